@@ -277,6 +277,14 @@ build_authtool() {
     popd >/dev/null
 }
 
+build_metabench() {
+    pre_build
+    pushd $SrcPath >/dev/null
+    echo -n "build cfs-metabench "
+    go build $MODFLAGS -ldflags "${LDFlags}" -o ${BuildBinPath}/cfs-metabench ${SrcPath}/cmd/metabench/*.go  && echo "success" || echo "failed"
+    popd >/dev/null
+}
+
 build_cli() {
     #cli need gorocksdb too
     pre_build_server
@@ -322,6 +330,9 @@ case "$cmd" in
     "cli")
         build_cli
         ;;
+    "metabench")
+        build_metabench
+        ;;
     "clean")
         clean
         ;;
@@ -15,7 +15,9 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"strconv"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -39,6 +41,7 @@ func (cmd *ChubaoFSCmd) newClusterCmd(client *master.MasterClient) *cobra.Comman
 		newClusterFreezeCmd(client),
 		newClusterSetThresholdCmd(client),
 		newClusterDeleteParasCmd(client),
+		newClusterBootstrapCmd(client),
 	)
 	return clusterCmd
 }
@@ -49,6 +52,7 @@ const (
 	cmdClusterFreezeShort    = "Freeze cluster"
 	cmdClusterThresholdShort = "Set memory threshold of metanodes"
 	cmdClusterDelParaShort   = "Set delete parameters"
+	cmdClusterBootstrapShort = "Bootstrap cluster with a topology manifest"
 	nodeDeleteBatchCountKey  = "batchCount"
 	nodeMarkDeleteRateKey    = "markDeleteRate"
 	nodeDeleteWorkerSleepMs  = "deleteWorkerSleepMs"
@@ -208,3 +212,52 @@ func newClusterDeleteParasCmd(client *master.MasterClient) *cobra.Command {
 
 	return cmd
 }
+
+func newClusterBootstrapCmd(client *master.MasterClient) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   CliOpBootstrap + " [MANIFEST FILE]",
+		Short: cmdClusterBootstrapShort,
+		Args:  cobra.MinimumNArgs(1),
+		Long: `Add the data nodes and meta nodes, and create the default volume described in the JSON manifest file:
+{
+  "DataNodes": [{"Addr": "192.168.0.11:17310", "ZoneName": "zone1"}],
+  "MetaNodes": [{"Addr": "192.168.0.21:17210", "ZoneName": "zone1"}],
+  "Volume": {"Name": "ltptest", "Owner": "ltptest", "Capacity": 100}
+}
+The steps which have been done are skipped, so the failed steps can be retried by running the command again.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err      error
+				data     []byte
+				manifest = &proto.BootstrapManifest{}
+				result   *proto.BootstrapResult
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			if data, err = ioutil.ReadFile(args[0]); err != nil {
+				err = fmt.Errorf("Read manifest fail: %v\n", err)
+				return
+			}
+			if err = json.Unmarshal(data, manifest); err != nil {
+				err = fmt.Errorf("Parse manifest fail: %v\n", err)
+				return
+			}
+			if result, err = client.AdminAPI().Bootstrap(manifest); err != nil {
+				return
+			}
+			stdout("%v\n", bootstrapStepTableHeader)
+			for _, step := range result.Steps {
+				stdout("%v\n", formatBootstrapStepTableRow(step))
+			}
+			if result.Failed > 0 {
+				err = fmt.Errorf("%v steps failed, run the command again to retry\n", result.Failed)
+				return
+			}
+			stdout("Bootstrap cluster successful!\n")
+		},
+	}
+	return cmd
+}
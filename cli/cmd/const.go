@@ -28,14 +28,18 @@ const (
 	CliOpDownloadZip       = "load"
 	CliOpMetaCompatibility = "meta"
 	CliOpFreeze            = "freeze"
+	CliOpUnfreeze          = "unfreeze"
 	CliOpSetThreshold      = "threshold"
 	CliOpSetDelRate        = "delelerate"
 	CliOpCheck             = "check"
 	CliOpReset             = "reset"
 	CliOpReplicate         = "add-replica"
 	CliOpDelReplica        = "del-replica"
+	CliOpCheckRef          = "check-ref"
+	CliOpCancelDelete      = "cancel-delete"
 	CliOpExpand              = "expand"
 	CliOpShrink              = "shrink"
+	CliOpBootstrap         = "bootstrap"
 
 	//Shorthand format of operation name
 	CliOpDecommissionShortHand = "dec"
@@ -73,6 +77,8 @@ const (
 	CliFlagDelBatchCount      = "delete-batch-count"
 	CliFlagDelWorkerSleepMs   = "delete-worker-sleep-ms"
 	CliFlagMarkDelRate        = "mark-delete-rate"
+	CliFlagMaxClients         = "max-clients"
+	CliFlagCaseInsensitive    = "case-insensitive"
 
 	//CliFlagSetDataPartitionCount	= "count" use dp-count instead
 
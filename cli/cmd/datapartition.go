@@ -39,6 +39,11 @@ func newDataPartitionCmd(client *master.MasterClient) *cobra.Command {
 		newDataPartitionDecommissionCmd(client),
 		newDataPartitionReplicateCmd(client),
 		newDataPartitionDeleteReplicaCmd(client),
+		newDataPartitionCheckRefCmd(client),
+		newDataPartitionDeleteCmd(client),
+		newDataPartitionCancelDeleteCmd(client),
+		newDataPartitionFreezeCmd(client),
+		newDataPartitionUnfreezeCmd(client),
 	)
 	return cmd
 }
@@ -49,6 +54,11 @@ const (
 	cmdDataPartitionDecommissionShort     = "Decommission a replication of the data partition to a new address"
 	cmdDataPartitionReplicateShort        = "Add a replication of the data partition on a new address"
 	cmdDataPartitionDeleteReplicaShort    = "Delete a replication of the data partition on a fixed address"
+	cmdDataPartitionCheckRefShort         = "Check the inodes referring to the data partition"
+	cmdDataPartitionDeleteShort           = "Delete a data partition which is not referenced by any inode"
+	cmdDataPartitionCancelDeleteShort     = "Cancel the deletion of a data partition"
+	cmdDataPartitionFreezeShort           = "Pin a data partition read-only, without any write, repair or delete"
+	cmdDataPartitionUnfreezeShort         = "Unfreeze a data partition"
 	)
 
 func newDataPartitionGetCmd(client *master.MasterClient) *cobra.Command {
@@ -268,3 +278,206 @@ func newDataPartitionDeleteReplicaCmd(client *master.MasterClient) *cobra.Comman
 	}
 	return cmd
 }
+
+func newDataPartitionCheckRefCmd(client *master.MasterClient) *cobra.Command {
+	var optLimit int
+	var cmd = &cobra.Command{
+		Use:   CliOpCheckRef + " [VOLUME] [DATA PARTITION ID]",
+		Short: cmdDataPartitionCheckRefShort,
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err         error
+				partitionID uint64
+				report      *proto.DataPartitionRefReport
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			volName := args[0]
+			if partitionID, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return
+			}
+			if report, err = client.AdminAPI().CheckDataPartitionRef(volName, partitionID, optLimit); err != nil {
+				return
+			}
+			stdout(formatDataPartitionRefReport(report))
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validVols(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().IntVar(&optLimit, "limit", 100, "Specify the max number of inodes to display")
+	return cmd
+}
+
+func newDataPartitionDeleteCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optYes   bool
+		optForce bool
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpDelete + " [VOLUME] [DATA PARTITION ID]",
+		Short: cmdDataPartitionDeleteShort,
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err         error
+				partitionID uint64
+				report      *proto.DataPartitionRefReport
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			volName := args[0]
+			if partitionID, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return
+			}
+			// ask user for confirm
+			if !optYes {
+				stdout("Delete data partition [%v] of volume [%v] (yes/no)[no]:", partitionID, volName)
+				var userConfirm string
+				_, _ = fmt.Scanln(&userConfirm)
+				if userConfirm != "yes" {
+					err = fmt.Errorf("Abort by user.\n")
+					return
+				}
+			}
+			report, err = client.AdminAPI().DeleteDataPartition(volName, partitionID, optForce)
+			if err == proto.ErrDataPartitionReferenced {
+				if report, err = client.AdminAPI().CheckDataPartitionRef(volName, partitionID, 100); err != nil {
+					return
+				}
+				stdout(formatDataPartitionRefReport(report))
+				err = fmt.Errorf("Data partition is still referenced, use --force to migrate the referenced extents.\n")
+				return
+			}
+			if err != nil {
+				return
+			}
+			if report.ExtentKeyCount != 0 {
+				stdout("Migrating %v extent keys of %v inodes...\n", report.ExtentKeyCount, report.InodeCount)
+				if err = migrateDataPartition(client, volName, partitionID); err != nil {
+					err = fmt.Errorf("Migrate data partition failed, the deletion is pending until no inode refers to it:\n%v\n", err)
+					return
+				}
+			}
+			stdout("Data partition is marked to be deleted.\n")
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validVols(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().BoolVarP(&optYes, "yes", "y", false, "Answer yes for all questions")
+	cmd.Flags().BoolVarP(&optForce, "force", "f", false, "Migrate the referenced extents to the other data partitions before deleting")
+	return cmd
+}
+
+func newDataPartitionCancelDeleteCmd(client *master.MasterClient) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   CliOpCancelDelete + " [VOLUME] [DATA PARTITION ID]",
+		Short: cmdDataPartitionCancelDeleteShort,
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err         error
+				partitionID uint64
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			volName := args[0]
+			if partitionID, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return
+			}
+			if err = client.AdminAPI().CancelDeleteDataPartition(volName, partitionID); err != nil {
+				return
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validVols(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	return cmd
+}
+
+func newDataPartitionFreezeCmd(client *master.MasterClient) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   CliOpFreeze + " [VOLUME] [DATA PARTITION ID]",
+		Short: cmdDataPartitionFreezeShort,
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err         error
+				partitionID uint64
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			volName := args[0]
+			if partitionID, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return
+			}
+			if err = client.AdminAPI().FreezeDataPartition(volName, partitionID); err != nil {
+				return
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validVols(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	return cmd
+}
+
+func newDataPartitionUnfreezeCmd(client *master.MasterClient) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   CliOpUnfreeze + " [VOLUME] [DATA PARTITION ID]",
+		Short: cmdDataPartitionUnfreezeShort,
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err         error
+				partitionID uint64
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			volName := args[0]
+			if partitionID, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return
+			}
+			if err = client.AdminAPI().UnfreezeDataPartition(volName, partitionID); err != nil {
+				return
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validVols(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	return cmd
+}
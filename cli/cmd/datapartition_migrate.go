@@ -0,0 +1,213 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/data/stream"
+	"github.com/chubaofs/chubaofs/sdk/master"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+const (
+	migrateChunkSize  = 4 * util.MB
+	migrateInodeBatch = 100
+)
+
+// extentMigrator copies the extents of a data partition to the other data partitions of the volume,
+// and replaces the extent keys of the inodes referring to them.
+//
+// The data partition must be read-only before the migration, so that the copies are written to the other
+// data partitions. The files should not be modified during the migration, an extent key is not replaced
+// if it has been changed while it is copied.
+type extentMigrator struct {
+	partitionID uint64
+	mw          *meta.MetaWrapper
+	ec          *stream.ExtentClient
+}
+
+func newExtentMigrator(client *master.MasterClient, volName string, partitionID uint64) (m *extentMigrator, err error) {
+	m = &extentMigrator{partitionID: partitionID}
+	if m.mw, err = meta.NewMetaWrapper(&meta.MetaConfig{
+		Volume:  volName,
+		Masters: client.Nodes(),
+	}); err != nil {
+		return
+	}
+	if m.ec, err = stream.NewExtentClient(&stream.ExtentConfig{
+		Volume:            volName,
+		Masters:           client.Nodes(),
+		OnAppendExtentKey: m.mw.AppendExtentKey,
+		OnGetExtents:      m.mw.GetExtents,
+		OnTruncate:        m.mw.Truncate,
+	}); err != nil {
+		_ = m.mw.Close()
+		return
+	}
+	return
+}
+
+func (m *extentMigrator) close() {
+	_ = m.ec.Close()
+	_ = m.mw.Close()
+}
+
+// migrateInode migrates the extent keys of the inode which refer to the data partition.
+func (m *extentMigrator) migrateInode(ino uint64) (migrated int, err error) {
+	_, _, eks, err := m.mw.GetExtents(ino)
+	if err != nil {
+		return
+	}
+	if err = m.ec.OpenStream(ino); err != nil {
+		return
+	}
+	defer func() {
+		_ = m.ec.CloseStream(ino)
+		_ = m.ec.EvictStream(ino)
+	}()
+	for _, ek := range eks {
+		if ek.PartitionId != m.partitionID {
+			continue
+		}
+		if err = m.migrateExtentKey(ino, ek); err != nil {
+			err = fmt.Errorf("migrate extent key %v: %v", ek, err)
+			return
+		}
+		migrated++
+	}
+	return
+}
+
+// migrateExtentKey copies the data of the extent key to a temporary inode at the same file offset,
+// so that the new extent key replaces the old one exactly when it is appended to the inode.
+func (m *extentMigrator) migrateExtentKey(ino uint64, ek proto.ExtentKey) (err error) {
+	tmp, err := m.mw.InodeCreate_ll(proto.Mode(os.ModePerm), 0, 0, nil)
+	if err != nil {
+		return
+	}
+	var attached bool
+	defer func() {
+		_ = m.ec.CloseStream(tmp.Inode)
+		_ = m.ec.EvictStream(tmp.Inode)
+		if attached {
+			// the new extent belongs to the inode now, so the temporary inode is removed without deleting its data
+			_ = m.mw.InodeDelete_ll(tmp.Inode)
+			return
+		}
+		if _, e := m.mw.InodeUnlink_ll(tmp.Inode); e == nil {
+			_ = m.mw.Evict(tmp.Inode)
+		}
+	}()
+	if err = m.ec.OpenStream(tmp.Inode); err != nil {
+		return
+	}
+
+	buf := make([]byte, migrateChunkSize)
+	for copied := 0; copied < int(ek.Size); {
+		size := int(ek.Size) - copied
+		if size > len(buf) {
+			size = len(buf)
+		}
+		offset := int(ek.FileOffset) + copied
+		var read int
+		if read, err = m.ec.Read(ino, buf[:size], offset, size); err != nil && err != io.EOF {
+			return
+		}
+		if read != size {
+			return fmt.Errorf("read %v bytes at offset %v, expect %v", read, offset, size)
+		}
+		if _, err = m.ec.Write(tmp.Inode, offset, buf[:size], 0); err != nil {
+			return
+		}
+		copied += size
+	}
+	if err = m.ec.Flush(tmp.Inode); err != nil {
+		return
+	}
+
+	_, _, newEks, err := m.mw.GetExtents(tmp.Inode)
+	if err != nil {
+		return
+	}
+	if len(newEks) != 1 || newEks[0].FileOffset != ek.FileOffset || newEks[0].Size != ek.Size ||
+		newEks[0].PartitionId == m.partitionID {
+		return fmt.Errorf("unexpected extent keys %v of the copy", newEks)
+	}
+	_, _, eks, err := m.mw.GetExtents(ino)
+	if err != nil {
+		return
+	}
+	if !containsExtentKey(eks, ek) {
+		return fmt.Errorf("extent key is changed during the migration")
+	}
+	if err = m.mw.AppendExtentKey(ino, newEks[0]); err != nil {
+		return
+	}
+	attached = true
+	return
+}
+
+func containsExtentKey(eks []proto.ExtentKey, ek proto.ExtentKey) bool {
+	for _, key := range eks {
+		if key.FileOffset == ek.FileOffset && key.PartitionId == ek.PartitionId &&
+			key.ExtentId == ek.ExtentId && key.ExtentOffset == ek.ExtentOffset && key.Size == ek.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateDataPartition migrates all the extent keys referring to the data partition,
+// until no extent key can be migrated any more.
+func migrateDataPartition(client *master.MasterClient, volName string, partitionID uint64) (err error) {
+	migrator, err := newExtentMigrator(client, volName, partitionID)
+	if err != nil {
+		return
+	}
+	defer migrator.close()
+
+	failed := make(map[uint64]struct{})
+	for {
+		var report *proto.DataPartitionRefReport
+		if report, err = client.AdminAPI().CheckDataPartitionRef(volName, partitionID, migrateInodeBatch+len(failed)); err != nil {
+			return
+		}
+		if report.ExtentKeyCount == 0 {
+			return
+		}
+		var migrated int
+		for _, ino := range report.Inodes {
+			if _, ok := failed[ino]; ok {
+				continue
+			}
+			n, e := migrator.migrateInode(ino)
+			migrated += n
+			if e != nil {
+				failed[ino] = struct{}{}
+				stdout("Migrate inode %v failed: %v\n", ino, e)
+			}
+		}
+		stdout("Migrated %v extent keys, %v extent keys of %v inodes remain\n",
+			migrated, int(report.ExtentKeyCount)-migrated, report.InodeCount)
+		if migrated == 0 {
+			return fmt.Errorf("%v extent keys of %v inodes can not be migrated", report.ExtentKeyCount, report.InodeCount)
+		}
+	}
+}
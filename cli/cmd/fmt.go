@@ -94,6 +94,9 @@ func formatSimpleVolView(svv *proto.SimpleVolView) string {
 	sb.WriteString(fmt.Sprintf("  Name                 : %v\n", svv.Name))
 	sb.WriteString(fmt.Sprintf("  Owner                : %v\n", svv.Owner))
 	sb.WriteString(fmt.Sprintf("  Zone                 : %v\n", svv.ZoneName))
+	if svv.ColdZone != "" {
+		sb.WriteString(fmt.Sprintf("  Cold zone            : %v\n", svv.ColdZone))
+	}
 	sb.WriteString(fmt.Sprintf("  Status               : %v\n", formatVolumeStatus(svv.Status)))
 	sb.WriteString(fmt.Sprintf("  Capacity             : %v GB\n", svv.Capacity))
 	sb.WriteString(fmt.Sprintf("  Create time          : %v\n", svv.CreateTime))
@@ -101,6 +104,15 @@ func formatSimpleVolView(svv *proto.SimpleVolView) string {
 	sb.WriteString(fmt.Sprintf("  Follower read        : %v\n", formatEnabledDisabled(svv.FollowerRead)))
 	sb.WriteString(fmt.Sprintf("  Enable token         : %v\n", formatEnabledDisabled(svv.EnableToken)))
 	sb.WriteString(fmt.Sprintf("  Cross zone           : %v\n", formatEnabledDisabled(svv.CrossZone)))
+	sb.WriteString(fmt.Sprintf("  Case insensitive     : %v\n", formatYesNo(svv.CaseInsensitive)))
+	sb.WriteString(fmt.Sprintf("  Meta cache           : %v\n", formatEnabledDisabled(svv.MetaCache)))
+	sb.WriteString(fmt.Sprintf("  Clients              : %v / %v\n", svv.Clients, formatMaxClients(svv.MaxClients)))
+	sb.WriteString(fmt.Sprintf("  Sync on rename       : %v\n", formatEnabledDisabled(svv.SyncOnRename)))
+	sb.WriteString(fmt.Sprintf("  Require token        : %v\n", formatYesNo(svv.RequireToken)))
+	sb.WriteString(fmt.Sprintf("  Name policy          : %v\n", svv.NamePolicy.String()))
+	if svv.Features[proto.FeatureDedup] {
+		sb.WriteString(fmt.Sprintf("  Dedup ratio          : %v\n", formatDedupStat(&svv.DedupStat)))
+	}
 	sb.WriteString(fmt.Sprintf("  Inode count          : %v\n", svv.InodeCount))
 	sb.WriteString(fmt.Sprintf("  Dentry count         : %v\n", svv.DentryCount))
 	sb.WriteString(fmt.Sprintf("  Max metaPartition ID : %v\n", svv.MaxMetaPartitionID))
@@ -111,6 +123,15 @@ func formatSimpleVolView(svv *proto.SimpleVolView) string {
 	return sb.String()
 }
 
+func formatDedupStat(stat *proto.DedupStat) string {
+	var ratio float64 = 1
+	if stat.PhysicalBytes > 0 {
+		ratio = float64(stat.LogicalBytes) / float64(stat.PhysicalBytes)
+	}
+	return fmt.Sprintf("%.2f (logical %v, physical %v, blocks %v)",
+		ratio, formatSize(stat.LogicalBytes), formatSize(stat.PhysicalBytes), stat.Blocks)
+}
+
 func formatVolumeStatus(status uint8) string {
 	switch status {
 	case 0:
@@ -168,6 +189,7 @@ func formatDataPartitionInfo(partition *proto.DataPartitionInfo) string {
 	sb.WriteString(fmt.Sprintf("volume ID     : %v\n", partition.VolID))
 	sb.WriteString(fmt.Sprintf("PartitionID   : %v\n", partition.PartitionID))
 	sb.WriteString(fmt.Sprintf("Status        : %v\n", formatDataPartitionStatus(partition.Status)))
+	sb.WriteString(fmt.Sprintf("Frozen        : %v\n", formatYesNo(partition.IsFrozen)))
 	sb.WriteString(fmt.Sprintf("LastLoadedTime: %v\n", formatTime(partition.LastLoadedTime)))
 	sb.WriteString("\n")
 	sb.WriteString(fmt.Sprintf("Replicas : \n"))
@@ -273,6 +295,15 @@ func formatUserInfoTableRow(userInfo *proto.UserInfo) string {
 		userInfo.UserID, formatUserType(userInfo.UserType), userInfo.AccessKey, userInfo.SecretKey, userInfo.CreateTime)
 }
 
+var (
+	bootstrapStepTablePattern = "%-12v    %-24v    %-8v    %v"
+	bootstrapStepTableHeader  = fmt.Sprintf(bootstrapStepTablePattern, "ACTION", "TARGET", "STATUS", "MESSAGE")
+)
+
+func formatBootstrapStepTableRow(step *proto.BootstrapStep) string {
+	return fmt.Sprintf(bootstrapStepTablePattern, step.Action, step.Target, step.Status, step.Msg)
+}
+
 func formatDataPartitionStatus(status int8) string {
 	switch status {
 	case 1:
@@ -328,6 +359,13 @@ func formatYesNo(b bool) string {
 	return "No"
 }
 
+func formatMaxClients(maxClients int) string {
+	if maxClients == 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(maxClients)
+}
+
 func formatEnabledDisabled(b bool) string {
 	if b {
 		return "Enabled"
@@ -386,6 +424,9 @@ func formatDataReplica(indentation string, replica *proto.DataReplica, rowTable
 	sb.WriteString(fmt.Sprintf("%v  NeedsToCompare : %v\n", indentation, replica.NeedsToCompare))
 	sb.WriteString(fmt.Sprintf("%v  Status         : %v\n", indentation, formatDataPartitionStatus(replica.Status)))
 	sb.WriteString(fmt.Sprintf("%v  DiskPath       : %v\n", indentation, replica.DiskPath))
+	sb.WriteString(fmt.Sprintf("%v  Frozen         : %v\n", indentation, formatYesNo(replica.IsFrozen)))
+	sb.WriteString(fmt.Sprintf("%v  TinyExtents    : %v available, %v broken\n", indentation,
+		replica.AvailableTinyExtents, replica.BrokenTinyExtents))
 	sb.WriteString(fmt.Sprintf("%v  ReportTime     : %v\n", indentation, formatTime(replica.ReportTime)))
 	return sb.String()
 }
@@ -496,3 +537,16 @@ func formatZoneView(zv *proto.ZoneView) string {
 	}
 	return sb.String()
 }
+
+func formatDataPartitionRefReport(report *proto.DataPartitionRefReport) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Volume          : %v\n", report.VolName))
+	sb.WriteString(fmt.Sprintf("PartitionID     : %v\n", report.PartitionID))
+	sb.WriteString(fmt.Sprintf("Pending delete  : %v\n", formatYesNo(report.IsPendingDelete)))
+	sb.WriteString(fmt.Sprintf("Extent keys     : %v\n", report.ExtentKeyCount))
+	sb.WriteString(fmt.Sprintf("Inodes          : %v\n", report.InodeCount))
+	if len(report.Inodes) != 0 {
+		sb.WriteString(fmt.Sprintf("Sample inodes   : %v\n", report.Inodes))
+	}
+	return sb.String()
+}
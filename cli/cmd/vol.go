@@ -47,6 +47,7 @@ func newVolCmd(client *master.MasterClient) *cobra.Command {
 		newVolSetCmd(client),
 		newVolInfoCmd(client),
 		newVolDeleteCmd(client),
+		newVolUndeleteCmd(client),
 		newVolTransferCmd(client),
 		newVolAddDPCmd(client),
 	)
@@ -103,6 +104,7 @@ func newVolCreateCmd(client *master.MasterClient) *cobra.Command {
 	var optFollowerRead bool
 	var optYes bool
 	var optZoneName string
+	var optCaseInsensitive bool
 	var cmd = &cobra.Command{
 		Use:   cmdVolCreateUse,
 		Short: cmdVolCreateShort,
@@ -127,6 +129,7 @@ func newVolCreateCmd(client *master.MasterClient) *cobra.Command {
 				stdout("  Replicas            : %v\n", optReplicas)
 				stdout("  Allow follower read : %v\n", formatEnabledDisabled(optFollowerRead))
 				stdout("  ZoneName            : %v\n", optZoneName)
+				stdout("  Case insensitive    : %v\n", formatYesNo(optCaseInsensitive))
 				stdout("\nConfirm (yes/no)[yes]: ")
 				var userConfirm string
 				_, _ = fmt.Scanln(&userConfirm)
@@ -138,7 +141,7 @@ func newVolCreateCmd(client *master.MasterClient) *cobra.Command {
 
 			err = client.AdminAPI().CreateVolume(
 				volumeName, userID, optMPCount, optDPSize,
-				optCapacity, optReplicas, optFollowerRead, optZoneName)
+				optCapacity, optReplicas, optFollowerRead, optZoneName, optCaseInsensitive)
 			if err != nil {
 				err = fmt.Errorf("Create volume failed case:\n%v\n", err)
 				return
@@ -153,6 +156,7 @@ func newVolCreateCmd(client *master.MasterClient) *cobra.Command {
 	cmd.Flags().IntVar(&optReplicas, CliFlagReplicas, cmdVolDefaultReplicas, "Specify data partition replicas number")
 	cmd.Flags().BoolVar(&optFollowerRead, CliFlagEnableFollowerRead, cmdVolDefaultFollowerReader, "Enable read form replica follower")
 	cmd.Flags().StringVar(&optZoneName, CliFlagZoneName, cmdVolDefaultZoneName, "Specify volume zone name")
+	cmd.Flags().BoolVar(&optCaseInsensitive, CliFlagCaseInsensitive, false, "Look up the file names case-insensitively, which cannot be changed later")
 	cmd.Flags().BoolVarP(&optYes, "yes", "y", false, "Answer yes for all questions")
 	return cmd
 }
@@ -166,6 +170,7 @@ func newVolSetCmd(client *master.MasterClient) *cobra.Command {
 	var optAuthenticate string
 	var optEnableToken string
 	var optZoneName string
+	var optMaxClients int
 	var optYes bool
 	var confirmString = strings.Builder{}
 	var vv *proto.SimpleVolView
@@ -242,6 +247,12 @@ func newVolSetCmd(client *master.MasterClient) *cobra.Command {
 			} else {
 				confirmString.WriteString(fmt.Sprintf("  ZoneName            : %v\n", vv.ZoneName))
 			}
+			if optMaxClients >= 0 {
+				isChange = true
+				confirmString.WriteString(fmt.Sprintf("  Max clients         : %v -> %v\n", formatMaxClients(vv.MaxClients), formatMaxClients(optMaxClients)))
+			} else {
+				confirmString.WriteString(fmt.Sprintf("  Max clients         : %v\n", formatMaxClients(vv.MaxClients)))
+			}
 			if vv.CrossZone == true && "" != optZoneName {
 				err = fmt.Errorf("Can not set zone name of the volume that cross zone\n")
 			}
@@ -268,6 +279,11 @@ func newVolSetCmd(client *master.MasterClient) *cobra.Command {
 			if err != nil {
 				return
 			}
+			if optMaxClients >= 0 {
+				if err = client.AdminAPI().SetVolMaxClients(vv.Name, optMaxClients); err != nil {
+					return
+				}
+			}
 			stdout("Volume configuration has been set successfully.\n")
 			return
 		},
@@ -284,6 +300,7 @@ func newVolSetCmd(client *master.MasterClient) *cobra.Command {
 	cmd.Flags().StringVar(&optAuthenticate, CliFlagAuthenticate, "", "Enable authenticate")
 	cmd.Flags().StringVar(&optEnableToken, CliFlagEnableToken, "", "ReadOnly/ReadWrite token validation for fuse client")
 	cmd.Flags().StringVar(&optZoneName, CliFlagZoneName, "", "Specify volume zone name")
+	cmd.Flags().IntVar(&optMaxClients, CliFlagMaxClients, -1, "Specify the maximum number of the mounted clients, 0 for unlimited")
 	cmd.Flags().BoolVarP(&optYes, "yes", "y", false, "Answer yes for all questions")
 	return cmd
 }
@@ -421,6 +438,45 @@ func newVolDeleteCmd(client *master.MasterClient) *cobra.Command {
 	return cmd
 }
 
+const (
+	cmdVolUndeleteUse   = "undelete [VOLUME NAME]"
+	cmdVolUndeleteShort = "Restore a volume deleted within the grace period"
+)
+
+func newVolUndeleteCmd(client *master.MasterClient) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   cmdVolUndeleteUse,
+		Short: cmdVolUndeleteShort,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			var volumeName = args[0]
+			defer func() {
+				if err != nil {
+					errout("Error: %v", err)
+				}
+			}()
+			var svv *proto.SimpleVolView
+			if svv, err = client.AdminAPI().GetVolumeSimpleInfo(volumeName); err != nil {
+				err = fmt.Errorf("Undelete volume failed:\n%v\n", err)
+				return
+			}
+			if err = client.AdminAPI().UndeleteVolume(volumeName, calcAuthKey(svv.Owner)); err != nil {
+				err = fmt.Errorf("Undelete volume failed:\n%v\n", err)
+				return
+			}
+			stdout("Undelete volume success.\n")
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validVols(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	return cmd
+}
+
 const (
 	cmdVolTransferUse   = "transfer [VOLUME NAME] [USER ID]"
 	cmdVolTransferShort = "Transfer volume to another user. (Change owner of volume)"
@@ -0,0 +1,130 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"sync"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultAsyncCloseQueueSize = 1024
+	DefaultAsyncCloseWorkers   = 8
+)
+
+// streamCloser closes the streams of the inodes, which is the extent client.
+type streamCloser interface {
+	CloseStream(inode uint64) error
+}
+
+// AsyncCloser offloads the flush of the released files from the release request, so that closing a file does not
+// wait for the dirty data to be written to the data nodes. The failure of a deferred flush is kept until it is
+// reported by the following fsync, or by the next open in strict mode.
+type AsyncCloser struct {
+	sync.Mutex
+	cond    *sync.Cond
+	ec      streamCloser
+	metrics *Metrics
+	strict  bool
+	closed  bool
+	queue   chan uint64
+	pending map[uint64]int
+	errs    map[uint64]error
+	wg      sync.WaitGroup
+}
+
+// NewAsyncCloser returns a new AsyncCloser.
+func NewAsyncCloser(ec streamCloser, metrics *Metrics, queueSize int, strict bool) *AsyncCloser {
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncCloseQueueSize
+	}
+	ac := &AsyncCloser{
+		ec:      ec,
+		metrics: metrics,
+		strict:  strict,
+		queue:   make(chan uint64, queueSize),
+		pending: make(map[uint64]int),
+		errs:    make(map[uint64]error),
+	}
+	ac.cond = sync.NewCond(ac)
+	for i := 0; i < DefaultAsyncCloseWorkers; i++ {
+		ac.wg.Add(1)
+		go ac.work()
+	}
+	return ac
+}
+
+// Enqueue queues the stream of the inode to be closed without blocking. It returns false if the queue is full or
+// the closer is stopped, and the caller should close the stream by itself.
+func (ac *AsyncCloser) Enqueue(ino uint64) bool {
+	ac.Lock()
+	defer ac.Unlock()
+	if ac.closed {
+		return false
+	}
+	select {
+	case ac.queue <- ino:
+		ac.pending[ino]++
+		ac.metrics.deferredClose()
+		return true
+	default:
+		return false
+	}
+}
+
+func (ac *AsyncCloser) work() {
+	defer ac.wg.Done()
+	for ino := range ac.queue {
+		err := ac.ec.CloseStream(ino)
+		ac.Lock()
+		if err != nil {
+			log.LogErrorf("AsyncCloser: deferred close failed, ino(%v) err(%v)", ino, err)
+			ac.errs[ino] = err
+			ac.metrics.deferredCloseFailure()
+		}
+		if ac.pending[ino]--; ac.pending[ino] <= 0 {
+			delete(ac.pending, ino)
+		}
+		ac.cond.Broadcast()
+		ac.Unlock()
+	}
+}
+
+// Wait waits for the queued closes of the inode to finish, and returns the error of the failed ones if any.
+// The returned error is consumed, so it is reported only once.
+func (ac *AsyncCloser) Wait(ino uint64) (err error) {
+	ac.Lock()
+	defer ac.Unlock()
+	for ac.pending[ino] > 0 {
+		ac.cond.Wait()
+	}
+	err = ac.errs[ino]
+	delete(ac.errs, ino)
+	return
+}
+
+// Stop stops accepting new closes, and waits for the queued ones to finish.
+func (ac *AsyncCloser) Stop() {
+	ac.Lock()
+	if ac.closed {
+		ac.Unlock()
+		return
+	}
+	ac.closed = true
+	close(ac.queue)
+	ac.Unlock()
+	ac.wg.Wait()
+}
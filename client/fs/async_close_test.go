@@ -0,0 +1,101 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingCloser closes the streams once released, and fails those of the inodes given.
+type blockingCloser struct {
+	sync.Mutex
+	release chan struct{}
+	failed  map[uint64]error
+	closed  []uint64
+}
+
+func (c *blockingCloser) CloseStream(ino uint64) error {
+	<-c.release
+	c.Lock()
+	c.closed = append(c.closed, ino)
+	c.Unlock()
+	return c.failed[ino]
+}
+
+func TestAsyncCloseWait(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	closer := &blockingCloser{release: make(chan struct{}), failed: map[uint64]error{2: errFlush}}
+	metrics := NewMetrics()
+	ac := NewAsyncCloser(closer, metrics, 0, false)
+	defer ac.Stop()
+	if !ac.Enqueue(1) || !ac.Enqueue(2) {
+		t.Fatalf("the closes should be queued")
+	}
+
+	// the fsync waits for the deferred close of the file
+	done := make(chan error, 1)
+	go func() {
+		done <- ac.Wait(2)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the wait returns before the deferred close is done, err %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(closer.release)
+	if err := <-done; err != errFlush {
+		t.Fatalf("expect the error of the deferred close, but is %v", err)
+	}
+	// the error is reported only once
+	if err := ac.Wait(2); err != nil {
+		t.Fatalf("the error reported should be consumed, but is %v", err)
+	}
+	if err := ac.Wait(1); err != nil {
+		t.Fatalf("unexpected err %v", err)
+	}
+	if metrics.deferredCloses != 2 || metrics.deferredCloseFailures != 1 {
+		t.Fatalf("unexpected deferred closes %v failures %v", metrics.deferredCloses, metrics.deferredCloseFailures)
+	}
+}
+
+func TestAsyncCloseQueueFull(t *testing.T) {
+	closer := &blockingCloser{release: make(chan struct{})}
+	ac := NewAsyncCloser(closer, NewMetrics(), 1, false)
+
+	// the workers are blocked, and the release closes the stream by itself once the queue is full
+	accepted := 0
+	for ino := uint64(1); ino <= DefaultAsyncCloseWorkers+2; ino++ {
+		if !ac.Enqueue(ino) {
+			break
+		}
+		accepted++
+	}
+	if accepted == 0 || accepted > DefaultAsyncCloseWorkers+1 {
+		t.Fatalf("expect the queue to be full, but %v closes are accepted", accepted)
+	}
+
+	// the queued closes are done before the stop returns
+	close(closer.release)
+	ac.Stop()
+	if len(closer.closed) != accepted {
+		t.Fatalf("expect %v closes done, but are %v", accepted, closer.closed)
+	}
+	if ac.Enqueue(100) {
+		t.Fatalf("the stopped closer should not accept any close")
+	}
+}
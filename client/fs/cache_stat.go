@@ -0,0 +1,93 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// CacheStat defines the statistics of the inode and dentry caches of a mount, along with the memory of the process.
+type CacheStat struct {
+	Volume string
+
+	Inodes         int
+	MaxInodes      int
+	InodeEvictions uint64
+
+	DentryDirs      int
+	Dentries        int
+	MaxDentries     int
+	DentryEvictions uint64
+
+	DirPrefetch PrefetchStat
+
+	HeapAlloc    uint64
+	HeapSys      uint64
+	HeapReleased uint64
+	NumGC        uint32
+	LastGC       int64
+	PauseTotalNs uint64
+
+	Pressure *proto.ResourcePressure
+}
+
+// CacheStat returns the statistics of the caches.
+func (s *Super) CacheStat() *CacheStat {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stat := &CacheStat{
+		Volume:         s.volname,
+		Inodes:         s.ic.Len(),
+		MaxInodes:      s.ic.MaxElements(),
+		InodeEvictions: s.ic.Evictions(),
+		MaxDentries:    s.dcacheLRU.MaxElements(),
+		HeapAlloc:      ms.HeapAlloc,
+		HeapSys:        ms.HeapSys,
+		HeapReleased:   ms.HeapReleased,
+		NumGC:          ms.NumGC,
+		LastGC:         time.Unix(0, int64(ms.LastGC)).Unix(),
+		PauseTotalNs:   ms.PauseTotalNs,
+		Pressure:       s.pressure.Stat(),
+	}
+	stat.DentryDirs, stat.Dentries, stat.DentryEvictions = s.dcacheLRU.Stat()
+	stat.DirPrefetch = s.prefetcher.Stat()
+	return stat
+}
+
+// GetCacheStat handles the control command to get the statistics of the caches.
+func (s *Super) GetCacheStat(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(s.CacheStat())
+	if err != nil {
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(data)
+}
+
+// relieveCachePressure evicts a batch of the least recently used inodes and dentries when the memory pressure
+// rises, so that the memory is returned to the OS by the monitor afterwards.
+func (s *Super) relieveCachePressure() {
+	inodes := s.ic.EvictBatch(int(float64(s.ic.Len()) * PressureEvictRatio))
+	_, dentries, _ := s.dcacheLRU.Stat()
+	dentries = s.dcacheLRU.EvictBatch(int(float64(dentries) * PressureEvictRatio))
+	s.prefetcher.Purge()
+	log.LogWarnf("relieveCachePressure: volume(%v) evicts inodes(%v) dentries(%v)", s.volname, inodes, dentries)
+}
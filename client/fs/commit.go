@@ -0,0 +1,101 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"strings"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// resolveStagingDir looks up the staging directory by its path relative to the directory.
+func (s *Super) resolveStagingDir(parentID uint64, path string) (ino uint64, err error) {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return 0, fuse.Errno(syscall.EINVAL)
+	}
+	ino = parentID
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." || name == ".." {
+			return 0, fuse.Errno(syscall.EINVAL)
+		}
+		var mode uint32
+		if ino, mode, err = s.mw.Lookup_ll(ino, name); err != nil {
+			return 0, ParseError(err)
+		}
+		if !proto.IsDir(mode) {
+			return 0, fuse.Errno(syscall.ENOTDIR)
+		}
+	}
+	return ino, nil
+}
+
+// commit moves all the entries of the staging directory into the directory at once, so that the readers of the
+// directory observe either none or all of them. The staging directory is left empty.
+func (d *Dir) commit(stagingPath string) (err error) {
+	start := time.Now()
+	metric := d.super.metrics.Begin("commit")
+	defer func() { metric.End(err) }()
+
+	ino := d.info.Inode
+	staging, err := d.super.resolveStagingDir(ino, stagingPath)
+	if err != nil {
+		log.LogErrorf("Commit: parent(%v) staging(%v) err(%v)", ino, stagingPath, err)
+		return err
+	}
+	children, err := d.super.mw.ReadDir_ll(staging)
+	if err != nil {
+		log.LogErrorf("Commit: parent(%v) staging(%v) err(%v)", ino, stagingPath, err)
+		return ParseError(err)
+	}
+	items := make([]proto.BatchRenameItem, 0, len(children))
+	names := make([]string, 0, len(children))
+	for _, child := range children {
+		items = append(items, proto.BatchRenameItem{
+			SrcName: child.Name,
+			DstName: child.Name,
+			Inode:   child.Inode,
+			Type:    child.Type,
+		})
+		names = append(names, child.Name)
+	}
+	if err = d.super.mw.BatchRename(staging, ino, items); err != nil {
+		log.LogErrorf("Commit: parent(%v) staging(%v) entries(%v) err(%v)", ino, stagingPath, len(items), err)
+		err = ParseError(err)
+	}
+
+	// drop the moved entries even on failure, which may have moved them
+	d.super.ic.Delete(ino)
+	d.super.ic.Delete(staging)
+	for _, name := range names {
+		d.dcache.Delete(name)
+	}
+	// the kernel entries are invalidated outside of the request, which holds the lock of the directory
+	go func() {
+		for _, name := range names {
+			d.super.invalidateDentry(staging, name)
+			d.super.invalidateDentry(ino, name)
+		}
+	}()
+
+	log.LogDebugf("TRACE Commit: parent(%v) staging(%v) entries(%v) (%v)ns", ino, stagingPath, len(items),
+		time.Since(start).Nanoseconds())
+	return
+}
@@ -35,6 +35,10 @@ const (
 const (
 	DefaultInodeExpiration = 120 * time.Second
 	MaxInodeCache          = 10000000 // in terms of the number of items
+	MaxDentryCache         = 10000000 // in terms of the number of items
+
+	// the ratio of the cached inodes and dentries evicted when the memory pressure rises
+	PressureEvictRatio = 0.5
 )
 
 const (
@@ -46,6 +50,22 @@ const (
 	DeleteExtentsTimeout = 600 * time.Second
 )
 
+const (
+	// the xattr to get the SHA256 checksum of a file, which is computed by the meta node on demand
+	ChecksumXattrName = "user." + proto.XAttrKeyChecksumSHA256
+	// the xattr to verify the replicas of the extents of a file, whose value is the report in json
+	VerifyXattrName = "user.cfs.verify"
+	// the xattr set on a directory to move all the entries of the staging directory, whose path relative to the
+	// directory is the value, into the directory at once
+	CommitXattrName = "user.cfs.commit"
+	// the xattr set on a directory to hint the upcoming accesses, PrefetchHintStat or PrefetchHintTree, so that the
+	// entries and the attributes are prefetched ahead of them
+	PrefetchXattrName = "user.cfs.prefetch"
+	// the xattr to get the birth time of a file in RFC3339 with nanoseconds, since the birth time can not be reported
+	// by statx through the FUSE protocol
+	BirthTimeXattrName = "user.cfs.btime"
+)
+
 var (
 	// The following two are used in the FUSE cache
 	// every time the lookup will be performed on the fly, and the result will not be cached
@@ -62,7 +82,8 @@ func ParseError(err error) fuse.Errno {
 	case fuse.Errno:
 		return v
 	default:
-		return fuse.ENOSYS
+		// the other errors are reported as the errnos of their codes in the error catalog
+		return fuse.Errno(proto.ErrnoOf(err))
 	}
 }
 
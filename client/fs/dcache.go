@@ -15,6 +15,7 @@
 package fs
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
@@ -61,6 +62,20 @@ func (dc *DentryCache) Get(name string) (uint64, bool) {
 	return ino, ok
 }
 
+// Clear deletes all the items, and returns their keys.
+func (dc *DentryCache) Clear() (names []string) {
+	if dc == nil {
+		return
+	}
+	dc.Lock()
+	defer dc.Unlock()
+	for name := range dc.cache {
+		names = append(names, name)
+	}
+	dc.cache = make(map[string]uint64)
+	return
+}
+
 // Delete deletes the item based on the given key.
 func (dc *DentryCache) Delete(name string) {
 	if dc == nil {
@@ -70,3 +85,129 @@ func (dc *DentryCache) Delete(name string) {
 	defer dc.Unlock()
 	delete(dc.cache, name)
 }
+
+// Len returns the number of the cached dentries.
+func (dc *DentryCache) Len() int {
+	if dc == nil {
+		return 0
+	}
+	dc.Lock()
+	defer dc.Unlock()
+	return len(dc.cache)
+}
+
+// DentryCacheLRU bounds the total number of the dentries cached by the directories of a mount. The dentry caches
+// are evicted as a whole, starting from the least recently used directory. A dentry cache is accounted by its size
+// when it is filled by the readdir, since it only shrinks afterwards.
+type DentryCacheLRU struct {
+	sync.Mutex
+	cache       map[*DentryCache]*list.Element
+	lruList     *list.List
+	count       int
+	maxElements int
+	evictions   uint64
+}
+
+type dcacheElement struct {
+	dc   *DentryCache
+	size int
+}
+
+// NewDentryCacheLRU returns a new DentryCacheLRU.
+func NewDentryCacheLRU(maxElements int) *DentryCacheLRU {
+	return &DentryCacheLRU{
+		cache:       make(map[*DentryCache]*list.Element),
+		lruList:     list.New(),
+		maxElements: maxElements,
+	}
+}
+
+// Put replaces the old dentry cache of a directory with the filled one, and evicts the least recently used dentry
+// caches of the other directories once the total number of the dentries exceeds the limit.
+func (l *DentryCacheLRU) Put(dc, old *DentryCache) {
+	l.Lock()
+	defer l.Unlock()
+	l.remove(old)
+	if dc == nil {
+		return
+	}
+	size := dc.Len()
+	l.cache[dc] = l.lruList.PushFront(&dcacheElement{dc: dc, size: size})
+	l.count += size
+	for l.count > l.maxElements {
+		element := l.lruList.Back()
+		if element.Value.(*dcacheElement).dc == dc {
+			break
+		}
+		l.evict(element)
+	}
+}
+
+// Touch marks the dentry cache as the most recently used one.
+func (l *DentryCacheLRU) Touch(dc *DentryCache) {
+	l.Lock()
+	if element, ok := l.cache[dc]; ok {
+		l.lruList.MoveToFront(element)
+	}
+	l.Unlock()
+}
+
+// Remove stops accounting the dentry cache, e.g. when its directory is forgotten.
+func (l *DentryCacheLRU) Remove(dc *DentryCache) {
+	l.Lock()
+	l.remove(dc)
+	l.Unlock()
+}
+
+// EvictBatch evicts the least recently used dentry caches until at least the given number of the dentries are
+// evicted, and returns the number of the evicted dentries.
+func (l *DentryCacheLRU) EvictBatch(count int) (evicted int) {
+	l.Lock()
+	defer l.Unlock()
+	for evicted < count {
+		element := l.lruList.Back()
+		if element == nil {
+			break
+		}
+		evicted += l.evict(element)
+	}
+	return
+}
+
+// Stat returns the number of the directories whose dentries are cached, the number of the cached dentries, and
+// the number of the evicted dentries.
+func (l *DentryCacheLRU) Stat() (dirs, dentries int, evictions uint64) {
+	l.Lock()
+	defer l.Unlock()
+	return l.lruList.Len(), l.count, l.evictions
+}
+
+// MaxElements returns the maximum number of the cached dentries.
+func (l *DentryCacheLRU) MaxElements() int {
+	return l.maxElements
+}
+
+// The caller should grab the lock.
+func (l *DentryCacheLRU) remove(dc *DentryCache) {
+	if dc == nil {
+		return
+	}
+	element, ok := l.cache[dc]
+	if !ok {
+		return
+	}
+	l.lruList.Remove(element)
+	delete(l.cache, dc)
+	l.count -= element.Value.(*dcacheElement).size
+}
+
+// The caller should grab the lock.
+func (l *DentryCacheLRU) evict(element *list.Element) int {
+	e := element.Value.(*dcacheElement)
+	l.lruList.Remove(element)
+	delete(l.cache, e.dc)
+	l.count -= e.size
+	e.dc.Clear()
+	l.evictions += uint64(e.size)
+	return e.size
+}
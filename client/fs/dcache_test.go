@@ -0,0 +1,68 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func filledDentryCache(dentries int) *DentryCache {
+	dc := NewDentryCache()
+	for i := 0; i < dentries; i++ {
+		dc.Put(fmt.Sprintf("f%v", i), uint64(i+2))
+	}
+	return dc
+}
+
+func TestDentryCacheLRU(t *testing.T) {
+	l := NewDentryCacheLRU(10)
+	dc1, dc2, dc3 := filledDentryCache(4), filledDentryCache(4), filledDentryCache(4)
+	l.Put(dc1, nil)
+	l.Put(dc2, nil)
+	l.Touch(dc1)
+	// the directory read least recently is evicted as a whole
+	l.Put(dc3, nil)
+	if dirs, dentries, evictions := l.Stat(); dirs != 2 || dentries != 8 || evictions != 4 {
+		t.Fatalf("unexpected dirs %v dentries %v evictions %v", dirs, dentries, evictions)
+	}
+	if dc2.Len() != 0 || dc1.Len() != 4 || dc3.Len() != 4 {
+		t.Fatalf("the dentries of dc2 should be evicted, left %v %v %v", dc1.Len(), dc2.Len(), dc3.Len())
+	}
+
+	// the directory read again is accounted by its new dentry cache only
+	dc1New := filledDentryCache(2)
+	l.Put(dc1New, dc1)
+	if dirs, dentries, _ := l.Stat(); dirs != 2 || dentries != 6 {
+		t.Fatalf("unexpected dirs %v dentries %v after the dentry cache is replaced", dirs, dentries)
+	}
+	l.Remove(dc3)
+	if dirs, dentries, _ := l.Stat(); dirs != 1 || dentries != 2 {
+		t.Fatalf("unexpected dirs %v dentries %v after the dentry cache is removed", dirs, dentries)
+	}
+
+	// a directory larger than the limit by itself is kept until it is evicted by the pressure
+	large := filledDentryCache(12)
+	l.Put(large, nil)
+	if dirs, dentries, _ := l.Stat(); dirs != 1 || dentries != 12 || dc1New.Len() != 0 {
+		t.Fatalf("unexpected dirs %v dentries %v with the large directory", dirs, dentries)
+	}
+	if evicted := l.EvictBatch(1); evicted != 12 || large.Len() != 0 {
+		t.Fatalf("expect the large directory evicted, but are %v", evicted)
+	}
+	if dirs, dentries, evictions := l.Stat(); dirs != 0 || dentries != 0 || evictions != 4+2+12 {
+		t.Fatalf("unexpected dirs %v dentries %v evictions %v", dirs, dentries, evictions)
+	}
+}
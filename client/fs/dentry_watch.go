@@ -0,0 +1,83 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// the interval to poll the meta partitions for the dentries changed by the other clients
+	DentryWatchInterval = 500 * time.Millisecond
+)
+
+// SetServer sets the FUSE server which serves the super block. The dentries changed by the other clients are
+// invalidated in the kernel through the server if the dentry watch is enabled.
+func (s *Super) SetServer(server *fs.Server) {
+	s.fsServer = server
+	if s.enableDentryWatch {
+		s.mw.StartDentryWatch(DentryWatchInterval, s.invalidateDentry)
+	}
+}
+
+// watchDir watches the dentries of the directory as long as they are cached by the client or the kernel.
+func (s *Super) watchDir(ino uint64, duration time.Duration) {
+	if s.enableDentryWatch {
+		s.mw.WatchDir(ino, duration)
+	}
+}
+
+// invalidateDentry drops the dentry changed by the other clients from the dentry cache and the kernel, so that the
+// next lookup gets it from the meta node. An empty name invalidates the whole directory.
+func (s *Super) invalidateDentry(parentID uint64, name string) {
+	s.ic.Delete(parentID)
+	s.prefetcher.Invalidate(parentID)
+	s.fslock.Lock()
+	node, ok := s.nodeCache[parentID]
+	s.fslock.Unlock()
+	if !ok {
+		return
+	}
+	dir, ok := node.(*Dir)
+	if !ok {
+		return
+	}
+	var names []string
+	if name == "" {
+		names = dir.dcache.Clear()
+	} else {
+		dir.dcache.Delete(name)
+		names = []string{name}
+	}
+	if s.fsServer == nil {
+		return
+	}
+	if name == "" {
+		if err := s.fsServer.InvalidateNodeData(node); err != nil && err != fuse.ErrNotCached {
+			log.LogWarnf("invalidateDentry: parent(%v) err(%v)", parentID, err)
+		}
+	}
+	for _, n := range names {
+		if err := s.fsServer.InvalidateEntry(node, n); err != nil && err != fuse.ErrNotCached {
+			log.LogWarnf("invalidateDentry: parent(%v) name(%v) err(%v)", parentID, n, err)
+		}
+	}
+	log.LogDebugf("invalidateDentry: parent(%v) name(%v) entries(%v)", parentID, name, len(names))
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"syscall"
+
+	"bazil.org/fuse"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// directIOPassthrough returns true if the handle opened with the flags bypasses the caches, unless the volume
+// disables the feature.
+func (s *Super) directIOPassthrough(flags fuse.OpenFlags) bool {
+	return !s.disableDirectIO && isDirectIOEnabled(flags)
+}
+
+// checkDirectIOAlignment returns EINVAL like a local file system does if the offset or the size of a direct IO
+// request is not aligned.
+func (s *Super) checkDirectIOAlignment(op string, ino uint64, offset int64, size int) error {
+	if s.directIOAlignment <= 0 {
+		return nil
+	}
+	if offset%s.directIOAlignment == 0 && int64(size)%s.directIOAlignment == 0 {
+		return nil
+	}
+	log.LogWarnf("%v: unaligned direct IO, ino(%v) offset(%v) size(%v) alignment(%v)", op, ino, offset, size, s.directIOAlignment)
+	return fuse.Errno(syscall.EINVAL)
+}
+
+// writeDirect writes the data of a direct IO request in pieces which do not cross the block boundaries of the file,
+// so that every packet covers a single block on the data node.
+func (s *Super) writeDirect(ino uint64, offset int, data []byte, flags int) (total int, err error) {
+	return writeInBlocks(offset, data, func(offset int, data []byte) (int, error) {
+		return s.ec.Write(ino, offset, data, flags)
+	})
+}
+
+// writeInBlocks writes the data by the pieces not crossing the block boundaries, and stops at the first failure.
+func writeInBlocks(offset int, data []byte, write func(offset int, data []byte) (int, error)) (total int, err error) {
+	for total < len(data) {
+		size := util.BlockSize - (offset+total)%util.BlockSize
+		if size > len(data)-total {
+			size = len(data) - total
+		}
+		var written int
+		if written, err = write(offset+total, data[total:total+size]); err != nil {
+			return
+		}
+		total += written
+		if written != size {
+			err = fmt.Errorf("short write, offset(%v) size(%v) written(%v)", offset+total-written, size, written)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestCheckDirectIOAlignment(t *testing.T) {
+	s := &Super{directIOAlignment: 4096}
+	if err := s.checkDirectIOAlignment("Write", 1, 8192, 4096); err != nil {
+		t.Fatalf("the aligned request should be served, err %v", err)
+	}
+	for _, req := range []struct {
+		offset int64
+		size   int
+	}{{offset: 100, size: 4096}, {offset: 4096, size: 100}} {
+		if err := s.checkDirectIOAlignment("Write", 1, req.offset, req.size); err != fuse.Errno(syscall.EINVAL) {
+			t.Fatalf("the unaligned request %+v should fail with EINVAL, but is %v", req, err)
+		}
+	}
+	s.directIOAlignment = 0
+	if err := s.checkDirectIOAlignment("Read", 1, 100, 100); err != nil {
+		t.Fatalf("the alignment should not be checked if disabled, err %v", err)
+	}
+}
+
+type directWrite struct {
+	offset, size int
+}
+
+func TestWriteInBlocks(t *testing.T) {
+	var writes []directWrite
+	write := func(offset int, data []byte) (int, error) {
+		writes = append(writes, directWrite{offset: offset, size: len(data)})
+		return len(data), nil
+	}
+	data := make([]byte, 2*util.BlockSize+200)
+	total, err := writeInBlocks(util.BlockSize-100, data, write)
+	if err != nil || total != len(data) {
+		t.Fatalf("unexpected total %v err %v", total, err)
+	}
+	expected := []directWrite{
+		{offset: util.BlockSize - 100, size: 100},
+		{offset: util.BlockSize, size: util.BlockSize},
+		{offset: 2 * util.BlockSize, size: util.BlockSize},
+		{offset: 3 * util.BlockSize, size: 100},
+	}
+	if len(writes) != len(expected) {
+		t.Fatalf("expect the writes %v, but are %v", expected, writes)
+	}
+	for i := range expected {
+		if writes[i] != expected[i] {
+			t.Fatalf("expect the writes %v, but are %v", expected, writes)
+		}
+	}
+
+	// the short write stops the request with the bytes written so far
+	writes = nil
+	short := func(offset int, data []byte) (int, error) {
+		writes = append(writes, directWrite{offset: offset, size: len(data)})
+		if offset >= util.BlockSize {
+			return len(data) / 2, nil
+		}
+		return len(data), nil
+	}
+	total, err = writeInBlocks(util.BlockSize-100, data, short)
+	if err == nil || total != 100+util.BlockSize/2 || len(writes) != 2 {
+		t.Fatalf("unexpected total %v err %v writes %v", total, err, writes)
+	}
+}
@@ -24,7 +24,6 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/chubaofs/chubaofs/proto"
-	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
@@ -81,8 +80,8 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 	start := time.Now()
 
 	var err error
-	metric := exporter.NewTPCnt("filecreate")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("filecreate")
+	defer func() { metric.End(err) }()
 
 	info, err := d.super.mw.Create_ll(d.info.Inode, req.Name, proto.Mode(req.Mode.Perm()), req.Uid, req.Gid, nil)
 	if err != nil {
@@ -104,6 +103,7 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 	resp.EntryValid = LookupValidDuration
 
 	d.super.ic.Delete(d.info.Inode)
+	d.super.prefetcher.Invalidate(d.info.Inode)
 
 	elapsed := time.Since(start)
 	log.LogDebugf("TRACE Create: parent(%v) req(%v) resp(%v) ino(%v) (%v)ns", d.info.Inode, req, resp, info.Inode, elapsed.Nanoseconds())
@@ -118,6 +118,9 @@ func (d *Dir) Forget() {
 	}()
 
 	d.super.ic.Delete(ino)
+	if d.dcache != nil {
+		d.super.dcacheLRU.Remove(d.dcache)
+	}
 
 	d.super.fslock.Lock()
 	delete(d.super.nodeCache, ino)
@@ -129,8 +132,8 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 	start := time.Now()
 
 	var err error
-	metric := exporter.NewTPCnt("mkdir")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("mkdir")
+	defer func() { metric.End(err) }()
 
 	info, err := d.super.mw.Create_ll(d.info.Inode, req.Name, proto.Mode(os.ModeDir|req.Mode.Perm()), req.Uid, req.Gid, nil)
 	if err != nil {
@@ -146,6 +149,7 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 	d.super.fslock.Unlock()
 
 	d.super.ic.Delete(d.info.Inode)
+	d.super.prefetcher.Invalidate(d.info.Inode)
 
 	elapsed := time.Since(start)
 	log.LogDebugf("TRACE Mkdir: parent(%v) req(%v) ino(%v) (%v)ns", d.info.Inode, req, info.Inode, elapsed.Nanoseconds())
@@ -158,8 +162,8 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 	d.dcache.Delete(req.Name)
 
 	var err error
-	metric := exporter.NewTPCnt("remove")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("remove")
+	defer func() { metric.End(err) }()
 
 	info, err := d.super.mw.Delete_ll(d.info.Inode, req.Name, req.Dir)
 	if err != nil {
@@ -168,6 +172,7 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 	}
 
 	d.super.ic.Delete(d.info.Inode)
+	d.super.prefetcher.Invalidate(d.info.Inode)
 
 	if info != nil && info.Nlink == 0 && !proto.IsDir(info.Mode) {
 		d.super.orphan.Put(info.Inode)
@@ -192,8 +197,16 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 
 	log.LogDebugf("TRACE Lookup: parent(%v) req(%v)", d.info.Inode, req)
 
+	if d.super.enableXattr && d.info.Inode == d.super.rootIno && req.Name == proto.VirtualTagDirName {
+		resp.EntryValid = LookupValidDuration
+		return &TagRoot{super: d.super}, nil
+	}
+
 	ino, ok := d.dcache.Get(req.Name)
-	if !ok {
+	d.super.metrics.dcacheHit(ok)
+	if ok {
+		d.super.dcacheLRU.Touch(d.dcache)
+	} else {
 		ino, _, err = d.super.mw.Lookup_ll(d.info.Inode, req.Name)
 		if err != nil {
 			if err != syscall.ENOENT {
@@ -224,6 +237,7 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 	}
 	d.super.fslock.Unlock()
 
+	d.super.watchDir(d.info.Inode, LookupValidDuration)
 	resp.EntryValid = LookupValidDuration
 	return child, nil
 }
@@ -233,13 +247,15 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	start := time.Now()
 
 	var err error
-	metric := exporter.NewTPCnt("readdir")
-	defer metric.Set(err)
-
-	children, err := d.super.mw.ReadDir_ll(d.info.Inode)
-	if err != nil {
-		log.LogErrorf("Readdir: ino(%v) err(%v)", d.info.Inode, err)
-		return make([]fuse.Dirent, 0), ParseError(err)
+	metric := d.super.metrics.Begin("readdir")
+	defer func() { metric.End(err) }()
+
+	children, prefetched := d.super.prefetcher.Take(d.info.Inode)
+	if !prefetched {
+		if children, err = d.super.mw.ReadDir_ll(d.info.Inode); err != nil {
+			log.LogErrorf("Readdir: ino(%v) err(%v)", d.info.Inode, err)
+			return make([]fuse.Dirent, 0), ParseError(err)
+		}
 	}
 
 	inodes := make([]uint64, 0, len(children))
@@ -261,11 +277,19 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		dcache.Put(child.Name, child.Inode)
 	}
 
-	infos := d.super.mw.BatchInodeGet(inodes)
-	for _, info := range infos {
-		d.super.ic.Put(info)
+	// the attributes of the prefetched children are cached by the prefetch
+	if !prefetched {
+		infos := d.super.mw.BatchInodeGet(inodes)
+		for _, info := range infos {
+			d.super.ic.Put(info)
+		}
+	}
+	d.super.prefetcher.Prefetch(children)
+	if dcache != nil {
+		d.super.dcacheLRU.Put(dcache, d.dcache)
 	}
 	d.dcache = dcache
+	d.super.watchDir(d.info.Inode, DentryValidDuration)
 
 	elapsed := time.Since(start)
 	log.LogDebugf("TRACE ReadDir: ino(%v) (%v)ns", d.info.Inode, elapsed.Nanoseconds())
@@ -279,12 +303,23 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Nod
 		log.LogErrorf("Rename: NOT DIR, parent(%v) req(%v)", d.info.Inode, req)
 		return fuse.ENOTSUP
 	}
+	// the directories of the other aliases of the namespace are served by the other volumes
+	if dstDir.super != d.super {
+		return fuse.Errno(syscall.EXDEV)
+	}
 	start := time.Now()
 	d.dcache.Delete(req.OldName)
 
 	var err error
-	metric := exporter.NewTPCnt("rename")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("rename")
+	defer func() { metric.End(err) }()
+
+	if d.super.mw.SyncOnRename() {
+		if err = d.syncToRename(req.OldName); err != nil {
+			log.LogErrorf("Rename: sync parent(%v) req(%v) err(%v)", d.info.Inode, req, err)
+			return ParseError(err)
+		}
+	}
 
 	err = d.super.mw.Rename_ll(d.info.Inode, req.OldName, dstDir.info.Inode, req.NewName)
 	if err != nil {
@@ -293,13 +328,38 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Nod
 	}
 
 	d.super.ic.Delete(d.info.Inode)
+	d.super.prefetcher.Invalidate(d.info.Inode)
 	d.super.ic.Delete(dstDir.info.Inode)
+	d.super.prefetcher.Invalidate(dstDir.info.Inode)
 
 	elapsed := time.Since(start)
 	log.LogDebugf("TRACE Rename: SrcParent(%v) OldName(%v) DstParent(%v) NewName(%v) (%v)ns", d.info.Inode, req.OldName, dstDir.info.Inode, req.NewName, elapsed.Nanoseconds())
 	return nil
 }
 
+// syncToRename flushes the data written to the file to be renamed, as Fsync does, so that the file is complete once
+// it is visible by the new name on a volume with SyncOnRename.
+func (d *Dir) syncToRename(name string) (err error) {
+	ino, mode, err := d.super.mw.Lookup_ll(d.info.Inode, name)
+	if err != nil || !proto.IsRegular(mode) {
+		return
+	}
+	if d.super.asyncCloser != nil {
+		if err = d.super.asyncCloser.Wait(ino); err != nil {
+			return
+		}
+	}
+	// the file is not written by this client unless its stream is opened
+	if d.super.ec.GetStreamer(ino) == nil {
+		return
+	}
+	if err = d.super.ec.Flush(ino); err != nil {
+		return
+	}
+	d.super.ic.Delete(ino)
+	return
+}
+
 // Setattr handles the setattr request.
 func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
 	ino := d.info.Inode
@@ -311,8 +371,8 @@ func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.
 	}
 
 	if valid := setattr(info, req); valid != 0 {
-		err = d.super.mw.Setattr(ino, valid, info.Mode, info.Uid, info.Gid, info.AccessTime.Unix(),
-			info.ModifyTime.Unix())
+		err = d.super.mw.Setattr(ino, valid, info.Mode, info.Uid, info.Gid, info.AccessTime,
+			info.ModifyTime)
 		if err != nil {
 			d.super.ic.Delete(ino)
 			return ParseError(err)
@@ -334,14 +394,15 @@ func (d *Dir) Mknod(ctx context.Context, req *fuse.MknodRequest) (fs.Node, error
 	start := time.Now()
 
 	var err error
-	metric := exporter.NewTPCnt("mknod")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("mknod")
+	defer func() { metric.End(err) }()
 
 	info, err := d.super.mw.Create_ll(d.info.Inode, req.Name, proto.Mode(req.Mode), req.Uid, req.Gid, nil)
 	if err != nil {
 		log.LogErrorf("Mknod: parent(%v) req(%v) err(%v)", d.info.Inode, req, err)
 		return nil, ParseError(err)
 	}
+	d.super.prefetcher.Invalidate(d.info.Inode)
 
 	d.super.ic.Put(info)
 	child := NewFile(d.super, info)
@@ -361,14 +422,15 @@ func (d *Dir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, e
 	start := time.Now()
 
 	var err error
-	metric := exporter.NewTPCnt("symlink")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("symlink")
+	defer func() { metric.End(err) }()
 
 	info, err := d.super.mw.Create_ll(parentIno, req.NewName, proto.Mode(os.ModeSymlink|os.ModePerm), req.Uid, req.Gid, []byte(req.Target))
 	if err != nil {
 		log.LogErrorf("Symlink: parent(%v) NewName(%v) err(%v)", parentIno, req.NewName, err)
 		return nil, ParseError(err)
 	}
+	d.super.prefetcher.Invalidate(d.info.Inode)
 
 	d.super.ic.Put(info)
 	child := NewFile(d.super, info)
@@ -387,6 +449,9 @@ func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.
 	var oldInode *proto.InodeInfo
 	switch old := old.(type) {
 	case *File:
+		if old.super != d.super {
+			return nil, fuse.Errno(syscall.EXDEV)
+		}
 		oldInode = old.info
 	default:
 		return nil, fuse.EPERM
@@ -400,14 +465,15 @@ func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.
 	start := time.Now()
 
 	var err error
-	metric := exporter.NewTPCnt("link")
-	defer metric.Set(err)
+	metric := d.super.metrics.Begin("link")
+	defer func() { metric.End(err) }()
 
 	info, err := d.super.mw.Link(d.info.Inode, req.NewName, oldInode.Inode)
 	if err != nil {
 		log.LogErrorf("Link: parent(%v) name(%v) ino(%v) err(%v)", d.info.Inode, req.NewName, oldInode.Inode, err)
 		return nil, ParseError(err)
 	}
+	d.super.prefetcher.Invalidate(d.info.Inode)
 
 	d.super.ic.Put(info)
 
@@ -434,9 +500,20 @@ func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *f
 	return fuse.ENOSYS
 }
 
-// Setxattr has not been implemented yet.
+// Setxattr handles the commit request and the prefetch hint of the directory. The other xattrs have not been
+// implemented yet.
 func (d *Dir) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
-	return fuse.ENOSYS
+	if !d.super.enableXattr {
+		return fuse.ENOSYS
+	}
+	switch req.Name {
+	case CommitXattrName:
+		return d.commit(string(req.Xattr))
+	case PrefetchXattrName:
+		return d.prefetchHint(string(req.Xattr))
+	default:
+		return fuse.ENOSYS
+	}
 }
 
 // Removexattr has not been implemented yet.
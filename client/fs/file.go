@@ -15,8 +15,10 @@
 package fs
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"syscall"
 	"time"
 
 	"bazil.org/fuse"
@@ -26,7 +28,6 @@ import (
 	"sync"
 
 	"github.com/chubaofs/chubaofs/proto"
-	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
@@ -47,6 +48,7 @@ var (
 	_ fs.HandleReader      = (*File)(nil)
 	_ fs.HandleWriter      = (*File)(nil)
 	_ fs.HandleFlusher     = (*File)(nil)
+	_ fs.HandleFallocater  = (*File)(nil)
 	_ fs.NodeFsyncer       = (*File)(nil)
 	_ fs.NodeSetattrer     = (*File)(nil)
 	_ fs.NodeReadlinker    = (*File)(nil)
@@ -101,6 +103,13 @@ func (f *File) Forget() {
 	delete(f.super.nodeCache, ino)
 	f.super.fslock.Unlock()
 
+	if f.super.asyncCloser != nil {
+		// the stream can not be evicted until the deferred closes are done
+		if err := f.super.asyncCloser.Wait(ino); err != nil {
+			log.LogWarnf("Forget: drop unreported deferred close error, ino(%v) err(%v)", ino, err)
+		}
+	}
+
 	if err := f.super.ec.EvictStream(ino); err != nil {
 		log.LogWarnf("Forget: stream not ready to evict, ino(%v) err(%v)", ino, err)
 		return
@@ -120,11 +129,22 @@ func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenR
 	ino := f.info.Inode
 	start := time.Now()
 
+	if f.super.asyncCloser != nil && f.super.asyncCloser.strict {
+		if err = f.super.asyncCloser.Wait(ino); err != nil {
+			msg := fmt.Sprintf("Open: deferred close failed, ino(%v) req(%v) err(%v)", ino, req, err)
+			f.super.handleError("Open", msg)
+			return nil, fuse.EIO
+		}
+	}
+
 	f.super.ec.OpenStream(ino)
 
 	f.super.ec.RefreshExtentsCache(ino)
 
-	if f.super.keepCache {
+	if f.super.directIOPassthrough(req.Flags) {
+		// Bypass the page cache and the read-ahead of the kernel for this handle.
+		resp.Flags |= fuse.OpenDirectIO
+	} else if f.super.keepCache {
 		resp.Flags |= fuse.OpenKeepCache
 	}
 
@@ -142,6 +162,12 @@ func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) (err error
 
 	//log.LogDebugf("TRACE Release close stream: ino(%v) req(%v)", ino, req)
 
+	if f.super.asyncCloser != nil && f.super.asyncCloser.Enqueue(ino) {
+		f.super.ic.Delete(ino)
+		log.LogDebugf("TRACE Release: deferred close, ino(%v) req(%v)", ino, req)
+		return nil
+	}
+
 	err = f.super.ec.CloseStream(ino)
 	if err != nil {
 		log.LogErrorf("Release: close writer failed, ino(%v) req(%v) err(%v)", ino, req, err)
@@ -160,10 +186,16 @@ func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 
 	start := time.Now()
 
-	metric := exporter.NewTPCnt("fileread")
-	defer metric.Set(err)
+	metric := f.super.metrics.Begin("fileread")
+	defer func() { metric.End(err) }()
+
+	if f.super.directIOPassthrough(req.FileFlags) {
+		if err = f.super.checkDirectIOAlignment("Read", f.info.Inode, req.Offset, req.Size); err != nil {
+			return
+		}
+	}
 
-	size, err := f.super.ec.Read(f.info.Inode, resp.Data[fuse.OutHeaderSize:], int(req.Offset), req.Size)
+	size, err := f.super.ec.ReadV(f.info.Inode, [][]byte{resp.Data[fuse.OutHeaderSize : fuse.OutHeaderSize+req.Size]}, int(req.Offset))
 	if err != nil && err != io.EOF {
 		msg := fmt.Sprintf("Read: ino(%v) req(%v) err(%v) size(%v)", f.info.Inode, req, err, size)
 		f.super.handleError("Read", msg)
@@ -214,6 +246,13 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 	var waitForFlush bool
 	var flags int
 
+	directIO := f.super.directIOPassthrough(req.FileFlags)
+	if directIO {
+		if err = f.super.checkDirectIOAlignment("Write", ino, req.Offset, reqlen); err != nil {
+			return
+		}
+	}
+
 	if isDirectIOEnabled(req.FileFlags) || (req.FileFlags&fuse.OpenSync != 0) {
 		waitForFlush = true
 		if f.super.enSyncWrite {
@@ -227,10 +266,15 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 
 	start := time.Now()
 
-	metric := exporter.NewTPCnt("filewrite")
-	defer metric.Set(err)
+	metric := f.super.metrics.Begin("filewrite")
+	defer func() { metric.End(err) }()
 
-	size, err := f.super.ec.Write(ino, int(req.Offset), req.Data, flags)
+	var size int
+	if directIO {
+		size, err = f.super.writeDirect(ino, int(req.Offset), req.Data, flags)
+	} else {
+		size, err = f.super.ec.Write(ino, int(req.Offset), req.Data, flags)
+	}
 	if err != nil {
 		msg := fmt.Sprintf("Write: ino(%v) offset(%v) len(%v) err(%v)", ino, req.Offset, reqlen, err)
 		f.super.handleError("Write", msg)
@@ -256,6 +300,47 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 	return nil
 }
 
+// Fallocate preallocates the space of the file, which is reserved against the capacity of the volume. Only the
+// default mode and FALLOC_FL_KEEP_SIZE are supported, the file is extended to the end of the range unless the size
+// is kept. No extent is allocated until the range is written.
+func (f *File) Fallocate(ctx context.Context, req *fuse.FallocateRequest) (err error) {
+	ino := f.info.Inode
+	if req.Mode&^fuse.FallocateKeepSize != 0 {
+		log.LogWarnf("Fallocate: unsupported mode, ino(%v) req(%v)", ino, req)
+		return fuse.Errno(syscall.EOPNOTSUPP)
+	}
+	log.LogDebugf("TRACE Fallocate enter: ino(%v) req(%v)", ino, req)
+	start := time.Now()
+
+	metric := f.super.metrics.Begin("fallocate")
+	defer func() { metric.End(err) }()
+
+	defer func() {
+		f.super.ic.Delete(ino)
+	}()
+
+	if err = f.super.mw.Fallocate(ino, req.Offset, req.Length); err != nil {
+		log.LogErrorf("Fallocate: ino(%v) req(%v) err(%v)", ino, req, err)
+		return ParseError(err)
+	}
+	end := req.Offset + req.Length
+	if size, _ := f.fileSize(ino); req.Mode&fuse.FallocateKeepSize == 0 && end > uint64(size) {
+		if err = f.super.ec.Flush(ino); err != nil {
+			log.LogErrorf("Fallocate: extend wait for flush ino(%v) size(%v) err(%v)", ino, end, err)
+			return ParseError(err)
+		}
+		if err = f.super.ec.Truncate(ino, int(end)); err != nil {
+			log.LogErrorf("Fallocate: extend ino(%v) size(%v) err(%v)", ino, end, err)
+			return ParseError(err)
+		}
+		f.super.ec.RefreshExtentsCache(ino)
+	}
+
+	elapsed := time.Since(start)
+	log.LogDebugf("TRACE Fallocate: ino(%v) req(%v) (%v)ns", ino, req, elapsed.Nanoseconds())
+	return nil
+}
+
 // Flush only when fsyncOnClose is enabled.
 func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
 	if !f.super.fsyncOnClose {
@@ -264,8 +349,8 @@ func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
 	log.LogDebugf("TRACE Flush enter: ino(%v)", f.info.Inode)
 	start := time.Now()
 
-	metric := exporter.NewTPCnt("filesync")
-	defer metric.Set(err)
+	metric := f.super.metrics.Begin("filesync")
+	defer func() { metric.End(err) }()
 
 	err = f.super.ec.Flush(f.info.Inode)
 	if err != nil {
@@ -283,6 +368,13 @@ func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
 func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 	log.LogDebugf("TRACE Fsync enter: ino(%v)", f.info.Inode)
 	start := time.Now()
+	if f.super.asyncCloser != nil {
+		if err = f.super.asyncCloser.Wait(f.info.Inode); err != nil {
+			msg := fmt.Sprintf("Fsync: deferred close failed, ino(%v) err(%v)", f.info.Inode, err)
+			f.super.handleError("Fsync", msg)
+			return fuse.EIO
+		}
+	}
 	err = f.super.ec.Flush(f.info.Inode)
 	if err != nil {
 		msg := fmt.Sprintf("Fsync: ino(%v) err(%v)", f.info.Inode, err)
@@ -325,8 +417,8 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 	}
 
 	if valid := setattr(info, req); valid != 0 {
-		err = f.super.mw.Setattr(ino, valid, info.Mode, info.Uid, info.Gid, info.AccessTime.Unix(),
-			info.ModifyTime.Unix())
+		err = f.super.mw.Setattr(ino, valid, info.Mode, info.Uid, info.Gid, info.AccessTime,
+			info.ModifyTime)
 		if err != nil {
 			f.super.ic.Delete(ino)
 			return ParseError(err)
@@ -361,12 +453,34 @@ func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fu
 	name := req.Name
 	size := req.Size
 	pos := req.Position
-	info, err := f.super.mw.XAttrGet_ll(ino, name)
-	if err != nil {
-		log.LogErrorf("GetXattr: ino(%v) name(%v) err(%v)", ino, name, err)
-		return ParseError(err)
+	var value []byte
+	switch name {
+	case ChecksumXattrName:
+		checksum, err := f.checksum()
+		if err != nil {
+			return ParseError(err)
+		}
+		value = []byte(checksum)
+	case VerifyXattrName:
+		report, err := f.verify()
+		if err != nil {
+			return ParseError(err)
+		}
+		value = report
+	case BirthTimeXattrName:
+		info, err := f.super.InodeGet(ino)
+		if err != nil {
+			return ParseError(err)
+		}
+		value = []byte(birthTime(info).Format(time.RFC3339Nano))
+	default:
+		info, err := f.super.mw.XAttrGet_ll(ino, name)
+		if err != nil {
+			log.LogErrorf("GetXattr: ino(%v) name(%v) err(%v)", ino, name, err)
+			return ParseError(err)
+		}
+		value = info.Get(name)
 	}
-	value := info.Get(name)
 	if pos > 0 {
 		value = value[pos:]
 	}
@@ -378,6 +492,45 @@ func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fu
 	return nil
 }
 
+// flushForXattr flushes the data written by this client, so that the xattrs computed from the extents cover it.
+func (f *File) flushForXattr() error {
+	ino := f.info.Inode
+	if f.super.ec.GetStreamer(ino) == nil {
+		return nil
+	}
+	if err := f.super.ec.Flush(ino); err != nil {
+		log.LogErrorf("GetXattr: flush ino(%v) err(%v)", ino, err)
+		return fuse.EIO
+	}
+	return nil
+}
+
+// checksum returns the checksum of the file including the data written by this client.
+func (f *File) checksum() (checksum string, err error) {
+	ino := f.info.Inode
+	if err = f.flushForXattr(); err != nil {
+		return
+	}
+	if checksum, err = f.super.mw.FileChecksum_ll(ino); err != nil {
+		log.LogErrorf("GetXattr: checksum ino(%v) err(%v)", ino, err)
+	}
+	return
+}
+
+// verify returns the report in json of verifying the replicas of the extents of the file.
+func (f *File) verify() (value []byte, err error) {
+	ino := f.info.Inode
+	if err = f.flushForXattr(); err != nil {
+		return
+	}
+	report, err := f.super.ec.VerifyFile(ino)
+	if err != nil {
+		log.LogErrorf("GetXattr: verify ino(%v) err(%v)", ino, err)
+		return
+	}
+	return json.Marshal(report)
+}
+
 // Listxattr has not been implemented yet.
 func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
 	if !f.super.enableXattr {
@@ -407,6 +560,9 @@ func (f *File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
 	ino := f.info.Inode
 	name := req.Name
 	value := req.Xattr
+	if name == ChecksumXattrName || name == VerifyXattrName {
+		return fuse.EPERM
+	}
 	// TODO： implement flag to improve compatible (Mofei Zhang)
 	if err := f.super.mw.XAttrSet_ll(ino, []byte(name), []byte(value)); err != nil {
 		log.LogErrorf("Setxattr: ino(%v) name(%v) err(%v)", ino, name, err)
@@ -17,6 +17,7 @@ package fs
 import (
 	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -39,6 +40,7 @@ type InodeCache struct {
 	lruList     *list.List
 	expiration  time.Duration
 	maxElements int
+	evictions   uint64
 }
 
 // NewInodeCache returns a new inode cache.
@@ -72,22 +74,23 @@ func (ic *InodeCache) Put(info *proto.InodeInfo) {
 	ic.Unlock()
 }
 
-// Get returns the inode info based on the given inode number.
+// Get returns the inode info based on the given inode number, and marks it as the most recently used one.
 func (ic *InodeCache) Get(ino uint64) *proto.InodeInfo {
-	ic.RLock()
+	ic.Lock()
 	element, ok := ic.cache[ino]
 	if !ok {
-		ic.RUnlock()
+		ic.Unlock()
 		return nil
 	}
 
 	info := element.Value.(*proto.InodeInfo)
 	if inodeExpired(info) {
-		ic.RUnlock()
+		ic.Unlock()
 		//log.LogDebugf("InodeCache GetConnect expired: now(%v) inode(%v)", time.Now().Format(LogTimeFormat), inode)
 		return nil
 	}
-	ic.RUnlock()
+	ic.lruList.MoveToFront(element)
+	ic.Unlock()
 	return info
 }
 
@@ -103,11 +106,69 @@ func (ic *InodeCache) Delete(ino uint64) {
 	ic.Unlock()
 }
 
+// EvictBatch evicts the given number of the least recently used inodes regardless of their expiration, and returns
+// the number of the evicted ones. The lock is released every MaxInodeCacheEvictNum inodes so that the lookups are
+// not blocked for long.
+func (ic *InodeCache) EvictBatch(count int) (evicted int) {
+	for evicted < count {
+		batch := count - evicted
+		if batch > MaxInodeCacheEvictNum {
+			batch = MaxInodeCacheEvictNum
+		}
+		ic.Lock()
+		n := ic.evictLRU(batch)
+		ic.Unlock()
+		evicted += n
+		if n < batch {
+			break
+		}
+	}
+	return
+}
+
+// Len returns the number of the cached inodes.
+func (ic *InodeCache) Len() int {
+	ic.RLock()
+	defer ic.RUnlock()
+	return ic.lruList.Len()
+}
+
+// MaxElements returns the maximum number of the cached inodes.
+func (ic *InodeCache) MaxElements() int {
+	return ic.maxElements
+}
+
+// Evictions returns the number of the inodes evicted before they are deleted.
+func (ic *InodeCache) Evictions() uint64 {
+	return atomic.LoadUint64(&ic.evictions)
+}
+
+// The caller should grab the WRITE lock of the inode cache.
+func (ic *InodeCache) evictLRU(count int) (evicted int) {
+	defer func() {
+		atomic.AddUint64(&ic.evictions, uint64(evicted))
+	}()
+	for evicted < count {
+		element := ic.lruList.Back()
+		if element == nil {
+			return
+		}
+		info := element.Value.(*proto.InodeInfo)
+		ic.lruList.Remove(element)
+		delete(ic.cache, info.Inode)
+		evicted++
+	}
+	return
+}
+
 // Foreground eviction cares more about the speed.
 // Background eviction evicts all expired items from the cache.
 // The caller should grab the WRITE lock of the inode cache.
 func (ic *InodeCache) evict(foreground bool) {
 	var count int
+	defer func() {
+		atomic.AddUint64(&ic.evictions, uint64(count))
+	}()
 
 	for i := 0; i < MinInodeCacheEvictNum; i++ {
 		element := ic.lruList.Back()
@@ -0,0 +1,61 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestInodeCacheBound(t *testing.T) {
+	ic := NewInodeCache(time.Minute, 20)
+	for ino := uint64(1); ino <= 50; ino++ {
+		ic.Put(&proto.InodeInfo{Inode: ino})
+		if ic.Len() > ic.MaxElements() {
+			t.Fatalf("the inode cache of %v inodes exceeds the limit %v", ic.Len(), ic.MaxElements())
+		}
+	}
+	if ic.Get(50) == nil || ic.Get(1) != nil {
+		t.Fatalf("the least recently used inodes should be evicted first")
+	}
+	if ic.Evictions() != uint64(50-ic.Len()) {
+		t.Fatalf("expect %v evictions, but are %v", 50-ic.Len(), ic.Evictions())
+	}
+}
+
+func TestInodeCacheEvictBatch(t *testing.T) {
+	ic := NewInodeCache(time.Minute, 100)
+	for ino := uint64(1); ino <= 10; ino++ {
+		ic.Put(&proto.InodeInfo{Inode: ino})
+	}
+	// the inodes read recently are kept under the pressure regardless of their expiration
+	ic.Get(1)
+	if evicted := ic.EvictBatch(5); evicted != 5 || ic.Len() != 5 {
+		t.Fatalf("expect 5 inodes evicted, but are %v, left %v", evicted, ic.Len())
+	}
+	for ino := uint64(2); ino <= 6; ino++ {
+		if ic.Get(ino) != nil {
+			t.Fatalf("inode %v should be evicted", ino)
+		}
+	}
+	if ic.Get(1) == nil || ic.Get(7) == nil {
+		t.Fatalf("the recently used inodes should be kept")
+	}
+	if evicted := ic.EvictBatch(100); evicted != 5 || ic.Len() != 0 || ic.Evictions() != 10 {
+		t.Fatalf("expect all the inodes evicted, evicted %v left %v evictions %v", evicted, ic.Len(), ic.Evictions())
+	}
+}
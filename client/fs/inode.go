@@ -29,6 +29,7 @@ const (
 
 func (s *Super) InodeGet(ino uint64) (*proto.InodeInfo, error) {
 	info := s.ic.Get(ino)
+	s.metrics.icacheHit(info != nil)
 	if info != nil {
 		return info, nil
 	}
@@ -83,14 +84,27 @@ func fillAttr(info *proto.InodeInfo, attr *fuse.Attr) {
 	attr.Mode = proto.OsMode(info.Mode)
 	attr.Size = info.Size
 	attr.Blocks = attr.Size >> 9 // In 512 bytes
+	if info.Reserved > attr.Size {
+		// the preallocated space is counted in the blocks, the same as the local file systems
+		attr.Blocks = info.Reserved >> 9
+	}
 	attr.Atime = info.AccessTime
 	attr.Ctime = info.CreateTime
 	attr.Mtime = info.ModifyTime
+	attr.Crtime = birthTime(info)
 	attr.BlockSize = DefaultBlksize
 	attr.Uid = info.Uid
 	attr.Gid = info.Gid
 }
 
+// birthTime returns the birth time of the inode, which is the create time if it is replied by the older meta nodes.
+func birthTime(info *proto.InodeInfo) time.Time {
+	if info.BirthTime.IsZero() {
+		return info.CreateTime
+	}
+	return info.BirthTime
+}
+
 func inodeExpired(info *proto.InodeInfo) bool {
 	if time.Now().UnixNano() > info.Expiration() {
 		return true
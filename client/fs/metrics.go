@@ -0,0 +1,135 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/exporter"
+)
+
+// Metrics collects the operation statistics of a mounted volume.
+type Metrics struct {
+	inflight   int64
+	icacheHits uint64
+	icacheMiss uint64
+	dcacheHits uint64
+	dcacheMiss uint64
+	ops        sync.Map // op name -> *opStat
+
+	// the closes offloaded to the async closer, and the failed ones among them
+	deferredCloses        uint64
+	deferredCloseFailures uint64
+
+	shadowFailures func() uint64 // the writes failed to be mirrored to the shadow volume, nil if there is none
+}
+
+type opStat struct {
+	count  uint64
+	errors uint64
+}
+
+// OpMetric tracks a single in-flight operation.
+type OpMetric struct {
+	m   *Metrics
+	op  string
+	tpc *exporter.TimePointCount
+}
+
+// NewMetrics returns a new Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) stat(op string) *opStat {
+	if v, ok := m.ops.Load(op); ok {
+		return v.(*opStat)
+	}
+	v, _ := m.ops.LoadOrStore(op, &opStat{})
+	return v.(*opStat)
+}
+
+// Begin marks the start of the given operation.
+func (m *Metrics) Begin(op string) *OpMetric {
+	atomic.AddInt64(&m.inflight, 1)
+	return &OpMetric{m: m, op: op, tpc: exporter.NewTPCnt(op)}
+}
+
+// End marks the end of the operation and records the result.
+func (om *OpMetric) End(err error) {
+	om.tpc.Set(err)
+	atomic.AddInt64(&om.m.inflight, -1)
+	stat := om.m.stat(om.op)
+	atomic.AddUint64(&stat.count, 1)
+	if err != nil {
+		atomic.AddUint64(&stat.errors, 1)
+	}
+}
+
+func (m *Metrics) icacheHit(hit bool) {
+	if hit {
+		atomic.AddUint64(&m.icacheHits, 1)
+	} else {
+		atomic.AddUint64(&m.icacheMiss, 1)
+	}
+}
+
+func (m *Metrics) dcacheHit(hit bool) {
+	if hit {
+		atomic.AddUint64(&m.dcacheHits, 1)
+	} else {
+		atomic.AddUint64(&m.dcacheMiss, 1)
+	}
+}
+
+func (m *Metrics) deferredClose() {
+	atomic.AddUint64(&m.deferredCloses, 1)
+}
+
+func (m *Metrics) deferredCloseFailure() {
+	atomic.AddUint64(&m.deferredCloseFailures, 1)
+}
+
+// Summary returns a snapshot of the collected metrics.
+func (m *Metrics) Summary(volume, clientID string) *proto.ClientMetrics {
+	cm := &proto.ClientMetrics{
+		Volume:      volume,
+		ClientID:    clientID,
+		ReportTime:  time.Now().Unix(),
+		Inflight:    atomic.LoadInt64(&m.inflight),
+		OpCounts:    make(map[string]uint64),
+		ErrorCounts: make(map[string]uint64),
+		IcacheHits:  atomic.LoadUint64(&m.icacheHits),
+		IcacheMiss:  atomic.LoadUint64(&m.icacheMiss),
+		DcacheHits:  atomic.LoadUint64(&m.dcacheHits),
+		DcacheMiss:  atomic.LoadUint64(&m.dcacheMiss),
+
+		DeferredCloses:        atomic.LoadUint64(&m.deferredCloses),
+		DeferredCloseFailures: atomic.LoadUint64(&m.deferredCloseFailures),
+	}
+	if m.shadowFailures != nil {
+		cm.ShadowFailures = m.shadowFailures()
+	}
+	m.ops.Range(func(key, value interface{}) bool {
+		stat := value.(*opStat)
+		cm.OpCounts[key.(string)] = atomic.LoadUint64(&stat.count)
+		cm.ErrorCounts[key.(string)] = atomic.LoadUint64(&stat.errors)
+		return true
+	})
+	return cm
+}
@@ -0,0 +1,322 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/master"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	NamespaceRootIno          = 1
+	NamespaceRetryInterval    = 30 * time.Second
+	NamespaceAliasQueryKey    = "alias"
+	namespaceRootMode         = os.ModeDir | 0555
+	namespaceUnavailableState = "unavailable"
+	namespaceAvailableState   = "available"
+)
+
+// namespaceAlias is a directory of the namespace, which is served by the super block of its own, i.e. the meta and
+// the data sessions of its volume, so that the failures of a volume are isolated in its alias.
+type namespaceAlias struct {
+	proto.NamespaceAlias
+	opt *proto.MountOptions
+
+	sync.RWMutex
+	super *Super  // nil until the super block is created
+	root  fs.Node // the root directory of the alias, which is looked up by the same node
+	err   error   // the last failure to create the super block
+}
+
+func (a *namespaceAlias) getSuper() (s *Super, root fs.Node, err error) {
+	a.RLock()
+	defer a.RUnlock()
+	return a.super, a.root, a.err
+}
+
+// connect creates the super block of the alias if it is not created yet.
+func (a *namespaceAlias) connect(server *fs.Server) (err error) {
+	if s, _, _ := a.getSuper(); s != nil {
+		return
+	}
+	s, err := NewSuper(a.opt)
+	var root fs.Node
+	if err == nil {
+		if root, err = s.Root(); err != nil {
+			s.Close()
+		}
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.err = err; err != nil {
+		log.LogErrorf("Namespace: alias(%v) volume(%v) subDir(%v) unavailable, err(%v)", a.Name, a.Volume, a.SubDir,
+			err)
+		return
+	}
+	a.super, a.root = s, root
+	if server != nil {
+		s.SetServer(server)
+	}
+	log.LogInfof("Namespace: alias(%v) volume(%v) subDir(%v) available", a.Name, a.Volume, a.SubDir)
+	return
+}
+
+// Namespace is the file system mapping the sub directories of the volumes to the directories of the mount point.
+// An alias whose volume is unavailable on mount is connected again in the background, and its directory fails with
+// EIO until then. The operations across the aliases, such as renaming or linking a file to another alias, fail
+// with EXDEV, and the inode numbers are only unique within an alias.
+type Namespace struct {
+	cluster string
+	aliases []*namespaceAlias
+	byName  map[string]*namespaceAlias
+	stopC   chan struct{}
+	wg      sync.WaitGroup
+
+	sync.RWMutex
+	server *fs.Server
+}
+
+// Functions that Namespace needs to implement
+var (
+	_ fs.FS                 = (*Namespace)(nil)
+	_ fs.FSStatfser         = (*Namespace)(nil)
+	_ fs.Node               = (*namespaceRoot)(nil)
+	_ fs.NodeStringLookuper = (*namespaceRoot)(nil)
+	_ fs.HandleReadDirAller = (*namespaceRoot)(nil)
+)
+
+// NewNamespace returns the namespace of the aliases of the mount options. It fails only if none of the aliases is
+// available.
+func NewNamespace(opt *proto.MountOptions) (ns *Namespace, err error) {
+	ns = &Namespace{
+		byName: make(map[string]*namespaceAlias),
+		stopC:  make(chan struct{}),
+	}
+	for _, alias := range opt.Namespace {
+		a := &namespaceAlias{NamespaceAlias: alias, opt: opt.AliasOptions(alias)}
+		ns.aliases = append(ns.aliases, a)
+		ns.byName[alias.Name] = a
+	}
+	available := 0
+	for _, a := range ns.aliases {
+		if err = a.connect(nil); err != nil {
+			continue
+		}
+		available++
+		if ns.cluster == "" {
+			ns.cluster = a.super.ClusterName()
+		}
+	}
+	if available == 0 {
+		return nil, fmt.Errorf("no alias of the namespace is available, the last err(%v)", err)
+	}
+	ns.wg.Add(1)
+	go ns.reconnect()
+	return ns, nil
+}
+
+// reconnect connects the unavailable aliases periodically until the namespace is closed.
+func (ns *Namespace) reconnect() {
+	defer ns.wg.Done()
+	ticker := time.NewTicker(NamespaceRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ns.stopC:
+			return
+		case <-ticker.C:
+			ns.RLock()
+			server := ns.server
+			ns.RUnlock()
+			for _, a := range ns.aliases {
+				a.connect(server)
+			}
+		}
+	}
+}
+
+// Close closes the super blocks of the aliases.
+func (ns *Namespace) Close() {
+	close(ns.stopC)
+	ns.wg.Wait()
+	for _, a := range ns.aliases {
+		if s, _, _ := a.getSuper(); s != nil {
+			s.Close()
+		}
+	}
+}
+
+// ClusterName returns the cluster name.
+func (ns *Namespace) ClusterName() string {
+	return ns.cluster
+}
+
+// SetServer sets the FUSE server which serves the namespace to the super blocks of the aliases.
+func (ns *Namespace) SetServer(server *fs.Server) {
+	ns.Lock()
+	ns.server = server
+	ns.Unlock()
+	for _, a := range ns.aliases {
+		if s, _, _ := a.getSuper(); s != nil {
+			s.SetServer(server)
+		}
+	}
+}
+
+// Root returns the root directory of the namespace, which lists the aliases.
+func (ns *Namespace) Root() (fs.Node, error) {
+	return &namespaceRoot{ns: ns}, nil
+}
+
+// Statfs sums the statistics of the available aliases.
+func (ns *Namespace) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	sum := &meta.VolStat{}
+	for _, a := range ns.aliases {
+		if s, _, _ := a.getSuper(); s != nil {
+			sum.Add(s.mw.VolStat())
+		}
+	}
+	fillStatfs(resp, sum)
+	return nil
+}
+
+// NamespaceAliasStat is the state and the statistics of an alias.
+type NamespaceAliasStat struct {
+	Name      string
+	Volume    string
+	SubDir    string
+	State     string
+	Err       string `json:",omitempty"`
+	Metrics   *proto.ClientMetrics
+	CacheStat *CacheStat
+}
+
+// Stats returns the states and the statistics of the aliases.
+func (ns *Namespace) Stats() (stats []*NamespaceAliasStat) {
+	for _, a := range ns.aliases {
+		s, _, err := a.getSuper()
+		stat := &NamespaceAliasStat{Name: a.Name, Volume: a.Volume, SubDir: a.SubDir, State: namespaceAvailableState}
+		if s == nil {
+			stat.State = namespaceUnavailableState
+			if err != nil {
+				stat.Err = err.Error()
+			}
+		} else {
+			stat.Metrics = s.metricsSummary()
+			stat.CacheStat = s.CacheStat()
+		}
+		stats = append(stats, stat)
+	}
+	return
+}
+
+// GetStats replies the states and the statistics of the aliases.
+func (ns *Namespace) GetStats(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(ns.Stats())
+	if err != nil {
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(data)
+}
+
+// HandleAlias returns the handler serving the request with the super block of the alias in the request.
+func (ns *Namespace) HandleAlias(handler func(s *Super, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.FormValue(NamespaceAliasQueryKey)
+		a, ok := ns.byName[name]
+		if !ok {
+			w.Write([]byte(fmt.Sprintf("alias(%v) not found\n", name)))
+			return
+		}
+		s, _, err := a.getSuper()
+		if s == nil {
+			w.Write([]byte(fmt.Sprintf("alias(%v) is %v, err(%v)\n", name, namespaceUnavailableState, err)))
+			return
+		}
+		handler(s, w, r)
+	}
+}
+
+// PushMetrics periodically reports the summarized metrics of the available aliases to the master until the
+// namespace is unmounted.
+func (ns *Namespace) PushMetrics(mc *master.MasterClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ns.stopC:
+			return
+		case <-ticker.C:
+			for _, a := range ns.aliases {
+				s, _, _ := a.getSuper()
+				if s == nil {
+					continue
+				}
+				if err := mc.ClientAPI().ReportClientMetrics(s.metricsSummary()); err != nil {
+					log.LogWarnf("PushMetrics: alias(%v) volume(%v) err(%v)", a.Name, s.volname, err)
+				}
+			}
+		}
+	}
+}
+
+// namespaceRoot is the read-only root directory of the namespace, whose entries are the aliases.
+type namespaceRoot struct {
+	ns *Namespace
+}
+
+func (r *namespaceRoot) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = NamespaceRootIno
+	a.Mode = namespaceRootMode
+	a.Nlink = uint32(len(r.ns.aliases) + 2)
+	a.BlockSize = DefaultBlksize
+	a.Valid = AttrValidDuration
+	return nil
+}
+
+func (r *namespaceRoot) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	a, ok := r.ns.byName[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	s, root, err := a.getSuper()
+	if s == nil {
+		log.LogErrorf("Lookup: alias(%v) is %v, err(%v)", name, namespaceUnavailableState, err)
+		return nil, fuse.EIO
+	}
+	return root, nil
+}
+
+func (r *namespaceRoot) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	dirents := make([]fuse.Dirent, 0, len(r.ns.aliases))
+	for _, a := range r.ns.aliases {
+		dirents = append(dirents, fuse.Dirent{Name: a.Name, Type: fuse.DT_Dir})
+	}
+	return dirents, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// newTestNamespace returns the namespace of an alias available, served by its own super block, and an alias whose
+// volume is unavailable.
+func newTestNamespace() (ns *Namespace, available *namespaceAlias) {
+	available = &namespaceAlias{NamespaceAlias: proto.NamespaceAlias{Name: "data", Volume: "volA", SubDir: "/shared"}}
+	available.super = &Super{volname: "volA"}
+	available.root = &Dir{super: available.super, info: &proto.InodeInfo{Inode: proto.RootIno}}
+	unavailable := &namespaceAlias{NamespaceAlias: proto.NamespaceAlias{Name: "scratch", Volume: "volB"}}
+	unavailable.err = errors.New("vol not exists")
+	ns = &Namespace{
+		aliases: []*namespaceAlias{available, unavailable},
+		byName:  map[string]*namespaceAlias{"data": available, "scratch": unavailable},
+	}
+	return
+}
+
+func TestNamespaceRoot(t *testing.T) {
+	ns, available := newTestNamespace()
+	root, _ := ns.Root()
+	ctx := context.Background()
+	dirents, err := root.(*namespaceRoot).ReadDirAll(ctx)
+	if err != nil || len(dirents) != 2 || dirents[0].Name != "data" || dirents[1].Name != "scratch" {
+		t.Fatalf("the root should list the aliases, but are %v, err %v", dirents, err)
+	}
+	attr := &fuse.Attr{}
+	if err = root.Attr(ctx, attr); err != nil || attr.Nlink != 4 || !attr.Mode.IsDir() {
+		t.Fatalf("unexpected attr %v of the root, err %v", attr, err)
+	}
+
+	lookup := root.(*namespaceRoot).Lookup
+	if node, err := lookup(ctx, "data"); err != nil || node != available.root {
+		t.Fatalf("expect the root of the alias, but is %v, err %v", node, err)
+	}
+	// the alias of the unavailable volume fails until it is connected, while the others are served
+	if _, err = lookup(ctx, "scratch"); err != fuse.EIO {
+		t.Fatalf("expect EIO of the unavailable alias, but is %v", err)
+	}
+	if _, err = lookup(ctx, "other"); err != fuse.ENOENT {
+		t.Fatalf("expect ENOENT of the unknown alias, but is %v", err)
+	}
+}
+
+func TestNamespaceCrossAlias(t *testing.T) {
+	src := &Dir{super: &Super{volname: "volA"}, info: &proto.InodeInfo{Inode: 10}}
+	dst := &Dir{super: &Super{volname: "volB"}, info: &proto.InodeInfo{Inode: 10}}
+	ctx := context.Background()
+	if err := src.Rename(ctx, &fuse.RenameRequest{OldName: "a", NewName: "b"}, dst); err != fuse.Errno(syscall.EXDEV) {
+		t.Fatalf("expect EXDEV renaming to another alias, but is %v", err)
+	}
+	file := &File{super: src.super, info: &proto.InodeInfo{Inode: 11}}
+	if _, err := dst.Link(ctx, &fuse.LinkRequest{NewName: "b"}, file); err != fuse.Errno(syscall.EXDEV) {
+		t.Fatalf("expect EXDEV linking to another alias, but is %v", err)
+	}
+}
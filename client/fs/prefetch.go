@@ -0,0 +1,313 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// the number of the directories prefetched at the same time
+	DirPrefetchConcurrency = 4
+	// the maximum number of the subdirectories prefetched after a directory is read
+	DirPrefetchBudget = 64
+	// the maximum number of the prefetched directories not read yet
+	MaxPrefetchedDirs = 1024
+	// the prefetched entries not read within this duration are dropped, which bounds their staleness
+	DirPrefetchValidDuration = 10 * time.Second
+)
+
+// the hints of the upcoming accesses to a directory, the values of PrefetchXattrName
+const (
+	// all the children of the directory will be stat, e.g. ls -l
+	PrefetchHintStat = "stat"
+	// all the entries in the tree of the directory will be stat, e.g. ls -lR and find
+	PrefetchHintTree = "tree"
+)
+
+// PrefetchStat defines the statistics of the directory prefetch, by which the hit rate is evaluated.
+type PrefetchStat struct {
+	Prefetched uint64 // directories prefetched
+	Hits       uint64 // directories read from the prefetched entries
+	Misses     uint64 // directories read from the meta nodes
+	Wasted     uint64 // prefetched directories dropped before being read
+	Skipped    uint64 // subdirectories not prefetched since the budget is exhausted
+	Hints      uint64 // directories hinted by the applications
+}
+
+type prefetchedDir struct {
+	children   []proto.Dentry
+	expiration time.Time
+}
+
+// DirPrefetcher prefetches the entries and the attributes of the subdirectories once a directory is read, so that
+// the tree walks reading the directories breadth-first, e.g. chown -R and find, are served from the memory. The
+// prefetched entries are read only once, and dropped once the directory is changed.
+type DirPrefetcher struct {
+	sync.Mutex
+	readDir    func(ino uint64) ([]proto.Dentry, error) // reads the children of the directory with their attributes cached
+	queue      chan uint64
+	dirs       map[uint64]*prefetchedDir
+	pending    map[uint64]bool // queued or being prefetched
+	trees      map[uint64]bool // hinted by PrefetchHintTree, whose subdirectories are queued once it is prefetched
+	generation uint64          // increased by each invalidation to drop the prefetches in flight
+	stat       PrefetchStat
+	stopC      chan struct{}
+}
+
+// NewDirPrefetcher returns a new DirPrefetcher with the workers started.
+func NewDirPrefetcher(s *Super) *DirPrefetcher {
+	p := &DirPrefetcher{
+		readDir: s.readDirAttrs,
+		queue:   make(chan uint64, DirPrefetchBudget*DirPrefetchConcurrency),
+		dirs:    make(map[uint64]*prefetchedDir),
+		pending: make(map[uint64]bool),
+		trees:   make(map[uint64]bool),
+		stopC:   make(chan struct{}),
+	}
+	for i := 0; i < DirPrefetchConcurrency; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Stop stops the workers.
+func (p *DirPrefetcher) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stopC)
+}
+
+// Prefetch queues the subdirectories among the children of a directory just read to be prefetched.
+func (p *DirPrefetcher) Prefetch(children []proto.Dentry) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.expire()
+	p.queueSubdirs(children, false)
+}
+
+// Hint prefetches the directory ahead of the accesses hinted by the application, and the subdirectories in its tree
+// once their parents are prefetched if tree is true. The tree is prefetched within the limit of the prefetched
+// directories, so the rest of a large tree is prefetched once the directories are read as usual.
+func (p *DirPrefetcher) Hint(ino uint64, tree bool) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.expire()
+	p.stat.Hints++
+	if dir := p.dirs[ino]; dir != nil {
+		if tree {
+			p.queueSubdirs(dir.children, true)
+		}
+		return
+	}
+	if (p.pending[ino] || p.queueDir(ino)) && tree {
+		p.trees[ino] = true
+	}
+}
+
+// queueSubdirs queues the subdirectories among the children within the budget, whose trees are prefetched as well if
+// tree is true. The caller should grab the lock.
+func (p *DirPrefetcher) queueSubdirs(children []proto.Dentry, tree bool) {
+	budget := DirPrefetchBudget
+	for _, child := range children {
+		if !proto.IsDir(child.Type) || p.pending[child.Inode] || p.dirs[child.Inode] != nil {
+			continue
+		}
+		if budget == 0 {
+			p.stat.Skipped++
+			continue
+		}
+		if p.queueDir(child.Inode) {
+			budget--
+			if tree {
+				p.trees[child.Inode] = true
+			}
+		}
+	}
+}
+
+// queueDir queues the directory to be prefetched, which is skipped if there are too many prefetched directories. The
+// caller should grab the lock.
+func (p *DirPrefetcher) queueDir(ino uint64) bool {
+	if len(p.dirs)+len(p.pending) >= MaxPrefetchedDirs {
+		p.stat.Skipped++
+		return false
+	}
+	select {
+	case p.queue <- ino:
+		p.pending[ino] = true
+		return true
+	default:
+		p.stat.Skipped++
+		return false
+	}
+}
+
+// Take returns the prefetched children of the directory, which are removed once taken.
+func (p *DirPrefetcher) Take(ino uint64) (children []proto.Dentry, ok bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.Lock()
+	defer p.Unlock()
+	dir := p.dirs[ino]
+	if dir == nil {
+		p.stat.Misses++
+		return nil, false
+	}
+	delete(p.dirs, ino)
+	if dir.expiration.Before(time.Now()) {
+		p.stat.Wasted++
+		p.stat.Misses++
+		return nil, false
+	}
+	p.stat.Hits++
+	return dir.children, true
+}
+
+// Invalidate drops the prefetched children of the directory once it is changed.
+func (p *DirPrefetcher) Invalidate(ino uint64) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.generation++
+	if p.dirs[ino] != nil {
+		delete(p.dirs, ino)
+		p.stat.Wasted++
+	}
+}
+
+// Purge drops all the prefetched directories, e.g. when the memory pressure rises.
+func (p *DirPrefetcher) Purge() {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.generation++
+	p.stat.Wasted += uint64(len(p.dirs))
+	p.dirs = make(map[uint64]*prefetchedDir)
+}
+
+// Stat returns the statistics of the prefetch.
+func (p *DirPrefetcher) Stat() (stat PrefetchStat) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	return p.stat
+}
+
+func (p *DirPrefetcher) worker() {
+	for {
+		select {
+		case <-p.stopC:
+			return
+		case ino := <-p.queue:
+			p.prefetch(ino)
+		}
+	}
+}
+
+func (p *DirPrefetcher) prefetch(ino uint64) {
+	p.Lock()
+	generation := p.generation
+	p.Unlock()
+
+	children, err := p.readDir(ino)
+
+	p.Lock()
+	defer p.Unlock()
+	delete(p.pending, ino)
+	tree := p.trees[ino]
+	delete(p.trees, ino)
+	if err != nil {
+		log.LogDebugf("DirPrefetcher: ino(%v) err(%v)", ino, err)
+		return
+	}
+	// the directories might be changed during the prefetch
+	if p.generation != generation {
+		return
+	}
+	p.dirs[ino] = &prefetchedDir{children: children, expiration: time.Now().Add(DirPrefetchValidDuration)}
+	p.stat.Prefetched++
+	if tree {
+		p.queueSubdirs(children, true)
+	}
+}
+
+// readDirAttrs reads the children of the directory, and caches their attributes.
+func (s *Super) readDirAttrs(ino uint64) (children []proto.Dentry, err error) {
+	if children, err = s.mw.ReadDir_ll(ino); err != nil {
+		return
+	}
+	inodes := make([]uint64, 0, len(children))
+	for _, child := range children {
+		inodes = append(inodes, child.Inode)
+	}
+	for _, info := range s.mw.BatchInodeGet(inodes) {
+		s.ic.Put(info)
+	}
+	return
+}
+
+// expire drops the expired directories, which have never been read. The caller should grab the lock.
+func (p *DirPrefetcher) expire() {
+	if len(p.dirs) < MaxPrefetchedDirs/2 {
+		return
+	}
+	now := time.Now()
+	for ino, dir := range p.dirs {
+		if dir.expiration.Before(now) {
+			delete(p.dirs, ino)
+			p.stat.Wasted++
+		}
+	}
+}
+
+// prefetchHint prefetches the directory ahead of the accesses hinted by the application, which is set by the xattr
+// PrefetchXattrName. The hint is not persisted.
+func (d *Dir) prefetchHint(hint string) error {
+	if d.super.prefetcher == nil {
+		return fuse.ENOSYS
+	}
+	switch hint {
+	case PrefetchHintStat:
+		d.super.prefetcher.Hint(d.info.Inode, false)
+	case PrefetchHintTree:
+		d.super.prefetcher.Hint(d.info.Inode, true)
+	default:
+		return fuse.Errno(syscall.EINVAL)
+	}
+	log.LogDebugf("PrefetchHint: ino(%v) hint(%v)", d.info.Inode, hint)
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// newTestPrefetcher returns a prefetcher without the workers, whose queue is drained by drainPrefetcher, reading
+// the directories of the tree. Each directory ino has a file, and the subdirectories ino*10+1 .. ino*10+subdirs if it
+// is above the third level.
+func newTestPrefetcher(subdirs int) (p *DirPrefetcher, reads map[uint64]int) {
+	reads = make(map[uint64]int)
+	p = &DirPrefetcher{
+		queue:   make(chan uint64, DirPrefetchBudget*DirPrefetchConcurrency),
+		dirs:    make(map[uint64]*prefetchedDir),
+		pending: make(map[uint64]bool),
+		trees:   make(map[uint64]bool),
+	}
+	p.readDir = func(ino uint64) ([]proto.Dentry, error) {
+		reads[ino]++
+		return testDirChildren(ino, subdirs), nil
+	}
+	return
+}
+
+func testDirChildren(ino uint64, subdirs int) []proto.Dentry {
+	children := []proto.Dentry{{Name: "file", Inode: ino*10 + 9, Type: proto.Mode(0644)}}
+	if ino >= 100 {
+		return children
+	}
+	for i := 1; i <= subdirs; i++ {
+		children = append(children, proto.Dentry{Name: fmt.Sprintf("d%v", i), Inode: ino*10 + uint64(i), Type: proto.Mode(os.ModeDir | 0755)})
+	}
+	return children
+}
+
+func drainPrefetcher(p *DirPrefetcher) {
+	for {
+		select {
+		case ino := <-p.queue:
+			p.prefetch(ino)
+		default:
+			return
+		}
+	}
+}
+
+func TestDirPrefetch(t *testing.T) {
+	p, reads := newTestPrefetcher(3)
+	p.Prefetch(testDirChildren(1, 3))
+	drainPrefetcher(p)
+	if len(reads) != 3 || reads[19] != 0 {
+		t.Fatalf("only the subdirectories should be prefetched, but are %v", reads)
+	}
+
+	children, ok := p.Take(11)
+	if !ok || len(children) != 4 {
+		t.Fatalf("expect the prefetched children of dir 11, but are %v", children)
+	}
+	// the prefetched entries are read only once
+	if _, ok = p.Take(11); ok {
+		t.Fatalf("the prefetched entries should be taken once")
+	}
+
+	p.Invalidate(12)
+	if _, ok = p.Take(12); ok {
+		t.Fatalf("the prefetched entries of the changed dir should be dropped")
+	}
+	p.dirs[13].expiration = time.Now().Add(-time.Second)
+	if _, ok = p.Take(13); ok {
+		t.Fatalf("the expired entries should be dropped")
+	}
+	if stat := p.Stat(); stat.Prefetched != 3 || stat.Hits != 1 || stat.Misses != 3 || stat.Wasted != 2 {
+		t.Fatalf("unexpected stat %+v", stat)
+	}
+}
+
+func TestDirPrefetchInvalidatedInFlight(t *testing.T) {
+	p, _ := newTestPrefetcher(1)
+	p.readDir = func(ino uint64) ([]proto.Dentry, error) {
+		// a directory is changed while its children are read
+		p.Invalidate(ino)
+		return testDirChildren(ino, 1), nil
+	}
+	p.Prefetch(testDirChildren(1, 1))
+	drainPrefetcher(p)
+	if _, ok := p.Take(11); ok || len(p.pending) != 0 {
+		t.Fatalf("the entries read before the change should be dropped")
+	}
+}
+
+func TestDirPrefetchBudget(t *testing.T) {
+	p, reads := newTestPrefetcher(0)
+	children := make([]proto.Dentry, 0)
+	for i := 0; i < DirPrefetchBudget+6; i++ {
+		children = append(children, proto.Dentry{Inode: uint64(100 + i), Type: proto.Mode(os.ModeDir | 0755)})
+	}
+	p.Prefetch(children)
+	drainPrefetcher(p)
+	if len(reads) != DirPrefetchBudget || p.Stat().Skipped != 6 {
+		t.Fatalf("expect %v dirs prefetched and 6 skipped, but are %v and %+v", DirPrefetchBudget, len(reads), p.Stat())
+	}
+}
+
+func TestDirPrefetchHintTree(t *testing.T) {
+	p, reads := newTestPrefetcher(2)
+	p.Hint(1, true)
+	drainPrefetcher(p)
+	// the subdirectories of the hinted tree are prefetched level by level
+	for _, ino := range []uint64{1, 11, 12, 111, 112, 121, 122} {
+		if reads[ino] != 1 {
+			t.Fatalf("dir %v of the hinted tree should be prefetched once, but reads are %v", ino, reads)
+		}
+	}
+	if len(p.trees) != 0 || len(p.pending) != 0 {
+		t.Fatalf("the prefetch of the tree should be finished, trees %v pending %v", p.trees, p.pending)
+	}
+
+	// the hint of the stat prefetches the dir only
+	p, reads = newTestPrefetcher(2)
+	p.Hint(1, false)
+	drainPrefetcher(p)
+	if len(reads) != 1 || reads[1] != 1 {
+		t.Fatalf("only the hinted dir should be prefetched, but are %v", reads)
+	}
+}
+
+func TestSetxattrPrefetchHint(t *testing.T) {
+	p, reads := newTestPrefetcher(2)
+	d := &Dir{super: &Super{enableXattr: true, prefetcher: p}, info: &proto.InodeInfo{Inode: 1}}
+	setHint := func(hint string) error {
+		return d.Setxattr(context.Background(), &fuse.SetxattrRequest{Name: PrefetchXattrName, Xattr: []byte(hint)})
+	}
+	if err := setHint("unknown"); err != fuse.Errno(syscall.EINVAL) {
+		t.Fatalf("expect EINVAL for the unknown hint, but is %v", err)
+	}
+	if err := setHint(PrefetchHintTree); err != nil {
+		t.Fatal(err)
+	}
+	drainPrefetcher(p)
+	if len(reads) != 7 || p.Stat().Hints != 1 {
+		t.Fatalf("the hinted tree should be prefetched, reads %v stat %+v", reads, p.Stat())
+	}
+	if _, ok := p.Take(1); !ok {
+		t.Fatalf("the hinted dir should be prefetched")
+	}
+
+	// the hint is not supported if the prefetch is disabled
+	d.super.prefetcher = nil
+	if err := setHint(PrefetchHintStat); err != fuse.ENOSYS {
+		t.Fatalf("expect ENOSYS if the prefetch is disabled, but is %v", err)
+	}
+}
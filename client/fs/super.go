@@ -15,6 +15,7 @@
 package fs
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -29,9 +30,11 @@ import (
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/sdk/data/stream"
+	"github.com/chubaofs/chubaofs/sdk/master"
 	"github.com/chubaofs/chubaofs/sdk/meta"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/pressure"
 	"github.com/chubaofs/chubaofs/util/ump"
 )
 
@@ -54,6 +57,21 @@ type Super struct {
 	fsyncOnClose  bool
 	enableXattr   bool
 	rootIno       uint64
+
+	directIOAlignment int64
+	disableDirectIO   bool
+
+	enableDentryWatch bool
+	fsServer          *fs.Server
+
+	metrics     *Metrics
+	asyncCloser *AsyncCloser
+
+	dcacheLRU  *DentryCacheLRU
+	prefetcher *DirPrefetcher // nil if the directory prefetch is disabled
+	pressure   *pressure.Monitor
+	stopC      chan struct{} // closed on unmount to stop the background reports
+	closeOnce  sync.Once
 }
 
 // Functions that Super needs to implement
@@ -67,12 +85,15 @@ func NewSuper(opt *proto.MountOptions) (s *Super, err error) {
 	s = new(Super)
 	var masters = strings.Split(opt.Master, meta.HostsSeparator)
 	var metaConfig = &meta.MetaConfig{
-		Volume:        opt.Volname,
-		Owner:         opt.Owner,
-		Masters:       masters,
-		Authenticate:  opt.Authenticate,
-		TicketMess:    opt.TicketMess,
-		ValidateOwner: opt.Authenticate || opt.AccessKey == "",
+		Volume:         opt.Volname,
+		Owner:          opt.Owner,
+		Masters:        masters,
+		Authenticate:   opt.Authenticate,
+		TicketMess:     opt.TicketMess,
+		ValidateOwner:  opt.Authenticate || opt.AccessKey == "",
+		SkipVolGate:    opt.SkipVolGate,
+		DelegatedToken: opt.DelegatedToken,
+		AsOf:           opt.AsOf,
 	}
 	s.mw, err = meta.NewMetaWrapper(metaConfig)
 	if err != nil {
@@ -96,38 +117,130 @@ func NewSuper(opt *proto.MountOptions) (s *Super, err error) {
 		s.enSyncWrite = true
 	}
 	s.keepCache = opt.KeepCache
-	s.ic = NewInodeCache(inodeExpiration, MaxInodeCache)
+	maxInodes := MaxInodeCache
+	if opt.MaxCachedInodes > 0 {
+		maxInodes = int(opt.MaxCachedInodes)
+	}
+	maxDentries := MaxDentryCache
+	if opt.MaxCachedDentries > 0 {
+		maxDentries = int(opt.MaxCachedDentries)
+	}
+	s.ic = NewInodeCache(inodeExpiration, maxInodes)
+	s.dcacheLRU = NewDentryCacheLRU(maxDentries)
 	s.orphan = NewOrphanInodeList()
 	s.nodeCache = make(map[uint64]fs.Node)
 	s.disableDcache = opt.DisableDcache
 	s.fsyncOnClose = opt.FsyncOnClose
 	s.enableXattr = opt.EnableXattr
+	s.directIOAlignment = opt.DirectIOAlignment
+	s.enableDentryWatch = opt.EnableDentryWatch
+	s.applyVolFeatures(opt)
+	s.metrics = NewMetrics()
+	s.stopC = make(chan struct{})
+	if !opt.DisableDirPrefetch {
+		s.prefetcher = NewDirPrefetcher(s)
+	}
 
 	var extentConfig = &stream.ExtentConfig{
 		Volume:            opt.Volname,
 		Masters:           masters,
 		FollowerRead:      opt.FollowerRead,
 		NearRead:          opt.NearRead,
+		ZoneName:          opt.ZoneName,
 		ReadRate:          opt.ReadRate,
 		WriteRate:         opt.WriteRate,
+		HedgeReadBudget:   opt.HedgeReadBudget,
+		DelegatedToken:    opt.DelegatedToken,
+		VerifyRead:        opt.AsOf != 0,
 		OnAppendExtentKey: s.mw.AppendExtentKey,
 		OnGetExtents:      s.mw.GetExtents,
 		OnTruncate:        s.mw.Truncate,
 		OnEvictIcache:     s.ic.Delete,
 	}
+	if s.mw.VolFeatureRequired(proto.FeatureDedup) {
+		extentConfig.OnDedupRegister = s.mw.DedupRegister
+		extentConfig.OnDedupReference = s.mw.DedupReference
+		log.LogInfof("NewSuper: volume(%v) requires %v, the files can only be appended", s.volname, proto.FeatureDedup)
+	}
+	if opt.AsOf != 0 {
+		log.LogInfof("NewSuper: volume(%v) is mounted read-only as of %v", s.volname,
+			time.Unix(opt.AsOf, 0).Format(time.RFC3339))
+	}
 	s.ec, err = stream.NewExtentClient(extentConfig)
 	if err != nil {
 		return nil, errors.Trace(err, "NewExtentClient failed!")
 	}
+	if shadow := s.mw.Shadow(); shadow.ShadowMirrors() && opt.AsOf == 0 {
+		if err = s.setShadow(opt, masters, shadow.Name); err != nil {
+			return nil, err
+		}
+	}
 
 	if s.rootIno, err = s.mw.GetRootIno(opt.SubDir); err != nil {
 		return nil, err
 	}
 
-	log.LogInfof("NewSuper: cluster(%v) volname(%v) icacheExpiration(%v) LookupValidDuration(%v) AttrValidDuration(%v)", s.cluster, s.volname, inodeExpiration, LookupValidDuration, AttrValidDuration)
+	if opt.AsyncClose {
+		s.asyncCloser = NewAsyncCloser(s.ec, s.metrics, int(opt.AsyncCloseQueueSize), opt.StrictAsyncClose)
+	}
+
+	if s.pressure, err = pressure.NewMonitor("fuseclient", nil); err != nil {
+		return nil, err
+	}
+	s.pressure.AddRelief(s.relieveCachePressure)
+	s.pressure.Start()
+
+	log.LogInfof("NewSuper: cluster(%v) volname(%v) icacheExpiration(%v) LookupValidDuration(%v) AttrValidDuration(%v) maxCachedInodes(%v) maxCachedDentries(%v)",
+		s.cluster, s.volname, inodeExpiration, LookupValidDuration, AttrValidDuration, maxInodes, maxDentries)
 	return s, nil
 }
 
+// setShadow mirrors the data written to the shadow volume, whose namespace is mirrored by the meta nodes. The extents
+// written to the shadow are appended to the inodes of the shadow, which have the same inode numbers.
+func (s *Super) setShadow(opt *proto.MountOptions, masters []string, shadow string) (err error) {
+	shadowMw, err := meta.NewMetaWrapper(&meta.MetaConfig{
+		Volume:        shadow,
+		Owner:         opt.Owner,
+		Masters:       masters,
+		Authenticate:  opt.Authenticate,
+		TicketMess:    opt.TicketMess,
+		ValidateOwner: opt.Authenticate || opt.AccessKey == "",
+		SkipVolGate:   opt.SkipVolGate,
+	})
+	if err != nil {
+		return errors.Trace(err, "NewMetaWrapper of shadow(%v) failed!", shadow)
+	}
+	shadowEc, err := stream.NewExtentClient(&stream.ExtentConfig{
+		Volume:            shadow,
+		Masters:           masters,
+		ZoneName:          opt.ZoneName,
+		WriteRate:         opt.WriteRate,
+		OnAppendExtentKey: shadowMw.AppendExtentKey,
+		OnGetExtents:      shadowMw.GetExtents,
+		OnTruncate:        shadowMw.Truncate,
+	})
+	if err != nil {
+		shadowMw.Close()
+		return errors.Trace(err, "NewExtentClient of shadow(%v) failed!", shadow)
+	}
+	s.ec.SetShadow(shadowEc)
+	s.metrics.shadowFailures = s.ec.ShadowFailures
+	log.LogInfof("NewSuper: the data written to volume(%v) is mirrored to shadow(%v)", s.volname, shadow)
+	return nil
+}
+
+// Close waits for the deferred closes of the files to finish. It can be called more than once.
+func (s *Super) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stopC)
+		s.pressure.Stop()
+		s.prefetcher.Stop()
+		if s.asyncCloser != nil {
+			s.asyncCloser.Stop()
+		}
+	})
+}
+
 // Root returns the root directory where it resides.
 func (s *Super) Root() (fs.Node, error) {
 	inode, err := s.InodeGet(s.rootIno)
@@ -135,22 +248,60 @@ func (s *Super) Root() (fs.Node, error) {
 		return nil, err
 	}
 	root := NewDir(s, inode)
+	s.fslock.Lock()
+	s.nodeCache[s.rootIno] = root
+	s.fslock.Unlock()
 	return root, nil
 }
 
 // Statfs handles the Statfs request and returns a set of statistics.
 func (s *Super) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
-	total, used := s.mw.Statfs()
-	resp.Blocks = total / uint64(DefaultBlksize)
-	resp.Bfree = (total - used) / uint64(DefaultBlksize)
+	fillStatfs(resp, s.mw.VolStat())
+	return nil
+}
+
+// fillStatfs reports the capacity and the inodes of the volume in terms of blocks of DefaultBlksize. The blocks in use
+// are rounded up, so that a partially used block is never reported as free.
+func fillStatfs(resp *fuse.StatfsResponse, stat *meta.VolStat) {
+	used := stat.Used
+	if used > stat.Total {
+		used = stat.Total
+	}
+	resp.Blocks = stat.Total / uint64(DefaultBlksize)
+	usedBlocks := (used + uint64(DefaultBlksize) - 1) / uint64(DefaultBlksize)
+	if usedBlocks > resp.Blocks {
+		usedBlocks = resp.Blocks
+	}
+	resp.Bfree = resp.Blocks - usedBlocks
 	resp.Bavail = resp.Bfree
+	resp.Files = stat.Inodes
+	resp.Ffree = stat.FreeInodes
 	resp.Bsize = DefaultBlksize
 	resp.Namelen = DefaultMaxNameLen
 	resp.Frsize = DefaultBlksize
-	return nil
 }
 
 // ClusterName returns the cluster name.
+// applyVolFeatures turns off the features which are disabled by the volume, overriding the mount options.
+func (s *Super) applyVolFeatures(opt *proto.MountOptions) {
+	if s.enableXattr && s.mw.VolFeatureDisabled(proto.FeatureXattr) {
+		s.enableXattr = false
+		log.LogWarnf("NewSuper: volume(%v) disables %v", s.volname, proto.FeatureXattr)
+	}
+	if opt.EnablePosixACL && s.mw.VolFeatureDisabled(proto.FeaturePosixACL) {
+		opt.EnablePosixACL = false
+		log.LogWarnf("NewSuper: volume(%v) disables %v", s.volname, proto.FeaturePosixACL)
+	}
+	if opt.AsyncClose && s.mw.VolFeatureDisabled(proto.FeatureAsyncClose) {
+		opt.AsyncClose = false
+		log.LogWarnf("NewSuper: volume(%v) disables %v", s.volname, proto.FeatureAsyncClose)
+	}
+	if s.mw.VolFeatureDisabled(proto.FeatureDirectIO) {
+		s.disableDirectIO = true
+		log.LogWarnf("NewSuper: volume(%v) disables %v", s.volname, proto.FeatureDirectIO)
+	}
+}
+
 func (s *Super) ClusterName() string {
 	return s.cluster
 }
@@ -186,6 +337,38 @@ func (s *Super) SetRate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetMetrics returns the summarized operation metrics of the mounted volume.
+func (s *Super) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(s.metricsSummary())
+	if err != nil {
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(data)
+}
+
+// metricsSummary returns the summarized metrics of the mount, which are told apart by the master from those of the
+// other mounts of the volume on the same host by the client ID.
+func (s *Super) metricsSummary() *proto.ClientMetrics {
+	return s.metrics.Summary(s.volname, s.mw.ClientID())
+}
+
+// PushMetrics periodically reports the summarized metrics to the master until the volume is unmounted.
+func (s *Super) PushMetrics(mc *master.MasterClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopC:
+			return
+		case <-ticker.C:
+			if err := mc.ClientAPI().ReportClientMetrics(s.metricsSummary()); err != nil {
+				log.LogWarnf("PushMetrics: volume(%v) err(%v)", s.volname, err)
+			}
+		}
+	}
+}
+
 func (s *Super) exporterKey(act string) string {
 	return fmt.Sprintf("%v_fuseclient_%v", s.cluster, act)
 }
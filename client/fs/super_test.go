@@ -0,0 +1,73 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"testing"
+
+	"bazil.org/fuse"
+
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/pressure"
+)
+
+func TestFillStatfs(t *testing.T) {
+	const blk = uint64(DefaultBlksize)
+	tests := []struct {
+		stat          meta.VolStat
+		blocks, bfree uint64
+	}{
+		{meta.VolStat{Total: 10 * blk, Used: 3 * blk}, 10, 7},
+		// a partially used block is never reported as free
+		{meta.VolStat{Total: 10 * blk, Used: 3*blk + 1}, 10, 6},
+		{meta.VolStat{Total: 10 * blk, Used: 20 * blk}, 10, 0},
+		{meta.VolStat{Total: 10*blk + blk/2, Used: 10 * blk}, 10, 0},
+	}
+	for _, test := range tests {
+		stat := test.stat
+		stat.Inodes, stat.FreeInodes = 100, 60
+		resp := &fuse.StatfsResponse{}
+		fillStatfs(resp, &stat)
+		if resp.Blocks != test.blocks || resp.Bfree != test.bfree || resp.Bavail != test.bfree {
+			t.Fatalf("expect blocks %v free %v of stat %+v, but are %v and %v", test.blocks, test.bfree, stat,
+				resp.Blocks, resp.Bfree)
+		}
+		if resp.Files != 100 || resp.Ffree != 60 || resp.Bsize != DefaultBlksize || resp.Frsize != DefaultBlksize {
+			t.Fatalf("unexpected statfs %+v", resp)
+		}
+	}
+}
+
+func TestSuperCloseTwice(t *testing.T) {
+	monitor, err := pressure.NewMonitor("fuseclient", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefetcher, _ := newTestPrefetcher(0)
+	prefetcher.stopC = make(chan struct{})
+	s := &Super{
+		stopC:       make(chan struct{}),
+		pressure:    monitor,
+		prefetcher:  prefetcher,
+		asyncCloser: NewAsyncCloser(&blockingCloser{}, NewMetrics(), 1, false),
+	}
+	s.Close()
+	s.Close()
+	select {
+	case <-s.stopC:
+	default:
+		t.Fatalf("the background reports should be stopped")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// TagRoot is the read-only virtual directory under the root of the volume which lists all the tags.
+// Files are tagged by setting the xattr named proto.XAttrKeyTagPrefix+<tag>.
+type TagRoot struct {
+	super *Super
+}
+
+// TagDir is the read-only virtual directory which lists all the files attached with the tag.
+type TagDir struct {
+	super *Super
+	tag   string
+}
+
+// Functions that TagRoot and TagDir need to implement
+var (
+	_ fs.Node                = (*TagRoot)(nil)
+	_ fs.NodeRequestLookuper = (*TagRoot)(nil)
+	_ fs.HandleReadDirAller  = (*TagRoot)(nil)
+	_ fs.Node                = (*TagDir)(nil)
+	_ fs.NodeRequestLookuper = (*TagDir)(nil)
+	_ fs.HandleReadDirAller  = (*TagDir)(nil)
+)
+
+func fillVirtualDirAttr(a *fuse.Attr) {
+	a.Valid = AttrValidDuration
+	a.Nlink = 2
+	a.Mode = os.ModeDir | 0555
+	a.BlockSize = DefaultBlksize
+}
+
+// Attr sets the attributes of the tag root.
+func (r *TagRoot) Attr(ctx context.Context, a *fuse.Attr) error {
+	fillVirtualDirAttr(a)
+	return nil
+}
+
+// Lookup handles the lookup request of a tag.
+func (r *TagRoot) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	tags, _, err := r.super.mw.ListTag_ll("")
+	if err != nil {
+		log.LogErrorf("Lookup tag: name(%v) err(%v)", req.Name, err)
+		return nil, ParseError(err)
+	}
+	for _, tag := range tags {
+		if tag == req.Name {
+			resp.EntryValid = LookupValidDuration
+			return &TagDir{super: r.super, tag: tag}, nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// ReadDirAll lists all the tags of the volume.
+func (r *TagRoot) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	tags, _, err := r.super.mw.ListTag_ll("")
+	if err != nil {
+		log.LogErrorf("Readdir tags: err(%v)", err)
+		return make([]fuse.Dirent, 0), ParseError(err)
+	}
+	dirents := make([]fuse.Dirent, 0, len(tags))
+	for _, tag := range tags {
+		if strings.Contains(tag, "/") {
+			continue
+		}
+		dirents = append(dirents, fuse.Dirent{Type: fuse.DT_Dir, Name: tag})
+	}
+	return dirents, nil
+}
+
+// Attr sets the attributes of the tag directory.
+func (d *TagDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	fillVirtualDirAttr(a)
+	return nil
+}
+
+// Lookup handles the lookup request of a file attached with the tag.
+func (d *TagDir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	entries, err := d.entries()
+	if err != nil {
+		log.LogErrorf("Lookup tag entry: tag(%v) name(%v) err(%v)", d.tag, req.Name, err)
+		return nil, ParseError(err)
+	}
+	for _, entry := range entries {
+		if entry.Name != req.Name {
+			continue
+		}
+		info, err := d.super.InodeGet(entry.Inode)
+		if err != nil {
+			log.LogErrorf("Lookup tag entry: tag(%v) name(%v) ino(%v) err(%v)", d.tag, req.Name, entry.Inode, err)
+			return nil, ParseError(err)
+		}
+		d.super.fslock.Lock()
+		child, ok := d.super.nodeCache[info.Inode]
+		if !ok {
+			if proto.OsMode(info.Mode).IsDir() {
+				child = NewDir(d.super, info)
+			} else {
+				child = NewFile(d.super, info)
+			}
+			d.super.nodeCache[info.Inode] = child
+		}
+		d.super.fslock.Unlock()
+		resp.EntryValid = LookupValidDuration
+		return child, nil
+	}
+	return nil, fuse.ENOENT
+}
+
+// ReadDirAll lists all the files attached with the tag.
+func (d *TagDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := d.entries()
+	if err != nil {
+		log.LogErrorf("Readdir tag: tag(%v) err(%v)", d.tag, err)
+		return make([]fuse.Dirent, 0), ParseError(err)
+	}
+	dirents := make([]fuse.Dirent, 0, len(entries))
+	for _, entry := range entries {
+		dirents = append(dirents, fuse.Dirent{Inode: entry.Inode, Type: fuse.DT_Unknown, Name: entry.Name})
+	}
+	return dirents, nil
+}
+
+// entries returns the files attached with the tag, named by the value of the tag xattr.
+// The inode ID is used if the value is not a valid file name, and is appended if the name conflicts.
+func (d *TagDir) entries() ([]*proto.TagEntry, error) {
+	_, entries, err := d.super.mw.ListTag_ll(d.tag)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		ino := strconv.FormatUint(entry.Inode, 10)
+		if entry.Name == "" || entry.Name == "." || entry.Name == ".." || strings.Contains(entry.Name, "/") {
+			entry.Name = ino
+		}
+		if _, conflict := names[entry.Name]; conflict {
+			entry.Name = fmt.Sprintf("%v_%v", entry.Name, ino)
+		}
+		names[entry.Name] = struct{}{}
+	}
+	return entries, nil
+}
@@ -33,8 +33,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/chubaofs/chubaofs/sdk/master"
 
@@ -69,6 +71,9 @@ const (
 	ControlCommandSetRate      = "/rate/set"
 	ControlCommandGetRate      = "/rate/get"
 	ControlCommandFreeOSMemory = "/debug/freeosmemory"
+	ControlCommandGetMetrics   = "/metrics/summary"
+	ControlCommandGetCacheStat = "/cache/stat"
+	ControlCommandGetNamespace = "/namespace/stats"
 	Role                       = "Client"
 )
 
@@ -118,6 +123,7 @@ func main() {
 	} else {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 	}
+	proto.SetLocalPriority(opt.Priority)
 
 	exporter.Init(ModuleName, cfg)
 
@@ -157,14 +163,19 @@ func main() {
 
 	registerInterceptedSignal(opt.MountPoint)
 
-	if err = checkPermission(opt); err != nil {
+	if len(opt.Namespace) > 0 {
+		err = checkNamespacePermission(opt)
+	} else {
+		err = checkPermission(opt)
+	}
+	if err != nil {
 		syslog.Println("check permission failed: ", err)
 		log.LogFlush()
 		_ = daemonize.SignalOutcome(err)
 		os.Exit(1)
 	}
 
-	fsConn, super, err := mount(opt)
+	fsConn, fsys, err := mount(opt)
 	if err != nil {
 		syslog.Println("mount failed: ", err)
 		log.LogFlush()
@@ -175,13 +186,16 @@ func main() {
 	}
 	defer fsConn.Close()
 
-	exporter.RegistConsul(super.ClusterName(), ModuleName, cfg)
+	exporter.RegistConsul(fsys.ClusterName(), ModuleName, cfg)
 
-	if err = fs.Serve(fsConn, super); err != nil {
+	server := fs.New(fsConn, nil)
+	fsys.SetServer(server)
+	if err = server.Serve(fsys); err != nil {
 		log.LogFlush()
 		syslog.Printf("fs Serve returns err(%v)", err)
 		os.Exit(1)
 	}
+	fsys.Close()
 
 	<-fsConn.Ready
 	if fsConn.MountError != nil {
@@ -231,15 +245,25 @@ func startDaemon() error {
 	return nil
 }
 
-func mount(opt *proto.MountOptions) (fsConn *fuse.Conn, super *cfs.Super, err error) {
-	super, err = cfs.NewSuper(opt)
+// mountedFS is the file system served by the client, which is a volume or a namespace of the volumes.
+type mountedFS interface {
+	fs.FS
+	ClusterName() string
+	SetServer(server *fs.Server)
+	Close()
+}
+
+func mount(opt *proto.MountOptions) (fsConn *fuse.Conn, fsys mountedFS, err error) {
+	if len(opt.Namespace) > 0 {
+		fsys, err = newNamespace(opt)
+	} else {
+		fsys, err = newSuper(opt)
+	}
 	if err != nil {
 		log.LogError(errors.Stack(err))
 		return
 	}
 
-	http.HandleFunc(ControlCommandSetRate, super.SetRate)
-	http.HandleFunc(ControlCommandGetRate, super.GetRate)
 	http.HandleFunc(log.SetLogLevelPath, log.SetLogLevel)
 	http.HandleFunc(ControlCommandFreeOSMemory, freeOSMemory)
 	http.HandleFunc(log.GetLogPath, log.GetLog)
@@ -260,18 +284,22 @@ func mount(opt *proto.MountOptions) (fsConn *fuse.Conn, super *cfs.Super, err er
 		}
 	}()
 
-	if err = ump.InitUmp(fmt.Sprintf("%v_%v", super.ClusterName(), ModuleName), opt.UmpDatadir); err != nil {
+	if err = ump.InitUmp(fmt.Sprintf("%v_%v", fsys.ClusterName(), ModuleName), opt.UmpDatadir); err != nil {
 		return
 	}
 
+	fsName := "chubaofs-" + opt.Volname
+	if len(opt.Namespace) > 0 {
+		fsName = "chubaofs-namespace"
+	}
 	options := []fuse.MountOption{
 		fuse.AllowOther(),
 		fuse.MaxReadahead(MaxReadAhead),
 		fuse.AsyncRead(),
 		fuse.AutoInvalData(opt.AutoInvalData),
-		fuse.FSName("chubaofs-" + opt.Volname),
+		fuse.FSName(fsName),
 		fuse.LocalVolume(),
-		fuse.VolumeName("chubaofs-" + opt.Volname)}
+		fuse.VolumeName(fsName)}
 
 	if opt.Rdonly {
 		options = append(options, fuse.ReadOnly())
@@ -289,6 +317,41 @@ func mount(opt *proto.MountOptions) (fsConn *fuse.Conn, super *cfs.Super, err er
 	return
 }
 
+func newSuper(opt *proto.MountOptions) (super *cfs.Super, err error) {
+	if super, err = cfs.NewSuper(opt); err != nil {
+		return
+	}
+	http.HandleFunc(ControlCommandSetRate, super.SetRate)
+	http.HandleFunc(ControlCommandGetRate, super.GetRate)
+	http.HandleFunc(ControlCommandGetMetrics, super.GetMetrics)
+	http.HandleFunc(ControlCommandGetCacheStat, super.GetCacheStat)
+
+	if opt.MetricsPushInterval > 0 {
+		mc := master.NewMasterClientFromString(opt.Master, false)
+		go super.PushMetrics(mc, time.Duration(opt.MetricsPushInterval)*time.Second)
+	}
+	return
+}
+
+// newNamespace mounts the namespace of the aliases, whose rates, metrics and cache statistics are controlled and
+// queried by the alias in the request.
+func newNamespace(opt *proto.MountOptions) (ns *cfs.Namespace, err error) {
+	if ns, err = cfs.NewNamespace(opt); err != nil {
+		return
+	}
+	http.HandleFunc(ControlCommandSetRate, ns.HandleAlias((*cfs.Super).SetRate))
+	http.HandleFunc(ControlCommandGetRate, ns.HandleAlias((*cfs.Super).GetRate))
+	http.HandleFunc(ControlCommandGetMetrics, ns.HandleAlias((*cfs.Super).GetMetrics))
+	http.HandleFunc(ControlCommandGetCacheStat, ns.HandleAlias((*cfs.Super).GetCacheStat))
+	http.HandleFunc(ControlCommandGetNamespace, ns.GetStats)
+
+	if opt.MetricsPushInterval > 0 {
+		mc := master.NewMasterClientFromString(opt.Master, false)
+		go ns.PushMetrics(mc, time.Duration(opt.MetricsPushInterval)*time.Second)
+	}
+	return
+}
+
 func registerInterceptedSignal(mnt string) {
 	sigC := make(chan os.Signal, 1)
 	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
@@ -350,15 +413,58 @@ func parseMountOption(cfg *config.Config) (*proto.MountOptions, error) {
 	opt.EnableXattr = GlobalMountOptions[proto.EnableXattr].GetBool()
 	opt.NearRead = GlobalMountOptions[proto.NearRead].GetBool()
 	opt.EnablePosixACL = GlobalMountOptions[proto.EnablePosixACL].GetBool()
+	opt.MetricsPushInterval = GlobalMountOptions[proto.MetricsPushInterval].GetInt64()
+	opt.AsyncClose = GlobalMountOptions[proto.AsyncClose].GetBool()
+	opt.AsyncCloseQueueSize = GlobalMountOptions[proto.AsyncCloseQueueSize].GetInt64()
+	opt.StrictAsyncClose = GlobalMountOptions[proto.StrictAsyncClose].GetBool()
+	opt.DirectIOAlignment = GlobalMountOptions[proto.DirectIOAlignment].GetInt64()
+	opt.SkipVolGate = GlobalMountOptions[proto.SkipVolGate].GetBool()
+	opt.EnableDentryWatch = GlobalMountOptions[proto.EnableDentryWatch].GetBool()
+	opt.ZoneName = GlobalMountOptions[proto.ZoneName].GetString()
+	opt.MaxCachedInodes = GlobalMountOptions[proto.MaxCachedInodes].GetInt64()
+	opt.MaxCachedDentries = GlobalMountOptions[proto.MaxCachedDentries].GetInt64()
+	opt.DisableDirPrefetch = GlobalMountOptions[proto.DisableDirPrefetch].GetBool()
+	opt.HedgeReadBudget = GlobalMountOptions[proto.HedgeReadBudget].GetInt64()
+	opt.DelegatedToken = GlobalMountOptions[proto.DelegatedTokenKey].GetString()
+	if opt.AsOf, err = parseAsOf(GlobalMountOptions[proto.AsOf].GetString()); err != nil {
+		return nil, err
+	}
+	if opt.AsOf != 0 {
+		opt.Rdonly = true
+	}
+	if opt.Namespace, err = proto.ParseNamespace(GlobalMountOptions[proto.Namespace].GetString()); err != nil {
+		return nil, err
+	}
+	if opt.Priority, err = proto.ParsePriority(GlobalMountOptions[proto.Priority].GetString()); err != nil {
+		return nil, err
+	}
 
-	if opt.MountPoint == "" || opt.Volname == "" || opt.Owner == "" || opt.Master == "" {
+	if opt.MountPoint == "" || (opt.Volname == "" && len(opt.Namespace) == 0) || opt.Owner == "" || opt.Master == "" {
 		return nil, errors.New(fmt.Sprintf("invalid config file: lack of mandatory fields, mountPoint(%v), volName(%v), owner(%v), masterAddr(%v)", opt.MountPoint, opt.Volname, opt.Owner, opt.Master))
 	}
 
 	return opt, nil
 }
 
+// parseAsOf parses the time to mount as of, which is in unix seconds or RFC3339.
+func parseAsOf(value string) (asOf int64, err error) {
+	if value == "" {
+		return
+	}
+	if asOf, err = strconv.ParseInt(value, 10, 64); err == nil && asOf > 0 {
+		return
+	}
+	var t time.Time
+	if t, err = time.Parse(time.RFC3339, value); err != nil {
+		return 0, fmt.Errorf("invalid asOf(%v): neither unix seconds nor RFC3339", value)
+	}
+	return t.Unix(), nil
+}
+
 func checkPermission(opt *proto.MountOptions) (err error) {
+	if opt.DelegatedToken != "" {
+		return checkDelegatedToken(opt)
+	}
 	var mc = master.NewMasterClientFromString(opt.Master, false)
 
 	// Check token permission
@@ -406,6 +512,59 @@ func checkPermission(opt *proto.MountOptions) (err error) {
 	return
 }
 
+// checkNamespacePermission checks the permission of each alias of the namespace. The read-only permission of an
+// alias mounts the whole namespace read-only, since the permission is enforced by the mount.
+func checkNamespacePermission(opt *proto.MountOptions) (err error) {
+	for i, alias := range opt.Namespace {
+		aliasOpt := opt.AliasOptions(alias)
+		if err = checkPermission(aliasOpt); err != nil {
+			return fmt.Errorf("check permission of alias(%v) volume(%v) failed: %v", alias.Name, alias.Volume, err)
+		}
+		opt.Namespace[i].SubDir = aliasOpt.SubDir
+		if aliasOpt.Rdonly && !opt.Rdonly {
+			log.LogWarnf("checkNamespacePermission: alias(%v) volume(%v) is read-only, so is the namespace",
+				alias.Name, alias.Volume)
+			opt.Rdonly = true
+		}
+	}
+	return
+}
+
+// checkDelegatedToken limits the mount to the scope of the delegated token, i.e. mounts read-only with a read-only
+// token, and mounts the sub directory of the token or a directory in it. The master and the nodes validate the token,
+// and the meta nodes confine the requests under the sub directory.
+func checkDelegatedToken(opt *proto.MountOptions) (err error) {
+	var token *proto.DelegatedToken
+	if token, err = proto.DecodeDelegatedToken(opt.DelegatedToken); err != nil {
+		return
+	}
+	if token.VolName != opt.Volname {
+		return proto.ErrDelegatedTokenInvalid
+	}
+	if token.Expired(time.Now()) {
+		return proto.ErrDelegatedTokenExpired
+	}
+	opt.Rdonly = token.ReadOnly || opt.Rdonly
+	if token.Scoped() {
+		if token.RootInode == 0 {
+			// minted by a master not resolving the sub directory, which the meta nodes refuse
+			return proto.ErrDelegatedTokenInvalid
+		}
+		subDir := path.Clean("/" + opt.SubDir)
+		if opt.SubDir == "" {
+			subDir = token.SubDir
+		}
+		if subDir != token.SubDir && !strings.HasPrefix(subDir, token.SubDir+"/") {
+			log.LogWarnf("checkDelegatedToken: subdir(%v) is out of the subdir(%v) of the token", opt.SubDir, token.SubDir)
+			return proto.ErrNoPermission
+		}
+		opt.SubDir = subDir
+	}
+	log.LogInfof("checkDelegatedToken: token(%v) readOnly(%v) subDir(%v) expires at %v", token.ID, token.ReadOnly,
+		token.SubDir, time.Unix(token.ExpireTime, 0).Format(proto.TimeFormat))
+	return
+}
+
 func parseLogLevel(loglvl string) log.Level {
 	var level log.Level
 	switch strings.ToLower(loglvl) {
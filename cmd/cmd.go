@@ -41,6 +41,7 @@ import (
 	"github.com/chubaofs/chubaofs/cmd/common"
 	"github.com/chubaofs/chubaofs/datanode"
 	"github.com/chubaofs/chubaofs/master"
+	"github.com/chubaofs/chubaofs/metacache"
 	"github.com/chubaofs/chubaofs/metanode"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -51,26 +52,30 @@ const (
 	ConfigKeyRole       = "role"
 	ConfigKeyLogDir     = "logDir"
 	ConfigKeyLogLevel   = "logLevel"
+	ConfigKeyLogRate    = "logRateLimit"
+	ConfigKeyLogBurst   = "logRateBurst"
 	ConfigKeyProfPort   = "prof"
 	ConfigKeyWarnLogDir = "warnLogDir"
 )
 
 const (
-	RoleMaster  = "master"
-	RoleMeta    = "metanode"
-	RoleData    = "datanode"
-	RoleAuth    = "authnode"
-	RoleObject  = "objectnode"
-	RoleConsole = "console"
+	RoleMaster    = "master"
+	RoleMeta      = "metanode"
+	RoleData      = "datanode"
+	RoleAuth      = "authnode"
+	RoleObject    = "objectnode"
+	RoleConsole   = "console"
+	RoleMetaCache = "metacache"
 )
 
 const (
-	ModuleMaster  = "master"
-	ModuleMeta    = "metaNode"
-	ModuleData    = "dataNode"
-	ModuleAuth    = "authNode"
-	ModuleObject  = "objectNode"
-	ModuleConsole = "console"
+	ModuleMaster    = "master"
+	ModuleMeta      = "metaNode"
+	ModuleData      = "dataNode"
+	ModuleAuth      = "authNode"
+	ModuleObject    = "objectNode"
+	ModuleConsole   = "console"
+	ModuleMetaCache = "metaCache"
 )
 
 const (
@@ -81,6 +86,8 @@ var (
 	configFile       = flag.String("c", "", "config file path")
 	configVersion    = flag.Bool("v", false, "show version")
 	configForeground = flag.Bool("f", false, "run foreground")
+	configCheck      = flag.Bool("check", false, "check the config and the environment without starting the server")
+	configImport     = flag.String("import", "", "import the metadata archive into the empty store of the master and exit")
 )
 
 func interceptSignal(s common.Server) {
@@ -129,6 +136,12 @@ func main() {
 	 * call os.Exit() w/o notifying the parent process.
 	 */
 	cfg, err := config.LoadConfigFile(*configFile)
+	if *configCheck {
+		os.Exit(runPreflight(cfg, err))
+	}
+	if *configImport != "" {
+		os.Exit(runImport(cfg, err))
+	}
 	if err != nil {
 		daemonize.SignalOutcome(err)
 		os.Exit(1)
@@ -177,6 +190,9 @@ func main() {
 	case RoleConsole:
 		server = console.NewServer()
 		module = ModuleConsole
+	case RoleMetaCache:
+		server = metacache.NewServer()
+		module = ModuleMetaCache
 	default:
 		daemonize.SignalOutcome(fmt.Errorf("Fatal: role mismatch: %v", role))
 		os.Exit(1)
@@ -205,6 +221,14 @@ func main() {
 		os.Exit(1)
 	}
 	defer log.LogFlush()
+	logRate, logBurst := float64(log.DefaultRateLimit), log.DefaultRateBurst
+	if rate := cfg.GetFloat(ConfigKeyLogRate); rate >= 0 {
+		logRate = rate
+	}
+	if burst := cfg.GetInt64(ConfigKeyLogBurst); burst > 0 {
+		logBurst = int(burst)
+	}
+	log.SetRateLimit(logRate, logBurst)
 
 	// Init output file
 	outputFilePath := path.Join(logDir, module, LoggerOutput)
@@ -0,0 +1,41 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/master"
+	"github.com/chubaofs/chubaofs/util/config"
+)
+
+// runImport loads the metadata archive into the store of the master without starting it, and returns the exit code.
+func runImport(cfg *config.Config, loadErr error) int {
+	if loadErr != nil {
+		fmt.Printf("load config %v failed: %v\n", *configFile, loadErr)
+		return 1
+	}
+	if role := cfg.GetString(ConfigKeyRole); role != RoleMaster {
+		fmt.Printf("role %v can not import the metadata archive\n", role)
+		return 1
+	}
+	count, err := master.ImportMetadata(cfg, *configImport)
+	if err != nil {
+		fmt.Printf("import %v failed: %v\n", *configImport, err)
+		return 1
+	}
+	fmt.Printf("%v records imported from %v\n", count, *configImport)
+	return 0
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Metabench drives metadata workloads directly against the meta nodes of a volume through the meta SDK, and reports
+// the throughput and the latency percentiles of the operations.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+var (
+	masterAddr = flag.String("master", "", "master addresses, separated by comma")
+	volName    = flag.String("vol", "", "volume name")
+	owner      = flag.String("owner", "", "owner of the volume")
+	workers    = flag.Int("workers", 16, "number of concurrent workers")
+	duration   = flag.Duration("duration", 30*time.Second, "how long to run the workload")
+	totalOps   = flag.Int("ops", 0, "total number of operations to run, overrides -duration if positive")
+	mix        = flag.String("mix", "create=40,stat=30,readdir=10,unlink=20", "weights of the operations: "+strings.Join(allOps, ","))
+	width      = flag.Int("width", 10, "number of subdirectories in each directory of the tree")
+	depth      = flag.Int("depth", 2, "depth of the directory tree")
+	dist       = flag.String("dist", DistUniform, "distribution to pick the directories: uniform or zipf")
+	zipfS      = flag.Float64("zipf-s", 1.1, "skew of the zipf distribution, must be greater than 1")
+	seed       = flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	keep       = flag.Bool("keep", false, "keep the directory tree and the files after the run")
+	jsonOutput = flag.Bool("json", false, "print the report in json")
+	logDir     = flag.String("log-dir", "", "log directory of the meta SDK, no logs if empty")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		log.LogFlush()
+		os.Exit(1)
+	}
+	log.LogFlush()
+}
+
+func parseConfig() (cfg *benchConfig, err error) {
+	if *masterAddr == "" || *volName == "" || *owner == "" {
+		return nil, fmt.Errorf("-master, -vol and -owner are required")
+	}
+	if *workers <= 0 || *width <= 0 || *depth < 0 {
+		return nil, fmt.Errorf("-workers and -width must be positive, and -depth must not be negative")
+	}
+	if *dist != DistUniform && *dist != DistZipf {
+		return nil, fmt.Errorf("unknown distribution %v", *dist)
+	}
+	if *dist == DistZipf && *zipfS <= 1 {
+		return nil, fmt.Errorf("-zipf-s must be greater than 1")
+	}
+	cfg = &benchConfig{
+		workers:  *workers,
+		duration: *duration,
+		ops:      *totalOps,
+		width:    *width,
+		depth:    *depth,
+		dist:     *dist,
+		zipfS:    *zipfS,
+		seed:     *seed,
+	}
+	if cfg.mix, err = parseMix(*mix); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func run() (err error) {
+	cfg, err := parseConfig()
+	if err != nil {
+		return
+	}
+	if *logDir != "" {
+		if _, err = log.InitLog(*logDir, "metabench", log.WarnLevel, nil); err != nil {
+			return
+		}
+	}
+	mw, err := meta.NewMetaWrapper(&meta.MetaConfig{
+		Volume:        *volName,
+		Owner:         *owner,
+		Masters:       strings.Split(*masterAddr, meta.HostsSeparator),
+		ValidateOwner: true,
+	})
+	if err != nil {
+		return
+	}
+	defer mw.Close()
+
+	rootName := fmt.Sprintf("metabench-%v-%v", os.Getpid(), time.Now().Unix())
+	root, err := mw.Create_ll(proto.RootIno, rootName, proto.Mode(dirMode), 0, 0, nil)
+	if err != nil {
+		return fmt.Errorf("create root directory %v: %v", rootName, err)
+	}
+	fmt.Fprintf(os.Stderr, "building %v directories of width %v and depth %v under /%v\n",
+		treeSize(cfg.width, cfg.depth), cfg.width, cfg.depth, rootName)
+	tree, err := buildTree(mw, root.Inode, cfg.width, cfg.depth)
+	if err != nil {
+		return fmt.Errorf("build directory tree: %v", err)
+	}
+	dirs := make([]uint64, 0, len(tree))
+	for _, d := range tree {
+		dirs = append(dirs, d.ino)
+	}
+
+	report, ws := runBench(mw, cfg, dirs)
+	if *jsonOutput {
+		var data []byte
+		if data, err = json.MarshalIndent(report, "", "  "); err != nil {
+			return
+		}
+		fmt.Println(string(data))
+	} else {
+		report.print(os.Stdout)
+	}
+
+	if *keep {
+		fmt.Fprintf(os.Stderr, "kept the directory tree /%v\n", rootName)
+		return
+	}
+	for _, w := range ws {
+		if err = w.cleanup(); err != nil {
+			return fmt.Errorf("clean up files: %v", err)
+		}
+	}
+	if err = removeTree(mw, tree); err != nil {
+		return fmt.Errorf("remove directory tree: %v", err)
+	}
+	if _, err = mw.Delete_ll(proto.RootIno, rootName, true); err != nil {
+		return fmt.Errorf("remove root directory %v: %v", rootName, err)
+	}
+	return mw.Evict(root.Inode)
+}
+
+func treeSize(width, depth int) (size int) {
+	level := 1
+	for d := 0; d < depth; d++ {
+		level *= width
+		size += level
+	}
+	return
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// opStats records the latencies of an operation of a worker, so that the workers need no locking.
+type opStats struct {
+	latencies []time.Duration
+	errors    uint64
+}
+
+func (s *opStats) record(latency time.Duration, err error) {
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+func (s *opStats) merge(other *opStats) {
+	s.latencies = append(s.latencies, other.latencies...)
+	s.errors += other.errors
+}
+
+// OpReport is the result of an operation in a benchmark run.
+type OpReport struct {
+	Op     string  `json:"op"`
+	Count  int     `json:"count"`
+	Errors uint64  `json:"errors"`
+	OpsSec float64 `json:"opsPerSec"`
+	AvgUs  int64   `json:"avgUs"`
+	P50Us  int64   `json:"p50Us"`
+	P90Us  int64   `json:"p90Us"`
+	P99Us  int64   `json:"p99Us"`
+	P999Us int64   `json:"p999Us"`
+	MaxUs  int64   `json:"maxUs"`
+}
+
+// Report is the result of a benchmark run.
+type Report struct {
+	Workers  int         `json:"workers"`
+	Elapsed  float64     `json:"elapsedSec"`
+	TotalOps int         `json:"totalOps"`
+	OpsSec   float64     `json:"opsPerSec"`
+	Ops      []*OpReport `json:"ops"`
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func newOpReport(op string, s *opStats, elapsed time.Duration) *OpReport {
+	r := &OpReport{Op: op, Count: len(s.latencies), Errors: s.errors}
+	if r.Count == 0 {
+		return r
+	}
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	var total time.Duration
+	for _, latency := range s.latencies {
+		total += latency
+	}
+	r.OpsSec = float64(r.Count) / elapsed.Seconds()
+	r.AvgUs = (total / time.Duration(r.Count)).Microseconds()
+	r.P50Us = percentile(s.latencies, 0.5).Microseconds()
+	r.P90Us = percentile(s.latencies, 0.9).Microseconds()
+	r.P99Us = percentile(s.latencies, 0.99).Microseconds()
+	r.P999Us = percentile(s.latencies, 0.999).Microseconds()
+	r.MaxUs = s.latencies[len(s.latencies)-1].Microseconds()
+	return r
+}
+
+func (r *Report) print(w io.Writer) {
+	fmt.Fprintf(w, "workers %v, elapsed %.1fs, ops %v, %.0f op/s\n", r.Workers, r.Elapsed, r.TotalOps, r.OpsSec)
+	fmt.Fprintf(w, "%-8s %10s %8s %10s %10s %10s %10s %10s %10s %10s\n",
+		"op", "count", "errors", "op/s", "avg(us)", "p50(us)", "p90(us)", "p99(us)", "p999(us)", "max(us)")
+	for _, op := range r.Ops {
+		fmt.Fprintf(w, "%-8s %10d %8d %10.0f %10d %10d %10d %10d %10d %10d\n",
+			op.Op, op.Count, op.Errors, op.OpsSec, op.AvgUs, op.P50Us, op.P90Us, op.P99Us, op.P999Us, op.MaxUs)
+	}
+}
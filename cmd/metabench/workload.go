@@ -0,0 +1,311 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The operations of the workloads.
+const (
+	OpCreate  = "create"
+	OpStat    = "stat"
+	OpLookup  = "lookup"
+	OpReaddir = "readdir"
+	OpUnlink  = "unlink"
+)
+
+var allOps = []string{OpCreate, OpStat, OpLookup, OpReaddir, OpUnlink}
+
+// The distributions to pick the directories of the operations.
+const (
+	DistUniform = "uniform"
+	DistZipf    = "zipf"
+)
+
+const (
+	fileMode os.FileMode = 0644
+	dirMode              = os.ModeDir | 0755
+)
+
+// metaClient is the part of the meta SDK driven by the benchmark.
+type metaClient interface {
+	Create_ll(parentID uint64, name string, mode, uid, gid uint32, target []byte) (*proto.InodeInfo, error)
+	Lookup_ll(parentID uint64, name string) (inode uint64, mode uint32, err error)
+	InodeGet_ll(inode uint64) (*proto.InodeInfo, error)
+	ReadDir_ll(parentID uint64) ([]proto.Dentry, error)
+	Delete_ll(parentID uint64, name string, isDir bool) (*proto.InodeInfo, error)
+	Evict(inode uint64) error
+}
+
+type opWeight struct {
+	op     string
+	weight int
+}
+
+// parseMix parses an operation mix such as "create=40,stat=30,readdir=10,unlink=20".
+func parseMix(value string) (mix []opWeight, err error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix item %v, expect op=weight", item)
+		}
+		op := strings.TrimSpace(kv[0])
+		known := false
+		for _, o := range allOps {
+			known = known || o == op
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown op %v, the ops are %v", op, strings.Join(allOps, ","))
+		}
+		var weight int
+		if weight, err = strconv.Atoi(strings.TrimSpace(kv[1])); err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight of op %v: %v", op, kv[1])
+		}
+		if weight > 0 {
+			mix = append(mix, opWeight{op: op, weight: weight})
+		}
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("empty mix")
+	}
+	return
+}
+
+func pickOp(mix []opWeight, r *rand.Rand) string {
+	total := 0
+	for _, w := range mix {
+		total += w.weight
+	}
+	n := r.Intn(total)
+	for _, w := range mix {
+		if n < w.weight {
+			return w.op
+		}
+		n -= w.weight
+	}
+	return mix[len(mix)-1].op
+}
+
+type benchConfig struct {
+	workers  int
+	duration time.Duration
+	ops      int // total operations, overrides the duration if positive
+	mix      []opWeight
+	width    int
+	depth    int
+	dist     string
+	zipfS    float64
+	seed     int64
+}
+
+type fileEntry struct {
+	parent uint64
+	name   string
+	ino    uint64
+}
+
+// worker runs the operations in its own files, so that it can stat and unlink what it has created.
+type worker struct {
+	id    int
+	mc    metaClient
+	cfg   *benchConfig
+	dirs  []uint64
+	rand  *rand.Rand
+	zipf  *rand.Zipf
+	files []*fileEntry
+	seq   uint64
+	stats map[string]*opStats
+}
+
+func (w *worker) pickDir() uint64 {
+	if w.zipf != nil {
+		return w.dirs[w.zipf.Uint64()]
+	}
+	return w.dirs[w.rand.Intn(len(w.dirs))]
+}
+
+func (w *worker) pickFile() *fileEntry {
+	return w.files[w.rand.Intn(len(w.files))]
+}
+
+func (w *worker) runOp(op string) {
+	if len(w.files) == 0 && (op == OpStat || op == OpLookup || op == OpUnlink) {
+		op = OpCreate
+	}
+	var err error
+	start := time.Now()
+	switch op {
+	case OpCreate:
+		parent := w.pickDir()
+		w.seq++
+		name := fmt.Sprintf("w%v-%v", w.id, w.seq)
+		var info *proto.InodeInfo
+		if info, err = w.mc.Create_ll(parent, name, proto.Mode(fileMode), 0, 0, nil); err == nil {
+			w.files = append(w.files, &fileEntry{parent: parent, name: name, ino: info.Inode})
+		}
+	case OpStat:
+		_, err = w.mc.InodeGet_ll(w.pickFile().ino)
+	case OpLookup:
+		f := w.pickFile()
+		_, _, err = w.mc.Lookup_ll(f.parent, f.name)
+	case OpReaddir:
+		_, err = w.mc.ReadDir_ll(w.pickDir())
+	case OpUnlink:
+		i := w.rand.Intn(len(w.files))
+		f := w.files[i]
+		if _, err = w.mc.Delete_ll(f.parent, f.name, false); err == nil {
+			err = w.mc.Evict(f.ino)
+			w.files[i] = w.files[len(w.files)-1]
+			w.files = w.files[:len(w.files)-1]
+		}
+	}
+	w.stats[op].record(time.Since(start), err)
+}
+
+func (w *worker) run(ops int, deadline time.Time) {
+	for n := 0; ops <= 0 || n < ops; n++ {
+		if ops <= 0 && time.Now().After(deadline) {
+			return
+		}
+		w.runOp(pickOp(w.cfg.mix, w.rand))
+	}
+}
+
+// cleanup removes the files left by the worker.
+func (w *worker) cleanup() (err error) {
+	for _, f := range w.files {
+		if _, err = w.mc.Delete_ll(f.parent, f.name, false); err != nil {
+			return
+		}
+		if err = w.mc.Evict(f.ino); err != nil {
+			return
+		}
+	}
+	w.files = nil
+	return
+}
+
+type dirEntry struct {
+	parent uint64
+	name   string
+	ino    uint64
+}
+
+// buildTree creates the directories of the width and the depth under the parent, and returns them in the order of
+// creation, which includes the parent.
+func buildTree(mc metaClient, parent uint64, width, depth int) (dirs []*dirEntry, err error) {
+	dirs = []*dirEntry{{ino: parent}}
+	level := []uint64{parent}
+	for d := 0; d < depth; d++ {
+		next := make([]uint64, 0, len(level)*width)
+		for _, p := range level {
+			for i := 0; i < width; i++ {
+				name := fmt.Sprintf("d%v-%v", d, i)
+				var info *proto.InodeInfo
+				if info, err = mc.Create_ll(p, name, proto.Mode(dirMode), 0, 0, nil); err != nil {
+					return
+				}
+				dirs = append(dirs, &dirEntry{parent: p, name: name, ino: info.Inode})
+				next = append(next, info.Inode)
+			}
+		}
+		level = next
+	}
+	return
+}
+
+// removeTree removes the directories created by buildTree in the reverse order, except the parent.
+func removeTree(mc metaClient, dirs []*dirEntry) (err error) {
+	for i := len(dirs) - 1; i > 0; i-- {
+		if _, err = mc.Delete_ll(dirs[i].parent, dirs[i].name, true); err != nil {
+			return
+		}
+		if err = mc.Evict(dirs[i].ino); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func newWorker(id int, mc metaClient, cfg *benchConfig, dirs []uint64) *worker {
+	w := &worker{
+		id:    id,
+		mc:    mc,
+		cfg:   cfg,
+		dirs:  dirs,
+		rand:  rand.New(rand.NewSource(cfg.seed + int64(id))),
+		stats: make(map[string]*opStats),
+	}
+	if cfg.dist == DistZipf && len(dirs) > 1 {
+		w.zipf = rand.NewZipf(w.rand, cfg.zipfS, 1, uint64(len(dirs)-1))
+	}
+	for _, op := range allOps {
+		w.stats[op] = &opStats{}
+	}
+	return w
+}
+
+// runBench runs the workers on the directories, and leaves the files created by the workers for cleanup.
+func runBench(mc metaClient, cfg *benchConfig, dirs []uint64) (report *Report, workers []*worker) {
+	workers = make([]*worker, cfg.workers)
+	for i := range workers {
+		workers[i] = newWorker(i, mc, cfg, dirs)
+	}
+	ops := 0
+	if cfg.ops > 0 {
+		ops = (cfg.ops + cfg.workers - 1) / cfg.workers
+	}
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(cfg.duration)
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.run(ops, deadline)
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report = &Report{Workers: cfg.workers, Elapsed: elapsed.Seconds()}
+	for _, op := range allOps {
+		merged := &opStats{}
+		for _, w := range workers {
+			merged.merge(w.stats[op])
+		}
+		if len(merged.latencies) == 0 && merged.errors == 0 {
+			continue
+		}
+		r := newOpReport(op, merged, elapsed)
+		report.TotalOps += r.Count
+		report.Ops = append(report.Ops, r)
+	}
+	report.OpsSec = float64(report.TotalOps) / elapsed.Seconds()
+	return
+}
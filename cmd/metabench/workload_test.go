@@ -0,0 +1,181 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// memMeta is a namespace in memory which serves the benchmark in place of the meta nodes.
+type memMeta struct {
+	sync.Mutex
+	nextIno  uint64
+	inodes   map[uint64]uint32 // inode -> mode, until evicted
+	children map[uint64]map[string]uint64
+}
+
+func newMemMeta() *memMeta {
+	return &memMeta{
+		nextIno:  proto.RootIno,
+		inodes:   map[uint64]uint32{proto.RootIno: proto.Mode(dirMode)},
+		children: map[uint64]map[string]uint64{proto.RootIno: {}},
+	}
+}
+
+func (m *memMeta) Create_ll(parentID uint64, name string, mode, uid, gid uint32, target []byte) (*proto.InodeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	dentries, ok := m.children[parentID]
+	if !ok {
+		return nil, syscall.ENOTDIR
+	}
+	if _, exist := dentries[name]; exist {
+		return nil, syscall.EEXIST
+	}
+	m.nextIno++
+	dentries[name] = m.nextIno
+	m.inodes[m.nextIno] = mode
+	if proto.IsDir(mode) {
+		m.children[m.nextIno] = make(map[string]uint64)
+	}
+	return &proto.InodeInfo{Inode: m.nextIno, Mode: mode}, nil
+}
+
+func (m *memMeta) Lookup_ll(parentID uint64, name string) (uint64, uint32, error) {
+	m.Lock()
+	defer m.Unlock()
+	ino, ok := m.children[parentID][name]
+	if !ok {
+		return 0, 0, syscall.ENOENT
+	}
+	return ino, m.inodes[ino], nil
+}
+
+func (m *memMeta) InodeGet_ll(inode uint64) (*proto.InodeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	mode, ok := m.inodes[inode]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return &proto.InodeInfo{Inode: inode, Mode: mode}, nil
+}
+
+func (m *memMeta) ReadDir_ll(parentID uint64) ([]proto.Dentry, error) {
+	m.Lock()
+	defer m.Unlock()
+	dentries := make([]proto.Dentry, 0)
+	for name, ino := range m.children[parentID] {
+		dentries = append(dentries, proto.Dentry{Name: name, Inode: ino})
+	}
+	return dentries, nil
+}
+
+func (m *memMeta) Delete_ll(parentID uint64, name string, isDir bool) (*proto.InodeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	ino, ok := m.children[parentID][name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	if isDir && len(m.children[ino]) != 0 {
+		return nil, syscall.ENOTEMPTY
+	}
+	delete(m.children[parentID], name)
+	delete(m.children, ino)
+	return &proto.InodeInfo{Inode: ino}, nil
+}
+
+func (m *memMeta) Evict(inode uint64) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.inodes, inode)
+	return nil
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := parseMix(" create=40, stat=30,readdir=0 ,unlink=30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ops of no weight are left out
+	if len(mix) != 3 || mix[0] != (opWeight{op: OpCreate, weight: 40}) || mix[2] != (opWeight{op: OpUnlink, weight: 30}) {
+		t.Fatalf("unexpected mix %v", mix)
+	}
+	for _, value := range []string{"", "create", "rename=10", "create=-1", "create=x", "create=0"} {
+		if _, err = parseMix(value); err == nil {
+			t.Fatalf("the mix %q should be refused", value)
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	mc := newMemMeta()
+	tree, err := buildTree(mc, proto.RootIno, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 1+treeSize(3, 2) {
+		t.Fatalf("expect %v dirs, but are %v", 1+treeSize(3, 2), len(tree))
+	}
+	dirs := make([]uint64, 0, len(tree))
+	for _, d := range tree {
+		dirs = append(dirs, d.ino)
+	}
+	mix, _ := parseMix("create=40,stat=20,lookup=10,readdir=10,unlink=20")
+	for _, dist := range []string{DistUniform, DistZipf} {
+		cfg := &benchConfig{workers: 4, ops: 1000, mix: mix, dist: dist, zipfS: 1.1, seed: 1, duration: time.Minute}
+		report, workers := runBench(mc, cfg, dirs)
+		if report.TotalOps != 1000 || report.Workers != 4 {
+			t.Fatalf("dist %v: unexpected report %+v", dist, report)
+		}
+		created := 0
+		for _, op := range report.Ops {
+			if op.Errors != 0 {
+				t.Fatalf("dist %v: unexpected errors of op %+v", dist, op)
+			}
+			if op.Op == OpCreate {
+				created = op.Count
+			}
+		}
+		// the files left by the workers are found in the namespace, and removed by the cleanup
+		left := 0
+		for _, w := range workers {
+			left += len(w.files)
+			for _, f := range w.files {
+				if ino, _, err := mc.Lookup_ll(f.parent, f.name); err != nil || ino != f.ino {
+					t.Fatalf("dist %v: file %+v is not found, err %v", dist, f, err)
+				}
+			}
+			if err = w.cleanup(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if created == 0 || left > created {
+			t.Fatalf("dist %v: %v files left by %v created", dist, left, created)
+		}
+	}
+	if err = removeTree(mc, tree); err != nil {
+		t.Fatal(err)
+	}
+	if len(mc.inodes) != 1 || len(mc.children[proto.RootIno]) != 0 {
+		t.Fatalf("expect only the root left, but are %v inodes", len(mc.inodes))
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/datanode"
+	"github.com/chubaofs/chubaofs/master"
+	"github.com/chubaofs/chubaofs/metanode"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/preflight"
+)
+
+// runPreflight checks the config and the environment of the server without starting it, prints the report
+// in JSON to the stdout, and returns the exit code, which is 0 only if all the checks are passed.
+func runPreflight(cfg *config.Config, loadErr error) int {
+	role := cfg.GetString(ConfigKeyRole)
+	var report *preflight.Report
+	switch {
+	case loadErr != nil:
+		report = preflight.NewReport(role)
+		report.Add(preflight.CheckConfig, *configFile, loadErr)
+	case role == RoleMaster:
+		report = master.Preflight(cfg)
+	case role == RoleMeta:
+		report = metanode.Preflight(cfg)
+	case role == RoleData:
+		report = datanode.Preflight(cfg)
+	default:
+		report = preflight.NewReport(role)
+		report.Add(preflight.CheckConfig, ConfigKeyRole, fmt.Errorf("role %v is not supported by the check", role))
+	}
+	if logDir := cfg.GetString(ConfigKeyLogDir); logDir != "" {
+		report.Dir(logDir)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Printf("marshal report failed: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
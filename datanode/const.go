@@ -14,9 +14,11 @@
 
 package datanode
 
+import "time"
+
 const (
 	IntervalToUpdateReplica       = 600 // interval to update the replica
-	IntervalToUpdatePartitionSize = 60  // interval to update the partition size
+	IntervalToReconcileUsedSize   = 600 // interval to reconcile the used size of the partition with the disk
 	NumOfFilesToRecoverInParallel = 10  // number of files to be recovered simultaneously
 )
 
@@ -62,6 +64,15 @@ const (
 	ActionSyncTinyDeleteRecord       = "ActionSyncTinyDeleteRecord"
 	ActionStreamReadTinyExtentRepair = "ActionStreamReadTinyExtentRepair"
 	ActionBatchMarkDelete            = "ActionBatchMarkDelete"
+	ActionExtentHash                 = "ActionExtentHash"
+	ActionVerifyExtent               = "ActionVerifyExtent"
+	ActionExtentDelta                = "ActionExtentDelta"
+	ActionFreezeDataPartition        = "ActionFreezeDataPartition"
+	ActionDegradeDataPartition       = "ActionDegradeDataPartition"
+	ActionRepairDataBlock            = "ActionRepairDataBlock"
+	ActionResizeDataPartition        = "ActionResizeDataPartition"
+	ActionCopyExtent                 = "ActionCopyExtent"
+	ActionOrphanExtents              = "ActionOrphanExtents"
 )
 
 // Apply the raft log operation. Currently we only have the random write operation.
@@ -76,6 +87,8 @@ const (
 
 const (
 	MinAvaliTinyExtentCnt = 5
+	// a tiny extent taken for writing longer than this period is leaked, and reclaimed to be repaired
+	TinyExtentReclaimTimeout = 5 * time.Minute
 )
 
 // Sector size
@@ -0,0 +1,132 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// The block is read from the source again after it is written, in case it is overwritten in the meantime.
+	blockRepairMaxRetry = 3
+)
+
+// repairExtentBlocks overwrites the corrupted blocks of the extent in the range with the data of the same blocks
+// read from the source replica. The blocks which are read with the matched Crc are left untouched.
+func (dp *DataPartition) repairExtentBlocks(extentID uint64, offset int64, size uint32, source string) (err error) {
+	if storage.IsTinyExtent(extentID) {
+		return storage.NewParameterMismatchErr(fmt.Sprintf("tiny extent %v has no block crc", extentID))
+	}
+	if dp.IsFrozen() {
+		return proto.ErrDataPartitionFrozen
+	}
+	if source == "" {
+		return storage.NewParameterMismatchErr(fmt.Sprintf("invalid source %v", source))
+	}
+	store := dp.ExtentStore()
+	ei, err := store.Watermark(extentID)
+	if err != nil {
+		return
+	}
+	// the blocks are verified only if they are read in whole
+	start := offset / util.BlockSize * util.BlockSize
+	end := util.Min((int(offset)+int(size)+util.BlockSize-1)/util.BlockSize*util.BlockSize, int(ei.Size))
+	for blockOffset := start; blockOffset < int64(end); blockOffset += util.BlockSize {
+		blockSize := uint32(util.Min(util.BlockSize, end-int(blockOffset)))
+		if err = dp.repairExtentBlock(extentID, blockOffset, blockSize, source); err != nil {
+			return errors.Trace(err, "repairExtentBlocks extent(%v_%v) offset(%v) from(%v)",
+				dp.partitionID, extentID, blockOffset, source)
+		}
+	}
+	return
+}
+
+func (dp *DataPartition) repairExtentBlock(extentID uint64, offset int64, size uint32, source string) (err error) {
+	store := dp.ExtentStore()
+	data := make([]byte, size)
+	if _, err = store.Read(extentID, offset, int64(size), data, false); err == nil {
+		return
+	}
+	if !proto.IsResultCode(err, proto.OpCrcMismatchErr) {
+		return
+	}
+	var crc, sourceCrc uint32
+	for i := 0; i < blockRepairMaxRetry; i++ {
+		if crc, err = dp.readBlockFromSource(extentID, offset, size, source, data); err != nil {
+			return
+		}
+		if err = store.Write(extentID, offset, int64(size), data, crc, storage.RandomWriteType, true); err != nil {
+			return
+		}
+		if sourceCrc, err = dp.readBlockFromSource(extentID, offset, size, source, data); err != nil {
+			return
+		}
+		if sourceCrc == crc {
+			log.LogWarnf("action[repairExtentBlock] extent(%v_%v) offset(%v) size(%v) is repaired from(%v)",
+				dp.partitionID, extentID, offset, size, source)
+			return
+		}
+	}
+	return fmt.Errorf("the block is overwritten on the source during the repair: %v", storage.TryAgainError)
+}
+
+// readBlockFromSource reads the block from the source replica into the data, and returns its Crc.
+func (dp *DataPartition) readBlockFromSource(extentID uint64, offset int64, size uint32, source string,
+	data []byte) (crc uint32, err error) {
+	return dp.readBlockFromReplica(source, dp.partitionID, extentID, offset, size, data)
+}
+
+// readBlockFromReplica reads the block of the extent of the partition of the volume from the replica on the source.
+func (dp *DataPartition) readBlockFromReplica(source string, partitionID, extentID uint64, offset int64, size uint32,
+	data []byte) (crc uint32, err error) {
+	request := repl.NewBlockRepairReadPacket(partitionID, extentID, offset, size)
+	// the repair read is a follower read, which the volumes requiring the delegated tokens serve with an internal one
+	request.Arg = proto.AttachDelegatedToken(nil, proto.NewInternalDelegatedToken(dp.volumeID,
+		[]byte(dp.disk.space.dataNode.tokenSigningKey)))
+	request.ArgLen = uint32(len(request.Arg))
+	conn, err := getReplicaConnect(source)
+	if err != nil {
+		return
+	}
+	defer func() {
+		gConnPool.PutConnect(conn, err != nil)
+	}()
+	if err = request.WriteToConn(conn); err != nil {
+		return
+	}
+	reply := repl.NewPacket()
+	if err = reply.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if reply.ResultCode != proto.OpOk {
+		return 0, fmt.Errorf("read from source replica failed: %v", reply.GetResultMsg())
+	}
+	if reply.ReqID != request.ReqID || reply.ExtentID != extentID || reply.ExtentOffset != offset || reply.Size != size {
+		return 0, fmt.Errorf("invalid reply(%v) of request(%v)", reply.GetUniqueLogId(), request.GetUniqueLogId())
+	}
+	if crc = crc32.ChecksumIEEE(reply.Data[:size]); crc != reply.CRC {
+		return 0, fmt.Errorf("reply crc(%v) mismatch data crc(%v): %v", reply.CRC, crc, storage.CrcMismatchError)
+	}
+	copy(data, reply.Data[:size])
+	return
+}
@@ -195,7 +195,7 @@ func (dp *DataPartition) getRemoteExtentInfo(extentType uint8, tinyExtents []uin
 		p.Size = uint32(len(p.Data))
 	}
 	var conn *net.TCPConn
-	conn, err = gConnPool.GetConnect(target) // get remote connection
+	conn, err = getReplicaConnect(target) // get remote connection
 	if err != nil {
 		err = errors.Trace(err, "getRemoteExtentInfo DataPartition(%v) get host(%v) connect", dp.partitionID, target)
 		return
@@ -401,7 +401,7 @@ func (dp *DataPartition) notifyFollower(wg *sync.WaitGroup, index int, members [
 	target := dp.getReplicaAddr(index)
 	p.Data, _ = json.Marshal(members[index])
 	p.Size = uint32(len(p.Data))
-	conn, err = gConnPool.GetConnect(target)
+	conn, err = getReplicaConnect(target)
 	defer func() {
 		wg.Done()
 		log.LogInfof(fmt.Sprintf(ActionNotifyFollowerToRepair+" to host(%v) Partition(%v) failed (%v)", target, dp.partitionID, err))
@@ -487,7 +487,7 @@ func (dp *DataPartition) streamRepairExtent(remoteExtentInfo *storage.ExtentInfo
 		request = repl.NewTinyExtentRepairReadPacket(dp.partitionID, remoteExtentInfo.FileID, int(localExtentInfo.Size), int(sizeDiff))
 	}
 	var conn *net.TCPConn
-	conn, err = gConnPool.GetConnect(remoteExtentInfo.Source)
+	conn, err = getReplicaConnect(remoteExtentInfo.Source)
 	if err != nil {
 		return errors.Trace(err, "streamRepairExtent get conn from host(%v) error", remoteExtentInfo.Source)
 	}
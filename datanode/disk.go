@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
 	"os"
@@ -34,7 +35,7 @@ import (
 
 var (
 	// RegexpDataPartitionDir validates the directory name of a data partition.
-	RegexpDataPartitionDir, _ = regexp.Compile("^datapartition_(\\d)+_(\\d)+$")
+	RegexpDataPartitionDir, _ = regexp.Compile("^datapartition_(\\d)+(_(\\d)+)?$")
 )
 
 const ExpiredPartitionPrefix = "expired_"
@@ -60,6 +61,7 @@ type Disk struct {
 	partitionMap                              map[uint64]*DataPartition
 	syncTinyDeleteRecordFromLeaderOnEveryDisk chan bool
 	space                                     *SpaceManager
+	mmapCache                                 *storage.MmapCache // nil if the hot extents are not mapped
 }
 
 const (
@@ -77,6 +79,9 @@ func NewDisk(path string, reservedSpace uint64, maxErrCnt int, space *SpaceManag
 	d.space = space
 	d.partitionMap = make(map[uint64]*DataPartition)
 	d.syncTinyDeleteRecordFromLeaderOnEveryDisk = make(chan bool, SyncTinyDeleteRecordFromLeaderOnEveryDisk)
+	if budget := space.dataNode.extentMmapBudget; budget > 0 {
+		d.mmapCache = storage.NewMmapCache(budget)
+	}
 	d.computeUsage()
 	d.updateSpaceInfo()
 	d.startScheduleToUpdateSpaceInfo()
@@ -182,6 +187,7 @@ func (d *Disk) doBackendTask() {
 		d.RUnlock()
 		for _, dp := range partitions {
 			dp.extentStore.BackendTask()
+			dp.reconcileUsedSize()
 		}
 		time.Sleep(time.Minute)
 	}
@@ -295,15 +301,19 @@ func (d *Disk) DataPartitionList() (partitionIDs []uint64) {
 	return
 }
 
+// unmarshalPartitionName parses the directory name of a partition, the size is 0 for the unsized layout.
 func unmarshalPartitionName(name string) (partitionID uint64, partitionSize int, err error) {
 	arr := strings.Split(name, "_")
-	if len(arr) != 3 {
+	if len(arr) != 2 && len(arr) != 3 {
 		err = fmt.Errorf("error DataPartition name(%v)", name)
 		return
 	}
 	if partitionID, err = strconv.ParseUint(arr[1], 10, 64); err != nil {
 		return
 	}
+	if len(arr) == 2 {
+		return
+	}
 	if partitionSize, err = strconv.Atoi(arr[2]); err != nil {
 		return
 	}
@@ -370,7 +380,11 @@ func (d *Disk) RestorePartition(visitor PartitionVisitor) {
 				"manually", filename)
 			oldName := path.Join(d.Path, filename)
 			newName := path.Join(d.Path, ExpiredPartitionPrefix+filename)
-			os.Rename(oldName, newName)
+			if err = os.Rename(oldName, newName); err == nil {
+				// the modify time is used to decide when the expired partition can be deleted
+				now := time.Now()
+				os.Chtimes(newName, now, now)
+			}
 			continue
 		}
 
@@ -0,0 +1,152 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultExpiredPartitionRetention = time.Hour * 24 * 7
+	IntervalToCleanExpiredPartition  = time.Hour
+)
+
+// ExpiredPartition is a data partition dir renamed with ExpiredPartitionPrefix, since the partition
+// does not exist in master when the data node starts.
+type ExpiredPartition struct {
+	Disk        string `json:"disk"`
+	Name        string `json:"name"`
+	PartitionID uint64 `json:"partitionId"`
+	ExpiredTime int64  `json:"expiredTime"`
+	Deletable   bool   `json:"deletable"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// scanExpiredPartitions lists the expired partition dirs of all the disks, and checks whether they can be deleted.
+// An expired partition dir can be deleted only if it is older than the retention and the partition
+// is still absent from master.
+func (s *DataNode) scanExpiredPartitions() (partitions []*ExpiredPartition, err error) {
+	dataNode, err := MasterClient.NodeAPI().GetDataNode(s.localServerAddr)
+	if err != nil {
+		return
+	}
+	partitions = s.listExpiredPartitions(dataNode.PersistenceDataPartitions, time.Now())
+	return
+}
+
+// listExpiredPartitions lists the expired partition dirs of all the disks, and checks them against the partitions
+// of this node persisted in master.
+func (s *DataNode) listExpiredPartitions(persistedIDs []uint64, now time.Time) (partitions []*ExpiredPartition) {
+	persisted := make(map[uint64]struct{}, len(persistedIDs))
+	for _, id := range persistedIDs {
+		persisted[id] = struct{}{}
+	}
+
+	partitions = make([]*ExpiredPartition, 0)
+	for _, d := range s.space.GetDisks() {
+		fileInfoList, e := ioutil.ReadDir(d.Path)
+		if e != nil {
+			log.LogErrorf("action[scanExpiredPartitions] read dir(%v) err(%v).", d.Path, e)
+			continue
+		}
+		for _, fileInfo := range fileInfoList {
+			filename := fileInfo.Name()
+			if !fileInfo.IsDir() || !strings.HasPrefix(filename, ExpiredPartitionPrefix) ||
+				!d.isPartitionDir(strings.TrimPrefix(filename, ExpiredPartitionPrefix)) {
+				continue
+			}
+			partitionID, _, e := unmarshalPartitionName(strings.TrimPrefix(filename, ExpiredPartitionPrefix))
+			if e != nil {
+				continue
+			}
+			partition := &ExpiredPartition{
+				Disk:        d.Path,
+				Name:        filename,
+				PartitionID: partitionID,
+				ExpiredTime: fileInfo.ModTime().Unix(),
+			}
+			if _, exist := persisted[partitionID]; exist {
+				partition.Reason = "partition exists in master"
+			} else if len(persisted) == 0 {
+				partition.Reason = "no partition of this node in master"
+			} else if s.expiredRetention < 0 {
+				partition.Reason = "deleting expired partition is disabled"
+			} else if now.Sub(fileInfo.ModTime()) < s.expiredRetention {
+				partition.Reason = fmt.Sprintf("retained until %v",
+					fileInfo.ModTime().Add(s.expiredRetention).Format(time.RFC3339))
+			} else {
+				partition.Deletable = true
+			}
+			partitions = append(partitions, partition)
+		}
+	}
+	return
+}
+
+func (s *DataNode) cleanExpiredPartitions() {
+	partitions, err := s.scanExpiredPartitions()
+	if err != nil {
+		log.LogErrorf("action[cleanExpiredPartitions] scan expired partitions err(%v).", err)
+		return
+	}
+	removeExpiredPartitions(partitions)
+}
+
+// removeExpiredPartitions removes the expired partition dirs which can be deleted.
+func removeExpiredPartitions(partitions []*ExpiredPartition) {
+	for _, partition := range partitions {
+		if !partition.Deletable {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(partition.Disk, partition.Name)); err != nil {
+			log.LogErrorf("action[cleanExpiredPartitions] remove expired partition(%v) on disk(%v) err(%v).",
+				partition.Name, partition.Disk, err)
+			continue
+		}
+		log.LogWarnf("action[cleanExpiredPartitions] expired partition(%v) on disk(%v) is removed.",
+			partition.Name, partition.Disk)
+	}
+}
+
+func (s *DataNode) startExpiredPartitionJanitor() {
+	ticker := time.NewTicker(IntervalToCleanExpiredPartition)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopC:
+			return
+		case <-ticker.C:
+			s.cleanExpiredPartitions()
+		}
+	}
+}
+
+// getExpiredPartitionsAPI lists the expired partitions and whether they can be deleted, without deleting them.
+func (s *DataNode) getExpiredPartitionsAPI(w http.ResponseWriter, r *http.Request) {
+	partitions, err := s.scanExpiredPartitions()
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, partitions)
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiredPartitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expired_partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	dirs := map[string]time.Time{
+		ExpiredPartitionPrefix + "datapartition_1_128849018880": now.Add(-10 * 24 * time.Hour),
+		ExpiredPartitionPrefix + "datapartition_2_128849018880": now.Add(-time.Hour),
+		ExpiredPartitionPrefix + "datapartition_3":              now.Add(-10 * 24 * time.Hour),
+		// neither expired nor a partition, which are left alone
+		"datapartition_4_128849018880":   now.Add(-10 * 24 * time.Hour),
+		ExpiredPartitionPrefix + "trash": now.Add(-10 * 24 * time.Hour),
+	}
+	for name, modTime := range dirs {
+		if err = os.Mkdir(path.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(path.Join(dir, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &DataNode{
+		space:            &SpaceManager{disks: map[string]*Disk{dir: {Path: dir}}},
+		expiredRetention: DefaultExpiredPartitionRetention,
+	}
+	check := func(persisted []uint64, expected map[uint64]string) []*ExpiredPartition {
+		partitions := s.listExpiredPartitions(persisted, now)
+		if len(partitions) != len(expected) {
+			t.Fatalf("expect the expired partitions %v, but are %v", expected, len(partitions))
+		}
+		for _, partition := range partitions {
+			reason, ok := expected[partition.PartitionID]
+			if !ok || partition.Deletable != (reason == "") || !strings.Contains(partition.Reason, reason) ||
+				partition.Disk != dir {
+				t.Fatalf("persisted %v retention %v: unexpected expired partition %+v", persisted, s.expiredRetention, partition)
+			}
+		}
+		return partitions
+	}
+
+	// the partitions still in master, and the ones not older than the retention are kept
+	partitions := check([]uint64{3, 9}, map[uint64]string{1: "", 2: "retained until", 3: "exists in master"})
+	// nothing is deleted if master knows no partition of this node, which may have lost its metadata
+	check(nil, map[uint64]string{1: "no partition", 2: "no partition", 3: "no partition"})
+	s.expiredRetention = -1
+	check([]uint64{3, 9}, map[uint64]string{1: "disabled", 2: "disabled", 3: "exists in master"})
+
+	removeExpiredPartitions(partitions)
+	for name := range dirs {
+		_, err = os.Stat(path.Join(dir, name))
+		if removed := os.IsNotExist(err); removed != (name == ExpiredPartitionPrefix+"datapartition_1_128849018880") {
+			t.Fatalf("dir %v removed %v, err %v", name, removed, err)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	MaxRunningExtentCopyJobs = 8
+	// the source reads the whole range to answer the Crc
+	extentCopyVerifyDeadlineTime = 60
+	// the finished jobs are kept for the status queries within the retention
+	extentCopyJobRetention = time.Hour
+)
+
+// extentCopyJobs keeps the extent copy jobs run by this data node.
+type extentCopyJobs struct {
+	sync.RWMutex
+	jobs map[uint64]*proto.ExtentCopyJob
+}
+
+func newExtentCopyJobs() *extentCopyJobs {
+	return &extentCopyJobs{jobs: make(map[uint64]*proto.ExtentCopyJob)}
+}
+
+// add registers the job unless the job is submitted before or too many jobs are running.
+func (j *extentCopyJobs) add(job *proto.ExtentCopyJob) (err error) {
+	j.Lock()
+	defer j.Unlock()
+	running := 0
+	for id, old := range j.jobs {
+		if old.State != proto.ExtentCopyRunning && time.Since(time.Unix(old.UpdateTime, 0)) > extentCopyJobRetention {
+			delete(j.jobs, id)
+		} else if old.State == proto.ExtentCopyRunning {
+			running++
+		}
+	}
+	if _, ok := j.jobs[job.ID]; ok {
+		return fmt.Errorf("extent copy job(%v) exists", job.ID)
+	}
+	if running >= MaxRunningExtentCopyJobs {
+		return fmt.Errorf("too many extent copy jobs running(%v)", running)
+	}
+	j.jobs[job.ID] = job
+	return
+}
+
+func (j *extentCopyJobs) update(id uint64, update func(job *proto.ExtentCopyJob)) {
+	j.Lock()
+	defer j.Unlock()
+	if job, ok := j.jobs[id]; ok {
+		update(job)
+		job.UpdateTime = time.Now().Unix()
+	}
+}
+
+// list returns the copies of the job of the ID, or all the jobs in the order of their IDs if the ID is zero.
+func (j *extentCopyJobs) list(id uint64) (jobs []*proto.ExtentCopyJob) {
+	j.RLock()
+	defer j.RUnlock()
+	jobs = make([]*proto.ExtentCopyJob, 0)
+	for _, job := range j.jobs {
+		if id == 0 || job.ID == id {
+			view := *job
+			jobs = append(jobs, &view)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return
+}
+
+// Handle OpCopyExtent packet. The packet is answered once the job is started, and the result of the job is sent to
+// the master as the response of the task when the copy ends. The ID of the copy allocated for the request is replied
+// with the request.
+func (s *DataNode) handlePacketToCopyExtent(p *repl.Packet) {
+	var (
+		err     error
+		reqData []byte
+		reply   []byte
+		task    = &proto.AdminTask{}
+		request = &proto.CopyExtentRequest{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionCopyExtent, err.Error())
+		} else if reply != nil {
+			p.PacketOkWithBody(reply)
+		} else {
+			p.PacketOkReply()
+		}
+	}()
+	if err = json.Unmarshal(p.Data, task); err != nil {
+		return
+	}
+	if reqData, err = json.Marshal(task.Request); err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, request); err != nil {
+		return
+	}
+	p.AddMesgLog(string(reqData))
+	dp := s.space.Partition(request.PartitionId)
+	if dp == nil {
+		err = proto.ErrDataPartitionNotExists
+		return
+	}
+	if err = dp.checkExtentCopy(request); err != nil {
+		return
+	}
+	if request.SourcePartitionId != 0 && request.ExtentId == 0 {
+		if request.ExtentId, err = dp.ExtentStore().NextExtentID(); err != nil {
+			return
+		}
+		if reply, err = json.Marshal(request); err != nil {
+			return
+		}
+		task.Request = request
+	}
+	now := time.Now().Unix()
+	job := &proto.ExtentCopyJob{
+		ID:          request.JobID,
+		PartitionID: request.PartitionId,
+		ExtentID:    request.ExtentId,
+		Offset:      request.Offset,
+		Size:        request.Size,
+		SourceAddr:  request.SourceAddr,
+		DestAddr:    s.localServerAddr,
+		RateLimit:   request.RateLimit,
+		State:       proto.ExtentCopyRunning,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	if err = s.copyJobs.add(job); err != nil {
+		return
+	}
+	go s.runExtentCopyJob(dp, task, request)
+}
+
+func (s *DataNode) runExtentCopyJob(dp *DataPartition, task *proto.AdminTask, request *proto.CopyExtentRequest) {
+	response := &proto.CopyExtentResponse{JobID: request.JobID}
+	copied, crc, err := dp.copyExtent(request, func(size uint32, copied uint64) {
+		s.copyJobs.update(request.JobID, func(job *proto.ExtentCopyJob) {
+			job.Size, job.CopiedBytes = size, copied
+		})
+	})
+	response.CopiedBytes, response.Crc = copied, crc
+	if err != nil {
+		response.Status, response.Result = proto.TaskFailed, err.Error()
+		log.LogErrorf("action[runExtentCopyJob] job(%v) extent(%v_%v) from(%v) err(%v)", request.JobID,
+			request.PartitionId, request.ExtentId, request.SourceAddr, err)
+	} else {
+		response.Status = proto.TaskSucceeds
+		log.LogWarnf("action[runExtentCopyJob] job(%v) extent(%v_%v) offset(%v) is copied from(%v) size(%v) crc(%v)",
+			request.JobID, request.PartitionId, request.ExtentId, request.Offset, request.SourceAddr, copied, crc)
+	}
+	s.copyJobs.update(request.JobID, func(job *proto.ExtentCopyJob) {
+		job.CopiedBytes, job.Crc, job.Msg = copied, crc, response.Result
+		if err != nil {
+			job.State = proto.ExtentCopyFailed
+		} else {
+			job.State = proto.ExtentCopySucceeded
+		}
+	})
+	task.Response = response
+	if err = MasterClient.NodeAPI().ResponseDataNodeTask(task); err != nil {
+		err = errors.Trace(err, "copy extent response failed, job(%v)", request.JobID)
+		log.LogError(errors.Stack(err))
+	}
+}
+
+func (dp *DataPartition) checkExtentCopy(request *proto.CopyExtentRequest) (err error) {
+	if storage.IsTinyExtent(request.ExtentId) {
+		return storage.NewParameterMismatchErr(fmt.Sprintf("tiny extent %v can not be copied", request.ExtentId))
+	}
+	if request.SourcePartitionId != 0 && (request.SourcePartitionId == dp.partitionID ||
+		storage.IsTinyExtent(request.SourceExtentId) || request.SourceExtentId == 0) {
+		return storage.NewParameterMismatchErr(fmt.Sprintf("extent %v_%v can not be copied",
+			request.SourcePartitionId, request.SourceExtentId))
+	}
+	if request.SourceAddr == "" {
+		return storage.NewParameterMismatchErr(fmt.Sprintf("invalid source %v", request.SourceAddr))
+	}
+	if dp.IsFrozen() {
+		return proto.ErrDataPartitionFrozen
+	}
+	if dp.ExtentStore().IsDeletedNormalExtent(request.ExtentId) {
+		return storage.ExtentHasBeenDeletedError
+	}
+	return
+}
+
+// copyExtent copies the range of the extent from the source replica, in the chunks read with the Crc checked and
+// throttled by the rate limit. The extent is created if it does not exist, and the range must not start beyond its
+// end. The copy is written locally instead of through raft like the repair, and is verified at last by comparing the
+// Crc of the range read back with the Crc of the same range on the source, which also fails the copy if the range is
+// changed on the source in the meantime. The range is read from the source extent of the request if it is set.
+func (dp *DataPartition) copyExtent(request *proto.CopyExtentRequest, progress func(size uint32, copied uint64)) (
+	copied uint64, crc uint32, err error) {
+	extentID, offset, size, source := request.ExtentId, request.Offset, request.Size, request.SourceAddr
+	src := &extentOnSource{addr: source, partitionID: dp.partitionID, extentID: extentID}
+	if request.SourcePartitionId != 0 {
+		src.partitionID, src.extentID = request.SourcePartitionId, request.SourceExtentId
+	}
+	sourceInfo, err := dp.verifyExtentOnSource(src, offset, 0)
+	if err != nil {
+		return
+	}
+	if offset > sourceInfo.ExtentSize {
+		err = fmt.Errorf("range offset(%v) is beyond the source extent size(%v)", offset, sourceInfo.ExtentSize)
+		return
+	}
+	if size == 0 {
+		size = uint32(sourceInfo.ExtentSize - offset)
+	}
+	if offset+uint64(size) > sourceInfo.ExtentSize {
+		err = fmt.Errorf("range offset(%v) size(%v) is beyond the source extent size(%v)", offset, size, sourceInfo.ExtentSize)
+		return
+	}
+	progress(size, 0)
+	store := dp.ExtentStore()
+	if !store.HasExtent(extentID) {
+		if err = store.Create(extentID); err != nil && err != storage.ExtentExistsError {
+			return
+		}
+	}
+	localInfo, err := store.Watermark(extentID)
+	if err != nil {
+		return
+	}
+	if offset > localInfo.Size {
+		err = fmt.Errorf("range offset(%v) is beyond the local extent size(%v)", offset, localInfo.Size)
+		return
+	}
+
+	limit := rate.Inf
+	if request.RateLimit > 0 {
+		limit = rate.Limit(request.RateLimit)
+	}
+	limiter := rate.NewLimiter(limit, util.ReadBlockSize)
+	data := make([]byte, util.ReadBlockSize)
+	end := offset + uint64(size)
+	for pos := offset; pos < end; {
+		// the chunks are aligned to the blocks, so that they are checked against the block Crcs of the source
+		chunk := uint32(util.Min(int(end-pos), util.ReadBlockSize-int(pos%util.ReadBlockSize)))
+		if err = limiter.WaitN(context.Background(), int(chunk)); err != nil {
+			return
+		}
+		var chunkCrc uint32
+		if chunkCrc, err = dp.readBlockFromReplica(src.addr, src.partitionID, src.extentID, int64(pos), chunk,
+			data); err != nil {
+			return
+		}
+		writeType := storage.RandomWriteType
+		if pos+uint64(chunk) > localInfo.Size {
+			writeType = storage.AppendWriteType
+		}
+		if err = store.Write(extentID, int64(pos), int64(chunk), data[:chunk], chunkCrc, writeType, true); err != nil {
+			return
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, data[:chunk])
+		pos += uint64(chunk)
+		copied += uint64(chunk)
+		progress(size, copied)
+	}
+	return copied, crc, dp.verifyExtentCopy(extentID, offset, size, src, crc)
+}
+
+func (dp *DataPartition) verifyExtentCopy(extentID, offset uint64, size uint32, src *extentOnSource, crc uint32) (
+	err error) {
+	store := dp.ExtentStore()
+	var localCrc uint32
+	data := make([]byte, util.ReadBlockSize)
+	for pos, end := offset, offset+uint64(size); pos < end; {
+		chunk := uint64(util.Min(int(end-pos), util.ReadBlockSize))
+		if _, err = store.Read(extentID, int64(pos), int64(chunk), data[:chunk], false); err != nil {
+			return
+		}
+		localCrc = crc32.Update(localCrc, crc32.IEEETable, data[:chunk])
+		pos += chunk
+	}
+	if localCrc != crc {
+		return fmt.Errorf("local crc(%v) mismatch copied crc(%v): %v", localCrc, crc, storage.CrcMismatchError)
+	}
+	sourceInfo, err := dp.verifyExtentOnSource(src, offset, size)
+	if err != nil {
+		return
+	}
+	if !sourceInfo.Complete || sourceInfo.Crc != crc {
+		return fmt.Errorf("source crc(%v) mismatch copied crc(%v), the range is changed on the source: %v",
+			sourceInfo.Crc, crc, storage.CrcMismatchError)
+	}
+	return
+}
+
+// extentOnSource is the extent copied from the source replica.
+type extentOnSource struct {
+	addr        string
+	partitionID uint64
+	extentID    uint64
+}
+
+// verifyExtentOnSource returns the size of the extent on the source replica, and the Crc of the range.
+func (dp *DataPartition) verifyExtentOnSource(src *extentOnSource, offset uint64, size uint32) (
+	resp *proto.ExtentVerifyResponse, err error) {
+	request := repl.NewVerifyExtentPacket(src.partitionID, src.extentID, offset, size)
+	conn, err := getReplicaConnect(src.addr)
+	if err != nil {
+		return
+	}
+	defer func() {
+		gConnPool.PutConnect(conn, err != nil)
+	}()
+	if err = request.WriteToConn(conn); err != nil {
+		return
+	}
+	reply := repl.NewPacket()
+	if err = reply.ReadFromConn(conn, extentCopyVerifyDeadlineTime); err != nil {
+		return
+	}
+	if reply.ResultCode != proto.OpOk {
+		return nil, fmt.Errorf("verify extent on source failed: %v", reply.GetResultMsg())
+	}
+	resp = &proto.ExtentVerifyResponse{}
+	if err = json.Unmarshal(reply.Data[:reply.Size], resp); err != nil {
+		return
+	}
+	if !resp.Exists || resp.Deleted {
+		return nil, fmt.Errorf("extent(%v_%v) does not exist on source(%v)", src.partitionID, src.extentID, src.addr)
+	}
+	return
+}
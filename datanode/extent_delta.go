@@ -0,0 +1,475 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/tiglabs/raft"
+)
+
+// The delta sync copies an extent from a data node of another cluster in the way of rsync. The destination sends
+// the signatures of the blocks of its own copy to the source, and the source answers the regions which are not
+// found in these blocks with the data, and the others with the indexes of the blocks, so that only the changed
+// regions are transferred.
+const (
+	DefaultDeltaBlockSize = 8 * util.KB
+	MinDeltaBlockSize     = 1 * util.KB
+
+	deltaWindowSize        = 16 * util.MB
+	deltaSignatureSize     = 4 + md5.Size
+	deltaReadDeadlineTime  = 60
+	deltaTempFilePrefix    = ".delta_"
+	deltaOpLiteral         = uint8(0)
+	deltaOpCopy            = uint8(1)
+	deltaResponseHeaderLen = 16
+)
+
+var (
+	ErrDeltaSourceShrunk = errors.New("source extent is smaller than the destination")
+	ErrMalformedDelta    = errors.New("malformed extent delta")
+)
+
+// ExtentDeltaSyncResult is the result of syncing an extent from the source.
+type ExtentDeltaSyncResult struct {
+	SourceSize   uint64 `json:"sourceSize"`
+	DestSize     uint64 `json:"destSize"`
+	MatchedBytes uint64 `json:"matchedBytes"` // found in the destination, not transferred
+	LiteralBytes uint64 `json:"literalBytes"` // transferred from the source
+	WrittenBytes uint64 `json:"writtenBytes"` // written to the destination
+}
+
+type blockSignature struct {
+	weak   uint32
+	strong [md5.Size]byte
+}
+
+// rollingChecksum is the weak checksum of rsync, which is updated in constant time when the window moves forward
+// by one byte.
+type rollingChecksum struct {
+	a, b uint32
+	size uint32
+}
+
+func (r *rollingChecksum) reset(data []byte) {
+	r.a, r.b, r.size = 0, 0, uint32(len(data))
+	for i, c := range data {
+		r.a += uint32(c)
+		r.b += uint32(len(data)-i) * uint32(c)
+	}
+}
+
+func (r *rollingChecksum) roll(out, in byte) {
+	r.a = r.a - uint32(out) + uint32(in)
+	r.b = r.b - r.size*uint32(out) + r.a
+}
+
+func (r *rollingChecksum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+func weakChecksum(data []byte) uint32 {
+	var r rollingChecksum
+	r.reset(data)
+	return r.sum()
+}
+
+func isValidDeltaBlockSize(blockSize int) bool {
+	return blockSize >= MinDeltaBlockSize && blockSize <= util.BlockSize && blockSize&(blockSize-1) == 0
+}
+
+// extentSignatures returns the signatures of the full blocks of the extent.
+func extentSignatures(store *storage.ExtentStore, extentID uint64, size int64, blockSize int) (sigs []blockSignature, err error) {
+	buf, _ := proto.Buffers.Get(util.ReadBlockSize)
+	defer proto.Buffers.Put(buf)
+	for offset := int64(0); offset+int64(blockSize) <= size; offset += util.ReadBlockSize {
+		n := util.Min(int(size-offset), util.ReadBlockSize)
+		n -= n % blockSize
+		if _, err = store.Read(extentID, offset, int64(n), buf[:n], false); err != nil {
+			return
+		}
+		for i := 0; i < n; i += blockSize {
+			block := buf[i : i+blockSize]
+			sigs = append(sigs, blockSignature{weak: weakChecksum(block), strong: md5.Sum(block)})
+		}
+	}
+	return
+}
+
+func marshalDeltaRequest(blockSize, window int, sigs []blockSignature) []byte {
+	data := make([]byte, 8, 8+len(sigs)*deltaSignatureSize)
+	binary.BigEndian.PutUint32(data[0:4], uint32(blockSize))
+	binary.BigEndian.PutUint32(data[4:8], uint32(window))
+	for _, sig := range sigs {
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], sig.weak)
+		data = append(data, sig.strong[:]...)
+	}
+	return data
+}
+
+func unmarshalDeltaRequest(data []byte) (blockSize, window int, sigs []blockSignature, err error) {
+	if len(data) < 8 || (len(data)-8)%deltaSignatureSize != 0 {
+		err = ErrMalformedDelta
+		return
+	}
+	blockSize = int(binary.BigEndian.Uint32(data[0:4]))
+	window = int(binary.BigEndian.Uint32(data[4:8]))
+	if !isValidDeltaBlockSize(blockSize) || window <= 0 {
+		err = fmt.Errorf("invalid delta block size %v or window %v", blockSize, window)
+		return
+	}
+	sigs = make([]blockSignature, (len(data)-8)/deltaSignatureSize)
+	for i, off := 0, 8; i < len(sigs); i, off = i+1, off+deltaSignatureSize {
+		sigs[i].weak = binary.BigEndian.Uint32(data[off : off+4])
+		copy(sigs[i].strong[:], data[off+4:off+deltaSignatureSize])
+	}
+	return
+}
+
+func appendDeltaLiteral(delta, data []byte) []byte {
+	if len(data) == 0 {
+		return delta
+	}
+	var header [5]byte
+	header[0] = deltaOpLiteral
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	delta = append(delta, header[:]...)
+	return append(delta, data...)
+}
+
+func appendDeltaCopy(delta []byte, index int) []byte {
+	var op [5]byte
+	op[0] = deltaOpCopy
+	binary.BigEndian.PutUint32(op[1:], uint32(index))
+	return append(delta, op[:]...)
+}
+
+// computeExtentDelta returns the delta of the extent from the offset against the signatures. The delta covers at
+// least the window from the offset, and the offset to continue with is returned in the header of the delta along
+// with the size of the extent.
+func computeExtentDelta(store *storage.ExtentStore, extentID uint64, offset int64, window, blockSize int,
+	sigs []blockSignature) (delta []byte, err error) {
+	var ei *storage.ExtentInfo
+	if ei, err = store.Watermark(extentID); err != nil {
+		return
+	}
+	size := int64(ei.Size)
+	if offset < 0 || offset > size {
+		err = fmt.Errorf("offset %v is out of the extent size %v", offset, size)
+		return
+	}
+	windowLen := util.Min(window, int(size-offset))
+	buf := make([]byte, util.Min(windowLen+blockSize-1, int(size-offset)))
+	for n := 0; n < len(buf); {
+		readSize := util.Min(len(buf)-n, util.ReadBlockSize)
+		if _, err = store.Read(extentID, offset+int64(n), int64(readSize), buf[n:n+readSize], false); err != nil {
+			return
+		}
+		n += readSize
+	}
+
+	index := make(map[uint32][]int, len(sigs))
+	for i, sig := range sigs {
+		index[sig.weak] = append(index[sig.weak], i)
+	}
+	match := func(pos int, weak uint32) int {
+		candidates, ok := index[weak]
+		if !ok {
+			return -1
+		}
+		strong := md5.Sum(buf[pos : pos+blockSize])
+		found := -1
+		for _, i := range candidates {
+			if sigs[i].strong != strong {
+				continue
+			}
+			// the block at the same place needs not to be written by the destination
+			if int64(i*blockSize) == offset+int64(pos) {
+				return i
+			}
+			if found < 0 {
+				found = i
+			}
+		}
+		return found
+	}
+
+	delta = make([]byte, deltaResponseHeaderLen, deltaResponseHeaderLen+windowLen/8)
+	var (
+		rc           rollingChecksum
+		rolled       bool
+		pos, literal int
+	)
+	for pos < windowLen && pos+blockSize <= len(buf) {
+		if !rolled {
+			rc.reset(buf[pos : pos+blockSize])
+			rolled = true
+		}
+		if i := match(pos, rc.sum()); i >= 0 {
+			delta = appendDeltaLiteral(delta, buf[literal:pos])
+			delta = appendDeltaCopy(delta, i)
+			pos += blockSize
+			literal, rolled = pos, false
+			continue
+		}
+		if pos+blockSize < len(buf) {
+			rc.roll(buf[pos], buf[pos+blockSize])
+		}
+		pos++
+	}
+	if pos < windowLen {
+		// the rest is shorter than a block
+		pos = len(buf)
+	}
+	delta = appendDeltaLiteral(delta, buf[literal:pos])
+	binary.BigEndian.PutUint64(delta[0:8], uint64(offset)+uint64(pos))
+	binary.BigEndian.PutUint64(delta[8:16], uint64(size))
+	return
+}
+
+// Handle OpExtentDelta packet, which is sent by the destination of a delta sync.
+func (s *DataNode) handleExtentDeltaPacket(p *repl.Packet, connect net.Conn) {
+	var (
+		err       error
+		delta     []byte
+		blockSize int
+		window    int
+		sigs      []blockSignature
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionExtentDelta, err.Error())
+		} else {
+			p.PacketOkWithBody(delta)
+		}
+	}()
+	partition := p.Object.(*DataPartition)
+	if err = partition.CheckLeader(p, connect); err != nil {
+		return
+	}
+	if storage.IsTinyExtent(p.ExtentID) {
+		err = fmt.Errorf("tiny extent %v can not be synced", p.ExtentID)
+		return
+	}
+	if blockSize, window, sigs, err = unmarshalDeltaRequest(p.Data[:p.Size]); err != nil {
+		return
+	}
+	window = util.Min(window, deltaWindowSize)
+	delta, err = computeExtentDelta(partition.ExtentStore(), p.ExtentID, p.ExtentOffset, window, blockSize, sigs)
+	p.AddMesgLog(fmt.Sprintf("delta_(%v)", len(delta)))
+}
+
+func fetchExtentDelta(addr string, partitionID, extentID uint64, offset int64, request []byte) (delta []byte, err error) {
+	p := repl.NewPacketToExtentDelta(partitionID, extentID, offset, request)
+	var conn *net.TCPConn
+	if conn, err = getReplicaConnect(addr); err != nil {
+		return
+	}
+	defer gConnPool.PutConnect(conn, true)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, deltaReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = errors.New(string(p.Data[:p.Size]))
+		return
+	}
+	delta = p.Data[:p.Size]
+	return
+}
+
+type deltaRange struct {
+	start, end int64
+}
+
+func addDeltaRange(ranges []deltaRange, start, end int64) []deltaRange {
+	if n := len(ranges); n > 0 && ranges[n-1].end == start {
+		ranges[n-1].end = end
+		return ranges
+	}
+	return append(ranges, deltaRange{start: start, end: end})
+}
+
+// SyncExtentDelta makes the extent the same as the source extent on the data node of another cluster, by
+// transferring the changed regions only. The new content is assembled in a temporary file first, because the
+// blocks of the extent may be moved, and then the changed regions are written through raft, so that the extent
+// grows on all the replicas. The source must not be smaller than the extent, since an extent can not be truncated.
+func (dp *DataPartition) SyncExtentDelta(extentID uint64, sourceAddr string, sourcePartitionID, sourceExtentID uint64,
+	blockSize int) (result *ExtentDeltaSyncResult, err error) {
+	if storage.IsTinyExtent(extentID) || storage.IsTinyExtent(sourceExtentID) {
+		err = fmt.Errorf("tiny extents can not be synced")
+		return
+	}
+	if !isValidDeltaBlockSize(blockSize) {
+		err = fmt.Errorf("invalid delta block size %v", blockSize)
+		return
+	}
+	if dp.IsFrozen() {
+		err = proto.ErrDataPartitionFrozen
+		return
+	}
+	if _, isLeader := dp.IsRaftLeader(); !isLeader {
+		err = raft.ErrNotLeader
+		return
+	}
+	store := dp.ExtentStore()
+	var ei *storage.ExtentInfo
+	if ei, err = store.Watermark(extentID); err != nil {
+		return
+	}
+	result = &ExtentDeltaSyncResult{DestSize: ei.Size}
+	var sigs []blockSignature
+	if sigs, err = extentSignatures(store, extentID, int64(ei.Size), blockSize); err != nil {
+		return
+	}
+	request := marshalDeltaRequest(blockSize, deltaWindowSize, sigs)
+
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(dp.Path(), deltaTempFilePrefix); err != nil {
+		return
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	fetch := func(offset int64) ([]byte, error) {
+		return fetchExtentDelta(sourceAddr, sourcePartitionID, sourceExtentID, offset, request)
+	}
+	var dirty []deltaRange
+	if dirty, err = assembleExtentDelta(store, extentID, blockSize, len(sigs), tmp, fetch, result); err != nil {
+		return
+	}
+	write := func(offset, size int64, data []byte) error {
+		val, err := MarshalRandWriteRaftLog(proto.OpExtentDelta, extentID, offset, size, data, crc32.ChecksumIEEE(data))
+		if err != nil {
+			return err
+		}
+		resp, err := dp.Put(nil, val)
+		if err != nil {
+			return err
+		}
+		if resp.(uint8) != proto.OpOk {
+			return storage.TryAgainError
+		}
+		return nil
+	}
+	if err = writeDeltaRanges(tmp, dirty, write, result); err != nil {
+		return
+	}
+	log.LogInfof("action[SyncExtentDelta] partition(%v) extent(%v) from %v partition(%v) extent(%v): %+v",
+		dp.partitionID, extentID, sourceAddr, sourcePartitionID, sourceExtentID, result)
+	return
+}
+
+// assembleExtentDelta fetches the deltas of the source extent against the signatures of the blocks of the extent,
+// and assembles the changed regions in the temporary file. The regions to be written to the extent are returned.
+func assembleExtentDelta(store *storage.ExtentStore, extentID uint64, blockSize, sigCount int, tmp *os.File,
+	fetch func(offset int64) ([]byte, error), result *ExtentDeltaSyncResult) (dirty []deltaRange, err error) {
+	buf := make([]byte, blockSize)
+	for offset, sourceSize := int64(0), int64(-1); sourceSize < 0 || offset < sourceSize; {
+		var delta []byte
+		if delta, err = fetch(offset); err != nil {
+			return
+		}
+		if len(delta) < deltaResponseHeaderLen {
+			err = ErrMalformedDelta
+			return
+		}
+		next := int64(binary.BigEndian.Uint64(delta[0:8]))
+		if sourceSize = int64(binary.BigEndian.Uint64(delta[8:16])); sourceSize < int64(result.DestSize) {
+			err = ErrDeltaSourceShrunk
+			return
+		}
+		target := offset
+		for ops := delta[deltaResponseHeaderLen:]; len(ops) > 0; {
+			if len(ops) < 5 {
+				err = ErrMalformedDelta
+				return
+			}
+			op, value := ops[0], binary.BigEndian.Uint32(ops[1:5])
+			ops = ops[5:]
+			switch {
+			case op == deltaOpLiteral && int(value) <= len(ops):
+				if _, err = tmp.WriteAt(ops[:value], target); err != nil {
+					return
+				}
+				dirty = addDeltaRange(dirty, target, target+int64(value))
+				ops = ops[value:]
+				target += int64(value)
+				result.LiteralBytes += uint64(value)
+			case op == deltaOpCopy && int(value) < sigCount:
+				src := int64(value) * int64(blockSize)
+				if src != target {
+					if _, err = store.Read(extentID, src, int64(blockSize), buf, false); err != nil {
+						return
+					}
+					if _, err = tmp.WriteAt(buf, target); err != nil {
+						return
+					}
+					dirty = addDeltaRange(dirty, target, target+int64(blockSize))
+				}
+				target += int64(blockSize)
+				result.MatchedBytes += uint64(blockSize)
+			default:
+				err = ErrMalformedDelta
+				return
+			}
+		}
+		if target != next || next <= offset && next < sourceSize {
+			err = ErrMalformedDelta
+			return
+		}
+		offset = next
+		result.SourceSize = uint64(sourceSize)
+	}
+	return
+}
+
+// writeDeltaRanges writes the assembled regions to the extent.
+func writeDeltaRanges(tmp *os.File, dirty []deltaRange, write func(offset, size int64, data []byte) error,
+	result *ExtentDeltaSyncResult) (err error) {
+	buf, _ := proto.Buffers.Get(util.BlockSize)
+	defer proto.Buffers.Put(buf)
+	for _, r := range dirty {
+		for offset := r.start; offset < r.end; {
+			// the writes are aligned with the blocks of the extent, so that the crc of the full blocks is kept
+			size := int64(util.Min(int(r.end-offset), util.BlockSize-int(offset%util.BlockSize)))
+			if _, err = tmp.ReadAt(buf[:size], offset); err != nil {
+				return
+			}
+			if err = write(offset, size, buf[:size]); err != nil {
+				return
+			}
+			offset += size
+			result.WrittenBytes += uint64(size)
+		}
+	}
+	return
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func newDeltaTestExtent(t *testing.T, dataDir string, content []byte) (store *storage.ExtentStore, extentID uint64) {
+	store, err := storage.NewExtentStore(dataDir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extentID, _ = store.NextExtentID()
+	if err = store.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < len(content); offset += util.BlockSize {
+		data := content[offset:util.Min(offset+util.BlockSize, len(content))]
+		if err = store.Write(extentID, int64(offset), int64(len(data)), data, crc32.ChecksumIEEE(data),
+			storage.AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func readDeltaTestExtent(t *testing.T, store *storage.ExtentStore, extentID uint64) []byte {
+	ei, err := store.Watermark(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, ei.Size)
+	for offset := 0; offset < len(data); offset += util.ReadBlockSize {
+		size := util.Min(len(data)-offset, util.ReadBlockSize)
+		if _, err = store.Read(extentID, int64(offset), int64(size), data[offset:offset+size], false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return data
+}
+
+// TestSyncExtentDelta tests that a replica diverged in the middle of the extent, and outgrown by the source, gets
+// only the changed regions, and ends up byte-identical to the source.
+func TestSyncExtentDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_delta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const (
+		blockSize    = DefaultDeltaBlockSize
+		changeOffset = util.BlockSize + 1000
+		changeSize   = 100
+		appendSize   = 5000
+	)
+	// the random content has no repeated blocks, which would be matched at the other places
+	random := rand.New(rand.NewSource(1))
+	dest := make([]byte, 3*util.BlockSize)
+	random.Read(dest)
+	source := append([]byte{}, dest...)
+	for i := changeOffset; i < changeOffset+changeSize; i++ {
+		source[i] ^= 0xff
+	}
+	appended := make([]byte, appendSize)
+	random.Read(appended)
+	source = append(source, appended...)
+	sourceStore, sourceExtentID := newDeltaTestExtent(t, dir+"/source", source)
+	destStore, destExtentID := newDeltaTestExtent(t, dir+"/dest", dest)
+
+	sigs, err := extentSignatures(destStore, destExtentID, int64(len(dest)), blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != len(dest)/blockSize {
+		t.Fatalf("expect %v signatures, but are %v", len(dest)/blockSize, len(sigs))
+	}
+	request := marshalDeltaRequest(blockSize, deltaWindowSize, sigs)
+	var sent int
+	fetch := func(offset int64) ([]byte, error) {
+		// the source serves the request as the handler of OpExtentDelta does
+		reqBlockSize, window, reqSigs, err := unmarshalDeltaRequest(request)
+		if err != nil {
+			return nil, err
+		}
+		delta, err := computeExtentDelta(sourceStore, sourceExtentID, offset, window, reqBlockSize, reqSigs)
+		sent += len(delta)
+		return delta, err
+	}
+
+	tmp, err := ioutil.TempFile(dir, deltaTempFilePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	result := &ExtentDeltaSyncResult{DestSize: uint64(len(dest))}
+	dirty, err := assembleExtentDelta(destStore, destExtentID, blockSize, len(sigs), tmp, fetch, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the block containing the change, and the appended data, are transferred and written
+	changedBlock := int64(changeOffset / blockSize * blockSize)
+	expectDirty := []deltaRange{
+		{start: changedBlock, end: changedBlock + blockSize},
+		{start: int64(len(dest)), end: int64(len(source))},
+	}
+	if len(dirty) != len(expectDirty) || dirty[0] != expectDirty[0] || dirty[1] != expectDirty[1] {
+		t.Fatalf("expect the dirty ranges %v, but are %v", expectDirty, dirty)
+	}
+	if result.LiteralBytes != blockSize+appendSize || result.MatchedBytes != uint64(len(dest)-blockSize) ||
+		result.SourceSize != uint64(len(source)) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if sent > blockSize+appendSize+len(sigs)*5+deltaResponseHeaderLen+2*5 {
+		t.Fatalf("too much data %v is sent for the changes", sent)
+	}
+
+	write := func(offset, size int64, data []byte) error {
+		return destStore.Write(destExtentID, offset, size, data, crc32.ChecksumIEEE(data), storage.AppendWriteType, false)
+	}
+	if err = writeDeltaRanges(tmp, dirty, write, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.WrittenBytes != blockSize+appendSize {
+		t.Fatalf("expect %v bytes written, but are %v", blockSize+appendSize, result.WrittenBytes)
+	}
+	if synced := readDeltaTestExtent(t, destStore, destExtentID); !bytes.Equal(synced, source) {
+		t.Fatalf("the synced extent of size %v differs from the source of size %v", len(synced), len(source))
+	}
+}
+
+// TestSyncExtentDeltaSourceShrunk tests that the destination larger than the source is refused, since an extent can
+// not be truncated.
+func TestSyncExtentDeltaSourceShrunk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_delta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := make([]byte, util.BlockSize)
+	sourceStore, sourceExtentID := newDeltaTestExtent(t, dir+"/source", content[:util.BlockSize/2])
+	destStore, destExtentID := newDeltaTestExtent(t, dir+"/dest", content)
+	sigs, err := extentSignatures(destStore, destExtentID, int64(len(content)), DefaultDeltaBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch := func(offset int64) ([]byte, error) {
+		return computeExtentDelta(sourceStore, sourceExtentID, offset, deltaWindowSize, DefaultDeltaBlockSize, sigs)
+	}
+	tmp, err := ioutil.TempFile(dir, deltaTempFilePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	result := &ExtentDeltaSyncResult{DestSize: uint64(len(content))}
+	if _, err = assembleExtentDelta(destStore, destExtentID, DefaultDeltaBlockSize, len(sigs), tmp, fetch, result); err != ErrDeltaSourceShrunk {
+		t.Fatalf("expect %v, but is %v", ErrDeltaSourceShrunk, err)
+	}
+}
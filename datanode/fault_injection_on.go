@@ -0,0 +1,99 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build faultinject
+// +build faultinject
+
+package datanode
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// registerFaultInjectionAPI registers the APIs injecting the faults into the disks, which only exist in the
+// faultinject builds for testing.
+func (s *DataNode) registerFaultInjectionAPI() {
+	http.HandleFunc("/diskFaults", s.getDiskFaultsAPI)
+	http.HandleFunc("/setDiskFaults", s.setDiskFaultsAPI)
+}
+
+func (s *DataNode) getDiskFaultsAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, storage.ErrorInjectors())
+}
+
+// setDiskFaultsAPI sets the faults injected into the extents on the disk, and stops injecting if all of them are zero.
+func (s *DataNode) setDiskFaultsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramDisk              = "disk"
+		paramWriteErrPercent   = "writeErrPercent"
+		paramReadErrPercent    = "readErrPercent"
+		paramReadDelayMs       = "readDelayMs"
+		paramCrcCorruptPercent = "crcCorruptPercent"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	diskPath := r.FormValue(paramDisk)
+	if _, err := s.space.GetDisk(diskPath); err != nil {
+		s.buildFailureResp(w, http.StatusNotFound, err.Error())
+		return
+	}
+	parsePercent := func(param string) (percent int, err error) {
+		if value := r.FormValue(param); value != "" {
+			if percent, err = strconv.Atoi(value); err == nil && (percent < 0 || percent > 100) {
+				err = fmt.Errorf("out of [0, 100]")
+			}
+			if err != nil {
+				err = fmt.Errorf("parse param %v fail: %v", param, err)
+			}
+		}
+		return
+	}
+	var (
+		faults = &storage.DiskFaults{}
+		err    error
+	)
+	if faults.WriteErrPercent, err = parsePercent(paramWriteErrPercent); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if faults.ReadErrPercent, err = parsePercent(paramReadErrPercent); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if faults.CrcCorruptPercent, err = parsePercent(paramCrcCorruptPercent); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if value := r.FormValue(paramReadDelayMs); value != "" {
+		if faults.ReadDelayMs, err = strconv.ParseInt(value, 10, 64); err != nil || faults.ReadDelayMs < 0 {
+			err = fmt.Errorf("parse param %v fail: %v", paramReadDelayMs, value)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if *faults == (storage.DiskFaults{}) {
+		storage.SetErrorInjector(diskPath, nil)
+		s.buildSuccessResp(w, nil)
+		return
+	}
+	storage.SetErrorInjector(diskPath, faults)
+	s.buildSuccessResp(w, faults)
+}
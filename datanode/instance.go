@@ -0,0 +1,103 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	InstanceIDFileName = ".instance_id"
+	instanceIDLen      = 16
+)
+
+// loadInstanceID loads the instance ID of the data node from its disks, which is generated at the first start and
+// registered on the master, so that the master can detect a data node started with the disks cloned from another one.
+// The disks without the instance ID, which are newly added, are stamped with the instance ID of the others.
+func (s *DataNode) loadInstanceID(cfg *config.Config) (err error) {
+	var (
+		instanceID string
+		unstamped  []string
+	)
+	for _, d := range cfg.GetSlice(ConfigKeyDisks) {
+		arr := strings.Split(d.(string), ":")
+		if len(arr) != 2 {
+			return fmt.Errorf("Invalid disk configuration. Example: PATH:RESERVE_SIZE")
+		}
+		var id string
+		if id, err = readInstanceID(arr[0]); err != nil {
+			return
+		}
+		if id == "" {
+			unstamped = append(unstamped, arr[0])
+			continue
+		}
+		if instanceID != "" && instanceID != id {
+			return fmt.Errorf("disks belong to different data node instances [%v] and [%v], "+
+				"the disk [%v] may be moved from another data node", instanceID, id, arr[0])
+		}
+		instanceID = id
+	}
+	if instanceID == "" {
+		if instanceID, err = newInstanceID(); err != nil {
+			return
+		}
+	}
+	for _, diskPath := range unstamped {
+		if err = writeInstanceID(diskPath, instanceID); err != nil {
+			return
+		}
+		log.LogInfof("action[loadInstanceID] stamp disk(%v) with instance(%v)", diskPath, instanceID)
+	}
+	s.instanceID = instanceID
+	return
+}
+
+func readInstanceID(diskPath string) (id string, err error) {
+	data, err := ioutil.ReadFile(path.Join(diskPath, InstanceIDFileName))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func writeInstanceID(diskPath, id string) (err error) {
+	filename := path.Join(diskPath, InstanceIDFileName)
+	tmpFilename := filename + ".tmp"
+	if err = ioutil.WriteFile(tmpFilename, []byte(id), 0644); err != nil {
+		return
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+func newInstanceID() (id string, err error) {
+	buf := make([]byte, instanceIDLen)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+	return hex.EncodeToString(buf), nil
+}
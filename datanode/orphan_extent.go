@@ -0,0 +1,127 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// Handle OpOrphanExtents packet, which lists the candidates of the orphan extents, or deletes the orphan extents
+// confirmed by the master.
+func (s *DataNode) handlePacketToOrphanExtents(p *repl.Packet) {
+	var (
+		err     error
+		reqData []byte
+		data    []byte
+		task    = &proto.AdminTask{}
+		request = &proto.OrphanExtentsRequest{}
+		resp    *proto.OrphanExtentsResponse
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionOrphanExtents, err.Error())
+		}
+	}()
+	if err = json.Unmarshal(p.Data, task); err != nil {
+		return
+	}
+	if reqData, err = json.Marshal(task.Request); err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, request); err != nil {
+		return
+	}
+	dp := s.space.Partition(request.PartitionID)
+	if dp == nil {
+		err = proto.ErrDataPartitionNotExists
+		return
+	}
+	if len(request.Reclaim) == 0 {
+		resp = dp.listOrphanExtents(request)
+	} else if resp, err = dp.reclaimOrphanExtents(request); err != nil {
+		return
+	}
+	if data, err = json.Marshal(resp); err != nil {
+		return
+	}
+	p.PacketOkWithBody(data)
+}
+
+// listOrphanExtents lists the normal extents not modified since the time with the inodes they are created for.
+func (dp *DataPartition) listOrphanExtents(request *proto.OrphanExtentsRequest) (resp *proto.OrphanExtentsResponse) {
+	resp = &proto.OrphanExtentsResponse{PartitionID: dp.partitionID, Extents: make([]*proto.OrphanExtent, 0)}
+	store := dp.ExtentStore()
+	extents, _, err := store.GetAllWatermarks(storage.OrphanExtentFilter(request.ModifiedBefore))
+	if err != nil {
+		log.LogWarnf("action[listOrphanExtents] partition(%v) err(%v)", dp.partitionID, err)
+	}
+	sort.Sort(storage.ExtentInfoArr(extents))
+	for _, ei := range extents {
+		if ei.FileID <= request.FromExtentID {
+			continue
+		}
+		if len(resp.Extents) >= request.Limit {
+			break
+		}
+		resp.Extents = append(resp.Extents, &proto.OrphanExtent{
+			PartitionID: dp.partitionID,
+			ExtentID:    ei.FileID,
+			Inode:       store.ExtentInode(ei.FileID),
+			Size:        ei.Size,
+			ModifyTime:  ei.ModifyTime,
+		})
+	}
+	return
+}
+
+// reclaimOrphanExtents deletes the orphan extents, unless they have been written since they are listed.
+func (dp *DataPartition) reclaimOrphanExtents(request *proto.OrphanExtentsRequest) (resp *proto.OrphanExtentsResponse, err error) {
+	if dp.IsFrozen() {
+		return nil, proto.ErrDataPartitionFrozen
+	}
+	resp = &proto.OrphanExtentsResponse{PartitionID: dp.partitionID, Extents: make([]*proto.OrphanExtent, 0)}
+	store := dp.ExtentStore()
+	for _, extentID := range request.Reclaim {
+		if storage.IsTinyExtent(extentID) {
+			continue
+		}
+		ei, watermarkErr := store.Watermark(extentID)
+		if watermarkErr != nil || ei.IsDeleted || ei.ModifyTime >= request.ModifiedBefore {
+			continue
+		}
+		orphan := &proto.OrphanExtent{
+			PartitionID: dp.partitionID,
+			ExtentID:    extentID,
+			Inode:       store.ExtentInode(extentID),
+			Size:        ei.Size,
+			ModifyTime:  ei.ModifyTime,
+		}
+		if err = store.MarkDelete(extentID, 0, 0); err != nil {
+			log.LogErrorf("action[reclaimOrphanExtents] partition(%v) extent(%v) err(%v)", dp.partitionID,
+				extentID, err)
+			return
+		}
+		resp.Extents = append(resp.Extents, orphan)
+	}
+	log.LogWarnf("action[reclaimOrphanExtents] partition(%v) reclaims %v of %v orphan extents", dp.partitionID,
+		len(resp.Extents), len(request.Reclaim))
+	return
+}
@@ -17,7 +17,6 @@ package datanode
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"os"
 	"path"
@@ -36,6 +35,7 @@ import (
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/chubaofs/chubaofs/repl"
 	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/atomicfile"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -60,6 +60,10 @@ type DataPartitionMetadata struct {
 	Hosts                   []string
 	DataPartitionCreateType int
 	LastTruncateID          uint64
+	IsFrozen                bool
+	IsDegraded              bool
+	LayoutVersion           int
+	PackTinyExtents         bool
 }
 
 type sortedPeers []proto.Peer
@@ -111,6 +115,9 @@ type DataPartition struct {
 	storeC    chan uint64
 	stopC     chan bool
 
+	catchUpC         chan struct{} // launch the repair to catch up the lagging replicas
+	catchUpScheduled int32
+
 	intervalToUpdateReplicas      int64 // interval to ask the master for updating the replica information
 	snapshot                      []*proto.File
 	snapshotMutex                 sync.RWMutex
@@ -118,11 +125,18 @@ type DataPartition struct {
 	loadExtentHeaderStatus        int
 	DataPartitionCreateType       int
 	isLoadingDataPartition        bool
+	isFrozen                      bool // pinned read-only by the master, without any write, repair or delete
+	isDegraded                    bool // serves the possibly stale reads without the leader once the quorum is lost
+
+	// the writes led and the reads served by the replica, counted in the buckets of proto.IOSizeBounds
+	writeSizes [proto.IOSizeBucketCount]uint64
+	readSizes  [proto.IOSizeBucketCount]uint64
 }
 
 func CreateDataPartition(dpCfg *dataPartitionCfg, disk *Disk, request *proto.CreateDataPartitionRequest) (dp *DataPartition, err error) {
 
-	if dp, err = newDataPartition(dpCfg, disk); err != nil {
+	dpCfg.LayoutVersion = CurrentPartitionLayout
+	if dp, err = newDataPartition(dpCfg, disk, path.Join(disk.Path, partitionDirName(dpCfg.PartitionID))); err != nil {
 		return
 	}
 	dp.ForceLoadHeader()
@@ -181,7 +195,7 @@ func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err
 	var (
 		metaFileData []byte
 	)
-	if metaFileData, err = ioutil.ReadFile(path.Join(partitionDir, DataPartitionMetadataFileName)); err != nil {
+	if metaFileData, err = atomicfile.ReadFile(path.Join(partitionDir, DataPartitionMetadataFileName)); err != nil {
 		return
 	}
 	meta := &DataPartitionMetadata{}
@@ -201,8 +215,10 @@ func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err
 		RaftStore:     disk.space.GetRaftStore(),
 		NodeID:        disk.space.GetNodeID(),
 		ClusterID:     disk.space.GetClusterID(),
+		LayoutVersion: meta.LayoutVersion,
 	}
-	if dp, err = newDataPartition(dpCfg, disk); err != nil {
+	// the directory of a partition in the sized layout is named after its size at the creation, not the current one
+	if dp, err = newDataPartition(dpCfg, disk, partitionDir); err != nil {
 		return
 	}
 	dp.ForceSetDataPartitionToLoadding()
@@ -213,6 +229,9 @@ func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err
 	log.LogInfof("Action(LoadDataPartition) PartitionID(%v) meta(%v)", dp.partitionID, meta)
 	dp.DataPartitionCreateType = meta.DataPartitionCreateType
 	dp.lastTruncateID = meta.LastTruncateID
+	dp.isFrozen = meta.IsFrozen
+	dp.isDegraded = meta.IsDegraded
+	dp.extentStore.SetPackTinyExtents(meta.PackTinyExtents)
 	if meta.DataPartitionCreateType == proto.NormalCreateDataPartition {
 		err = dp.StartRaft()
 	} else {
@@ -229,9 +248,8 @@ func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err
 	return
 }
 
-func newDataPartition(dpCfg *dataPartitionCfg, disk *Disk) (dp *DataPartition, err error) {
+func newDataPartition(dpCfg *dataPartitionCfg, disk *Disk, dataPath string) (dp *DataPartition, err error) {
 	partitionID := dpCfg.PartitionID
-	dataPath := path.Join(disk.Path, fmt.Sprintf(DataPartitionPrefix+"_%v_%v", partitionID, dpCfg.PartitionSize))
 	partition := &DataPartition{
 		volumeID:        dpCfg.VolName,
 		clusterID:       dpCfg.ClusterID,
@@ -241,6 +259,7 @@ func newDataPartition(dpCfg *dataPartitionCfg, disk *Disk) (dp *DataPartition, e
 		partitionSize:   dpCfg.PartitionSize,
 		replicas:        make([]string, 0),
 		stopC:           make(chan bool, 0),
+		catchUpC:        make(chan struct{}, 1),
 		stopRaftC:       make(chan uint64, 0),
 		storeC:          make(chan uint64, 128),
 		snapshot:        make([]*proto.File, 0),
@@ -252,6 +271,19 @@ func newDataPartition(dpCfg *dataPartitionCfg, disk *Disk) (dp *DataPartition, e
 	if err != nil {
 		return
 	}
+	partition.extentStore.SetMmapCache(disk.mmapCache)
+	partition.extentStore.SetQuorumWrite(disk.space.dataNode.isQuorumWrite())
+	if status, msg := partition.extentStore.ExtentMetaStatus(); status == storage.ExtentMetaRestored ||
+		status == storage.ExtentMetaRebuilt {
+		mesg := fmt.Sprintf("partition(%v) on %v repaired the extent meta(%v): %v", partitionID, LocalIP, status, msg)
+		exporter.Warning(mesg)
+		log.LogWarnf(mesg)
+	}
+	if disk.space.dataNode.bucketExtents {
+		if err = partition.extentStore.SetExtentLayout(storage.ExtentLayoutBucketed); err != nil {
+			return
+		}
+	}
 
 	disk.AttachDataPartition(partition)
 	dp = partition
@@ -378,6 +410,63 @@ func (dp *DataPartition) IsRejectWrite() bool {
 	return dp.Disk().RejectWrite
 }
 
+// IsFrozen returns whether the partition is frozen.
+func (dp *DataPartition) IsFrozen() bool {
+	return dp.isFrozen
+}
+
+// SetFrozen freezes or unfreezes the partition, and persists the flag.
+func (dp *DataPartition) SetFrozen(isFrozen bool) (err error) {
+	oldFlag := dp.isFrozen
+	dp.isFrozen = isFrozen
+	if err = dp.PersistMetadata(); err != nil {
+		dp.isFrozen = oldFlag
+		return
+	}
+	dp.statusUpdate()
+	log.LogWarnf("action[SetFrozen] partition(%v) isFrozen(%v)", dp.partitionID, isFrozen)
+	return
+}
+
+// IsDegraded returns whether the partition is in the degraded mode.
+func (dp *DataPartition) IsDegraded() bool {
+	return dp.isDegraded
+}
+
+// SetDegraded switches the degraded mode of the partition, and persists the flag.
+func (dp *DataPartition) SetDegraded(isDegraded bool) (err error) {
+	oldFlag := dp.isDegraded
+	dp.isDegraded = isDegraded
+	if err = dp.PersistMetadata(); err != nil {
+		dp.isDegraded = oldFlag
+		return
+	}
+	log.LogWarnf("action[SetDegraded] partition(%v) isDegraded(%v)", dp.partitionID, isDegraded)
+	return
+}
+
+// servesDegradedRead returns whether the partition serves the reads as a follower, since it is in the degraded mode
+// and the raft group has no leader. The data read may be stale, as the writes acked by the lost quorum may be missing.
+func (dp *DataPartition) servesDegradedRead() bool {
+	if !dp.isDegraded {
+		return false
+	}
+	leaderAddr, isLeader := dp.IsRaftLeader()
+	return !isLeader && leaderAddr == ""
+}
+
+// SetPackTinyExtents sets the format the tiny extents are converted to in the background, and persists it.
+func (dp *DataPartition) SetPackTinyExtents(packed bool) (err error) {
+	oldFlag := dp.extentStore.PackTinyExtents()
+	dp.extentStore.SetPackTinyExtents(packed)
+	if err = dp.PersistMetadata(); err != nil {
+		dp.extentStore.SetPackTinyExtents(oldFlag)
+		return
+	}
+	log.LogWarnf("action[SetPackTinyExtents] partition(%v) packTinyExtents(%v)", dp.partitionID, packed)
+	return
+}
+
 // Status returns the partition status.
 func (dp *DataPartition) Status() int {
 	return dp.partitionStatus
@@ -405,19 +494,8 @@ func (dp *DataPartition) ForceLoadHeader() {
 // PersistMetadata persists the file metadata on the disk.
 func (dp *DataPartition) PersistMetadata() (err error) {
 	var (
-		metadataFile *os.File
-		metaData     []byte
+		metaData []byte
 	)
-	fileName := path.Join(dp.Path(), TempMetadataFileName)
-	if metadataFile, err = os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0666); err != nil {
-		return
-	}
-	defer func() {
-		metadataFile.Sync()
-		metadataFile.Close()
-		os.Remove(fileName)
-	}()
-
 	sp := sortedPeers(dp.config.Peers)
 	sort.Sort(sp)
 
@@ -430,15 +508,18 @@ func (dp *DataPartition) PersistMetadata() (err error) {
 		DataPartitionCreateType: dp.DataPartitionCreateType,
 		CreateTime:              time.Now().Format(TimeLayout),
 		LastTruncateID:          dp.lastTruncateID,
+		IsFrozen:                dp.isFrozen,
+		IsDegraded:              dp.isDegraded,
+		LayoutVersion:           dp.config.LayoutVersion,
+		PackTinyExtents:         dp.extentStore.PackTinyExtents(),
 	}
 	if metaData, err = json.Marshal(md); err != nil {
 		return
 	}
-	if _, err = metadataFile.Write(metaData); err != nil {
+	if err = atomicfile.WriteFile(path.Join(dp.Path(), DataPartitionMetadataFileName), TempMetadataFileName, metaData, 0666); err != nil {
 		return
 	}
 	log.LogInfof("PersistMetadata DataPartition(%v) data(%v)", dp.partitionID, string(metaData))
-	err = os.Rename(fileName, path.Join(dp.Path(), DataPartitionMetadataFileName))
 	return
 }
 func (dp *DataPartition) statusUpdateScheduler() {
@@ -450,6 +531,7 @@ func (dp *DataPartition) statusUpdateScheduler() {
 		case <-ticker.C:
 			index++
 			dp.statusUpdate()
+			dp.reclaimTinyExtents()
 			if index >= math.MaxUint32 {
 				index = 0
 			}
@@ -460,6 +542,8 @@ func (dp *DataPartition) statusUpdateScheduler() {
 			}
 		case <-snapshotTicker.C:
 			dp.ReloadSnapshot()
+		case <-dp.catchUpC:
+			dp.LaunchRepair(proto.NormalExtentType)
 		case <-dp.stopC:
 			ticker.Stop()
 			snapshotTicker.Stop()
@@ -478,6 +562,9 @@ func (dp *DataPartition) statusUpdate() {
 	if dp.extentStore.GetExtentCount() >= storage.MaxExtentCount {
 		status = proto.ReadOnly
 	}
+	if dp.isFrozen {
+		status = proto.ReadOnly
+	}
 	if dp.Status() == proto.Unavailable {
 		status = proto.Unavailable
 	}
@@ -519,11 +606,47 @@ func (dp *DataPartition) actualSize(path string, finfo os.FileInfo) (size int64)
 }
 
 func (dp *DataPartition) computeUsage() {
-	if time.Now().Unix()-dp.intervalToUpdatePartitionSize < IntervalToUpdatePartitionSize {
+	dp.used = int(dp.ExtentStore().UsedSize())
+}
+
+// reconcileUsedSize computes the used size from the extents on the disk at the interval, which corrects the drift of
+// the used size counted on the writes and the deletions.
+func (dp *DataPartition) reconcileUsedSize() {
+	if time.Now().Unix()-dp.intervalToUpdatePartitionSize < IntervalToReconcileUsedSize {
 		return
 	}
-	dp.used = int(dp.ExtentStore().GetStoreUsedSize())
+	counted, reconciled := dp.ExtentStore().ReconcileUsedSize()
 	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	drift := counted - reconciled
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > int64(dp.partitionSize)/100 {
+		log.LogWarnf("action[reconcileUsedSize] partition(%v) used size counted(%v) drifts from reconciled(%v)",
+			dp.partitionID, counted, reconciled)
+		return
+	}
+	log.LogDebugf("action[reconcileUsedSize] partition(%v) used size counted(%v) reconciled(%v)",
+		dp.partitionID, counted, reconciled)
+}
+
+func (dp *DataPartition) countWrite(size uint32) {
+	atomic.AddUint64(&dp.writeSizes[proto.IOSizeBucket(size)], 1)
+}
+
+func (dp *DataPartition) countRead(size uint32) {
+	atomic.AddUint64(&dp.readSizes[proto.IOSizeBucket(size)], 1)
+}
+
+// IOSizes returns the writes led and the reads served by the replica, counted in the buckets of proto.IOSizeBounds.
+func (dp *DataPartition) IOSizes() (writes, reads []uint64) {
+	writes = make([]uint64, proto.IOSizeBucketCount)
+	reads = make([]uint64, proto.IOSizeBucketCount)
+	for i := 0; i < proto.IOSizeBucketCount; i++ {
+		writes[i] = atomic.LoadUint64(&dp.writeSizes[i])
+		reads[i] = atomic.LoadUint64(&dp.readSizes[i])
+	}
+	return
 }
 
 func (dp *DataPartition) ExtentStore() *storage.ExtentStore {
@@ -551,12 +674,25 @@ func (dp *DataPartition) checkIsDiskError(err error) (diskError bool) {
 
 // String returns the string format of the data partition information.
 func (dp *DataPartition) String() (m string) {
-	return fmt.Sprintf(DataPartitionPrefix+"_%v_%v", dp.partitionID, dp.partitionSize)
+	return path.Base(dp.path)
+}
+
+// reclaimTinyExtents reclaims the leaked tiny extents, and repairs the tiny extents at once if few of them are
+// available, rather than failing the small file writes until the next scheduled repair.
+func (dp *DataPartition) reclaimTinyExtents() {
+	if extentIDs := dp.extentStore.ReclaimTinyExtents(TinyExtentReclaimTimeout); len(extentIDs) != 0 {
+		mesg := fmt.Sprintf("partition(%v) on %v reclaimed the leaked tiny extents %v", dp.partitionID, LocalIP, extentIDs)
+		exporter.Warning(mesg)
+		log.LogWarnf(mesg)
+	}
+	if dp.extentStore.AvailableTinyExtentCnt() <= MinAvaliTinyExtentCnt && dp.extentStore.BrokenTinyExtentCnt() > 0 {
+		dp.LaunchRepair(proto.TinyExtentType)
+	}
 }
 
 // LaunchRepair launches the repair of extents.
 func (dp *DataPartition) LaunchRepair(extentType uint8) {
-	if dp.partitionStatus == proto.Unavailable {
+	if dp.partitionStatus == proto.Unavailable || dp.isFrozen {
 		return
 	}
 	if err := dp.updateReplicas(false); err != nil {
@@ -577,10 +713,11 @@ func (dp *DataPartition) updateReplicas(isForce bool) (err error) {
 		return
 	}
 	dp.isLeader = false
-	isLeader, replicas, err := dp.fetchReplicasFromMaster()
+	isLeader, replicas, peers, err := dp.fetchReplicasFromMaster()
 	if err != nil {
 		return
 	}
+	dp.updatePeerAddrs(peers)
 	dp.replicasLock.Lock()
 	defer dp.replicasLock.Unlock()
 	if !dp.compareReplicas(dp.replicas, replicas) {
@@ -595,6 +732,51 @@ func (dp *DataPartition) updateReplicas(isForce bool) (err error) {
 	return
 }
 
+// updatePeerAddrs follows the new addresses of the peers, which are migrated by the master after the data nodes of the
+// peers register again with new IPs. The raft members are identified by the node IDs, so only their addresses change.
+func (dp *DataPartition) updatePeerAddrs(masterPeers []proto.Peer) {
+	addrs := make(map[uint64]string, len(masterPeers))
+	for _, peer := range masterPeers {
+		addrs[peer.ID] = peer.Addr
+	}
+	peers := make([]proto.Peer, len(dp.config.Peers))
+	copy(peers, dp.config.Peers)
+	var changed []proto.Peer
+	for i, peer := range peers {
+		if addr, ok := addrs[peer.ID]; ok && addr != "" && addr != peer.Addr {
+			peers[i].Addr = addr
+			changed = append(changed, peers[i])
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	heartbeatPort, replicaPort, err := dp.raftPort()
+	if err != nil {
+		log.LogErrorf("action[updatePeerAddrs] partition(%v) err(%v)", dp.partitionID, err)
+		return
+	}
+	hosts := make([]string, len(dp.config.Hosts))
+	for i, host := range dp.config.Hosts {
+		hosts[i] = host
+		for j, peer := range dp.config.Peers {
+			if peer.Addr == host {
+				hosts[i] = peers[j].Addr
+			}
+		}
+	}
+	log.LogWarnf("action[updatePeerAddrs] partition(%v) peers readdressed from (%v) to (%v)",
+		dp.partitionID, dp.config.Peers, peers)
+	dp.config.Peers = peers
+	dp.config.Hosts = hosts
+	for _, peer := range changed {
+		dp.config.RaftStore.AddNodeWithPort(peer.ID, strings.Split(peer.Addr, ":")[0], heartbeatPort, replicaPort)
+	}
+	if err = dp.PersistMetadata(); err != nil {
+		log.LogErrorf("action[updatePeerAddrs] partition(%v) persist metadata err(%v)", dp.partitionID, err)
+	}
+}
+
 // Compare the fetched replica with the local one.
 func (dp *DataPartition) compareReplicas(v1, v2 []string) (equals bool) {
 	equals = true
@@ -613,7 +795,7 @@ func (dp *DataPartition) compareReplicas(v1, v2 []string) (equals bool) {
 }
 
 // Fetch the replica information from the master.
-func (dp *DataPartition) fetchReplicasFromMaster() (isLeader bool, replicas []string, err error) {
+func (dp *DataPartition) fetchReplicasFromMaster() (isLeader bool, replicas []string, peers []proto.Peer, err error) {
 
 	var partition *proto.DataPartitionInfo
 	if partition, err = MasterClient.AdminAPI().GetDataPartition(dp.volumeID, dp.partitionID); err != nil {
@@ -623,6 +805,7 @@ func (dp *DataPartition) fetchReplicasFromMaster() (isLeader bool, replicas []st
 	for _, host := range partition.Hosts {
 		replicas = append(replicas, host)
 	}
+	peers = partition.Peers
 	if partition.Hosts != nil && len(partition.Hosts) >= 1 {
 		leaderAddr := strings.Split(partition.Hosts[0], ":")
 		if len(leaderAddr) == 2 && strings.TrimSpace(leaderAddr[0]) == LocalIP {
@@ -655,6 +838,10 @@ func (dp *DataPartition) Load() (response *proto.LoadDataPartitionResponse) {
 // 1. when the extent size is smaller than the max size on the record, start to repair the missing part.
 // 2. if the extent does not even exist, create the extent first, and then repair.
 func (dp *DataPartition) DoExtentStoreRepair(repairTask *DataPartitionRepairTask) {
+	if dp.isFrozen {
+		log.LogWarnf("action[DoExtentStoreRepair] partition(%v) is frozen, skip the repair", dp.partitionID)
+		return
+	}
 	store := dp.extentStore
 	for _, extentInfo := range repairTask.ExtentsToBeCreated {
 		if storage.IsTinyExtent(extentInfo.FileID) {
@@ -753,7 +940,7 @@ func (dp *DataPartition) doStreamFixTinyDeleteRecord(repairTask *DataPartitionRe
 	}()
 
 	p := repl.NewPacketToReadTinyDeleteRecord(dp.partitionID, localTinyDeleteFileSize)
-	if conn, err = gConnPool.GetConnect(repairTask.LeaderAddr); err != nil {
+	if conn, err = getReplicaConnect(repairTask.LeaderAddr); err != nil {
 		return
 	}
 	defer gConnPool.PutConnect(conn, true)
@@ -162,10 +162,8 @@ func UnmarshalOldVersionRandWriteOpItem(raw []byte) (result *rndWrtOpItem, err e
 
 func (dp *DataPartition) checkWriteErrs(errMsg string) (ignore bool) {
 	// file has been deleted when applying the raft log
-	if strings.Contains(errMsg, storage.ExtentHasBeenDeletedError.Error()) || strings.Contains(errMsg, storage.ExtentNotFoundError.Error()) {
-		return true
-	}
-	return false
+	code, ok := proto.ResultCodeOfMessage(errMsg)
+	return ok && code == proto.OpNotExistErr
 }
 
 // CheckLeader checks if itself is the leader during read
@@ -182,6 +180,15 @@ func (dp *DataPartition) CheckLeader(request *repl.Packet, connect net.Conn) (er
 	return
 }
 
+// CheckReadLeader checks the leader for the read like CheckLeader, while a degraded partition without the leader
+// serves the read by itself.
+func (dp *DataPartition) CheckReadLeader(request *repl.Packet, connect net.Conn) (err error) {
+	if dp.servesDegradedRead() {
+		return
+	}
+	return dp.CheckLeader(request, connect)
+}
+
 type ItemIterator struct {
 	applyID uint64
 }
@@ -236,8 +243,13 @@ func (dp *DataPartition) ApplyRandomWrite(command []byte, raftApplyID uint64) (r
 	}
 	log.LogDebugf("[ApplyRandomWrite] ApplyID(%v) Partition(%v)_Extent(%v)_ExtentOffset(%v)_Size(%v)",
 		raftApplyID, dp.partitionID, opItem.extentID, opItem.offset, opItem.size)
+	// the writes of a delta sync may grow the extent
+	writeType := storage.RandomWriteType
+	if opItem.opcode == proto.OpExtentDelta {
+		writeType = storage.AppendWriteType
+	}
 	for i := 0; i < 20; i++ {
-		err = dp.ExtentStore().Write(opItem.extentID, opItem.offset, opItem.size, opItem.data, opItem.crc, storage.RandomWriteType, opItem.opcode == proto.OpSyncRandomWrite)
+		err = dp.ExtentStore().Write(opItem.extentID, opItem.offset, opItem.size, opItem.data, opItem.crc, writeType, opItem.opcode == proto.OpSyncRandomWrite)
 		if dp.checkIsDiskError(err) {
 			return
 		}
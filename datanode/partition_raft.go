@@ -18,7 +18,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"os"
 	"path"
@@ -30,6 +29,7 @@ import (
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/util/atomicfile"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -43,6 +43,7 @@ type dataPartitionCfg struct {
 	PartitionSize int                 `json:"partition_size"`
 	Peers         []proto.Peer        `json:"peers"`
 	Hosts         []string            `json:"hosts"`
+	LayoutVersion int                 `json:"layout_version"`
 	NodeID        uint64              `json:"-"`
 	RaftStore     raftstore.RaftStore `json:"-"`
 }
@@ -373,20 +374,8 @@ func (dp *DataPartition) removeRaftNode(req *proto.RemoveDataPartitionRaftMember
 }
 
 func (dp *DataPartition) storeAppliedID(applyIndex uint64) (err error) {
-	filename := path.Join(dp.Path(), TempApplyIndexFile)
-	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_TRUNC|os.O_CREATE, 0755)
-	if err != nil {
-		return
-	}
-	defer func() {
-		fp.Close()
-		os.Remove(filename)
-	}()
-	if _, err = fp.WriteString(fmt.Sprintf("%d", applyIndex)); err != nil {
-		return
-	}
-	fp.Sync()
-	err = os.Rename(filename, path.Join(dp.Path(), ApplyIndexFile))
+	data := []byte(fmt.Sprintf("%d", applyIndex))
+	err = atomicfile.WriteFile(path.Join(dp.Path(), ApplyIndexFile), TempApplyIndexFile, data, 0755)
 	return
 }
 
@@ -397,7 +386,7 @@ func (dp *DataPartition) LoadAppliedID() (err error) {
 		err = nil
 		return
 	}
-	data, err := ioutil.ReadFile(filename)
+	data, err := atomicfile.ReadFile(filename)
 	if err != nil {
 		if err == os.ErrNotExist {
 			err = nil
@@ -432,16 +421,22 @@ func (s *DataNode) parseRaftConfig(cfg *config.Config) (err error) {
 	}
 	s.raftHeartbeat = cfg.GetString(ConfigKeyRaftHeartbeat)
 	s.raftReplica = cfg.GetString(ConfigKeyRaftReplica)
+	if s.raftTimings, err = raftstore.LoadTimings(cfg); err != nil {
+		return fmt.Errorf("bad raft timings config: %v", err)
+	}
 	log.LogDebugf("[parseRaftConfig] load raftDir(%v).", s.raftDir)
 	log.LogDebugf("[parseRaftConfig] load raftHearbeat(%v).", s.raftHeartbeat)
 	log.LogDebugf("[parseRaftConfig] load raftReplica(%v).", s.raftReplica)
+	log.LogDebugf("[parseRaftConfig] load raftTimings(%+v).", s.raftTimings)
 	return
 }
 
 func (s *DataNode) startRaftServer(cfg *config.Config) (err error) {
 	log.LogInfo("Start: startRaftServer")
 
-	s.parseRaftConfig(cfg)
+	if err = s.parseRaftConfig(cfg); err != nil {
+		return
+	}
 
 	constCfg := config.ConstConfig{
 		Listen:           s.port,
@@ -480,6 +475,12 @@ func (s *DataNode) startRaftServer(cfg *config.Config) (err error) {
 		HeartbeatPort:     heartbeatPort,
 		ReplicaPort:       replicatePort,
 		NumOfLogsToRetain: DefaultRaftLogsToRetain,
+		TickInterval:      s.raftTimings.TickInterval,
+		HeartbeatTick:     s.raftTimings.HeartbeatTick,
+		ElectionTick:      s.raftTimings.ElectionTick,
+		MaxInflightMsgs:   s.raftTimings.MaxInflightMsgs,
+		ReplicaIP:         s.replicaIP,
+		ReplicaResolver:   gReplicaResolver,
 	}
 	s.raftStore, err = raftstore.NewRaftStore(raftConf)
 	if err != nil {
@@ -570,7 +571,7 @@ func (dp *DataPartition) getLeaderPartitionSize(maxExtentID uint64) (size uint64
 	p := NewPacketToGetPartitionSize(dp.partitionID)
 	p.ExtentID = maxExtentID
 	target := dp.getReplicaAddr(0)
-	conn, err = gConnPool.GetConnect(target) //get remote connect
+	conn, err = getReplicaConnect(target) //get remote connect
 	if err != nil {
 		err = errors.Trace(err, " partition(%v) get host(%v) connect", dp.partitionID, target)
 		return
@@ -606,7 +607,7 @@ func (dp *DataPartition) getLeaderMaxExtentIDAndPartitionSize() (maxExtentID, Pa
 	p := NewPacketToGetMaxExtentIDAndPartitionSIze(dp.partitionID)
 
 	target := dp.getReplicaAddr(0)
-	conn, err = gConnPool.GetConnect(target) //get remote connect
+	conn, err = getReplicaConnect(target) //get remote connect
 	if err != nil {
 		err = errors.Trace(err, " partition(%v) get host(%v) connect", dp.partitionID, target)
 		return
@@ -648,7 +649,7 @@ func (dp *DataPartition) broadcastMinAppliedID(minAppliedID uint64) (err error)
 		}
 		target := dp.getReplicaAddr(i)
 		var conn *net.TCPConn
-		conn, err = gConnPool.GetConnect(target)
+		conn, err = getReplicaConnect(target)
 		if err != nil {
 			return
 		}
@@ -711,7 +712,7 @@ func (dp *DataPartition) getRemoteAppliedID(target string, p *repl.Packet) (appl
 		}
 	}()
 
-	conn, err = gConnPool.GetConnect(target)
+	conn, err = getReplicaConnect(target)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,96 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+)
+
+const (
+	DefaultPartitionsPerReport = 4096 // the nodes with fewer partitions report all of them in each heartbeat
+	// A round of the cohorts takes fewer heartbeats than the master waits for before it takes a replica as missing.
+	MaxReportCohorts = 8
+)
+
+type reportedStatus struct {
+	status     int
+	isLeader   bool
+	isFrozen   bool
+	isDegraded bool
+	round      uint64
+}
+
+// partitionReporter splits the partition reports of a node with massive partitions into the cohorts of their IDs,
+// which are reported round-robin across the consecutive heartbeats to bound the size of a heartbeat. A partition whose
+// status changed since it was last reported is reported in the next heartbeat regardless of its cohort.
+type partitionReporter struct {
+	sync.Mutex
+	partitionsPerReport int // not positive to report all the partitions in each heartbeat
+	round               uint64
+	cohort              int
+	cohorts             int
+	reported            map[uint64]*reportedStatus
+}
+
+func newPartitionReporter(partitionsPerReport int) *partitionReporter {
+	return &partitionReporter{
+		partitionsPerReport: partitionsPerReport,
+		reported:            make(map[uint64]*reportedStatus),
+	}
+}
+
+// begin starts a heartbeat of the given number of partitions, and returns the cohort reported by it and the number of
+// the cohorts. The caller holds the lock until the heartbeat is built.
+func (r *partitionReporter) begin(partitionCnt int) (cohort, cohorts int) {
+	r.round++
+	r.cohorts = 1
+	if r.partitionsPerReport > 0 {
+		r.cohorts = (partitionCnt + r.partitionsPerReport - 1) / r.partitionsPerReport
+	}
+	if r.cohorts > MaxReportCohorts {
+		r.cohorts = MaxReportCohorts
+	}
+	if r.cohorts < 1 {
+		r.cohorts = 1
+	}
+	r.cohort = int(r.round % uint64(r.cohorts))
+	return r.cohort, r.cohorts
+}
+
+// shouldReport returns whether a partition is reported by the heartbeat, i.e. it belongs to the cohort or its status
+// changed since it was last reported.
+func (r *partitionReporter) shouldReport(partitionID uint64, status int, isLeader, isFrozen, isDegraded bool) bool {
+	rs, ok := r.reported[partitionID]
+	if !ok {
+		rs = &reportedStatus{}
+		r.reported[partitionID] = rs
+	}
+	rs.round = r.round
+	if ok && int(partitionID%uint64(r.cohorts)) != r.cohort &&
+		rs.status == status && rs.isLeader == isLeader && rs.isFrozen == isFrozen && rs.isDegraded == isDegraded {
+		return false
+	}
+	rs.status, rs.isLeader, rs.isFrozen, rs.isDegraded = status, isLeader, isFrozen, isDegraded
+	return true
+}
+
+// end forgets the partitions deleted since the last heartbeat.
+func (r *partitionReporter) end() {
+	for id, rs := range r.reported {
+		if rs.round != r.round {
+			delete(r.reported, id)
+		}
+	}
+}
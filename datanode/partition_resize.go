@@ -0,0 +1,66 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The layouts of the partition directories, recorded as the LayoutVersion in the META file.
+const (
+	// PartitionLayoutSized names the directory after the ID and the size at the creation, i.e. datapartition_{id}_{size}.
+	// The name is kept once the partition is resized, so the size in it may be stale.
+	PartitionLayoutSized = 0
+	// PartitionLayoutUnsized names the directory after the ID only, i.e. datapartition_{id}, which is not loaded by
+	// the data nodes released before it.
+	PartitionLayoutUnsized = 1
+
+	CurrentPartitionLayout = PartitionLayoutUnsized
+)
+
+var ErrNoSpaceToResizePartition = errors.New("No disk space to resize the data partition")
+
+func partitionDirName(partitionID uint64) string {
+	return fmt.Sprintf(DataPartitionPrefix+"_%v", partitionID)
+}
+
+// Resize grows the partition to the size online, and persists it. The size is accounted to the disk at once, rather
+// than at the next computation of the disk usage.
+func (dp *DataPartition) Resize(size int) (err error) {
+	oldSize := dp.partitionSize
+	if size < oldSize {
+		return fmt.Errorf("partition(%v) cannot shrink from size(%v) to size(%v)", dp.partitionID, oldSize, size)
+	}
+	if size == oldSize {
+		return
+	}
+	if uint64(size-oldSize) > dp.disk.Unallocated {
+		return ErrNoSpaceToResizePartition
+	}
+	dp.partitionSize = size
+	dp.config.PartitionSize = size
+	if err = dp.PersistMetadata(); err != nil {
+		dp.partitionSize = oldSize
+		dp.config.PartitionSize = oldSize
+		return
+	}
+	dp.disk.AddSize(uint64(size - oldSize))
+	dp.statusUpdate()
+	log.LogWarnf("action[Resize] partition(%v) size(%v) -> size(%v)", dp.partitionID, oldSize, size)
+	return
+}
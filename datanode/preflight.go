@@ -0,0 +1,107 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/preflight"
+)
+
+// Preflight checks the config of the data node and its environment without starting it.
+func Preflight(cfg *config.Config) *preflight.Report {
+	return preflightCheck(cfg)
+}
+
+func preflightCheck(cfg *config.Config, ownPorts ...string) (r *preflight.Report) {
+	r = preflight.NewReport(proto.NodeRoleData, ownPorts...)
+	if !r.Required(cfg, proto.ListenPort, ConfigKeyRaftDir, ConfigKeyRaftHeartbeat, ConfigKeyRaftReplica) {
+		return
+	}
+	port, heartbeatPort, replicaPort := cfg.GetString(proto.ListenPort), cfg.GetString(ConfigKeyRaftHeartbeat),
+		cfg.GetString(ConfigKeyRaftReplica)
+	r.Port(port)
+	r.Port(heartbeatPort)
+	r.Port(replicaPort)
+
+	masters := r.Strings(cfg, proto.MasterAddr)
+	if len(masters) == 0 {
+		r.Add(preflight.CheckConfig, proto.MasterAddr, fmt.Errorf("%v is not set", proto.MasterAddr))
+	}
+	for _, addr := range masters {
+		r.Resolve(addr)
+	}
+
+	raftDir := cfg.GetString(ConfigKeyRaftDir)
+	r.Dir(raftDir)
+	r.DiskSpace(raftDir, preflight.DefaultMinDiskSpace)
+	r.ConstConfig(raftDir, &config.ConstConfig{
+		Listen:           port,
+		RaftHeartbetPort: heartbeatPort,
+		RaftReplicaPort:  replicaPort,
+	})
+
+	disks := r.Strings(cfg, ConfigKeyDisks)
+	if len(disks) == 0 {
+		r.Add(preflight.CheckConfig, ConfigKeyDisks, fmt.Errorf("%v is not set", ConfigKeyDisks))
+	}
+	for _, disk := range disks {
+		// format "PATH:RESERVE_SIZE"
+		arr := strings.Split(disk, ":")
+		if len(arr) != 2 {
+			r.Add(preflight.CheckConfig, disk, fmt.Errorf("invalid disk, example: PATH:RESERVE_SIZE"))
+			continue
+		}
+		reservedSpace, err := strconv.ParseUint(arr[1], 10, 64)
+		if err != nil {
+			r.Add(preflight.CheckConfig, disk, fmt.Errorf("invalid disk reserved space: %v", err))
+			continue
+		}
+		if reservedSpace < DefaultDiskRetainMin {
+			reservedSpace = DefaultDiskRetainMin
+		}
+		// the disk path is not created by the data node
+		if _, err = os.Stat(arr[0]); err != nil {
+			r.Add(preflight.CheckDir, arr[0], err)
+			continue
+		}
+		r.Dir(arr[0])
+		r.DiskSpace(arr[0], reservedSpace)
+	}
+	return
+}
+
+// validateConfigAPI checks the config in the body against the environment of the data node. The ports listened
+// by the data node itself are taken as free.
+func (s *DataNode) validateConfigAPI(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg, err := config.ParseConfig(body)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, preflightCheck(cfg, s.port, s.raftHeartbeat, s.raftReplica))
+}
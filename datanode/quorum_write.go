@@ -0,0 +1,97 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The normal extent repair only repairs the extents which have not been modified for storage.RepairInterval,
+// so the catch-up of a lagging replica is launched after that.
+const IntervalToCatchUpLaggingReplica = time.Second * (storage.RepairInterval + 10)
+
+// Quorum write is turned on or off by the master in the heartbeat. With quorum write, the leader acks an append write
+// of a normal extent once the quorum of the replicas persist it, and the stragglers are caught up asynchronously.
+// The replicas reject the append writes which do not follow the extent size, so that a straggler never has a hole in
+// the extent, and its reads beyond the extent size are redirected to the other replicas.
+func (s *DataNode) setQuorumWrite(enable bool) {
+	var flag int32
+	if enable {
+		flag = 1
+	}
+	if atomic.SwapInt32(&s.quorumWrite, flag) != flag {
+		log.LogInfof("action[setQuorumWrite] quorum write is set to %v", enable)
+	}
+	// set on every heartbeat, so that the partitions created or loaded meanwhile follow the mode as well
+	s.space.RangePartitions(func(dp *DataPartition) bool {
+		dp.extentStore.SetQuorumWrite(enable)
+		return true
+	})
+}
+
+func (s *DataNode) isQuorumWrite() bool {
+	return atomic.LoadInt32(&s.quorumWrite) == 1
+}
+
+// Mark the append write of a normal extent forwarded to the followers as a quorum write.
+func (s *DataNode) markQuorumWrite(p *repl.Packet) {
+	if s.isQuorumWrite() && p.IsForwardPacket() && p.IsWriteOperation() && p.ExtentType == proto.NormalExtentType {
+		p.QuorumWrite = true
+	}
+}
+
+// Check the offset of an append write of a normal extent with quorum write, a replica which has missed the previous
+// packets rejects the following ones until it is caught up.
+func (dp *DataPartition) checkAppendOffset(extentID uint64, offset int64) (err error) {
+	ei, err := dp.extentStore.Watermark(extentID)
+	if err != nil {
+		return
+	}
+	if offset > int64(ei.Size) {
+		return storage.ExtentIsLaggingError
+	}
+	return
+}
+
+// Handle the straggler of a quorum write packet reported by the replication protocol.
+func (s *DataNode) handleStraggler(p *repl.FollowerPacket, addr string, err error) {
+	dp := s.space.Partition(p.PartitionID)
+	if dp == nil {
+		return
+	}
+	log.LogWarnf("action[handleStraggler] partition(%v) extent(%v) is lagging on follower(%v) err(%v)",
+		p.PartitionID, p.ExtentID, addr, err)
+	dp.scheduleCatchUp()
+}
+
+// Launch the repair of the normal extents once the lagging extents are not written any more.
+func (dp *DataPartition) scheduleCatchUp() {
+	if !atomic.CompareAndSwapInt32(&dp.catchUpScheduled, 0, 1) {
+		return
+	}
+	time.AfterFunc(IntervalToCatchUpLaggingReplica, func() {
+		atomic.StoreInt32(&dp.catchUpScheduled, 0)
+		select {
+		case dp.catchUpC <- struct{}{}:
+		default:
+		}
+	})
+}
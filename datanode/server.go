@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"errors"
@@ -38,6 +39,9 @@ import (
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/pressure"
+	"github.com/chubaofs/chubaofs/util/priority"
+	"github.com/chubaofs/chubaofs/util/replnet"
 )
 
 var (
@@ -48,6 +52,7 @@ var (
 
 	LocalIP, serverPort string
 	gConnPool           = util.NewConnectPool()
+	gReplicaResolver    *replnet.Resolver // nil if the data node has no replication interface
 	MasterClient        = masterSDK.NewMasterClient(nil, false)
 )
 
@@ -69,10 +74,17 @@ const (
 	ConfigKeyPort          = "port"          // int
 	ConfigKeyMasterAddr    = "masterAddr"    // array
 	ConfigKeyZone          = "zoneName"      // string
+	ConfigKeyRack          = "rack"          // string
+	ConfigKeySpare         = "spare"         // bool
 	ConfigKeyDisks         = "disks"         // array
 	ConfigKeyRaftDir       = "raftDir"       // string
 	ConfigKeyRaftHeartbeat = "raftHeartbeat" // string
 	ConfigKeyRaftReplica   = "raftReplica"   // string
+
+	ConfigKeyExpiredPartitionRetentionHours = "expiredPartitionRetentionHours" // int, negative to disable deleting
+	ConfigKeyExtentMmapBudgetMB             = "extentMmapBudgetMB"             // int, per disk, 0 to disable mapping the hot extents
+	ConfigKeyPartitionsPerReport            = "partitionsPerReport"            // int, negative to report all the partitions in each heartbeat
+	ConfigKeyBucketExtents                  = "bucketExtents"                  // bool, keep the normal extents in the hash-bucketed subdirectories
 )
 
 // DataNode defines the structure of a data node.
@@ -80,6 +92,9 @@ type DataNode struct {
 	space           *SpaceManager
 	port            string
 	zoneName        string
+	rack            string // the rack of the node within the zone, empty if unknown
+	isSpare         bool
+	instanceID      string
 	clusterID       string
 	localIP         string
 	localServerAddr string
@@ -87,16 +102,32 @@ type DataNode struct {
 	raftDir         string
 	raftHeartbeat   string
 	raftReplica     string
+	raftTimings     raftstore.Timings // zero ones take the defaults of the raft store
 	raftStore       raftstore.RaftStore
 
+	expiredRetention time.Duration
+	quorumWrite      int32 // 1 if the quorum write is enabled by the master
+	extentMmapBudget int64 // bytes of the hot extents mapped on each disk
+	bucketExtents    bool  // upgrade the extent stores to the bucketed layout
+	reporter         *partitionReporter
+	tokenSigningKey  string // key to validate the delegated tokens
+
+	tokenRequiredVols atomic.Value // map[string]bool, the vols refusing the clients without a delegated token
+
 	tcpListener net.Listener
 	stopC       chan bool
+	pressure    *pressure.Monitor
+	priorityQ   *priority.Queue // queues the reads and the writes of the clients by their priority classes
+
+	replicaIP  string // the IP of the interface dedicated to the replication and the repair, if any
+	netMonitor *replnet.Monitor
+	copyJobs   *extentCopyJobs
 
 	control common.Control
 }
 
 func NewServer() *DataNode {
-	return &DataNode{}
+	return &DataNode{copyJobs: newExtentCopyJobs()}
 }
 
 func (s *DataNode) Start(cfg *config.Config) (err error) {
@@ -128,8 +159,23 @@ func doStart(server common.Server, cfg *config.Config) (err error) {
 		return
 	}
 
+	if s.pressure, err = pressure.NewMonitor(ModuleName, cfg); err != nil {
+		return
+	}
+	if s.priorityQ, err = priority.NewQueue(ModuleName, cfg); err != nil {
+		return
+	}
+
+	// load the instance ID stamped on the disks
+	if err = s.loadInstanceID(cfg); err != nil {
+		return
+	}
+
 	exporter.Init(ModuleName, cfg)
-	s.register(cfg)
+	if err = s.register(cfg); err != nil {
+		return
+	}
+	s.startReplicaNetwork()
 
 	// start the raft server
 	if err = s.startRaftServer(cfg); err != nil {
@@ -148,6 +194,10 @@ func doStart(server common.Server, cfg *config.Config) (err error) {
 		return
 	}
 
+	// watch the memory and the file descriptors before accepting connections
+	s.pressure.AddRelief(s.releaseExtentCaches)
+	s.pressure.Start()
+
 	// start tcp listening
 	if err = s.startTCPService(); err != nil {
 		return
@@ -156,6 +206,8 @@ func doStart(server common.Server, cfg *config.Config) (err error) {
 
 	go s.startUpdateNodeInfo()
 
+	go s.startExpiredPartitionJanitor()
+
 	return
 }
 
@@ -165,6 +217,12 @@ func doShutdown(server common.Server) {
 		return
 	}
 	close(s.stopC)
+	if s.pressure != nil {
+		s.pressure.Stop()
+	}
+	if s.netMonitor != nil {
+		s.netMonitor.Stop()
+	}
 	s.space.Stop()
 	s.stopUpdateNodeInfo()
 	s.stopTCPService()
@@ -177,6 +235,11 @@ func (s *DataNode) parseConfig(cfg *config.Config) (err error) {
 		regexpPort *regexp.Regexp
 	)
 	LocalIP = cfg.GetString(ConfigKeyLocalIP)
+	if s.replicaIP = cfg.GetString(proto.ReplicaIP); s.replicaIP != "" {
+		if err = replnet.CheckLocalIP(s.replicaIP); err != nil {
+			return
+		}
+	}
 	port = cfg.GetString(proto.ListenPort)
 	serverPort = port
 	if regexpPort, err = regexp.Compile("^(\\d)+$"); err != nil {
@@ -192,14 +255,37 @@ func (s *DataNode) parseConfig(cfg *config.Config) (err error) {
 	for _, ip := range cfg.GetSlice(proto.MasterAddr) {
 		MasterClient.AddNode(ip.(string))
 	}
+	MasterClient.SetNodeIdentity(proto.NodeRoleData, cfg.GetString(proto.NodeToken))
 	s.zoneName = cfg.GetString(ConfigKeyZone)
 	if s.zoneName == "" {
 		s.zoneName = DefaultZoneName
 	}
+	s.rack = cfg.GetString(ConfigKeyRack)
+	s.isSpare = cfg.GetBool(ConfigKeySpare)
+	s.tokenSigningKey = cfg.GetString(proto.TokenSigningKey)
+	s.expiredRetention = DefaultExpiredPartitionRetention
+	if hours := cfg.GetInt64(ConfigKeyExpiredPartitionRetentionHours); hours != 0 {
+		s.expiredRetention = time.Duration(hours) * time.Hour
+	}
+	if budget := cfg.GetInt64(ConfigKeyExtentMmapBudgetMB); budget > 0 {
+		s.extentMmapBudget = budget * util.MB
+	}
+	partitionsPerReport := DefaultPartitionsPerReport
+	if n := cfg.GetInt64(ConfigKeyPartitionsPerReport); n != 0 {
+		partitionsPerReport = int(n)
+	}
+	s.reporter = newPartitionReporter(partitionsPerReport)
+	s.bucketExtents = cfg.GetBool(ConfigKeyBucketExtents)
 
 	log.LogDebugf("action[parseConfig] load masterAddrs(%v).", MasterClient.Nodes())
 	log.LogDebugf("action[parseConfig] load port(%v).", s.port)
 	log.LogDebugf("action[parseConfig] load zoneName(%v).", s.zoneName)
+	log.LogDebugf("action[parseConfig] load rack(%v).", s.rack)
+	log.LogDebugf("action[parseConfig] load isSpare(%v).", s.isSpare)
+	log.LogDebugf("action[parseConfig] load expiredRetention(%v).", s.expiredRetention)
+	log.LogDebugf("action[parseConfig] load partitionsPerReport(%v).", partitionsPerReport)
+	log.LogDebugf("action[parseConfig] load extentMmapBudget(%v).", s.extentMmapBudget)
+	log.LogDebugf("action[parseConfig] load bucketExtents(%v).", s.bucketExtents)
 	return
 }
 
@@ -252,11 +338,7 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 
 // registers the data node on the master to report the information such as IsIPV4 address.
 // The startup of a data node will be blocked until the registration succeeds.
-func (s *DataNode) register(cfg *config.Config) {
-	var (
-		err error
-	)
-
+func (s *DataNode) register(cfg *config.Config) (err error) {
 	timer := time.NewTimer(0)
 
 	// get the IsIPV4 address, cluster ID and node ID from the master
@@ -285,19 +367,26 @@ func (s *DataNode) register(cfg *config.Config) {
 
 			// register this data node on the master
 			var nodeID uint64
-			if nodeID, err = MasterClient.NodeAPI().AddDataNode(fmt.Sprintf("%s:%v", LocalIP, s.port), s.zoneName); err != nil {
-				log.LogErrorf("action[registerToMaster] cannot register this node to master[%v] err(%v).",
-					masterAddr, err)
+			if nodeID, err = MasterClient.NodeAPI().AddDataNode(fmt.Sprintf("%s:%v", LocalIP, s.port), s.zoneName,
+				s.instanceID, s.isSpare); err != nil {
+				// the data directories cloned from another data node never pass the registration
+				if err == proto.ErrDuplicateNodeInstance {
+					log.LogErrorf("action[registerToMaster] instance(%v) is registered with another address, "+
+						"clean the disks before starting this node, err(%v).", s.instanceID, err)
+					return
+				}
+				log.LogErrorf("action[registerToMaster] cannot register this node to master[%v] err(%v), "+
+					"check the clock and the address of this node if it is refused.", masterAddr, err)
 				timer.Reset(2 * time.Second)
 				continue
 			}
 			exporter.RegistConsul(s.clusterID, ModuleName, cfg)
 			s.nodeID = nodeID
-			log.LogDebugf("register: register DataNode: nodeID(%v)", s.nodeID)
-			return
+			log.LogDebugf("register: register DataNode: nodeID(%v) instance(%v)", s.nodeID, s.instanceID)
+			return nil
 		case <-s.stopC:
 			timer.Stop()
-			return
+			return nil
 		}
 	}
 }
@@ -351,9 +440,20 @@ func (s *DataNode) registerHandler() {
 	http.HandleFunc("/partition", s.getPartitionAPI)
 	http.HandleFunc("/extent", s.getExtentAPI)
 	http.HandleFunc("/block", s.getBlockCrcAPI)
+	http.HandleFunc("/verifyExtentHeader", s.verifyExtentHeaderAPI)
+	http.HandleFunc("/rebuildExtentHeader", s.rebuildExtentHeaderAPI)
+	http.HandleFunc("/extentDeltaSync", s.syncExtentDeltaAPI)
+	http.HandleFunc("/extentCopyJobs", s.getExtentCopyJobsAPI)
 	http.HandleFunc("/stats", s.getStatAPI)
 	http.HandleFunc("/raftStatus", s.getRaftStatus)
 	http.HandleFunc("/setAutoRepairStatus", s.setAutoRepairStatus)
+	http.HandleFunc("/expiredPartitions", s.getExpiredPartitionsAPI)
+	http.HandleFunc("/validateConfig", s.validateConfigAPI)
+	http.HandleFunc("/raftTimings", s.getRaftTimings)
+	http.HandleFunc("/setRaftTimings", s.setRaftTimings)
+	http.HandleFunc("/tinyExtents", s.getTinyExtentsAPI)
+	http.HandleFunc("/setPackTinyExtents", s.setPackTinyExtents)
+	s.registerFaultInjectionAPI()
 }
 
 func (s *DataNode) startTCPService() (err error) {
@@ -395,10 +495,40 @@ func (s *DataNode) serveConn(conn net.Conn) {
 	c, _ := conn.(*net.TCPConn)
 	c.SetKeepAlive(true)
 	c.SetNoDelay(true)
-	packetProcessor := repl.NewReplProtocol(c, s.Prepare, s.OperatePacket, s.Post)
+	packetProcessor := repl.NewReplProtocol(c, s.Prepare, s.OperatePacket, s.Post, s.handleStraggler)
 	packetProcessor.ServerConn()
 }
 
+// startReplicaNetwork sends the replication and the repair traffic to the replication interfaces of the peers if this
+// node has one, and monitors the throughput of the interfaces.
+func (s *DataNode) startReplicaNetwork() {
+	if s.replicaIP != "" {
+		gReplicaResolver = replnet.NewResolver(func() ([]proto.NodeView, error) {
+			cv, err := MasterClient.AdminAPI().GetCluster()
+			if err != nil {
+				return nil, err
+			}
+			return cv.DataNodes, nil
+		})
+		repl.SetReplicaResolver(gReplicaResolver)
+	}
+	s.netMonitor = replnet.NewMonitor(ModuleName, LocalIP, s.replicaIP)
+	s.netMonitor.Start()
+}
+
+// getReplicaConnect gets the connection to the data node through its replication interface, if any.
+func getReplicaConnect(addr string) (*net.TCPConn, error) {
+	return gConnPool.GetConnect(gReplicaResolver.ReplicaAddr(addr))
+}
+
+// releaseExtentCaches closes the cached extents of all the partitions to release the file descriptors under pressure.
+func (s *DataNode) releaseExtentCaches() {
+	s.space.RangePartitions(func(dp *DataPartition) bool {
+		dp.ExtentStore().ReleaseCache()
+		return true
+	})
+}
+
 // Increase the disk error count by one.
 func (s *DataNode) incDiskErrCnt(partitionID uint64, err error, flag uint8) {
 	if err == nil {
@@ -33,15 +33,16 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 	disks := make([]interface{}, 0)
 	for _, diskItem := range s.space.GetDisks() {
 		disk := &struct {
-			Path        string `json:"path"`
-			Total       uint64 `json:"total"`
-			Used        uint64 `json:"used"`
-			Available   uint64 `json:"available"`
-			Unallocated uint64 `json:"unallocated"`
-			Allocated   uint64 `json:"allocated"`
-			Status      int    `json:"status"`
-			RestSize    uint64 `json:"restSize"`
-			Partitions  int    `json:"partitions"`
+			Path        string            `json:"path"`
+			Total       uint64            `json:"total"`
+			Used        uint64            `json:"used"`
+			Available   uint64            `json:"available"`
+			Unallocated uint64            `json:"unallocated"`
+			Allocated   uint64            `json:"allocated"`
+			Status      int               `json:"status"`
+			RestSize    uint64            `json:"restSize"`
+			Partitions  int               `json:"partitions"`
+			Mmap        *storage.MmapStat `json:"mmap,omitempty"`
 		}{
 			Path:        diskItem.Path,
 			Total:       diskItem.Total,
@@ -53,6 +54,9 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 			RestSize:    diskItem.ReservedSpace,
 			Partitions:  diskItem.PartitionCount(),
 		}
+		if diskItem.mmapCache != nil {
+			disk.Mmap = diskItem.mmapCache.Stat()
+		}
 		disks = append(disks, disk)
 	}
 	diskReport := &struct {
@@ -65,9 +69,95 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 	s.buildSuccessResp(w, diskReport)
 }
 
+// syncExtentDeltaAPI makes the extent the same as the extent on the raft leader of the source partition, which is
+// usually in another cluster, by transferring the changed regions only.
+func (s *DataNode) syncExtentDeltaAPI(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID       uint64
+		extentID          uint64
+		sourcePartitionID uint64
+		sourceExtentID    uint64
+		blockSize         = DefaultDeltaBlockSize
+		err               error
+	)
+	if err = r.ParseForm(); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if partitionID, err = strconv.ParseUint(r.FormValue("partitionID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if extentID, err = strconv.ParseUint(r.FormValue("extentID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sourceAddr := r.FormValue("sourceAddr")
+	if sourceAddr == "" {
+		s.buildFailureResp(w, http.StatusBadRequest, "sourceAddr is required")
+		return
+	}
+	if sourcePartitionID, err = strconv.ParseUint(r.FormValue("sourcePartitionID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// the extent is synced from the extent with the same ID if the source extent is not specified
+	sourceExtentID = extentID
+	if value := r.FormValue("sourceExtentID"); value != "" {
+		if sourceExtentID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if value := r.FormValue("blockSize"); value != "" {
+		if blockSize, err = strconv.Atoi(value); err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	result, err := partition.SyncExtentDelta(extentID, sourceAddr, sourcePartitionID, sourceExtentID, blockSize)
+	if err != nil {
+		s.buildFailureResp(w, 500, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// getExtentCopyJobsAPI returns the extent copy jobs run by this data node, or the job of the jobID.
+func (s *DataNode) getExtentCopyJobsAPI(w http.ResponseWriter, r *http.Request) {
+	var (
+		jobID uint64
+		err   error
+	)
+	if err = r.ParseForm(); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if value := r.FormValue("jobID"); value != "" {
+		if jobID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	jobs := s.copyJobs.list(jobID)
+	if jobID != 0 && len(jobs) == 0 {
+		s.buildFailureResp(w, http.StatusNotFound, "job not exist")
+		return
+	}
+	s.buildSuccessResp(w, jobs)
+}
+
 func (s *DataNode) getStatAPI(w http.ResponseWriter, r *http.Request) {
 	response := &proto.DataNodeHeartbeatResponse{}
-	s.buildHeartBeatResponse(response)
+	s.buildHeartBeatResponse(response, false)
+	response.Pressure = s.pressure.Stat()
+	response.Interfaces = s.netMonitor.Stat()
+	response.PriorityQueue = s.priorityQ.Stat()
 
 	s.buildSuccessResp(w, response)
 }
@@ -91,6 +181,103 @@ func (s *DataNode) setAutoRepairStatus(w http.ResponseWriter, r *http.Request) {
 	s.buildSuccessResp(w, autoRepair)
 }
 
+func (s *DataNode) getRaftTimings(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.raftStore.TimingsView())
+}
+
+// setRaftTimings changes the raft timings given without restart, which is lost on restart unless the config is
+// updated as well.
+func (s *DataNode) setRaftTimings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timings, err := s.raftStore.Timings().Override(r.FormValue)
+	if err == nil {
+		err = s.raftStore.SetTimings(timings)
+	}
+	if err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, s.raftStore.TimingsView())
+}
+
+func (s *DataNode) getTinyExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	stats, err := partition.ExtentStore().TinyExtentStats()
+	if err != nil {
+		err = fmt.Errorf("get tiny extents fail: %v", err)
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := &struct {
+		ID              uint64                    `json:"id"`
+		PackTinyExtents bool                      `json:"packTinyExtents"`
+		Extents         []*storage.TinyExtentStat `json:"extents"`
+	}{
+		ID:              partitionID,
+		PackTinyExtents: partition.ExtentStore().PackTinyExtents(),
+		Extents:         stats,
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// setPackTinyExtents sets the format the tiny extents of the partition are converted to in the background.
+func (s *DataNode) setPackTinyExtents(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramPacked      = "packed"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	packed, err := strconv.ParseBool(r.FormValue(paramPacked))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPacked, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if err = partition.SetPackTinyExtents(packed); err != nil {
+		err = fmt.Errorf("persist partition fail: %v", err)
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, packed)
+}
+
 func (s *DataNode) getRaftStatus(w http.ResponseWriter, r *http.Request) {
 	const (
 		paramRaftID = "raftID"
@@ -106,6 +293,11 @@ func (s *DataNode) getRaftStatus(w http.ResponseWriter, r *http.Request) {
 		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	// the raft group of a data partition is identified by the partition ID
+	if dp := s.space.Partition(raftID); dp != nil && dp.raftPartition != nil {
+		s.buildSuccessResp(w, dp.raftPartition.RaftView())
+		return
+	}
 	raftStatus := s.raftStore.RaftStatus(raftID)
 	s.buildSuccessResp(w, raftStatus)
 }
@@ -171,6 +363,9 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	extentLayout, flatExtents := partition.ExtentStore().ExtentLayout()
+	reconciledUsed, reconcileTime := partition.ExtentStore().ReconciledUsedSize()
+	extentMetaStatus, extentMetaError := partition.ExtentStore().ExtentMetaStatus()
 	result := &struct {
 		VolName              string                `json:"volName"`
 		ID                   uint64                `json:"id"`
@@ -183,6 +378,14 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		Replicas             []string              `json:"replicas"`
 		TinyDeleteRecordSize int64                 `json:"tinyDeleteRecordSize"`
 		RaftStatus           *raft.Status          `json:"raftStatus"`
+		IsFrozen             bool                  `json:"isFrozen"`
+		IsDegraded           bool                  `json:"isDegraded"`
+		ExtentLayout         int32                 `json:"extentLayout"`
+		FlatExtents          int                   `json:"flatExtents"` // the normal extents to be moved into the buckets
+		ReconciledUsed       int64                 `json:"reconciledUsed"`
+		ReconcileTime        int64                 `json:"reconcileTime"`
+		ExtentMetaStatus     int                   `json:"extentMetaStatus"`
+		ExtentMetaError      string                `json:"extentMetaError"`
 	}{
 		VolName:              partition.volumeID,
 		ID:                   partition.partitionID,
@@ -195,6 +398,14 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		Replicas:             partition.Replicas(),
 		TinyDeleteRecordSize: tinyDeleteRecordSize,
 		RaftStatus:           partition.raftPartition.Status(),
+		IsFrozen:             partition.IsFrozen(),
+		IsDegraded:           partition.IsDegraded(),
+		ExtentLayout:         extentLayout,
+		FlatExtents:          flatExtents,
+		ReconciledUsed:       reconciledUsed,
+		ReconcileTime:        reconcileTime,
+		ExtentMetaStatus:     extentMetaStatus,
+		ExtentMetaError:      extentMetaError,
 	}
 	s.buildSuccessResp(w, result)
 }
@@ -265,6 +476,85 @@ func (s *DataNode) getBlockCrcAPI(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func (s *DataNode) verifyExtentHeaderAPI(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		extentID    uint64
+		err         error
+		results     []*storage.ExtentVerifyResult
+	)
+	if err = r.ParseForm(); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if partitionID, err = strconv.ParseUint(r.FormValue("partitionID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	// all the normal extents are verified if the extent is not specified
+	if r.FormValue("extentID") == "" {
+		if results, err = partition.ExtentStore().VerifyAllExtentHeaders(); err != nil {
+			s.buildFailureResp(w, 500, err.Error())
+			return
+		}
+		s.buildSuccessResp(w, results)
+		return
+	}
+	if extentID, err = strconv.ParseUint(r.FormValue("extentID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result, err := partition.ExtentStore().VerifyExtentHeader(extentID)
+	if err != nil {
+		s.buildFailureResp(w, 500, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, result)
+}
+
+func (s *DataNode) rebuildExtentHeaderAPI(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		extentID    uint64
+		force       bool
+		err         error
+	)
+	if err = r.ParseForm(); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if partitionID, err = strconv.ParseUint(r.FormValue("partitionID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if extentID, err = strconv.ParseUint(r.FormValue("extentID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if value := r.FormValue("force"); value != "" {
+		if force, err = strconv.ParseBool(value); err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	result, err := partition.ExtentStore().RebuildExtentHeader(extentID, force)
+	if err != nil {
+		s.buildFailureResp(w, 500, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, result)
+}
+
 func (s *DataNode) buildSuccessResp(w http.ResponseWriter, data interface{}) {
 	s.buildJSONResp(w, http.StatusOK, data, "")
 }
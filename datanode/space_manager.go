@@ -247,6 +247,22 @@ func (manager *SpaceManager) minPartitionCnt() (d *Disk) {
 	d = minWeightDisk
 	return d
 }
+
+// preferredDisk returns the disk preferred by the master for a new partition, or nil if it is unusable.
+func (manager *SpaceManager) preferredDisk(path string) (d *Disk) {
+	if path == "" {
+		return
+	}
+	manager.diskMutex.Lock()
+	defer manager.diskMutex.Unlock()
+	disk, ok := manager.disks[path]
+	if !ok || disk.Available <= 5*util.GB || disk.Status != proto.ReadWrite {
+		log.LogWarnf("action[preferredDisk] disk(%v) preferred by the master is unusable", path)
+		return
+	}
+	return disk
+}
+
 func (manager *SpaceManager) statUpdateScheduler() {
 	go func() {
 		ticker := time.NewTicker(10 * time.Second)
@@ -303,7 +319,10 @@ func (manager *SpaceManager) CreatePartition(request *proto.CreateDataPartitionR
 		}
 		return
 	}
-	disk := manager.minPartitionCnt()
+	disk := manager.preferredDisk(request.DiskPath)
+	if disk == nil {
+		disk = manager.minPartitionCnt()
+	}
 	if disk == nil {
 		return nil, ErrNoSpaceToCreatePartition
 	}
@@ -329,7 +348,9 @@ func (manager *SpaceManager) DeletePartition(dpID uint64) {
 	os.RemoveAll(dp.Path())
 }
 
-func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatResponse) {
+// buildHeartBeatResponse builds the heartbeat, whose partition reports are split into the cohorts reported across the
+// consecutive heartbeats if sharded, otherwise all the partitions are reported.
+func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatResponse, sharded bool) {
 	response.Status = proto.TaskSucceeds
 	stat := s.space.Stats()
 	stat.Lock()
@@ -344,20 +365,40 @@ func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatRespo
 	stat.Unlock()
 
 	response.ZoneName = s.zoneName
+	response.ReplicaIP = s.replicaIP
+	response.Rack = s.rack
+	response.BuildInfo = proto.GetBuildInfo()
 	response.PartitionReports = make([]*proto.PartitionReport, 0)
+	if sharded {
+		s.reporter.Lock()
+		defer s.reporter.Unlock()
+		response.ReportCohort, response.ReportCohorts = s.reporter.begin(int(response.CreatedPartitionCnt))
+		defer s.reporter.end()
+	}
 	space := s.space
 	space.RangePartitions(func(partition *DataPartition) bool {
 		leaderAddr, isLeader := partition.IsRaftLeader()
+		status := partition.Status()
+		if sharded && !s.reporter.shouldReport(partition.partitionID, status, isLeader, partition.IsFrozen(), partition.IsDegraded()) {
+			return true
+		}
+		writeSizes, readSizes := partition.IOSizes()
 		vr := &proto.PartitionReport{
-			VolName:         partition.volumeID,
-			PartitionID:     uint64(partition.partitionID),
-			PartitionStatus: partition.Status(),
-			Total:           uint64(partition.Size()),
-			Used:            uint64(partition.Used()),
-			DiskPath:        partition.Disk().Path,
-			IsLeader:        isLeader,
-			ExtentCount:     partition.GetExtentCount(),
-			NeedCompare:     true,
+			VolName:              partition.volumeID,
+			PartitionID:          uint64(partition.partitionID),
+			PartitionStatus:      status,
+			Total:                uint64(partition.Size()),
+			Used:                 uint64(partition.Used()),
+			DiskPath:             partition.Disk().Path,
+			IsLeader:             isLeader,
+			ExtentCount:          partition.GetExtentCount(),
+			NeedCompare:          true,
+			IsFrozen:             partition.IsFrozen(),
+			IsDegraded:           partition.IsDegraded(),
+			AvailableTinyExtents: partition.ExtentStore().AvailableTinyExtentCnt(),
+			BrokenTinyExtents:    partition.ExtentStore().BrokenTinyExtentCnt(),
+			WriteSizes:           writeSizes,
+			ReadSizes:            readSizes,
 		}
 		log.LogDebugf("action[Heartbeats] dpid(%v), status(%v) total(%v) used(%v) leader(%v) isLeader(%v).", vr.PartitionID, vr.PartitionStatus, vr.Total, vr.Used, leaderAddr, vr.IsLeader)
 		response.PartitionReports = append(response.PartitionReports, vr)
@@ -365,9 +406,21 @@ func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatRespo
 	})
 
 	disks := space.GetDisks()
+	response.Disks = make([]*proto.DiskReport, 0, len(disks))
 	for _, d := range disks {
 		if d.Status == proto.Unavailable {
 			response.BadDisks = append(response.BadDisks, d.Path)
 		}
+		d.RLock()
+		report := &proto.DiskReport{
+			Path:      d.Path,
+			Total:     d.Total,
+			Used:      d.Used,
+			Available: d.Available,
+			Status:    d.Status,
+		}
+		d.RUnlock()
+		report.Partitions = d.PartitionCount()
+		response.Disks = append(response.Disks, report)
 	}
 }
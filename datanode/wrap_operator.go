@@ -16,6 +16,8 @@ package datanode
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -48,12 +50,12 @@ func (s *DataNode) OperatePacket(p *repl.Packet, c *net.TCPConn) (err error) {
 			err = fmt.Errorf("op(%v) error(%v)", p.GetOpMsg(), string(p.Data[:resultSize]))
 			logContent := fmt.Sprintf("action[OperatePacket] %v.",
 				p.LogMessage(p.GetOpMsg(), c.RemoteAddr().String(), start, err))
-			log.LogErrorf(logContent)
+			log.LogErrorfLimited("%v", logContent)
 		} else {
 			logContent := fmt.Sprintf("action[OperatePacket] %v.",
 				p.LogMessage(p.GetOpMsg(), c.RemoteAddr().String(), start, nil))
 			switch p.Opcode {
-			case proto.OpStreamRead, proto.OpRead, proto.OpExtentRepairRead, proto.OpStreamFollowerRead:
+			case proto.OpStreamRead, proto.OpRead, proto.OpExtentRepairRead, proto.OpStreamFollowerRead, proto.OpStreamVectorRead:
 			case proto.OpReadTinyDeleteRecord:
 				log.LogRead(logContent)
 			case proto.OpWrite, proto.OpRandomWrite, proto.OpSyncRandomWrite, proto.OpSyncWrite, proto.OpMarkDelete:
@@ -65,6 +67,9 @@ func (s *DataNode) OperatePacket(p *repl.Packet, c *net.TCPConn) (err error) {
 		p.Size = resultSize
 		tpObject.Set(err)
 	}()
+	if isPriorityQueued(p.Opcode) {
+		defer s.priorityQ.Acquire(p.Priority)()
+	}
 	switch p.Opcode {
 	case proto.OpCreateExtent:
 		s.handlePacketToCreateExtent(p)
@@ -74,6 +79,8 @@ func (s *DataNode) OperatePacket(p *repl.Packet, c *net.TCPConn) (err error) {
 		s.handleStreamReadPacket(p, c, StreamRead)
 	case proto.OpStreamFollowerRead:
 		s.extentRepairReadPacket(p, c, StreamRead)
+	case proto.OpStreamVectorRead:
+		s.handleStreamVectorReadPacket(p, c)
 	case proto.OpExtentRepairRead:
 		s.handleExtentRepairReadPacket(p, c, RepairRead)
 	case proto.OpTinyExtentRepairRead:
@@ -106,6 +113,18 @@ func (s *DataNode) OperatePacket(p *repl.Packet, c *net.TCPConn) (err error) {
 		s.handlePacketToRemoveDataPartitionRaftMember(p)
 	case proto.OpDataPartitionTryToLeader:
 		s.handlePacketToDataPartitionTryToLeaderrr(p)
+	case proto.OpFreezeDataPartition:
+		s.handlePacketToFreezeDataPartition(p)
+	case proto.OpDegradeDataPartition:
+		s.handlePacketToDegradeDataPartition(p)
+	case proto.OpCopyExtent:
+		s.handlePacketToCopyExtent(p)
+	case proto.OpRepairDataBlock:
+		s.handlePacketToRepairDataBlock(p)
+	case proto.OpOrphanExtents:
+		s.handlePacketToOrphanExtents(p)
+	case proto.OpResizeDataPartition:
+		s.handlePacketToResizeDataPartition(p)
 	case proto.OpGetPartitionSize:
 		s.handlePacketToGetPartitionSize(p)
 	case proto.OpGetMaxExtentIDAndPartitionSize:
@@ -114,6 +133,12 @@ func (s *DataNode) OperatePacket(p *repl.Packet, c *net.TCPConn) (err error) {
 		s.handlePacketToReadTinyDeleteRecordFile(p, c)
 	case proto.OpBroadcastMinAppliedID:
 		s.handleBroadcastMinAppliedID(p)
+	case proto.OpExtentHash:
+		s.handleExtentHashPacket(p, c)
+	case proto.OpVerifyExtent:
+		s.handleVerifyExtentPacket(p)
+	case proto.OpExtentDelta:
+		s.handleExtentDeltaPacket(p, c)
 	default:
 		p.PackErrorBody(repl.ErrorUnknownOp.Error(), repl.ErrorUnknownOp.Error()+strconv.Itoa(int(p.Opcode)))
 	}
@@ -139,7 +164,17 @@ func (s *DataNode) handlePacketToCreateExtent(p *repl.Packet) {
 		err = storage.BrokenDiskError
 		return
 	}
-	err = partition.ExtentStore().Create(p.ExtentID)
+	if err = partition.ExtentStore().Create(p.ExtentID); err != nil {
+		return
+	}
+	// the older clients send no inode
+	if len(p.Data) >= 8 {
+		inode := binary.BigEndian.Uint64(p.Data[0:8])
+		if bindErr := partition.ExtentStore().BindExtentInode(p.ExtentID, inode); bindErr != nil {
+			log.LogWarnf("action[handlePacketToCreateExtent] partition(%v) extent(%v) inode(%v) err(%v)",
+				partition.partitionID, p.ExtentID, inode, bindErr)
+		}
+	}
 
 	return
 }
@@ -206,11 +241,13 @@ func (s *DataNode) handleHeartbeatPacket(p *repl.Packet) {
 	go func() {
 		request := &proto.HeartBeatRequest{}
 		response := &proto.DataNodeHeartbeatResponse{}
-		s.buildHeartBeatResponse(response)
+		s.buildHeartBeatResponse(response, true)
 
 		if task.OpCode == proto.OpDataNodeHeartbeat {
 			marshaled, _ := json.Marshal(task.Request)
 			_ = json.Unmarshal(marshaled, request)
+			s.setQuorumWrite(request.EnableQuorumWrite)
+			s.setTokenRequiredVols(request.TokenRequiredVols)
 			response.Status = proto.TaskSucceeds
 		} else {
 			response.Status = proto.TaskFailed
@@ -248,6 +285,9 @@ func (s *DataNode) handlePacketToDeleteDataPartition(p *repl.Packet) {
 		err = json.Unmarshal(bytes, request)
 		if err != nil {
 			return
+		}
+		if dp := s.space.Partition(request.PartitionId); dp != nil && dp.IsFrozen() {
+			err = proto.ErrDataPartitionFrozen
 		} else {
 			s.space.DeletePartition(request.PartitionId)
 		}
@@ -262,6 +302,138 @@ func (s *DataNode) handlePacketToDeleteDataPartition(p *repl.Packet) {
 
 }
 
+// Handle OpFreezeDataPartition packet.
+func (s *DataNode) handlePacketToFreezeDataPartition(p *repl.Packet) {
+	var (
+		err     error
+		reqData []byte
+		task    = &proto.AdminTask{}
+		request = &proto.FreezeDataPartitionRequest{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionFreezeDataPartition, err.Error())
+		} else {
+			p.PacketOkReply()
+		}
+	}()
+	if err = json.Unmarshal(p.Data, task); err != nil {
+		return
+	}
+	if reqData, err = json.Marshal(task.Request); err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, request); err != nil {
+		return
+	}
+	p.AddMesgLog(string(reqData))
+	dp := s.space.Partition(request.PartitionId)
+	if dp == nil {
+		err = proto.ErrDataPartitionNotExists
+		return
+	}
+	err = dp.SetFrozen(request.IsFrozen)
+}
+
+// Handle OpDegradeDataPartition packet.
+func (s *DataNode) handlePacketToDegradeDataPartition(p *repl.Packet) {
+	var (
+		err     error
+		reqData []byte
+		task    = &proto.AdminTask{}
+		request = &proto.DegradeDataPartitionRequest{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionDegradeDataPartition, err.Error())
+		} else {
+			p.PacketOkReply()
+		}
+	}()
+	if err = json.Unmarshal(p.Data, task); err != nil {
+		return
+	}
+	if reqData, err = json.Marshal(task.Request); err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, request); err != nil {
+		return
+	}
+	p.AddMesgLog(string(reqData))
+	dp := s.space.Partition(request.PartitionId)
+	if dp == nil {
+		err = proto.ErrDataPartitionNotExists
+		return
+	}
+	err = dp.SetDegraded(request.IsDegraded)
+}
+
+// Handle OpResizeDataPartition packet.
+func (s *DataNode) handlePacketToResizeDataPartition(p *repl.Packet) {
+	var (
+		err     error
+		reqData []byte
+		task    = &proto.AdminTask{}
+		request = &proto.ResizeDataPartitionRequest{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionResizeDataPartition, err.Error())
+		} else {
+			p.PacketOkReply()
+		}
+	}()
+	if err = json.Unmarshal(p.Data, task); err != nil {
+		return
+	}
+	if reqData, err = json.Marshal(task.Request); err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, request); err != nil {
+		return
+	}
+	p.AddMesgLog(string(reqData))
+	dp := s.space.Partition(request.PartitionId)
+	if dp == nil {
+		err = proto.ErrDataPartitionNotExists
+		return
+	}
+	err = dp.Resize(request.PartitionSize)
+}
+
+// Handle OpRepairDataBlock packet.
+func (s *DataNode) handlePacketToRepairDataBlock(p *repl.Packet) {
+	var (
+		err     error
+		reqData []byte
+		task    = &proto.AdminTask{}
+		request = &proto.RepairDataBlockRequest{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionRepairDataBlock, err.Error())
+		} else {
+			p.PacketOkReply()
+		}
+	}()
+	if err = json.Unmarshal(p.Data, task); err != nil {
+		return
+	}
+	if reqData, err = json.Marshal(task.Request); err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, request); err != nil {
+		return
+	}
+	p.AddMesgLog(string(reqData))
+	dp := s.space.Partition(request.PartitionId)
+	if dp == nil {
+		err = proto.ErrDataPartitionNotExists
+		return
+	}
+	err = dp.repairExtentBlocks(request.ExtentId, request.Offset, request.Size, request.SourceAddr)
+}
+
 // Handle OpLoadDataPartition packet.
 func (s *DataNode) handlePacketToLoadDataPartition(p *repl.Packet) {
 	task := &proto.AdminTask{}
@@ -389,6 +561,9 @@ func (s *DataNode) handleWritePacket(p *repl.Packet) {
 		err = storage.BrokenDiskError
 		return
 	}
+	if p.IsLeaderPacket() {
+		partition.countWrite(p.Size)
+	}
 	store := partition.ExtentStore()
 	if p.ExtentType == proto.TinyExtentType {
 		err = store.Write(p.ExtentID, p.ExtentOffset, int64(p.Size), p.Data, p.CRC, storage.AppendWriteType, p.IsSyncWrite())
@@ -396,6 +571,11 @@ func (s *DataNode) handleWritePacket(p *repl.Packet) {
 		return
 	}
 
+	if s.isQuorumWrite() {
+		if err = partition.checkAppendOffset(p.ExtentID, p.ExtentOffset); err != nil {
+			return
+		}
+	}
 	if p.Size <= util.BlockSize {
 		err = store.Write(p.ExtentID, p.ExtentOffset, int64(p.Size), p.Data, p.CRC, storage.AppendWriteType, p.IsSyncWrite())
 		partition.checkIsDiskError(err)
@@ -437,6 +617,7 @@ func (s *DataNode) handleRandomWritePacket(p *repl.Packet) {
 		err = raft.ErrNotLeader
 		return
 	}
+	partition.countWrite(p.Size)
 	err = partition.RandomWriteSubmit(p)
 	if err != nil && strings.Contains(err.Error(), raft.ErrNotLeader.Error()) {
 		err = raft.ErrNotLeader
@@ -461,7 +642,7 @@ func (s *DataNode) handleStreamReadPacket(p *repl.Packet, connect net.Conn, isRe
 		}
 	}()
 	partition := p.Object.(*DataPartition)
-	if err = partition.CheckLeader(p, connect); err != nil {
+	if err = partition.CheckReadLeader(p, connect); err != nil {
 		return
 	}
 	s.extentRepairReadPacket(p, connect, isRepairRead)
@@ -489,6 +670,33 @@ func (s *DataNode) handleExtentRepairReadPacket(p *repl.Packet, connect net.Conn
 	s.extentRepairReadPacket(p, connect, isRepairRead)
 }
 
+// Handle OpStreamVectorRead packet. The ranges are served in the order of the request on the same connection.
+func (s *DataNode) handleStreamVectorReadPacket(p *repl.Packet, connect net.Conn) {
+	var (
+		err    error
+		ranges []proto.ReadRange
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionStreamRead, err.Error())
+			p.WriteToConn(connect)
+		}
+	}()
+	partition := p.Object.(*DataPartition)
+	if err = partition.CheckReadLeader(p, connect); err != nil {
+		return
+	}
+	if ranges, err = proto.UnmarshalReadRanges(p.Data); err != nil {
+		return
+	}
+	for _, r := range ranges {
+		if err = s.readExtentRange(p, connect, r.Offset, r.Size, StreamRead); err != nil {
+			return
+		}
+	}
+	p.PacketOkReply()
+}
+
 func (s *DataNode) handleTinyExtentRepairReadPacket(p *repl.Packet, connect net.Conn) {
 	s.tinyExtentRepairRead(p, connect)
 }
@@ -503,11 +711,30 @@ func (s *DataNode) extentRepairReadPacket(p *repl.Packet, connect net.Conn, isRe
 			p.WriteToConn(connect)
 		}
 	}()
+	if err = s.readExtentRange(p, connect, p.ExtentOffset, p.Size, isRepairRead); err != nil {
+		return
+	}
+	p.PacketOkReply()
+
+	return
+}
+
+// readExtentRange reads the range of the extent and writes the data to the connection
+// with the reply packets of at most util.ReadBlockSize each.
+func (s *DataNode) readExtentRange(p *repl.Packet, connect net.Conn, offset int64, needReplySize uint32, isRepairRead bool) (err error) {
 	partition := p.Object.(*DataPartition)
-	needReplySize := p.Size
-	offset := p.ExtentOffset
 	store := partition.ExtentStore()
+	if !isRepairRead {
+		partition.countRead(needReplySize)
+	}
 
+	if p.ExtentType == proto.VerifiedReadExtentType && storage.IsTinyExtent(p.ExtentID) {
+		if err = store.CheckTinyExtentData(p.ExtentID, offset, int64(needReplySize)); err != nil {
+			return
+		}
+	}
+	// the replies of a degraded partition without the leader are flagged, since the data may be stale
+	isDegradedRead := !isRepairRead && partition.servesDegradedRead()
 	for {
 		if needReplySize <= 0 {
 			break
@@ -515,6 +742,9 @@ func (s *DataNode) extentRepairReadPacket(p *repl.Packet, connect net.Conn, isRe
 		err = nil
 		reply := repl.NewStreamReadResponsePacket(p.ReqID, p.PartitionID, p.ExtentID)
 		reply.StartT = p.StartT
+		if isDegradedRead {
+			reply.ExtentType |= proto.DegradedReplyFlag
+		}
 		currReadSize := uint32(util.Min(int(needReplySize), util.ReadBlockSize))
 		if currReadSize == util.ReadBlockSize {
 			reply.Data, _ = proto.Buffers.Get(util.ReadBlockSize)
@@ -527,6 +757,9 @@ func (s *DataNode) extentRepairReadPacket(p *repl.Packet, connect net.Conn, isRe
 		p.ExtentOffset = offset
 		reply.CRC, err = store.Read(reply.ExtentID, offset, int64(currReadSize), reply.Data, isRepairRead)
 		partition.checkIsDiskError(err)
+		if err != nil && proto.IsResultCode(err, proto.OpCrcMismatchErr) {
+			exporter.Warning(fmt.Sprintf("partition(%v) on %v: %v", p.PartitionID, LocalIP, err))
+		}
 		tpObject.Set(err)
 		p.CRC = reply.CRC
 		if err != nil {
@@ -548,8 +781,6 @@ func (s *DataNode) extentRepairReadPacket(p *repl.Packet, connect net.Conn, isRe
 			reply.LogMessage(reply.GetOpMsg(), connect.RemoteAddr().String(), reply.StartT, err))
 		log.LogReadf(logContent)
 	}
-	p.PacketOkReply()
-
 	return
 }
 
@@ -801,6 +1032,95 @@ func (s *DataNode) handlePacketToGetMaxExtentIDAndPartitionSize(p *repl.Packet)
 	return
 }
 
+// Handle OpExtentHash packet, which resumes the hash state of the request with the range of the extent. The checksum
+// of a file is computed extent by extent in this way, without moving the data out of the data nodes.
+func (s *DataNode) handleExtentHashPacket(p *repl.Packet, connect net.Conn) {
+	var (
+		err   error
+		state []byte
+		req   = &proto.ExtentHashRequest{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionExtentHash, err.Error())
+		} else {
+			p.PacketOkWithBody(state)
+		}
+	}()
+	partition := p.Object.(*DataPartition)
+	if err = partition.CheckLeader(p, connect); err != nil {
+		return
+	}
+	if err = json.Unmarshal(p.Data[:p.Size], req); err != nil {
+		return
+	}
+	if req.Algorithm != proto.ChecksumAlgorithmSHA256 {
+		err = fmt.Errorf("unsupported checksum algorithm %v", req.Algorithm)
+		return
+	}
+	h := sha256.New()
+	if err = h.(encoding.BinaryUnmarshaler).UnmarshalBinary(req.State); err != nil {
+		return
+	}
+	store := partition.ExtentStore()
+	data, _ := proto.Buffers.Get(util.ReadBlockSize)
+	defer proto.Buffers.Put(data)
+	offset, end := int64(req.Offset), int64(req.Offset)+int64(req.Size)
+	for offset < end {
+		size := int64(util.Min(int(end-offset), util.ReadBlockSize))
+		if _, err = store.Read(p.ExtentID, offset, size, data[:size], false); err != nil {
+			return
+		}
+		h.Write(data[:size])
+		offset += size
+	}
+	state, err = h.(encoding.BinaryMarshaler).MarshalBinary()
+	p.AddMesgLog(fmt.Sprintf("hashed_(%v)", req.Size))
+}
+
+// Handle OpVerifyExtent packet, which is answered by every replica so that the client can compare them.
+func (s *DataNode) handleVerifyExtentPacket(p *repl.Packet) {
+	var (
+		err  error
+		data []byte
+		req  = &proto.ExtentVerifyRequest{}
+		resp = &proto.ExtentVerifyResponse{}
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionVerifyExtent, err.Error())
+		} else {
+			p.PacketOkWithBody(data)
+		}
+	}()
+	if err = json.Unmarshal(p.Data[:p.Size], req); err != nil {
+		return
+	}
+	store := p.Object.(*DataPartition).ExtentStore()
+	if resp.Exists = store.HasExtent(p.ExtentID); resp.Exists {
+		var ei *storage.ExtentInfo
+		if ei, err = store.Watermark(p.ExtentID); err != nil {
+			return
+		}
+		resp.ExtentSize, resp.Deleted = ei.Size, ei.IsDeleted
+		resp.Complete = !ei.IsDeleted && req.Offset+uint64(req.Size) <= ei.Size
+	}
+	if resp.Complete {
+		buf, _ := proto.Buffers.Get(util.ReadBlockSize)
+		defer proto.Buffers.Put(buf)
+		offset, end := int64(req.Offset), int64(req.Offset)+int64(req.Size)
+		for offset < end {
+			size := int64(util.Min(int(end-offset), util.ReadBlockSize))
+			if _, err = store.Read(p.ExtentID, offset, size, buf[:size], true); err != nil {
+				return
+			}
+			resp.Crc = crc32.Update(resp.Crc, crc32.IEEETable, buf[:size])
+			offset += size
+		}
+	}
+	data, err = json.Marshal(resp)
+}
+
 func (s *DataNode) handlePacketToDecommissionDataPartition(p *repl.Packet) {
 	var (
 		err          error
@@ -1020,7 +1340,7 @@ func (s *DataNode) forwardToRaftLeader(dp *DataPartition, p *repl.Packet) (ok bo
 	}
 
 	// forward the packet to the leader if local one is not the leader
-	conn, err = gConnPool.GetConnect(leaderAddr)
+	conn, err = getReplicaConnect(leaderAddr)
 	if err != nil {
 		return
 	}
@@ -1035,3 +1355,14 @@ func (s *DataNode) forwardToRaftLeader(dp *DataPartition, p *repl.Packet) (ok bo
 
 	return
 }
+
+// isPriorityQueued returns whether the packets of the opcode are the reads and the writes of the clients, which are
+// queued by their priority classes. The repairs and the admin tasks are not queued.
+func isPriorityQueued(opcode uint8) bool {
+	switch opcode {
+	case proto.OpWrite, proto.OpSyncWrite, proto.OpRandomWrite, proto.OpSyncRandomWrite, proto.OpStreamRead,
+		proto.OpStreamFollowerRead, proto.OpStreamVectorRead, proto.OpRead:
+		return true
+	}
+	return false
+}
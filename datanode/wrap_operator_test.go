@@ -0,0 +1,256 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// newReadTestPartition creates a degraded partition without the raft, which serves the reads without the
+// leader, with an extent of two blocks.
+func newReadTestPartition(t *testing.T, dataDir string) (dp *DataPartition, extentID uint64, content []byte) {
+	store, err := storage.NewExtentStore(dataDir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp = &DataPartition{partitionID: 1, extentStore: store, isDegraded: true}
+	extentID, _ = store.NextExtentID()
+	if err = store.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	content = make([]byte, 2*util.BlockSize)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	for offset := 0; offset < len(content); offset += util.BlockSize {
+		data := content[offset : offset+util.BlockSize]
+		if err = store.Write(extentID, int64(offset), int64(len(data)), data, crc32.ChecksumIEEE(data),
+			storage.AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+// serveVectorRead serves a single request on the connection like the datanode does, and returns the request with
+// the result.
+func serveVectorRead(s *DataNode, dp *DataPartition, conn net.Conn, done chan<- *repl.Packet) {
+	defer conn.Close()
+	p := repl.NewPacket()
+	if err := p.ReadFromConnFromCli(conn, proto.NoReadDeadlineTime); err != nil {
+		done <- nil
+		return
+	}
+	p.Object = dp
+	s.handleStreamVectorReadPacket(p, conn)
+	done <- p
+}
+
+func sendVectorRead(t *testing.T, addr string, extentID uint64, data []byte) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := proto.NewPacket()
+	req.Opcode = proto.OpStreamVectorRead
+	req.PartitionID = 1
+	req.ExtentID = extentID
+	req.ReqID = proto.GenerateRequestID()
+	req.Data = data
+	req.Size = uint32(len(data))
+	if err = req.WriteToConn(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestStreamVectorRead(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "vector_read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	dp, extentID, content := newReadTestPartition(t, dataDir)
+	defer dp.extentStore.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the ranges are out of order, and the second one spans the reply packets
+	ranges := []proto.ReadRange{
+		{Offset: util.BlockSize + 100, Size: 10},
+		{Offset: util.BlockSize - 10, Size: util.ReadBlockSize + 5},
+		{Offset: 0, Size: 1},
+	}
+	done := make(chan *repl.Packet, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- nil
+			return
+		}
+		serveVectorRead(&DataNode{}, dp, conn, done)
+	}()
+	conn := sendVectorRead(t, ln.Addr().String(), extentID, proto.MarshalReadRanges(ranges))
+	defer conn.Close()
+
+	for _, r := range ranges {
+		read := 0
+		for read < int(r.Size) {
+			reply := proto.NewPacket()
+			if err = reply.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+				t.Fatalf("read the reply of range %v: %v", r, err)
+			}
+			if reply.ResultCode != proto.OpOk || reply.Opcode != proto.OpStreamVectorRead || reply.ExtentID != extentID {
+				t.Fatalf("unexpected reply %v of range %v: %s", reply, r, reply.Data)
+			}
+			if reply.ExtentOffset != r.Offset+int64(read) || reply.Size > util.ReadBlockSize {
+				t.Fatalf("expect the reply of offset %v, but is %v of size %v", r.Offset+int64(read),
+					reply.ExtentOffset, reply.Size)
+			}
+			if reply.ExtentType&proto.DegradedReplyFlag == 0 {
+				t.Fatalf("the reply of the degraded partition without the leader should be flagged")
+			}
+			if !bytes.Equal(reply.Data[:reply.Size], content[reply.ExtentOffset:reply.ExtentOffset+int64(reply.Size)]) {
+				t.Fatalf("unexpected data at offset %v", reply.ExtentOffset)
+			}
+			read += int(reply.Size)
+		}
+		if read != int(r.Size) {
+			t.Fatalf("expect %v bytes of range %v, but is %v", r.Size, r, read)
+		}
+	}
+	if p := <-done; p == nil || p.ResultCode != proto.OpOk {
+		t.Fatalf("the vectored read should succeed, request %v", p)
+	}
+	// the final reply of the request is not sent for the reads
+	if n, _ := conn.Read(make([]byte, 1)); n != 0 {
+		t.Fatalf("unexpected reply after the ranges")
+	}
+}
+
+func TestStreamVectorReadBadRanges(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "vector_read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	dp, extentID, _ := newReadTestPartition(t, dataDir)
+	defer dp.extentStore.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	tooMany := make([]proto.ReadRange, proto.MaxReadRanges+1)
+	for i := range tooMany {
+		tooMany[i] = proto.ReadRange{Offset: int64(i), Size: 1}
+	}
+	for _, data := range [][]byte{
+		proto.MarshalReadRanges(nil),
+		proto.MarshalReadRanges([]proto.ReadRange{{Offset: 0, Size: 0}}),
+		proto.MarshalReadRanges([]proto.ReadRange{{Offset: -1, Size: 1}}),
+		proto.MarshalReadRanges([]proto.ReadRange{{Offset: 0, Size: 1}})[:proto.ReadRangeLength-1],
+		proto.MarshalReadRanges(tooMany),
+		proto.MarshalReadRanges([]proto.ReadRange{{Offset: 0, Size: proto.MaxReadRangeSize}, {Offset: 0, Size: 1}}),
+	} {
+		done := make(chan *repl.Packet, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				done <- nil
+				return
+			}
+			serveVectorRead(&DataNode{}, dp, conn, done)
+		}()
+		conn := sendVectorRead(t, ln.Addr().String(), extentID, data)
+		reply := proto.NewPacket()
+		if err = reply.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if reply.ResultCode == proto.OpOk {
+			t.Fatalf("the bad ranges %v should be refused", data)
+		}
+		if p := <-done; p == nil || p.ResultCode == proto.OpOk {
+			t.Fatalf("the request of the bad ranges %v should fail", data)
+		}
+	}
+}
+
+func TestVerifyExtent(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "verify_extent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	dp, extentID, content := newReadTestPartition(t, dataDir)
+	defer dp.extentStore.Close()
+	s := &DataNode{}
+	verify := func(extentID uint64, data []byte) (p *repl.Packet, resp *proto.ExtentVerifyResponse) {
+		p = repl.NewPacket()
+		p.Opcode = proto.OpVerifyExtent
+		p.ExtentID = extentID
+		p.Data = data
+		p.Size = uint32(len(data))
+		p.Object = dp
+		s.handleVerifyExtentPacket(p)
+		if p.ResultCode != proto.OpOk {
+			return
+		}
+		resp = &proto.ExtentVerifyResponse{}
+		if err := json.Unmarshal(p.Data[:p.Size], resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	request := func(offset uint64, size uint32) []byte {
+		data, _ := json.Marshal(&proto.ExtentVerifyRequest{Offset: offset, Size: size})
+		return data
+	}
+
+	// the range spans the blocks, and the crc is computed over the range only
+	offset, size := uint64(util.BlockSize-100), uint32(util.BlockSize)
+	_, resp := verify(extentID, request(offset, size))
+	if resp == nil || !resp.Exists || !resp.Complete || resp.ExtentSize != uint64(len(content)) ||
+		resp.Crc != crc32.ChecksumIEEE(content[offset:offset+uint64(size)]) {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	// the replica not holding the whole range
+	if _, resp = verify(extentID, request(uint64(len(content))-10, 100)); resp == nil || !resp.Exists || resp.Complete ||
+		resp.Crc != 0 {
+		t.Fatalf("the range past the extent should not be complete, response %+v", resp)
+	}
+	if _, resp = verify(extentID+1, request(0, 100)); resp == nil || resp.Exists || resp.Complete {
+		t.Fatalf("the extent should not exist, response %+v", resp)
+	}
+	if p, _ := verify(extentID, []byte("{")); p.ResultCode == proto.OpOk {
+		t.Fatalf("the malformed request should fail")
+	}
+}
@@ -24,7 +24,7 @@ func (s *DataNode) Post(p *repl.Packet) error {
 	if p.IsMasterCommand() {
 		p.NeedReply = true
 	}
-	if p.IsReadOperation() {
+	if p.IsReadOperation() || p.IsVectorReadOperation() {
 		p.NeedReply = false
 	}
 	s.cleanupPkt(p)
@@ -35,6 +35,9 @@ func (s *DataNode) Prepare(p *repl.Packet) (err error) {
 		return
 	}
 	p.BeforeTp(s.clusterID)
+	if err = s.shedLoad(p); err != nil {
+		return
+	}
 	err = s.checkStoreMode(p)
 	if err != nil {
 		return
@@ -45,19 +48,49 @@ func (s *DataNode) Prepare(p *repl.Packet) (err error) {
 	if err = s.checkPartition(p); err != nil {
 		return
 	}
+	if err = s.checkDelegatedToken(p); err != nil {
+		return
+	}
 
 	// For certain packet, we meed to add some additional extent information.
 	if err = s.addExtentInfo(p); err != nil {
 		return
 	}
+	s.markQuorumWrite(p)
 
 	return
 }
 
+// shedLoad refuses the reads and the writes of the clients under the critical pressure. The packets forwarded by the
+// leaders and the repair reads of the peers are always served, or the replicas would fall behind.
+func (s *DataNode) shedLoad(p *repl.Packet) (err error) {
+	if !isClientReadOrWrite(p) {
+		return
+	}
+	return s.pressure.Shed()
+}
+
+// isClientReadOrWrite returns if the packet is a read or a write sent by a client. The appends are sent by the
+// clients to the leaders, which forward them to the followers.
+func isClientReadOrWrite(p *repl.Packet) bool {
+	switch p.Opcode {
+	case proto.OpStreamRead, proto.OpStreamFollowerRead, proto.OpStreamVectorRead, proto.OpRead:
+		return true
+	case proto.OpRandomWrite, proto.OpSyncRandomWrite:
+		return true
+	case proto.OpWrite, proto.OpSyncWrite:
+		return p.IsForwardPacket()
+	}
+	return false
+}
+
 func (s *DataNode) checkStoreMode(p *repl.Packet) (err error) {
 	if p.ExtentType == proto.TinyExtentType || p.ExtentType == proto.NormalExtentType {
 		return nil
 	}
+	if p.ExtentType == proto.VerifiedReadExtentType && (p.IsReadOperation() || p.IsVectorReadOperation()) {
+		return nil
+	}
 	return ErrIncorrectStoreType
 }
 
@@ -80,6 +113,11 @@ func (s *DataNode) checkPartition(p *repl.Packet) (err error) {
 		return
 	}
 	p.Object = dp
+	if dp.IsFrozen() && (p.IsWriteOperation() || p.IsRandomWrite() || p.IsCreateExtentOperation() ||
+		p.IsMarkDeleteExtentOperation() || p.IsBatchDeleteExtents()) {
+		err = proto.ErrDataPartitionFrozen
+		return
+	}
 	if p.IsWriteOperation() || p.IsCreateExtentOperation() {
 		if dp.Available() <= 0 {
 			err = storage.NoSpaceError
@@ -89,6 +127,49 @@ func (s *DataNode) checkPartition(p *repl.Packet) (err error) {
 	return
 }
 
+// checkDelegatedToken validates the delegated token attached to the packet against the volume of the partition, and
+// refuses the mutations with a read-only token. The reads and the writes of the clients without a token are refused
+// if the volume requires the tokens.
+func (s *DataNode) checkDelegatedToken(p *repl.Packet) (err error) {
+	_, token := proto.DetachDelegatedToken(p.Arg[:p.ArgLen])
+	if token == "" {
+		if isClientPacket(p) && s.isTokenRequired(p.Object.(*DataPartition).volumeID) {
+			return proto.ErrDelegatedTokenRequired
+		}
+		return
+	}
+	t, err := proto.VerifyDelegatedToken(token, []byte(s.tokenSigningKey))
+	if err != nil {
+		return
+	}
+	write := p.IsWriteOperation() || p.IsRandomWrite() || p.IsCreateExtentOperation() ||
+		p.IsMarkDeleteExtentOperation() || p.IsBatchDeleteExtents()
+	if !t.Allows(p.Object.(*DataPartition).volumeID, write) {
+		return proto.ErrDelegatedTokenInvalid
+	}
+	return
+}
+
+// isClientPacket returns if the packet is sent by a client, i.e. a read or a write, or an extent creation sent to the
+// leader.
+func isClientPacket(p *repl.Packet) bool {
+	return isClientReadOrWrite(p) || (p.IsCreateExtentOperation() && p.IsForwardPacket())
+}
+
+// setTokenRequiredVols records the vols requiring the delegated tokens, which are sent with the heartbeats.
+func (s *DataNode) setTokenRequiredVols(names []string) {
+	vols := make(map[string]bool, len(names))
+	for _, name := range names {
+		vols[name] = true
+	}
+	s.tokenRequiredVols.Store(vols)
+}
+
+func (s *DataNode) isTokenRequired(volName string) bool {
+	vols, _ := s.tokenRequiredVols.Load().(map[string]bool)
+	return vols[volName]
+}
+
 func (s *DataNode) addExtentInfo(p *repl.Packet) error {
 	partition := p.Object.(*DataPartition)
 	store := p.Object.(*DataPartition).ExtentStore()
@@ -0,0 +1,99 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/pressure"
+)
+
+func TestShedLoad(t *testing.T) {
+	// any usage of the memory or the file descriptors is critical with the tiny ratios
+	m, err := pressure.NewMonitor(ModuleName, config.LoadConfigString(`{"pressureWarnRatio": 0.000001, "pressureCriticalRatio": 0.000002}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Start()
+	defer m.Stop()
+	if !m.Critical() {
+		t.Fatalf("the pressure should be critical, stat %v", m.Stat())
+	}
+	s := &DataNode{pressure: m}
+
+	newPacket := func(opcode uint8, remainingFollowers uint8) *repl.Packet {
+		p := repl.NewPacket()
+		p.Opcode = opcode
+		p.RemainingFollowers = remainingFollowers
+		return p
+	}
+	shed := []*repl.Packet{
+		newPacket(proto.OpStreamRead, 0),
+		newPacket(proto.OpStreamFollowerRead, 0),
+		newPacket(proto.OpStreamVectorRead, 0),
+		newPacket(proto.OpRead, 0),
+		newPacket(proto.OpWrite, 2),
+		newPacket(proto.OpSyncWrite, 2),
+		newPacket(proto.OpRandomWrite, 0),
+	}
+	for _, p := range shed {
+		if err = s.Prepare(p); err == nil || p.ResultCode != proto.OpAgain {
+			t.Fatalf("the client packet %v should be replied with OpAgain, err %v", p, err)
+		}
+	}
+	if rejected := m.Stat().RejectedRequests; rejected != uint64(len(shed)) {
+		t.Fatalf("expect %v rejected requests, but is %v", len(shed), rejected)
+	}
+
+	// the heartbeats and the tasks of the master are not prepared at all
+	heartbeat := newPacket(proto.OpDataNodeHeartbeat, 0)
+	if err = s.Prepare(heartbeat); err != nil || heartbeat.ResultCode == proto.OpAgain {
+		t.Fatalf("the master command should be served, err %v", err)
+	}
+	// the packets forwarded by the leaders and the repairs of the peers
+	for _, p := range []*repl.Packet{
+		newPacket(proto.OpWrite, 0),
+		newPacket(proto.OpSyncWrite, 0),
+		newPacket(proto.OpExtentRepairRead, 0),
+		newPacket(proto.OpTinyExtentRepairRead, 0),
+		newPacket(proto.OpGetAllWatermarks, 0),
+		newPacket(proto.OpNotifyReplicasToRepair, 0),
+	} {
+		if err = s.shedLoad(p); err != nil {
+			t.Fatalf("the peer packet %v should be served, err %v", p, err)
+		}
+	}
+	if rejected := m.Stat().RejectedRequests; rejected != uint64(len(shed)) {
+		t.Fatalf("the peer packets should not be counted, rejected %v", rejected)
+	}
+}
+
+func TestShedLoadUnderNormalPressure(t *testing.T) {
+	m, err := pressure.NewMonitor(ModuleName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &DataNode{pressure: m}
+	for _, opcode := range []uint8{proto.OpStreamRead, proto.OpStreamVectorRead, proto.OpRandomWrite} {
+		p := repl.NewPacket()
+		p.Opcode = opcode
+		if err = s.shedLoad(p); err != nil {
+			t.Fatalf("the packet %v should be served, err %v", p, err)
+		}
+	}
+}
@@ -42,11 +42,21 @@ type AdminTaskManager struct {
 	clusterID  string
 	targetAddr string
 	TaskMap    map[string]*proto.AdminTask
+	sendCh     chan struct{} // wakes up the sender to send the heartbeat without waiting for the next tick
 	sync.RWMutex
 	exitCh     chan struct{}
 	connPool   *util.ConnectPool
+
+	// the tasks sent synchronously whose responses are posted back later, keyed by their nonces
+	awaitedTasks map[uint64]*proto.AdminTask
 }
 
+var (
+	errUnknownTaskResponse = errors.New("no such task is outstanding")
+	errStaleTaskResponse   = errors.New("the task has been replaced by a newer one")
+	errExpiredTaskResponse = errors.New("the task has timed out")
+)
+
 func newAdminTaskManager(targetAddr, clusterID string) (sender *AdminTaskManager) {
 
 	sender = &AdminTaskManager{
@@ -54,7 +64,10 @@ func newAdminTaskManager(targetAddr, clusterID string) (sender *AdminTaskManager
 		clusterID:  clusterID,
 		TaskMap:    make(map[string]*proto.AdminTask),
 		exitCh:     make(chan struct{}, 1),
+		sendCh:     make(chan struct{}, 1),
 		connPool:   util.NewConnectPoolWithTimeout(idleConnTimeout, connectTimeout),
+
+		awaitedTasks: make(map[uint64]*proto.AdminTask),
 	}
 	go sender.process()
 
@@ -74,6 +87,8 @@ func (sender *AdminTaskManager) process() {
 		case <-ticker.C:
 			sender.doDeleteTasks()
 			sender.doSendTasks()
+		case <-sender.sendCh:
+			sender.doSendTasks()
 		}
 	}
 }
@@ -83,6 +98,7 @@ func (sender *AdminTaskManager) doDeleteTasks() {
 	for _, t := range delTasks {
 		sender.DelTask(t)
 	}
+	sender.pruneAwaitedTasks()
 	return
 }
 
@@ -93,8 +109,7 @@ func (sender *AdminTaskManager) getToBeDeletedTasks() (delTasks []*proto.AdminTa
 
 	for _, task := range sender.TaskMap {
 		if task.CheckTaskTimeOut() {
-			log.LogWarnf(fmt.Sprintf("clusterID[%v] %v has no response util time out",
-				sender.clusterID, task.ID))
+			log.LogWarnfLimited("clusterID[%v] %v has no response util time out", sender.clusterID, task.ID)
 			if task.SendTime > 0 {
 				Warn(sender.clusterID, fmt.Sprintf("clusterID[%v] %v has no response util time out",
 					sender.clusterID, task.ID))
@@ -219,12 +234,30 @@ func (sender *AdminTaskManager) syncSendAdminTask(task *proto.AdminTask) (packet
 	}
 	if packet.ResultCode != proto.OpOk {
 		err = fmt.Errorf("result code[%v],msg[%v]", packet.ResultCode, string(packet.Data))
-		log.LogErrorf("action[syncSendAdminTask],task:%v,reqID[%v],err[%v],", task.ID, packet.ReqID, err)
+		log.LogErrorfLimited("action[syncSendAdminTask],task:%v,reqID[%v],err[%v],", task.ID, packet.ReqID, err)
 		return
 	}
 	return packet, nil
 }
 
+// syncSendPacket sends the packet to the target and returns its reply whatever the result code is.
+func (sender *AdminTaskManager) syncSendPacket(packet *proto.Packet) (reply *proto.Packet, err error) {
+	conn, err := sender.getConn()
+	if err != nil {
+		return nil, errors.Trace(err, "action[syncSendPacket] get conn failed,reqID[%v]", packet.ReqID)
+	}
+	defer func() {
+		sender.putConn(conn, err != nil)
+	}()
+	if err = packet.WriteToConn(conn); err != nil {
+		return nil, errors.Trace(err, "action[syncSendPacket],WriteToConn failed,reqID[%v]", packet.ReqID)
+	}
+	if err = packet.ReadFromConn(conn, proto.SyncSendTaskDeadlineTime); err != nil {
+		return nil, errors.Trace(err, "action[syncSendPacket],ReadFromConn failed,reqID[%v]", packet.ReqID)
+	}
+	return packet, nil
+}
+
 // DelTask deletes the to-be-deleted tasks.
 func (sender *AdminTaskManager) DelTask(t *proto.AdminTask) {
 	sender.Lock()
@@ -239,6 +272,83 @@ func (sender *AdminTaskManager) DelTask(t *proto.AdminTask) {
 	delete(sender.TaskMap, t.ID)
 }
 
+// awaitResponse registers the task sent by syncSendAdminTask whose response is posted back once the task ends.
+func (sender *AdminTaskManager) awaitResponse(t *proto.AdminTask) {
+	sender.Lock()
+	defer sender.Unlock()
+	sender.awaitedTasks[t.Nonce] = t
+}
+
+func (sender *AdminTaskManager) pruneAwaitedTasks() {
+	sender.Lock()
+	defer sender.Unlock()
+	for nonce, t := range sender.awaitedTasks {
+		if time.Now().Unix()-t.CreateTime > defaultTaskResponseAwaitSec {
+			log.LogWarnfLimited("clusterID[%v] %v has no response until time out", sender.clusterID, t.ID)
+			delete(sender.awaitedTasks, nonce)
+		}
+	}
+}
+
+// takeTask takes the outstanding task off the manager for its response. The response is rejected unless it carries
+// the ID, the nonce and the create time of the task and arrives before the task times out, so the responses replayed,
+// duplicated by the retries or delayed past the timeout never apply to the state twice or to a newer task.
+// The nodes of the older versions do not echo the nonce, so their responses, carrying a zero nonce, are matched by the
+// ID and the create time only.
+func (sender *AdminTaskManager) takeTask(resp *proto.AdminTask) (err error) {
+	sender.Lock()
+	defer sender.Unlock()
+	nonce, awaited := resp.Nonce, false
+	if resp.Nonce == 0 {
+		for n, t := range sender.awaitedTasks {
+			if t.ID == resp.ID && t.CreateTime == resp.CreateTime {
+				nonce, awaited = n, true
+				break
+			}
+		}
+	} else if t, ok := sender.awaitedTasks[resp.Nonce]; ok && t.ID == resp.ID {
+		awaited = true
+	}
+	if awaited {
+		t := sender.awaitedTasks[nonce]
+		if t.CreateTime != resp.CreateTime {
+			return errStaleTaskResponse
+		}
+		delete(sender.awaitedTasks, nonce)
+		if resp.Nonce == 0 {
+			log.LogInfof("action[takeTask] clusterID[%v] accept legacy response without nonce of task[%v]",
+				sender.clusterID, resp.ID)
+		}
+		if time.Now().Unix()-t.CreateTime > defaultTaskResponseAwaitSec {
+			return errExpiredTaskResponse
+		}
+		return
+	}
+	t, ok := sender.TaskMap[resp.ID]
+	if !ok {
+		return errUnknownTaskResponse
+	}
+	if (resp.Nonce != 0 && t.Nonce != resp.Nonce) || t.CreateTime != resp.CreateTime {
+		return errStaleTaskResponse
+	}
+	if resp.Nonce == 0 {
+		log.LogInfof("action[takeTask] clusterID[%v] accept legacy response without nonce of task[%v]",
+			sender.clusterID, resp.ID)
+	}
+	delete(sender.TaskMap, resp.ID)
+	if t.SendTime > 0 && time.Now().Unix()-t.SendTime > int64(proto.ResponseTimeOut) {
+		return errExpiredTaskResponse
+	}
+	return
+}
+
+// auditTaskResponse logs the rejected response with the identity of the task and of the poster.
+func auditTaskResponse(resp *proto.AdminTask, remoteAddr string, err error) {
+	log.LogWarnf("action[auditTaskResponse] reject response of task[%v] op[%v] operator[%v] nonce[%v] createTime[%v] "+
+		"sendCount[%v] from[%v],err[%v]", resp.ID, resp.OpCode, resp.OperatorAddr, resp.Nonce, resp.CreateTime,
+		resp.SendCount, remoteAddr, err)
+}
+
 // AddTask adds a new task to the task map.
 func (sender *AdminTaskManager) AddTask(t *proto.AdminTask) {
 	sender.Lock()
@@ -247,6 +357,22 @@ func (sender *AdminTaskManager) AddTask(t *proto.AdminTask) {
 	if !ok {
 		sender.TaskMap[t.ID] = t
 	}
+	if !ok && t.IsHeartbeatTask() {
+		select {
+		case sender.sendCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// hasPendingTask returns if the task of the op code, e.g. the heartbeat, has not been responded, whose ID is fixed
+// for the node.
+func (sender *AdminTaskManager) hasPendingTask(opCode uint8) bool {
+	id := proto.NewAdminTask(opCode, sender.targetAddr, nil).ID
+	sender.RLock()
+	defer sender.RUnlock()
+	_, ok := sender.TaskMap[id]
+	return ok
 }
 
 func (sender *AdminTaskManager) getToDoTasks() (tasks []*proto.AdminTask) {
@@ -0,0 +1,92 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestTakeTask(t *testing.T) {
+	sender := &AdminTaskManager{
+		TaskMap:      make(map[string]*proto.AdminTask),
+		awaitedTasks: make(map[uint64]*proto.AdminTask),
+	}
+	task := proto.NewAdminTask(proto.OpDataNodeHeartbeat, "127.0.0.1:6000", nil)
+	sender.TaskMap[task.ID] = task
+	response := func(t *proto.AdminTask) *proto.AdminTask {
+		resp := *t
+		return &resp
+	}
+
+	stale := response(task)
+	stale.Nonce++
+	if err := sender.takeTask(stale); err != errStaleTaskResponse {
+		t.Errorf("the response with another nonce should be stale, err[%v]", err)
+	}
+	if err := sender.takeTask(response(task)); err != nil {
+		t.Fatalf("the response of the outstanding task should be accepted, err[%v]", err)
+	}
+	if err := sender.takeTask(response(task)); err != errUnknownTaskResponse {
+		t.Errorf("the duplicated response should be rejected, err[%v]", err)
+	}
+
+	task = proto.NewAdminTask(proto.OpDataNodeHeartbeat, "127.0.0.1:6000", nil)
+	task.SendTime = time.Now().Unix() - proto.ResponseTimeOut - 1
+	sender.TaskMap[task.ID] = task
+	if err := sender.takeTask(response(task)); err != errExpiredTaskResponse {
+		t.Errorf("the response after the timeout should be expired, err[%v]", err)
+	}
+
+	task = proto.NewAdminTask(proto.OpCopyExtent, "127.0.0.1:6000", nil)
+	sender.awaitResponse(task)
+	if err := sender.takeTask(response(task)); err != nil {
+		t.Fatalf("the response of the awaited task should be accepted, err[%v]", err)
+	}
+	if err := sender.takeTask(response(task)); err != errUnknownTaskResponse {
+		t.Errorf("the replayed response should be rejected, err[%v]", err)
+	}
+
+	// the nodes of the older versions echo a zero nonce
+	legacy := func(t *proto.AdminTask) *proto.AdminTask {
+		resp := response(t)
+		resp.Nonce = 0
+		return resp
+	}
+	task = proto.NewAdminTask(proto.OpDataNodeHeartbeat, "127.0.0.1:6000", nil)
+	sender.TaskMap[task.ID] = task
+	stale = legacy(task)
+	stale.CreateTime--
+	if err := sender.takeTask(stale); err != errStaleTaskResponse {
+		t.Errorf("the legacy response of another create time should be stale, err[%v]", err)
+	}
+	if err := sender.takeTask(legacy(task)); err != nil {
+		t.Fatalf("the legacy response of the outstanding task should be accepted, err[%v]", err)
+	}
+	if err := sender.takeTask(legacy(task)); err != errUnknownTaskResponse {
+		t.Errorf("the duplicated legacy response should be rejected, err[%v]", err)
+	}
+
+	task = proto.NewAdminTask(proto.OpLoadDataPartition, "127.0.0.1:6000", nil)
+	sender.awaitResponse(task)
+	if err := sender.takeTask(legacy(task)); err != nil {
+		t.Fatalf("the legacy response of the awaited task should be accepted, err[%v]", err)
+	}
+	if err := sender.takeTask(legacy(task)); err != errUnknownTaskResponse {
+		t.Errorf("the replayed legacy response should be rejected, err[%v]", err)
+	}
+}
@@ -120,6 +120,40 @@ func (m *Server) setupAutoAllocation(w http.ResponseWriter, r *http.Request) {
 	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set DisableAutoAllocate to %v successfully", status)))
 }
 
+// Turn on or off promoting spare data nodes automatically when a data node is dead.
+func (m *Server) setupAutoPromoteSpare(w http.ResponseWriter, r *http.Request) {
+	var (
+		status bool
+		err    error
+	)
+	if status, err = parseAndExtractStatus(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setDisableAutoPromoteSpare(!status); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set DisableAutoPromoteSpare to %v successfully", !status)))
+}
+
+// Turn on or off the quorum write, with which the data nodes ack an append write once the quorum of the replicas persist it.
+func (m *Server) setupQuorumWrite(w http.ResponseWriter, r *http.Request) {
+	var (
+		status bool
+		err    error
+	)
+	if status, err = parseAndExtractStatus(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setEnableQuorumWrite(status); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set EnableQuorumWrite to %v successfully", status)))
+}
+
 // View the topology of the cluster.
 func (m *Server) getTopology(w http.ResponseWriter, r *http.Request) {
 	tv := &TopologyView{
@@ -205,6 +239,8 @@ func (m *Server) getCluster(w http.ResponseWriter, r *http.Request) {
 		Name:                m.cluster.Name,
 		LeaderAddr:          m.leaderInfo.addr,
 		DisableAutoAlloc:    m.cluster.DisableAutoAllocate,
+		DisableAutoPromote:  m.cluster.DisableAutoPromoteSpare,
+		EnableQuorumWrite:   m.cluster.EnableQuorumWrite,
 		MetaNodeThreshold:   m.cluster.cfg.MetaNodeThreshold,
 		Applied:             m.fsm.applied,
 		MaxDataPartitionID:  m.cluster.idAlloc.dataPartitionID,
@@ -215,6 +251,7 @@ func (m *Server) getCluster(w http.ResponseWriter, r *http.Request) {
 		VolStatInfo:         make([]*proto.VolStatInfo, 0),
 		BadPartitionIDs:     make([]proto.BadPartitionView, 0),
 		BadMetaPartitionIDs: make([]proto.BadPartitionView, 0),
+		HeartbeatPace:       m.cluster.cfg.heartbeat.view(),
 	}
 
 	vols := m.cluster.allVolNames()
@@ -280,6 +317,7 @@ func (m *Server) createDataPartition(w http.ResponseWriter, r *http.Request) {
 		reqCreateCount             int
 		lastTotalDataPartitions    int
 		clusterTotalDataPartitions int
+		decisions                  []*proto.PlacementDecision
 		err                        error
 	)
 
@@ -294,7 +332,7 @@ func (m *Server) createDataPartition(w http.ResponseWriter, r *http.Request) {
 	}
 	lastTotalDataPartitions = len(vol.dataPartitions.partitions)
 	clusterTotalDataPartitions = m.cluster.getDataPartitionCount()
-	err = m.cluster.batchCreateDataPartition(vol, reqCreateCount)
+	decisions, err = m.cluster.batchCreateDataPartition(vol, reqCreateCount, vol.allocationEpoch())
 	rstMsg = fmt.Sprintf(" createDataPartition succeeeds. "+
 		"clusterLastTotalDataPartitions[%v],vol[%v] has %v data partitions previously and %v data partitions now",
 		clusterTotalDataPartitions, volName, lastTotalDataPartitions, len(vol.dataPartitions.partitions))
@@ -303,7 +341,7 @@ func (m *Server) createDataPartition(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
-	_ = sendOkReply(w, r, newSuccessHTTPReply(rstMsg))
+	_ = sendOkReply(w, r, newSuccessHTTPReply(&proto.DataPartitionCreation{Message: rstMsg, Decisions: decisions}))
 }
 
 func (m *Server) getDataPartition(w http.ResponseWriter, r *http.Request) {
@@ -502,6 +540,163 @@ func (m *Server) decommissionDataPartition(w http.ResponseWriter, r *http.Reques
 	sendOkReply(w, r, newSuccessHTTPReply(rstMsg))
 }
 
+// Mark the data partition to be deleted. It is refused if any inode refers to the data partition,
+// unless force is true, so that the referenced extents can be migrated before the deletion.
+func (m *Server) deleteDataPartition(w http.ResponseWriter, r *http.Request) {
+	var (
+		dp          *DataPartition
+		vol         *Vol
+		partitionID uint64
+		volName     string
+		force       bool
+		report      *proto.DataPartitionRefReport
+		err         error
+	)
+	if partitionID, volName, err = parseRequestToOperateDataPartition(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, dp, err = m.cluster.getVolAndDataPartition(volName, partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if force, err = extractForce(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	report, err = m.cluster.markDataPartitionToDelete(vol, dp, force)
+	if err == proto.ErrDataPartitionReferenced {
+		sendErrReply(w, r, &proto.HTTPReply{
+			Code: proto.ErrCodeDataPartitionReferenced,
+			Msg: fmt.Sprintf("%v, [%v] extent keys of [%v] inodes, inodes%v",
+				err, report.ExtentKeyCount, report.InodeCount, report.Inodes),
+			Data: report,
+		})
+		return
+	}
+	if err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(report))
+}
+
+func (m *Server) cancelDeleteDataPartition(w http.ResponseWriter, r *http.Request) {
+	var (
+		dp          *DataPartition
+		vol         *Vol
+		partitionID uint64
+		volName     string
+		err         error
+	)
+	if partitionID, volName, err = parseRequestToOperateDataPartition(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, dp, err = m.cluster.getVolAndDataPartition(volName, partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err = m.cluster.setDataPartitionPendingDelete(vol, dp, false); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("cancel deleting data partition[%v] successfully", dp.PartitionID)))
+}
+
+func (m *Server) freezeDataPartition(w http.ResponseWriter, r *http.Request) {
+	m.setDataPartitionFrozen(w, r, true)
+}
+
+func (m *Server) unfreezeDataPartition(w http.ResponseWriter, r *http.Request) {
+	m.setDataPartitionFrozen(w, r, false)
+}
+
+func (m *Server) setDataPartitionFrozen(w http.ResponseWriter, r *http.Request, isFrozen bool) {
+	var (
+		dp          *DataPartition
+		vol         *Vol
+		partitionID uint64
+		volName     string
+		err         error
+	)
+	if partitionID, volName, err = parseRequestToOperateDataPartition(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, dp, err = m.cluster.getVolAndDataPartition(volName, partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err = m.cluster.setDataPartitionFrozen(vol, dp, isFrozen); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set data partition[%v] frozen to [%v] successfully", dp.PartitionID, isFrozen)))
+}
+
+// Grow the data partition to the size in GB online.
+func (m *Server) resizeDataPartition(w http.ResponseWriter, r *http.Request) {
+	var (
+		dp          *DataPartition
+		vol         *Vol
+		partitionID uint64
+		volName     string
+		size        int
+		err         error
+	)
+	if partitionID, volName, err = parseRequestToOperateDataPartition(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if size, err = strconv.Atoi(r.FormValue(dataPartitionSizeKey)); err != nil || size <= 0 {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: unmatchedKey(dataPartitionSizeKey).Error()})
+		return
+	}
+	if vol, dp, err = m.cluster.getVolAndDataPartition(volName, partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err = m.cluster.resizeDataPartition(vol, dp, uint64(size)*util.GB); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("resize data partition[%v] to [%v]GB successfully", dp.PartitionID, size)))
+}
+
+// List the inodes which have extent keys referring to the data partition.
+func (m *Server) checkDataPartitionRef(w http.ResponseWriter, r *http.Request) {
+	var (
+		dp          *DataPartition
+		vol         *Vol
+		partitionID uint64
+		volName     string
+		limit       int
+		report      *proto.DataPartitionRefReport
+		err         error
+	)
+	if partitionID, volName, err = parseRequestToOperateDataPartition(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, dp, err = m.cluster.getVolAndDataPartition(volName, partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	limit = defaultDataPartitionRefLimit
+	if value := r.FormValue(limitKey); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", limitKey, value)})
+			return
+		}
+	}
+	if report, err = m.cluster.checkDataPartitionRef(vol, dp, limit); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(report))
+}
+
 func (m *Server) diagnoseDataPartition(w http.ResponseWriter, r *http.Request) {
 	var (
 		err               error
@@ -567,6 +762,33 @@ func (m *Server) markDeleteVol(w http.ResponseWriter, r *http.Request) {
 	sendOkReply(w, r, newSuccessHTTPReply(msg))
 }
 
+// Restore the volume deleted within the grace period, before its partitions are deleted.
+func (m *Server) undeleteVol(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		vol     *Vol
+		err     error
+		msg     string
+	)
+
+	if name, authKey, err = parseRequestToDeleteVol(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.undeleteVol(name, authKey); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err = m.associateVolWithUser(vol.Owner, name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	msg = fmt.Sprintf("undelete vol[%v] successfully,from[%v]", name, r.RemoteAddr)
+	log.LogWarn(msg)
+	sendOkReply(w, r, newSuccessHTTPReply(msg))
+}
+
 func (m *Server) updateVol(w http.ResponseWriter, r *http.Request) {
 	var (
 		name           string
@@ -582,6 +804,19 @@ func (m *Server) updateVol(w http.ResponseWriter, r *http.Request) {
 		description    string
 		dpSelectorName string
 		dpSelectorParm string
+		dpAffinity     string
+		failureDomain  string
+		minVersion     string
+		features       map[string]bool
+		multipartTTL   int64
+		metaCache      bool
+		maxClients     int
+		verifyReads    bool
+		verifyPercent  int
+		syncOnRename   bool
+		requireToken   bool
+		coldZone       string
+		namePolicy     proto.DentryNamePolicy
 		vol            *Vol
 	)
 
@@ -609,6 +844,58 @@ func (m *Server) updateVol(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dpAffinity, err = parseDpAffinityToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if failureDomain, err = parseFailureDomainToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if minVersion, features, err = parseClientGateToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if multipartTTL, err = parseMultipartTTLToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if metaCache, err = parseMetaCacheToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if maxClients, err = parseMaxClientsToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if verifyReads, verifyPercent, err = parseVerifyReadsToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if syncOnRename, err = parseSyncOnRenameToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	if requireToken, err = parseRequireTokenToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	coldZone = parseColdZoneToUpdateVol(r, vol)
+
+	if namePolicy, err = parseNamePolicyToUpdateVol(r, vol); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
 	newArgs := getVolVarargs(vol)
 
 	newArgs.zoneName = zoneName
@@ -619,6 +906,19 @@ func (m *Server) updateVol(w http.ResponseWriter, r *http.Request) {
 	newArgs.enableToken = enableToken
 	newArgs.dpSelectorName = dpSelectorName
 	newArgs.dpSelectorParm = dpSelectorParm
+	newArgs.dpAffinity = dpAffinity
+	newArgs.failureDomain = failureDomain
+	newArgs.minClientVersion = minVersion
+	newArgs.features = features
+	newArgs.multipartTTL = multipartTTL
+	newArgs.metaCache = metaCache
+	newArgs.maxClients = maxClients
+	newArgs.verifyReads = verifyReads
+	newArgs.verifyReadsPercent = verifyPercent
+	newArgs.syncOnRename = syncOnRename
+	newArgs.requireToken = requireToken
+	newArgs.coldZone = coldZone
+	newArgs.namePolicy = namePolicy
 
 	if err = m.cluster.updateVol(name, authKey, newArgs); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
@@ -713,9 +1013,26 @@ func (m *Server) createVol(w http.ResponseWriter, r *http.Request) {
 		enableToken  bool
 		zoneName     string
 		description  string
+		tenantName   string
+		tenantInfo   *proto.TenantInfo
+
+		caseInsensitive bool
+		shadow          bool
 	)
 
-	if name, owner, zoneName, description, mpCount, dpReplicaNum, size, capacity, followerRead, authenticate, crossZone, enableToken, err = parseRequestToCreateVol(r); err != nil {
+	if tenantName = r.FormValue(tenantKey); tenantName != "" {
+		// the tenants are locked until the vol is added, so the vols created at once never exceed the quota together
+		m.cluster.tenantMutex.Lock()
+		defer m.cluster.tenantMutex.Unlock()
+		if tenantInfo, err = m.cluster.getTenant(tenantName); err != nil {
+			sendErrReply(w, r, newErrHTTPReply(err))
+			return
+		}
+		if r.FormValue(volOwnerKey) == "" {
+			r.Form.Set(volOwnerKey, tenantInfo.Owner)
+		}
+	}
+	if name, owner, zoneName, description, mpCount, dpReplicaNum, size, capacity, followerRead, authenticate, crossZone, enableToken, caseInsensitive, err = parseRequestToCreateVol(r); err != nil {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
@@ -724,7 +1041,24 @@ func (m *Server) createVol(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if vol, err = m.cluster.createVol(name, owner, zoneName, description, mpCount, dpReplicaNum, size, capacity, followerRead, authenticate, crossZone, enableToken); err != nil {
+	if shadow, err = extractShadow(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if tenantInfo != nil {
+		if err = m.cluster.checkTenantQuota(tenantInfo, name, uint64(capacity)); err != nil {
+			sendErrReply(w, r, newErrHTTPReply(err))
+			return
+		}
+	}
+	if vol, err = m.cluster.createVol(name, owner, zoneName, description, mpCount, dpReplicaNum, size, capacity, createVolOptions{
+		followerRead:    followerRead,
+		authenticate:    authenticate,
+		crossZone:       crossZone,
+		enableToken:     enableToken,
+		caseInsensitive: caseInsensitive,
+		shadow:          shadow,
+	}); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -733,6 +1067,12 @@ func (m *Server) createVol(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
+	if tenantInfo != nil {
+		if err = m.addVolToTenantLocked(tenantName, name); err != nil {
+			sendErrReply(w, r, newErrHTTPReply(err))
+			return
+		}
+	}
 	msg = fmt.Sprintf("create vol[%v] successfully, has allocate [%v] data partitions", name, len(vol.dataPartitions.partitions))
 	sendOkReply(w, r, newSuccessHTTPReply(msg))
 }
@@ -753,6 +1093,7 @@ func (m *Server) getVolSimpleInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	volView = newSimpleView(vol)
+	volView.Clients = m.cluster.clientLeases.count(name)
 	sendOkReply(w, r, newSuccessHTTPReply(volView))
 }
 
@@ -760,12 +1101,21 @@ func newSimpleView(vol *Vol) *proto.SimpleVolView {
 	var (
 		volInodeCount  uint64
 		volDentryCount uint64
+		dedupStat      proto.DedupStat
 	)
 	for _, mp := range vol.MetaPartitions {
 		volDentryCount = volDentryCount + mp.DentryCount
 		volInodeCount = volInodeCount + mp.InodeCount
+		dedupStat.Blocks += mp.DedupStat.Blocks
+		dedupStat.Extents += mp.DedupStat.Extents
+		dedupStat.LogicalBytes += mp.DedupStat.LogicalBytes
+		dedupStat.PhysicalBytes += mp.DedupStat.PhysicalBytes
 	}
 	maxPartitionID := vol.maxPartitionID()
+	var deleteTime string
+	if vol.Status == markDelete {
+		deleteTime = time.Unix(vol.deleteTime, 0).Format(proto.TimeFormat)
+	}
 	return &proto.SimpleVolView{
 		ID:                 vol.ID,
 		Name:               vol.Name,
@@ -782,6 +1132,7 @@ func newSimpleView(vol *Vol) *proto.SimpleVolView {
 		NeedToLowerReplica: vol.NeedToLowerReplica,
 		Authenticate:       vol.authenticate,
 		CrossZone:          vol.crossZone,
+		CaseInsensitive:    vol.caseInsensitive,
 		EnableToken:        vol.enableToken,
 		Tokens:             vol.tokens,
 		RwDpCnt:            vol.dataPartitions.readableAndWritableCnt,
@@ -791,27 +1142,98 @@ func newSimpleView(vol *Vol) *proto.SimpleVolView {
 		Description:        vol.description,
 		DpSelectorName:     vol.dpSelectorName,
 		DpSelectorParm:     vol.dpSelectorParm,
+		DpAffinity:         vol.dpAffinity,
+		FailureDomain:      vol.failureDomain,
+		MinClientVersion:   vol.minClientVersion,
+		Features:           vol.features,
+		MultipartTTL:       vol.multipartTTL,
+		DeleteTime:         deleteTime,
+		DedupStat:          dedupStat,
+		MetaCache:          vol.metaCache,
+		MaxClients:         vol.maxClients,
+		IsFrozen:           vol.freeze != nil,
+		VerifyReads:        vol.verifyReads,
+		VerifyReadsPercent: vol.verifyReadsPercent,
+		SyncOnRename:       vol.syncOnRename,
+		RequireToken:       vol.requireToken,
+		ColdZone:           vol.coldZone,
+		NamePolicy:         vol.namePolicy,
+		Shadow:             vol.shadowView(),
+		ShadowOf:           vol.getShadowOf(),
 	}
 }
 
 func (m *Server) addDataNode(w http.ResponseWriter, r *http.Request) {
 	var (
-		nodeAddr string
-		zoneName string
-		id       uint64
-		err      error
+		nodeAddr   string
+		zoneName   string
+		instanceID string
+		reportTime int64
+		isSpare    bool
+		id         uint64
+		msg        string
+		staleNode  *DataNode
+		err        error
 	)
 	if nodeAddr, zoneName, err = parseRequestForAddNode(r); err != nil {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if id, err = m.cluster.addDataNode(nodeAddr, zoneName); err != nil {
+	if isSpare, err = extractSpare(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if instanceID, reportTime, err = extractNodeInstance(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if staleNode, msg, err = m.cluster.checkDataNodeRegistration(nodeAddr, instanceID, reportTime); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.Err2CodeMap[err], Msg: msg})
+		return
+	}
+	if staleNode != nil {
+		id, err = m.cluster.readdressDataNode(staleNode, nodeAddr)
+	} else {
+		id, err = m.cluster.addDataNode(nodeAddr, zoneName, instanceID, isSpare)
+	}
+	if err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
 	sendOkReply(w, r, newSuccessHTTPReply(id))
 }
 
+// Mark a data node without data partitions as spare, or promote a spare data node manually.
+func (m *Server) setDataNodeSpare(w http.ResponseWriter, r *http.Request) {
+	var (
+		nodeAddr string
+		isSpare  bool
+		dataNode *DataNode
+		err      error
+	)
+	if nodeAddr, err = parseAndExtractNodeAddr(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if r.FormValue(spareKey) == "" {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: keyNotFound(spareKey).Error()})
+		return
+	}
+	if isSpare, err = extractSpare(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if dataNode, err = m.cluster.dataNode(nodeAddr); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeDataNodeNotExists, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setDataNodeSpare(dataNode, isSpare); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set spare of dataNode[%v] to %v successfully", nodeAddr, isSpare)))
+}
+
 func (m *Server) getDataNode(w http.ResponseWriter, r *http.Request) {
 	var (
 		nodeAddr     string
@@ -847,6 +1269,10 @@ func (m *Server) getDataNode(w http.ResponseWriter, r *http.Request) {
 		NodeSetID:                 dataNode.NodeSetID,
 		PersistenceDataPartitions: dataNode.PersistenceDataPartitions,
 		BadDisks:                  dataNode.BadDisks,
+		IsSpare:                   dataNode.IsSpare,
+		InstanceID:                dataNode.InstanceID,
+		ReplicaIP:                 dataNode.ReplicaIP,
+		Rack:                      dataNode.Rack,
 	}
 
 	sendOkReply(w, r, newSuccessHTTPReply(dataNodeInfo))
@@ -1021,22 +1447,38 @@ func (m *Server) handleDataNodeTaskResponse(w http.ResponseWriter, r *http.Reque
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
+	if err = m.cluster.acceptDataNodeTaskResponse(tr); err != nil {
+		auditTaskResponse(tr, r.RemoteAddr, err)
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
 	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("%v", http.StatusOK)))
 	m.cluster.handleDataNodeTaskResponse(tr.OperatorAddr, tr)
 }
 
 func (m *Server) addMetaNode(w http.ResponseWriter, r *http.Request) {
 	var (
-		nodeAddr string
-		zoneName string
-		id       uint64
-		err      error
+		nodeAddr   string
+		zoneName   string
+		instanceID string
+		reportTime int64
+		id         uint64
+		msg        string
+		err        error
 	)
 	if nodeAddr, zoneName, err = parseRequestForAddNode(r); err != nil {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if id, err = m.cluster.addMetaNode(nodeAddr, zoneName); err != nil {
+	if instanceID, reportTime, err = extractNodeInstance(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if msg, err = m.cluster.checkMetaNodeRegistration(nodeAddr, instanceID, reportTime); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.Err2CodeMap[err], Msg: msg})
+		return
+	}
+	if id, err = m.cluster.addMetaNode(nodeAddr, zoneName, instanceID); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -1115,6 +1557,8 @@ func (m *Server) getMetaNode(w http.ResponseWriter, r *http.Request) {
 		MetaPartitionCount:        metaNode.MetaPartitionCount,
 		NodeSetID:                 metaNode.NodeSetID,
 		PersistenceMetaPartitions: metaNode.PersistenceMetaPartitions,
+		ReplicaIP:                 metaNode.ReplicaIP,
+		InstanceID:                metaNode.InstanceID,
 	}
 	sendOkReply(w, r, newSuccessHTTPReply(metaNodeInfo))
 }
@@ -1197,6 +1641,11 @@ func (m *Server) handleMetaNodeTaskResponse(w http.ResponseWriter, r *http.Reque
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
+	if err = m.cluster.acceptMetaNodeTaskResponse(tr); err != nil {
+		auditTaskResponse(tr, r.RemoteAddr, err)
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
 	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("%v", http.StatusOK)))
 	m.cluster.handleMetaNodeTaskResponse(tr.OperatorAddr, tr)
 }
@@ -1335,6 +1784,7 @@ func parseVolName(r *http.Request) (name string, err error) {
 type getVolParameter struct {
 	name                string
 	authKey             string
+	delegatedToken      string
 	skipOwnerValidation bool
 }
 
@@ -1354,7 +1804,8 @@ func parseGetVolParameter(r *http.Request) (p *getVolParameter, err error) {
 		err = errors.New("name can only be number and letters")
 		return
 	}
-	if p.authKey = r.FormValue(volAuthKey); !p.skipOwnerValidation && len(p.authKey) == 0 {
+	p.delegatedToken = r.FormValue(delegatedTokenKey)
+	if p.authKey = r.FormValue(volAuthKey); !p.skipOwnerValidation && len(p.authKey) == 0 && len(p.delegatedToken) == 0 {
 		err = keyNotFound(volAuthKey)
 		return
 	}
@@ -1441,6 +1892,171 @@ func parseDefaultInfoToUpdateVol(r *http.Request, vol *Vol) (zoneName string, ca
 	return
 }
 
+func parseDpAffinityToUpdateVol(r *http.Request, vol *Vol) (dpAffinity string, err error) {
+	if _, ok := r.Form[dpAffinityKey]; !ok {
+		return vol.dpAffinity, nil
+	}
+	switch dpAffinity = r.FormValue(dpAffinityKey); dpAffinity {
+	case proto.DpAffinityNone, proto.DpAffinityColocate, proto.DpAffinityAntiColocate:
+	default:
+		err = fmt.Errorf("parameter %v should be empty, %v or %v", dpAffinityKey, proto.DpAffinityColocate,
+			proto.DpAffinityAntiColocate)
+	}
+	return
+}
+
+func parseFailureDomainToUpdateVol(r *http.Request, vol *Vol) (failureDomain string, err error) {
+	if _, ok := r.Form[failureDomainKey]; !ok {
+		return vol.failureDomain, nil
+	}
+	switch failureDomain = r.FormValue(failureDomainKey); failureDomain {
+	case proto.FailureDomainNone, proto.FailureDomainHost, proto.FailureDomainRack:
+	case proto.FailureDomainZone:
+		if !vol.crossZone {
+			err = fmt.Errorf("parameter %v can be %v only if the vol is across zones", failureDomainKey,
+				proto.FailureDomainZone)
+		}
+	default:
+		err = fmt.Errorf("parameter %v should be empty, %v, %v or %v", failureDomainKey, proto.FailureDomainHost,
+			proto.FailureDomainRack, proto.FailureDomainZone)
+	}
+	return
+}
+
+func parseClientGateToUpdateVol(r *http.Request, vol *Vol) (minVersion string, features map[string]bool, err error) {
+	minVersion = vol.minClientVersion
+	features = vol.features
+	if _, ok := r.Form[minClientVersionKey]; ok {
+		if minVersion = r.FormValue(minClientVersionKey); minVersion != "" {
+			if err = proto.ValidateVersion(minVersion); err != nil {
+				err = fmt.Errorf("parameter %v is invalid: %v", minClientVersionKey, err)
+				return
+			}
+		}
+	}
+	if _, ok := r.Form[featuresKey]; ok {
+		if features, err = proto.ParseFeatures(r.FormValue(featuresKey)); err != nil {
+			err = fmt.Errorf("parameter %v is invalid: %v", featuresKey, err)
+			return
+		}
+	}
+	return
+}
+
+func parseMetaCacheToUpdateVol(r *http.Request, vol *Vol) (metaCache bool, err error) {
+	value := r.FormValue(metaCacheKey)
+	if value == "" {
+		return vol.metaCache, nil
+	}
+	if metaCache, err = strconv.ParseBool(value); err != nil {
+		err = unmatchedKey(metaCacheKey)
+	}
+	return
+}
+
+func parseMaxClientsToUpdateVol(r *http.Request, vol *Vol) (maxClients int, err error) {
+	value := r.FormValue(maxClientsKey)
+	if value == "" {
+		return vol.maxClients, nil
+	}
+	if maxClients, err = strconv.Atoi(value); err != nil || maxClients < 0 {
+		err = unmatchedKey(maxClientsKey)
+	}
+	return
+}
+
+// parseVerifyReadsToUpdateVol parses the verification of the reads, whose percent is defaultVerifyReadsPercent
+// once it is enabled without the percent.
+func parseVerifyReadsToUpdateVol(r *http.Request, vol *Vol) (verifyReads bool, percent int, err error) {
+	verifyReads, percent = vol.verifyReads, vol.verifyReadsPercent
+	if value := r.FormValue(verifyReadsKey); value != "" {
+		if verifyReads, err = strconv.ParseBool(value); err != nil {
+			err = unmatchedKey(verifyReadsKey)
+			return
+		}
+	}
+	if value := r.FormValue(verifyReadsPercentKey); value != "" {
+		if percent, err = strconv.Atoi(value); err != nil || percent <= 0 || percent > 100 {
+			err = unmatchedKey(verifyReadsPercentKey)
+			return
+		}
+	}
+	if verifyReads && percent == 0 {
+		percent = defaultVerifyReadsPercent
+	}
+	return
+}
+
+func parseSyncOnRenameToUpdateVol(r *http.Request, vol *Vol) (syncOnRename bool, err error) {
+	value := r.FormValue(syncOnRenameKey)
+	if value == "" {
+		return vol.syncOnRename, nil
+	}
+	if syncOnRename, err = strconv.ParseBool(value); err != nil {
+		err = unmatchedKey(syncOnRenameKey)
+	}
+	return
+}
+
+func parseRequireTokenToUpdateVol(r *http.Request, vol *Vol) (requireToken bool, err error) {
+	value := r.FormValue(requireTokenKey)
+	if value == "" {
+		return vol.requireToken, nil
+	}
+	if requireToken, err = strconv.ParseBool(value); err != nil {
+		err = unmatchedKey(requireTokenKey)
+	}
+	return
+}
+
+// parseColdZoneToUpdateVol returns the cold zone of the volume, which is removed with the empty parameter.
+func parseColdZoneToUpdateVol(r *http.Request, vol *Vol) (coldZone string) {
+	if _, ok := r.Form[coldZoneKey]; !ok {
+		return vol.coldZone
+	}
+	return r.FormValue(coldZoneKey)
+}
+
+func parseNamePolicyToUpdateVol(r *http.Request, vol *Vol) (policy proto.DentryNamePolicy, err error) {
+	policy = vol.namePolicy
+	if value := r.FormValue(nameMaxLengthKey); value != "" {
+		if policy.MaxLength, err = strconv.Atoi(value); err != nil || policy.MaxLength < 0 {
+			err = unmatchedKey(nameMaxLengthKey)
+			return
+		}
+	}
+	flags := []struct {
+		key  string
+		flag *bool
+	}{
+		{nameValidUTF8Key, &policy.ValidUTF8},
+		{nameNoControlCharsKey, &policy.NoControlChars},
+		{nameRelaxedKey, &policy.Relaxed},
+	}
+	for _, f := range flags {
+		value := r.FormValue(f.key)
+		if value == "" {
+			continue
+		}
+		if *f.flag, err = strconv.ParseBool(value); err != nil {
+			err = unmatchedKey(f.key)
+			return
+		}
+	}
+	return
+}
+
+func parseMultipartTTLToUpdateVol(r *http.Request, vol *Vol) (multipartTTL int64, err error) {
+	value := r.FormValue(multipartTTLKey)
+	if value == "" {
+		return vol.multipartTTL, nil
+	}
+	if multipartTTL, err = strconv.ParseInt(value, 10, 64); err != nil || multipartTTL < 0 {
+		err = unmatchedKey(multipartTTLKey)
+	}
+	return
+}
+
 func parseBoolFieldToUpdateVol(r *http.Request, vol *Vol) (followerRead, authenticate bool, err error) {
 	if followerReadStr := r.FormValue(followerReadKey); followerReadStr != "" {
 		if followerRead, err = strconv.ParseBool(followerReadStr); err != nil {
@@ -1477,7 +2093,7 @@ func parseRequestToSetVolCapacity(r *http.Request) (name, authKey string, capaci
 	return
 }
 
-func parseRequestToCreateVol(r *http.Request) (name, owner, zoneName, description string, mpCount, dpReplicaNum, size, capacity int, followerRead, authenticate, crossZone, enableToken bool, err error) {
+func parseRequestToCreateVol(r *http.Request) (name, owner, zoneName, description string, mpCount, dpReplicaNum, size, capacity int, followerRead, authenticate, crossZone, enableToken, caseInsensitive bool, err error) {
 	if err = r.ParseForm(); err != nil {
 		return
 	}
@@ -1523,6 +2139,10 @@ func parseRequestToCreateVol(r *http.Request) (name, owner, zoneName, descriptio
 	if crossZone, err = extractCrossZone(r); err != nil {
 		return
 	}
+
+	if caseInsensitive, err = extractCaseInsensitive(r); err != nil {
+		return
+	}
 	zoneName = r.FormValue(zoneNameKey)
 	enableToken = extractEnableToken(r)
 	description = r.FormValue(descriptionKey)
@@ -1626,6 +2246,27 @@ func extractDataPartitionID(r *http.Request) (ID uint64, err error) {
 	return strconv.ParseUint(value, 10, 64)
 }
 
+func parseRequestToOperateDataPartition(r *http.Request) (ID uint64, volName string, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	if ID, err = extractDataPartitionID(r); err != nil {
+		return
+	}
+	if volName, err = extractName(r); err != nil {
+		return
+	}
+	return
+}
+
+func extractForce(r *http.Request) (force bool, err error) {
+	var value string
+	if value = r.FormValue(forceKey); value == "" {
+		return
+	}
+	return strconv.ParseBool(value)
+}
+
 func parseRequestToDecommissionDataPartition(r *http.Request) (ID uint64, nodeAddr string, err error) {
 	return extractDataPartitionIDAndAddr(r)
 }
@@ -1689,6 +2330,31 @@ func extractStatus(r *http.Request) (status bool, err error) {
 	return
 }
 
+func extractSpare(r *http.Request) (isSpare bool, err error) {
+	var value string
+	if value = r.FormValue(spareKey); value == "" {
+		return
+	}
+	if isSpare, err = strconv.ParseBool(value); err != nil {
+		return
+	}
+	return
+}
+
+// extractNodeInstance extracts the instance ID and the current time reported by a node on registration,
+// which are absent if the node is of an old version.
+func extractNodeInstance(r *http.Request) (instanceID string, reportTime int64, err error) {
+	instanceID = r.FormValue(instanceIDKey)
+	var value string
+	if value = r.FormValue(timeKey); value == "" {
+		return
+	}
+	if reportTime, err = strconv.ParseInt(value, 10, 64); err != nil {
+		return
+	}
+	return
+}
+
 func extractFollowerRead(r *http.Request) (followerRead bool, err error) {
 	var value string
 	if value = r.FormValue(followerReadKey); value == "" {
@@ -1725,6 +2391,30 @@ func extractCrossZone(r *http.Request) (crossZone bool, err error) {
 	return
 }
 
+func extractCaseInsensitive(r *http.Request) (caseInsensitive bool, err error) {
+	var value string
+	if value = r.FormValue(caseInsensitiveKey); value == "" {
+		return
+	}
+	if caseInsensitive, err = strconv.ParseBool(value); err != nil {
+		err = unmatchedKey(caseInsensitiveKey)
+		return
+	}
+	return
+}
+
+func extractShadow(r *http.Request) (shadow bool, err error) {
+	var value string
+	if value = r.FormValue(shadowKey); value == "" {
+		return
+	}
+	if shadow, err = strconv.ParseBool(value); err != nil {
+		err = unmatchedKey(shadowKey)
+		return
+	}
+	return
+}
+
 func parseAndExtractThreshold(r *http.Request) (threshold float64, err error) {
 	if err = r.ParseForm(); err != nil {
 		return
@@ -1826,6 +2516,9 @@ func newErrHTTPReply(err error) *proto.HTTPReply {
 }
 
 func sendOkReply(w http.ResponseWriter, r *http.Request, httpReply *proto.HTTPReply) (err error) {
+	if r.URL.Query().Get(proto.FormatKey) == proto.FormatJSON {
+		httpReply.Data = typedReplyData(r, httpReply.Data)
+	}
 	switch httpReply.Data.(type) {
 	case *DataPartition:
 		dp := httpReply.Data.(*DataPartition)
@@ -1854,6 +2547,17 @@ func sendOkReply(w http.ResponseWriter, r *http.Request, httpReply *proto.HTTPRe
 	return
 }
 
+// typedReplyData converts the bare message or ID replied by the API into the typed structure.
+func typedReplyData(r *http.Request, data interface{}) interface{} {
+	switch v := data.(type) {
+	case string:
+		return &proto.MessageResult{Operation: r.URL.Path, Message: v}
+	case uint64:
+		return &proto.IDResult{Operation: r.URL.Path, ID: v}
+	}
+	return data
+}
+
 func send(w http.ResponseWriter, r *http.Request, reply []byte) {
 	w.Header().Set("content-type", "application/json")
 	w.Header().Set("Content-Length", strconv.Itoa(len(reply)))
@@ -1891,7 +2595,7 @@ func (m *Server) getMetaPartitions(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if vol, err = m.cluster.getVol(name); err != nil {
+	if vol, err = m.cluster.getVol(name); err != nil || vol.status() == markDelete {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
 		return
 	}
@@ -1916,12 +2620,12 @@ func (m *Server) getDataPartitions(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if vol, err = m.cluster.getVol(name); err != nil {
+	if vol, err = m.cluster.getVol(name); err != nil || vol.status() == markDelete {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
 		return
 	}
 
-	if body, err = vol.getDataPartitionsView(); err != nil {
+	if body, err = m.cluster.servingVol(vol).getDataPartitionsView(); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -1942,11 +2646,17 @@ func (m *Server) getVol(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if vol, err = m.cluster.getVol(param.name); err != nil {
+	if vol, err = m.cluster.getVol(param.name); err != nil || vol.status() == markDelete {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
 		return
 	}
-	if !param.skipOwnerValidation && !matchKey(vol.Owner, param.authKey) {
+	if !param.skipOwnerValidation && param.authKey == "" {
+		// the delegated token takes the place of the auth key of the owner
+		if err = m.cluster.checkDelegatedToken(param.delegatedToken, vol.Name); err != nil {
+			sendErrReply(w, r, newErrHTTPReply(err))
+			return
+		}
+	} else if !param.skipOwnerValidation && !matchKey(vol.Owner, param.authKey) {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolAuthKeyNotMatch))
 		return
 	}
@@ -1985,7 +2695,7 @@ func (m *Server) getVolStatInfo(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
-	if vol, err = m.cluster.getVol(name); err != nil {
+	if vol, err = m.cluster.getVol(name); err != nil || vol.status() == markDelete {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
 		return
 	}
@@ -2001,7 +2711,8 @@ func volStat(vol *Vol) (stat *proto.VolStatInfo) {
 		stat.UsedSize = stat.TotalSize
 	}
 	stat.EnableToken = vol.enableToken
-	log.LogDebugf("total[%v],usedSize[%v]", stat.TotalSize, stat.UsedSize)
+	stat.ReservedSize = vol.totalReservedSpace()
+	log.LogDebugf("total[%v],usedSize[%v],reservedSize[%v]", stat.TotalSize, stat.UsedSize, stat.ReservedSize)
 	return
 }
 
@@ -2056,6 +2767,11 @@ func (m *Server) getMetaPartition(w http.ResponseWriter, r *http.Request) {
 				ReportTime: mp.Replicas[i].ReportTime,
 				Status:     mp.Replicas[i].Status,
 				IsLeader:   mp.Replicas[i].IsLeader,
+				ApplyStall: mp.Replicas[i].ApplyStall,
+				ApplyQueue: mp.Replicas[i].ApplyQueue,
+				IsDegraded: mp.Replicas[i].IsDegraded,
+
+				DeleteBacklog: mp.Replicas[i].DeleteBacklog,
 			}
 		}
 		var mpInfo = &proto.MetaPartitionInfo{
@@ -2076,6 +2792,7 @@ func (m *Server) getMetaPartition(w http.ResponseWriter, r *http.Request) {
 			MissNodes:     mp.MissNodes,
 			OfflinePeerID: mp.OfflinePeerID,
 			LoadResponse:  mp.LoadResponse,
+			IsDegraded:    mp.isDegraded,
 		}
 		return mpInfo
 	}
@@ -22,14 +22,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	_ "net/http/pprof"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/chubaofs/chubaofs/master/mocktest"
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/log"
 )
@@ -102,7 +108,7 @@ func createDefaultMasterServerForTest() *Server {
 	testServer.cluster.checkMetaNodeHeartbeat()
 	time.Sleep(5 * time.Second)
 	testServer.cluster.scheduleToUpdateStatInfo()
-	vol, err := testServer.cluster.createVol(commonVolName, "cfs", testZone2, "", 3, 3, 3, 100, false, false, false, false)
+	vol, err := testServer.cluster.createVol(commonVolName, "cfs", testZone2, "", 3, 3, 3, 100, createVolOptions{})
 	if err != nil {
 		panic(err)
 	}
@@ -201,6 +207,23 @@ func TestSetMetaNodeThreshold(t *testing.T) {
 	}
 }
 
+func TestTypedReplyFormat(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?threshold=0.5", hostAddr, proto.AdminSetMetaNodeThreshold)
+	if reply := process(reqURL, t); reply == nil {
+		return
+	} else if _, ok := reply.Data.(string); !ok {
+		t.Errorf("the message should be replied by default, but got %v", reply.Data)
+	}
+	reply := process(reqURL+"&"+proto.FormatKey+"="+proto.FormatJSON, t)
+	if reply == nil {
+		return
+	}
+	result, ok := reply.Data.(map[string]interface{})
+	if !ok || result["operation"] != proto.AdminSetMetaNodeThreshold || result["message"] == "" {
+		t.Errorf("unexpected typed reply %v", reply.Data)
+	}
+}
+
 func TestSetDisableAutoAlloc(t *testing.T) {
 	enable := true
 	reqURL := fmt.Sprintf("%v%v?enable=%v", hostAddr, proto.AdminClusterFreeze, enable)
@@ -213,12 +236,83 @@ func TestSetDisableAutoAlloc(t *testing.T) {
 	server.cluster.DisableAutoAllocate = false
 }
 
+func TestSetAutoPromoteSpare(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?enable=false", hostAddr, proto.AdminSetAutoPromoteSpare)
+	fmt.Println(reqURL)
+	process(reqURL, t)
+	if !server.cluster.DisableAutoPromoteSpare {
+		t.Errorf("disable auto promote spare failed")
+		return
+	}
+	server.cluster.DisableAutoPromoteSpare = false
+}
+
+func TestSetQuorumWrite(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?enable=true", hostAddr, proto.AdminSetQuorumWrite)
+	fmt.Println(reqURL)
+	process(reqURL, t)
+	if !server.cluster.EnableQuorumWrite {
+		t.Errorf("enable quorum write failed")
+		return
+	}
+	dataNode, err := server.cluster.dataNode(mds1Addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	task := dataNode.createHeartbeatTask(server.cluster.masterAddr(), server.cluster.EnableQuorumWrite, nil)
+	if request := task.Request.(*proto.HeartBeatRequest); !request.EnableQuorumWrite {
+		t.Errorf("quorum write is not sent to data node in heartbeat")
+	}
+	server.cluster.EnableQuorumWrite = false
+}
+
 func TestGetCluster(t *testing.T) {
 	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminGetCluster)
 	fmt.Println(reqURL)
 	process(reqURL, t)
 }
 
+func TestStatsTree(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?level=%v", hostAddr, proto.AdminStatsTree, proto.StatsLevelRack)
+	process(reqURL, t)
+
+	tree := newStatsTree()
+	tree.update(&nodeStats{addr: mds1Addr, role: proto.NodeRoleData, zone: testZone1, rack: "r1",
+		stats: proto.StorageStats{DataNodes: 1, DataTotal: 100, DataUsed: 10, DataPartitionCount: 2}})
+	tree.update(&nodeStats{addr: mds2Addr, role: proto.NodeRoleData, zone: testZone1, rack: "r2",
+		stats: proto.StorageStats{DataNodes: 1, DataTotal: 100, DataUsed: 20, DataPartitionCount: 3}})
+	tree.update(&nodeStats{addr: mms1Addr, role: proto.NodeRoleMeta, zone: testZone1,
+		stats: proto.StorageStats{MetaNodes: 1, MetaTotal: 50, MetaUsed: 5, MetaPartitionCount: 4}})
+	// the heartbeat replaces the contribution of the node, which moves to another zone
+	tree.update(&nodeStats{addr: mds2Addr, role: proto.NodeRoleData, zone: testZone2, rack: "r2",
+		stats: proto.StorageStats{DataNodes: 1, DataTotal: 100, DataUsed: 30, DataPartitionCount: 3}})
+	root := tree.view("test", "", proto.StatsLevelNode)
+	if root.DataNodes != 2 || root.DataUsed != 40 || root.DataPartitionCount != 5 || root.MetaNodes != 1 ||
+		root.MetaPartitionCount != 4 || len(root.Children) != 2 {
+		t.Errorf("unexpected cluster stats %+v", root)
+		return
+	}
+	zone := root.Children[0]
+	if zone.Name != testZone1 || zone.DataUsed != 10 || zone.MetaUsed != 5 || len(zone.Children) != 2 ||
+		zone.Children[0].Name != "" || zone.Children[0].Children[0].Role != proto.NodeRoleMeta {
+		t.Errorf("unexpected zone stats %+v", zone)
+		return
+	}
+	if zone = tree.view("test", testZone2, proto.StatsLevelZone).Children[0]; zone.DataUsed != 30 || zone.Children != nil {
+		t.Errorf("unexpected zone stats %+v", zone)
+		return
+	}
+	tree.remove(proto.NodeRoleData, mds2Addr)
+	if root = tree.view("test", "", proto.StatsLevelCluster); root.DataNodes != 1 || root.DataUsed != 10 {
+		t.Errorf("unexpected cluster stats %+v after the node is removed", root)
+		return
+	}
+	if len(tree.zones) != 1 {
+		t.Errorf("expect the empty zone is removed, but %v zones", len(tree.zones))
+	}
+}
+
 func TestGetIpAndClusterName(t *testing.T) {
 	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminGetIP)
 	fmt.Println(reqURL)
@@ -302,154 +396,1269 @@ func TestMarkDeleteVol(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	if contains(userInfo.Policy.OwnVols, name) {
-		t.Errorf("expect no vol %v in own vols, but is exist", name)
-		return
+	if contains(userInfo.Policy.OwnVols, name) {
+		t.Errorf("expect no vol %v in own vols, but is exist", name)
+		return
+	}
+}
+
+func TestUndeleteVol(t *testing.T) {
+	name := "undelVol"
+	createVol(name, t)
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminDeleteVol, name, buildAuthKey("cfs"))
+	process(reqURL, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	vol.checkStatus(server.cluster)
+	if _, err = server.cluster.getVol(name); err != nil || vol.status() != markDelete {
+		t.Errorf("expect vol %v pending delete, err %v", name, err)
+		return
+	}
+	if code := replyCode(fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.ClientVol, name, buildAuthKey("cfs")), t); code != proto.ErrCodeVolNotExists {
+		t.Errorf("expect the vol pending delete invisible to the clients, but the code is %v", code)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminUndeleteVol, name, buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.status() != normal {
+		t.Errorf("expect vol %v restored, but the status is %v", name, vol.status())
+		return
+	}
+	userInfo, err := server.user.getUserInfo("cfs")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !contains(userInfo.Policy.OwnVols, name) {
+		t.Errorf("expect vol %v in own vols", name)
+		return
+	}
+	if code := replyCode(reqURL, t); code != proto.ErrCodeVolNotDeleted {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolNotDeleted, code)
+		return
+	}
+
+	gracePeriod := server.cluster.cfg.VolDeleteGracePeriodSec
+	server.cluster.cfg.VolDeleteGracePeriodSec = 0
+	defer func() {
+		server.cluster.cfg.VolDeleteGracePeriodSec = gracePeriod
+	}()
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminDeleteVol, name, buildAuthKey("cfs")), t)
+	if code := replyCode(reqURL, t); code != proto.ErrCodeVolDeleteGraceExpired {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolDeleteGraceExpired, code)
+		return
+	}
+}
+
+func replyCode(reqURL string, t *testing.T) int32 {
+	resp, err := http.Get(reqURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reply := &proto.HTTPReply{}
+	if err = json.NewDecoder(resp.Body).Decode(reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply.Code
+}
+
+func TestSetVolCapacity(t *testing.T) {
+	setVolCapacity(600, proto.AdminVolExpand, t)
+	setVolCapacity(300, proto.AdminVolShrink, t)
+}
+
+func TestUpdateVol(t *testing.T) {
+	capacity := 2000
+	reqURL := fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v",
+		hostAddr, proto.AdminUpdateVol, commonVol.Name, capacity, buildAuthKey("cfs"))
+	process(reqURL, t)
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if vol.FollowerRead != false {
+		t.Errorf("expect FollowerRead is false, but is %v", vol.FollowerRead)
+		return
+	}
+	if vol.enableToken != false {
+		t.Errorf("expect enableToken is false, but is %v", vol.enableToken)
+		return
+	}
+
+	reqURL = fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v&followerRead=true&enableToken=true&zoneName=%v",
+		hostAddr, proto.AdminUpdateVol, commonVol.Name, capacity, buildAuthKey("cfs"), commonVol.zoneName)
+	process(reqURL, t)
+	if vol.FollowerRead != true {
+		t.Errorf("expect FollowerRead is true, but is %v", vol.FollowerRead)
+		return
+	}
+	if vol.enableToken != true {
+		t.Errorf("expect enableToken is true, but is %v", vol.enableToken)
+		return
+	}
+
+}
+
+func TestVolLifecycle(t *testing.T) {
+	rules := []*proto.LifecycleRule{
+		{ID: "expireLogs", Prefix: "logs/2020", ExpirationDays: 30},
+		{ID: "abortUploads", AbortIncompleteMultipartUploadDays: 7},
+		{ID: "disabled", Prefix: "tmp/", ExpirationDays: 1, Disabled: true},
+	}
+	if err := validateLifecycleRules([]*proto.LifecycleRule{{ID: "transition", TransitionStorageClass: proto.StorageClassCold}}); err == nil {
+		t.Errorf("transition rule without days should be refused")
+		return
+	}
+	if err := validateLifecycleRules([]*proto.LifecycleRule{rules[0], rules[0]}); err == nil {
+		t.Errorf("duplicated rules should be refused")
+		return
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminSetVolLifecycle, commonVol.Name, buildAuthKey(commonVol.Owner))
+	post(reqURL, data, t)
+	if len(commonVol.getLifecycleRules()) != len(rules) {
+		t.Errorf("expect %v lifecycle rules, real %v", len(rules), len(commonVol.getLifecycleRules()))
+		return
+	}
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	server.cluster.runVolLifecycle(commonVol)
+	vs := server.cluster.getVolLifecycleStatus(commonVol.Name)
+	for _, rule := range rules {
+		st, ok := vs.get(rule.ID)
+		if !ok {
+			t.Errorf("no status of lifecycle rule[%v]", rule.ID)
+			return
+		}
+		if rule.Disabled {
+			if st.State != proto.LifecycleRuleDisabled || st.Runs != 0 {
+				t.Errorf("disabled lifecycle rule[%v] should not run, status[%v]", rule.ID, st)
+			}
+			continue
+		}
+		if st.State != proto.LifecycleRuleIdle || st.Runs != 1 || st.LastError != "" {
+			t.Errorf("lifecycle rule[%v] unexpected status[%v]", rule.ID, st)
+		}
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetVolLifecycleStatus, commonVol.Name)
+	process(reqURL, t)
+
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminSetVolLifecycle, commonVol.Name, buildAuthKey(commonVol.Owner))
+	post(reqURL, []byte("[]"), t)
+	if len(commonVol.getLifecycleRules()) != 0 {
+		t.Errorf("lifecycle rules should be removed")
+	}
+}
+
+func TestVolLifecycleTransition(t *testing.T) {
+	rules := []*proto.LifecycleRule{{ID: "transition", Prefix: "logs/", TransitionDays: 30, TransitionStorageClass: proto.StorageClassCold}}
+	if err := validateLifecycleRules(rules); err != nil {
+		t.Fatalf("transition rule is refused: %v", err)
+	}
+	if err := validateLifecycleRules([]*proto.LifecycleRule{{ID: "glacier", TransitionDays: 30, TransitionStorageClass: "GLACIER"}}); err == nil {
+		t.Errorf("unknown storage class should be refused")
+	}
+	if err := server.cluster.setVolLifecycleRules(commonVol.Name, buildAuthKey(commonVol.Owner), rules); err != proto.ErrVolNoColdZone {
+		t.Fatalf("expect err[%v] without the cold zone, but is %v", proto.ErrVolNoColdZone, err)
+	}
+	updateURL := "%v%v?name=%v&authKey=%v&capacity=%v&%v"
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, commonVol.Name, buildAuthKey(commonVol.Owner),
+		commonVol.Capacity, "coldZone="+testZone2), t)
+	if view := newSimpleView(commonVol); view.ColdZone != testZone2 {
+		t.Fatalf("expect cold zone %v, but is %v", testZone2, view.ColdZone)
+	}
+	if err := server.cluster.setVolLifecycleRules(commonVol.Name, buildAuthKey(commonVol.Owner), rules); err != nil {
+		t.Fatal(err)
+	}
+	if code := replyCode(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, commonVol.Name,
+		buildAuthKey(commonVol.Owner), commonVol.Capacity, "coldZone="), t); code == proto.ErrCodeSuccess {
+		t.Errorf("cold zone is removed with the transition rules")
+	}
+	defer func() {
+		server.cluster.setVolLifecycleRules(commonVol.Name, buildAuthKey(commonVol.Owner), nil)
+		process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, commonVol.Name, buildAuthKey(commonVol.Owner),
+			commonVol.Capacity, "coldZone="), t)
+	}()
+
+	cold, err := server.cluster.createColdDataPartition(commonVol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commonVol.dataPartitions.del(cold)
+	if !cold.isCold || cold.Status != proto.ReadOnly {
+		t.Errorf("dp[%v] isCold[%v] status[%v] is not a read-only cold data partition", cold.PartitionID, cold.isCold,
+			cold.Status)
+	}
+	for _, host := range cold.Hosts {
+		if dataNode, err := server.cluster.dataNode(host); err != nil || dataNode.ZoneName != testZone2 {
+			t.Errorf("cold dp[%v] host[%v] is not in the cold zone", cold.PartitionID, host)
+		}
+	}
+	if restored := newVolFromVolValue(newVolValue(commonVol)); restored.coldZone != testZone2 {
+		t.Errorf("expect cold zone persisted on vol[%v]", commonVol.Name)
+	}
+	partition := commonVol.dataPartitions.partitions[0]
+	coldExtentID, err := server.cluster.copyExtentToColdPartition(partition, cold, 1025, 10*time.Second)
+	if err != nil || coldExtentID == 0 {
+		t.Fatalf("copy extent to cold dp[%v], extent[%v] err[%v]", cold.PartitionID, coldExtentID, err)
+	}
+
+	server.cluster.runVolLifecycle(commonVol)
+	st, ok := server.cluster.getVolLifecycleStatus(commonVol.Name).get(rules[0].ID)
+	if !ok || st.State != proto.LifecycleRuleIdle || st.Runs != 1 || st.LastError != "" {
+		t.Errorf("lifecycle rule[%v] unexpected status[%v]", rules[0].ID, st)
+	}
+}
+
+func setVolCapacity(capacity uint64, url string, t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v",
+		hostAddr, url, commonVol.Name, capacity, buildAuthKey("cfs"))
+	process(reqURL, t)
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if vol.Capacity != capacity {
+		t.Errorf("expect capacity is %v, but is %v", capacity, vol.Capacity)
+		return
+	}
+}
+
+func buildAuthKey(owner string) string {
+	h := md5.New()
+	h.Write([]byte(owner))
+	cipherStr := h.Sum(nil)
+	return hex.EncodeToString(cipherStr)
+}
+
+func TestGetVolSimpleInfo(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetVol, commonVol.Name)
+	process(reqURL, t)
+}
+
+func TestCreateVol(t *testing.T) {
+	name := "test_create_vol"
+	reqURL := fmt.Sprintf("%v%v?name=%v&replicas=3&type=extent&capacity=100&owner=cfstest&zoneName=%v", hostAddr, proto.AdminCreateVol, name, testZone2)
+	fmt.Println(reqURL)
+	process(reqURL, t)
+	userInfo, err := server.user.getUserInfo("cfstest")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !contains(userInfo.Policy.OwnVols, name) {
+		t.Errorf("expect vol %v in own vols, but is not", name)
+		return
+	}
+}
+
+func TestCreateCaseInsensitiveVol(t *testing.T) {
+	name := "test_case_insensitive_vol"
+	reqURL := fmt.Sprintf("%v%v?name=%v&replicas=3&capacity=100&owner=cfstest&zoneName=%v&caseInsensitive=true",
+		hostAddr, proto.AdminCreateVol, name, testZone2)
+	process(reqURL, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !vol.caseInsensitive || !newVolFromVolValue(newVolValue(vol)).caseInsensitive {
+		t.Errorf("vol[%v] is not case-insensitive", name)
+		return
+	}
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		for _, task := range mp.buildNewMetaPartitionTasks(nil, mp.Peers, name, vol.caseInsensitive, "") {
+			if req := task.Request.(*proto.CreateMetaPartitionRequest); !req.CaseInsensitive {
+				t.Errorf("mp[%v] is created case-sensitive", mp.PartitionID)
+			}
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminBootstrap)
+	manifest := &proto.BootstrapManifest{
+		DataNodes: []*proto.BootstrapNode{{Addr: mds1Addr, ZoneName: testZone1}},
+		MetaNodes: []*proto.BootstrapNode{{Addr: mms1Addr, ZoneName: testZone1}},
+		Volume:    &proto.BootstrapVolume{Name: "test_bootstrap_vol", Owner: "cfstest", Capacity: 100, ZoneName: testZone2},
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fmt.Println(reqURL)
+	// the steps done are skipped when the manifest is submitted again
+	for _, expectVolStatus := range []string{proto.BootstrapStepCreated, proto.BootstrapStepExists} {
+		reply := post(reqURL, data, t)
+		if reply == nil {
+			return
+		}
+		result := &proto.BootstrapResult{}
+		body, _ := json.Marshal(reply.Data)
+		if err = json.Unmarshal(body, result); err != nil {
+			t.Error(err)
+			return
+		}
+		if result.Failed != 0 || len(result.Steps) != 3 {
+			t.Errorf("unexpected bootstrap result %v", string(body))
+			return
+		}
+		if result.Steps[0].Status != proto.BootstrapStepExists || result.Steps[1].Status != proto.BootstrapStepExists ||
+			result.Steps[2].Status != expectVolStatus {
+			t.Errorf("unexpected bootstrap result %v", string(body))
+			return
+		}
+	}
+}
+
+func TestCreateMetaPartition(t *testing.T) {
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	commonVol.checkMetaPartitions(server.cluster)
+	createMetaPartition(commonVol, t)
+}
+
+func TestCreateDataPartition(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?count=2&name=%v&type=extent",
+		hostAddr, proto.AdminCreateDataPartition, commonVol.Name)
+	process(reqURL, t)
+}
+
+func TestDataNodeSpare(t *testing.T) {
+	spare := newDataNode("127.0.0.1:9199", testZone1, server.cluster.Name)
+	spare.isActive = true
+	spare.AvailableSpace = 100 * util.GB
+	spare.IsSpare = true
+	if spare.isWriteAble() {
+		t.Errorf("spare dataNode[%v] should not be writable", spare.Addr)
+		return
+	}
+	dataNode, err := server.cluster.dataNode(mds1Addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(server.cluster.getAllDataPartitionIDByDatanode(mds1Addr)) != 0 {
+		if err = server.cluster.setDataNodeSpare(dataNode, true); err == nil {
+			server.cluster.setDataNodeSpare(dataNode, false)
+			t.Errorf("dataNode[%v] with data partitions should not be set to spare", mds1Addr)
+			return
+		}
+	}
+	if _, err = server.cluster.promoteSpareDataNode("noSpareZone"); err == nil {
+		t.Errorf("promote spare dataNode in zone without spare should fail")
+	}
+}
+
+func TestMaintenancePlan(t *testing.T) {
+	addrs := []string{"127.0.0.1:9130", "127.0.0.1:9131"}
+	for _, addr := range addrs {
+		addDataServer(addr, testZone1)
+	}
+	server.cluster.checkDataNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	if err := server.cluster.validateMaintenancePlan(&proto.MaintenancePlan{Name: "badPlan",
+		Steps: []*proto.MaintenanceStep{{Type: proto.PlanStepDecommissionMetaNode, Addr: addrs[0]}}}); err == nil {
+		t.Errorf("plan decommissioning the data node as a meta node should be refused")
+		return
+	}
+	plan := &proto.MaintenancePlan{Name: "offlineRack1", Steps: []*proto.MaintenanceStep{
+		{Type: proto.PlanStepDecommissionDataNode, Addr: addrs[0]},
+		{Type: proto.PlanStepDecommissionDataNode, Addr: addrs[1]},
+	}}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	post(fmt.Sprintf("%v%v", hostAddr, proto.AdminSubmitMaintenancePlan), data, t)
+	p, err := server.cluster.getMaintenancePlan(plan.Name)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = server.cluster.submitMaintenancePlan(&proto.MaintenancePlan{Name: plan.Name, Steps: plan.Steps}); err != proto.ErrDuplicateMaintenancePlan {
+		t.Errorf("duplicate plan should be refused, err[%v]", err)
+		return
+	}
+
+	// take the plan from the scheduler, so that it is advanced by the test only
+	process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminPauseMaintenancePlan, plan.Name), t)
+	for !atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer atomic.StoreInt32(&p.running, 0)
+	if p.copy().State != proto.PlanPaused || server.cluster.advanceMaintenancePlan(p) {
+		t.Errorf("paused plan should not be advanced, plan[%v]", p.view())
+		return
+	}
+	process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminResumeMaintenancePlan, plan.Name), t)
+
+	badDataPartitionIds, badMetaPartitionIds := server.cluster.BadDataPartitionIds, server.cluster.BadMetaPartitionIds
+	server.cluster.BadDataPartitionIds, server.cluster.BadMetaPartitionIds = new(sync.Map), new(sync.Map)
+	defer func() {
+		server.cluster.BadDataPartitionIds, server.cluster.BadMetaPartitionIds = badDataPartitionIds, badMetaPartitionIds
+	}()
+	server.cluster.putBadDataPartitionIDs(nil, mds1Addr, 1)
+	if !server.cluster.advanceMaintenancePlan(p) || p.copy().NextStep != 0 {
+		t.Errorf("plan should wait for the recovery, plan[%v]", p.view())
+		return
+	}
+	server.cluster.BadDataPartitionIds.Delete(fmt.Sprintf("%s:%s", mds1Addr, ""))
+	for i, addr := range addrs {
+		if !server.cluster.advanceMaintenancePlan(p) {
+			t.Errorf("plan should be advanced, plan[%v]", p.view())
+			return
+		}
+		if _, err = server.cluster.dataNode(addr); err == nil || p.copy().NextStep != i+1 {
+			t.Errorf("step[%v] should decommission dataNode[%v], plan[%v]", i, addr, p.view())
+			return
+		}
+	}
+	if server.cluster.advanceMaintenancePlan(p) || p.copy().State != proto.PlanSucceeded {
+		t.Errorf("plan should succeed, plan[%v]", p.view())
+		return
+	}
+	if err = server.cluster.setMaintenancePlanState(plan.Name, proto.PlanAborted); err != proto.ErrMaintenancePlanState {
+		t.Errorf("succeeded plan should not be aborted, err[%v]", err)
+	}
+	process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetMaintenancePlan, plan.Name), t)
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminListMaintenancePlans), t)
+}
+
+func TestCheckDataNodeRegistration(t *testing.T) {
+	if _, _, err := server.cluster.checkDataNodeRegistration(mds1Addr, "", time.Now().Unix()-3600); err != proto.ErrNodeClockSkew {
+		t.Errorf("registration with clock skew should be refused, err[%v]", err)
+		return
+	}
+	dataNode, err := server.cluster.dataNode(mds1Addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = server.cluster.updateDataNodeInstance(dataNode, "instance1"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, _, err = server.cluster.checkDataNodeRegistration(mds1Addr, "instance1", time.Now().Unix()); err != nil {
+		t.Errorf("registration of the same instance should pass, err[%v]", err)
+		return
+	}
+	if _, _, err = server.cluster.checkDataNodeRegistration(mds2Addr, "instance1", time.Now().Unix()); err != proto.ErrDuplicateNodeInstance {
+		t.Errorf("registration of a cloned instance should be refused, err[%v]", err)
+		return
+	}
+	if dataNode.isActive {
+		if _, _, err = server.cluster.checkDataNodeRegistration(mds1Addr, "instance2", time.Now().Unix()); err != proto.ErrDuplicateNodeAddr {
+			t.Errorf("registration of an active address by another instance should be refused, err[%v]", err)
+			return
+		}
+	}
+}
+
+func TestCheckMetaNodeRegistration(t *testing.T) {
+	c := server.cluster
+	if _, err := c.checkMetaNodeRegistration(mms1Addr, "", time.Now().Unix()-3600); err != proto.ErrNodeClockSkew {
+		t.Fatalf("registration with clock skew should be refused, err[%v]", err)
+	}
+	metaNode, err := c.metaNode(mms1Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.addMetaNode(mms1Addr, testZone1, "metaInstance1"); err != nil {
+		t.Fatal(err)
+	}
+	if metaNode.InstanceID != "metaInstance1" {
+		t.Fatalf("the instance should be recorded, but got %v", metaNode.InstanceID)
+	}
+	if _, err = c.checkMetaNodeRegistration(mms1Addr, "metaInstance1", time.Now().Unix()); err != nil {
+		t.Fatalf("registration of the same instance should pass, err[%v]", err)
+	}
+	metaNode.RLock()
+	isActive := metaNode.IsActive
+	metaNode.RUnlock()
+	if !isActive {
+		return
+	}
+	if _, err = c.checkMetaNodeRegistration(mms2Addr, "metaInstance1", time.Now().Unix()); err != proto.ErrDuplicateNodeInstance {
+		t.Fatalf("registration of a cloned instance should be refused, err[%v]", err)
+	}
+	if _, err = c.checkMetaNodeRegistration(mms1Addr, "metaInstance2", time.Now().Unix()); err != proto.ErrDuplicateNodeAddr {
+		t.Fatalf("registration of an active address by another instance should be refused, err[%v]", err)
+	}
+}
+
+func TestReaddressDataNode(t *testing.T) {
+	const (
+		staleAddr  = "127.0.0.1:30001"
+		newAddr    = "127.0.0.1:30002"
+		instanceID = "readdressed"
+	)
+	c := server.cluster
+	id, err := c.addDataNode(staleAddr, testZone2, instanceID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleNode, err := c.dataNode(staleAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol := newVol(1001, "readdressVol", "cfs", "", util.DefaultDataPartitionSize, 10, 1, 1, false, false, false, false,
+		time.Now().Unix(), "")
+	dp := newDataPartition(100001, 1, vol.Name, vol.ID)
+	dp.Hosts = []string{staleAddr}
+	dp.Peers = []proto.Peer{{ID: id, Addr: staleAddr}}
+	dp.Replicas = []*DataReplica{newDataReplica(staleNode)}
+	vol.dataPartitions.put(dp)
+	c.putVol(vol)
+	defer c.deleteVol(vol.Name)
+
+	if staleNode, _, err = c.checkDataNodeRegistration(newAddr, instanceID, time.Now().Unix()); err != nil ||
+		staleNode == nil || staleNode.Addr != staleAddr {
+		t.Fatalf("the inactive record of the instance should be moved, stale node %v err %v", staleNode, err)
+	}
+	newID, err := c.readdressDataNode(staleNode, newAddr)
+	if err != nil || newID != id {
+		t.Fatalf("the ID %v should be kept, but got %v err %v", id, newID, err)
+	}
+	if _, err = c.dataNode(staleAddr); err == nil {
+		t.Fatalf("the stale address should be retired")
+	}
+	dataNode, err := c.dataNode(newAddr)
+	if err != nil || dataNode.ID != id || dataNode.InstanceID != instanceID {
+		t.Fatalf("unexpected data node %v err %v", dataNode, err)
+	}
+	defer func() {
+		c.delDataNodeFromCache(dataNode)
+		c.syncDeleteDataNode(dataNode)
+	}()
+	if dp.Hosts[0] != newAddr || dp.Peers[0].Addr != newAddr || dp.Replicas[0].Addr != newAddr ||
+		dp.Replicas[0].dataNode != dataNode {
+		t.Fatalf("the partition should be migrated, hosts %v peers %v", dp.Hosts, dp.Peers)
+	}
+	if staleNode, _, err = c.checkDataNodeRegistration(newAddr, instanceID, time.Now().Unix()); err != nil || staleNode != nil {
+		t.Fatalf("the registration with the new address should pass, stale node %v err %v", staleNode, err)
+	}
+}
+
+func TestGetDataPartition(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	partition := commonVol.dataPartitions.partitions[0]
+	reqURL := fmt.Sprintf("%v%v?id=%v", hostAddr, proto.AdminGetDataPartition, partition.PartitionID)
+	process(reqURL, t)
+
+	reqURL = fmt.Sprintf("%v%v?id=%v&name=%v", hostAddr, proto.AdminGetDataPartition, partition.PartitionID, partition.VolName)
+	process(reqURL, t)
+}
+
+func TestLoadDataPartition(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	partition := commonVol.dataPartitions.partitions[0]
+	reqURL := fmt.Sprintf("%v%v?id=%v&name=%v",
+		hostAddr, proto.AdminLoadDataPartition, partition.PartitionID, commonVol.Name)
+	process(reqURL, t)
+}
+
+func TestDataPartitionDecommission(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	server.cluster.checkDataNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	partition := commonVol.dataPartitions.partitions[0]
+	offlineAddr := partition.Hosts[0]
+	reqURL := fmt.Sprintf("%v%v?name=%v&id=%v&addr=%v",
+		hostAddr, proto.AdminDecommissionDataPartition, commonVol.Name, partition.PartitionID, offlineAddr)
+	process(reqURL, t)
+	if contains(partition.Hosts, offlineAddr) {
+		t.Errorf("offlineAddr[%v],hosts[%v]", offlineAddr, partition.Hosts)
+		return
+	}
+	partition.isRecover = false
+}
+
+func TestFreezeDataPartition(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	partition := commonVol.dataPartitions.partitions[0]
+	reqURL := fmt.Sprintf("%v%v?name=%v&id=%v",
+		hostAddr, proto.AdminFreezeDataPartition, commonVol.Name, partition.PartitionID)
+	process(reqURL, t)
+	if !partition.isFrozen || partition.Status != proto.ReadOnly {
+		t.Errorf("dp[%v] is not frozen, status[%v]", partition.PartitionID, partition.Status)
+		return
+	}
+	if err := server.cluster.validateDecommissionDataPartition(partition, partition.Hosts[0]); err != proto.ErrDataPartitionFrozen {
+		t.Errorf("frozen dp[%v] should not be decommissioned, err[%v]", partition.PartitionID, err)
+	}
+	if _, err := server.cluster.markDataPartitionToDelete(commonVol, partition, true); err != proto.ErrDataPartitionFrozen {
+		t.Errorf("frozen dp[%v] should not be deleted, err[%v]", partition.PartitionID, err)
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&id=%v",
+		hostAddr, proto.AdminUnfreezeDataPartition, commonVol.Name, partition.PartitionID)
+	process(reqURL, t)
+	if partition.isFrozen {
+		t.Errorf("dp[%v] is not unfrozen", partition.PartitionID)
+	}
+}
+
+func TestCopyExtent(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	partition := commonVol.dataPartitions.partitions[0]
+	if len(partition.Hosts) < 2 {
+		t.Errorf("dp[%v] has too few hosts %v", partition.PartitionID, partition.Hosts)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v?id=%v&addr=%v&sourceAddr=%v&extentID=%v&size=%v&rateLimit=%v",
+		hostAddr, proto.AdminCopyExtent, partition.PartitionID, partition.Hosts[1], partition.Hosts[0], 1025, util.MB, util.MB)
+	reply := process(reqURL, t)
+	if reply == nil {
+		return
+	}
+	jobID := uint64(reply.Data.(float64))
+	var job *proto.ExtentCopyJob
+	for i := 0; i < 20; i++ {
+		if jobs := server.cluster.getExtentCopyJobs(jobID); len(jobs) == 1 && jobs[0].State != proto.ExtentCopyRunning {
+			job = jobs[0]
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if job == nil || job.State != proto.ExtentCopySucceeded || job.CopiedBytes != util.MB || job.DestAddr != partition.Hosts[1] {
+		t.Errorf("extent copy job[%v] is not succeeded, job %v", jobID, job)
+	}
+	if _, err := server.cluster.copyExtent(&proto.CopyExtentRequest{PartitionId: partition.PartitionID, ExtentId: 1025,
+		SourceAddr: partition.Hosts[0]}, partition.Hosts[0]); err == nil {
+		t.Errorf("extent copied from dp[%v] replica[%v] to itself", partition.PartitionID, partition.Hosts[0])
+	}
+}
+
+func TestResizeDataPartition(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	partition := commonVol.dataPartitions.partitions[len(commonVol.dataPartitions.partitions)-1]
+	size := partition.size/util.GB + 8
+	reqURL := fmt.Sprintf("%v%v?name=%v&id=%v&size=%v",
+		hostAddr, proto.AdminResizeDataPartition, commonVol.Name, partition.PartitionID, size)
+	process(reqURL, t)
+	if partition.size != size*util.GB || partition.total != partition.size {
+		t.Errorf("dp[%v] is not resized, size[%v] total[%v]", partition.PartitionID, partition.size, partition.total)
+		return
+	}
+	for _, replica := range partition.Replicas {
+		if replica.Total != partition.size {
+			t.Errorf("replica[%v] of dp[%v] is not resized, total[%v]", replica.Addr, partition.PartitionID, replica.Total)
+		}
+	}
+	if err := server.cluster.resizeDataPartition(commonVol, partition, partition.size-util.GB); err == nil {
+		t.Errorf("dp[%v] should not shrink", partition.PartitionID)
+	}
+}
+
+func TestDegradePartitions(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	dp := commonVol.dataPartitions.partitions[0]
+	reqURL := fmt.Sprintf("%v%v?name=%v&id=%v",
+		hostAddr, proto.AdminDegradeDataPartition, commonVol.Name, dp.PartitionID)
+	process(reqURL, t)
+	if !dp.isDegraded || dp.Status != proto.ReadOnly || !newDataPartitionValue(dp).IsDegraded {
+		t.Errorf("dp[%v] is not degraded, status[%v]", dp.PartitionID, dp.Status)
+		return
+	}
+	for _, replica := range dp.Replicas {
+		if !replica.IsDegraded {
+			t.Errorf("replica[%v] of dp[%v] is not degraded", replica.Addr, dp.PartitionID)
+		}
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&id=%v",
+		hostAddr, proto.AdminUndegradeDataPartition, commonVol.Name, dp.PartitionID)
+	process(reqURL, t)
+	if dp.isDegraded {
+		t.Errorf("dp[%v] is not undegraded", dp.PartitionID)
+	}
+
+	var mp *MetaPartition
+	for _, mp = range commonVol.cloneMetaPartitionMap() {
+		break
+	}
+	if mp == nil {
+		t.Errorf("no meta partitions")
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?id=%v", hostAddr, proto.AdminDegradeMetaPartition, mp.PartitionID)
+	process(reqURL, t)
+	if !mp.isDegraded || !newMetaPartitionValue(mp).IsDegraded {
+		t.Errorf("mp[%v] is not degraded", mp.PartitionID)
+		return
+	}
+	for _, replica := range mp.Replicas {
+		if !replica.IsDegraded {
+			t.Errorf("replica[%v] of mp[%v] is not degraded", replica.Addr, mp.PartitionID)
+		}
+	}
+	reqURL = fmt.Sprintf("%v%v?id=%v", hostAddr, proto.AdminUndegradeMetaPartition, mp.PartitionID)
+	process(reqURL, t)
+	if mp.isDegraded {
+		t.Errorf("mp[%v] is not undegraded", mp.PartitionID)
+	}
+}
+
+func TestFreezeVol(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	// the data partition frozen before the vol is kept frozen when the vol is thawed
+	pinned := commonVol.dataPartitions.partitions[0]
+	if err := server.cluster.setDataPartitionFrozen(commonVol, pinned, true); err != nil {
+		t.Error(err)
+		return
+	}
+	defer server.cluster.setDataPartitionFrozen(commonVol, pinned, false)
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminFreezeVol, commonVolName, buildAuthKey("cfs"))
+	reply := process(reqURL, t)
+	if reply == nil {
+		return
+	}
+	data, err := json.Marshal(reply.Data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	view := &proto.VolFreezeView{}
+	if err = json.Unmarshal(data, view); err != nil {
+		t.Error(err)
+		return
+	}
+	if view.Token == "" || len(view.MetaPartitions) != len(commonVol.MetaPartitions) {
+		t.Errorf("unexpected freeze view[%v]", string(data))
+		return
+	}
+	for _, mp := range commonVol.MetaPartitions {
+		for _, mr := range mp.Replicas {
+			if !mr.IsFrozen {
+				t.Errorf("replica[%v] of mp[%v] is not frozen", mr.Addr, mp.PartitionID)
+			}
+		}
+	}
+	for _, dp := range commonVol.dataPartitions.partitions {
+		if !dp.isFrozen {
+			t.Errorf("dp[%v] is not frozen", dp.PartitionID)
+		}
+	}
+	if code := replyCode(reqURL, t); code != proto.ErrCodeVolFrozen {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolFrozen, code)
+	}
+	thawURL := func(token string) string {
+		return fmt.Sprintf("%v%v?name=%v&authKey=%v&token=%v", hostAddr, proto.AdminThawVol, commonVolName,
+			buildAuthKey("cfs"), token)
+	}
+	if code := replyCode(thawURL("invalid"), t); code != proto.ErrCodeVolFreezeTokenNotMatch {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolFreezeTokenNotMatch, code)
+	}
+	process(thawURL(view.Token), t)
+	if commonVol.isFrozen() {
+		t.Errorf("vol[%v] is not thawed", commonVolName)
+		return
+	}
+	for _, dp := range commonVol.dataPartitions.partitions {
+		if dp.isFrozen != (dp == pinned) {
+			t.Errorf("dp[%v] isFrozen[%v] after the vol is thawed", dp.PartitionID, dp.isFrozen)
+		}
+	}
+	if code := replyCode(thawURL(view.Token), t); code != proto.ErrCodeVolNotFrozen {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolNotFrozen, code)
+	}
+}
+
+func TestReportBadBlock(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	partition := commonVol.dataPartitions.partitions[0]
+	report := &proto.DataBlockReport{
+		PartitionID: partition.PartitionID,
+		ExtentID:    1025,
+		Size:        128 * 1024,
+		Addr:        partition.Hosts[0],
+		SourceAddr:  partition.Hosts[0],
+	}
+	if err := server.cluster.repairDataBlock(report); err == nil {
+		t.Errorf("the corrupted replica should not be the source")
+		return
+	}
+	report.SourceAddr = partition.Hosts[1]
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	post(fmt.Sprintf("%v%v", hostAddr, proto.ClientReportBadBlock), data, t)
+	for i := 0; i < 10; i++ {
+		if _, ok := server.cluster.blockRepairs.Load(blockRepairKey(report)); !ok {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	t.Errorf("the blocks of dp[%v] on [%v] are not repaired", partition.PartitionID, report.Addr)
+}
+
+func TestDeleteDataPartition(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	partition := commonVol.dataPartitions.partitions[len(commonVol.dataPartitions.partitions)-1]
+	reqURL := fmt.Sprintf("%v%v?name=%v&id=%v",
+		hostAddr, proto.AdminCheckDataPartitionRef, commonVol.Name, partition.PartitionID)
+	process(reqURL, t)
+	reqURL = fmt.Sprintf("%v%v?name=%v&id=%v",
+		hostAddr, proto.AdminDeleteDataPartition, commonVol.Name, partition.PartitionID)
+	process(reqURL, t)
+	if !partition.isPendingDelete || partition.Status != proto.ReadOnly {
+		t.Errorf("dp[%v] is not marked to be deleted, status[%v]", partition.PartitionID, partition.Status)
+		return
+	}
+	partition.pendingDeleteTime -= defaultSecondsToDeleteDataPartition
+	server.cluster.deletePendingDataPartitions()
+	if _, err := commonVol.getDataPartitionByID(partition.PartitionID); err == nil {
+		t.Errorf("dp[%v] is not deleted", partition.PartitionID)
+	}
+}
+
+//func TestGetAllVols(t *testing.T) {
+//	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.GetALLVols)
+//	process(reqURL, t)
+//}
+//
+func TestPlacementDiff(t *testing.T) {
+	rr := newReportedReplicas()
+	rr.add(1, commonVolName, "127.0.0.1:1")
+	rr.add(1, commonVolName, "127.0.0.1:2")
+	rr.add(1, commonVolName, "127.0.0.1:4")
+	rr.add(2, commonVolName, "127.0.0.1:1")
+	rr.inactive["127.0.0.1:3"] = true
+	d := rr.diff(1, proto.PartitionTypeData, commonVolName, []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"})
+	if d == nil || len(d.MissingHosts) != 0 || len(d.InactiveHosts) != 1 ||
+		len(d.UnexpectedHosts) != 1 || d.UnexpectedHosts[0] != "127.0.0.1:4" {
+		t.Errorf("unexpected placement diff %v", d)
+		return
+	}
+	if orphans := rr.orphans(proto.PartitionTypeData, ""); len(orphans) != 1 || orphans[0].PartitionID != 2 {
+		t.Errorf("unexpected orphan partitions %v", orphans)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminPlacementDiff, commonVolName)
+	process(reqURL, t)
+	reqURL = fmt.Sprintf("%v%v?type=%v", hostAddr, proto.AdminPlacementDiff, proto.PartitionTypeMeta)
+	process(reqURL, t)
+}
+
+func TestDpAffinity(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&dpAffinity=%v",
+		hostAddr, proto.AdminUpdateVol, commonVolName, buildAuthKey("cfs"), proto.DpAffinityAntiColocate)
+	process(reqURL, t)
+	if vol.dpAffinity != proto.DpAffinityAntiColocate {
+		t.Errorf("expect dpAffinity is %v, but is %v", proto.DpAffinityAntiColocate, vol.dpAffinity)
+		return
+	}
+	// all the mock nodes are on the same host, so the data partition is created by falling back to all the data nodes
+	if excludeHosts := server.cluster.dataNodesExcludedByAffinity(vol); len(excludeHosts) != server.cluster.dataNodeCount() {
+		t.Errorf("expect all the data nodes are excluded, but excluded %v", excludeHosts)
+		return
+	}
+	if _, err = server.cluster.createDataPartition(commonVolName, 1, commonVol.allocationEpoch()); err != nil {
+		t.Error(err)
+		return
+	}
+	vol.dpAffinity = proto.DpAffinityColocate
+	if excludeHosts := server.cluster.dataNodesExcludedByAffinity(vol); len(excludeHosts) != 0 {
+		t.Errorf("expect no data nodes are excluded, but excluded %v", excludeHosts)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&dpAffinity=", hostAddr, proto.AdminUpdateVol, commonVolName, buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.dpAffinity != proto.DpAffinityNone {
+		t.Errorf("expect dpAffinity is reset, but is %v", vol.dpAffinity)
+	}
+}
+
+func TestFailureDomain(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&failureDomain=%v",
+		hostAddr, proto.AdminUpdateVol, commonVolName, buildAuthKey("cfs"), proto.FailureDomainHost)
+	process(reqURL, t)
+	if vol.failureDomain != proto.FailureDomainHost {
+		t.Errorf("expect failureDomain is %v, but is %v", proto.FailureDomainHost, vol.failureDomain)
+		return
+	}
+	// all the mock nodes are on the same host, so no placement keeps the replicas on different hosts
+	count := vol.getDataPartitionsCount()
+	if _, err = server.cluster.createDataPartition(commonVolName, 1, commonVol.allocationEpoch()); err == nil || !strings.Contains(err.Error(), "same host") {
+		t.Errorf("expect the data partition is rejected on the same host, but err[%v]", err)
+		return
+	}
+	if vol.getDataPartitionsCount() != count {
+		t.Errorf("expect no data partition is created, but %v are created", vol.getDataPartitionsCount()-count)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&failureDomain=", hostAddr, proto.AdminUpdateVol, commonVolName, buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.failureDomain != proto.FailureDomainNone {
+		t.Errorf("expect failureDomain is reset, but is %v", vol.failureDomain)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?count=1&name=%v", hostAddr, proto.AdminCreateDataPartition, commonVolName)
+	reply := process(reqURL, t)
+	if reply == nil {
+		return
+	}
+	data, _ := json.Marshal(reply.Data)
+	creation := &proto.DataPartitionCreation{}
+	if err = json.Unmarshal(data, creation); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(creation.Decisions) != 1 || len(creation.Decisions[0].Replicas) != int(vol.dpReplicaNum) ||
+		creation.Decisions[0].Replicas[0].Zone == "" {
+		t.Errorf("expect the placement decision of the data partition, but got %v", string(data))
+	}
+}
+
+func TestDataPartitionCreationQueue(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminDataPartitionCreations)
+	process(reqURL, t)
+
+	cfg := newClusterConfig()
+	cfg.DpCreationConcurrency, cfg.DpCreationRate, cfg.VolDpCreationQueueSize, cfg.DpCreationWaitSec = 1, 0, 1, 1
+	q := newDpCreationQueue(cfg)
+	if err := q.acquire("a"); err != nil {
+		t.Fatal(err)
+	}
+	admitted := make(chan string, 2)
+	for _, volName := range []string{"b", "a"} {
+		go func(volName string) {
+			if err := q.acquire(volName); err == nil {
+				admitted <- volName
+			}
+		}(volName)
+		for len(q.view().Waiting) == 0 || q.view().Waiting[len(q.view().Waiting)-1].VolName != volName {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if err := q.acquire("a"); err != proto.ErrDataPartitionCreationQueueFull {
+		t.Fatalf("expect the queue of the vol is full, but err[%v]", err)
+	}
+	// the waiter of the other vol is admitted first, and the one of the same vol waits for it
+	q.release("a")
+	if volName := <-admitted; volName != "b" {
+		t.Fatalf("expect vol[b] is admitted, but vol[%v]", volName)
+	}
+	q.release("b")
+	if volName := <-admitted; volName != "a" {
+		t.Fatalf("expect vol[a] is admitted, but vol[%v]", volName)
+	}
+	if err := q.acquire("b"); err != proto.ErrDataPartitionCreationTimeout {
+		t.Fatalf("expect the creation times out, but err[%v]", err)
+	}
+	view := q.view()
+	if view.Running["a"] != 1 || len(view.Waiting) != 0 || view.Admitted != 3 || view.Rejected != 1 || view.TimedOut != 1 {
+		t.Fatalf("unexpected queue %+v", view)
+	}
+}
+
+func TestTenant(t *testing.T) {
+	process(fmt.Sprintf("%v%v?name=tenant1&owner=cfstenant&capacity=300&acl=cfs:ReadOnly", hostAddr,
+		proto.AdminCreateTenant), t)
+	if code := replyCode(fmt.Sprintf("%v%v?name=tenant1&owner=cfstenant&capacity=300", hostAddr,
+		proto.AdminCreateTenant), t); code != proto.ErrCodeDuplicateTenant {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeDuplicateTenant, code)
+	}
+	createURL := "%v%v?name=%v&replicas=3&capacity=%v&tenant=tenant1&zoneName=%v"
+	process(fmt.Sprintf(createURL, hostAddr, proto.AdminCreateVol, "tenantVol1", 200, testZone2), t)
+	vol, err := server.cluster.getVol("tenantVol1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Owner != "cfstenant" {
+		t.Errorf("expect the vol owned by the owner of the tenant, but is %v", vol.Owner)
+	}
+	userInfo, err := server.user.getUserInfo("cfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := userInfo.Policy.AuthorizedVols[vol.Name]; !ok {
+		t.Errorf("expect the ACL of the tenant granted on vol %v", vol.Name)
+	}
+	if code := replyCode(fmt.Sprintf(createURL, hostAddr, proto.AdminCreateVol, "tenantVol2", 200, testZone2),
+		t); code != proto.ErrCodeTenantQuotaExceeded {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTenantQuotaExceeded, code)
+	}
+	expandURL := "%v%v?name=%v&capacity=%v&authKey=%v"
+	if code := replyCode(fmt.Sprintf(expandURL, hostAddr, proto.AdminVolExpand, vol.Name, 400, buildAuthKey("cfstenant")),
+		t); code != proto.ErrCodeTenantQuotaExceeded {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTenantQuotaExceeded, code)
+	}
+	process(fmt.Sprintf(expandURL, hostAddr, proto.AdminVolExpand, vol.Name, 300, buildAuthKey("cfstenant")), t)
+	if code := replyCode(fmt.Sprintf("%v%v?name=tenant1&volName=%v", hostAddr, proto.AdminTenantAddVol,
+		commonVol.Name), t); code != proto.ErrCodeTenantQuotaExceeded {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTenantQuotaExceeded, code)
+	}
+	if code := replyCode(fmt.Sprintf("%v%v?name=tenant1&capacity=200", hostAddr, proto.AdminUpdateTenant),
+		t); code != proto.ErrCodeTenantQuotaExceeded {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTenantQuotaExceeded, code)
+	}
+	stats, err := server.cluster.getTenantStats("tenant1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].AllocatedCapacity != 300 || len(stats[0].Vols) != 1 {
+		t.Errorf("expect 300 GB allocated to 1 vol, but is %v GB to %v vols", stats[0].AllocatedCapacity,
+			len(stats[0].Vols))
+	}
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminTenantStats), t)
+	if code := replyCode(fmt.Sprintf("%v%v?name=tenant1", hostAddr, proto.AdminDeleteTenant),
+		t); code != proto.ErrCodeTenantNotEmpty {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTenantNotEmpty, code)
+	}
+	process(fmt.Sprintf("%v%v?name=tenant1&volName=%v", hostAddr, proto.AdminTenantRemoveVol, vol.Name), t)
+	if userInfo, err = server.user.getUserInfo("cfs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := userInfo.Policy.AuthorizedVols[vol.Name]; ok {
+		t.Errorf("expect the ACL of the tenant revoked from vol %v", vol.Name)
+	}
+	process(fmt.Sprintf("%v%v?name=tenant1", hostAddr, proto.AdminDeleteTenant), t)
+	if _, err = server.cluster.getTenant("tenant1"); err != proto.ErrTenantNotExists {
+		t.Errorf("expect tenant1 deleted, but err is %v", err)
+	}
+}
+
+func TestVolClientGate(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&minClientVersion=v2.1.0&features=%v,-%v",
+		hostAddr, proto.AdminUpdateVol, commonVolName, buildAuthKey("cfs"), proto.FeatureXattr, proto.FeatureAsyncClose)
+	process(reqURL, t)
+	if vol.minClientVersion != "v2.1.0" {
+		t.Errorf("expect minClientVersion is v2.1.0, but is %v", vol.minClientVersion)
+		return
+	}
+	if proto.FormatFeatures(vol.features) != "-asyncClose,xattr" {
+		t.Errorf("expect features are -asyncClose,xattr, but are %v", proto.FormatFeatures(vol.features))
+		return
+	}
+	vol.updateViewCache(server.cluster)
+	view := &proto.VolView{}
+	reply := &proto.HTTPReply{Data: view}
+	if err = json.Unmarshal(vol.getViewCache(), reply); err != nil {
+		t.Error(err)
+		return
+	}
+	if view.MinClientVersion != "v2.1.0" || len(view.Features) != 2 {
+		t.Errorf("unexpected volume view, minClientVersion %v features %v", view.MinClientVersion, view.Features)
+		return
+	}
+	if err = proto.CheckClientCompatibility("v2.0.3", view.MinClientVersion, view.Features); err == nil {
+		t.Errorf("expect the older client is incompatible")
+		return
+	}
+	if err = proto.CheckClientCompatibility("v2.1.0-rc1", view.MinClientVersion, view.Features); err != nil {
+		t.Error(err)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&minClientVersion=&features=", hostAddr, proto.AdminUpdateVol,
+		commonVolName, buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.minClientVersion != "" || len(vol.features) != 0 {
+		t.Errorf("expect the gate is reset, but minClientVersion is %v, features are %v", vol.minClientVersion, vol.features)
 	}
 }
 
-func TestSetVolCapacity(t *testing.T) {
-	setVolCapacity(600, proto.AdminVolExpand, t)
-	setVolCapacity(300, proto.AdminVolShrink, t)
-}
-
-func TestUpdateVol(t *testing.T) {
-	capacity := 2000
-	reqURL := fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v",
-		hostAddr, proto.AdminUpdateVol, commonVol.Name, capacity, buildAuthKey("cfs"))
-	process(reqURL, t)
+func TestVolMaxClients(t *testing.T) {
 	vol, err := server.cluster.getVol(commonVolName)
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	if vol.FollowerRead != false {
-		t.Errorf("expect FollowerRead is false, but is %v", vol.FollowerRead)
+	registerURL := func(clientID string, renew bool) string {
+		return fmt.Sprintf("%v%v?name=%v&clientId=%v&renew=%v", hostAddr, proto.ClientRegister, commonVolName, clientID, renew)
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&maxClients=2", hostAddr, proto.AdminUpdateVol, commonVolName,
+		buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.maxClients != 2 {
+		t.Errorf("expect maxClients is 2, but is %v", vol.maxClients)
 		return
 	}
-	if vol.enableToken != false {
-		t.Errorf("expect enableToken is false, but is %v", vol.enableToken)
+	defer server.cluster.setVolMaxClients(commonVolName, 0)
+	process(registerURL("client1", false), t)
+	process(registerURL("client2", false), t)
+	if code := replyCode(registerURL("client3", false), t); code != proto.ErrCodeTooManyClients {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTooManyClients, code)
 		return
 	}
+	// the renewals of the mounted clients are accepted
+	process(registerURL("client1", true), t)
+	process(fmt.Sprintf("%v%v?name=%v&clientId=client1", hostAddr, proto.ClientUnregister, commonVolName), t)
+	process(registerURL("client3", false), t)
 
-	reqURL = fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v&followerRead=true&enableToken=true&zoneName=%v",
-		hostAddr, proto.AdminUpdateVol, commonVol.Name, capacity, buildAuthKey("cfs"), commonVol.zoneName)
-	process(reqURL, t)
-	if vol.FollowerRead != true {
-		t.Errorf("expect FollowerRead is true, but is %v", vol.FollowerRead)
+	// the administrator bumps the limit live
+	if code := replyCode(registerURL("client4", false), t); code != proto.ErrCodeTooManyClients {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeTooManyClients, code)
 		return
 	}
-	if vol.enableToken != true {
-		t.Errorf("expect enableToken is true, but is %v", vol.enableToken)
-		return
+	process(fmt.Sprintf("%v%v?name=%v&maxClients=3", hostAddr, proto.AdminSetVolMaxClients, commonVolName), t)
+	process(registerURL("client4", false), t)
+	if clients := server.cluster.clientLeases.count(commonVolName); vol.maxClients != 3 || clients != 3 {
+		t.Errorf("expect 3 clients of 3, but are %v of %v", clients, vol.maxClients)
+	}
+	for _, clientID := range []string{"client2", "client3", "client4"} {
+		server.cluster.clientLeases.unregister(commonVolName, clientID)
 	}
-
 }
 
-func setVolCapacity(capacity uint64, url string, t *testing.T) {
-	reqURL := fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v",
-		hostAddr, url, commonVol.Name, capacity, buildAuthKey("cfs"))
-	process(reqURL, t)
+func TestVolMetaCache(t *testing.T) {
 	vol, err := server.cluster.getVol(commonVolName)
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	if vol.Capacity != capacity {
-		t.Errorf("expect capacity is %v, but is %v", capacity, vol.Capacity)
+	cacheAddr := "127.0.0.1:17410"
+	process(fmt.Sprintf("%v%v?addr=%v", hostAddr, proto.AddMetaCacheNode, cacheAddr), t)
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&metaCache=true", hostAddr, proto.AdminUpdateVol, commonVolName,
+		buildAuthKey("cfs"))
+	process(reqURL, t)
+	if !vol.metaCache {
+		t.Errorf("expect metaCache is enabled")
+		return
+	}
+	vol.updateViewCache(server.cluster)
+	view := &proto.VolView{}
+	if err = json.Unmarshal(vol.getViewCache(), &proto.HTTPReply{Data: view}); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(view.MetaCacheNodes) != 1 || view.MetaCacheNodes[0] != cacheAddr {
+		t.Errorf("expect meta cache nodes [%v], but are %v", cacheAddr, view.MetaCacheNodes)
 		return
 	}
-}
-
-func buildAuthKey(owner string) string {
-	h := md5.New()
-	h.Write([]byte(owner))
-	cipherStr := h.Sum(nil)
-	return hex.EncodeToString(cipherStr)
-}
 
-func TestGetVolSimpleInfo(t *testing.T) {
-	reqURL := fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetVol, commonVol.Name)
+	// the expired meta cache nodes are not advertised
+	server.cluster.metaCacheNodes.Store(cacheAddr, &MetaCacheNode{Addr: cacheAddr,
+		ReportTime: time.Now().Add(-2 * defaultMetaCacheNodeTimeout)})
+	if nodes := server.cluster.aliveMetaCacheNodes(); len(nodes) != 0 {
+		t.Errorf("expect no alive meta cache nodes, but are %v", nodes)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&metaCache=false", hostAddr, proto.AdminUpdateVol, commonVolName,
+		buildAuthKey("cfs"))
 	process(reqURL, t)
+	if vol.metaCache {
+		t.Errorf("expect metaCache is disabled")
+	}
 }
 
-func TestCreateVol(t *testing.T) {
-	name := "test_create_vol"
-	reqURL := fmt.Sprintf("%v%v?name=%v&replicas=3&type=extent&capacity=100&owner=cfstest&zoneName=%v", hostAddr, proto.AdminCreateVol, name, testZone2)
-	fmt.Println(reqURL)
-	process(reqURL, t)
-	userInfo, err := server.user.getUserInfo("cfstest")
+func TestNodeVersions(t *testing.T) {
+	dataNode, err := server.cluster.dataNode(mds1Addr)
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	if !contains(userInfo.Policy.OwnVols, name) {
-		t.Errorf("expect vol %v in own vols, but is not", name)
+	dataNode.Lock()
+	dataNode.BuildInfo = proto.BuildInfo{Version: "test", CommitID: "test-commit", StartTime: time.Now().Unix()}
+	dataNode.Unlock()
+	view := server.cluster.nodeVersions("test-commit")
+	if view.CommitCounts["test-commit"] < 1 || contains(view.StaleNodes, mds1Addr) {
+		t.Errorf("unexpected node versions %v", view)
 		return
 	}
-}
-
-func TestCreateMetaPartition(t *testing.T) {
-	server.cluster.checkMetaNodeHeartbeat()
-	time.Sleep(5 * time.Second)
-	commonVol.checkMetaPartitions(server.cluster)
-	createMetaPartition(commonVol, t)
-}
-
-func TestCreateDataPartition(t *testing.T) {
-	reqURL := fmt.Sprintf("%v%v?count=2&name=%v&type=extent",
-		hostAddr, proto.AdminCreateDataPartition, commonVol.Name)
-	process(reqURL, t)
-}
-
-func TestGetDataPartition(t *testing.T) {
-	if len(commonVol.dataPartitions.partitions) == 0 {
-		t.Errorf("no data partitions")
+	view = server.cluster.nodeVersions("other-commit")
+	if !contains(view.StaleNodes, mds1Addr) {
+		t.Errorf("data node [%v] should be stale, stale nodes %v", mds1Addr, view.StaleNodes)
 		return
 	}
-	partition := commonVol.dataPartitions.partitions[0]
-	reqURL := fmt.Sprintf("%v%v?id=%v", hostAddr, proto.AdminGetDataPartition, partition.PartitionID)
-	process(reqURL, t)
-
-	reqURL = fmt.Sprintf("%v%v?id=%v&name=%v", hostAddr, proto.AdminGetDataPartition, partition.PartitionID, partition.VolName)
+	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminNodeVersions)
 	process(reqURL, t)
 }
 
-func TestLoadDataPartition(t *testing.T) {
-	if len(commonVol.dataPartitions.partitions) == 0 {
-		t.Errorf("no data partitions")
+func TestSchemaVersion(t *testing.T) {
+	// a data node record written before the versioning, with an ID which does not fit into a float64
+	raw := []byte(`{"ID":9007199254740993,"NodeSetID":1,"Addr":"192.168.0.1:6000","ZoneName":""}`)
+	migrated, upgraded, err := migrateRecord(dataNodeAcronym, raw)
+	if err != nil || !upgraded {
+		t.Errorf("migrate record failed, upgraded[%v] err[%v]", upgraded, err)
 		return
 	}
-	partition := commonVol.dataPartitions.partitions[0]
-	reqURL := fmt.Sprintf("%v%v?id=%v&name=%v",
-		hostAddr, proto.AdminLoadDataPartition, partition.PartitionID, commonVol.Name)
-	process(reqURL, t)
-}
-
-func TestDataPartitionDecommission(t *testing.T) {
-	if len(commonVol.dataPartitions.partitions) == 0 {
-		t.Errorf("no data partitions")
+	dnv := &dataNodeValue{}
+	if err = json.Unmarshal(migrated, dnv); err != nil {
+		t.Error(err)
 		return
 	}
-	server.cluster.checkDataNodeHeartbeat()
-	time.Sleep(5 * time.Second)
-	partition := commonVol.dataPartitions.partitions[0]
-	offlineAddr := partition.Hosts[0]
-	reqURL := fmt.Sprintf("%v%v?name=%v&id=%v&addr=%v",
-		hostAddr, proto.AdminDecommissionDataPartition, commonVol.Name, partition.PartitionID, offlineAddr)
-	process(reqURL, t)
-	if contains(partition.Hosts, offlineAddr) {
-		t.Errorf("offlineAddr[%v],hosts[%v]", offlineAddr, partition.Hosts)
+	if dnv.ID != 9007199254740993 || dnv.ZoneName != DefaultZoneName || dnv.SchemaVersion != currentSchemaVersion {
+		t.Errorf("unexpected migrated record %v", string(migrated))
 		return
 	}
-	partition.isRecover = false
+	if _, upgraded, _ = migrateRecord(dataNodeAcronym, migrated); upgraded {
+		t.Errorf("record of the current version should not be upgraded")
+		return
+	}
+	server.cluster.upgradeSchemaVersion()
+	if err = server.cluster.loadSchemaVersion(); err != nil {
+		t.Error(err)
+		return
+	}
+	if view := server.cluster.schema.view(); view.Stored != currentSchemaVersion {
+		t.Errorf("stored schema version[%v], expected[%v]", view.Stored, currentSchemaVersion)
+		return
+	}
+	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminSchemaVersion)
+	process(reqURL, t)
 }
 
-//func TestGetAllVols(t *testing.T) {
-//	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.GetALLVols)
-//	process(reqURL, t)
-//}
-//
 func TestGetMetaPartitions(t *testing.T) {
 	reqURL := fmt.Sprintf("%v%v?name=%v", hostAddr, proto.ClientMetaPartitions, commonVolName)
 	process(reqURL, t)
@@ -622,6 +1831,41 @@ func TestListVols(t *testing.T) {
 	process(reqURL, t)
 }
 
+func TestValidateConfig(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v", hostAddr, proto.AdminValidateConfig)
+	reply := post(reqURL, []byte(`{"role":"master","listen":"8080"}`), t)
+	if reply == nil {
+		return
+	}
+	report, ok := reply.Data.(map[string]interface{})
+	if !ok || report["Passed"] != false || report["Role"] != ModuleName {
+		t.Errorf("config without the dirs should fail, report %v", reply.Data)
+	}
+}
+
+func TestRaftTimings(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?electionTick=8", hostAddr, proto.AdminSetRaftTimings)
+	fmt.Println(reqURL)
+	if reply := process(reqURL, t); reply == nil {
+		return
+	}
+	defer server.raftStore.SetTimings(raftstore.Timings{TickInterval: 500, HeartbeatTick: 1, ElectionTick: 6, MaxInflightMsgs: 128})
+	reply := process(fmt.Sprintf("%v%v", hostAddr, proto.AdminGetRaftTimings), t)
+	if reply == nil {
+		return
+	}
+	view, ok := reply.Data.(map[string]interface{})
+	if !ok || view["electionTick"] != float64(8) || view["tickInterval"] != float64(500) || view["ElectionTimeout"] != "4s" {
+		t.Errorf("unexpected raft timings %v", reply.Data)
+	}
+	// the heartbeat interval must be shorter than the election timeout
+	timings := server.raftStore.Timings()
+	timings.HeartbeatTick = 8
+	if err := server.raftStore.SetTimings(timings); err == nil {
+		t.Errorf("heartbeatTick %v not less than electionTick %v should be refused", timings.HeartbeatTick, timings.ElectionTick)
+	}
+}
+
 func post(reqURL string, data []byte, t *testing.T) (reply *proto.HTTPReply) {
 	reader := bytes.NewReader(data)
 	req, err := http.NewRequest(http.MethodPost, reqURL, reader)
@@ -846,3 +2090,485 @@ func TestListUsersOfVol(t *testing.T) {
 	fmt.Println(reqURL)
 	process(reqURL, t)
 }
+
+func TestCheckNodeIdentity(t *testing.T) {
+	m := &Server{config: &clusterConfig{}}
+	newRequest := func(role, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, proto.GetDataNodeTaskResponse, nil)
+		if role != "" {
+			r.Header.Set(proto.NodeRoleHeader, role)
+			r.Header.Set(proto.NodeTokenHeader, token)
+		}
+		return r
+	}
+	if err := m.checkNodeIdentity(newRequest("", "")); err != nil {
+		t.Fatalf("node APIs should be open without node token, err[%v]", err)
+	}
+	m.config.nodeToken = "secret"
+	if err := m.checkNodeIdentity(newRequest("", "")); err == nil {
+		t.Fatalf("external request should be rejected")
+	}
+	if err := m.checkNodeIdentity(newRequest(proto.NodeRoleData, "wrong")); err == nil {
+		t.Fatalf("request with invalid token should be rejected")
+	}
+	if err := m.checkNodeIdentity(newRequest("client", "secret")); err == nil {
+		t.Fatalf("request with unknown role should be rejected")
+	}
+	if err := m.checkNodeIdentity(newRequest(proto.NodeRoleMeta, "secret")); err != nil {
+		t.Fatalf("node request should be accepted, err[%v]", err)
+	}
+}
+
+func TestClusterEvents(t *testing.T) {
+	pushed := make(chan *proto.ClusterEvent, 100)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := &proto.ClusterEvent{}
+		if err := json.NewDecoder(r.Body).Decode(event); err == nil && event.Resource == "testEventVol" {
+			pushed <- event
+		}
+	}))
+	defer webhook.Close()
+	process(fmt.Sprintf("%v%v?webhooks=%v", hostAddr, proto.AdminSetEventWebhooks, webhook.URL), t)
+	defer server.cluster.setEventWebhooks(nil)
+	if webhooks := server.cluster.events.getWebhooks(); len(webhooks) != 1 || webhooks[0] != webhook.URL {
+		t.Fatalf("unexpected webhooks %v", webhooks)
+	}
+
+	c := server.cluster
+	c.raiseEvent(proto.EventVolumeFull, proto.EventSeverityCritical, "testEventVol", "testEventVol", "full", time.Hour)
+	if view := c.events.query(proto.EventVolumeFull, "testEventVol", 0, false, 0); len(view.Events) != 0 {
+		t.Fatalf("event should not be raised in the grace period, events %v", view.Events)
+	}
+	for i := 0; i < 3; i++ {
+		c.raiseEvent(proto.EventVolumeFull, proto.EventSeverityCritical, "testEventVol", "testEventVol", "full", 0)
+	}
+	c.resolveEvent(proto.EventVolumeFull, "testEventVol")
+	c.resolveEvent(proto.EventVolumeFull, "testEventVol")
+	for i, resolved := range []bool{false, true} {
+		select {
+		case event := <-pushed:
+			if event.Type != proto.EventVolumeFull || event.Resolved != resolved {
+				t.Fatalf("unexpected pushed event %v of %v", event, i)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("event %v is not pushed", i)
+		}
+	}
+
+	reply := process(fmt.Sprintf("%v%v?type=%v&resource=testEventVol", hostAddr, proto.AdminGetEvents, proto.EventVolumeFull), t)
+	data, err := json.Marshal(reply.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := &proto.ClusterEventsView{}
+	if err = json.Unmarshal(data, view); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.Events) != 2 || view.Events[0].Resolved || !view.Events[1].Resolved ||
+		view.Events[0].Severity != proto.EventSeverityCritical || view.Events[1].Severity != proto.EventSeverityInfo {
+		t.Fatalf("unexpected events %v", view.Events)
+	}
+	if view = c.events.query("", "testEventVol", 0, true, 0); len(view.Events) != 0 {
+		t.Fatalf("resolved event should not be active, events %v", view.Events)
+	}
+}
+
+func TestVolUsageHooks(t *testing.T) {
+	var rejecting int32 = 1
+	delivered := make(chan *proto.VolUsageEvent, 100)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := &proto.VolUsageEvent{}
+		if err := json.NewDecoder(r.Body).Decode(event); err != nil || atomic.LoadInt32(&rejecting) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if event.Type == proto.VolUsageCapacityChange && event.Vol == commonVolName {
+			delivered <- event
+		}
+	}))
+	defer webhook.Close()
+	process(fmt.Sprintf("%v%v?webhooks=%v&tickInterval=3600", hostAddr, proto.AdminSetVolUsageHooks, webhook.URL), t)
+	c := server.cluster
+	defer c.setVolUsageHooks(nil, 0)
+	c.volUsage.deliverLock.Lock()
+	c.volUsage.maxAttempts = 1
+	c.volUsage.deliverLock.Unlock()
+	defer func() {
+		c.volUsage.deliverLock.Lock()
+		c.volUsage.maxAttempts = defaultVolUsageMaxAttempts
+		c.volUsage.deliverLock.Unlock()
+	}()
+
+	event := c.newVolUsageEvent(proto.VolUsageCapacityChange, commonVol)
+	event.OldCapacity = commonVol.Capacity / 2
+	c.recordVolUsageEvent(event)
+	if event.ID == 0 {
+		t.Fatalf("event is not recorded")
+	}
+	getView := func() *proto.VolUsageHooksView {
+		reply := process(fmt.Sprintf("%v%v", hostAddr, proto.AdminGetVolUsageHooks), t)
+		data, err := json.Marshal(reply.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		view := &proto.VolUsageHooksView{}
+		if err = json.Unmarshal(data, view); err != nil {
+			t.Fatal(err)
+		}
+		return view
+	}
+	isDead := func(view *proto.VolUsageHooksView) bool {
+		for _, letter := range view.DeadLetters {
+			if letter.Event.ID == event.ID {
+				return len(letter.Hooks) == 1 && letter.Hooks[0] == webhook.URL && letter.LastError != ""
+			}
+		}
+		return false
+	}
+	for i := 0; !isDead(getView()); i++ {
+		if i >= 100 {
+			t.Fatalf("event[%v] is not moved to the dead letters, view %v", event.ID, getView())
+		}
+		c.deliverVolUsageEvents()
+		time.Sleep(100 * time.Millisecond)
+	}
+	key := volUsagePrefix + strconv.FormatUint(event.ID, 10)
+	if value, err := c.fsm.store.Get(key); err != nil || len(value.([]byte)) == 0 {
+		t.Fatalf("dead letter of event[%v] is not persisted, err[%v]", event.ID, err)
+	}
+
+	atomic.StoreInt32(&rejecting, 0)
+	process(fmt.Sprintf("%v%v?id=%v", hostAddr, proto.AdminRetryVolUsageDeadLetters, event.ID), t)
+	select {
+	case pushed := <-delivered:
+		if pushed.ID != event.ID || pushed.OldCapacity != event.OldCapacity || pushed.Capacity != commonVol.Capacity {
+			t.Fatalf("unexpected delivered event %v", pushed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("event[%v] is not delivered after retried", event.ID)
+	}
+	for i := 0; ; i++ {
+		if value, err := c.fsm.store.Get(key); err == nil && len(value.([]byte)) == 0 {
+			break
+		}
+		if i >= 100 {
+			t.Fatalf("event[%v] is not deleted after delivered", event.ID)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminPurgeVolUsageDeadLetters), t)
+	if view := getView(); isDead(view) || len(view.DeadLetters) != 0 {
+		t.Fatalf("unexpected dead letters %v", view.DeadLetters)
+	}
+}
+
+func TestTinyExtentEvents(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	c := server.cluster
+	partition := commonVol.dataPartitions.partitions[0]
+	dataNode, err := c.dataNode(partition.Hosts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &proto.PartitionReport{
+		VolName:              commonVol.Name,
+		PartitionID:          partition.PartitionID,
+		PartitionStatus:      proto.ReadWrite,
+		Total:                partition.total,
+		DiskPath:             "/cfs",
+		IsLeader:             true,
+		AvailableTinyExtents: 1,
+		BrokenTinyExtents:    10,
+	}
+	partition.updateMetric(report, dataNode, c)
+	resource := strconv.FormatUint(partition.PartitionID, 10)
+	c.checkTinyExtentEvents(commonVol.Name, partition)
+	if view := c.events.query(proto.EventTinyExtentsLow, resource, 0, true, 0); len(view.Events) != 0 {
+		t.Fatalf("event should not be raised in the grace period, events %v", view.Events)
+	}
+	c.events.Lock()
+	c.events.pending[eventKey(proto.EventTinyExtentsLow, resource)] = time.Now().Add(-time.Second * defaultTinyExtentsLowGracePeriodSec)
+	c.events.Unlock()
+	partition.updateMetric(report, dataNode, c)
+	c.checkTinyExtentEvents(commonVol.Name, partition)
+	if view := c.events.query(proto.EventTinyExtentsLow, resource, 0, true, 0); len(view.Events) != 1 {
+		t.Fatalf("expect the event raised, but got %v", view.Events)
+	}
+
+	report.AvailableTinyExtents = 54
+	partition.updateMetric(report, dataNode, c)
+	c.checkTinyExtentEvents(commonVol.Name, partition)
+	if view := c.events.query(proto.EventTinyExtentsLow, resource, 0, true, 0); len(view.Events) != 0 {
+		t.Fatalf("expect the event resolved, but got %v", view.Events)
+	}
+}
+
+func TestDelegateVolToken(t *testing.T) {
+	mintURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&readOnly=true&subDir=dir&ttl=2",
+		hostAddr, proto.AdminDelegateVolToken, commonVol.Name, buildAuthKey(commonVol.Owner))
+	if code := replyCode(mintURL, t); code != proto.ErrCodeDelegatedTokenNotEnabled {
+		t.Fatalf("expect code %v without the signing key, real %v", proto.ErrCodeDelegatedTokenNotEnabled, code)
+	}
+	server.cluster.cfg.tokenSigningKey = "signing-key"
+	defer func() {
+		server.cluster.cfg.tokenSigningKey = ""
+	}()
+	if code := replyCode(fmt.Sprintf("%v%v?name=%v&authKey=%v&ttl=%v", hostAddr, proto.AdminDelegateVolToken,
+		commonVol.Name, buildAuthKey(commonVol.Owner), proto.MaxDelegatedTokenTTLHours+1), t); code != proto.ErrCodeParamError {
+		t.Fatalf("expect code %v with a too long ttl, real %v", proto.ErrCodeParamError, code)
+	}
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	// the sub directory must be a directory of the volume
+	if code := replyCode(fmt.Sprintf("%v%v?name=%v&authKey=%v&subDir=dir/file", hostAddr, proto.AdminDelegateVolToken,
+		commonVol.Name, buildAuthKey(commonVol.Owner)), t); code == proto.ErrCodeSuccess {
+		t.Fatalf("expect the token of a file refused")
+	}
+	reply := process(mintURL, t)
+	if reply == nil {
+		return
+	}
+	data, _ := json.Marshal(reply.Data)
+	view := &proto.DelegatedTokenView{}
+	if err := json.Unmarshal(data, view); err != nil {
+		t.Fatal(err)
+	}
+	token, err := proto.VerifyDelegatedToken(view.Token, []byte("signing-key"))
+	if err != nil {
+		t.Fatalf("verify token err %v", err)
+	}
+	if token.VolName != commonVol.Name || !token.ReadOnly || token.SubDir != "/dir" ||
+		token.RootInode != mocktest.MockDirInode || token.ExpireTime-token.IssueTime != 2*3600 {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	process(fmt.Sprintf("%v%v?name=%v&delegatedToken=%v", hostAddr, proto.ClientVol, commonVol.Name, view.Token), t)
+	if code := replyCode(fmt.Sprintf("%v%v?name=%v&delegatedToken=%v", hostAddr, proto.ClientVol, commonVol.Name,
+		view.Token+"x"), t); code != proto.ErrCodeDelegatedTokenInvalid {
+		t.Fatalf("expect code %v with a forged token, real %v", proto.ErrCodeDelegatedTokenInvalid, code)
+	}
+}
+
+func TestDataPartitionPlacement(t *testing.T) {
+	reply := process(fmt.Sprintf("%v%v", hostAddr, proto.AdminDataPartitionPlacement), t)
+	if reply == nil {
+		return
+	}
+	data, _ := json.Marshal(reply.Data)
+	view := &proto.DataPartitionPlacementView{}
+	if err := json.Unmarshal(data, view); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.DataNodes) == 0 || len(view.Decisions) == 0 {
+		t.Fatalf("unexpected placement view %+v", view)
+	}
+	for _, replica := range view.Decisions[0].Replicas {
+		if replica.PreferredDisk != "/cfs" {
+			t.Errorf("replica %v preferred disk %v, expected /cfs", replica.Addr, replica.PreferredDisk)
+		}
+	}
+	reqURL := fmt.Sprintf("%v%v?addr=%v&id=%v", hostAddr, proto.AdminDataPartitionPlacement, mds1Addr,
+		view.Decisions[0].PartitionID)
+	process(reqURL, t)
+
+	if code := replyCode(fmt.Sprintf("%v%v?threshold=1.5", hostAddr, proto.AdminSetDataNodeDiskThreshold), t); code != proto.ErrCodeParamError {
+		t.Errorf("expect code %v with an invalid threshold, real %v", proto.ErrCodeParamError, code)
+	}
+	process(fmt.Sprintf("%v%v?threshold=0.8", hostAddr, proto.AdminSetDataNodeDiskThreshold), t)
+	if server.cluster.cfg.DataNodeDiskThreshold != 0.8 {
+		t.Errorf("disk threshold %v, expected 0.8", server.cluster.cfg.DataNodeDiskThreshold)
+	}
+	process(fmt.Sprintf("%v%v?threshold=%v", hostAddr, proto.AdminSetDataNodeDiskThreshold, defaultDataNodeDiskThreshold), t)
+}
+
+func TestVolReservation(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?name=reserveVol&replicas=3&capacity=100000&owner=cfs&zoneName=%v", hostAddr,
+		proto.AdminCreateVol, testZone2)
+	process(reqURL, t)
+	vol, err := server.cluster.getVol("reserveVol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserveURL := "%v%v?name=%v&authKey=%v&size=%v&ttl=%v"
+	size := server.cluster.availableDataSpace() / util.GB / uint64(vol.dpReplicaNum)
+	if code := replyCode(fmt.Sprintf(reserveURL, hostAddr, proto.AdminReserveVolSpace, vol.Name, buildAuthKey("cfs"),
+		size+1, 1), t); code != proto.ErrCodeNoSpaceToReserve {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeNoSpaceToReserve, code)
+	}
+	if code := replyCode(fmt.Sprintf(reserveURL, hostAddr, proto.AdminReserveVolSpace, vol.Name,
+		buildAuthKey("cfs"), vol.capacity()+1, 1), t); code != proto.ErrCodeVolReservationExceedsCapacity {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolReservationExceedsCapacity, code)
+	}
+	reservation, err := server.cluster.reserveVolSpace(vol.Name, buildAuthKey("cfs"), size, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.cluster.checkUnreservedSpace(commonVol); err != proto.ErrSpaceReserved {
+		t.Errorf("expect the data partitions of the other vols refused, but err is %v", err)
+	}
+	if err = server.cluster.checkUnreservedSpace(vol); err != nil {
+		t.Errorf("expect the data partitions of the reserving vol created, but err is %v", err)
+	}
+	if code := replyCode(fmt.Sprintf("%v%v?name=%v&capacity=%v&authKey=%v", hostAddr, proto.AdminVolShrink, vol.Name,
+		size-1, buildAuthKey("cfs")), t); code != proto.ErrCodeVolReservationExceedsCapacity {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolReservationExceedsCapacity, code)
+	}
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminGetVolReservations), t)
+	if view := server.cluster.getVolReservationsView(vol); view.ReservedSize != size || len(view.Reservations) != 1 {
+		t.Errorf("expect %vGB reserved by 1 reservation, but is %v", size, view)
+	}
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v&id=%v", hostAddr, proto.AdminCancelVolReservation, vol.Name,
+		buildAuthKey("cfs"), reservation.ID), t)
+	if err = server.cluster.checkUnreservedSpace(commonVol); err != nil {
+		t.Errorf("expect the cancelled reservation released, but err is %v", err)
+	}
+	if code := replyCode(fmt.Sprintf("%v%v?name=%v&authKey=%v&id=%v", hostAddr, proto.AdminCancelVolReservation,
+		vol.Name, buildAuthKey("cfs"), reservation.ID), t); code != proto.ErrCodeVolReservationNotExists {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeVolReservationNotExists, code)
+	}
+	vol.Lock()
+	vol.reservations = []*proto.VolReservation{{ID: reservation.ID, VolName: vol.Name, Size: size,
+		ExpireTime: time.Now().Unix() - 1}}
+	vol.Unlock()
+	if reserved := vol.reservedSize(); reserved != 0 {
+		t.Errorf("expect the expired reservation not counted, but %vGB reserved", reserved)
+	}
+	if err = server.cluster.checkUnreservedSpace(commonVol); err != nil {
+		t.Errorf("expect the expired reservation released, but err is %v", err)
+	}
+}
+
+func TestVerifyReads(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?name=verifyReadsVol&replicas=3&capacity=100&owner=cfs&zoneName=%v", hostAddr,
+		proto.AdminCreateVol, testZone2)
+	process(reqURL, t)
+	vol, err := server.cluster.getVol("verifyReadsVol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateURL := "%v%v?name=%v&authKey=%v&capacity=%v&%v"
+	if code := replyCode(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey("cfs"),
+		vol.Capacity, "verifyReads=true&verifyReadsPercent=101"), t); code != proto.ErrCodeParamError {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeParamError, code)
+	}
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey("cfs"), vol.Capacity,
+		"verifyReads=true"), t)
+	if view := newSimpleView(vol); !view.VerifyReads || view.VerifyReadsPercent != defaultVerifyReadsPercent {
+		t.Errorf("expect reads verified by %v percent, but is %v %v", defaultVerifyReadsPercent, view.VerifyReads,
+			view.VerifyReadsPercent)
+	}
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey("cfs"), vol.Capacity,
+		"verifyReadsPercent=10"), t)
+	if !vol.verifyReads || vol.verifyReadsPercent != 10 {
+		t.Errorf("expect reads verified by 10 percent, but is %v %v", vol.verifyReads, vol.verifyReadsPercent)
+	}
+
+	if len(vol.dataPartitions.partitions) == 0 {
+		t.Fatalf("no data partitions")
+	}
+	partition := vol.dataPartitions.partitions[0]
+	report := &proto.ReadMismatchReport{
+		VolName:     vol.Name,
+		Inode:       100,
+		PartitionID: partition.PartitionID,
+		ExtentID:    1025,
+		Size:        4096,
+		Replicas:    []*proto.ReplicaCrc{{Addr: partition.Hosts[0], Crc: 1}, {Addr: "127.0.0.1:1", Crc: 2}},
+	}
+	if err = server.cluster.reportReadMismatch(report); err == nil {
+		t.Errorf("the mismatch of a replica out of the hosts should not be recorded")
+	}
+	report.Replicas[1].Addr = partition.Hosts[1]
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(fmt.Sprintf("%v%v", hostAddr, proto.ClientReportMismatch), data, t)
+	reports := server.cluster.readMismatches.list(vol.Name, partition.PartitionID)
+	if len(reports) != 1 || reports[0].ExtentID != report.ExtentID || reports[0].ReportTime == 0 {
+		t.Errorf("expect the mismatch recorded, but is %v", reports)
+	}
+	process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetReadMismatches, vol.Name), t)
+	if reports = server.cluster.readMismatches.list(commonVolName, 0); len(reports) != 0 {
+		t.Errorf("expect no mismatch of vol[%v], but is %v", commonVolName, reports)
+	}
+}
+
+func TestSyncOnRename(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateURL := "%v%v?name=%v&authKey=%v&capacity=%v&%v"
+	if code := replyCode(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner),
+		vol.Capacity, "syncOnRename=sometimes"), t); code != proto.ErrCodeParamError {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeParamError, code)
+	}
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner), vol.Capacity,
+		"syncOnRename=true"), t)
+	defer process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner),
+		vol.Capacity, "syncOnRename=false"), t)
+	if view := newSimpleView(vol); !view.SyncOnRename {
+		t.Errorf("expect renames synced on vol[%v]", vol.Name)
+	}
+	if restored := newVolFromVolValue(newVolValue(vol)); !restored.syncOnRename {
+		t.Errorf("expect syncOnRename persisted on vol[%v]", vol.Name)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateURL := "%v%v?name=%v&authKey=%v&capacity=%v&%v"
+	if code := replyCode(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner),
+		vol.Capacity, "requireToken=true"), t); code != proto.ErrCodeDelegatedTokenNotEnabled {
+		t.Errorf("expect code %v without the signing key, but is %v", proto.ErrCodeDelegatedTokenNotEnabled, code)
+	}
+	server.cluster.cfg.tokenSigningKey = "signing-key"
+	defer func() {
+		server.cluster.cfg.tokenSigningKey = ""
+	}()
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner), vol.Capacity,
+		"requireToken=true"), t)
+	defer process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner),
+		vol.Capacity, "requireToken=false"), t)
+	if view := newSimpleView(vol); !view.RequireToken {
+		t.Errorf("expect tokens required on vol[%v]", vol.Name)
+	}
+	if restored := newVolFromVolValue(newVolValue(vol)); !restored.requireToken {
+		t.Errorf("expect requireToken persisted on vol[%v]", vol.Name)
+	}
+	if names := server.cluster.tokenRequiredVols(); len(names) != 1 || names[0] != vol.Name {
+		t.Errorf("expect vol[%v] sent with the heartbeats, but is %v", vol.Name, names)
+	}
+}
+
+func TestNamePolicy(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateURL := "%v%v?name=%v&authKey=%v&capacity=%v&%v"
+	if code := replyCode(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner),
+		vol.Capacity, "nameMaxLength=-1"), t); code != proto.ErrCodeParamError {
+		t.Errorf("expect code %v, but is %v", proto.ErrCodeParamError, code)
+	}
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner), vol.Capacity,
+		"nameMaxLength=255&nameValidUTF8=true&nameNoControlChars=true"), t)
+	defer process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner),
+		vol.Capacity, "nameMaxLength=0&nameValidUTF8=false&nameNoControlChars=false&nameRelaxed=false"), t)
+	// the rules not given are kept
+	process(fmt.Sprintf(updateURL, hostAddr, proto.AdminUpdateVol, vol.Name, buildAuthKey(vol.Owner), vol.Capacity,
+		"nameRelaxed=true"), t)
+	expected := proto.DentryNamePolicy{MaxLength: 255, ValidUTF8: true, NoControlChars: true, Relaxed: true}
+	if view := newSimpleView(vol); view.NamePolicy != expected {
+		t.Errorf("expect name policy %v of vol[%v], but is %v", expected.String(), vol.Name, view.NamePolicy.String())
+	}
+	if restored := newVolFromVolValue(newVolValue(vol)); restored.namePolicy != expected {
+		t.Errorf("expect name policy persisted on vol[%v], but is %v", vol.Name, restored.namePolicy.String())
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	bootstrapActionAddDataNode = "addDataNode"
+	bootstrapActionAddMetaNode = "addMetaNode"
+	bootstrapActionCreateVol   = "createVol"
+)
+
+// bootstrap adds the nodes and creates the default volume described in the manifest.
+// The steps which have been done are skipped, so that the same manifest can be submitted again
+// to retry the failed steps, e.g. the volume can not be created until enough nodes are active.
+func (m *Server) bootstrap(w http.ResponseWriter, r *http.Request) {
+	var (
+		body     []byte
+		manifest *proto.BootstrapManifest
+		err      error
+	)
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	manifest = &proto.BootstrapManifest{}
+	if err = json.Unmarshal(body, manifest); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = checkBootstrapManifest(manifest); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+
+	result := &proto.BootstrapResult{Steps: make([]*proto.BootstrapStep, 0)}
+	addStep := func(step *proto.BootstrapStep) {
+		if step.Status == proto.BootstrapStepFailed {
+			result.Failed++
+		}
+		result.Steps = append(result.Steps, step)
+		log.LogInfof("action[bootstrap] step action[%v] target[%v] status[%v] msg[%v]",
+			step.Action, step.Target, step.Status, step.Msg)
+	}
+	for _, node := range manifest.DataNodes {
+		addStep(m.bootstrapDataNode(node))
+	}
+	for _, node := range manifest.MetaNodes {
+		addStep(m.bootstrapMetaNode(node))
+	}
+	if manifest.Volume != nil {
+		addStep(m.bootstrapVol(manifest.Volume))
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(result))
+}
+
+func checkBootstrapManifest(manifest *proto.BootstrapManifest) (err error) {
+	for _, node := range append(manifest.DataNodes, manifest.MetaNodes...) {
+		if node == nil || node.Addr == "" {
+			return keyNotFound(addrKey)
+		}
+		if node.ZoneName == "" {
+			node.ZoneName = DefaultZoneName
+		}
+	}
+	vol := manifest.Volume
+	if vol == nil {
+		return
+	}
+	if !volNameRegexp.MatchString(vol.Name) {
+		return fmt.Errorf("name can only be number and letters")
+	}
+	if !ownerRegexp.MatchString(vol.Owner) {
+		return fmt.Errorf("owner can only be number and letters")
+	}
+	if vol.Capacity <= 0 {
+		return keyNotFound(volCapacityKey)
+	}
+	if vol.MpCount == 0 {
+		vol.MpCount = defaultInitMetaPartitionCount
+	}
+	if vol.DpReplicaNum == 0 {
+		vol.DpReplicaNum = defaultReplicaNum
+	}
+	if !(vol.DpReplicaNum == 2 || vol.DpReplicaNum == 3) {
+		return fmt.Errorf("replicaNum can only be 2 and 3,received replicaNum is[%v]", vol.DpReplicaNum)
+	}
+	return
+}
+
+func (m *Server) bootstrapDataNode(node *proto.BootstrapNode) (step *proto.BootstrapStep) {
+	step = &proto.BootstrapStep{Action: bootstrapActionAddDataNode, Target: node.Addr}
+	if value, ok := m.cluster.dataNodes.Load(node.Addr); ok {
+		dataNode := value.(*DataNode)
+		step.Status = proto.BootstrapStepExists
+		step.Msg = fmt.Sprintf("id[%v] zone[%v]", dataNode.ID, dataNode.ZoneName)
+		return
+	}
+	id, err := m.cluster.addDataNode(node.Addr, node.ZoneName, "", node.Spare)
+	if err != nil {
+		step.Status = proto.BootstrapStepFailed
+		step.Msg = err.Error()
+		return
+	}
+	step.Status = proto.BootstrapStepCreated
+	step.Msg = fmt.Sprintf("id[%v] zone[%v]", id, node.ZoneName)
+	return
+}
+
+func (m *Server) bootstrapMetaNode(node *proto.BootstrapNode) (step *proto.BootstrapStep) {
+	step = &proto.BootstrapStep{Action: bootstrapActionAddMetaNode, Target: node.Addr}
+	if value, ok := m.cluster.metaNodes.Load(node.Addr); ok {
+		metaNode := value.(*MetaNode)
+		step.Status = proto.BootstrapStepExists
+		step.Msg = fmt.Sprintf("id[%v] zone[%v]", metaNode.ID, metaNode.ZoneName)
+		return
+	}
+	id, err := m.cluster.addMetaNode(node.Addr, node.ZoneName, "")
+	if err != nil {
+		step.Status = proto.BootstrapStepFailed
+		step.Msg = err.Error()
+		return
+	}
+	step.Status = proto.BootstrapStepCreated
+	step.Msg = fmt.Sprintf("id[%v] zone[%v]", id, node.ZoneName)
+	return
+}
+
+func (m *Server) bootstrapVol(spec *proto.BootstrapVolume) (step *proto.BootstrapStep) {
+	step = &proto.BootstrapStep{Action: bootstrapActionCreateVol, Target: spec.Name}
+	if vol, err := m.cluster.getVol(spec.Name); err == nil {
+		if vol.Owner != spec.Owner {
+			step.Status = proto.BootstrapStepFailed
+			step.Msg = fmt.Sprintf("vol exists with another owner[%v]", vol.Owner)
+			return
+		}
+		step.Status = proto.BootstrapStepExists
+		return
+	}
+	vol, err := m.cluster.createVol(spec.Name, spec.Owner, spec.ZoneName, spec.Description, spec.MpCount,
+		spec.DpReplicaNum, spec.DpSize, spec.Capacity, createVolOptions{
+			followerRead:    spec.FollowerRead,
+			crossZone:       spec.CrossZone,
+			caseInsensitive: spec.CaseInsensitive,
+		})
+	if err != nil {
+		step.Status = proto.BootstrapStepFailed
+		step.Msg = err.Error()
+		return
+	}
+	if err = m.associateVolWithUser(spec.Owner, spec.Name); err != nil {
+		step.Status = proto.BootstrapStepFailed
+		step.Msg = err.Error()
+		return
+	}
+	step.Status = proto.BootstrapStepCreated
+	step.Msg = fmt.Sprintf("has allocate [%v] data partitions", len(vol.dataPartitions.partitions))
+	return
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// Client leases are only kept in the memory of the leader like the client metrics, and the ones not renewed within
+// this interval (in terms of seconds) are considered as unmounted.
+const defaultClientLeaseExpiredSec = 3 * int64(proto.ClientLeaseInterval/time.Second)
+
+type clientLease struct {
+	Addr      string
+	RenewTime int64
+}
+
+// clientLeases holds the registrations of the mounted clients by the volumes.
+type clientLeases struct {
+	sync.Mutex
+	vols map[string]map[string]*clientLease // vol name -> client id -> lease
+}
+
+func newClientLeases() *clientLeases {
+	return &clientLeases{vols: make(map[string]map[string]*clientLease)}
+}
+
+// register registers the client of the volume, which is rejected if the live clients of the volume reach the
+// maximum. The renewals are always accepted, since the leases are lost once the leader changes.
+func (l *clientLeases) register(volName, clientID, addr string, maxClients int, renew bool) (err error) {
+	l.Lock()
+	defer l.Unlock()
+	clients := l.vols[volName]
+	if clients == nil {
+		clients = make(map[string]*clientLease)
+		l.vols[volName] = clients
+	}
+	now := time.Now().Unix()
+	lease, ok := clients[clientID]
+	if !ok && !renew && maxClients > 0 && expireClientLeases(clients, now) >= maxClients {
+		return proto.ErrTooManyClients
+	}
+	if !ok {
+		lease = new(clientLease)
+		clients[clientID] = lease
+	}
+	lease.Addr = addr
+	lease.RenewTime = now
+	return
+}
+
+func (l *clientLeases) unregister(volName, clientID string) {
+	l.Lock()
+	defer l.Unlock()
+	if clients := l.vols[volName]; clients != nil {
+		delete(clients, clientID)
+	}
+}
+
+// count returns the number of the live clients of the volume.
+func (l *clientLeases) count(volName string) int {
+	l.Lock()
+	defer l.Unlock()
+	clients := l.vols[volName]
+	if clients == nil {
+		return 0
+	}
+	return expireClientLeases(clients, time.Now().Unix())
+}
+
+func expireClientLeases(clients map[string]*clientLease, now int64) int {
+	for id, lease := range clients {
+		if now-lease.RenewTime > defaultClientLeaseExpiredSec {
+			delete(clients, id)
+		}
+	}
+	return len(clients)
+}
+
+// setVolMaxClients overrides the maximum number of the mounted clients of the volume by the administrators. The
+// clients mounted already are not affected by lowering it.
+func (c *Cluster) setVolMaxClients(name string, maxClients int) (err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return proto.ErrVolNotExists
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	oldMaxClients := vol.maxClients
+	vol.maxClients = maxClients
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.maxClients = oldMaxClients
+		log.LogErrorf("action[setVolMaxClients] vol[%v] err[%v]", name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	return
+}
+
+func parseClientID(r *http.Request) (name, clientID string, err error) {
+	if name, err = parseAndExtractName(r); err != nil {
+		return
+	}
+	if clientID = r.FormValue(clientIDKey); clientID == "" {
+		err = keyNotFound(clientIDKey)
+	}
+	return
+}
+
+func (m *Server) registerClient(w http.ResponseWriter, r *http.Request) {
+	var (
+		name     string
+		clientID string
+		renew    bool
+		vol      *Vol
+		err      error
+	)
+	if name, clientID, err = parseClientID(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if value := r.FormValue(renewKey); value != "" {
+		if renew, err = strconv.ParseBool(value); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: unmatchedKey(renewKey).Error()})
+			return
+		}
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	addr := r.FormValue(addrKey)
+	if addr == "" {
+		addr = strings.Split(r.RemoteAddr, colonSplit)[0]
+	}
+	vol.RLock()
+	maxClients := vol.maxClients
+	vol.RUnlock()
+	if err = m.cluster.clientLeases.register(name, clientID, addr, maxClients, renew); err != nil {
+		log.LogWarnf("action[registerClient] vol[%v] client[%v] addr[%v] maxClients[%v] err[%v]",
+			name, clientID, addr, maxClients, err)
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("register client[%v] of vol[%v] successfully", clientID, name)))
+}
+
+func (m *Server) unregisterClient(w http.ResponseWriter, r *http.Request) {
+	name, clientID, err := parseClientID(r)
+	if err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	m.cluster.clientLeases.unregister(name, clientID)
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("unregister client[%v] of vol[%v] successfully", clientID, name)))
+}
+
+func (m *Server) setVolMaxClients(w http.ResponseWriter, r *http.Request) {
+	var (
+		name       string
+		maxClients int
+		err        error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if maxClients, err = strconv.Atoi(r.FormValue(maxClientsKey)); err != nil || maxClients < 0 {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: unmatchedKey(maxClientsKey).Error()})
+		return
+	}
+	if err = m.cluster.setVolMaxClients(name, maxClients); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	msg := fmt.Sprintf("set maxClients of vol[%v] to %v successfully, %v clients are mounted", name, maxClients,
+		m.cluster.clientLeases.count(name))
+	log.LogWarn(msg)
+	sendOkReply(w, r, newSuccessHTTPReply(msg))
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Client metrics are only kept in the memory of the leader, and the ones not reported
+// within this interval (in terms of seconds) are considered as stale.
+const defaultClientMetricsExpiredSec = 10 * 60
+
+// clientMetricsKey returns the key of the metrics of a mount, the mounts of a volume on the same host are told apart
+// by their client IDs, which are empty for the clients registering no ID.
+func clientMetricsKey(metrics *proto.ClientMetrics) string {
+	return metrics.Volume + keySeparator + metrics.Addr + keySeparator + metrics.ClientID
+}
+
+func (c *Cluster) putClientMetrics(metrics *proto.ClientMetrics) {
+	metrics.ReportTime = time.Now().Unix()
+	c.clientMetrics.Store(clientMetricsKey(metrics), metrics)
+}
+
+func (c *Cluster) listClientMetrics(volName string) (metrics []*proto.ClientMetrics) {
+	metrics = make([]*proto.ClientMetrics, 0)
+	now := time.Now().Unix()
+	c.clientMetrics.Range(func(key, value interface{}) bool {
+		cm := value.(*proto.ClientMetrics)
+		if now-cm.ReportTime > defaultClientMetricsExpiredSec {
+			c.clientMetrics.Delete(key)
+			return true
+		}
+		if volName == "" || cm.Volume == volName {
+			metrics = append(metrics, cm)
+		}
+		return true
+	})
+	return
+}
+
+func (m *Server) reportClientMetrics(w http.ResponseWriter, r *http.Request) {
+	var (
+		body    []byte
+		metrics *proto.ClientMetrics
+		vol     *Vol
+		err     error
+	)
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	metrics = &proto.ClientMetrics{}
+	if err = json.Unmarshal(body, metrics); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(metrics.Volume); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	if metrics.Addr == "" {
+		metrics.Addr = strings.Split(r.RemoteAddr, colonSplit)[0]
+	}
+	if metrics.ShadowFailures > 0 {
+		m.cluster.markShadowOutOfSync(vol, fmt.Sprintf("client[%v] failed to mirror %v writes",
+			metrics.Addr, metrics.ShadowFailures))
+	}
+	m.cluster.putClientMetrics(metrics)
+	sendOkReply(w, r, newSuccessHTTPReply("report client metrics successfully"))
+}
+
+func (m *Server) listClientMetrics(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.listClientMetrics(r.FormValue(nameKey))))
+}
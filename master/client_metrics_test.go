@@ -0,0 +1,113 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func clientMetricsByID(metrics []*proto.ClientMetrics) map[string]*proto.ClientMetrics {
+	byID := make(map[string]*proto.ClientMetrics)
+	for _, cm := range metrics {
+		byID[cm.Volume+"/"+cm.ClientID] = cm
+	}
+	return byID
+}
+
+func TestClientMetricsOfMounts(t *testing.T) {
+	c := &Cluster{}
+	// two mounts of the volume on the same host, and a mount of another volume
+	c.putClientMetrics(&proto.ClientMetrics{Volume: "vol1", Addr: "10.0.0.1", ClientID: "a", Inflight: 1})
+	c.putClientMetrics(&proto.ClientMetrics{Volume: "vol1", Addr: "10.0.0.1", ClientID: "b", Inflight: 2})
+	c.putClientMetrics(&proto.ClientMetrics{Volume: "vol2", Addr: "10.0.0.1", ClientID: "a", Inflight: 3})
+	if metrics := c.listClientMetrics("vol1"); len(metrics) != 2 {
+		t.Fatalf("expect the metrics of 2 mounts of vol1, but are %v", len(metrics))
+	}
+	if metrics := c.listClientMetrics(""); len(metrics) != 3 {
+		t.Fatalf("expect the metrics of 3 mounts, but are %v", len(metrics))
+	}
+
+	// the report of a mount replaces its previous one
+	c.putClientMetrics(&proto.ClientMetrics{Volume: "vol1", Addr: "10.0.0.1", ClientID: "b", Inflight: 5})
+	byID := clientMetricsByID(c.listClientMetrics("vol1"))
+	if len(byID) != 2 || byID["vol1/a"].Inflight != 1 || byID["vol1/b"].Inflight != 5 {
+		t.Fatalf("unexpected metrics of vol1 %v", byID)
+	}
+
+	// the metrics of a mount not reported for a while are dropped
+	byID["vol1/a"].ReportTime = time.Now().Unix() - defaultClientMetricsExpiredSec - 1
+	byID = clientMetricsByID(c.listClientMetrics("vol1"))
+	if len(byID) != 1 || byID["vol1/b"] == nil {
+		t.Fatalf("the stale metrics should be dropped, but are %v", byID)
+	}
+	if metrics := c.listClientMetrics(""); len(metrics) != 2 {
+		t.Fatalf("expect the metrics of 2 mounts after the expiration, but are %v", len(metrics))
+	}
+}
+
+func TestReportClientMetrics(t *testing.T) {
+	reportURL := fmt.Sprintf("%v%v", hostAddr, proto.ClientMetricsReport)
+	for _, clientID := range []string{"mount1", "mount2", "mount1"} {
+		data, err := json.Marshal(&proto.ClientMetrics{
+			Volume:   commonVol.Name,
+			ClientID: clientID,
+			OpCounts: map[string]uint64{"read": 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply := post(reportURL, data, t); reply == nil || reply.Code != proto.ErrCodeSuccess {
+			t.Fatalf("report the metrics of %v failed, reply %v", clientID, reply)
+		}
+	}
+	data, _ := json.Marshal(&proto.ClientMetrics{Volume: "notExistVol", ClientID: "mount1"})
+	resp, err := http.Post(reportURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := &proto.HTTPReply{}
+	err = json.NewDecoder(resp.Body).Decode(refused)
+	resp.Body.Close()
+	if err != nil || refused.Code != proto.ErrCodeVolNotExists {
+		t.Fatalf("the metrics of the volume not existing should be refused, reply %v err %v", refused, err)
+	}
+
+	reply := process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.ClientMetricsList, commonVol.Name), t)
+	if reply == nil {
+		return
+	}
+	body, _ := json.Marshal(reply.Data)
+	metrics := make([]*proto.ClientMetrics, 0)
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		t.Fatal(err)
+	}
+	byID := clientMetricsByID(metrics)
+	if len(byID) != 2 || byID[commonVol.Name+"/mount1"] == nil || byID[commonVol.Name+"/mount2"] == nil {
+		t.Fatalf("expect the metrics of mount1 and mount2, but are %v", byID)
+	}
+	for _, cm := range metrics {
+		// the address is taken from the request if not reported
+		if cm.Addr != "127.0.0.1" || cm.OpCounts["read"] != 1 {
+			t.Fatalf("unexpected metrics %v", cm)
+		}
+	}
+}
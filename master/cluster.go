@@ -50,11 +50,32 @@ type Cluster struct {
 	BadDataPartitionIds       *sync.Map
 	BadMetaPartitionIds       *sync.Map
 	DisableAutoAllocate       bool
+	DisableAutoPromoteSpare   bool
+	EnableQuorumWrite         bool
 	fsm                       *MetadataFsm
 	partition                 raftstore.Partition
 	MasterSecretKey           []byte
 	lastMasterZoneForDataNode string
 	lastMasterZoneForMetaNode string
+	clientMetrics             sync.Map
+	lifecycleStatus           sync.Map // vol name -> *volLifecycleStatus
+	spareMigrations           sync.Map // address of the dead data node -> *spareMigration
+	maintenancePlans          sync.Map // plan name -> *maintenancePlan
+	tenants                   sync.Map // tenant name -> *proto.TenantInfo, replaced on every change
+	tenantMutex               sync.Mutex
+	blockRepairs              sync.Map // key of the reported blocks -> *proto.DataBlockReport being repaired
+	metaCacheNodes            sync.Map // address -> *MetaCacheNode registered by the heartbeats
+	events                    *clusterEvents
+	clientLeases              *clientLeases
+	schema                    *schemaState
+	placements                *placementDecisions
+	volUsage                  *volUsageHooks
+	extentCopyJobs            sync.Map // job id -> *extentCopyJob
+	statsTree                 *statsTree
+	dpCreations               *dpCreationQueue
+	readMismatches            *readMismatches
+	nsExports                 sync.Map // vol name -> *nsExportJob
+	orphanExtents             sync.Map // vol name -> *orphanExtentJob
 }
 
 func newCluster(name string, leaderInfo *LeaderInfo, fsm *MetadataFsm, partition raftstore.Partition, cfg *clusterConfig) (c *Cluster) {
@@ -68,6 +89,14 @@ func newCluster(name string, leaderInfo *LeaderInfo, fsm *MetadataFsm, partition
 	c.BadMetaPartitionIds = new(sync.Map)
 	c.dataNodeStatInfo = new(nodeStatInfo)
 	c.metaNodeStatInfo = new(nodeStatInfo)
+	c.events = newClusterEvents()
+	c.clientLeases = newClientLeases()
+	c.schema = newSchemaState()
+	c.placements = newPlacementDecisions()
+	c.readMismatches = newReadMismatches()
+	c.volUsage = newVolUsageHooks()
+	c.statsTree = newStatsTree()
+	c.dpCreations = newDpCreationQueue(cfg)
 	c.zoneStatInfos = make(map[string]*proto.ZoneStat)
 	c.fsm = fsm
 	c.partition = partition
@@ -88,6 +117,14 @@ func (c *Cluster) scheduleTask() {
 	c.scheduleToCheckMetaPartitionRecoveryProgress()
 	c.scheduleToLoadMetaPartitions()
 	c.scheduleToReduceReplicaNum()
+	c.scheduleToCheckSpareDataNodes()
+	c.scheduleToDeleteDataPartitions()
+	c.scheduleToRunLifecycle()
+	c.scheduleToExportNamespace()
+	c.scheduleToReclaimOrphanExtents()
+	c.scheduleToRunMaintenancePlans()
+	c.scheduleToTickVolUsage()
+	c.scheduleToDeliverVolUsageEvents()
 }
 
 func (c *Cluster) masterAddr() (addr string) {
@@ -162,6 +199,9 @@ func (c *Cluster) checkDataPartitions() {
 	vols := c.allVols()
 	for _, vol := range vols {
 		readWrites := vol.checkDataPartitions(c)
+		c.syncFrozenDataReplicas(vol)
+		c.syncDegradedDataReplicas(vol)
+		c.syncResizedDataReplicas(vol)
 		vol.dataPartitions.setReadWriteDataPartitions(readWrites, c.Name)
 		vol.dataPartitions.updateResponseCache(true, 0)
 		msg := fmt.Sprintf("action[checkDataPartitions],vol[%v] can readWrite partitions:%v  ", vol.Name, vol.dataPartitions.readableAndWritableCnt)
@@ -225,9 +265,10 @@ func (c *Cluster) scheduleToCheckHeartbeat() {
 		for {
 			if c.partition != nil && c.partition.IsRaftLeader() {
 				c.checkLeaderAddr()
+				c.adjustHeartbeatInterval()
 				c.checkDataNodeHeartbeat()
 			}
-			time.Sleep(time.Second * defaultIntervalToCheckHeartbeat)
+			time.Sleep(c.cfg.heartbeat.interval())
 		}
 	}()
 
@@ -236,7 +277,7 @@ func (c *Cluster) scheduleToCheckHeartbeat() {
 			if c.partition != nil && c.partition.IsRaftLeader() {
 				c.checkMetaNodeHeartbeat()
 			}
-			time.Sleep(time.Second * defaultIntervalToCheckHeartbeat)
+			time.Sleep(c.cfg.heartbeat.interval())
 		}
 	}()
 }
@@ -248,10 +289,12 @@ func (c *Cluster) checkLeaderAddr() {
 
 func (c *Cluster) checkDataNodeHeartbeat() {
 	tasks := make([]*proto.AdminTask, 0)
+	tokenRequiredVols := c.tokenRequiredVols()
 	c.dataNodes.Range(func(addr, dataNode interface{}) bool {
 		node := dataNode.(*DataNode)
-		node.checkLiveness()
-		task := node.createHeartbeatTask(c.masterAddr())
+		node.checkLiveness(c.cfg.nodeTimeOut())
+		c.checkDataNodeEvents(node)
+		task := node.createHeartbeatTask(c.masterAddr(), c.EnableQuorumWrite, tokenRequiredVols)
 		tasks = append(tasks, task)
 		return true
 	})
@@ -260,10 +303,12 @@ func (c *Cluster) checkDataNodeHeartbeat() {
 
 func (c *Cluster) checkMetaNodeHeartbeat() {
 	tasks := make([]*proto.AdminTask, 0)
+	tokenRequiredVols := c.tokenRequiredVols()
 	c.metaNodes.Range(func(addr, metaNode interface{}) bool {
 		node := metaNode.(*MetaNode)
-		node.checkHeartbeat()
-		task := node.createHeartbeatTask(c.masterAddr())
+		node.checkHeartbeat(c.cfg.nodeTimeOut())
+		c.checkMetaNodeEvents(node)
+		task := node.createHeartbeatTask(c.masterAddr(), tokenRequiredVols)
 		tasks = append(tasks, task)
 		return true
 	})
@@ -292,6 +337,9 @@ func (c *Cluster) checkMetaPartitions() {
 	vols := c.allVols()
 	for _, vol := range vols {
 		vol.checkMetaPartitions(c)
+		c.syncFrozenMetaReplicas(vol)
+		c.syncDegradedMetaReplicas(vol)
+		c.checkShadowFailover(vol)
 	}
 }
 
@@ -430,13 +478,16 @@ func (c *Cluster) updateMetaNodeBaseInfo(nodeAddr string, id uint64) (err error)
 	return
 }
 
-func (c *Cluster) addMetaNode(nodeAddr, zoneName string) (id uint64, err error) {
+func (c *Cluster) addMetaNode(nodeAddr, zoneName, instanceID string) (id uint64, err error) {
 	c.mnMutex.Lock()
 	defer c.mnMutex.Unlock()
 	var metaNode *MetaNode
 	if value, ok := c.metaNodes.Load(nodeAddr); ok {
 		metaNode = value.(*MetaNode)
-		return metaNode.ID, nil
+		if instanceID != "" && metaNode.InstanceID != instanceID {
+			err = c.updateMetaNodeInstance(metaNode, instanceID)
+		}
+		return metaNode.ID, err
 	}
 	metaNode = newMetaNode(nodeAddr, zoneName, c.Name)
 	zone, err := c.t.getZone(zoneName)
@@ -454,6 +505,7 @@ func (c *Cluster) addMetaNode(nodeAddr, zoneName string) (id uint64, err error)
 	}
 	metaNode.ID = id
 	metaNode.NodeSetID = ns.ID
+	metaNode.InstanceID = instanceID
 	if err = c.syncAddMetaNode(metaNode); err != nil {
 		goto errHandler
 	}
@@ -473,13 +525,128 @@ errHandler:
 	return
 }
 
-func (c *Cluster) addDataNode(nodeAddr, zoneName string) (id uint64, err error) {
+// checkDataNodeRegistration validates the registration of a data node, the clock of the node must not skew too much
+// from the master, and an address or an instance can be registered by a single instance or address only.
+// The returned message tells how to fix the refused registration. If the instance is registered with another address
+// which is inactive, the IP of the data node has changed, and the stale record is returned to be moved to the address.
+func (c *Cluster) checkDataNodeRegistration(nodeAddr, instanceID string, reportTime int64) (staleNode *DataNode, msg string, err error) {
+	if msg, err = c.checkNodeClock("data node", nodeAddr, reportTime); err != nil {
+		return
+	}
+	if instanceID == "" {
+		return
+	}
+	if node, ok := c.dataNodes.Load(nodeAddr); ok {
+		dataNode := node.(*DataNode)
+		dataNode.RLock()
+		isActive := dataNode.isActive
+		registeredID := dataNode.InstanceID
+		dataNode.RUnlock()
+		if isActive && registeredID != "" && registeredID != instanceID {
+			err = proto.ErrDuplicateNodeAddr
+			msg = fmt.Sprintf("%v: address[%v] is registered by instance[%v] which is still active, "+
+				"check the localIP and port of the data node of instance[%v]", err, nodeAddr, registeredID, instanceID)
+			return
+		}
+	}
+	c.dataNodes.Range(func(addr, node interface{}) bool {
+		dataNode := node.(*DataNode)
+		dataNode.RLock()
+		registeredID := dataNode.InstanceID
+		isActive := dataNode.isActive
+		dataNode.RUnlock()
+		if dataNode.Addr != nodeAddr && registeredID == instanceID {
+			// the address may be registered by the interrupted move of the record
+			registered, ok := c.dataNodes.Load(nodeAddr)
+			if !isActive && (!ok || registered.(*DataNode).ID == dataNode.ID) {
+				staleNode = dataNode
+				return false
+			}
+			err = proto.ErrDuplicateNodeInstance
+			msg = fmt.Sprintf("%v: instance[%v] of data node[%v] is registered by data node[%v], "+
+				"the data directories may be cloned from it, clean the disks of data node[%v] before starting it",
+				err, instanceID, nodeAddr, dataNode.Addr, nodeAddr)
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// checkNodeClock refuses the registration of a node whose clock skews too much from the master. The report time is 0 if
+// the node is of an old version.
+func (c *Cluster) checkNodeClock(role, nodeAddr string, reportTime int64) (msg string, err error) {
+	if reportTime == 0 {
+		return
+	}
+	skew := time.Now().Unix() - reportTime
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > c.cfg.MaxNodeClockSkewSec {
+		err = proto.ErrNodeClockSkew
+		msg = fmt.Sprintf("%v: the clock of %v[%v] skews [%v]s from the master, more than [%v]s, "+
+			"synchronize its clock with NTP before the registration", err, role, nodeAddr, skew, c.cfg.MaxNodeClockSkewSec)
+	}
+	return
+}
+
+// checkMetaNodeRegistration validates the registration of a meta node in the same way as the one of a data node,
+// except that the instance registered with another address which is inactive is registered again as a new meta node,
+// whose partitions are decommissioned from the stale one as usual.
+func (c *Cluster) checkMetaNodeRegistration(nodeAddr, instanceID string, reportTime int64) (msg string, err error) {
+	if msg, err = c.checkNodeClock("meta node", nodeAddr, reportTime); err != nil {
+		return
+	}
+	if instanceID == "" {
+		return
+	}
+	if node, ok := c.metaNodes.Load(nodeAddr); ok {
+		metaNode := node.(*MetaNode)
+		metaNode.RLock()
+		isActive := metaNode.IsActive
+		registeredID := metaNode.InstanceID
+		metaNode.RUnlock()
+		if isActive && registeredID != "" && registeredID != instanceID {
+			err = proto.ErrDuplicateNodeAddr
+			msg = fmt.Sprintf("%v: address[%v] is registered by instance[%v] which is still active, "+
+				"check the localIP and port of the meta node of instance[%v]", err, nodeAddr, registeredID, instanceID)
+			return
+		}
+	}
+	c.metaNodes.Range(func(addr, node interface{}) bool {
+		metaNode := node.(*MetaNode)
+		metaNode.RLock()
+		registeredID := metaNode.InstanceID
+		isActive := metaNode.IsActive
+		metaNode.RUnlock()
+		if metaNode.Addr == nodeAddr || registeredID != instanceID {
+			return true
+		}
+		if !isActive {
+			log.LogWarnf("action[checkMetaNodeRegistration] instance[%v] of inactive meta node[%v] is registered "+
+				"again with address[%v]", instanceID, metaNode.Addr, nodeAddr)
+			return true
+		}
+		err = proto.ErrDuplicateNodeInstance
+		msg = fmt.Sprintf("%v: instance[%v] of meta node[%v] is registered by meta node[%v], "+
+			"the metadata directory may be cloned from it, clean the metadataDir of meta node[%v] before starting it",
+			err, instanceID, nodeAddr, metaNode.Addr, nodeAddr)
+		return false
+	})
+	return
+}
+
+func (c *Cluster) addDataNode(nodeAddr, zoneName, instanceID string, isSpare bool) (id uint64, err error) {
 	c.dnMutex.Lock()
 	defer c.dnMutex.Unlock()
 	var dataNode *DataNode
 	if node, ok := c.dataNodes.Load(nodeAddr); ok {
 		dataNode = node.(*DataNode)
-		return dataNode.ID, nil
+		if instanceID != "" && dataNode.InstanceID != instanceID {
+			err = c.updateDataNodeInstance(dataNode, instanceID)
+		}
+		return dataNode.ID, err
 	}
 
 	dataNode = newDataNode(nodeAddr, zoneName, c.Name)
@@ -499,6 +666,8 @@ func (c *Cluster) addDataNode(nodeAddr, zoneName string) (id uint64, err error)
 	}
 	dataNode.ID = id
 	dataNode.NodeSetID = ns.ID
+	dataNode.IsSpare = isSpare
+	dataNode.InstanceID = instanceID
 	if err = c.syncAddDataNode(dataNode); err != nil {
 		goto errHandler
 	}
@@ -507,8 +676,8 @@ func (c *Cluster) addDataNode(nodeAddr, zoneName string) (id uint64, err error)
 	}
 	c.t.putDataNode(dataNode)
 	c.dataNodes.Store(nodeAddr, dataNode)
-	log.LogInfof("action[addDataNode],clusterID[%v] dataNodeAddr:%v,nodeSetId[%v],capacity[%v]",
-		c.Name, nodeAddr, ns.ID, ns.Capacity)
+	log.LogInfof("action[addDataNode],clusterID[%v] dataNodeAddr:%v,nodeSetId[%v],capacity[%v],spare[%v]",
+		c.Name, nodeAddr, ns.ID, ns.Capacity, isSpare)
 	return
 errHandler:
 	err = fmt.Errorf("action[addDataNode],clusterID[%v] dataNodeAddr:%v err:%v ", c.Name, nodeAddr, err.Error())
@@ -517,6 +686,125 @@ errHandler:
 	return
 }
 
+// readdressDataNode moves the record of the data node whose IP has changed to the new address, keeping its ID, so that
+// the partitions on it are served from the new address without being decommissioned. The record is added with the
+// new address before the partitions are migrated, and the stale one is deleted at last, so that an interrupted move
+// is resumed by the next registration.
+func (c *Cluster) readdressDataNode(staleNode *DataNode, nodeAddr string) (id uint64, err error) {
+	c.dnMutex.Lock()
+	defer c.dnMutex.Unlock()
+	staleAddr := staleNode.Addr
+	var dataNode *DataNode
+	if node, ok := c.dataNodes.Load(nodeAddr); ok {
+		if dataNode = node.(*DataNode); dataNode.ID != staleNode.ID {
+			return 0, proto.ErrDuplicateNodeAddr
+		}
+	} else {
+		dataNode = newDataNode(nodeAddr, staleNode.ZoneName, c.Name)
+		staleNode.RLock()
+		dataNode.ID = staleNode.ID
+		dataNode.NodeSetID = staleNode.NodeSetID
+		dataNode.IsSpare = staleNode.IsSpare
+		dataNode.InstanceID = staleNode.InstanceID
+		dataNode.PersistenceDataPartitions = staleNode.PersistenceDataPartitions
+		staleNode.RUnlock()
+		if err = c.syncAddDataNode(dataNode); err != nil {
+			goto errHandler
+		}
+		c.t.putDataNode(dataNode)
+		c.dataNodes.Store(nodeAddr, dataNode)
+	}
+	if err = c.migrateDataPartitions(staleAddr, dataNode); err != nil {
+		goto errHandler
+	}
+	if err = c.syncDeleteDataNode(staleNode); err != nil {
+		goto errHandler
+	}
+	c.delDataNodeFromCache(staleNode)
+	Warn(c.Name, fmt.Sprintf("action[readdressDataNode] clusterID[%v] instance[%v] of data node[%v] is moved from [%v] "+
+		"to [%v]", c.Name, dataNode.InstanceID, dataNode.ID, staleAddr, nodeAddr))
+	return dataNode.ID, nil
+errHandler:
+	err = fmt.Errorf("action[readdressDataNode],clusterID[%v] data node[%v] from [%v] to [%v] err:%v ",
+		c.Name, staleNode.ID, staleAddr, nodeAddr, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+// migrateDataPartitions replaces the stale address of the data node with its new address in the hosts, the peers and
+// the replicas of the partitions on it.
+func (c *Cluster) migrateDataPartitions(staleAddr string, dataNode *DataNode) (err error) {
+	for _, dp := range c.getAllDataPartitionByDataNode(staleAddr) {
+		dp.Lock()
+		hosts := make([]string, len(dp.Hosts))
+		for i, host := range dp.Hosts {
+			if hosts[i] = host; host == staleAddr {
+				hosts[i] = dataNode.Addr
+			}
+		}
+		peers := make([]proto.Peer, len(dp.Peers))
+		for i, peer := range dp.Peers {
+			if peers[i] = peer; peer.Addr == staleAddr {
+				peers[i].Addr = dataNode.Addr
+			}
+		}
+		for _, replica := range dp.Replicas {
+			if replica.Addr == staleAddr {
+				replica.Addr = dataNode.Addr
+				replica.dataNode = dataNode
+			}
+		}
+		delete(dp.MissingNodes, staleAddr)
+		err = dp.update("migrateDataPartitions", dp.VolName, peers, hosts, c)
+		dp.Unlock()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Record the instance of a data node registered by an old version, or replaced by a new instance since its disks are
+// cleaned or replaced.
+func (c *Cluster) updateDataNodeInstance(dataNode *DataNode, instanceID string) (err error) {
+	dataNode.Lock()
+	oldInstanceID := dataNode.InstanceID
+	dataNode.InstanceID = instanceID
+	dataNode.Unlock()
+	if err = c.syncUpdateDataNode(dataNode); err != nil {
+		dataNode.Lock()
+		dataNode.InstanceID = oldInstanceID
+		dataNode.Unlock()
+		return
+	}
+	if oldInstanceID != "" {
+		Warn(c.Name, fmt.Sprintf("action[updateDataNodeInstance] clusterID[%v] instance[%v] of data node[%v] is replaced by instance[%v]",
+			c.Name, oldInstanceID, dataNode.Addr, instanceID))
+	}
+	return
+}
+
+// Record the instance of a meta node registered by an old version, or replaced by a new instance since its metadata
+// directory is cleaned or replaced.
+func (c *Cluster) updateMetaNodeInstance(metaNode *MetaNode, instanceID string) (err error) {
+	metaNode.Lock()
+	oldInstanceID := metaNode.InstanceID
+	metaNode.InstanceID = instanceID
+	metaNode.Unlock()
+	if err = c.syncUpdateMetaNode(metaNode); err != nil {
+		metaNode.Lock()
+		metaNode.InstanceID = oldInstanceID
+		metaNode.Unlock()
+		return
+	}
+	if oldInstanceID != "" {
+		Warn(c.Name, fmt.Sprintf("action[updateMetaNodeInstance] clusterID[%v] instance[%v] of meta node[%v] is replaced by instance[%v]",
+			c.Name, oldInstanceID, metaNode.Addr, instanceID))
+	}
+	return
+}
+
 func (c *Cluster) checkCorruptDataPartitions() (inactiveDataNodes []string, corruptPartitions []*DataPartition, err error) {
 	partitionMap := make(map[uint64]uint8)
 	inactiveDataNodes = make([]string, 0)
@@ -628,30 +916,91 @@ func (c *Cluster) markDeleteVol(name, authKey string) (err error) {
 	if !matchKey(serverAuthKey, authKey) {
 		return proto.ErrVolAuthKeyNotMatch
 	}
+	if c.isLiveShadowVol(vol) {
+		return proto.ErrShadowVol
+	}
 
+	vol.Lock()
+	defer vol.Unlock()
+	if vol.Status == markDelete {
+		return
+	}
 	vol.Status = markDelete
+	vol.deleteTime = time.Now().Unix()
 	if err = c.syncUpdateVol(vol); err != nil {
 		vol.Status = normal
+		vol.deleteTime = 0
 		return proto.ErrPersistenceByRaft
 	}
+	log.LogWarnf("action[markDeleteVol] vol[%v] pending delete for %v seconds", name, c.cfg.VolDeleteGracePeriodSec)
+	c.syncShadowVolStatus(vol)
 	return
 }
 
-func (c *Cluster) batchCreateDataPartition(vol *Vol, reqCount int) (err error) {
-	var zoneNum int
+// undeleteVol restores the volume marked deleted, if its grace period has not expired.
+func (c *Cluster) undeleteVol(name, authKey string) (vol *Vol, err error) {
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[undeleteVol] err[%v]", err)
+		return nil, proto.ErrVolNotExists
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return nil, proto.ErrVolAuthKeyNotMatch
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if vol.Status != markDelete {
+		return nil, proto.ErrVolNotDeleted
+	}
+	if !vol.inDeleteGracePeriod(c.cfg.VolDeleteGracePeriodSec) {
+		return nil, proto.ErrVolDeleteGraceExpired
+	}
+	deleteTime := vol.deleteTime
+	vol.Status = normal
+	vol.deleteTime = 0
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.Status = markDelete
+		vol.deleteTime = deleteTime
+		return nil, proto.ErrPersistenceByRaft
+	}
+	c.syncShadowVolStatus(vol)
+	return
+}
+
+// batchCreateDataPartition creates the data partitions of the volume, and returns the placement decisions of the
+// created ones.
+// batchCreateDataPartition creates the data partitions of the volume planned by its capacity of the allocation epoch,
+// and stops with ErrStaleVolCapacity once the capacity is changed.
+func (c *Cluster) batchCreateDataPartition(vol *Vol, reqCount int, epoch uint64) (decisions []*proto.PlacementDecision, err error) {
+	var (
+		zoneNum int
+		dp      *DataPartition
+	)
+	decisions = make([]*proto.PlacementDecision, 0)
 	for i := 0; i < reqCount; i++ {
 		if c.DisableAutoAllocate {
 			return
 		}
 		zoneNum = c.decideZoneNum(vol.crossZone)
-		//most of partitions are replicated across 3 zones,but a few partitions are replicated across 2 zones
-		if vol.crossZone && i%5 == 0 {
+		//most of partitions are replicated across 3 zones,but a few partitions are replicated across 2 zones,
+		//unless a zone holds at most one replica
+		if vol.crossZone && i%5 == 0 && vol.failureDomain != proto.FailureDomainZone {
 			zoneNum = 2
 		}
-		if _, err = c.createDataPartition(vol.Name, zoneNum); err != nil {
+		if err = c.checkUnreservedSpace(vol); err != nil {
+			log.LogErrorf("action[batchCreateDataPartition] vol[%v] after create [%v] data partition, err[%v]", vol.Name, i, err)
+			break
+		}
+		if err = c.dpCreations.acquire(vol.Name); err != nil {
+			log.LogErrorf("action[batchCreateDataPartition] vol[%v] after create [%v] data partition, err[%v]", vol.Name, i, err)
+			break
+		}
+		dp, err = c.createDataPartition(vol.Name, zoneNum, epoch)
+		c.dpCreations.release(vol.Name)
+		if err != nil {
 			log.LogErrorf("action[batchCreateDataPartition] after create [%v] data partition,occurred error,err[%v]", i, err)
 			break
 		}
+		decisions = append(decisions, c.placements.list(dp.PartitionID)...)
 	}
 	return
 }
@@ -662,7 +1011,15 @@ func (c *Cluster) batchCreateDataPartition(vol *Vol, reqCount int) (err error) {
 // 3. Communicate with the data node to synchronously create a data partition.
 // - If succeeded, replicate the data through raft and persist it to RocksDB.
 // - Otherwise, throw errors
-func (c *Cluster) createDataPartition(volName string, zoneNum int) (dp *DataPartition, err error) {
+// The creation is rejected if the capacity of the volume is changed since the allocation epoch it is planned by.
+func (c *Cluster) createDataPartition(volName string, zoneNum int, epoch uint64) (dp *DataPartition, err error) {
+	return c.doCreateDataPartition(volName, zoneNum, epoch, "")
+}
+
+// doCreateDataPartition creates a data partition of the volume, which is a read-only cold data partition in the cold
+// zone if the zone is specified.
+func (c *Cluster) doCreateDataPartition(volName string, zoneNum int, epoch uint64, coldZone string) (dp *DataPartition,
+	err error) {
 	var (
 		vol         *Vol
 		partitionID uint64
@@ -676,30 +1033,42 @@ func (c *Cluster) createDataPartition(volName string, zoneNum int) (dp *DataPart
 	}
 	vol.createDpMutex.Lock()
 	defer vol.createDpMutex.Unlock()
+	if vol.allocationEpoch() != epoch {
+		return nil, proto.ErrStaleVolCapacity
+	}
 	errChannel := make(chan error, vol.dpReplicaNum)
-	if targetHosts, targetPeers, err = c.chooseTargetDataNodes("", nil, nil, int(vol.dpReplicaNum), zoneNum, vol.zoneName); err != nil {
+	placements := make([]*proto.ReplicaPlacement, 0, vol.dpReplicaNum)
+	if coldZone != "" {
+		targetHosts, targetPeers, err = c.chooseTargetDataNodes("", nil, nil, int(vol.dpReplicaNum), 1, coldZone)
+	} else {
+		targetHosts, targetPeers, err = c.chooseTargetDataNodesInFailureDomain(vol, zoneNum)
+	}
+	if err != nil {
 		goto errHandler
 	}
 	if partitionID, err = c.idAlloc.allocateDataPartitionID(); err != nil {
 		goto errHandler
 	}
 	dp = newDataPartition(partitionID, vol.dpReplicaNum, volName, vol.ID)
+	dp.isCold = coldZone != ""
 	dp.Hosts = targetHosts
 	dp.Peers = targetPeers
+	dp.size = vol.dataPartitionSize
 	for _, host := range targetHosts {
 		wg.Add(1)
 		go func(host string) {
 			defer func() {
 				wg.Done()
 			}()
-			var diskPath string
-			if diskPath, err = c.syncCreateDataPartitionToDataNode(host, vol.dataPartitionSize, dp, dp.Peers, dp.Hosts, proto.NormalCreateDataPartition); err != nil {
+			var placement *proto.ReplicaPlacement
+			if placement, err = c.syncCreateDataPartitionToDataNode(host, dp.size, dp, dp.Peers, dp.Hosts, proto.NormalCreateDataPartition); err != nil {
 				errChannel <- err
 				return
 			}
 			dp.Lock()
 			defer dp.Unlock()
-			if err = dp.afterCreation(host, diskPath, c); err != nil {
+			placements = append(placements, placement)
+			if err = dp.afterCreation(host, placement.DiskPath, c); err != nil {
 				errChannel <- err
 			}
 		}(host)
@@ -726,14 +1095,19 @@ func (c *Cluster) createDataPartition(volName string, zoneNum int) (dp *DataPart
 		wg.Wait()
 		goto errHandler
 	default:
-		dp.total = util.DefaultDataPartitionSize
+		dp.total = dp.size
 		dp.Status = proto.ReadWrite
+		if dp.isCold {
+			dp.Status = proto.ReadOnly
+		}
 	}
 	if err = c.syncAddDataPartition(dp); err != nil {
 		goto errHandler
 	}
 	vol.dataPartitions.put(dp)
-	log.LogInfof("action[createDataPartition] success,volName[%v],partitionId[%v]", volName, partitionID)
+	c.recordPlacement(dp, proto.NormalCreateDataPartition, placements)
+	log.LogInfof("action[createDataPartition] success,volName[%v],partitionId[%v],coldZone[%v]", volName, partitionID,
+		coldZone)
 	return
 errHandler:
 	err = fmt.Errorf("action[createDataPartition],clusterID[%v] vol[%v] Err:%v ", c.Name, volName, err.Error())
@@ -742,23 +1116,35 @@ errHandler:
 	return
 }
 
-func (c *Cluster) syncCreateDataPartitionToDataNode(host string, size uint64, dp *DataPartition, peers []proto.Peer, hosts []string, createType int) (diskPath string, err error) {
-	task := dp.createTaskToCreateDataPartition(host, size, peers, hosts, createType)
+// syncCreateDataPartitionToDataNode creates the replica of the data partition on the emptiest eligible disk of the
+// data node, and returns its placement.
+func (c *Cluster) syncCreateDataPartitionToDataNode(host string, size uint64, dp *DataPartition, peers []proto.Peer, hosts []string, createType int) (placement *proto.ReplicaPlacement, err error) {
 	dataNode, err := c.dataNode(host)
 	if err != nil {
 		return
 	}
+	placement = &proto.ReplicaPlacement{Addr: host}
+	dataNode.RLock()
+	placement.Zone, placement.Rack = dataNode.ZoneName, dataNode.Rack
+	dataNode.RUnlock()
+	placement.PreferredDisk, placement.PreferredUsage = dataNode.preferredDisk()
+	task := dp.createTaskToCreateDataPartition(host, size, peers, hosts, createType, placement.PreferredDisk)
 	var resp *proto.Packet
 	if resp, err = dataNode.TaskManager.syncSendAdminTask(task); err != nil {
 		return
 	}
-	return string(resp.Data), nil
+	placement.DiskPath = string(resp.Data)
+	return placement, nil
 }
 
 func (c *Cluster) syncCreateMetaPartitionToMetaNode(host string, mp *MetaPartition) (err error) {
 	hosts := make([]string, 0)
 	hosts = append(hosts, host)
-	tasks := mp.buildNewMetaPartitionTasks(hosts, mp.Peers, mp.volName)
+	vol, err := c.getVol(mp.volName)
+	if err != nil {
+		return
+	}
+	tasks := mp.buildNewMetaPartitionTasks(hosts, mp.Peers, mp.volName, vol.caseInsensitive, vol.shadowName())
 	metaNode, err := c.metaNode(host)
 	if err != nil {
 		return
@@ -1030,6 +1416,7 @@ func (c *Cluster) decommissionDataNode(dataNode *DataNode) (err error) {
 func (c *Cluster) delDataNodeFromCache(dataNode *DataNode) {
 	c.dataNodes.Delete(dataNode.Addr)
 	c.t.deleteDataNode(dataNode)
+	c.statsTree.remove(proto.NodeRoleData, dataNode.Addr)
 	go dataNode.clean()
 }
 
@@ -1044,6 +1431,12 @@ func (c *Cluster) delDataNodeFromCache(dataNode *DataNode) {
 // 5. Set the data partition as readOnly.
 // 6. persistent the new host list
 func (c *Cluster) decommissionDataPartition(offlineAddr string, dp *DataPartition, errMsg string) (err error) {
+	return c.decommissionDataPartitionToTarget(offlineAddr, dp, errMsg, "")
+}
+
+// decommissionDataPartitionToTarget decommissions the data partition, and the new replica is created on
+// the target data node preferentially if it is writable.
+func (c *Cluster) decommissionDataPartitionToTarget(offlineAddr string, dp *DataPartition, errMsg, targetAddr string) (err error) {
 	var (
 		targetHosts     []string
 		newAddr         string
@@ -1081,7 +1474,9 @@ func (c *Cluster) decommissionDataPartition(offlineAddr string, dp *DataPartitio
 	if ns, err = zone.getNodeSet(dataNode.NodeSetID); err != nil {
 		goto errHandler
 	}
-	if targetHosts, _, err = ns.getAvailDataNodeHosts(dp.Hosts, 1); err != nil {
+	if targetAddr != "" && c.isDataNodeWritableTarget(targetAddr, dp) {
+		targetHosts = []string{targetAddr}
+	} else if targetHosts, _, err = ns.getAvailDataNodeHosts(dp.Hosts, 1); err != nil {
 		// select data nodes from the other node set in same zone
 		excludeNodeSets = append(excludeNodeSets, ns.ID)
 		if targetHosts, _, err = zone.getAvailDataNodeHosts(excludeNodeSets, dp.Hosts, 1); err != nil {
@@ -1145,6 +1540,10 @@ func (c *Cluster) validateDecommissionDataPartition(dp *DataPartition, offlineAd
 		err = fmt.Errorf("vol[%v],data partition[%v] is recovering,[%v] can't be decommissioned", vol.Name, dp.PartitionID, offlineAddr)
 		return
 	}
+	if dp.isFrozen {
+		err = proto.ErrDataPartitionFrozen
+		return
+	}
 	return
 }
 
@@ -1154,6 +1553,9 @@ func (c *Cluster) addDataReplica(dp *DataPartition, addr string) (err error) {
 			log.LogErrorf("action[addDataReplica],vol[%v],data partition[%v],err[%v]", dp.VolName, dp.PartitionID, err)
 		}
 	}()
+	if dp.isFrozen {
+		return proto.ErrDataPartitionFrozen
+	}
 	dataNode, err := c.dataNode(addr)
 	if err != nil {
 		return
@@ -1247,8 +1649,7 @@ func (c *Cluster) addDataPartitionRaftMember(dp *DataPartition, addPeer proto.Pe
 }
 
 func (c *Cluster) createDataReplica(dp *DataPartition, addPeer proto.Peer) (err error) {
-	vol, err := c.getVol(dp.VolName)
-	if err != nil {
+	if _, err = c.getVol(dp.VolName); err != nil {
 		return
 	}
 	dp.RLock()
@@ -1256,14 +1657,17 @@ func (c *Cluster) createDataReplica(dp *DataPartition, addPeer proto.Peer) (err
 	copy(hosts, dp.Hosts)
 	peers := make([]proto.Peer, len(dp.Peers))
 	copy(peers, dp.Peers)
+	size := dp.size
 	dp.RUnlock()
-	diskPath, err := c.syncCreateDataPartitionToDataNode(addPeer.Addr, vol.dataPartitionSize, dp, peers, hosts, proto.DecommissionedCreateDataPartition)
+	// the new replica takes the size of the partition, which may have been grown beyond the one of the vol
+	placement, err := c.syncCreateDataPartitionToDataNode(addPeer.Addr, size, dp, peers, hosts, proto.DecommissionedCreateDataPartition)
 	if err != nil {
 		return
 	}
+	c.recordPlacement(dp, proto.DecommissionedCreateDataPartition, []*proto.ReplicaPlacement{placement})
 	dp.Lock()
 	defer dp.Unlock()
-	if err = dp.afterCreation(addPeer.Addr, diskPath, c); err != nil {
+	if err = dp.afterCreation(addPeer.Addr, placement.DiskPath, c); err != nil {
 		return
 	}
 	if err = dp.update("createDataReplica", dp.VolName, dp.Peers, dp.Hosts, c); err != nil {
@@ -1283,6 +1687,10 @@ func (c *Cluster) removeDataReplica(dp *DataPartition, addr string, validate boo
 			return
 		}
 	}
+	if dp.isFrozen {
+		err = proto.ErrDataPartitionFrozen
+		return
+	}
 	ok := c.isRecovering(dp, addr)
 	if ok {
 		err = fmt.Errorf("vol[%v],data partition[%v] can't decommision until it has recovered", dp.VolName, dp.PartitionID)
@@ -1495,6 +1903,7 @@ func (c *Cluster) decommissionMetaNode(metaNode *MetaNode) (err error) {
 func (c *Cluster) deleteMetaNodeFromCache(metaNode *MetaNode) {
 	c.metaNodes.Delete(metaNode.Addr)
 	c.t.deleteMetaNode(metaNode)
+	c.statsTree.remove(proto.NodeRoleMeta, metaNode.Addr)
 	go metaNode.clean()
 }
 
@@ -1511,25 +1920,59 @@ func (c *Cluster) updateVol(name, authKey string, newArgs *VolVarargs) (err erro
 		oldDescription    string
 		oldDpSelectorName string
 		oldDpSelectorParm string
+		oldDpAffinity     string
+		oldFailureDomain  string
+		oldMinVersion     string
+		oldFeatures       map[string]bool
+		oldMultipartTTL   int64
+		oldMetaCache      bool
+		oldMaxClients     int
+		oldVerifyReads    bool
+		oldVerifyPercent  int
+		oldSyncOnRename   bool
+		oldRequireToken   bool
+		oldColdZone       string
+		oldNamePolicy     proto.DentryNamePolicy
 		volUsedSpace      uint64
+		tenantInfo        *proto.TenantInfo
 	)
 	if vol, err = c.getVol(name); err != nil {
 		log.LogErrorf("action[updateVol] err[%v]", err)
 		err = proto.ErrVolNotExists
 		goto errHandler
 	}
+	// the capacity is changed between the data partition creations, which are planned by the capacity
+	vol.createDpMutex.Lock()
+	defer vol.createDpMutex.Unlock()
 	vol.Lock()
 	defer vol.Unlock()
 	serverAuthKey = vol.Owner
 	if !matchKey(serverAuthKey, authKey) {
 		return proto.ErrVolAuthKeyNotMatch
 	}
+	if newArgs.requireToken && c.cfg.tokenSigningKey == "" {
+		return proto.ErrDelegatedTokenNotEnabled
+	}
 	volUsedSpace = vol.totalUsedSpace()
 	if float64(newArgs.capacity*util.GB) < float64(volUsedSpace)*1.2 {
 		err = fmt.Errorf("capacity[%v] has to be 20 percent larger than the used space[%v]", newArgs.capacity,
 			volUsedSpace/util.GB)
 		goto errHandler
 	}
+	if reserved := vol.reservedSizeLocked(time.Now().Unix()); newArgs.capacity < volUsedSpace/util.GB+reserved {
+		log.LogWarnf("action[updateVol] vol[%v] capacity[%v] used[%v] reserved[%v]", name, newArgs.capacity,
+			volUsedSpace/util.GB, reserved)
+		return proto.ErrVolReservationExceedsCapacity
+	}
+	if newArgs.capacity > vol.Capacity {
+		c.tenantMutex.Lock()
+		defer c.tenantMutex.Unlock()
+		if tenantInfo = c.tenantOfVol(name); tenantInfo != nil {
+			if err = c.checkTenantQuota(tenantInfo, name, newArgs.capacity); err != nil {
+				return
+			}
+		}
+	}
 	if newArgs.dpReplicaNum > vol.dpReplicaNum {
 		err = fmt.Errorf("don't support new replicaNum[%v] larger than old dpReplicaNum[%v]", newArgs.dpReplicaNum,
 			vol.dpReplicaNum)
@@ -1554,6 +1997,17 @@ func (c *Cluster) updateVol(name, authKey string, newArgs *VolVarargs) (err erro
 			goto errHandler
 		}
 	}
+	if newArgs.coldZone != "" && newArgs.coldZone != vol.coldZone {
+		if _, err = c.t.getZone(newArgs.coldZone); err != nil {
+			goto errHandler
+		}
+	}
+	// the cold zone is kept for the lifecycle rules moving the files to it
+	for _, rule := range vol.lifecycleRules {
+		if rule.TransitionDays > 0 && newArgs.coldZone == "" {
+			return proto.ErrVolNoColdZone
+		}
+	}
 
 	oldCapacity = vol.Capacity
 	oldDpReplicaNum = vol.dpReplicaNum
@@ -1564,6 +2018,19 @@ func (c *Cluster) updateVol(name, authKey string, newArgs *VolVarargs) (err erro
 	oldDescription = vol.description
 	oldDpSelectorName = vol.dpSelectorName
 	oldDpSelectorParm = vol.dpSelectorParm
+	oldDpAffinity = vol.dpAffinity
+	oldFailureDomain = vol.failureDomain
+	oldMinVersion = vol.minClientVersion
+	oldFeatures = vol.features
+	oldMultipartTTL = vol.multipartTTL
+	oldMetaCache = vol.metaCache
+	oldMaxClients = vol.maxClients
+	oldVerifyReads = vol.verifyReads
+	oldVerifyPercent = vol.verifyReadsPercent
+	oldSyncOnRename = vol.syncOnRename
+	oldRequireToken = vol.requireToken
+	oldColdZone = vol.coldZone
+	oldNamePolicy = vol.namePolicy
 
 	vol.zoneName = newArgs.zoneName
 	vol.Capacity = newArgs.capacity
@@ -1579,6 +2046,19 @@ func (c *Cluster) updateVol(name, authKey string, newArgs *VolVarargs) (err erro
 	}
 	vol.dpSelectorName = newArgs.dpSelectorName
 	vol.dpSelectorParm = newArgs.dpSelectorParm
+	vol.dpAffinity = newArgs.dpAffinity
+	vol.failureDomain = newArgs.failureDomain
+	vol.minClientVersion = newArgs.minClientVersion
+	vol.features = newArgs.features
+	vol.multipartTTL = newArgs.multipartTTL
+	vol.metaCache = newArgs.metaCache
+	vol.maxClients = newArgs.maxClients
+	vol.verifyReads = newArgs.verifyReads
+	vol.verifyReadsPercent = newArgs.verifyReadsPercent
+	vol.syncOnRename = newArgs.syncOnRename
+	vol.requireToken = newArgs.requireToken
+	vol.coldZone = newArgs.coldZone
+	vol.namePolicy = newArgs.namePolicy
 
 	if err = c.syncUpdateVol(vol); err != nil {
 		vol.Capacity = oldCapacity
@@ -1590,11 +2070,30 @@ func (c *Cluster) updateVol(name, authKey string, newArgs *VolVarargs) (err erro
 		vol.description = oldDescription
 		vol.dpSelectorName = oldDpSelectorName
 		vol.dpSelectorParm = oldDpSelectorParm
+		vol.dpAffinity = oldDpAffinity
+		vol.failureDomain = oldFailureDomain
+		vol.minClientVersion = oldMinVersion
+		vol.features = oldFeatures
+		vol.multipartTTL = oldMultipartTTL
+		vol.metaCache = oldMetaCache
+		vol.maxClients = oldMaxClients
+		vol.verifyReads = oldVerifyReads
+		vol.verifyReadsPercent = oldVerifyPercent
+		vol.syncOnRename = oldSyncOnRename
+		vol.requireToken = oldRequireToken
+		vol.coldZone = oldColdZone
+		vol.namePolicy = oldNamePolicy
 
 		log.LogErrorf("action[updateVol] vol[%v] err[%v]", name, err)
 		err = proto.ErrPersistenceByRaft
 		goto errHandler
 	}
+	if vol.Capacity != oldCapacity {
+		vol.allocEpoch++
+		event := c.newVolUsageEvent(proto.VolUsageCapacityChange, vol)
+		event.OldCapacity = oldCapacity
+		c.recordVolUsageEvent(event)
+	}
 	return
 errHandler:
 	err = fmt.Errorf("action[updateVol], clusterID[%v] name:%v, err:%v ", c.Name, name, err.Error())
@@ -1603,12 +2102,25 @@ errHandler:
 	return
 }
 
+// createVolOptions defines the switches of a new volume.
+type createVolOptions struct {
+	followerRead    bool
+	authenticate    bool
+	crossZone       bool
+	enableToken     bool
+	caseInsensitive bool
+	shadow          bool // create the shadow volume along with the volume
+}
+
 // Create a new volume.
 // By default we create 3 meta partitions and 10 data partitions during initialization.
-func (c *Cluster) createVol(name, owner, zoneName, description string, mpCount, dpReplicaNum, size, capacity int, followerRead, authenticate, crossZone, enableToken bool) (vol *Vol, err error) {
+// A volume with the shadow is created after the shadow, which is placed on the other nodes.
+func (c *Cluster) createVol(name, owner, zoneName, description string, mpCount, dpReplicaNum, size, capacity int, opts createVolOptions) (vol *Vol, err error) {
 	var (
 		dataPartitionSize       uint64
 		readWriteDataPartitions int
+		shadowVol               *Vol
+		shadowName              string
 	)
 	if size == 0 {
 		dataPartitionSize = util.DefaultDataPartitionSize
@@ -1616,20 +2128,30 @@ func (c *Cluster) createVol(name, owner, zoneName, description string, mpCount,
 		dataPartitionSize = uint64(size) * util.GB
 	}
 
-	if crossZone && c.t.zoneLen() <= 1 {
+	if opts.crossZone && c.t.zoneLen() <= 1 {
 		return nil, fmt.Errorf("cluster has one zone,can't cross zone")
 	}
-	if crossZone && zoneName != "" {
+	if opts.crossZone && zoneName != "" {
 		return nil, fmt.Errorf("only the vol which don't across zones,can specified zoneName")
 	}
 	if zoneName != "" {
 		if _, err = c.t.getZone(zoneName); err != nil {
 			return
 		}
-	} else if !crossZone {
+	} else if !opts.crossZone {
 		zoneName = DefaultZoneName
 	}
-	if vol, err = c.doCreateVol(name, owner, zoneName, description, dataPartitionSize, uint64(capacity), dpReplicaNum, followerRead, authenticate, crossZone, enableToken); err != nil {
+	if opts.shadow {
+		if _, err = c.getVol(name); err == nil {
+			err = proto.ErrDuplicateVol
+			goto errHandler
+		}
+		if shadowVol, err = c.createShadowVol(name, owner, zoneName, description, mpCount, dpReplicaNum, size, capacity, opts); err != nil {
+			goto errHandler
+		}
+		shadowName = shadowVol.Name
+	}
+	if vol, err = c.doCreateVol(name, owner, zoneName, description, dataPartitionSize, uint64(capacity), dpReplicaNum, opts, shadowName); err != nil {
 		goto errHandler
 	}
 	if err = vol.initMetaPartitions(c, mpCount); err != nil {
@@ -1647,17 +2169,21 @@ func (c *Cluster) createVol(name, owner, zoneName, description string, mpCount,
 	}
 	vol.dataPartitions.readableAndWritableCnt = readWriteDataPartitions
 	vol.updateViewCache(c)
+	c.recordVolUsageEvent(c.newVolUsageEvent(proto.VolUsageCreate, vol))
 	log.LogInfof("action[createVol] vol[%v],readableAndWritableCnt[%v]", name, readWriteDataPartitions)
 	return
 
 errHandler:
+	if shadowVol != nil {
+		c.abandonShadowVol(shadowVol)
+	}
 	err = fmt.Errorf("action[createVol], clusterID[%v] name:%v, err:%v ", c.Name, name, err)
 	log.LogError(errors.Stack(err))
 	Warn(c.Name, err.Error())
 	return
 }
 
-func (c *Cluster) doCreateVol(name, owner, zoneName, description string, dpSize, capacity uint64, dpReplicaNum int, followerRead, authenticate, crossZone, enableToken bool) (vol *Vol, err error) {
+func (c *Cluster) doCreateVol(name, owner, zoneName, description string, dpSize, capacity uint64, dpReplicaNum int, opts createVolOptions, shadow string) (vol *Vol, err error) {
 	var id uint64
 	c.createVolMutex.Lock()
 	defer c.createVolMutex.Unlock()
@@ -1670,14 +2196,18 @@ func (c *Cluster) doCreateVol(name, owner, zoneName, description string, dpSize,
 	if err != nil {
 		goto errHandler
 	}
-	vol = newVol(id, name, owner, zoneName, dpSize, capacity, uint8(dpReplicaNum), defaultReplicaNum, followerRead, authenticate, crossZone, enableToken, createTime, description)
+	vol = newVol(id, name, owner, zoneName, dpSize, capacity, uint8(dpReplicaNum), defaultReplicaNum, opts.followerRead, opts.authenticate, opts.crossZone, opts.enableToken, createTime, description)
+	vol.caseInsensitive = opts.caseInsensitive
+	if shadow != "" {
+		vol.shadow = &proto.VolShadowView{Name: shadow}
+	}
 	// refresh oss secure
 	vol.refreshOSSSecure()
 	if err = c.syncAddVol(vol); err != nil {
 		goto errHandler
 	}
 	c.putVol(vol)
-	if enableToken {
+	if opts.enableToken {
 		if err = c.createToken(vol, proto.ReadOnlyToken); err != nil {
 			goto errHandler
 		}
@@ -1844,7 +2374,8 @@ func (c *Cluster) allDataNodes() (dataNodes []proto.NodeView) {
 	dataNodes = make([]proto.NodeView, 0)
 	c.dataNodes.Range(func(addr, node interface{}) bool {
 		dataNode := node.(*DataNode)
-		dataNodes = append(dataNodes, proto.NodeView{Addr: dataNode.Addr, Status: dataNode.isActive, ID: dataNode.ID, IsWritable: dataNode.isWriteAble()})
+		dataNodes = append(dataNodes, proto.NodeView{Addr: dataNode.Addr, Status: dataNode.isActive, ID: dataNode.ID, IsWritable: dataNode.isWriteAble(),
+			ReplicaIP: dataNode.ReplicaIP})
 		return true
 	})
 	return
@@ -1854,7 +2385,8 @@ func (c *Cluster) allMetaNodes() (metaNodes []proto.NodeView) {
 	metaNodes = make([]proto.NodeView, 0)
 	c.metaNodes.Range(func(addr, node interface{}) bool {
 		metaNode := node.(*MetaNode)
-		metaNodes = append(metaNodes, proto.NodeView{ID: metaNode.ID, Addr: metaNode.Addr, Status: metaNode.IsActive, IsWritable: metaNode.isWritable()})
+		metaNodes = append(metaNodes, proto.NodeView{ID: metaNode.ID, Addr: metaNode.Addr, Status: metaNode.IsActive, IsWritable: metaNode.isWritable(),
+			ReplicaIP: metaNode.ReplicaIP})
 		return true
 	})
 	return
@@ -1982,6 +2514,30 @@ func (c *Cluster) setDisableAutoAllocate(disableAutoAllocate bool) (err error) {
 	return
 }
 
+func (c *Cluster) setEnableQuorumWrite(enableQuorumWrite bool) (err error) {
+	oldFlag := c.EnableQuorumWrite
+	c.EnableQuorumWrite = enableQuorumWrite
+	if err = c.syncPutCluster(); err != nil {
+		log.LogErrorf("action[setEnableQuorumWrite] err[%v]", err)
+		c.EnableQuorumWrite = oldFlag
+		err = proto.ErrPersistenceByRaft
+		return
+	}
+	return
+}
+
+func (c *Cluster) setDisableAutoPromoteSpare(disableAutoPromoteSpare bool) (err error) {
+	oldFlag := c.DisableAutoPromoteSpare
+	c.DisableAutoPromoteSpare = disableAutoPromoteSpare
+	if err = c.syncPutCluster(); err != nil {
+		log.LogErrorf("action[setDisableAutoPromoteSpare] err[%v]", err)
+		c.DisableAutoPromoteSpare = oldFlag
+		err = proto.ErrPersistenceByRaft
+		return
+	}
+	return
+}
+
 func (c *Cluster) clearVols() {
 	c.volMutex.Lock()
 	defer c.volMutex.Unlock()
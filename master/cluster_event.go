@@ -0,0 +1,436 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// clusterEvents keeps the recent events raised by the checks of the leader, and pushes them to the webhooks.
+// The events are raised on the changes of the conditions only, so a condition lasting for many checks raises one
+// event when it begins and one when it is resolved.
+type clusterEvents struct {
+	sync.RWMutex
+	events   []*proto.ClusterEvent // ordered by ID, up to defaultMaxClusterEvents
+	nextID   uint64
+	active   map[string]*proto.ClusterEvent // type/resource -> the event raising the condition
+	pending  map[string]time.Time           // type/resource -> the time the condition is observed first
+	webhooks []string
+	pushCh   chan *proto.ClusterEvent
+	dropped  uint64
+	client   *http.Client
+}
+
+func newClusterEvents() (e *clusterEvents) {
+	e = &clusterEvents{
+		active:  make(map[string]*proto.ClusterEvent),
+		pending: make(map[string]time.Time),
+		pushCh:  make(chan *proto.ClusterEvent, defaultEventPushQueueSize),
+		client:  &http.Client{Timeout: time.Duration(defaultEventPushTimeoutSec) * time.Second},
+	}
+	go e.push()
+	return
+}
+
+func eventKey(eventType, resource string) string {
+	return eventType + "/" + resource
+}
+
+func (e *clusterEvents) record(event *proto.ClusterEvent) {
+	e.nextID++
+	event.ID = e.nextID
+	event.Time = time.Now().Unix()
+	if len(e.events) >= defaultMaxClusterEvents {
+		copy(e.events, e.events[1:])
+		e.events = e.events[:len(e.events)-1]
+	}
+	e.events = append(e.events, event)
+	if len(e.webhooks) == 0 {
+		return
+	}
+	select {
+	case e.pushCh <- event:
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+		log.LogWarnf("action[recordClusterEvent] push queue is full, event[%v] %v of %v is dropped",
+			event.ID, event.Type, event.Resource)
+	}
+}
+
+// raise records the event if its condition is not raised yet and has lasted for the grace period.
+func (e *clusterEvents) raise(event *proto.ClusterEvent, grace time.Duration) {
+	key := eventKey(event.Type, event.Resource)
+	e.Lock()
+	defer e.Unlock()
+	if _, ok := e.active[key]; ok {
+		return
+	}
+	if grace > 0 {
+		first, ok := e.pending[key]
+		if !ok {
+			e.pending[key] = time.Now()
+			return
+		}
+		if time.Since(first) < grace {
+			return
+		}
+	}
+	delete(e.pending, key)
+	e.active[key] = event
+	e.record(event)
+	log.LogWarnf("action[raiseClusterEvent] cluster[%v] %v %v of %v: %v",
+		event.Cluster, event.Severity, event.Type, event.Resource, event.Msg)
+}
+
+// resolve records the event resolving the condition if it is raised.
+func (e *clusterEvents) resolve(eventType, resource string) {
+	key := eventKey(eventType, resource)
+	e.Lock()
+	defer e.Unlock()
+	delete(e.pending, key)
+	raised, ok := e.active[key]
+	if !ok {
+		return
+	}
+	delete(e.active, key)
+	e.record(&proto.ClusterEvent{
+		Cluster:  raised.Cluster,
+		Type:     eventType,
+		Severity: proto.EventSeverityInfo,
+		Resource: resource,
+		Vol:      raised.Vol,
+		Msg:      fmt.Sprintf("resolved, raised by event[%v] at %v", raised.ID, time.Unix(raised.Time, 0).Format(proto.TimeFormat)),
+		Resolved: true,
+	})
+	log.LogInfof("action[resolveClusterEvent] cluster[%v] %v of %v", raised.Cluster, eventType, resource)
+}
+
+// reset forgets the conditions, which are observed again by the checks of the new leader.
+func (e *clusterEvents) reset() {
+	e.Lock()
+	defer e.Unlock()
+	e.active = make(map[string]*proto.ClusterEvent)
+	e.pending = make(map[string]time.Time)
+}
+
+// activeResources returns the resources whose conditions of the type are raised.
+func (e *clusterEvents) activeResources(eventType, resourcePrefix string) (resources []string) {
+	e.RLock()
+	defer e.RUnlock()
+	for _, event := range e.active {
+		if event.Type == eventType && strings.HasPrefix(event.Resource, resourcePrefix) {
+			resources = append(resources, event.Resource)
+		}
+	}
+	return
+}
+
+// query returns the events matching the filters in the order they are raised, up to the latest limit ones.
+func (e *clusterEvents) query(eventType, resource string, since int64, active bool, limit int) (view *proto.ClusterEventsView) {
+	e.RLock()
+	defer e.RUnlock()
+	view = &proto.ClusterEventsView{
+		Webhooks: e.webhooks,
+		Dropped:  atomic.LoadUint64(&e.dropped),
+		Events:   make([]*proto.ClusterEvent, 0),
+	}
+	for _, event := range e.events {
+		if (eventType != "" && event.Type != eventType) || (resource != "" && event.Resource != resource) ||
+			event.Time < since {
+			continue
+		}
+		if active {
+			if raised, ok := e.active[eventKey(event.Type, event.Resource)]; !ok || raised != event {
+				continue
+			}
+		}
+		view.Events = append(view.Events, event)
+	}
+	if limit > 0 && len(view.Events) > limit {
+		view.Events = view.Events[len(view.Events)-limit:]
+	}
+	return
+}
+
+func (e *clusterEvents) getWebhooks() []string {
+	e.RLock()
+	defer e.RUnlock()
+	return e.webhooks
+}
+
+func (e *clusterEvents) setWebhooks(webhooks []string) {
+	e.Lock()
+	defer e.Unlock()
+	e.webhooks = webhooks
+}
+
+func (e *clusterEvents) push() {
+	for event := range e.pushCh {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.LogErrorf("action[pushClusterEvent] marshal event[%v] err[%v]", event.ID, err)
+			continue
+		}
+		for _, webhook := range e.getWebhooks() {
+			for i := 0; i < defaultEventPushRetryTimes; i++ {
+				if err = e.post(webhook, body); err == nil {
+					break
+				}
+				time.Sleep(time.Duration(i+1) * time.Second)
+			}
+			if err != nil {
+				log.LogErrorf("action[pushClusterEvent] push event[%v] to webhook[%v] err[%v]", event.ID, webhook, err)
+			}
+		}
+	}
+}
+
+func (e *clusterEvents) post(webhook string, body []byte) (err error) {
+	resp, err := e.client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("status code[%v]", resp.StatusCode)
+	}
+	return
+}
+
+func (c *Cluster) raiseEvent(eventType, severity, resource, volName, msg string, grace time.Duration) {
+	c.events.raise(&proto.ClusterEvent{
+		Cluster:  c.Name,
+		Type:     eventType,
+		Severity: severity,
+		Resource: resource,
+		Vol:      volName,
+		Msg:      msg,
+	}, grace)
+}
+
+func (c *Cluster) resolveEvent(eventType, resource string) {
+	c.events.resolve(eventType, resource)
+}
+
+// nodeDownGracePeriod returns how long an inactive node must stay so to be down. A node which has not reported to
+// this master since it is added or since the master takes the leadership is given the time out to report.
+func nodeDownGracePeriod(reportTime time.Time) time.Duration {
+	if reportTime.IsZero() {
+		return gConfig.nodeTimeOut()
+	}
+	return 0
+}
+
+// checkDataNodeEvents raises the events of the data node being down and of its disks going offline.
+func (c *Cluster) checkDataNodeEvents(dataNode *DataNode) {
+	dataNode.RLock()
+	isActive := dataNode.isActive
+	reportTime := dataNode.ReportTime
+	badDisks := make(map[string]bool, len(dataNode.BadDisks))
+	for _, disk := range dataNode.BadDisks {
+		badDisks[disk] = true
+	}
+	dataNode.RUnlock()
+
+	if isActive {
+		c.resolveEvent(proto.EventDataNodeDown, dataNode.Addr)
+	} else {
+		c.raiseEvent(proto.EventDataNodeDown, proto.EventSeverityCritical, dataNode.Addr, "",
+			fmt.Sprintf("data node[%v] has not reported since %v", dataNode.Addr, reportTime.Format(proto.TimeFormat)),
+			nodeDownGracePeriod(reportTime))
+	}
+
+	prefix := dataNode.Addr + ":"
+	for _, resource := range c.events.activeResources(proto.EventDiskOffline, prefix) {
+		if !badDisks[strings.TrimPrefix(resource, prefix)] {
+			c.resolveEvent(proto.EventDiskOffline, resource)
+		}
+	}
+	for disk := range badDisks {
+		c.raiseEvent(proto.EventDiskOffline, proto.EventSeverityCritical, prefix+disk, "",
+			fmt.Sprintf("disk[%v] of data node[%v] is offline", disk, dataNode.Addr), 0)
+	}
+}
+
+// checkMetaNodeEvents raises the event of the meta node being down.
+func (c *Cluster) checkMetaNodeEvents(metaNode *MetaNode) {
+	metaNode.RLock()
+	isActive := metaNode.IsActive
+	reportTime := metaNode.ReportTime
+	metaNode.RUnlock()
+
+	if isActive {
+		c.resolveEvent(proto.EventMetaNodeDown, metaNode.Addr)
+		return
+	}
+	c.raiseEvent(proto.EventMetaNodeDown, proto.EventSeverityCritical, metaNode.Addr, "",
+		fmt.Sprintf("meta node[%v] has not reported since %v", metaNode.Addr, reportTime.Format(proto.TimeFormat)),
+		nodeDownGracePeriod(reportTime))
+}
+
+// checkDataPartitionEvents raises the event of the data partition having fewer live replicas than required for the
+// time out of the partition, which also covers the replicas not reported yet to a new leader.
+func (c *Cluster) checkDataPartitionEvents(volName string, dp *DataPartition) {
+	dp.RLock()
+	replicaNum := int(dp.ReplicaNum)
+	live := len(dp.getLiveReplicasFromHosts(c.cfg.dpTimeOutSec()))
+	dp.RUnlock()
+
+	resource := strconv.FormatUint(dp.PartitionID, 10)
+	if live >= replicaNum {
+		c.resolveEvent(proto.EventDataPartitionUnderReplicated, resource)
+		return
+	}
+	c.raiseEvent(proto.EventDataPartitionUnderReplicated, proto.EventSeverityWarning, resource, volName,
+		fmt.Sprintf("data partition[%v] of vol[%v] has %v live replicas of %v", dp.PartitionID, volName, live, replicaNum),
+		time.Second*time.Duration(c.cfg.dpTimeOutSec()))
+}
+
+// checkTinyExtentEvents raises the event of the leader of the data partition having few tiny extents available, upon
+// which the small file writes to the partition fail.
+func (c *Cluster) checkTinyExtentEvents(volName string, dp *DataPartition) {
+	var (
+		leader    *DataReplica
+		available int
+		broken    int
+	)
+	dp.RLock()
+	for _, replica := range dp.getLiveReplicasFromHosts(c.cfg.dpTimeOutSec()) {
+		if replica.IsLeader {
+			leader = replica
+			available, broken = replica.AvailableTinyExtents, replica.BrokenTinyExtents
+			break
+		}
+	}
+	dp.RUnlock()
+
+	resource := strconv.FormatUint(dp.PartitionID, 10)
+	if leader == nil || available >= c.cfg.MinAvailTinyExtents {
+		c.resolveEvent(proto.EventTinyExtentsLow, resource)
+		return
+	}
+	c.raiseEvent(proto.EventTinyExtentsLow, proto.EventSeverityWarning, resource, volName,
+		fmt.Sprintf("data partition[%v] of vol[%v] has %v tiny extents available and %v broken on the leader[%v]",
+			dp.PartitionID, volName, available, broken, leader.Addr),
+		time.Second*time.Duration(defaultTinyExtentsLowGracePeriodSec))
+}
+
+// checkMetaPartitionEvents raises the event of the meta partition having fewer live replicas than required for the
+// time out of the partition.
+func (c *Cluster) checkMetaPartitionEvents(volName string, mp *MetaPartition) {
+	mp.RLock()
+	replicaNum := int(mp.ReplicaNum)
+	live := len(mp.getLiveReplicas())
+	mp.RUnlock()
+
+	resource := strconv.FormatUint(mp.PartitionID, 10)
+	if live >= replicaNum {
+		c.resolveEvent(proto.EventMetaPartitionUnderReplicated, resource)
+		return
+	}
+	c.raiseEvent(proto.EventMetaPartitionUnderReplicated, proto.EventSeverityWarning, resource, volName,
+		fmt.Sprintf("meta partition[%v] of vol[%v] has %v live replicas of %v", mp.PartitionID, volName, live, replicaNum),
+		time.Second*time.Duration(c.cfg.mpTimeOutSec()))
+}
+
+func (c *Cluster) setEventWebhooks(webhooks []string) (err error) {
+	oldWebhooks := c.events.getWebhooks()
+	c.events.setWebhooks(webhooks)
+	if err = c.syncPutCluster(); err != nil {
+		log.LogErrorf("action[setEventWebhooks] err[%v]", err)
+		c.events.setWebhooks(oldWebhooks)
+		err = proto.ErrPersistenceByRaft
+		return
+	}
+	return
+}
+
+func parseEventWebhooks(value string) (webhooks []string, err error) {
+	for _, webhook := range strings.Split(value, commaSplit) {
+		if webhook = strings.TrimSpace(webhook); webhook == "" {
+			continue
+		}
+		var u *url.URL
+		if u, err = url.Parse(webhook); err != nil {
+			return
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook[%v]", webhook)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return
+}
+
+func (m *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	var (
+		since  int64
+		active bool
+		limit  = defaultEventQueryLimit
+		err    error
+	)
+	if value := r.FormValue(timeKey); value != "" {
+		if since, err = strconv.ParseInt(value, 10, 64); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", timeKey, value)})
+			return
+		}
+	}
+	if value := r.FormValue(activeKey); value != "" {
+		if active, err = strconv.ParseBool(value); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", activeKey, value)})
+			return
+		}
+	}
+	if value := r.FormValue(limitKey); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", limitKey, value)})
+			return
+		}
+	}
+	view := m.cluster.events.query(r.FormValue(eventTypeKey), r.FormValue(resourceKey), since, active, limit)
+	sendOkReply(w, r, newSuccessHTTPReply(view))
+}
+
+func (m *Server) setEventWebhooks(w http.ResponseWriter, r *http.Request) {
+	var (
+		webhooks []string
+		err      error
+	)
+	if err = r.ParseForm(); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if webhooks, err = parseEventWebhooks(r.FormValue(webhooksKey)); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setEventWebhooks(webhooks); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set event webhooks to %v successfully", webhooks)))
+}
@@ -420,7 +420,11 @@ func (c *Cluster) addMetaReplica(partition *MetaPartition, addr string) (err err
 }
 
 func (c *Cluster) createMetaReplica(partition *MetaPartition, addPeer proto.Peer) (err error) {
-	task, err := partition.createTaskToCreateReplica(addPeer.Addr)
+	vol, err := c.getVol(partition.volName)
+	if err != nil {
+		return
+	}
+	task, err := partition.createTaskToCreateReplica(addPeer.Addr, vol.caseInsensitive, vol.shadowName())
 	if err != nil {
 		return
 	}
@@ -556,14 +560,14 @@ func (c *Cluster) doLoadDataPartition(dp *DataPartition) {
 	loadTasks := dp.createLoadTasks()
 	c.addDataNodeTasks(loadTasks)
 	for i := 0; i < timeToWaitForResponse; i++ {
-		if dp.checkLoadResponse(c.cfg.DataPartitionTimeOutSec) {
+		if dp.checkLoadResponse(c.cfg.dpTimeOutSec()) {
 			log.LogDebugf("action[checkLoadResponse]  all replica has responded,partitionID:%v ", dp.PartitionID)
 			break
 		}
 		time.Sleep(time.Second)
 	}
 
-	if dp.checkLoadResponse(c.cfg.DataPartitionTimeOutSec) == false {
+	if dp.checkLoadResponse(c.cfg.dpTimeOutSec()) == false {
 		return
 	}
 
@@ -573,19 +577,21 @@ func (c *Cluster) doLoadDataPartition(dp *DataPartition) {
 	dp.setToNormal()
 }
 
+// acceptMetaNodeTaskResponse takes the task which the response is posted for off the meta node, and rejects the
+// response if the task is not outstanding.
+func (c *Cluster) acceptMetaNodeTaskResponse(task *proto.AdminTask) (err error) {
+	metaNode, err := c.metaNode(task.OperatorAddr)
+	if err != nil {
+		return
+	}
+	return metaNode.Sender.takeTask(task)
+}
+
 func (c *Cluster) handleMetaNodeTaskResponse(nodeAddr string, task *proto.AdminTask) (err error) {
 	if task == nil {
 		return
 	}
 	log.LogDebugf(fmt.Sprintf("action[handleMetaNodeTaskResponse] receive Task response:%v from %v", task.ID, nodeAddr))
-	var (
-		metaNode *MetaNode
-	)
-
-	if metaNode, err = c.metaNode(nodeAddr); err != nil {
-		goto errHandler
-	}
-	metaNode.Sender.DelTask(task)
 	if err = unmarshalTaskResponse(task); err != nil {
 		goto errHandler
 	}
@@ -600,6 +606,9 @@ func (c *Cluster) handleMetaNodeTaskResponse(nodeAddr string, task *proto.AdminT
 	case proto.OpUpdateMetaPartition:
 		response := task.Response.(*proto.UpdateMetaPartitionResponse)
 		err = c.dealUpdateMetaPartitionResp(task.OperatorAddr, response)
+	case proto.OpMetaNamespaceExport:
+		response := task.Response.(*proto.NamespaceExportResponse)
+		err = c.handleResponseToNamespaceExport(task.OperatorAddr, response)
 	default:
 		err := fmt.Errorf("unknown operate code %v", task.OpCode)
 		log.LogError(err)
@@ -686,9 +695,10 @@ func (c *Cluster) dealMetaNodeHeartbeatResp(nodeAddr string, resp *proto.MetaNod
 	}
 	metaNode.updateMetric(resp, c.cfg.MetaNodeThreshold)
 	metaNode.setNodeActive()
+	c.updateMetaNodeStats(metaNode)
 
 	if err = c.t.putMetaNode(metaNode); err != nil {
-		log.LogErrorf("action[dealMetaNodeHeartbeatResp],metaNode[%v] error[%v]", metaNode.Addr, err)
+		log.LogErrorfLimited("action[dealMetaNodeHeartbeatResp],metaNode[%v] error[%v]", metaNode.Addr, err)
 	}
 	c.updateMetaNode(metaNode, resp.MetaPartitionReports, metaNode.reachesThreshold())
 	metaNode.metaPartitionInfos = nil
@@ -738,21 +748,23 @@ func (c *Cluster) adjustMetaNode(metaNode *MetaNode) {
 	return
 }
 
+// acceptDataNodeTaskResponse takes the task which the response is posted for off the data node, and rejects the
+// response if the task is not outstanding.
+func (c *Cluster) acceptDataNodeTaskResponse(task *proto.AdminTask) (err error) {
+	dataNode, err := c.dataNode(task.OperatorAddr)
+	if err != nil {
+		return
+	}
+	return dataNode.TaskManager.takeTask(task)
+}
+
 func (c *Cluster) handleDataNodeTaskResponse(nodeAddr string, task *proto.AdminTask) {
 	if task == nil {
 		log.LogInfof("action[handleDataNodeTaskResponse] receive addr[%v] task response,but task is nil", nodeAddr)
 		return
 	}
 	log.LogDebugf("action[handleDataNodeTaskResponse] receive addr[%v] task response:%v", nodeAddr, task.ToString())
-	var (
-		err      error
-		dataNode *DataNode
-	)
-
-	if dataNode, err = c.dataNode(nodeAddr); err != nil {
-		goto errHandler
-	}
-	dataNode.TaskManager.DelTask(task)
+	var err error
 	if err = unmarshalTaskResponse(task); err != nil {
 		goto errHandler
 	}
@@ -764,6 +776,9 @@ func (c *Cluster) handleDataNodeTaskResponse(nodeAddr string, task *proto.AdminT
 	case proto.OpLoadDataPartition:
 		response := task.Response.(*proto.LoadDataPartitionResponse)
 		err = c.handleResponseToLoadDataPartition(task.OperatorAddr, response)
+	case proto.OpCopyExtent:
+		response := task.Response.(*proto.CopyExtentResponse)
+		err = c.handleResponseToCopyExtent(task.OperatorAddr, response)
 	case proto.OpDataNodeHeartbeat:
 		response := task.Response.(*proto.DataNodeHeartbeatResponse)
 		err = c.handleDataNodeHeartbeatResp(task.OperatorAddr, response)
@@ -860,10 +875,11 @@ func (c *Cluster) handleDataNodeHeartbeatResp(nodeAddr string, resp *proto.DataN
 		log.LogWarnf("dataNode zone changed from [%v] to [%v]", oldZoneName, resp.ZoneName)
 	}
 
-	dataNode.updateNodeMetric(resp)
+	dataNode.updateNodeMetric(resp, c.cfg.DataNodeDiskThreshold)
+	c.updateDataNodeStats(dataNode)
 
 	if err = c.t.putDataNode(dataNode); err != nil {
-		log.LogErrorf("action[handleDataNodeHeartbeatResp] dataNode[%v],zone[%v],node set[%v], err[%v]", dataNode.Addr, dataNode.ZoneName, dataNode.NodeSetID, err)
+		log.LogErrorfLimited("action[handleDataNodeHeartbeatResp] dataNode[%v],zone[%v],node set[%v], err[%v]", dataNode.Addr, dataNode.ZoneName, dataNode.NodeSetID, err)
 	}
 	c.updateDataNode(dataNode, resp.PartitionReports)
 	logMsg = fmt.Sprintf("action[handleDataNodeHeartbeatResp],dataNode:%v,zone[%v], ReportTime:%v  success", dataNode.Addr, dataNode.ZoneName, time.Now().Unix())
@@ -970,11 +986,58 @@ func (c *Cluster) updateMetaNode(metaNode *MetaNode, metaPartitions []*proto.Met
 		if mr.End != mp.End {
 			mp.addUpdateMetaReplicaTask(c)
 		}
-		mp.updateMetaPartition(mr, metaNode)
+		applyStalls, backlogStuck := mp.updateMetaPartition(mr, metaNode)
+		if applyStalls {
+			c.handleMetaPartitionApplyStall(mp, mr, metaNode)
+		}
+		if backlogStuck {
+			msg := fmt.Sprintf("action[updateMetaNode] clusterID[%v] vol[%v] meta partition[%v] on metaNode[%v] "+
+				"the deletion backlog looks stuck: %v inodes and %v extents pending, the oldest inode pending for %vs",
+				c.Name, mp.volName, mp.PartitionID, metaNode.Addr, mr.DeleteBacklog.PendingInodes,
+				mr.DeleteBacklog.PendingExtents, mr.DeleteBacklog.OldestPendingSec)
+			log.LogWarn(msg)
+			Warn(c.Name, msg)
+		}
+		if mr.ShadowFailures > 0 && vol != nil {
+			c.markShadowOutOfSync(vol, fmt.Sprintf("meta partition[%v] on metaNode[%v] failed to mirror %v mutations",
+				mp.PartitionID, metaNode.Addr, mr.ShadowFailures))
+		}
 		c.updateInodeIDUpperBound(mp, mr, threshold, metaNode)
 	}
 }
 
+// handleMetaPartitionApplyStall alerts the apply stall of a replica of the meta partition, and moves the leadership
+// to a healthy replica if the stalled replica is the leader and the transfer is enabled.
+func (c *Cluster) handleMetaPartitionApplyStall(mp *MetaPartition, mr *proto.MetaPartitionReport, metaNode *MetaNode) {
+	msg := fmt.Sprintf("action[handleMetaPartitionApplyStall] clusterID[%v] vol[%v] meta partition[%v] on metaNode[%v] "+
+		"isLeader[%v] stalls on the apply with %v proposals pending", c.Name, mp.volName, mp.PartitionID, metaNode.Addr,
+		mr.IsLeader, mr.ApplyQueue)
+	Warn(c.Name, msg)
+	if !mr.IsLeader || !c.cfg.TransferStalledMetaLeader {
+		return
+	}
+	target := mp.applyStallTransferTarget(metaNode.Addr)
+	if target == "" {
+		log.LogWarnf("action[handleMetaPartitionApplyStall] meta partition[%v] has no healthy replica to take over the leadership",
+			mp.PartitionID)
+		return
+	}
+	targetNode, err := c.metaNode(target)
+	if err != nil {
+		log.LogErrorf("action[handleMetaPartitionApplyStall] meta partition[%v] err[%v]", mp.PartitionID, err)
+		return
+	}
+	go func() {
+		if err := mp.tryToChangeLeader(c, targetNode); err != nil {
+			log.LogErrorf("action[handleMetaPartitionApplyStall] meta partition[%v] failed to move the leadership to %v, err[%v]",
+				mp.PartitionID, target, err)
+			return
+		}
+		log.LogWarnf("action[handleMetaPartitionApplyStall] meta partition[%v] moved the leadership from %v to %v",
+			mp.PartitionID, metaNode.Addr, target)
+	}()
+}
+
 func (c *Cluster) updateInodeIDUpperBound(mp *MetaPartition, mr *proto.MetaPartitionReport, hasArriveThreshold bool, metaNode *MetaNode) (err error) {
 	if !hasArriveThreshold {
 		return
@@ -19,6 +19,7 @@ import (
 	syslog "log"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/tiglabs/raft/proto"
@@ -38,6 +39,34 @@ const (
 	cfgMetaNodeReservedMem              = "metaNodeReservedMem"
 	heartbeatPortKey                    = "heartbeatPort"
 	replicaPortKey                      = "replicaPort"
+	// a spare data node is promoted if a data node has been inactive for this period (in terms of seconds)
+	spareDataNodeGracePeriodSec = "spareDataNodeGracePeriodSec"
+	// a node is refused to register if its clock skews more than this (in terms of seconds)
+	maxNodeClockSkewSec = "maxNodeClockSkewSec"
+	// the lifecycle rules of the volumes are executed at this interval (in terms of seconds)
+	intervalToRunLifecycle = "intervalToRunLifecycle"
+	// the partitions of a deleted volume are deleted after this period (in terms of seconds), within which it can be restored
+	volDeleteGracePeriodSec = "volDeleteGracePeriodSec"
+	// the event is raised if the leader of a data partition has fewer tiny extents available than this
+	minAvailTinyExtents = "minAvailTinyExtents"
+	// the leadership of a meta partition is moved to a healthy replica once the leader reports the apply stalls
+	transferStalledMetaLeader = "transferStalledMetaLeader"
+	// the data partitions created in the cluster at once
+	dpCreationConcurrency = "dpCreationConcurrency"
+	// the data partitions started to be created per second, 0 if unlimited
+	dpCreationRate = "dpCreationRate"
+	// the data partition creations of a volume waiting at most, the excess ones are rejected
+	volDpCreationQueueSize = "volDpCreationQueueSize"
+	// the data partition creation waiting longer than this (in terms of seconds) is rejected
+	dpCreationWaitSec = "dpCreationWaitSec"
+	// the leader sends the heartbeats to the nodes at this interval (in terms of milliseconds)
+	heartbeatIntervalMs = "heartbeatIntervalMs"
+	// a node is inactive if it has not responded to the heartbeats for this period (in terms of milliseconds)
+	nodeTimeoutMs = "nodeTimeoutMs"
+	// the orphan extents of the volumes are checked at this interval (in terms of seconds), 0 to disable
+	intervalToCheckOrphanExtents = "intervalToCheckOrphanExtents"
+	// an extent not modified for this period (in terms of seconds) may be reclaimed if no inode refers to it
+	orphanExtentSafetySec = "orphanExtentSafetySec"
 )
 
 //default value
@@ -52,6 +81,50 @@ const (
 	defaultNodeTimeOutSec                      = noHeartBeatTimes * defaultIntervalToCheckHeartbeat
 	defaultDataPartitionTimeOutSec             = 10 * defaultIntervalToCheckHeartbeat
 	defaultMissingDataPartitionInterval        = 24 * 3600
+	defaultSpareDataNodeGracePeriodSec         = 30 * 60
+	defaultSecondsToDeleteDataPartition        = 3 * 60 // wait for the clients to stop writing to the read-only data partition
+	defaultDataPartitionRefLimit               = 100
+	defaultMaxNodeClockSkewSec                 = 30
+	defaultIntervalToRunLifecycle              = 60 * 60
+	defaultLifecycleBatchSize                  = 1000
+	defaultLifecycleCopyTimeoutSec             = 60 * 60 // the copy of an extent to the cold tier is given up beyond it
+	defaultVolDeleteGracePeriodSec             = 24 * 3600
+	defaultIntervalToCheckMaintenancePlan      = 10
+	defaultMaxClusterEvents                    = 10000
+	defaultEventQueryLimit                     = 100
+	defaultEventPushQueueSize                  = 1024
+	defaultEventPushRetryTimes                 = 3
+	defaultEventPushTimeoutSec                 = 5
+	defaultMinAvailTinyExtents                 = 10
+	defaultTinyExtentsLowGracePeriodSec        = 5 * 60 // the data node repairs the tiny extents within this period
+	defaultVolUsageTickIntervalSec             = 60 * 60
+	minVolUsageTickIntervalSec                 = 60
+	defaultIntervalToDeliverVolUsage           = 10
+	defaultVolUsageMaxAttempts                 = 20
+	defaultVolUsageMaxRetryIntervalSec         = 10 * 60
+	defaultExtentCopyJobRetentionSec           = 24 * 3600
+	defaultDpCreationConcurrency               = 8
+	defaultDpCreationRate                      = 10
+	defaultVolDpCreationQueueSize              = 16
+	defaultDpCreationWaitSec                   = 60
+	defaultVerifyReadsPercent                  = 1
+	defaultMaxReadMismatches                   = 1000
+	minHeartbeatIntervalMs                     = 100
+	minPartitionTimeOutSec                     = 3 // the report time of the replicas is in terms of seconds
+	defaultAllocEpochRetries                   = 3 // the data partition creations planned again once the capacity changes
+	defaultResolveExtentLimit                  = 1000
+	defaultSnapshotDiffLimit                   = 1000
+	defaultTaskResponseAwaitSec                = 24 * 3600 // the responses posted long after the tasks, e.g. the copies of the extents
+	defaultDeleteBacklogGrowthReports          = 60        // the deletion backlog of a meta partition grown in this many heartbeats in a row looks stuck
+	defaultDeleteBacklogStuckSec               = 6 * 3600  // so does the one with an inode waiting this long to be freed
+	defaultNamespaceExportTimeoutSec           = 12 * 3600 // the namespace export fails if any partition is not exported in time
+	defaultIntervalToCheckNamespaceExport      = 60
+	defaultIntervalToCheckOrphanExtents        = 24 * 3600
+	defaultOrphanExtentSafetySec               = 24 * 3600
+	minOrphanExtentSafetySec                   = 3600 // longer than the clients take to append the extent keys
+	defaultOrphanExtentBatchSize               = 1000
+	defaultOrphanExtentReportSize              = 100
+	defaultIntervalToScheduleOrphanExtents     = 60
 
 	defaultIntervalToAlarmMissingDataPartition = 60 * 60
 	timeToWaitForResponse                      = 120         // time to wait for response by the master during loading partition
@@ -62,6 +135,7 @@ const (
 
 	defaultIntervalToAlarmMissingMetaPartition         = 10 * 60 // interval of checking if a replica is missing
 	defaultMetaPartitionMemUsageThreshold      float32 = 0.75    // memory usage threshold on a meta partition
+	defaultDataNodeDiskThreshold               float32 = 0.9     // usage threshold of a disk to place the data partitions on
 	defaultMaxMetaPartitionCountOnEachNode             = 10000
 	defaultReplicaNum                                  = 3
 	defaultDiffSpaceUsage                              = 1024 * 1024 * 1024
@@ -72,7 +146,6 @@ var AddrDatabase = make(map[uint64]string)
 
 type clusterConfig struct {
 	secondsToFreeDataPartitionAfterLoad int64
-	NodeTimeOutSec                      int64
 	MissingDataPartitionInterval        int64
 	DataPartitionTimeOutSec             int64
 	IntervalToAlarmMissingDataPartition int64
@@ -83,6 +156,7 @@ type clusterConfig struct {
 	numberOfDataPartitionsToLoad        int
 	nodeSetCapacity                     int
 	MetaNodeThreshold                   float32
+	DataNodeDiskThreshold               float32
 	MetaNodeDeleteBatchCount            uint64 //metanode delete batch count
 	DataNodeDeleteLimitRate             uint64 //datanode delete limit rate
 	MetaNodeDeleteWorkerSleepMs         uint64 //datanode delete limit rate
@@ -92,22 +166,51 @@ type clusterConfig struct {
 	heartbeatPort                       int64
 	replicaPort                         int64
 	diffSpaceUsage                      uint64
+	SpareDataNodeGracePeriodSec         int64
+	MaxNodeClockSkewSec                 int64
+	IntervalToRunLifecycle              int64 // seconds
+	VolDeleteGracePeriodSec             int64
+	MinAvailTinyExtents                 int
+	nodeToken                           string
+	tokenSigningKey                     string
+	TransferStalledMetaLeader           bool
+	DpCreationConcurrency               int
+	DpCreationRate                      int // per second, 0 if unlimited
+	VolDpCreationQueueSize              int
+	DpCreationWaitSec                   int64
+	MetaPartitionTimeOutSec             int64
+	IntervalToCheckOrphanExtents        int64 // seconds, 0 if disabled
+	OrphanExtentSafetySec               int64
+	heartbeat                           *heartbeatPacer
 }
 
 func newClusterConfig() (cfg *clusterConfig) {
 	cfg = new(clusterConfig)
 	cfg.numberOfDataPartitionsToFree = defaultTobeFreedDataPartitionCount
 	cfg.secondsToFreeDataPartitionAfterLoad = defaultSecondsToFreeDataPartitionAfterLoad
-	cfg.NodeTimeOutSec = defaultNodeTimeOutSec
 	cfg.MissingDataPartitionInterval = defaultMissingDataPartitionInterval
 	cfg.DataPartitionTimeOutSec = defaultDataPartitionTimeOutSec
+	cfg.MetaPartitionTimeOutSec = defaultMetaPartitionTimeOutSec
+	cfg.heartbeat = newHeartbeatPacer(time.Second*defaultIntervalToCheckHeartbeat, time.Second*defaultNodeTimeOutSec)
 	cfg.IntervalToCheckDataPartition = defaultIntervalToCheckDataPartition
 	cfg.IntervalToAlarmMissingDataPartition = defaultIntervalToAlarmMissingDataPartition
 	cfg.numberOfDataPartitionsToLoad = defaultNumberOfDataPartitionsToLoad
 	cfg.PeriodToLoadALLDataPartitions = defaultPeriodToLoadAllDataPartitions
 	cfg.MetaNodeThreshold = defaultMetaPartitionMemUsageThreshold
+	cfg.DataNodeDiskThreshold = defaultDataNodeDiskThreshold
 	cfg.metaNodeReservedMem = defaultMetaNodeReservedMem
 	cfg.diffSpaceUsage = defaultDiffSpaceUsage
+	cfg.SpareDataNodeGracePeriodSec = defaultSpareDataNodeGracePeriodSec
+	cfg.MaxNodeClockSkewSec = defaultMaxNodeClockSkewSec
+	cfg.IntervalToRunLifecycle = defaultIntervalToRunLifecycle
+	cfg.VolDeleteGracePeriodSec = defaultVolDeleteGracePeriodSec
+	cfg.MinAvailTinyExtents = defaultMinAvailTinyExtents
+	cfg.DpCreationConcurrency = defaultDpCreationConcurrency
+	cfg.DpCreationRate = defaultDpCreationRate
+	cfg.VolDpCreationQueueSize = defaultVolDpCreationQueueSize
+	cfg.DpCreationWaitSec = defaultDpCreationWaitSec
+	cfg.IntervalToCheckOrphanExtents = defaultIntervalToCheckOrphanExtents
+	cfg.OrphanExtentSafetySec = defaultOrphanExtentSafetySec
 	return
 }
 
@@ -43,6 +43,7 @@ const (
 	keywordsKey             = "keywords"
 	zoneNameKey             = "zoneName"
 	crossZoneKey            = "crossZone"
+	caseInsensitiveKey      = "caseInsensitive"
 	tokenKey                = "token"
 	tokenTypeKey            = "tokenType"
 	enableTokenKey          = "enableToken"
@@ -55,6 +56,58 @@ const (
 	descriptionKey          = "description"
 	dpSelectorNameKey       = "dpSelectorName"
 	dpSelectorParmKey       = "dpSelectorParm"
+	spareKey                = "spare"
+	forceKey                = "force"
+	limitKey                = "limit"
+	instanceIDKey           = "instanceId"
+	timeKey                 = "time"
+	partitionTypeKey        = "type"
+	commitKey               = "commit"
+	dpAffinityKey           = "dpAffinity"
+	failureDomainKey        = "failureDomain"
+	minClientVersionKey     = "minClientVersion"
+	featuresKey             = "features"
+	multipartTTLKey         = "multipartTTL"
+	metaCacheKey            = "metaCache"
+	maxClientsKey           = "maxClients"
+	verifyReadsKey          = "verifyReads"
+	verifyReadsPercentKey   = "verifyReadsPercent"
+	syncOnRenameKey         = "syncOnRename"
+	requireTokenKey         = "requireToken"
+	coldZoneKey             = "coldZone"
+	nameMaxLengthKey        = "nameMaxLength"
+	nameValidUTF8Key        = "nameValidUTF8"
+	nameNoControlCharsKey   = "nameNoControlChars"
+	nameRelaxedKey          = "nameRelaxed"
+	clientIDKey             = "clientId"
+	renewKey                = "renew"
+	eventTypeKey            = "type"
+	resourceKey             = "resource"
+	activeKey               = "active"
+	webhooksKey             = "webhooks"
+	tickIntervalKey         = "tickInterval"
+	extentIDKey             = "extentID"
+	extentOffsetKey         = "offset"
+	extentSizeKey           = "size"
+	sourceAddrKey           = "sourceAddr"
+	rateLimitKey            = "rateLimit"
+	jobIDKey                = "jobID"
+	levelKey                = "level"
+	readOnlyKey             = "readOnly"
+	subDirKey               = "subDir"
+	ttlKey                  = "ttl"
+	delegatedTokenKey       = "delegatedToken"
+	tenantKey               = "tenant"
+	volNameKey              = "volName"
+	aclKey                  = "acl"
+	volKey                  = "vol"
+	pathKey                 = "path"
+	shadowKey               = "shadow"
+	targetKey               = "target"
+	intervalHoursKey        = "intervalHours"
+	fromKey                 = "from"
+	toKey                   = "to"
+	markerKey               = "marker"
 )
 
 const (
@@ -64,6 +117,7 @@ const (
 	dataNodeOfflineErr            = "dataNodeOfflineErr "
 	diskOfflineErr                = "diskOfflineErr "
 	handleDataPartitionOfflineErr = "handleDataPartitionOffLineErr "
+	spareDataNodeTakeOverErr      = "spareDataNodeTakeOverErr "
 )
 
 const (
@@ -136,10 +190,19 @@ const (
 	opSyncAddVolUser           uint32 = 0x1C
 	opSyncDeleteVolUser        uint32 = 0x1D
 	opSyncUpdateVolUser        uint32 = 0x1E
+	opSyncPutMaintenancePlan   uint32 = 0x1F
 
 	OpSyncAddToken    uint32 = 0x20
 	OpSyncDelToken    uint32 = 0x21
 	OpSyncUpdateToken uint32 = 0x22
+
+	opSyncPutSchemaVersion uint32 = 0x23
+
+	opSyncPutVolUsageRecord    uint32 = 0x24
+	opSyncDeleteVolUsageRecord uint32 = 0x25
+
+	opSyncPutTenant    uint32 = 0x26
+	opSyncDeleteTenant uint32 = 0x27
 )
 
 const (
@@ -153,9 +216,13 @@ const (
 	clusterAcronym        = "c"
 	nodeSetAcronym        = "s"
 	tokenAcronym          = "t"
+	planAcronym           = "plan"
+	volUsageAcronym       = "vu"
+	tenantAcronym         = "tenant"
 	maxDataPartitionIDKey = keySeparator + "max_dp_id"
 	maxMetaPartitionIDKey = keySeparator + "max_mp_id"
 	maxCommonIDKey        = keySeparator + "max_common_id"
+	schemaVersionKey      = keySeparator + "schema_version"
 	metaNodePrefix        = keySeparator + metaNodeAcronym + keySeparator
 	dataNodePrefix        = keySeparator + dataNodeAcronym + keySeparator
 	dataPartitionPrefix   = keySeparator + dataPartitionAcronym + keySeparator
@@ -163,6 +230,9 @@ const (
 	metaPartitionPrefix   = keySeparator + metaPartitionAcronym + keySeparator
 	clusterPrefix         = keySeparator + clusterAcronym + keySeparator
 	nodeSetPrefix         = keySeparator + nodeSetAcronym + keySeparator
+	maintenancePlanPrefix = keySeparator + planAcronym + keySeparator
+	volUsagePrefix        = keySeparator + volUsageAcronym + keySeparator
+	tenantPrefix          = keySeparator + tenantAcronym + keySeparator
 
 	akAcronym      = "ak"
 	userAcronym    = "user"
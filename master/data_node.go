@@ -16,11 +16,11 @@ package master
 
 import (
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
-	"github.com/chubaofs/chubaofs/util"
 )
 
 // DataNode stores all the information about a data node
@@ -39,11 +39,19 @@ type DataNode struct {
 	Carry                     float64           // carry is a factor used in cacluate the node's weight
 	TaskManager               *AdminTaskManager `graphql:"-"`
 	DataPartitionReports      []*proto.PartitionReport
+	partitionReports          map[uint64]*proto.PartitionReport // latest report of each partition
 	DataPartitionCount        uint32
 	NodeSetID                 uint64
 	PersistenceDataPartitions []uint64
 	BadDisks                  []string
 	ToBeOffline               bool
+	IsSpare                   bool   // a spare data node receives no partitions until it is promoted
+	InstanceID                string // generated by the data node at the first start and stored on its disks
+	BuildInfo                 proto.BuildInfo
+	Disks                     []*proto.DiskReport
+	DiskThreshold             float32 // usage threshold of a disk to place the data partitions on
+	ReplicaIP                 string  // the IP of the interface dedicated to the replication, reported by heartbeats
+	Rack                      string  // the rack within the zone reported by heartbeats, empty if unknown
 }
 
 func newDataNode(addr, zoneName, clusterID string) (dataNode *DataNode) {
@@ -56,10 +64,10 @@ func newDataNode(addr, zoneName, clusterID string) (dataNode *DataNode) {
 	return
 }
 
-func (dataNode *DataNode) checkLiveness() {
+func (dataNode *DataNode) checkLiveness(timeout time.Duration) {
 	dataNode.Lock()
 	defer dataNode.Unlock()
-	if time.Since(dataNode.ReportTime) > time.Second*time.Duration(defaultNodeTimeOutSec) {
+	if time.Since(dataNode.ReportTime) > timeout {
 		dataNode.isActive = false
 	}
 
@@ -79,7 +87,7 @@ func (dataNode *DataNode) badPartitions(diskPath string, c *Cluster) (partitions
 	return
 }
 
-func (dataNode *DataNode) updateNodeMetric(resp *proto.DataNodeHeartbeatResponse) {
+func (dataNode *DataNode) updateNodeMetric(resp *proto.DataNodeHeartbeatResponse, diskThreshold float32) {
 	dataNode.Lock()
 	defer dataNode.Unlock()
 	dataNode.Total = resp.Total
@@ -87,8 +95,13 @@ func (dataNode *DataNode) updateNodeMetric(resp *proto.DataNodeHeartbeatResponse
 	dataNode.AvailableSpace = resp.Available
 	dataNode.ZoneName = resp.ZoneName
 	dataNode.DataPartitionCount = resp.CreatedPartitionCnt
-	dataNode.DataPartitionReports = resp.PartitionReports
+	dataNode.mergePartitionReports(resp)
 	dataNode.BadDisks = resp.BadDisks
+	dataNode.BuildInfo = resp.BuildInfo
+	dataNode.Disks = resp.Disks
+	dataNode.ReplicaIP = resp.ReplicaIP
+	dataNode.Rack = resp.Rack
+	dataNode.DiskThreshold = diskThreshold
 	if dataNode.Total == 0 {
 		dataNode.UsageRatio = 0.0
 	} else {
@@ -98,11 +111,46 @@ func (dataNode *DataNode) updateNodeMetric(resp *proto.DataNodeHeartbeatResponse
 	dataNode.isActive = true
 }
 
+// mergePartitionReports keeps the latest report of each partition, since a data node with massive partitions reports
+// them in cohorts across the consecutive heartbeats, and a partition is unchanged until it is reported again. A
+// partition missing from the report of its cohort has been deleted from the data node.
+func (dataNode *DataNode) mergePartitionReports(resp *proto.DataNodeHeartbeatResponse) {
+	if resp.ReportCohorts <= 1 {
+		dataNode.partitionReports = make(map[uint64]*proto.PartitionReport, len(resp.PartitionReports))
+		for _, vr := range resp.PartitionReports {
+			dataNode.partitionReports[vr.PartitionID] = vr
+		}
+		dataNode.DataPartitionReports = resp.PartitionReports
+		return
+	}
+	if dataNode.partitionReports == nil {
+		dataNode.partitionReports = make(map[uint64]*proto.PartitionReport)
+	}
+	cohorts, cohort := uint64(resp.ReportCohorts), uint64(resp.ReportCohort)
+	reported := make(map[uint64]bool, len(resp.PartitionReports))
+	for _, vr := range resp.PartitionReports {
+		dataNode.partitionReports[vr.PartitionID] = vr
+		reported[vr.PartitionID] = true
+	}
+	for id := range dataNode.partitionReports {
+		if id%cohorts == cohort && !reported[id] {
+			delete(dataNode.partitionReports, id)
+		}
+	}
+	reports := make([]*proto.PartitionReport, 0, len(dataNode.partitionReports))
+	for _, vr := range dataNode.partitionReports {
+		reports = append(reports, vr)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].PartitionID < reports[j].PartitionID })
+	dataNode.DataPartitionReports = reports
+}
+
 func (dataNode *DataNode) isWriteAble() (ok bool) {
 	dataNode.RLock()
 	defer dataNode.RUnlock()
 
-	if dataNode.isActive == true && dataNode.AvailableSpace > 10*util.GB {
+	if dataNode.isActive == true && !dataNode.IsSpare && dataNode.AvailableSpace > minNodeAvailSpaceToCreatePartition &&
+		dataNode.hasEligibleDisk() {
 		ok = true
 	}
 
@@ -148,10 +196,12 @@ func (dataNode *DataNode) clean() {
 	dataNode.TaskManager.exitCh <- struct{}{}
 }
 
-func (dataNode *DataNode) createHeartbeatTask(masterAddr string) (task *proto.AdminTask) {
+func (dataNode *DataNode) createHeartbeatTask(masterAddr string, enableQuorumWrite bool, tokenRequiredVols []string) (task *proto.AdminTask) {
 	request := &proto.HeartBeatRequest{
-		CurrTime:   time.Now().Unix(),
-		MasterAddr: masterAddr,
+		CurrTime:          time.Now().Unix(),
+		MasterAddr:        masterAddr,
+		EnableQuorumWrite: enableQuorumWrite,
+		TokenRequiredVols: tokenRequiredVols,
 	}
 	task = proto.NewAdminTask(proto.OpDataNodeHeartbeat, dataNode.Addr, request)
 	return
@@ -0,0 +1,238 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	minDiskAvailSpaceToCreatePartition = 5 * util.GB // the same as the data node
+	minNodeAvailSpaceToCreatePartition = 10 * util.GB
+	defaultMaxPlacementDecisions       = 100
+)
+
+// evaluateDisks tells whether each disk reported by the data node receives the new data partitions, and returns the
+// emptiest eligible one. The disk above the usage threshold is excluded even if the data node has enough space on
+// the other disks. The caller must hold the lock of the data node.
+func (dataNode *DataNode) evaluateDisks() (disks []*proto.DiskPlacementView, preferred *proto.DiskPlacementView) {
+	threshold := dataNode.DiskThreshold
+	if threshold <= 0 {
+		threshold = defaultDataNodeDiskThreshold
+	}
+	disks = make([]*proto.DiskPlacementView, 0, len(dataNode.Disks))
+	for _, d := range dataNode.Disks {
+		view := &proto.DiskPlacementView{
+			Path:       d.Path,
+			Total:      d.Total,
+			Used:       d.Used,
+			Available:  d.Available,
+			Status:     d.Status,
+			Partitions: d.Partitions,
+		}
+		if d.Total > 0 {
+			view.UsageRatio = float64(d.Used) / float64(d.Total)
+		}
+		switch {
+		case d.Status != proto.ReadWrite:
+			view.Reason = "disk is not writable"
+		case d.Total == 0 || view.UsageRatio >= float64(threshold):
+			view.Reason = fmt.Sprintf("usage %.2f reaches the threshold %.2f", view.UsageRatio, threshold)
+		case d.Available <= minDiskAvailSpaceToCreatePartition:
+			view.Reason = fmt.Sprintf("available space %v is not more than %v", d.Available, uint64(minDiskAvailSpaceToCreatePartition))
+		default:
+			view.Eligible = true
+			if preferred == nil || view.UsageRatio < preferred.UsageRatio {
+				preferred = view
+			}
+		}
+		disks = append(disks, view)
+	}
+	if preferred != nil {
+		preferred.Preferred = true
+	}
+	return
+}
+
+// hasEligibleDisk returns whether the data node has a disk to place the new data partitions on. The data node which
+// reports no disks is judged by its total usage only. The caller must hold the lock of the data node.
+func (dataNode *DataNode) hasEligibleDisk() bool {
+	if len(dataNode.Disks) == 0 {
+		return true
+	}
+	_, preferred := dataNode.evaluateDisks()
+	return preferred != nil
+}
+
+// preferredDisk returns the emptiest eligible disk of the data node to place a new data partition on, or an empty
+// path if the data node reports no disks, which leaves the choice to the data node.
+func (dataNode *DataNode) preferredDisk() (path string, usage float64) {
+	dataNode.RLock()
+	defer dataNode.RUnlock()
+	if _, preferred := dataNode.evaluateDisks(); preferred != nil {
+		return preferred.Path, preferred.UsageRatio
+	}
+	return
+}
+
+func (dataNode *DataNode) placementView() (view *proto.DataNodePlacementView) {
+	dataNode.RLock()
+	defer dataNode.RUnlock()
+	view = &proto.DataNodePlacementView{
+		Addr:       dataNode.Addr,
+		ZoneName:   dataNode.ZoneName,
+		UsageRatio: dataNode.UsageRatio,
+	}
+	var preferred *proto.DiskPlacementView
+	view.Disks, preferred = dataNode.evaluateDisks()
+	switch {
+	case !dataNode.isActive:
+		view.Reason = "node is inactive"
+	case dataNode.IsSpare:
+		view.Reason = "node is a spare"
+	case dataNode.AvailableSpace <= minNodeAvailSpaceToCreatePartition:
+		view.Reason = fmt.Sprintf("available space %v is not more than %v", dataNode.AvailableSpace, uint64(minNodeAvailSpaceToCreatePartition))
+	case len(view.Disks) > 0 && preferred == nil:
+		view.Reason = "no disk is eligible"
+	default:
+		view.Eligible = true
+	}
+	return
+}
+
+// placementDecisions keeps the placements of the latest data partitions created by the master.
+type placementDecisions struct {
+	sync.RWMutex
+	decisions []*proto.PlacementDecision
+}
+
+func newPlacementDecisions() *placementDecisions {
+	return &placementDecisions{decisions: make([]*proto.PlacementDecision, 0)}
+}
+
+func (pd *placementDecisions) add(decision *proto.PlacementDecision) {
+	pd.Lock()
+	defer pd.Unlock()
+	pd.decisions = append(pd.decisions, decision)
+	if len(pd.decisions) > defaultMaxPlacementDecisions {
+		pd.decisions = pd.decisions[len(pd.decisions)-defaultMaxPlacementDecisions:]
+	}
+}
+
+func (pd *placementDecisions) list(partitionID uint64) (decisions []*proto.PlacementDecision) {
+	pd.RLock()
+	defer pd.RUnlock()
+	decisions = make([]*proto.PlacementDecision, 0, len(pd.decisions))
+	for _, decision := range pd.decisions {
+		if partitionID == 0 || decision.PartitionID == partitionID {
+			decisions = append(decisions, decision)
+		}
+	}
+	return
+}
+
+func (c *Cluster) recordPlacement(dp *DataPartition, createType int, replicas []*proto.ReplicaPlacement) {
+	decision := &proto.PlacementDecision{
+		PartitionID:   dp.PartitionID,
+		VolName:       dp.VolName,
+		CreateType:    createType,
+		CreateTime:    time.Now().Unix(),
+		DiskThreshold: c.cfg.DataNodeDiskThreshold,
+		Replicas:      replicas,
+	}
+	if vol, err := c.getVol(dp.VolName); err == nil {
+		decision.FailureDomain = vol.failureDomain
+	}
+	c.placements.add(decision)
+	log.LogInfof("action[recordPlacement] partition[%v] vol[%v] createType[%v] placed on %v",
+		dp.PartitionID, dp.VolName, createType, replicas)
+}
+
+func (c *Cluster) dataPartitionPlacement(addr string, partitionID uint64) (view *proto.DataPartitionPlacementView) {
+	view = &proto.DataPartitionPlacementView{
+		DiskThreshold: c.cfg.DataNodeDiskThreshold,
+		DataNodes:     make([]*proto.DataNodePlacementView, 0),
+		Decisions:     c.placements.list(partitionID),
+	}
+	c.dataNodes.Range(func(key, node interface{}) bool {
+		dataNode := node.(*DataNode)
+		if addr == "" || dataNode.Addr == addr {
+			view.DataNodes = append(view.DataNodes, dataNode.placementView())
+		}
+		return true
+	})
+	sort.Slice(view.DataNodes, func(i, j int) bool { return view.DataNodes[i].Addr < view.DataNodes[j].Addr })
+	return
+}
+
+func (c *Cluster) setDataNodeDiskThreshold(threshold float32) (err error) {
+	oldThreshold := c.cfg.DataNodeDiskThreshold
+	c.cfg.DataNodeDiskThreshold = threshold
+	if err = c.syncPutCluster(); err != nil {
+		log.LogErrorf("action[setDataNodeDiskThreshold] err[%v]", err)
+		c.cfg.DataNodeDiskThreshold = oldThreshold
+		err = proto.ErrPersistenceByRaft
+		return
+	}
+	return
+}
+
+// Set the threshold of the usage of each disk on the data nodes, above which the disk receives no new data partitions.
+func (m *Server) setDataNodeDiskThreshold(w http.ResponseWriter, r *http.Request) {
+	var (
+		threshold float64
+		err       error
+	)
+	if threshold, err = parseAndExtractThreshold(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if threshold <= 0 || threshold > 1 {
+		err = fmt.Errorf("%v must be in (0, 1]", thresholdKey)
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setDataNodeDiskThreshold(float32(threshold)); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set disk threshold to %v successfully", threshold)))
+}
+
+func (m *Server) getDataPartitionPlacement(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		err         error
+	)
+	if err = r.ParseForm(); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if r.FormValue(idKey) != "" {
+		if partitionID, err = extractDataPartitionID(r); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+			return
+		}
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.dataPartitionPlacement(r.FormValue(addrKey), partitionID)))
+}
@@ -3,6 +3,7 @@ package master
 import (
 	"fmt"
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
 	"testing"
 	"time"
 )
@@ -33,3 +34,109 @@ func decommissionDataNode(addr string, t *testing.T) {
 	fmt.Println(reqURL)
 	process(reqURL, t)
 }
+
+func TestMergePartitionReports(t *testing.T) {
+	dataNode := newDataNode("127.0.0.1:9097", DefaultZoneName, "cfs")
+	reports := func(ids ...uint64) []*proto.PartitionReport {
+		rs := make([]*proto.PartitionReport, 0)
+		for _, id := range ids {
+			rs = append(rs, &proto.PartitionReport{PartitionID: id})
+		}
+		return rs
+	}
+	reportedIDs := func() (ids []uint64) {
+		for _, vr := range dataNode.DataPartitionReports {
+			ids = append(ids, vr.PartitionID)
+		}
+		return
+	}
+	dataNode.mergePartitionReports(&proto.DataNodeHeartbeatResponse{PartitionReports: reports(1, 2, 3, 4)})
+	// cohort 0 of 2 reports partition 2 and partition 4 is deleted, partition 3 changed its status
+	dataNode.mergePartitionReports(&proto.DataNodeHeartbeatResponse{
+		PartitionReports: reports(2, 3),
+		ReportCohort:     0,
+		ReportCohorts:    2,
+	})
+	if ids := reportedIDs(); fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("merged partitions %v, expected [1 2 3]", ids)
+		return
+	}
+	// cohort 1 of 2 reports partition 1 and partition 5 created, partition 3 is deleted
+	dataNode.mergePartitionReports(&proto.DataNodeHeartbeatResponse{
+		PartitionReports: reports(1, 5),
+		ReportCohort:     1,
+		ReportCohorts:    2,
+	})
+	if ids := reportedIDs(); fmt.Sprint(ids) != "[1 2 5]" {
+		t.Errorf("merged partitions %v, expected [1 2 5]", ids)
+	}
+}
+
+func TestDataNodeDiskPlacement(t *testing.T) {
+	dataNode := newDataNode("127.0.0.1:9098", DefaultZoneName, "cfs")
+	disk := func(path string, usedGB uint64, status int) *proto.DiskReport {
+		return &proto.DiskReport{Path: path, Total: 100 * util.GB, Used: usedGB * util.GB,
+			Available: (100 - usedGB) * util.GB, Status: status}
+	}
+	resp := &proto.DataNodeHeartbeatResponse{
+		Total:     400 * util.GB,
+		Used:      215 * util.GB,
+		Available: 185 * util.GB,
+		Disks: []*proto.DiskReport{
+			disk("/cfs/disk1", 95, proto.ReadWrite),
+			disk("/cfs/disk2", 60, proto.ReadWrite),
+			disk("/cfs/disk3", 40, proto.ReadWrite),
+			disk("/cfs/disk4", 20, proto.Unavailable),
+		},
+	}
+	dataNode.updateNodeMetric(resp, 0.9)
+	if !dataNode.isWriteAble() {
+		t.Fatalf("data node with eligible disks is not writable")
+	}
+	if path, usage := dataNode.preferredDisk(); path != "/cfs/disk3" || usage != 0.4 {
+		t.Fatalf("preferred disk %v usage %v, expected the emptiest eligible /cfs/disk3", path, usage)
+	}
+	view := dataNode.placementView()
+	if !view.Eligible || len(view.Disks) != 4 {
+		t.Fatalf("unexpected placement view %+v", view)
+	}
+	for _, d := range view.Disks {
+		if eligible := d.Path == "/cfs/disk2" || d.Path == "/cfs/disk3"; d.Eligible != eligible || (!eligible && d.Reason == "") {
+			t.Errorf("disk %v eligible %v reason %q", d.Path, d.Eligible, d.Reason)
+		}
+	}
+
+	// the disks above the threshold are excluded even if the node has space in total
+	dataNode.updateNodeMetric(resp, 0.3)
+	if dataNode.isWriteAble() {
+		t.Fatalf("data node without eligible disks is writable")
+	}
+	if path, _ := dataNode.preferredDisk(); path != "" {
+		t.Fatalf("preferred disk %v without eligible disks", path)
+	}
+	if view = dataNode.placementView(); view.Eligible || view.Reason == "" {
+		t.Fatalf("unexpected placement view %+v", view)
+	}
+
+	// the data node reporting no disks is judged by its total usage only
+	resp.Disks = nil
+	dataNode.updateNodeMetric(resp, 0.3)
+	if !dataNode.isWriteAble() {
+		t.Fatalf("data node reporting no disks is not writable")
+	}
+}
+
+func TestDataNodeReplicaIP(t *testing.T) {
+	c := &Cluster{}
+	dataNode := newDataNode("127.0.0.1:9099", DefaultZoneName, "cfs")
+	c.dataNodes.Store(dataNode.Addr, dataNode)
+	dataNode.updateNodeMetric(&proto.DataNodeHeartbeatResponse{Total: util.GB, ReplicaIP: "10.0.0.1"}, 0.9)
+	if views := c.allDataNodes(); len(views) != 1 || views[0].ReplicaIP != "10.0.0.1" {
+		t.Fatalf("the replication IP reported by the heartbeat should be in the node view, but got %v", views)
+	}
+	// the replication interface is removed from the config
+	dataNode.updateNodeMetric(&proto.DataNodeHeartbeatResponse{Total: util.GB}, 0.9)
+	if views := c.allDataNodes(); views[0].ReplicaIP != "" {
+		t.Fatalf("the replication IP should be cleared, but got %v", views[0].ReplicaIP)
+	}
+}
@@ -22,25 +22,30 @@ import (
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
-	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
 // DataPartition represents the structure of storing the file contents.
 type DataPartition struct {
-	PartitionID    uint64
-	LastLoadedTime int64
-	ReplicaNum     uint8
-	Status         int8
-	isRecover      bool
-	Replicas       []*DataReplica
-	Hosts          []string // host addresses
-	Peers          []proto.Peer
-	offlineMutex   sync.RWMutex
+	PartitionID       uint64
+	LastLoadedTime    int64
+	ReplicaNum        uint8
+	Status            int8
+	isRecover         bool
+	isPendingDelete   bool  // the partition is read-only and deleted once no inode refers to it
+	pendingDeleteTime int64 // when the partition is marked to be deleted
+	isFrozen          bool  // the partition is pinned read-only on the data nodes, without any write, repair or delete
+	isDegraded        bool  // the replicas serve the possibly stale reads without the leader once the quorum is lost
+	isCold            bool  // the partition in the cold zone holds the files moved by the lifecycle rules, read-only
+	Replicas          []*DataReplica
+	Hosts             []string // host addresses
+	Peers             []proto.Peer
+	offlineMutex      sync.RWMutex
 	sync.RWMutex
 	total                   uint64
 	used                    uint64
+	size                    uint64           // the size allocated on each replica, which can be grown by the resize
 	MissingNodes            map[string]int64 // key: address of the missing node, value: when the node is missing
 	VolName                 string
 	VolID                   uint64
@@ -121,10 +126,10 @@ func (partition *DataPartition) createTaskToRemoveRaftMember(removePeer proto.Pe
 	return
 }
 
-func (partition *DataPartition) createTaskToCreateDataPartition(addr string, dataPartitionSize uint64, peers []proto.Peer, hosts []string, createType int) (task *proto.AdminTask) {
+func (partition *DataPartition) createTaskToCreateDataPartition(addr string, dataPartitionSize uint64, peers []proto.Peer, hosts []string, createType int, diskPath string) (task *proto.AdminTask) {
 
 	task = proto.NewAdminTask(proto.OpCreateDataPartition, addr, newCreateDataPartitionRequest(
-		partition.VolName, partition.PartitionID, peers, int(dataPartitionSize), hosts, createType))
+		partition.VolName, partition.PartitionID, peers, int(dataPartitionSize), hosts, createType, diskPath))
 	partition.resetTaskID(task)
 	return
 }
@@ -154,7 +159,7 @@ func (partition *DataPartition) hasMissingOneReplica(replicaNum int) (err error)
 func (partition *DataPartition) canBeOffLine(offlineAddr string) (err error) {
 	msg := fmt.Sprintf("action[canOffLine],partitionID:%v  RocksDBHost:%v  offLine:%v ",
 		partition.PartitionID, partition.Hosts, offlineAddr)
-	liveReplicas := partition.liveReplicas(defaultDataPartitionTimeOutSec)
+	liveReplicas := partition.liveReplicas(gConfig.dpTimeOutSec())
 
 	otherLiveReplicas := make([]*DataReplica, 0)
 	for i := 0; i < len(liveReplicas); i++ {
@@ -230,7 +235,7 @@ func (partition *DataPartition) createLoadTasks() (tasks []*proto.AdminTask) {
 	defer partition.Unlock()
 	for _, addr := range partition.Hosts {
 		replica, err := partition.getReplica(addr)
-		if err != nil || replica.isLive(defaultDataPartitionTimeOutSec) == false {
+		if err != nil || replica.isLive(gConfig.dpTimeOutSec()) == false {
 			continue
 		}
 		replica.HasLoadResponse = false
@@ -267,6 +272,12 @@ func (partition *DataPartition) convertToDataPartitionResponse() (dpr *proto.Dat
 	dpr.ReplicaNum = partition.ReplicaNum
 	dpr.Hosts = make([]string, len(partition.Hosts))
 	copy(dpr.Hosts, partition.Hosts)
+	dpr.HostZones = make(map[string]string, len(partition.Replicas))
+	for _, replica := range partition.Replicas {
+		if replica.dataNode != nil && replica.dataNode.ZoneName != "" {
+			dpr.HostZones[replica.Addr] = replica.dataNode.ZoneName
+		}
+	}
 	dpr.LeaderAddr = partition.getLeaderAddr()
 	dpr.IsRecover = partition.isRecover
 	return
@@ -346,7 +357,7 @@ func (partition *DataPartition) getFileCount() {
 func (partition *DataPartition) releaseDataPartition() {
 	partition.Lock()
 	defer partition.Unlock()
-	liveReplicas := partition.getLiveReplicasFromHosts(defaultDataPartitionTimeOutSec)
+	liveReplicas := partition.getLiveReplicasFromHosts(gConfig.dpTimeOutSec())
 	for _, replica := range liveReplicas {
 		replica.HasLoadResponse = false
 	}
@@ -517,7 +528,10 @@ func (partition *DataPartition) updateMetric(vr *proto.PartitionReport, dataNode
 		replica = newDataReplica(dataNode)
 		partition.addReplica(replica)
 	}
-	partition.total = vr.Total
+	// the replicas not resized yet report the smaller sizes, the total follows the size of the partition
+	if partition.total = partition.size; partition.total == 0 {
+		partition.total = vr.Total
+	}
 	replica.Status = int8(vr.PartitionStatus)
 	replica.Total = vr.Total
 	replica.Used = vr.Used
@@ -526,6 +540,11 @@ func (partition *DataPartition) updateMetric(vr *proto.PartitionReport, dataNode
 	replica.setAlive()
 	replica.IsLeader = vr.IsLeader
 	replica.NeedsToCompare = vr.NeedCompare
+	replica.IsFrozen = vr.IsFrozen
+	replica.IsDegraded = vr.IsDegraded
+	replica.AvailableTinyExtents = vr.AvailableTinyExtents
+	replica.BrokenTinyExtents = vr.BrokenTinyExtents
+	replica.writes, replica.reads = vr.WriteSizes, vr.ReadSizes
 	if replica.DiskPath != vr.DiskPath && vr.DiskPath != "" {
 		oldDiskPath := replica.DiskPath
 		replica.DiskPath = vr.DiskPath
@@ -560,7 +579,7 @@ func (partition *DataPartition) afterCreation(nodeAddr, diskPath string, c *Clus
 	replica.Status = proto.ReadWrite
 	replica.DiskPath = diskPath
 	replica.ReportTime = time.Now().Unix()
-	replica.Total = util.DefaultDataPartitionSize
+	replica.Total = partition.size
 	partition.addReplica(replica)
 	partition.checkAndRemoveMissReplica(replica.Addr)
 	return
@@ -681,5 +700,10 @@ func (partition *DataPartition) ToProto(c *Cluster) *proto.DataPartitionInfo {
 		FileInCoreMap:           fileInCoreMap,
 		OfflinePeerID:           partition.OfflinePeerID,
 		FilesWithMissingReplica: partition.FilesWithMissingReplica,
+		IsPendingDelete:         partition.isPendingDelete,
+		IsFrozen:                partition.isFrozen,
+		IsDegraded:              partition.isDegraded,
+		IsCold:                  partition.isCold,
+		Size:                    partition.size,
 	}
 }
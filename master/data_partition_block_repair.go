@@ -0,0 +1,107 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func blockRepairKey(report *proto.DataBlockReport) string {
+	return fmt.Sprintf("%v%v%v%v%v%v%v", report.PartitionID, keySeparator, report.Addr, keySeparator,
+		report.ExtentID, keySeparator, report.Offset)
+}
+
+func (partition *DataPartition) createTaskToRepairDataBlock(report *proto.DataBlockReport) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpRepairDataBlock, report.Addr, &proto.RepairDataBlockRequest{
+		PartitionId: partition.PartitionID,
+		ExtentId:    report.ExtentID,
+		Offset:      report.Offset,
+		Size:        report.Size,
+		SourceAddr:  report.SourceAddr,
+	})
+	partition.resetTaskID(task)
+	return
+}
+
+// repairDataBlock schedules the repair of the blocks reported by a client on the corrupted replica, which reads
+// the same blocks from the source replica. The blocks reported again by the other clients before the repair
+// finishes are ignored.
+func (c *Cluster) repairDataBlock(report *proto.DataBlockReport) (err error) {
+	dp, err := c.getDataPartitionByID(report.PartitionID)
+	if err != nil {
+		return
+	}
+	dp.RLock()
+	isFrozen := dp.isFrozen
+	hasHosts := dp.hasHost(report.Addr) && dp.hasHost(report.SourceAddr)
+	dp.RUnlock()
+	if isFrozen {
+		return proto.ErrDataPartitionFrozen
+	}
+	if !hasHosts || report.Addr == report.SourceAddr {
+		return fmt.Errorf("the replica[%v] or the source[%v] is not a host of data partition[%v]",
+			report.Addr, report.SourceAddr, dp.PartitionID)
+	}
+	dataNode, err := c.dataNode(report.Addr)
+	if err != nil {
+		return
+	}
+	key := blockRepairKey(report)
+	if _, loaded := c.blockRepairs.LoadOrStore(key, report); loaded {
+		return
+	}
+	log.LogWarnf("action[repairDataBlock] dp[%v] extent[%v] offset[%v] size[%v] addr[%v] source[%v]",
+		dp.PartitionID, report.ExtentID, report.Offset, report.Size, report.Addr, report.SourceAddr)
+	go func() {
+		defer c.blockRepairs.Delete(key)
+		if _, err := dataNode.TaskManager.syncSendAdminTask(dp.createTaskToRepairDataBlock(report)); err != nil {
+			log.LogErrorf("action[repairDataBlock] dp[%v] extent[%v] offset[%v] addr[%v] source[%v] err[%v]",
+				dp.PartitionID, report.ExtentID, report.Offset, report.Addr, report.SourceAddr, err)
+			return
+		}
+		log.LogWarnf("action[repairDataBlock] dp[%v] extent[%v] offset[%v] addr[%v] is repaired",
+			dp.PartitionID, report.ExtentID, report.Offset, report.Addr)
+	}()
+	return
+}
+
+func (m *Server) reportBadBlock(w http.ResponseWriter, r *http.Request) {
+	var (
+		body   []byte
+		report *proto.DataBlockReport
+		err    error
+	)
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	report = &proto.DataBlockReport{}
+	if err = json.Unmarshal(body, report); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.repairDataBlock(report); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("repair of the blocks of data partition[%v] on [%v] is scheduled",
+		report.PartitionID, report.Addr)))
+}
@@ -38,7 +38,8 @@ func (partition *DataPartition) checkStatus(clusterName string, needLog bool, dp
 	switch len(liveReplicas) {
 	case (int)(partition.ReplicaNum):
 		partition.Status = proto.ReadOnly
-		if partition.checkReplicaStatusOnLiveNode(liveReplicas) == true && partition.canWrite() {
+		if partition.checkReplicaStatusOnLiveNode(liveReplicas) == true && partition.canWrite() && !partition.isPendingDelete && !partition.isFrozen &&
+			!partition.isDegraded && !partition.isCold {
 			partition.Status = proto.ReadWrite
 		}
 	default:
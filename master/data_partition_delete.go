@@ -0,0 +1,196 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (c *Cluster) getVolAndDataPartition(volName string, partitionID uint64) (vol *Vol, dp *DataPartition, err error) {
+	if vol, err = c.getVol(volName); err != nil {
+		return nil, nil, proto.ErrVolNotExists
+	}
+	if dp, err = vol.getDataPartitionByID(partitionID); err != nil {
+		return nil, nil, proto.ErrDataPartitionNotExists
+	}
+	return
+}
+
+// checkDataPartitionRef asks the leader of each meta partition of the vol for the inodes
+// which have extent keys referring to the data partition.
+func (c *Cluster) checkDataPartitionRef(vol *Vol, dp *DataPartition, limit int) (report *proto.DataPartitionRefReport, err error) {
+	dp.RLock()
+	report = &proto.DataPartitionRefReport{
+		VolName:         vol.Name,
+		PartitionID:     dp.PartitionID,
+		Inodes:          make([]uint64, 0),
+		IsPendingDelete: dp.isPendingDelete,
+	}
+	dp.RUnlock()
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		var resp *proto.CheckDataPartitionRefResponse
+		if resp, err = c.checkDataPartitionRefOnMetaPartition(mp, dp.PartitionID, limit); err != nil {
+			return
+		}
+		report.ExtentKeyCount += resp.ExtentKeyCount
+		report.InodeCount += resp.InodeCount
+		for _, ino := range resp.Inodes {
+			if len(report.Inodes) >= limit {
+				break
+			}
+			report.Inodes = append(report.Inodes, ino)
+		}
+	}
+	return
+}
+
+func (c *Cluster) checkDataPartitionRefOnMetaPartition(mp *MetaPartition, dataPartitionID uint64, limit int) (resp *proto.CheckDataPartitionRefResponse, err error) {
+	mp.RLock()
+	mr, err := mp.getMetaReplicaLeader()
+	mp.RUnlock()
+	if err != nil {
+		err = fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+		return
+	}
+	req := &proto.CheckDataPartitionRefRequest{
+		PartitionID:     mp.PartitionID,
+		DataPartitionID: dataPartitionID,
+		Limit:           limit,
+	}
+	task := proto.NewAdminTask(proto.OpCheckDataPartitionRef, mr.Addr, req)
+	resetMetaPartitionTaskID(task, mp.PartitionID)
+	packet, err := mr.metaNode.Sender.syncSendAdminTask(task)
+	if err != nil {
+		err = fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+		return
+	}
+	resp = &proto.CheckDataPartitionRefResponse{}
+	if err = json.Unmarshal(packet.Data, resp); err != nil {
+		err = fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+		return
+	}
+	return
+}
+
+// markDataPartitionToDelete makes the data partition read-only, and it is deleted by the scheduled task
+// once no inode refers to it. A referenced data partition can be marked only if force is true,
+// so that the referenced extents can be migrated to the other data partitions without new references.
+func (c *Cluster) markDataPartitionToDelete(vol *Vol, dp *DataPartition, force bool) (report *proto.DataPartitionRefReport, err error) {
+	if dp.isFrozen {
+		err = proto.ErrDataPartitionFrozen
+		return
+	}
+	if report, err = c.checkDataPartitionRef(vol, dp, defaultDataPartitionRefLimit); err != nil {
+		return
+	}
+	if report.ExtentKeyCount != 0 && !force {
+		err = proto.ErrDataPartitionReferenced
+		return
+	}
+	if err = c.setDataPartitionPendingDelete(vol, dp, true); err != nil {
+		return
+	}
+	report.IsPendingDelete = true
+	return
+}
+
+func (c *Cluster) setDataPartitionPendingDelete(vol *Vol, dp *DataPartition, isPendingDelete bool) (err error) {
+	dp.Lock()
+	oldFlag := dp.isPendingDelete
+	dp.isPendingDelete = isPendingDelete
+	if err = c.syncUpdateDataPartition(dp); err != nil {
+		dp.isPendingDelete = oldFlag
+		dp.Unlock()
+		return
+	}
+	if isPendingDelete {
+		dp.Status = proto.ReadOnly
+		dp.pendingDeleteTime = time.Now().Unix()
+	}
+	dp.Unlock()
+	vol.dataPartitions.updateResponseCache(true, 0)
+	log.LogWarnf("action[setDataPartitionPendingDelete] vol[%v] dp[%v] isPendingDelete[%v]", vol.Name, dp.PartitionID, isPendingDelete)
+	return
+}
+
+func (c *Cluster) scheduleToDeleteDataPartitions() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.deletePendingDataPartitions()
+			}
+			time.Sleep(time.Second * time.Duration(c.cfg.IntervalToCheckDataPartition))
+		}
+	}()
+}
+
+// deletePendingDataPartitions deletes the data partitions marked to be deleted, if they have been read-only
+// long enough for the clients to stop writing, and no inode refers to them.
+func (c *Cluster) deletePendingDataPartitions() {
+	now := time.Now().Unix()
+	for _, vol := range c.copyVols() {
+		for _, dp := range vol.cloneDataPartitionMap() {
+			dp.Lock()
+			if !dp.isPendingDelete || dp.isFrozen {
+				dp.Unlock()
+				continue
+			}
+			// the time is not persisted, so the waiting restarts after the master leader changes
+			if dp.pendingDeleteTime == 0 {
+				dp.pendingDeleteTime = now
+			}
+			waiting := now-dp.pendingDeleteTime < defaultSecondsToDeleteDataPartition
+			dp.Unlock()
+			if waiting {
+				continue
+			}
+			report, err := c.checkDataPartitionRef(vol, dp, defaultDataPartitionRefLimit)
+			if err != nil {
+				log.LogErrorf("action[deletePendingDataPartitions] vol[%v] dp[%v] err[%v]", vol.Name, dp.PartitionID, err)
+				continue
+			}
+			if report.ExtentKeyCount != 0 {
+				log.LogWarnf("action[deletePendingDataPartitions] vol[%v] dp[%v] is referenced by [%v] extent keys of [%v] inodes, inodes%v",
+					vol.Name, dp.PartitionID, report.ExtentKeyCount, report.InodeCount, report.Inodes)
+				continue
+			}
+			if err = c.deleteDataPartition(vol, dp); err != nil {
+				log.LogErrorf("action[deletePendingDataPartitions] vol[%v] dp[%v] err[%v]", vol.Name, dp.PartitionID, err)
+			}
+		}
+	}
+}
+
+func (c *Cluster) deleteDataPartition(vol *Vol, dp *DataPartition) (err error) {
+	if err = c.syncDeleteDataPartition(dp); err != nil {
+		return
+	}
+	vol.dataPartitions.del(dp)
+	vol.dataPartitions.updateResponseCache(true, 0)
+	dp.RLock()
+	tasks := make([]*proto.AdminTask, 0, len(dp.Replicas))
+	for _, replica := range dp.Replicas {
+		tasks = append(tasks, dp.createTaskToDeleteDataPartition(replica.Addr))
+	}
+	dp.RUnlock()
+	c.addDataNodeTasks(tasks)
+	Warn(c.Name, fmt.Sprintf("action[deleteDataPartition] clusterID[%v] vol[%v] dp[%v] is deleted", c.Name, vol.Name, dp.PartitionID))
+	return
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (partition *DataPartition) createTaskToFreezeDataPartition(addr string, isFrozen bool) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpFreezeDataPartition, addr, &proto.FreezeDataPartitionRequest{
+		PartitionId: partition.PartitionID,
+		IsFrozen:    isFrozen,
+	})
+	partition.resetTaskID(task)
+	return
+}
+
+// setDataPartitionFrozen freezes or unfreezes the data partition on every replica. A frozen data partition keeps
+// serving the reads, while the writes, repairs and deletes are refused, so that the evidence of a corruption is
+// preserved for the investigation. The flag is persisted before the replicas are notified, and the replicas which
+// fail to be notified are synced by the scheduled check of the data partitions.
+func (c *Cluster) setDataPartitionFrozen(vol *Vol, dp *DataPartition, isFrozen bool) (err error) {
+	dp.Lock()
+	oldFlag := dp.isFrozen
+	dp.isFrozen = isFrozen
+	if err = c.syncUpdateDataPartition(dp); err != nil {
+		dp.isFrozen = oldFlag
+		dp.Unlock()
+		return
+	}
+	if isFrozen {
+		dp.Status = proto.ReadOnly
+	}
+	hosts := make([]string, len(dp.Hosts))
+	copy(hosts, dp.Hosts)
+	dp.Unlock()
+	vol.dataPartitions.updateResponseCache(true, 0)
+	log.LogWarnf("action[setDataPartitionFrozen] vol[%v] dp[%v] isFrozen[%v]", vol.Name, dp.PartitionID, isFrozen)
+
+	return notifyReplicas("data partition", dp.PartitionID, hosts, func(addr string) error {
+		return c.syncFreezeDataReplica(dp, addr, isFrozen)
+	})
+}
+
+func isFrozenDataReplica(replica *DataReplica) *bool {
+	return &replica.IsFrozen
+}
+
+func (c *Cluster) syncFreezeDataReplica(dp *DataPartition, addr string, isFrozen bool) (err error) {
+	_, err = c.syncDataReplicaFlag(dp, addr, dp.createTaskToFreezeDataPartition(addr, isFrozen), isFrozenDataReplica, isFrozen)
+	return
+}
+
+// syncFrozenDataReplicas notifies the live replicas whose reported flag differs from the data partition again.
+func (c *Cluster) syncFrozenDataReplicas(vol *Vol) {
+	c.syncDataReplicaFlags(vol, "syncFrozenDataReplicas", func(dp *DataPartition) bool { return dp.isFrozen },
+		isFrozenDataReplica, c.syncFreezeDataReplica)
+}
@@ -78,6 +78,22 @@ func (dpMap *DataPartitionMap) put(dp *DataPartition) {
 	}
 }
 
+func (dpMap *DataPartitionMap) del(dp *DataPartition) {
+	dpMap.Lock()
+	defer dpMap.Unlock()
+	if _, ok := dpMap.partitionMap[dp.PartitionID]; !ok {
+		return
+	}
+	delete(dpMap.partitionMap, dp.PartitionID)
+	dataPartitions := make([]*DataPartition, 0, len(dpMap.partitions))
+	for _, partition := range dpMap.partitions {
+		if partition.PartitionID != dp.PartitionID {
+			dataPartitions = append(dataPartitions, partition)
+		}
+	}
+	dpMap.partitions = dataPartitions
+}
+
 func (dpMap *DataPartitionMap) setReadWriteDataPartitions(readWrites int, clusterName string) {
 	dpMap.Lock()
 	defer dpMap.Unlock()
@@ -229,6 +245,18 @@ func (dpMap *DataPartitionMap) totalUsedSpace() (totalUsed uint64) {
 	return
 }
 
+// coldPartitions returns the cold data partitions, which hold the files moved by the lifecycle rules.
+func (dpMap *DataPartitionMap) coldPartitions() (partitions []*DataPartition) {
+	dpMap.RLock()
+	defer dpMap.RUnlock()
+	for _, dp := range dpMap.partitions {
+		if dp.isCold {
+			partitions = append(partitions, dp)
+		}
+	}
+	return
+}
+
 func (dpMap *DataPartitionMap) setAllDataPartitionsToReadOnly() {
 	dpMap.Lock()
 	defer dpMap.Unlock()
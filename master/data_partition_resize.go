@@ -0,0 +1,112 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (partition *DataPartition) createTaskToResizeDataPartition(addr string, size uint64) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpResizeDataPartition, addr, &proto.ResizeDataPartitionRequest{
+		PartitionId:   partition.PartitionID,
+		PartitionSize: int(size),
+	})
+	partition.resetTaskID(task)
+	return
+}
+
+// resizeDataPartition grows the data partition to the size online. The size is persisted before the replicas are
+// notified, so that the total of the partition and the new replicas take it at once, and the replicas which fail to
+// be resized are synced by the scheduled check of the data partitions.
+func (c *Cluster) resizeDataPartition(vol *Vol, dp *DataPartition, size uint64) (err error) {
+	dp.Lock()
+	if dp.isFrozen {
+		dp.Unlock()
+		return proto.ErrDataPartitionFrozen
+	}
+	oldSize := dp.size
+	if size < oldSize {
+		dp.Unlock()
+		return fmt.Errorf("data partition[%v] cannot shrink from size[%v] to size[%v]", dp.PartitionID, oldSize, size)
+	}
+	if size == oldSize {
+		dp.Unlock()
+		return
+	}
+	dp.size = size
+	if err = c.syncUpdateDataPartition(dp); err != nil {
+		dp.size = oldSize
+		dp.Unlock()
+		return
+	}
+	dp.total = size
+	hosts := make([]string, len(dp.Hosts))
+	copy(hosts, dp.Hosts)
+	dp.Unlock()
+	log.LogWarnf("action[resizeDataPartition] vol[%v] dp[%v] size[%v] -> size[%v]", vol.Name, dp.PartitionID, oldSize, size)
+
+	failures := make([]string, 0)
+	for _, host := range hosts {
+		if err = c.syncResizeDataReplica(dp, host, size); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", host, err))
+		}
+	}
+	if len(failures) != 0 {
+		err = fmt.Errorf("failed to resize the replicas of data partition[%v], [%v]", dp.PartitionID, strings.Join(failures, ", "))
+	}
+	return
+}
+
+func (c *Cluster) syncResizeDataReplica(dp *DataPartition, addr string, size uint64) (err error) {
+	dataNode, err := c.dataNode(addr)
+	if err != nil {
+		return
+	}
+	if _, err = dataNode.TaskManager.syncSendAdminTask(dp.createTaskToResizeDataPartition(addr, size)); err != nil {
+		return
+	}
+	// take the size before it is reported by the heartbeat, so that the replica is not resized again
+	dp.Lock()
+	if replica, ok := dp.hasReplica(addr); ok && replica.Total < size {
+		replica.Total = size
+	}
+	dp.Unlock()
+	return
+}
+
+// syncResizedDataReplicas resizes the live replicas which report a smaller size than the data partition again.
+func (c *Cluster) syncResizedDataReplicas(vol *Vol) {
+	for _, dp := range vol.cloneDataPartitionMap() {
+		dp.RLock()
+		size := dp.size
+		addrs := make([]string, 0)
+		for _, replica := range dp.getLiveReplicasFromHosts(c.cfg.dpTimeOutSec()) {
+			if replica.Total != 0 && replica.Total < size {
+				addrs = append(addrs, replica.Addr)
+			}
+		}
+		dp.RUnlock()
+		for _, addr := range addrs {
+			if err := c.syncResizeDataReplica(dp, addr, size); err != nil {
+				log.LogErrorf("action[syncResizedDataReplicas] vol[%v] dp[%v] addr[%v] size[%v] err[%v]",
+					vol.Name, dp.PartitionID, addr, size, err)
+			}
+		}
+	}
+}
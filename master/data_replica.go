@@ -25,6 +25,8 @@ type DataReplica struct {
 	proto.DataReplica
 	dataNode *DataNode
 	loc      uint8
+	writes   []uint64 // the writes led by the replica, counted in the buckets of proto.IOSizeBounds
+	reads    []uint64 // the reads served by the replica, counted in the buckets of proto.IOSizeBounds
 }
 
 func newDataReplica(dataNode *DataNode) (replica *DataReplica) {
@@ -68,7 +70,7 @@ func (replica *DataReplica) isLocationAvailable() (isAvailable bool) {
 	dataNode := replica.getReplicaNode()
 	dataNode.Lock()
 	defer dataNode.Unlock()
-	if dataNode.isActive == true && replica.isActive(defaultDataPartitionTimeOutSec) == true {
+	if dataNode.isActive == true && replica.isActive(gConfig.dpTimeOutSec()) == true {
 		isAvailable = true
 	}
 
@@ -0,0 +1,89 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func hostIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// metaHostIPs returns the IPs of the meta nodes hosting the meta partitions of the volume.
+func (vol *Vol) metaHostIPs() (ips map[string]bool) {
+	ips = make(map[string]bool)
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		mp.RLock()
+		for _, host := range mp.Hosts {
+			ips[hostIP(host)] = true
+		}
+		mp.RUnlock()
+	}
+	return
+}
+
+// dataNodesExcludedByAffinity returns the data nodes which are not preferred by the affinity policy of the volume.
+func (c *Cluster) dataNodesExcludedByAffinity(vol *Vol) (excludeHosts []string) {
+	excludeHosts = make([]string, 0)
+	metaIPs := vol.metaHostIPs()
+	if len(metaIPs) == 0 {
+		return
+	}
+	c.dataNodes.Range(func(addr, node interface{}) bool {
+		onMetaHost := metaIPs[hostIP(addr.(string))]
+		if (vol.dpAffinity == proto.DpAffinityColocate && !onMetaHost) ||
+			(vol.dpAffinity == proto.DpAffinityAntiColocate && onMetaHost) {
+			excludeHosts = append(excludeHosts, addr.(string))
+		}
+		return true
+	})
+	return
+}
+
+// chooseTargetDataNodesForVol chooses the hosts of a new data partition of the volume. The data nodes preferred by
+// the affinity policy of the volume are tried first, and all the data nodes are considered if the preferred ones
+// are not enough, for example, if they lack space. The data nodes of the volume paired by the shadow replication are
+// always avoided unless the others are not enough, which is alarmed.
+func (c *Cluster) chooseTargetDataNodesForVol(vol *Vol, zoneNum int) (hosts []string, peers []proto.Peer, err error) {
+	partnerHosts := c.shadowPartnerHosts(vol, false)
+	if vol.dpAffinity != proto.DpAffinityNone {
+		if excludeHosts := c.dataNodesExcludedByAffinity(vol); len(excludeHosts) > 0 {
+			excludeHosts = append(excludeHosts, partnerHosts...)
+			if hosts, peers, err = c.chooseTargetDataNodes("", nil, excludeHosts, int(vol.dpReplicaNum), zoneNum, vol.zoneName); err == nil {
+				return
+			}
+			log.LogWarnf("action[chooseTargetDataNodesForVol] vol[%v] affinity[%v] no enough preferred data nodes, "+
+				"fall back to all the data nodes, err[%v]", vol.Name, vol.dpAffinity, err)
+		}
+	}
+	if len(partnerHosts) > 0 {
+		if hosts, peers, err = c.chooseTargetDataNodes("", nil, partnerHosts, int(vol.dpReplicaNum), zoneNum, vol.zoneName); err == nil {
+			return
+		}
+		msg := fmt.Sprintf("action[chooseTargetDataNodesForVol] vol[%v] no enough data nodes disjoint from its "+
+			"shadow pair, err[%v]", vol.Name, err)
+		log.LogWarn(msg)
+		Warn(c.Name, msg)
+	}
+	return c.chooseTargetDataNodes("", nil, nil, int(vol.dpReplicaNum), zoneNum, vol.zoneName)
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/log"
+	"golang.org/x/time/rate"
+)
+
+type dpCreationWaiter struct {
+	volName string
+	since   time.Time
+	ready   chan struct{} // closed once the creation is admitted
+}
+
+// dpCreationQueue admits the data partition creations, so that the batches of the volumes, e.g. the automatic
+// expansions creating tens of data partitions, do not storm the data nodes. At most cfg.DpCreationConcurrency creations
+// run in the cluster at once, and one of each volume, at most cfg.DpCreationRate are started per second, and the
+// rest wait in the order of their arrivals. A creation is rejected if its volume has cfg.VolDpCreationQueueSize ones
+// waiting, or it has waited cfg.DpCreationWaitSec, which pushes back on the callers.
+type dpCreationQueue struct {
+	sync.Mutex
+	cfg      *clusterConfig
+	limiter  *rate.Limiter // nil if the rate is unlimited
+	running  map[string]int
+	total    int // creations running
+	waiters  []*dpCreationWaiter
+	admitted uint64
+	rejected uint64
+	timedOut uint64
+}
+
+func (m *Server) parseDpCreationConfig(cfg *config.Config) (err error) {
+	for _, item := range []struct {
+		key   string
+		value *int
+		min   int
+	}{
+		{dpCreationConcurrency, &m.config.DpCreationConcurrency, 1},
+		{dpCreationRate, &m.config.DpCreationRate, 0},
+		{volDpCreationQueueSize, &m.config.VolDpCreationQueueSize, 1},
+	} {
+		value := cfg.GetString(item.key)
+		if value == "" {
+			continue
+		}
+		if *item.value, err = strconv.Atoi(value); err != nil || *item.value < item.min {
+			return fmt.Errorf("%v,err:invalid %v[%v]", proto.ErrInvalidCfg, item.key, value)
+		}
+	}
+	if value := cfg.GetString(dpCreationWaitSec); value != "" {
+		if m.config.DpCreationWaitSec, err = strconv.ParseInt(value, 10, 64); err != nil || m.config.DpCreationWaitSec <= 0 {
+			return fmt.Errorf("%v,err:invalid %v[%v]", proto.ErrInvalidCfg, dpCreationWaitSec, value)
+		}
+	}
+	return
+}
+
+func newDpCreationQueue(cfg *clusterConfig) (q *dpCreationQueue) {
+	q = &dpCreationQueue{cfg: cfg, running: make(map[string]int)}
+	if cfg.DpCreationRate > 0 {
+		q.limiter = rate.NewLimiter(rate.Limit(cfg.DpCreationRate), cfg.DpCreationRate)
+	}
+	return
+}
+
+func (q *dpCreationQueue) canRun(volName string) bool {
+	return q.total < q.cfg.DpCreationConcurrency && q.running[volName] == 0
+}
+
+// dispatch admits the waiters in the order of their arrivals, skipping the ones whose volumes are creating. The
+// caller should grab the lock.
+func (q *dpCreationQueue) dispatch() {
+	waiters := q.waiters[:0]
+	for _, waiter := range q.waiters {
+		if !q.canRun(waiter.volName) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		q.running[waiter.volName]++
+		q.total++
+		q.admitted++
+		close(waiter.ready)
+	}
+	q.waiters = waiters
+}
+
+// acquire waits until a creation of the volume is admitted, which must be released afterwards.
+func (q *dpCreationQueue) acquire(volName string) (err error) {
+	q.Lock()
+	waiting := 0
+	for _, waiter := range q.waiters {
+		if waiter.volName == volName {
+			waiting++
+		}
+	}
+	if waiting >= q.cfg.VolDpCreationQueueSize {
+		q.rejected++
+		q.Unlock()
+		return proto.ErrDataPartitionCreationQueueFull
+	}
+	waiter := &dpCreationWaiter{volName: volName, since: time.Now(), ready: make(chan struct{})}
+	q.waiters = append(q.waiters, waiter)
+	q.dispatch()
+	q.Unlock()
+
+	timeout := time.Duration(q.cfg.DpCreationWaitSec) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	select {
+	case <-waiter.ready:
+	case <-ctx.Done():
+		q.Lock()
+		select {
+		case <-waiter.ready:
+			// admitted meanwhile
+		default:
+			q.removeWaiter(waiter)
+			q.timedOut++
+			q.Unlock()
+			log.LogWarnf("action[dpCreationQueue.acquire] vol[%v] waited for %v", volName, timeout)
+			return proto.ErrDataPartitionCreationTimeout
+		}
+		q.Unlock()
+	}
+	if q.limiter == nil {
+		return
+	}
+	if err = q.limiter.Wait(ctx); err != nil {
+		q.release(volName)
+		q.Lock()
+		q.timedOut++
+		q.Unlock()
+		return proto.ErrDataPartitionCreationTimeout
+	}
+	return
+}
+
+func (q *dpCreationQueue) removeWaiter(waiter *dpCreationWaiter) {
+	for i, w := range q.waiters {
+		if w == waiter {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (q *dpCreationQueue) release(volName string) {
+	q.Lock()
+	defer q.Unlock()
+	if q.running[volName]--; q.running[volName] <= 0 {
+		delete(q.running, volName)
+	}
+	q.total--
+	q.dispatch()
+}
+
+func (q *dpCreationQueue) view() (view *proto.DataPartitionCreationQueue) {
+	q.Lock()
+	defer q.Unlock()
+	view = &proto.DataPartitionCreationQueue{
+		Concurrency:  q.cfg.DpCreationConcurrency,
+		RatePerSec:   q.cfg.DpCreationRate,
+		VolQueueSize: q.cfg.VolDpCreationQueueSize,
+		WaitSec:      q.cfg.DpCreationWaitSec,
+		Running:      make(map[string]int, len(q.running)),
+		Waiting:      make([]*proto.DataPartitionCreationWaiter, 0, len(q.waiters)),
+		Admitted:     q.admitted,
+		Rejected:     q.rejected,
+		TimedOut:     q.timedOut,
+	}
+	for volName, n := range q.running {
+		view.Running[volName] = n
+	}
+	now := time.Now()
+	for _, waiter := range q.waiters {
+		view.Waiting = append(view.Waiting, &proto.DataPartitionCreationWaiter{
+			VolName:   waiter.volName,
+			WaitedSec: int64(now.Sub(waiter.since).Seconds()),
+		})
+	}
+	return
+}
+
+func (m *Server) getDataPartitionCreationQueue(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.dpCreations.view()))
+}
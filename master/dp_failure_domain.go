@@ -0,0 +1,92 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const defaultFailureDomainAttempts = 3
+
+// failureDomain returns the failure domain of the data node at the level, empty if it is unknown.
+func (dataNode *DataNode) failureDomain(level string) string {
+	dataNode.RLock()
+	defer dataNode.RUnlock()
+	switch level {
+	case proto.FailureDomainZone:
+		return dataNode.ZoneName
+	case proto.FailureDomainRack:
+		if dataNode.Rack == "" {
+			return ""
+		}
+		return dataNode.ZoneName + "/" + dataNode.Rack
+	default:
+		return hostIP(dataNode.Addr)
+	}
+}
+
+// validateFailureDomain rejects the hosts chosen for a new data partition of the volume if two of them are in the
+// same failure domain of the volume, or on the same host. A data node whose rack is unknown breaks the rack domain.
+func (c *Cluster) validateFailureDomain(vol *Vol, hosts []string) (err error) {
+	if vol.failureDomain == proto.FailureDomainNone {
+		return
+	}
+	levels := []string{proto.FailureDomainHost}
+	if vol.failureDomain != proto.FailureDomainHost {
+		levels = append(levels, vol.failureDomain)
+	}
+	dataNodes := make([]*DataNode, 0, len(hosts))
+	for _, host := range hosts {
+		dataNode, err := c.dataNode(host)
+		if err != nil {
+			return err
+		}
+		dataNodes = append(dataNodes, dataNode)
+	}
+	for _, level := range levels {
+		owners := make(map[string]string)
+		for _, dataNode := range dataNodes {
+			domain := dataNode.failureDomain(level)
+			if domain == "" {
+				return fmt.Errorf("the %v of data node[%v] is unknown", level, dataNode.Addr)
+			}
+			if owner, ok := owners[domain]; ok {
+				return fmt.Errorf("data nodes[%v] and [%v] are in the same %v[%v]", owner, dataNode.Addr, level, domain)
+			}
+			owners[domain] = dataNode.Addr
+		}
+	}
+	return
+}
+
+// chooseTargetDataNodesInFailureDomain chooses the hosts of a new data partition of the volume which keep at most one
+// replica in each failure domain of the volume. The data nodes are chosen regardless of the racks and the hosts, so
+// they are chosen again up to defaultFailureDomainAttempts times before the creation is rejected.
+func (c *Cluster) chooseTargetDataNodesInFailureDomain(vol *Vol, zoneNum int) (hosts []string, peers []proto.Peer, err error) {
+	for i := 0; i < defaultFailureDomainAttempts; i++ {
+		if hosts, peers, err = c.chooseTargetDataNodesForVol(vol, zoneNum); err != nil {
+			return
+		}
+		if err = c.validateFailureDomain(vol, hosts); err == nil {
+			return
+		}
+		log.LogWarnf("action[chooseTargetDataNodesInFailureDomain] vol[%v] failureDomain[%v] hosts%v rejected, err[%v]",
+			vol.Name, vol.failureDomain, hosts, err)
+	}
+	return nil, nil, fmt.Errorf("no placement in the failure domain[%v] of vol[%v], %v", vol.failureDomain, vol.Name, err)
+}
@@ -0,0 +1,309 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// extentCopyJob is a job copying an extent between the data nodes, which is kept by the leader only, so the jobs are
+// lost once the leader is changed while the copies go on.
+type extentCopyJob struct {
+	sync.RWMutex
+	view proto.ExtentCopyJob
+}
+
+func (job *extentCopyJob) getView() *proto.ExtentCopyJob {
+	job.RLock()
+	defer job.RUnlock()
+	view := job.view
+	return &view
+}
+
+func (job *extentCopyJob) finish(state, msg string, copied uint64, crc uint32) {
+	job.Lock()
+	defer job.Unlock()
+	job.view.State, job.view.Msg, job.view.CopiedBytes, job.view.Crc = state, msg, copied, crc
+	job.view.UpdateTime = time.Now().Unix()
+}
+
+func (partition *DataPartition) createTaskToCopyExtent(addr string, request *proto.CopyExtentRequest) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpCopyExtent, addr, request)
+	partition.resetTaskID(task)
+	return
+}
+
+// copyExtent submits the job copying the range of the extent from the replica on the source data node to the replica
+// on the destination, which pulls the range from the source and reports the result once the copy ends. It moves the
+// data explicitly, instead of in the disguise of a repair, for the rebalance, the decommission and the manual fixes.
+func (c *Cluster) copyExtent(request *proto.CopyExtentRequest, destAddr string) (jobID uint64, err error) {
+	dp, err := c.getDataPartitionByID(request.PartitionId)
+	if err != nil {
+		return
+	}
+	dp.RLock()
+	isFrozen := dp.isFrozen
+	hasHosts := dp.hasHost(destAddr) && dp.hasHost(request.SourceAddr)
+	dp.RUnlock()
+	if isFrozen {
+		return 0, proto.ErrDataPartitionFrozen
+	}
+	if !hasHosts || destAddr == request.SourceAddr {
+		return 0, fmt.Errorf("the destination[%v] or the source[%v] is not a host of data partition[%v]",
+			destAddr, request.SourceAddr, dp.PartitionID)
+	}
+	if _, _, err = c.submitExtentCopy(dp, request, destAddr); err != nil {
+		return
+	}
+	return request.JobID, nil
+}
+
+// submitExtentCopy submits the job copying the extent to the replica of the data partition on the destination, and
+// returns the job with the reply of the destination.
+func (c *Cluster) submitExtentCopy(dp *DataPartition, request *proto.CopyExtentRequest, destAddr string) (
+	job *extentCopyJob, reply *proto.Packet, err error) {
+	dataNode, err := c.dataNode(destAddr)
+	if err != nil {
+		return
+	}
+	if request.JobID, err = c.idAlloc.allocateCommonID(); err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	job = &extentCopyJob{view: proto.ExtentCopyJob{
+		ID:          request.JobID,
+		PartitionID: request.PartitionId,
+		ExtentID:    request.ExtentId,
+		Offset:      request.Offset,
+		Size:        request.Size,
+		SourceAddr:  request.SourceAddr,
+		DestAddr:    destAddr,
+		RateLimit:   request.RateLimit,
+		State:       proto.ExtentCopyRunning,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}}
+	c.pruneExtentCopyJobs()
+	c.extentCopyJobs.Store(request.JobID, job)
+	task := dp.createTaskToCopyExtent(destAddr, request)
+	dataNode.TaskManager.awaitResponse(task)
+	if reply, err = dataNode.TaskManager.syncSendAdminTask(task); err != nil {
+		job.finish(proto.ExtentCopyFailed, err.Error(), 0, 0)
+		return
+	}
+	log.LogWarnf("action[copyExtent] job[%v] dp[%v] extent[%v] offset[%v] size[%v] from[%v] to[%v] rateLimit[%v] "+
+		"source[%v_%v]", request.JobID, dp.PartitionID, request.ExtentId, request.Offset, request.Size,
+		request.SourceAddr, destAddr, request.RateLimit, request.SourcePartitionId, request.SourceExtentId)
+	return
+}
+
+// copyExtentToColdPartition copies the extent of the data partition to every replica of the cold data partition, and
+// waits for the copies until the timeout. The replica first in the hosts of the cold data partition allocates the ID
+// of the copy, which is returned even if the copies fail, so that the copies are deleted.
+func (c *Cluster) copyExtentToColdPartition(dp, cold *DataPartition, extentID uint64, timeout time.Duration) (
+	coldExtentID uint64, err error) {
+	dp.RLock()
+	source := dp.getLeaderAddr()
+	if source == "" && len(dp.Hosts) > 0 {
+		source = dp.Hosts[0]
+	}
+	dp.RUnlock()
+	cold.RLock()
+	hosts := make([]string, len(cold.Hosts))
+	copy(hosts, cold.Hosts)
+	cold.RUnlock()
+	if source == "" || len(hosts) == 0 {
+		return 0, fmt.Errorf("no source of data partition[%v] or no host of cold data partition[%v]", dp.PartitionID,
+			cold.PartitionID)
+	}
+	jobs := make([]*extentCopyJob, 0, len(hosts))
+	for _, host := range hosts {
+		request := &proto.CopyExtentRequest{
+			PartitionId:       cold.PartitionID,
+			ExtentId:          coldExtentID,
+			SourceAddr:        source,
+			SourcePartitionId: dp.PartitionID,
+			SourceExtentId:    extentID,
+		}
+		var (
+			job   *extentCopyJob
+			reply *proto.Packet
+		)
+		if job, reply, err = c.submitExtentCopy(cold, request, host); err != nil {
+			return
+		}
+		jobs = append(jobs, job)
+		if coldExtentID != 0 {
+			continue
+		}
+		allocated := &proto.CopyExtentRequest{}
+		if err = json.Unmarshal(reply.Data, allocated); err != nil || allocated.ExtentId == 0 {
+			return 0, fmt.Errorf("no extent allocated by [%v] of cold data partition[%v], err[%v]", host,
+				cold.PartitionID, err)
+		}
+		coldExtentID = allocated.ExtentId
+	}
+	return coldExtentID, waitExtentCopyJobs(jobs, timeout)
+}
+
+// waitExtentCopyJobs waits until the jobs end, and fails if any job fails or does not end within the timeout.
+func waitExtentCopyJobs(jobs []*extentCopyJob, timeout time.Duration) (err error) {
+	deadline := time.Now().Add(timeout)
+	for _, job := range jobs {
+		for {
+			view := job.getView()
+			if view.State == proto.ExtentCopySucceeded {
+				break
+			}
+			if view.State == proto.ExtentCopyFailed {
+				return fmt.Errorf("extent copy job[%v] to [%v] failed, err[%v]", view.ID, view.DestAddr, view.Msg)
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("extent copy job[%v] to [%v] timeout", view.ID, view.DestAddr)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+	return
+}
+
+func (c *Cluster) handleResponseToCopyExtent(nodeAddr string, resp *proto.CopyExtentResponse) (err error) {
+	value, ok := c.extentCopyJobs.Load(resp.JobID)
+	if !ok {
+		log.LogWarnf("action[handleResponseToCopyExtent] job[%v] of [%v] is unknown, status[%v] result[%v]",
+			resp.JobID, nodeAddr, resp.Status, resp.Result)
+		return
+	}
+	job := value.(*extentCopyJob)
+	if resp.Status == proto.TaskSucceeds {
+		job.finish(proto.ExtentCopySucceeded, "", resp.CopiedBytes, resp.Crc)
+		return
+	}
+	job.finish(proto.ExtentCopyFailed, resp.Result, resp.CopiedBytes, resp.Crc)
+	Warn(c.Name, fmt.Sprintf("clusterID[%v] extent copy job[%v] on [%v] failed, err[%v]", c.Name, resp.JobID, nodeAddr,
+		resp.Result))
+	return
+}
+
+// pruneExtentCopyJobs forgets the jobs finished beyond the retention.
+func (c *Cluster) pruneExtentCopyJobs() {
+	c.extentCopyJobs.Range(func(key, value interface{}) bool {
+		job := value.(*extentCopyJob).getView()
+		if job.State != proto.ExtentCopyRunning && time.Now().Unix()-job.UpdateTime > defaultExtentCopyJobRetentionSec {
+			c.extentCopyJobs.Delete(key)
+		}
+		return true
+	})
+}
+
+// getExtentCopyJobs returns the job of the ID, or all the jobs in the order of their IDs if the ID is zero.
+func (c *Cluster) getExtentCopyJobs(jobID uint64) (jobs []*proto.ExtentCopyJob) {
+	jobs = make([]*proto.ExtentCopyJob, 0)
+	c.extentCopyJobs.Range(func(key, value interface{}) bool {
+		if jobID == 0 || key.(uint64) == jobID {
+			jobs = append(jobs, value.(*extentCopyJob).getView())
+		}
+		return true
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return
+}
+
+func parseRequestToCopyExtent(r *http.Request) (request *proto.CopyExtentRequest, destAddr string, err error) {
+	request = &proto.CopyExtentRequest{}
+	if request.PartitionId, destAddr, err = extractDataPartitionIDAndAddr(r); err != nil {
+		return
+	}
+	if request.SourceAddr = r.FormValue(sourceAddrKey); request.SourceAddr == "" {
+		err = keyNotFound(sourceAddrKey)
+		return
+	}
+	value := r.FormValue(extentIDKey)
+	if value == "" {
+		err = keyNotFound(extentIDKey)
+		return
+	}
+	if request.ExtentId, err = strconv.ParseUint(value, 10, 64); err != nil {
+		return
+	}
+	if value = r.FormValue(extentOffsetKey); value != "" {
+		if request.Offset, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return
+		}
+	}
+	if value = r.FormValue(extentSizeKey); value != "" {
+		var size uint64
+		if size, err = strconv.ParseUint(value, 10, 32); err != nil {
+			return
+		}
+		request.Size = uint32(size)
+	}
+	if value = r.FormValue(rateLimitKey); value != "" {
+		if request.RateLimit, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m *Server) copyExtent(w http.ResponseWriter, r *http.Request) {
+	var (
+		request  *proto.CopyExtentRequest
+		destAddr string
+		jobID    uint64
+		err      error
+	)
+	if request, destAddr, err = parseRequestToCopyExtent(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if jobID, err = m.cluster.copyExtent(request, destAddr); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(jobID))
+}
+
+func (m *Server) getExtentCopyJob(w http.ResponseWriter, r *http.Request) {
+	var (
+		jobID uint64
+		err   error
+	)
+	if value := r.FormValue(jobIDKey); value != "" {
+		if jobID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", jobIDKey, value)})
+			return
+		}
+	}
+	jobs := m.cluster.getExtentCopyJobs(jobID)
+	if jobID == 0 {
+		sendOkReply(w, r, newSuccessHTTPReply(jobs))
+		return
+	}
+	if len(jobs) == 0 {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("extent copy job[%v] not found", jobID)})
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(jobs[0]))
+}
@@ -27,7 +27,7 @@ import (
 func (partition *DataPartition) validateCRC(clusterID string) {
 	partition.Lock()
 	defer partition.Unlock()
-	liveReplicas := partition.liveReplicas(defaultDataPartitionTimeOutSec)
+	liveReplicas := partition.liveReplicas(gConfig.dpTimeOutSec())
 	if len(liveReplicas) == 0 {
 		return
 	}
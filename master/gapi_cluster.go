@@ -436,7 +436,7 @@ func (m *ClusterService) addMetaNode(ctx context.Context, args struct {
 	NodeAddr string
 	ZoneName string
 }) (uint64, error) {
-	if id, err := m.cluster.addMetaNode(args.NodeAddr, args.ZoneName); err != nil {
+	if id, err := m.cluster.addMetaNode(args.NodeAddr, args.ZoneName, ""); err != nil {
 		return 0, err
 	} else {
 		return id, nil
@@ -610,6 +610,8 @@ func (m *ClusterService) makeClusterView() *proto.ClusterView {
 		Name:                m.cluster.Name,
 		LeaderAddr:          m.cluster.leaderInfo.addr,
 		DisableAutoAlloc:    m.cluster.DisableAutoAllocate,
+		DisableAutoPromote:  m.cluster.DisableAutoPromoteSpare,
+		EnableQuorumWrite:   m.cluster.EnableQuorumWrite,
 		MetaNodeThreshold:   m.cluster.cfg.MetaNodeThreshold,
 		Applied:             m.cluster.fsm.applied,
 		MaxDataPartitionID:  m.cluster.idAlloc.dataPartitionID,
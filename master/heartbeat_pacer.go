@@ -0,0 +1,197 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// heartbeatPacer paces the heartbeats sent to the nodes, and the timeouts derived from them. The leader stretches the
+// interval up to the default one while most of the active nodes have not responded to the previous heartbeats, i.e.
+// the master or the network can not keep up with it, and the timeouts are stretched in proportion, so that a node is
+// never taken as dead by the suppression.
+type heartbeatPacer struct {
+	sync.RWMutex
+	base        time.Duration // the configured interval
+	maxInterval time.Duration
+	current     time.Duration
+	nodeTimeout time.Duration // the configured timeout of the nodes at the base interval
+	suppressed  uint64        // the rounds sent at a stretched interval
+}
+
+func newHeartbeatPacer(interval, nodeTimeout time.Duration) *heartbeatPacer {
+	maxInterval := time.Second * defaultIntervalToCheckHeartbeat
+	if interval > maxInterval {
+		maxInterval = interval
+	}
+	return &heartbeatPacer{base: interval, maxInterval: maxInterval, current: interval, nodeTimeout: nodeTimeout}
+}
+
+func (p *heartbeatPacer) interval() time.Duration {
+	p.RLock()
+	defer p.RUnlock()
+	return p.current
+}
+
+func (p *heartbeatPacer) ratio() float64 {
+	p.RLock()
+	defer p.RUnlock()
+	return float64(p.current) / float64(p.base)
+}
+
+// nodeTimeOut returns how long a node may go without responding to the heartbeats before it is inactive.
+func (p *heartbeatPacer) nodeTimeOut() time.Duration {
+	return time.Duration(float64(p.nodeTimeout) * p.ratio())
+}
+
+// partitionTimeOutSec stretches the timeout of the partition replicas configured at the base interval.
+func (p *heartbeatPacer) partitionTimeOutSec(timeOutSec int64) int64 {
+	return int64(math.Ceil(float64(timeOutSec) * p.ratio()))
+}
+
+// adjust doubles the interval up to the max one if more than half of the active nodes have not responded to the
+// previous heartbeats, and halves it back down to the base one once all of them have responded.
+func (p *heartbeatPacer) adjust(pending, active int) (interval time.Duration, changed bool) {
+	p.Lock()
+	defer p.Unlock()
+	interval = p.current
+	switch {
+	case active > 0 && pending*2 > active:
+		if interval *= 2; interval > p.maxInterval {
+			interval = p.maxInterval
+		}
+	case pending == 0:
+		if interval /= 2; interval < p.base {
+			interval = p.base
+		}
+	}
+	changed = interval != p.current
+	if p.current = interval; p.current != p.base {
+		p.suppressed++
+	}
+	return
+}
+
+func (p *heartbeatPacer) view() *proto.HeartbeatPaceView {
+	p.RLock()
+	defer p.RUnlock()
+	return &proto.HeartbeatPaceView{
+		IntervalMs:      p.base.Milliseconds(),
+		CurrentMs:       p.current.Milliseconds(),
+		NodeTimeoutMs:   time.Duration(float64(p.nodeTimeout) * float64(p.current) / float64(p.base)).Milliseconds(),
+		SuppressedCount: p.suppressed,
+	}
+}
+
+func (cfg *clusterConfig) nodeTimeOut() time.Duration {
+	return cfg.heartbeat.nodeTimeOut()
+}
+
+func (cfg *clusterConfig) dpTimeOutSec() int64 {
+	return cfg.heartbeat.partitionTimeOutSec(cfg.DataPartitionTimeOutSec)
+}
+
+func (cfg *clusterConfig) mpTimeOutSec() int64 {
+	return cfg.heartbeat.partitionTimeOutSec(cfg.MetaPartitionTimeOutSec)
+}
+
+// parseHeartbeatConfig parses the interval of the heartbeats and the timeout of the nodes, and derives the timeouts of
+// the partition replicas from the interval, which are overridden by their own config.
+func (m *Server) parseHeartbeatConfig(cfg *config.Config) (err error) {
+	interval := time.Second * defaultIntervalToCheckHeartbeat
+	if value := cfg.GetString(heartbeatIntervalMs); value != "" {
+		var ms int64
+		if ms, err = strconv.ParseInt(value, 10, 64); err != nil || ms < minHeartbeatIntervalMs {
+			return fmt.Errorf("%v,err:invalid %v[%v], at least %v", proto.ErrInvalidCfg, heartbeatIntervalMs, value,
+				minHeartbeatIntervalMs)
+		}
+		interval = time.Millisecond * time.Duration(ms)
+	}
+	nodeTimeout := noHeartBeatTimes * interval
+	if value := cfg.GetString(nodeTimeoutMs); value != "" {
+		var ms int64
+		if ms, err = strconv.ParseInt(value, 10, 64); err != nil || time.Millisecond*time.Duration(ms) <= interval {
+			return fmt.Errorf("%v,err:invalid %v[%v], longer than the heartbeat interval", proto.ErrInvalidCfg,
+				nodeTimeoutMs, value)
+		}
+		nodeTimeout = time.Millisecond * time.Duration(ms)
+	}
+	m.config.heartbeat = newHeartbeatPacer(interval, nodeTimeout)
+	partitionTimeOutSec := int64(math.Ceil((10 * interval).Seconds()))
+	if partitionTimeOutSec < minPartitionTimeOutSec {
+		partitionTimeOutSec = minPartitionTimeOutSec
+	}
+	m.config.DataPartitionTimeOutSec = partitionTimeOutSec
+	m.config.MetaPartitionTimeOutSec = partitionTimeOutSec
+	log.LogInfof("action[parseHeartbeatConfig] interval[%v] nodeTimeout[%v] partitionTimeOutSec[%v]", interval,
+		nodeTimeout, partitionTimeOutSec)
+	return
+}
+
+// pendingHeartbeats counts the active nodes, and the ones which have not responded to the previous heartbeats.
+func (c *Cluster) pendingHeartbeats() (pending, active int) {
+	c.dataNodes.Range(func(addr, value interface{}) bool {
+		node := value.(*DataNode)
+		node.RLock()
+		isActive := node.isActive
+		node.RUnlock()
+		if isActive {
+			active++
+			if node.TaskManager.hasPendingTask(proto.OpDataNodeHeartbeat) {
+				pending++
+			}
+		}
+		return true
+	})
+	c.metaNodes.Range(func(addr, value interface{}) bool {
+		node := value.(*MetaNode)
+		node.RLock()
+		isActive := node.IsActive
+		node.RUnlock()
+		if isActive {
+			active++
+			if node.Sender.hasPendingTask(proto.OpMetaNodeHeartbeat) {
+				pending++
+			}
+		}
+		return true
+	})
+	return
+}
+
+// adjustHeartbeatInterval stretches or restores the interval of the heartbeats by the responses to the previous ones.
+func (c *Cluster) adjustHeartbeatInterval() {
+	pending, active := c.pendingHeartbeats()
+	interval, changed := c.cfg.heartbeat.adjust(pending, active)
+	if !changed {
+		return
+	}
+	msg := fmt.Sprintf("action[adjustHeartbeatInterval] clusterID[%v] %v of %v active nodes have not responded to the "+
+		"previous heartbeats, the heartbeat interval is changed to %v, the node timeout to %v", c.Name, pending, active,
+		interval, c.cfg.nodeTimeOut())
+	if pending > 0 {
+		Warn(c.Name, msg)
+		return
+	}
+	log.LogWarn(msg)
+}
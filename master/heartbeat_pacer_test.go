@@ -0,0 +1,72 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/config"
+)
+
+func TestHeartbeatPacer(t *testing.T) {
+	p := newHeartbeatPacer(500*time.Millisecond, 1500*time.Millisecond)
+	if interval, changed := p.adjust(0, 10); changed || interval != 500*time.Millisecond {
+		t.Fatalf("the interval should be kept at the base, but is %v", interval)
+	}
+	if interval, changed := p.adjust(5, 10); changed || interval != 500*time.Millisecond {
+		t.Fatalf("the interval should be kept if half of the nodes are pending, but is %v", interval)
+	}
+	if interval, changed := p.adjust(6, 10); !changed || interval != time.Second {
+		t.Fatalf("the interval should be doubled if most of the nodes are pending, but is %v", interval)
+	}
+	if timeout := p.nodeTimeOut(); timeout != 3*time.Second {
+		t.Errorf("the node timeout should be stretched to 3s, but is %v", timeout)
+	}
+	if timeOutSec := p.partitionTimeOutSec(5); timeOutSec != 10 {
+		t.Errorf("the partition timeout should be stretched to 10s, but is %v", timeOutSec)
+	}
+	for i := 0; i < 10; i++ {
+		p.adjust(10, 10)
+	}
+	if interval := p.interval(); interval != time.Second*defaultIntervalToCheckHeartbeat {
+		t.Errorf("the interval should be capped at the default, but is %v", interval)
+	}
+	if interval, _ := p.adjust(1, 10); interval != time.Second*defaultIntervalToCheckHeartbeat {
+		t.Errorf("the interval should be kept while some nodes are pending, but is %v", interval)
+	}
+	for i := 0; i < 10; i++ {
+		p.adjust(0, 10)
+	}
+	if view := p.view(); view.CurrentMs != 500 || view.NodeTimeoutMs != 1500 || view.SuppressedCount == 0 {
+		t.Errorf("the interval should be restored to the base, but is %v", view)
+	}
+}
+
+func TestParseHeartbeatConfig(t *testing.T) {
+	m := &Server{config: newClusterConfig()}
+	if err := m.parseHeartbeatConfig(config.LoadConfigString(`{"heartbeatIntervalMs":"500"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if m.config.nodeTimeOut() != 1500*time.Millisecond || m.config.dpTimeOutSec() != 5 || m.config.mpTimeOutSec() != 5 {
+		t.Errorf("unexpected timeouts derived from the interval, node[%v] dp[%v] mp[%v]", m.config.nodeTimeOut(),
+			m.config.dpTimeOutSec(), m.config.mpTimeOutSec())
+	}
+	for _, cfg := range []string{`{"heartbeatIntervalMs":"50"}`, `{"heartbeatIntervalMs":"500","nodeTimeoutMs":"500"}`} {
+		if err := m.parseHeartbeatConfig(config.LoadConfigString(cfg)); err == nil {
+			t.Errorf("config %v should be rejected", cfg)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package master
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"github.com/samsarahq/thunder/graphql"
@@ -55,8 +56,11 @@ func (m *Server) registerAPIMiddleware(route *mux.Router) {
 	var interceptor mux.MiddlewareFunc = func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
-				log.LogDebugf("action[interceptor] request, method[%v] path[%v] query[%v]", r.Method, r.URL.Path, r.URL.Query())
-				if mux.CurrentRoute(r).GetName() == proto.AdminGetIP {
+				log.LogDebugf("action[interceptor] request, method[%v] path[%v] query[%v] node[%v]",
+					r.Method, r.URL.Path, r.URL.Query(), r.Header.Get(proto.NodeRoleHeader))
+				// the environment and the raft timings of the master itself are checked and tuned on each master
+				if name := mux.CurrentRoute(r).GetName(); name == proto.AdminGetIP || name == proto.AdminValidateConfig ||
+					name == proto.AdminGetRaftTimings || name == proto.AdminSetRaftTimings {
 					next.ServeHTTP(w, r)
 					return
 				}
@@ -99,9 +103,24 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet).
 		Path(proto.AdminGetCluster).
 		HandlerFunc(m.getCluster)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminStatsTree).
+		HandlerFunc(m.getStatsTree)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminExportMetadata).
+		HandlerFunc(m.exportMetadata)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminResolvePath).
+		HandlerFunc(m.resolvePath)
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminClusterFreeze).
 		HandlerFunc(m.setupAutoAllocation)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetAutoPromoteSpare).
+		HandlerFunc(m.setupAutoPromoteSpare)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetQuorumWrite).
+		HandlerFunc(m.setupQuorumWrite)
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AddRaftNode).
 		HandlerFunc(m.addRaftNode)
@@ -109,6 +128,36 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 		Path(proto.RemoveRaftNode).
 		HandlerFunc(m.removeRaftNode)
 	router.NewRoute().Methods(http.MethodGet).Path(proto.AdminClusterStat).HandlerFunc(m.clusterStat)
+	router.NewRoute().Methods(http.MethodPost).
+		Path(proto.AdminBootstrap).
+		HandlerFunc(m.bootstrap)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminPlacementDiff).
+		HandlerFunc(m.getPlacementDiff)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminDataPartitionCreations).
+		HandlerFunc(m.getDataPartitionCreationQueue)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminDataPartitionPlacement).
+		HandlerFunc(m.getDataPartitionPlacement)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminNodeVersions).
+		HandlerFunc(m.getNodeVersions)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminSchemaVersion).
+		HandlerFunc(m.getSchemaVersion)
+	router.NewRoute().Name(proto.AdminValidateConfig).
+		Methods(http.MethodPost).
+		Path(proto.AdminValidateConfig).
+		HandlerFunc(m.validateConfig)
+	router.NewRoute().Name(proto.AdminGetRaftTimings).
+		Methods(http.MethodGet).
+		Path(proto.AdminGetRaftTimings).
+		HandlerFunc(m.getRaftTimings)
+	router.NewRoute().Name(proto.AdminSetRaftTimings).
+		Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetRaftTimings).
+		HandlerFunc(m.setRaftTimings)
 
 	// volume management APIs
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
@@ -120,6 +169,9 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminDeleteVol).
 		HandlerFunc(m.markDeleteVol)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminUndeleteVol).
+		HandlerFunc(m.undeleteVol)
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminUpdateVol).
 		HandlerFunc(m.updateVol)
@@ -129,6 +181,57 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminVolExpand).
 		HandlerFunc(m.volExpand)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminFreezeVol).
+		HandlerFunc(m.freezeVol)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminThawVol).
+		HandlerFunc(m.thawVol)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminDelegateVolToken).
+		HandlerFunc(m.delegateVolToken)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminReserveVolSpace).
+		HandlerFunc(m.reserveVolSpace)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminCancelVolReservation).
+		HandlerFunc(m.cancelVolReservation)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetVolReservations).
+		HandlerFunc(m.getVolReservations)
+	router.NewRoute().Methods(http.MethodPost).
+		Path(proto.AdminSetVolLifecycle).
+		HandlerFunc(m.setVolLifecycle)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetVolLifecycleStatus).
+		HandlerFunc(m.getVolLifecycleStatus)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetVolNamespaceExport).
+		HandlerFunc(m.setVolNamespaceExport)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminRunVolNamespaceExport).
+		HandlerFunc(m.runVolNamespaceExport)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetVolNamespaceExportJob).
+		HandlerFunc(m.getVolNamespaceExportStatus)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminRunVolOrphanExtents).
+		HandlerFunc(m.runVolOrphanExtents)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetVolOrphanExtentsReport).
+		HandlerFunc(m.getVolOrphanExtentsReport)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminVolSnapshotDiff).
+		HandlerFunc(m.getVolSnapshotDiff)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminVolRecommendations).
+		HandlerFunc(m.getVolRecommendations)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminVolShadowFailover).
+		HandlerFunc(m.failoverVolToShadow)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetVolMaxClients).
+		HandlerFunc(m.setVolMaxClients)
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.ClientVol).
 		HandlerFunc(m.getVol)
@@ -141,14 +244,32 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet).
 		Path(proto.AdminListVols).
 		HandlerFunc(m.listVols)
+	router.NewRoute().Methods(http.MethodPost).
+		Path(proto.ClientMetricsReport).
+		HandlerFunc(m.reportClientMetrics)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.ClientMetricsList).
+		HandlerFunc(m.listClientMetrics)
+	router.NewRoute().Methods(http.MethodPost).
+		Path(proto.ClientReportBadBlock).
+		HandlerFunc(m.reportBadBlock)
+	router.NewRoute().Methods(http.MethodPost).
+		Path(proto.ClientReportMismatch).
+		HandlerFunc(m.reportReadMismatch)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.ClientRegister).
+		HandlerFunc(m.registerClient)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.ClientUnregister).
+		HandlerFunc(m.unregisterClient)
 
 	// node task response APIs
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.GetDataNodeTaskResponse).
-		HandlerFunc(m.handleDataNodeTaskResponse)
+		HandlerFunc(m.nodeOnly(m.handleDataNodeTaskResponse))
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.GetMetaNodeTaskResponse).
-		HandlerFunc(m.handleMetaNodeTaskResponse)
+		HandlerFunc(m.nodeOnly(m.handleMetaNodeTaskResponse))
 
 	// meta partition management APIs
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
@@ -157,6 +278,12 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminDecommissionMetaPartition).
 		HandlerFunc(m.decommissionMetaPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminDegradeMetaPartition).
+		HandlerFunc(m.degradeMetaPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminUndegradeMetaPartition).
+		HandlerFunc(m.undegradeMetaPartition)
 	router.NewRoute().Methods(http.MethodGet).
 		Path(proto.ClientMetaPartitions).
 		HandlerFunc(m.getMetaPartitions)
@@ -189,6 +316,39 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminDecommissionDataPartition).
 		HandlerFunc(m.decommissionDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminDeleteDataPartition).
+		HandlerFunc(m.deleteDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminCancelDeleteDataPartition).
+		HandlerFunc(m.cancelDeleteDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminFreezeDataPartition).
+		HandlerFunc(m.freezeDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminUnfreezeDataPartition).
+		HandlerFunc(m.unfreezeDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminDegradeDataPartition).
+		HandlerFunc(m.degradeDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminUndegradeDataPartition).
+		HandlerFunc(m.undegradeDataPartition)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminCopyExtent).
+		HandlerFunc(m.copyExtent)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetExtentCopyJob).
+		HandlerFunc(m.getExtentCopyJob)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetReadMismatches).
+		HandlerFunc(m.getReadMismatches)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminResizeDataPartition).
+		HandlerFunc(m.resizeDataPartition)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminCheckDataPartitionRef).
+		HandlerFunc(m.checkDataPartitionRef)
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminDiagnoseDataPartition).
 		HandlerFunc(m.diagnoseDataPartition)
@@ -199,7 +359,7 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	// meta node management APIs
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AddMetaNode).
-		HandlerFunc(m.addMetaNode)
+		HandlerFunc(m.nodeOnly(m.addMetaNode))
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.DecommissionMetaNode).
 		HandlerFunc(m.decommissionMetaNode)
@@ -209,6 +369,9 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminSetMetaNodeThreshold).
 		HandlerFunc(m.setMetaNodeThreshold)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetDataNodeDiskThreshold).
+		HandlerFunc(m.setDataNodeDiskThreshold)
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AdminAddDataReplica).
 		HandlerFunc(m.addDataReplica)
@@ -225,13 +388,24 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 		Path(proto.AdminGetInvalidNodes).
 		HandlerFunc(m.checkInvalidIDNodes)
 
+	// meta cache node management APIs
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AddMetaCacheNode).
+		HandlerFunc(m.nodeOnly(m.addMetaCacheNode))
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.GetMetaCacheNodes).
+		HandlerFunc(m.getMetaCacheNodes)
+
 	// data node management APIs
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.AddDataNode).
-		HandlerFunc(m.addDataNode)
+		HandlerFunc(m.nodeOnly(m.addDataNode))
 	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
 		Path(proto.DecommissionDataNode).
 		HandlerFunc(m.decommissionDataNode)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetDataNodeSpare).
+		HandlerFunc(m.setDataNodeSpare)
 	router.NewRoute().Methods(http.MethodGet).
 		Path(proto.GetDataNode).
 		HandlerFunc(m.getDataNode)
@@ -245,6 +419,68 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 		Path(proto.AdminGetNodeInfo).
 		HandlerFunc(m.getNodeInfoHandler)
 
+	// maintenance plan APIs
+	router.NewRoute().Methods(http.MethodPost).
+		Path(proto.AdminSubmitMaintenancePlan).
+		HandlerFunc(m.submitMaintenancePlan)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetMaintenancePlan).
+		HandlerFunc(m.getMaintenancePlan)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminListMaintenancePlans).
+		HandlerFunc(m.listMaintenancePlans)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminPauseMaintenancePlan).
+		HandlerFunc(m.pauseMaintenancePlan)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminResumeMaintenancePlan).
+		HandlerFunc(m.resumeMaintenancePlan)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminAbortMaintenancePlan).
+		HandlerFunc(m.abortMaintenancePlan)
+
+	// tenant APIs
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminCreateTenant).
+		HandlerFunc(m.createTenant)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminUpdateTenant).
+		HandlerFunc(m.updateTenant)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminDeleteTenant).
+		HandlerFunc(m.deleteTenant)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminTenantAddVol).
+		HandlerFunc(m.addVolToTenant)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminTenantRemoveVol).
+		HandlerFunc(m.removeVolFromTenant)
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminTenantStats).
+		HandlerFunc(m.getTenantStats)
+
+	// cluster event APIs
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetEvents).
+		HandlerFunc(m.getEvents)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetEventWebhooks).
+		HandlerFunc(m.setEventWebhooks)
+
+	// vol usage hook APIs
+	router.NewRoute().Methods(http.MethodGet).
+		Path(proto.AdminGetVolUsageHooks).
+		HandlerFunc(m.getVolUsageHooks)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminSetVolUsageHooks).
+		HandlerFunc(m.setVolUsageHooks)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminRetryVolUsageDeadLetters).
+		HandlerFunc(m.retryVolUsageDeadLetters)
+	router.NewRoute().Methods(http.MethodGet, http.MethodPost).
+		Path(proto.AdminPurgeVolUsageDeadLetters).
+		HandlerFunc(m.purgeVolUsageDeadLetters)
+
 	// user management APIs
 	router.NewRoute().Methods(http.MethodPost).
 		Path(proto.UserCreate).
@@ -303,6 +539,39 @@ func (m *Server) registerAPIRoutes(router *mux.Router) {
 		HandlerFunc(m.updateToken)
 }
 
+// nodeOnly rejects the requests to the handler unless they carry the node token of the cluster, so that only the
+// data nodes, the meta nodes and the meta cache nodes can call the node APIs. The node APIs are open if no node
+// token is configured.
+func (m *Server) nodeOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := m.checkNodeIdentity(r); err != nil {
+			log.LogWarnf("action[nodeOnly] reject path[%v] remoteAddr[%v] role[%v] err[%v]",
+				r.URL.Path, r.RemoteAddr, r.Header.Get(proto.NodeRoleHeader), err)
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeNoPermission, Msg: err.Error()})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (m *Server) checkNodeIdentity(r *http.Request) (err error) {
+	if m.config.nodeToken == "" {
+		return
+	}
+	switch role := r.Header.Get(proto.NodeRoleHeader); role {
+	case proto.NodeRoleData, proto.NodeRoleMeta, proto.NodeRoleMetaCache:
+	case "":
+		return fmt.Errorf("%v is an internal API of the cluster nodes", r.URL.Path)
+	default:
+		return fmt.Errorf("unknown node role %v", role)
+	}
+	token := r.Header.Get(proto.NodeTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(m.config.nodeToken)) != 1 {
+		return fmt.Errorf("invalid node token")
+	}
+	return
+}
+
 func (m *Server) registerHandler(router *mux.Router, model string, schema *graphql.Schema) {
 	introspection.AddIntrospectionToSchema(schema)
 
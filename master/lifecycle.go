@@ -0,0 +1,526 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	maxLifecycleRuleCount  = 1000
+	maxLifecycleRuleIDLen  = 255
+	secondsOfLifecycleDays = 24 * 60 * 60
+)
+
+// volLifecycleStatus keeps the status of the lifecycle rules of a volume on the master leader.
+type volLifecycleStatus struct {
+	sync.RWMutex
+	rules map[string]*proto.LifecycleRuleStatus
+}
+
+func (vs *volLifecycleStatus) update(ruleID string, fn func(st *proto.LifecycleRuleStatus)) {
+	vs.Lock()
+	defer vs.Unlock()
+	st, ok := vs.rules[ruleID]
+	if !ok {
+		st = &proto.LifecycleRuleStatus{ID: ruleID, State: proto.LifecycleRuleIdle}
+		vs.rules[ruleID] = st
+	}
+	fn(st)
+}
+
+func (vs *volLifecycleStatus) get(ruleID string) (st *proto.LifecycleRuleStatus, ok bool) {
+	vs.RLock()
+	defer vs.RUnlock()
+	var stored *proto.LifecycleRuleStatus
+	if stored, ok = vs.rules[ruleID]; ok {
+		copied := *stored
+		st = &copied
+	}
+	return
+}
+
+func (c *Cluster) getVolLifecycleStatus(volName string) *volLifecycleStatus {
+	vs, _ := c.lifecycleStatus.LoadOrStore(volName, &volLifecycleStatus{rules: make(map[string]*proto.LifecycleRuleStatus)})
+	return vs.(*volLifecycleStatus)
+}
+
+func validateLifecycleRules(rules []*proto.LifecycleRule) (err error) {
+	if len(rules) > maxLifecycleRuleCount {
+		return fmt.Errorf("the number of lifecycle rules exceeds %v", maxLifecycleRuleCount)
+	}
+	ids := make(map[string]bool)
+	for _, rule := range rules {
+		if rule == nil || rule.ID == "" {
+			return fmt.Errorf("lifecycle rule ID is empty")
+		}
+		if len(rule.ID) > maxLifecycleRuleIDLen {
+			return fmt.Errorf("lifecycle rule[%v] ID is longer than %v", rule.ID, maxLifecycleRuleIDLen)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("lifecycle rule[%v] is duplicated", rule.ID)
+		}
+		ids[rule.ID] = true
+		if rule.ExpirationDays < 0 || rule.TransitionDays < 0 || rule.AbortIncompleteMultipartUploadDays < 0 {
+			return fmt.Errorf("lifecycle rule[%v] days must not be negative", rule.ID)
+		}
+		if rule.TransitionStorageClass != "" && rule.TransitionStorageClass != proto.StorageClassCold {
+			return fmt.Errorf("lifecycle rule[%v] storage class[%v] is not supported", rule.ID, rule.TransitionStorageClass)
+		}
+		if rule.TransitionStorageClass != "" && rule.TransitionDays == 0 {
+			return fmt.Errorf("lifecycle rule[%v] has no transition days", rule.ID)
+		}
+		if rule.ExpirationDays == 0 && rule.TransitionDays == 0 && rule.AbortIncompleteMultipartUploadDays == 0 {
+			return fmt.Errorf("lifecycle rule[%v] has no action", rule.ID)
+		}
+	}
+	return
+}
+
+func (vol *Vol) getLifecycleRules() (rules []*proto.LifecycleRule) {
+	vol.RLock()
+	defer vol.RUnlock()
+	rules = make([]*proto.LifecycleRule, 0, len(vol.lifecycleRules))
+	for _, rule := range vol.lifecycleRules {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	return
+}
+
+// setVolLifecycleRules replaces the lifecycle rules of the volume, the rules are removed if they are empty.
+// The rules moving the files to the cold tier require the cold zone of the volume.
+func (c *Cluster) setVolLifecycleRules(name, authKey string, rules []*proto.LifecycleRule) (err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return proto.ErrVolNotExists
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	for _, rule := range rules {
+		if rule.TransitionDays > 0 && vol.coldZone == "" {
+			return proto.ErrVolNoColdZone
+		}
+	}
+	oldRules := vol.lifecycleRules
+	vol.lifecycleRules = rules
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.lifecycleRules = oldRules
+		log.LogErrorf("action[setVolLifecycleRules] vol[%v] err[%v]", name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	log.LogInfof("action[setVolLifecycleRules] vol[%v] rules[%v]", name, len(rules))
+	return
+}
+
+func (c *Cluster) scheduleToRunLifecycle() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.runLifecycle()
+			}
+			time.Sleep(time.Second * time.Duration(c.cfg.IntervalToRunLifecycle))
+		}
+	}()
+}
+
+func (c *Cluster) runLifecycle() {
+	for _, vol := range c.copyVols() {
+		if vol.Status == markDelete {
+			continue
+		}
+		c.runVolLifecycle(vol)
+	}
+}
+
+// runVolLifecycle executes the lifecycle rules of the volume one by one.
+func (c *Cluster) runVolLifecycle(vol *Vol) {
+	rules := vol.getLifecycleRules()
+	if len(rules) == 0 {
+		return
+	}
+	vs := c.getVolLifecycleStatus(vol.Name)
+	for _, rule := range rules {
+		if rule.Disabled {
+			vs.update(rule.ID, func(st *proto.LifecycleRuleStatus) {
+				st.State = proto.LifecycleRuleDisabled
+			})
+			continue
+		}
+		task := &lifecycleTask{c: c, vol: vol, rule: rule, status: vs, batchSize: defaultLifecycleBatchSize}
+		task.run()
+	}
+}
+
+// lifecycleTask executes a lifecycle rule of a volume by the batched operations on the meta partitions.
+type lifecycleTask struct {
+	c         *Cluster
+	vol       *Vol
+	rule      *proto.LifecycleRule
+	status    *volLifecycleStatus
+	batchSize int
+	cold      *DataPartition // the cold data partition which the extents are copied to
+}
+
+func (t *lifecycleTask) update(fn func(st *proto.LifecycleRuleStatus)) {
+	t.status.update(t.rule.ID, fn)
+}
+
+func (t *lifecycleTask) run() {
+	now := time.Now().Unix()
+	t.update(func(st *proto.LifecycleRuleStatus) {
+		st.State = proto.LifecycleRuleRunning
+		st.LastStartTime = now
+		st.Runs++
+		st.ScannedDirs, st.ScannedFiles, st.ExpiredFiles, st.TransitionedFiles, st.AbortedUploads = 0, 0, 0, 0, 0
+		st.LastError = ""
+	})
+	var err error
+	if t.rule.ExpirationDays > 0 {
+		err = t.expire(now - int64(t.rule.ExpirationDays)*secondsOfLifecycleDays)
+	}
+	if err == nil && t.rule.TransitionDays > 0 {
+		err = t.transition(now - int64(t.rule.TransitionDays)*secondsOfLifecycleDays)
+	}
+	if err == nil && t.rule.AbortIncompleteMultipartUploadDays > 0 {
+		err = t.abortMultiparts(now - int64(t.rule.AbortIncompleteMultipartUploadDays)*secondsOfLifecycleDays)
+	}
+	t.update(func(st *proto.LifecycleRuleStatus) {
+		st.State = proto.LifecycleRuleIdle
+		st.CurrentPath = ""
+		st.LastEndTime = time.Now().Unix()
+		if err != nil {
+			st.LastError = err.Error()
+		}
+	})
+	if err != nil {
+		log.LogErrorf("action[runLifecycleRule] vol[%v] rule[%v] err[%v]", t.vol.Name, t.rule.ID, err)
+		return
+	}
+	log.LogInfof("action[runLifecycleRule] vol[%v] rule[%v] finished", t.vol.Name, t.rule.ID)
+}
+
+// expire deletes the files under the prefix of the rule which have not been modified since expireBefore.
+func (t *lifecycleTask) expire(expireBefore int64) (err error) {
+	return t.walk(func(parentID uint64, files []*proto.LifecycleDentry) error {
+		return t.expireFiles(parentID, files, expireBefore)
+	})
+}
+
+// walk executes the action on the files under the prefix of the rule, in the batches of the files in a directory.
+// The prefix is split into the directories and the prefix of the names in the last directory,
+// e.g. prefix "logs/2020" matches the files under directory "logs" whose names start with "2020",
+// and all the files under the matched subdirectories.
+func (t *lifecycleTask) walk(action func(parentID uint64, files []*proto.LifecycleDentry) error) (err error) {
+	prefix := strings.TrimPrefix(t.rule.Prefix, "/")
+	var dirs []string
+	namePrefix := prefix
+	if index := strings.LastIndex(prefix, "/"); index >= 0 {
+		dirs = strings.Split(prefix[:index], "/")
+		namePrefix = prefix[index+1:]
+	}
+	parentID := proto.RootIno
+	path := "/"
+	for _, name := range dirs {
+		if name == "" {
+			continue
+		}
+		var resp *proto.LifecycleScanDirResponse
+		if resp, err = t.scanDir(parentID, name, "", 1); err != nil {
+			return
+		}
+		if len(resp.Dentries) == 0 || resp.Dentries[0].Name != name || !proto.IsDir(resp.Dentries[0].Type) {
+			return
+		}
+		parentID = resp.Dentries[0].Inode
+		path += name + "/"
+	}
+	return t.walkDir(parentID, path, namePrefix, action)
+}
+
+func (t *lifecycleTask) walkDir(parentID uint64, path, namePrefix string,
+	action func(parentID uint64, files []*proto.LifecycleDentry) error) (err error) {
+	t.update(func(st *proto.LifecycleRuleStatus) {
+		st.CurrentPath = path
+		st.ScannedDirs++
+	})
+	var marker string
+	for {
+		var resp *proto.LifecycleScanDirResponse
+		if resp, err = t.scanDir(parentID, namePrefix, marker, t.batchSize); err != nil {
+			return
+		}
+		files := make([]*proto.LifecycleDentry, 0)
+		subdirs := make([]*proto.LifecycleDentry, 0)
+		for _, d := range resp.Dentries {
+			if proto.IsDir(d.Type) {
+				subdirs = append(subdirs, d)
+			} else if proto.IsRegular(d.Type) {
+				files = append(files, d)
+			}
+		}
+		t.update(func(st *proto.LifecycleRuleStatus) {
+			st.ScannedFiles += uint64(len(files))
+		})
+		if err = action(parentID, files); err != nil {
+			return
+		}
+		for _, d := range subdirs {
+			if err = t.walkDir(d.Inode, path+d.Name+"/", "", action); err != nil {
+				return
+			}
+		}
+		if resp.NextMarker == "" {
+			return
+		}
+		marker = resp.NextMarker
+	}
+}
+
+// expireFiles deletes the dentries of the expired files first, and then the inodes, like removing the files.
+func (t *lifecycleTask) expireFiles(parentID uint64, files []*proto.LifecycleDentry, expireBefore int64) (err error) {
+	if len(files) == 0 {
+		return
+	}
+	inodes := make([]uint64, 0, len(files))
+	for _, d := range files {
+		inodes = append(inodes, d.Inode)
+	}
+	groups, err := t.groupInodesByMetaPartition(inodes)
+	if err != nil {
+		return
+	}
+	expired := make(map[uint64]bool)
+	for mp, group := range groups {
+		req := &proto.LifecycleFilterExpiredRequest{PartitionID: mp.PartitionID, Inodes: group, ExpireBefore: expireBefore}
+		resp := &proto.LifecycleFilterExpiredResponse{}
+		if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleFilterExpired, req, resp); err != nil {
+			return
+		}
+		for _, ino := range resp.Inodes {
+			expired[ino] = true
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	dentries := make([]*proto.LifecycleDentry, 0, len(expired))
+	for _, d := range files {
+		if expired[d.Inode] {
+			dentries = append(dentries, d)
+		}
+	}
+	parentMp, err := t.vol.metaPartitionByInode(parentID)
+	if err != nil {
+		return
+	}
+	dentryReq := &proto.LifecycleDeleteDentriesRequest{PartitionID: parentMp.PartitionID, ParentID: parentID, Dentries: dentries}
+	dentryResp := &proto.LifecycleDeleteDentriesResponse{}
+	if err = t.c.sendLifecycleTask(parentMp, proto.OpLifecycleDeleteDentries, dentryReq, dentryResp); err != nil {
+		return
+	}
+	if err = t.deleteInodes(dentryResp.Inodes); err != nil {
+		return
+	}
+	t.update(func(st *proto.LifecycleRuleStatus) {
+		st.ExpiredFiles += uint64(len(dentryResp.Inodes))
+		st.TotalExpiredFiles += uint64(len(dentryResp.Inodes))
+	})
+	return
+}
+
+// abortMultiparts aborts the multipart uploads under the prefix which have been initiated before initBefore.
+// The parts are deleted before the multipart upload is removed, like aborting it by the object node.
+func (t *lifecycleTask) abortMultiparts(initBefore int64) (err error) {
+	prefix := strings.TrimPrefix(t.rule.Prefix, "/")
+	for _, mp := range t.vol.cloneMetaPartitionMap() {
+		t.update(func(st *proto.LifecycleRuleStatus) {
+			st.CurrentPath = fmt.Sprintf("multipart uploads of meta partition %v", mp.PartitionID)
+		})
+		for {
+			req := &proto.LifecycleListMultipartsRequest{PartitionID: mp.PartitionID, Prefix: prefix, InitBefore: initBefore, Limit: t.batchSize}
+			resp := &proto.LifecycleListMultipartsResponse{}
+			if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleListMultiparts, req, resp); err != nil {
+				return
+			}
+			if len(resp.Multiparts) == 0 {
+				break
+			}
+			inodes := make([]uint64, 0)
+			for _, m := range resp.Multiparts {
+				inodes = append(inodes, m.Inodes...)
+			}
+			if err = t.deleteInodes(inodes); err != nil {
+				return
+			}
+			removeReq := &proto.LifecycleRemoveMultipartsRequest{PartitionID: mp.PartitionID, Multiparts: resp.Multiparts}
+			if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleRemoveMultiparts, removeReq, nil); err != nil {
+				return
+			}
+			t.update(func(st *proto.LifecycleRuleStatus) {
+				st.AbortedUploads += uint64(len(resp.Multiparts))
+				st.TotalAborted += uint64(len(resp.Multiparts))
+			})
+			if len(resp.Multiparts) < t.batchSize {
+				break
+			}
+		}
+	}
+	return
+}
+
+func (t *lifecycleTask) scanDir(parentID uint64, prefix, marker string, limit int) (resp *proto.LifecycleScanDirResponse, err error) {
+	mp, err := t.vol.metaPartitionByInode(parentID)
+	if err != nil {
+		return
+	}
+	req := &proto.LifecycleScanDirRequest{PartitionID: mp.PartitionID, ParentID: parentID, Prefix: prefix, Marker: marker, Limit: limit}
+	resp = &proto.LifecycleScanDirResponse{}
+	err = t.c.sendLifecycleTask(mp, proto.OpLifecycleScanDir, req, resp)
+	return
+}
+
+func (t *lifecycleTask) deleteInodes(inodes []uint64) (err error) {
+	groups, err := t.groupInodesByMetaPartition(inodes)
+	if err != nil {
+		return
+	}
+	for mp, group := range groups {
+		req := &proto.LifecycleDeleteInodesRequest{PartitionID: mp.PartitionID, Inodes: group}
+		if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleDeleteInodes, req, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (t *lifecycleTask) groupInodesByMetaPartition(inodes []uint64) (groups map[*MetaPartition][]uint64, err error) {
+	groups = make(map[*MetaPartition][]uint64)
+	for _, ino := range inodes {
+		var mp *MetaPartition
+		if mp, err = t.vol.metaPartitionByInode(ino); err != nil {
+			return
+		}
+		groups[mp] = append(groups[mp], ino)
+	}
+	return
+}
+
+// sendLifecycleTask sends the lifecycle request to the leader of the meta partition, and decodes the response if resp
+// is not nil.
+func (c *Cluster) sendLifecycleTask(mp *MetaPartition, opCode uint8, req, resp interface{}) (err error) {
+	mp.RLock()
+	mr, err := mp.getMetaReplicaLeader()
+	mp.RUnlock()
+	if err != nil {
+		return fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+	}
+	task := proto.NewAdminTask(opCode, mr.Addr, req)
+	resetMetaPartitionTaskID(task, mp.PartitionID)
+	packet, err := mr.metaNode.Sender.syncSendAdminTask(task)
+	if err != nil {
+		return fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+	}
+	if resp == nil {
+		return
+	}
+	if err = json.Unmarshal(packet.Data, resp); err != nil {
+		return fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+	}
+	return
+}
+
+func (m *Server) setVolLifecycle(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		body    []byte
+		rules   []*proto.LifecycleRule
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	rules = make([]*proto.LifecycleRule, 0)
+	if len(body) != 0 {
+		if err = json.Unmarshal(body, &rules); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+			return
+		}
+	}
+	if err = validateLifecycleRules(rules); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setVolLifecycleRules(name, authKey, rules); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	msg := fmt.Sprintf("set %v lifecycle rules of vol[%v] successfully", len(rules), name)
+	log.LogWarn(msg)
+	sendOkReply(w, r, newSuccessHTTPReply(msg))
+}
+
+func (m *Server) getVolLifecycleStatus(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		vol  *Vol
+		err  error
+	)
+	if name, err = parseVolName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	status := &proto.LifecycleStatus{
+		VolName: name,
+		Rules:   vol.getLifecycleRules(),
+		Status:  make([]*proto.LifecycleRuleStatus, 0),
+	}
+	vs := m.cluster.getVolLifecycleStatus(name)
+	for _, rule := range status.Rules {
+		st, ok := vs.get(rule.ID)
+		if !ok {
+			st = &proto.LifecycleRuleStatus{ID: rule.ID, State: proto.LifecycleRuleIdle}
+		}
+		if rule.Disabled {
+			st.State = proto.LifecycleRuleDisabled
+		} else if st.State == proto.LifecycleRuleDisabled {
+			st.State = proto.LifecycleRuleIdle
+		}
+		status.Status = append(status.Status, st)
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(status))
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// createColdDataPartition creates a cold data partition of the volume in its cold zone, which is read-only to the
+// clients and holds the extents copied by the lifecycle rules.
+func (c *Cluster) createColdDataPartition(vol *Vol) (dp *DataPartition, err error) {
+	vol.RLock()
+	coldZone := vol.coldZone
+	vol.RUnlock()
+	if coldZone == "" {
+		return nil, proto.ErrVolNoColdZone
+	}
+	// the data nodes are chosen in another zone if the zone is not found
+	if _, err = c.t.getZone(coldZone); err != nil {
+		return
+	}
+	return c.doCreateDataPartition(vol.Name, 1, vol.allocationEpoch(), coldZone)
+}
+
+// coldDataPartition returns a cold data partition of the volume with enough space, which is created if there is none.
+func (t *lifecycleTask) coldDataPartition() (dp *DataPartition, err error) {
+	if t.cold != nil && t.cold.isColdWritable() {
+		return t.cold, nil
+	}
+	for _, candidate := range t.vol.dataPartitions.coldPartitions() {
+		if candidate.isColdWritable() {
+			t.cold = candidate
+			return candidate, nil
+		}
+	}
+	if t.cold, err = t.c.createColdDataPartition(t.vol); err != nil {
+		return
+	}
+	return t.cold, nil
+}
+
+// isColdWritable returns whether the extents are copied to the cold data partition, which has all its replicas alive
+// and enough space.
+func (partition *DataPartition) isColdWritable() bool {
+	partition.RLock()
+	defer partition.RUnlock()
+	return partition.isCold && !partition.isFrozen && !partition.isPendingDelete && partition.canWrite() &&
+		len(partition.getLiveReplicasFromHosts(defaultDataPartitionTimeOutSec)) == int(partition.ReplicaNum)
+}
+
+// transition moves the files under the prefix of the rule which have not been modified since transitionBefore to the
+// cold tier.
+func (t *lifecycleTask) transition(transitionBefore int64) (err error) {
+	return t.walk(func(parentID uint64, files []*proto.LifecycleDentry) error {
+		return t.transitionFiles(files, transitionBefore)
+	})
+}
+
+// transitionFiles moves the files to the cold tier by copying their extents to the cold data partitions, and then
+// swapping the extent keys of the files to the copies.
+func (t *lifecycleTask) transitionFiles(files []*proto.LifecycleDentry, transitionBefore int64) (err error) {
+	if len(files) == 0 {
+		return
+	}
+	inodes := make([]uint64, 0, len(files))
+	for _, d := range files {
+		inodes = append(inodes, d.Inode)
+	}
+	groups, err := t.groupInodesByMetaPartition(inodes)
+	if err != nil {
+		return
+	}
+	for mp, group := range groups {
+		filterReq := &proto.LifecycleFilterExpiredRequest{PartitionID: mp.PartitionID, Inodes: group, ExpireBefore: transitionBefore}
+		filterResp := &proto.LifecycleFilterExpiredResponse{}
+		if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleFilterExpired, filterReq, filterResp); err != nil {
+			return
+		}
+		if len(filterResp.Inodes) == 0 {
+			continue
+		}
+		listReq := &proto.LifecycleListExtentsRequest{PartitionID: mp.PartitionID, Inodes: filterResp.Inodes}
+		listResp := &proto.LifecycleListExtentsResponse{}
+		if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleListExtents, listReq, listResp); err != nil {
+			return
+		}
+		for _, file := range listResp.Files {
+			var swapped bool
+			if swapped, err = t.transitionFile(mp, file); err != nil {
+				return
+			}
+			if swapped {
+				t.update(func(st *proto.LifecycleRuleStatus) {
+					st.TransitionedFiles++
+					st.TotalTransitioned++
+				})
+			}
+		}
+	}
+	return
+}
+
+// extentOfPartition identifies an extent of a data partition.
+type extentOfPartition struct {
+	partitionID uint64
+	extentID    uint64
+}
+
+// transitionFile copies the normal extents of the file which are not cold yet, and swaps the extent keys of the file
+// to the copies. The tiny extents shared by the small files are kept. The copies are deleted by the meta node if the
+// file is changed since its extent keys are listed, or if the copies fail.
+func (t *lifecycleTask) transitionFile(mp *MetaPartition, file *proto.LifecycleFileExtents) (swapped bool, err error) {
+	newExtents := make([]proto.ExtentKey, len(file.Extents))
+	copy(newExtents, file.Extents)
+	copies := make(map[extentOfPartition]extentOfPartition)
+	created := make([]proto.ExtentKey, 0)
+	for idx, ek := range file.Extents {
+		if storage.IsTinyExtent(ek.ExtentId) {
+			continue
+		}
+		source := extentOfPartition{partitionID: ek.PartitionId, extentID: ek.ExtentId}
+		target, ok := copies[source]
+		if !ok {
+			var dp *DataPartition
+			if dp, err = t.vol.getDataPartitionByID(ek.PartitionId); err != nil {
+				break
+			}
+			if dp.isCold {
+				continue
+			}
+			if target, err = t.copyToColdTier(dp, ek.ExtentId); target.extentID != 0 {
+				created = append(created, proto.ExtentKey{PartitionId: target.partitionID, ExtentId: target.extentID})
+			}
+			if err != nil {
+				break
+			}
+			copies[source] = target
+		}
+		newExtents[idx].PartitionId, newExtents[idx].ExtentId = target.partitionID, target.extentID
+	}
+	if err != nil {
+		if len(created) > 0 {
+			abortReq := &proto.LifecycleSwapExtentsRequest{PartitionID: mp.PartitionID, Inode: file.Inode, NewExtents: created}
+			if abortErr := t.c.sendLifecycleTask(mp, proto.OpLifecycleSwapExtents, abortReq, nil); abortErr != nil {
+				log.LogWarnf("action[transitionFile] vol[%v] inode[%v] copies%v are not deleted, err[%v]",
+					t.vol.Name, file.Inode, created, abortErr)
+			}
+		}
+		return false, fmt.Errorf("inode[%v] err[%v]", file.Inode, err)
+	}
+	if len(copies) == 0 {
+		return
+	}
+	req := &proto.LifecycleSwapExtentsRequest{
+		PartitionID: mp.PartitionID,
+		Inode:       file.Inode,
+		OldExtents:  file.Extents,
+		NewExtents:  newExtents,
+	}
+	resp := &proto.LifecycleSwapExtentsResponse{}
+	if err = t.c.sendLifecycleTask(mp, proto.OpLifecycleSwapExtents, req, resp); err != nil {
+		return
+	}
+	log.LogInfof("action[transitionFile] vol[%v] inode[%v] extents[%v] swapped[%v]", t.vol.Name, file.Inode,
+		len(copies), resp.Swapped)
+	return resp.Swapped, nil
+}
+
+// copyToColdTier copies the extent of the data partition to a cold data partition, and returns the copy, whose ID is
+// set once it is allocated even if the copy fails.
+func (t *lifecycleTask) copyToColdTier(dp *DataPartition, extentID uint64) (target extentOfPartition, err error) {
+	cold, err := t.coldDataPartition()
+	if err != nil {
+		return
+	}
+	t.update(func(st *proto.LifecycleRuleStatus) {
+		st.CurrentPath = fmt.Sprintf("extent %v_%v to cold data partition %v", dp.PartitionID, extentID, cold.PartitionID)
+	})
+	target.partitionID = cold.PartitionID
+	target.extentID, err = t.c.copyExtentToColdPartition(dp, cold, extentID, defaultLifecycleCopyTimeoutSec*time.Second)
+	return
+}
@@ -0,0 +1,480 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	maxMaintenancePlanSteps = 1000
+	maxMaintenancePlanLogs  = 1000
+	maintenancePlanNoStep   = -1
+)
+
+// maintenancePlan keeps a maintenance plan and its execution on the master leader.
+type maintenancePlan struct {
+	sync.RWMutex
+	plan    *proto.MaintenancePlan
+	running int32
+	waiting bool // whether the wait for the recovery has been logged, accessed by the executing goroutine only
+}
+
+func (p *maintenancePlan) copy() *proto.MaintenancePlan {
+	p.RLock()
+	defer p.RUnlock()
+	copied := *p.plan
+	copied.Steps = append([]*proto.MaintenanceStep(nil), p.plan.Steps...)
+	copied.Logs = append([]*proto.MaintenancePlanLog(nil), p.plan.Logs...)
+	return &copied
+}
+
+func (p *maintenancePlan) view() *proto.MaintenancePlanView {
+	p.RLock()
+	defer p.RUnlock()
+	return &proto.MaintenancePlanView{
+		Name:       p.plan.Name,
+		State:      p.plan.State,
+		Steps:      len(p.plan.Steps),
+		NextStep:   p.plan.NextStep,
+		CreateTime: p.plan.CreateTime,
+		UpdateTime: p.plan.UpdateTime,
+		LastError:  p.plan.LastError,
+	}
+}
+
+func appendMaintenancePlanLog(plan *proto.MaintenancePlan, step int, msg string) {
+	plan.Logs = append(plan.Logs, &proto.MaintenancePlanLog{Time: time.Now().Unix(), Step: step, Msg: msg})
+	if len(plan.Logs) > maxMaintenancePlanLogs {
+		plan.Logs = plan.Logs[len(plan.Logs)-maxMaintenancePlanLogs:]
+	}
+}
+
+func describeMaintenanceStep(step *proto.MaintenanceStep) string {
+	switch step.Type {
+	case proto.PlanStepDecommissionDisk:
+		return fmt.Sprintf("%v addr[%v] disk[%v]", step.Type, step.Addr, step.DiskPath)
+	case proto.PlanStepDecommissionDataPartition, proto.PlanStepDecommissionMetaPartition:
+		return fmt.Sprintf("%v addr[%v] partition[%v]", step.Type, step.Addr, step.PartitionID)
+	default:
+		return fmt.Sprintf("%v addr[%v]", step.Type, step.Addr)
+	}
+}
+
+// validateMaintenancePlan checks the steps of the plan against the current topology.
+func (c *Cluster) validateMaintenancePlan(plan *proto.MaintenancePlan) (err error) {
+	if !volNameRegexp.MatchString(plan.Name) {
+		return fmt.Errorf("maintenance plan name[%v] can only be number and letters", plan.Name)
+	}
+	if len(plan.Steps) == 0 || len(plan.Steps) > maxMaintenancePlanSteps {
+		return fmt.Errorf("the number of steps should be between 1 and %v", maxMaintenancePlanSteps)
+	}
+	for i, step := range plan.Steps {
+		if step == nil || step.Addr == "" {
+			return fmt.Errorf("step[%v] has no addr", i)
+		}
+		switch step.Type {
+		case proto.PlanStepDecommissionDataNode:
+			_, err = c.dataNode(step.Addr)
+		case proto.PlanStepDecommissionMetaNode:
+			_, err = c.metaNode(step.Addr)
+		case proto.PlanStepDecommissionDisk:
+			if step.DiskPath == "" {
+				return fmt.Errorf("step[%v] has no disk path", i)
+			}
+			_, err = c.dataNode(step.Addr)
+		case proto.PlanStepDecommissionDataPartition:
+			var dp *DataPartition
+			if dp, err = c.getDataPartitionByID(step.PartitionID); err == nil && !dp.hasHost(step.Addr) {
+				err = fmt.Errorf("data partition[%v] has no replica on [%v]", step.PartitionID, step.Addr)
+			}
+		case proto.PlanStepDecommissionMetaPartition:
+			var mp *MetaPartition
+			if mp, err = c.getMetaPartitionByID(step.PartitionID); err == nil {
+				mp.RLock()
+				if !contains(mp.Hosts, step.Addr) {
+					err = fmt.Errorf("meta partition[%v] has no replica on [%v]", step.PartitionID, step.Addr)
+				}
+				mp.RUnlock()
+			}
+		default:
+			return fmt.Errorf("step[%v] has unknown type[%v]", i, step.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("step[%v] %v: %v", i, describeMaintenanceStep(step), err)
+		}
+	}
+	return
+}
+
+func (c *Cluster) getMaintenancePlan(name string) (p *maintenancePlan, err error) {
+	value, ok := c.maintenancePlans.Load(name)
+	if !ok {
+		return nil, proto.ErrMaintenancePlanNotExists
+	}
+	return value.(*maintenancePlan), nil
+}
+
+func (c *Cluster) listMaintenancePlans() (views []*proto.MaintenancePlanView) {
+	views = make([]*proto.MaintenancePlanView, 0)
+	c.maintenancePlans.Range(func(key, value interface{}) bool {
+		views = append(views, value.(*maintenancePlan).view())
+		return true
+	})
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].CreateTime < views[j].CreateTime
+	})
+	return
+}
+
+// submitMaintenancePlan persists the plan in the running state, and the plan is executed by the scheduler.
+func (c *Cluster) submitMaintenancePlan(plan *proto.MaintenancePlan) (err error) {
+	now := time.Now().Unix()
+	plan.State = proto.PlanRunning
+	plan.NextStep = 0
+	plan.CreateTime = now
+	plan.UpdateTime = now
+	plan.LastError = ""
+	plan.Logs = nil
+	appendMaintenancePlanLog(plan, maintenancePlanNoStep, fmt.Sprintf("submitted with %v steps", len(plan.Steps)))
+	p := &maintenancePlan{plan: plan}
+	if _, loaded := c.maintenancePlans.LoadOrStore(plan.Name, p); loaded {
+		return proto.ErrDuplicateMaintenancePlan
+	}
+	if err = c.syncPutMaintenancePlan(plan); err != nil {
+		c.maintenancePlans.Delete(plan.Name)
+		log.LogErrorf("action[submitMaintenancePlan] plan[%v] err[%v]", plan.Name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	Warn(c.Name, fmt.Sprintf("action[submitMaintenancePlan] clusterID[%v] plan[%v] is submitted with [%v] steps",
+		c.Name, plan.Name, len(plan.Steps)))
+	return
+}
+
+// updateMaintenancePlan applies the change to the plan and persists it, the change is rolled back if it fails.
+func (c *Cluster) updateMaintenancePlan(p *maintenancePlan, fn func(plan *proto.MaintenancePlan) error) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	updated := *p.plan
+	updated.Logs = append([]*proto.MaintenancePlanLog(nil), p.plan.Logs...)
+	if err = fn(&updated); err != nil {
+		return
+	}
+	updated.UpdateTime = time.Now().Unix()
+	if err = c.syncPutMaintenancePlan(&updated); err != nil {
+		log.LogErrorf("action[updateMaintenancePlan] plan[%v] err[%v]", updated.Name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	p.plan = &updated
+	return
+}
+
+// setMaintenancePlanState pauses, resumes or aborts the plan. The step being executed is not interrupted,
+// and the change takes effect before the next step. Resuming a failed plan retries the failed step.
+func (c *Cluster) setMaintenancePlanState(name, state string) (err error) {
+	p, err := c.getMaintenancePlan(name)
+	if err != nil {
+		return
+	}
+	err = c.updateMaintenancePlan(p, func(plan *proto.MaintenancePlan) error {
+		switch state {
+		case proto.PlanPaused:
+			if plan.State != proto.PlanRunning {
+				return proto.ErrMaintenancePlanState
+			}
+		case proto.PlanRunning:
+			if plan.State != proto.PlanPaused && plan.State != proto.PlanFailed {
+				return proto.ErrMaintenancePlanState
+			}
+			plan.LastError = ""
+		case proto.PlanAborted:
+			if plan.State == proto.PlanAborted || plan.State == proto.PlanSucceeded {
+				return proto.ErrMaintenancePlanState
+			}
+		}
+		appendMaintenancePlanLog(plan, maintenancePlanNoStep, fmt.Sprintf("%v is changed to %v", plan.State, state))
+		plan.State = state
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	log.LogWarnf("action[setMaintenancePlanState] plan[%v] state[%v]", name, state)
+	return
+}
+
+func (c *Cluster) scheduleToRunMaintenancePlans() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.runMaintenancePlans()
+			}
+			time.Sleep(time.Second * defaultIntervalToCheckMaintenancePlan)
+		}
+	}()
+}
+
+func (c *Cluster) runMaintenancePlans() {
+	c.maintenancePlans.Range(func(key, value interface{}) bool {
+		p := value.(*maintenancePlan)
+		p.RLock()
+		state := p.plan.State
+		p.RUnlock()
+		if state != proto.PlanRunning || !atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+			return true
+		}
+		go func() {
+			defer atomic.StoreInt32(&p.running, 0)
+			for c.partition != nil && c.partition.IsRaftLeader() && c.advanceMaintenancePlan(p) {
+				time.Sleep(time.Second * defaultIntervalToCheckMaintenancePlan)
+			}
+		}()
+		return true
+	})
+}
+
+// countRecoveringPartitions returns the number of the partitions whose replicas taken offline are being recovered.
+func (c *Cluster) countRecoveringPartitions() (dataPartitions, metaPartitions int) {
+	c.BadDataPartitionIds.Range(func(key, value interface{}) bool {
+		dataPartitions += len(value.([]uint64))
+		return true
+	})
+	c.BadMetaPartitionIds.Range(func(key, value interface{}) bool {
+		metaPartitions += len(value.([]uint64))
+		return true
+	})
+	return
+}
+
+// advanceMaintenancePlan executes the next step of the running plan once the replicas taken offline are recovered,
+// and returns false if the plan should not be advanced any more.
+func (c *Cluster) advanceMaintenancePlan(p *maintenancePlan) (more bool) {
+	p.RLock()
+	name, state, next, waiting := p.plan.Name, p.plan.State, p.plan.NextStep, p.waiting
+	var step *proto.MaintenanceStep
+	if next < len(p.plan.Steps) {
+		step = p.plan.Steps[next]
+	}
+	p.RUnlock()
+	if state != proto.PlanRunning {
+		return false
+	}
+
+	// the health gate, the plan also waits for the recovery after the last step before it succeeds
+	if dps, mps := c.countRecoveringPartitions(); dps+mps != 0 {
+		if !waiting {
+			err := c.updateMaintenancePlan(p, func(plan *proto.MaintenancePlan) error {
+				appendMaintenancePlanLog(plan, next, fmt.Sprintf("waiting for the recovery of [%v] data partitions and [%v] meta partitions", dps, mps))
+				return nil
+			})
+			if err != nil {
+				return false
+			}
+			p.waiting = true
+		}
+		return true
+	}
+	p.waiting = false
+
+	if step == nil {
+		if err := c.updateMaintenancePlan(p, func(plan *proto.MaintenancePlan) error {
+			appendMaintenancePlanLog(plan, maintenancePlanNoStep, "all steps are finished")
+			plan.State = proto.PlanSucceeded
+			return nil
+		}); err != nil {
+			return false
+		}
+		Warn(c.Name, fmt.Sprintf("action[advanceMaintenancePlan] clusterID[%v] plan[%v] succeeded", c.Name, name))
+		return false
+	}
+
+	desc := describeMaintenanceStep(step)
+	if err := c.updateMaintenancePlan(p, func(plan *proto.MaintenancePlan) error {
+		appendMaintenancePlanLog(plan, next, fmt.Sprintf("%v started", desc))
+		return nil
+	}); err != nil {
+		return false
+	}
+	log.LogWarnf("action[advanceMaintenancePlan] plan[%v] step[%v] %v started", name, next, desc)
+	stepErr := c.runMaintenanceStep(step)
+	err := c.updateMaintenancePlan(p, func(plan *proto.MaintenancePlan) error {
+		if stepErr != nil {
+			appendMaintenancePlanLog(plan, next, fmt.Sprintf("%v failed: %v", desc, stepErr))
+			plan.LastError = fmt.Sprintf("step[%v] %v: %v", next, desc, stepErr)
+			// the plan paused or aborted during the step keeps its state
+			if plan.State == proto.PlanRunning {
+				plan.State = proto.PlanFailed
+			}
+			return nil
+		}
+		appendMaintenancePlanLog(plan, next, fmt.Sprintf("%v finished", desc))
+		plan.NextStep = next + 1
+		state = plan.State
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	if stepErr != nil {
+		Warn(c.Name, fmt.Sprintf("action[advanceMaintenancePlan] clusterID[%v] plan[%v] step[%v] %v failed, err[%v]",
+			c.Name, name, next, desc, stepErr))
+		return false
+	}
+	return state == proto.PlanRunning
+}
+
+// runMaintenanceStep takes the replicas offline like the decommission APIs. The node which does not exist is taken
+// as decommissioned, since the step may be executed again after the leader changes.
+func (c *Cluster) runMaintenanceStep(step *proto.MaintenanceStep) (err error) {
+	switch step.Type {
+	case proto.PlanStepDecommissionDataNode:
+		var dataNode *DataNode
+		if dataNode, err = c.dataNode(step.Addr); err != nil {
+			return nil
+		}
+		return c.decommissionDataNode(dataNode)
+	case proto.PlanStepDecommissionDisk:
+		var dataNode *DataNode
+		if dataNode, err = c.dataNode(step.Addr); err != nil {
+			return nil
+		}
+		badPartitions := dataNode.badPartitions(step.DiskPath, c)
+		if len(badPartitions) == 0 {
+			return
+		}
+		return c.decommissionDisk(dataNode, step.DiskPath, badPartitions)
+	case proto.PlanStepDecommissionMetaNode:
+		var metaNode *MetaNode
+		if metaNode, err = c.metaNode(step.Addr); err != nil {
+			return nil
+		}
+		return c.decommissionMetaNode(metaNode)
+	case proto.PlanStepDecommissionDataPartition:
+		var dp *DataPartition
+		if dp, err = c.getDataPartitionByID(step.PartitionID); err != nil {
+			return
+		}
+		if !dp.hasHost(step.Addr) {
+			return
+		}
+		return c.decommissionDataPartition(step.Addr, dp, handleDataPartitionOfflineErr)
+	case proto.PlanStepDecommissionMetaPartition:
+		var mp *MetaPartition
+		if mp, err = c.getMetaPartitionByID(step.PartitionID); err != nil {
+			return
+		}
+		mp.RLock()
+		isHost := contains(mp.Hosts, step.Addr)
+		mp.RUnlock()
+		if !isHost {
+			return
+		}
+		return c.decommissionMetaPartition(step.Addr, mp)
+	default:
+		return fmt.Errorf("unknown step type[%v]", step.Type)
+	}
+}
+
+func (c *Cluster) clearMaintenancePlans() {
+	c.maintenancePlans.Range(func(key, value interface{}) bool {
+		c.maintenancePlans.Delete(key)
+		return true
+	})
+}
+
+func (m *Server) submitMaintenancePlan(w http.ResponseWriter, r *http.Request) {
+	var (
+		body []byte
+		plan *proto.MaintenancePlan
+		err  error
+	)
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	plan = &proto.MaintenancePlan{}
+	if err = json.Unmarshal(body, plan); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.validateMaintenancePlan(plan); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.submitMaintenancePlan(plan); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("submit maintenance plan[%v] with %v steps successfully", plan.Name, len(plan.Steps))))
+}
+
+func (m *Server) getMaintenancePlan(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		p    *maintenancePlan
+		err  error
+	)
+	if name, err = parseVolName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if p, err = m.cluster.getMaintenancePlan(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(p.copy()))
+}
+
+func (m *Server) listMaintenancePlans(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.listMaintenancePlans()))
+}
+
+func (m *Server) pauseMaintenancePlan(w http.ResponseWriter, r *http.Request) {
+	m.setMaintenancePlanState(w, r, proto.PlanPaused)
+}
+
+func (m *Server) resumeMaintenancePlan(w http.ResponseWriter, r *http.Request) {
+	m.setMaintenancePlanState(w, r, proto.PlanRunning)
+}
+
+func (m *Server) abortMaintenancePlan(w http.ResponseWriter, r *http.Request) {
+	m.setMaintenancePlanState(w, r, proto.PlanAborted)
+}
+
+func (m *Server) setMaintenancePlanState(w http.ResponseWriter, r *http.Request, state string) {
+	var (
+		name string
+		err  error
+	)
+	if name, err = parseVolName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setMaintenancePlanState(name, state); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("maintenance plan[%v] is %v", name, state)))
+}
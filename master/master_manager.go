@@ -42,8 +42,10 @@ func (m *Server) handleLeaderChange(leader uint64) {
 		Warn(m.clusterName, fmt.Sprintf("clusterID[%v] leader is changed to %v",
 			m.clusterName, m.leaderInfo.addr))
 		if oldLeaderAddr != m.leaderInfo.addr {
+			m.cluster.events.reset()
 			m.loadMetadata()
 			m.metaReady = true
+			go m.cluster.upgradeSchemaVersion()
 		}
 		m.cluster.checkDataNodeHeartbeat()
 		m.cluster.checkMetaNodeHeartbeat()
@@ -93,6 +95,9 @@ func (m *Server) loadMetadata() {
 	m.restoreIDAlloc()
 	m.cluster.fsm.restore()
 	var err error
+	if err = m.cluster.loadSchemaVersion(); err != nil {
+		panic(err)
+	}
 	if err = m.cluster.loadClusterValue(); err != nil {
 		panic(err)
 	}
@@ -122,6 +127,15 @@ func (m *Server) loadMetadata() {
 	if err = m.cluster.loadDataPartitions(); err != nil {
 		panic(err)
 	}
+	if err = m.cluster.loadMaintenancePlans(); err != nil {
+		panic(err)
+	}
+	if err = m.cluster.loadVolUsageRecords(); err != nil {
+		panic(err)
+	}
+	if err = m.cluster.loadTenants(); err != nil {
+		panic(err)
+	}
 	log.LogInfo("action[loadMetadata] end")
 
 	log.LogInfo("action[loadUserInfo] begin")
@@ -149,6 +163,10 @@ func (m *Server) clearMetadata() {
 	m.cluster.clearDataNodes()
 	m.cluster.clearMetaNodes()
 	m.cluster.clearVols()
+	m.cluster.clearMaintenancePlans()
+	m.cluster.clearTenants()
+	m.cluster.volUsage.clearRecords()
+	m.cluster.statsTree.clear()
 	m.user.clearUserStore()
 	m.user.clearAKStore()
 	m.user.clearVolUsers()
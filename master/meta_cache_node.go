@@ -0,0 +1,82 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A meta cache node is expired if it has not registered again for the timeout.
+const defaultMetaCacheNodeTimeout = 3 * proto.MetaCacheNodeHeartbeatInterval
+
+// MetaCacheNode is a meta cache node proxying the metadata requests of the volumes with the meta cache enabled.
+// The meta cache nodes hold no state of the cluster, so they are kept in the memory of the leader only, and
+// register to the new leader again within a heartbeat interval.
+type MetaCacheNode struct {
+	Addr       string
+	ReportTime time.Time
+}
+
+func (c *Cluster) addMetaCacheNode(addr string) {
+	node := &MetaCacheNode{Addr: addr, ReportTime: time.Now()}
+	if _, loaded := c.metaCacheNodes.LoadOrStore(addr, node); loaded {
+		c.metaCacheNodes.Store(addr, node)
+		return
+	}
+	log.LogInfof("action[addMetaCacheNode] add meta cache node[%v]", addr)
+}
+
+// aliveMetaCacheNodes returns the sorted addresses of the unexpired meta cache nodes, so that the clients route
+// the requests of a meta partition to the same node, and removes the expired ones.
+func (c *Cluster) aliveMetaCacheNodes() (addrs []string) {
+	addrs = make([]string, 0)
+	c.metaCacheNodes.Range(func(key, value interface{}) bool {
+		node := value.(*MetaCacheNode)
+		if time.Since(node.ReportTime) > defaultMetaCacheNodeTimeout {
+			c.metaCacheNodes.Delete(key)
+			log.LogWarnf("action[aliveMetaCacheNodes] meta cache node[%v] expired, last report at %v",
+				node.Addr, node.ReportTime.Format(proto.TimeFormat))
+			return true
+		}
+		addrs = append(addrs, node.Addr)
+		return true
+	})
+	sort.Strings(addrs)
+	return
+}
+
+func (m *Server) addMetaCacheNode(w http.ResponseWriter, r *http.Request) {
+	nodeAddr, err := parseAndExtractNodeAddr(r)
+	if err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if _, _, err = net.SplitHostPort(nodeAddr); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	m.cluster.addMetaCacheNode(nodeAddr)
+	sendOkReply(w, r, newSuccessHTTPReply(nodeAddr))
+}
+
+func (m *Server) getMetaCacheNodes(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.aliveMetaCacheNodes()))
+}
@@ -43,6 +43,9 @@ type MetaNode struct {
 	sync.RWMutex              `graphql:"-"`
 	ToBeOffline               bool
 	PersistenceMetaPartitions []uint64
+	BuildInfo                 proto.BuildInfo
+	ReplicaIP                 string // the IP of the interface dedicated to the replication, reported by heartbeats
+	InstanceID                string // generated by the meta node at the first start and stored in its metadataDir
 }
 
 func newMetaNode(addr, zoneName, clusterID string) (node *MetaNode) {
@@ -124,6 +127,8 @@ func (metaNode *MetaNode) updateMetric(resp *proto.MetaNodeHeartbeatResponse, th
 	metaNode.MaxMemAvailWeight = resp.Total - resp.Used
 	metaNode.ZoneName = resp.ZoneName
 	metaNode.Threshold = threshold
+	metaNode.BuildInfo = resp.BuildInfo
+	metaNode.ReplicaIP = resp.ReplicaIP
 }
 
 func (metaNode *MetaNode) reachesThreshold() bool {
@@ -133,19 +138,20 @@ func (metaNode *MetaNode) reachesThreshold() bool {
 	return float32(float64(metaNode.Used)/float64(metaNode.Total)) > metaNode.Threshold
 }
 
-func (metaNode *MetaNode) createHeartbeatTask(masterAddr string) (task *proto.AdminTask) {
+func (metaNode *MetaNode) createHeartbeatTask(masterAddr string, tokenRequiredVols []string) (task *proto.AdminTask) {
 	request := &proto.HeartBeatRequest{
-		CurrTime:   time.Now().Unix(),
-		MasterAddr: masterAddr,
+		CurrTime:          time.Now().Unix(),
+		MasterAddr:        masterAddr,
+		TokenRequiredVols: tokenRequiredVols,
 	}
 	task = proto.NewAdminTask(proto.OpMetaNodeHeartbeat, metaNode.Addr, request)
 	return
 }
 
-func (metaNode *MetaNode) checkHeartbeat() {
+func (metaNode *MetaNode) checkHeartbeat(timeout time.Duration) {
 	metaNode.Lock()
 	defer metaNode.Unlock()
-	if time.Since(metaNode.ReportTime) > time.Second*time.Duration(defaultNodeTimeOutSec) {
+	if time.Since(metaNode.ReportTime) > timeout {
 		metaNode.IsActive = false
 	}
 }
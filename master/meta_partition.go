@@ -35,10 +35,20 @@ type MetaReplica struct {
 	MaxInodeID  uint64
 	InodeCount  uint64
 	DentryCount uint64
+	DedupStat   proto.DedupStat
+	Reserved    uint64
+	ApplyStall  bool  // the proposals wait on the replica without any entry applied
+	ApplyQueue  int64 // the proposals waiting to be applied on the replica
 	ReportTime  int64
 	Status      int8 // unavailable, readOnly, readWrite
 	IsLeader    bool
+	IsFrozen    bool
+	IsDegraded  bool
 	metaNode    *MetaNode
+
+	DeleteBacklog  proto.DeleteBacklog
+	backlogGrowths int  // the reports in a row in which the deletion backlog grows
+	backlogStuck   bool // the deletion backlog looks stuck, which is alerted once
 }
 
 // MetaPartition defines the structure of a meta partition
@@ -49,6 +59,8 @@ type MetaPartition struct {
 	MaxInodeID    uint64
 	InodeCount    uint64
 	DentryCount   uint64
+	DedupStat     proto.DedupStat
+	Reserved      uint64 // the space preallocated to the inodes which is not written yet
 	Replicas      []*MetaReplica
 	ReplicaNum    uint8
 	Status        int8
@@ -60,6 +72,7 @@ type MetaPartition struct {
 	OfflinePeerID uint64
 	MissNodes     map[string]int64
 	LoadResponse  []*proto.MetaPartitionLoadResponse
+	isDegraded    bool // the replicas serve the possibly stale reads without the leader once the quorum is lost
 	offlineMutex  sync.RWMutex
 	sync.RWMutex
 }
@@ -328,7 +341,9 @@ func (mp *MetaPartition) missingReplicaAddrs() (lackAddrs []string) {
 	return
 }
 
-func (mp *MetaPartition) updateMetaPartition(mgr *proto.MetaPartitionReport, metaNode *MetaNode) {
+// updateMetaPartition updates the replica on the meta node by its report, and returns whether the replica starts
+// stalling on the apply, and whether its deletion backlog starts to look stuck, by the report.
+func (mp *MetaPartition) updateMetaPartition(mgr *proto.MetaPartitionReport, metaNode *MetaNode) (applyStalls, backlogStuck bool) {
 
 	if !contains(mp.Hosts, metaNode.Addr) {
 		return
@@ -340,11 +355,16 @@ func (mp *MetaPartition) updateMetaPartition(mgr *proto.MetaPartitionReport, met
 		mr = newMetaReplica(mp.Start, mp.End, metaNode)
 		mp.addReplica(mr)
 	}
+	applyStalls = mgr.ApplyStall && !mr.ApplyStall
+	backlogStuck = mr.updateDeleteBacklog(mgr.DeleteBacklog) && mgr.IsLeader
 	mr.updateMetric(mgr)
 	mp.setMaxInodeID()
 	mp.setInodeCount()
 	mp.setDentryCount()
+	mp.setDedupStat()
+	mp.setReserved()
 	mp.removeMissingReplica(metaNode.Addr)
+	return
 }
 
 func (mp *MetaPartition) canBeOffline(nodeAddr string, replicaNum int) (err error) {
@@ -379,6 +399,23 @@ func (mp *MetaPartition) getLiveReplicasAddr(liveReplicas []*MetaReplica) (addrs
 	}
 	return
 }
+
+// applyStallTransferTarget returns the live replica which does not stall on the apply to take over the leadership
+// from the stalled replica on the given address.
+func (mp *MetaPartition) applyStallTransferTarget(stalledAddr string) (addr string) {
+	mp.RLock()
+	defer mp.RUnlock()
+	for _, host := range mp.Hosts {
+		if host == stalledAddr {
+			continue
+		}
+		if mr, err := mp.getMetaReplica(host); err == nil && mr.isActive() && !mr.ApplyStall {
+			return host
+		}
+	}
+	return
+}
+
 func (mp *MetaPartition) getLiveReplicas() (liveReplicas []*MetaReplica) {
 	liveReplicas = make([]*MetaReplica, 0)
 	for _, mr := range mp.Replicas {
@@ -462,7 +499,7 @@ func (mp *MetaPartition) reportMissingReplicas(clusterID, leaderAddr string, sec
 		if mp.isMissingReplica(addr) && mp.shouldReportMissingReplica(addr, interval) {
 			msg := fmt.Sprintf("action[reportMissingReplicas],clusterID[%v] volName[%v] partition:%v  on Node:%v  "+
 				"miss time  > %v ",
-				clusterID, mp.volName, mp.PartitionID, addr, defaultMetaPartitionTimeOutSec)
+				clusterID, mp.volName, mp.PartitionID, addr, seconds)
 			Warn(clusterID, msg)
 			msg = fmt.Sprintf("decommissionMetaPartitionURL is http://%v/dataPartition/decommission?id=%v&addr=%v", leaderAddr, mp.PartitionID, addr)
 			Warn(clusterID, msg)
@@ -489,15 +526,17 @@ func (mp *MetaPartition) replicaCreationTasks(clusterID, volName string) (tasks
 	return
 }
 
-func (mp *MetaPartition) buildNewMetaPartitionTasks(specifyAddrs []string, peers []proto.Peer, volName string) (tasks []*proto.AdminTask) {
+func (mp *MetaPartition) buildNewMetaPartitionTasks(specifyAddrs []string, peers []proto.Peer, volName string, caseInsensitive bool, shadowVol string) (tasks []*proto.AdminTask) {
 	tasks = make([]*proto.AdminTask, 0)
 	hosts := make([]string, 0)
 	req := &proto.CreateMetaPartitionRequest{
-		Start:       mp.Start,
-		End:         mp.End,
-		PartitionID: mp.PartitionID,
-		Members:     peers,
-		VolName:     volName,
+		Start:           mp.Start,
+		End:             mp.End,
+		PartitionID:     mp.PartitionID,
+		Members:         peers,
+		VolName:         volName,
+		CaseInsensitive: caseInsensitive,
+		ShadowVol:       shadowVol,
 	}
 	if specifyAddrs == nil {
 		hosts = mp.Hosts
@@ -530,13 +569,15 @@ func (mp *MetaPartition) createTaskToTryToChangeLeader(addr string) (task *proto
 	return
 }
 
-func (mp *MetaPartition) createTaskToCreateReplica(host string) (t *proto.AdminTask, err error) {
+func (mp *MetaPartition) createTaskToCreateReplica(host string, caseInsensitive bool, shadowVol string) (t *proto.AdminTask, err error) {
 	req := &proto.CreateMetaPartitionRequest{
-		Start:       mp.Start,
-		End:         mp.End,
-		PartitionID: mp.PartitionID,
-		Members:     mp.Peers,
-		VolName:     mp.volName,
+		Start:           mp.Start,
+		End:             mp.End,
+		PartitionID:     mp.PartitionID,
+		Members:         mp.Peers,
+		VolName:         mp.volName,
+		CaseInsensitive: caseInsensitive,
+		ShadowVol:       shadowVol,
 	}
 	t = proto.NewAdminTask(proto.OpCreateMetaPartition, host, req)
 	resetMetaPartitionTaskID(t, mp.PartitionID)
@@ -605,12 +646,12 @@ func (mr *MetaReplica) createTaskToLoadMetaPartition(partitionID uint64) (t *pro
 	return
 }
 func (mr *MetaReplica) isMissing() (miss bool) {
-	return time.Now().Unix()-mr.ReportTime > defaultMetaPartitionTimeOutSec
+	return time.Now().Unix()-mr.ReportTime > gConfig.mpTimeOutSec()
 }
 
 func (mr *MetaReplica) isActive() (active bool) {
 	return mr.metaNode.IsActive && mr.Status != proto.Unavailable &&
-		time.Now().Unix()-mr.ReportTime < defaultMetaPartitionTimeOutSec
+		time.Now().Unix()-mr.ReportTime < gConfig.mpTimeOutSec()
 }
 
 func (mr *MetaReplica) setLastReportTime() {
@@ -623,9 +664,32 @@ func (mr *MetaReplica) updateMetric(mgr *proto.MetaPartitionReport) {
 	mr.MaxInodeID = mgr.MaxInodeID
 	mr.InodeCount = mgr.InodeCnt
 	mr.DentryCount = mgr.DentryCnt
+	mr.DedupStat = mgr.DedupStat
+	mr.Reserved = mgr.Reserved
+	mr.ApplyStall = mgr.ApplyStall
+	mr.ApplyQueue = mgr.ApplyQueue
+	mr.IsFrozen = mgr.IsFrozen
+	mr.IsDegraded = mgr.IsDegraded
 	mr.setLastReportTime()
 }
 
+// updateDeleteBacklog records the deletion backlog reported by the replica, and returns whether the backlog starts to
+// look stuck by the report, i.e. it has grown in defaultDeleteBacklogGrowthReports reports in a row, or an inode has
+// waited longer than defaultDeleteBacklogStuckSec to be freed.
+func (mr *MetaReplica) updateDeleteBacklog(backlog proto.DeleteBacklog) (stuck bool) {
+	old := mr.DeleteBacklog
+	if backlog.PendingInodes+backlog.PendingExtents > old.PendingInodes+old.PendingExtents {
+		mr.backlogGrowths++
+	} else {
+		mr.backlogGrowths = 0
+	}
+	mr.DeleteBacklog = backlog
+	isStuck := mr.backlogGrowths >= defaultDeleteBacklogGrowthReports || backlog.OldestPendingSec >= defaultDeleteBacklogStuckSec
+	stuck = isStuck && !mr.backlogStuck
+	mr.backlogStuck = isStuck
+	return
+}
+
 func (mp *MetaPartition) afterCreation(nodeAddr string, c *Cluster) (err error) {
 	metaNode, err := c.metaNode(nodeAddr)
 	if err != nil {
@@ -700,6 +764,32 @@ func (mp *MetaPartition) setDentryCount() {
 	mp.DentryCount = dentryCount
 }
 
+// setDedupStat takes the dedup statistics of the replica which has applied the most blocks.
+func (mp *MetaPartition) setDedupStat() {
+	var stat proto.DedupStat
+	for _, r := range mp.Replicas {
+		if r.DedupStat.LogicalBytes > stat.LogicalBytes {
+			stat = r.DedupStat
+		}
+	}
+	mp.DedupStat = stat
+}
+
+// setReserved takes the reserved space reported by the leader, or the largest one if the leader is unknown.
+func (mp *MetaPartition) setReserved() {
+	var reserved uint64
+	for _, r := range mp.Replicas {
+		if r.IsLeader {
+			reserved = r.Reserved
+			break
+		}
+		if r.Reserved > reserved {
+			reserved = r.Reserved
+		}
+	}
+	mp.Reserved = reserved
+}
+
 func (mp *MetaPartition) getAllNodeSets() (nodeSets []uint64) {
 	mp.RLock()
 	defer mp.RUnlock()
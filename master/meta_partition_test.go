@@ -3,6 +3,7 @@ package master
 import (
 	"fmt"
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
 	"testing"
 	"time"
 )
@@ -106,3 +107,77 @@ func decommissionMetaPartition(vol *Vol, id uint64, t *testing.T) {
 		return
 	}
 }
+
+func TestMetaPartitionReserved(t *testing.T) {
+	vol := newVol(1000, "reservedVol", "cfs", "", util.DefaultDataPartitionSize, 10, 3, 3, false, false, false, false, time.Now().Unix(), "")
+	mp := newMetaPartition(1000, 1, defaultMaxMetaPartitionInodeID, 3, vol.Name, vol.ID)
+	follower := newMetaReplica(mp.Start, mp.End, &MetaNode{Addr: "127.0.0.1:1"})
+	leader := newMetaReplica(mp.Start, mp.End, &MetaNode{Addr: "127.0.0.1:2"})
+	mp.addReplica(follower)
+	mp.addReplica(leader)
+	follower.updateMetric(&proto.MetaPartitionReport{Reserved: 8192})
+	leader.updateMetric(&proto.MetaPartitionReport{Reserved: 4096, IsLeader: true})
+	mp.setReserved()
+	if mp.Reserved != 4096 {
+		t.Fatalf("reserved space should be taken from the leader, expect[4096], real[%v]", mp.Reserved)
+	}
+	vol.addMetaPartition(mp)
+	if stat := volStat(vol); stat.ReservedSize != 4096 {
+		t.Fatalf("expect reserved size[4096], real[%v]", stat.ReservedSize)
+	}
+}
+
+func TestMetaPartitionApplyStall(t *testing.T) {
+	mp := newMetaPartition(1001, 1, defaultMaxMetaPartitionInodeID, 3, "stallVol", 1001)
+	nodes := []*MetaNode{{Addr: "127.0.0.1:1", IsActive: true}, {Addr: "127.0.0.1:2", IsActive: true}, {Addr: "127.0.0.1:3", IsActive: true}}
+	for _, node := range nodes {
+		mp.Hosts = append(mp.Hosts, node.Addr)
+	}
+	report := func(node *MetaNode, stall bool) bool {
+		applyStalls, _ := mp.updateMetaPartition(&proto.MetaPartitionReport{Status: proto.ReadWrite, ApplyStall: stall, ApplyQueue: 5}, node)
+		return applyStalls
+	}
+	if !report(nodes[0], true) {
+		t.Fatalf("the stall should be reported")
+	}
+	if report(nodes[0], true) {
+		t.Fatalf("the stall should be reported once")
+	}
+	report(nodes[1], true)
+	report(nodes[2], false)
+	if target := mp.applyStallTransferTarget(nodes[0].Addr); target != nodes[2].Addr {
+		t.Fatalf("expect target[%v], real[%v]", nodes[2].Addr, target)
+	}
+	nodes[2].IsActive = false
+	if target := mp.applyStallTransferTarget(nodes[0].Addr); target != "" {
+		t.Fatalf("expect no target, real[%v]", target)
+	}
+}
+
+func TestMetaPartitionDeleteBacklog(t *testing.T) {
+	mp := newMetaPartition(1002, 1, defaultMaxMetaPartitionInodeID, 3, "backlogVol", 1002)
+	node := &MetaNode{Addr: "127.0.0.1:1", IsActive: true}
+	mp.Hosts = append(mp.Hosts, node.Addr)
+	report := func(inodes uint64, oldest int64) bool {
+		_, backlogStuck := mp.updateMetaPartition(&proto.MetaPartitionReport{Status: proto.ReadWrite, IsLeader: true,
+			DeleteBacklog: proto.DeleteBacklog{PendingInodes: inodes, OldestPendingSec: oldest}}, node)
+		return backlogStuck
+	}
+	for i := 1; i < defaultDeleteBacklogGrowthReports; i++ {
+		if report(uint64(i), 60) {
+			t.Fatalf("the backlog grown in %v reports should not be alerted", i)
+		}
+	}
+	if !report(defaultDeleteBacklogGrowthReports, 60) {
+		t.Fatalf("the backlog grown in %v reports should be alerted", defaultDeleteBacklogGrowthReports)
+	}
+	if report(defaultDeleteBacklogGrowthReports+1, 60) {
+		t.Fatalf("the stuck backlog should be alerted once")
+	}
+	if report(1, 60) {
+		t.Fatalf("the shrunk backlog should not be alerted")
+	}
+	if !report(1, defaultDeleteBacklogStuckSec) {
+		t.Fatalf("the backlog with an inode pending for %vs should be alerted", defaultDeleteBacklogStuckSec)
+	}
+}
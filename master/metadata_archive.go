@@ -0,0 +1,290 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	metadataArchiveFormat  = "chubaofs-master-metadata"
+	metadataArchiveVersion = 1
+	metadataImportBatch    = 1024 // the records written into the store at a time by the import
+)
+
+// archivedAcronyms are the kinds of the records kept in the archive, i.e. all the kinds persisted by the master.
+var archivedAcronyms = map[string]bool{
+	metaNodeAcronym:      true,
+	dataNodeAcronym:      true,
+	dataPartitionAcronym: true,
+	metaPartitionAcronym: true,
+	volAcronym:           true,
+	clusterAcronym:       true,
+	nodeSetAcronym:       true,
+	tokenAcronym:         true,
+	planAcronym:          true,
+	volUsageAcronym:      true,
+	tenantAcronym:        true,
+	akAcronym:            true,
+	userAcronym:          true,
+	volUserAcronym:       true,
+}
+
+// metadataArchiveHeader describes the archive, which is the first line of it.
+type metadataArchiveHeader struct {
+	Format        string `json:"format"`
+	Version       int    `json:"version"`
+	Cluster       string `json:"cluster"`
+	SchemaVersion int    `json:"schemaVersion"` // the schema version of the master which exported the archive
+	CreateTime    int64  `json:"createTime"`
+}
+
+// metadataArchiveRecord is a key-value pair of the store, with the kind of the key.
+type metadataArchiveRecord struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// metadataArchiveTrailer ends the archive, so that a truncated archive is rejected by the import.
+type metadataArchiveTrailer struct {
+	Count uint64 `json:"count"`
+	Crc   uint32 `json:"crc"` // the crc32 of the keys and the values of all the records in order
+}
+
+// metadataArchiveLine is a line of the archive, which holds one of the header, a record and the trailer.
+type metadataArchiveLine struct {
+	Header  *metadataArchiveHeader  `json:"header,omitempty"`
+	Record  *metadataArchiveRecord  `json:"record,omitempty"`
+	Trailer *metadataArchiveTrailer `json:"trailer,omitempty"`
+}
+
+// metadataArchiveType returns the kind of the key in the archive, i.e. its acronym, or the name of the ID keys.
+func metadataArchiveType(key string) (typ string, err error) {
+	switch key {
+	case maxDataPartitionIDKey, maxMetaPartitionIDKey, maxCommonIDKey, schemaVersionKey:
+		return strings.TrimPrefix(key, keySeparator), nil
+	}
+	if arr := strings.SplitN(key, keySeparator, 3); len(arr) == 3 && arr[0] == "" && archivedAcronyms[arr[1]] {
+		return arr[1], nil
+	}
+	return "", fmt.Errorf("unknown key[%v]", key)
+}
+
+// exportMetadata writes all the records of the store as of now into the archive, which is a gzip'd stream of json
+// lines. The applied index is left out, so the archive is loaded as the initial state of a new quorum.
+func exportMetadata(store *raftstore.RocksDBStore, clusterName string, w io.Writer) (count uint64, err error) {
+	gw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gw)
+	header := &metadataArchiveHeader{
+		Format:        metadataArchiveFormat,
+		Version:       metadataArchiveVersion,
+		Cluster:       clusterName,
+		SchemaVersion: currentSchemaVersion,
+		CreateTime:    time.Now().Unix(),
+	}
+	if err = encoder.Encode(&metadataArchiveLine{Header: header}); err != nil {
+		return
+	}
+	snapshot := store.RocksDBSnapshot()
+	it := store.Iterator(snapshot)
+	defer func() {
+		it.Close()
+		store.ReleaseSnapshot(snapshot)
+	}()
+	crc := crc32.NewIEEE()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := string(it.Key().Data())
+		value := make([]byte, len(it.Value().Data()))
+		copy(value, it.Value().Data())
+		it.Key().Free()
+		it.Value().Free()
+		if key == applied {
+			continue
+		}
+		record := &metadataArchiveRecord{Key: key, Value: value}
+		if record.Type, err = metadataArchiveType(key); err != nil {
+			return
+		}
+		if err = encoder.Encode(&metadataArchiveLine{Record: record}); err != nil {
+			return
+		}
+		crc.Write([]byte(key))
+		crc.Write(value)
+		count++
+	}
+	if err = it.Err(); err != nil {
+		return
+	}
+	if err = encoder.Encode(&metadataArchiveLine{Trailer: &metadataArchiveTrailer{Count: count, Crc: crc.Sum32()}}); err != nil {
+		return
+	}
+	err = gw.Close()
+	return
+}
+
+// readMetadataArchive validates the archive of the cluster and passes each record to put, which may be nil to
+// validate the archive only. The records are in the order of the keys, and the archive must end with the trailer
+// matching them, so the records passed before a broken record or a missing trailer are to be discarded.
+func readMetadataArchive(r io.Reader, clusterName string, put func(key string, value []byte) error) (count uint64, err error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+	defer gr.Close()
+	decoder := json.NewDecoder(gr)
+	line := &metadataArchiveLine{}
+	if err = decoder.Decode(line); err != nil || line.Header == nil {
+		return 0, fmt.Errorf("the header of the archive is missing, err[%v]", err)
+	}
+	header := line.Header
+	if header.Format != metadataArchiveFormat || header.Version != metadataArchiveVersion {
+		return 0, fmt.Errorf("unsupported archive format[%v] version[%v]", header.Format, header.Version)
+	}
+	if header.SchemaVersion > currentSchemaVersion {
+		return 0, fmt.Errorf("the schema version[%v] of the archive is newer than[%v] of this master",
+			header.SchemaVersion, currentSchemaVersion)
+	}
+	if header.Cluster != clusterName {
+		return 0, fmt.Errorf("the archive of cluster[%v] can not be imported into cluster[%v]", header.Cluster, clusterName)
+	}
+	var lastKey string
+	crc := crc32.NewIEEE()
+	for {
+		line = &metadataArchiveLine{}
+		if err = decoder.Decode(line); err != nil {
+			return count, fmt.Errorf("the archive is truncated after %v records, err[%v]", count, err)
+		}
+		if line.Trailer != nil {
+			break
+		}
+		record := line.Record
+		if record == nil {
+			return count, fmt.Errorf("line %v of the archive is not a record", count+2)
+		}
+		if typ, err := metadataArchiveType(record.Key); err != nil || typ != record.Type {
+			return count, fmt.Errorf("the type[%v] of key[%v] is invalid", record.Type, record.Key)
+		}
+		if count > 0 && record.Key <= lastKey {
+			return count, fmt.Errorf("key[%v] is out of order after[%v]", record.Key, lastKey)
+		}
+		if put != nil {
+			if err = put(record.Key, record.Value); err != nil {
+				return
+			}
+		}
+		crc.Write([]byte(record.Key))
+		crc.Write(record.Value)
+		lastKey = record.Key
+		count++
+	}
+	if line.Trailer.Count != count || line.Trailer.Crc != crc.Sum32() {
+		return count, fmt.Errorf("the archive is corrupted, count[%v] crc[%v] mismatch the trailer count[%v] crc[%v]",
+			count, crc.Sum32(), line.Trailer.Count, line.Trailer.Crc)
+	}
+	if decoder.More() {
+		return count, fmt.Errorf("unexpected data after the trailer of the archive")
+	}
+	return count, nil
+}
+
+// ImportMetadata validates the archive exported by /admin/export and loads it into the store of the master, which
+// must not have been started, so that a new quorum starts with the metadata of the cluster exported. Each master of
+// the quorum loads the same archive, since the records are not replicated by the raft log.
+func ImportMetadata(cfg *config.Config, path string) (count uint64, err error) {
+	clusterName, walDir, storeDir := cfg.GetString(ClusterName), cfg.GetString(WalDir), cfg.GetString(StoreDir)
+	if clusterName == "" || walDir == "" || storeDir == "" {
+		return 0, fmt.Errorf("one of (%v,%v,%v) is null", ClusterName, WalDir, StoreDir)
+	}
+	if files, err := ioutil.ReadDir(walDir); err == nil && len(files) > 0 {
+		return 0, fmt.Errorf("the raft log in %v is not empty", walDir)
+	}
+	if _, err = readMetadataArchiveFile(path, clusterName, nil); err != nil {
+		return
+	}
+	store, err := raftstore.NewRocksDBStore(storeDir, LRUCacheSize, WriteBufferSize)
+	if err != nil {
+		return
+	}
+	defer store.Close()
+	if !isStoreEmpty(store) {
+		return 0, fmt.Errorf("the store in %v is not empty", storeDir)
+	}
+	batch := make(map[string][]byte)
+	put := func(key string, value []byte) (err error) {
+		batch[key] = value
+		if len(batch) < metadataImportBatch {
+			return
+		}
+		err = store.BatchPut(batch, false)
+		batch = make(map[string][]byte)
+		return
+	}
+	if count, err = readMetadataArchiveFile(path, clusterName, put); err == nil {
+		err = store.BatchPut(batch, true)
+	}
+	if err != nil {
+		return count, fmt.Errorf("import failed, remove %v before importing again, err[%v]", storeDir, err)
+	}
+	return
+}
+
+func readMetadataArchiveFile(path, clusterName string, put func(key string, value []byte) error) (count uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return readMetadataArchive(f, clusterName, put)
+}
+
+func isStoreEmpty(store *raftstore.RocksDBStore) bool {
+	snapshot := store.RocksDBSnapshot()
+	it := store.Iterator(snapshot)
+	defer func() {
+		it.Close()
+		store.ReleaseSnapshot(snapshot)
+	}()
+	it.SeekToFirst()
+	return !it.Valid()
+}
+
+// exportMetadata streams the archive of the metadata of the cluster, e.g. for the disaster recovery drills or the
+// migration to a new quorum of the masters. The error after the archive begins can not be replied, and the archive
+// without the trailer is rejected by the import.
+func (m *Server) exportMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v-%v.json.gz", m.cluster.Name,
+		time.Now().Format("20060102150405")))
+	count, err := exportMetadata(m.cluster.fsm.store, m.cluster.Name, w)
+	if err != nil {
+		log.LogErrorf("action[exportMetadata] export to[%v] failed after %v records, err[%v]", r.RemoteAddr, count, err)
+		return
+	}
+	log.LogWarnf("action[exportMetadata] %v records exported to[%v]", count, r.RemoteAddr)
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+)
+
+func TestExportAndImportMetadata(t *testing.T) {
+	resp, err := http.Get(fmt.Sprintf("%v%v", hostAddr, proto.AdminExportMetadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(map[string][]byte)
+	count, err := readMetadataArchive(bytes.NewReader(archive), server.cluster.Name, func(key string, value []byte) error {
+		records[key] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volKey := volPrefix + strconv.FormatUint(commonVol.ID, 10)
+	if count != uint64(len(records)) || records[volKey] == nil || records[applied] != nil {
+		t.Fatalf("expect vol[%v] without the applied index in %v records", commonVol.Name, count)
+	}
+	if _, err = readMetadataArchive(bytes.NewReader(archive), "otherCluster", nil); err == nil {
+		t.Errorf("the archive of another cluster should be rejected")
+	}
+	if _, err = readMetadataArchive(bytes.NewReader(archive[:len(archive)/2]), server.cluster.Name, nil); err == nil {
+		t.Errorf("the truncated archive should be rejected")
+	}
+
+	dir, err := ioutil.TempDir("", "metadata_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archivePath := path.Join(dir, "archive.json.gz")
+	if err = ioutil.WriteFile(archivePath, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.LoadConfigString(fmt.Sprintf(`{"clusterName":"%v","walDir":"%v","storeDir":"%v"}`,
+		server.cluster.Name, path.Join(dir, "raft"), path.Join(dir, "store")))
+	if count, err = ImportMetadata(cfg, archivePath); err != nil || count != uint64(len(records)) {
+		t.Fatalf("expect %v records imported, but is %v, err[%v]", len(records), count, err)
+	}
+	if _, err = ImportMetadata(cfg, archivePath); err == nil {
+		t.Errorf("the archive should not be imported into the store which is not empty")
+	}
+}
@@ -34,22 +34,36 @@ import (
 type clusterValue struct {
 	Name                        string
 	Threshold                   float32
+	DiskThreshold               float32
 	DisableAutoAllocate         bool
 	DataNodeDeleteLimitRate     uint64
 	MetaNodeDeleteBatchCount    uint64
 	MetaNodeDeleteWorkerSleepMs uint64
 	DataNodeAutoRepairLimitRate uint64
+	DisableAutoPromoteSpare     bool
+	EnableQuorumWrite           bool
+	EventWebhooks               []string
+	VolUsageWebhooks            []string
+	VolUsageTickIntervalSec     int64
+	SchemaVersion               int
 }
 
 func newClusterValue(c *Cluster) (cv *clusterValue) {
 	cv = &clusterValue{
 		Name:                        c.Name,
 		Threshold:                   c.cfg.MetaNodeThreshold,
+		DiskThreshold:               c.cfg.DataNodeDiskThreshold,
 		DataNodeDeleteLimitRate:     c.cfg.DataNodeDeleteLimitRate,
 		MetaNodeDeleteBatchCount:    c.cfg.MetaNodeDeleteBatchCount,
 		MetaNodeDeleteWorkerSleepMs: c.cfg.MetaNodeDeleteWorkerSleepMs,
 		DataNodeAutoRepairLimitRate: c.cfg.DataNodeAutoRepairLimitRate,
 		DisableAutoAllocate:         c.DisableAutoAllocate,
+		DisableAutoPromoteSpare:     c.DisableAutoPromoteSpare,
+		EnableQuorumWrite:           c.EnableQuorumWrite,
+		EventWebhooks:               c.events.getWebhooks(),
+		VolUsageWebhooks:            c.volUsage.getWebhooks(),
+		VolUsageTickIntervalSec:     c.volUsage.getTickInterval(),
+		SchemaVersion:               currentSchemaVersion,
 	}
 	return cv
 }
@@ -66,6 +80,8 @@ type metaPartitionValue struct {
 	OfflinePeerID uint64
 	Peers         []bsProto.Peer
 	IsRecover     bool
+	IsDegraded    bool
+	SchemaVersion int
 }
 
 func newMetaPartitionValue(mp *MetaPartition) (mpv *metaPartitionValue) {
@@ -81,21 +97,29 @@ func newMetaPartitionValue(mp *MetaPartition) (mpv *metaPartitionValue) {
 		Peers:         mp.Peers,
 		OfflinePeerID: mp.OfflinePeerID,
 		IsRecover:     mp.IsRecover,
+		IsDegraded:    mp.isDegraded,
+		SchemaVersion: currentSchemaVersion,
 	}
 	return
 }
 
 type dataPartitionValue struct {
-	PartitionID   uint64
-	ReplicaNum    uint8
-	Hosts         string
-	Peers         []bsProto.Peer
-	Status        int8
-	VolID         uint64
-	VolName       string
-	OfflinePeerID uint64
-	Replicas      []*replicaValue
-	IsRecover     bool
+	PartitionID     uint64
+	ReplicaNum      uint8
+	Hosts           string
+	Peers           []bsProto.Peer
+	Status          int8
+	VolID           uint64
+	VolName         string
+	OfflinePeerID   uint64
+	Replicas        []*replicaValue
+	IsRecover       bool
+	IsPendingDelete bool
+	IsFrozen        bool
+	IsDegraded      bool
+	IsCold          bool
+	Size            uint64
+	SchemaVersion   int
 }
 
 type replicaValue struct {
@@ -105,16 +129,22 @@ type replicaValue struct {
 
 func newDataPartitionValue(dp *DataPartition) (dpv *dataPartitionValue) {
 	dpv = &dataPartitionValue{
-		PartitionID:   dp.PartitionID,
-		ReplicaNum:    dp.ReplicaNum,
-		Hosts:         dp.hostsToString(),
-		Peers:         dp.Peers,
-		Status:        dp.Status,
-		VolID:         dp.VolID,
-		VolName:       dp.VolName,
-		OfflinePeerID: dp.OfflinePeerID,
-		Replicas:      make([]*replicaValue, 0),
-		IsRecover:     dp.isRecover,
+		PartitionID:     dp.PartitionID,
+		ReplicaNum:      dp.ReplicaNum,
+		Hosts:           dp.hostsToString(),
+		Peers:           dp.Peers,
+		Status:          dp.Status,
+		VolID:           dp.VolID,
+		VolName:         dp.VolName,
+		OfflinePeerID:   dp.OfflinePeerID,
+		Replicas:        make([]*replicaValue, 0),
+		IsRecover:       dp.isRecover,
+		IsPendingDelete: dp.isPendingDelete,
+		IsFrozen:        dp.isFrozen,
+		IsDegraded:      dp.isDegraded,
+		IsCold:          dp.isCold,
+		Size:            dp.size,
+		SchemaVersion:   currentSchemaVersion,
 	}
 	for _, replica := range dp.Replicas {
 		rv := &replicaValue{Addr: replica.Addr, DiskPath: replica.DiskPath}
@@ -143,6 +173,28 @@ type volValue struct {
 	Description       string
 	DpSelectorName    string
 	DpSelectorParm    string
+	DpAffinity        string
+	FailureDomain     string
+	MinClientVersion  string
+	Features          map[string]bool
+	MultipartTTL      int64
+	MetaCache         bool
+	MaxClients        int
+	VerifyReads       bool
+	VerifyPercent     int
+	SyncOnRename      bool
+	RequireToken      bool
+	ColdZone          string
+	NamePolicy        bsProto.DentryNamePolicy
+	LifecycleRules    []*bsProto.LifecycleRule
+	Reservations      []*bsProto.VolReservation
+	DeleteTime        int64
+	Freeze            *bsProto.VolFreezeView
+	CaseInsensitive   bool
+	Shadow            *bsProto.VolShadowView
+	ShadowOf          string
+	NamespaceExport   *bsProto.NamespaceExportConfig
+	SchemaVersion     int
 }
 
 func (v *volValue) Bytes() (raw []byte, err error) {
@@ -163,6 +215,7 @@ func newVolValue(vol *Vol) (vv *volValue) {
 		FollowerRead:      vol.FollowerRead,
 		Authenticate:      vol.authenticate,
 		CrossZone:         vol.crossZone,
+		CaseInsensitive:   vol.caseInsensitive,
 		ZoneName:          vol.zoneName,
 		EnableToken:       vol.enableToken,
 		OSSAccessKey:      vol.OSSAccessKey,
@@ -171,61 +224,86 @@ func newVolValue(vol *Vol) (vv *volValue) {
 		Description:       vol.description,
 		DpSelectorName:    vol.dpSelectorName,
 		DpSelectorParm:    vol.dpSelectorParm,
+		DpAffinity:        vol.dpAffinity,
+		FailureDomain:     vol.failureDomain,
+		MinClientVersion:  vol.minClientVersion,
+		Features:          vol.features,
+		MultipartTTL:      vol.multipartTTL,
+		MetaCache:         vol.metaCache,
+		MaxClients:        vol.maxClients,
+		VerifyReads:       vol.verifyReads,
+		VerifyPercent:     vol.verifyReadsPercent,
+		SyncOnRename:      vol.syncOnRename,
+		RequireToken:      vol.requireToken,
+		ColdZone:          vol.coldZone,
+		NamePolicy:        vol.namePolicy,
+		LifecycleRules:    vol.lifecycleRules,
+		Reservations:      vol.reservations,
+		DeleteTime:        vol.deleteTime,
+		Freeze:            vol.freeze,
+		Shadow:            vol.shadow,
+		ShadowOf:          vol.shadowOf,
+		NamespaceExport:   vol.nsExport,
+		SchemaVersion:     currentSchemaVersion,
 	}
 	return
 }
 
-func newVolValueFromBytes(raw []byte) (*volValue, error) {
-	vv := &volValue{}
-	if err := json.Unmarshal(raw, vv); err != nil {
-		return nil, err
-	}
-	return vv, nil
-}
-
 type dataNodeValue struct {
-	ID        uint64
-	NodeSetID uint64
-	Addr      string
-	ZoneName  string
+	ID            uint64
+	NodeSetID     uint64
+	Addr          string
+	ZoneName      string
+	IsSpare       bool
+	InstanceID    string
+	SchemaVersion int
 }
 
 func newDataNodeValue(dataNode *DataNode) *dataNodeValue {
 	return &dataNodeValue{
-		ID:        dataNode.ID,
-		NodeSetID: dataNode.NodeSetID,
-		Addr:      dataNode.Addr,
-		ZoneName:  dataNode.ZoneName,
+		ID:            dataNode.ID,
+		NodeSetID:     dataNode.NodeSetID,
+		Addr:          dataNode.Addr,
+		ZoneName:      dataNode.ZoneName,
+		IsSpare:       dataNode.IsSpare,
+		InstanceID:    dataNode.InstanceID,
+		SchemaVersion: currentSchemaVersion,
 	}
 }
 
 type metaNodeValue struct {
-	ID        uint64
-	NodeSetID uint64
-	Addr      string
-	ZoneName  string
+	ID            uint64
+	NodeSetID     uint64
+	Addr          string
+	ZoneName      string
+	InstanceID    string
+	SchemaVersion int
 }
 
 func newMetaNodeValue(metaNode *MetaNode) *metaNodeValue {
 	return &metaNodeValue{
-		ID:        metaNode.ID,
-		NodeSetID: metaNode.NodeSetID,
-		Addr:      metaNode.Addr,
-		ZoneName:  metaNode.ZoneName,
+		ID:            metaNode.ID,
+		NodeSetID:     metaNode.NodeSetID,
+		Addr:          metaNode.Addr,
+		ZoneName:      metaNode.ZoneName,
+		InstanceID:    metaNode.InstanceID,
+		SchemaVersion: currentSchemaVersion,
 	}
 }
 
 type nodeSetValue struct {
-	ID       uint64
-	Capacity int
-	ZoneName string
+	ID            uint64
+	Capacity      int
+	ZoneName      string
+	SchemaVersion int
 }
 
 func newNodeSetValue(nset *nodeSet) (nsv *nodeSetValue) {
 	nsv = &nodeSetValue{
-		ID:       nset.ID,
-		Capacity: nset.Capacity,
-		ZoneName: nset.zoneName,
+		ID:            nset.ID,
+		Capacity:      nset.Capacity,
+		ZoneName:      nset.zoneName,
+		SchemaVersion: currentSchemaVersion,
 	}
 	return
 }
@@ -345,6 +423,56 @@ func (c *Cluster) putNodeSetInfo(opType uint32, nset *nodeSet) (err error) {
 	return c.submit(metadata)
 }
 
+// key=#plan#name,value=json.Marshal(proto.MaintenancePlan)
+func (c *Cluster) syncPutMaintenancePlan(plan *bsProto.MaintenancePlan) (err error) {
+	metadata := new(RaftCmd)
+	metadata.Op = opSyncPutMaintenancePlan
+	metadata.K = maintenancePlanPrefix + plan.Name
+	metadata.V, err = json.Marshal(plan)
+	if err != nil {
+		return
+	}
+	return c.submit(metadata)
+}
+
+// key=#vu#id,value=json.Marshal(volUsageRecord)
+func (c *Cluster) syncPutVolUsageRecord(record *volUsageRecord) (err error) {
+	metadata := new(RaftCmd)
+	metadata.Op = opSyncPutVolUsageRecord
+	metadata.K = volUsagePrefix + strconv.FormatUint(record.Event.ID, 10)
+	metadata.V, err = json.Marshal(record)
+	if err != nil {
+		return
+	}
+	return c.submit(metadata)
+}
+
+// key=#tenant#name,value=json.Marshal(proto.TenantInfo)
+func (c *Cluster) syncPutTenant(info *bsProto.TenantInfo) (err error) {
+	metadata := new(RaftCmd)
+	metadata.Op = opSyncPutTenant
+	metadata.K = tenantPrefix + info.Name
+	metadata.V, err = json.Marshal(info)
+	if err != nil {
+		return
+	}
+	return c.submit(metadata)
+}
+
+func (c *Cluster) syncDeleteTenant(name string) (err error) {
+	metadata := new(RaftCmd)
+	metadata.Op = opSyncDeleteTenant
+	metadata.K = tenantPrefix + name
+	return c.submit(metadata)
+}
+
+func (c *Cluster) syncDeleteVolUsageRecord(id uint64) (err error) {
+	metadata := new(RaftCmd)
+	metadata.Op = opSyncDeleteVolUsageRecord
+	metadata.K = volUsagePrefix + strconv.FormatUint(id, 10)
+	return c.submit(metadata)
+}
+
 // key=#dp#volID#partitionID,value=json.Marshal(dataPartitionValue)
 func (c *Cluster) syncAddDataPartition(dp *DataPartition) (err error) {
 	return c.putDataPartitionInfo(opSyncAddDataPartition, dp)
@@ -544,12 +672,20 @@ func (c *Cluster) loadClusterValue() (err error) {
 	}
 	for _, value := range result {
 		cv := &clusterValue{}
-		if err = json.Unmarshal(value, cv); err != nil {
+		if err = c.decodeRecord(clusterAcronym, value, cv); err != nil {
 			log.LogErrorf("action[loadClusterValue], unmarshal err:%v", err.Error())
 			return err
 		}
 		c.cfg.MetaNodeThreshold = cv.Threshold
+		if cv.DiskThreshold > 0 {
+			c.cfg.DataNodeDiskThreshold = cv.DiskThreshold
+		}
 		c.DisableAutoAllocate = cv.DisableAutoAllocate
+		c.DisableAutoPromoteSpare = cv.DisableAutoPromoteSpare
+		c.EnableQuorumWrite = cv.EnableQuorumWrite
+		c.events.setWebhooks(cv.EventWebhooks)
+		c.volUsage.setWebhooks(cv.VolUsageWebhooks)
+		c.volUsage.setTickInterval(cv.VolUsageTickIntervalSec)
 		c.updateMetaNodeDeleteBatchCount(cv.MetaNodeDeleteBatchCount)
 		c.updateMetaNodeDeleteWorkerSleepMs(cv.MetaNodeDeleteWorkerSleepMs)
 		c.updateDataNodeDeleteLimitRate(cv.DataNodeDeleteLimitRate)
@@ -567,13 +703,10 @@ func (c *Cluster) loadNodeSets() (err error) {
 	}
 	for _, value := range result {
 		nsv := &nodeSetValue{}
-		if err = json.Unmarshal(value, nsv); err != nil {
+		if err = c.decodeRecord(nodeSetAcronym, value, nsv); err != nil {
 			log.LogErrorf("action[loadNodeSets], unmarshal err:%v", err.Error())
 			return err
 		}
-		if nsv.ZoneName == "" {
-			nsv.ZoneName = DefaultZoneName
-		}
 		ns := newNodeSet(nsv.ID, c.cfg.nodeSetCapacity, nsv.ZoneName)
 		zone, err := c.t.getZone(nsv.ZoneName)
 		if err != nil {
@@ -596,16 +729,15 @@ func (c *Cluster) loadDataNodes() (err error) {
 
 	for _, value := range result {
 		dnv := &dataNodeValue{}
-		if err = json.Unmarshal(value, dnv); err != nil {
+		if err = c.decodeRecord(dataNodeAcronym, value, dnv); err != nil {
 			err = fmt.Errorf("action[loadDataNodes],value:%v,unmarshal err:%v", string(value), err)
 			return
 		}
-		if dnv.ZoneName == "" {
-			dnv.ZoneName = DefaultZoneName
-		}
 		dataNode := newDataNode(dnv.Addr, dnv.ZoneName, c.Name)
 		dataNode.ID = dnv.ID
 		dataNode.NodeSetID = dnv.NodeSetID
+		dataNode.IsSpare = dnv.IsSpare
+		dataNode.InstanceID = dnv.InstanceID
 		olddn, ok := c.dataNodes.Load(dataNode.Addr)
 		if ok {
 			if olddn.(*DataNode).ID <= dataNode.ID {
@@ -626,16 +758,14 @@ func (c *Cluster) loadMetaNodes() (err error) {
 	}
 	for _, value := range result {
 		mnv := &metaNodeValue{}
-		if err = json.Unmarshal(value, mnv); err != nil {
+		if err = c.decodeRecord(metaNodeAcronym, value, mnv); err != nil {
 			err = fmt.Errorf("action[loadMetaNodes],unmarshal err:%v", err.Error())
 			return err
 		}
-		if mnv.ZoneName == "" {
-			mnv.ZoneName = DefaultZoneName
-		}
 		metaNode := newMetaNode(mnv.Addr, mnv.ZoneName, c.Name)
 		metaNode.ID = mnv.ID
 		metaNode.NodeSetID = mnv.NodeSetID
+		metaNode.InstanceID = mnv.InstanceID
 		oldmn, ok := c.metaNodes.Load(metaNode.Addr)
 		if ok {
 			if oldmn.(*MetaNode).ID <= metaNode.ID {
@@ -655,8 +785,8 @@ func (c *Cluster) loadVols() (err error) {
 		return err
 	}
 	for _, value := range result {
-		var vv *volValue
-		if vv, err = newVolValueFromBytes(value); err != nil {
+		vv := &volValue{}
+		if err = c.decodeRecord(volAcronym, value, vv); err != nil {
 			err = fmt.Errorf("action[loadVols],value:%v,unmarshal err:%v", string(value), err)
 			return err
 		}
@@ -677,7 +807,7 @@ func (c *Cluster) loadMetaPartitions() (err error) {
 
 	for _, value := range result {
 		mpv := &metaPartitionValue{}
-		if err = json.Unmarshal(value, mpv); err != nil {
+		if err = c.decodeRecord(metaPartitionAcronym, value, mpv); err != nil {
 			err = fmt.Errorf("action[loadMetaPartitions],value:%v,unmarshal err:%v", string(value), err)
 			return err
 		}
@@ -701,6 +831,7 @@ func (c *Cluster) loadMetaPartitions() (err error) {
 		mp.setPeers(mpv.Peers)
 		mp.OfflinePeerID = mpv.OfflinePeerID
 		mp.IsRecover = mpv.IsRecover
+		mp.isDegraded = mpv.IsDegraded
 		vol.addMetaPartition(mp)
 		log.LogInfof("action[loadMetaPartitions],vol[%v],mp[%v]", vol.Name, mp.PartitionID)
 	}
@@ -716,7 +847,7 @@ func (c *Cluster) loadDataPartitions() (err error) {
 	for _, value := range result {
 
 		dpv := &dataPartitionValue{}
-		if err = json.Unmarshal(value, dpv); err != nil {
+		if err = c.decodeRecord(dataPartitionAcronym, value, dpv); err != nil {
 			err = fmt.Errorf("action[loadDataPartitions],value:%v,unmarshal err:%v", string(value), err)
 			return err
 		}
@@ -740,6 +871,14 @@ func (c *Cluster) loadDataPartitions() (err error) {
 		dp.Peers = dpv.Peers
 		dp.OfflinePeerID = dpv.OfflinePeerID
 		dp.isRecover = dpv.IsRecover
+		dp.isPendingDelete = dpv.IsPendingDelete
+		dp.isFrozen = dpv.IsFrozen
+		dp.isDegraded = dpv.IsDegraded
+		dp.isCold = dpv.IsCold
+		// the partitions created before the resize are of the size of the vol
+		if dp.size = dpv.Size; dp.size == 0 {
+			dp.size = vol.dataPartitionSize
+		}
 		for _, rv := range dpv.Replicas {
 			if !contains(dp.Hosts, rv.Addr) {
 				continue
@@ -783,3 +922,57 @@ func (c *Cluster) loadTokens() (err error) {
 	}
 	return
 }
+
+func (c *Cluster) loadMaintenancePlans() (err error) {
+	result, err := c.fsm.store.SeekForPrefix([]byte(maintenancePlanPrefix))
+	if err != nil {
+		err = fmt.Errorf("action[loadMaintenancePlans],err:%v", err.Error())
+		return err
+	}
+	for _, value := range result {
+		plan := &bsProto.MaintenancePlan{}
+		if err = json.Unmarshal(value, plan); err != nil {
+			log.LogErrorf("action[loadMaintenancePlans], unmarshal err:%v", err.Error())
+			return err
+		}
+		c.maintenancePlans.Store(plan.Name, &maintenancePlan{plan: plan})
+		log.LogInfof("action[loadMaintenancePlans], plan[%v],state[%v],nextStep[%v]", plan.Name, plan.State, plan.NextStep)
+	}
+	return
+}
+
+func (c *Cluster) loadTenants() (err error) {
+	result, err := c.fsm.store.SeekForPrefix([]byte(tenantPrefix))
+	if err != nil {
+		err = fmt.Errorf("action[loadTenants],err:%v", err.Error())
+		return err
+	}
+	for _, value := range result {
+		info := &bsProto.TenantInfo{}
+		if err = json.Unmarshal(value, info); err != nil {
+			log.LogErrorf("action[loadTenants], unmarshal err:%v", err.Error())
+			return err
+		}
+		c.tenants.Store(info.Name, info)
+		log.LogInfof("action[loadTenants], tenant[%v],capacity[%v],vols[%v]", info.Name, info.Capacity, len(info.Vols))
+	}
+	return
+}
+
+func (c *Cluster) loadVolUsageRecords() (err error) {
+	result, err := c.fsm.store.SeekForPrefix([]byte(volUsagePrefix))
+	if err != nil {
+		err = fmt.Errorf("action[loadVolUsageRecords],err:%v", err.Error())
+		return err
+	}
+	for _, value := range result {
+		record := &volUsageRecord{}
+		if err = json.Unmarshal(value, record); err != nil {
+			log.LogErrorf("action[loadVolUsageRecords], unmarshal err:%v", err.Error())
+			return err
+		}
+		c.volUsage.putRecord(record)
+	}
+	log.LogInfof("action[loadVolUsageRecords], records[%v]", len(result))
+	return
+}
@@ -30,6 +30,9 @@ const (
 	defaultUsedSize = 20 * util.GB
 )
 
+// MockOrphanExtentID is the extent referenced by no inode on each data partition of the mock data nodes.
+const MockOrphanExtentID = 2000
+
 type MockDataServer struct {
 	nodeID                          uint64
 	TcpAddr                         string
@@ -68,7 +71,7 @@ func (mds *MockDataServer) register() {
 	var nodeID uint64
 	var retry int
 	for retry < 3 {
-		nodeID, err = mds.mc.NodeAPI().AddDataNode(mds.TcpAddr, mds.zoneName)
+		nodeID, err = mds.mc.NodeAPI().AddDataNode(mds.TcpAddr, mds.zoneName, "", false)
 		if err == nil {
 			break
 		}
@@ -140,6 +143,24 @@ func (mds *MockDataServer) serveConn(rc net.Conn) {
 	case proto.OpDataPartitionTryToLeader:
 		err = mds.handleTryToLeader(conn, req, adminTask)
 		fmt.Printf("data node [%v] try to leader,id[%v],err:%v\n", mds.TcpAddr, adminTask.ID, err)
+	case proto.OpFreezeDataPartition:
+		err = mds.handleFreezeDataPartition(conn, req, adminTask)
+		fmt.Printf("data node [%v] freeze data partition,id[%v],err:%v\n", mds.TcpAddr, adminTask.ID, err)
+	case proto.OpDegradeDataPartition:
+		err = mds.handleDegradeDataPartition(conn, req, adminTask)
+		fmt.Printf("data node [%v] degrade data partition,id[%v],err:%v\n", mds.TcpAddr, adminTask.ID, err)
+	case proto.OpResizeDataPartition:
+		err = mds.handleResizeDataPartition(conn, req, adminTask)
+		fmt.Printf("data node [%v] resize data partition,id[%v],err:%v\n", mds.TcpAddr, adminTask.ID, err)
+	case proto.OpCopyExtent:
+		err = mds.handleCopyExtent(conn, req, adminTask)
+		fmt.Printf("data node [%v] copy extent,id[%v],err:%v\n", mds.TcpAddr, adminTask.ID, err)
+	case proto.OpRepairDataBlock:
+		responseAckOKToMaster(conn, req, nil)
+		fmt.Printf("data node [%v] repair data block,id[%v]\n", mds.TcpAddr, adminTask.ID)
+	case proto.OpOrphanExtents:
+		err = mds.handleOrphanExtents(conn, req, adminTask)
+		fmt.Printf("data node [%v] orphan extents,id[%v],err:%v\n", mds.TcpAddr, adminTask.ID, err)
 	default:
 		fmt.Printf("unknown code [%v]\n", req.Opcode)
 	}
@@ -160,6 +181,83 @@ func (mds *MockDataServer) handleTryToLeader(conn net.Conn, p *proto.Packet, adm
 	return
 }
 
+func (mds *MockDataServer) handleFreezeDataPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, nil)
+		}
+	}()
+	requestJson, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	req := &proto.FreezeDataPartitionRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		return
+	}
+	for _, partition := range mds.partitions {
+		if partition.PartitionID == req.PartitionId {
+			partition.isFrozen = req.IsFrozen
+			return
+		}
+	}
+	return proto.ErrDataPartitionNotExists
+}
+
+func (mds *MockDataServer) handleDegradeDataPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, nil)
+		}
+	}()
+	requestJson, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	req := &proto.DegradeDataPartitionRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		return
+	}
+	for _, partition := range mds.partitions {
+		if partition.PartitionID == req.PartitionId {
+			partition.isDegraded = req.IsDegraded
+			return
+		}
+	}
+	return proto.ErrDataPartitionNotExists
+}
+
+func (mds *MockDataServer) handleResizeDataPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, nil)
+		}
+	}()
+	requestJson, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	req := &proto.ResizeDataPartitionRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		return
+	}
+	for _, partition := range mds.partitions {
+		if partition.PartitionID == req.PartitionId {
+			if req.PartitionSize > partition.total {
+				partition.total = req.PartitionSize
+			}
+			return
+		}
+	}
+	return proto.ErrDataPartitionNotExists
+}
+
 func (mds *MockDataServer) handleDecommissionDataPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
 	defer func() {
 		if err != nil {
@@ -235,19 +333,32 @@ func (mds *MockDataServer) handleHeartbeats(conn net.Conn, pkg *proto.Packet, ta
 	response.RemainingCapacity = 800 * util.GB
 
 	response.ZoneName = mds.zoneName
+	response.BuildInfo = proto.GetBuildInfo()
 	response.PartitionReports = make([]*proto.PartitionReport, 0)
+	response.Disks = []*proto.DiskReport{{
+		Path:       "/cfs",
+		Total:      response.Total,
+		Used:       response.Used,
+		Available:  response.Available,
+		Status:     proto.ReadWrite,
+		Partitions: len(mds.partitions),
+	}}
 
 	for _, partition := range mds.partitions {
 		vr := &proto.PartitionReport{
-			PartitionID:     partition.PartitionID,
-			PartitionStatus: proto.ReadWrite,
-			Total:           120 * util.GB,
-			Used:            defaultUsedSize,
-			DiskPath:        "/cfs",
-			ExtentCount:     10,
-			NeedCompare:     true,
-			IsLeader:        true, //todo
-			VolName:         partition.VolName,
+			PartitionID:          partition.PartitionID,
+			PartitionStatus:      proto.ReadWrite,
+			Total:                uint64(partition.total),
+			Used:                 defaultUsedSize,
+			DiskPath:             "/cfs",
+			ExtentCount:          10,
+			NeedCompare:          true,
+			IsLeader:             true, //todo
+			VolName:              partition.VolName,
+			IsFrozen:             partition.isFrozen,
+			IsDegraded:           partition.isDegraded,
+			AvailableTinyExtents: 54,
+			BrokenTinyExtents:    10,
 		}
 		response.PartitionReports = append(response.PartitionReports, vr)
 	}
@@ -301,6 +412,66 @@ func (mds *MockDataServer) handleLoadDataPartition(conn net.Conn, pkg *proto.Pac
 	return
 }
 
+// handleCopyExtent copies the extent at once, and allocates the copy of the extent of another partition by the job.
+func (mds *MockDataServer) handleCopyExtent(conn net.Conn, pkg *proto.Packet, task *proto.AdminTask) (err error) {
+	requestJson, err := json.Marshal(task.Request)
+	if err != nil {
+		return
+	}
+	req := &proto.CopyExtentRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		return
+	}
+	var reply []byte
+	if req.SourcePartitionId != 0 && req.ExtentId == 0 {
+		req.ExtentId = 1024 + req.JobID
+		if reply, err = json.Marshal(req); err != nil {
+			return
+		}
+	}
+	if err = responseAckOKToMaster(conn, pkg, reply); err != nil {
+		return
+	}
+	task.Response = &proto.CopyExtentResponse{
+		JobID:       req.JobID,
+		Status:      proto.TaskSucceeds,
+		CopiedBytes: uint64(req.Size),
+	}
+	return mds.mc.NodeAPI().ResponseDataNodeTask(task)
+}
+
+// handleOrphanExtents lists an extent never referenced on each data partition, and reclaims the requested ones.
+func (mds *MockDataServer) handleOrphanExtents(conn net.Conn, pkg *proto.Packet, task *proto.AdminTask) (err error) {
+	var data []byte
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, pkg, err)
+		} else {
+			responseAckOKToMaster(conn, pkg, data)
+		}
+	}()
+	requestJson, err := json.Marshal(task.Request)
+	if err != nil {
+		return
+	}
+	req := &proto.OrphanExtentsRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		return
+	}
+	resp := &proto.OrphanExtentsResponse{PartitionID: req.PartitionID, Extents: make([]*proto.OrphanExtent, 0)}
+	if len(req.Reclaim) > 0 {
+		for _, extentID := range req.Reclaim {
+			resp.Extents = append(resp.Extents, &proto.OrphanExtent{PartitionID: req.PartitionID, ExtentID: extentID,
+				Size: 1024})
+		}
+	} else if req.FromExtentID < MockOrphanExtentID {
+		resp.Extents = append(resp.Extents, &proto.OrphanExtent{PartitionID: req.PartitionID,
+			ExtentID: MockOrphanExtentID, Size: 1024})
+	}
+	data, err = json.Marshal(resp)
+	return
+}
+
 func buildSnapshot() (files []*proto.File) {
 	files = make([]*proto.File, 0)
 	f1 := &proto.File{
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +29,15 @@ import (
 	"github.com/chubaofs/chubaofs/util"
 )
 
+// The namespace served by the mock meta nodes for any volume, which is /dir/file.
+const (
+	MockDirInode  = 2
+	MockFileInode = 3
+)
+
+// MockFileExtents are the extent keys of the file served by the mock meta nodes.
+var MockFileExtents []proto.ExtentKey
+
 type MockMetaServer struct {
 	NodeID     uint64
 	TcpAddr    string
@@ -56,7 +66,7 @@ func (mms *MockMetaServer) register() {
 	var nodeID uint64
 	var retry int
 	for retry < 3 {
-		nodeID, err = mms.mc.NodeAPI().AddMetaNode(mms.TcpAddr, mms.ZoneName)
+		nodeID, err = mms.mc.NodeAPI().AddMetaNode(mms.TcpAddr, mms.ZoneName, "")
 		if err == nil {
 			break
 		}
@@ -135,6 +145,29 @@ func (mms *MockMetaServer) serveConn(rc net.Conn) {
 	case proto.OpMetaPartitionTryToLeader:
 		err = mms.handleTryToLeader(conn, req, adminTask)
 		fmt.Printf("meta node [%v] try to leader,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpCheckDataPartitionRef:
+		err = mms.handleCheckDataPartitionRef(conn, req, adminTask)
+		fmt.Printf("meta node [%v] check data partition ref,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpCheckExtentRefs:
+		err = mms.handleCheckExtentRefs(conn, req, adminTask)
+		fmt.Printf("meta node [%v] check extent refs,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpFreezeMetaPartition:
+		err = mms.handleFreezeMetaPartition(conn, req, adminTask)
+		fmt.Printf("meta node [%v] freeze meta partition,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpDegradeMetaPartition:
+		err = mms.handleDegradeMetaPartition(conn, req, adminTask)
+		fmt.Printf("meta node [%v] degrade meta partition,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpLifecycleScanDir, proto.OpLifecycleFilterExpired, proto.OpLifecycleDeleteDentries,
+		proto.OpLifecycleDeleteInodes, proto.OpLifecycleListMultiparts, proto.OpLifecycleRemoveMultiparts,
+		proto.OpLifecycleListExtents, proto.OpLifecycleSwapExtents:
+		err = mms.handleLifecycle(conn, req, adminTask)
+		fmt.Printf("meta node [%v] lifecycle op[%v],id[%v],err:%v\n", mms.TcpAddr, req.GetOpMsg(), adminTask.ID, err)
+	case proto.OpMetaNamespaceExport:
+		err = mms.handleNamespaceExport(conn, req, adminTask)
+		fmt.Printf("meta node [%v] namespace export,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpMetaLookup, proto.OpMetaInodeGet, proto.OpMetaExtentsList, proto.OpMetaSnapshotDiff:
+		err = mms.handleNamespace(conn, req)
+		fmt.Printf("meta node [%v] namespace op[%v],err:%v\n", mms.TcpAddr, req.GetOpMsg(), err)
 	default:
 		fmt.Printf("unknown code [%v]\n", req.Opcode)
 	}
@@ -155,6 +188,256 @@ func (mms *MockMetaServer) handleTryToLeader(conn net.Conn, p *proto.Packet, adm
 	return
 }
 
+func (mms *MockMetaServer) handleCheckDataPartitionRef(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	var data []byte
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, data)
+		}
+	}()
+	req := &proto.CheckDataPartitionRefRequest{}
+	reqData, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, req); err != nil {
+		return
+	}
+	resp := &proto.CheckDataPartitionRefResponse{
+		PartitionID:     req.PartitionID,
+		DataPartitionID: req.DataPartitionID,
+		Inodes:          make([]uint64, 0),
+	}
+	data, err = json.Marshal(resp)
+	return
+}
+
+// handleCheckExtentRefs finds no extent referenced.
+func (mms *MockMetaServer) handleCheckExtentRefs(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	var data []byte
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, data)
+		}
+	}()
+	req := &proto.CheckExtentRefsRequest{}
+	reqData, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, req); err != nil {
+		return
+	}
+	resp := &proto.CheckExtentRefsResponse{
+		PartitionID: req.PartitionID,
+		Referenced:  make([]*proto.OrphanExtent, 0),
+	}
+	data, err = json.Marshal(resp)
+	return
+}
+
+func (mms *MockMetaServer) handleFreezeMetaPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	var data []byte
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, data)
+		}
+	}()
+	req := &proto.FreezeMetaPartitionRequest{}
+	reqData, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, req); err != nil {
+		return
+	}
+	mms.Lock()
+	partition, ok := mms.partitions[req.PartitionID]
+	if ok {
+		partition.IsFrozen = req.IsFrozen
+	}
+	mms.Unlock()
+	if !ok {
+		return fmt.Errorf("meta partition[%v] not exists", req.PartitionID)
+	}
+	resp := &proto.FreezeMetaPartitionResponse{
+		PartitionID: req.PartitionID,
+		IsFrozen:    req.IsFrozen,
+		IsLeader:    true,
+		ApplyID:     req.PartitionID,
+		Status:      proto.TaskSucceeds,
+	}
+	data, err = json.Marshal(resp)
+	return
+}
+
+func (mms *MockMetaServer) handleDegradeMetaPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, nil)
+		}
+	}()
+	req := &proto.DegradeMetaPartitionRequest{}
+	reqData, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(reqData, req); err != nil {
+		return
+	}
+	mms.Lock()
+	partition, ok := mms.partitions[req.PartitionID]
+	if ok {
+		partition.IsDegraded = req.IsDegraded
+	}
+	mms.Unlock()
+	if !ok {
+		return fmt.Errorf("meta partition[%v] not exists", req.PartitionID)
+	}
+	return
+}
+
+// handleLifecycle replies the lifecycle requests as if the meta partition is empty.
+func (mms *MockMetaServer) handleLifecycle(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	var (
+		data []byte
+		resp interface{}
+	)
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else {
+			responseAckOKToMaster(conn, p, data)
+		}
+	}()
+	switch p.Opcode {
+	case proto.OpLifecycleScanDir:
+		resp = &proto.LifecycleScanDirResponse{Dentries: make([]*proto.LifecycleDentry, 0)}
+	case proto.OpLifecycleFilterExpired:
+		resp = &proto.LifecycleFilterExpiredResponse{Inodes: make([]uint64, 0)}
+	case proto.OpLifecycleDeleteDentries:
+		resp = &proto.LifecycleDeleteDentriesResponse{Inodes: make([]uint64, 0)}
+	case proto.OpLifecycleListMultiparts:
+		resp = &proto.LifecycleListMultipartsResponse{Multiparts: make([]*proto.LifecycleMultipart, 0)}
+	case proto.OpLifecycleListExtents:
+		resp = &proto.LifecycleListExtentsResponse{Files: make([]*proto.LifecycleFileExtents, 0)}
+	case proto.OpLifecycleSwapExtents:
+		resp = &proto.LifecycleSwapExtentsResponse{}
+	default:
+		return
+	}
+	data, err = json.Marshal(resp)
+	return
+}
+
+// handleNamespaceExport reports the meta partition exported as the index file of the root and /dir/file, and
+// accepts the manifest.
+func (mms *MockMetaServer) handleNamespaceExport(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	if err = responseAckOKToMaster(conn, p, nil); err != nil {
+		return
+	}
+	requestJson, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		return
+	}
+	req := &proto.NamespaceExportRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		return
+	}
+	if len(req.Files) > 0 {
+		return
+	}
+	resp := &proto.NamespaceExportResponse{
+		PartitionID: req.PartitionID,
+		VolName:     req.VolName,
+		ExportID:    req.ExportID,
+		Status:      proto.TaskSucceeds,
+		File:        fmt.Sprintf("mp_%d.cfsidx", req.PartitionID),
+		Inodes:      3,
+		Dentries:    2,
+		Size:        100,
+	}
+	return mms.postResponseToMaster(adminTask, resp)
+}
+
+// handleNamespace replies the requests to read the namespace, which is the same /dir/file for every volume.
+func (mms *MockMetaServer) handleNamespace(conn net.Conn, p *proto.Packet) (err error) {
+	var (
+		data []byte
+		resp interface{}
+	)
+	defer func() {
+		if err != nil {
+			responseAckErrToMaster(conn, p, err)
+		} else if resp == nil {
+			p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+			err = p.WriteToConn(conn)
+		} else {
+			responseAckOKToMaster(conn, p, data)
+		}
+	}()
+	switch p.Opcode {
+	case proto.OpMetaLookup:
+		req := &proto.LookupRequest{}
+		if err = json.Unmarshal(p.Data, req); err != nil {
+			return
+		}
+		if req.ParentID == proto.RootIno && req.Name == "dir" {
+			resp = &proto.LookupResponse{Inode: MockDirInode, Mode: uint32(os.ModeDir | 0755)}
+		} else if req.ParentID == MockDirInode && req.Name == "file" {
+			resp = &proto.LookupResponse{Inode: MockFileInode, Mode: 0644}
+		}
+	case proto.OpMetaInodeGet:
+		req := &proto.InodeGetRequest{}
+		if err = json.Unmarshal(p.Data, req); err != nil {
+			return
+		}
+		switch req.Inode {
+		case proto.RootIno, MockDirInode:
+			resp = &proto.InodeGetResponse{Info: &proto.InodeInfo{Inode: req.Inode, Mode: uint32(os.ModeDir | 0755), Nlink: 2}}
+		case MockFileInode:
+			var size uint64
+			for _, ek := range MockFileExtents {
+				size += uint64(ek.Size)
+			}
+			resp = &proto.InodeGetResponse{Info: &proto.InodeInfo{Inode: req.Inode, Mode: 0644, Nlink: 1, Size: size}}
+		}
+	case proto.OpMetaExtentsList:
+		resp = &proto.GetExtentsResponse{Generation: 1, Extents: MockFileExtents}
+	case proto.OpMetaSnapshotDiff:
+		// /dir/new is created and /dir/old is deleted since any snapshot but the one as of 1, which is not retained
+		req := &proto.SnapshotDiffRequest{}
+		if err = json.Unmarshal(p.Data, req); err != nil || req.From == 1 {
+			return
+		}
+		entries := []*proto.SnapshotDiffEntry{
+			{Type: proto.SnapshotDiffCreated, ParentID: MockDirInode, Name: "new", Inode: MockFileInode + 1, Mode: 0644},
+			{Type: proto.SnapshotDiffDeleted, ParentID: MockDirInode, Name: "old", Inode: MockFileInode + 2, Mode: 0644},
+		}
+		if req.Marker != "" {
+			entries = entries[1:]
+		}
+		diff := &proto.SnapshotDiffResponse{PartitionID: req.PartitionID, Entries: entries}
+		if len(entries) > req.Limit {
+			diff.Entries = entries[:req.Limit]
+			diff.NextMarker = fmt.Sprintf("d/%v/%v", MockDirInode, entries[req.Limit-1].Name)
+		}
+		resp = diff
+	}
+	if resp != nil {
+		data, err = json.Marshal(resp)
+	}
+	return
+}
+
 func (mms *MockMetaServer) handleCreateMetaPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
 	defer func() {
 		if err != nil {
@@ -223,10 +506,13 @@ func (mms *MockMetaServer) handleHeartbeats(conn net.Conn, p *proto.Packet, admi
 		}
 		mpr.Status = proto.ReadWrite
 		mpr.IsLeader = true
+		mpr.IsFrozen = partition.IsFrozen
+		mpr.IsDegraded = partition.IsDegraded
 		resp.MetaPartitionReports = append(resp.MetaPartitionReports, mpr)
 	}
 	mms.RUnlock()
 	resp.ZoneName = mms.ZoneName
+	resp.BuildInfo = proto.GetBuildInfo()
 	resp.Status = proto.TaskSucceeds
 end:
 	return mms.postResponseToMaster(adminTask, resp)
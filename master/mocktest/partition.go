@@ -8,6 +8,8 @@ type MockDataPartition struct {
 	total            int
 	used             uint64
 	VolName          string
+	isFrozen         bool
+	isDegraded       bool
 }
 
 type MockMetaPartition struct {
@@ -18,4 +20,6 @@ type MockMetaPartition struct {
 	Cursor      uint64
 	VolName     string
 	Members     []proto.Peer
+	IsFrozen    bool
+	IsDegraded  bool
 }
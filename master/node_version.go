@@ -0,0 +1,100 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func (dataNode *DataNode) version() *proto.NodeVersion {
+	dataNode.RLock()
+	defer dataNode.RUnlock()
+	return &proto.NodeVersion{
+		Addr:       dataNode.Addr,
+		NodeType:   proto.NodeTypeData,
+		ZoneName:   dataNode.ZoneName,
+		IsActive:   dataNode.isActive,
+		ReportTime: dataNode.ReportTime.Unix(),
+		Reported:   dataNode.BuildInfo.StartTime != 0,
+		BuildInfo:  dataNode.BuildInfo,
+	}
+}
+
+func (metaNode *MetaNode) version() *proto.NodeVersion {
+	metaNode.RLock()
+	defer metaNode.RUnlock()
+	return &proto.NodeVersion{
+		Addr:       metaNode.Addr,
+		NodeType:   proto.NodeTypeMeta,
+		ZoneName:   metaNode.ZoneName,
+		IsActive:   metaNode.IsActive,
+		ReportTime: metaNode.ReportTime.Unix(),
+		Reported:   metaNode.BuildInfo.StartTime != 0,
+		BuildInfo:  metaNode.BuildInfo,
+	}
+}
+
+// nodeVersions collects the build information reported by the data nodes and the meta nodes, and marks the nodes
+// running a commit other than the expected one as stale. The commit of the master is expected if commitID is empty.
+func (c *Cluster) nodeVersions(commitID string) (view *proto.NodeVersionsView) {
+	view = &proto.NodeVersionsView{
+		Master:           proto.GetBuildInfo(),
+		ExpectedCommitID: commitID,
+		CommitCounts:     make(map[string]int),
+		StaleNodes:       make([]string, 0),
+		UnreportedNodes:  make([]string, 0),
+		Nodes:            make([]*proto.NodeVersion, 0),
+	}
+	if view.ExpectedCommitID == "" {
+		view.ExpectedCommitID = view.Master.CommitID
+	}
+	c.dataNodes.Range(func(addr, node interface{}) bool {
+		view.Nodes = append(view.Nodes, node.(*DataNode).version())
+		return true
+	})
+	c.metaNodes.Range(func(addr, node interface{}) bool {
+		view.Nodes = append(view.Nodes, node.(*MetaNode).version())
+		return true
+	})
+	sort.Slice(view.Nodes, func(i, j int) bool {
+		if view.Nodes[i].NodeType != view.Nodes[j].NodeType {
+			return view.Nodes[i].NodeType < view.Nodes[j].NodeType
+		}
+		return view.Nodes[i].Addr < view.Nodes[j].Addr
+	})
+	for _, nv := range view.Nodes {
+		if !nv.Reported {
+			view.UnreportedNodes = append(view.UnreportedNodes, nv.Addr)
+			continue
+		}
+		view.CommitCounts[nv.CommitID]++
+		if nv.CommitID != view.ExpectedCommitID {
+			nv.Stale = true
+			view.StaleNodes = append(view.StaleNodes, nv.Addr)
+		}
+	}
+	return
+}
+
+func (m *Server) getNodeVersions(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.nodeVersions(r.FormValue(commitKey))))
+}
@@ -0,0 +1,417 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const nsExportS3Scheme = "s3://"
+
+// nsExportJob keeps the namespace export of a volume on the master leader, which is lost once the leader is changed.
+// Each meta partition is exported from its snapshot by a replica, preferably a follower, and the manifest listing the
+// index files is written once all of them are exported.
+type nsExportJob struct {
+	sync.RWMutex
+	status     proto.NamespaceExportStatus
+	target     string
+	exportTime int64
+	pending    map[uint64]bool // the meta partitions not exported yet
+	files      []*proto.NamespaceExportResponse
+}
+
+func (job *nsExportJob) getStatus() *proto.NamespaceExportStatus {
+	job.RLock()
+	defer job.RUnlock()
+	status := job.status
+	return &status
+}
+
+// start begins a new export of the meta partitions unless an export is running.
+func (job *nsExportJob) start(target string, partitionIDs []uint64, now time.Time) (exportID string, err error) {
+	job.Lock()
+	defer job.Unlock()
+	if job.status.State == proto.NamespaceExportRunning {
+		return "", fmt.Errorf("export[%v] of vol[%v] is running", job.status.ExportID, job.status.VolName)
+	}
+	exportID = now.UTC().Format("20060102T150405Z")
+	job.status.State = proto.NamespaceExportRunning
+	job.status.ExportID = exportID
+	job.status.LastStartTime = now.Unix()
+	job.status.Runs++
+	job.status.Partitions = len(partitionIDs)
+	job.status.Exported = 0
+	job.status.Inodes, job.status.Dentries, job.status.Size = 0, 0, 0
+	job.status.LastError = ""
+	job.target = target
+	job.exportTime = now.Unix()
+	job.pending = make(map[uint64]bool, len(partitionIDs))
+	for _, id := range partitionIDs {
+		job.pending[id] = true
+	}
+	job.files = make([]*proto.NamespaceExportResponse, 0, len(partitionIDs))
+	return
+}
+
+// finish ends the running export with the error, or as a success if the error is empty.
+func (job *nsExportJob) finish(exportID, errMsg string, now time.Time) {
+	job.Lock()
+	defer job.Unlock()
+	if job.status.State != proto.NamespaceExportRunning || job.status.ExportID != exportID {
+		return
+	}
+	job.status.State = proto.NamespaceExportIdle
+	job.status.LastEndTime = now.Unix()
+	job.status.LastError = errMsg
+	if errMsg == "" {
+		job.status.LastSuccessID = exportID
+	}
+	job.pending = nil
+}
+
+// exported records the response of a meta partition, and returns the manifest request once all the meta partitions
+// are exported. The export fails at the first failed meta partition.
+func (job *nsExportJob) exported(resp *proto.NamespaceExportResponse, now time.Time) (manifest *proto.NamespaceExportRequest, failed bool) {
+	job.Lock()
+	defer job.Unlock()
+	if job.status.State != proto.NamespaceExportRunning || job.status.ExportID != resp.ExportID || !job.pending[resp.PartitionID] {
+		return
+	}
+	if resp.Status != proto.TaskSucceeds {
+		job.status.State = proto.NamespaceExportIdle
+		job.status.LastEndTime = now.Unix()
+		job.status.LastError = fmt.Sprintf("meta partition[%v] err[%v]", resp.PartitionID, resp.Result)
+		job.pending = nil
+		return nil, true
+	}
+	delete(job.pending, resp.PartitionID)
+	job.files = append(job.files, resp)
+	job.status.Exported++
+	job.status.Inodes += resp.Inodes
+	job.status.Dentries += resp.Dentries
+	job.status.Size += resp.Size
+	if len(job.pending) > 0 {
+		return
+	}
+	files := make([]*proto.NamespaceExportResponse, len(job.files))
+	copy(files, job.files)
+	sort.Slice(files, func(i, j int) bool { return files[i].PartitionID < files[j].PartitionID })
+	manifest = &proto.NamespaceExportRequest{
+		VolName:    job.status.VolName,
+		ExportID:   job.status.ExportID,
+		ExportTime: job.exportTime,
+		Target:     job.target,
+		Files:      files,
+	}
+	return
+}
+
+// isDue returns if the next export of the volume should start, and fails the running export which is not done
+// in time, e.g. whose responses are lost as the meta nodes restart.
+func (job *nsExportJob) isDue(config *proto.NamespaceExportConfig, now time.Time) bool {
+	job.Lock()
+	defer job.Unlock()
+	if job.status.State == proto.NamespaceExportRunning {
+		if now.Unix()-job.status.LastStartTime <= defaultNamespaceExportTimeoutSec {
+			return false
+		}
+		job.status.State = proto.NamespaceExportIdle
+		job.status.LastEndTime = now.Unix()
+		job.status.LastError = fmt.Sprintf("%v partitions are not exported in %v seconds", len(job.pending),
+			defaultNamespaceExportTimeoutSec)
+		job.pending = nil
+	}
+	return config.IntervalHours > 0 && now.Unix()-job.status.LastStartTime >= int64(config.IntervalHours)*3600
+}
+
+func (c *Cluster) getNamespaceExportJob(volName string) *nsExportJob {
+	job, _ := c.nsExports.LoadOrStore(volName, &nsExportJob{status: proto.NamespaceExportStatus{
+		VolName: volName,
+		State:   proto.NamespaceExportIdle,
+	}})
+	return job.(*nsExportJob)
+}
+
+func validateNamespaceExportConfig(config *proto.NamespaceExportConfig) (err error) {
+	if config.IntervalHours < 0 {
+		return fmt.Errorf("namespace export interval must not be negative")
+	}
+	if strings.HasPrefix(config.Target, nsExportS3Scheme) {
+		if bucket := strings.SplitN(strings.TrimPrefix(config.Target, nsExportS3Scheme), "/", 2)[0]; bucket == "" {
+			return fmt.Errorf("namespace export target[%v] has no bucket", config.Target)
+		}
+		return
+	}
+	if !path.IsAbs(config.Target) {
+		return fmt.Errorf("namespace export target[%v] is neither an absolute path nor %vbucket/prefix",
+			config.Target, nsExportS3Scheme)
+	}
+	return
+}
+
+func (vol *Vol) getNamespaceExport() *proto.NamespaceExportConfig {
+	vol.RLock()
+	defer vol.RUnlock()
+	if vol.nsExport == nil {
+		return nil
+	}
+	config := *vol.nsExport
+	return &config
+}
+
+// setVolNamespaceExport replaces the namespace export of the volume, which is removed if the config is nil.
+func (c *Cluster) setVolNamespaceExport(name, authKey string, config *proto.NamespaceExportConfig) (err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return proto.ErrVolNotExists
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	oldConfig := vol.nsExport
+	vol.nsExport = config
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.nsExport = oldConfig
+		log.LogErrorf("action[setVolNamespaceExport] vol[%v] err[%v]", name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	log.LogInfof("action[setVolNamespaceExport] vol[%v] config[%+v]", name, config)
+	return
+}
+
+func (c *Cluster) scheduleToExportNamespace() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.checkNamespaceExports(time.Now())
+			}
+			time.Sleep(time.Second * defaultIntervalToCheckNamespaceExport)
+		}
+	}()
+}
+
+func (c *Cluster) checkNamespaceExports(now time.Time) {
+	for _, vol := range c.copyVols() {
+		if vol.Status == markDelete {
+			continue
+		}
+		config := vol.getNamespaceExport()
+		if config == nil || !c.getNamespaceExportJob(vol.Name).isDue(config, now) {
+			continue
+		}
+		if _, err := c.exportNamespace(vol, now); err != nil {
+			log.LogWarnf("action[checkNamespaceExports] vol[%v] err[%v]", vol.Name, err)
+		}
+	}
+}
+
+// exportNamespace starts to export the namespace of the volume, each meta partition of which is exported from its
+// snapshot by a replica and reported once done.
+func (c *Cluster) exportNamespace(vol *Vol, now time.Time) (exportID string, err error) {
+	config := vol.getNamespaceExport()
+	if config == nil {
+		return "", fmt.Errorf("vol[%v] has no namespace export", vol.Name)
+	}
+	mps := vol.cloneMetaPartitionMap()
+	ids := make([]uint64, 0, len(mps))
+	for id := range mps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	job := c.getNamespaceExportJob(vol.Name)
+	if exportID, err = job.start(config.Target, ids, now); err != nil {
+		return
+	}
+	for _, id := range ids {
+		req := &proto.NamespaceExportRequest{
+			PartitionID: id,
+			VolName:     vol.Name,
+			ExportID:    exportID,
+			ExportTime:  now.Unix(),
+			Target:      config.Target,
+		}
+		if err = c.sendNamespaceExportTask(mps[id], req); err != nil {
+			job.finish(exportID, err.Error(), time.Now())
+			Warn(c.Name, fmt.Sprintf("clusterID[%v] vol[%v] namespace export[%v] failed, err[%v]", c.Name, vol.Name,
+				exportID, err))
+			return
+		}
+	}
+	log.LogWarnf("action[exportNamespace] vol[%v] export[%v] of %v meta partitions to %v", vol.Name, exportID,
+		len(ids), config.Target)
+	return
+}
+
+// sendNamespaceExportTask sends the export to a live follower of the meta partition, or the leader if no follower
+// is live, so that the leader keeps serving the clients undisturbed.
+func (c *Cluster) sendNamespaceExportTask(mp *MetaPartition, req *proto.NamespaceExportRequest) (err error) {
+	mp.RLock()
+	var mr *MetaReplica
+	for _, replica := range mp.getLiveReplicas() {
+		if mr == nil || mr.IsLeader {
+			mr = replica
+		}
+	}
+	mp.RUnlock()
+	if mr == nil {
+		return fmt.Errorf("meta partition[%v] has no live replica", mp.PartitionID)
+	}
+	task := proto.NewAdminTask(proto.OpMetaNamespaceExport, mr.Addr, req)
+	resetMetaPartitionTaskID(task, mp.PartitionID)
+	mr.metaNode.Sender.awaitResponse(task)
+	if _, err = mr.metaNode.Sender.syncSendAdminTask(task); err != nil {
+		return fmt.Errorf("meta partition[%v] on [%v] err[%v]", mp.PartitionID, mr.Addr, err)
+	}
+	return
+}
+
+func (c *Cluster) handleResponseToNamespaceExport(nodeAddr string, resp *proto.NamespaceExportResponse) (err error) {
+	value, ok := c.nsExports.Load(resp.VolName)
+	if !ok {
+		log.LogWarnf("action[handleResponseToNamespaceExport] export[%v] of vol[%v] from [%v] is unknown",
+			resp.ExportID, resp.VolName, nodeAddr)
+		return
+	}
+	job := value.(*nsExportJob)
+	manifest, failed := job.exported(resp, time.Now())
+	if failed {
+		Warn(c.Name, fmt.Sprintf("clusterID[%v] vol[%v] namespace export[%v] of meta partition[%v] on [%v] failed, "+
+			"err[%v]", c.Name, resp.VolName, resp.ExportID, resp.PartitionID, nodeAddr, resp.Result))
+		return
+	}
+	if manifest == nil {
+		return
+	}
+	// the manifest is written by the meta node which reports last, since the response is posted by it
+	go func() {
+		err := c.writeNamespaceExportManifest(nodeAddr, manifest)
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+			Warn(c.Name, fmt.Sprintf("clusterID[%v] vol[%v] namespace export[%v] manifest failed, err[%v]", c.Name,
+				resp.VolName, resp.ExportID, err))
+		}
+		job.finish(manifest.ExportID, msg, time.Now())
+		log.LogWarnf("action[handleResponseToNamespaceExport] vol[%v] export[%v] done, err[%v]", resp.VolName,
+			resp.ExportID, err)
+	}()
+	return
+}
+
+func (c *Cluster) writeNamespaceExportManifest(nodeAddr string, manifest *proto.NamespaceExportRequest) (err error) {
+	metaNode, err := c.metaNode(nodeAddr)
+	if err != nil {
+		return
+	}
+	task := proto.NewAdminTask(proto.OpMetaNamespaceExport, nodeAddr, manifest)
+	_, err = metaNode.Sender.syncSendAdminTask(task)
+	return
+}
+
+func (m *Server) setVolNamespaceExport(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		config  *proto.NamespaceExportConfig
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if target := r.FormValue(targetKey); target != "" {
+		config = &proto.NamespaceExportConfig{Target: target}
+		if value := r.FormValue(intervalHoursKey); value != "" {
+			if config.IntervalHours, err = strconv.Atoi(value); err != nil {
+				sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+				return
+			}
+		}
+		if err = validateNamespaceExportConfig(config); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+			return
+		}
+	}
+	if err = m.cluster.setVolNamespaceExport(name, authKey, config); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	msg := fmt.Sprintf("remove namespace export of vol[%v] successfully", name)
+	if config != nil {
+		msg = fmt.Sprintf("set namespace export of vol[%v] to [%v] every %v hours successfully", name, config.Target,
+			config.IntervalHours)
+	}
+	log.LogWarn(msg)
+	sendOkReply(w, r, newSuccessHTTPReply(msg))
+}
+
+func (m *Server) runVolNamespaceExport(w http.ResponseWriter, r *http.Request) {
+	var (
+		name     string
+		authKey  string
+		vol      *Vol
+		exportID string
+		err      error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	if !matchKey(vol.Owner, authKey) {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolAuthKeyNotMatch))
+		return
+	}
+	if exportID, err = m.cluster.exportNamespace(vol, time.Now()); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.getNamespaceExportJob(name).getStatus()))
+	log.LogWarnf("action[runVolNamespaceExport] vol[%v] export[%v] started", name, exportID)
+}
+
+func (m *Server) getVolNamespaceExportStatus(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		vol  *Vol
+		err  error
+	)
+	if name, err = parseVolName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	status := m.cluster.getNamespaceExportJob(name).getStatus()
+	status.Config = vol.getNamespaceExport()
+	sendOkReply(w, r, newSuccessHTTPReply(status))
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestNamespaceExport(t *testing.T) {
+	name := "nsExportVol"
+	process(fmt.Sprintf("%v%v?name=%v&replicas=3&type=extent&capacity=100&owner=cfs&mpCount=2&zoneName=%v", hostAddr,
+		proto.AdminCreateVol, name, testZone2), t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v&target=/nsexport&intervalHours=0", hostAddr,
+		proto.AdminSetVolNamespaceExport, name, buildAuthKey("cfs")), t)
+	defer process(fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminSetVolNamespaceExport, name,
+		buildAuthKey("cfs")), t)
+	config := vol.getNamespaceExport()
+	if config == nil || config.Target != "/nsexport" {
+		t.Fatalf("unexpected namespace export %v", config)
+	}
+	if restored := newVolFromVolValue(newVolValue(vol)); restored.nsExport == nil || restored.nsExport.Target != "/nsexport" {
+		t.Errorf("the namespace export is not persisted")
+	}
+
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminRunVolNamespaceExport, name,
+		buildAuthKey("cfs")), t)
+	job := server.cluster.getNamespaceExportJob(name)
+	var status *proto.NamespaceExportStatus
+	for i := 0; i < 50; i++ {
+		if status = job.getStatus(); status.State != proto.NamespaceExportRunning {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	partitions := len(vol.cloneMetaPartitionMap())
+	if status.State != proto.NamespaceExportIdle || status.LastError != "" || status.LastSuccessID != status.ExportID {
+		t.Fatalf("the namespace export is not done, status %+v", status)
+	}
+	if status.Partitions != partitions || status.Exported != partitions || status.Inodes != uint64(3*partitions) {
+		t.Errorf("unexpected statistics of the namespace export, status %+v", status)
+	}
+	process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetVolNamespaceExportJob, name), t)
+}
+
+func TestNamespaceExportJob(t *testing.T) {
+	for _, target := range []string{"", "nsexport", "s3://", "s3:///prefix"} {
+		if err := validateNamespaceExportConfig(&proto.NamespaceExportConfig{Target: target}); err == nil {
+			t.Errorf("target[%v] should be rejected", target)
+		}
+	}
+	if err := validateNamespaceExportConfig(&proto.NamespaceExportConfig{Target: "s3://bucket/prefix", IntervalHours: 24}); err != nil {
+		t.Error(err)
+	}
+
+	config := &proto.NamespaceExportConfig{Target: "/nsexport", IntervalHours: 1}
+	job := &nsExportJob{status: proto.NamespaceExportStatus{VolName: "vol", State: proto.NamespaceExportIdle}}
+	now := time.Now()
+	if !job.isDue(config, now) {
+		t.Fatalf("the first export should be due")
+	}
+	exportID, err := job.start(config.Target, []uint64{1, 2}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = job.start(config.Target, []uint64{1, 2}, now); err == nil {
+		t.Errorf("the export should not start while running")
+	}
+	manifest, failed := job.exported(&proto.NamespaceExportResponse{PartitionID: 2, ExportID: exportID,
+		Status: proto.TaskSucceeds}, now)
+	if manifest != nil || failed {
+		t.Fatalf("the export should wait for meta partition 1")
+	}
+	// the responses of the other exports are ignored
+	if manifest, failed = job.exported(&proto.NamespaceExportResponse{PartitionID: 1, ExportID: "old",
+		Status: proto.TaskFailed}, now); manifest != nil || failed {
+		t.Fatalf("the response of another export should be ignored")
+	}
+	manifest, _ = job.exported(&proto.NamespaceExportResponse{PartitionID: 1, ExportID: exportID,
+		Status: proto.TaskSucceeds}, now)
+	if manifest == nil || len(manifest.Files) != 2 || manifest.Files[0].PartitionID != 1 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	job.finish(exportID, "", now)
+	if job.isDue(config, now.Add(30*time.Minute)) || !job.isDue(config, now.Add(time.Hour)) {
+		t.Errorf("the export should be due every hour")
+	}
+
+	next := now.Add(time.Hour)
+	if exportID, err = job.start(config.Target, []uint64{1}, next); err != nil {
+		t.Fatal(err)
+	}
+	if job.isDue(config, next.Add(2*time.Hour)) {
+		t.Errorf("the running export should not be due")
+	}
+	if !job.isDue(config, next.Add(defaultNamespaceExportTimeoutSec*time.Second+time.Second)) {
+		t.Errorf("the export timed out should be due")
+	}
+	if status := job.getStatus(); status.State != proto.NamespaceExportIdle || status.LastError == "" ||
+		status.LastSuccessID == exportID {
+		t.Errorf("the export should fail once timed out, status %+v", status)
+	}
+}
@@ -28,7 +28,7 @@ import (
 	"time"
 )
 
-func newCreateDataPartitionRequest(volName string, ID uint64, members []proto.Peer, dataPartitionSize int, hosts []string, createType int) (req *proto.CreateDataPartitionRequest) {
+func newCreateDataPartitionRequest(volName string, ID uint64, members []proto.Peer, dataPartitionSize int, hosts []string, createType int, diskPath string) (req *proto.CreateDataPartitionRequest) {
 	req = &proto.CreateDataPartitionRequest{
 		PartitionId:   ID,
 		PartitionSize: dataPartitionSize,
@@ -36,6 +36,7 @@ func newCreateDataPartitionRequest(volName string, ID uint64, members []proto.Pe
 		Members:       members,
 		Hosts:         hosts,
 		CreateType:    createType,
+		DiskPath:      diskPath,
 	}
 	return
 }
@@ -83,6 +84,8 @@ func unmarshalTaskResponse(task *proto.AdminTask) (err error) {
 		response = &proto.DeleteDataPartitionResponse{}
 	case proto.OpLoadDataPartition:
 		response = &proto.LoadDataPartitionResponse{}
+	case proto.OpCopyExtent:
+		response = &proto.CopyExtentResponse{}
 	case proto.OpDeleteFile:
 		response = &proto.DeleteFileResponse{}
 	case proto.OpMetaNodeHeartbeat:
@@ -93,6 +96,8 @@ func unmarshalTaskResponse(task *proto.AdminTask) (err error) {
 		response = &proto.UpdateMetaPartitionResponse{}
 	case proto.OpDecommissionMetaPartition:
 		response = &proto.MetaPartitionDecommissionResponse{}
+	case proto.OpMetaNamespaceExport:
+		response = &proto.NamespaceExportResponse{}
 	default:
 		log.LogError(fmt.Sprintf("unknown operate code(%v)", task.OpCode))
 	}
@@ -0,0 +1,453 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// orphanExtentJob keeps the orphan extents of a volume on the master leader, which are lost once the leader is
+// changed. The normal extents not modified within the safety window are listed by the leader of each data partition,
+// and checked against the inodes they are created for, and then against all the inodes of the volume. An extent
+// referenced by no inode is queued, and reclaimed from all the replicas if it is still an orphan in the next run.
+type orphanExtentJob struct {
+	sync.Mutex
+	report    proto.OrphanExtentsReport
+	queued    map[uint64]map[uint64]*proto.OrphanExtent // data partition id -> extent id -> the orphan extent
+	reclaimed []*proto.OrphanExtent                     // the extents reclaimed lately
+}
+
+func newOrphanExtentJob(volName string) *orphanExtentJob {
+	return &orphanExtentJob{
+		report: proto.OrphanExtentsReport{VolName: volName, State: proto.OrphanExtentsIdle},
+		queued: make(map[uint64]map[uint64]*proto.OrphanExtent),
+	}
+}
+
+func (job *orphanExtentJob) getReport() *proto.OrphanExtentsReport {
+	job.Lock()
+	defer job.Unlock()
+	report := job.report
+	report.Queued = make([]*proto.OrphanExtent, 0)
+	for _, extents := range job.queued {
+		for _, extent := range extents {
+			report.Queued = append(report.Queued, extent)
+		}
+	}
+	sort.Slice(report.Queued, func(i, j int) bool {
+		if report.Queued[i].PartitionID != report.Queued[j].PartitionID {
+			return report.Queued[i].PartitionID < report.Queued[j].PartitionID
+		}
+		return report.Queued[i].ExtentID < report.Queued[j].ExtentID
+	})
+	if len(report.Queued) > defaultOrphanExtentReportSize {
+		report.Queued = report.Queued[:defaultOrphanExtentReportSize]
+	}
+	report.Reclaimed = make([]*proto.OrphanExtent, len(job.reclaimed))
+	copy(report.Reclaimed, job.reclaimed)
+	return &report
+}
+
+// start begins a new run unless a run is going on.
+func (job *orphanExtentJob) start(partitions int, now time.Time) (err error) {
+	job.Lock()
+	defer job.Unlock()
+	if job.report.State == proto.OrphanExtentsRunning {
+		return fmt.Errorf("orphan extents of vol[%v] are being checked", job.report.VolName)
+	}
+	job.report.State = proto.OrphanExtentsRunning
+	job.report.LastStartTime = now.Unix()
+	job.report.Runs++
+	job.report.Partitions = partitions
+	job.report.Scanned = 0
+	job.report.LastError = ""
+	return
+}
+
+func (job *orphanExtentJob) finish(errMsg string, now time.Time) {
+	job.Lock()
+	defer job.Unlock()
+	job.report.State = proto.OrphanExtentsIdle
+	job.report.LastEndTime = now.Unix()
+	job.report.LastError = errMsg
+}
+
+func (job *orphanExtentJob) isDue(intervalSec int64, now time.Time) bool {
+	job.Lock()
+	defer job.Unlock()
+	return job.report.State != proto.OrphanExtentsRunning && intervalSec > 0 &&
+		now.Unix()-job.report.LastStartTime >= intervalSec
+}
+
+// queue replaces the queued extents of the data partition by the orphan extents found by the run, and returns the
+// ones already queued by the last run, which are to be reclaimed.
+func (job *orphanExtentJob) queue(partitionID uint64, scanned int, orphans []*proto.OrphanExtent) (confirmed []*proto.OrphanExtent) {
+	job.Lock()
+	defer job.Unlock()
+	job.report.Scanned += uint64(scanned)
+	last := job.queued[partitionID]
+	queued := make(map[uint64]*proto.OrphanExtent)
+	for _, orphan := range orphans {
+		if _, ok := last[orphan.ExtentID]; ok {
+			confirmed = append(confirmed, orphan)
+		} else {
+			queued[orphan.ExtentID] = orphan
+		}
+	}
+	if len(queued) == 0 {
+		delete(job.queued, partitionID)
+	} else {
+		job.queued[partitionID] = queued
+	}
+	job.countQueued()
+	return
+}
+
+// requeue puts back the extents failing to be reclaimed, which are reclaimed by the next run if still orphans.
+func (job *orphanExtentJob) requeue(partitionID uint64, extents []*proto.OrphanExtent) {
+	job.Lock()
+	defer job.Unlock()
+	queued := job.queued[partitionID]
+	if queued == nil {
+		queued = make(map[uint64]*proto.OrphanExtent)
+		job.queued[partitionID] = queued
+	}
+	for _, extent := range extents {
+		queued[extent.ExtentID] = extent
+	}
+	job.countQueued()
+}
+
+func (job *orphanExtentJob) countQueued() {
+	job.report.QueuedExtents, job.report.QueuedSize = 0, 0
+	for _, extents := range job.queued {
+		for _, extent := range extents {
+			job.report.QueuedExtents++
+			job.report.QueuedSize += extent.Size
+		}
+	}
+}
+
+func (job *orphanExtentJob) addReclaimed(extents []*proto.OrphanExtent) {
+	job.Lock()
+	defer job.Unlock()
+	for _, extent := range extents {
+		job.report.ReclaimedExtents++
+		job.report.ReclaimedSize += extent.Size
+	}
+	job.reclaimed = append(job.reclaimed, extents...)
+	if excess := len(job.reclaimed) - defaultOrphanExtentReportSize; excess > 0 {
+		job.reclaimed = append(job.reclaimed[:0], job.reclaimed[excess:]...)
+	}
+}
+
+func (c *Cluster) getOrphanExtentJob(volName string) *orphanExtentJob {
+	job, _ := c.orphanExtents.LoadOrStore(volName, newOrphanExtentJob(volName))
+	return job.(*orphanExtentJob)
+}
+
+func (c *Cluster) scheduleToReclaimOrphanExtents() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.checkOrphanExtents(time.Now())
+			}
+			time.Sleep(time.Second * defaultIntervalToScheduleOrphanExtents)
+		}
+	}()
+}
+
+func (c *Cluster) checkOrphanExtents(now time.Time) {
+	for _, vol := range c.copyVols() {
+		if vol.Status == markDelete || !c.getOrphanExtentJob(vol.Name).isDue(c.cfg.IntervalToCheckOrphanExtents, now) {
+			continue
+		}
+		if err := c.reclaimOrphanExtents(vol, now); err != nil {
+			log.LogWarnf("action[checkOrphanExtents] vol[%v] err[%v]", vol.Name, err)
+		}
+	}
+}
+
+// reclaimOrphanExtents checks the data partitions of the volume one by one. The failed data partitions are skipped
+// with their queued extents kept, and the first error is reported.
+func (c *Cluster) reclaimOrphanExtents(vol *Vol, now time.Time) (err error) {
+	dps := vol.cloneDataPartitionMap()
+	ids := make([]uint64, 0, len(dps))
+	for id := range dps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	job := c.getOrphanExtentJob(vol.Name)
+	if err = job.start(len(ids), now); err != nil {
+		return
+	}
+	mps := vol.cloneMetaPartitionMap()
+	modifiedBefore := now.Unix() - c.cfg.OrphanExtentSafetySec
+	var (
+		firstErr  error
+		failed    int
+		reclaimed int
+	)
+	for _, id := range ids {
+		count, dpErr := c.reclaimDataPartitionOrphanExtents(job, dps[id], mps, modifiedBefore)
+		reclaimed += count
+		if dpErr != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("data partition[%v] err[%v]", id, dpErr)
+			}
+			log.LogWarnf("action[reclaimOrphanExtents] vol[%v] data partition[%v] err[%v]", vol.Name, id, dpErr)
+		}
+	}
+	errMsg := ""
+	if firstErr != nil {
+		errMsg = fmt.Sprintf("%v of %v data partitions failed, %v", failed, len(ids), firstErr)
+		Warn(c.Name, fmt.Sprintf("clusterID[%v] vol[%v] orphan extents: %v", c.Name, vol.Name, errMsg))
+	}
+	job.finish(errMsg, time.Now())
+	report := job.getReport()
+	log.LogWarnf("action[reclaimOrphanExtents] vol[%v] partitions[%v] scanned[%v] queued[%v] reclaimed[%v] "+
+		"failed[%v]", vol.Name, len(ids), report.Scanned, report.QueuedExtents, reclaimed, failed)
+	return
+}
+
+func (c *Cluster) reclaimDataPartitionOrphanExtents(job *orphanExtentJob, dp *DataPartition,
+	mps map[uint64]*MetaPartition, modifiedBefore int64) (reclaimed int, err error) {
+	dp.RLock()
+	skip := dp.isPendingDelete || dp.isFrozen
+	hosts := make([]string, len(dp.Hosts))
+	copy(hosts, dp.Hosts)
+	leaderAddr := dp.getLeaderAddr()
+	dp.RUnlock()
+	if skip {
+		return
+	}
+	if leaderAddr == "" {
+		return 0, fmt.Errorf("no leader")
+	}
+	candidates, err := c.listOrphanExtents(dp, leaderAddr, modifiedBefore)
+	if err != nil {
+		return
+	}
+	orphans, err := c.filterReferencedExtents(candidates, mps)
+	if err != nil {
+		return
+	}
+	confirmed := job.queue(dp.PartitionID, len(candidates), orphans)
+	if len(confirmed) == 0 {
+		return
+	}
+	extentIDs := make([]uint64, 0, len(confirmed))
+	for _, extent := range confirmed {
+		extentIDs = append(extentIDs, extent.ExtentID)
+	}
+	req := &proto.OrphanExtentsRequest{
+		PartitionID:    dp.PartitionID,
+		ModifiedBefore: modifiedBefore,
+		Reclaim:        extentIDs,
+	}
+	// the extents deleted on the leader are the ones reported, since the others are deleted by the repair
+	var leaderResp *proto.OrphanExtentsResponse
+	for _, host := range hosts {
+		resp, sendErr := c.sendOrphanExtentsTask(dp, host, req)
+		if sendErr != nil {
+			err = fmt.Errorf("reclaim on [%v] err[%v]", host, sendErr)
+			continue
+		}
+		if host == leaderAddr {
+			leaderResp = resp
+		}
+	}
+	if err != nil {
+		job.requeue(dp.PartitionID, confirmed)
+	}
+	if leaderResp != nil {
+		job.addReclaimed(leaderResp.Extents)
+		reclaimed = len(leaderResp.Extents)
+	}
+	return
+}
+
+// listOrphanExtents lists the normal extents of the data partition not modified since the time from the leader.
+func (c *Cluster) listOrphanExtents(dp *DataPartition, leaderAddr string, modifiedBefore int64) (extents []*proto.OrphanExtent, err error) {
+	req := &proto.OrphanExtentsRequest{
+		PartitionID:    dp.PartitionID,
+		ModifiedBefore: modifiedBefore,
+		Limit:          defaultOrphanExtentBatchSize,
+	}
+	for {
+		resp, err := c.sendOrphanExtentsTask(dp, leaderAddr, req)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, resp.Extents...)
+		if len(resp.Extents) < req.Limit {
+			return extents, nil
+		}
+		req.FromExtentID = resp.Extents[len(resp.Extents)-1].ExtentID
+	}
+}
+
+func (c *Cluster) sendOrphanExtentsTask(dp *DataPartition, addr string, req *proto.OrphanExtentsRequest) (resp *proto.OrphanExtentsResponse, err error) {
+	dataNode, err := c.dataNode(addr)
+	if err != nil {
+		return
+	}
+	task := proto.NewAdminTask(proto.OpOrphanExtents, addr, req)
+	dp.resetTaskID(task)
+	packet, err := dataNode.TaskManager.syncSendAdminTask(task)
+	if err != nil {
+		return
+	}
+	resp = &proto.OrphanExtentsResponse{}
+	err = json.Unmarshal(packet.Data, resp)
+	return
+}
+
+// filterReferencedExtents returns the extents referenced by no inode. The extents are checked against the inodes they
+// are created for first, and the rest against all the inodes of the volume, since an extent may be shared by the
+// inodes, or created before the inodes are recorded.
+func (c *Cluster) filterReferencedExtents(extents []*proto.OrphanExtent, mps map[uint64]*MetaPartition) (orphans []*proto.OrphanExtent, err error) {
+	if len(extents) == 0 {
+		return
+	}
+	byInode := make(map[uint64][]*proto.OrphanExtent)
+	for _, extent := range extents {
+		if extent.Inode == 0 {
+			continue
+		}
+		for id, mp := range mps {
+			if extent.Inode >= mp.Start && extent.Inode <= mp.End {
+				byInode[id] = append(byInode[id], extent)
+				break
+			}
+		}
+	}
+	referenced := make(map[uint64]bool)
+	for id, bound := range byInode {
+		if err = c.checkExtentRefs(mps[id], bound, true, referenced); err != nil {
+			return
+		}
+	}
+	orphans = unreferencedExtents(extents, referenced)
+	for _, mp := range mps {
+		if len(orphans) == 0 {
+			break
+		}
+		if err = c.checkExtentRefs(mp, orphans, false, referenced); err != nil {
+			return nil, err
+		}
+		orphans = unreferencedExtents(orphans, referenced)
+	}
+	return
+}
+
+func unreferencedExtents(extents []*proto.OrphanExtent, referenced map[uint64]bool) (unreferenced []*proto.OrphanExtent) {
+	unreferenced = make([]*proto.OrphanExtent, 0, len(extents))
+	for _, extent := range extents {
+		if !referenced[extent.ExtentID] {
+			unreferenced = append(unreferenced, extent)
+		}
+	}
+	return
+}
+
+// checkExtentRefs checks the extents of a data partition on the leader of the meta partition, and marks the
+// referenced ones.
+func (c *Cluster) checkExtentRefs(mp *MetaPartition, extents []*proto.OrphanExtent, byInode bool, referenced map[uint64]bool) (err error) {
+	mp.RLock()
+	mr, err := mp.getMetaReplicaLeader()
+	mp.RUnlock()
+	if err != nil {
+		return fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+	}
+	req := &proto.CheckExtentRefsRequest{
+		PartitionID: mp.PartitionID,
+		Extents:     extents,
+		ByInode:     byInode,
+	}
+	task := proto.NewAdminTask(proto.OpCheckExtentRefs, mr.Addr, req)
+	resetMetaPartitionTaskID(task, mp.PartitionID)
+	packet, err := mr.metaNode.Sender.syncSendAdminTask(task)
+	if err != nil {
+		return fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+	}
+	resp := &proto.CheckExtentRefsResponse{}
+	if err = json.Unmarshal(packet.Data, resp); err != nil {
+		return fmt.Errorf("meta partition[%v] err[%v]", mp.PartitionID, err)
+	}
+	for _, extent := range resp.Referenced {
+		referenced[extent.ExtentID] = true
+	}
+	return
+}
+
+func (m *Server) runVolOrphanExtents(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		vol     *Vol
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	if !matchKey(vol.Owner, authKey) {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolAuthKeyNotMatch))
+		return
+	}
+	job := m.cluster.getOrphanExtentJob(name)
+	if job.getReport().State == proto.OrphanExtentsRunning {
+		sendErrReply(w, r, newErrHTTPReply(fmt.Errorf("orphan extents of vol[%v] are being checked", name)))
+		return
+	}
+	go func() {
+		if err := m.cluster.reclaimOrphanExtents(vol, time.Now()); err != nil {
+			log.LogWarnf("action[runVolOrphanExtents] vol[%v] err[%v]", name, err)
+		}
+	}()
+	msg := fmt.Sprintf("check orphan extents of vol[%v] started", name)
+	log.LogWarn(msg)
+	sendOkReply(w, r, newSuccessHTTPReply(msg))
+}
+
+func (m *Server) getVolOrphanExtentsReport(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		err  error
+	)
+	if name, err = parseVolName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if _, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.getOrphanExtentJob(name).getReport()))
+}
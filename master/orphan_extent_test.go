@@ -0,0 +1,121 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/master/mocktest"
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestOrphanExtents(t *testing.T) {
+	vol, err := server.cluster.getVol(commonVolName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.cluster.checkDataNodeHeartbeat()
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	var partitions int
+	for _, dp := range vol.cloneDataPartitionMap() {
+		if !dp.isPendingDelete && !dp.isFrozen && dp.getLeaderAddrWithLock() != "" {
+			partitions++
+		}
+	}
+	if partitions == 0 {
+		t.Fatalf("no data partition to check")
+	}
+	// the scheduled checks, which may have run since the master started, are stopped to count the runs of the test
+	interval := server.cluster.cfg.IntervalToCheckOrphanExtents
+	server.cluster.cfg.IntervalToCheckOrphanExtents = 0
+	defer func() {
+		server.cluster.cfg.IntervalToCheckOrphanExtents = interval
+	}()
+	for i := 0; i < 50 && server.cluster.getOrphanExtentJob(commonVolName).getReport().State == proto.OrphanExtentsRunning; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	server.cluster.orphanExtents.Delete(commonVolName)
+	job := server.cluster.getOrphanExtentJob(commonVolName)
+	if err = server.cluster.reclaimOrphanExtents(vol, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	report := job.getReport()
+	if report.LastError != "" || report.QueuedExtents != partitions || report.ReclaimedExtents != 0 {
+		t.Fatalf("the orphan extents are not queued by the first run, report %+v", report)
+	}
+
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminRunVolOrphanExtents, commonVolName,
+		buildAuthKey(vol.Owner)), t)
+	for i := 0; i < 50; i++ {
+		if report = job.getReport(); report.Runs == 2 && report.State == proto.OrphanExtentsIdle {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if report.LastError != "" || report.QueuedExtents != 0 || report.ReclaimedExtents != uint64(partitions) {
+		t.Fatalf("the orphan extents are not reclaimed by the second run, report %+v", report)
+	}
+	if len(report.Reclaimed) == 0 || report.Reclaimed[0].ExtentID != mocktest.MockOrphanExtentID {
+		t.Errorf("unexpected reclaimed extents %v", report.Reclaimed)
+	}
+	process(fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminGetVolOrphanExtentsReport, commonVolName), t)
+}
+
+func TestOrphanExtentJobQueue(t *testing.T) {
+	job := newOrphanExtentJob("vol")
+	now := time.Now()
+	if !job.isDue(3600, now) || job.isDue(0, now) {
+		t.Fatalf("the first run should be due unless disabled")
+	}
+	if err := job.start(1, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.start(1, now); err == nil || job.isDue(3600, now) {
+		t.Fatalf("the running job should not be started again")
+	}
+	first := []*proto.OrphanExtent{{PartitionID: 1, ExtentID: 1025, Size: 10}, {PartitionID: 1, ExtentID: 1026, Size: 20}}
+	if confirmed := job.queue(1, 2, first); len(confirmed) != 0 {
+		t.Fatalf("the extents found first are confirmed %v", confirmed)
+	}
+	job.finish("", now)
+	if job.isDue(3600, now) || !job.isDue(3600, now.Add(time.Hour)) {
+		t.Fatalf("the next run should be due after the interval")
+	}
+
+	// 1025 is referenced since the last run, and 1027 is found first
+	second := []*proto.OrphanExtent{{PartitionID: 1, ExtentID: 1026, Size: 20}, {PartitionID: 1, ExtentID: 1027, Size: 30}}
+	confirmed := job.queue(1, 3, second)
+	if len(confirmed) != 1 || confirmed[0].ExtentID != 1026 {
+		t.Fatalf("unexpected confirmed extents %v", confirmed)
+	}
+	if report := job.getReport(); report.QueuedExtents != 1 || report.QueuedSize != 30 || report.Scanned != 5 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	job.requeue(1, confirmed)
+	if report := job.getReport(); report.QueuedExtents != 2 || report.Queued[0].ExtentID != 1026 {
+		t.Fatalf("the extent failing to be reclaimed is not queued again, report %+v", report)
+	}
+	for i := 0; i < defaultOrphanExtentReportSize+1; i++ {
+		job.addReclaimed([]*proto.OrphanExtent{{PartitionID: 1, ExtentID: uint64(2000 + i), Size: 1}})
+	}
+	report := job.getReport()
+	if report.ReclaimedExtents != defaultOrphanExtentReportSize+1 || len(report.Reclaimed) != defaultOrphanExtentReportSize ||
+		report.Reclaimed[0].ExtentID != 2001 {
+		t.Fatalf("unexpected reclaimed extents in report %+v", report)
+	}
+}
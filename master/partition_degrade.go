@@ -0,0 +1,181 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (partition *DataPartition) createTaskToDegradeDataPartition(addr string, isDegraded bool) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpDegradeDataPartition, addr, &proto.DegradeDataPartitionRequest{
+		PartitionId: partition.PartitionID,
+		IsDegraded:  isDegraded,
+	})
+	partition.resetTaskID(task)
+	return
+}
+
+func (mp *MetaPartition) createTaskToDegradeMetaPartition(addr string, isDegraded bool) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpDegradeMetaPartition, addr, &proto.DegradeMetaPartitionRequest{
+		PartitionID: mp.PartitionID,
+		IsDegraded:  isDegraded,
+	})
+	resetMetaPartitionTaskID(task, mp.PartitionID)
+	return
+}
+
+// setDataPartitionDegraded switches the degraded mode of the data partition on every replica. Once the quorum of a
+// degraded data partition is lost, the surviving replicas serve the reads without the leader and flag the replies as
+// possibly stale, while the writes keep failing. The data partition is kept read-only until the mode is switched off.
+// The flag is persisted before the replicas are notified, so that the unreachable replicas are synced once they are
+// back by the scheduled check of the data partitions.
+func (c *Cluster) setDataPartitionDegraded(vol *Vol, dp *DataPartition, isDegraded bool) (err error) {
+	dp.Lock()
+	oldFlag := dp.isDegraded
+	dp.isDegraded = isDegraded
+	if err = c.syncUpdateDataPartition(dp); err != nil {
+		dp.isDegraded = oldFlag
+		dp.Unlock()
+		return
+	}
+	if isDegraded {
+		dp.Status = proto.ReadOnly
+	}
+	hosts := make([]string, len(dp.Hosts))
+	copy(hosts, dp.Hosts)
+	dp.Unlock()
+	vol.dataPartitions.updateResponseCache(true, 0)
+	log.LogWarnf("action[setDataPartitionDegraded] vol[%v] dp[%v] isDegraded[%v]", vol.Name, dp.PartitionID, isDegraded)
+
+	return notifyReplicas("data partition", dp.PartitionID, hosts, func(addr string) error {
+		return c.syncDegradeDataReplica(dp, addr, isDegraded)
+	})
+}
+
+func isDegradedDataReplica(replica *DataReplica) *bool {
+	return &replica.IsDegraded
+}
+
+func (c *Cluster) syncDegradeDataReplica(dp *DataPartition, addr string, isDegraded bool) (err error) {
+	_, err = c.syncDataReplicaFlag(dp, addr, dp.createTaskToDegradeDataPartition(addr, isDegraded), isDegradedDataReplica, isDegraded)
+	return
+}
+
+// syncDegradedDataReplicas notifies the live replicas whose reported flag differs from the data partition again.
+func (c *Cluster) syncDegradedDataReplicas(vol *Vol) {
+	c.syncDataReplicaFlags(vol, "syncDegradedDataReplicas", func(dp *DataPartition) bool { return dp.isDegraded },
+		isDegradedDataReplica, c.syncDegradeDataReplica)
+}
+
+// setMetaPartitionDegraded switches the degraded mode of the meta partition on every replica. Once the quorum of a
+// degraded meta partition is lost, the surviving replicas serve the read-only requests locally and flag the replies
+// as possibly stale, while the mutations keep failing without the leader.
+func (c *Cluster) setMetaPartitionDegraded(mp *MetaPartition, isDegraded bool) (err error) {
+	mp.Lock()
+	oldFlag := mp.isDegraded
+	mp.isDegraded = isDegraded
+	if err = c.syncUpdateMetaPartition(mp); err != nil {
+		mp.isDegraded = oldFlag
+		mp.Unlock()
+		return
+	}
+	hosts := make([]string, len(mp.Hosts))
+	copy(hosts, mp.Hosts)
+	mp.Unlock()
+	log.LogWarnf("action[setMetaPartitionDegraded] vol[%v] mp[%v] isDegraded[%v]", mp.volName, mp.PartitionID, isDegraded)
+
+	return notifyReplicas("meta partition", mp.PartitionID, hosts, func(addr string) error {
+		return c.syncDegradeMetaReplica(mp, addr, isDegraded)
+	})
+}
+
+func isDegradedMetaReplica(replica *MetaReplica) *bool {
+	return &replica.IsDegraded
+}
+
+func (c *Cluster) syncDegradeMetaReplica(mp *MetaPartition, addr string, isDegraded bool) (err error) {
+	_, err = c.syncMetaReplicaFlag(mp, addr, mp.createTaskToDegradeMetaPartition(addr, isDegraded), isDegradedMetaReplica, isDegraded)
+	return
+}
+
+// syncDegradedMetaReplicas notifies the live replicas whose reported flag differs from the meta partition again.
+func (c *Cluster) syncDegradedMetaReplicas(vol *Vol) {
+	c.syncMetaReplicaFlags(vol, "syncDegradedMetaReplicas", func(mp *MetaPartition) bool { return mp.isDegraded },
+		isDegradedMetaReplica, c.syncDegradeMetaReplica)
+}
+
+func (m *Server) degradeDataPartition(w http.ResponseWriter, r *http.Request) {
+	m.setDataPartitionDegraded(w, r, true)
+}
+
+func (m *Server) undegradeDataPartition(w http.ResponseWriter, r *http.Request) {
+	m.setDataPartitionDegraded(w, r, false)
+}
+
+func (m *Server) setDataPartitionDegraded(w http.ResponseWriter, r *http.Request, isDegraded bool) {
+	var (
+		dp          *DataPartition
+		vol         *Vol
+		partitionID uint64
+		volName     string
+		err         error
+	)
+	if partitionID, volName, err = parseRequestToOperateDataPartition(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, dp, err = m.cluster.getVolAndDataPartition(volName, partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err = m.cluster.setDataPartitionDegraded(vol, dp, isDegraded); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set data partition[%v] degraded to [%v] successfully", dp.PartitionID, isDegraded)))
+}
+
+func (m *Server) degradeMetaPartition(w http.ResponseWriter, r *http.Request) {
+	m.setMetaPartitionDegraded(w, r, true)
+}
+
+func (m *Server) undegradeMetaPartition(w http.ResponseWriter, r *http.Request) {
+	m.setMetaPartitionDegraded(w, r, false)
+}
+
+func (m *Server) setMetaPartitionDegraded(w http.ResponseWriter, r *http.Request, isDegraded bool) {
+	var (
+		mp          *MetaPartition
+		partitionID uint64
+		err         error
+	)
+	if partitionID, err = parseAndExtractPartitionInfo(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if mp, err = m.cluster.getMetaPartitionByID(partitionID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrMetaPartitionNotExists))
+		return
+	}
+	if err = m.cluster.setMetaPartitionDegraded(mp, isDegraded); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set meta partition[%v] degraded to [%v] successfully", mp.PartitionID, isDegraded)))
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// resolvePath walks the dentries of the path from the root inode on the leaders of the meta partitions, then maps the
+// extent keys of the inode it ends at to the replicas of their data partitions. Only the first limit extents are mapped.
+func (c *Cluster) resolvePath(vol *Vol, p string, limit int) (res *proto.PathResolution, err error) {
+	res = &proto.PathResolution{
+		VolName:    vol.Name,
+		Path:       path.Clean(p),
+		Components: make([]*proto.ResolvedDentry, 0),
+		Extents:    make([]*proto.ResolvedExtent, 0),
+	}
+	ino := proto.RootIno
+	for _, name := range strings.Split(res.Path, "/") {
+		if name == "" {
+			continue
+		}
+		if n := len(res.Components); n > 0 && !proto.IsDir(res.Components[n-1].Mode) {
+			return nil, fmt.Errorf("[%v] of path[%v] is not a directory", res.Components[n-1].Name, res.Path)
+		}
+		var dentry *proto.ResolvedDentry
+		if dentry, err = c.lookupDentry(vol, ino, name); err != nil {
+			return nil, err
+		}
+		res.Components = append(res.Components, dentry)
+		ino = dentry.Inode
+	}
+
+	mp, err := vol.metaPartitionByInode(ino)
+	if err != nil {
+		return nil, err
+	}
+	inode := &proto.InodeGetResponse{}
+	req := &proto.InodeGetRequest{VolName: vol.Name, PartitionID: mp.PartitionID, Inode: ino}
+	if res.MetaPartition, err = c.requestMetaPartition(mp, proto.OpMetaInodeGet, req, inode); err != nil {
+		return nil, fmt.Errorf("get inode[%v]: %v", ino, err)
+	}
+	res.Inode = inode.Info
+	if res.Inode == nil || !proto.IsRegular(res.Inode.Mode) {
+		return
+	}
+
+	extents := &proto.GetExtentsResponse{}
+	if _, err = c.requestMetaPartition(mp, proto.OpMetaExtentsList,
+		&proto.GetExtentsRequest{VolName: vol.Name, PartitionID: mp.PartitionID, Inode: ino}, extents); err != nil {
+		return nil, fmt.Errorf("list extents of inode[%v]: %v", ino, err)
+	}
+	res.Generation = extents.Generation
+	res.ExtentCount = len(extents.Extents)
+	for i, ek := range extents.Extents {
+		if i >= limit {
+			res.Truncated = true
+			break
+		}
+		res.Extents = append(res.Extents, resolveExtent(vol, ek))
+	}
+	return
+}
+
+// resolveDir walks the dentries of the directory path from the root inode, and returns the inode of the directory.
+func (c *Cluster) resolveDir(vol *Vol, p string) (ino uint64, err error) {
+	ino = proto.RootIno
+	for _, name := range strings.Split(path.Clean("/"+p), "/") {
+		if name == "" {
+			continue
+		}
+		var dentry *proto.ResolvedDentry
+		if dentry, err = c.lookupDentry(vol, ino, name); err != nil {
+			return 0, err
+		}
+		if !proto.IsDir(dentry.Mode) {
+			return 0, fmt.Errorf("[%v] of path[%v] is not a directory", name, p)
+		}
+		ino = dentry.Inode
+	}
+	return
+}
+
+func (c *Cluster) lookupDentry(vol *Vol, parentID uint64, name string) (dentry *proto.ResolvedDentry, err error) {
+	mp, err := vol.metaPartitionByInode(parentID)
+	if err != nil {
+		return
+	}
+	resp := &proto.LookupResponse{}
+	req := &proto.LookupRequest{VolName: vol.Name, PartitionID: mp.PartitionID, ParentID: parentID, Name: name}
+	view, err := c.requestMetaPartition(mp, proto.OpMetaLookup, req, resp)
+	if err != nil {
+		return nil, fmt.Errorf("lookup [%v] under inode[%v]: %v", name, parentID, err)
+	}
+	return &proto.ResolvedDentry{
+		Name:        name,
+		ParentID:    parentID,
+		Inode:       resp.Inode,
+		Mode:        resp.Mode,
+		PartitionID: view.PartitionID,
+		Leader:      view.Leader,
+	}, nil
+}
+
+// requestMetaPartition sends the request to the leader of the meta partition and decodes the reply into resp.
+func (c *Cluster) requestMetaPartition(mp *MetaPartition, opcode uint8, req, resp interface{}) (view *proto.ResolvedMetaPartition, err error) {
+	mp.RLock()
+	view = &proto.ResolvedMetaPartition{PartitionID: mp.PartitionID, Start: mp.Start, End: mp.End}
+	view.Hosts = append(make([]string, 0, len(mp.Hosts)), mp.Hosts...)
+	mr, err := mp.getMetaReplicaLeader()
+	if err == nil {
+		view.Leader = mr.Addr
+	}
+	mp.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("meta partition[%v]: %v", mp.PartitionID, err)
+	}
+	metaNode, err := c.metaNode(view.Leader)
+	if err != nil {
+		return nil, err
+	}
+	packet := proto.NewPacketReqID()
+	packet.Opcode = opcode
+	packet.PartitionID = mp.PartitionID
+	// the volumes requiring the delegated tokens serve the master with an internal one
+	packet.Arg = proto.AttachDelegatedToken(nil, proto.NewInternalDelegatedToken(mp.volName, []byte(c.cfg.tokenSigningKey)))
+	packet.ArgLen = uint32(len(packet.Arg))
+	if err = packet.MarshalData(req); err != nil {
+		return nil, err
+	}
+	if packet, err = metaNode.Sender.syncSendPacket(packet); err != nil {
+		return nil, err
+	}
+	switch packet.ResultCode {
+	case proto.OpOk:
+	case proto.OpNotExistErr:
+		return nil, fmt.Errorf("not found on meta partition[%v] leader[%v]", mp.PartitionID, view.Leader)
+	default:
+		return nil, fmt.Errorf("%v on meta partition[%v] leader[%v] failed: %v", packet.GetOpMsg(), mp.PartitionID,
+			view.Leader, packet.GetResultMsg())
+	}
+	if err = packet.UnmarshalData(resp); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func resolveExtent(vol *Vol, ek proto.ExtentKey) (extent *proto.ResolvedExtent) {
+	extent = &proto.ResolvedExtent{ExtentKey: ek, Hosts: make([]string, 0), Replicas: make([]*proto.ResolvedReplica, 0)}
+	dp, err := vol.getDataPartitionByID(ek.PartitionId)
+	if err != nil {
+		extent.Err = err.Error()
+		return
+	}
+	dp.RLock()
+	defer dp.RUnlock()
+	extent.Hosts = append(extent.Hosts, dp.Hosts...)
+	for _, replica := range dp.Replicas {
+		extent.Replicas = append(extent.Replicas, &proto.ResolvedReplica{
+			Addr:     replica.Addr,
+			DiskPath: replica.DiskPath,
+			IsLeader: replica.IsLeader,
+			Status:   replica.Status,
+		})
+	}
+	return
+}
+
+func (m *Server) resolvePath(w http.ResponseWriter, r *http.Request) {
+	var (
+		vol   *Vol
+		res   *proto.PathResolution
+		limit = defaultResolveExtentLimit
+		err   error
+	)
+	volName := r.FormValue(volKey)
+	if volName == "" {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: keyNotFound(volKey).Error()})
+		return
+	}
+	p := r.FormValue(pathKey)
+	if !strings.HasPrefix(p, "/") {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v], an absolute path is expected", pathKey, p)})
+		return
+	}
+	if value := r.FormValue(limitKey); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", limitKey, value)})
+			return
+		}
+	}
+	if vol, err = m.cluster.getVol(volName); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeVolNotExists, Msg: err.Error()})
+		return
+	}
+	if res, err = m.cluster.resolvePath(vol, p, limit); err != nil {
+		log.LogWarnf("action[resolvePath] vol[%v] path[%v] err[%v]", volName, p, err)
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(res))
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/master/mocktest"
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestResolvePath(t *testing.T) {
+	name := "resolveVol"
+	createVol(name, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	dp := vol.dataPartitions.partitions[0]
+	mocktest.MockFileExtents = []proto.ExtentKey{
+		{FileOffset: 0, PartitionId: dp.PartitionID, ExtentId: 1025, Size: 4096},
+		{FileOffset: 4096, PartitionId: 1 << 40, ExtentId: 1026, Size: 4096},
+	}
+	defer func() {
+		mocktest.MockFileExtents = nil
+	}()
+
+	res, err := server.cluster.resolvePath(vol, "/dir//file", defaultResolveExtentLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Components) != 2 || res.Components[1].Inode != mocktest.MockFileInode || res.Path != "/dir/file" {
+		t.Fatalf("unexpected components %v of path[%v]", res.Components, res.Path)
+	}
+	if res.Inode == nil || res.Inode.Size != 8192 || res.MetaPartition.Leader == "" {
+		t.Fatalf("unexpected inode[%v] of meta partition[%v]", res.Inode, res.MetaPartition)
+	}
+	if res.ExtentCount != 2 || len(res.Extents) != 2 {
+		t.Fatalf("expect 2 extents, but is %v", len(res.Extents))
+	}
+	if e := res.Extents[0]; e.Err != "" || len(e.Hosts) == 0 || len(e.Replicas) != len(dp.Replicas) {
+		t.Errorf("unexpected replicas %v of extent[%v], err[%v]", e.Replicas, e.ExtentKey, e.Err)
+	}
+	if res.Extents[1].Err == "" {
+		t.Errorf("the extent on the missing data partition should be reported")
+	}
+	if res, err = server.cluster.resolvePath(vol, "/dir/file", 1); err != nil || !res.Truncated || len(res.Extents) != 1 {
+		t.Errorf("the extents should be truncated by the limit, err[%v]", err)
+	}
+	if res, err = server.cluster.resolvePath(vol, "/dir", 1); err != nil || len(res.Extents) != 0 {
+		t.Errorf("no extent should be listed for a directory, err[%v]", err)
+	}
+	if _, err = server.cluster.resolvePath(vol, "/dir/missing", 1); err == nil {
+		t.Errorf("the missing dentry should fail the resolution")
+	}
+	if _, err = server.cluster.resolvePath(vol, "/dir/file/x", 1); err == nil {
+		t.Errorf("the path under a file should fail the resolution")
+	}
+
+	reqURL := fmt.Sprintf("%v%v?vol=%v&path=/dir/file", hostAddr, proto.AdminResolvePath, name)
+	process(reqURL, t)
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// reportedReplicas records the replicas of the partitions reported by the active nodes in the latest heartbeats.
+type reportedReplicas struct {
+	hosts    map[uint64]map[string]bool
+	volNames map[uint64]string
+	inactive map[string]bool
+}
+
+func newReportedReplicas() *reportedReplicas {
+	return &reportedReplicas{
+		hosts:    make(map[uint64]map[string]bool),
+		volNames: make(map[uint64]string),
+		inactive: make(map[string]bool),
+	}
+}
+
+func (rr *reportedReplicas) add(partitionID uint64, volName, addr string) {
+	if _, ok := rr.hosts[partitionID]; !ok {
+		rr.hosts[partitionID] = make(map[string]bool)
+	}
+	rr.hosts[partitionID][addr] = true
+	rr.volNames[partitionID] = volName
+}
+
+func (rr *reportedReplicas) inactiveNodes() (addrs []string) {
+	addrs = make([]string, 0, len(rr.inactive))
+	for addr := range rr.inactive {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return
+}
+
+// diff compares the hosts of the partition with the reported replicas, and removes the reported replicas of the
+// partition, so that the remaining ones are unknown to the master. It returns nil if they are consistent.
+func (rr *reportedReplicas) diff(partitionID uint64, partitionType, volName string, hosts []string) (d *proto.PartitionPlacementDiff) {
+	reported := rr.hosts[partitionID]
+	delete(rr.hosts, partitionID)
+	d = &proto.PartitionPlacementDiff{
+		PartitionID:     partitionID,
+		PartitionType:   partitionType,
+		VolName:         volName,
+		Hosts:           hosts,
+		ReportedHosts:   make([]string, 0),
+		MissingHosts:    make([]string, 0),
+		UnexpectedHosts: make([]string, 0),
+		InactiveHosts:   make([]string, 0),
+	}
+	isHost := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		isHost[host] = true
+		if rr.inactive[host] {
+			d.InactiveHosts = append(d.InactiveHosts, host)
+		} else if !reported[host] {
+			d.MissingHosts = append(d.MissingHosts, host)
+		}
+	}
+	for addr := range reported {
+		d.ReportedHosts = append(d.ReportedHosts, addr)
+		if !isHost[addr] {
+			d.UnexpectedHosts = append(d.UnexpectedHosts, addr)
+		}
+	}
+	sort.Strings(d.ReportedHosts)
+	sort.Strings(d.UnexpectedHosts)
+	if len(d.MissingHosts) == 0 && len(d.UnexpectedHosts) == 0 {
+		return nil
+	}
+	return
+}
+
+// orphans returns the partitions reported by the nodes which are unknown to the master.
+func (rr *reportedReplicas) orphans(partitionType, volName string) (diffs []*proto.PartitionPlacementDiff) {
+	diffs = make([]*proto.PartitionPlacementDiff, 0)
+	for partitionID := range rr.hosts {
+		if volName != "" && rr.volNames[partitionID] != volName {
+			continue
+		}
+		if d := rr.diff(partitionID, partitionType, rr.volNames[partitionID], []string{}); d != nil {
+			diffs = append(diffs, d)
+		}
+	}
+	return
+}
+
+func (c *Cluster) reportedDataReplicas() (rr *reportedReplicas) {
+	rr = newReportedReplicas()
+	c.dataNodes.Range(func(addr, node interface{}) bool {
+		dataNode := node.(*DataNode)
+		dataNode.RLock()
+		defer dataNode.RUnlock()
+		if !dataNode.isActive || dataNode.ReportTime.IsZero() {
+			rr.inactive[dataNode.Addr] = true
+			return true
+		}
+		for _, report := range dataNode.DataPartitionReports {
+			rr.add(report.PartitionID, report.VolName, dataNode.Addr)
+		}
+		return true
+	})
+	return
+}
+
+func (c *Cluster) reportedMetaReplicas() (rr *reportedReplicas) {
+	rr = newReportedReplicas()
+	c.metaNodes.Range(func(addr, node interface{}) bool {
+		metaNode := node.(*MetaNode)
+		metaNode.RLock()
+		defer metaNode.RUnlock()
+		if !metaNode.IsActive || metaNode.ReportTime.IsZero() {
+			rr.inactive[metaNode.Addr] = true
+			return true
+		}
+		for _, report := range metaNode.metaPartitionInfos {
+			rr.add(report.PartitionID, report.VolName, metaNode.Addr)
+		}
+		return true
+	})
+	return
+}
+
+// placementDiff cross-references the hosts of the partitions with the partitions reported by the nodes in the latest
+// heartbeats, and lists the partitions whose actual replicas diverge from the hosts. The partitions of all the
+// volumes are checked if volName is empty.
+func (c *Cluster) placementDiff(volName string, checkData, checkMeta bool) (report *proto.PlacementDiffReport) {
+	report = &proto.PlacementDiffReport{
+		InactiveDataNodes: make([]string, 0),
+		InactiveMetaNodes: make([]string, 0),
+		Diffs:             make([]*proto.PartitionPlacementDiff, 0),
+	}
+	vols := c.copyVols()
+	if checkData {
+		rr := c.reportedDataReplicas()
+		for _, vol := range vols {
+			for _, dp := range vol.cloneDataPartitionMap() {
+				dp.RLock()
+				hosts := append([]string{}, dp.Hosts...)
+				dp.RUnlock()
+				d := rr.diff(dp.PartitionID, proto.PartitionTypeData, vol.Name, hosts)
+				if volName != "" && vol.Name != volName {
+					continue
+				}
+				report.CheckedDataPartitions++
+				if d != nil {
+					report.Diffs = append(report.Diffs, d)
+				}
+			}
+		}
+		report.Diffs = append(report.Diffs, rr.orphans(proto.PartitionTypeData, volName)...)
+		report.InactiveDataNodes = rr.inactiveNodes()
+	}
+	if checkMeta {
+		rr := c.reportedMetaReplicas()
+		for _, vol := range vols {
+			for _, mp := range vol.cloneMetaPartitionMap() {
+				mp.RLock()
+				hosts := append([]string{}, mp.Hosts...)
+				mp.RUnlock()
+				d := rr.diff(mp.PartitionID, proto.PartitionTypeMeta, vol.Name, hosts)
+				if volName != "" && vol.Name != volName {
+					continue
+				}
+				report.CheckedMetaPartitions++
+				if d != nil {
+					report.Diffs = append(report.Diffs, d)
+				}
+			}
+		}
+		report.Diffs = append(report.Diffs, rr.orphans(proto.PartitionTypeMeta, volName)...)
+		report.InactiveMetaNodes = rr.inactiveNodes()
+	}
+	sort.Slice(report.Diffs, func(i, j int) bool {
+		if report.Diffs[i].PartitionType != report.Diffs[j].PartitionType {
+			return report.Diffs[i].PartitionType < report.Diffs[j].PartitionType
+		}
+		return report.Diffs[i].PartitionID < report.Diffs[j].PartitionID
+	})
+	return
+}
+
+func (m *Server) getPlacementDiff(w http.ResponseWriter, r *http.Request) {
+	var (
+		volName   string
+		checkData bool
+		checkMeta bool
+		err       error
+	)
+	if err = r.ParseForm(); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	volName = r.FormValue(nameKey)
+	if volName != "" {
+		if _, err = m.cluster.getVol(volName); err != nil {
+			sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+			return
+		}
+	}
+	switch partitionType := r.FormValue(partitionTypeKey); partitionType {
+	case "":
+		checkData, checkMeta = true, true
+	case proto.PartitionTypeData:
+		checkData = true
+	case proto.PartitionTypeMeta:
+		checkMeta = true
+	default:
+		err = fmt.Errorf("parameter %v should be %v or %v", partitionTypeKey, proto.PartitionTypeData, proto.PartitionTypeMeta)
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.placementDiff(volName, checkData, checkMeta)))
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
+	"github.com/chubaofs/chubaofs/util/preflight"
+)
+
+// Preflight checks the config of the master and its environment without starting it.
+func Preflight(cfg *config.Config) *preflight.Report {
+	return preflightCheck(cfg)
+}
+
+func preflightCheck(cfg *config.Config, ownPorts ...string) (r *preflight.Report) {
+	r = preflight.NewReport(ModuleName, ownPorts...)
+	if !r.Required(cfg, ClusterName, ID, IP, proto.ListenPort, WalDir, StoreDir, cfgPeers) {
+		return
+	}
+	id, err := strconv.ParseUint(cfg.GetString(ID), 10, 64)
+	r.Add(preflight.CheckConfig, ID, err)
+	_, err = cryptoutil.Base64Decode(cfg.GetString(SecretKey))
+	r.Add(preflight.CheckConfig, SecretKey, err)
+
+	heartbeatPort, replicaPort := cfg.GetInt64(heartbeatPortKey), cfg.GetInt64(replicaPortKey)
+	if heartbeatPort <= 1024 {
+		heartbeatPort = raftstore.DefaultHeartbeatPort
+	}
+	if replicaPort <= 1024 {
+		replicaPort = raftstore.DefaultReplicaPort
+	}
+	r.Port(cfg.GetString(proto.ListenPort))
+	r.Port(strconv.FormatInt(heartbeatPort, 10))
+	r.Port(strconv.FormatInt(replicaPort, 10))
+
+	var isPeer bool
+	for _, peerAddr := range strings.Split(cfg.GetString(cfgPeers), commaSplit) {
+		// id:ip:port
+		arr := strings.Split(peerAddr, colonSplit)
+		if len(arr) != 3 {
+			r.Add(preflight.CheckConfig, cfgPeers, fmt.Errorf("invalid peer %v", peerAddr))
+			continue
+		}
+		peerID, _, _, err := parsePeerAddr(peerAddr)
+		if err != nil {
+			r.Add(preflight.CheckConfig, cfgPeers, fmt.Errorf("invalid peer %v: %v", peerAddr, err))
+			continue
+		}
+		isPeer = isPeer || peerID == id
+		r.Resolve(net.JoinHostPort(arr[1], arr[2]))
+	}
+	if !isPeer {
+		r.Add(preflight.CheckConfig, cfgPeers, fmt.Errorf("id %v is not one of the peers", id))
+	}
+
+	for _, dir := range []string{cfg.GetString(WalDir), cfg.GetString(StoreDir)} {
+		r.Dir(dir)
+		r.DiskSpace(dir, preflight.DefaultMinDiskSpace)
+	}
+	return
+}
+
+// validateConfig checks the config in the body against the environment of the master. The ports listened by the
+// master itself are taken as free.
+func (m *Server) validateConfig(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	cfg, err := config.ParseConfig(body)
+	if err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	report := preflightCheck(cfg, m.port, strconv.FormatInt(m.config.heartbeatPort, 10),
+		strconv.FormatInt(m.config.replicaPort, 10))
+	sendOkReply(w, r, newSuccessHTTPReply(report))
+}
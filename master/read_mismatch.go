@@ -0,0 +1,136 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// readMismatches keeps the latest mismatches of the reads verified by the clients, which is kept by the leader only.
+type readMismatches struct {
+	sync.RWMutex
+	reports []*proto.ReadMismatchReport
+}
+
+func newReadMismatches() *readMismatches {
+	return &readMismatches{reports: make([]*proto.ReadMismatchReport, 0)}
+}
+
+func (rm *readMismatches) add(report *proto.ReadMismatchReport) {
+	rm.Lock()
+	defer rm.Unlock()
+	rm.reports = append(rm.reports, report)
+	if len(rm.reports) > defaultMaxReadMismatches {
+		rm.reports = rm.reports[len(rm.reports)-defaultMaxReadMismatches:]
+	}
+}
+
+// list returns the mismatches of the volume and the data partition, the empty name and the zero ID match all.
+func (rm *readMismatches) list(volName string, partitionID uint64) (reports []*proto.ReadMismatchReport) {
+	rm.RLock()
+	defer rm.RUnlock()
+	reports = make([]*proto.ReadMismatchReport, 0)
+	for _, report := range rm.reports {
+		if (volName == "" || report.VolName == volName) && (partitionID == 0 || report.PartitionID == partitionID) {
+			reports = append(reports, report)
+		}
+	}
+	return
+}
+
+// reportReadMismatch records a suspected corruption reported by a client which reads different data of the same
+// range from two replicas, and alarms. It is not repaired automatically, since the corrupted replica is unknown.
+func (c *Cluster) reportReadMismatch(report *proto.ReadMismatchReport) (err error) {
+	dp, err := c.getDataPartitionByID(report.PartitionID)
+	if err != nil {
+		return
+	}
+	if dp.VolName != report.VolName {
+		return fmt.Errorf("data partition[%v] is not of vol[%v]", report.PartitionID, report.VolName)
+	}
+	if len(report.Replicas) < 2 {
+		return fmt.Errorf("a mismatch is reported with %v replicas", len(report.Replicas))
+	}
+	dp.RLock()
+	for _, replica := range report.Replicas {
+		if !dp.hasHost(replica.Addr) {
+			err = fmt.Errorf("replica[%v] is not a host of data partition[%v]", replica.Addr, dp.PartitionID)
+			break
+		}
+	}
+	dp.RUnlock()
+	if err != nil {
+		return
+	}
+	report.ReportTime = time.Now().Unix()
+	c.readMismatches.add(report)
+	crcs := make([]string, 0, len(report.Replicas))
+	for _, replica := range report.Replicas {
+		crcs = append(crcs, fmt.Sprintf("%v:%v", replica.Addr, replica.Crc))
+	}
+	Warn(c.Name, fmt.Sprintf("clusterID[%v] vol[%v] suspected corruption of dp[%v] extent[%v] offset[%v] size[%v], "+
+		"crcs%v reported by client[%v] reading inode[%v]", c.Name, report.VolName, report.PartitionID, report.ExtentID,
+		report.ExtentOffset, report.Size, crcs, report.ClientIP, report.Inode))
+	return
+}
+
+func (m *Server) reportReadMismatch(w http.ResponseWriter, r *http.Request) {
+	var (
+		body   []byte
+		report *proto.ReadMismatchReport
+		err    error
+	)
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	report = &proto.ReadMismatchReport{}
+	if err = json.Unmarshal(body, report); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	report.ClientIP = strings.Split(r.RemoteAddr, colonSplit)[0]
+	if err = m.cluster.reportReadMismatch(report); err != nil {
+		log.LogWarnf("action[reportReadMismatch] report[%+v] err[%v]", report, err)
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("read mismatch of data partition[%v] is recorded",
+		report.PartitionID)))
+}
+
+func (m *Server) getReadMismatches(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		err         error
+	)
+	if value := r.FormValue(idKey); value != "" {
+		if partitionID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: unmatchedKey(idKey).Error()})
+			return
+		}
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.readMismatches.list(r.FormValue(nameKey), partitionID)))
+}
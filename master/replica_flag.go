@@ -0,0 +1,129 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The flags of a partition, such as frozen and degraded, are persisted by the master and switched on the replicas
+// by the admin tasks. The replicas report their flags by the heartbeats, and those differing from the partition are
+// notified again by the scheduled checks.
+
+// dataReplicaFlag returns the address of a flag of the data replica.
+type dataReplicaFlag func(replica *DataReplica) *bool
+
+// metaReplicaFlag returns the address of a flag of the meta replica.
+type metaReplicaFlag func(replica *MetaReplica) *bool
+
+// notifyReplicas notifies every host of the partition, and returns the failures of them all.
+func notifyReplicas(partitionType string, partitionID uint64, hosts []string, notify func(addr string) error) (err error) {
+	failures := make([]string, 0)
+	for _, host := range hosts {
+		if err = notify(host); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", host, err))
+		}
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("failed to notify the replicas of %v[%v], [%v]", partitionType, partitionID, strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// syncDataReplicaFlag sends the task switching the flag to the data replica, and takes the flag once the replica
+// succeeds, before it is reported by the heartbeat, so that the replica is not notified again.
+func (c *Cluster) syncDataReplicaFlag(dp *DataPartition, addr string, task *proto.AdminTask, flag dataReplicaFlag, value bool) (packet *proto.Packet, err error) {
+	dataNode, err := c.dataNode(addr)
+	if err != nil {
+		return
+	}
+	if packet, err = dataNode.TaskManager.syncSendAdminTask(task); err != nil {
+		return
+	}
+	dp.Lock()
+	if replica, ok := dp.hasReplica(addr); ok {
+		*flag(replica) = value
+	}
+	dp.Unlock()
+	return
+}
+
+// syncMetaReplicaFlag sends the task switching the flag to the meta replica, and takes the flag once the replica
+// succeeds, before it is reported by the heartbeat, so that the replica is not notified again.
+func (c *Cluster) syncMetaReplicaFlag(mp *MetaPartition, addr string, task *proto.AdminTask, flag metaReplicaFlag, value bool) (packet *proto.Packet, err error) {
+	metaNode, err := c.metaNode(addr)
+	if err != nil {
+		return
+	}
+	if packet, err = metaNode.Sender.syncSendAdminTask(task); err != nil {
+		return
+	}
+	mp.Lock()
+	if replica, e := mp.getMetaReplica(addr); e == nil {
+		*flag(replica) = value
+	}
+	mp.Unlock()
+	return
+}
+
+// syncDataReplicaFlags notifies the live data replicas of the volume whose reported flag differs from the value of
+// their partition again.
+func (c *Cluster) syncDataReplicaFlags(vol *Vol, action string, value func(dp *DataPartition) bool, flag dataReplicaFlag,
+	notify func(dp *DataPartition, addr string, value bool) error) {
+	for _, dp := range vol.cloneDataPartitionMap() {
+		dp.RLock()
+		expected := value(dp)
+		addrs := make([]string, 0)
+		for _, replica := range dp.getLiveReplicasFromHosts(c.cfg.dpTimeOutSec()) {
+			if *flag(replica) != expected {
+				addrs = append(addrs, replica.Addr)
+			}
+		}
+		dp.RUnlock()
+		for _, addr := range addrs {
+			if err := notify(dp, addr, expected); err != nil {
+				log.LogErrorf("action[%v] vol[%v] dp[%v] addr[%v] flag[%v] err[%v]", action, vol.Name, dp.PartitionID,
+					addr, expected, err)
+			}
+		}
+	}
+}
+
+// syncMetaReplicaFlags notifies the live meta replicas of the volume whose reported flag differs from the value of
+// their partition again.
+func (c *Cluster) syncMetaReplicaFlags(vol *Vol, action string, value func(mp *MetaPartition) bool, flag metaReplicaFlag,
+	notify func(mp *MetaPartition, addr string, value bool) error) {
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		mp.RLock()
+		expected := value(mp)
+		addrs := make([]string, 0)
+		for _, replica := range mp.getLiveReplicas() {
+			if *flag(replica) != expected {
+				addrs = append(addrs, replica.Addr)
+			}
+		}
+		mp.RUnlock()
+		for _, addr := range addrs {
+			if err := notify(mp, addr, expected); err != nil {
+				log.LogErrorf("action[%v] vol[%v] mp[%v] addr[%v] flag[%v] err[%v]", action, vol.Name, mp.PartitionID,
+					addr, expected, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyReplicas(t *testing.T) {
+	notified := make([]string, 0)
+	err := notifyReplicas("data partition", 10, []string{"a", "b", "c"}, func(addr string) error {
+		notified = append(notified, addr)
+		if addr == "b" {
+			return fmt.Errorf("refused")
+		}
+		return nil
+	})
+	if len(notified) != 3 {
+		t.Fatalf("every replica should be notified despite the failures, but only %v are", notified)
+	}
+	if err == nil || !strings.Contains(err.Error(), "data partition[10]") || !strings.Contains(err.Error(), "b: refused") ||
+		strings.Contains(err.Error(), "a:") {
+		t.Fatalf("expect the failure of replica b, but is %v", err)
+	}
+	if err = notifyReplicas("meta partition", 10, []string{"a"}, func(string) error { return nil }); err != nil {
+		t.Fatalf("unexpected err %v", err)
+	}
+}
+
+// TestSyncReplicaFlags tests that the replicas reporting a stale flag are notified again by the scheduled checks,
+// and take the flag of their partition at once.
+func TestSyncReplicaFlags(t *testing.T) {
+	if len(commonVol.dataPartitions.partitions) == 0 {
+		t.Errorf("no data partitions")
+		return
+	}
+	dp := commonVol.dataPartitions.partitions[0]
+	setDegraded := func(isDegraded bool) {
+		dp.Lock()
+		dp.isDegraded = isDegraded
+		for _, replica := range dp.Replicas {
+			replica.setAlive()
+			replica.IsDegraded = !isDegraded
+		}
+		dp.Unlock()
+	}
+	for _, isDegraded := range []bool{true, false} {
+		setDegraded(isDegraded)
+		server.cluster.syncDegradedDataReplicas(commonVol)
+		for _, replica := range dp.Replicas {
+			if replica.IsDegraded != isDegraded {
+				t.Errorf("replica[%v] of dp[%v] should be synced to isDegraded[%v]", replica.Addr, dp.PartitionID, isDegraded)
+			}
+		}
+	}
+
+	var mp *MetaPartition
+	for _, mp = range commonVol.cloneMetaPartitionMap() {
+		break
+	}
+	if mp == nil {
+		t.Errorf("no meta partitions")
+		return
+	}
+	for _, isDegraded := range []bool{true, false} {
+		mp.Lock()
+		mp.isDegraded = isDegraded
+		for _, replica := range mp.Replicas {
+			replica.ReportTime = time.Now().Unix()
+			replica.IsDegraded = !isDegraded
+		}
+		mp.Unlock()
+		server.cluster.syncDegradedMetaReplicas(commonVol)
+		for _, replica := range mp.Replicas {
+			if replica.IsDegraded != isDegraded {
+				t.Errorf("replica[%v] of mp[%v] should be synced to isDegraded[%v]", replica.Addr, mp.PartitionID, isDegraded)
+			}
+		}
+	}
+
+	// the meta replicas follow the flag of the volume
+	mp.Lock()
+	for _, replica := range mp.Replicas {
+		replica.ReportTime = time.Now().Unix()
+		replica.IsFrozen = !commonVol.isFrozen()
+	}
+	mp.Unlock()
+	server.cluster.syncFrozenMetaReplicas(commonVol)
+	for _, replica := range mp.Replicas {
+		if replica.IsFrozen != commonVol.isFrozen() {
+			t.Errorf("replica[%v] of mp[%v] should be synced to isFrozen[%v]", replica.Addr, mp.PartitionID, commonVol.isFrozen())
+		}
+	}
+}
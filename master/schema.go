@@ -0,0 +1,189 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// currentSchemaVersion is the version of the values written by this master. The records written by an older master
+// carry an older version (0 if they were written before the versioning), and are upgraded by the migrations when they
+// are loaded. Bump it and register the migrations of the changed values whenever the meaning of a persisted field
+// changes; adding a field with a usable zero value needs no migration.
+const currentSchemaVersion = 1
+
+// schemaMigration upgrades a record decoded from the store by one version in place.
+type schemaMigration func(record map[string]interface{}) error
+
+// schemaMigrations holds the migrations of each kind of value, keyed by the acronym of the kind and then by the
+// version upgraded from. A missing migration means the kind is unchanged by that version.
+var schemaMigrations = map[string]map[int]schemaMigration{
+	dataNodeAcronym: {0: migrateDefaultZoneName},
+	metaNodeAcronym: {0: migrateDefaultZoneName},
+	nodeSetAcronym:  {0: migrateDefaultZoneName},
+}
+
+// migrateDefaultZoneName places the nodes and the node sets created before the zones into the default zone.
+func migrateDefaultZoneName(record map[string]interface{}) error {
+	if zoneName, _ := record["ZoneName"].(string); zoneName == "" {
+		record["ZoneName"] = DefaultZoneName
+	}
+	return nil
+}
+
+// schemaState tracks the schema version of the store and the records upgraded by the last load.
+type schemaState struct {
+	sync.Mutex
+	stored   int
+	migrated map[string]int // acronym -> number of the records upgraded when loaded
+}
+
+func newSchemaState() *schemaState {
+	return &schemaState{migrated: make(map[string]int)}
+}
+
+func (s *schemaState) reset(stored int) {
+	s.Lock()
+	defer s.Unlock()
+	s.stored = stored
+	s.migrated = make(map[string]int)
+}
+
+func (s *schemaState) addMigrated(acronym string) {
+	s.Lock()
+	defer s.Unlock()
+	s.migrated[acronym]++
+}
+
+func (s *schemaState) setStored(version int) {
+	s.Lock()
+	defer s.Unlock()
+	s.stored = version
+}
+
+func (s *schemaState) view() *proto.SchemaVersionView {
+	s.Lock()
+	defer s.Unlock()
+	view := &proto.SchemaVersionView{
+		Current:  currentSchemaVersion,
+		Stored:   s.stored,
+		Migrated: make(map[string]int),
+	}
+	for acronym, count := range s.migrated {
+		view.Migrated[acronym] = count
+	}
+	return view
+}
+
+// migrateRecord upgrades a record of the given kind to the current version. The record is returned as is if it is
+// up to date, or written by a newer master whose changes this master cannot undo.
+func migrateRecord(acronym string, raw []byte) (migrated []byte, upgraded bool, err error) {
+	header := struct{ SchemaVersion int }{}
+	if err = json.Unmarshal(raw, &header); err != nil {
+		return
+	}
+	if header.SchemaVersion >= currentSchemaVersion {
+		if header.SchemaVersion > currentSchemaVersion {
+			log.LogWarnf("action[migrateRecord] kind[%v] version[%v] is newer than[%v]",
+				acronym, header.SchemaVersion, currentSchemaVersion)
+		}
+		return raw, false, nil
+	}
+	record := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	// keep the numbers as they are, the IDs do not fit into a float64
+	decoder.UseNumber()
+	if err = decoder.Decode(&record); err != nil {
+		return
+	}
+	for version := header.SchemaVersion; version < currentSchemaVersion; version++ {
+		migration, ok := schemaMigrations[acronym][version]
+		if !ok {
+			continue
+		}
+		if err = migration(record); err != nil {
+			err = fmt.Errorf("migrate kind[%v] from version[%v] failed: %v", acronym, version, err)
+			return
+		}
+	}
+	record["SchemaVersion"] = currentSchemaVersion
+	if migrated, err = json.Marshal(record); err != nil {
+		return
+	}
+	return migrated, true, nil
+}
+
+// decodeRecord upgrades a record loaded from the store and unmarshals it into value.
+func (c *Cluster) decodeRecord(acronym string, raw []byte, value interface{}) (err error) {
+	migrated, upgraded, err := migrateRecord(acronym, raw)
+	if err != nil {
+		return
+	}
+	if upgraded {
+		c.schema.addMigrated(acronym)
+	}
+	return json.Unmarshal(migrated, value)
+}
+
+func (c *Cluster) loadSchemaVersion() (err error) {
+	value, err := c.fsm.store.Get(schemaVersionKey)
+	if err != nil {
+		return fmt.Errorf("action[loadSchemaVersion],err:%v", err.Error())
+	}
+	var stored int
+	if raw := value.([]byte); len(raw) != 0 {
+		if stored, err = strconv.Atoi(string(raw)); err != nil {
+			return fmt.Errorf("action[loadSchemaVersion],value:%v,err:%v", string(raw), err.Error())
+		}
+	}
+	c.schema.reset(stored)
+	if stored > currentSchemaVersion {
+		Warn(c.Name, fmt.Sprintf("action[loadSchemaVersion] stored schema version[%v] is newer than[%v] of this master, "+
+			"the fields added since are lost once the records are updated", stored, currentSchemaVersion))
+	}
+	log.LogInfof("action[loadSchemaVersion] stored[%v],current[%v]", stored, currentSchemaVersion)
+	return
+}
+
+// upgradeSchemaVersion raises the schema version of the store to the one of the leader, which marks that the records
+// of the current version may have been written. The records themselves are upgraded lazily once they are updated.
+func (c *Cluster) upgradeSchemaVersion() {
+	if c.schema.view().Stored >= currentSchemaVersion {
+		return
+	}
+	metadata := &RaftCmd{
+		Op: opSyncPutSchemaVersion,
+		K:  schemaVersionKey,
+		V:  []byte(strconv.Itoa(currentSchemaVersion)),
+	}
+	if err := c.submit(metadata); err != nil {
+		log.LogErrorf("action[upgradeSchemaVersion] err:%v", err.Error())
+		return
+	}
+	c.schema.setStored(currentSchemaVersion)
+	log.LogWarnf("action[upgradeSchemaVersion] schema version is upgraded to[%v]", currentSchemaVersion)
+}
+
+func (m *Server) getSchemaVersion(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.schema.view()))
+}
@@ -46,8 +46,6 @@ const (
 	ModuleName        = "master"
 	CfgRetainLogs     = "retainLogs"
 	DefaultRetainLogs = 20000
-	cfgTickInterval   = "tickInterval"
-	cfgElectionTick   = "electionTick"
 	SecretKey         = "masterServiceKey"
 )
 
@@ -69,8 +67,7 @@ type Server struct {
 	walDir       string
 	storeDir     string
 	retainLogs   uint64
-	tickInterval int
-	electionTick int
+	raftTimings  raftstore.Timings
 	leaderInfo   *LeaderInfo
 	config       *clusterConfig
 	cluster      *Cluster
@@ -206,6 +203,9 @@ func (m *Server) checkConfig(cfg *config.Config) (err error) {
 		}
 	}
 
+	if err = m.parseHeartbeatConfig(cfg); err != nil {
+		return
+	}
 	dataPartitionTimeOutSec := cfg.GetString(dataPartitionTimeOutSec)
 	if dataPartitionTimeOutSec != "" {
 		if m.config.DataPartitionTimeOutSec, err = strconv.ParseInt(dataPartitionTimeOutSec, 10, 0); err != nil {
@@ -222,18 +222,66 @@ func (m *Server) checkConfig(cfg *config.Config) (err error) {
 	if m.config.numberOfDataPartitionsToLoad <= 40 {
 		m.config.numberOfDataPartitionsToLoad = 40
 	}
+	if gracePeriodSec := cfg.GetString(spareDataNodeGracePeriodSec); gracePeriodSec != "" {
+		if m.config.SpareDataNodeGracePeriodSec, err = strconv.ParseInt(gracePeriodSec, 10, 64); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
+	if lifecycleInterval := cfg.GetString(intervalToRunLifecycle); lifecycleInterval != "" {
+		if m.config.IntervalToRunLifecycle, err = strconv.ParseInt(lifecycleInterval, 10, 64); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
+	if gracePeriodSec := cfg.GetString(volDeleteGracePeriodSec); gracePeriodSec != "" {
+		if m.config.VolDeleteGracePeriodSec, err = strconv.ParseInt(gracePeriodSec, 10, 64); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
+	if orphanInterval := cfg.GetString(intervalToCheckOrphanExtents); orphanInterval != "" {
+		if m.config.IntervalToCheckOrphanExtents, err = strconv.ParseInt(orphanInterval, 10, 64); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
+	if safetySec := cfg.GetString(orphanExtentSafetySec); safetySec != "" {
+		if m.config.OrphanExtentSafetySec, err = strconv.ParseInt(safetySec, 10, 64); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+		if m.config.OrphanExtentSafetySec < minOrphanExtentSafetySec {
+			return fmt.Errorf("%v,err:%v must be at least %v", proto.ErrInvalidCfg, orphanExtentSafetySec,
+				minOrphanExtentSafetySec)
+		}
+	}
+	if minTinyExtents := cfg.GetString(minAvailTinyExtents); minTinyExtents != "" {
+		if m.config.MinAvailTinyExtents, err = strconv.Atoi(minTinyExtents); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
+	if err = m.parseDpCreationConfig(cfg); err != nil {
+		return
+	}
+	if clockSkewSec := cfg.GetString(maxNodeClockSkewSec); clockSkewSec != "" {
+		if m.config.MaxNodeClockSkewSec, err = strconv.ParseInt(clockSkewSec, 10, 64); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
+	if m.config.nodeToken = cfg.GetString(proto.NodeToken); m.config.nodeToken == "" {
+		log.LogWarnf("action[checkConfig] %v is not configured, the node APIs are open to the external users", proto.NodeToken)
+	}
+	m.config.tokenSigningKey = cfg.GetString(proto.TokenSigningKey)
+	m.config.TransferStalledMetaLeader = cfg.GetBool(transferStalledMetaLeader)
 	if secondsToFreeDP := cfg.GetString(secondsToFreeDataPartitionAfterLoad); secondsToFreeDP != "" {
 		if m.config.secondsToFreeDataPartitionAfterLoad, err = strconv.ParseInt(secondsToFreeDP, 10, 64); err != nil {
 			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
 		}
 	}
-	m.tickInterval = int(cfg.GetFloat(cfgTickInterval))
-	m.electionTick = int(cfg.GetFloat(cfgElectionTick))
-	if m.tickInterval <= 300 {
-		m.tickInterval = 500
+	if m.raftTimings, err = raftstore.LoadTimings(cfg); err != nil {
+		return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+	}
+	if m.raftTimings.TickInterval <= 300 {
+		m.raftTimings.TickInterval = 500
 	}
-	if m.electionTick <= 3 {
-		m.electionTick = 5
+	if m.raftTimings.ElectionTick <= 3 {
+		m.raftTimings.ElectionTick = 5
 	}
 	return
 }
@@ -245,13 +293,15 @@ func (m *Server) createRaftServer() (err error) {
 		NumOfLogsToRetain: m.retainLogs,
 		HeartbeatPort:     int(m.config.heartbeatPort),
 		ReplicaPort:       int(m.config.replicaPort),
-		TickInterval:      m.tickInterval,
-		ElectionTick:      m.electionTick,
+		TickInterval:      m.raftTimings.TickInterval,
+		HeartbeatTick:     m.raftTimings.HeartbeatTick,
+		ElectionTick:      m.raftTimings.ElectionTick,
+		MaxInflightMsgs:   m.raftTimings.MaxInflightMsgs,
 	}
 	if m.raftStore, err = raftstore.NewRaftStore(raftCfg); err != nil {
 		return errors.Trace(err, "NewRaftStore failed! id[%v] walPath[%v]", m.id, m.walDir)
 	}
-	syslog.Printf("peers[%v],tickInterval[%v],electionTick[%v]\n", m.config.peers, m.tickInterval, m.electionTick)
+	syslog.Printf("peers[%v],raftTimings[%+v]\n", m.config.peers, m.raftStore.Timings())
 	m.initFsm()
 	partitionCfg := &raftstore.PartitionConfig{
 		ID:      GroupID,
@@ -0,0 +1,134 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// snapshotDiff lists the changes of the namespace of the volume between its views as of from and to, which are
+// served by the snapshots retained by the leaders of the meta partitions. The partitions are diffed in the order of
+// their IDs, and the marker "<partition id>:<marker of the partition>" resumes the listing of the previous page.
+func (c *Cluster) snapshotDiff(vol *Vol, from, to int64, marker string, limit int) (diff *proto.SnapshotDiff, err error) {
+	startID, mpMarker, err := parseSnapshotDiffMarker(marker)
+	if err != nil {
+		return
+	}
+	diff = &proto.SnapshotDiff{VolName: vol.Name, From: from, To: to, Entries: make([]*proto.SnapshotDiffEntry, 0)}
+	mps := make([]*MetaPartition, 0)
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		if mp.PartitionID >= startID {
+			mps = append(mps, mp)
+		}
+	}
+	sort.Slice(mps, func(i, j int) bool { return mps[i].PartitionID < mps[j].PartitionID })
+	for i, mp := range mps {
+		if mp.PartitionID != startID {
+			mpMarker = ""
+		}
+		if len(diff.Entries) >= limit {
+			diff.NextMarker = fmt.Sprintf("%v:", mps[i].PartitionID)
+			return
+		}
+		req := &proto.SnapshotDiffRequest{
+			VolName:     vol.Name,
+			PartitionID: mp.PartitionID,
+			From:        from,
+			To:          to,
+			Marker:      mpMarker,
+			Limit:       limit - len(diff.Entries),
+		}
+		resp := &proto.SnapshotDiffResponse{}
+		if _, err = c.requestMetaPartition(mp, proto.OpMetaSnapshotDiff, req, resp); err != nil {
+			return nil, fmt.Errorf("diff meta partition[%v]: %v", mp.PartitionID, err)
+		}
+		for _, entry := range resp.Entries {
+			entry.PartitionID = mp.PartitionID
+		}
+		diff.Entries = append(diff.Entries, resp.Entries...)
+		if resp.NextMarker != "" {
+			diff.NextMarker = fmt.Sprintf("%v:%v", mp.PartitionID, resp.NextMarker)
+			return
+		}
+	}
+	return
+}
+
+func parseSnapshotDiffMarker(marker string) (partitionID uint64, mpMarker string, err error) {
+	if marker == "" {
+		return
+	}
+	parts := strings.SplitN(marker, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid %v[%v]", markerKey, marker)
+	}
+	if partitionID, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, "", fmt.Errorf("invalid %v[%v]", markerKey, marker)
+	}
+	return partitionID, parts[1], nil
+}
+
+func (m *Server) getVolSnapshotDiff(w http.ResponseWriter, r *http.Request) {
+	var (
+		name     string
+		authKey  string
+		from, to int64
+		limit    = defaultSnapshotDiffLimit
+		vol      *Vol
+		diff     *proto.SnapshotDiff
+		err      error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if from, err = strconv.ParseInt(r.FormValue(fromKey), 10, 64); err != nil || from <= 0 {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", fromKey, r.FormValue(fromKey))})
+		return
+	}
+	if value := r.FormValue(toKey); value != "" {
+		if to, err = strconv.ParseInt(value, 10, 64); err != nil || to < from {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", toKey, value)})
+			return
+		}
+	}
+	if value := r.FormValue(limitKey); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", limitKey, value)})
+			return
+		}
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	if !matchKey(vol.Owner, authKey) {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolAuthKeyNotMatch))
+		return
+	}
+	if diff, err = m.cluster.snapshotDiff(vol, from, to, r.FormValue(markerKey), limit); err != nil {
+		log.LogWarnf("action[getVolSnapshotDiff] vol[%v] from[%v] to[%v] err[%v]", name, from, to, err)
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(diff))
+}
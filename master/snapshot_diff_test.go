@@ -0,0 +1,87 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	name := "snapshotDiffVol"
+	createVol(name, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.cluster.checkMetaNodeHeartbeat()
+	time.Sleep(5 * time.Second)
+	mpCount := len(vol.cloneMetaPartitionMap())
+
+	diff, err := server.cluster.snapshotDiff(vol, 100, 0, "", defaultSnapshotDiffLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Entries) != 2*mpCount || diff.NextMarker != "" {
+		t.Fatalf("expect %v entries of %v partitions, but is %v, next marker[%v]", 2*mpCount, mpCount,
+			len(diff.Entries), diff.NextMarker)
+	}
+	for i := 1; i < len(diff.Entries); i++ {
+		if diff.Entries[i].PartitionID < diff.Entries[i-1].PartitionID {
+			t.Fatalf("the partitions should be diffed in order, %v after %v", diff.Entries[i].PartitionID,
+				diff.Entries[i-1].PartitionID)
+		}
+	}
+
+	var (
+		pages  int
+		marker string
+		listed []string
+	)
+	for {
+		page, err := server.cluster.snapshotDiff(vol, 100, 200, marker, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Entries {
+			listed = append(listed, fmt.Sprintf("%v %v/%v", e.PartitionID, e.Type, e.Name))
+		}
+		pages++
+		if marker = page.NextMarker; marker == "" {
+			break
+		}
+	}
+	expected := make([]string, 0)
+	for _, e := range diff.Entries {
+		expected = append(expected, fmt.Sprintf("%v %v/%v", e.PartitionID, e.Type, e.Name))
+	}
+	if fmt.Sprint(listed) != fmt.Sprint(expected) || pages < 2*mpCount {
+		t.Fatalf("expect %v paged by 1, but is %v in %v pages", expected, listed, pages)
+	}
+
+	if _, err = server.cluster.snapshotDiff(vol, 1, 0, "", defaultSnapshotDiffLimit); err == nil {
+		t.Errorf("the diff from a snapshot not retained should fail")
+	}
+	if _, err = server.cluster.snapshotDiff(vol, 100, 0, "bad", defaultSnapshotDiffLimit); err == nil {
+		t.Errorf("the bad marker should be refused")
+	}
+
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&from=100&limit=1", hostAddr, proto.AdminVolSnapshotDiff, name,
+		buildAuthKey(vol.Owner))
+	process(reqURL, t)
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// spareMigration records the spare data node promoted to take over the data partitions of a dead data node.
+type spareMigration struct {
+	deadAddr  string
+	spareAddr string
+	running   int32
+}
+
+func (c *Cluster) scheduleToCheckSpareDataNodes() {
+	go func() {
+		// the time when each data node is found inactive, which is kept by the leader only
+		deadSince := make(map[string]time.Time)
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.checkSpareDataNodes(deadSince)
+			} else if len(deadSince) != 0 {
+				deadSince = make(map[string]time.Time)
+			}
+			time.Sleep(c.cfg.heartbeat.interval())
+		}
+	}()
+}
+
+// checkSpareDataNodes promotes a spare data node in the same zone if a data node has been inactive longer than
+// the grace period, and migrates the data partitions of the dead data node to the spare one.
+func (c *Cluster) checkSpareDataNodes(deadSince map[string]time.Time) {
+	now := time.Now()
+	gracePeriod := time.Second * time.Duration(c.cfg.SpareDataNodeGracePeriodSec)
+	c.dataNodes.Range(func(addr, value interface{}) bool {
+		dataNode := value.(*DataNode)
+		dataNode.RLock()
+		isActive, isSpare := dataNode.isActive, dataNode.IsSpare
+		dataNode.RUnlock()
+		if isActive || isSpare {
+			delete(deadSince, dataNode.Addr)
+			c.spareMigrations.Delete(dataNode.Addr)
+			return true
+		}
+		since, ok := deadSince[dataNode.Addr]
+		if !ok {
+			deadSince[dataNode.Addr] = now
+			return true
+		}
+		if now.Sub(since) < gracePeriod {
+			return true
+		}
+		c.takeOverDeadDataNode(dataNode)
+		return true
+	})
+}
+
+func (c *Cluster) takeOverDeadDataNode(dataNode *DataNode) {
+	if c.DisableAutoPromoteSpare {
+		return
+	}
+	partitions := c.getAllDataPartitionByDataNode(dataNode.Addr)
+	if len(partitions) == 0 {
+		c.spareMigrations.Delete(dataNode.Addr)
+		return
+	}
+	value, ok := c.spareMigrations.Load(dataNode.Addr)
+	if !ok {
+		spare, err := c.promoteSpareDataNode(dataNode.ZoneName)
+		if err != nil {
+			Warn(c.Name, fmt.Sprintf("action[takeOverDeadDataNode] clusterID[%v] dataNode[%v] is dead, "+
+				"no spare data node is promoted, err[%v]", c.Name, dataNode.Addr, err))
+			return
+		}
+		Warn(c.Name, fmt.Sprintf("action[takeOverDeadDataNode] clusterID[%v] dataNode[%v] is dead, "+
+			"spare dataNode[%v] is promoted to take over [%v] data partitions", c.Name, dataNode.Addr, spare.Addr, len(partitions)))
+		value, _ = c.spareMigrations.LoadOrStore(dataNode.Addr, &spareMigration{deadAddr: dataNode.Addr, spareAddr: spare.Addr})
+	}
+	migration := value.(*spareMigration)
+	if !atomic.CompareAndSwapInt32(&migration.running, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&migration.running, 0)
+		c.migrateDataPartitionsToSpare(migration, partitions)
+	}()
+}
+
+// promoteSpareDataNode selects the active spare data node with the most available space in the zone,
+// and makes it able to receive data partitions.
+func (c *Cluster) promoteSpareDataNode(zoneName string) (spare *DataNode, err error) {
+	c.dnMutex.Lock()
+	defer c.dnMutex.Unlock()
+	c.dataNodes.Range(func(addr, value interface{}) bool {
+		dataNode := value.(*DataNode)
+		dataNode.RLock()
+		defer dataNode.RUnlock()
+		if !dataNode.IsSpare || !dataNode.isActive || dataNode.ZoneName != zoneName {
+			return true
+		}
+		if spare == nil || dataNode.AvailableSpace > spare.AvailableSpace {
+			spare = dataNode
+		}
+		return true
+	})
+	if spare == nil {
+		err = fmt.Errorf("no active spare data node in zone[%v]", zoneName)
+		return
+	}
+	if err = c.updateDataNodeSpare(spare, false); err != nil {
+		return
+	}
+	return
+}
+
+func (c *Cluster) migrateDataPartitionsToSpare(migration *spareMigration, partitions []*DataPartition) {
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	for _, dp := range partitions {
+		wg.Add(1)
+		go func(dp *DataPartition) {
+			defer wg.Done()
+			if err := c.decommissionDataPartitionToTarget(migration.deadAddr, dp, spareDataNodeTakeOverErr, migration.spareAddr); err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		}(dp)
+	}
+	wg.Wait()
+	msg := fmt.Sprintf("action[migrateDataPartitionsToSpare] clusterID[%v] dataNode[%v] spare dataNode[%v] "+
+		"migrated [%v] data partitions, failed [%v]", c.Name, migration.deadAddr, migration.spareAddr, len(partitions), failed)
+	if failed > 0 {
+		Warn(c.Name, msg)
+		return
+	}
+	log.LogWarn(msg)
+}
+
+// setDataNodeSpare lets the operator mark a data node without data partitions as spare, or promote a spare data node manually.
+func (c *Cluster) setDataNodeSpare(dataNode *DataNode, isSpare bool) (err error) {
+	if isSpare && len(c.getAllDataPartitionIDByDatanode(dataNode.Addr)) != 0 {
+		return fmt.Errorf("dataNode[%v] has data partitions, can not be spare", dataNode.Addr)
+	}
+	c.dnMutex.Lock()
+	defer c.dnMutex.Unlock()
+	return c.updateDataNodeSpare(dataNode, isSpare)
+}
+
+// updateDataNodeSpare should be protected by dnMutex.
+func (c *Cluster) updateDataNodeSpare(dataNode *DataNode, isSpare bool) (err error) {
+	dataNode.Lock()
+	oldFlag := dataNode.IsSpare
+	dataNode.IsSpare = isSpare
+	dataNode.Unlock()
+	if err = c.syncUpdateDataNode(dataNode); err != nil {
+		dataNode.Lock()
+		dataNode.IsSpare = oldFlag
+		dataNode.Unlock()
+		return
+	}
+	log.LogWarnf("action[updateDataNodeSpare] clusterID[%v] dataNode[%v] spare[%v]", c.Name, dataNode.Addr, isSpare)
+	return
+}
+
+func (c *Cluster) isDataNodeWritableTarget(addr string, dp *DataPartition) bool {
+	dataNode, err := c.dataNode(addr)
+	if err != nil || !dataNode.isWriteAble() {
+		return false
+	}
+	dp.RLock()
+	defer dp.RUnlock()
+	return !dp.hasHost(addr)
+}
@@ -0,0 +1,237 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+type nodeStats struct {
+	addr       string
+	role       string
+	zone       string
+	rack       string
+	reportTime int64
+	stats      proto.StorageStats
+}
+
+type rackStats struct {
+	stats proto.StorageStats
+	nodes map[string]*nodeStats // role/address -> the node
+}
+
+type zoneStats struct {
+	stats proto.StorageStats
+	racks map[string]*rackStats
+}
+
+// statsTree rolls up the statistics of the nodes by zone, rack and node. A heartbeat replaces the contribution of the
+// node to its rack, its zone and the cluster instead of summing up all the nodes, so that the tree is not recomputed
+// for each request in a large cluster. It is fed by the heartbeats to the leader only, so it is empty on a follower
+// and fills up within a heartbeat interval after the leader is changed. The nodes without a rack are in the rack named
+// by an empty string.
+type statsTree struct {
+	sync.RWMutex
+	total proto.StorageStats
+	zones map[string]*zoneStats
+	nodes map[string]*nodeStats // role/address -> the node
+}
+
+func newStatsTree() *statsTree {
+	return &statsTree{zones: make(map[string]*zoneStats), nodes: make(map[string]*nodeStats)}
+}
+
+func addStorageStats(to *proto.StorageStats, s *proto.StorageStats) {
+	to.DataNodes += s.DataNodes
+	to.DataTotal += s.DataTotal
+	to.DataUsed += s.DataUsed
+	to.DataPartitionCount += s.DataPartitionCount
+	to.MetaNodes += s.MetaNodes
+	to.MetaTotal += s.MetaTotal
+	to.MetaUsed += s.MetaUsed
+	to.MetaPartitionCount += s.MetaPartitionCount
+}
+
+func subStorageStats(from *proto.StorageStats, s *proto.StorageStats) {
+	from.DataNodes -= s.DataNodes
+	from.DataTotal -= s.DataTotal
+	from.DataUsed -= s.DataUsed
+	from.DataPartitionCount -= s.DataPartitionCount
+	from.MetaNodes -= s.MetaNodes
+	from.MetaTotal -= s.MetaTotal
+	from.MetaUsed -= s.MetaUsed
+	from.MetaPartitionCount -= s.MetaPartitionCount
+}
+
+func statsKey(role, addr string) string {
+	return role + "/" + addr
+}
+
+func (t *statsTree) update(node *nodeStats) {
+	t.Lock()
+	defer t.Unlock()
+	key := statsKey(node.role, node.addr)
+	t.removeLocked(key)
+	zone, ok := t.zones[node.zone]
+	if !ok {
+		zone = &zoneStats{racks: make(map[string]*rackStats)}
+		t.zones[node.zone] = zone
+	}
+	rack, ok := zone.racks[node.rack]
+	if !ok {
+		rack = &rackStats{nodes: make(map[string]*nodeStats)}
+		zone.racks[node.rack] = rack
+	}
+	rack.nodes[key] = node
+	addStorageStats(&rack.stats, &node.stats)
+	addStorageStats(&zone.stats, &node.stats)
+	addStorageStats(&t.total, &node.stats)
+	t.nodes[key] = node
+}
+
+func (t *statsTree) remove(role, addr string) {
+	t.Lock()
+	defer t.Unlock()
+	t.removeLocked(statsKey(role, addr))
+}
+
+// removeLocked takes the contribution of the node off the tree, and drops its rack and its zone once they are empty.
+func (t *statsTree) removeLocked(key string) {
+	node, ok := t.nodes[key]
+	if !ok {
+		return
+	}
+	delete(t.nodes, key)
+	zone := t.zones[node.zone]
+	rack := zone.racks[node.rack]
+	delete(rack.nodes, key)
+	subStorageStats(&rack.stats, &node.stats)
+	subStorageStats(&zone.stats, &node.stats)
+	subStorageStats(&t.total, &node.stats)
+	if len(rack.nodes) == 0 {
+		delete(zone.racks, node.rack)
+	}
+	if len(zone.racks) == 0 {
+		delete(t.zones, node.zone)
+	}
+}
+
+func (t *statsTree) clear() {
+	t.Lock()
+	defer t.Unlock()
+	t.total = proto.StorageStats{}
+	t.zones = make(map[string]*zoneStats)
+	t.nodes = make(map[string]*nodeStats)
+}
+
+func sortStatsTreeNodes(nodes []*proto.StatsTreeNode) []*proto.StatsTreeNode {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].Role < nodes[j].Role
+	})
+	return nodes
+}
+
+// view returns the tree down to the level, of the zone only if zoneName is not empty.
+func (t *statsTree) view(clusterName, zoneName, level string) (root *proto.StatsTreeNode) {
+	t.RLock()
+	defer t.RUnlock()
+	root = &proto.StatsTreeNode{Name: clusterName, Level: proto.StatsLevelCluster, StorageStats: t.total}
+	if level == proto.StatsLevelCluster {
+		return
+	}
+	for name, zone := range t.zones {
+		if zoneName != "" && name != zoneName {
+			continue
+		}
+		zoneView := &proto.StatsTreeNode{Name: name, Level: proto.StatsLevelZone, StorageStats: zone.stats}
+		root.Children = append(root.Children, zoneView)
+		if level == proto.StatsLevelZone {
+			continue
+		}
+		for rackName, rack := range zone.racks {
+			rackView := &proto.StatsTreeNode{Name: rackName, Level: proto.StatsLevelRack, StorageStats: rack.stats}
+			zoneView.Children = append(zoneView.Children, rackView)
+			if level == proto.StatsLevelRack {
+				continue
+			}
+			for _, node := range rack.nodes {
+				rackView.Children = append(rackView.Children, &proto.StatsTreeNode{Name: node.addr,
+					Level: proto.StatsLevelNode, Role: node.role, ReportTime: node.reportTime, StorageStats: node.stats})
+			}
+			sortStatsTreeNodes(rackView.Children)
+		}
+		sortStatsTreeNodes(zoneView.Children)
+	}
+	sortStatsTreeNodes(root.Children)
+	return
+}
+
+func (c *Cluster) updateDataNodeStats(dataNode *DataNode) {
+	dataNode.RLock()
+	node := &nodeStats{
+		addr:       dataNode.Addr,
+		role:       proto.NodeRoleData,
+		zone:       dataNode.ZoneName,
+		rack:       dataNode.Rack,
+		reportTime: dataNode.ReportTime.Unix(),
+		stats: proto.StorageStats{
+			DataNodes:          1,
+			DataTotal:          dataNode.Total,
+			DataUsed:           dataNode.Used,
+			DataPartitionCount: uint64(dataNode.DataPartitionCount),
+		},
+	}
+	dataNode.RUnlock()
+	c.statsTree.update(node)
+}
+
+func (c *Cluster) updateMetaNodeStats(metaNode *MetaNode) {
+	metaNode.RLock()
+	node := &nodeStats{
+		addr:       metaNode.Addr,
+		role:       proto.NodeRoleMeta,
+		zone:       metaNode.ZoneName,
+		reportTime: metaNode.ReportTime.Unix(),
+		stats: proto.StorageStats{
+			MetaNodes:          1,
+			MetaTotal:          metaNode.Total,
+			MetaUsed:           metaNode.Used,
+			MetaPartitionCount: uint64(metaNode.MetaPartitionCount),
+		},
+	}
+	metaNode.RUnlock()
+	c.statsTree.update(node)
+}
+
+func (m *Server) getStatsTree(w http.ResponseWriter, r *http.Request) {
+	level := r.FormValue(levelKey)
+	switch level {
+	case "":
+		level = proto.StatsLevelNode
+	case proto.StatsLevelCluster, proto.StatsLevelZone, proto.StatsLevelRack, proto.StatsLevelNode:
+	default:
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", levelKey, level)})
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.statsTree.view(m.cluster.Name, r.FormValue(zoneNameKey), level)))
+}
@@ -0,0 +1,459 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (c *Cluster) getTenant(name string) (info *proto.TenantInfo, err error) {
+	value, ok := c.tenants.Load(name)
+	if !ok {
+		return nil, proto.ErrTenantNotExists
+	}
+	return value.(*proto.TenantInfo), nil
+}
+
+// tenantOfVol returns the tenant the volume belongs to, nil if it belongs to none.
+func (c *Cluster) tenantOfVol(volName string) (info *proto.TenantInfo) {
+	c.tenants.Range(func(key, value interface{}) bool {
+		if contains(value.(*proto.TenantInfo).Vols, volName) {
+			info = value.(*proto.TenantInfo)
+			return false
+		}
+		return true
+	})
+	return
+}
+
+func (c *Cluster) createTenant(info *proto.TenantInfo) (err error) {
+	c.tenantMutex.Lock()
+	defer c.tenantMutex.Unlock()
+	if _, ok := c.tenants.Load(info.Name); ok {
+		return proto.ErrDuplicateTenant
+	}
+	info.Vols = make([]string, 0)
+	info.CreateTime = time.Now().Unix()
+	info.UpdateTime = info.CreateTime
+	if err = c.syncPutTenant(info); err != nil {
+		log.LogErrorf("action[createTenant] tenant[%v] err[%v]", info.Name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	c.tenants.Store(info.Name, info)
+	log.LogWarnf("action[createTenant] tenant[%v] owner[%v] capacity[%v] acl[%v]", info.Name, info.Owner,
+		info.Capacity, info.ACL)
+	return
+}
+
+// updateTenantLocked applies the change to a copy of the tenant and persists it, with c.tenantMutex held.
+func (c *Cluster) updateTenantLocked(name string, fn func(info *proto.TenantInfo) error) (updated *proto.TenantInfo, err error) {
+	info, err := c.getTenant(name)
+	if err != nil {
+		return
+	}
+	copied := *info
+	copied.Vols = append([]string(nil), info.Vols...)
+	if err = fn(&copied); err != nil {
+		return
+	}
+	copied.UpdateTime = time.Now().Unix()
+	if err = c.syncPutTenant(&copied); err != nil {
+		log.LogErrorf("action[updateTenant] tenant[%v] err[%v]", name, err)
+		return nil, proto.ErrPersistenceByRaft
+	}
+	c.tenants.Store(name, &copied)
+	return &copied, nil
+}
+
+// updateTenant changes the owner, the quota and the ACL of the tenant. The quota can not be less than the capacity
+// allocated to the volumes, and the ACL applies to the volumes added afterwards.
+func (c *Cluster) updateTenant(name, owner string, capacity uint64, acl map[string]string) (err error) {
+	c.tenantMutex.Lock()
+	defer c.tenantMutex.Unlock()
+	_, err = c.updateTenantLocked(name, func(info *proto.TenantInfo) error {
+		if owner != "" {
+			info.Owner = owner
+		}
+		if capacity != 0 {
+			if allocated := c.allocatedCapacityOfTenant(info, ""); capacity < allocated {
+				log.LogWarnf("action[updateTenant] tenant[%v] capacity[%v] is less than the allocated[%v]", name,
+					capacity, allocated)
+				return proto.ErrTenantQuotaExceeded
+			}
+			info.Capacity = capacity
+		}
+		if acl != nil {
+			info.ACL = acl
+		}
+		return nil
+	})
+	return
+}
+
+func (c *Cluster) deleteTenant(name string) (err error) {
+	c.tenantMutex.Lock()
+	defer c.tenantMutex.Unlock()
+	info, err := c.getTenant(name)
+	if err != nil {
+		return
+	}
+	if len(info.Vols) != 0 {
+		return proto.ErrTenantNotEmpty
+	}
+	if err = c.syncDeleteTenant(name); err != nil {
+		log.LogErrorf("action[deleteTenant] tenant[%v] err[%v]", name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	c.tenants.Delete(name)
+	log.LogWarnf("action[deleteTenant] tenant[%v]", name)
+	return
+}
+
+// allocatedCapacityOfTenant returns the sum of the capacities of the volumes of the tenant in GB, except the volume
+// excluded. The volumes marked deleted are counted until they are deleted, since they may be restored.
+func (c *Cluster) allocatedCapacityOfTenant(info *proto.TenantInfo, exclude string) (capacity uint64) {
+	for _, volName := range info.Vols {
+		if volName == exclude {
+			continue
+		}
+		if vol, err := c.getVol(volName); err == nil {
+			capacity += vol.Capacity
+		}
+	}
+	return
+}
+
+// checkTenantQuota rejects the capacity of the volume if the volumes of the tenant would exceed the quota with it,
+// with c.tenantMutex held.
+func (c *Cluster) checkTenantQuota(info *proto.TenantInfo, volName string, capacity uint64) (err error) {
+	allocated := c.allocatedCapacityOfTenant(info, volName)
+	if allocated+capacity > info.Capacity {
+		log.LogWarnf("action[checkTenantQuota] tenant[%v] vol[%v] capacity[%v] allocated[%v] quota[%v] exceeded",
+			info.Name, volName, capacity, allocated, info.Capacity)
+		return proto.ErrTenantQuotaExceeded
+	}
+	return
+}
+
+// addVolToTenantLocked adds the volume to the tenant within the quota, with c.tenantMutex held. Adding a volume of
+// the tenant again changes nothing.
+func (c *Cluster) addVolToTenantLocked(name, volName string) (info *proto.TenantInfo, err error) {
+	vol, err := c.getVol(volName)
+	if err != nil {
+		return nil, proto.ErrVolNotExists
+	}
+	if owner := c.tenantOfVol(volName); owner != nil && owner.Name != name {
+		return nil, proto.ErrVolInOtherTenant
+	}
+	return c.updateTenantLocked(name, func(info *proto.TenantInfo) error {
+		if contains(info.Vols, volName) {
+			return nil
+		}
+		if err := c.checkTenantQuota(info, volName, vol.Capacity); err != nil {
+			return err
+		}
+		info.Vols = append(info.Vols, volName)
+		return nil
+	})
+}
+
+func (c *Cluster) removeVolFromTenant(name, volName string) (info *proto.TenantInfo, err error) {
+	c.tenantMutex.Lock()
+	defer c.tenantMutex.Unlock()
+	return c.updateTenantLocked(name, func(info *proto.TenantInfo) error {
+		var ok bool
+		if info.Vols, ok = removeString(info.Vols, volName); !ok {
+			return fmt.Errorf("vol[%v] does not belong to tenant[%v]", volName, name)
+		}
+		return nil
+	})
+}
+
+// removeDeletedVolFromTenant removes the volume deleted from its tenant.
+func (c *Cluster) removeDeletedVolFromTenant(volName string) {
+	info := c.tenantOfVol(volName)
+	if info == nil {
+		return
+	}
+	if _, err := c.removeVolFromTenant(info.Name, volName); err != nil {
+		log.LogErrorf("action[removeDeletedVolFromTenant] tenant[%v] vol[%v] err[%v]", info.Name, volName, err)
+	}
+}
+
+func (c *Cluster) getTenantStat(info *proto.TenantInfo) (stat *proto.TenantStat) {
+	stat = &proto.TenantStat{
+		Name:     info.Name,
+		Owner:    info.Owner,
+		Capacity: info.Capacity,
+		ACL:      info.ACL,
+		Vols:     make([]*proto.TenantVolStat, 0, len(info.Vols)),
+	}
+	for _, volName := range info.Vols {
+		vol, err := c.getVol(volName)
+		if err != nil {
+			continue
+		}
+		volStat := &proto.TenantVolStat{Name: vol.Name, Capacity: vol.Capacity, UsedSize: vol.totalUsedSpace()}
+		if vol.Capacity > 0 {
+			volStat.UsedRatio = strconv.FormatFloat(float64(volStat.UsedSize)/float64(vol.Capacity*util.GB), 'f', 3, 32)
+		}
+		stat.AllocatedCapacity += volStat.Capacity
+		stat.UsedSize += volStat.UsedSize
+		stat.Vols = append(stat.Vols, volStat)
+	}
+	return
+}
+
+// getTenantStats returns the usage of the tenant, or of all the tenants in the order of their names if the name is
+// empty.
+func (c *Cluster) getTenantStats(name string) (stats []*proto.TenantStat, err error) {
+	if name != "" {
+		var info *proto.TenantInfo
+		if info, err = c.getTenant(name); err != nil {
+			return
+		}
+		return []*proto.TenantStat{c.getTenantStat(info)}, nil
+	}
+	stats = make([]*proto.TenantStat, 0)
+	c.tenants.Range(func(key, value interface{}) bool {
+		stats = append(stats, c.getTenantStat(value.(*proto.TenantInfo)))
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return
+}
+
+func (c *Cluster) clearTenants() {
+	c.tenants.Range(func(key, value interface{}) bool {
+		c.tenants.Delete(key)
+		return true
+	})
+}
+
+// grantTenantACL grants the users in the ACL of the tenant their permissions on the volume.
+func (m *Server) grantTenantACL(info *proto.TenantInfo, volName string) (err error) {
+	for userID, perm := range info.ACL {
+		param := proto.NewUserPermUpdateParam(userID, volName)
+		param.SetPolicy(perm)
+		if _, err = m.user.updatePolicy(param); err != nil && err != proto.ErrIsOwner {
+			return fmt.Errorf("grant %v on vol[%v] to user[%v] failed, err[%v]", perm, volName, userID, err)
+		}
+	}
+	return nil
+}
+
+// revokeTenantACL revokes the permissions on the volume granted by the ACL of the tenant.
+func (m *Server) revokeTenantACL(info *proto.TenantInfo, volName string) (err error) {
+	for userID := range info.ACL {
+		param := &proto.UserPermRemoveParam{UserID: userID, Volume: volName}
+		if _, err = m.user.removePolicy(param); err != nil && err != proto.ErrIsOwner && err != proto.ErrUserNotExists {
+			return fmt.Errorf("revoke vol[%v] from user[%v] failed, err[%v]", volName, userID, err)
+		}
+	}
+	return nil
+}
+
+// addVolToTenantLocked adds the volume to the tenant and grants the ACL of the tenant on it, with
+// m.cluster.tenantMutex held.
+func (m *Server) addVolToTenantLocked(name, volName string) (err error) {
+	var info *proto.TenantInfo
+	if info, err = m.cluster.addVolToTenantLocked(name, volName); err != nil {
+		return
+	}
+	return m.grantTenantACL(info, volName)
+}
+
+// parseTenantACL parses the ACL in the form of user1:ReadOnly,user2:Writable, the users must exist.
+func (m *Server) parseTenantACL(r *http.Request) (acl map[string]string, err error) {
+	value := r.FormValue(aclKey)
+	if value == "" {
+		return
+	}
+	acl = make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid %v entry[%v]", aclKey, entry)
+		}
+		perm := proto.BuiltinPermissionPrefix + proto.Permission(fields[1])
+		if perm != proto.BuiltinPermissionReadOnly && perm != proto.BuiltinPermissionWritable {
+			return nil, fmt.Errorf("invalid permission[%v] of user[%v], only ReadOnly and Writable", fields[1], fields[0])
+		}
+		if _, err = m.user.getUserInfo(fields[0]); err != nil {
+			return nil, fmt.Errorf("user[%v] of %v: %v", fields[0], aclKey, err)
+		}
+		acl[fields[0]] = perm.String()
+	}
+	return
+}
+
+func (m *Server) createTenant(w http.ResponseWriter, r *http.Request) {
+	var (
+		info     = &proto.TenantInfo{}
+		capacity int
+		err      error
+	)
+	if info.Name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if info.Owner, err = extractOwner(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if capacity, err = extractCapacity(r); err != nil || capacity <= 0 {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v", volCapacityKey)})
+		return
+	}
+	info.Capacity = uint64(capacity)
+	if info.ACL, err = m.parseTenantACL(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.createTenant(info); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("create tenant[%v] successfully", info.Name)))
+}
+
+func (m *Server) updateTenant(w http.ResponseWriter, r *http.Request) {
+	var (
+		name     string
+		owner    string
+		capacity int
+		acl      map[string]string
+		err      error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if r.FormValue(volOwnerKey) != "" {
+		if owner, err = extractOwner(r); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+			return
+		}
+	}
+	if r.FormValue(volCapacityKey) != "" {
+		if capacity, err = extractCapacity(r); err != nil || capacity <= 0 {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v", volCapacityKey)})
+			return
+		}
+	}
+	if acl, err = m.parseTenantACL(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.updateTenant(name, owner, uint64(capacity), acl); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("update tenant[%v] successfully", name)))
+}
+
+func (m *Server) deleteTenant(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		err  error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.deleteTenant(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("delete tenant[%v] successfully", name)))
+}
+
+func parseRequestToChangeTenantVol(r *http.Request) (name, volName string, err error) {
+	if name, err = parseAndExtractName(r); err != nil {
+		return
+	}
+	if volName = r.FormValue(volNameKey); volName == "" {
+		err = keyNotFound(volNameKey)
+	}
+	return
+}
+
+func (m *Server) addVolToTenant(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		volName string
+		err     error
+	)
+	if name, volName, err = parseRequestToChangeTenantVol(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	m.cluster.tenantMutex.Lock()
+	err = m.addVolToTenantLocked(name, volName)
+	m.cluster.tenantMutex.Unlock()
+	if err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("add vol[%v] to tenant[%v] successfully", volName, name)))
+}
+
+func (m *Server) removeVolFromTenant(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		volName string
+		info    *proto.TenantInfo
+		err     error
+	)
+	if name, volName, err = parseRequestToChangeTenantVol(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if info, err = m.cluster.removeVolFromTenant(name, volName); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err = m.revokeTenantACL(info, volName); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("remove vol[%v] from tenant[%v] successfully", volName, name)))
+}
+
+func (m *Server) getTenantStats(w http.ResponseWriter, r *http.Request) {
+	var (
+		name  = r.FormValue(nameKey)
+		stats []*proto.TenantStat
+		err   error
+	)
+	if stats, err = m.cluster.getTenantStats(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if name != "" {
+		sendOkReply(w, r, newSuccessHTTPReply(stats[0]))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(stats))
+}
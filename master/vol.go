@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util"
@@ -35,6 +36,21 @@ type VolVarargs struct {
 	enableToken    bool
 	dpSelectorName string
 	dpSelectorParm string
+	dpAffinity     string
+	failureDomain  string
+
+	minClientVersion string
+	features         map[string]bool
+	multipartTTL     int64
+	metaCache        bool
+	maxClients       int
+
+	verifyReads        bool
+	verifyReadsPercent int
+	syncOnRename       bool
+	requireToken       bool
+	coldZone           string
+	namePolicy         proto.DentryNamePolicy
 }
 
 // Vol represents a set of meta partitionMap and data partitionMap
@@ -54,6 +70,7 @@ type Vol struct {
 	FollowerRead       bool
 	authenticate       bool
 	crossZone          bool
+	caseInsensitive    bool // the dentries are looked up case-insensitively, which is fixed once the vol is created
 	zoneName           string
 	enableToken        bool
 	tokens             map[string]*proto.Token
@@ -64,11 +81,33 @@ type Vol struct {
 	mpsCache           []byte
 	viewCache          []byte
 	createDpMutex      sync.RWMutex
+	allocEpoch         uint64 // bumped by the capacity changes, which are serialized with the data partition creations
 	createMpMutex      sync.RWMutex
 	createTime         int64
 	description        string
 	dpSelectorName     string
 	dpSelectorParm     string
+	dpAffinity         string
+	failureDomain      string // the failure domain holding at most one replica of a new data partition
+	minClientVersion   string
+	features           map[string]bool
+	multipartTTL       int64  // hours, the multipart uploads abandoned for longer are expired by the meta nodes
+	metaCache          bool   // the metadata requests are proxied by the meta cache nodes
+	maxClients         int    // the maximum number of the mounted clients, 0 for unlimited
+	verifyReads        bool   // the clients verify the sampled reads against another replica
+	verifyReadsPercent int    // the percent of the reads verified with verifyReads
+	syncOnRename       bool   // the renames are durable once they return, for the publishing workflows
+	requireToken       bool   // the data nodes and the meta nodes refuse the clients without a delegated token
+	coldZone           string // the zone of the cold data partitions, which the lifecycle rules move the files to
+	namePolicy         proto.DentryNamePolicy
+	lifecycleRules     []*proto.LifecycleRule
+	reservations       []*proto.VolReservation      // the expired ones are dropped once the reservations are changed
+	deleteTime         int64                        // unix seconds when the volume was marked deleted
+	freeze             *proto.VolFreezeView         // the writes are quiesced until the volume is thawed with the token
+	shadow             *proto.VolShadowView         // the shadow volume mirroring the volume, nil if it has no shadow
+	shadowOf           string                       // the volume mirrored by the volume, empty unless it is a shadow
+	nsExport           *proto.NamespaceExportConfig // nil if the namespace is not exported
+	unavailableSince   int64                        // unix seconds since the partitions are unavailable, 0 if available
 	sync.RWMutex
 }
 
@@ -127,6 +166,27 @@ func newVolFromVolValue(vv *volValue) (vol *Vol) {
 	vol.Status = vv.Status
 	vol.dpSelectorName = vv.DpSelectorName
 	vol.dpSelectorParm = vv.DpSelectorParm
+	vol.dpAffinity = vv.DpAffinity
+	vol.failureDomain = vv.FailureDomain
+	vol.minClientVersion = vv.MinClientVersion
+	vol.features = vv.Features
+	vol.multipartTTL = vv.MultipartTTL
+	vol.metaCache = vv.MetaCache
+	vol.maxClients = vv.MaxClients
+	vol.verifyReads = vv.VerifyReads
+	vol.verifyReadsPercent = vv.VerifyPercent
+	vol.syncOnRename = vv.SyncOnRename
+	vol.requireToken = vv.RequireToken
+	vol.coldZone = vv.ColdZone
+	vol.namePolicy = vv.NamePolicy
+	vol.lifecycleRules = vv.LifecycleRules
+	vol.reservations = vv.Reservations
+	vol.deleteTime = vv.DeleteTime
+	vol.freeze = vv.Freeze
+	vol.caseInsensitive = vv.CaseInsensitive
+	vol.shadow = vv.Shadow
+	vol.shadowOf = vv.ShadowOf
+	vol.nsExport = vv.NamespaceExport
 	return vol
 }
 
@@ -233,22 +293,24 @@ func (vol *Vol) initMetaPartitions(c *Cluster, count int) (err error) {
 
 func (vol *Vol) initDataPartitions(c *Cluster) (err error) {
 	// initialize k data partitionMap at a time
-	err = c.batchCreateDataPartition(vol, defaultInitDataPartitionCnt)
+	_, err = c.batchCreateDataPartition(vol, defaultInitDataPartitionCnt, vol.allocationEpoch())
 	return
 }
 
 func (vol *Vol) checkDataPartitions(c *Cluster) (cnt int) {
 	if vol.getDataPartitionsCount() == 0 && vol.Status != markDelete {
-		c.batchCreateDataPartition(vol, 1)
+		c.batchCreateDataPartition(vol, 1, vol.allocationEpoch())
 	}
 	vol.dataPartitions.RLock()
 	defer vol.dataPartitions.RUnlock()
 	for _, dp := range vol.dataPartitions.partitionMap {
-		dp.checkReplicaStatus(c.cfg.DataPartitionTimeOutSec)
-		dp.checkStatus(c.Name, true, c.cfg.DataPartitionTimeOutSec)
-		dp.checkLeader(c.cfg.DataPartitionTimeOutSec)
+		dp.checkReplicaStatus(c.cfg.dpTimeOutSec())
+		dp.checkStatus(c.Name, true, c.cfg.dpTimeOutSec())
+		dp.checkLeader(c.cfg.dpTimeOutSec())
 		dp.checkMissingReplicas(c.Name, c.leaderInfo.addr, c.cfg.MissingDataPartitionInterval, c.cfg.IntervalToAlarmMissingDataPartition)
 		dp.checkReplicaNum(c, vol)
+		c.checkDataPartitionEvents(vol.Name, dp)
+		c.checkTinyExtentEvents(vol.Name, dp)
 		if dp.Status == proto.ReadWrite {
 			cnt++
 		}
@@ -323,7 +385,8 @@ func (vol *Vol) checkMetaPartitions(c *Cluster) {
 		mp.checkLeader()
 		mp.checkReplicaNum(c, vol.Name, vol.mpReplicaNum)
 		mp.checkEnd(c, maxPartitionID)
-		mp.reportMissingReplicas(c.Name, c.leaderInfo.addr, defaultMetaPartitionTimeOutSec, defaultIntervalToAlarmMissingMetaPartition)
+		mp.reportMissingReplicas(c.Name, c.leaderInfo.addr, c.cfg.mpTimeOutSec(), defaultIntervalToAlarmMissingMetaPartition)
+		c.checkMetaPartitionEvents(vol.Name, mp)
 		tasks = append(tasks, mp.replicaCreationTasks(c.Name, vol.Name)...)
 	}
 	c.addMetaNodeTasks(tasks)
@@ -372,6 +435,18 @@ func (vol *Vol) cloneMetaPartitionMap() (mps map[uint64]*MetaPartition) {
 	return
 }
 
+// metaPartitionByInode returns the meta partition whose inode range covers the inode.
+func (vol *Vol) metaPartitionByInode(ino uint64) (mp *MetaPartition, err error) {
+	vol.mpsLock.RLock()
+	defer vol.mpsLock.RUnlock()
+	for _, mp = range vol.MetaPartitions {
+		if ino >= mp.Start && ino <= mp.End {
+			return
+		}
+	}
+	return nil, fmt.Errorf("no meta partition of vol[%v] covers inode[%v]", vol.Name, ino)
+}
+
 func (vol *Vol) cloneDataPartitionMap() (dps map[uint64]*DataPartition) {
 	vol.dataPartitions.RLock()
 	defer vol.dataPartitions.RUnlock()
@@ -411,14 +486,21 @@ func (vol *Vol) checkAutoDataPartitionCreation(c *Cluster) {
 	if vol.status() == markDelete {
 		return
 	}
+	// the data partitions of a frozen volume are read-only, which are not to be replaced with the new ones
+	if vol.isFrozen() {
+		return
+	}
 	if vol.capacity() == 0 {
 		return
 	}
 	usedSpace := vol.totalUsedSpace() / util.GB
 	if usedSpace >= vol.capacity() {
+		c.raiseEvent(proto.EventVolumeFull, proto.EventSeverityCritical, vol.Name, vol.Name,
+			fmt.Sprintf("vol[%v] used space[%vGB] reaches its capacity[%vGB]", vol.Name, usedSpace, vol.capacity()), 0)
 		vol.setAllDataPartitionsToReadOnly()
 		return
 	}
+	c.resolveEvent(proto.EventVolumeFull, vol.Name)
 	vol.setStatus(normal)
 
 	if vol.status() == normal && !c.DisableAutoAllocate {
@@ -427,16 +509,40 @@ func (vol *Vol) checkAutoDataPartitionCreation(c *Cluster) {
 }
 
 func (vol *Vol) autoCreateDataPartitions(c *Cluster) {
+	for i := 0; i < defaultAllocEpochRetries; i++ {
+		epoch, count := vol.planExpansion()
+		if count == 0 {
+			return
+		}
+		log.LogInfof("action[autoCreateDataPartitions] vol[%v] epoch[%v] count[%v]", vol.Name, epoch, count)
+		if _, err := c.batchCreateDataPartition(vol, count, epoch); err != proto.ErrStaleVolCapacity {
+			return
+		}
+		log.LogWarnf("action[autoCreateDataPartitions] vol[%v] capacity is changed since epoch[%v], plan again",
+			vol.Name, epoch)
+	}
+}
+
+// planExpansion returns the number of the data partitions to be created by the capacity of the volume, and the
+// allocation epoch of the capacity, which the creations are tied to.
+func (vol *Vol) planExpansion() (epoch uint64, count int) {
+	vol.RLock()
+	defer vol.RUnlock()
 	if (vol.Capacity > 200000 && vol.dataPartitions.readableAndWritableCnt < 200) || vol.dataPartitions.readableAndWritableCnt < minNumOfRWDataPartitions {
-		count := vol.calculateExpansionNum()
-		log.LogInfof("action[autoCreateDataPartitions] vol[%v] count[%v]", vol.Name, count)
-		c.batchCreateDataPartition(vol, count)
+		count = vol.calculateExpansionNum()
 	}
+	return vol.allocEpoch, count
+}
+
+func (vol *Vol) allocationEpoch() uint64 {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.allocEpoch
 }
 
 // Calculate the expansion number (the number of data partitions to be allocated to the given volume)
 func (vol *Vol) calculateExpansionNum() (count int) {
-	c := float64(vol.Capacity) * float64(volExpansionRatio) * float64(util.GB) / float64(util.DefaultDataPartitionSize)
+	c := float64(vol.Capacity) * float64(volExpansionRatio) * float64(util.GB) / float64(vol.dataPartitionSize)
 	switch {
 	case c < minNumOfRWDataPartitions:
 		count = minNumOfRWDataPartitions
@@ -456,11 +562,30 @@ func (vol *Vol) totalUsedSpace() uint64 {
 	return vol.dataPartitions.totalUsedSpace()
 }
 
+// totalReservedSpace returns the space preallocated to the files of the volume which is not written yet.
+func (vol *Vol) totalReservedSpace() (reserved uint64) {
+	vol.mpsLock.RLock()
+	defer vol.mpsLock.RUnlock()
+	for _, mp := range vol.MetaPartitions {
+		reserved += mp.Reserved
+	}
+	return
+}
+
 func (vol *Vol) updateViewCache(c *Cluster) {
 	view := proto.NewVolView(vol.Name, vol.Status, vol.FollowerRead, vol.createTime)
 	view.SetOwner(vol.Owner)
 	view.SetOSSSecure(vol.OSSAccessKey, vol.OSSSecretKey)
-	mpViews := vol.getMetaPartitionsView()
+	view.MinClientVersion = vol.minClientVersion
+	view.Features = vol.features
+	view.SyncOnRename = vol.syncOnRename
+	if vol.metaCache {
+		view.MetaCacheNodes = c.aliveMetaCacheNodes()
+	}
+	view.Shadow = vol.shadowView()
+	// the clients are served by the partitions of the shadow once the volume fails over to it
+	serving := c.servingVol(vol)
+	mpViews := serving.getMetaPartitionsView()
 	view.MetaPartitions = mpViews
 	mpViewsReply := newSuccessHTTPReply(mpViews)
 	mpsBody, err := json.Marshal(mpViewsReply)
@@ -469,7 +594,7 @@ func (vol *Vol) updateViewCache(c *Cluster) {
 		return
 	}
 	vol.setMpsCache(mpsBody)
-	dpResps := vol.dataPartitions.getDataPartitionsView(0)
+	dpResps := serving.dataPartitions.getDataPartitionsView(0)
 	view.DataPartitions = dpResps
 	viewReply := newSuccessHTTPReply(view)
 	body, err := json.Marshal(viewReply)
@@ -531,12 +656,19 @@ func (vol *Vol) checkStatus(c *Cluster) {
 	if vol.Status != markDelete {
 		return
 	}
+	if vol.inDeleteGracePeriod(c.cfg.VolDeleteGracePeriodSec) {
+		return
+	}
 	log.LogInfof("action[volCheckStatus] vol[%v],status[%v]", vol.Name, vol.Status)
 	metaTasks := vol.getTasksToDeleteMetaPartitions()
 	dataTasks := vol.getTasksToDeleteDataPartitions()
 
 	if len(metaTasks) == 0 && len(dataTasks) == 0 {
-		vol.deleteVolFromStore(c)
+		event := c.newVolUsageEvent(proto.VolUsageDelete, vol)
+		if err := vol.deleteVolFromStore(c); err == nil {
+			c.recordVolUsageEvent(event)
+			c.removeDeletedVolFromTenant(vol.Name)
+		}
 	}
 	go func() {
 		for _, metaTask := range metaTasks {
@@ -551,6 +683,12 @@ func (vol *Vol) checkStatus(c *Cluster) {
 	return
 }
 
+// inDeleteGracePeriod tells whether the volume marked deleted can still be restored, for its partitions are not
+// deleted until the grace period expires. The caller must hold the lock of the volume.
+func (vol *Vol) inDeleteGracePeriod(gracePeriodSec int64) bool {
+	return vol.Status == markDelete && time.Now().Unix() < vol.deleteTime+gracePeriodSec
+}
+
 func (vol *Vol) deleteMetaPartitionFromMetaNode(c *Cluster, task *proto.AdminTask) {
 	mp, err := vol.metaPartition(task.PartitionID)
 	if err != nil {
@@ -755,7 +893,7 @@ func (vol *Vol) doCreateMetaPartition(c *Cluster, start, end uint64) (mp *MetaPa
 		wg          sync.WaitGroup
 	)
 	errChannel := make(chan error, vol.mpReplicaNum)
-	if hosts, peers, err = c.chooseTargetMetaHosts("", nil, nil, int(vol.mpReplicaNum), vol.crossZone, vol.zoneName); err != nil {
+	if hosts, peers, err = c.chooseTargetMetaHostsForVol(vol); err != nil {
 		log.LogErrorf("action[doCreateMetaPartition] chooseTargetMetaHosts err[%v]", err)
 		return nil, errors.NewError(err)
 	}
@@ -822,5 +960,20 @@ func getVolVarargs(vol *Vol) *VolVarargs {
 		enableToken:    vol.enableToken,
 		dpSelectorName: vol.dpSelectorName,
 		dpSelectorParm: vol.dpSelectorParm,
+		dpAffinity:     vol.dpAffinity,
+		failureDomain:  vol.failureDomain,
+
+		minClientVersion: vol.minClientVersion,
+		features:         vol.features,
+		multipartTTL:     vol.multipartTTL,
+		metaCache:        vol.metaCache,
+		maxClients:       vol.maxClients,
+
+		verifyReads:        vol.verifyReads,
+		verifyReadsPercent: vol.verifyReadsPercent,
+		syncOnRename:       vol.syncOnRename,
+		requireToken:       vol.requireToken,
+		coldZone:           vol.coldZone,
+		namePolicy:         vol.namePolicy,
 	}
 }
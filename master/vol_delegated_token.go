@@ -0,0 +1,140 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// delegateVolToken mints a short-lived token of the volume for the owner, which the batch jobs mount the volume with
+// instead of the auth key of the owner. The token is not persisted, it is validated by its signature until it expires.
+// The sub directory is resolved to its inode, which the meta nodes confine the requests with the token under.
+func (c *Cluster) delegateVolToken(name, authKey string, readOnly bool, subDir string, ttlHours int64) (view *proto.DelegatedTokenView, err error) {
+	if c.cfg.tokenSigningKey == "" {
+		return nil, proto.ErrDelegatedTokenNotEnabled
+	}
+	vol, err := c.getVol(name)
+	if err != nil || vol.status() == markDelete {
+		return nil, proto.ErrVolNotExists
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return nil, proto.ErrVolAuthKeyNotMatch
+	}
+	var rootIno uint64
+	if subDir != "" {
+		if rootIno, err = c.resolveDir(vol, subDir); err != nil {
+			return nil, fmt.Errorf("resolve subDir[%v]: %v", subDir, err)
+		}
+	}
+	now := time.Now()
+	t := &proto.DelegatedToken{
+		ID:         util.RandomString(16, util.Numeric|util.LowerLetter|util.UpperLetter),
+		VolName:    vol.Name,
+		ReadOnly:   readOnly,
+		SubDir:     subDir,
+		RootInode:  rootIno,
+		IssueTime:  now.Unix(),
+		ExpireTime: now.Add(time.Duration(ttlHours) * time.Hour).Unix(),
+	}
+	token, err := t.Sign([]byte(c.cfg.tokenSigningKey))
+	if err != nil {
+		return
+	}
+	log.LogWarnf("action[delegateVolToken] vol[%v] token[%v] readOnly[%v] subDir[%v] rootIno[%v] expires at %v",
+		name, t.ID, readOnly, subDir, rootIno, time.Unix(t.ExpireTime, 0).Format(proto.TimeFormat))
+	return &proto.DelegatedTokenView{
+		Token:      token,
+		VolName:    t.VolName,
+		ReadOnly:   t.ReadOnly,
+		SubDir:     t.SubDir,
+		RootInode:  t.RootInode,
+		ExpireTime: t.ExpireTime,
+	}, nil
+}
+
+// checkDelegatedToken checks whether the delegated token grants the access to the volume.
+func (c *Cluster) checkDelegatedToken(token, volName string) (err error) {
+	if token == "" {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	t, err := proto.VerifyDelegatedToken(token, []byte(c.cfg.tokenSigningKey))
+	if err != nil {
+		return
+	}
+	if !t.Allows(volName, false) {
+		return proto.ErrDelegatedTokenInvalid
+	}
+	return nil
+}
+
+// tokenRequiredVols returns the volumes whose clients are refused without a delegated token, which are sent to the
+// data nodes and the meta nodes with the heartbeats.
+func (c *Cluster) tokenRequiredVols() (names []string) {
+	for name, vol := range c.allVols() {
+		vol.RLock()
+		if vol.requireToken {
+			names = append(names, name)
+		}
+		vol.RUnlock()
+	}
+	return
+}
+
+func parseRequestToDelegateVolToken(r *http.Request) (name, authKey string, readOnly bool, subDir string, ttlHours int64, err error) {
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	if value := r.FormValue(readOnlyKey); value != "" {
+		if readOnly, err = strconv.ParseBool(value); err != nil {
+			err = unmatchedKey(readOnlyKey)
+			return
+		}
+	}
+	if subDir = r.FormValue(subDirKey); subDir != "" {
+		if subDir = path.Clean("/" + subDir); subDir == "/" {
+			subDir = ""
+		}
+	}
+	ttlHours = proto.DefaultDelegatedTokenTTLHours
+	if value := r.FormValue(ttlKey); value != "" {
+		if ttlHours, err = strconv.ParseInt(value, 10, 64); err != nil || ttlHours <= 0 || ttlHours > proto.MaxDelegatedTokenTTLHours {
+			err = fmt.Errorf("%v must be a number of hours in (0, %v]", ttlKey, proto.MaxDelegatedTokenTTLHours)
+			return
+		}
+	}
+	return
+}
+
+func (m *Server) delegateVolToken(w http.ResponseWriter, r *http.Request) {
+	name, authKey, readOnly, subDir, ttlHours, err := parseRequestToDelegateVolToken(r)
+	if err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	view, err := m.cluster.delegateVolToken(name, authKey, readOnly, subDir, ttlHours)
+	if err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(view))
+}
@@ -0,0 +1,276 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (mp *MetaPartition) createTaskToFreezeMetaPartition(addr string, isFrozen bool) (task *proto.AdminTask) {
+	task = proto.NewAdminTask(proto.OpFreezeMetaPartition, addr, &proto.FreezeMetaPartitionRequest{
+		PartitionID: mp.PartitionID,
+		IsFrozen:    isFrozen,
+	})
+	resetMetaPartitionTaskID(task, mp.PartitionID)
+	return
+}
+
+func (vol *Vol) isFrozen() bool {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.freeze != nil
+}
+
+func (vol *Vol) freezeView() (view *proto.VolFreezeView) {
+	vol.RLock()
+	defer vol.RUnlock()
+	if vol.freeze == nil {
+		return nil
+	}
+	view = &proto.VolFreezeView{}
+	*view = *vol.freeze
+	return
+}
+
+// freezeVol quiesces the writes of the volume, so that the external tools can capture a consistent state of it, e.g.
+// by the snapshots of the disks of the data nodes. The freeze is persisted before the partitions are notified: the
+// meta partitions refuse the mutations and flush the applied state into the snapshots, and the data partitions not
+// frozen yet are pinned read-only. The replicas which fail to be notified are synced by the scheduled checks.
+func (c *Cluster) freezeVol(name, authKey string) (view *proto.VolFreezeView, err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return nil, proto.ErrVolNotExists
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return nil, proto.ErrVolAuthKeyNotMatch
+	}
+	vol.Lock()
+	if vol.freeze != nil {
+		vol.Unlock()
+		return nil, proto.ErrVolFrozen
+	}
+	freeze := &proto.VolFreezeView{
+		Name:       vol.Name,
+		Token:      util.RandomString(16, util.Numeric|util.LowerLetter|util.UpperLetter),
+		FreezeTime: time.Now().Unix(),
+	}
+	vol.freeze = freeze
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.freeze = nil
+		vol.Unlock()
+		return nil, proto.ErrPersistenceByRaft
+	}
+	vol.Unlock()
+	log.LogWarnf("action[freezeVol] vol[%v] is frozen", name)
+
+	failures := make([]string, 0)
+	marks := make([]*proto.MetaPartitionFreezeMark, 0)
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		mark, err := c.freezeMetaPartition(mp, true)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		marks = append(marks, mark)
+	}
+	sort.Slice(marks, func(i, j int) bool { return marks[i].PartitionID < marks[j].PartitionID })
+	frozenDps := make([]uint64, 0)
+	for _, dp := range vol.cloneDataPartitionMap() {
+		dp.RLock()
+		isFrozen := dp.isFrozen
+		dp.RUnlock()
+		if isFrozen {
+			continue
+		}
+		if err = c.setDataPartitionFrozen(vol, dp, true); err != nil {
+			failures = append(failures, err.Error())
+		}
+		dp.RLock()
+		if dp.isFrozen {
+			frozenDps = append(frozenDps, dp.PartitionID)
+		}
+		dp.RUnlock()
+	}
+	sort.Slice(frozenDps, func(i, j int) bool { return frozenDps[i] < frozenDps[j] })
+
+	vol.Lock()
+	freeze.MetaPartitions = marks
+	freeze.FrozenDataPartitions = frozenDps
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.Unlock()
+		return nil, proto.ErrPersistenceByRaft
+	}
+	view = &proto.VolFreezeView{}
+	*view = *freeze
+	vol.Unlock()
+	if len(failures) != 0 {
+		err = fmt.Errorf("vol[%v] is frozen, but some partitions failed, [%v]", name, strings.Join(failures, "; "))
+		log.LogErrorf("action[freezeVol] %v", err)
+		return view, err
+	}
+	return view, nil
+}
+
+// thawVol resumes the writes of the volume frozen with the token. The data partitions frozen before the volume are
+// kept frozen.
+func (c *Cluster) thawVol(name, authKey, token string) (err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return proto.ErrVolNotExists
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	vol.Lock()
+	freeze := vol.freeze
+	if freeze == nil {
+		vol.Unlock()
+		return proto.ErrVolNotFrozen
+	}
+	if freeze.Token != token {
+		vol.Unlock()
+		return proto.ErrVolFreezeTokenNotMatch
+	}
+	vol.freeze = nil
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.freeze = freeze
+		vol.Unlock()
+		return proto.ErrPersistenceByRaft
+	}
+	vol.Unlock()
+	log.LogWarnf("action[thawVol] vol[%v] is thawed, frozen for %v seconds", name, time.Now().Unix()-freeze.FreezeTime)
+
+	failures := make([]string, 0)
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		if _, err = c.freezeMetaPartition(mp, false); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	for _, id := range freeze.FrozenDataPartitions {
+		dp, err := vol.getDataPartitionByID(id)
+		if err != nil {
+			continue
+		}
+		if err = c.setDataPartitionFrozen(vol, dp, false); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) != 0 {
+		err = fmt.Errorf("vol[%v] is thawed, but some partitions failed, [%v]", name, strings.Join(failures, "; "))
+		log.LogErrorf("action[thawVol] %v", err)
+		return
+	}
+	return nil
+}
+
+// freezeMetaPartition notifies every replica of the meta partition, and returns the highest applied index replied.
+func (c *Cluster) freezeMetaPartition(mp *MetaPartition, isFrozen bool) (mark *proto.MetaPartitionFreezeMark, err error) {
+	mp.RLock()
+	hosts := make([]string, len(mp.Hosts))
+	copy(hosts, mp.Hosts)
+	mp.RUnlock()
+	mark = &proto.MetaPartitionFreezeMark{PartitionID: mp.PartitionID}
+	err = notifyReplicas("meta partition", mp.PartitionID, hosts, func(addr string) error {
+		resp, err := c.syncFreezeMetaReplica(mp, addr, isFrozen)
+		if err != nil {
+			return err
+		}
+		if resp.ApplyID > mark.ApplyID {
+			mark.ApplyID = resp.ApplyID
+		}
+		return nil
+	})
+	return
+}
+
+func isFrozenMetaReplica(replica *MetaReplica) *bool {
+	return &replica.IsFrozen
+}
+
+func (c *Cluster) syncFreezeMetaReplica(mp *MetaPartition, addr string, isFrozen bool) (resp *proto.FreezeMetaPartitionResponse, err error) {
+	packet, err := c.syncMetaReplicaFlag(mp, addr, mp.createTaskToFreezeMetaPartition(addr, isFrozen), isFrozenMetaReplica, isFrozen)
+	if err != nil {
+		return
+	}
+	resp = &proto.FreezeMetaPartitionResponse{}
+	err = json.Unmarshal(packet.Data, resp)
+	return
+}
+
+// syncFrozenMetaReplicas notifies the live replicas whose reported flag differs from the volume again.
+func (c *Cluster) syncFrozenMetaReplicas(vol *Vol) {
+	isFrozen := vol.isFrozen()
+	c.syncMetaReplicaFlags(vol, "syncFrozenMetaReplicas", func(mp *MetaPartition) bool { return isFrozen },
+		isFrozenMetaReplica, func(mp *MetaPartition, addr string, isFrozen bool) (err error) {
+			_, err = c.syncFreezeMetaReplica(mp, addr, isFrozen)
+			return
+		})
+}
+
+func (m *Server) freezeVol(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		view    *proto.VolFreezeView
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if view, err = m.cluster.freezeVol(name, authKey); err != nil && view == nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	if err != nil {
+		// the vol is frozen, the failed partitions are synced by the scheduled checks
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeInternalError, Msg: err.Error(), Data: view})
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(view))
+}
+
+func (m *Server) thawVol(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		token   string
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if token = r.FormValue(tokenKey); token == "" {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: keyNotFound(tokenKey).Error()})
+		return
+	}
+	if err = m.cluster.thawVol(name, authKey, token); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	msg := fmt.Sprintf("thaw vol[%v] successfully,from[%v]", name, r.RemoteAddr)
+	log.LogWarn(msg)
+	sendOkReply(w, r, newSuccessHTTPReply(msg))
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The thresholds of the access patterns at which the volumes are recommended to be tuned.
+const (
+	recommendMinIOs             = 1000      // the reads and the writes counted before their sizes are analyzed
+	recommendSmallWriteSize     = 128 << 10 // the writes up to the size go to the tiny extents
+	recommendSmallWriteRatio    = 0.5       // of the writes
+	recommendReadRatio          = 0.8       // of the reads and the writes
+	recommendMetaPartitionItems = 10000000  // the inodes and the dentries of a meta partition
+	recommendApplyQueue         = 100       // the proposals waiting to be applied on a meta partition replica
+	recommendMinInodeLookups    = 1000      // the inode cache lookups of the clients before their misses are analyzed
+	recommendInodeCacheMiss     = 0.5       // of the inode cache lookups
+)
+
+const (
+	recommendPackTinyExtents    = "packTinyExtents"
+	recommendAddMetaPartition   = "addMetaPartition"
+	recommendEnableFollowerRead = "enableFollowerRead"
+	recommendEnableMetaCache    = "enableMetaCache"
+)
+
+// volAccessPattern sums up the sizes of the reads and the writes reported by the data partitions, the items and the
+// apply queues reported by the meta partitions, and the operations reported by the clients of the volume.
+func (c *Cluster) volAccessPattern(vol *Vol) (pattern *proto.VolAccessPattern) {
+	pattern = &proto.VolAccessPattern{
+		WriteSizes: make([]uint64, proto.IOSizeBucketCount),
+		ReadSizes:  make([]uint64, proto.IOSizeBucketCount),
+		OpCounts:   make(map[string]uint64),
+	}
+	for _, dp := range vol.cloneDataPartitionMap() {
+		dp.RLock()
+		for _, replica := range dp.Replicas {
+			addIOSizes(pattern.WriteSizes, replica.writes)
+			addIOSizes(pattern.ReadSizes, replica.reads)
+		}
+		dp.RUnlock()
+	}
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		mp.RLock()
+		pattern.MetaPartitions++
+		if mp.Status == proto.ReadWrite {
+			pattern.WritableMetaPartitions++
+		}
+		if items := mp.InodeCount + mp.DentryCount; items > pattern.MaxMetaPartitionItems {
+			pattern.MaxMetaPartitionItems = items
+		}
+		for _, mr := range mp.Replicas {
+			if mr.ApplyQueue > pattern.MaxApplyQueue {
+				pattern.MaxApplyQueue = mr.ApplyQueue
+			}
+		}
+		mp.RUnlock()
+	}
+	for _, cm := range c.listClientMetrics(vol.Name) {
+		pattern.Clients++
+		pattern.IcacheHits += cm.IcacheHits
+		pattern.IcacheMiss += cm.IcacheMiss
+		for op, count := range cm.OpCounts {
+			pattern.OpCounts[op] += count
+		}
+	}
+	return
+}
+
+func addIOSizes(sum, sizes []uint64) {
+	for i := 0; i < len(sum) && i < len(sizes); i++ {
+		sum[i] += sizes[i]
+	}
+}
+
+// recommendVolTuning derives the suggestions to tune the volume from its access pattern.
+func recommendVolTuning(vol *Vol, pattern *proto.VolAccessPattern) (recs []*proto.VolRecommendation) {
+	recs = make([]*proto.VolRecommendation, 0)
+	var writes, smallWrites, reads uint64
+	for i := range pattern.WriteSizes {
+		writes += pattern.WriteSizes[i]
+		if i < len(proto.IOSizeBounds) && proto.IOSizeBounds[i] <= recommendSmallWriteSize {
+			smallWrites += pattern.WriteSizes[i]
+		}
+	}
+	for _, count := range pattern.ReadSizes {
+		reads += count
+	}
+
+	if writes >= recommendMinIOs && float64(smallWrites) >= float64(writes)*recommendSmallWriteRatio {
+		recs = append(recs, &proto.VolRecommendation{
+			ID: recommendPackTinyExtents,
+			Reason: fmt.Sprintf("%.0f%% of the %v writes are not larger than %vKB, which are stored in the tiny extents",
+				float64(smallWrites)*100/float64(writes), writes, recommendSmallWriteSize>>10),
+			Action: "pack the tiny extents of the data partitions by /setPackTinyExtents?id=<partition>&packed=true of the data nodes",
+		})
+	}
+	if pattern.MaxMetaPartitionItems >= recommendMetaPartitionItems || pattern.MaxApplyQueue >= recommendApplyQueue {
+		recs = append(recs, &proto.VolRecommendation{
+			ID: recommendAddMetaPartition,
+			Reason: fmt.Sprintf("the largest of the %v meta partitions holds %v inodes and dentries, and %v proposals wait to be applied on the busiest replica",
+				pattern.MetaPartitions, pattern.MaxMetaPartitionItems, pattern.MaxApplyQueue),
+			Action: fmt.Sprintf("split the last meta partition by %v?name=%v&start=<inode>", proto.AdminCreateMetaPartition, vol.Name),
+		})
+	}
+	if ios := reads + writes; ios >= recommendMinIOs && !vol.FollowerRead && float64(reads) >= float64(ios)*recommendReadRatio {
+		recs = append(recs, &proto.VolRecommendation{
+			ID: recommendEnableFollowerRead,
+			Reason: fmt.Sprintf("%.0f%% of the %v reads and writes are reads, which are all served by the leaders",
+				float64(reads)*100/float64(ios), ios),
+			Action: fmt.Sprintf("%v?name=%v&authKey=<md5(owner)>&%v=true", proto.AdminUpdateVol, vol.Name, followerReadKey),
+		})
+	}
+	if lookups := pattern.IcacheHits + pattern.IcacheMiss; lookups >= recommendMinInodeLookups && !vol.metaCache &&
+		float64(pattern.IcacheMiss) >= float64(lookups)*recommendInodeCacheMiss {
+		recs = append(recs, &proto.VolRecommendation{
+			ID: recommendEnableMetaCache,
+			Reason: fmt.Sprintf("%.0f%% of the %v inode cache lookups of %v clients miss",
+				float64(pattern.IcacheMiss)*100/float64(lookups), lookups, pattern.Clients),
+			Action: fmt.Sprintf("%v?name=%v&authKey=<md5(owner)>&%v=true", proto.AdminUpdateVol, vol.Name, metaCacheKey),
+		})
+	}
+	return
+}
+
+func (m *Server) getVolRecommendations(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		vol  *Vol
+		err  error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	pattern := m.cluster.volAccessPattern(vol)
+	sendOkReply(w, r, newSuccessHTTPReply(&proto.VolRecommendations{
+		VolName:         vol.Name,
+		Pattern:         pattern,
+		Recommendations: recommendVolTuning(vol, pattern),
+	}))
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func hasRecommendation(recs []*proto.VolRecommendation, id string) bool {
+	for _, rec := range recs {
+		if rec.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRecommendVolTuning(t *testing.T) {
+	vol := &Vol{Name: "recommendVol"}
+	pattern := &proto.VolAccessPattern{
+		WriteSizes: make([]uint64, proto.IOSizeBucketCount),
+		ReadSizes:  make([]uint64, proto.IOSizeBucketCount),
+	}
+	if recs := recommendVolTuning(vol, pattern); len(recs) != 0 {
+		t.Fatalf("no recommendation expected for an idle volume, but got %v", recs)
+	}
+
+	pattern.WriteSizes[proto.IOSizeBucket(4096)] = 900
+	pattern.WriteSizes[proto.IOSizeBucket(1<<20)] = 100
+	pattern.ReadSizes[proto.IOSizeBucket(1<<20)] = 9000
+	pattern.MaxApplyQueue = recommendApplyQueue
+	pattern.IcacheMiss = recommendMinInodeLookups
+	recs := recommendVolTuning(vol, pattern)
+	for _, id := range []string{recommendPackTinyExtents, recommendAddMetaPartition, recommendEnableFollowerRead, recommendEnableMetaCache} {
+		if !hasRecommendation(recs, id) {
+			t.Errorf("expect recommendation[%v] in %v", id, recs)
+		}
+	}
+
+	vol.FollowerRead = true
+	vol.metaCache = true
+	pattern.WriteSizes[proto.IOSizeBucket(4096)] = 100
+	pattern.WriteSizes[proto.IOSizeBucket(1<<20)] = 900
+	pattern.MaxApplyQueue = 0
+	if recs = recommendVolTuning(vol, pattern); len(recs) != 0 {
+		t.Errorf("no recommendation expected for a tuned volume, but got %v", recs)
+	}
+}
+
+func TestGetVolRecommendations(t *testing.T) {
+	name := "recommendVol"
+	createVol(name, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := server.cluster.volAccessPattern(vol)
+	if len(pattern.WriteSizes) != proto.IOSizeBucketCount || pattern.MetaPartitions != len(vol.MetaPartitions) {
+		t.Errorf("unexpected access pattern %v", pattern)
+	}
+	reqURL := fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminVolRecommendations, name)
+	process(reqURL, t)
+}
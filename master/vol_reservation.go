@@ -0,0 +1,295 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const maxVolReservations = 100
+
+// activeReservationsLocked returns the reservations of the volume not expired yet, with the lock of the volume held.
+func (vol *Vol) activeReservationsLocked(now int64) (reservations []*proto.VolReservation) {
+	reservations = make([]*proto.VolReservation, 0, len(vol.reservations))
+	for _, reservation := range vol.reservations {
+		if reservation.ExpireTime > now {
+			reservations = append(reservations, reservation)
+		}
+	}
+	return
+}
+
+// reservedSizeLocked returns the space reserved on the volume in GB, with the lock of the volume held.
+func (vol *Vol) reservedSizeLocked(now int64) (size uint64) {
+	for _, reservation := range vol.activeReservationsLocked(now) {
+		size += reservation.Size
+	}
+	return
+}
+
+func (vol *Vol) reservedSize() uint64 {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.reservedSizeLocked(time.Now().Unix())
+}
+
+func (vol *Vol) getReservations() (reservations []*proto.VolReservation) {
+	vol.RLock()
+	defer vol.RUnlock()
+	for _, reservation := range vol.activeReservationsLocked(time.Now().Unix()) {
+		copied := *reservation
+		reservations = append(reservations, &copied)
+	}
+	return
+}
+
+// availableDataSpace returns the available space of the active data nodes in bytes.
+func (c *Cluster) availableDataSpace() (space uint64) {
+	c.dataNodes.Range(func(addr, node interface{}) bool {
+		dataNode := node.(*DataNode)
+		dataNode.RLock()
+		if dataNode.isActive && !dataNode.IsSpare {
+			space += dataNode.AvailableSpace
+		}
+		dataNode.RUnlock()
+		return true
+	})
+	return
+}
+
+// reservedSpaceExcept returns the space of the data nodes reserved by the volumes except the one, in bytes of all
+// the replicas.
+func (c *Cluster) reservedSpaceExcept(volName string) (space uint64) {
+	for name, vol := range c.copyVols() {
+		if name == volName || vol.status() == markDelete {
+			continue
+		}
+		space += vol.reservedSize() * util.GB * uint64(vol.dpReplicaNum)
+	}
+	return
+}
+
+// checkUnreservedSpace rejects a new data partition of the volume if the available space of the data nodes, less the
+// space reserved by the other volumes, can not hold its replicas, so that the volumes without the reservations do not
+// consume the space the reserving ones depend on.
+func (c *Cluster) checkUnreservedSpace(vol *Vol) (err error) {
+	reserved := c.reservedSpaceExcept(vol.Name)
+	if reserved == 0 {
+		return
+	}
+	available := c.availableDataSpace()
+	if need := vol.dataPartitionSize * uint64(vol.dpReplicaNum); available < reserved+need {
+		log.LogWarnf("action[checkUnreservedSpace] vol[%v] available[%v] reserved by the other vols[%v] need[%v]",
+			vol.Name, available, reserved, need)
+		return proto.ErrSpaceReserved
+	}
+	return
+}
+
+// reserveVolSpace reserves the space on the volume for ttlHours. The used and the reserved space of the volume can
+// not exceed its capacity, and the space reserved by all the volumes can not exceed the available space of the data
+// nodes. The expired reservations are dropped.
+func (c *Cluster) reserveVolSpace(name, authKey string, size uint64, ttlHours int64) (reservation *proto.VolReservation, err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return nil, proto.ErrVolNotExists
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return nil, proto.ErrVolAuthKeyNotMatch
+	}
+	// the other volumes are counted before the volume is locked, or two reservations lock each other's volumes
+	reservedByOthers := c.reservedSpaceExcept(name)
+	available := c.availableDataSpace()
+	id, err := c.idAlloc.allocateCommonID()
+	if err != nil {
+		return
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if vol.Status == markDelete {
+		return nil, proto.ErrVolNotExists
+	}
+	now := time.Now().Unix()
+	active := vol.activeReservationsLocked(now)
+	if len(active) >= maxVolReservations {
+		return nil, fmt.Errorf("vol[%v] has %v reservations at most", name, maxVolReservations)
+	}
+	reserved := vol.reservedSizeLocked(now)
+	if used := vol.totalUsedSpace() / util.GB; used+reserved+size > vol.Capacity {
+		log.LogWarnf("action[reserveVolSpace] vol[%v] used[%v] reserved[%v] size[%v] capacity[%v]", name, used, reserved,
+			size, vol.Capacity)
+		return nil, proto.ErrVolReservationExceedsCapacity
+	}
+	if reservedByOthers+(reserved+size)*util.GB*uint64(vol.dpReplicaNum) > available {
+		log.LogWarnf("action[reserveVolSpace] vol[%v] size[%v] reserved[%v] reserved by the other vols[%v] available[%v]",
+			name, size, reserved, reservedByOthers, available)
+		return nil, proto.ErrNoSpaceToReserve
+	}
+	reservation = &proto.VolReservation{
+		ID:         id,
+		VolName:    name,
+		Size:       size,
+		CreateTime: now,
+		ExpireTime: now + ttlHours*3600,
+	}
+	oldReservations := vol.reservations
+	vol.reservations = append(active, reservation)
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.reservations = oldReservations
+		log.LogErrorf("action[reserveVolSpace] vol[%v] err[%v]", name, err)
+		return nil, proto.ErrPersistenceByRaft
+	}
+	log.LogWarnf("action[reserveVolSpace] vol[%v] reservation[%v] size[%v] expires at[%v]", name, id, size,
+		time.Unix(reservation.ExpireTime, 0).Format(proto.TimeFormat))
+	copied := *reservation
+	return &copied, nil
+}
+
+func (c *Cluster) cancelVolReservation(name, authKey string, id uint64) (err error) {
+	vol, err := c.getVol(name)
+	if err != nil {
+		return proto.ErrVolNotExists
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	active := vol.activeReservationsLocked(time.Now().Unix())
+	reservations := make([]*proto.VolReservation, 0, len(active))
+	for _, reservation := range active {
+		if reservation.ID != id {
+			reservations = append(reservations, reservation)
+		}
+	}
+	if len(reservations) == len(active) {
+		return proto.ErrVolReservationNotExists
+	}
+	oldReservations := vol.reservations
+	vol.reservations = reservations
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.reservations = oldReservations
+		log.LogErrorf("action[cancelVolReservation] vol[%v] err[%v]", name, err)
+		return proto.ErrPersistenceByRaft
+	}
+	log.LogWarnf("action[cancelVolReservation] vol[%v] reservation[%v]", name, id)
+	return
+}
+
+func (c *Cluster) getVolReservationsView(vol *Vol) *proto.VolReservationsView {
+	view := &proto.VolReservationsView{
+		VolName:      vol.Name,
+		Capacity:     vol.capacity(),
+		UsedSize:     vol.totalUsedSpace() / util.GB,
+		Reservations: vol.getReservations(),
+	}
+	for _, reservation := range view.Reservations {
+		view.ReservedSize += reservation.Size
+	}
+	return view
+}
+
+func parseRequestToReserveVolSpace(r *http.Request) (name, authKey string, size uint64, ttlHours int64, err error) {
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	value := r.FormValue(dataPartitionSizeKey)
+	if value == "" {
+		err = keyNotFound(dataPartitionSizeKey)
+		return
+	}
+	if size, err = strconv.ParseUint(value, 10, 64); err != nil || size == 0 {
+		err = fmt.Errorf("%v must be a positive number of GB", dataPartitionSizeKey)
+		return
+	}
+	ttlHours = proto.DefaultVolReservationTTLHours
+	if value = r.FormValue(ttlKey); value != "" {
+		if ttlHours, err = strconv.ParseInt(value, 10, 64); err != nil || ttlHours <= 0 || ttlHours > proto.MaxVolReservationTTLHours {
+			err = fmt.Errorf("%v must be a number of hours in (0, %v]", ttlKey, proto.MaxVolReservationTTLHours)
+			return
+		}
+	}
+	return
+}
+
+func (m *Server) reserveVolSpace(w http.ResponseWriter, r *http.Request) {
+	name, authKey, size, ttlHours, err := parseRequestToReserveVolSpace(r)
+	if err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	reservation, err := m.cluster.reserveVolSpace(name, authKey, size, ttlHours)
+	if err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(reservation))
+}
+
+func (m *Server) cancelVolReservation(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		id      uint64
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if id, err = strconv.ParseUint(r.FormValue(idKey), 10, 64); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: unmatchedKey(idKey).Error()})
+		return
+	}
+	if err = m.cluster.cancelVolReservation(name, authKey, id); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("cancel reservation[%v] of vol[%v] successfully", id, name)))
+}
+
+// getVolReservations shows the active reservations of the volume, or of all the volumes with the active reservations
+// in the order of their names if the name is empty.
+func (m *Server) getVolReservations(w http.ResponseWriter, r *http.Request) {
+	var (
+		name = r.FormValue(nameKey)
+		vol  *Vol
+		err  error
+	)
+	if name != "" {
+		if vol, err = m.cluster.getVol(name); err != nil {
+			sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+			return
+		}
+		sendOkReply(w, r, newSuccessHTTPReply(m.cluster.getVolReservationsView(vol)))
+		return
+	}
+	views := make([]*proto.VolReservationsView, 0)
+	for _, vol = range m.cluster.copyVols() {
+		if view := m.cluster.getVolReservationsView(vol); len(view.Reservations) > 0 {
+			views = append(views, view)
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].VolName < views[j].VolName })
+	sendOkReply(w, r, newSuccessHTTPReply(views))
+}
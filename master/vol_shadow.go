@@ -0,0 +1,368 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	shadowVolSuffix = "-shadow"
+	// the primary volume fails over to its shadow automatically once it is unavailable for the period
+	defaultShadowFailoverSec = 120
+)
+
+func shadowVolName(name string) string {
+	return name + shadowVolSuffix
+}
+
+func (vol *Vol) shadowView() (view *proto.VolShadowView) {
+	vol.RLock()
+	defer vol.RUnlock()
+	if vol.shadow == nil {
+		return nil
+	}
+	view = &proto.VolShadowView{}
+	*view = *vol.shadow
+	return
+}
+
+// shadowName returns the shadow volume which the meta partitions of the volume mirror the mutations to.
+func (vol *Vol) shadowName() string {
+	vol.RLock()
+	defer vol.RUnlock()
+	if vol.shadow == nil {
+		return ""
+	}
+	return vol.shadow.Name
+}
+
+func (vol *Vol) getShadowOf() string {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.shadowOf
+}
+
+// createShadowVol creates the shadow of the volume to create, which is marked as the shadow before the volume is
+// created, so that the partitions of the volume are placed on the nodes other than the ones of the shadow.
+func (c *Cluster) createShadowVol(name, owner, zoneName, description string, mpCount, dpReplicaNum, size, capacity int, opts createVolOptions) (shadowVol *Vol, err error) {
+	shadowOpts := createVolOptions{
+		followerRead:    opts.followerRead,
+		crossZone:       opts.crossZone,
+		caseInsensitive: opts.caseInsensitive,
+	}
+	if shadowVol, err = c.createVol(shadowVolName(name), owner, zoneName, description, mpCount, dpReplicaNum, size, capacity, shadowOpts); err != nil {
+		return
+	}
+	shadowVol.Lock()
+	shadowVol.shadowOf = name
+	if err = c.syncUpdateVol(shadowVol); err != nil {
+		shadowVol.shadowOf = ""
+		shadowVol.Unlock()
+		c.abandonShadowVol(shadowVol)
+		return nil, proto.ErrPersistenceByRaft
+	}
+	shadowVol.Unlock()
+	log.LogInfof("action[createShadowVol] vol[%v] is created as the shadow of vol[%v]", shadowVol.Name, name)
+	return
+}
+
+// abandonShadowVol marks the shadow deleted once the volume fails to be created, and the partitions of the shadow
+// are deleted by the scheduled checks.
+func (c *Cluster) abandonShadowVol(shadowVol *Vol) {
+	shadowVol.Lock()
+	defer shadowVol.Unlock()
+	shadowVol.Status = markDelete
+	shadowVol.deleteTime = time.Now().Unix()
+	if err := c.syncUpdateVol(shadowVol); err != nil {
+		log.LogErrorf("action[abandonShadowVol] vol[%v] err[%v]", shadowVol.Name, err)
+	}
+}
+
+// isLiveShadowVol returns whether the volume is the shadow of a volume not deleted, which is deleted along with that
+// volume rather than on its own.
+func (c *Cluster) isLiveShadowVol(vol *Vol) bool {
+	primary := vol.getShadowOf()
+	if primary == "" {
+		return false
+	}
+	primaryVol, err := c.getVol(primary)
+	return err == nil && primaryVol.status() != markDelete
+}
+
+// syncShadowVolStatus marks the shadow deleted or restored along with the volume, which is locked by the caller.
+func (c *Cluster) syncShadowVolStatus(vol *Vol) {
+	if vol.shadow == nil {
+		return
+	}
+	shadowVol, err := c.getVol(vol.shadow.Name)
+	if err != nil {
+		return
+	}
+	shadowVol.Lock()
+	defer shadowVol.Unlock()
+	if shadowVol.Status == vol.Status {
+		return
+	}
+	shadowVol.Status = vol.Status
+	shadowVol.deleteTime = vol.deleteTime
+	if err = c.syncUpdateVol(shadowVol); err != nil {
+		log.LogErrorf("action[syncShadowVolStatus] vol[%v] shadow[%v] err[%v]", vol.Name, shadowVol.Name, err)
+		return
+	}
+	log.LogWarnf("action[syncShadowVolStatus] shadow[%v] of vol[%v] status[%v]", shadowVol.Name, vol.Name, vol.Status)
+}
+
+// shadowPartner returns the volume paired with the volume by the shadow replication, nil if it is not paired.
+func (c *Cluster) shadowPartner(vol *Vol) *Vol {
+	vol.RLock()
+	name := vol.shadowOf
+	if vol.shadow != nil {
+		name = vol.shadow.Name
+	}
+	vol.RUnlock()
+	if name == "" {
+		return nil
+	}
+	partner, err := c.getVol(name)
+	if err != nil {
+		return nil
+	}
+	return partner
+}
+
+// shadowPartnerHosts returns the hosts of the meta or data partitions of the volume paired with the volume, which are
+// avoided by the new partitions of the volume, so that a node failure never takes down both of them.
+func (c *Cluster) shadowPartnerHosts(vol *Vol, meta bool) (hosts []string) {
+	partner := c.shadowPartner(vol)
+	if partner == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	add := func(addrs []string) {
+		for _, addr := range addrs {
+			if !seen[addr] {
+				seen[addr] = true
+				hosts = append(hosts, addr)
+			}
+		}
+	}
+	if meta {
+		for _, mp := range partner.cloneMetaPartitionMap() {
+			mp.RLock()
+			add(mp.Hosts)
+			mp.RUnlock()
+		}
+		return
+	}
+	for _, dp := range partner.cloneDataPartitionMap() {
+		dp.RLock()
+		add(dp.Hosts)
+		dp.RUnlock()
+	}
+	return
+}
+
+// chooseTargetMetaHostsForVol chooses the hosts of a new meta partition of the volume, avoiding the meta nodes of
+// the volume paired by the shadow replication unless the other meta nodes are not enough.
+func (c *Cluster) chooseTargetMetaHostsForVol(vol *Vol) (hosts []string, peers []proto.Peer, err error) {
+	if excludeHosts := c.shadowPartnerHosts(vol, true); len(excludeHosts) > 0 {
+		if hosts, peers, err = c.chooseTargetMetaHosts("", nil, excludeHosts, int(vol.mpReplicaNum), vol.crossZone, vol.zoneName); err == nil {
+			return
+		}
+		msg := fmt.Sprintf("action[chooseTargetMetaHostsForVol] vol[%v] no enough meta nodes disjoint from its shadow "+
+			"pair, err[%v]", vol.Name, err)
+		log.LogWarn(msg)
+		Warn(c.Name, msg)
+	}
+	return c.chooseTargetMetaHosts("", nil, nil, int(vol.mpReplicaNum), vol.crossZone, vol.zoneName)
+}
+
+// servingVol returns the volume whose partitions serve the clients of the volume, which is the shadow once the
+// volume fails over to it.
+func (c *Cluster) servingVol(vol *Vol) *Vol {
+	view := vol.shadowView()
+	if view == nil || !view.Active {
+		return vol
+	}
+	shadowVol, err := c.getVol(view.Name)
+	if err != nil {
+		return vol
+	}
+	return shadowVol
+}
+
+// markShadowOutOfSync latches the shadow of the volume out of sync once a mutation fails to be mirrored to it, so that
+// the volume never fails over to the shadow automatically.
+func (c *Cluster) markShadowOutOfSync(vol *Vol, reason string) {
+	vol.Lock()
+	defer vol.Unlock()
+	if vol.shadow == nil || vol.shadow.OutOfSync || vol.shadow.Active {
+		return
+	}
+	old := vol.shadow
+	shadow := *old
+	shadow.OutOfSync = true
+	shadow.SyncError = reason
+	vol.shadow = &shadow
+	if err := c.syncUpdateVol(vol); err != nil {
+		vol.shadow = old
+		log.LogErrorf("action[markShadowOutOfSync] vol[%v] err[%v]", vol.Name, err)
+		return
+	}
+	msg := fmt.Sprintf("action[markShadowOutOfSync] clusterID[%v] the shadow of vol[%v] is out of sync: %v",
+		c.Name, vol.Name, reason)
+	log.LogError(msg)
+	Warn(c.Name, msg)
+}
+
+// partitionsAvailable returns whether all the meta partitions and data partitions of the volume are available, the
+// ones lost their leaders or all their replicas leave some files of the volume unavailable.
+func (vol *Vol) partitionsAvailable() (ok bool, reason string) {
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		mp.RLock()
+		status := mp.Status
+		mp.RUnlock()
+		if status == proto.Unavailable {
+			return false, fmt.Sprintf("meta partition[%v] is unavailable", mp.PartitionID)
+		}
+	}
+	for _, dp := range vol.cloneDataPartitionMap() {
+		dp.RLock()
+		status := dp.Status
+		dp.RUnlock()
+		if status == proto.Unavailable {
+			return false, fmt.Sprintf("data partition[%v] is unavailable", dp.PartitionID)
+		}
+	}
+	return true, ""
+}
+
+// checkShadowFailover fails the volume over to its shadow once the volume is unavailable for defaultShadowFailoverSec,
+// if the shadow is available and in sync. The clients switch to the partitions of the shadow by the views of the
+// volume refreshed periodically.
+func (c *Cluster) checkShadowFailover(vol *Vol) {
+	view := vol.shadowView()
+	if view == nil || view.Active {
+		return
+	}
+	ok, reason := vol.partitionsAvailable()
+	if ok {
+		vol.Lock()
+		vol.unavailableSince = 0
+		vol.Unlock()
+		return
+	}
+	now := time.Now().Unix()
+	vol.Lock()
+	if vol.unavailableSince == 0 {
+		vol.unavailableSince = now
+	}
+	since := vol.unavailableSince
+	vol.Unlock()
+	if now-since < defaultShadowFailoverSec {
+		return
+	}
+	if view.OutOfSync {
+		log.LogWarnf("action[checkShadowFailover] vol[%v] is unavailable, but its shadow is out of sync, reason[%v]",
+			vol.Name, reason)
+		return
+	}
+	if err := c.failoverToShadow(vol, "unavailable since "+time.Unix(since, 0).Format(proto.TimeFormat)+": "+reason, false); err != nil {
+		log.LogErrorf("action[checkShadowFailover] vol[%v] err[%v]", vol.Name, err)
+	}
+}
+
+// failoverToShadow switches the clients of the volume to its shadow. The shadow out of sync only takes over if forced,
+// since the mutations failed to be mirrored are lost. Once the volume fails over, the clients stop mirroring to the
+// shadow, which is never switched back.
+func (c *Cluster) failoverToShadow(vol *Vol, by string, force bool) (err error) {
+	view := vol.shadowView()
+	if view == nil {
+		return proto.ErrNoShadowVol
+	}
+	if view.Active {
+		return proto.ErrShadowVolActive
+	}
+	if view.OutOfSync && !force {
+		return fmt.Errorf("the shadow of vol[%v] is out of sync: %v", vol.Name, view.SyncError)
+	}
+	shadowVol, err := c.getVol(view.Name)
+	if err != nil {
+		return proto.ErrVolNotExists
+	}
+	if ok, reason := shadowVol.partitionsAvailable(); !ok && !force {
+		return fmt.Errorf("the shadow of vol[%v] is unavailable: %v", vol.Name, reason)
+	}
+	vol.Lock()
+	old := vol.shadow
+	if old == nil || old.Active {
+		vol.Unlock()
+		return proto.ErrShadowVolActive
+	}
+	shadow := *old
+	shadow.Active = true
+	shadow.FailoverTime = time.Now().Unix()
+	shadow.FailoverBy = by
+	vol.shadow = &shadow
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.shadow = old
+		vol.Unlock()
+		return proto.ErrPersistenceByRaft
+	}
+	vol.Unlock()
+	vol.updateViewCache(c)
+	msg := fmt.Sprintf("action[failoverToShadow] clusterID[%v] vol[%v] failed over to shadow[%v], by[%v]",
+		c.Name, vol.Name, shadow.Name, by)
+	log.LogWarn(msg)
+	Warn(c.Name, msg)
+	return
+}
+
+func (m *Server) failoverVolToShadow(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		force   bool
+		vol     *Vol
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if force, err = extractForce(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: unmatchedKey(forceKey).Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	if !matchKey(vol.Owner, authKey) {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolAuthKeyNotMatch))
+		return
+	}
+	if err = m.cluster.failoverToShadow(vol, "manual from "+r.RemoteAddr, force); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(vol.shadowView()))
+}
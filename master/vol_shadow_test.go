@@ -0,0 +1,108 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestShadowVol(t *testing.T) {
+	name := "shadowVol"
+	reqURL := fmt.Sprintf("%v%v?name=%v&replicas=3&type=extent&capacity=100&owner=cfs&mpCount=2&zoneName=%v&shadow=true",
+		hostAddr, proto.AdminCreateVol, name, testZone2)
+	process(reqURL, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadowVol, err := server.cluster.getVol(shadowVolName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view := vol.shadowView(); view == nil || view.Name != shadowVol.Name || view.Active {
+		t.Fatalf("vol[%v] has unexpected shadow %v", name, view)
+	}
+	if shadowVol.getShadowOf() != name || shadowVol.shadowName() != "" {
+		t.Fatalf("vol[%v] is not the shadow of vol[%v]", shadowVol.Name, name)
+	}
+	restored := newVolFromVolValue(newVolValue(vol))
+	if restored.shadow == nil || restored.shadow.Name != shadowVol.Name || newVolFromVolValue(newVolValue(shadowVol)).shadowOf != name {
+		t.Errorf("the shadow pairing is not persisted")
+	}
+	for _, mp := range vol.cloneMetaPartitionMap() {
+		for _, task := range mp.buildNewMetaPartitionTasks(nil, mp.Peers, name, vol.caseInsensitive, vol.shadowName()) {
+			if req := task.Request.(*proto.CreateMetaPartitionRequest); req.ShadowVol != shadowVol.Name {
+				t.Errorf("mp[%v] is created without the shadow", mp.PartitionID)
+			}
+		}
+	}
+	hosts := server.cluster.shadowPartnerHosts(vol, true)
+	for _, mp := range shadowVol.cloneMetaPartitionMap() {
+		for _, host := range mp.Hosts {
+			if !contains(hosts, host) {
+				t.Errorf("host[%v] of the shadow is not avoided by vol[%v]", host, name)
+			}
+		}
+	}
+
+	if err = server.cluster.markDeleteVol(shadowVol.Name, buildAuthKey("cfs")); err != proto.ErrShadowVol {
+		t.Errorf("expect err[%v] to delete the shadow, but got [%v]", proto.ErrShadowVol, err)
+	}
+	if err = server.cluster.failoverToShadow(shadowVol, "test", false); err != proto.ErrNoShadowVol {
+		t.Errorf("expect err[%v] to fail over the shadow, but got [%v]", proto.ErrNoShadowVol, err)
+	}
+
+	server.cluster.markShadowOutOfSync(vol, "test")
+	if view := vol.shadowView(); !view.OutOfSync {
+		t.Fatalf("the shadow of vol[%v] is not out of sync", name)
+	}
+	if err = server.cluster.failoverToShadow(vol, "test", false); err == nil {
+		t.Errorf("vol[%v] fails over to the shadow out of sync", name)
+	}
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v&force=true", hostAddr, proto.AdminVolShadowFailover, name,
+		buildAuthKey("cfs")), t)
+	if view := vol.shadowView(); !view.Active || view.FailoverTime == 0 {
+		t.Fatalf("vol[%v] is not failed over, shadow %v", name, view)
+	}
+	if server.cluster.servingVol(vol) != shadowVol {
+		t.Errorf("vol[%v] is not served by the shadow", name)
+	}
+	vol.updateViewCache(server.cluster)
+	mpViews := make([]*proto.MetaPartitionView, 0)
+	if err = json.Unmarshal(vol.getMpsCache(), &proto.HTTPReply{Data: &mpViews}); err != nil {
+		t.Fatal(err)
+	}
+	shadowMps := shadowVol.cloneMetaPartitionMap()
+	if len(mpViews) != len(shadowMps) {
+		t.Errorf("vol[%v] serves %v meta partitions, expect the %v ones of the shadow", name, len(mpViews), len(shadowMps))
+	}
+	for _, mpView := range mpViews {
+		if _, ok := shadowMps[mpView.PartitionID]; !ok {
+			t.Errorf("mp[%v] of vol[%v] is served after the failover", mpView.PartitionID, name)
+		}
+	}
+	if err = server.cluster.failoverToShadow(vol, "test", true); err != proto.ErrShadowVolActive {
+		t.Errorf("expect err[%v] to fail over again, but got [%v]", proto.ErrShadowVolActive, err)
+	}
+
+	process(fmt.Sprintf("%v%v?name=%v&authKey=%v", hostAddr, proto.AdminDeleteVol, name, buildAuthKey("cfs")), t)
+	if shadowVol.status() != markDelete {
+		t.Errorf("the shadow of vol[%v] is not deleted along with it", name)
+	}
+}
@@ -28,6 +28,30 @@ func TestAutoCreateDataPartitions(t *testing.T) {
 	}
 }
 
+func TestAllocationEpoch(t *testing.T) {
+	name := "allocEpochVol"
+	createVol(name, t)
+	vol, err := server.cluster.getVol(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch := vol.allocationEpoch()
+	updateVol(name, 200, t)
+	if vol.allocationEpoch() == epoch {
+		t.Fatalf("the allocation epoch should be bumped by the capacity change")
+	}
+	if _, err = server.cluster.createDataPartition(name, 1, epoch); err != proto.ErrStaleVolCapacity {
+		t.Errorf("the creation planned by the stale capacity should be rejected, err[%v]", err)
+	}
+	dpCount := len(vol.dataPartitions.partitions)
+	if _, err = server.cluster.batchCreateDataPartition(vol, 1, vol.allocationEpoch()); err != nil {
+		t.Fatal(err)
+	}
+	if newDpCount := len(vol.dataPartitions.partitions); newDpCount != dpCount+1 {
+		t.Errorf("expect %v data partitions, but is %v", dpCount+1, newDpCount)
+	}
+}
+
 func TestCheckVol(t *testing.T) {
 	commonVol.checkStatus(server.cluster)
 	commonVol.checkMetaPartitions(server.cluster)
@@ -0,0 +1,552 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// VolUsageHook is the hook of an external system, such as a billing system, notified of the volume usage events by
+// the leader master. An event is delivered again until Deliver succeeds, also by the next leader, so Deliver should
+// drop the events of the IDs seen before.
+type VolUsageHook interface {
+	Name() string
+	Deliver(event *proto.VolUsageEvent) error
+}
+
+var (
+	volUsagePluginsLock sync.RWMutex
+	volUsagePlugins     = make(map[string]VolUsageHook)
+)
+
+// RegisterVolUsageHook registers the hook into the master, which is normally called by the init function of the
+// package of the hook linked into a custom build of the master. The hook replaces the one registered with the name.
+func RegisterVolUsageHook(hook VolUsageHook) {
+	volUsagePluginsLock.Lock()
+	defer volUsagePluginsLock.Unlock()
+	volUsagePlugins[hook.Name()] = hook
+}
+
+func volUsagePluginNames() (names []string) {
+	volUsagePluginsLock.RLock()
+	defer volUsagePluginsLock.RUnlock()
+	names = make([]string, 0, len(volUsagePlugins))
+	for name := range volUsagePlugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// httpVolUsageHook posts the events to the webhook, which accepts an event with a 2xx status code.
+type httpVolUsageHook struct {
+	url    string
+	client *http.Client
+}
+
+func (h *httpVolUsageHook) Name() string {
+	return h.url
+}
+
+func (h *httpVolUsageHook) Deliver(event *proto.VolUsageEvent) (err error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("status code[%v]", resp.StatusCode)
+	}
+	return
+}
+
+// volUsageRecord is the persisted state of an event not delivered to all the hooks yet.
+type volUsageRecord struct {
+	Event     *proto.VolUsageEvent
+	Hooks     []string // the names of the hooks the event is not delivered to yet
+	Attempts  int
+	LastError string
+	DeadTime  int64     // the time the event is moved to the dead letters, or zero
+	nextTime  time.Time // the time to deliver the event again after a failure
+}
+
+// volUsageHooks keeps the events to be delivered to the volume usage hooks. An event is persisted before it is
+// delivered and deleted once it is delivered to all the hooks, so it is delivered at least once even if the leader is
+// changed. The events are delivered to every hook in the order of their IDs. An event failing within the attempts is
+// moved to the dead letters, which no longer hold back the later events, and are kept until they are retried or
+// purged by the administrator.
+type volUsageHooks struct {
+	sync.RWMutex
+	webhooks      []string
+	tickInterval  int64
+	lastTick      time.Time
+	records       map[uint64]*volUsageRecord // event id -> record, changed with both the locks held
+	deliverLock   sync.Mutex                 // serializes the deliveries and the operations on the dead letters
+	notifyCh      chan struct{}
+	maxAttempts   int
+	retryInterval time.Duration
+	client        *http.Client
+}
+
+func newVolUsageHooks() *volUsageHooks {
+	return &volUsageHooks{
+		records:       make(map[uint64]*volUsageRecord),
+		notifyCh:      make(chan struct{}, 1),
+		maxAttempts:   defaultVolUsageMaxAttempts,
+		retryInterval: time.Duration(defaultIntervalToDeliverVolUsage) * time.Second,
+		client:        &http.Client{Timeout: time.Duration(defaultEventPushTimeoutSec) * time.Second},
+	}
+}
+
+func (h *volUsageHooks) getWebhooks() []string {
+	h.RLock()
+	defer h.RUnlock()
+	return h.webhooks
+}
+
+func (h *volUsageHooks) setWebhooks(webhooks []string) {
+	h.Lock()
+	defer h.Unlock()
+	h.webhooks = webhooks
+}
+
+func (h *volUsageHooks) getTickInterval() int64 {
+	h.RLock()
+	defer h.RUnlock()
+	if h.tickInterval <= 0 {
+		return defaultVolUsageTickIntervalSec
+	}
+	return h.tickInterval
+}
+
+func (h *volUsageHooks) setTickInterval(tickInterval int64) {
+	h.Lock()
+	defer h.Unlock()
+	h.tickInterval = tickInterval
+}
+
+// hooks returns the configured webhooks and the registered hooks by their names.
+func (h *volUsageHooks) hooks() (hooks map[string]VolUsageHook) {
+	h.RLock()
+	hooks = make(map[string]VolUsageHook, len(h.webhooks))
+	for _, webhook := range h.webhooks {
+		hooks[webhook] = &httpVolUsageHook{url: webhook, client: h.client}
+	}
+	h.RUnlock()
+	volUsagePluginsLock.RLock()
+	for name, hook := range volUsagePlugins {
+		hooks[name] = hook
+	}
+	volUsagePluginsLock.RUnlock()
+	return
+}
+
+func (h *volUsageHooks) putRecord(record *volUsageRecord) {
+	h.Lock()
+	defer h.Unlock()
+	h.records[record.Event.ID] = record
+}
+
+func (h *volUsageHooks) deleteRecord(id uint64) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.records, id)
+}
+
+func (h *volUsageHooks) updateRecord(record, updated *volUsageRecord) {
+	h.Lock()
+	defer h.Unlock()
+	*record = *updated
+}
+
+// clearRecords forgets the records, which are loaded again by the next leader.
+func (h *volUsageHooks) clearRecords() {
+	h.Lock()
+	defer h.Unlock()
+	h.records = make(map[uint64]*volUsageRecord)
+	h.lastTick = time.Time{}
+}
+
+// sortedRecords returns the records in the order of the IDs of their events.
+func (h *volUsageHooks) sortedRecords() (records []*volUsageRecord) {
+	h.RLock()
+	defer h.RUnlock()
+	records = make([]*volUsageRecord, 0, len(h.records))
+	for _, record := range h.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Event.ID < records[j].Event.ID
+	})
+	return
+}
+
+// deadLetters returns the dead letters of the event ID, or all of them if the ID is zero.
+func (h *volUsageHooks) deadLetters(id uint64) (records []*volUsageRecord, err error) {
+	for _, record := range h.sortedRecords() {
+		if record.DeadTime != 0 && (id == 0 || record.Event.ID == id) {
+			records = append(records, record)
+		}
+	}
+	if id != 0 && len(records) == 0 {
+		err = fmt.Errorf("dead letter of event[%v] not found", id)
+	}
+	return
+}
+
+func (h *volUsageHooks) notify() {
+	select {
+	case h.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (h *volUsageHooks) view() (view *proto.VolUsageHooksView) {
+	view = &proto.VolUsageHooksView{
+		Webhooks:        h.getWebhooks(),
+		Plugins:         volUsagePluginNames(),
+		TickIntervalSec: h.getTickInterval(),
+		DeadLetters:     make([]*proto.VolUsageDeadLetter, 0),
+	}
+	records := h.sortedRecords()
+	h.RLock()
+	defer h.RUnlock()
+	for _, record := range records {
+		if record.DeadTime == 0 {
+			view.Pending++
+			continue
+		}
+		view.DeadLetters = append(view.DeadLetters, &proto.VolUsageDeadLetter{
+			Event:     record.Event,
+			Hooks:     record.Hooks,
+			Attempts:  record.Attempts,
+			LastError: record.LastError,
+			Time:      record.DeadTime,
+		})
+	}
+	return
+}
+
+// newVolUsageEvent returns the event of the volume, without taking the lock of the volume held by the callers.
+func (c *Cluster) newVolUsageEvent(eventType string, vol *Vol) *proto.VolUsageEvent {
+	return &proto.VolUsageEvent{
+		Cluster:   c.Name,
+		Type:      eventType,
+		Vol:       vol.Name,
+		VolID:     vol.ID,
+		Owner:     vol.Owner,
+		Capacity:  vol.Capacity,
+		TotalSize: vol.Capacity * util.GB,
+		UsedSize:  vol.totalUsedSpace(),
+	}
+}
+
+// recordVolUsageEvent persists the event to be delivered to the hooks. The event is dropped if there are no hooks.
+func (c *Cluster) recordVolUsageEvent(event *proto.VolUsageEvent) {
+	hooks := c.volUsage.hooks()
+	if len(hooks) == 0 {
+		return
+	}
+	if err := c.persistVolUsageEvent(event, hooks); err != nil {
+		Warn(c.Name, fmt.Sprintf("action[recordVolUsageEvent] clusterID[%v] %v of vol[%v] is lost, err[%v]",
+			c.Name, event.Type, event.Vol, err))
+		return
+	}
+	c.volUsage.notify()
+}
+
+func (c *Cluster) persistVolUsageEvent(event *proto.VolUsageEvent, hooks map[string]VolUsageHook) (err error) {
+	if event.ID, err = c.idAlloc.allocateCommonID(); err != nil {
+		return
+	}
+	event.Time = time.Now().Unix()
+	record := &volUsageRecord{Event: event, Hooks: make([]string, 0, len(hooks))}
+	for name := range hooks {
+		record.Hooks = append(record.Hooks, name)
+	}
+	sort.Strings(record.Hooks)
+	if err = c.syncPutVolUsageRecord(record); err != nil {
+		return
+	}
+	c.volUsage.putRecord(record)
+	return
+}
+
+// deliverVolUsageEvents delivers every pending event to the hooks it is not delivered to yet. A hook failing to take
+// an event is not delivered the later events in the round, so that every hook takes the events in order.
+func (c *Cluster) deliverVolUsageEvents() {
+	h := c.volUsage
+	h.deliverLock.Lock()
+	defer h.deliverLock.Unlock()
+	hooks := h.hooks()
+	blocked := make(map[string]bool)
+	now := time.Now()
+	for _, record := range h.sortedRecords() {
+		if record.DeadTime != 0 {
+			continue
+		}
+		if now.Before(record.nextTime) {
+			for _, name := range record.Hooks {
+				blocked[name] = true
+			}
+			continue
+		}
+		var failure error
+		updated := *record
+		updated.Hooks = make([]string, 0, len(record.Hooks))
+		for _, name := range record.Hooks {
+			hook, ok := hooks[name]
+			if !ok {
+				log.LogWarnf("action[deliverVolUsageEvents] event[%v] is dropped for hook[%v] is removed", record.Event.ID, name)
+				continue
+			}
+			if blocked[name] {
+				updated.Hooks = append(updated.Hooks, name)
+				continue
+			}
+			if err := hook.Deliver(record.Event); err != nil {
+				log.LogWarnf("action[deliverVolUsageEvents] deliver event[%v] to hook[%v] err[%v]", record.Event.ID, name, err)
+				blocked[name] = true
+				updated.Hooks = append(updated.Hooks, name)
+				failure = fmt.Errorf("hook[%v]: %v", name, err)
+			}
+		}
+		c.updateVolUsageRecord(record, &updated, failure, now)
+	}
+}
+
+func (c *Cluster) updateVolUsageRecord(record, updated *volUsageRecord, failure error, now time.Time) {
+	h := c.volUsage
+	if len(updated.Hooks) == 0 {
+		if err := c.syncDeleteVolUsageRecord(record.Event.ID); err != nil {
+			log.LogErrorf("action[deliverVolUsageEvents] delete event[%v] err[%v]", record.Event.ID, err)
+			return
+		}
+		h.deleteRecord(record.Event.ID)
+		return
+	}
+	changed := len(updated.Hooks) != len(record.Hooks)
+	if failure != nil {
+		updated.Attempts++
+		updated.LastError = failure.Error()
+		retryInterval := time.Duration(updated.Attempts) * h.retryInterval
+		if maxInterval := time.Duration(defaultVolUsageMaxRetryIntervalSec) * time.Second; retryInterval > maxInterval {
+			retryInterval = maxInterval
+		}
+		updated.nextTime = now.Add(retryInterval)
+		if updated.Attempts >= h.maxAttempts {
+			updated.DeadTime = now.Unix()
+			changed = true
+		}
+	}
+	if changed {
+		if err := c.syncPutVolUsageRecord(updated); err != nil {
+			log.LogErrorf("action[deliverVolUsageEvents] update event[%v] err[%v]", record.Event.ID, err)
+			return
+		}
+	}
+	h.updateRecord(record, updated)
+	if updated.DeadTime != 0 {
+		Warn(c.Name, fmt.Sprintf("action[deliverVolUsageEvents] clusterID[%v] event[%v] %v of vol[%v] is moved to the "+
+			"dead letters after %v attempts, hooks%v, err[%v]", c.Name, updated.Event.ID, updated.Event.Type,
+			updated.Event.Vol, updated.Attempts, updated.Hooks, updated.LastError))
+	}
+}
+
+// retryVolUsageDeadLetters moves the dead letters of the event ID, or all of them if the ID is zero, back to be
+// delivered.
+func (c *Cluster) retryVolUsageDeadLetters(id uint64) (count int, err error) {
+	h := c.volUsage
+	h.deliverLock.Lock()
+	defer h.deliverLock.Unlock()
+	records, err := h.deadLetters(id)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		updated := *record
+		updated.Attempts, updated.LastError, updated.DeadTime, updated.nextTime = 0, "", 0, time.Time{}
+		if err = c.syncPutVolUsageRecord(&updated); err != nil {
+			err = proto.ErrPersistenceByRaft
+			return
+		}
+		h.updateRecord(record, &updated)
+		count++
+	}
+	h.notify()
+	return
+}
+
+// purgeVolUsageDeadLetters drops the dead letters of the event ID, or all of them if the ID is zero.
+func (c *Cluster) purgeVolUsageDeadLetters(id uint64) (count int, err error) {
+	h := c.volUsage
+	h.deliverLock.Lock()
+	defer h.deliverLock.Unlock()
+	records, err := h.deadLetters(id)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		if err = c.syncDeleteVolUsageRecord(record.Event.ID); err != nil {
+			err = proto.ErrPersistenceByRaft
+			return
+		}
+		h.deleteRecord(record.Event.ID)
+		count++
+	}
+	return
+}
+
+// tickVolUsage records the usage events of the volumes once in the tick interval.
+func (c *Cluster) tickVolUsage() {
+	h := c.volUsage
+	if len(h.hooks()) == 0 {
+		return
+	}
+	interval := time.Duration(h.getTickInterval()) * time.Second
+	h.Lock()
+	if time.Since(h.lastTick) < interval {
+		h.Unlock()
+		return
+	}
+	h.lastTick = time.Now()
+	h.Unlock()
+	for _, vol := range c.copyVols() {
+		if vol.Status != normal {
+			continue
+		}
+		c.recordVolUsageEvent(c.newVolUsageEvent(proto.VolUsageTick, vol))
+	}
+}
+
+func (c *Cluster) scheduleToTickVolUsage() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.tickVolUsage()
+			}
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+func (c *Cluster) scheduleToDeliverVolUsageEvents() {
+	go func() {
+		for {
+			select {
+			case <-c.volUsage.notifyCh:
+			case <-time.After(time.Duration(defaultIntervalToDeliverVolUsage) * time.Second):
+			}
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.deliverVolUsageEvents()
+			}
+		}
+	}()
+}
+
+func (c *Cluster) setVolUsageHooks(webhooks []string, tickInterval int64) (err error) {
+	oldWebhooks := c.volUsage.getWebhooks()
+	oldTickInterval := c.volUsage.getTickInterval()
+	c.volUsage.setWebhooks(webhooks)
+	c.volUsage.setTickInterval(tickInterval)
+	if err = c.syncPutCluster(); err != nil {
+		log.LogErrorf("action[setVolUsageHooks] err[%v]", err)
+		c.volUsage.setWebhooks(oldWebhooks)
+		c.volUsage.setTickInterval(oldTickInterval)
+		err = proto.ErrPersistenceByRaft
+		return
+	}
+	return
+}
+
+func (m *Server) getVolUsageHooks(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.volUsage.view()))
+}
+
+func (m *Server) setVolUsageHooks(w http.ResponseWriter, r *http.Request) {
+	var (
+		webhooks     []string
+		tickInterval int64
+		err          error
+	)
+	if err = r.ParseForm(); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	webhooks = m.cluster.volUsage.getWebhooks()
+	if _, ok := r.Form[webhooksKey]; ok {
+		if webhooks, err = parseEventWebhooks(r.FormValue(webhooksKey)); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+			return
+		}
+	}
+	tickInterval = m.cluster.volUsage.getTickInterval()
+	if value := r.FormValue(tickIntervalKey); value != "" {
+		if tickInterval, err = strconv.ParseInt(value, 10, 64); err != nil || tickInterval < minVolUsageTickIntervalSec {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError,
+				Msg: fmt.Sprintf("invalid %v[%v], at least %v seconds", tickIntervalKey, value, minVolUsageTickIntervalSec)})
+			return
+		}
+	}
+	if err = m.cluster.setVolUsageHooks(webhooks, tickInterval); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set vol usage webhooks to %v and tick interval to %vs successfully",
+		webhooks, tickInterval)))
+}
+
+func (m *Server) retryVolUsageDeadLetters(w http.ResponseWriter, r *http.Request) {
+	m.operateVolUsageDeadLetters(w, r, "retry", m.cluster.retryVolUsageDeadLetters)
+}
+
+func (m *Server) purgeVolUsageDeadLetters(w http.ResponseWriter, r *http.Request) {
+	m.operateVolUsageDeadLetters(w, r, "purge", m.cluster.purgeVolUsageDeadLetters)
+}
+
+func (m *Server) operateVolUsageDeadLetters(w http.ResponseWriter, r *http.Request, action string,
+	operate func(id uint64) (int, error)) {
+	var (
+		id    uint64
+		count int
+		err   error
+	)
+	if value := r.FormValue(idKey); value != "" {
+		if id, err = strconv.ParseUint(value, 10, 64); err != nil {
+			sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: fmt.Sprintf("invalid %v[%v]", idKey, value)})
+			return
+		}
+	}
+	if count, err = operate(id); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("%v %v dead letters of vol usage events successfully", action, count)))
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metacache
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// metaRequest holds the fields of the metadata requests which identify the cached responses changed by them.
+type metaRequest struct {
+	PartitionID uint64          `json:"pid"`
+	ParentID    uint64          `json:"pino"`
+	SrcParentID uint64          `json:"srcPid"`
+	DstParentID uint64          `json:"dstPid"`
+	Inode       json.RawMessage `json:"ino"` // a single inode, or the inodes of a batch
+	Inodes      []uint64        `json:"inos"`
+}
+
+// inodes returns the inodes and the directories read or changed by the request.
+func (req *metaRequest) inodes() (inodes []uint64) {
+	for _, ino := range []uint64{req.ParentID, req.SrcParentID, req.DstParentID} {
+		if ino != 0 {
+			inodes = append(inodes, ino)
+		}
+	}
+	if len(req.Inode) != 0 {
+		var (
+			ino  uint64
+			inos []uint64
+		)
+		if json.Unmarshal(req.Inode, &ino) == nil {
+			inodes = append(inodes, ino)
+		} else if json.Unmarshal(req.Inode, &inos) == nil {
+			inodes = append(inodes, inos...)
+		}
+	}
+	return append(inodes, req.Inodes...)
+}
+
+// The read-only requests which are not cached, and change nothing cached either.
+var uncachedReads = map[uint8]bool{
+	proto.OpMetaExtentsList:   true,
+	proto.OpMetaGetXAttr:      true,
+	proto.OpMetaListXAttr:     true,
+	proto.OpMetaBatchGetXAttr: true,
+	proto.OpMetaListTag:       true,
+	proto.OpMetaWatchDentry:   true,
+	proto.OpMetaFileChecksum:  true,
+	proto.OpGetMultipart:      true,
+	proto.OpListMultiparts:    true,
+}
+
+type cacheEntry struct {
+	resultCode uint8
+	data       []byte
+	inodes     []uint64
+	applied    uint64 // the index applied to the partition before the response is read
+	expire     time.Time
+}
+
+// partitionCache caches the responses of a meta partition. The generation is increased by each mutation, so that
+// the responses read before the mutation are not cached after it. The applied is the latest index applied to the
+// partition replied by the meta nodes, and the responses read before it are stale.
+type partitionCache struct {
+	generation uint64
+	applied    uint64
+	entries    map[string]*cacheEntry
+	inodes     map[uint64]map[string]bool // inode -> keys of the entries reading it
+}
+
+// Stat is the statistics of the cache.
+type Stat struct {
+	Entries       int
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+}
+
+// metaCache caches the responses to the cacheable requests by the meta partitions. A response is invalidated by
+// the mutation requests of the inodes and the directories it reads, or by any request of the partition replied with a
+// later applied index, which catches up the mutations not passing through this node. The TTL bounds the staleness
+// of the partitions no request of which is forwarded after such a mutation.
+type metaCache struct {
+	sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	partitions map[uint64]*partitionCache
+	stat       Stat
+}
+
+func newMetaCache(ttl time.Duration, maxEntries int) *metaCache {
+	return &metaCache{ttl: ttl, maxEntries: maxEntries, partitions: make(map[uint64]*partitionCache)}
+}
+
+func cacheKey(p *proto.Packet) string {
+	return string([]byte{p.Opcode}) + string(p.Data[:p.Size])
+}
+
+// get returns the cached response to the request, or the generation of the partition to cache the response with.
+func (c *metaCache) get(p *proto.Packet, pid uint64) (entry *cacheEntry, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	pc := c.partition(pid)
+	key := cacheKey(p)
+	if entry = pc.entries[key]; entry != nil && (entry.expire.Before(time.Now()) || entry.applied < pc.applied) {
+		c.removeEntry(pc, key)
+		entry = nil
+	}
+	if entry == nil {
+		c.stat.Misses++
+	} else {
+		c.stat.Hits++
+	}
+	return entry, pc.generation
+}
+
+// put caches the response unless the partition is changed since the request is forwarded, or the cache is full.
+func (c *metaCache) put(p *proto.Packet, req *metaRequest, generation uint64, resp *proto.Packet) {
+	if resp.ResultCode != proto.OpOk && resp.ResultCode != proto.OpNotExistErr {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	pc := c.partition(req.PartitionID)
+	if resp.KernelOffset < pc.applied {
+		return
+	}
+	pc.applied = resp.KernelOffset
+	if pc.generation != generation || c.stat.Entries >= c.maxEntries {
+		return
+	}
+	key := cacheKey(p)
+	if pc.entries[key] != nil {
+		c.removeEntry(pc, key)
+	}
+	entry := &cacheEntry{
+		resultCode: resp.ResultCode,
+		data:       resp.Data[:resp.Size],
+		inodes:     req.inodes(),
+		applied:    resp.KernelOffset,
+		expire:     time.Now().Add(c.ttl),
+	}
+	pc.entries[key] = entry
+	for _, ino := range entry.inodes {
+		keys := pc.inodes[ino]
+		if keys == nil {
+			keys = make(map[string]bool)
+			pc.inodes[ino] = keys
+		}
+		keys[key] = true
+	}
+	c.stat.Entries++
+}
+
+// invalidate removes the responses changed by the mutation request. All the responses of the partition are
+// removed if the changed inodes are unknown, and all the cached responses if even the partition is unknown.
+func (c *metaCache) invalidate(p *proto.Packet, req *metaRequest) {
+	if uncachedReads[p.Opcode] {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.stat.Invalidations++
+	if req == nil || req.PartitionID == 0 {
+		for _, pc := range c.partitions {
+			c.purgePartition(pc)
+		}
+		return
+	}
+	pc := c.partition(req.PartitionID)
+	pc.generation++
+	inodes := req.inodes()
+	if len(inodes) == 0 {
+		c.purgePartition(pc)
+		return
+	}
+	for _, ino := range inodes {
+		for key := range pc.inodes[ino] {
+			c.removeEntry(pc, key)
+		}
+	}
+}
+
+// advance records the applied index of the partition replied by the meta node, which makes the responses read
+// before it stale.
+func (c *metaCache) advance(pid uint64, resp *proto.Packet) {
+	c.Lock()
+	defer c.Unlock()
+	if pc := c.partition(pid); resp.KernelOffset > pc.applied {
+		pc.applied = resp.KernelOffset
+	}
+}
+
+// expire removes the expired and the stale responses.
+func (c *metaCache) expire() {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	for _, pc := range c.partitions {
+		for key, entry := range pc.entries {
+			if entry.expire.Before(now) || entry.applied < pc.applied {
+				c.removeEntry(pc, key)
+			}
+		}
+	}
+}
+
+// partition returns the cache of the partition, which is kept once created to track the generation.
+func (c *metaCache) partition(pid uint64) *partitionCache {
+	pc := c.partitions[pid]
+	if pc == nil {
+		pc = &partitionCache{entries: make(map[string]*cacheEntry), inodes: make(map[uint64]map[string]bool)}
+		c.partitions[pid] = pc
+	}
+	return pc
+}
+
+func (c *metaCache) purgePartition(pc *partitionCache) {
+	pc.generation++
+	c.stat.Entries -= len(pc.entries)
+	pc.entries = make(map[string]*cacheEntry)
+	pc.inodes = make(map[uint64]map[string]bool)
+}
+
+func (c *metaCache) removeEntry(pc *partitionCache, key string) {
+	entry := pc.entries[key]
+	if entry == nil {
+		return
+	}
+	delete(pc.entries, key)
+	for _, ino := range entry.inodes {
+		if keys := pc.inodes[ino]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(pc.inodes, ino)
+			}
+		}
+	}
+	c.stat.Entries--
+}
+
+func (c *metaCache) getStat() Stat {
+	c.Lock()
+	defer c.Unlock()
+	return c.stat
+}
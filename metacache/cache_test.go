@@ -0,0 +1,173 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metacache
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func newRequest(t *testing.T, opcode uint8, data interface{}) (p *proto.Packet, req *metaRequest) {
+	p = proto.NewPacketReqID()
+	p.Opcode = opcode
+	if err := p.MarshalData(data); err != nil {
+		t.Fatal(err)
+	}
+	req = new(metaRequest)
+	if err := json.Unmarshal(p.Data, req); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func okResponse(data string) *proto.Packet {
+	resp := proto.NewPacket()
+	resp.PacketOkWithBody([]byte(data))
+	return resp
+}
+
+func TestInvalidate(t *testing.T) {
+	c := newMetaCache(time.Minute, 100)
+	lookup, lookupReq := newRequest(t, proto.OpMetaLookup, &proto.LookupRequest{PartitionID: 1, ParentID: 1, Name: "a"})
+	iget, igetReq := newRequest(t, proto.OpMetaInodeGet, &proto.InodeGetRequest{PartitionID: 1, Inode: 2})
+	for _, item := range []struct {
+		p   *proto.Packet
+		req *metaRequest
+	}{{lookup, lookupReq}, {iget, igetReq}} {
+		entry, generation := c.get(item.p, item.req.PartitionID)
+		if entry != nil {
+			t.Fatalf("unexpected cache hit")
+		}
+		c.put(item.p, item.req, generation, okResponse("resp"))
+	}
+	if entry, _ := c.get(lookup, lookupReq.PartitionID); entry == nil || string(entry.data) != "resp" {
+		t.Fatalf("expect cache hit, but got %v", entry)
+	}
+
+	// a dentry created in the directory invalidates the lookups in it only
+	create, createReq := newRequest(t, proto.OpMetaCreateDentry,
+		&proto.CreateDentryRequest{PartitionID: 1, ParentID: 1, Inode: 3, Name: "b"})
+	c.invalidate(create, createReq)
+	if entry, _ := c.get(lookup, lookupReq.PartitionID); entry != nil {
+		t.Fatalf("expect the lookup is invalidated")
+	}
+	if entry, _ := c.get(iget, igetReq.PartitionID); entry == nil {
+		t.Fatalf("expect the inode is still cached")
+	}
+
+	// a batch of inodes in the field ino
+	del, delReq := newRequest(t, proto.OpMetaBatchDeleteInode, &proto.DeleteInodeBatchRequest{PartitionId: 1,
+		Inodes: []uint64{2, 4}})
+	c.invalidate(del, delReq)
+	if entry, _ := c.get(iget, igetReq.PartitionID); entry != nil {
+		t.Fatalf("expect the inode is invalidated")
+	}
+	if stat := c.getStat(); stat.Entries != 0 || stat.Invalidations != 2 {
+		t.Fatalf("unexpected stat %v", stat)
+	}
+}
+
+func TestStaleResponse(t *testing.T) {
+	c := newMetaCache(time.Minute, 100)
+	iget, igetReq := newRequest(t, proto.OpMetaInodeGet, &proto.InodeGetRequest{PartitionID: 1, Inode: 2})
+	_, generation := c.get(iget, igetReq.PartitionID)
+
+	// the response read before the mutation of the partition is not cached
+	setattr, setattrReq := newRequest(t, proto.OpMetaSetattr, &proto.SetAttrRequest{PartitionID: 1, Inode: 2})
+	c.invalidate(setattr, setattrReq)
+	c.put(iget, igetReq, generation, okResponse("stale"))
+	if entry, _ := c.get(iget, igetReq.PartitionID); entry != nil {
+		t.Fatalf("expect the stale response is not cached")
+	}
+
+	// the failed responses are not cached
+	entry, generation := c.get(iget, igetReq.PartitionID)
+	resp := proto.NewPacket()
+	resp.PacketErrorWithBody(proto.OpAgain, nil)
+	c.put(iget, igetReq, generation, resp)
+	if entry, _ = c.get(iget, igetReq.PartitionID); entry != nil {
+		t.Fatalf("expect the failed response is not cached")
+	}
+
+	// the read-only requests do not invalidate the cache
+	_, generation = c.get(iget, igetReq.PartitionID)
+	c.put(iget, igetReq, generation, okResponse("resp"))
+	list, listReq := newRequest(t, proto.OpMetaExtentsList, &proto.GetExtentsRequest{PartitionID: 1, Inode: 2})
+	c.invalidate(list, listReq)
+	if entry, _ = c.get(iget, igetReq.PartitionID); entry == nil {
+		t.Fatalf("expect the inode is still cached")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := newMetaCache(time.Millisecond, 1)
+	iget, igetReq := newRequest(t, proto.OpMetaInodeGet, &proto.InodeGetRequest{PartitionID: 1, Inode: 2})
+	readdir, readdirReq := newRequest(t, proto.OpMetaReadDir, &proto.ReadDirRequest{PartitionID: 1, ParentID: 1})
+	_, generation := c.get(iget, igetReq.PartitionID)
+	c.put(iget, igetReq, generation, okResponse("resp"))
+	c.put(readdir, readdirReq, generation, okResponse("resp"))
+	if stat := c.getStat(); stat.Entries != 1 {
+		t.Fatalf("expect the cache is full with 1 entry, but got %v", stat.Entries)
+	}
+	time.Sleep(10 * time.Millisecond)
+	c.expire()
+	if stat := c.getStat(); stat.Entries != 0 {
+		t.Fatalf("expect the entries are expired, but got %v", stat.Entries)
+	}
+}
+
+func TestAppliedIndex(t *testing.T) {
+	c := newMetaCache(time.Minute, 100)
+	iget, igetReq := newRequest(t, proto.OpMetaInodeGet, &proto.InodeGetRequest{PartitionID: 1, Inode: 2})
+	applied := func(data string, index uint64) *proto.Packet {
+		resp := okResponse(data)
+		resp.KernelOffset = index
+		return resp
+	}
+	_, generation := c.get(iget, igetReq.PartitionID)
+	c.put(iget, igetReq, generation, applied("resp", 10))
+	if entry, _ := c.get(iget, igetReq.PartitionID); entry == nil {
+		t.Fatalf("expect cache hit")
+	}
+
+	// a response read before the latest applied index is not cached
+	c.advance(1, applied("", 12))
+	if entry, _ := c.get(iget, igetReq.PartitionID); entry != nil {
+		t.Fatalf("expect the response read before the mutation not passing through is stale")
+	}
+	_, generation = c.get(iget, igetReq.PartitionID)
+	c.put(iget, igetReq, generation, applied("stale", 11))
+	if entry, _ := c.get(iget, igetReq.PartitionID); entry != nil {
+		t.Fatalf("expect the stale response is not cached")
+	}
+
+	// the responses of the other partitions are not affected
+	other, otherReq := newRequest(t, proto.OpMetaInodeGet, &proto.InodeGetRequest{PartitionID: 2, Inode: 2})
+	_, generation = c.get(other, otherReq.PartitionID)
+	c.put(other, otherReq, generation, applied("resp", 5))
+	_, generation = c.get(iget, igetReq.PartitionID)
+	c.put(iget, igetReq, generation, applied("resp", 12))
+	c.advance(1, applied("", 13))
+	c.expire()
+	if stat := c.getStat(); stat.Entries != 1 {
+		t.Fatalf("expect the stale response is removed, but got %v entries", stat.Entries)
+	}
+	if entry, _ := c.get(other, otherReq.PartitionID); entry == nil {
+		t.Fatalf("expect the response of the other partition is still cached")
+	}
+}
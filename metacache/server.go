@@ -0,0 +1,327 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metacache implements the meta cache node, which proxies the metadata requests of the volumes with the
+// meta cache enabled, and caches the responses to the read-only ones for the massive client fleets.
+package metacache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/cmd/common"
+	"github.com/chubaofs/chubaofs/proto"
+	masterSDK "github.com/chubaofs/chubaofs/sdk/master"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// Configuration keys
+const (
+	cfgLocalIP    = "localIP"
+	cfgCacheTTL   = "cacheTTL"   // seconds
+	cfgMaxEntries = "maxEntries" // the maximum number of the cached responses
+)
+
+const (
+	defaultCacheTTL   = 10 * time.Second
+	defaultMaxEntries = 1 << 20
+)
+
+// MetaCache is the meta cache node.
+type MetaCache struct {
+	listen       string
+	localAddr    string
+	masterClient *masterSDK.MasterClient
+	cache        *metaCache
+	conns        *util.ConnectPool
+	stopC        chan struct{}
+
+	control common.Control
+}
+
+// NewServer creates a new meta cache node.
+func NewServer() *MetaCache {
+	return &MetaCache{}
+}
+
+// Start starts the meta cache node with the specified configuration.
+func (m *MetaCache) Start(cfg *config.Config) (err error) {
+	return m.control.Start(m, cfg, doStart)
+}
+
+// Shutdown stops the meta cache node.
+func (m *MetaCache) Shutdown() {
+	m.control.Shutdown(m, doShutdown)
+}
+
+// Sync blocks the invoker's goroutine until the meta cache node shuts down.
+func (m *MetaCache) Sync() {
+	m.control.Sync()
+}
+
+func doStart(s common.Server, cfg *config.Config) (err error) {
+	m, ok := s.(*MetaCache)
+	if !ok {
+		return errors.New("Invalid Node Type!")
+	}
+	if err = m.parseConfig(cfg); err != nil {
+		return
+	}
+	m.conns = util.NewConnectPool()
+	m.stopC = make(chan struct{})
+	if err = m.register(); err != nil {
+		return
+	}
+	if err = m.startServer(); err != nil {
+		return
+	}
+	http.HandleFunc("/stat", m.getStat)
+	go m.scheduleTask()
+	return
+}
+
+func doShutdown(s common.Server) {
+	m, ok := s.(*MetaCache)
+	if !ok {
+		return
+	}
+	close(m.stopC)
+}
+
+func (m *MetaCache) parseConfig(cfg *config.Config) (err error) {
+	m.localAddr = cfg.GetString(cfgLocalIP)
+	m.listen = cfg.GetString(proto.ListenPort)
+	if len(strings.TrimSpace(m.listen)) == 0 {
+		return errors.New("illegal listen")
+	}
+	ttl := defaultCacheTTL
+	if seconds := cfg.GetInt64(cfgCacheTTL); seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	maxEntries := defaultMaxEntries
+	if value := cfg.GetInt64(cfgMaxEntries); value > 0 {
+		maxEntries = int(value)
+	}
+	m.cache = newMetaCache(ttl, maxEntries)
+
+	masters := make([]string, 0)
+	for _, addr := range cfg.GetSlice(proto.MasterAddr) {
+		masters = append(masters, addr.(string))
+	}
+	if len(masters) == 0 {
+		return errors.New("master address list is empty")
+	}
+	m.masterClient = masterSDK.NewMasterClient(masters, false)
+	m.masterClient.SetNodeIdentity(proto.NodeRoleMetaCache, cfg.GetString(proto.NodeToken))
+	log.LogInfof("[parseConfig] load listen[%v] cacheTTL[%v] maxEntries[%v] masters[%v]", m.listen, ttl,
+		maxEntries, masters)
+	return
+}
+
+// register registers the meta cache node to the master, which is retried until it succeeds.
+func (m *MetaCache) register() (err error) {
+	for {
+		if m.localAddr == "" {
+			var ci *proto.ClusterInfo
+			if ci, err = m.masterClient.AdminAPI().GetClusterInfo(); err != nil {
+				log.LogErrorf("[register] get cluster info fail: err(%v)", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+			m.localAddr = ci.Ip
+		}
+		if err = m.masterClient.NodeAPI().AddMetaCacheNode(m.nodeAddr()); err != nil {
+			log.LogErrorf("[register] register to master fail: address(%v) err(%v)", m.nodeAddr(), err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		return
+	}
+}
+
+func (m *MetaCache) nodeAddr() string {
+	return m.localAddr + ":" + m.listen
+}
+
+// scheduleTask registers the meta cache node to the master at the heartbeat interval, and expires the cache.
+func (m *MetaCache) scheduleTask() {
+	heartbeat := time.NewTicker(proto.MetaCacheNodeHeartbeatInterval)
+	expire := time.NewTicker(m.cache.ttl)
+	defer func() {
+		heartbeat.Stop()
+		expire.Stop()
+	}()
+	for {
+		select {
+		case <-m.stopC:
+			return
+		case <-heartbeat.C:
+			if err := m.masterClient.NodeAPI().AddMetaCacheNode(m.nodeAddr()); err != nil {
+				log.LogWarnf("[scheduleTask] heartbeat to master fail: address(%v) err(%v)", m.nodeAddr(), err)
+			}
+		case <-expire.C:
+			m.cache.expire()
+		}
+	}
+}
+
+func (m *MetaCache) startServer() (err error) {
+	ln, err := net.Listen("tcp", ":"+m.listen)
+	if err != nil {
+		return
+	}
+	go func() {
+		<-m.stopC
+		ln.Close()
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			select {
+			case <-m.stopC:
+				return
+			default:
+			}
+			if err != nil {
+				continue
+			}
+			go m.serveConn(conn)
+		}
+	}()
+	log.LogInfof("start server over...")
+	return
+}
+
+// serveConn serves the requests from the connection until it is closed by the client, or a request is failed to
+// be forwarded, upon which the client retries it as if the meta node is unreachable.
+func (m *MetaCache) serveConn(conn net.Conn) {
+	defer conn.Close()
+	c := conn.(*net.TCPConn)
+	c.SetKeepAlive(true)
+	c.SetNoDelay(true)
+	for {
+		select {
+		case <-m.stopC:
+			return
+		default:
+		}
+		p := proto.NewPacket()
+		if err := p.ReadFromConn(conn, proto.NoReadDeadlineTime); err != nil {
+			if err != io.EOF {
+				log.LogErrorf("serveConn: read from %v err(%v)", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if err := m.handlePacket(conn, p); err != nil {
+			log.LogErrorf("serveConn: handle packet(%v) from %v err(%v)", p, conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handlePacket answers the cacheable request from the cache if possible, and forwards the other requests to the
+// meta node in the arg of the packet. The responses to the mutation requests invalidate the cache, and the applied
+// index in every response of the partition makes the responses read before it stale. The requests with a
+// delegated token bypass the cache and carry the token and the capabilities of the inodes on, since only the meta node
+// validates its scope and grants the capabilities.
+func (m *MetaCache) handlePacket(conn net.Conn, p *proto.Packet) (err error) {
+	arg, token := proto.DetachDelegatedToken(p.Arg[:p.ArgLen])
+	arg, caps := proto.DetachInodeCaps(arg)
+	target := string(arg)
+	if target == "" {
+		return fmt.Errorf("no meta node to forward to")
+	}
+	p.Arg = proto.AttachDelegatedToken(proto.AttachInodeCaps(nil, caps), token)
+	p.ArgLen = uint32(len(p.Arg))
+
+	var req *metaRequest
+	if r := new(metaRequest); json.Unmarshal(p.Data[:p.Size], r) == nil {
+		req = r
+	}
+	cacheable := req != nil && req.PartitionID != 0 && proto.IsMetaCacheable(p.Opcode)
+
+	if cacheable && token != "" {
+		var resp *proto.Packet
+		if resp, err = m.forward(target, p); err != nil {
+			return
+		}
+		m.cache.advance(req.PartitionID, resp)
+		return resp.WriteToConn(conn)
+	}
+
+	var generation uint64
+	if cacheable {
+		var entry *cacheEntry
+		if entry, generation = m.cache.get(p, req.PartitionID); entry != nil {
+			p.ResultCode = entry.resultCode
+			p.Data = entry.data
+			p.Size = uint32(len(entry.data))
+			return p.WriteToConn(conn)
+		}
+	}
+	resp, err := m.forward(target, p)
+	if !cacheable {
+		// the mutation might be done even if the response is lost
+		m.cache.invalidate(p, req)
+	}
+	if err != nil {
+		return
+	}
+	if cacheable {
+		m.cache.put(p, req, generation, resp)
+	} else if req != nil && req.PartitionID != 0 {
+		m.cache.advance(req.PartitionID, resp)
+	}
+	return resp.WriteToConn(conn)
+}
+
+func (m *MetaCache) forward(target string, p *proto.Packet) (resp *proto.Packet, err error) {
+	conn, err := m.conns.GetConnect(target)
+	if err != nil {
+		return
+	}
+	defer func() {
+		m.conns.PutConnect(conn, err != nil)
+	}()
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	resp = proto.NewPacket()
+	if err = resp.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if resp.ReqID != p.ReqID || resp.Opcode != p.Opcode {
+		err = fmt.Errorf("response mismatch with request: target(%v) resp(%v)", target, resp)
+	}
+	return
+}
+
+func (m *MetaCache) getStat(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(&proto.HTTPReply{Code: proto.ErrCodeSuccess, Msg: "success", Data: m.cache.getStat()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err = w.Write(data); err != nil {
+		log.LogErrorf("[getStat] response %s", err)
+	}
+}
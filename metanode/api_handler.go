@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"bytes"
 
@@ -52,6 +53,9 @@ func (m *MetaNode) registerAPIHandler() (err error) {
 	http.HandleFunc("/getPartitionById", m.getPartitionByIDHandler)
 	http.HandleFunc("/getInode", m.getInodeHandler)
 	http.HandleFunc("/getExtentsByInode", m.getExtentsByInodeHandler)
+	// dump the full state of an inode, and restore a corrected one under raft for the support cases
+	http.HandleFunc("/dumpInode", m.dumpInodeHandler)
+	http.HandleFunc("/restoreInode", m.restoreInodeHandler)
 	// get all inodes of the partitionID
 	http.HandleFunc("/getAllInodes", m.getAllInodesHandler)
 	// get dentry information
@@ -59,9 +63,126 @@ func (m *MetaNode) registerAPIHandler() (err error) {
 	http.HandleFunc("/getDirectory", m.getDirectoryHandler)
 	http.HandleFunc("/getAllDentry", m.getAllDentriesHandler)
 	http.HandleFunc("/getParams", m.getParamsHandler)
+	// list the expired partitions and whether they can be deleted
+	http.HandleFunc("/getExpiredPartitions", m.getExpiredPartitionsHandler)
+	// the usage of the memory and the file descriptors against their limits
+	http.HandleFunc("/getStats", m.getStatsHandler)
+	// move the leaderships of the partitions away from this node before a planned shutdown
+	http.HandleFunc("/prepareShutdown", m.prepareShutdownHandler)
+	// check a config against the environment of this node
+	http.HandleFunc("/validateConfig", m.validateConfigHandler)
+	// get and tune the raft timings of this node
+	http.HandleFunc("/getRaftTimings", m.getRaftTimingsHandler)
+	http.HandleFunc("/raftStatus", m.getRaftStatusHandler)
+	http.HandleFunc("/setRaftTimings", m.setRaftTimingsHandler)
 	return
 }
 
+func (m *MetaNode) getStatsHandler(w http.ResponseWriter,
+	r *http.Request) {
+	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
+	stats := make(map[string]interface{})
+	stats["Pressure"] = m.pressure.Stat()
+	stats["Interfaces"] = m.netMonitor.Stat()
+	stats["PriorityQueue"] = m.priorityQ.Stat()
+	resp.Data = stats
+	data, _ := resp.Marshal()
+	if _, err := w.Write(data); err != nil {
+		log.LogErrorf("[getStatsHandler] response %s", err)
+	}
+}
+
+func (m *MetaNode) prepareShutdownHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[prepareShutdownHandler] response %s", err)
+		}
+	}()
+	timeout := DefaultLeaderTransferTimeout
+	if value := r.FormValue("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			resp.Code = http.StatusBadRequest
+			resp.Msg = fmt.Sprintf("invalid timeout %v", value)
+			return
+		}
+	}
+	report := m.metadataManager.TransferLeaders(timeout)
+	if len(report.Remaining) > 0 {
+		resp.Msg = fmt.Sprintf("%v partitions still led by this node", len(report.Remaining))
+	}
+	resp.Data = report
+}
+
+func (m *MetaNode) getRaftTimingsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
+	resp.Data = m.raftStore.TimingsView()
+	data, _ := resp.Marshal()
+	if _, err := w.Write(data); err != nil {
+		log.LogErrorf("[getRaftTimingsHandler] response %s", err)
+	}
+}
+
+// getRaftStatusHandler returns the term, the commit and applied indices, the match index of each peer, the recent
+// leader changes and the pending member changes of the raft group of a partition.
+func (m *MetaNode) getRaftStatusHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	resp := NewAPIResponse(http.StatusBadRequest, "")
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[getRaftStatusHandler] response %s", err)
+		}
+	}()
+	pid, err := strconv.ParseUint(r.FormValue("pid"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	mp, err := m.metadataManager.GetPartition(pid)
+	if err != nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = err.Error()
+		return
+	}
+	view := mp.GetRaftView()
+	if view == nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = fmt.Sprintf("raft of partition %v is not started", pid)
+		return
+	}
+	resp.Code = http.StatusOK
+	resp.Msg = http.StatusText(http.StatusOK)
+	resp.Data = view
+}
+
+// setRaftTimingsHandler changes the raft timings given without restart, which is lost on restart unless the config is
+// updated as well.
+func (m *MetaNode) setRaftTimingsHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[setRaftTimingsHandler] response %s", err)
+		}
+	}()
+	timings, err := m.raftStore.Timings().Override(r.FormValue)
+	if err == nil {
+		err = m.raftStore.SetTimings(timings)
+	}
+	if err != nil {
+		resp.Code = http.StatusBadRequest
+		resp.Msg = err.Error()
+		return
+	}
+	log.LogWarnf("[setRaftTimingsHandler] raft timings changed to %+v", timings)
+	resp.Data = m.raftStore.TimingsView()
+}
+
 func (m *MetaNode) getParamsHandler(w http.ResponseWriter,
 	r *http.Request) {
 	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
@@ -84,6 +205,21 @@ func (m *MetaNode) getPartitionsHandler(w http.ResponseWriter,
 	}
 }
 
+func (m *MetaNode) getExpiredPartitionsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
+	partitions, err := m.metadataManager.GetExpiredPartitions()
+	if err != nil {
+		resp.Code = http.StatusInternalServerError
+		resp.Msg = err.Error()
+	} else {
+		resp.Data = partitions
+	}
+	data, _ := resp.Marshal()
+	if _, err = w.Write(data); err != nil {
+		log.LogErrorf("[getExpiredPartitionsHandler] response %s", err)
+	}
+}
+
 func (m *MetaNode) getPartitionByIDHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	resp := NewAPIResponse(http.StatusBadRequest, "")
@@ -111,6 +247,13 @@ func (m *MetaNode) getPartitionByIDHandler(w http.ResponseWriter, r *http.Reques
 	msg["peers"] = conf.Peers
 	msg["nodeId"] = conf.NodeId
 	msg["cursor"] = conf.Cursor
+	msg["multipartGC"] = mp.GetMultipartGCStat()
+	msg["extentDelJournal"] = mp.GetExtentDelJournalStat()
+	msg["deleteBacklog"] = mp.GetDeleteBacklog()
+	msg["dedup"] = mp.GetDedupStat()
+	msg["reserved"] = mp.GetReserved()
+	msg["apply"] = mp.GetApplyStat()
+	msg["snapshotHistory"] = mp.GetSnapshotHistory()
 	resp.Data = msg
 	resp.Code = http.StatusOK
 	resp.Msg = http.StatusText(http.StatusOK)
@@ -216,6 +359,86 @@ func (m *MetaNode) getInodeHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func (m *MetaNode) dumpInodeHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	resp := NewAPIResponse(http.StatusBadRequest, "")
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[dumpInodeHandler] response %s", err)
+		}
+	}()
+	pid, err := strconv.ParseUint(r.FormValue("pid"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("ino"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	mp, err := m.metadataManager.GetPartition(pid)
+	if err != nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = err.Error()
+		return
+	}
+	dump, err := mp.DumpInode(id)
+	if err != nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = err.Error()
+		return
+	}
+	resp.Code = http.StatusOK
+	resp.Msg = http.StatusText(http.StatusOK)
+	resp.Data = dump
+}
+
+// restoreInodeHandler restores the inode with the dump in the body, which is returned by /dumpInode and corrected.
+// It is only accepted by the leader of the partition with POST, and refused if the inode is changed after the dump.
+func (m *MetaNode) restoreInodeHandler(w http.ResponseWriter, r *http.Request) {
+	resp := NewAPIResponse(http.StatusBadRequest, "")
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[restoreInodeHandler] response %s", err)
+		}
+	}()
+	if r.Method != http.MethodPost {
+		resp.Code = http.StatusMethodNotAllowed
+		resp.Msg = "the dump of the inode is to be posted"
+		return
+	}
+	pid, err := strconv.ParseUint(r.FormValue("pid"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	dump := &InodeDump{}
+	if err = json.NewDecoder(r.Body).Decode(dump); err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	mp, err := m.metadataManager.GetPartition(pid)
+	if err != nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = err.Error()
+		return
+	}
+	if err = mp.RestoreInode(dump); err != nil {
+		if err == ErrNotALeader {
+			leader, _ := mp.IsLeader()
+			err = fmt.Errorf("%v, the leader is %v", err, leader)
+		}
+		resp.Code = http.StatusConflict
+		resp.Msg = err.Error()
+		return
+	}
+	resp.Code = http.StatusOK
+	resp.Msg = http.StatusText(http.StatusOK)
+}
+
 func (m *MetaNode) getExtentsByInodeHandler(w http.ResponseWriter,
 	r *http.Request) {
 	r.ParseForm()
@@ -117,6 +117,14 @@ const (
 	opFSMDeleteDentryBatch
 	opFSMUnlinkInodeBatch
 	opFSMEvictInodeBatch
+	opFSMInternalRotateExtentFile
+	opFSMDedupRegister
+	opFSMDedupReference
+	opFSMBatchRename
+	opFSMFallocate
+	opFSMRestoreInode
+	opFSMRetryJournal // only in the snapshots, carrying the retry journal
+	opFSMSwapExtents
 )
 
 var (
@@ -126,6 +134,7 @@ var (
 var (
 	ErrNoLeader   = errors.New("no leader")
 	ErrNotALeader = errors.New("not a leader")
+	ErrOpTimeout  = errors.New("the deadline of the request is exceeded")
 )
 
 // Default configuration
@@ -141,6 +150,7 @@ const (
 	cfgListen            = "listen"
 	cfgMetadataDir       = "metadataDir"
 	cfgRaftDir           = "raftDir"
+	cfgRaftDirs          = "raftDirs"    // extra dirs to spread the raft logs of meta partitions
 	cfgMasterAddrs       = "masterAddrs" // will be deprecated
 	cfgRaftHeartbeatPort = "raftHeartbeatPort"
 	cfgRaftReplicaPort   = "raftReplicaPort"
@@ -148,6 +158,25 @@ const (
 	cfgTotalMem          = "totalMem"
 	cfgZoneName          = "zoneName"
 
+	// retention of the expired partition dirs before being deleted, negative to disable deleting
+	cfgExpiredPartitionRetentionHours = "expiredPartitionRetentionHours"
+
+	// snapshots of each partition retained for the historical reads, 0 to disable retaining
+	cfgRetainSnapshots               = "retainSnapshots"
+	cfgRetainSnapshotIntervalMinutes = "retainSnapshotIntervalMinutes"
+
+	// the object store the namespace of the volumes is exported to for the targets like "s3://bucket/prefix"
+	cfgNamespaceExportS3Endpoint  = "nsExportS3Endpoint"
+	cfgNamespaceExportS3Region    = "nsExportS3Region"
+	cfgNamespaceExportS3AccessKey = "nsExportS3AccessKey"
+	cfgNamespaceExportS3SecretKey = "nsExportS3SecretKey"
+
+	// timeouts of the long reads by their opcodes, like "OpMetaReadDir:5s,OpMetaBatchInodeGet:2s"
+	cfgOpTimeouts = "opTimeouts"
+
+	// marshal the time extension of the inodes, which is enabled once all the meta nodes are upgraded to decode it
+	cfgEnableInodeTimeExt = "enableInodeTimeExt"
+
 	metaNodeDeleteBatchCountKey = "batchCount"
 )
 
@@ -155,6 +184,9 @@ const (
 	// interval of persisting in-memory data
 	intervalToPersistData = time.Minute * 5
 	intervalToSyncCursor  = time.Minute * 1
+
+	intervalToCleanExpiredPartition  = time.Hour
+	defaultExpiredPartitionRetention = time.Hour * 24 * 7
 )
 
 const (
@@ -0,0 +1,136 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// ExpiredPartition is a partition dir renamed with ExpiredPartitionPrefix, since the partition
+// does not exist in master when the meta node starts.
+type ExpiredPartition struct {
+	Name        string `json:"name"`
+	PartitionID uint64 `json:"partitionId"`
+	ExpiredTime int64  `json:"expiredTime"`
+	Deletable   bool   `json:"deletable"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// scanExpiredPartitions lists the expired partition dirs, and checks whether they can be deleted.
+// An expired partition dir can be deleted only if it is older than the retention and the partition
+// is still absent from master.
+func (m *metadataManager) scanExpiredPartitions() (partitions []*ExpiredPartition, err error) {
+	metaNodeInfo, err := masterClient.NodeAPI().GetMetaNode(fmt.Sprintf("%s:%s", m.metaNode.localAddr, m.metaNode.listen))
+	if err != nil {
+		return
+	}
+	return m.listExpiredPartitions(metaNodeInfo.PersistenceMetaPartitions, time.Now())
+}
+
+// listExpiredPartitions lists the expired partition dirs, and checks them against the partitions of this node
+// persisted in master.
+func (m *metadataManager) listExpiredPartitions(persistedIDs []uint64, now time.Time) (partitions []*ExpiredPartition, err error) {
+	fileInfoList, err := ioutil.ReadDir(m.rootDir)
+	if err != nil {
+		return
+	}
+	persisted := make(map[uint64]struct{}, len(persistedIDs))
+	for _, id := range persistedIDs {
+		persisted[id] = struct{}{}
+	}
+
+	partitions = make([]*ExpiredPartition, 0)
+	for _, fileInfo := range fileInfoList {
+		if !fileInfo.IsDir() || !strings.HasPrefix(fileInfo.Name(), ExpiredPartitionPrefix+partitionPrefix) {
+			continue
+		}
+		id, e := strconv.ParseUint(fileInfo.Name()[len(ExpiredPartitionPrefix+partitionPrefix):], 10, 64)
+		if e != nil {
+			continue
+		}
+		partition := &ExpiredPartition{
+			Name:        fileInfo.Name(),
+			PartitionID: id,
+			ExpiredTime: fileInfo.ModTime().Unix(),
+		}
+		if _, exist := persisted[id]; exist {
+			partition.Reason = "partition exists in master"
+		} else if len(persisted) == 0 {
+			partition.Reason = "no partition of this node in master"
+		} else if m.expiredRetention < 0 {
+			partition.Reason = "deleting expired partition is disabled"
+		} else if now.Sub(fileInfo.ModTime()) < m.expiredRetention {
+			partition.Reason = fmt.Sprintf("retained until %v", fileInfo.ModTime().Add(m.expiredRetention).Format(time.RFC3339))
+		} else {
+			partition.Deletable = true
+		}
+		partitions = append(partitions, partition)
+	}
+	return
+}
+
+// GetExpiredPartitions returns the expired partitions without deleting them.
+func (m *metadataManager) GetExpiredPartitions() ([]*ExpiredPartition, error) {
+	return m.scanExpiredPartitions()
+}
+
+func (m *metadataManager) cleanExpiredPartitions() {
+	partitions, err := m.scanExpiredPartitions()
+	if err != nil {
+		log.LogErrorf("[cleanExpiredPartitions] scan expired partitions: %v", err)
+		return
+	}
+	m.removeExpiredPartitions(partitions)
+}
+
+// removeExpiredPartitions removes the expired partition dirs which can be deleted, along with their raft WaL. The
+// WaL is removed first, so that it is retried with the dir by the next clean if it fails.
+func (m *metadataManager) removeExpiredPartitions(partitions []*ExpiredPartition) {
+	for _, partition := range partitions {
+		if !partition.Deletable {
+			continue
+		}
+		if err := m.raftDisks.removePartitionWal(partition.PartitionID); err != nil {
+			log.LogErrorf("[cleanExpiredPartitions] remove raft wal of expired partition(%v): %v", partition.Name, err)
+			continue
+		}
+		if err := os.RemoveAll(path.Join(m.rootDir, partition.Name)); err != nil {
+			log.LogErrorf("[cleanExpiredPartitions] remove expired partition(%v): %v", partition.Name, err)
+			continue
+		}
+		log.LogWarnf("[cleanExpiredPartitions] expired partition(%v) is removed", partition.Name)
+	}
+}
+
+func (m *metadataManager) startExpiredPartitionJanitor() {
+	ticker := time.NewTicker(intervalToCleanExpiredPartition)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopC:
+			return
+		case <-ticker.C:
+			m.cleanExpiredPartitions()
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiredPartitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expired_partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	dirs := map[string]time.Time{
+		ExpiredPartitionPrefix + partitionPrefix + "1": now.Add(-10 * 24 * time.Hour),
+		ExpiredPartitionPrefix + partitionPrefix + "2": now.Add(-time.Hour),
+		ExpiredPartitionPrefix + partitionPrefix + "3": now.Add(-10 * 24 * time.Hour),
+		// neither expired nor a partition, which are left alone
+		partitionPrefix + "4":                          now.Add(-10 * 24 * time.Hour),
+		ExpiredPartitionPrefix + partitionPrefix + "x": now.Add(-10 * 24 * time.Hour),
+	}
+	for name, modTime := range dirs {
+		if err = os.Mkdir(path.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(path.Join(dir, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the raft wal of partition 1 in the legacy layout and in an extra raft dir, and the one of partition 2
+	raftDir, extraRaftDir := path.Join(dir, "raft0"), path.Join(dir, "raft1")
+	raftDisks, err := newRaftDiskManager(raftDir, []string{extraRaftDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wals := map[string]bool{
+		path.Join(raftDir, "1"):            true,
+		path.Join(extraRaftDir, "wal_1"):   true,
+		path.Join(extraRaftDir, "wal_2"):   false,
+		path.Join(extraRaftDir, "wal_100"): false,
+	}
+	for wal := range wals {
+		if err = os.Mkdir(wal, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &metadataManager{rootDir: dir, expiredRetention: defaultExpiredPartitionRetention, raftDisks: raftDisks}
+	check := func(persisted []uint64, expected map[uint64]string) []*ExpiredPartition {
+		partitions, err := m.listExpiredPartitions(persisted, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(partitions) != len(expected) {
+			t.Fatalf("expect the expired partitions %v, but are %v", expected, len(partitions))
+		}
+		for _, partition := range partitions {
+			reason, ok := expected[partition.PartitionID]
+			if !ok || partition.Deletable != (reason == "") || !strings.Contains(partition.Reason, reason) {
+				t.Fatalf("persisted %v retention %v: unexpected expired partition %+v", persisted, m.expiredRetention, partition)
+			}
+		}
+		return partitions
+	}
+
+	// the partitions still in master, and the ones not older than the retention are kept
+	partitions := check([]uint64{3, 9}, map[uint64]string{1: "", 2: "retained until", 3: "exists in master"})
+	// nothing is deleted if master knows no partition of this node, which may have lost its metadata
+	check(nil, map[uint64]string{1: "no partition", 2: "no partition", 3: "no partition"})
+	m.expiredRetention = -1
+	check([]uint64{3, 9}, map[uint64]string{1: "disabled", 2: "disabled", 3: "exists in master"})
+
+	m.removeExpiredPartitions(partitions)
+	for name := range dirs {
+		_, err = os.Stat(path.Join(dir, name))
+		if removed := os.IsNotExist(err); removed != (name == ExpiredPartitionPrefix+partitionPrefix+"1") {
+			t.Fatalf("dir %v removed %v, err %v", name, removed, err)
+		}
+	}
+	for wal, expired := range wals {
+		_, err = os.Stat(wal)
+		if removed := os.IsNotExist(err); removed != expired {
+			t.Fatalf("raft wal %v removed %v, err %v", wal, removed, err)
+		}
+	}
+
+	// the wal of a partition served by this node is never removed
+	if _, err = raftDisks.attachPartition(extraRaftDir, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err = raftDisks.removePartitionWal(100); err == nil {
+		t.Fatalf("the raft wal of an attached partition should not be removed")
+	}
+}
@@ -17,6 +17,7 @@ package metanode
 import (
 	"container/list"
 	"sync"
+	"time"
 )
 
 type freeList struct {
@@ -25,6 +26,12 @@ type freeList struct {
 	index map[uint64]*list.Element
 }
 
+// freeItem is an inode on the free list, with the unix time it has been pending to be freed since.
+type freeItem struct {
+	ino   uint64
+	since int64
+}
+
 func newFreeList() *freeList {
 	return &freeList{
 		list:  list.New(),
@@ -32,26 +39,34 @@ func newFreeList() *freeList {
 	}
 }
 
-// Pop removes the first item on the list and returns it.
-func (fl *freeList) Pop() (ino uint64) {
+// Pop removes the first item on the list and returns it, along with the time it has been pending since.
+func (fl *freeList) Pop() (ino uint64, since int64) {
 	fl.Lock()
 	defer fl.Unlock()
 	item := fl.list.Front()
 	if item == nil {
 		return
 	}
-	val := fl.list.Remove(item)
-	ino = val.(uint64)
-	delete(fl.index, ino)
-	return
+	fi := fl.list.Remove(item).(*freeItem)
+	delete(fl.index, fi.ino)
+	return fi.ino, fi.since
 }
 
 // Push inserts a new item at the back of the list.
 func (fl *freeList) Push(ino uint64) {
+	fl.PushSince(ino, 0)
+}
+
+// PushSince inserts the item at the back of the list, keeping the time it has been pending since, so that an inode
+// failed to be freed and pushed again is still counted as old. Zero since means now.
+func (fl *freeList) PushSince(ino uint64, since int64) {
+	if since == 0 {
+		since = time.Now().Unix()
+	}
 	fl.Lock()
 	defer fl.Unlock()
 	if _, ok := fl.index[ino]; !ok {
-		item := fl.list.PushBack(ino)
+		item := fl.list.PushBack(&freeItem{ino: ino, since: since})
 		fl.index[ino] = item
 	}
 }
@@ -70,3 +85,14 @@ func (fl *freeList) Len() int {
 	defer fl.Unlock()
 	return len(fl.index)
 }
+
+// Oldest returns the time the first item has been pending since, 0 if the list is empty. The items pushed again
+// keep their time at the back of the list, so it is the oldest once they come round to the front again.
+func (fl *freeList) Oldest() (since int64) {
+	fl.Lock()
+	defer fl.Unlock()
+	if item := fl.list.Front(); item != nil {
+		since = item.Value.(*freeItem).since
+	}
+	return
+}
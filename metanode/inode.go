@@ -28,6 +28,10 @@ import (
 
 const (
 	DeleteMarkFlag = 1 << 0
+	// TimeExtFlag is only set in the marshaled value, which is followed by the birth time and the nanoseconds of the
+	// timestamps after Reserved. It is absent from the values marshaled by the older versions, and from the ones
+	// marshaled with inodeTimeExtEnabled off, which the older versions still decode during a rolling upgrade.
+	TimeExtFlag = 1 << 1
 )
 
 // Inode wraps necessary properties of `Inode` information in the file system.
@@ -43,6 +47,12 @@ const (
 //  +-------+------+------+-----+----+----+----+--------+------------------+
 //  | bytes |  4   |  8   |  8  | 8  | 8  | 8  |   4    |      ExtLen      |
 //  +-------+------+------+-----+----+----+----+--------+------------------+
+// The time extension between Reserved and the extents if TimeExtFlag is set:
+//  +-------+----+--------+--------+--------+--------+
+//  | item  | BT | CTNsec | ATNsec | MTNsec | BTNsec |
+//  +-------+----+--------+--------+--------+--------+
+//  | bytes | 8  |   4    |   4    |   4    |   4    |
+//  +-------+----+--------+--------+--------+--------+
 // Marshal entity:
 //  +-------+-----------+--------------+-----------+--------------+
 //  | item  | KeyLength | MarshaledKey | ValLength | MarshaledVal |
@@ -60,10 +70,16 @@ type Inode struct {
 	CreateTime int64
 	AccessTime int64
 	ModifyTime int64
-	LinkTarget []byte // SymLink target name
-	NLink      uint32 // NodeLink counts
-	Flag       int32
-	Reserved   uint64 // reserved space
+	BirthTime  int64 // the time the inode is created, which is never changed
+	// the nanoseconds of the timestamps above
+	CreateTimeNsec uint32
+	AccessTimeNsec uint32
+	ModifyTimeNsec uint32
+	BirthTimeNsec  uint32
+	LinkTarget     []byte // SymLink target name
+	NLink          uint32 // NodeLink counts
+	Flag           int32
+	Reserved       uint64 // reserved space
 	//Extents    *ExtentsTree
 	Extents *SortedExtents
 }
@@ -83,9 +99,10 @@ func (i *Inode) String() string {
 	buff.WriteString(fmt.Sprintf("Gid[%d]", i.Gid))
 	buff.WriteString(fmt.Sprintf("Size[%d]", i.Size))
 	buff.WriteString(fmt.Sprintf("Gen[%d]", i.Generation))
-	buff.WriteString(fmt.Sprintf("CT[%d]", i.CreateTime))
-	buff.WriteString(fmt.Sprintf("AT[%d]", i.AccessTime))
-	buff.WriteString(fmt.Sprintf("MT[%d]", i.ModifyTime))
+	buff.WriteString(fmt.Sprintf("CT[%d.%09d]", i.CreateTime, i.CreateTimeNsec))
+	buff.WriteString(fmt.Sprintf("AT[%d.%09d]", i.AccessTime, i.AccessTimeNsec))
+	buff.WriteString(fmt.Sprintf("MT[%d.%09d]", i.ModifyTime, i.ModifyTimeNsec))
+	buff.WriteString(fmt.Sprintf("BT[%d.%09d]", i.BirthTime, i.BirthTimeNsec))
 	buff.WriteString(fmt.Sprintf("LinkT[%s]", i.LinkTarget))
 	buff.WriteString(fmt.Sprintf("NLink[%d]", i.NLink))
 	buff.WriteString(fmt.Sprintf("Flag[%d]", i.Flag))
@@ -96,18 +113,23 @@ func (i *Inode) String() string {
 }
 
 // NewInode returns a new Inode instance with specified Inode ID, name and type.
-// The AccessTime and ModifyTime will be set to the current time.
+// The timestamps will be set to the current time.
 func NewInode(ino uint64, t uint32) *Inode {
-	ts := Now.GetCurrentTime().Unix()
+	ts, nsec := splitTime(time.Now())
 	i := &Inode{
-		Inode:      ino,
-		Type:       t,
-		Generation: 1,
-		CreateTime: ts,
-		AccessTime: ts,
-		ModifyTime: ts,
-		NLink:      1,
-		Extents:    NewSortedExtents(),
+		Inode:          ino,
+		Type:           t,
+		Generation:     1,
+		CreateTime:     ts,
+		AccessTime:     ts,
+		ModifyTime:     ts,
+		BirthTime:      ts,
+		CreateTimeNsec: nsec,
+		AccessTimeNsec: nsec,
+		ModifyTimeNsec: nsec,
+		BirthTimeNsec:  nsec,
+		NLink:          1,
+		Extents:        NewSortedExtents(),
 	}
 	if proto.IsDir(t) {
 		i.NLink = 2
@@ -133,6 +155,11 @@ func (i *Inode) Copy() BtreeItem {
 	newIno.CreateTime = i.CreateTime
 	newIno.ModifyTime = i.ModifyTime
 	newIno.AccessTime = i.AccessTime
+	newIno.BirthTime = i.BirthTime
+	newIno.CreateTimeNsec = i.CreateTimeNsec
+	newIno.AccessTimeNsec = i.AccessTimeNsec
+	newIno.ModifyTimeNsec = i.ModifyTimeNsec
+	newIno.BirthTimeNsec = i.BirthTimeNsec
 	if size := len(i.LinkTarget); size > 0 {
 		newIno.LinkTarget = make([]byte, size)
 		copy(newIno.LinkTarget, i.LinkTarget)
@@ -308,12 +335,23 @@ func (i *Inode) MarshalValue() (val []byte) {
 	if err = binary.Write(buff, binary.BigEndian, &i.NLink); err != nil {
 		panic(err)
 	}
-	if err = binary.Write(buff, binary.BigEndian, &i.Flag); err != nil {
+	flag := i.Flag &^ TimeExtFlag
+	if inodeTimeExtEnabled {
+		flag |= TimeExtFlag
+	}
+	if err = binary.Write(buff, binary.BigEndian, &flag); err != nil {
 		panic(err)
 	}
 	if err = binary.Write(buff, binary.BigEndian, &i.Reserved); err != nil {
 		panic(err)
 	}
+	if flag&TimeExtFlag != 0 {
+		for _, v := range []interface{}{&i.BirthTime, &i.CreateTimeNsec, &i.AccessTimeNsec, &i.ModifyTimeNsec, &i.BirthTimeNsec} {
+			if err = binary.Write(buff, binary.BigEndian, v); err != nil {
+				panic(err)
+			}
+		}
+	}
 	// marshal ExtentsKey
 	extData, err := i.Extents.MarshalBinary()
 	if err != nil {
@@ -376,6 +414,18 @@ func (i *Inode) UnmarshalValue(val []byte) (err error) {
 	if err = binary.Read(buff, binary.BigEndian, &i.Reserved); err != nil {
 		return
 	}
+	if i.Flag&TimeExtFlag != 0 {
+		i.Flag &^= TimeExtFlag
+		for _, v := range []interface{}{&i.BirthTime, &i.CreateTimeNsec, &i.AccessTimeNsec, &i.ModifyTimeNsec, &i.BirthTimeNsec} {
+			if err = binary.Read(buff, binary.BigEndian, v); err != nil {
+				return
+			}
+		}
+	} else {
+		// the create time is never changed, so it is the birth time of the inodes marshaled by the older versions
+		i.BirthTime = i.CreateTime
+		i.CreateTimeNsec, i.AccessTimeNsec, i.ModifyTimeNsec, i.BirthTimeNsec = 0, 0, 0, 0
+	}
 	if buff.Len() == 0 {
 		return
 	}
@@ -390,7 +440,7 @@ func (i *Inode) UnmarshalValue(val []byte) (err error) {
 }
 
 // AppendExtents append the extent to the btree.
-func (i *Inode) AppendExtents(eks []proto.ExtentKey, ct int64) (delExtents []proto.ExtentKey) {
+func (i *Inode) AppendExtents(eks []proto.ExtentKey, ct int64, ctNsec uint32) (delExtents []proto.ExtentKey) {
 	i.Lock()
 	for _, ek := range eks {
 		delItems := i.Extents.Append(ek)
@@ -401,21 +451,46 @@ func (i *Inode) AppendExtents(eks []proto.ExtentKey, ct int64) (delExtents []pro
 		delExtents = append(delExtents, delItems...)
 	}
 	i.Generation++
-	i.ModifyTime = ct
+	i.ModifyTime, i.ModifyTimeNsec = ct, ctNsec
 	i.Unlock()
 	return
 }
 
-func (i *Inode) ExtentsTruncate(length uint64, ct int64) (delExtents []proto.ExtentKey) {
+// SwapExtents replaces the extent keys with the new ones if they are exactly the old ones. The modify time is kept,
+// since the data of the file are not changed.
+func (i *Inode) SwapExtents(oldEks, newEks []proto.ExtentKey) (swapped bool) {
+	i.Lock()
+	defer i.Unlock()
+	if swapped = i.Extents.Swap(oldEks, newEks); swapped {
+		i.Generation++
+	}
+	return
+}
+
+func (i *Inode) ExtentsTruncate(length uint64, ct int64, ctNsec uint32) (delExtents []proto.ExtentKey) {
 	i.Lock()
 	delExtents = i.Extents.Truncate(length)
+	// the space preallocated beyond the new size is released unless the file is extended
+	if length <= i.Size && i.Reserved > length {
+		i.Reserved = length
+	}
 	i.Size = length
-	i.ModifyTime = ct
+	i.ModifyTime, i.ModifyTimeNsec = ct, ctNsec
 	i.Generation++
 	i.Unlock()
 	return
 }
 
+// UnwrittenReserved returns the space preallocated to the inode beyond its extents, which is not written yet.
+func (i *Inode) UnwrittenReserved() uint64 {
+	i.RLock()
+	defer i.RUnlock()
+	if size := i.Extents.Size(); i.Reserved > size {
+		return i.Reserved - size
+	}
+	return 0
+}
+
 // IncNLink increases the nLink value by one.
 func (i *Inode) IncNLink() {
 	i.Lock()
@@ -497,10 +572,10 @@ func (i *Inode) SetAttr(req *SetattrRequest) {
 		i.Gid = req.Gid
 	}
 	if req.Valid&proto.AttrAccessTime != 0 {
-		i.AccessTime = req.AccessTime
+		i.AccessTime, i.AccessTimeNsec = req.AccessTime, req.AccessTimeNsec
 	}
 	if req.Valid&proto.AttrModifyTime != 0 {
-		i.ModifyTime = req.ModifyTime
+		i.ModifyTime, i.ModifyTimeNsec = req.ModifyTime, req.ModifyTimeNsec
 	}
 	i.Unlock()
 }
@@ -520,8 +595,13 @@ func (i *Inode) DoReadFunc(fn func()) {
 
 // SetMtime sets mtime to the current time.
 func (i *Inode) SetMtime() {
-	mtime := Now.GetCurrentTime().Unix()
+	mtime, nsec := splitTime(time.Now())
 	i.Lock()
-	i.ModifyTime = mtime
+	i.ModifyTime, i.ModifyTimeNsec = mtime, nsec
 	i.Unlock()
 }
+
+// splitTime returns the seconds and the nanoseconds of a timestamp.
+func splitTime(t time.Time) (sec int64, nsec uint32) {
+	return t.Unix(), uint32(t.Nanosecond())
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestInodeMarshalTimes(t *testing.T) {
+	inodeTimeExtEnabled = true
+	defer func() {
+		inodeTimeExtEnabled = false
+	}()
+	ino := NewInode(10, proto.Mode(0644))
+	ino.Flag = DeleteMarkFlag
+	ino.AccessTime, ino.AccessTimeNsec = 200, 2
+	ino.ModifyTime, ino.ModifyTimeNsec = 300, 3
+	ino.CreateTime, ino.CreateTimeNsec = 400, 4
+	ino.BirthTime, ino.BirthTimeNsec = 100, 1
+	ino.AppendExtents([]proto.ExtentKey{{FileOffset: 0, PartitionId: 1, ExtentId: 1, Size: 10}}, 300, 3)
+	val := ino.MarshalValue()
+
+	got := NewInode(10, 0)
+	if err := got.UnmarshalValue(val); err != nil {
+		t.Fatalf("unmarshal err %v", err)
+	}
+	if got.Flag != DeleteMarkFlag || got.BirthTime != 100 || got.BirthTimeNsec != 1 || got.AccessTimeNsec != 2 ||
+		got.ModifyTimeNsec != 3 || got.CreateTimeNsec != 4 || got.Extents.Size() != 10 {
+		t.Fatalf("unexpected inode %v", got)
+	}
+
+	// the value marshaled by the older versions has neither the flag nor the time extension
+	const flagOffset = 4 + 4 + 4 + 8 + 8 + 8*3 + 4 + 4
+	old := make([]byte, 0, len(val))
+	old = append(old, val[:flagOffset+4+8]...)
+	old = append(old, val[flagOffset+4+8+8+4*4:]...)
+	binary.BigEndian.PutUint32(old[flagOffset:], uint32(DeleteMarkFlag))
+	got = NewInode(10, 0)
+	if err := got.UnmarshalValue(old); err != nil {
+		t.Fatalf("unmarshal old value err %v", err)
+	}
+	if got.Flag != DeleteMarkFlag || got.BirthTime != 400 || got.CreateTime != 400 || got.ModifyTime != 300 ||
+		got.BirthTimeNsec != 0 || got.ModifyTimeNsec != 0 || got.Extents.Size() != 10 {
+		t.Fatalf("unexpected inode of the old value %v", got)
+	}
+}
+
+// unmarshalLegacyInode decodes the value as the meta nodes before the time extension do.
+func unmarshalLegacyInode(val []byte) (i *Inode, err error) {
+	i = NewInode(0, 0)
+	buff := bytes.NewBuffer(val)
+	for _, v := range []interface{}{&i.Type, &i.Uid, &i.Gid, &i.Size, &i.Generation, &i.CreateTime, &i.AccessTime,
+		&i.ModifyTime} {
+		if err = binary.Read(buff, binary.BigEndian, v); err != nil {
+			return
+		}
+	}
+	symSize := uint32(0)
+	if err = binary.Read(buff, binary.BigEndian, &symSize); err != nil {
+		return
+	}
+	if symSize > 0 {
+		i.LinkTarget = make([]byte, symSize)
+		if _, err = io.ReadFull(buff, i.LinkTarget); err != nil {
+			return
+		}
+	}
+	for _, v := range []interface{}{&i.NLink, &i.Flag, &i.Reserved} {
+		if err = binary.Read(buff, binary.BigEndian, v); err != nil {
+			return
+		}
+	}
+	if buff.Len() == 0 {
+		return
+	}
+	err = i.Extents.UnmarshalBinary(buff.Bytes())
+	return
+}
+
+func TestInodeMarshalTimesDisabled(t *testing.T) {
+	ino := NewInode(10, proto.Mode(0644))
+	ino.Flag = DeleteMarkFlag
+	ino.LinkTarget = []byte("target")
+	ino.CreateTime, ino.CreateTimeNsec = 400, 4
+	ino.ModifyTime, ino.ModifyTimeNsec = 300, 3
+	ino.BirthTime, ino.BirthTimeNsec = 100, 1
+	ino.AppendExtents([]proto.ExtentKey{{FileOffset: 0, PartitionId: 1, ExtentId: 1, Size: 10},
+		{FileOffset: 10, PartitionId: 1, ExtentId: 2, Size: 20}}, 300, 3)
+	val := ino.MarshalValue()
+
+	// the meta nodes not upgraded yet decode the value marshaled with the time extension disabled
+	old, err := unmarshalLegacyInode(val)
+	if err != nil {
+		t.Fatalf("legacy unmarshal err %v", err)
+	}
+	if old.Flag != DeleteMarkFlag || string(old.LinkTarget) != "target" || old.CreateTime != 400 ||
+		old.ModifyTime != 300 || old.NLink != ino.NLink || old.Extents.Size() != 30 || old.Extents.Len() != 2 {
+		t.Fatalf("unexpected inode %v decoded by the legacy format", old)
+	}
+
+	// the upgraded ones take the create time as the birth time
+	got := NewInode(10, 0)
+	if err = got.UnmarshalValue(val); err != nil {
+		t.Fatalf("unmarshal err %v", err)
+	}
+	if got.Flag != DeleteMarkFlag || got.BirthTime != 400 || got.BirthTimeNsec != 0 || got.ModifyTimeNsec != 0 ||
+		got.Extents.Size() != 30 {
+		t.Fatalf("unexpected inode %v", got)
+	}
+
+	// the flag only set in memory is not marshaled either
+	got.Flag |= TimeExtFlag
+	if old, err = unmarshalLegacyInode(got.MarshalValue()); err != nil || old.Flag != DeleteMarkFlag {
+		t.Fatalf("unexpected flag %v err %v", old.Flag, err)
+	}
+}
+
+func TestInodeReplyTimes(t *testing.T) {
+	ino := NewInode(10, proto.Mode(0644))
+	ino.SetAttr(&SetattrRequest{Valid: proto.AttrModifyTime, ModifyTime: 300, ModifyTimeNsec: 123456789})
+	info := &proto.InodeInfo{}
+	if !replyInfo(info, ino) {
+		t.Fatalf("reply info failed")
+	}
+	if !info.ModifyTime.Equal(time.Unix(300, 123456789)) {
+		t.Fatalf("unexpected mtime %v", info.ModifyTime)
+	}
+	if !info.BirthTime.Equal(time.Unix(ino.BirthTime, int64(ino.BirthTimeNsec))) || info.BirthTime.IsZero() {
+		t.Fatalf("unexpected btime %v", info.BirthTime)
+	}
+}
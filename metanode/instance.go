@@ -0,0 +1,64 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	InstanceIDFileName = ".instance_id"
+	instanceIDLen      = 16
+)
+
+// loadInstanceID loads the instance ID of the meta node from its metadata directory, which is generated at the first
+// start and registered on the master, so that the master can detect a meta node started with the metadata directory
+// cloned from another one.
+func (m *MetaNode) loadInstanceID() (err error) {
+	filename := path.Join(m.metadataDir, InstanceIDFileName)
+	data, err := ioutil.ReadFile(filename)
+	if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		m.instanceID = strings.TrimSpace(string(data))
+		return
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	buf := make([]byte, instanceIDLen)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+	instanceID := hex.EncodeToString(buf)
+	if err = os.MkdirAll(m.metadataDir, 0755); err != nil {
+		return
+	}
+	tmpFilename := filename + ".tmp"
+	if err = ioutil.WriteFile(tmpFilename, []byte(instanceID), 0644); err != nil {
+		return
+	}
+	if err = os.Rename(tmpFilename, filename); err != nil {
+		return
+	}
+	log.LogInfof("action[loadInstanceID] stamp metadataDir(%v) with instance(%v)", m.metadataDir, instanceID)
+	m.instanceID = instanceID
+	return
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultLeaderTransferTimeout = 30 * time.Second
+	// a peer lagging more than this many entries behind the commit is not healthy enough to be the leader
+	LeaderTransferMaxLag        = 1000
+	leaderTransferCheckInterval = 100 * time.Millisecond
+)
+
+// LeaderTransfer is the result of moving the leadership of a partition away from this node.
+type LeaderTransfer struct {
+	PartitionID uint64 `json:"partitionId"`
+	Target      string `json:"target,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// LeaderTransferReport is the result of moving the leaderships away from this node before it shuts down.
+type LeaderTransferReport struct {
+	Transferred []*LeaderTransfer `json:"transferred"`
+	Remaining   []*LeaderTransfer `json:"remaining"` // the partitions still led by this node
+	Elapsed     string            `json:"elapsed"`
+}
+
+// selectLeaderTransferTarget returns the active peer which is the most caught up with the commit of the leader.
+func selectLeaderTransferTarget(peers []proto.Peer, nodeID uint64, status *raftstore.PartitionStatus) (target proto.Peer, err error) {
+	var (
+		found bool
+		match uint64
+	)
+	for _, peer := range peers {
+		if peer.ID == nodeID {
+			continue
+		}
+		replica, ok := status.Replicas[peer.ID]
+		if !ok || !replica.Active || replica.Snapshoting || replica.Match+LeaderTransferMaxLag < status.Commit {
+			continue
+		}
+		if !found || replica.Match > match {
+			target, match, found = peer, replica.Match, true
+		}
+	}
+	if !found {
+		err = fmt.Errorf("no healthy peer to be the leader")
+	}
+	return
+}
+
+// LeaderTransferTarget returns the healthy peer to take over the leadership of the partition.
+func (mp *metaPartition) LeaderTransferTarget() (target proto.Peer, err error) {
+	conf := mp.GetBaseConfig()
+	return selectLeaderTransferTarget(conf.Peers, conf.NodeId, mp.raftPartition.Status())
+}
+
+func (m *metadataManager) tryToLeaderOnPeer(addr string, partitionID uint64) (err error) {
+	conn, err := m.connPool.GetConnect(addr)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			m.connPool.PutConnect(conn, ForceClosedConnect)
+		} else {
+			m.connPool.PutConnect(conn, NoClosedConnect)
+		}
+	}()
+	p := NewPacketToTryToLeader(partitionID)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = fmt.Errorf("%s response: %s", p.GetUniqueLogId(), p.GetResultMsg())
+	}
+	return
+}
+
+// TransferLeaders asks the healthy peers of the partitions led by this node to take over the leaderships, and waits
+// for them up to the timeout, so that the clients do not stall on the elections after this node shuts down.
+func (m *metadataManager) TransferLeaders(timeout time.Duration) *LeaderTransferReport {
+	start := time.Now()
+	m.mu.RLock()
+	partitions := make([]MetaPartition, 0, len(m.partitions))
+	for _, mp := range m.partitions {
+		partitions = append(partitions, mp)
+	}
+	m.mu.RUnlock()
+
+	report := &LeaderTransferReport{
+		Transferred: make([]*LeaderTransfer, 0),
+		Remaining:   make([]*LeaderTransfer, 0),
+	}
+	pending := make(map[uint64]*LeaderTransfer)
+	for _, mp := range partitions {
+		if _, isLeader := mp.IsLeader(); !isLeader {
+			continue
+		}
+		conf := mp.GetBaseConfig()
+		transfer := &LeaderTransfer{PartitionID: conf.PartitionId}
+		pending[conf.PartitionId] = transfer
+		target, err := mp.LeaderTransferTarget()
+		if err == nil {
+			transfer.Target = target.Addr
+			err = m.tryToLeaderOnPeer(target.Addr, conf.PartitionId)
+		}
+		if err != nil {
+			transfer.Reason = err.Error()
+			log.LogWarnf("[TransferLeaders] partition(%v) target(%v): %v", conf.PartitionId, transfer.Target, err)
+		}
+	}
+
+	deadline := start.Add(timeout)
+	for {
+		for _, mp := range partitions {
+			conf := mp.GetBaseConfig()
+			transfer, ok := pending[conf.PartitionId]
+			if !ok {
+				continue
+			}
+			if _, isLeader := mp.IsLeader(); !isLeader {
+				transfer.Reason = ""
+				report.Transferred = append(report.Transferred, transfer)
+				delete(pending, conf.PartitionId)
+			}
+		}
+		if len(pending) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(leaderTransferCheckInterval)
+	}
+	for _, transfer := range pending {
+		if transfer.Reason == "" {
+			transfer.Reason = "timeout"
+		}
+		report.Remaining = append(report.Remaining, transfer)
+	}
+	sort.Slice(report.Transferred, func(i, j int) bool {
+		return report.Transferred[i].PartitionID < report.Transferred[j].PartitionID
+	})
+	sort.Slice(report.Remaining, func(i, j int) bool {
+		return report.Remaining[i].PartitionID < report.Remaining[j].PartitionID
+	})
+	report.Elapsed = time.Since(start).String()
+	log.LogInfof("[TransferLeaders] transferred(%v) remaining(%v) elapsed(%v)",
+		len(report.Transferred), len(report.Remaining), report.Elapsed)
+	return report
+}
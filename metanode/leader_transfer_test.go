@@ -0,0 +1,45 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/tiglabs/raft"
+)
+
+func TestSelectLeaderTransferTarget(t *testing.T) {
+	peers := []proto.Peer{{ID: 1, Addr: "a:1"}, {ID: 2, Addr: "b:1"}, {ID: 3, Addr: "c:1"}, {ID: 4, Addr: "d:1"}}
+	status := &raftstore.PartitionStatus{
+		Commit: 5000,
+		Replicas: map[uint64]*raft.ReplicaStatus{
+			1: {Match: 5000, Active: true},
+			2: {Match: 4990, Active: true},
+			3: {Match: 5000, Active: false},
+			4: {Match: 3000, Active: true},
+		},
+	}
+	target, err := selectLeaderTransferTarget(peers, 1, status)
+	if err != nil || target.ID != 2 {
+		t.Fatalf("expect peer 2, but got %v err %v", target, err)
+	}
+
+	status.Replicas[2].Snapshoting = true
+	if target, err = selectLeaderTransferTarget(peers, 1, status); err == nil {
+		t.Fatalf("expect no target, but got %v", target)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/chubaofs/chubaofs/cmd/common"
 	"github.com/chubaofs/chubaofs/proto"
@@ -35,6 +36,7 @@ import (
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/priority"
 )
 
 const partitionPrefix = "partition_"
@@ -47,6 +49,8 @@ type MetadataManager interface {
 	//CreatePartition(id string, start, end uint64, peers []proto.Peer) error
 	HandleMetadataOperation(conn net.Conn, p *Packet, remoteAddr string) error
 	GetPartition(id uint64) (MetaPartition, error)
+	GetExpiredPartitions() ([]*ExpiredPartition, error)
+	TransferLeaders(timeout time.Duration) *LeaderTransferReport
 }
 
 // MetadataManagerConfig defines the configures in the metadata manager.
@@ -55,6 +59,21 @@ type MetadataManagerConfig struct {
 	RootDir   string
 	ZoneName  string
 	RaftStore raftstore.RaftStore
+	RaftDisks *raftDiskManager
+
+	ExpiredRetention time.Duration
+	TokenSigningKey  string
+
+	RetainSnapshots        int
+	RetainSnapshotInterval time.Duration
+
+	ReplicaIP string
+
+	OpTimeouts map[uint8]time.Duration
+
+	PriorityQueue *priority.Queue
+
+	NamespaceExportS3 NamespaceExportS3Config
 }
 
 type metadataManager struct {
@@ -62,12 +81,32 @@ type metadataManager struct {
 	zoneName           string
 	rootDir            string
 	raftStore          raftstore.RaftStore
+	raftDisks          *raftDiskManager
 	connPool           *util.ConnectPool
 	state              uint32
 	mu                 sync.RWMutex
 	partitions         map[uint64]MetaPartition // Key: metaRangeId, Val: metaPartition
 	metaNode           *MetaNode
 	flDeleteBatchCount atomic.Value
+	expiredRetention   time.Duration
+	tokenSigningKey    string
+	tokenRequiredVols  atomic.Value // map[string]bool, the vols refusing the clients without a delegated token
+	stopC              chan struct{}
+
+	// the snapshots retained for the historical reads of each partition, and the interval between them
+	retainSnapshots        int
+	retainSnapshotInterval time.Duration
+
+	replicaIP string // reported to the master for the peers to replicate to
+
+	opTimeouts map[uint8]time.Duration // the deadlines of the long reads by their opcodes
+	priorityQ  *priority.Queue         // queues the operations of the clients by their priority classes
+
+	shadowRoutes sync.Map // the cached meta partitions of the shadow volumes, keyed by the volume names
+	namePolicies sync.Map // the cached naming policies of the volumes, keyed by the volume names
+
+	nsExportS3 NamespaceExportS3Config
+	nsExportMu sync.Mutex // serializes the namespace exports, each of which loads a partition from its snapshot
 }
 
 // HandleMetadataOperation handles the metadata operations.
@@ -75,6 +114,11 @@ func (m *metadataManager) HandleMetadataOperation(conn net.Conn, p *Packet,
 	remoteAddr string) (err error) {
 	metric := exporter.NewTPCnt(p.GetOpMsg())
 	defer metric.Set(err)
+	cancel := m.withOpTimeout(p)
+	defer cancel()
+	if isPriorityQueued(p.Opcode) {
+		defer m.priorityQ.Acquire(p.Priority)()
+	}
 
 	switch p.Opcode {
 	case proto.OpMetaCreateInode:
@@ -133,6 +177,22 @@ func (m *metadataManager) HandleMetadataOperation(conn net.Conn, p *Packet,
 		err = m.opRemoveMetaPartitionRaftMember(conn, p, remoteAddr)
 	case proto.OpMetaPartitionTryToLeader:
 		err = m.opMetaPartitionTryToLeader(conn, p, remoteAddr)
+	case proto.OpCheckDataPartitionRef:
+		err = m.opCheckDataPartitionRef(conn, p, remoteAddr)
+	case proto.OpCheckExtentRefs:
+		err = m.opCheckExtentRefs(conn, p, remoteAddr)
+	case proto.OpFreezeMetaPartition:
+		err = m.opFreezeMetaPartition(conn, p, remoteAddr)
+	case proto.OpDegradeMetaPartition:
+		err = m.opDegradeMetaPartition(conn, p, remoteAddr)
+	case proto.OpMetaNamespaceExport:
+		err = m.opNamespaceExport(conn, p, remoteAddr)
+	case proto.OpMetaSnapshotDiff:
+		err = m.opMetaSnapshotDiff(conn, p, remoteAddr)
+	case proto.OpLifecycleScanDir, proto.OpLifecycleFilterExpired, proto.OpLifecycleDeleteDentries,
+		proto.OpLifecycleDeleteInodes, proto.OpLifecycleListMultiparts, proto.OpLifecycleRemoveMultiparts,
+		proto.OpLifecycleListExtents, proto.OpLifecycleSwapExtents:
+		err = m.opLifecycle(conn, p, remoteAddr)
 	case proto.OpMetaBatchInodeGet:
 		err = m.opMetaBatchInodeGet(conn, p, remoteAddr)
 	case proto.OpMetaDeleteInode:
@@ -152,6 +212,20 @@ func (m *metadataManager) HandleMetadataOperation(conn net.Conn, p *Packet,
 		err = m.opMetaRemoveXAttr(conn, p, remoteAddr)
 	case proto.OpMetaListXAttr:
 		err = m.opMetaListXAttr(conn, p, remoteAddr)
+	case proto.OpMetaListTag:
+		err = m.opMetaListTag(conn, p, remoteAddr)
+	case proto.OpMetaFileChecksum:
+		err = m.opMetaFileChecksum(conn, p, remoteAddr)
+	case proto.OpMetaDedupRegister:
+		err = m.opMetaDedupRegister(conn, p, remoteAddr)
+	case proto.OpMetaDedupReference:
+		err = m.opMetaDedupReference(conn, p, remoteAddr)
+	case proto.OpMetaBatchRename:
+		err = m.opMetaBatchRename(conn, p, remoteAddr)
+	case proto.OpMetaFallocate:
+		err = m.opMetaFallocate(conn, p, remoteAddr)
+	case proto.OpMetaWatchDentry:
+		err = m.opMetaWatchDentry(conn, p, remoteAddr)
 	// operations for multipart session
 	case proto.OpCreateMultipart:
 		err = m.opCreateMultipart(conn, p, remoteAddr)
@@ -174,6 +248,21 @@ func (m *metadataManager) HandleMetadataOperation(conn net.Conn, p *Packet,
 	return
 }
 
+// isPriorityQueued returns whether the operations of the opcode are from the clients, which are queued by their
+// priority classes. The tasks of the master, the operations between the replicas and the watches of the dentries,
+// which are held until the dentries change, are not queued.
+func isPriorityQueued(opcode uint8) bool {
+	switch {
+	case opcode == proto.OpMetaFreeInodesOnRaftFollower, opcode == proto.OpMetaWatchDentry:
+		return false
+	case opcode >= proto.OpMetaCreateInode && opcode <= proto.OpMetaBatchRename:
+		return true
+	case opcode >= proto.OpCreateMultipart && opcode <= proto.OpMetaFallocate:
+		return true
+	}
+	return false
+}
+
 // Start starts the metadata manager.
 func (m *metadataManager) Start() (err error) {
 	if atomic.CompareAndSwapUint32(&m.state, common.StateStandby, common.StateStart) {
@@ -202,12 +291,32 @@ func (m *metadataManager) Stop() {
 // onStart creates the connection pool and loads the partitions.
 func (m *metadataManager) onStart() (err error) {
 	m.connPool = util.NewConnectPool()
-	err = m.loadPartitions()
+	if err = m.loadPartitions(); err != nil {
+		return
+	}
+	m.raftDisks.onDiskError = m.onRaftDiskError
+	m.raftDisks.start()
+	go m.startExpiredPartitionJanitor()
+	go m.startApplyStallChecker()
 	return
 }
 
+// onRaftDiskError takes the meta partitions colocated on the broken raft disk out of the raft store,
+// while the other partitions on this meta node keep serving.
+func (m *metadataManager) onRaftDiskError(diskPath string, partitions []uint64) {
+	for _, id := range partitions {
+		mp, err := m.getPartition(id)
+		if err != nil {
+			continue
+		}
+		mp.ForceExitRaftStore()
+		log.LogErrorf("[onRaftDiskError] partition(%v) exit raft store due to broken raft disk(%v)", id, diskPath)
+	}
+}
+
 // onStop stops each meta partitions.
 func (m *metadataManager) onStop() {
+	close(m.stopC)
 	if m.partitions != nil {
 		for _, partition := range m.partitions {
 			partition.Stop()
@@ -268,7 +377,11 @@ func (m *metadataManager) loadPartitions() (err error) {
 					fileInfo.Name())
 				oldName := path.Join(m.rootDir, fileInfo.Name())
 				newName := path.Join(m.rootDir, ExpiredPartitionPrefix+fileInfo.Name())
-				os.Rename(oldName, newName)
+				if err := os.Rename(oldName, newName); err == nil {
+					// the modify time is used to decide when the expired partition can be deleted
+					now := time.Now()
+					os.Chtimes(newName, now, now)
+				}
 				continue
 			}
 
@@ -330,6 +443,11 @@ func (m *metadataManager) loadPartitions() (err error) {
 				if errload != nil {
 					log.LogErrorf("load partition id=%d failed: %s.",
 						id, errload.Error())
+					// a broken raft disk only affects the partitions colocated on it
+					if raftDir := partition.GetBaseConfig().RaftDir; m.raftDisks.isUnavailable(raftDir) {
+						log.LogErrorf("skip partition id=%d on unavailable raft disk(%v)", id, raftDir)
+						errload = nil
+					}
 				}
 			}(fileInfo.Name())
 		}
@@ -380,6 +498,9 @@ func (m *metadataManager) createPartition(request *proto.CreateMetaPartitionRequ
 		NodeId:      m.nodeId,
 		RootDir:     path.Join(m.rootDir, partitionPrefix+partitionId),
 		ConnPool:    m.connPool,
+
+		CaseInsensitive: request.CaseInsensitive,
+		ShadowVol:       request.ShadowVol,
 	}
 	mpc.AfterStop = func() {
 		m.detachPartition(request.PartitionID)
@@ -390,6 +511,11 @@ func (m *metadataManager) createPartition(request *proto.CreateMetaPartitionRequ
 		return
 	}
 
+	if mpc.RaftDir, err = m.raftDisks.selectDisk(); err != nil {
+		err = errors.NewErrorf("[createPartition]->%s", err.Error())
+		return
+	}
+
 	partition := NewMetaPartition(mpc, m)
 	if err = partition.PersistMetadata(); err != nil {
 		err = errors.NewErrorf("[createPartition]->%s", err.Error())
@@ -397,6 +523,7 @@ func (m *metadataManager) createPartition(request *proto.CreateMetaPartitionRequ
 	}
 
 	if err = partition.Start(); err != nil {
+		m.raftDisks.detachPartition(mpc.RaftDir, request.PartitionID)
 		os.RemoveAll(mpc.RootDir)
 		log.LogErrorf("load meta partition %v fail: %v", request.PartitionID, err)
 		err = errors.NewErrorf("[createPartition]->%s", err.Error())
@@ -417,6 +544,7 @@ func (m *metadataManager) deletePartition(id uint64) (err error) {
 		return
 	}
 	mp.Reset()
+	m.raftDisks.detachPartition(mp.GetBaseConfig().RaftDir, id)
 	delete(m.partitions, id)
 	return
 }
@@ -452,8 +580,23 @@ func NewMetadataManager(conf MetadataManagerConfig, metaNode *MetaNode) Metadata
 		zoneName:   conf.ZoneName,
 		rootDir:    conf.RootDir,
 		raftStore:  conf.RaftStore,
+		raftDisks:  conf.RaftDisks,
 		partitions: make(map[uint64]MetaPartition),
 		metaNode:   metaNode,
+
+		expiredRetention: conf.ExpiredRetention,
+		tokenSigningKey:  conf.TokenSigningKey,
+		stopC:            make(chan struct{}),
+
+		retainSnapshots:        conf.RetainSnapshots,
+		retainSnapshotInterval: conf.RetainSnapshotInterval,
+
+		replicaIP: conf.ReplicaIP,
+
+		opTimeouts: conf.OpTimeouts,
+		priorityQ:  conf.PriorityQueue,
+
+		nsExportS3: conf.NamespaceExportS3,
 	}
 }
 
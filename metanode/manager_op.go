@@ -51,6 +51,7 @@ func (m *metadataManager) opMasterHeartbeat(conn net.Conn, p *Packet,
 		resp.Result = err.Error()
 		goto end
 	}
+	m.setTokenRequiredVols(req.TokenRequiredVols)
 
 	// collect memory info
 	resp.Total = configTotalMem
@@ -61,6 +62,7 @@ func (m *metadataManager) opMasterHeartbeat(conn net.Conn, p *Packet,
 	}
 	m.Range(func(id uint64, partition MetaPartition) bool {
 		mConf := partition.GetBaseConfig()
+		apply := partition.GetApplyStat()
 		mpr := &proto.MetaPartitionReport{
 			PartitionID: mConf.PartitionId,
 			Start:       mConf.Start,
@@ -70,6 +72,15 @@ func (m *metadataManager) opMasterHeartbeat(conn net.Conn, p *Packet,
 			VolName:     mConf.VolName,
 			InodeCnt:    uint64(partition.GetInodeTree().Len()),
 			DentryCnt:   uint64(partition.GetDentryTree().Len()),
+			DedupStat:   *partition.GetDedupStat(),
+			IsFrozen:    partition.IsFrozen(),
+			IsDegraded:  partition.IsDegraded(),
+			Reserved:    partition.GetReserved(),
+			ApplyStall:  apply.Stalled,
+			ApplyQueue:  apply.Pending,
+
+			ShadowFailures: partition.GetShadowFailures(),
+			DeleteBacklog:  *partition.GetDeleteBacklog(),
 		}
 		addr, isLeader := partition.IsLeader()
 		if addr == "" {
@@ -86,6 +97,8 @@ func (m *metadataManager) opMasterHeartbeat(conn net.Conn, p *Packet,
 		return true
 	})
 	resp.ZoneName = m.zoneName
+	resp.ReplicaIP = m.replicaIP
+	resp.BuildInfo = proto.GetBuildInfo()
 	resp.Status = proto.TaskSucceeds
 end:
 	adminTask.Request = nil
@@ -533,6 +546,56 @@ func (m *metadataManager) opMetaLookup(conn net.Conn, p *Packet,
 	return
 }
 
+// opMetaSnapshotDiff lists the changes of the partition between two views for the snapshot diff of the master.
+func (m *metadataManager) opMetaSnapshotDiff(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &proto.SnapshotDiffRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	err = mp.SnapshotDiff(req, p)
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opMetaSnapshotDiff] partition[%v] from[%v] to[%v] marker[%v], response status[%s]",
+		remoteAddr, req.PartitionID, req.From, req.To, req.Marker, p.GetResultMsg())
+	return
+}
+
+func (m *metadataManager) opMetaWatchDentry(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &proto.WatchDentryRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.WatchDentry(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaWatchDentry] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
 func (m *metadataManager) opMetaExtentsAdd(conn net.Conn, p *Packet,
 	remoteAddr string) (err error) {
 	req := &proto.AppendExtentKeyRequest{}
@@ -621,6 +684,30 @@ func (m *metadataManager) opMetaExtentsTruncate(conn net.Conn, p *Packet,
 	return
 }
 
+func (m *metadataManager) opMetaFallocate(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.FallocateRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.Fallocate(req, p)
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaFallocate] req: %d - %v, resp: %v", remoteAddr, p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
 // Delete a meta partition.
 func (m *metadataManager) opDeleteMetaPartition(conn net.Conn,
 	p *Packet, remoteAddr string) (err error) {
@@ -957,6 +1044,142 @@ errDeal:
 	return
 }
 
+func (m *metadataManager) opCheckDataPartitionRef(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &proto.CheckDataPartitionRefRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	err = mp.CheckDataPartitionRef(req, p)
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opCheckDataPartitionRef] req[%v], response status[%s], "+
+		"response body[%s], error[%v]", remoteAddr, req, p.GetResultMsg(), p.Data, err)
+	return
+}
+
+func (m *metadataManager) opCheckExtentRefs(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &proto.CheckExtentRefsRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	err = mp.CheckExtentRefs(req, p)
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opCheckExtentRefs] partition[%v] extents[%v] byInode[%v], response status[%s], error[%v]",
+		remoteAddr, req.PartitionID, len(req.Extents), req.ByInode, p.GetResultMsg(), err)
+	return
+}
+
+func (m *metadataManager) opFreezeMetaPartition(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	var data []byte
+	req := &proto.FreezeMetaPartitionRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	resp := &proto.FreezeMetaPartitionResponse{
+		PartitionID: req.PartitionID,
+		IsFrozen:    req.IsFrozen,
+		Status:      proto.TaskSucceeds,
+	}
+	if resp.ApplyID, err = mp.SetFrozen(req.IsFrozen); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	_, resp.IsLeader = mp.IsLeader()
+	if data, err = json.Marshal(resp); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		return
+	}
+	p.PacketOkWithBody(data)
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opFreezeMetaPartition] req[%v], response status[%s], "+
+		"response body[%s], error[%v]", remoteAddr, req, p.GetResultMsg(), p.Data, err)
+	return
+}
+
+func (m *metadataManager) opDegradeMetaPartition(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &proto.DegradeMetaPartitionRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if err = mp.SetDegraded(req.IsDegraded); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	p.PacketOkReply()
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opDegradeMetaPartition] req[%v], response status[%s], error[%v]",
+		remoteAddr, req, p.GetResultMsg(), err)
+	return
+}
+
 func (m *metadataManager) opMetaDeleteInode(conn net.Conn, p *Packet,
 	remoteAddr string) (err error) {
 	req := &proto.DeleteInodeRequest{}
@@ -1137,6 +1360,131 @@ func (m *metadataManager) opMetaListXAttr(conn net.Conn, p *Packet, remoteAddr s
 	return
 }
 
+func (m *metadataManager) opMetaListTag(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.ListTagRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionId)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.ListTag(req, p)
+	_ = m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaListTag] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaFileChecksum(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.FileChecksumRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.FileChecksum(req, p)
+	_ = m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaFileChecksum] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaDedupRegister(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.DedupRegisterRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.DedupRegister(req, p)
+	_ = m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaDedupRegister] req: %d - ino(%v) blocks(%v), resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req.Inode, len(req.Blocks), p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaDedupReference(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.DedupReferenceRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.DedupReference(req, p)
+	_ = m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaDedupReference] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaBatchRename(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.BatchRenameRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.BatchRename(req, p)
+	_ = m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaBatchRename] req: %d - src(%v) dst(%v) items(%v), resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req.SrcParentID, req.DstParentID, len(req.Items), p.GetResultMsg(), p.Data)
+	return
+}
+
 func (m *metadataManager) opMetaBatchExtentsAdd(conn net.Conn, p *Packet, remoteAddr string) (err error) {
 	req := &proto.AppendExtentKeysRequest{}
 	if err = json.Unmarshal(p.Data, req); err != nil {
@@ -0,0 +1,112 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// opLifecycle decodes the lifecycle request sent by the master in an admin task, and executes it on the meta partition.
+func (m *metadataManager) opLifecycle(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	var (
+		partitionID uint64
+		req         interface{}
+	)
+	switch p.Opcode {
+	case proto.OpLifecycleScanDir:
+		req = &proto.LifecycleScanDirRequest{}
+	case proto.OpLifecycleFilterExpired:
+		req = &proto.LifecycleFilterExpiredRequest{}
+	case proto.OpLifecycleDeleteDentries:
+		req = &proto.LifecycleDeleteDentriesRequest{}
+	case proto.OpLifecycleDeleteInodes:
+		req = &proto.LifecycleDeleteInodesRequest{}
+	case proto.OpLifecycleListMultiparts:
+		req = &proto.LifecycleListMultipartsRequest{}
+	case proto.OpLifecycleRemoveMultiparts:
+		req = &proto.LifecycleRemoveMultipartsRequest{}
+	case proto.OpLifecycleListExtents:
+		req = &proto.LifecycleListExtentsRequest{}
+	case proto.OpLifecycleSwapExtents:
+		req = &proto.LifecycleSwapExtentsRequest{}
+	}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	switch r := req.(type) {
+	case *proto.LifecycleScanDirRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleFilterExpiredRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleDeleteDentriesRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleDeleteInodesRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleListMultipartsRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleRemoveMultipartsRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleListExtentsRequest:
+		partitionID = r.PartitionID
+	case *proto.LifecycleSwapExtentsRequest:
+		partitionID = r.PartitionID
+	}
+	mp, err := m.getPartition(partitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	switch r := req.(type) {
+	case *proto.LifecycleScanDirRequest:
+		err = mp.LifecycleScanDir(r, p)
+	case *proto.LifecycleFilterExpiredRequest:
+		err = mp.LifecycleFilterExpired(r, p)
+	case *proto.LifecycleDeleteDentriesRequest:
+		err = mp.LifecycleDeleteDentries(r, p)
+	case *proto.LifecycleDeleteInodesRequest:
+		err = mp.LifecycleDeleteInodes(r, p)
+	case *proto.LifecycleListMultipartsRequest:
+		err = mp.LifecycleListMultiparts(r, p)
+	case *proto.LifecycleRemoveMultipartsRequest:
+		err = mp.LifecycleRemoveMultiparts(r, p)
+	case *proto.LifecycleListExtentsRequest:
+		err = mp.LifecycleListExtents(r, p)
+	case *proto.LifecycleSwapExtentsRequest:
+		err = mp.LifecycleSwapExtents(r, p)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opLifecycle] op[%v] partition[%v], response status[%s], error[%v]",
+		remoteAddr, p.GetOpMsg(), partitionID, p.GetResultMsg(), err)
+	return
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const (
+	defaultOpTimeout = 10 * time.Second
+
+	// the items visited between two checks of the deadline in the loops of the long reads
+	opTimeoutCheckInterval = 256
+)
+
+// defaultOpTimeouts bounds the reads whose cost grows with the directory or the batch. The mutations are not bounded,
+// since they can not be canceled once proposed to raft.
+var defaultOpTimeouts = map[uint8]time.Duration{
+	proto.OpMetaReadDir:       defaultOpTimeout,
+	proto.OpMetaBatchInodeGet: defaultOpTimeout,
+	proto.OpMetaBatchGetXAttr: defaultOpTimeout,
+}
+
+// parseOpTimeouts parses the timeouts like "OpMetaReadDir:5s,OpMetaBatchInodeGet:2s" over the defaults, where a zero
+// timeout disables the deadline of the opcode. Only the opcodes with a default timeout can be configured.
+func parseOpTimeouts(value string) (timeouts map[uint8]time.Duration, err error) {
+	timeouts = make(map[uint8]time.Duration, len(defaultOpTimeouts))
+	names := make(map[string]uint8, len(defaultOpTimeouts))
+	for op, timeout := range defaultOpTimeouts {
+		timeouts[op] = timeout
+		names[(&proto.Packet{Opcode: op}).GetOpMsg()] = op
+	}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pair := strings.SplitN(item, ":", 2)
+		op, ok := names[strings.TrimSpace(pair[0])]
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("invalid op timeout[%v]", item)
+		}
+		var timeout time.Duration
+		if timeout, err = time.ParseDuration(strings.TrimSpace(pair[1])); err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid op timeout[%v]", item)
+		}
+		timeouts[op] = timeout
+	}
+	return
+}
+
+// withOpTimeout sets the deadline of the packet by the timeout of its opcode, and returns the func to release it.
+func (m *metadataManager) withOpTimeout(p *Packet) context.CancelFunc {
+	timeout := m.opTimeouts[p.Opcode]
+	if timeout <= 0 {
+		return func() {}
+	}
+	var cancel context.CancelFunc
+	p.ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	return cancel
+}
+
+// canceled returns whether the deadline of the packet is exceeded, the loops of the long reads check it every
+// opTimeoutCheckInterval items and reply OpTimeout instead of going on.
+func (p *Packet) canceled() bool {
+	return p != nil && p.ctx != nil && p.ctx.Err() != nil
+}
+
+// packetTimeout replies the packet with OpTimeout once its deadline is exceeded.
+func (p *Packet) packetTimeout() {
+	p.PacketErrorWithBody(proto.OpTimeout, []byte(ErrOpTimeout.Error()))
+}
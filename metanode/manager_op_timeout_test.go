@@ -0,0 +1,71 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestParseOpTimeouts(t *testing.T) {
+	timeouts, err := parseOpTimeouts("OpMetaReadDir:5s, OpMetaBatchGetXAttr:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeouts[proto.OpMetaReadDir] != 5*time.Second || timeouts[proto.OpMetaBatchGetXAttr] != 0 ||
+		timeouts[proto.OpMetaBatchInodeGet] != defaultOpTimeout {
+		t.Fatalf("wrong timeouts %v", timeouts)
+	}
+	for _, value := range []string{"OpMetaReadDir", "OpMetaReadDir:-1s", "OpMetaCreateInode:5s", "Unknown:5s"} {
+		if _, err = parseOpTimeouts(value); err == nil {
+			t.Fatalf("invalid timeouts[%v] are parsed", value)
+		}
+	}
+}
+
+func TestReadDirWithDeadline(t *testing.T) {
+	mp := &metaPartition{dentryTree: NewBtree()}
+	for i := 0; i < 2*opTimeoutCheckInterval; i++ {
+		mp.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 1, Name: fmt.Sprintf("%04d", i), Inode: uint64(i + 2)}, true)
+	}
+	mp.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 2, Name: "other", Inode: 1000}, true)
+
+	resp, err := mp.readDir(&ReadDirReq{ParentID: 1, Marker: "0009", Limit: 3}, nil)
+	if err != nil || len(resp.Children) != 3 || resp.Children[0].Name != "0010" || resp.Children[2].Name != "0012" {
+		t.Fatalf("wrong page %v, err %v", resp.Children, err)
+	}
+	resp, err = mp.readDir(&ReadDirReq{ParentID: 1, Marker: fmt.Sprintf("%04d", 2*opTimeoutCheckInterval-2)}, nil)
+	if err != nil || len(resp.Children) != 1 {
+		t.Fatalf("wrong last page %v, err %v", resp.Children, err)
+	}
+
+	p := &Packet{}
+	var cancel context.CancelFunc
+	p.ctx, cancel = context.WithCancel(context.Background())
+	if resp, err = mp.readDir(&ReadDirReq{ParentID: 1}, p); err != nil || len(resp.Children) != 2*opTimeoutCheckInterval {
+		t.Fatalf("wrong children %v, err %v", len(resp.Children), err)
+	}
+	cancel()
+	if _, err = mp.readDir(&ReadDirReq{ParentID: 1}, p); err != ErrOpTimeout {
+		t.Fatalf("canceled read is not stopped, err %v", err)
+	}
+	if err = mp.ReadDir(&ReadDirReq{ParentID: 1}, p); err != ErrOpTimeout || p.ResultCode != proto.OpTimeout {
+		t.Fatalf("canceled read is replied with %v, err %v", p.GetResultMsg(), err)
+	}
+}
@@ -37,9 +37,26 @@ func (m *metadataManager) serveProxy(conn net.Conn, mp MetaPartition,
 		reqID      = p.ReqID
 		reqOp      = p.Opcode
 	)
+	if !m.checkDelegatedToken(conn, mp, p) {
+		return false
+	}
 	if leaderAddr, ok = mp.IsLeader(); ok {
+		if mp.IsFrozen() && mutationOps[p.Opcode] {
+			ok = false
+			p.PacketErrorWithBody(proto.OpVolFrozen, []byte(proto.ErrVolFrozen.Error()))
+			m.respondToClient(conn, p)
+			return
+		}
+		prepareShadowMirror(mp, p)
+		p.KernelOffset = mp.GetAppliedID()
 		return
 	}
+	if servesDegradedRead(mp, leaderAddr, p.Opcode) {
+		// the reply is flagged, since the metadata may be stale
+		p.ExtentType |= proto.DegradedReplyFlag
+		p.KernelOffset = mp.GetAppliedID()
+		return true
+	}
 	if leaderAddr == "" {
 		err = ErrNoLeader
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
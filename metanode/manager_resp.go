@@ -55,6 +55,12 @@ func (m *metadataManager) respondToClient(conn net.Conn, p *Packet) (err error)
 		}
 	}()
 
+	if p.shadowMp != nil {
+		m.mirrorToShadow(p)
+	}
+	if p.scope != nil {
+		m.grantInodeCaps(p)
+	}
 	// process data and send reply though specified tcp connection.
 	err = p.WriteToConn(conn)
 	if err != nil {
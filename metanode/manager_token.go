@@ -0,0 +1,151 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// checkDelegatedToken validates the delegated token attached to the request against the volume of the partition and
+// refuses the mutations with a read-only token. The requests of the clients without a token are refused if the volume
+// requires the tokens. A token with a sub directory confines the request to the inodes under it, see checkTokenScope.
+// The token is validated by its signature alone, so the requests are never sent to the master. A request with a token
+// is refused if the signing key is not configured.
+func (m *metadataManager) checkDelegatedToken(conn net.Conn, mp MetaPartition, p *Packet) (ok bool) {
+	arg, token := proto.DetachDelegatedToken(p.Arg[:p.ArgLen])
+	volName := mp.GetBaseConfig().VolName
+	var err error
+	if token == "" {
+		if isClientOp(p.Opcode) && m.isTokenRequired(volName) {
+			err = proto.ErrDelegatedTokenRequired
+		}
+	} else {
+		var t *proto.DelegatedToken
+		t, err = proto.VerifyDelegatedToken(token, []byte(m.tokenSigningKey))
+		if err == nil && !t.Allows(volName, mutationOps[p.Opcode]) {
+			err = proto.ErrDelegatedTokenInvalid
+		}
+		if err == nil && t.Scoped() && isClientOp(p.Opcode) {
+			if err = m.checkTokenScope(t, arg, p); err == nil {
+				p.scope = t
+			}
+		}
+	}
+	if err != nil {
+		log.LogWarnf("checkDelegatedToken: partition(%v) req(%v) op(%v) refused: %v",
+			mp.GetBaseConfig().PartitionId, p.GetReqID(), p.GetOpMsg(), err)
+		p.PacketErrorWithBody(proto.OpNotPerm, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		return false
+	}
+	return true
+}
+
+// checkTokenScope checks that the inodes the request refers to are under the sub directory of the token. The inodes
+// carry no parent, so the meta nodes grant a capability of each inode they return under the sub directory, and the
+// client presents the capabilities of the inodes in its requests. The root inode of the token needs none. The requests
+// referring to no inode are refused, except the inode creations, whose inodes are linked under a granted parent.
+func (m *metadataManager) checkTokenScope(t *proto.DelegatedToken, arg []byte, p *Packet) (err error) {
+	if t.RootInode == 0 {
+		// minted before the sub directories are resolved by the master
+		return proto.ErrDelegatedTokenInvalid
+	}
+	inodes, err := proto.RequestInodes(p.Data[:p.Size])
+	if err != nil {
+		return proto.ErrDelegatedTokenOutOfScope
+	}
+	if len(inodes) == 0 && p.Opcode != proto.OpMetaCreateInode {
+		return proto.ErrDelegatedTokenOutOfScope
+	}
+	_, caps := proto.DetachInodeCaps(arg)
+	key := []byte(m.tokenSigningKey)
+	for _, ino := range inodes {
+		if ino == t.RootInode {
+			continue
+		}
+		if c, ok := caps[ino]; !ok || !hmac.Equal([]byte(c), []byte(t.InodeCap(key, ino))) {
+			return proto.ErrDelegatedTokenOutOfScope
+		}
+	}
+	return nil
+}
+
+// grantInodeCaps replies the capabilities of the inodes returned by a request confined by a scoped token, i.e. the
+// children of the lookups and the directory reads, and the inodes created.
+func (m *metadataManager) grantInodeCaps(p *Packet) {
+	if p.scope == nil || p.ResultCode != proto.OpOk {
+		return
+	}
+	var inodes []uint64
+	switch p.Opcode {
+	case proto.OpMetaLookup:
+		resp := &proto.LookupResponse{}
+		if json.Unmarshal(p.Data[:p.Size], resp) == nil {
+			inodes = append(inodes, resp.Inode)
+		}
+	case proto.OpMetaReadDir:
+		resp := &proto.ReadDirResponse{}
+		if json.Unmarshal(p.Data[:p.Size], resp) == nil {
+			for _, child := range resp.Children {
+				inodes = append(inodes, child.Inode)
+			}
+		}
+	case proto.OpMetaCreateInode:
+		resp := &proto.CreateInodeResponse{}
+		if json.Unmarshal(p.Data[:p.Size], resp) == nil && resp.Info != nil {
+			inodes = append(inodes, resp.Info.Inode)
+		}
+	}
+	if len(inodes) == 0 {
+		return
+	}
+	key := []byte(m.tokenSigningKey)
+	caps := make(map[uint64]string, len(inodes))
+	for _, ino := range inodes {
+		caps[ino] = p.scope.InodeCap(key, ino)
+	}
+	p.Arg = proto.AttachInodeCaps(nil, caps)
+	p.ArgLen = uint32(len(p.Arg))
+}
+
+// setTokenRequiredVols records the vols requiring the delegated tokens, which are sent with the heartbeats.
+func (m *metadataManager) setTokenRequiredVols(names []string) {
+	vols := make(map[string]bool, len(names))
+	for _, name := range names {
+		vols[name] = true
+	}
+	m.tokenRequiredVols.Store(vols)
+}
+
+func (m *metadataManager) isTokenRequired(volName string) bool {
+	vols, _ := m.tokenRequiredVols.Load().(map[string]bool)
+	return vols[volName]
+}
+
+// isClientOp returns whether the operations of the opcode are sent by the clients, which carry the delegated tokens
+// of their mounts. The tasks and the lifecycle operations of the master carry none.
+func isClientOp(opcode uint8) bool {
+	switch opcode {
+	case proto.OpMetaWatchDentry, proto.OpMetaBatchDeleteInode, proto.OpMetaBatchDeleteDentry,
+		proto.OpMetaBatchUnlinkInode, proto.OpMetaBatchEvictInode:
+		return true
+	}
+	return isPriorityQueued(opcode)
+}
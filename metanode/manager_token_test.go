@@ -0,0 +1,194 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestCheckDelegatedToken(t *testing.T) {
+	const key = "signing-key"
+	m := &metadataManager{tokenSigningKey: key}
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1, VolName: "vol"}}
+	server, client := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	sign := func(vol string, readOnly bool, ttl time.Duration, key string) string {
+		token, err := (&proto.DelegatedToken{ID: "id", VolName: vol, ReadOnly: readOnly,
+			ExpireTime: time.Now().Add(ttl).Unix()}).Sign([]byte(key))
+		if err != nil {
+			t.Fatalf("sign err %v", err)
+		}
+		return token
+	}
+	check := func(opcode uint8, token string) bool {
+		p := &Packet{}
+		p.Opcode = opcode
+		p.Arg = proto.AttachDelegatedToken([]byte("127.0.0.1:17210"), token)
+		p.ArgLen = uint32(len(p.Arg))
+		ok := m.checkDelegatedToken(server, mp, p)
+		if !ok && p.ResultCode != proto.OpNotPerm {
+			t.Fatalf("unexpected result code %v", p.ResultCode)
+		}
+		return ok
+	}
+
+	if !check(proto.OpMetaCreateInode, "") {
+		t.Fatalf("request without token refused")
+	}
+	if !check(proto.OpMetaCreateInode, sign("vol", false, time.Hour, key)) {
+		t.Fatalf("read-write token refused")
+	}
+	if !check(proto.OpMetaLookup, sign("vol", true, time.Hour, key)) {
+		t.Fatalf("read-only token refused to read")
+	}
+	if check(proto.OpMetaCreateInode, sign("vol", true, time.Hour, key)) {
+		t.Fatalf("read-only token allowed to write")
+	}
+	if check(proto.OpMetaLookup, sign("other", false, time.Hour, key)) {
+		t.Fatalf("token of another volume allowed")
+	}
+	if check(proto.OpMetaLookup, sign("vol", false, -time.Second, key)) {
+		t.Fatalf("expired token allowed")
+	}
+	if check(proto.OpMetaLookup, sign("vol", false, time.Hour, "forged")) {
+		t.Fatalf("forged token allowed")
+	}
+}
+
+func TestRequireDelegatedToken(t *testing.T) {
+	const key = "signing-key"
+	m := &metadataManager{tokenSigningKey: key}
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1, VolName: "vol"}}
+	other := &metaPartition{config: &MetaPartitionConfig{PartitionId: 2, VolName: "other"}}
+	server, client := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	token, err := (&proto.DelegatedToken{ID: "id", VolName: "vol", ExpireTime: time.Now().Add(time.Hour).Unix()}).Sign([]byte(key))
+	if err != nil {
+		t.Fatalf("sign err %v", err)
+	}
+	check := func(mp MetaPartition, opcode uint8, token string) bool {
+		p := &Packet{}
+		p.Opcode = opcode
+		p.Arg = proto.AttachDelegatedToken(nil, token)
+		p.ArgLen = uint32(len(p.Arg))
+		return m.checkDelegatedToken(server, mp, p)
+	}
+
+	m.setTokenRequiredVols([]string{"vol"})
+	if check(mp, proto.OpMetaLookup, "") || check(mp, proto.OpMetaBatchDeleteDentry, "") {
+		t.Fatalf("request of the client without token allowed")
+	}
+	if !check(mp, proto.OpMetaLookup, token) {
+		t.Fatalf("request with token refused")
+	}
+	if !check(mp, proto.OpLifecycleScanDir, "") {
+		t.Fatalf("request of the master refused")
+	}
+	if !check(other, proto.OpMetaLookup, "") {
+		t.Fatalf("request to another volume refused")
+	}
+	if !check(mp, proto.OpMetaLookup, proto.NewInternalDelegatedToken("vol", []byte(key))) {
+		t.Fatalf("request with the internal token refused")
+	}
+	m.setTokenRequiredVols(nil)
+	if !check(mp, proto.OpMetaLookup, "") {
+		t.Fatalf("request without token refused once the token is not required")
+	}
+}
+
+func TestDelegatedTokenScope(t *testing.T) {
+	const key = "signing-key"
+	m := &metadataManager{tokenSigningKey: key}
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1, VolName: "vol"}}
+	server, client := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	sign := func(id string, rootIno uint64) string {
+		token, err := (&proto.DelegatedToken{ID: id, VolName: "vol", SubDir: "/jobs", RootInode: rootIno,
+			ExpireTime: time.Now().Add(time.Hour).Unix()}).Sign([]byte(key))
+		if err != nil {
+			t.Fatalf("sign err %v", err)
+		}
+		return token
+	}
+	token := sign("id", 100)
+	check := func(opcode uint8, req interface{}, caps map[uint64]string, token string) (p *Packet, ok bool) {
+		p = &Packet{}
+		p.Opcode = opcode
+		if err := p.MarshalData(req); err != nil {
+			t.Fatal(err)
+		}
+		p.Arg = proto.AttachDelegatedToken(proto.AttachInodeCaps([]byte("127.0.0.1:17210"), caps), token)
+		p.ArgLen = uint32(len(p.Arg))
+		return p, m.checkDelegatedToken(server, mp, p)
+	}
+
+	// the root of the token is looked up without a capability, and grants the one of the child
+	p, ok := check(proto.OpMetaLookup, &proto.LookupRequest{ParentID: 100, Name: "a"}, nil, token)
+	if !ok || p.scope == nil {
+		t.Fatalf("lookup under the root of the token refused")
+	}
+	p.PacketOkWithBody([]byte(`{"ino":200,"mode":2147484141}`))
+	m.grantInodeCaps(p)
+	_, granted := proto.DetachInodeCaps(p.Arg[:p.ArgLen])
+	if len(granted) != 1 || granted[200] == "" {
+		t.Fatalf("unexpected capabilities granted %v", granted)
+	}
+	if _, ok = check(proto.OpMetaInodeGet, &proto.InodeGetRequest{Inode: 200}, granted, token); !ok {
+		t.Fatalf("request with the capability granted refused")
+	}
+	if _, ok = check(proto.OpMetaInodeGet, &proto.InodeGetRequest{Inode: 200}, nil, token); ok {
+		t.Fatalf("request without the capability allowed")
+	}
+	if _, ok = check(proto.OpMetaInodeGet, &proto.InodeGetRequest{Inode: 200}, map[uint64]string{200: "forged"}, token); ok {
+		t.Fatalf("request with a forged capability allowed")
+	}
+	if _, ok = check(proto.OpMetaInodeGet, &proto.InodeGetRequest{Inode: 200}, granted, sign("other", 100)); ok {
+		t.Fatalf("capability of another token allowed")
+	}
+	if _, ok = check(proto.OpMetaBatchInodeGet, &proto.BatchInodeGetRequest{Inodes: []uint64{200, 300}}, granted, token); ok {
+		t.Fatalf("batch request with an inode out of the sub directory allowed")
+	}
+	if _, ok = check(proto.OpMetaLookup, &proto.LookupRequest{ParentID: proto.RootIno, Name: "jobs"}, nil, token); ok {
+		t.Fatalf("lookup out of the sub directory allowed")
+	}
+	if _, ok = check(proto.OpMetaBatchRename, &proto.BatchRenameRequest{SrcParentID: 200, DstParentID: 1}, granted, token); ok {
+		t.Fatalf("rename out of the sub directory allowed")
+	}
+	if _, ok = check(proto.OpMetaCreateInode, &proto.CreateInodeRequest{Mode: 0644}, nil, token); !ok {
+		t.Fatalf("inode creation refused")
+	}
+	if _, ok = check(proto.OpMetaListTag, &proto.ListTagRequest{Tag: "t"}, nil, token); ok {
+		t.Fatalf("request referring to no inode allowed")
+	}
+	if _, ok = check(proto.OpMetaLookup, &proto.LookupRequest{ParentID: 100, Name: "a"}, nil, sign("id", 0)); ok {
+		t.Fatalf("token without the root inode allowed")
+	}
+	// the operations of the master are not confined
+	if _, ok = check(proto.OpLifecycleScanDir, &proto.LookupRequest{ParentID: proto.RootIno}, nil, token); !ok {
+		t.Fatalf("request of the master refused")
+	}
+}
@@ -33,6 +33,9 @@ import (
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/pressure"
+	"github.com/chubaofs/chubaofs/util/priority"
+	"github.com/chubaofs/chubaofs/util/replnet"
 )
 
 var (
@@ -40,6 +43,8 @@ var (
 	masterClient   *masterSDK.MasterClient
 	configTotalMem uint64
 	serverPort     string
+	// inodeTimeExtEnabled marshals the time extension of the inodes, see TimeExtFlag
+	inodeTimeExtEnabled bool
 )
 
 // The MetaNode manages the dentry and inode information of the meta partitions on a meta node.
@@ -47,16 +52,37 @@ var (
 type MetaNode struct {
 	nodeId            uint64
 	listen            string
-	metadataDir       string // root dir of the metaNode
-	raftDir           string // root dir of the raftStore log
+	metadataDir       string   // root dir of the metaNode
+	raftDir           string   // root dir of the raftStore log
+	raftDirs          []string // extra dirs of the raftStore log
+	raftDisks         *raftDiskManager
 	metadataManager   MetadataManager
 	localAddr         string
 	clusterId         string
 	raftStore         raftstore.RaftStore
 	raftHeartbeatPort string
 	raftReplicatePort string
+	raftTimings       raftstore.Timings // zero ones take the defaults of the raft store
 	zoneName          string
+	instanceID        string        // generated at the first start and stored in the metadataDir
+	expiredRetention  time.Duration // retention of the expired partition dirs
+	tokenSigningKey   string        // key to validate the delegated tokens
 	httpStopC         chan uint8
+	pressure          *pressure.Monitor
+	priorityQ         *priority.Queue // queues the operations of the clients by their priority classes
+
+	// snapshots of each partition retained for the historical reads, and the interval between them
+	retainSnapshots        int
+	retainSnapshotInterval time.Duration
+
+	opTimeouts map[uint8]time.Duration // the deadlines of the long reads by their opcodes
+
+	nsExportS3 NamespaceExportS3Config
+
+	// the IP of the interface dedicated to the raft replication, if any, and the monitor of the interfaces
+	replicaIP       string
+	replicaResolver *replnet.Resolver
+	netMonitor      *replnet.Monitor
 
 	control common.Control
 }
@@ -110,9 +136,19 @@ func doStart(s common.Server, cfg *config.Config) (err error) {
 	if err = m.parseConfig(cfg); err != nil {
 		return
 	}
+	if err = m.loadInstanceID(); err != nil {
+		return
+	}
+	if m.pressure, err = pressure.NewMonitor(cfg.GetString("role"), cfg); err != nil {
+		return
+	}
+	if m.priorityQ, err = priority.NewQueue(cfg.GetString("role"), cfg); err != nil {
+		return
+	}
 	if err = m.register(); err != nil {
 		return
 	}
+	m.startReplicaNetwork(cfg.GetString("role"))
 	if err = m.startRaftServer(); err != nil {
 		return
 	}
@@ -134,6 +170,8 @@ func doStart(s common.Server, cfg *config.Config) (err error) {
 		return
 	}
 
+	// watch the memory and the file descriptors before accepting connections
+	m.pressure.Start()
 	if err = m.startServer(); err != nil {
 		return
 	}
@@ -147,6 +185,12 @@ func doShutdown(s common.Server) {
 		return
 	}
 	m.stopUpdateNodeInfo()
+	if m.pressure != nil {
+		m.pressure.Stop()
+	}
+	if m.netMonitor != nil {
+		m.netMonitor.Stop()
+	}
 	// shutdown node and release the resource
 	m.stopServer()
 	m.stopMetaManager()
@@ -164,10 +208,16 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 		return
 	}
 	m.localAddr = cfg.GetString(cfgLocalIP)
+	if m.replicaIP = cfg.GetString(proto.ReplicaIP); m.replicaIP != "" {
+		if err = replnet.CheckLocalIP(m.replicaIP); err != nil {
+			return
+		}
+	}
 	m.listen = cfg.GetString(proto.ListenPort)
 	serverPort = m.listen
 	m.metadataDir = cfg.GetString(cfgMetadataDir)
 	m.raftDir = cfg.GetString(cfgRaftDir)
+	m.raftDirs = cfg.GetStringSlice(cfgRaftDirs)
 	m.raftHeartbeatPort = cfg.GetString(cfgRaftHeartbeatPort)
 	m.raftReplicatePort = cfg.GetString(cfgRaftReplicaPort)
 	m.zoneName = cfg.GetString(cfgZoneName)
@@ -177,6 +227,36 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 		return fmt.Errorf("bad totalMem config,Recommended to be configured as 80 percent of physical machine memory")
 	}
 
+	m.expiredRetention = defaultExpiredPartitionRetention
+	if retentionHours := cfg.GetInt64(cfgExpiredPartitionRetentionHours); retentionHours != 0 {
+		m.expiredRetention = time.Duration(retentionHours) * time.Hour
+	}
+
+	m.tokenSigningKey = cfg.GetString(proto.TokenSigningKey)
+
+	inodeTimeExtEnabled = cfg.GetBool(cfgEnableInodeTimeExt)
+
+	m.retainSnapshots = int(cfg.GetInt64(cfgRetainSnapshots))
+	m.retainSnapshotInterval = defaultRetainSnapshotInterval
+	if minutes := cfg.GetInt64(cfgRetainSnapshotIntervalMinutes); minutes > 0 {
+		m.retainSnapshotInterval = time.Duration(minutes) * time.Minute
+	}
+
+	m.nsExportS3 = NamespaceExportS3Config{
+		Endpoint:  cfg.GetString(cfgNamespaceExportS3Endpoint),
+		Region:    cfg.GetString(cfgNamespaceExportS3Region),
+		AccessKey: cfg.GetString(cfgNamespaceExportS3AccessKey),
+		SecretKey: cfg.GetString(cfgNamespaceExportS3SecretKey),
+	}
+
+	if m.opTimeouts, err = parseOpTimeouts(cfg.GetString(cfgOpTimeouts)); err != nil {
+		return fmt.Errorf("bad opTimeouts config: %v", err)
+	}
+
+	if m.raftTimings, err = raftstore.LoadTimings(cfg); err != nil {
+		return fmt.Errorf("bad raft timings config: %v", err)
+	}
+
 	deleteBatchCount := cfg.GetInt64(cfgDeleteBatchCount)
 	if deleteBatchCount > 1 {
 		updateDeleteBatchCount(uint64(deleteBatchCount))
@@ -218,9 +298,16 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 	log.LogInfof("[parseConfig] load listen[%v].", m.listen)
 	log.LogInfof("[parseConfig] load metadataDir[%v].", m.metadataDir)
 	log.LogInfof("[parseConfig] load raftDir[%v].", m.raftDir)
+	log.LogInfof("[parseConfig] load raftDirs[%v].", m.raftDirs)
 	log.LogInfof("[parseConfig] load raftHeartbeatPort[%v].", m.raftHeartbeatPort)
 	log.LogInfof("[parseConfig] load raftReplicatePort[%v].", m.raftReplicatePort)
+	log.LogInfof("[parseConfig] load raftTimings[%+v].", m.raftTimings)
 	log.LogInfof("[parseConfig] load zoneName[%v].", m.zoneName)
+	log.LogInfof("[parseConfig] load expiredRetention[%v].", m.expiredRetention)
+	log.LogInfof("[parseConfig] load retainSnapshots[%v] retainSnapshotInterval[%v].", m.retainSnapshots,
+		m.retainSnapshotInterval)
+	log.LogInfof("[parseConfig] load opTimeouts[%v].", m.opTimeouts)
+	log.LogInfof("[parseConfig] load enableInodeTimeExt[%v].", inodeTimeExtEnabled)
 
 	addrs := cfg.GetSlice(proto.MasterAddr)
 	masters := make([]string, 0, len(addrs))
@@ -228,6 +315,7 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 		masters = append(masters, addr.(string))
 	}
 	masterClient = masterSDK.NewMasterClient(masters, false)
+	masterClient.SetNodeIdentity(proto.NodeRoleMeta, cfg.GetString(proto.NodeToken))
 	err = m.validConfig()
 	return
 }
@@ -261,7 +349,21 @@ func (m *MetaNode) startMetaManager() (err error) {
 		NodeID:    m.nodeId,
 		RootDir:   m.metadataDir,
 		RaftStore: m.raftStore,
+		RaftDisks: m.raftDisks,
 		ZoneName:  m.zoneName,
+
+		ExpiredRetention: m.expiredRetention,
+		TokenSigningKey:  m.tokenSigningKey,
+
+		RetainSnapshots:        m.retainSnapshots,
+		RetainSnapshotInterval: m.retainSnapshotInterval,
+
+		ReplicaIP: m.replicaIP,
+
+		OpTimeouts:    m.opTimeouts,
+		PriorityQueue: m.priorityQ,
+
+		NamespaceExportS3: m.nsExportS3,
 	}
 	m.metadataManager = NewMetadataManager(conf, m)
 	if err = m.metadataManager.Start(); err == nil {
@@ -276,6 +378,22 @@ func (m *MetaNode) stopMetaManager() {
 	}
 }
 
+// startReplicaNetwork replicates the raft logs to the replication interfaces of the peers if this node has one, and
+// monitors the throughput of the interfaces.
+func (m *MetaNode) startReplicaNetwork(module string) {
+	if m.replicaIP != "" {
+		m.replicaResolver = replnet.NewResolver(func() ([]proto.NodeView, error) {
+			cv, err := masterClient.AdminAPI().GetCluster()
+			if err != nil {
+				return nil, err
+			}
+			return cv.MetaNodes, nil
+		})
+	}
+	m.netMonitor = replnet.NewMonitor(module, m.localAddr, m.replicaIP)
+	m.netMonitor.Start()
+}
+
 func (m *MetaNode) register() (err error) {
 	step := 0
 	var nodeAddress string
@@ -294,7 +412,13 @@ func (m *MetaNode) register() (err error) {
 			step++
 		}
 		var nodeID uint64
-		if nodeID, err = masterClient.NodeAPI().AddMetaNode(nodeAddress, m.zoneName); err != nil {
+		if nodeID, err = masterClient.NodeAPI().AddMetaNode(nodeAddress, m.zoneName, m.instanceID); err != nil {
+			// the metadata directory cloned from another meta node never passes the registration
+			if err == proto.ErrDuplicateNodeInstance {
+				log.LogErrorf("register: instance(%v) is registered with another address, "+
+					"clean the metadataDir before starting this node, err(%v)", m.instanceID, err)
+				return
+			}
 			log.LogErrorf("register: register to master fail: address(%v) err(%s)", nodeAddress, err)
 			time.Sleep(3 * time.Second)
 			continue
@@ -15,6 +15,7 @@
 package metanode
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/storage"
@@ -22,6 +23,16 @@ import (
 
 type Packet struct {
 	proto.Packet
+	ctx context.Context // the deadline of the request, nil if its opcode is not bounded
+
+	// the request mirrored to the shadow volume once it succeeds on the partition, nil if it is not mirrored
+	shadowMp  MetaPartition
+	shadowVol string
+	shadowReq []byte
+
+	// the delegated token confining the request under its sub directory, whose reply grants the capabilities of the
+	// inodes looked up, read or created, nil unless the token is scoped
+	scope *proto.DelegatedToken
 }
 
 // NewPacketToDeleteExtent returns a new packet to delete the extent.
@@ -76,3 +87,33 @@ func NewPacketToFreeInodeOnRaftFollower(partitionID uint64, freeInodes []byte) *
 
 	return p
 }
+
+// NewPacketToHashExtent returns a new packet to resume the hash state with the range of the extent.
+func NewPacketToHashExtent(dp *DataPartition, ek *proto.ExtentKey, req *proto.ExtentHashRequest) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpExtentHash
+	p.ExtentType = proto.NormalExtentType
+	if storage.IsTinyExtent(ek.ExtentId) {
+		p.ExtentType = proto.TinyExtentType
+	}
+	p.PartitionID = dp.PartitionID
+	p.ExtentID = ek.ExtentId
+	p.ReqID = proto.GenerateRequestID()
+	p.Data, _ = json.Marshal(req)
+	p.Size = uint32(len(p.Data))
+
+	return p
+}
+
+// NewPacketToTryToLeader returns a new packet to make the peer try to be the leader of the partition.
+func NewPacketToTryToLeader(partitionID uint64) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpMetaPartitionTryToLeader
+	p.PartitionID = partitionID
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+
+	return p
+}
@@ -20,7 +20,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"fmt"
 	"io/ioutil"
@@ -76,6 +78,13 @@ type MetaPartitionConfig struct {
 	AfterStop   func()              `json:"-"`
 	RaftStore   raftstore.RaftStore `json:"-"`
 	ConnPool    *util.ConnectPool   `json:"-"`
+	RaftDir     string              `json:"raft_dir,omitempty"` // Dir of the raft log, empty for the default raftDir
+	Frozen      bool                `json:"frozen,omitempty"`   // the mutations are refused while the volume is frozen
+	Degraded    bool                `json:"degraded,omitempty"` // the reads are served without the leader, possibly stale
+	// the dentries are looked up case-insensitively, which is fixed when the volume is created
+	CaseInsensitive bool `json:"case_insensitive,omitempty"`
+	// the shadow volume which the mutations of the namespace are mirrored to by the leader
+	ShadowVol string `json:"shadow_vol,omitempty"`
 }
 
 func (c *MetaPartitionConfig) checkMeta() (err error) {
@@ -119,6 +128,8 @@ type OpInode interface {
 	GetInodeTree() *BTree
 	DeleteInode(req *proto.DeleteInodeRequest, p *Packet) (err error)
 	DeleteInodeBatch(req *proto.DeleteInodeBatchRequest, p *Packet) (err error)
+	DumpInode(inode uint64) (dump *InodeDump, err error)
+	RestoreInode(dump *InodeDump) (err error)
 }
 
 type OpExtend interface {
@@ -127,6 +138,8 @@ type OpExtend interface {
 	BatchGetXAttr(req *proto.BatchGetXAttrRequest, p *Packet) (err error)
 	RemoveXAttr(req *proto.RemoveXAttrRequest, p *Packet) (err error)
 	ListXAttr(req *proto.ListXAttrRequest, p *Packet) (err error)
+	ListTag(req *proto.ListTagRequest, p *Packet) (err error)
+	FileChecksum(req *proto.FileChecksumRequest, p *Packet) (err error)
 }
 
 // OpDentry defines the interface for the dentry operations.
@@ -137,6 +150,8 @@ type OpDentry interface {
 	UpdateDentry(req *UpdateDentryReq, p *Packet) (err error)
 	ReadDir(req *ReadDirReq, p *Packet) (err error)
 	Lookup(req *LookupReq, p *Packet) (err error)
+	WatchDentry(req *proto.WatchDentryRequest, p *Packet) (err error)
+	BatchRename(req *proto.BatchRenameRequest, p *Packet) (err error)
 	GetDentryTree() *BTree
 }
 
@@ -146,6 +161,11 @@ type OpExtent interface {
 	ExtentsList(req *proto.GetExtentsRequest, p *Packet) (err error)
 	ExtentsTruncate(req *ExtentsTruncateReq, p *Packet) (err error)
 	BatchExtentAppend(req *proto.AppendExtentKeysRequest, p *Packet) (err error)
+	CheckDataPartitionRef(req *proto.CheckDataPartitionRefRequest, p *Packet) (err error)
+	CheckExtentRefs(req *proto.CheckExtentRefsRequest, p *Packet) (err error)
+	DedupRegister(req *proto.DedupRegisterRequest, p *Packet) (err error)
+	DedupReference(req *proto.DedupReferenceRequest, p *Packet) (err error)
+	Fallocate(req *proto.FallocateRequest, p *Packet) (err error)
 }
 
 type OpMultipart interface {
@@ -156,6 +176,18 @@ type OpMultipart interface {
 	ListMultipart(req *proto.ListMultipartRequest, p *Packet) (err error)
 }
 
+// OpLifecycle defines the interface for the operations issued by the lifecycle rules of the volume.
+type OpLifecycle interface {
+	LifecycleScanDir(req *proto.LifecycleScanDirRequest, p *Packet) (err error)
+	LifecycleFilterExpired(req *proto.LifecycleFilterExpiredRequest, p *Packet) (err error)
+	LifecycleDeleteDentries(req *proto.LifecycleDeleteDentriesRequest, p *Packet) (err error)
+	LifecycleDeleteInodes(req *proto.LifecycleDeleteInodesRequest, p *Packet) (err error)
+	LifecycleListMultiparts(req *proto.LifecycleListMultipartsRequest, p *Packet) (err error)
+	LifecycleRemoveMultiparts(req *proto.LifecycleRemoveMultipartsRequest, p *Packet) (err error)
+	LifecycleListExtents(req *proto.LifecycleListExtentsRequest, p *Packet) (err error)
+	LifecycleSwapExtents(req *proto.LifecycleSwapExtentsRequest, p *Packet) (err error)
+}
+
 // OpMeta defines the interface for the metadata operations.
 type OpMeta interface {
 	OpInode
@@ -164,12 +196,14 @@ type OpMeta interface {
 	OpPartition
 	OpExtend
 	OpMultipart
+	OpLifecycle
 }
 
 // OpPartition defines the interface for the partition operations.
 type OpPartition interface {
 	IsLeader() (leaderAddr string, isLeader bool)
 	GetCursor() uint64
+	GetAppliedID() uint64
 	GetBaseConfig() MetaPartitionConfig
 	ResponseLoadMetaPartition(p *Packet) (err error)
 	PersistMetadata() (err error)
@@ -179,8 +213,26 @@ type OpPartition interface {
 	DeleteRaft() error
 	IsExsitPeer(peer proto.Peer) bool
 	TryToLeader(groupID uint64) error
+	LeaderTransferTarget() (target proto.Peer, err error)
 	CanRemoveRaftMember(peer proto.Peer) error
 	IsEquareCreateMetaPartitionRequst(request *proto.CreateMetaPartitionRequest) (err error)
+	GetMultipartGCStat() *proto.MultipartGCStat
+	GetExtentDelJournalStat() *ExtentDelJournalStat
+	GetDeleteBacklog() *proto.DeleteBacklog
+	GetDedupStat() *proto.DedupStat
+	GetReserved() uint64
+	GetApplyStat() *ApplyStat
+	CheckApplyStall(now time.Time)
+	GetSnapshotHistory() []*SnapshotHistory
+	SnapshotDiff(req *proto.SnapshotDiffRequest, p *Packet) (err error)
+	ExportNamespace(req *proto.NamespaceExportRequest) (resp *proto.NamespaceExportResponse, err error)
+	IsFrozen() bool
+	SetFrozen(isFrozen bool) (applyID uint64, err error)
+	IsDegraded() bool
+	SetDegraded(isDegraded bool) (err error)
+	GetShadowFailures() uint64
+	AddShadowFailure()
+	GetRaftView() *raftstore.RaftView
 }
 
 // MetaPartition defines the interface for the meta partition operations.
@@ -189,6 +241,7 @@ type MetaPartition interface {
 	Stop()
 	OpMeta
 	LoadSnapshot(path string) error
+	ForceExitRaftStore()
 	ForceSetMetaPartitionToLoadding()
 	ForceSetMetaPartitionToFininshLoad()
 }
@@ -215,9 +268,27 @@ type metaPartition struct {
 	freeList               *freeList // free inode list
 	extDelCh               chan []proto.ExtentKey
 	extReset               chan struct{}
+	extRotate              chan struct{}
+	extDelRotations        uint64
+	extDelDeletedKeys      uint64
+	extDelDedupedKeys      uint64
+	extDelFailedKeys       uint64
+	extDelPending          int64 // the extent keys in the delete extents files which are not applied yet
 	vol                    *Vol
 	manager                *metadataManager
 	isLoadingMetaPartition bool
+	multipartGCStat        proto.MultipartGCStat
+	multipartGCLock        sync.RWMutex
+	dentryWatch            *dentryWatchTable
+	fileChecksums          *fileChecksumTable
+	dedup                  *dedupIndex
+	dentryFold             *dentryFoldIndex
+	tags                   *tagIndex
+	retries                *retryJournal // the results of the latest mutations with the request IDs of the clients
+	reserved               uint64        // the unwritten space preallocated to the inodes
+	applyStat              applyStat
+	history                *historyViews // the historical views loaded from the retained snapshots
+	shadowFailures         uint64        // the mutations failed to be mirrored to the shadow volume
 }
 
 func (mp *metaPartition) ForceSetMetaPartitionToLoadding() {
@@ -293,6 +364,7 @@ func (mp *metaPartition) onStart() (err error) {
 			mp.config.PartitionId, err.Error())
 		return
 	}
+	mp.startMultipartGC()
 	return
 }
 
@@ -334,6 +406,20 @@ func (mp *metaPartition) startRaft() (err error) {
 		Peers:   peers,
 		SM:      mp,
 	}
+	if mp.config.RaftDir == "" {
+		// record the raft directory of the partition created before multiple raft directories are supported
+		if mp.config.RaftDir, err = mp.manager.raftDisks.locatePartition(mp.config.PartitionId); err != nil {
+			return
+		}
+		if mp.config.RaftDir != "" {
+			if err = mp.PersistMetadata(); err != nil {
+				return
+			}
+		}
+	}
+	if pc.WalPath, err = mp.manager.raftDisks.attachPartition(mp.config.RaftDir, mp.config.PartitionId); err != nil {
+		return
+	}
 	mp.raftPartition, err = mp.config.RaftStore.CreatePartition(pc)
 	if err == nil {
 		mp.ForceSetMetaPartitionToFininshLoad()
@@ -349,6 +435,16 @@ func (mp *metaPartition) stopRaft() {
 	return
 }
 
+// ForceExitRaftStore removes the raft partition from the raft store, e.g. when its raft disk is broken.
+func (mp *metaPartition) ForceExitRaftStore() {
+	if mp.raftPartition == nil {
+		return
+	}
+	if err := mp.raftPartition.Stop(); err != nil {
+		log.LogErrorf("[ForceExitRaftStore] partition(%v) stop raft: %v", mp.config.PartitionId, err)
+	}
+}
+
 func (mp *metaPartition) getRaftPort() (heartbeat, replica int, err error) {
 	raftConfig := mp.config.RaftStore.RaftConfig()
 	heartbeatAddrSplits := strings.Split(raftConfig.HeartbeatAddr, ":")
@@ -385,8 +481,16 @@ func NewMetaPartition(conf *MetaPartitionConfig, manager *metadataManager) MetaP
 		freeList:      newFreeList(),
 		extDelCh:      make(chan []proto.ExtentKey, 10000),
 		extReset:      make(chan struct{}),
+		extRotate:     make(chan struct{}, 1),
 		vol:           NewVol(),
 		manager:       manager,
+		dentryWatch:   newDentryWatchTable(),
+		fileChecksums: newFileChecksumTable(),
+		dedup:         newDedupIndex(),
+		dentryFold:    newDentryFoldIndex(),
+		tags:          newTagIndex(),
+		retries:       newRetryJournal(),
+		history:       newHistoryViews(),
 	}
 	return mp
 }
@@ -410,6 +514,14 @@ func (mp *metaPartition) IsLeader() (leaderAddr string, ok bool) {
 	return
 }
 
+// GetRaftView returns the internals of the raft group of the partition, nil if the raft is not started.
+func (mp *metaPartition) GetRaftView() *raftstore.RaftView {
+	if mp.raftPartition == nil {
+		return nil
+	}
+	return mp.raftPartition.RaftView()
+}
+
 func (mp *metaPartition) GetPeers() (peers []string) {
 	peers = make([]string, 0)
 	for _, peer := range mp.config.Peers {
@@ -426,6 +538,11 @@ func (mp *metaPartition) GetCursor() uint64 {
 	return atomic.LoadUint64(&mp.config.Cursor)
 }
 
+// GetAppliedID returns the index of the latest raft log applied to the partition.
+func (mp *metaPartition) GetAppliedID() uint64 {
+	return atomic.LoadUint64(&mp.applyID)
+}
+
 // PersistMetadata is the wrapper of persistMetadata.
 func (mp *metaPartition) PersistMetadata() (err error) {
 	mp.config.sortPeers()
@@ -446,7 +563,16 @@ func (mp *metaPartition) LoadSnapshot(snapshotPath string) (err error) {
 	if err = mp.loadMultipart(snapshotPath); err != nil {
 		return
 	}
-	err = mp.loadApplyID(snapshotPath)
+	if err = mp.loadRetryJournal(snapshotPath); err != nil {
+		return
+	}
+	if err = mp.loadApplyID(snapshotPath); err != nil {
+		return
+	}
+	mp.rebuildDedupIndex()
+	mp.rebuildDentryFoldIndex()
+	mp.rebuildTagIndex()
+	mp.rebuildReserved()
 	return
 }
 
@@ -467,6 +593,9 @@ func (mp *metaPartition) load() (err error) {
 	if err = mp.loadMultipart(snapshotPath); err != nil {
 		return
 	}
+	if err = mp.loadRetryJournal(snapshotPath); err != nil {
+		return
+	}
 	err = mp.loadApplyID(snapshotPath)
 	return
 }
@@ -494,6 +623,7 @@ func (mp *metaPartition) store(sm *storeMsg) (err error) {
 		mp.storeDentry,
 		mp.storeExtend,
 		mp.storeMultipart,
+		mp.storeRetryJournal,
 	}
 	for _, storeFunc := range storeFuncs {
 		var crc uint32
@@ -0,0 +1,157 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	intervalToCheckApplyStall = 10 * time.Second
+	// a partition is stalled if the proposals wait this long without any entry applied
+	applyStallTimeout = 30 * time.Second
+)
+
+// ApplyStat is the apply pipeline of a partition. The pending proposals are the ones submitted by this node and not
+// applied yet, so the stall is only detected on the leader. The raft status is not consulted, since it blocks as
+// well once the apply stalls.
+type ApplyStat struct {
+	Applied       uint64  `json:"applied"`       // entries applied since the partition is started
+	Throughput    float64 `json:"throughput"`    // entries applied per second within the last check interval
+	Pending       int64   `json:"pending"`       // proposals waiting to be applied
+	LastApplyTime string  `json:"lastApplyTime"` // empty if nothing is applied yet
+	Stalled       bool    `json:"stalled"`
+	StalledSince  string  `json:"stalledSince,omitempty"`
+}
+
+// applyStat tracks the apply pipeline of a partition. The counters are updated on the apply path without the lock,
+// and the samples are taken by the stall checker with the lock.
+type applyStat struct {
+	applied      uint64
+	pending      int64
+	pendingSince int64 // unix nano when the pending proposals became non-zero
+	lastApply    int64 // unix nano
+
+	sync.Mutex
+	sampleApplied uint64
+	sampleTime    time.Time
+	throughput    float64
+	stalledSince  time.Time // zero if not stalled
+}
+
+func (s *applyStat) propose() {
+	if atomic.AddInt64(&s.pending, 1) == 1 {
+		atomic.StoreInt64(&s.pendingSince, time.Now().UnixNano())
+	}
+}
+
+func (s *applyStat) proposed() {
+	atomic.AddInt64(&s.pending, -1)
+}
+
+func (s *applyStat) apply(now time.Time) {
+	atomic.AddUint64(&s.applied, 1)
+	atomic.StoreInt64(&s.lastApply, now.UnixNano())
+}
+
+// check samples the throughput and tells whether the apply stalls, i.e. the proposals wait longer than the timeout
+// since the last apply. It returns whether the apply starts or stops stalling by the check.
+func (s *applyStat) check(now time.Time, timeout time.Duration) (stall, recovered bool) {
+	s.Lock()
+	defer s.Unlock()
+	applied := atomic.LoadUint64(&s.applied)
+	if !s.sampleTime.IsZero() && now.After(s.sampleTime) {
+		s.throughput = float64(applied-s.sampleApplied) / now.Sub(s.sampleTime).Seconds()
+	}
+	s.sampleApplied, s.sampleTime = applied, now
+
+	stalled := false
+	if atomic.LoadInt64(&s.pending) > 0 {
+		since := atomic.LoadInt64(&s.lastApply)
+		if pendingSince := atomic.LoadInt64(&s.pendingSince); pendingSince > since {
+			since = pendingSince
+		}
+		stalled = now.Sub(time.Unix(0, since)) >= timeout
+	}
+	switch {
+	case stalled && s.stalledSince.IsZero():
+		s.stalledSince = now
+		stall = true
+	case !stalled && !s.stalledSince.IsZero():
+		s.stalledSince = time.Time{}
+		recovered = true
+	}
+	return
+}
+
+func (s *applyStat) view() *ApplyStat {
+	s.Lock()
+	defer s.Unlock()
+	stat := &ApplyStat{
+		Applied:    atomic.LoadUint64(&s.applied),
+		Throughput: s.throughput,
+		Pending:    atomic.LoadInt64(&s.pending),
+		Stalled:    !s.stalledSince.IsZero(),
+	}
+	if lastApply := atomic.LoadInt64(&s.lastApply); lastApply > 0 {
+		stat.LastApplyTime = time.Unix(0, lastApply).Format(time.RFC3339)
+	}
+	if stat.Stalled {
+		stat.StalledSince = s.stalledSince.Format(time.RFC3339)
+	}
+	return stat
+}
+
+// GetApplyStat returns the apply pipeline of the partition.
+func (mp *metaPartition) GetApplyStat() *ApplyStat {
+	return mp.applyStat.view()
+}
+
+// CheckApplyStall samples the apply pipeline of the partition, and alerts when the apply starts stalling.
+func (mp *metaPartition) CheckApplyStall(now time.Time) {
+	stall, recovered := mp.applyStat.check(now, applyStallTimeout)
+	if stall {
+		stat := mp.applyStat.view()
+		msg := fmt.Sprintf("metaPartition(%v) apply stalls with %v proposals pending, last applied at %v",
+			mp.config.PartitionId, stat.Pending, stat.LastApplyTime)
+		log.LogErrorf("[CheckApplyStall] %v", msg)
+		exporter.Warning(msg)
+	}
+	if recovered {
+		log.LogWarnf("[CheckApplyStall] metaPartition(%v) apply recovers from the stall", mp.config.PartitionId)
+	}
+}
+
+func (m *metadataManager) startApplyStallChecker() {
+	ticker := time.NewTicker(intervalToCheckApplyStall)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopC:
+			return
+		case now := <-ticker.C:
+			m.Range(func(id uint64, partition MetaPartition) bool {
+				partition.CheckApplyStall(now)
+				return true
+			})
+		}
+	}
+}
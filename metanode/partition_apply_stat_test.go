@@ -0,0 +1,58 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApplyStatCheck(t *testing.T) {
+	s := &applyStat{}
+	now := time.Now()
+	s.apply(now)
+	if stall, _ := s.check(now, time.Minute); stall {
+		t.Fatalf("idle partition should not stall")
+	}
+
+	// the proposal waiting shorter than the timeout does not stall, even if the last apply is long ago
+	s.propose()
+	atomic.StoreInt64(&s.pendingSince, now.Add(2*time.Minute).UnixNano())
+	if stall, _ := s.check(now.Add(150*time.Second), time.Minute); stall {
+		t.Fatalf("proposal waiting 30s should not stall")
+	}
+	if stall, _ := s.check(now.Add(4*time.Minute), time.Minute); !stall {
+		t.Fatalf("proposal waiting 2m should stall")
+	}
+	if stall, _ := s.check(now.Add(5*time.Minute), time.Minute); stall {
+		t.Fatalf("the stall should be reported once")
+	}
+	stat := s.view()
+	if !stat.Stalled || stat.Pending != 1 || stat.Applied != 1 || stat.StalledSince == "" {
+		t.Fatalf("unexpected stat %+v", stat)
+	}
+
+	for i := 0; i < 600; i++ {
+		s.apply(now.Add(5 * time.Minute))
+	}
+	s.proposed()
+	if _, recovered := s.check(now.Add(6*time.Minute), time.Minute); !recovered {
+		t.Fatalf("the stall should recover after the applies")
+	}
+	if stat = s.view(); stat.Stalled || stat.Pending != 0 || stat.Throughput != 10 {
+		t.Fatalf("unexpected stat %+v after the recovery", stat)
+	}
+}
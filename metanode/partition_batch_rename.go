@@ -0,0 +1,238 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/btree"
+)
+
+// BatchRenameResp is the result of applying a batch rename.
+type BatchRenameResp struct {
+	Status   uint8
+	Replaced []uint64
+	Moved    []uint64
+}
+
+// getLiveDir returns the directory inode of the partition, or the status to fail the request with.
+func (mp *metaPartition) getLiveDir(ino uint64) (dir *Inode, status uint8) {
+	item := mp.inodeTree.CopyGet(NewInode(ino, 0))
+	if item == nil {
+		return nil, proto.OpNotExistErr
+	}
+	dir = item.(*Inode)
+	if dir.ShouldDelete() {
+		return nil, proto.OpNotExistErr
+	}
+	if !proto.IsDir(dir.Type) {
+		return nil, proto.OpArgMismatchErr
+	}
+	return dir, proto.OpOk
+}
+
+// fsmBatchRename moves the dentries of the request under the dentry tree lock, so that the readers never observe
+// part of them moved. Either all the dentries are moved or none of them.
+func (mp *metaPartition) fsmBatchRename(req *proto.BatchRenameRequest) (resp *BatchRenameResp) {
+	resp = &BatchRenameResp{Status: proto.OpOk}
+	if req.SrcParentID == 0 && req.DstParentID == 0 {
+		resp.Status = proto.OpArgMismatchErr
+		return
+	}
+	var srcDir, dstDir *Inode
+	if req.SrcParentID != 0 {
+		if srcDir, resp.Status = mp.getLiveDir(req.SrcParentID); resp.Status != proto.OpOk {
+			// the source dentries of an unlink only request are gone with the directory
+			if req.DstParentID == 0 && resp.Status == proto.OpNotExistErr {
+				resp.Status = proto.OpOk
+			}
+			return
+		}
+	}
+	if req.DstParentID != 0 {
+		if dstDir, resp.Status = mp.getLiveDir(req.DstParentID); resp.Status != proto.OpOk {
+			return
+		}
+	}
+
+	var unlinked, linked int
+	mp.dentryTree.Execute(func(tree *btree.BTree) interface{} {
+		srcNames := make(map[string]struct{}, len(req.Items))
+		dstNames := make(map[string]struct{}, len(req.Items))
+		for _, item := range req.Items {
+			srcName, dstName := item.SrcName, item.DstName
+			if mp.isCaseInsensitive() {
+				srcName, dstName = foldDentryName(srcName), foldDentryName(dstName)
+			}
+			_, srcDup := srcNames[srcName]
+			_, dstDup := dstNames[dstName]
+			if (req.SrcParentID != 0 && srcDup) || (req.DstParentID != 0 && dstDup) {
+				resp.Status = proto.OpArgMismatchErr
+				return nil
+			}
+			srcNames[srcName] = struct{}{}
+			dstNames[dstName] = struct{}{}
+		}
+
+		// unlink the source dentries first, so that the items may take the names of each other
+		var removed []*Dentry
+		for _, item := range req.Items {
+			if req.SrcParentID == 0 {
+				break
+			}
+			srcName := mp.resolveDentryName(req.SrcParentID, item.SrcName, tree.Get)
+			d := tree.Get(&Dentry{ParentId: req.SrcParentID, Name: srcName})
+			if d == nil || d.(*Dentry).Inode != item.Inode {
+				if req.DstParentID == 0 {
+					// unlinked by a former attempt
+					continue
+				}
+				resp.Status = proto.OpNotExistErr
+				break
+			}
+			removed = append(removed, tree.Delete(d).(*Dentry))
+		}
+
+		var (
+			inserted     []*Dentry
+			replaced     []*Dentry
+			linkedInodes []uint64
+		)
+		for _, item := range req.Items {
+			if resp.Status != proto.OpOk || req.DstParentID == 0 {
+				break
+			}
+			dentry := &Dentry{ParentId: req.DstParentID, Name: item.DstName, Inode: item.Inode, Type: item.Type}
+			old := tree.Get(dentry)
+			if old == nil {
+				// a dentry of another case takes the name in a case-insensitive volume
+				if d := mp.foldedDentry(dentry, tree.Get); d != nil {
+					dentry.Name, old = d.Name, d
+				}
+			}
+			if old == nil {
+				tree.ReplaceOrInsert(dentry)
+				inserted = append(inserted, dentry)
+				linkedInodes = append(linkedInodes, dentry.Inode)
+				continue
+			}
+			o := old.(*Dentry)
+			if o.Inode == dentry.Inode {
+				// linked by a former attempt
+				continue
+			}
+			// only regular files are allowed to be overwritten
+			if proto.OsModeType(o.Type) != proto.OsModeType(dentry.Type) {
+				resp.Status = proto.OpArgMismatchErr
+			} else if !proto.IsRegular(o.Type) {
+				resp.Status = proto.OpExistErr
+			} else {
+				tree.ReplaceOrInsert(dentry)
+				replaced = append(replaced, o)
+				linkedInodes = append(linkedInodes, dentry.Inode)
+			}
+		}
+
+		if resp.Status != proto.OpOk {
+			for _, d := range inserted {
+				tree.Delete(d)
+			}
+			for _, d := range replaced {
+				tree.ReplaceOrInsert(d)
+			}
+			for _, d := range removed {
+				tree.ReplaceOrInsert(d)
+			}
+			return nil
+		}
+		for _, d := range replaced {
+			resp.Replaced = append(resp.Replaced, d.Inode)
+		}
+		if req.SrcParentID != 0 {
+			for _, d := range removed {
+				resp.Moved = append(resp.Moved, d.Inode)
+			}
+		} else {
+			resp.Moved = linkedInodes
+		}
+		for _, d := range removed {
+			mp.removeFoldedName(d)
+		}
+		for _, d := range inserted {
+			mp.addFoldedName(d)
+		}
+		unlinked, linked = len(removed), len(inserted)
+		return nil
+	})
+	if resp.Status != proto.OpOk {
+		return
+	}
+
+	for i := 0; i < unlinked; i++ {
+		srcDir.DecNLink()
+	}
+	if unlinked > 0 {
+		srcDir.SetMtime()
+	}
+	for i := 0; i < linked; i++ {
+		dstDir.IncNLink()
+	}
+	if linked > 0 || len(resp.Replaced) > 0 {
+		dstDir.SetMtime()
+	}
+	for _, item := range req.Items {
+		if req.SrcParentID != 0 {
+			mp.dentryWatch.notify(req.SrcParentID, item.SrcName)
+		}
+		if req.DstParentID != 0 {
+			mp.dentryWatch.notify(req.DstParentID, item.DstName)
+		}
+	}
+	return
+}
+
+// BatchRename moves a set of dentries of the partition atomically.
+func (mp *metaPartition) BatchRename(req *proto.BatchRenameRequest, p *Packet) (err error) {
+	if req.DstParentID != 0 {
+		for _, item := range req.Items {
+			if !mp.checkDentryName(item.DstName, p) {
+				return
+			}
+		}
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	r, err := mp.submit(opFSMBatchRename, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	result := r.(*BatchRenameResp)
+	if result.Status != proto.OpOk {
+		p.PacketErrorWithBody(result.Status, nil)
+		return
+	}
+	reply, err := json.Marshal(&proto.BatchRenameResponse{Replaced: result.Replaced, Moved: result.Moved})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func listDir(mp *metaPartition, parentID uint64) map[string]uint64 {
+	children := make(map[string]uint64)
+	resp, _ := mp.readDir(&ReadDirReq{ParentID: parentID}, nil)
+	for _, d := range resp.Children {
+		children[d.Name] = d.Inode
+	}
+	return children
+}
+
+func TestFsmBatchRename(t *testing.T) {
+	mp := &metaPartition{dentryTree: NewBtree(), inodeTree: NewBtree(), dentryWatch: newDentryWatchTable()}
+	fileMode := proto.Mode(0644)
+	staging := NewInode(1, proto.Mode(os.ModeDir|0755))
+	output := NewInode(2, proto.Mode(os.ModeDir|0755))
+	mp.inodeTree.ReplaceOrInsert(staging, true)
+	mp.inodeTree.ReplaceOrInsert(output, true)
+	for _, d := range []*Dentry{
+		{ParentId: 1, Name: "part-0", Inode: 10, Type: fileMode},
+		{ParentId: 1, Name: "part-1", Inode: 11, Type: fileMode},
+		{ParentId: 2, Name: "part-1", Inode: 20, Type: fileMode},
+		{ParentId: 2, Name: "logs", Inode: 21, Type: proto.Mode(os.ModeDir | 0755)},
+	} {
+		if status := mp.fsmCreateDentry(d, false); status != proto.OpOk {
+			t.Fatalf("create dentry %v status %v", d, status)
+		}
+	}
+	items := []proto.BatchRenameItem{
+		{SrcName: "part-0", DstName: "part-0", Inode: 10, Type: fileMode},
+		{SrcName: "part-1", DstName: "part-1", Inode: 11, Type: fileMode},
+	}
+
+	// a directory is not overwritten, and nothing is moved
+	failed := append(items, proto.BatchRenameItem{SrcName: "part-1", DstName: "logs", Inode: 11, Type: fileMode})
+	resp := mp.fsmBatchRename(&proto.BatchRenameRequest{SrcParentID: 1, DstParentID: 2, Items: failed})
+	if resp.Status != proto.OpArgMismatchErr {
+		t.Fatalf("duplicated source name should fail, status %v", resp.Status)
+	}
+	failed[2].SrcName = "part-2"
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "part-2", Inode: 12, Type: fileMode}, false)
+	failed[2].Inode = 12
+	resp = mp.fsmBatchRename(&proto.BatchRenameRequest{SrcParentID: 1, DstParentID: 2, Items: failed})
+	if resp.Status != proto.OpArgMismatchErr {
+		t.Fatalf("file overwriting directory should fail, status %v", resp.Status)
+	}
+	if src := listDir(mp, 1); len(src) != 3 {
+		t.Fatalf("failed rename should be rolled back, staging %v", src)
+	}
+	if dst := listDir(mp, 2); !reflect.DeepEqual(dst, map[string]uint64{"part-1": 20, "logs": 21}) {
+		t.Fatalf("failed rename should be rolled back, output %v", dst)
+	}
+
+	resp = mp.fsmBatchRename(&proto.BatchRenameRequest{SrcParentID: 1, DstParentID: 2, Items: items})
+	if resp.Status != proto.OpOk || !reflect.DeepEqual(resp.Replaced, []uint64{20}) {
+		t.Fatalf("unexpected rename result %v", resp)
+	}
+	if src := listDir(mp, 1); !reflect.DeepEqual(src, map[string]uint64{"part-2": 12}) {
+		t.Fatalf("unexpected staging %v", src)
+	}
+	if dst := listDir(mp, 2); !reflect.DeepEqual(dst, map[string]uint64{"part-0": 10, "part-1": 11, "logs": 21}) {
+		t.Fatalf("unexpected output %v", dst)
+	}
+	if staging.GetNLink() != 3 || output.GetNLink() != 5 {
+		t.Fatalf("unexpected nlink of staging %v output %v", staging.GetNLink(), output.GetNLink())
+	}
+
+	// the link only and unlink only requests are idempotent, and only the first attempt moves the dentries
+	move := []proto.BatchRenameItem{{SrcName: "part-2", DstName: "part-2", Inode: 12, Type: fileMode}}
+	for i := 0; i < 2; i++ {
+		resp = mp.fsmBatchRename(&proto.BatchRenameRequest{DstParentID: 2, Items: move})
+		if resp.Status != proto.OpOk || (i == 0) != reflect.DeepEqual(resp.Moved, []uint64{12}) {
+			t.Fatalf("unexpected link only result %v of attempt %v", resp, i)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		resp = mp.fsmBatchRename(&proto.BatchRenameRequest{SrcParentID: 1, Items: move})
+		if resp.Status != proto.OpOk || (i == 0) != reflect.DeepEqual(resp.Moved, []uint64{12}) {
+			t.Fatalf("unexpected unlink only result %v of attempt %v", resp, i)
+		}
+	}
+	if src := listDir(mp, 1); len(src) != 0 {
+		t.Fatalf("staging should be empty, but got %v", src)
+	}
+	if dst := listDir(mp, 2); dst["part-2"] != 12 {
+		t.Fatalf("unexpected output %v", dst)
+	}
+	if staging.GetNLink() != 2 || output.GetNLink() != 6 {
+		t.Fatalf("unexpected nlink of staging %v output %v", staging.GetNLink(), output.GetNLink())
+	}
+}
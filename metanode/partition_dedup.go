@@ -0,0 +1,493 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A block used by a file is recorded in the xattr XAttrKeyDedupBlocks of the file as the fingerprint followed by
+// the partition id, the extent id, the extent offset and the size of the block.
+const dedupRecordSize = proto.DedupFingerprintSize + 8 + 8 + 8 + 4
+
+// DedupReferenceReq defines the raft command to append an indexed block to a file.
+type DedupReferenceReq struct {
+	proto.DedupReferenceRequest
+	ModifyTime     int64  `json:"mt"`
+	ModifyTimeNsec uint32 `json:"mtn,omitempty"`
+}
+
+// DedupOpResult is the result of applying the raft commands of the dedup index.
+type DedupOpResult struct {
+	Status     uint8
+	Registered int
+	Extent     proto.ExtentKey
+}
+
+type dedupExtentID struct {
+	partitionID uint64
+	extentID    uint64
+}
+
+func dedupExtentIDOf(ek *proto.ExtentKey) dedupExtentID {
+	return dedupExtentID{partitionID: ek.PartitionId, extentID: ek.ExtentId}
+}
+
+// dedupBlock is an indexed block, which is recorded by the files for the uses times.
+type dedupBlock struct {
+	ek   proto.ExtentKey
+	uses uint64
+}
+
+// dedupExtent is an extent holding indexed blocks. The extent may be shared by the files, so it is only deleted
+// once no extent key of the partition refers to it.
+type dedupExtent struct {
+	refs         int
+	fingerprints map[string]struct{}
+}
+
+// dedupRef counts the extent keys of an inode referring to an indexed extent, and ek is one of them.
+type dedupRef struct {
+	count int
+	ek    proto.ExtentKey
+}
+
+// dedupIndex indexes the blocks written to the files of the partition by their fingerprints. It is only changed by
+// the raft commands, and rebuilt from the records of the files and the extent keys of the inodes after loading the
+// partition, so all the replicas have the same index.
+type dedupIndex struct {
+	sync.RWMutex
+	blocks  map[string]*dedupBlock
+	extents map[dedupExtentID]*dedupExtent
+}
+
+func newDedupIndex() *dedupIndex {
+	return &dedupIndex{
+		blocks:  make(map[string]*dedupBlock),
+		extents: make(map[dedupExtentID]*dedupExtent),
+	}
+}
+
+func appendDedupRecord(records []byte, fingerprint string, ek *proto.ExtentKey) []byte {
+	var record [dedupRecordSize]byte
+	off := copy(record[:], fingerprint)
+	binary.BigEndian.PutUint64(record[off:], ek.PartitionId)
+	binary.BigEndian.PutUint64(record[off+8:], ek.ExtentId)
+	binary.BigEndian.PutUint64(record[off+16:], ek.ExtentOffset)
+	binary.BigEndian.PutUint32(record[off+24:], ek.Size)
+	return append(records, record[:]...)
+}
+
+func rangeDedupRecords(records []byte, f func(fingerprint string, ek proto.ExtentKey)) {
+	for ; len(records) >= dedupRecordSize; records = records[dedupRecordSize:] {
+		off := proto.DedupFingerprintSize
+		f(string(records[:off]), proto.ExtentKey{
+			PartitionId:  binary.BigEndian.Uint64(records[off:]),
+			ExtentId:     binary.BigEndian.Uint64(records[off+8:]),
+			ExtentOffset: binary.BigEndian.Uint64(records[off+16:]),
+			Size:         binary.BigEndian.Uint32(records[off+24:]),
+		})
+	}
+}
+
+func sameDedupBlock(a, b *proto.ExtentKey) bool {
+	return a.PartitionId == b.PartitionId && a.ExtentId == b.ExtentId &&
+		a.ExtentOffset == b.ExtentOffset && a.Size == b.Size
+}
+
+// blockExtentKey returns the range of the extent holding the block of the file, which must be covered by one key.
+func blockExtentKey(eks []proto.ExtentKey, offset uint64, size uint32) (ek proto.ExtentKey, ok bool) {
+	i := sort.Search(len(eks), func(i int) bool { return eks[i].FileOffset > offset }) - 1
+	if i < 0 {
+		return
+	}
+	key := &eks[i]
+	if storage.IsTinyExtent(key.ExtentId) || offset+uint64(size) > key.FileOffset+uint64(key.Size) {
+		return
+	}
+	ek = proto.ExtentKey{
+		PartitionId:  key.PartitionId,
+		ExtentId:     key.ExtentId,
+		ExtentOffset: key.ExtentOffset + offset - key.FileOffset,
+		Size:         size,
+	}
+	return ek, true
+}
+
+// countRefs counts the extent keys of the inode referring to the indexed extents.
+func (idx *dedupIndex) countRefs(ino *Inode) map[dedupExtentID]*dedupRef {
+	refs := make(map[dedupExtentID]*dedupRef)
+	ino.Extents.Range(func(ek proto.ExtentKey) bool {
+		id := dedupExtentIDOf(&ek)
+		if _, ok := idx.extents[id]; !ok {
+			return true
+		}
+		ref, ok := refs[id]
+		if !ok {
+			ref = &dedupRef{ek: ek}
+			refs[id] = ref
+		}
+		ref.count++
+		return true
+	})
+	return refs
+}
+
+// release drops the blocks of the extent which is no longer referred to.
+func (idx *dedupIndex) release(id dedupExtentID) {
+	if ext, ok := idx.extents[id]; ok {
+		for fingerprint := range ext.fingerprints {
+			delete(idx.blocks, fingerprint)
+		}
+		delete(idx.extents, id)
+	}
+}
+
+// derefs decreases the references to the indexed extents, and returns the keys of the extents to be deleted.
+func (idx *dedupIndex) derefs(refs map[dedupExtentID]*dedupRef, delExtents []proto.ExtentKey) []proto.ExtentKey {
+	for id, ref := range refs {
+		ext := idx.extents[id]
+		if ext.refs -= ref.count; ext.refs <= 0 {
+			idx.release(id)
+			delExtents = append(delExtents, ref.ek)
+		}
+	}
+	return delExtents
+}
+
+// updateExtents changes the extent keys of the inode by the update, which returns the keys to be deleted. The keys
+// of the indexed extents are kept from being deleted unless the extents are no longer referred to.
+func (idx *dedupIndex) updateExtents(ino *Inode, update func() []proto.ExtentKey) []proto.ExtentKey {
+	if idx == nil {
+		return update()
+	}
+	idx.Lock()
+	defer idx.Unlock()
+	if len(idx.extents) == 0 {
+		return update()
+	}
+	before := idx.countRefs(ino)
+	delExtents := update()
+	for id, ref := range idx.countRefs(ino) {
+		idx.extents[id].refs += ref.count
+	}
+	kept := make([]proto.ExtentKey, 0, len(delExtents))
+	for _, ek := range delExtents {
+		if _, ok := idx.extents[dedupExtentIDOf(&ek)]; !ok {
+			kept = append(kept, ek)
+		}
+	}
+	return idx.derefs(before, kept)
+}
+
+// removeInode drops the records of the deleted inode and its references to the indexed extents, and returns the
+// keys of the extents to be deleted.
+func (idx *dedupIndex) removeInode(ino *Inode, extend *Extend) (delExtents []proto.ExtentKey) {
+	if idx == nil {
+		return
+	}
+	idx.Lock()
+	defer idx.Unlock()
+	if extend != nil {
+		records, _ := extend.Get([]byte(proto.XAttrKeyDedupBlocks))
+		rangeDedupRecords(records, func(fingerprint string, ek proto.ExtentKey) {
+			block, ok := idx.blocks[fingerprint]
+			if !ok || !sameDedupBlock(&block.ek, &ek) {
+				return
+			}
+			if block.uses--; block.uses == 0 {
+				delete(idx.blocks, fingerprint)
+				delete(idx.extents[dedupExtentIDOf(&ek)].fingerprints, fingerprint)
+			}
+		})
+	}
+	if ino != nil && len(idx.extents) > 0 {
+		delExtents = idx.derefs(idx.countRefs(ino), nil)
+	}
+	return
+}
+
+func (idx *dedupIndex) isIndexedExtent(ek *proto.ExtentKey) bool {
+	if idx == nil {
+		return false
+	}
+	idx.RLock()
+	defer idx.RUnlock()
+	_, ok := idx.extents[dedupExtentIDOf(ek)]
+	return ok
+}
+
+func (idx *dedupIndex) lookup(fingerprint string) (ek proto.ExtentKey, ok bool) {
+	idx.RLock()
+	defer idx.RUnlock()
+	if block, exist := idx.blocks[fingerprint]; exist {
+		return block.ek, true
+	}
+	return
+}
+
+func (idx *dedupIndex) stat() *proto.DedupStat {
+	stat := &proto.DedupStat{}
+	if idx == nil {
+		return stat
+	}
+	idx.RLock()
+	defer idx.RUnlock()
+	for _, block := range idx.blocks {
+		stat.LogicalBytes += block.uses * uint64(block.ek.Size)
+		stat.PhysicalBytes += uint64(block.ek.Size)
+	}
+	stat.Blocks = uint64(len(idx.blocks))
+	stat.Extents = uint64(len(idx.extents))
+	return stat
+}
+
+// GetDedupStat returns the statistics of the blocks deduplicated in the partition.
+func (mp *metaPartition) GetDedupStat() *proto.DedupStat {
+	return mp.dedup.stat()
+}
+
+// appendDedupRecords appends the records of the blocks used by the inode to its hidden xattr.
+func (mp *metaPartition) appendDedupRecords(ino uint64, records []byte) {
+	var extend *Extend
+	if item := mp.extendTree.CopyGet(NewExtend(ino)); item != nil {
+		extend = item.(*Extend)
+	} else {
+		extend = NewExtend(ino)
+		mp.extendTree.ReplaceOrInsert(extend, true)
+	}
+	key := []byte(proto.XAttrKeyDedupBlocks)
+	value, _ := extend.Get(key)
+	extend.Put(key, append(value, records...))
+}
+
+// rebuildDedupIndex rebuilds the index from the records of the files, in which the records of the extents no longer
+// referred to are stale.
+func (mp *metaPartition) rebuildDedupIndex() {
+	type candidate struct {
+		ek   proto.ExtentKey
+		uses uint64
+	}
+	var (
+		fingerprints []string
+		candidates   = make(map[string][]*candidate)
+		refs         = make(map[dedupExtentID]int)
+		key          = []byte(proto.XAttrKeyDedupBlocks)
+	)
+	mp.extendTree.Ascend(func(i BtreeItem) bool {
+		records, _ := i.(*Extend).Get(key)
+		rangeDedupRecords(records, func(fingerprint string, ek proto.ExtentKey) {
+			refs[dedupExtentIDOf(&ek)] = 0
+			for _, c := range candidates[fingerprint] {
+				if sameDedupBlock(&c.ek, &ek) {
+					c.uses++
+					return
+				}
+			}
+			if len(candidates[fingerprint]) == 0 {
+				fingerprints = append(fingerprints, fingerprint)
+			}
+			candidates[fingerprint] = append(candidates[fingerprint], &candidate{ek: ek, uses: 1})
+		})
+		return true
+	})
+	if len(refs) > 0 {
+		mp.inodeTree.Ascend(func(i BtreeItem) bool {
+			i.(*Inode).Extents.Range(func(ek proto.ExtentKey) bool {
+				if count, ok := refs[dedupExtentIDOf(&ek)]; ok {
+					refs[dedupExtentIDOf(&ek)] = count + 1
+				}
+				return true
+			})
+			return true
+		})
+	}
+	blocks := make(map[string]*dedupBlock)
+	extents := make(map[dedupExtentID]*dedupExtent)
+	for _, fingerprint := range fingerprints {
+		for _, c := range candidates[fingerprint] {
+			id := dedupExtentIDOf(&c.ek)
+			if refs[id] == 0 {
+				continue
+			}
+			ext, ok := extents[id]
+			if !ok {
+				ext = &dedupExtent{refs: refs[id], fingerprints: make(map[string]struct{})}
+				extents[id] = ext
+			}
+			ext.fingerprints[fingerprint] = struct{}{}
+			blocks[fingerprint] = &dedupBlock{ek: c.ek, uses: c.uses}
+			break
+		}
+	}
+	mp.dedup.Lock()
+	mp.dedup.blocks, mp.dedup.extents = blocks, extents
+	mp.dedup.Unlock()
+	log.LogInfof("rebuildDedupIndex: partitionID(%v) blocks(%v) extents(%v)",
+		mp.config.PartitionId, len(blocks), len(extents))
+}
+
+func (mp *metaPartition) fsmDedupRegister(req *proto.DedupRegisterRequest) (resp *DedupOpResult) {
+	resp = &DedupOpResult{Status: proto.OpOk}
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item == nil || item.(*Inode).ShouldDelete() || item.(*Inode).GetNLink() == 0 {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	ino := item.(*Inode)
+	eks := ino.Extents.CopyExtents()
+	var records []byte
+	mp.dedup.Lock()
+	for _, block := range req.Blocks {
+		fingerprint := string(block.Fingerprint)
+		if len(fingerprint) != proto.DedupFingerprintSize || block.Size == 0 {
+			continue
+		}
+		if _, ok := mp.dedup.blocks[fingerprint]; ok {
+			continue
+		}
+		ek, ok := blockExtentKey(eks, block.FileOffset, block.Size)
+		if !ok {
+			continue
+		}
+		id := dedupExtentIDOf(&ek)
+		ext, ok := mp.dedup.extents[id]
+		if !ok {
+			// only the file writing the extent refers to it before any of its blocks is indexed
+			ext = &dedupExtent{fingerprints: make(map[string]struct{})}
+			for i := range eks {
+				if dedupExtentIDOf(&eks[i]) == id {
+					ext.refs++
+				}
+			}
+			mp.dedup.extents[id] = ext
+		}
+		ext.fingerprints[fingerprint] = struct{}{}
+		mp.dedup.blocks[fingerprint] = &dedupBlock{ek: ek, uses: 1}
+		records = appendDedupRecord(records, fingerprint, &ek)
+		resp.Registered++
+	}
+	mp.dedup.Unlock()
+	if len(records) > 0 {
+		mp.appendDedupRecords(req.Inode, records)
+	}
+	return
+}
+
+func (mp *metaPartition) fsmDedupReference(req *DedupReferenceReq) (resp *DedupOpResult) {
+	resp = &DedupOpResult{Status: proto.OpOk}
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item == nil || item.(*Inode).ShouldDelete() {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	ino := item.(*Inode)
+	if !proto.IsRegular(ino.Type) {
+		resp.Status = proto.OpArgMismatchErr
+		return
+	}
+	fingerprint := string(req.Fingerprint)
+	block, ok := mp.dedup.lookup(fingerprint)
+	if !ok {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	ek := block
+	ek.FileOffset = req.FileOffset
+	reserved := ino.UnwrittenReserved()
+	delExtents := mp.dedup.updateExtents(ino, func() []proto.ExtentKey {
+		return ino.AppendExtents([]proto.ExtentKey{ek}, req.ModifyTime, req.ModifyTimeNsec)
+	})
+	mp.updateReserved(reserved, ino)
+	mp.extDelCh <- delExtents
+	mp.dedup.Lock()
+	if b, ok := mp.dedup.blocks[fingerprint]; ok {
+		b.uses++
+	}
+	mp.dedup.Unlock()
+	mp.appendDedupRecords(req.Inode, appendDedupRecord(nil, fingerprint, &block))
+	resp.Extent = ek
+	return
+}
+
+// DedupRegister indexes the blocks written to a file.
+func (mp *metaPartition) DedupRegister(req *proto.DedupRegisterRequest, p *Packet) (err error) {
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	r, err := mp.submit(opFSMDedupRegister, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	result := r.(*DedupOpResult)
+	if result.Status != proto.OpOk {
+		p.PacketErrorWithBody(result.Status, nil)
+		return
+	}
+	reply, err := json.Marshal(&proto.DedupRegisterResponse{Registered: result.Registered})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// DedupReference appends the indexed block of the fingerprint to a file.
+func (mp *metaPartition) DedupReference(req *proto.DedupReferenceRequest, p *Packet) (err error) {
+	// the misses are answered without going through raft
+	if _, ok := mp.dedup.lookup(string(req.Fingerprint)); !ok {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		return
+	}
+	mtime, nsec := splitTime(time.Now())
+	val, err := json.Marshal(&DedupReferenceReq{
+		DedupReferenceRequest: *req,
+		ModifyTime:            mtime,
+		ModifyTimeNsec:        nsec,
+	})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	r, err := mp.submit(opFSMDedupReference, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	result := r.(*DedupOpResult)
+	if result.Status != proto.OpOk {
+		p.PacketErrorWithBody(result.Status, nil)
+		return
+	}
+	reply, err := json.Marshal(&proto.DedupReferenceResponse{Extent: result.Extent})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
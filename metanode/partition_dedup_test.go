@@ -0,0 +1,126 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func dedupFingerprint(b byte) []byte {
+	return bytes.Repeat([]byte{b}, proto.DedupFingerprintSize)
+}
+
+func drainExtDelCh(mp *metaPartition) (eks []proto.ExtentKey) {
+	for {
+		select {
+		case delExtents := <-mp.extDelCh:
+			eks = append(eks, delExtents...)
+		default:
+			return
+		}
+	}
+}
+
+func TestDedupIndex(t *testing.T) {
+	mp := &metaPartition{
+		config:     &MetaPartitionConfig{PartitionId: 1},
+		inodeTree:  NewBtree(),
+		extendTree: NewBtree(),
+		freeList:   newFreeList(),
+		extDelCh:   make(chan []proto.ExtentKey, 100),
+		dedup:      newDedupIndex(),
+	}
+	const blockSize = 128 * KB
+	shared := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 2 * blockSize}
+	a := NewInode(10, proto.Mode(0644))
+	a.AppendExtents([]proto.ExtentKey{shared}, 0, 0)
+	b := NewInode(11, proto.Mode(0644))
+	mp.inodeTree.ReplaceOrInsert(a, true)
+	mp.inodeTree.ReplaceOrInsert(b, true)
+
+	resp := mp.fsmDedupRegister(&proto.DedupRegisterRequest{Inode: 10, Blocks: []proto.DedupBlock{
+		{Fingerprint: dedupFingerprint(1), FileOffset: 0, Size: blockSize},
+		{Fingerprint: dedupFingerprint(2), FileOffset: blockSize, Size: blockSize},
+		{Fingerprint: dedupFingerprint(3), FileOffset: 2 * blockSize, Size: blockSize}, // not written yet
+	}})
+	if resp.Status != proto.OpOk || resp.Registered != 2 {
+		t.Fatalf("unexpected register result %v", resp)
+	}
+
+	req := &DedupReferenceReq{DedupReferenceRequest: proto.DedupReferenceRequest{Inode: 11, Fingerprint: dedupFingerprint(3)}}
+	if resp = mp.fsmDedupReference(req); resp.Status != proto.OpNotExistErr {
+		t.Fatalf("unknown fingerprint should not be referenced, status %v", resp.Status)
+	}
+	req.Fingerprint = dedupFingerprint(2)
+	if resp = mp.fsmDedupReference(req); resp.Status != proto.OpOk ||
+		resp.Extent.ExtentId != 1025 || resp.Extent.ExtentOffset != blockSize || resp.Extent.FileOffset != 0 {
+		t.Fatalf("unexpected reference result %v", resp)
+	}
+	stat := mp.GetDedupStat()
+	expected := proto.DedupStat{Blocks: 2, Extents: 1, LogicalBytes: 3 * blockSize, PhysicalBytes: 2 * blockSize}
+	if *stat != expected {
+		t.Fatalf("unexpected stat %v", stat)
+	}
+
+	// the extent is still referred to by b after a is truncated
+	mp.fsmExtentsTruncate(NewInode(10, 0))
+	if eks := drainExtDelCh(mp); len(eks) != 0 {
+		t.Fatalf("shared extent should not be deleted, but got %v", eks)
+	}
+
+	// the rebuilt index is the same as the one changed by the raft commands
+	blocks, extents := mp.dedup.blocks, mp.dedup.extents
+	mp.rebuildDedupIndex()
+	if !reflect.DeepEqual(blocks, mp.dedup.blocks) || !reflect.DeepEqual(extents, mp.dedup.extents) {
+		t.Fatalf("rebuilt index differs")
+	}
+
+	mp.internalDeleteInode(NewInode(10, 0))
+	if eks := drainExtDelCh(mp); len(eks) != 0 {
+		t.Fatalf("shared extent should not be deleted, but got %v", eks)
+	}
+	if stat = mp.GetDedupStat(); stat.Blocks != 1 || stat.LogicalBytes != blockSize {
+		t.Fatalf("unexpected stat after deleting the writer %v", stat)
+	}
+	mp.internalDeleteInode(NewInode(11, 0))
+	if eks := drainExtDelCh(mp); len(eks) != 1 || eks[0].ExtentId != 1025 {
+		t.Fatalf("extent should be deleted with the last reference, but got %v", eks)
+	}
+	if mp.dedup.isIndexedExtent(&shared) || mp.GetDedupStat().Blocks != 0 {
+		t.Fatalf("index should be empty")
+	}
+}
+
+func TestDedupBlocksXAttrHidden(t *testing.T) {
+	mp := &metaPartition{inodeTree: NewBtree(), extendTree: NewBtree(), dedup: newDedupIndex()}
+	mp.appendDedupRecords(10, appendDedupRecord(nil, string(dedupFingerprint(1)), &proto.ExtentKey{ExtentId: 1025}))
+
+	p := &Packet{}
+	mp.SetXAttr(&proto.SetXAttrRequest{Inode: 10, Key: proto.XAttrKeyDedupBlocks, Value: "x"}, p)
+	if p.ResultCode != proto.OpNotPerm {
+		t.Fatalf("dedup blocks should not be set by clients, result %v", p.GetResultMsg())
+	}
+	p = &Packet{}
+	if err := mp.ListXAttr(&proto.ListXAttrRequest{Inode: 10}, p); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(p.Data, []byte(proto.XAttrKeyDedupBlocks)) {
+		t.Fatalf("dedup blocks should be hidden, but got %s", p.Data)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// degradedReadOps holds the read-only operations served by a degraded meta partition without the leader.
+var degradedReadOps = map[uint8]bool{
+	proto.OpMetaLookup:        true,
+	proto.OpMetaReadDir:       true,
+	proto.OpMetaInodeGet:      true,
+	proto.OpMetaBatchInodeGet: true,
+	proto.OpMetaExtentsList:   true,
+	proto.OpMetaGetXAttr:      true,
+	proto.OpMetaBatchGetXAttr: true,
+	proto.OpMetaListXAttr:     true,
+	proto.OpMetaListTag:       true,
+	proto.OpGetMultipart:      true,
+	proto.OpListMultiparts:    true,
+}
+
+// IsDegraded returns whether the partition is in the degraded mode.
+func (mp *metaPartition) IsDegraded() bool {
+	return mp.config.Degraded
+}
+
+// SetDegraded switches the degraded mode of the partition, and persists the flag.
+func (mp *metaPartition) SetDegraded(isDegraded bool) (err error) {
+	oldFlag := mp.config.Degraded
+	mp.config.Degraded = isDegraded
+	if err = mp.PersistMetadata(); err != nil {
+		mp.config.Degraded = oldFlag
+		return
+	}
+	log.LogWarnf("action[SetDegraded] partition(%v) isDegraded(%v)", mp.config.PartitionId, isDegraded)
+	return
+}
+
+// servesDegradedRead returns whether the request is served by the replica itself, since the partition is in the
+// degraded mode and the raft group has no leader. The metadata read may be stale, as the mutations committed by the
+// lost quorum may be missing, and the mutations keep failing without the leader.
+func servesDegradedRead(mp MetaPartition, leaderAddr string, opcode uint8) bool {
+	return leaderAddr == "" && degradedReadOps[opcode] && mp.IsDegraded()
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestServesDegradedRead(t *testing.T) {
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1, VolName: "vol"}}
+	if servesDegradedRead(mp, "", proto.OpMetaLookup) {
+		t.Fatalf("read served without the leader before degraded")
+	}
+	mp.config.Degraded = true
+	if !servesDegradedRead(mp, "", proto.OpMetaLookup) {
+		t.Fatalf("read refused by the degraded partition without the leader")
+	}
+	if servesDegradedRead(mp, "", proto.OpMetaCreateInode) {
+		t.Fatalf("mutation served by the degraded partition without the leader")
+	}
+	if servesDegradedRead(mp, "127.0.0.1:17210", proto.OpMetaLookup) {
+		t.Fatalf("read served locally by the degraded partition with the leader")
+	}
+	for op := range degradedReadOps {
+		if mutationOps[op] {
+			t.Fatalf("mutation %v served by the degraded partition", op)
+		}
+	}
+}
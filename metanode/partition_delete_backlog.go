@@ -0,0 +1,94 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// GetDeleteBacklog returns the backlog of the deletion pipeline of the partition. The counters are maintained
+// incrementally, so it is cheap enough for every heartbeat.
+func (mp *metaPartition) GetDeleteBacklog() *proto.DeleteBacklog {
+	backlog := &proto.DeleteBacklog{
+		PendingInodes: uint64(mp.freeList.Len()),
+	}
+	if pending := atomic.LoadInt64(&mp.extDelPending); pending > 0 {
+		backlog.PendingExtents = uint64(pending)
+	}
+	if since := mp.freeList.Oldest(); since > 0 {
+		if age := time.Now().Unix() - since; age > 0 {
+			backlog.OldestPendingSec = age
+		}
+	}
+	return backlog
+}
+
+// extentDeleteKeyLen returns the length of a record in the delete extents file.
+func extentDeleteKeyLen(fileName string) int64 {
+	if strings.HasPrefix(fileName, prefixDelExtentV2) {
+		return int64(proto.ExtentV2Length)
+	}
+	return int64(proto.ExtentLength)
+}
+
+// readExtentDeleteFile returns the cursor and the size of the delete extents file.
+func (mp *metaPartition) readExtentDeleteFile(fileName string) (cursor, size int64, err error) {
+	fp, err := os.Open(path.Join(mp.config.RootDir, fileName))
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	info, err := fp.Stat()
+	if err != nil {
+		return
+	}
+	if err = binary.Read(fp, binary.BigEndian, &cursor); err != nil {
+		return
+	}
+	size = info.Size()
+	return
+}
+
+// extentDeleteFilePending returns the extent keys of the delete extents file behind its cursor.
+func (mp *metaPartition) extentDeleteFilePending(fileName string) int64 {
+	cursor, size, err := mp.readExtentDeleteFile(fileName)
+	if err != nil || cursor >= size {
+		return 0
+	}
+	return (size - cursor) / extentDeleteKeyLen(fileName)
+}
+
+// loadExtentDeletePending counts the pending extent keys of the delete extents files, once they are loaded.
+func (mp *metaPartition) loadExtentDeletePending(fileNames []string) {
+	var pending int64
+	for _, fileName := range fileNames {
+		pending += mp.extentDeleteFilePending(fileName)
+	}
+	atomic.StoreInt64(&mp.extDelPending, pending)
+}
+
+// extentDeletesApplied drops the extent keys passed by the cursor of the delete extents file from the pending ones.
+func (mp *metaPartition) extentDeletesApplied(fileName string, oldCursor, cursor int64) {
+	if cursor > oldCursor {
+		atomic.AddInt64(&mp.extDelPending, -(cursor-oldCursor)/extentDeleteKeyLen(fileName))
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/synclist"
+)
+
+func TestFreeListOldest(t *testing.T) {
+	fl := newFreeList()
+	if since := fl.Oldest(); since != 0 {
+		t.Fatalf("empty list should have no oldest item, but got %v", since)
+	}
+	old := time.Now().Unix() - 3600
+	fl.PushSince(1, old)
+	fl.Push(2)
+	if since := fl.Oldest(); since != old {
+		t.Fatalf("expect oldest %v, but got %v", old, since)
+	}
+	// an inode failed to be freed keeps its time once pushed again
+	ino, since := fl.Pop()
+	fl.PushSince(ino, since)
+	if ino, since = fl.Pop(); ino != 2 {
+		t.Fatalf("expect inode 2, but got %v", ino)
+	}
+	if since = fl.Oldest(); since != old {
+		t.Fatalf("expect oldest %v after pushed again, but got %v", old, since)
+	}
+}
+
+func TestDeleteBacklog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete_backlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mp := &metaPartition{
+		config:    &MetaPartitionConfig{RootDir: dir},
+		freeList:  newFreeList(),
+		extDelCh:  make(chan []proto.ExtentKey, 10),
+		extReset:  make(chan struct{}),
+		extRotate: make(chan struct{}, 1),
+		stopC:     make(chan bool),
+	}
+	defer close(mp.stopC)
+	mp.freeList.PushSince(10, time.Now().Unix()-60)
+	mp.freeList.Push(11)
+	go mp.appendDelExtentsToFile(synclist.New())
+	mp.extDelCh <- []proto.ExtentKey{{PartitionId: 1, ExtentId: 1, Size: 4096}, {PartitionId: 1, ExtentId: 2, Size: 4096}}
+	backlog := waitDeleteBacklog(t, mp, func(backlog *proto.DeleteBacklog) bool { return backlog.PendingExtents == 2 })
+	if backlog.PendingInodes != 2 || backlog.OldestPendingSec < 60 {
+		t.Fatalf("unexpected backlog %v", backlog)
+	}
+
+	// the keys passed by the cursor are applied
+	fileName := fmt.Sprintf("%s_%d", prefixDelExtentV2, 0)
+	cursor := int64(len(extentsFileHeader)) + int64(proto.ExtentV2Length)
+	if err = mp.setExtentDeleteFileCursor([]byte(fmt.Sprintf("%s %d", fileName, cursor))); err != nil {
+		t.Fatal(err)
+	}
+	if backlog = mp.GetDeleteBacklog(); backlog.PendingExtents != 1 {
+		t.Fatalf("expect 1 pending extent, but got %v", backlog)
+	}
+
+	// the pending keys are counted again from the files once they are reloaded
+	atomic.StoreInt64(&mp.extDelPending, 0)
+	mp.extReset <- struct{}{}
+	waitDeleteBacklog(t, mp, func(backlog *proto.DeleteBacklog) bool { return backlog.PendingExtents == 1 })
+}
+
+func waitDeleteBacklog(t *testing.T, mp *metaPartition, cond func(backlog *proto.DeleteBacklog) bool) *proto.DeleteBacklog {
+	for i := 0; i < 100; i++ {
+		if backlog := mp.GetDeleteBacklog(); cond(backlog) {
+			return backlog
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected backlog %v", mp.GetDeleteBacklog())
+	return nil
+}
@@ -23,7 +23,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -35,8 +38,110 @@ const (
 	prefixDelExtent     = "EXTENT_DEL"
 	prefixDelExtentV2   = "EXTENT_DEL_V2"
 	maxDeleteExtentSize = 10 * MB
+	// the last delete extents file is rotated once this many bytes of it have been applied, so that the applied
+	// records are dropped with the file instead of staying until it reaches maxDeleteExtentSize
+	compactDeleteExtentSize = 1 * MB
 )
 
+// ExtentDelJournalStat is the health of the delete extents files of a partition.
+type ExtentDelJournalStat struct {
+	Files        int    `json:"files"`
+	ActiveFile   string `json:"activeFile"`
+	TotalBytes   int64  `json:"totalBytes"`
+	PendingBytes int64  `json:"pendingBytes"` // bytes behind the cursors, which are not applied yet
+	Rotations    uint64 `json:"rotations"`
+	DeletedKeys  uint64 `json:"deletedKeys"`
+	DedupedKeys  uint64 `json:"dedupedKeys"`
+	FailedKeys   uint64 `json:"failedKeys"`
+}
+
+// parseExtentDeleteFile returns the version and the index of a delete extents file.
+func parseExtentDeleteFile(name string) (v2 bool, idx int64, ok bool) {
+	prefix := prefixDelExtent
+	if strings.HasPrefix(name, prefixDelExtentV2) {
+		v2, prefix = true, prefixDelExtentV2
+	} else if !strings.HasPrefix(name, prefixDelExtent) {
+		return
+	}
+	idx, err := strconv.ParseInt(strings.TrimPrefix(name, prefix+"_"), 10, 64)
+	ok = err == nil
+	return
+}
+
+// extentDeleteFileLess orders the delete extents files by the index rather than the name, in which
+// EXTENT_DEL_V2_10 would be taken as older than EXTENT_DEL_V2_2. The V1 files are older than the V2 files.
+func extentDeleteFileLess(a, b string) bool {
+	av2, aIdx, aOk := parseExtentDeleteFile(a)
+	bv2, bIdx, bOk := parseExtentDeleteFile(b)
+	if !aOk || !bOk {
+		return a < b
+	}
+	if av2 != bv2 {
+		return !av2
+	}
+	return aIdx < bIdx
+}
+
+// listExtentDeleteFiles returns the delete extents files of the partition from the oldest to the newest.
+func (mp *metaPartition) listExtentDeleteFiles() (fileNames []string, err error) {
+	infos, err := ioutil.ReadDir(mp.config.RootDir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasPrefix(info.Name(), prefixDelExtent) {
+			fileNames = append(fileNames, info.Name())
+		}
+	}
+	sort.Slice(fileNames, func(i, j int) bool { return extentDeleteFileLess(fileNames[i], fileNames[j]) })
+	return
+}
+
+// GetExtentDelJournalStat returns the health of the delete extents files.
+func (mp *metaPartition) GetExtentDelJournalStat() *ExtentDelJournalStat {
+	stat := &ExtentDelJournalStat{
+		Rotations:   atomic.LoadUint64(&mp.extDelRotations),
+		DeletedKeys: atomic.LoadUint64(&mp.extDelDeletedKeys),
+		DedupedKeys: atomic.LoadUint64(&mp.extDelDedupedKeys),
+		FailedKeys:  atomic.LoadUint64(&mp.extDelFailedKeys),
+	}
+	fileNames, err := mp.listExtentDeleteFiles()
+	if err != nil {
+		return stat
+	}
+	for _, fileName := range fileNames {
+		cursor, size, err := mp.readExtentDeleteFile(fileName)
+		if err != nil {
+			continue
+		}
+		stat.Files++
+		stat.ActiveFile = fileName
+		stat.TotalBytes += size
+		if cursor < size {
+			stat.PendingBytes += size - cursor
+		}
+	}
+	return stat
+}
+
+// rotateExtentDeleteFile makes the appender start a new delete extents file, which is applied by all the replicas
+// so that they drop the same files.
+func (mp *metaPartition) rotateExtentDeleteFile() {
+	select {
+	case mp.extRotate <- struct{}{}:
+	default:
+	}
+}
+
+// extentDeleteKey identifies the repeated records of an extent in the delete extents files, which come from the
+// extents appended again after failing to be deleted.
+type extentDeleteKey struct {
+	partitionID  uint64
+	extentID     uint64
+	extentOffset uint64
+	size         uint32
+}
+
 var extentsFileHeader = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08}
 
 /// start metapartition delete extents work
@@ -80,16 +185,15 @@ func (mp *metaPartition) appendDelExtentsToFile(fileList *synclist.SyncList) {
 	)
 LOOP:
 	// scan existed EXTENT_DEL_* files to fill fileList
-	finfos, err := ioutil.ReadDir(mp.config.RootDir)
+	fileNames, err := mp.listExtentDeleteFiles()
 	if err != nil {
 		panic(err)
 	}
-	for _, info := range finfos {
-		if strings.HasPrefix(info.Name(), prefixDelExtent) {
-			fileList.PushBack(info.Name())
-			fileSize = info.Size()
-		}
+	for _, name := range fileNames {
+		fileList.PushBack(name)
 	}
+	mp.loadExtentDeletePending(fileNames)
+	idx = 0
 	// check
 	lastItem := fileList.Back()
 	if lastItem == nil {
@@ -99,13 +203,19 @@ LOOP:
 			panic(err)
 		}
 	} else {
-		//exist, open last file
+		//exist, open last file, and continue the index of it for the new files
 		fileName = lastItem.Value.(string)
+		_, idx, _ = parseExtentDeleteFile(fileName)
 		fp, err = os.OpenFile(path.Join(mp.config.RootDir, fileName),
 			os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 		if err != nil {
 			panic(err)
 		}
+		var info os.FileInfo
+		if info, err = fp.Stat(); err != nil {
+			panic(err)
+		}
+		fileSize = info.Size()
 	}
 
 	extentV2 := false
@@ -126,6 +236,19 @@ LOOP:
 			// reset fileList
 			fileList.Init()
 			goto LOOP
+		case <-mp.extRotate:
+			if fileSize <= int64(len(extentsFileHeader)) {
+				continue
+			}
+			// TODO Unhandled errors
+			fp.Close()
+			idx += 1
+			fp, fileName, fileSize, err = mp.createExtentDeleteFile(prefixDelExtentV2, idx, fileList)
+			if err != nil {
+				panic(err)
+			}
+			atomic.AddUint64(&mp.extDelRotations, 1)
+			log.LogInfof("[appendDelExtentsToFile] partitionId=%d, rotate to %s", mp.config.PartitionId, fileName)
 		case eks := <-mp.extDelCh:
 			var data []byte
 			buf = buf[:0]
@@ -161,6 +284,7 @@ LOOP:
 				panic(err)
 			}
 			fileSize += int64(len(buf))
+			atomic.AddInt64(&mp.extDelPending, int64(len(eks)))
 		}
 	}
 }
@@ -255,6 +379,13 @@ func (mp *metaPartition) deleteExtentsFromList(fileList *synclist.SyncList) {
 			if fileList.Len() <= 1 {
 				log.LogDebugf("[deleteExtentsFromList] partitionId=%d, %s"+
 					" extents delete ok", mp.config.PartitionId, fileName)
+				if cursor >= compactDeleteExtentSize {
+					// drop the applied records by rotating the file, which is removed once it is the older one
+					if _, err = mp.submit(opFSMInternalRotateExtentFile, nil); err != nil {
+						log.LogWarnf("[deleteExtentsFromList] partitionId=%d, rotate %s: %s",
+							mp.config.PartitionId, fileName, err.Error())
+					}
+				}
 			} else {
 				status := mp.raftPartition.Status()
 				if status.State == "StateLeader" && !status.RestoringSnapshot {
@@ -278,6 +409,7 @@ func (mp *metaPartition) deleteExtentsFromList(fileList *synclist.SyncList) {
 		buff := bytes.NewBuffer(buf)
 		cursor += uint64(n)
 		var deleteCnt uint64
+		seen := make(map[extentDeleteKey]struct{})
 		for {
 			if buff.Len() == 0 {
 				break
@@ -305,13 +437,22 @@ func (mp *metaPartition) deleteExtentsFromList(fileList *synclist.SyncList) {
 					panic(err)
 				}
 			}
+			key := extentDeleteKey{partitionID: ek.PartitionId, extentID: ek.ExtentId, extentOffset: ek.ExtentOffset, size: ek.Size}
+			if _, ok := seen[key]; ok {
+				atomic.AddUint64(&mp.extDelDedupedKeys, 1)
+				continue
+			}
+			seen[key] = struct{}{}
 			// delete dataPartition
 			if err = mp.doDeleteMarkedInodes(&ek); err != nil {
 				eks := make([]proto.ExtentKey, 0)
 				eks = append(eks, ek)
 				mp.extDelCh <- eks
+				atomic.AddUint64(&mp.extDelFailedKeys, 1)
 				log.LogWarnf("[deleteExtentsFromList] mp: %v, extent: %v, %s",
 					mp.config.PartitionId, ek, err.Error())
+			} else {
+				atomic.AddUint64(&mp.extDelDeletedKeys, 1)
 			}
 			deleteCnt++
 		}
@@ -0,0 +1,99 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/synclist"
+)
+
+func TestExtentDeleteFileOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_del")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"EXTENT_DEL_V2_10", "EXTENT_DEL_V2_2", "EXTENT_DEL_1", "inode"} {
+		if err = ioutil.WriteFile(path.Join(dir, name), extentsFileHeader, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp := &metaPartition{config: &MetaPartitionConfig{RootDir: dir}}
+	fileNames, err := mp.listExtentDeleteFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"EXTENT_DEL_1", "EXTENT_DEL_V2_2", "EXTENT_DEL_V2_10"}
+	if !reflect.DeepEqual(fileNames, expect) {
+		t.Fatalf("expect files %v, but got %v", expect, fileNames)
+	}
+
+	if err = mp.delOldExtentFile([]byte("EXTENT_DEL_V2_2")); err != nil {
+		t.Fatal(err)
+	}
+	if fileNames, _ = mp.listExtentDeleteFiles(); !reflect.DeepEqual(fileNames, []string{"EXTENT_DEL_V2_10"}) {
+		t.Fatalf("only EXTENT_DEL_V2_10 should be left, but got %v", fileNames)
+	}
+}
+
+func TestRotateExtentDeleteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_del")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"EXTENT_DEL_V2_2", "EXTENT_DEL_V2_10"} {
+		if err = ioutil.WriteFile(path.Join(dir, name), extentsFileHeader, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp := &metaPartition{
+		config:    &MetaPartitionConfig{RootDir: dir},
+		extDelCh:  make(chan []proto.ExtentKey, 10),
+		extReset:  make(chan struct{}),
+		extRotate: make(chan struct{}, 1),
+		stopC:     make(chan bool),
+	}
+	defer close(mp.stopC)
+	go mp.appendDelExtentsToFile(synclist.New())
+
+	// nothing is appended to the last file, so it is not rotated
+	mp.rotateExtentDeleteFile()
+	mp.extDelCh <- []proto.ExtentKey{{PartitionId: 1, ExtentId: 1, Size: 4096}}
+	waitExtentDelJournal(t, mp, func(stat *ExtentDelJournalStat) bool { return stat.PendingBytes > 0 })
+	mp.rotateExtentDeleteFile()
+	stat := waitExtentDelJournal(t, mp, func(stat *ExtentDelJournalStat) bool { return stat.Files == 3 })
+	if stat.ActiveFile != "EXTENT_DEL_V2_11" || stat.Rotations != 1 {
+		t.Fatalf("expect rotation to EXTENT_DEL_V2_11, but got %v", stat)
+	}
+}
+
+func waitExtentDelJournal(t *testing.T, mp *metaPartition, cond func(stat *ExtentDelJournalStat) bool) *ExtentDelJournalStat {
+	for i := 0; i < 100; i++ {
+		if stat := mp.GetExtentDelJournalStat(); cond(stat) {
+			return stat
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected journal %v", mp.GetExtentDelJournalStat())
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// foldDentryName normalizes a name for the case-insensitive lookups. Each rune is mapped to the smallest rune of its
+// case folding orbit, so that two names have the same key if and only if they are equal under strings.EqualFold.
+func foldDentryName(name string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, name)
+}
+
+type dentryFoldKey struct {
+	parentID uint64
+	name     string
+}
+
+// dentryFoldIndex indexes the original names of the dentries by their normalized names in the partitions of the
+// case-insensitive volumes. Like the dentry tree, it is only changed by the raft commands, and rebuilt from the dentry
+// tree after loading the partition, so all the replicas have the same index. A key has more than one name only while
+// a dentry is renamed to another case of its name.
+type dentryFoldIndex struct {
+	sync.RWMutex
+	names map[dentryFoldKey][]string
+}
+
+func newDentryFoldIndex() *dentryFoldIndex {
+	return &dentryFoldIndex{names: make(map[dentryFoldKey][]string)}
+}
+
+func (idx *dentryFoldIndex) add(parentID uint64, name string) {
+	idx.Lock()
+	defer idx.Unlock()
+	key := dentryFoldKey{parentID: parentID, name: foldDentryName(name)}
+	for _, n := range idx.names[key] {
+		if n == name {
+			return
+		}
+	}
+	idx.names[key] = append(idx.names[key], name)
+}
+
+func (idx *dentryFoldIndex) remove(parentID uint64, name string) {
+	idx.Lock()
+	defer idx.Unlock()
+	key := dentryFoldKey{parentID: parentID, name: foldDentryName(name)}
+	names := idx.names[key]
+	for i, n := range names {
+		if n != name {
+			continue
+		}
+		if len(names) == 1 {
+			delete(idx.names, key)
+			return
+		}
+		idx.names[key] = append(names[:i:i], names[i+1:]...)
+		return
+	}
+}
+
+// lookup returns the original names of the dentries whose names are equal to the name under the case folding.
+func (idx *dentryFoldIndex) lookup(parentID uint64, name string) []string {
+	idx.RLock()
+	defer idx.RUnlock()
+	return idx.names[dentryFoldKey{parentID: parentID, name: foldDentryName(name)}]
+}
+
+func (mp *metaPartition) isCaseInsensitive() bool {
+	return mp.config != nil && mp.config.CaseInsensitive
+}
+
+// resolveDentryName returns the name a dentry is stored with, which is the name itself unless the partition is
+// case-insensitive, and no dentry is of the exact name but one of another case. The dentries are got from the dentry
+// tree by get, so that it can be called with the lock of the tree held.
+func (mp *metaPartition) resolveDentryName(parentID uint64, name string, get func(key BtreeItem) BtreeItem) string {
+	if !mp.isCaseInsensitive() {
+		return name
+	}
+	dentry := &Dentry{ParentId: parentID, Name: name}
+	if get(dentry) != nil {
+		return name
+	}
+	if d := mp.foldedDentry(dentry, get); d != nil {
+		return d.Name
+	}
+	return name
+}
+
+// foldedDentry returns another dentry of the parent whose name is equal to the name of the dentry under the case
+// folding, which is got from the dentry tree by get, so that it can be called with the lock of the tree held.
+func (mp *metaPartition) foldedDentry(dentry *Dentry, get func(key BtreeItem) BtreeItem) *Dentry {
+	if !mp.isCaseInsensitive() {
+		return nil
+	}
+	for _, name := range mp.dentryFold.lookup(dentry.ParentId, dentry.Name) {
+		if name == dentry.Name {
+			continue
+		}
+		if item := get(&Dentry{ParentId: dentry.ParentId, Name: name}); item != nil {
+			return item.(*Dentry)
+		}
+	}
+	return nil
+}
+
+func (mp *metaPartition) addFoldedName(dentry *Dentry) {
+	if mp.isCaseInsensitive() {
+		mp.dentryFold.add(dentry.ParentId, dentry.Name)
+	}
+}
+
+func (mp *metaPartition) removeFoldedName(dentry *Dentry) {
+	if mp.isCaseInsensitive() {
+		mp.dentryFold.remove(dentry.ParentId, dentry.Name)
+	}
+}
+
+func (mp *metaPartition) rebuildDentryFoldIndex() {
+	idx := newDentryFoldIndex()
+	if mp.isCaseInsensitive() {
+		mp.dentryTree.Ascend(func(i BtreeItem) bool {
+			d := i.(*Dentry)
+			idx.add(d.ParentId, d.Name)
+			return true
+		})
+	}
+	mp.dentryFold = idx
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func newCaseInsensitivePartition() *metaPartition {
+	mp := &metaPartition{
+		config:      &MetaPartitionConfig{CaseInsensitive: true},
+		dentryTree:  NewBtree(),
+		inodeTree:   NewBtree(),
+		dentryWatch: newDentryWatchTable(),
+		dentryFold:  newDentryFoldIndex(),
+	}
+	mp.inodeTree.ReplaceOrInsert(NewInode(1, proto.Mode(os.ModeDir|0755)), true)
+	mp.inodeTree.ReplaceOrInsert(NewInode(2, proto.Mode(os.ModeDir|0755)), true)
+	return mp
+}
+
+func TestFoldDentryName(t *testing.T) {
+	for _, c := range []struct {
+		a, b  string
+		equal bool
+	}{
+		{"Readme.TXT", "README.txt", true},
+		{"\u212a", "k", true}, // the kelvin sign
+		{"Stra\u00dfe", "STRASSE", false},
+		{"part-0", "part-1", false},
+	} {
+		if equal := foldDentryName(c.a) == foldDentryName(c.b); equal != c.equal {
+			t.Errorf("names %q and %q folded equal %v", c.a, c.b, equal)
+		}
+	}
+}
+
+func TestCaseInsensitiveDentry(t *testing.T) {
+	mp := newCaseInsensitivePartition()
+	fileMode := proto.Mode(0644)
+	if status := mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "Readme.TXT", Inode: 10, Type: fileMode}, false); status != proto.OpOk {
+		t.Fatalf("create dentry status %v", status)
+	}
+	if status := mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "readme.txt", Inode: 11, Type: fileMode}, false); status != proto.OpExistErr {
+		t.Fatalf("another case of the name should exist, status %v", status)
+	}
+	if status := mp.fsmCreateDentry(&Dentry{ParentId: 2, Name: "readme.txt", Inode: 11, Type: fileMode}, false); status != proto.OpOk {
+		t.Fatalf("the name is unique in the parent only, status %v", status)
+	}
+	if d, status := mp.getDentry(&Dentry{ParentId: 1, Name: "README.txt"}); status != proto.OpOk || d.Inode != 10 || d.Name != "Readme.TXT" {
+		t.Fatalf("lookup another case of the name got %v status %v", d, status)
+	}
+	if children := listDir(mp, 1); !reflect.DeepEqual(children, map[string]uint64{"Readme.TXT": 10}) {
+		t.Fatalf("readdir should keep the original case, %v", children)
+	}
+
+	// rename to another case of the name, i.e. link the new case and unlink the old one
+	if status := mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "README.TXT", Inode: 10, Type: fileMode}, false); status != proto.OpOk {
+		t.Fatalf("link another case of the name status %v", status)
+	}
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: 1, Name: "Readme.TXT"}, false); resp.Status != proto.OpOk {
+		t.Fatalf("unlink the old case status %v", resp.Status)
+	}
+	if children := listDir(mp, 1); !reflect.DeepEqual(children, map[string]uint64{"README.TXT": 10}) {
+		t.Fatalf("unexpected children after renaming the case, %v", children)
+	}
+	if resp := mp.fsmUpdateDentry(&Dentry{ParentId: 1, Name: "readme.txt", Inode: 12}); resp.Status != proto.OpOk || resp.Msg.Inode != 10 {
+		t.Fatalf("update another case of the name got %v", resp)
+	}
+
+	mp.rebuildDentryFoldIndex()
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: 1, Name: "readme.TXT"}, false); resp.Status != proto.OpOk || resp.Msg.Inode != 12 {
+		t.Fatalf("delete another case of the name got %v", resp)
+	}
+	if _, status := mp.getDentry(&Dentry{ParentId: 1, Name: "README.TXT"}); status != proto.OpNotExistErr {
+		t.Fatalf("deleted dentry is found, status %v", status)
+	}
+}
+
+func TestCaseInsensitiveBatchRename(t *testing.T) {
+	mp := newCaseInsensitivePartition()
+	fileMode := proto.Mode(0644)
+	for _, d := range []*Dentry{
+		{ParentId: 1, Name: "part-0", Inode: 10, Type: fileMode},
+		{ParentId: 1, Name: "part-1", Inode: 11, Type: fileMode},
+		{ParentId: 2, Name: "PART-1", Inode: 20, Type: fileMode},
+	} {
+		if status := mp.fsmCreateDentry(d, false); status != proto.OpOk {
+			t.Fatalf("create dentry %v status %v", d, status)
+		}
+	}
+	dup := []proto.BatchRenameItem{
+		{SrcName: "part-0", DstName: "Part-0", Inode: 10, Type: fileMode},
+		{SrcName: "part-1", DstName: "PART-0", Inode: 11, Type: fileMode},
+	}
+	if resp := mp.fsmBatchRename(&proto.BatchRenameRequest{SrcParentID: 1, DstParentID: 2, Items: dup}); resp.Status != proto.OpArgMismatchErr {
+		t.Fatalf("duplicated destination names under the case folding should fail, status %v", resp.Status)
+	}
+	items := []proto.BatchRenameItem{
+		{SrcName: "PART-0", DstName: "Part-0", Inode: 10, Type: fileMode},
+		{SrcName: "part-1", DstName: "part-1", Inode: 11, Type: fileMode},
+	}
+	resp := mp.fsmBatchRename(&proto.BatchRenameRequest{SrcParentID: 1, DstParentID: 2, Items: items})
+	if resp.Status != proto.OpOk || !reflect.DeepEqual(resp.Replaced, []uint64{20}) {
+		t.Fatalf("unexpected rename result %v", resp)
+	}
+	if dst := listDir(mp, 2); !reflect.DeepEqual(dst, map[string]uint64{"Part-0": 10, "PART-1": 11}) {
+		t.Fatalf("unexpected output %v", dst)
+	}
+	if d, status := mp.getDentry(&Dentry{ParentId: 2, Name: "part-0"}); status != proto.OpOk || d.Inode != 10 {
+		t.Fatalf("lookup renamed dentry got %v status %v", d, status)
+	}
+	if _, status := mp.getDentry(&Dentry{ParentId: 1, Name: "part-0"}); status != proto.OpNotExistErr {
+		t.Fatalf("moved dentry is found in the source, status %v", status)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const (
+	// DentryWatchTTL is how long a watch lasts unless the client renews it, which the clients do on every poll.
+	DentryWatchTTL = 30 * time.Second
+	// DentryWatchMaxPending is the maximum number of the invalidated dentries kept for a client between two polls,
+	// beyond which the whole directories are invalidated.
+	DentryWatchMaxPending = 1024
+	// DentryWatchMaxDirs is the maximum number of the directories a client can watch on a partition.
+	DentryWatchMaxDirs = 65536
+)
+
+type dentryWatcher struct {
+	dirs     map[uint64]time.Time // directory inode -> expiration
+	dentries []*proto.InvalidDentry
+	overflow map[uint64]struct{}
+	expire   time.Time
+}
+
+// dentryWatchTable tracks the directories whose dentries are cached by the clients, so that the clients can be
+// told about the changes of the dentries instead of waiting for their caches to expire. The watches are kept in
+// memory only, and are lost on a leader change, after which the clients fall back to the cache expiration until
+// they renew the watches.
+type dentryWatchTable struct {
+	sync.Mutex
+	watchers map[string]*dentryWatcher
+}
+
+func newDentryWatchTable() *dentryWatchTable {
+	return &dentryWatchTable{watchers: make(map[string]*dentryWatcher)}
+}
+
+// watch renews the watches of the client on the directories, and returns the dentries invalidated since the last
+// call of the client.
+func (t *dentryWatchTable) watch(clientID string, dirs []uint64) (resp *proto.WatchDentryResponse) {
+	now := time.Now()
+	expire := now.Add(DentryWatchTTL)
+	resp = &proto.WatchDentryResponse{}
+	t.Lock()
+	defer t.Unlock()
+	t.expireWatchers(now)
+	w, ok := t.watchers[clientID]
+	if !ok {
+		w = &dentryWatcher{dirs: make(map[uint64]time.Time), overflow: make(map[uint64]struct{})}
+		t.watchers[clientID] = w
+	}
+	w.expire = expire
+	for dir, dirExpire := range w.dirs {
+		if dirExpire.Before(now) {
+			delete(w.dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if _, ok = w.dirs[dir]; ok || len(w.dirs) < DentryWatchMaxDirs {
+			w.dirs[dir] = expire
+		}
+	}
+	resp.Dentries = w.dentries
+	for dir := range w.overflow {
+		resp.Overflow = append(resp.Overflow, dir)
+	}
+	w.dentries = nil
+	w.overflow = make(map[uint64]struct{})
+	return
+}
+
+// notify records the change of the dentry for the clients watching its parent directory.
+func (t *dentryWatchTable) notify(parentID uint64, name string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.Lock()
+	defer t.Unlock()
+	for _, w := range t.watchers {
+		expire, ok := w.dirs[parentID]
+		if !ok || expire.Before(now) {
+			continue
+		}
+		if _, ok = w.overflow[parentID]; ok {
+			continue
+		}
+		if len(w.dentries) >= DentryWatchMaxPending {
+			w.overflow[parentID] = struct{}{}
+			continue
+		}
+		w.dentries = append(w.dentries, &proto.InvalidDentry{ParentID: parentID, Name: name})
+	}
+}
+
+func (t *dentryWatchTable) expireWatchers(now time.Time) {
+	for clientID, w := range t.watchers {
+		if w.expire.Before(now) {
+			delete(t.watchers, clientID)
+		}
+	}
+}
+
+// WatchDentry registers the watches of the client on the directories, and replies the dentries invalidated since
+// the last request of the client.
+func (mp *metaPartition) WatchDentry(req *proto.WatchDentryRequest, p *Packet) (err error) {
+	resp := mp.dentryWatch.watch(req.ClientID, req.Dirs)
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
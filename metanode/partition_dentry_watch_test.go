@@ -0,0 +1,71 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestDentryWatchTable(t *testing.T) {
+	table := newDentryWatchTable()
+	table.watch("c1", []uint64{1})
+	table.watch("c2", []uint64{2})
+
+	table.notify(1, "a")
+	table.notify(2, "b")
+	table.notify(3, "c")
+
+	resp := table.watch("c1", []uint64{1})
+	if len(resp.Dentries) != 1 || resp.Dentries[0].ParentID != 1 || resp.Dentries[0].Name != "a" {
+		t.Fatalf("unexpected dentries of c1 %v", resp.Dentries)
+	}
+	if resp = table.watch("c1", []uint64{1}); len(resp.Dentries) != 0 {
+		t.Fatalf("dentries of c1 should be cleared, but got %v", resp.Dentries)
+	}
+	resp = table.watch("c2", nil)
+	if len(resp.Dentries) != 1 || resp.Dentries[0].Name != "b" {
+		t.Fatalf("unexpected dentries of c2 %v", resp.Dentries)
+	}
+
+	for i := 0; i <= DentryWatchMaxPending; i++ {
+		table.notify(1, fmt.Sprintf("f%v", i))
+	}
+	resp = table.watch("c1", []uint64{1})
+	if len(resp.Dentries) != DentryWatchMaxPending || len(resp.Overflow) != 1 || resp.Overflow[0] != 1 {
+		t.Fatalf("expect %v dentries and overflow of dir 1, but got %v dentries and overflow %v",
+			DentryWatchMaxPending, len(resp.Dentries), resp.Overflow)
+	}
+}
+
+func TestFsmDentryNotifyWatchers(t *testing.T) {
+	mp := &metaPartition{dentryTree: NewBtree(), inodeTree: NewBtree(), dentryWatch: newDentryWatchTable()}
+	mp.dentryWatch.watch("c1", []uint64{1})
+	if status := mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "a", Inode: 10}, true); status != proto.OpOk {
+		t.Fatalf("create dentry status %v", status)
+	}
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: 1, Name: "a", Inode: 10}, false); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry status %v", resp.Status)
+	}
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: 1, Name: "b"}, false); resp.Status == proto.OpOk {
+		t.Fatalf("delete missing dentry should fail")
+	}
+	resp := mp.dentryWatch.watch("c1", []uint64{1})
+	if len(resp.Dentries) != 2 || resp.Dentries[0].Name != "a" || resp.Dentries[1].Name != "a" {
+		t.Fatalf("unexpected dentries %v", resp.Dentries)
+	}
+}
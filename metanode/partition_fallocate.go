@@ -0,0 +1,93 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sync/atomic"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// Fallocate preallocates the space of the file. No extent is allocated on the data nodes, the preallocated size is
+// recorded on the inode and the unwritten part of it is reserved against the capacity of the volume.
+func (mp *metaPartition) Fallocate(req *proto.FallocateRequest, p *Packet) (err error) {
+	ino := NewInode(req.Inode, 0)
+	ino.Reserved = req.Offset + req.Length
+	val, err := ino.Marshal()
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.submit(opFSMFallocate, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(*InodeResponse).Status, nil)
+	return
+}
+
+func (mp *metaPartition) fsmFallocate(ino *Inode) (resp *InodeResponse) {
+	resp = NewInodeResponse()
+	resp.Status = proto.OpOk
+	item := mp.inodeTree.CopyGet(ino)
+	if item == nil {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	i := item.(*Inode)
+	if i.ShouldDelete() {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	if !proto.IsRegular(i.Type) {
+		resp.Status = proto.OpArgMismatchErr
+		return
+	}
+	reserved := i.UnwrittenReserved()
+	i.DoWriteFunc(func() {
+		if i.Reserved < ino.Reserved {
+			i.Reserved = ino.Reserved
+		}
+	})
+	mp.updateReserved(reserved, i)
+	log.LogDebugf("fsmFallocate: partitionID(%v) inode(%v) reserved(%v)", mp.config.PartitionId, i.Inode, ino.Reserved)
+	return
+}
+
+// updateReserved adjusts the unwritten reserved space of the partition by the change of the inode, whose unwritten
+// reserved space was the given one before the change.
+func (mp *metaPartition) updateReserved(before uint64, ino *Inode) {
+	after := ino.UnwrittenReserved()
+	if after != before {
+		atomic.AddUint64(&mp.reserved, after-before)
+	}
+}
+
+// rebuildReserved sums the unwritten reserved space of the inodes after the partition is loaded.
+func (mp *metaPartition) rebuildReserved() {
+	var reserved uint64
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		reserved += i.(*Inode).UnwrittenReserved()
+		return true
+	})
+	atomic.StoreUint64(&mp.reserved, reserved)
+}
+
+// GetReserved returns the space preallocated to the inodes of the partition which is not written yet.
+func (mp *metaPartition) GetReserved() uint64 {
+	return atomic.LoadUint64(&mp.reserved)
+}
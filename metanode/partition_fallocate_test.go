@@ -0,0 +1,108 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestFsmFallocate(t *testing.T) {
+	mp := &metaPartition{
+		config:    &MetaPartitionConfig{PartitionId: 1},
+		inodeTree: NewBtree(),
+		extDelCh:  make(chan []proto.ExtentKey, 10),
+	}
+	file := NewInode(10, proto.Mode(0644))
+	dir := NewInode(11, proto.Mode(os.ModeDir|0755))
+	mp.inodeTree.ReplaceOrInsert(file, true)
+	mp.inodeTree.ReplaceOrInsert(dir, true)
+	fallocate := func(ino, size uint64) uint8 {
+		req := NewInode(ino, 0)
+		req.Reserved = size
+		return mp.fsmFallocate(req).Status
+	}
+
+	if status := fallocate(11, 4096); status != proto.OpArgMismatchErr {
+		t.Fatalf("directory should not be preallocated, status %v", status)
+	}
+	if status := fallocate(12, 4096); status != proto.OpNotExistErr {
+		t.Fatalf("missing inode should not be preallocated, status %v", status)
+	}
+	if status := fallocate(10, 8192); status != proto.OpOk {
+		t.Fatalf("fallocate status %v", status)
+	}
+	// a smaller preallocation keeps the former one
+	fallocate(10, 4096)
+	if file.Reserved != 8192 || file.Size != 0 || mp.GetReserved() != 8192 {
+		t.Fatalf("unexpected reserved(%v) size(%v) partition reserved(%v)", file.Reserved, file.Size, mp.GetReserved())
+	}
+
+	// the written extents consume the reservation
+	ext := NewInode(10, 0)
+	ext.Extents.Append(proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1, Size: 3000})
+	if status := mp.fsmAppendExtents(ext); status != proto.OpOk {
+		t.Fatalf("append extents status %v", status)
+	}
+	if mp.GetReserved() != 8192-3000 {
+		t.Fatalf("unexpected partition reserved(%v) after write", mp.GetReserved())
+	}
+
+	// the truncate extending the file keeps the preallocated space, and the one shrinking it releases the space
+	// preallocated beyond the new size
+	truncate := func(size uint64) {
+		req := NewInode(10, 0)
+		req.Size = size
+		if resp := mp.fsmExtentsTruncate(req); resp.Status != proto.OpOk {
+			t.Fatalf("truncate status %v", resp.Status)
+		}
+	}
+	truncate(5000)
+	if file.Reserved != 8192 || mp.GetReserved() != 8192-3000 {
+		t.Fatalf("unexpected reserved(%v) partition reserved(%v) after extend", file.Reserved, mp.GetReserved())
+	}
+	truncate(4096)
+	if file.Reserved != 4096 || mp.GetReserved() != 4096-3000 {
+		t.Fatalf("unexpected reserved(%v) partition reserved(%v) after truncate", file.Reserved, mp.GetReserved())
+	}
+
+	mp.rebuildReserved()
+	if mp.GetReserved() != 4096-3000 {
+		t.Fatalf("unexpected partition reserved(%v) after rebuild", mp.GetReserved())
+	}
+
+	// the reservation of the deleted inode is dropped
+	mp.freeList = newFreeList()
+	mp.extendTree = NewBtree()
+	mp.internalDeleteInode(NewInode(10, 0))
+	if mp.GetReserved() != 0 {
+		t.Fatalf("unexpected partition reserved(%v) after delete", mp.GetReserved())
+	}
+}
+
+func TestInodeReservedMarshal(t *testing.T) {
+	ino := NewInode(10, proto.Mode(0644))
+	ino.Reserved = 1 << 20
+	ino2 := NewInode(0, 0)
+	ino2.UnmarshalKey(ino.MarshalKey())
+	if err := ino2.UnmarshalValue(ino.MarshalValue()); err != nil {
+		t.Fatal(err)
+	}
+	if ino2.Reserved != ino.Reserved || ino2.UnwrittenReserved() != 1<<20 {
+		t.Fatalf("unexpected reserved(%v) unwritten(%v)", ino2.Reserved, ino2.UnwrittenReserved())
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// the time to wait for the checksum of a file before asking the client to try again
+	FileChecksumWaitTime = 3 * time.Second
+	// the max size of the range of an extent hashed by a data node in a request
+	FileChecksumHashSize = 16 * MB
+)
+
+var (
+	ErrFileChanged = errors.New("file changed while computing the checksum")
+
+	zeroBlock = make([]byte, 64*KB)
+)
+
+type fileChecksumTask struct {
+	generation uint64
+	done       chan struct{}
+	checksum   string
+	err        error
+}
+
+// fileChecksumTable tracks the checksums being computed, so that the requests for the same file share one computation.
+type fileChecksumTable struct {
+	sync.Mutex
+	tasks map[uint64]*fileChecksumTask
+}
+
+func newFileChecksumTable() *fileChecksumTable {
+	return &fileChecksumTable{tasks: make(map[uint64]*fileChecksumTask)}
+}
+
+// start returns the task computing the checksum of the inode at the generation, and starts one if there is none.
+func (t *fileChecksumTable) start(ino, gen uint64, compute func() (string, error)) *fileChecksumTask {
+	t.Lock()
+	defer t.Unlock()
+	if task, ok := t.tasks[ino]; ok && task.generation == gen {
+		return task
+	}
+	task := &fileChecksumTask{generation: gen, done: make(chan struct{})}
+	t.tasks[ino] = task
+	go func() {
+		task.checksum, task.err = compute()
+		t.Lock()
+		if t.tasks[ino] == task {
+			delete(t.tasks, ino)
+		}
+		t.Unlock()
+		close(task.done)
+	}()
+	return task
+}
+
+// extentHasher resumes the hash state with the range of the extent.
+type extentHasher func(ek *proto.ExtentKey, offset uint64, size uint32, state []byte) ([]byte, error)
+
+// hashFileExtents writes the file of the extents and the size to the hash. The extents are hashed by the hasher
+// through the marshaled states of the hash, and the holes of the file are hashed as zeros.
+func hashFileExtents(h hash.Hash, eks []proto.ExtentKey, size uint64, hasher extentHasher) (err error) {
+	var pos uint64
+	for i := range eks {
+		ek := &eks[i]
+		if ek.FileOffset >= size {
+			break
+		}
+		if ek.FileOffset < pos {
+			return fmt.Errorf("extent %v overlaps the file offset %v", ek, pos)
+		}
+		writeZeros(h, ek.FileOffset-pos)
+		length := uint64(ek.Size)
+		if ek.FileOffset+length > size {
+			length = size - ek.FileOffset
+		}
+		for done := uint64(0); done < length; {
+			n := length - done
+			if n > FileChecksumHashSize {
+				n = FileChecksumHashSize
+			}
+			var state []byte
+			if state, err = h.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+				return
+			}
+			if state, err = hasher(ek, ek.ExtentOffset+done, uint32(n), state); err != nil {
+				return
+			}
+			if err = h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+				return
+			}
+			done += n
+		}
+		pos = ek.FileOffset + length
+	}
+	if size > pos {
+		writeZeros(h, size-pos)
+	}
+	return
+}
+
+func writeZeros(h hash.Hash, n uint64) {
+	for n > 0 {
+		size := n
+		if size > uint64(len(zeroBlock)) {
+			size = uint64(len(zeroBlock))
+		}
+		h.Write(zeroBlock[:size])
+		n -= size
+	}
+}
+
+// hashExtent asks the data nodes of the extent to resume the hash state with the range of the extent, starting
+// from the first host which is usually the leader.
+func (mp *metaPartition) hashExtent(ek *proto.ExtentKey, offset uint64, size uint32, state []byte) (result []byte, err error) {
+	dp := mp.vol.GetPartition(ek.PartitionId)
+	if dp == nil {
+		err = errors.NewErrorf("unknown dataPartitionID=%d in vol", ek.PartitionId)
+		return
+	}
+	req := &proto.ExtentHashRequest{
+		Algorithm: proto.ChecksumAlgorithmSHA256,
+		Offset:    offset,
+		Size:      size,
+		State:     state,
+	}
+	for _, host := range dp.Hosts {
+		if result, err = mp.hashExtentOnHost(host, dp, ek, req); err == nil {
+			return
+		}
+		log.LogWarnf("[hashExtent] partitionId=%d, extent %v on %v: %v", mp.config.PartitionId, ek, host, err)
+	}
+	return
+}
+
+func (mp *metaPartition) hashExtentOnHost(host string, dp *DataPartition, ek *proto.ExtentKey, req *proto.ExtentHashRequest) (state []byte, err error) {
+	conn, err := mp.config.ConnPool.GetConnect(host)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			mp.config.ConnPool.PutConnect(conn, ForceClosedConnect)
+		} else {
+			mp.config.ConnPool.PutConnect(conn, NoClosedConnect)
+		}
+	}()
+	p := NewPacketToHashExtent(dp, ek, req)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = errors.NewErrorf("%s response: %s", p.GetUniqueLogId(), p.GetResultMsg())
+		return
+	}
+	state = p.Data[:p.Size]
+	return
+}
+
+// inodeExtents returns the generation, the size and the extents of the alive inode.
+func (mp *metaPartition) inodeExtents(ino uint64) (gen, size uint64, eks []proto.ExtentKey, ok bool) {
+	item := mp.inodeTree.Get(NewInode(ino, 0))
+	if item == nil {
+		return
+	}
+	inode := item.(*Inode)
+	if inode.ShouldDelete() {
+		return
+	}
+	inode.DoReadFunc(func() {
+		gen, size = inode.Generation, inode.Size
+		inode.Extents.Range(func(ek proto.ExtentKey) bool {
+			eks = append(eks, ek)
+			return true
+		})
+	})
+	return gen, size, eks, true
+}
+
+// computeFileChecksum computes the checksum of the inode at the generation, and stores it in the xattr.
+func (mp *metaPartition) computeFileChecksum(ino, gen uint64) (checksum string, err error) {
+	curGen, size, eks, ok := mp.inodeExtents(ino)
+	if !ok {
+		return "", fmt.Errorf("inode %v not exists", ino)
+	}
+	if curGen != gen {
+		return "", ErrFileChanged
+	}
+	start := time.Now()
+	h := sha256.New()
+	if err = hashFileExtents(h, eks, size, mp.hashExtent); err != nil {
+		return
+	}
+	checksum = hex.EncodeToString(h.Sum(nil))
+	if curGen, _, _, ok = mp.inodeExtents(ino); !ok || curGen != gen {
+		return "", ErrFileChanged
+	}
+	extend := NewExtend(ino)
+	extend.Put([]byte(proto.XAttrKeyChecksumSHA256), []byte(fmt.Sprintf("%d:%s", gen, checksum)))
+	if _, err = mp.putExtend(opFSMSetXAttr, extend); err != nil {
+		return
+	}
+	log.LogInfof("[computeFileChecksum] partitionId=%d, inode %v generation %v size %v checksum %v cost %v",
+		mp.config.PartitionId, ino, gen, size, checksum, time.Since(start))
+	return
+}
+
+// parseFileChecksum parses the value of the checksum xattr into the generation and the checksum.
+func parseFileChecksum(value string) (gen uint64, checksum string, ok bool) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return
+	}
+	gen, err := strconv.ParseUint(parts[0], 10, 64)
+	return gen, parts[1], err == nil
+}
+
+// validFileChecksum returns the checksum in the xattr value if it is not stale.
+func (mp *metaPartition) validFileChecksum(ino uint64, value string) (checksum string, gen uint64, ok bool) {
+	if gen, checksum, ok = parseFileChecksum(value); !ok {
+		return
+	}
+	if curGen, _, _, alive := mp.inodeExtents(ino); !alive || curGen != gen {
+		return "", 0, false
+	}
+	return
+}
+
+// storedFileChecksum returns the checksum of the inode stored in the xattr if it is not stale.
+func (mp *metaPartition) storedFileChecksum(ino uint64) (checksum string, gen uint64, ok bool) {
+	treeItem := mp.extendTree.Get(NewExtend(ino))
+	if treeItem == nil {
+		return
+	}
+	value, exist := treeItem.(*Extend).Get([]byte(proto.XAttrKeyChecksumSHA256))
+	if !exist {
+		return
+	}
+	return mp.validFileChecksum(ino, string(value))
+}
+
+// FileChecksum replies the checksum of the file, which is computed with the data nodes if it is absent or stale.
+// The client is asked to try again if the computation takes longer than FileChecksumWaitTime.
+func (mp *metaPartition) FileChecksum(req *proto.FileChecksumRequest, p *Packet) (err error) {
+	item := mp.inodeTree.Get(NewInode(req.Inode, 0))
+	if item == nil || item.(*Inode).ShouldDelete() {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		return
+	}
+	if !proto.IsRegular(item.(*Inode).Type) {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte("not a regular file"))
+		return
+	}
+	resp := &proto.FileChecksumResponse{
+		Inode:     req.Inode,
+		Algorithm: proto.ChecksumAlgorithmSHA256,
+	}
+	var ok bool
+	if resp.Checksum, resp.Generation, ok = mp.storedFileChecksum(req.Inode); !ok {
+		gen, _, _, _ := mp.inodeExtents(req.Inode)
+		task := mp.fileChecksums.start(req.Inode, gen, func() (string, error) {
+			return mp.computeFileChecksum(req.Inode, gen)
+		})
+		select {
+		case <-task.done:
+		case <-time.After(FileChecksumWaitTime):
+			p.PacketErrorWithBody(proto.OpAgain, []byte("computing the checksum"))
+			return
+		}
+		if task.err != nil {
+			p.PacketErrorWithBody(proto.OpErr, []byte(task.err.Error()))
+			return
+		}
+		resp.Checksum, resp.Generation = task.checksum, gen
+	}
+	var encoded []byte
+	if encoded, err = json.Marshal(resp); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(encoded)
+	return
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestHashFileExtents(t *testing.T) {
+	const size = 3*FileChecksumHashSize + 100
+	extent := make([]byte, 2*FileChecksumHashSize+10)
+	rand.New(rand.NewSource(1)).Read(extent)
+	// the file has a hole at the beginning, two extents of the same extent with a hole between them, and a hole
+	// at the end
+	eks := []proto.ExtentKey{
+		{FileOffset: 10, ExtentId: 1, ExtentOffset: 0, Size: 100},
+		{FileOffset: 200, ExtentId: 1, ExtentOffset: 100, Size: uint32(len(extent) - 100)},
+	}
+	file := make([]byte, size)
+	for _, ek := range eks {
+		copy(file[ek.FileOffset:], extent[ek.ExtentOffset:ek.ExtentOffset+uint64(ek.Size)])
+	}
+
+	var requests int
+	hasher := func(ek *proto.ExtentKey, offset uint64, size uint32, state []byte) ([]byte, error) {
+		if size > FileChecksumHashSize {
+			return nil, fmt.Errorf("range size %v exceeds %v", size, FileChecksumHashSize)
+		}
+		requests++
+		h := sha256.New()
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			return nil, err
+		}
+		h.Write(extent[offset : offset+uint64(size)])
+		return h.(encoding.BinaryMarshaler).MarshalBinary()
+	}
+	h := sha256.New()
+	if err := hashFileExtents(h, eks, size, hasher); err != nil {
+		t.Fatal(err)
+	}
+	expect := sha256.Sum256(file)
+	if !bytes.Equal(h.Sum(nil), expect[:]) {
+		t.Fatalf("checksum mismatch")
+	}
+	if requests != 3 {
+		t.Fatalf("expect 3 requests to hash the extents, but got %v", requests)
+	}
+
+	// the extents beyond the size are not hashed
+	h.Reset()
+	if err := hashFileExtents(h, eks, 50, hasher); err != nil {
+		t.Fatal(err)
+	}
+	if expect = sha256.Sum256(file[:50]); !bytes.Equal(h.Sum(nil), expect[:]) {
+		t.Fatalf("checksum of the truncated file mismatch")
+	}
+}
+
+func TestFileChecksumTable(t *testing.T) {
+	table := newFileChecksumTable()
+	release := make(chan struct{})
+	var computes int
+	compute := func() (string, error) {
+		computes++
+		<-release
+		return "abc", nil
+	}
+	task := table.start(1, 1, compute)
+	if table.start(1, 1, compute) != task {
+		t.Fatalf("the requests of the same generation should share the task")
+	}
+	close(release)
+	select {
+	case <-task.done:
+	case <-time.After(time.Second):
+		t.Fatalf("task is not done")
+	}
+	if task.checksum != "abc" || computes != 1 {
+		t.Fatalf("unexpected task checksum %v computes %v", task.checksum, computes)
+	}
+	if table.start(1, 2, compute) == task {
+		t.Fatalf("a new generation should start a new task")
+	}
+}
+
+func TestStoredFileChecksum(t *testing.T) {
+	mp := &metaPartition{inodeTree: NewBtree(), extendTree: NewBtree(), fileChecksums: newFileChecksumTable()}
+	inode := NewInode(10, proto.Mode(0644))
+	mp.inodeTree.ReplaceOrInsert(inode, true)
+	checksum := hex.EncodeToString(make([]byte, sha256.Size))
+	extend := NewExtend(10)
+	extend.Put([]byte(proto.XAttrKeyChecksumSHA256), []byte(fmt.Sprintf("%d:%s", inode.Generation, checksum)))
+	mp.extendTree.ReplaceOrInsert(extend, true)
+
+	p := &Packet{}
+	if err := mp.FileChecksum(&proto.FileChecksumRequest{Inode: 10}, p); err != nil || p.ResultCode != proto.OpOk {
+		t.Fatalf("file checksum: err %v result %v", err, p.GetResultMsg())
+	}
+	resp := &proto.FileChecksumResponse{}
+	if err := json.Unmarshal(p.Data, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Checksum != checksum || resp.Generation != inode.Generation {
+		t.Fatalf("unexpected response %v", resp)
+	}
+
+	// the checksum is stale after the file is written
+	inode.AppendExtents([]proto.ExtentKey{{FileOffset: 0, PartitionId: 1, ExtentId: 1, Size: 10}}, 0, 0)
+	if _, _, ok := mp.storedFileChecksum(10); ok {
+		t.Fatalf("checksum should be stale")
+	}
+	p = &Packet{}
+	if err := mp.GetXAttr(&proto.GetXAttrRequest{Inode: 10, Key: proto.XAttrKeyChecksumSHA256}, p); err != nil {
+		t.Fatal(err)
+	}
+	getResp := &proto.GetXAttrResponse{}
+	if err := json.Unmarshal(p.Data, getResp); err != nil {
+		t.Fatal(err)
+	}
+	if getResp.Value != "" {
+		t.Fatalf("stale checksum should not be returned, but got %v", getResp.Value)
+	}
+
+	p = &Packet{}
+	mp.SetXAttr(&proto.SetXAttrRequest{Inode: 10, Key: proto.XAttrKeyChecksumSHA256, Value: "1:abc"}, p)
+	if p.ResultCode != proto.OpNotPerm {
+		t.Fatalf("checksum should not be set by clients, result %v", p.GetResultMsg())
+	}
+}
@@ -130,12 +130,14 @@ func (mp *metaPartition) deleteWorker() {
 
 		batchCount := DeleteBatchCount()
 		delayDeleteInos := make([]uint64, 0)
+		pendingSince := make(map[uint64]int64)
 		for idx = 0; idx < int(batchCount); idx++ {
 			// batch get free inoded from the freeList
-			ino := mp.freeList.Pop()
+			ino, since := mp.freeList.Pop()
 			if ino == 0 {
 				break
 			}
+			pendingSince[ino] = since
 
 			//check inode nlink == 0 and deletMarkFlag unset
 			if inode, ok := mp.inodeTree.CopyGet(&Inode{Inode: ino}).(*Inode); ok {
@@ -155,7 +157,7 @@ func (mp *metaPartition) deleteWorker() {
 		}
 
 		mp.persistDeletedInodes(buffSlice)
-		mp.deleteMarkedInodes(buffSlice)
+		mp.deleteMarkedInodes(buffSlice, pendingSince)
 		sleepCnt++
 	}
 }
@@ -207,8 +209,9 @@ func (mp *metaPartition) batchDeleteExtentsByPartition(partitionDeleteExtents ma
 	return
 }
 
-// Delete the marked inodes.
-func (mp *metaPartition) deleteMarkedInodes(inoSlice []uint64) {
+// Delete the marked inodes. The ones failed to be deleted are pushed to the free list again with the time they have
+// been pending since.
+func (mp *metaPartition) deleteMarkedInodes(inoSlice []uint64, pendingSince map[uint64]int64) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.LogErrorf(fmt.Sprintf("metaPartition(%v) deleteMarkedInodes panic (%v)", mp.config.PartitionId, r))
@@ -227,6 +230,10 @@ func (mp *metaPartition) deleteMarkedInodes(inoSlice []uint64) {
 		}
 		inode.Extents.Range(func(ek proto.ExtentKey) bool {
 			ext := &ek
+			// the deduplicated extents are deleted once the last inode referring to them is deleted
+			if mp.dedup.isIndexedExtent(ext) {
+				return true
+			}
 			_, ok := allDeleteExtents[ext.GetExtentKey()]
 			if !ok {
 				allDeleteExtents[ext.GetExtentKey()] = inode.Inode
@@ -256,12 +263,12 @@ func (mp *metaPartition) deleteMarkedInodes(inoSlice []uint64) {
 		if err == nil {
 			mp.internalDeleteInode(inode)
 		} else {
-			mp.freeList.Push(inode.Inode)
+			mp.freeList.PushSince(inode.Inode, pendingSince[inode.Inode])
 		}
 	}
 	log.LogInfof("metaPartition(%v) deleteInodeCnt(%v) inodeCnt(%v)", mp.config.PartitionId, len(shouldCommit), mp.inodeTree.Len())
 	for _,inode:=range shouldRePushToFreeList {
-		mp.freeList.Push(inode.Inode)
+		mp.freeList.PushSince(inode.Inode, pendingSince[inode.Inode])
 	}
 }
 
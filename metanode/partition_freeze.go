@@ -0,0 +1,80 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sync/atomic"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// mutationOps holds the operations refused by a frozen meta partition.
+var mutationOps = map[uint8]bool{
+	proto.OpMetaCreateInode:           true,
+	proto.OpMetaUnlinkInode:           true,
+	proto.OpMetaBatchUnlinkInode:      true,
+	proto.OpMetaLinkInode:             true,
+	proto.OpMetaEvictInode:            true,
+	proto.OpMetaBatchEvictInode:       true,
+	proto.OpMetaDeleteInode:           true,
+	proto.OpMetaBatchDeleteInode:      true,
+	proto.OpMetaSetattr:               true,
+	proto.OpMetaCreateDentry:          true,
+	proto.OpMetaDeleteDentry:          true,
+	proto.OpMetaBatchDeleteDentry:     true,
+	proto.OpMetaUpdateDentry:          true,
+	proto.OpMetaBatchRename:           true,
+	proto.OpMetaExtentsAdd:            true,
+	proto.OpMetaBatchExtentsAdd:       true,
+	proto.OpMetaExtentsDel:            true,
+	proto.OpMetaTruncate:              true,
+	proto.OpMetaFallocate:             true,
+	proto.OpMetaSetXAttr:              true,
+	proto.OpMetaRemoveXAttr:           true,
+	proto.OpMetaDedupRegister:         true,
+	proto.OpMetaDedupReference:        true,
+	proto.OpCreateMultipart:           true,
+	proto.OpAddMultipartPart:          true,
+	proto.OpRemoveMultipart:           true,
+	proto.OpLifecycleDeleteDentries:   true,
+	proto.OpLifecycleDeleteInodes:     true,
+	proto.OpLifecycleRemoveMultiparts: true,
+	proto.OpLifecycleSwapExtents:      true,
+}
+
+// IsFrozen returns whether the partition is frozen with its volume.
+func (mp *metaPartition) IsFrozen() bool {
+	return mp.config.Frozen
+}
+
+// SetFrozen freezes or thaws the partition, and persists the flag. Once the partition is frozen, the leader flushes
+// the state applied so far into a snapshot of every replica, and the applied index returned marks the state.
+func (mp *metaPartition) SetFrozen(isFrozen bool) (applyID uint64, err error) {
+	oldFlag := mp.config.Frozen
+	mp.config.Frozen = isFrozen
+	if err = mp.PersistMetadata(); err != nil {
+		mp.config.Frozen = oldFlag
+		return
+	}
+	log.LogWarnf("action[SetFrozen] partition(%v) isFrozen(%v)", mp.config.PartitionId, isFrozen)
+	if _, isLeader := mp.IsLeader(); isFrozen && isLeader {
+		if _, err = mp.submit(opFSMStoreTick, nil); err != nil {
+			log.LogErrorf("action[SetFrozen] partition(%v) flush: %v", mp.config.PartitionId, err)
+			return
+		}
+	}
+	return atomic.LoadUint64(&mp.applyID), nil
+}
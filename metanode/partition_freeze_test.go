@@ -0,0 +1,62 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestFrozenFlagReloaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metanode_freeze")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := &MetaPartitionConfig{
+		PartitionId: 1,
+		VolName:     "vol",
+		Start:       1,
+		End:         100,
+		Peers:       []proto.Peer{{ID: 1, Addr: "127.0.0.1:17210"}},
+		RootDir:     dir,
+	}
+	mp := &metaPartition{config: config}
+	if _, err = mp.SetFrozen(true); err != nil {
+		t.Fatalf("freeze: %v", err)
+	}
+
+	reloaded := &metaPartition{config: &MetaPartitionConfig{RootDir: dir}}
+	if err = reloaded.loadMetadata(); err != nil {
+		t.Fatalf("load metadata: %v", err)
+	}
+	if !reloaded.IsFrozen() {
+		t.Fatalf("the frozen partition is thawed by the restart")
+	}
+
+	if _, err = mp.SetFrozen(false); err != nil {
+		t.Fatalf("thaw: %v", err)
+	}
+	reloaded = &metaPartition{config: &MetaPartitionConfig{RootDir: dir}}
+	if err = reloaded.loadMetadata(); err != nil {
+		t.Fatalf("load metadata: %v", err)
+	}
+	if reloaded.IsFrozen() {
+		t.Fatalf("the thawed partition is frozen by the restart")
+	}
+}
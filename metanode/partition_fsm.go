@@ -40,11 +40,35 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 	defer func() {
 		if err == nil {
 			mp.uploadApplyID(index)
+			mp.applyStat.apply(time.Now())
 		}
 	}()
 	if err = msg.UnmarshalJson(command); err != nil {
 		return
 	}
+	if msg.ReqID != "" {
+		if m, ok := mp.retries.lookup(msg.ReqID, msg.Time); ok {
+			log.LogWarnf("action[Apply] partitionID(%v) replay the retried mutation: op(%v) reqID(%v) index(%v)",
+				mp.config.PartitionId, msg.Op, msg.ReqID, index)
+			var replayed interface{}
+			if replayed, err = m.response(); err != nil {
+				return
+			}
+			return &replayedMutation{resp: replayed, value: m.Value}, nil
+		}
+		defer func() {
+			if err != nil {
+				return
+			}
+			m, encodeErr := newJournaledMutation(msg.ReqID, msg.Time, msg.Op, resp, msg.V)
+			if encodeErr != nil {
+				log.LogErrorf("action[Apply] partitionID(%v) journal the mutation: op(%v) reqID(%v) err(%v)",
+					mp.config.PartitionId, msg.Op, msg.ReqID, encodeErr)
+				return
+			}
+			mp.retries.record(m)
+		}()
+	}
 
 	switch msg.Op {
 	case opFSMCreateInode:
@@ -74,6 +98,12 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 			return
 		}
 		resp = mp.fsmExtentsTruncate(ino)
+	case opFSMFallocate:
+		ino := NewInode(0, 0)
+		if err = ino.Unmarshal(msg.V); err != nil {
+			return
+		}
+		resp = mp.fsmFallocate(ino)
 	case opFSMCreateLinkInode:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
@@ -147,6 +177,7 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 			dentryTree:    dentryTree,
 			extendTree:    extendTree,
 			multipartTree: multipartTree,
+			retries:       mp.retries.entries(),
 		}
 		mp.storeChan <- msg
 	case opFSMInternalDeleteInode:
@@ -157,6 +188,8 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 		err = mp.delOldExtentFile(msg.V)
 	case opFSMInternalDelExtentCursor:
 		err = mp.setExtentDeleteFileCursor(msg.V)
+	case opFSMInternalRotateExtentFile:
+		mp.rotateExtentDeleteFile()
 	case opFSMSetXAttr:
 		var extend *Extend
 		if extend, err = NewExtendFromBytes(msg.V); err != nil {
@@ -181,6 +214,36 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 		var multipart *Multipart
 		multipart = MultipartFromBytes(msg.V)
 		resp = mp.fsmAppendMultipart(multipart)
+	case opFSMDedupRegister:
+		req := &proto.DedupRegisterRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmDedupRegister(req)
+	case opFSMDedupReference:
+		req := &DedupReferenceReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmDedupReference(req)
+	case opFSMBatchRename:
+		req := &proto.BatchRenameRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmBatchRename(req)
+	case opFSMRestoreInode:
+		dump := &InodeDump{}
+		if err = json.Unmarshal(msg.V, dump); err != nil {
+			return
+		}
+		resp = mp.fsmRestoreInode(dump)
+	case opFSMSwapExtents:
+		req := &proto.LifecycleSwapExtentsRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmSwapExtents(req)
 	case opFSMSyncCursor:
 		var cursor uint64
 		cursor = binary.BigEndian.Uint64(msg.V)
@@ -197,6 +260,7 @@ func (mp *metaPartition) ApplyMemberChange(confChange *raftproto.ConfChange, ind
 	defer func() {
 		if err == nil {
 			mp.uploadApplyID(index)
+			mp.applyStat.apply(time.Now())
 		}
 	}()
 	// change memory status
@@ -249,6 +313,7 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 		dentryTree    = NewBtree()
 		extendTree    = NewBtree()
 		multipartTree = NewBtree()
+		retries       []*journaledMutation
 	)
 	defer func() {
 		if err == io.EOF {
@@ -257,8 +322,13 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 			mp.dentryTree = dentryTree
 			mp.extendTree = extendTree
 			mp.multipartTree = multipartTree
+			mp.retries.reset(retries)
 			mp.config.Cursor = cursor
 			err = nil
+			mp.rebuildDedupIndex()
+			mp.rebuildDentryFoldIndex()
+			mp.rebuildTagIndex()
+			mp.rebuildReserved()
 			// store message
 			mp.storeChan <- &storeMsg{
 				command:       opFSMStoreTick,
@@ -267,6 +337,7 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 				dentryTree:    mp.dentryTree,
 				extendTree:    mp.extendTree,
 				multipartTree: mp.multipartTree,
+				retries:       retries,
 			}
 			mp.extReset <- struct{}{}
 			log.LogDebugf("ApplySnapshot: finish with EOF: partitionID(%v) applyID(%v)", mp.config.PartitionId, mp.applyID)
@@ -323,6 +394,12 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 			var multipart = MultipartFromBytes(snap.V)
 			multipartTree.ReplaceOrInsert(multipart, true)
 			log.LogDebugf("ApplySnapshot: create multipart: partitionID(%v) multipart(%v)", mp.config.PartitionId, multipart)
+		case opFSMRetryJournal:
+			if err = json.Unmarshal(snap.V, &retries); err != nil {
+				return
+			}
+			log.LogDebugf("ApplySnapshot: load retry journal: partitionID(%v) mutations(%v)",
+				mp.config.PartitionId, len(retries))
 		case opExtentFileSnapshot:
 			fileName := string(snap.K)
 			fileName = path.Join(mp.config.RootDir, fileName)
@@ -384,18 +461,34 @@ func (mp *metaPartition) HandleLeaderChange(leader uint64) {
 
 // Put puts the given key-value pair (operation key and operation request) into the raft store.
 func (mp *metaPartition) submit(op uint32, data []byte) (resp interface{}, err error) {
+	resp, _, err = mp.submitMutation(op, data, "")
+	return
+}
+
+// submitMutation submits the mutation with the request ID of the client, which is answered with the original result
+// if it is a retry of a mutation applied within the window. The value of the original mutation is returned as well
+// if it is replayed, nil otherwise.
+func (mp *metaPartition) submitMutation(op uint32, data []byte, reqID string) (resp interface{}, replayed []byte, err error) {
 	snap := NewMetaItem(0, nil, nil)
 	snap.Op = op
 	if data != nil {
 		snap.V = data
 	}
+	if reqID != "" {
+		snap.ReqID, snap.Time = reqID, time.Now().Unix()
+	}
 	cmd, err := snap.MarshalJson()
 	if err != nil {
 		return
 	}
 
 	// submit to the raft store
+	mp.applyStat.propose()
 	resp, err = mp.raftPartition.Submit(cmd)
+	mp.applyStat.proposed()
+	if r, ok := resp.(*replayedMutation); ok {
+		resp, replayed = r.resp, r.value
+	}
 	return
 }
 
@@ -18,11 +18,11 @@ import (
 	"encoding/json"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"encoding/binary"
 	"fmt"
-	"io/ioutil"
 	"path"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -143,20 +143,15 @@ func (mp *metaPartition) confRemoveNode(req *proto.RemoveMetaPartitionRaftMember
 
 func (mp *metaPartition) delOldExtentFile(buf []byte) (err error) {
 	fileName := string(buf)
-	infos, err := ioutil.ReadDir(mp.config.RootDir)
+	fileNames, err := mp.listExtentDeleteFiles()
 	if err != nil {
 		return
 	}
-	for _, f := range infos {
-		if f.IsDir() {
-			continue
-		}
-		if !strings.HasPrefix(f.Name(), prefixDelExtent) {
-			continue
-		}
-		if f.Name() <= fileName {
+	for _, name := range fileNames {
+		if !extentDeleteFileLess(fileName, name) {
+			atomic.AddInt64(&mp.extDelPending, -mp.extentDeleteFilePending(name))
 			// TODO Unhandled errors
-			os.Remove(path.Join(mp.config.RootDir, f.Name()))
+			os.Remove(path.Join(mp.config.RootDir, name))
 			continue
 		}
 		break
@@ -175,6 +170,7 @@ func (mp *metaPartition) setExtentDeleteFileCursor(buf []byte) (err error) {
 	if err != nil {
 		return
 	}
+	oldCursor, _, _ := mp.readExtentDeleteFile(fileName)
 	fp, err := os.OpenFile(path.Join(mp.config.RootDir, fileName), os.O_CREATE|os.O_RDWR,
 		0644)
 	if err != nil {
@@ -185,6 +181,8 @@ func (mp *metaPartition) setExtentDeleteFileCursor(buf []byte) (err error) {
 	if err = binary.Write(fp, binary.BigEndian, cursor); err != nil {
 		log.LogErrorf("[setExtentDeleteFileCursor] write file %s cursor"+
 			" failed: %s", fileName, err.Error())
+	} else {
+		mp.extentDeletesApplied(fileName, oldCursor, cursor)
 	}
 	// TODO Unhandled errors
 	fp.Close()
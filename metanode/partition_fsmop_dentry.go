@@ -53,6 +53,16 @@ func (mp *metaPartition) fsmCreateDentry(dentry *Dentry,
 			status = proto.OpArgMismatchErr
 			return
 		}
+		// the names of a case-insensitive volume are unique under the case folding, except that a dentry may be
+		// linked under another case of its name while it is renamed
+		if d := mp.foldedDentry(dentry, mp.dentryTree.Get); d != nil && d.Inode != dentry.Inode {
+			if proto.OsModeType(dentry.Type) != proto.OsModeType(d.Type) {
+				status = proto.OpArgMismatchErr
+				return
+			}
+			status = proto.OpExistErr
+			return
+		}
 	}
 	if item, ok := mp.dentryTree.ReplaceOrInsert(dentry, false); !ok {
 		//do not allow directories and files to overwrite each
@@ -73,6 +83,8 @@ func (mp *metaPartition) fsmCreateDentry(dentry *Dentry,
 			parIno.IncNLink()
 			parIno.SetMtime()
 		}
+		mp.addFoldedName(dentry)
+		mp.dentryWatch.notify(dentry.ParentId, dentry.Name)
 	}
 
 	return
@@ -81,6 +93,7 @@ func (mp *metaPartition) fsmCreateDentry(dentry *Dentry,
 // Query a dentry from the dentry tree with specified dentry info.
 func (mp *metaPartition) getDentry(dentry *Dentry) (*Dentry, uint8) {
 	status := proto.OpOk
+	dentry.Name = mp.resolveDentryName(dentry.ParentId, dentry.Name, mp.dentryTree.Get)
 	item := mp.dentryTree.Get(dentry)
 	if item == nil {
 		status = proto.OpNotExistErr
@@ -95,6 +108,7 @@ func (mp *metaPartition) fsmDeleteDentry(dentry *Dentry, checkInode bool) (
 	resp *DentryResponse) {
 	resp = NewDentryResponse()
 	resp.Status = proto.OpOk
+	dentry.Name = mp.resolveDentryName(dentry.ParentId, dentry.Name, mp.dentryTree.Get)
 
 	var item interface{}
 	if checkInode {
@@ -128,6 +142,8 @@ func (mp *metaPartition) fsmDeleteDentry(dentry *Dentry, checkInode bool) (
 			})
 	}
 	resp.Msg = item.(*Dentry)
+	mp.removeFoldedName(resp.Msg)
+	mp.dentryWatch.notify(dentry.ParentId, dentry.Name)
 	return
 }
 
@@ -144,6 +160,7 @@ func (mp *metaPartition) fsmUpdateDentry(dentry *Dentry) (
 	resp *DentryResponse) {
 	resp = NewDentryResponse()
 	resp.Status = proto.OpOk
+	dentry.Name = mp.resolveDentryName(dentry.ParentId, dentry.Name, mp.dentryTree.Get)
 	mp.dentryTree.CopyFind(dentry, func(item BtreeItem) {
 		if item == nil {
 			resp.Status = proto.OpNotExistErr
@@ -153,6 +170,9 @@ func (mp *metaPartition) fsmUpdateDentry(dentry *Dentry) (
 		d.Inode, dentry.Inode = dentry.Inode, d.Inode
 		resp.Msg = dentry
 	})
+	if resp.Status == proto.OpOk {
+		mp.dentryWatch.notify(dentry.ParentId, dentry.Name)
+	}
 	return
 }
 
@@ -160,22 +180,33 @@ func (mp *metaPartition) getDentryTree() *BTree {
 	return mp.dentryTree.GetTree()
 }
 
-func (mp *metaPartition) readDir(req *ReadDirReq) (resp *ReadDirResp) {
+// readDir reads the children after the marker of the request, at most the limit of them, and returns
+// ErrOpTimeout if the deadline of the packet is exceeded before the children are read.
+func (mp *metaPartition) readDir(req *ReadDirReq, p *Packet) (resp *ReadDirResp, err error) {
 	resp = &ReadDirResp{}
 	begDentry := &Dentry{
 		ParentId: req.ParentID,
+		Name:     req.Marker,
 	}
 	endDentry := &Dentry{
 		ParentId: req.ParentID + 1,
 	}
+	var visited int
 	mp.dentryTree.AscendRange(begDentry, endDentry, func(i BtreeItem) bool {
+		if visited++; visited%opTimeoutCheckInterval == 0 && p.canceled() {
+			err = ErrOpTimeout
+			return false
+		}
 		d := i.(*Dentry)
+		if req.Marker != "" && d.Name == req.Marker {
+			return true
+		}
 		resp.Children = append(resp.Children, proto.Dentry{
 			Inode: d.Inode,
 			Type:  d.Type,
 			Name:  d.Name,
 		})
-		return true
+		return req.Limit == 0 || uint64(len(resp.Children)) < req.Limit
 	})
 	return
 }
@@ -29,6 +29,7 @@ func (mp *metaPartition) fsmSetXAttr(extend *Extend) (err error) {
 		e = treeItem.(*Extend)
 	}
 	e.Merge(extend, true)
+	mp.tags.addExtend(extend)
 	return
 }
 
@@ -42,5 +43,6 @@ func (mp *metaPartition) fsmRemoveXAttr(extend *Extend) (err error) {
 		e.Remove(key)
 		return true
 	})
+	mp.tags.removeExtend(extend)
 	return
 }
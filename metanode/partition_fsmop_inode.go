@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -77,7 +78,7 @@ func (mp *metaPartition) getInode(ino *Inode) (resp *InodeResponse) {
 	 * FIXME: not protected by lock yet, since nothing is depending on atime.
 	 * Shall add inode lock in the future.
 	 */
-	i.AccessTime = Now.GetCurrentTime().Unix()
+	i.AccessTime, i.AccessTimeNsec = splitTime(Now.GetCurrentTime())
 	resp.Msg = i
 	return
 }
@@ -194,9 +195,18 @@ func (mp *metaPartition) internalDeleteBatch(val []byte) error {
 }
 
 func (mp *metaPartition) internalDeleteInode(ino *Inode) {
-	mp.inodeTree.Delete(ino)
+	inode, _ := mp.inodeTree.Delete(ino).(*Inode)
+	if inode != nil {
+		atomic.AddUint64(&mp.reserved, -inode.UnwrittenReserved())
+	}
 	mp.freeList.Remove(ino.Inode)
-	mp.extendTree.Delete(&Extend{inode: ino.Inode}) // Also delete extend attribute.
+	extend, _ := mp.extendTree.Delete(&Extend{inode: ino.Inode}).(*Extend) // Also delete extend attribute.
+	if extend != nil {
+		mp.tags.removeExtend(extend)
+	}
+	if delExtents := mp.dedup.removeInode(inode, extend); len(delExtents) > 0 {
+		mp.extDelCh <- delExtents
+	}
 	return
 }
 
@@ -213,12 +223,51 @@ func (mp *metaPartition) fsmAppendExtents(ino *Inode) (status uint8) {
 		return
 	}
 	eks := ino.Extents.CopyExtents()
-	delExtents := ino2.AppendExtents(eks, ino.ModifyTime)
+	reserved := ino2.UnwrittenReserved()
+	delExtents := mp.dedup.updateExtents(ino2, func() []proto.ExtentKey {
+		return ino2.AppendExtents(eks, ino.ModifyTime, ino.ModifyTimeNsec)
+	})
+	mp.updateReserved(reserved, ino2)
 	log.LogInfof("fsmAppendExtents inode(%v) exts(%v)", ino2.Inode, delExtents)
 	mp.extDelCh <- delExtents
 	return
 }
 
+// fsmSwapExtents replaces the extent keys of the file with the keys of the copies, see LifecycleSwapExtentsRequest.
+func (mp *metaPartition) fsmSwapExtents(req *proto.LifecycleSwapExtentsRequest) (resp *proto.LifecycleSwapExtentsResponse) {
+	resp = &proto.LifecycleSwapExtentsResponse{}
+	var ino *Inode
+	if item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0)); item != nil && len(req.OldExtents) > 0 {
+		ino = item.(*Inode)
+	}
+	if ino != nil && !ino.ShouldDelete() {
+		delExtents := mp.dedup.updateExtents(ino, func() []proto.ExtentKey {
+			if resp.Swapped = ino.SwapExtents(req.OldExtents, req.NewExtents); !resp.Swapped {
+				return nil
+			}
+			return movedExtents(req.OldExtents, req.NewExtents)
+		})
+		if resp.Swapped {
+			log.LogInfof("fsmSwapExtents inode(%v) exts(%v)", ino.Inode, delExtents)
+			mp.extDelCh <- delExtents
+			return
+		}
+	}
+	mp.extDelCh <- movedExtents(req.NewExtents, req.OldExtents)
+	return
+}
+
+// movedExtents returns the keys which refer to the other extents than the keys at the same index of the others.
+func movedExtents(eks, others []proto.ExtentKey) (moved []proto.ExtentKey) {
+	moved = make([]proto.ExtentKey, 0, len(eks))
+	for idx, ek := range eks {
+		if idx >= len(others) || ek.PartitionId != others[idx].PartitionId || ek.ExtentId != others[idx].ExtentId {
+			moved = append(moved, ek)
+		}
+	}
+	return
+}
+
 func (mp *metaPartition) fsmExtentsTruncate(ino *Inode) (resp *InodeResponse) {
 	resp = NewInodeResponse()
 
@@ -238,7 +287,11 @@ func (mp *metaPartition) fsmExtentsTruncate(ino *Inode) (resp *InodeResponse) {
 		return
 	}
 
-	delExtents := i.ExtentsTruncate(ino.Size, ino.ModifyTime)
+	reserved := i.UnwrittenReserved()
+	delExtents := mp.dedup.updateExtents(i, func() []proto.ExtentKey {
+		return i.ExtentsTruncate(ino.Size, ino.ModifyTime, ino.ModifyTimeNsec)
+	})
+	mp.updateReserved(reserved, i)
 
 	// now we should delete the extent
 	log.LogInfof("fsmExtentsTruncate inode(%v) exts(%v)", i.Inode, delExtents)
@@ -0,0 +1,234 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	snapshotHistoryDir = "history"
+	// the historical views not accessed within the expiration are released
+	historyViewExpiration = 10 * time.Minute
+	// the historical views loaded at the same time, each of which holds the whole tree of the partition in memory
+	maxHistoryViews = 2
+
+	defaultRetainSnapshotInterval = time.Hour
+)
+
+// SnapshotHistory defines a snapshot retained for the historical reads of the partition.
+type SnapshotHistory struct {
+	Name    string `json:"name"`
+	ApplyID uint64 `json:"applyID"`
+	Time    string `json:"time"`
+	unix    int64
+}
+
+func parseSnapshotHistory(name string) (history *SnapshotHistory, ok bool) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 2 {
+		return
+	}
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	applyID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return
+	}
+	return &SnapshotHistory{
+		Name:    name,
+		ApplyID: applyID,
+		Time:    time.Unix(unix, 0).Format(time.RFC3339),
+		unix:    unix,
+	}, true
+}
+
+// listSnapshotHistory returns the retained snapshots of the partition from the oldest to the newest.
+func (mp *metaPartition) listSnapshotHistory() (histories []*SnapshotHistory, err error) {
+	infos, err := ioutil.ReadDir(path.Join(mp.config.RootDir, snapshotHistoryDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if history, ok := parseSnapshotHistory(info.Name()); ok {
+			histories = append(histories, history)
+		}
+	}
+	sort.Slice(histories, func(i, j int) bool { return histories[i].unix < histories[j].unix })
+	return
+}
+
+// GetSnapshotHistory returns the retained snapshots of the partition.
+func (mp *metaPartition) GetSnapshotHistory() []*SnapshotHistory {
+	histories, err := mp.listSnapshotHistory()
+	if err != nil {
+		log.LogWarnf("[GetSnapshotHistory] partitionID(%v) list retained snapshots: %v", mp.config.PartitionId, err)
+	}
+	return histories
+}
+
+// retainSnapshot keeps the snapshot just stored by hard links, at most one within the retain interval, and prunes
+// the oldest ones beyond the retained count. The snapshot files are never modified in place, so the links stay
+// intact after the snapshot is replaced.
+func (mp *metaPartition) retainSnapshot(applyID uint64, now time.Time) (err error) {
+	if mp.manager == nil {
+		return
+	}
+	historyDir := path.Join(mp.config.RootDir, snapshotHistoryDir)
+	if mp.manager.retainSnapshots <= 0 {
+		return os.RemoveAll(historyDir)
+	}
+	histories, err := mp.listSnapshotHistory()
+	if err != nil {
+		return
+	}
+	if n := len(histories); n > 0 && now.Sub(time.Unix(histories[n-1].unix, 0)) < mp.manager.retainSnapshotInterval {
+		return
+	}
+
+	name := fmt.Sprintf("%d_%d", now.Unix(), applyID)
+	tmpDir := path.Join(historyDir, "."+name)
+	if err = os.MkdirAll(tmpDir, 0755); err != nil {
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshotPath := path.Join(mp.config.RootDir, snapshotDir)
+	infos, err := ioutil.ReadDir(snapshotPath)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if err = os.Link(path.Join(snapshotPath, info.Name()), path.Join(tmpDir, info.Name())); err != nil {
+			return
+		}
+	}
+	if err = os.Rename(tmpDir, path.Join(historyDir, name)); err != nil {
+		return
+	}
+	history, _ := parseSnapshotHistory(name)
+	histories = append(histories, history)
+	for len(histories) > mp.manager.retainSnapshots {
+		if err = os.RemoveAll(path.Join(historyDir, histories[0].Name)); err != nil {
+			return
+		}
+		histories = histories[1:]
+	}
+	log.LogInfof("[retainSnapshot] partitionID(%v) retained snapshot %v", mp.config.PartitionId, name)
+	return
+}
+
+type historyView struct {
+	mp         *metaPartition
+	lastAccess time.Time
+}
+
+// historyViews caches the historical views of the partition loaded from the retained snapshots.
+type historyViews struct {
+	sync.Mutex
+	views map[string]*historyView // key: the name of the retained snapshot
+}
+
+func newHistoryViews() *historyViews {
+	return &historyViews{views: make(map[string]*historyView)}
+}
+
+func (h *historyViews) expire(now time.Time) {
+	for name, view := range h.views {
+		if now.Sub(view.lastAccess) > historyViewExpiration {
+			delete(h.views, name)
+		}
+	}
+	for len(h.views) >= maxHistoryViews {
+		var oldest string
+		for name, view := range h.views {
+			if oldest == "" || view.lastAccess.Before(h.views[oldest].lastAccess) {
+				oldest = name
+			}
+		}
+		delete(h.views, oldest)
+	}
+}
+
+// loadHistoryView returns the read-only view of the partition as of the newest retained snapshot not later than
+// the time in unix seconds.
+func (mp *metaPartition) loadHistoryView(asOf int64) (view *metaPartition, err error) {
+	histories, err := mp.listSnapshotHistory()
+	if err != nil {
+		return
+	}
+	var history *SnapshotHistory
+	for _, h := range histories {
+		if h.unix <= asOf {
+			history = h
+		}
+	}
+	if history == nil {
+		err = fmt.Errorf("no snapshot retained as of %v", time.Unix(asOf, 0).Format(time.RFC3339))
+		return
+	}
+
+	now := time.Now()
+	mp.history.Lock()
+	defer mp.history.Unlock()
+	if cached, ok := mp.history.views[history.Name]; ok {
+		cached.lastAccess = now
+		return cached.mp, nil
+	}
+	mp.history.expire(now)
+	conf := *mp.config
+	conf.Peers = nil
+	view = NewMetaPartition(&conf, mp.manager).(*metaPartition)
+	if err = view.LoadSnapshot(path.Join(mp.config.RootDir, snapshotHistoryDir, history.Name)); err != nil {
+		return nil, err
+	}
+	mp.history.views[history.Name] = &historyView{mp: view, lastAccess: now}
+	log.LogInfof("[loadHistoryView] partitionID(%v) loaded the view as of %v from snapshot %v",
+		mp.config.PartitionId, time.Unix(asOf, 0).Format(time.RFC3339), history.Name)
+	return
+}
+
+// historyOf returns the partition itself if the request reads the current tree, otherwise the historical view of
+// the partition. The packet is replied with the error if no view is available.
+func (mp *metaPartition) historyOf(asOf int64, p *Packet) (view *metaPartition, ok bool) {
+	if asOf == 0 {
+		return mp, true
+	}
+	view, err := mp.loadHistoryView(asOf)
+	if err != nil {
+		log.LogWarnf("[historyOf] partitionID(%v) req(%v): %v", mp.config.PartitionId, p.GetReqID(), err)
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		return nil, false
+	}
+	return view, true
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestSnapshotHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manager := &metadataManager{retainSnapshots: 2, retainSnapshotInterval: time.Minute}
+	mp := NewMetaPartition(&MetaPartitionConfig{PartitionId: 1, Start: 1, End: 100, RootDir: dir}, manager).(*metaPartition)
+	store := func(applyID uint64, now time.Time) {
+		sm := &storeMsg{
+			applyIndex:    applyID,
+			inodeTree:     mp.inodeTree.GetTree(),
+			dentryTree:    mp.dentryTree.GetTree(),
+			extendTree:    mp.extendTree.GetTree(),
+			multipartTree: mp.multipartTree.GetTree(),
+		}
+		if err := mp.store(sm); err != nil {
+			t.Fatal(err)
+		}
+		if err := mp.retainSnapshot(applyID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lookup := func(asOf int64) (status uint8) {
+		p := &Packet{}
+		if err := mp.Lookup(&LookupReq{PartitionID: 1, ParentID: 1, Name: "a", AsOf: asOf}, p); err != nil {
+			t.Fatal(err)
+		}
+		return p.ResultCode
+	}
+
+	now := time.Now()
+	mp.fsmCreateInode(NewInode(1, proto.Mode(os.ModeDir|0755)))
+	mp.fsmCreateInode(NewInode(2, proto.Mode(0644)))
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2, Type: proto.Mode(0644)}, false)
+	store(10, now)
+	// the dentry is deleted after the snapshot is retained
+	mp.fsmDeleteDentry(&Dentry{ParentId: 1, Name: "a"}, false)
+	store(20, now.Add(30*time.Second))
+	if histories := mp.GetSnapshotHistory(); len(histories) != 1 || histories[0].ApplyID != 10 {
+		t.Fatalf("only the snapshot of apply 10 should be retained within the interval, but got %v", histories)
+	}
+
+	if status := lookup(0); status != proto.OpNotExistErr {
+		t.Fatalf("the current lookup should not find the deleted dentry, status %v", status)
+	}
+	if status := lookup(now.Unix()); status != proto.OpOk {
+		t.Fatalf("the historical lookup should find the deleted dentry, status %v", status)
+	}
+	if status := lookup(now.Unix() - 1); status != proto.OpNotExistErr {
+		t.Fatalf("the lookup before the retained snapshots should fail, status %v", status)
+	}
+	p := &Packet{}
+	if err = mp.ExtentsList(&proto.GetExtentsRequest{PartitionID: 1, Inode: 2, AsOf: now.Unix()}, p); err != nil || p.ResultCode != proto.OpOk {
+		t.Fatalf("the historical inode should be listed, status %v err %v", p.ResultCode, err)
+	}
+
+	store(30, now.Add(2*time.Minute))
+	store(40, now.Add(4*time.Minute))
+	histories := mp.GetSnapshotHistory()
+	if len(histories) != 2 || histories[0].ApplyID != 30 || histories[1].ApplyID != 40 {
+		t.Fatalf("the oldest snapshot should be pruned, but got %v", histories)
+	}
+	if status := lookup(now.Add(3 * time.Minute).Unix()); status != proto.OpNotExistErr {
+		t.Fatalf("the dentry is deleted as of the snapshot of apply 30, status %v", status)
+	}
+
+	manager.retainSnapshots = 0
+	store(50, now.Add(6*time.Minute))
+	if histories = mp.GetSnapshotHistory(); len(histories) != 0 {
+		t.Fatalf("the retained snapshots should be removed once disabled, but got %v", histories)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// MultipartDump is a multipart session with the parts uploaded to the dumped inode.
+type MultipartDump struct {
+	ID       string
+	Key      string
+	InitTime time.Time
+	Parts    []*Part
+}
+
+// InodeDump is the full state of an inode in the partition for the support cases. The extent keys are in Extents
+// instead of Inode. The dentries and the multipart sessions only cover the ones in the partition, since they may be
+// kept by the other partitions of the volume as well.
+type InodeDump struct {
+	PartitionID uint64
+	Inode       *Inode
+	Extents     []proto.ExtentKey
+	XAttrs      map[string][]byte
+	Dentries    []*Dentry        // the dentries referring to the inode
+	Multiparts  []*MultipartDump // the multipart sessions with the parts uploaded to the inode
+	Fingerprint uint32           // the checksum of the inode, its extent keys and its xattrs, 0 if the inode does not exist
+}
+
+// inodeFingerprint returns the checksum of the inode and its xattrs, 0 if the inode is nil.
+func inodeFingerprint(ino *Inode, xattrs map[string][]byte) (fingerprint uint32, err error) {
+	if ino == nil {
+		return
+	}
+	data, err := ino.Marshal()
+	if err != nil {
+		return
+	}
+	keys := make([]string, 0, len(xattrs))
+	for key := range xattrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, key := range keys {
+		data = append(data, lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(key)))]...)
+		data = append(data, key...)
+		data = append(data, lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(xattrs[key])))]...)
+		data = append(data, xattrs[key]...)
+	}
+	return crc32.ChecksumIEEE(data), nil
+}
+
+// getInodeState returns a copy of the inode and its xattrs, a nil inode if it does not exist.
+func (mp *metaPartition) getInodeState(inode uint64) (ino *Inode, xattrs map[string][]byte) {
+	xattrs = make(map[string][]byte)
+	if item := mp.inodeTree.Get(&Inode{Inode: inode}); item != nil {
+		ino = item.Copy().(*Inode)
+	}
+	if item := mp.extendTree.Get(NewExtend(inode)); item != nil {
+		item.(*Extend).Range(func(key, value []byte) bool {
+			xattrs[string(key)] = append([]byte(nil), value...)
+			return true
+		})
+	}
+	return
+}
+
+// DumpInode dumps the full state of the inode. The dentries and the multipart sessions are found by a scan of the
+// snapshot of the partition, which is not to be issued frequently.
+func (mp *metaPartition) DumpInode(inode uint64) (dump *InodeDump, err error) {
+	ino, xattrs := mp.getInodeState(inode)
+	if ino == nil {
+		return nil, fmt.Errorf("inode(%v) not found in partition(%v)", inode, mp.config.PartitionId)
+	}
+	dump = &InodeDump{
+		PartitionID: mp.config.PartitionId,
+		Inode:       ino,
+		Extents:     ino.Extents.CopyExtents(),
+		XAttrs:      xattrs,
+		Dentries:    make([]*Dentry, 0),
+		Multiparts:  make([]*MultipartDump, 0),
+	}
+	if dump.Fingerprint, err = inodeFingerprint(ino, xattrs); err != nil {
+		return nil, err
+	}
+	mp.dentryTree.GetTree().Ascend(func(i BtreeItem) bool {
+		if dentry := i.(*Dentry); dentry.Inode == inode {
+			dump.Dentries = append(dump.Dentries, dentry.Copy().(*Dentry))
+		}
+		return true
+	})
+	mp.multipartTree.GetTree().Ascend(func(i BtreeItem) bool {
+		multipart := i.(*Multipart)
+		var parts []*Part
+		for _, part := range multipart.Parts() {
+			if part.Inode == inode {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) > 0 {
+			dump.Multiparts = append(dump.Multiparts, &MultipartDump{ID: multipart.id, Key: multipart.key,
+				InitTime: multipart.initTime, Parts: parts})
+		}
+		return true
+	})
+	return
+}
+
+// RestoreInode replaces the inode and its xattrs with the ones of the dump under raft, or creates them if the inode
+// does not exist. The fingerprint of the dump must match the current state of the inode, so that a dump edited by
+// the support engineers does not override the changes made after it is taken. The dentries and the multipart
+// sessions of the dump are not restored, and the extents removed from the inode are not deleted from the data nodes.
+func (mp *metaPartition) RestoreInode(dump *InodeDump) (err error) {
+	if _, isLeader := mp.IsLeader(); !isLeader {
+		return ErrNotALeader
+	}
+	if mp.IsFrozen() {
+		return fmt.Errorf("partition(%v) is frozen", mp.config.PartitionId)
+	}
+	if err = mp.validateInodeDump(dump); err != nil {
+		return
+	}
+	val, err := json.Marshal(dump)
+	if err != nil {
+		return
+	}
+	resp, err := mp.submit(opFSMRestoreInode, val)
+	if err != nil {
+		return
+	}
+	if status := resp.(uint8); status != proto.OpOk {
+		return fmt.Errorf("restore inode(%v) of partition(%v): %v", dump.Inode.Inode, mp.config.PartitionId,
+			proto.ParseErrorCode(int32(status)))
+	}
+	log.LogWarnf("action[RestoreInode] partition(%v) inode(%v) fingerprint(%v) restored", mp.config.PartitionId,
+		dump.Inode.Inode, dump.Fingerprint)
+	return
+}
+
+func (mp *metaPartition) validateInodeDump(dump *InodeDump) (err error) {
+	if dump.Inode == nil {
+		return fmt.Errorf("no inode in the dump")
+	}
+	ino := dump.Inode.Inode
+	if ino < mp.config.Start || ino > mp.config.End {
+		return fmt.Errorf("inode(%v) is beyond the range [%v, %v] of partition(%v)", ino, mp.config.Start,
+			mp.config.End, mp.config.PartitionId)
+	}
+	// the marked inodes are freed by the delete worker regardless of the flag, they are not to be brought back
+	if dump.Inode.Flag&DeleteMarkFlag != 0 {
+		return fmt.Errorf("inode(%v) of the dump is marked deleted", ino)
+	}
+	var offset uint64
+	for _, ek := range dump.Extents {
+		if ek.FileOffset < offset {
+			return fmt.Errorf("extent key %v of inode(%v) overlaps the previous ones", ek, ino)
+		}
+		offset = ek.FileOffset + uint64(ek.Size)
+	}
+	return
+}
+
+func (mp *metaPartition) fsmRestoreInode(dump *InodeDump) (status uint8) {
+	ino := dump.Inode.Inode
+	current, xattrs := mp.getInodeState(ino)
+	fingerprint, err := inodeFingerprint(current, xattrs)
+	if err != nil || fingerprint != dump.Fingerprint {
+		log.LogWarnf("fsmRestoreInode: partition(%v) inode(%v) fingerprint(%v) mismatch(%v) err(%v)",
+			mp.config.PartitionId, ino, fingerprint, dump.Fingerprint, err)
+		return proto.OpArgMismatchErr
+	}
+	if current != nil && current.ShouldDelete() {
+		return proto.OpNotPerm
+	}
+	dump.Inode.Extents = NewSortedExtents()
+	restored := dump.Inode.Copy().(*Inode)
+	restored.Extents.eks = append(restored.Extents.eks, dump.Extents...)
+	var reserved uint64
+	if current != nil {
+		reserved = current.UnwrittenReserved()
+	}
+	mp.inodeTree.ReplaceOrInsert(restored, true)
+	mp.updateReserved(reserved, restored)
+	if mp.config.Cursor < ino {
+		mp.config.Cursor = ino
+	}
+	if old, _ := mp.extendTree.Delete(NewExtend(ino)).(*Extend); old != nil {
+		mp.tags.removeExtend(old)
+	}
+	if len(dump.XAttrs) > 0 {
+		extend := NewExtend(ino)
+		for key, value := range dump.XAttrs {
+			extend.Put([]byte(key), value)
+		}
+		mp.extendTree.ReplaceOrInsert(extend, true)
+		mp.tags.addExtend(extend)
+	}
+	return proto.OpOk
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestDumpAndRestoreInode(t *testing.T) {
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1, Start: 1, End: 100}, dentryTree: NewBtree(),
+		inodeTree: NewBtree(), extendTree: NewBtree(), multipartTree: NewBtree(), retries: newRetryJournal()}
+	ino := NewInode(10, proto.Mode(0644))
+	ino.Extents.Append(proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1, Size: 100})
+	mp.inodeTree.ReplaceOrInsert(ino, true)
+	mp.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 1, Name: "f", Inode: 10, Type: proto.Mode(0644)}, true)
+	extend := NewExtend(10)
+	extend.Put([]byte("user.k"), []byte("v"))
+	mp.extendTree.ReplaceOrInsert(extend, true)
+
+	dump, err := mp.DumpInode(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Extents) != 1 || len(dump.Dentries) != 1 || string(dump.XAttrs["user.k"]) != "v" || dump.Fingerprint == 0 {
+		t.Fatalf("incomplete dump %+v", dump)
+	}
+	restore := func(dump *InodeDump) interface{} {
+		value, err := json.Marshal(dump)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd, err := (&MetaItem{Op: opFSMRestoreInode, V: value}).MarshalJson()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mp.Apply(cmd, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	dump.Inode.Size = 50
+	dump.Extents[0].Size = 50
+	dump.XAttrs = map[string][]byte{"user.k2": []byte("v2")}
+	if resp := restore(dump); resp != proto.OpOk {
+		t.Fatalf("restore status %v", resp)
+	}
+	restored, xattrs := mp.getInodeState(10)
+	if restored.Size != 50 || restored.Extents.Size() != 50 || len(xattrs) != 1 || string(xattrs["user.k2"]) != "v2" {
+		t.Fatalf("inode is not restored, %v xattrs %v", restored, xattrs)
+	}
+	// the dump taken before the restore is stale
+	if resp := restore(dump); resp != proto.OpArgMismatchErr {
+		t.Fatalf("stale dump is restored, status %v", resp)
+	}
+	dump.Inode.Inode, dump.Fingerprint = 20, 0
+	if resp := restore(dump); resp != proto.OpOk {
+		t.Fatalf("restore missing inode status %v", resp)
+	}
+	if restored, _ = mp.getInodeState(20); restored == nil || mp.config.Cursor != 20 {
+		t.Fatalf("missing inode is not restored, cursor %v", mp.config.Cursor)
+	}
+	dump.Inode.Flag = DeleteMarkFlag
+	if err = mp.validateInodeDump(dump); err == nil {
+		t.Fatalf("marked inode is accepted")
+	}
+}
@@ -33,6 +33,11 @@ type MetaItem struct {
 	Op uint32 `json:"op"`
 	K  []byte `json:"k"`
 	V  []byte `json:"v"`
+
+	// The request ID of the client to recognize the retried mutation, and the unix seconds when it is proposed.
+	// Both are carried by the raft commands only.
+	ReqID string `json:"rid,omitempty"`
+	Time  int64  `json:"t,omitempty"`
 }
 
 // MarshalJson
@@ -129,6 +134,7 @@ type MetaItemIterator struct {
 	dentryTree    *BTree
 	extendTree    *BTree
 	multipartTree *BTree
+	retries       []*journaledMutation
 
 	filenames []string
 
@@ -148,6 +154,7 @@ func newMetaItemIterator(mp *metaPartition) (si *MetaItemIterator, err error) {
 	si.dentryTree = mp.dentryTree.GetTree()
 	si.extendTree = mp.extendTree.GetTree()
 	si.multipartTree = mp.multipartTree.GetTree()
+	si.retries = mp.retries.entries()
 	si.dataCh = make(chan interface{})
 	si.errorCh = make(chan error, 1)
 	si.closeCh = make(chan struct{})
@@ -228,6 +235,10 @@ func newMetaItemIterator(mp *metaPartition) (si *MetaItemIterator, err error) {
 		if checkClose() {
 			return
 		}
+		// process the retry journal
+		if !produceItem(iter.retries) {
+			return
+		}
 		// process extent del files
 		var err error
 		var raw []byte
@@ -309,6 +320,14 @@ func (si *MetaItemIterator) Next() (data []byte, err error) {
 			return
 		}
 		snap = NewMetaItem(opFSMCreateMultipart, nil, raw)
+	case []*journaledMutation:
+		var raw []byte
+		if raw, err = json.Marshal(typedItem); err != nil {
+			si.err = err
+			si.Close()
+			return
+		}
+		snap = NewMetaItem(opFSMRetryJournal, nil, raw)
 	case *fileData:
 		snap = NewMetaItem(opExtentFileSnapshot, []byte(typedItem.filename), typedItem.data)
 	default:
@@ -0,0 +1,207 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	MultipartGCInterval  = 30 * time.Minute
+	MultipartGCBatchSize = 100
+)
+
+// startMultipartGC starts the scanner which expires the multipart uploads abandoned for longer than the multipart TTL
+// of the volume, which is configured on the master.
+func (mp *metaPartition) startMultipartGC() {
+	go func() {
+		t := time.NewTicker(MultipartGCInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-mp.stopC:
+				return
+			case <-t.C:
+			}
+			if _, isLeader := mp.IsLeader(); !isLeader {
+				continue
+			}
+			if err := mp.expireMultiparts(); err != nil {
+				log.LogWarnf("[multipartGC] partition(%v) volume(%v) err(%v)", mp.config.PartitionId, mp.config.VolName, err)
+			}
+		}
+	}()
+}
+
+// GetMultipartGCStat returns the statistics of the expired multipart uploads since the partition started.
+func (mp *metaPartition) GetMultipartGCStat() *proto.MultipartGCStat {
+	mp.multipartGCLock.RLock()
+	defer mp.multipartGCLock.RUnlock()
+	stat := mp.multipartGCStat
+	return &stat
+}
+
+func (mp *metaPartition) updateMultipartGCStat(fn func(stat *proto.MultipartGCStat)) {
+	mp.multipartGCLock.Lock()
+	fn(&mp.multipartGCStat)
+	mp.multipartGCLock.Unlock()
+}
+
+// expiredMultiparts returns the multipart uploads initiated before the time.
+func (mp *metaPartition) expiredMultiparts(initBefore time.Time) (multiparts []*Multipart) {
+	multiparts = make([]*Multipart, 0)
+	mp.multipartTree.Ascend(func(i BtreeItem) bool {
+		multipart := i.(*Multipart)
+		if multipart.initTime.Before(initBefore) {
+			multiparts = append(multiparts, multipart)
+		}
+		return true
+	})
+	return
+}
+
+func (mp *metaPartition) expireMultiparts() (err error) {
+	defer func() {
+		mp.updateMultipartGCStat(func(stat *proto.MultipartGCStat) {
+			stat.LastRunTime = time.Now().Unix()
+			stat.LastErr = ""
+			if err != nil {
+				stat.LastErr = err.Error()
+			}
+		})
+	}()
+	view, err := masterClient.AdminAPI().GetVolumeSimpleInfo(mp.config.VolName)
+	if err != nil {
+		return
+	}
+	if view.MultipartTTL <= 0 {
+		return
+	}
+	multiparts := mp.expiredMultiparts(time.Now().Add(-time.Duration(view.MultipartTTL) * time.Hour))
+	if len(multiparts) == 0 {
+		return
+	}
+	mpViews, err := masterClient.ClientAPI().GetMetaPartitions(mp.config.VolName)
+	if err != nil {
+		return
+	}
+	for start := 0; start < len(multiparts); start += MultipartGCBatchSize {
+		end := start + MultipartGCBatchSize
+		if end > len(multiparts) {
+			end = len(multiparts)
+		}
+		if err = mp.removeMultiparts(multiparts[start:end], mpViews); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// removeMultiparts deletes the part inodes before removing the multipart uploads, like aborting them by the object
+// node. The extents of the parts are released once the inodes are evicted.
+func (mp *metaPartition) removeMultiparts(multiparts []*Multipart, mpViews []*proto.MetaPartitionView) (err error) {
+	var (
+		parts  uint64
+		bytes  uint64
+		groups = make(map[*proto.MetaPartitionView][]uint64)
+	)
+	for _, multipart := range multiparts {
+		for _, part := range multipart.Parts() {
+			view := metaPartitionViewByInode(mpViews, part.Inode)
+			if view == nil {
+				return fmt.Errorf("no meta partition for the part inode(%v) of multipart(%v)", part.Inode, multipart.id)
+			}
+			groups[view] = append(groups[view], part.Inode)
+			parts++
+			bytes += part.Size
+		}
+	}
+	for view, inodes := range groups {
+		req := &proto.LifecycleDeleteInodesRequest{PartitionID: view.PartitionID, Inodes: inodes}
+		if err = mp.sendLifecycleTask(view, proto.OpLifecycleDeleteInodes, req); err != nil {
+			return
+		}
+	}
+	for _, multipart := range multiparts {
+		var resp interface{}
+		if resp, err = mp.putMultipart(opFSMRemoveMultipart, &Multipart{id: multipart.id, key: multipart.key}); err != nil {
+			return
+		}
+		if status := resp.(uint8); status != proto.OpOk && status != proto.OpNotExistErr {
+			return fmt.Errorf("remove multipart(%v) key(%v) status(%v)", multipart.id, multipart.key, status)
+		}
+	}
+	mp.updateMultipartGCStat(func(stat *proto.MultipartGCStat) {
+		stat.ExpiredUploads += uint64(len(multiparts))
+		stat.DeletedParts += parts
+		stat.ReclaimedBytes += bytes
+	})
+	log.LogInfof("[multipartGC] partition(%v) volume(%v) expired uploads(%v) parts(%v) bytes(%v)",
+		mp.config.PartitionId, mp.config.VolName, len(multiparts), parts, bytes)
+	return
+}
+
+func metaPartitionViewByInode(views []*proto.MetaPartitionView, ino uint64) *proto.MetaPartitionView {
+	for _, view := range views {
+		if ino >= view.Start && ino <= view.End {
+			return view
+		}
+	}
+	return nil
+}
+
+// sendLifecycleTask sends the lifecycle request to a replica of the meta partition, which proxies it to the leader.
+func (mp *metaPartition) sendLifecycleTask(view *proto.MetaPartitionView, opCode uint8, req interface{}) (err error) {
+	addr := view.LeaderAddr
+	if addr == "" {
+		if len(view.Members) == 0 {
+			return fmt.Errorf("meta partition(%v) has no members", view.PartitionID)
+		}
+		addr = view.Members[0]
+	}
+	task := proto.NewAdminTask(opCode, addr, req)
+	body, err := json.Marshal(task)
+	if err != nil {
+		return
+	}
+	p := proto.NewPacket()
+	p.Opcode = opCode
+	p.ReqID = proto.GenerateRequestID()
+	p.PartitionID = view.PartitionID
+	p.Size = uint32(len(body))
+	p.Data = body
+	conn, err := mp.manager.connPool.GetConnect(addr)
+	if err != nil {
+		return
+	}
+	if err = p.WriteToConn(conn); err != nil {
+		mp.manager.connPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.SyncSendTaskDeadlineTime); err != nil {
+		mp.manager.connPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	mp.manager.connPool.PutConnect(conn, NoClosedConnect)
+	if p.ResultCode != proto.OpOk {
+		err = fmt.Errorf("meta partition(%v) addr(%v) result(%v) msg(%v)", view.PartitionID, addr, p.GetResultMsg(), string(p.Data))
+	}
+	return
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestExpiredMultiparts(t *testing.T) {
+	mp := &metaPartition{multipartTree: NewBtree()}
+	now := time.Now()
+	mp.multipartTree.ReplaceOrInsert(&Multipart{id: "1", key: "a", initTime: now.Add(-48 * time.Hour)}, true)
+	mp.multipartTree.ReplaceOrInsert(&Multipart{id: "2", key: "b", initTime: now}, true)
+	mp.multipartTree.ReplaceOrInsert(&Multipart{id: "3", key: "c", initTime: now.Add(-25 * time.Hour)}, true)
+
+	multiparts := mp.expiredMultiparts(now.Add(-24 * time.Hour))
+	if len(multiparts) != 2 || multiparts[0].id != "1" || multiparts[1].id != "3" {
+		t.Fatalf("unexpected expired multiparts %v", multiparts)
+	}
+}
+
+func TestMetaPartitionViewByInode(t *testing.T) {
+	views := []*proto.MetaPartitionView{
+		{PartitionID: 1, Start: 0, End: 100},
+		{PartitionID: 2, Start: 101, End: 200},
+	}
+	if view := metaPartitionViewByInode(views, 100); view == nil || view.PartitionID != 1 {
+		t.Fatalf("expect partition 1, but got %v", view)
+	}
+	if view := metaPartitionViewByInode(views, 101); view == nil || view.PartitionID != 2 {
+		t.Fatalf("expect partition 2, but got %v", view)
+	}
+	if view := metaPartitionViewByInode(views, 201); view != nil {
+		t.Fatalf("expect no partition, but got %v", view)
+	}
+}
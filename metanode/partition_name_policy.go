@@ -0,0 +1,84 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const namePolicyTTL = time.Minute
+
+// namePolicyEntry caches the naming policy of a volume configured on the master.
+type namePolicyEntry struct {
+	policy     proto.DentryNamePolicy
+	expires    time.Time
+	refreshing int32
+}
+
+// namePolicy returns the naming policy of the volume. The policy is fetched from the master on the first use, and
+// refreshed in the background once it expires, so that the creations are not blocked by the master afterwards. The
+// cached policy is kept if the master fails to be reached.
+func (m *metadataManager) namePolicy(vol string) *proto.DentryNamePolicy {
+	if val, ok := m.namePolicies.Load(vol); ok {
+		entry := val.(*namePolicyEntry)
+		if time.Now().After(entry.expires) && atomic.CompareAndSwapInt32(&entry.refreshing, 0, 1) {
+			go m.refreshNamePolicy(vol, &entry.policy)
+		}
+		return &entry.policy
+	}
+	return m.refreshNamePolicy(vol, nil)
+}
+
+func (m *metadataManager) refreshNamePolicy(vol string, cached *proto.DentryNamePolicy) *proto.DentryNamePolicy {
+	entry := &namePolicyEntry{expires: time.Now().Add(namePolicyTTL)}
+	if cached != nil {
+		entry.policy = *cached
+	}
+	if masterClient != nil {
+		view, err := masterClient.AdminAPI().GetVolumeSimpleInfo(vol)
+		if err != nil {
+			log.LogWarnfLimited("[refreshNamePolicy] volume(%v) keeps policy(%v) err(%v)", vol, entry.policy.String(), err)
+		} else {
+			entry.policy = view.NamePolicy
+		}
+	}
+	m.namePolicies.Store(vol, entry)
+	return &entry.policy
+}
+
+// checkDentryName checks the name of a dentry to be linked against the naming policy of the volume, and replies
+// OpNameTooLong or OpInvalidName if the name breaks it. The names are only logged by a relaxed policy, for migrating
+// the legacy data.
+func (mp *metaPartition) checkDentryName(name string, p *Packet) (ok bool) {
+	if mp.manager == nil {
+		return true
+	}
+	policy := mp.manager.namePolicy(mp.config.VolName)
+	code, err := policy.Check(name)
+	if err == nil {
+		return true
+	}
+	if policy.Relaxed {
+		log.LogWarnfLimited("[checkDentryName] partition(%v) req(%v) accepts name(%q) by the relaxed policy: %v",
+			mp.config.PartitionId, p.GetReqID(), name, err)
+		return true
+	}
+	p.PacketErrorWithBody(code, []byte(err.Error()))
+	return false
+}
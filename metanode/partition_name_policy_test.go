@@ -0,0 +1,67 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestCheckDentryName(t *testing.T) {
+	m := &metadataManager{}
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1, VolName: "vol"}, manager: m}
+	setPolicy := func(policy proto.DentryNamePolicy) {
+		m.namePolicies.Store("vol", &namePolicyEntry{policy: policy, expires: time.Now().Add(time.Hour)})
+	}
+	check := func(name string) uint8 {
+		p := &Packet{}
+		p.ResultCode = proto.OpOk
+		if !mp.checkDentryName(name, p) && p.ResultCode == proto.OpOk {
+			t.Fatalf("name(%q) is refused with OpOk", name)
+		}
+		return p.ResultCode
+	}
+
+	setPolicy(proto.DentryNamePolicy{})
+	if code := check("a\x01\xff" + strings.Repeat("x", 1024)); code != proto.OpOk {
+		t.Errorf("expect any name accepted by the zero policy, but is %v", proto.ResultCodeName(code))
+	}
+
+	setPolicy(proto.DentryNamePolicy{MaxLength: 8, ValidUTF8: true, NoControlChars: true})
+	cases := []struct {
+		name string
+		code uint8
+	}{
+		{"file.txt", proto.OpOk},
+		{"文件", proto.OpOk},
+		{"file.txt1", proto.OpNameTooLong},
+		{"a\xffb", proto.OpInvalidName},
+		{"a\nb", proto.OpInvalidName},
+		{"a\x7fb", proto.OpInvalidName},
+	}
+	for _, c := range cases {
+		if code := check(c.name); code != c.code {
+			t.Errorf("name(%q) expect %v, but is %v", c.name, proto.ResultCodeName(c.code), proto.ResultCodeName(code))
+		}
+	}
+
+	setPolicy(proto.DentryNamePolicy{MaxLength: 8, NoControlChars: true, Relaxed: true})
+	if code := check("legacy\nname"); code != proto.OpOk {
+		t.Errorf("expect the name accepted by the relaxed policy, but is %v", proto.ResultCodeName(code))
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/nsindex"
+)
+
+const (
+	nsExportDirPrefix = ".nsexport_"
+	nsExportS3Scheme  = "s3://"
+	// the times to link the snapshot if it is replaced during the linking
+	nsExportLinkRetries = 3
+)
+
+// NamespaceExportS3Config defines the object store the namespace is exported to, whose credentials are kept by
+// the meta nodes instead of being sent by the master.
+type NamespaceExportS3Config struct {
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// opNamespaceExport starts to export the namespace of the meta partition from its snapshot, and answers the master
+// once the export starts. The result is sent to the master once the export ends.
+func (m *metadataManager) opNamespaceExport(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.NamespaceExportRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	if req.ExportID == "" || path.Base(req.ExportID) != req.ExportID || path.Base(req.VolName) != req.VolName {
+		err = fmt.Errorf("bad export %v of volume %v", req.ExportID, req.VolName)
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		return
+	}
+	if len(req.Files) > 0 {
+		if err = m.putNamespaceExportManifest(req); err != nil {
+			p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		} else {
+			p.PacketOkReply()
+		}
+		m.respondToClient(conn, p)
+		log.LogInfof("%s [opNamespaceExport] volume[%v] export[%v] manifest of %v files, error[%v]",
+			remoteAddr, req.VolName, req.ExportID, len(req.Files), err)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, ([]byte)(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%v] req: %v, resp: %v", p.GetOpMsgWithReqAndResult(), req, err.Error())
+		return
+	}
+	p.PacketOkReply()
+	m.respondToClient(conn, p)
+	go func() {
+		m.nsExportMu.Lock()
+		resp, err := mp.ExportNamespace(req)
+		m.nsExportMu.Unlock()
+		if err != nil {
+			resp = &proto.NamespaceExportResponse{PartitionID: req.PartitionID, VolName: req.VolName,
+				ExportID: req.ExportID, Status: proto.TaskFailed, Result: err.Error()}
+		}
+		adminTask.Response = resp
+		adminTask.Request = nil
+		if err = m.respondToMaster(adminTask); err != nil {
+			log.LogErrorf("[opNamespaceExport] partitionID(%v) export(%v) respond to master: %v",
+				req.PartitionID, req.ExportID, err)
+		}
+	}()
+	log.LogInfof("%s [opNamespaceExport] volume[%v] partition[%v] export[%v] started",
+		remoteAddr, req.VolName, req.PartitionID, req.ExportID)
+	return
+}
+
+// ExportNamespace writes the index file of the partition exported from the snapshot to the target. The snapshot
+// is loaded into a detached view, so the live partition is not touched except for linking its snapshot files.
+func (mp *metaPartition) ExportNamespace(req *proto.NamespaceExportRequest) (resp *proto.NamespaceExportResponse, err error) {
+	dir := path.Join(mp.config.RootDir, nsExportDirPrefix+req.ExportID)
+	defer os.RemoveAll(dir)
+	if err = mp.linkSnapshot(dir); err != nil {
+		return
+	}
+	conf := *mp.config
+	conf.Peers = nil
+	view := NewMetaPartition(&conf, mp.manager).(*metaPartition)
+	if err = view.LoadSnapshot(dir); err != nil {
+		return
+	}
+	w := nsindex.NewWriter(req.VolName, mp.config.PartitionId, view.applyID, req.ExportTime)
+	view.inodeTree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		if ino.ShouldDelete() {
+			return true
+		}
+		err = w.AddInode(&nsindex.Inode{
+			Inode:      ino.Inode,
+			Mode:       ino.Type,
+			Size:       ino.Size,
+			ModifyTime: ino.ModifyTime,
+			Uid:        ino.Uid,
+			Gid:        ino.Gid,
+			Nlink:      ino.NLink,
+		})
+		return err == nil
+	})
+	if err != nil {
+		return
+	}
+	view.dentryTree.Ascend(func(i BtreeItem) bool {
+		dentry := i.(*Dentry)
+		err = w.AddDentry(&nsindex.Dentry{
+			ParentID: dentry.ParentId,
+			Name:     dentry.Name,
+			Inode:    dentry.Inode,
+			Type:     dentry.Type,
+		})
+		return err == nil
+	})
+	if err != nil {
+		return
+	}
+	buf := new(bytes.Buffer)
+	if _, err = w.WriteTo(buf); err != nil {
+		return
+	}
+	name := nsindex.FileName(mp.config.PartitionId)
+	if err = mp.manager.putNamespaceExportFile(req, name, buf.Bytes()); err != nil {
+		return
+	}
+	resp = &proto.NamespaceExportResponse{
+		PartitionID: mp.config.PartitionId,
+		VolName:     req.VolName,
+		ExportID:    req.ExportID,
+		Status:      proto.TaskSucceeds,
+		File:        name,
+		ApplyID:     view.applyID,
+		Size:        int64(buf.Len()),
+	}
+	resp.Inodes, resp.Dentries = w.Rows()
+	log.LogInfof("[ExportNamespace] partitionID(%v) exported %v inodes and %v dentries of apply %v to %v",
+		mp.config.PartitionId, resp.Inodes, resp.Dentries, resp.ApplyID, name)
+	return
+}
+
+// linkSnapshot hard links the files of the current snapshot into the directory. The linking is retried if the
+// snapshot is replaced meanwhile, so that all the files linked are of the same snapshot.
+func (mp *metaPartition) linkSnapshot(dir string) (err error) {
+	snapshotPath := path.Join(mp.config.RootDir, snapshotDir)
+	for i := 0; i < nsExportLinkRetries; i++ {
+		if err = os.RemoveAll(dir); err != nil {
+			return
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+		if err = linkFiles(snapshotPath, dir); err == nil {
+			return
+		}
+		log.LogWarnf("[linkSnapshot] partitionID(%v) retry to link the snapshot: %v", mp.config.PartitionId, err)
+	}
+	return
+}
+
+func linkFiles(src, dst string) (err error) {
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if err = os.Link(path.Join(src, info.Name()), path.Join(dst, info.Name())); err != nil {
+			return
+		}
+	}
+	for _, info := range infos {
+		var current, linked os.FileInfo
+		if current, err = os.Stat(path.Join(src, info.Name())); err != nil {
+			return
+		}
+		if linked, err = os.Stat(path.Join(dst, info.Name())); err != nil {
+			return
+		}
+		if !os.SameFile(current, linked) {
+			return fmt.Errorf("snapshot file %v is replaced", info.Name())
+		}
+	}
+	return
+}
+
+func (m *metadataManager) putNamespaceExportManifest(req *proto.NamespaceExportRequest) (err error) {
+	manifest := &nsindex.Manifest{
+		Volume:     req.VolName,
+		ExportID:   req.ExportID,
+		ExportTime: req.ExportTime,
+	}
+	for _, file := range req.Files {
+		manifest.Files = append(manifest.Files, &nsindex.ManifestFile{
+			PartitionID: file.PartitionID,
+			Name:        file.File,
+			ApplyID:     file.ApplyID,
+			Inodes:      file.Inodes,
+			Dentries:    file.Dentries,
+			Size:        file.Size,
+		})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return
+	}
+	return m.putNamespaceExportFile(req, nsindex.ManifestName, data)
+}
+
+// putNamespaceExportFile writes the file of the export to the directory or the object store of the target, which
+// is either written completely or not at all.
+func (m *metadataManager) putNamespaceExportFile(req *proto.NamespaceExportRequest, name string, data []byte) (err error) {
+	if strings.HasPrefix(req.Target, nsExportS3Scheme) {
+		return m.putNamespaceExportObject(req, name, data)
+	}
+	if !path.IsAbs(req.Target) {
+		return fmt.Errorf("bad namespace export target %v", req.Target)
+	}
+	dir := path.Join(req.Target, req.VolName, req.ExportID)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	tmpName := path.Join(dir, "."+name)
+	fp, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmpName)
+	if _, err = fp.Write(data); err == nil {
+		err = fp.Sync()
+	}
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(tmpName, path.Join(dir, name))
+}
+
+func (m *metadataManager) putNamespaceExportObject(req *proto.NamespaceExportRequest, name string, data []byte) (err error) {
+	if m.nsExportS3.Endpoint == "" {
+		return fmt.Errorf("no object store is configured for namespace export target %v", req.Target)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(req.Target, nsExportS3Scheme), "/", 2)
+	bucket, prefix := parts[0], ""
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+	if bucket == "" {
+		return fmt.Errorf("bad namespace export target %v", req.Target)
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return
+	}
+	region := m.nsExportS3.Region
+	if region == "" {
+		region = "default"
+	}
+	ac := aws.NewConfig()
+	ac.Endpoint = aws.String(m.nsExportS3.Endpoint)
+	ac.Region = aws.String(region)
+	ac.Credentials = credentials.NewStaticCredentials(m.nsExportS3.AccessKey, m.nsExportS3.SecretKey, "")
+	ac.S3ForcePathStyle = aws.Bool(true)
+	_, err = s3.New(sess, ac).PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(path.Join(prefix, req.VolName, req.ExportID, name)),
+		Body:   bytes.NewReader(data),
+	})
+	return
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/nsindex"
+)
+
+func TestExportNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ns_export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rootDir, target := path.Join(dir, "mp"), path.Join(dir, "target")
+	mp := NewMetaPartition(&MetaPartitionConfig{PartitionId: 1, Start: 1, End: 100, RootDir: rootDir},
+		&metadataManager{}).(*metaPartition)
+	mp.fsmCreateInode(NewInode(1, proto.Mode(os.ModeDir|0755)))
+	file := NewInode(2, proto.Mode(0644))
+	file.Size = 10
+	mp.fsmCreateInode(file)
+	deleted := NewInode(3, proto.Mode(0644))
+	deleted.SetDeleteMark()
+	mp.fsmCreateInode(deleted)
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "a", Inode: 2, Type: proto.Mode(0644)}, false)
+	sm := &storeMsg{
+		applyIndex:    10,
+		inodeTree:     mp.inodeTree.GetTree(),
+		dentryTree:    mp.dentryTree.GetTree(),
+		extendTree:    mp.extendTree.GetTree(),
+		multipartTree: mp.multipartTree.GetTree(),
+	}
+	if err = mp.store(sm); err != nil {
+		t.Fatal(err)
+	}
+	// the changes after the snapshot are not exported
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "b", Inode: 2, Type: proto.Mode(0644)}, false)
+
+	req := &proto.NamespaceExportRequest{PartitionID: 1, VolName: "vol", ExportID: "e1", ExportTime: 100, Target: target}
+	resp, err := mp.ExportNamespace(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ApplyID != 10 || resp.Inodes != 2 || resp.Dentries != 1 || resp.Status != proto.TaskSucceeds {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if _, err = os.Stat(path.Join(rootDir, nsExportDirPrefix+"e1")); !os.IsNotExist(err) {
+		t.Fatalf("the linked snapshot should be removed, but got %v", err)
+	}
+	r, err := nsindex.ReadFile(path.Join(target, "vol", "e1", resp.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make(map[string]*nsindex.Inode)
+	if err = nsindex.ResolvePaths([]*nsindex.Reader{r}, func(p string, ino *nsindex.Inode) bool {
+		paths[p] = ino
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths["/"] == nil || paths["/a"] == nil || paths["/a"].Size != 10 {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+
+	req.Files = []*proto.NamespaceExportResponse{resp}
+	if err = mp.manager.putNamespaceExportManifest(req); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path.Join(target, "vol", "e1", nsindex.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &nsindex.Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Name != resp.File || manifest.Files[0].Inodes != 2 {
+		t.Fatalf("unexpected manifest %s", data)
+	}
+}
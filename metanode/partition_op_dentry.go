@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
 )
 
 // CreateDentry returns a new dentry.
@@ -28,6 +29,9 @@ func (mp *metaPartition) CreateDentry(req *CreateDentryReq, p *Packet) (err erro
 		p.PacketErrorWithBody(proto.OpExistErr, []byte(err.Error()))
 		return
 	}
+	if !mp.checkDentryName(req.Name, p) {
+		return
+	}
 
 	dentry := &Dentry{
 		ParentId: req.ParentID,
@@ -39,12 +43,25 @@ func (mp *metaPartition) CreateDentry(req *CreateDentryReq, p *Packet) (err erro
 	if err != nil {
 		return
 	}
-	resp, err := mp.submit(opFSMCreateDentry, val)
+	resp, _, err := mp.submitMutation(opFSMCreateDentry, val, req.ReqID)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
 	}
 	p.ResultCode = resp.(uint8)
+	if req.Sync && p.ResultCode == proto.OpOk {
+		err = mp.barrier(p)
+	}
+	return
+}
+
+// barrier syncs the dentries applied so far by a raft barrier, for the renames of a volume with SyncOnRename. The
+// client retries the request with the same request ID on failure, which is replayed and synced again.
+func (mp *metaPartition) barrier(p *Packet) (err error) {
+	if err = mp.raftPartition.Barrier(); err != nil {
+		log.LogWarnf("[barrier] partition(%v) req(%v) err(%v)", mp.config.PartitionId, p.GetReqID(), err)
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+	}
 	return
 }
 
@@ -59,7 +76,7 @@ func (mp *metaPartition) DeleteDentry(req *DeleteDentryReq, p *Packet) (err erro
 		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	r, err := mp.submit(opFSMDeleteDentry, val)
+	r, _, err := mp.submitMutation(opFSMDeleteDentry, val, req.ReqID)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
@@ -68,6 +85,11 @@ func (mp *metaPartition) DeleteDentry(req *DeleteDentryReq, p *Packet) (err erro
 	p.ResultCode = retMsg.Status
 	dentry = retMsg.Msg
 	if p.ResultCode == proto.OpOk {
+		if req.Sync {
+			if err = mp.barrier(p); err != nil {
+				return
+			}
+		}
 		var reply []byte
 		resp := &DeleteDentryResp{
 			Inode: dentry.Inode,
@@ -160,7 +182,7 @@ func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err erro
 		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	resp, err := mp.submit(opFSMUpdateDentry, val)
+	resp, _, err := mp.submitMutation(opFSMUpdateDentry, val, req.ReqID)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
@@ -168,6 +190,11 @@ func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err erro
 	msg := resp.(*DentryResponse)
 	p.ResultCode = msg.Status
 	if msg.Status == proto.OpOk {
+		if req.Sync {
+			if err = mp.barrier(p); err != nil {
+				return
+			}
+		}
 		var reply []byte
 		m := &UpdateDentryResp{
 			Inode: msg.Msg.Inode,
@@ -180,7 +207,15 @@ func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err erro
 
 // ReadDir reads the directory based on the given request.
 func (mp *metaPartition) ReadDir(req *ReadDirReq, p *Packet) (err error) {
-	resp := mp.readDir(req)
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
+	resp, err := view.readDir(req, p)
+	if err != nil {
+		p.packetTimeout()
+		return
+	}
 	reply, err := json.Marshal(resp)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
@@ -192,11 +227,15 @@ func (mp *metaPartition) ReadDir(req *ReadDirReq, p *Packet) (err error) {
 
 // Lookup looks up the given dentry from the request.
 func (mp *metaPartition) Lookup(req *LookupReq, p *Packet) (err error) {
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
 	dentry := &Dentry{
 		ParentId: req.ParentID,
 		Name:     req.Name,
 	}
-	dentry, status := mp.getDentry(dentry)
+	dentry, status := view.getDentry(dentry)
 	var reply []byte
 	if status == proto.OpOk {
 		resp := &LookupResp{
@@ -21,6 +21,14 @@ import (
 )
 
 func (mp *metaPartition) SetXAttr(req *proto.SetXAttrRequest, p *Packet) (err error) {
+	if req.Key == proto.XAttrKeyChecksumSHA256 {
+		p.PacketErrorWithBody(proto.OpNotPerm, []byte("the checksum is set by the meta node"))
+		return
+	}
+	if req.Key == proto.XAttrKeyDedupBlocks {
+		p.PacketErrorWithBody(proto.OpNotPerm, []byte("the dedup blocks are set by the meta node"))
+		return
+	}
 	var extend = NewExtend(req.Inode)
 	extend.Put([]byte(req.Key), []byte(req.Value))
 	if _, err = mp.putExtend(opFSMSetXAttr, extend); err != nil {
@@ -38,12 +46,19 @@ func (mp *metaPartition) GetXAttr(req *proto.GetXAttrRequest, p *Packet) (err er
 		Inode:       req.Inode,
 		Key:         req.Key,
 	}
-	treeItem := mp.extendTree.Get(NewExtend(req.Inode))
-	if treeItem != nil {
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
+	treeItem := view.extendTree.Get(NewExtend(req.Inode))
+	if treeItem != nil && req.Key != proto.XAttrKeyDedupBlocks {
 		extend := treeItem.(*Extend)
 		if value, exist := extend.Get([]byte(req.Key)); exist {
 			response.Value = string(value)
 		}
+		if req.Key == proto.XAttrKeyChecksumSHA256 {
+			response.Value, _, _ = view.validFileChecksum(req.Inode, response.Value)
+		}
 	}
 	var encoded []byte
 	encoded, err = json.Marshal(response)
@@ -61,7 +76,11 @@ func (mp *metaPartition) BatchGetXAttr(req *proto.BatchGetXAttrRequest, p *Packe
 		PartitionId: req.PartitionId,
 		XAttrs:      make([]*proto.XAttrInfo, 0, len(req.Inodes)),
 	}
-	for _, inode := range req.Inodes {
+	for i, inode := range req.Inodes {
+		if (i+1)%opTimeoutCheckInterval == 0 && p.canceled() {
+			p.packetTimeout()
+			return ErrOpTimeout
+		}
 		treeItem := mp.extendTree.Get(NewExtend(inode))
 		if treeItem != nil {
 			extend := treeItem.(*Extend)
@@ -70,7 +89,16 @@ func (mp *metaPartition) BatchGetXAttr(req *proto.BatchGetXAttrRequest, p *Packe
 				XAttrs: make(map[string]string),
 			}
 			for _, key := range req.Keys {
-				if val, exist := extend.Get([]byte(key)); exist {
+				if key == proto.XAttrKeyDedupBlocks {
+					continue
+				}
+				val, exist := extend.Get([]byte(key))
+				if exist && key == proto.XAttrKeyChecksumSHA256 {
+					var checksum string
+					checksum, _, exist = mp.validFileChecksum(inode, string(val))
+					val = []byte(checksum)
+				}
+				if exist {
 					info.XAttrs[key] = string(val)
 				}
 			}
@@ -87,6 +115,10 @@ func (mp *metaPartition) BatchGetXAttr(req *proto.BatchGetXAttrRequest, p *Packe
 }
 
 func (mp *metaPartition) RemoveXAttr(req *proto.RemoveXAttrRequest, p *Packet) (err error) {
+	if req.Key == proto.XAttrKeyDedupBlocks {
+		p.PacketErrorWithBody(proto.OpNotPerm, []byte("the dedup blocks are removed with the inode"))
+		return
+	}
 	var extend = NewExtend(req.Inode)
 	extend.Put([]byte(req.Key), nil)
 	if _, err = mp.putExtend(opFSMRemoveXAttr, extend); err != nil {
@@ -104,11 +136,17 @@ func (mp *metaPartition) ListXAttr(req *proto.ListXAttrRequest, p *Packet) (err
 		Inode:       req.Inode,
 		XAttrs:      make([]string, 0),
 	}
-	treeItem := mp.extendTree.Get(NewExtend(req.Inode))
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
+	treeItem := view.extendTree.Get(NewExtend(req.Inode))
 	if treeItem != nil {
 		extend := treeItem.(*Extend)
 		extend.Range(func(key, value []byte) bool {
-			response.XAttrs = append(response.XAttrs, string(key))
+			if string(key) != proto.XAttrKeyDedupBlocks {
+				response.XAttrs = append(response.XAttrs, string(key))
+			}
 			return true
 		})
 	}
@@ -122,6 +160,36 @@ func (mp *metaPartition) ListXAttr(req *proto.ListXAttrRequest, p *Packet) (err
 	return
 }
 
+// ListTag lists the tags of this partition if no tag is specified in the request,
+// otherwise lists the inodes attached with the specified tag.
+func (mp *metaPartition) ListTag(req *proto.ListTagRequest, p *Packet) (err error) {
+	var response = &proto.ListTagResponse{
+		VolName:     req.VolName,
+		PartitionId: req.PartitionId,
+		Tags:        make([]string, 0),
+		Entries:     make([]*proto.TagEntry, 0),
+	}
+	if req.Tag != "" {
+		response.Entries = mp.tags.entries(req.Tag, mp.isTaggedInodeAlive)
+	} else {
+		response.Tags = mp.tags.tags(mp.isTaggedInodeAlive)
+	}
+	var encoded []byte
+	if encoded, err = json.Marshal(response); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(encoded)
+	return
+}
+
+// The extend of an inode stays in the extend tree after the inode is unlinked, so the tags
+// are only valid if the inode is still alive.
+func (mp *metaPartition) isTaggedInodeAlive(ino uint64) bool {
+	item := mp.inodeTree.Get(NewInode(ino, 0))
+	return item != nil && !item.(*Inode).ShouldDelete()
+}
+
 func (mp *metaPartition) putExtend(op uint32, extend *Extend) (resp interface{}, err error) {
 	var marshaled []byte
 	if marshaled, err = extend.Bytes(); err != nil {
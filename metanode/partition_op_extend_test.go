@@ -0,0 +1,92 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestListTag(t *testing.T) {
+	mp := &metaPartition{inodeTree: NewBtree(), extendTree: NewBtree(), freeList: newFreeList(), dedup: newDedupIndex(), tags: newTagIndex()}
+	tag := func(ino uint64, xattrs map[string]string) {
+		mp.inodeTree.ReplaceOrInsert(NewInode(ino, proto.Mode(0644)), true)
+		extend := NewExtend(ino)
+		for key, value := range xattrs {
+			extend.Put([]byte(key), []byte(value))
+		}
+		if err := mp.fsmSetXAttr(extend); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tag(10, map[string]string{proto.XAttrKeyTagPrefix + "photo": "a.jpg", proto.XAttrKeyTagPrefix + "2020": ""})
+	tag(11, map[string]string{proto.XAttrKeyTagPrefix + "photo": "b.jpg", "user.comment": "not a tag"})
+	// neither the empty tag nor the unlinked inode is listed
+	tag(12, map[string]string{proto.XAttrKeyTagPrefix: "c.jpg"})
+	tag(13, map[string]string{proto.XAttrKeyTagPrefix + "trash": "d.jpg"})
+	item := mp.inodeTree.Get(NewInode(13, 0))
+	item.(*Inode).SetDeleteMark()
+
+	list := func(tag string) *proto.ListTagResponse {
+		p := &Packet{}
+		if err := mp.ListTag(&proto.ListTagRequest{VolName: "vol", PartitionId: 1, Tag: tag}, p); err != nil || p.ResultCode != proto.OpOk {
+			t.Fatalf("list tag(%v): result(%v) err(%v)", tag, p.GetResultMsg(), err)
+		}
+		resp := &proto.ListTagResponse{}
+		if err := json.Unmarshal(p.Data, resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := list("")
+	sort.Strings(resp.Tags)
+	if len(resp.Tags) != 2 || resp.Tags[0] != "2020" || resp.Tags[1] != "photo" || len(resp.Entries) != 0 {
+		t.Fatalf("unexpected tags %v entries %v", resp.Tags, resp.Entries)
+	}
+	resp = list("photo")
+	if len(resp.Tags) != 0 || len(resp.Entries) != 2 {
+		t.Fatalf("unexpected tags %v entries %v", resp.Tags, resp.Entries)
+	}
+	names := map[uint64]string{10: "a.jpg", 11: "b.jpg"}
+	for _, entry := range resp.Entries {
+		if names[entry.Inode] != entry.Name {
+			t.Fatalf("unexpected entry %+v of tag photo", entry)
+		}
+	}
+	if resp = list("trash"); len(resp.Entries) != 0 {
+		t.Fatalf("the unlinked inode should not be listed, entries %v", resp.Entries)
+	}
+
+	// the index follows the removed xattrs and the deleted inodes, and is the same after rebuilt
+	removed := NewExtend(10)
+	removed.Put([]byte(proto.XAttrKeyTagPrefix+"2020"), nil)
+	if err := mp.fsmRemoveXAttr(removed); err != nil {
+		t.Fatal(err)
+	}
+	mp.internalDeleteInode(NewInode(11, 0))
+	for i := 0; i < 2; i++ {
+		if resp = list(""); len(resp.Tags) != 1 || resp.Tags[0] != "photo" {
+			t.Fatalf("unexpected tags %v", resp.Tags)
+		}
+		if resp = list("photo"); len(resp.Entries) != 1 || resp.Entries[0].Inode != 10 || resp.Entries[0].Name != "a.jpg" {
+			t.Fatalf("unexpected entries %v of tag photo", resp.Entries)
+		}
+		mp.rebuildTagIndex()
+	}
+}
@@ -42,8 +42,12 @@ func (mp *metaPartition) ExtentAppend(req *proto.AppendExtentKeyRequest, p *Pack
 
 // ExtentsList returns the list of extents.
 func (mp *metaPartition) ExtentsList(req *proto.GetExtentsRequest, p *Packet) (err error) {
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
-	retMsg := mp.getInode(ino)
+	retMsg := view.getInode(ino)
 	ino = retMsg.Msg
 	var (
 		reply  []byte
@@ -107,3 +111,84 @@ func (mp *metaPartition) BatchExtentAppend(req *proto.AppendExtentKeysRequest, p
 	p.PacketErrorWithBody(resp.(uint8), nil)
 	return
 }
+
+// CheckDataPartitionRef finds the inodes which have extent keys referring to the data partition,
+// including the inodes waiting to be freed, since their extents have not been deleted yet.
+func (mp *metaPartition) CheckDataPartitionRef(req *proto.CheckDataPartitionRefRequest, p *Packet) (err error) {
+	resp := &proto.CheckDataPartitionRefResponse{
+		PartitionID:     req.PartitionID,
+		DataPartitionID: req.DataPartitionID,
+		Inodes:          make([]uint64, 0),
+	}
+	mp.getInodeTree().Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		var count uint64
+		ino.Extents.Range(func(ek proto.ExtentKey) bool {
+			if ek.PartitionId == req.DataPartitionID {
+				count++
+			}
+			return true
+		})
+		if count == 0 {
+			return true
+		}
+		resp.ExtentKeyCount += count
+		resp.InodeCount++
+		if len(resp.Inodes) < req.Limit {
+			resp.Inodes = append(resp.Inodes, ino.Inode)
+		}
+		return true
+	})
+	data, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(data)
+	return
+}
+
+// CheckExtentRefs finds the extents referenced by the extent keys of the inodes, including the inodes waiting to be
+// freed, since their extents are deleted by the partition itself.
+func (mp *metaPartition) CheckExtentRefs(req *proto.CheckExtentRefsRequest, p *Packet) (err error) {
+	resp := &proto.CheckExtentRefsResponse{
+		PartitionID: req.PartitionID,
+		Referenced:  make([]*proto.OrphanExtent, 0),
+	}
+	unchecked := make(map[dedupExtentID]*proto.OrphanExtent, len(req.Extents))
+	for _, extent := range req.Extents {
+		unchecked[dedupExtentID{partitionID: extent.PartitionID, extentID: extent.ExtentID}] = extent
+	}
+	check := func(ino *Inode) bool {
+		ino.Extents.Range(func(ek proto.ExtentKey) bool {
+			id := dedupExtentIDOf(&ek)
+			if extent, ok := unchecked[id]; ok {
+				delete(unchecked, id)
+				resp.Referenced = append(resp.Referenced, extent)
+			}
+			return len(unchecked) > 0
+		})
+		return len(unchecked) > 0
+	}
+	if req.ByInode {
+		for _, extent := range req.Extents {
+			if len(unchecked) == 0 {
+				break
+			}
+			if item := mp.inodeTree.Get(NewInode(extent.Inode, 0)); item != nil {
+				check(item.(*Inode))
+			}
+		}
+	} else {
+		mp.getInodeTree().Ascend(func(i BtreeItem) bool {
+			return check(i.(*Inode))
+		})
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(data)
+	return
+}
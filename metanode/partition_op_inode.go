@@ -35,19 +35,21 @@ func replyInfo(info *proto.InodeInfo, ino *Inode) bool {
 	info.Uid = ino.Uid
 	info.Gid = ino.Gid
 	info.Generation = ino.Generation
+	info.Reserved = ino.Reserved
 	if length := len(ino.LinkTarget); length > 0 {
 		info.Target = make([]byte, length)
 		copy(info.Target, ino.LinkTarget)
 	}
-	info.CreateTime = time.Unix(ino.CreateTime, 0)
-	info.AccessTime = time.Unix(ino.AccessTime, 0)
-	info.ModifyTime = time.Unix(ino.ModifyTime, 0)
+	info.CreateTime = time.Unix(ino.CreateTime, int64(ino.CreateTimeNsec))
+	info.AccessTime = time.Unix(ino.AccessTime, int64(ino.AccessTimeNsec))
+	info.ModifyTime = time.Unix(ino.ModifyTime, int64(ino.ModifyTimeNsec))
+	info.BirthTime = time.Unix(ino.BirthTime, int64(ino.BirthTimeNsec))
 	return true
 }
 
 // CreateInode returns a new inode.
 func (mp *metaPartition) CreateInode(req *CreateInoReq, p *Packet) (err error) {
-	inoID, err := mp.nextInodeID()
+	inoID, err := mp.createInodeID(req.Inode)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpInodeFullErr, []byte(err.Error()))
 		return
@@ -61,11 +63,19 @@ func (mp *metaPartition) CreateInode(req *CreateInoReq, p *Packet) (err error) {
 		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	resp, err := mp.submit(opFSMCreateInode, val)
+	resp, replayed, err := mp.submitMutation(opFSMCreateInode, val, req.ReqID)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
 	}
+	// the retry is answered with the inode created originally
+	if replayed != nil {
+		ino = NewInode(0, 0)
+		if err = ino.Unmarshal(replayed); err != nil {
+			p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+			return
+		}
+	}
 	var (
 		status = proto.OpNotExistErr
 		reply  []byte
@@ -95,7 +105,7 @@ func (mp *metaPartition) UnlinkInode(req *UnlinkInoReq, p *Packet) (err error) {
 		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
 		return
 	}
-	r, err := mp.submit(opFSMUnlinkInode, val)
+	r, _, err := mp.submitMutation(opFSMUnlinkInode, val, req.ReqID)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
@@ -170,8 +180,12 @@ func (mp *metaPartition) UnlinkInodeBatch(req *BatchUnlinkInoReq, p *Packet) (er
 
 // InodeGet executes the inodeGet command from the client.
 func (mp *metaPartition) InodeGet(req *InodeGetReq, p *Packet) (err error) {
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
 	ino := NewInode(req.Inode, 0)
-	retMsg := mp.getInode(ino)
+	retMsg := view.getInode(ino)
 	ino = retMsg.Msg
 	var (
 		reply  []byte
@@ -196,11 +210,19 @@ func (mp *metaPartition) InodeGet(req *InodeGetReq, p *Packet) (err error) {
 
 // InodeGetBatch executes the inodeBatchGet command from the client.
 func (mp *metaPartition) InodeGetBatch(req *InodeGetReqBatch, p *Packet) (err error) {
+	view, ok := mp.historyOf(req.AsOf, p)
+	if !ok {
+		return
+	}
 	resp := &proto.BatchInodeGetResponse{}
 	ino := NewInode(0, 0)
-	for _, inoId := range req.Inodes {
+	for i, inoId := range req.Inodes {
+		if (i+1)%opTimeoutCheckInterval == 0 && p.canceled() {
+			p.packetTimeout()
+			return ErrOpTimeout
+		}
 		ino.Inode = inoId
-		retMsg := mp.getInode(ino)
+		retMsg := view.getInode(ino)
 		if retMsg.Status == proto.OpOk {
 			inoInfo := &proto.InodeInfo{}
 			if replyInfo(inoInfo, retMsg.Msg) {
@@ -0,0 +1,245 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func (mp *metaPartition) replyLifecycle(resp interface{}, p *Packet) (err error) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(data)
+	return
+}
+
+// LifecycleScanDir lists the dentries of the directory whose names start with the prefix.
+func (mp *metaPartition) LifecycleScanDir(req *proto.LifecycleScanDirRequest, p *Packet) (err error) {
+	resp := &proto.LifecycleScanDirResponse{Dentries: make([]*proto.LifecycleDentry, 0)}
+	start := req.Prefix
+	if req.Marker > start {
+		start = req.Marker
+	}
+	begin := &Dentry{ParentId: req.ParentID, Name: start}
+	end := &Dentry{ParentId: req.ParentID + 1}
+	mp.dentryTree.AscendRange(begin, end, func(i BtreeItem) bool {
+		d := i.(*Dentry)
+		if d.Name == req.Marker {
+			return true
+		}
+		if !strings.HasPrefix(d.Name, req.Prefix) {
+			return false
+		}
+		if len(resp.Dentries) >= req.Limit {
+			resp.NextMarker = resp.Dentries[len(resp.Dentries)-1].Name
+			return false
+		}
+		resp.Dentries = append(resp.Dentries, &proto.LifecycleDentry{Name: d.Name, Inode: d.Inode, Type: d.Type})
+		return true
+	})
+	return mp.replyLifecycle(resp, p)
+}
+
+// LifecycleFilterExpired finds the regular files which have not been modified since the expiration time.
+func (mp *metaPartition) LifecycleFilterExpired(req *proto.LifecycleFilterExpiredRequest, p *Packet) (err error) {
+	resp := &proto.LifecycleFilterExpiredResponse{Inodes: make([]uint64, 0)}
+	for _, ino := range req.Inodes {
+		item := mp.inodeTree.CopyGet(NewInode(ino, 0))
+		if item == nil {
+			continue
+		}
+		inode := item.(*Inode)
+		var expired bool
+		inode.DoReadFunc(func() {
+			expired = proto.IsRegular(inode.Type) && inode.ModifyTime < req.ExpireBefore
+		})
+		if expired && !inode.ShouldDelete() {
+			resp.Inodes = append(resp.Inodes, ino)
+		}
+	}
+	return mp.replyLifecycle(resp, p)
+}
+
+// LifecycleDeleteDentries deletes the dentries of the directory, and replies the inodes whose dentries are deleted.
+func (mp *metaPartition) LifecycleDeleteDentries(req *proto.LifecycleDeleteDentriesRequest, p *Packet) (err error) {
+	resp := &proto.LifecycleDeleteDentriesResponse{Inodes: make([]uint64, 0)}
+	if len(req.Dentries) == 0 {
+		return mp.replyLifecycle(resp, p)
+	}
+	db := make(DentryBatch, 0, len(req.Dentries))
+	for _, d := range req.Dentries {
+		db = append(db, &Dentry{
+			ParentId: req.ParentID,
+			Name:     d.Name,
+			Inode:    d.Inode,
+			Type:     d.Type,
+		})
+	}
+	val, err := db.Marshal()
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	r, err := mp.submit(opFSMDeleteDentryBatch, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	for _, m := range r.([]*DentryResponse) {
+		if m.Status == proto.OpOk && m.Msg != nil {
+			resp.Inodes = append(resp.Inodes, m.Msg.Inode)
+		}
+	}
+	return mp.replyLifecycle(resp, p)
+}
+
+// LifecycleDeleteInodes unlinks the inodes and evicts the ones which are not linked any more,
+// the inodes which do not exist are ignored.
+func (mp *metaPartition) LifecycleDeleteInodes(req *proto.LifecycleDeleteInodesRequest, p *Packet) (err error) {
+	if len(req.Inodes) == 0 {
+		p.PacketOkReply()
+		return
+	}
+	var inodes InodeBatch
+	for _, ino := range req.Inodes {
+		inodes = append(inodes, NewInode(ino, 0))
+	}
+	val, err := inodes.Marshal()
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	r, err := mp.submit(opFSMUnlinkInodeBatch, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	var unlinked InodeBatch
+	for _, ir := range r.([]*InodeResponse) {
+		if ir.Status == proto.OpOk && ir.Msg != nil {
+			unlinked = append(unlinked, NewInode(ir.Msg.Inode, 0))
+		}
+	}
+	if len(unlinked) == 0 {
+		p.PacketOkReply()
+		return
+	}
+	if val, err = unlinked.Marshal(); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	if _, err = mp.submit(opFSMEvictInodeBatch, val); err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketOkReply()
+	return
+}
+
+// LifecycleListMultiparts lists the multipart uploads under the prefix which have been initiated before the time.
+func (mp *metaPartition) LifecycleListMultiparts(req *proto.LifecycleListMultipartsRequest, p *Packet) (err error) {
+	resp := &proto.LifecycleListMultipartsResponse{Multiparts: make([]*proto.LifecycleMultipart, 0)}
+	mp.multipartTree.AscendGreaterOrEqual(&Multipart{key: req.Prefix}, func(i BtreeItem) bool {
+		multipart := i.(*Multipart)
+		if !strings.HasPrefix(multipart.key, req.Prefix) || len(resp.Multiparts) >= req.Limit {
+			return false
+		}
+		if multipart.initTime.Unix() >= req.InitBefore {
+			return true
+		}
+		m := &proto.LifecycleMultipart{
+			Path:        multipart.key,
+			MultipartID: multipart.id,
+			InitTime:    multipart.initTime.Unix(),
+			Inodes:      make([]uint64, 0),
+		}
+		for _, part := range multipart.Parts() {
+			m.Inodes = append(m.Inodes, part.Inode)
+		}
+		resp.Multiparts = append(resp.Multiparts, m)
+		return true
+	})
+	return mp.replyLifecycle(resp, p)
+}
+
+// LifecycleRemoveMultiparts removes the multipart uploads, whose parts have been deleted.
+func (mp *metaPartition) LifecycleRemoveMultiparts(req *proto.LifecycleRemoveMultipartsRequest, p *Packet) (err error) {
+	for _, m := range req.Multiparts {
+		var resp interface{}
+		if resp, err = mp.putMultipart(opFSMRemoveMultipart, &Multipart{id: m.MultipartID, key: m.Path}); err != nil {
+			p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+			return
+		}
+		if status := resp.(uint8); status != proto.OpOk && status != proto.OpNotExistErr {
+			p.PacketErrorWithBody(status, nil)
+			return
+		}
+	}
+	p.PacketOkReply()
+	return
+}
+
+// LifecycleListExtents lists the extent keys of the regular files, the other inodes are ignored.
+func (mp *metaPartition) LifecycleListExtents(req *proto.LifecycleListExtentsRequest, p *Packet) (err error) {
+	resp := &proto.LifecycleListExtentsResponse{Files: make([]*proto.LifecycleFileExtents, 0)}
+	for _, ino := range req.Inodes {
+		item := mp.inodeTree.CopyGet(NewInode(ino, 0))
+		if item == nil {
+			continue
+		}
+		inode := item.(*Inode)
+		if !proto.IsRegular(inode.Type) || inode.ShouldDelete() {
+			continue
+		}
+		resp.Files = append(resp.Files, &proto.LifecycleFileExtents{Inode: ino, Extents: inode.Extents.CopyExtents()})
+	}
+	return mp.replyLifecycle(resp, p)
+}
+
+// LifecycleSwapExtents replaces the extent keys of the file with the keys of the copies of their extents, which must
+// refer to the same ranges of the file and of the extents.
+func (mp *metaPartition) LifecycleSwapExtents(req *proto.LifecycleSwapExtentsRequest, p *Packet) (err error) {
+	if len(req.OldExtents) > 0 {
+		if len(req.NewExtents) != len(req.OldExtents) {
+			p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte("the number of the extent keys mismatch"))
+			return
+		}
+		for idx, ek := range req.NewExtents {
+			old := req.OldExtents[idx]
+			if ek.FileOffset != old.FileOffset || ek.ExtentOffset != old.ExtentOffset || ek.Size != old.Size {
+				p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte(fmt.Sprintf("extent key %v mismatch %v", ek, old)))
+				return
+			}
+		}
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	r, err := mp.submit(opFSMSwapExtents, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	return mp.replyLifecycle(r.(*proto.LifecycleSwapExtentsResponse), p)
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestLifecycleScanDir(t *testing.T) {
+	mp := &metaPartition{dentryTree: NewBtree()}
+	for i := 0; i < 5; i++ {
+		mp.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 1, Name: fmt.Sprintf("log-%v", i), Inode: uint64(10 + i), Type: proto.Mode(0644)}, true)
+	}
+	mp.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 1, Name: "data", Inode: 20, Type: proto.Mode(os.ModeDir | 0755)}, true)
+	mp.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 2, Name: "log-x", Inode: 30, Type: proto.Mode(0644)}, true)
+
+	var (
+		names  []string
+		marker string
+	)
+	for {
+		p := &Packet{}
+		req := &proto.LifecycleScanDirRequest{ParentID: 1, Prefix: "log-", Marker: marker, Limit: 2}
+		if err := mp.LifecycleScanDir(req, p); err != nil {
+			t.Fatalf("scan dir fail cause: %v", err)
+		}
+		resp := &proto.LifecycleScanDirResponse{}
+		if err := json.Unmarshal(p.Data, resp); err != nil {
+			t.Fatalf("unmarshal response fail cause: %v", err)
+		}
+		for _, d := range resp.Dentries {
+			names = append(names, d.Name)
+		}
+		if resp.NextMarker == "" {
+			break
+		}
+		marker = resp.NextMarker
+	}
+	if len(names) != 5 || names[0] != "log-0" || names[4] != "log-4" {
+		t.Fatalf("unexpected scanned dentries %v", names)
+	}
+}
+
+func TestLifecycleFilterExpired(t *testing.T) {
+	mp := &metaPartition{inodeTree: NewBtree()}
+	now := time.Now().Unix()
+	expired := NewInode(10, proto.Mode(0644))
+	expired.ModifyTime = now - 3600
+	fresh := NewInode(11, proto.Mode(0644))
+	fresh.ModifyTime = now
+	dir := NewInode(12, proto.Mode(os.ModeDir|0755))
+	dir.ModifyTime = now - 3600
+	for _, ino := range []*Inode{expired, fresh, dir} {
+		mp.inodeTree.ReplaceOrInsert(ino, true)
+	}
+
+	p := &Packet{}
+	req := &proto.LifecycleFilterExpiredRequest{Inodes: []uint64{10, 11, 12, 13}, ExpireBefore: now - 60}
+	if err := mp.LifecycleFilterExpired(req, p); err != nil {
+		t.Fatalf("filter expired fail cause: %v", err)
+	}
+	resp := &proto.LifecycleFilterExpiredResponse{}
+	if err := json.Unmarshal(p.Data, resp); err != nil {
+		t.Fatalf("unmarshal response fail cause: %v", err)
+	}
+	if len(resp.Inodes) != 1 || resp.Inodes[0] != 10 {
+		t.Fatalf("unexpected expired inodes %v", resp.Inodes)
+	}
+}
+
+func TestLifecycleSwapExtents(t *testing.T) {
+	mp := &metaPartition{inodeTree: NewBtree(), extDelCh: make(chan []proto.ExtentKey, 10)}
+	ino := NewInode(10, proto.Mode(0644))
+	ino.ModifyTime = 100
+	oldEks := []proto.ExtentKey{
+		{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 4096},
+		{FileOffset: 4096, PartitionId: 2, ExtentId: 1, ExtentOffset: 8192, Size: 4096},
+	}
+	ino.AppendExtents(oldEks, 100, 0)
+	mp.inodeTree.ReplaceOrInsert(ino, true)
+	newEks := []proto.ExtentKey{oldEks[0], oldEks[1]}
+	newEks[0].PartitionId, newEks[0].ExtentId = 9, 1030
+
+	resp := mp.fsmSwapExtents(&proto.LifecycleSwapExtentsRequest{Inode: 10, OldExtents: oldEks, NewExtents: newEks})
+	if !resp.Swapped {
+		t.Fatalf("extents are not swapped")
+	}
+	if eks := ino.Extents.CopyExtents(); len(eks) != 2 || eks[0] != newEks[0] || eks[1] != oldEks[1] {
+		t.Fatalf("unexpected extents %v", eks)
+	}
+	if ino.ModifyTime != 100 {
+		t.Fatalf("modify time is changed to %v", ino.ModifyTime)
+	}
+	if del := <-mp.extDelCh; len(del) != 1 || del[0] != oldEks[0] {
+		t.Fatalf("unexpected deleted extents %v", del)
+	}
+
+	// the file is changed since the extents are listed, so the copies are deleted
+	copies := []proto.ExtentKey{newEks[0], newEks[1]}
+	copies[0].ExtentId = 1031
+	resp = mp.fsmSwapExtents(&proto.LifecycleSwapExtentsRequest{Inode: 10, OldExtents: oldEks, NewExtents: copies})
+	if resp.Swapped {
+		t.Fatalf("the stale extents are swapped")
+	}
+	if del := <-mp.extDelCh; len(del) != 1 || del[0] != copies[0] {
+		t.Fatalf("unexpected deleted copies %v", del)
+	}
+
+	resp = mp.fsmSwapExtents(&proto.LifecycleSwapExtentsRequest{Inode: 10, NewExtents: copies[:1]})
+	if resp.Swapped {
+		t.Fatalf("the extents are swapped without the old ones")
+	}
+	if del := <-mp.extDelCh; len(del) != 1 || del[0] != copies[0] {
+		t.Fatalf("unexpected deleted copies %v", del)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+const (
+	retryJournalWindow = 5 * 60  // seconds to recognize a retried mutation, longer than the clients keep retrying
+	retryJournalLimit  = 1 << 16 // the most mutations journaled by a partition
+)
+
+// journaledMutation is the result of a mutation applied with the request ID of the client. It is persisted with the
+// trees of the partition and sent in the raft snapshots, so it is exported to be encoded.
+type journaledMutation struct {
+	ReqID  string `json:"reqID"`
+	Time   int64  `json:"time"`             // unix seconds when the leader proposed the mutation
+	Op     uint32 `json:"op"`               // the op of the raft command
+	Status uint8  `json:"status"`           // the status replied to the client
+	Result []byte `json:"result,omitempty"` // the dentry or the inode replied to the client, if any
+	Value  []byte `json:"value,omitempty"`  // the value of the raft command
+}
+
+// newJournaledMutation encodes the result of the mutation returned by Apply.
+func newJournaledMutation(reqID string, now int64, op uint32, resp interface{}, value []byte) (m *journaledMutation, err error) {
+	m = &journaledMutation{ReqID: reqID, Time: now, Op: op, Value: value}
+	switch r := resp.(type) {
+	case uint8:
+		m.Status = r
+	case *DentryResponse:
+		m.Status = r.Status
+		if r.Msg != nil {
+			m.Result, err = r.Msg.Marshal()
+		}
+	case *InodeResponse:
+		m.Status = r.Status
+		if r.Msg != nil {
+			m.Result, err = r.Msg.Marshal()
+		}
+	default:
+		err = fmt.Errorf("unknown response %T of op %v", resp, op)
+	}
+	return
+}
+
+// response decodes the result in the type returned by Apply for the op.
+func (m *journaledMutation) response() (resp interface{}, err error) {
+	switch m.Op {
+	case opFSMDeleteDentry, opFSMUpdateDentry:
+		r := &DentryResponse{Status: m.Status}
+		if m.Result != nil {
+			r.Msg = &Dentry{}
+			err = r.Msg.Unmarshal(m.Result)
+		}
+		return r, err
+	case opFSMUnlinkInode:
+		r := &InodeResponse{Status: m.Status}
+		if m.Result != nil {
+			r.Msg = NewInode(0, 0)
+			err = r.Msg.Unmarshal(m.Result)
+		}
+		return r, err
+	default:
+		return m.Status, nil
+	}
+}
+
+// replayedMutation is returned by Apply instead of applying a retried mutation again.
+type replayedMutation struct {
+	resp  interface{}
+	value []byte
+}
+
+// retryJournal keeps the results of the latest mutations applied with the request IDs of the clients, so that a
+// mutation retried after a timeout is answered with the original result instead of failing with EEXIST or ENOENT.
+// Like the trees, it is only changed by the raft commands, and the expiry follows the time proposed by the leader
+// instead of the local clock, so all the replicas recognize the same retries. It is persisted and sent in the raft
+// snapshots along with the trees, so a replica restarted or restored from a snapshot replays the same retries as well.
+type retryJournal struct {
+	sync.Mutex
+	records map[string]*list.Element
+	order   *list.List // of *journaledMutation, in the order of the proposals
+}
+
+func newRetryJournal() *retryJournal {
+	return &retryJournal{records: make(map[string]*list.Element), order: list.New()}
+}
+
+// lookup returns the mutation of the request ID if it is applied within the window before now.
+func (j *retryJournal) lookup(reqID string, now int64) (m *journaledMutation, ok bool) {
+	j.Lock()
+	defer j.Unlock()
+	e, ok := j.records[reqID]
+	if !ok {
+		return
+	}
+	if m = e.Value.(*journaledMutation); now-m.Time > retryJournalWindow {
+		return nil, false
+	}
+	return
+}
+
+// record journals the mutation, and forgets the ones beyond the window or the limit.
+func (j *retryJournal) record(m *journaledMutation) {
+	j.Lock()
+	defer j.Unlock()
+	if e, ok := j.records[m.ReqID]; ok {
+		j.order.Remove(e)
+	}
+	j.records[m.ReqID] = j.order.PushBack(m)
+	for e := j.order.Front(); e != nil; e = j.order.Front() {
+		old := e.Value.(*journaledMutation)
+		if m.Time-old.Time <= retryJournalWindow && j.order.Len() <= retryJournalLimit {
+			break
+		}
+		j.order.Remove(e)
+		delete(j.records, old.ReqID)
+	}
+}
+
+// entries returns the journaled mutations in the order of the proposals. The mutations are never changed once
+// journaled, so they are shared with the snapshots.
+func (j *retryJournal) entries() (entries []*journaledMutation) {
+	j.Lock()
+	defer j.Unlock()
+	entries = make([]*journaledMutation, 0, j.order.Len())
+	for e := j.order.Front(); e != nil; e = e.Next() {
+		entries = append(entries, e.Value.(*journaledMutation))
+	}
+	return
+}
+
+// reset replaces the journaled mutations with the ones loaded from a snapshot.
+func (j *retryJournal) reset(entries []*journaledMutation) {
+	j.Lock()
+	defer j.Unlock()
+	j.records = make(map[string]*list.Element, len(entries))
+	j.order = list.New()
+	for _, m := range entries {
+		if e, ok := j.records[m.ReqID]; ok {
+			j.order.Remove(e)
+		}
+		j.records[m.ReqID] = j.order.PushBack(m)
+	}
+}
+
+func (j *retryJournal) len() int {
+	j.Lock()
+	defer j.Unlock()
+	return j.order.Len()
+}
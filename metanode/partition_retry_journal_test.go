@@ -0,0 +1,171 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestRetryJournal(t *testing.T) {
+	j := newRetryJournal()
+	record := func(reqID string, now int64) {
+		j.record(&journaledMutation{ReqID: reqID, Time: now, Op: opFSMCreateDentry, Status: proto.OpOk})
+	}
+	record("a", 100)
+	if m, ok := j.lookup("a", 100+retryJournalWindow); !ok || m.Status != proto.OpOk {
+		t.Fatalf("mutation within the window is not found, %v", m)
+	}
+	if _, ok := j.lookup("a", 101+retryJournalWindow); ok {
+		t.Fatalf("mutation beyond the window is found")
+	}
+	record("b", 101+retryJournalWindow)
+	if _, ok := j.lookup("a", 100); ok || j.len() != 1 {
+		t.Fatalf("mutation beyond the window is kept, %v mutations", j.len())
+	}
+	for i := 0; i < retryJournalLimit; i++ {
+		record(fmt.Sprint(i), 200+retryJournalWindow)
+	}
+	if _, ok := j.lookup("b", 200+retryJournalWindow); ok || j.len() != retryJournalLimit {
+		t.Fatalf("mutations beyond the limit are kept, %v mutations", j.len())
+	}
+}
+
+func TestApplyRetriedMutation(t *testing.T) {
+	mp := &metaPartition{config: &MetaPartitionConfig{PartitionId: 1}, dentryTree: NewBtree(), inodeTree: NewBtree(),
+		dentryWatch: newDentryWatchTable(), retries: newRetryJournal()}
+	mp.inodeTree.ReplaceOrInsert(NewInode(1, proto.Mode(os.ModeDir|0755)), true)
+	dentry := &Dentry{ParentId: 1, Name: "f", Inode: 10, Type: proto.Mode(0644)}
+	value, err := dentry.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(op uint32, reqID string, now int64) interface{} {
+		cmd, err := (&MetaItem{Op: op, V: value, ReqID: reqID, Time: now}).MarshalJson()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mp.Apply(cmd, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := apply(opFSMCreateDentry, "create", 100); resp != proto.OpOk {
+		t.Fatalf("create dentry status %v", resp)
+	}
+	if resp, ok := apply(opFSMCreateDentry, "create", 110).(*replayedMutation); !ok || resp.resp != proto.OpOk {
+		t.Fatalf("retried create dentry is not replayed, %v", resp)
+	}
+	if resp := apply(opFSMDeleteDentry, "delete", 120).(*DentryResponse); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry status %v", resp.Status)
+	}
+	if resp, ok := apply(opFSMDeleteDentry, "delete", 130).(*replayedMutation); !ok ||
+		resp.resp.(*DentryResponse).Status != proto.OpOk || resp.resp.(*DentryResponse).Msg.Inode != 10 {
+		t.Fatalf("retried delete dentry is not replayed, %v", resp)
+	}
+	// the retry is not applied again, so the deleted dentry is not created again
+	apply(opFSMCreateDentry, "create", 140)
+	if d, _ := mp.getDentry(dentry); d != nil {
+		t.Fatalf("retried create dentry is applied again")
+	}
+	if resp := apply(opFSMCreateDentry, "create", 101+retryJournalWindow); resp != proto.OpOk {
+		t.Fatalf("mutation beyond the window is not applied, %v", resp)
+	}
+	if resp := apply(opFSMDeleteDentry, "", 102+retryJournalWindow).(*DentryResponse); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry status %v", resp.Status)
+	}
+	if resp := apply(opFSMDeleteDentry, "", 103+retryJournalWindow).(*DentryResponse); resp.Status != proto.OpNotExistErr {
+		t.Fatalf("mutation without request ID is replayed, status %v", resp.Status)
+	}
+}
+
+func TestRetryJournalReplicated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retry_journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newPartition := func(rootDir string) *metaPartition {
+		return NewMetaPartition(&MetaPartitionConfig{PartitionId: 1, Start: 1, End: 100, RootDir: rootDir}, nil).(*metaPartition)
+	}
+	apply := func(mp *metaPartition, op uint32, reqID string, now int64) interface{} {
+		value, err := (&Dentry{ParentId: 1, Name: "f", Inode: 10, Type: proto.Mode(0644)}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd, err := (&MetaItem{Op: op, V: value, ReqID: reqID, Time: now}).MarshalJson()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mp.Apply(cmd, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	checkReplayed := func(mp *metaPartition, source string) {
+		resp, ok := apply(mp, opFSMDeleteDentry, "delete", 130).(*replayedMutation)
+		if !ok {
+			t.Fatalf("retried delete dentry is not replayed by the partition %v", source)
+		}
+		if r := resp.resp.(*DentryResponse); r.Status != proto.OpOk || r.Msg == nil || r.Msg.Inode != 10 {
+			t.Fatalf("retried delete dentry is replayed by the partition %v with %v", source, r)
+		}
+		if _, ok = apply(mp, opFSMCreateDentry, "create", 140).(*replayedMutation); !ok {
+			t.Fatalf("retried create dentry is not replayed by the partition %v", source)
+		}
+	}
+
+	mp := newPartition(dir)
+	mp.inodeTree.ReplaceOrInsert(NewInode(1, proto.Mode(os.ModeDir|0755)), true)
+	apply(mp, opFSMCreateDentry, "create", 100)
+	apply(mp, opFSMDeleteDentry, "delete", 110)
+
+	sm := &storeMsg{
+		applyIndex:    1,
+		inodeTree:     mp.inodeTree.GetTree(),
+		dentryTree:    mp.dentryTree.GetTree(),
+		extendTree:    mp.extendTree.GetTree(),
+		multipartTree: mp.multipartTree.GetTree(),
+		retries:       mp.retries.entries(),
+	}
+	if err = mp.store(sm); err != nil {
+		t.Fatal(err)
+	}
+	restarted := newPartition(dir)
+	if err = restarted.LoadSnapshot(path.Join(dir, snapshotDir)); err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(restarted, "restarted")
+
+	iter, err := newMetaItemIterator(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower := newPartition(path.Join(dir, "follower"))
+	go func() {
+		<-follower.extReset
+	}()
+	if err = follower.ApplySnapshot(nil, iter); err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(follower, "restored from the snapshot")
+}
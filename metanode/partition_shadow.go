@@ -0,0 +1,307 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	shadowRouteTTL         = time.Minute
+	shadowMirrorTimeoutSec = 5
+)
+
+// shadowMirroredOps holds the mutations of the namespace mirrored to the shadow volume. The mutations of the extents
+// are not mirrored, since the extent keys refer to the data partitions of the volume: the clients write the data to
+// the shadow volume and append the extent keys to it by themselves.
+var shadowMirroredOps = map[uint8]bool{
+	proto.OpMetaCreateInode:       true,
+	proto.OpMetaLinkInode:         true,
+	proto.OpMetaUnlinkInode:       true,
+	proto.OpMetaBatchUnlinkInode:  true,
+	proto.OpMetaEvictInode:        true,
+	proto.OpMetaBatchEvictInode:   true,
+	proto.OpMetaDeleteInode:       true,
+	proto.OpMetaBatchDeleteInode:  true,
+	proto.OpMetaSetattr:           true,
+	proto.OpMetaCreateDentry:      true,
+	proto.OpMetaDeleteDentry:      true,
+	proto.OpMetaBatchDeleteDentry: true,
+	proto.OpMetaUpdateDentry:      true,
+	proto.OpMetaBatchRename:       true,
+	proto.OpMetaSetXAttr:          true,
+	proto.OpMetaRemoveXAttr:       true,
+}
+
+// shadowRoute caches the meta partitions of a shadow volume.
+type shadowRoute struct {
+	mps     []*proto.MetaPartitionView // sorted by the start
+	expires time.Time
+}
+
+// shadowRequest is a mirrored request sent to a meta partition of the shadow volume.
+type shadowRequest struct {
+	mp   *proto.MetaPartitionView
+	data []byte
+}
+
+// createInodeID returns the ID of the inode to create. The inode mirrored from the primary volume keeps its ID, which
+// must be in the range of the partition.
+func (mp *metaPartition) createInodeID(ino uint64) (uint64, error) {
+	if ino == 0 {
+		return mp.nextInodeID()
+	}
+	if ino < mp.config.Start || ino > mp.config.End {
+		return 0, ErrInodeIDOutOfRange
+	}
+	return ino, nil
+}
+
+// GetShadowFailures returns the number of the mutations of the partition failed to be mirrored to the shadow volume.
+func (mp *metaPartition) GetShadowFailures() uint64 {
+	return atomic.LoadUint64(&mp.shadowFailures)
+}
+
+func (mp *metaPartition) AddShadowFailure() {
+	atomic.AddUint64(&mp.shadowFailures, 1)
+}
+
+// prepareShadowMirror keeps the request served by the leader of a partition with a shadow volume, so that it is
+// mirrored before the reply is sent to the client.
+func prepareShadowMirror(mp MetaPartition, p *Packet) {
+	if !shadowMirroredOps[p.Opcode] {
+		return
+	}
+	if shadow := mp.GetBaseConfig().ShadowVol; shadow != "" {
+		p.shadowMp = mp
+		p.shadowVol = shadow
+		p.shadowReq = p.Data
+	}
+}
+
+// mirrorToShadow mirrors the request succeeded on the partition to the shadow volume synchronously. The request is
+// rewritten to the meta partitions of the shadow covering the inodes, with the same inode IDs and request IDs, so
+// that the retries of the clients are replayed by the shadow as well. The failures are only counted and reported to
+// the master, which marks the shadow out of sync, since the mutation is committed by the partition already.
+func (m *metadataManager) mirrorToShadow(p *Packet) {
+	mp, shadow, reqData := p.shadowMp, p.shadowVol, p.shadowReq
+	p.shadowMp, p.shadowReq = nil, nil
+	if p.ResultCode != proto.OpOk {
+		return
+	}
+	var err error
+	for i := 0; i < 2; i++ {
+		var reqs []*shadowRequest
+		if reqs, err = m.shadowRequests(shadow, p.Opcode, reqData, p.Data, i > 0); err != nil {
+			break
+		}
+		if err = m.sendShadowRequests(shadow, p.Opcode, reqs); err == nil {
+			return
+		}
+	}
+	mp.AddShadowFailure()
+	log.LogErrorf("mirrorToShadow: partition(%v) shadow(%v) req(%v) op(%v) failed: %v",
+		mp.GetBaseConfig().PartitionId, shadow, p.GetReqID(), p.GetOpMsg(), err)
+}
+
+func (m *metadataManager) sendShadowRequests(shadow string, op uint8, reqs []*shadowRequest) (err error) {
+	for _, req := range reqs {
+		if err = m.sendShadowRequest(shadow, op, req); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m *metadataManager) sendShadowRequest(shadow string, op uint8, req *shadowRequest) (err error) {
+	addr := req.mp.LeaderAddr
+	if addr == "" && len(req.mp.Members) > 0 {
+		addr = req.mp.Members[0]
+	}
+	if addr == "" {
+		return fmt.Errorf("shadow partition(%v) has no replica", req.mp.PartitionID)
+	}
+	p := proto.NewPacketReqID()
+	p.Opcode = op
+	p.Data = req.data
+	p.Size = uint32(len(req.data))
+	// the shadow requiring the delegated tokens serves the mirrored requests with an internal one
+	p.Arg = proto.AttachDelegatedToken(nil, proto.NewInternalDelegatedToken(shadow, []byte(m.tokenSigningKey)))
+	p.ArgLen = uint32(len(p.Arg))
+	conn, err := m.connPool.GetConnect(addr)
+	if err != nil {
+		return
+	}
+	if err = p.WriteToConn(conn); err == nil {
+		err = p.ReadFromConn(conn, shadowMirrorTimeoutSec)
+	}
+	m.connPool.PutConnect(conn, err != nil)
+	if err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		return fmt.Errorf("shadow partition(%v) addr(%v) replied %v", req.mp.PartitionID, addr, p.GetResultMsg())
+	}
+	return
+}
+
+// shadowPartitions returns the meta partitions of the shadow volume, which are refreshed from the master periodically
+// or on demand.
+func (m *metadataManager) shadowPartitions(shadow string, refresh bool) (mps []*proto.MetaPartitionView, err error) {
+	if val, ok := m.shadowRoutes.Load(shadow); ok && !refresh {
+		if route := val.(*shadowRoute); time.Now().Before(route.expires) {
+			return route.mps, nil
+		}
+	}
+	if mps, err = masterClient.ClientAPI().GetMetaPartitions(shadow); err != nil {
+		return
+	}
+	sort.Slice(mps, func(i, j int) bool { return mps[i].Start < mps[j].Start })
+	m.shadowRoutes.Store(shadow, &shadowRoute{mps: mps, expires: time.Now().Add(shadowRouteTTL)})
+	return
+}
+
+func shadowPartitionOf(mps []*proto.MetaPartitionView, ino uint64) (*proto.MetaPartitionView, error) {
+	i := sort.Search(len(mps), func(i int) bool { return mps[i].End >= ino })
+	if i == len(mps) || mps[i].Start > ino {
+		return nil, fmt.Errorf("no shadow partition covers inode(%v)", ino)
+	}
+	return mps[i], nil
+}
+
+// shadowRequests rewrites the request to the meta partitions of the shadow volume. The dentry operations are routed
+// by the parent inode, and the batch operations on the inodes are split by the partitions covering them. A rename
+// across two partitions of the shadow links the destination dentries first and unlinks the source ones next, the
+// same as the clients move the dentries across the partitions.
+func (m *metadataManager) shadowRequests(shadow string, op uint8, reqData, reply []byte, refresh bool) (reqs []*shadowRequest, err error) {
+	mps, err := m.shadowPartitions(shadow, refresh)
+	if err != nil {
+		return
+	}
+	fields := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(reqData))
+	decoder.UseNumber()
+	if err = decoder.Decode(&fields); err != nil {
+		return
+	}
+	if op == proto.OpMetaCreateInode {
+		resp := &CreateInoResp{}
+		if err = json.Unmarshal(reply, resp); err != nil {
+			return
+		}
+		if resp.Info == nil {
+			return nil, fmt.Errorf("no inode replied")
+		}
+		fields["ino"] = resp.Info.Inode
+	}
+	add := func(ino uint64, fields map[string]interface{}) error {
+		mp, err := shadowPartitionOf(mps, ino)
+		if err != nil {
+			return err
+		}
+		fields["vol"] = shadow
+		fields["pid"] = mp.PartitionID
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, &shadowRequest{mp: mp, data: data})
+		return nil
+	}
+
+	switch {
+	case op == proto.OpMetaBatchRename:
+		src, _ := jsonUint64(fields["srcPid"])
+		dst, _ := jsonUint64(fields["dstPid"])
+		if src == 0 || dst == 0 {
+			err = add(src+dst, fields)
+			return
+		}
+		srcMp, e1 := shadowPartitionOf(mps, src)
+		dstMp, e2 := shadowPartitionOf(mps, dst)
+		if e1 != nil || e2 != nil || srcMp == dstMp {
+			err = add(dst, fields)
+			return
+		}
+		link, unlink := copyFields(fields), copyFields(fields)
+		link["srcPid"], unlink["dstPid"] = 0, 0
+		if err = add(dst, link); err != nil {
+			return
+		}
+		err = add(src, unlink)
+	case fields["pino"] != nil:
+		pino, _ := jsonUint64(fields["pino"])
+		err = add(pino, fields)
+	default:
+		key := "ino"
+		if _, ok := fields["inos"]; ok {
+			key = "inos"
+		}
+		if ino, ok := jsonUint64(fields[key]); ok {
+			err = add(ino, fields)
+			return
+		}
+		inos, _ := fields[key].([]interface{})
+		groups := make(map[uint64][]uint64)
+		order := make([]uint64, 0)
+		for _, val := range inos {
+			ino, _ := jsonUint64(val)
+			mp, e := shadowPartitionOf(mps, ino)
+			if e != nil {
+				return nil, e
+			}
+			if _, ok := groups[mp.Start]; !ok {
+				order = append(order, mp.Start)
+			}
+			groups[mp.Start] = append(groups[mp.Start], ino)
+		}
+		for _, start := range order {
+			group := copyFields(fields)
+			group[key] = groups[start]
+			if err = add(start, group); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		cp[k] = v
+	}
+	return cp
+}
+
+func jsonUint64(val interface{}) (uint64, bool) {
+	switch v := val.(type) {
+	case json.Number:
+		n, err := strconv.ParseUint(v.String(), 10, 64)
+		return n, err == nil
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestShadowRequests(t *testing.T) {
+	m := &metadataManager{}
+	m.shadowRoutes.Store("shadow", &shadowRoute{
+		mps: []*proto.MetaPartitionView{
+			{PartitionID: 11, Start: 0, End: 100},
+			{PartitionID: 12, Start: 101, End: 1 << 62},
+		},
+		expires: time.Now().Add(time.Hour),
+	})
+	rewrite := func(op uint8, req interface{}, reply interface{}) []*shadowRequest {
+		reqData, _ := json.Marshal(req)
+		replyData, _ := json.Marshal(reply)
+		reqs, err := m.shadowRequests("shadow", op, reqData, replyData, false)
+		if err != nil {
+			t.Fatalf("op(%v) err %v", op, err)
+		}
+		return reqs
+	}
+
+	reqs := rewrite(proto.OpMetaCreateInode, &proto.CreateInodeRequest{VolName: "vol", PartitionID: 1, Mode: 0644, ReqID: "r1"},
+		&proto.CreateInodeResponse{Info: &proto.InodeInfo{Inode: 150}})
+	create := &proto.CreateInodeRequest{}
+	if len(reqs) != 1 || reqs[0].mp.PartitionID != 12 || json.Unmarshal(reqs[0].data, create) != nil {
+		t.Fatalf("unexpected create requests %v", reqs)
+	}
+	if create.VolName != "shadow" || create.PartitionID != 12 || create.Inode != 150 || create.Mode != 0644 || create.ReqID != "r1" {
+		t.Errorf("unexpected mirrored create request %+v", create)
+	}
+
+	reqs = rewrite(proto.OpMetaCreateDentry, &proto.CreateDentryRequest{VolName: "vol", PartitionID: 1, ParentID: 1, Inode: 150, Name: "f"}, nil)
+	if len(reqs) != 1 || reqs[0].mp.PartitionID != 11 {
+		t.Errorf("dentry is not routed by the parent inode, %v", reqs)
+	}
+
+	reqs = rewrite(proto.OpMetaBatchUnlinkInode, &proto.BatchUnlinkInodeRequest{VolName: "vol", PartitionID: 1, Inodes: []uint64{5, 150, 6}}, nil)
+	if len(reqs) != 2 {
+		t.Fatalf("batch is not split by the shadow partitions, %v", reqs)
+	}
+	for i, expect := range [][]uint64{{5, 6}, {150}} {
+		batch := &proto.BatchUnlinkInodeRequest{}
+		if err := json.Unmarshal(reqs[i].data, batch); err != nil {
+			t.Fatal(err)
+		}
+		if len(batch.Inodes) != len(expect) || batch.Inodes[0] != expect[0] || batch.PartitionID != reqs[i].mp.PartitionID {
+			t.Errorf("unexpected batch %+v, expect inodes %v", batch, expect)
+		}
+	}
+
+	reqs = rewrite(proto.OpMetaBatchRename, &proto.BatchRenameRequest{VolName: "vol", PartitionID: 1, SrcParentID: 5, DstParentID: 150,
+		Items: []proto.BatchRenameItem{{SrcName: "a", DstName: "b", Inode: 7}}}, nil)
+	if len(reqs) != 2 {
+		t.Fatalf("rename across the shadow partitions is not split, %v", reqs)
+	}
+	link, unlink := &proto.BatchRenameRequest{}, &proto.BatchRenameRequest{}
+	if json.Unmarshal(reqs[0].data, link) != nil || json.Unmarshal(reqs[1].data, unlink) != nil {
+		t.Fatalf("unexpected rename requests %v", reqs)
+	}
+	if link.PartitionID != 12 || link.SrcParentID != 0 || link.DstParentID != 150 || len(link.Items) != 1 {
+		t.Errorf("unexpected link request %+v", link)
+	}
+	if unlink.PartitionID != 11 || unlink.SrcParentID != 5 || unlink.DstParentID != 0 {
+		t.Errorf("unexpected unlink request %+v", unlink)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const (
+	defaultSnapshotDiffLimit = 1000
+	maxSnapshotDiffLimit     = 10000
+
+	// the markers of the snapshot diff, the dentries are compared before the inodes
+	snapshotDiffDentryMarker = "d"
+	snapshotDiffInodeMarker  = "i"
+)
+
+// SnapshotDiff lists the changes of the partition from the view as of req.From to the view as of req.To. The
+// dentries of both views are compared in their order first, then the inodes, so that a page ends at a dentry or an
+// inode which the next page starts after.
+func (mp *metaPartition) SnapshotDiff(req *proto.SnapshotDiffRequest, p *Packet) (err error) {
+	if req.From <= 0 || (req.To != 0 && req.To < req.From) {
+		err = fmt.Errorf("bad snapshot diff from %v to %v", req.From, req.To)
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte(err.Error()))
+		return
+	}
+	from, ok := mp.historyOf(req.From, p)
+	if !ok {
+		return
+	}
+	to, ok := mp.historyOf(req.To, p)
+	if !ok {
+		return
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSnapshotDiffLimit
+	} else if limit > maxSnapshotDiffLimit {
+		limit = maxSnapshotDiffLimit
+	}
+	resp, err := diffPartitionViews(from, to, req.Marker, limit)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte(err.Error()))
+		return
+	}
+	resp.PartitionID = mp.config.PartitionId
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// diffPartitionViews compares the trees of two views of a partition after the marker. The trees of the current
+// partition are cloned, so that they are not changed during the comparison.
+func diffPartitionViews(from, to *metaPartition, marker string, limit int) (resp *proto.SnapshotDiffResponse, err error) {
+	resp = &proto.SnapshotDiffResponse{
+		FromApplyID: atomic.LoadUint64(&from.applyID),
+		ToApplyID:   atomic.LoadUint64(&to.applyID),
+		Entries:     make([]*proto.SnapshotDiffEntry, 0),
+	}
+	var (
+		afterDentry *Dentry
+		afterInode  *Inode
+	)
+	stage := snapshotDiffDentryMarker
+	if marker != "" {
+		if stage, afterDentry, afterInode, err = parseSnapshotDiffMarker(marker); err != nil {
+			return
+		}
+	}
+	if stage == snapshotDiffDentryMarker {
+		var next *Dentry
+		resp.Entries, next = diffDentries(from.dentryTree.GetTree(), to.dentryTree.GetTree(), afterDentry, limit)
+		if next != nil {
+			resp.NextMarker = dentryDiffMarker(next)
+			return
+		}
+	}
+	next := diffInodes(from.inodeTree.GetTree(), to.inodeTree.GetTree(), afterInode, limit-len(resp.Entries),
+		&resp.Entries)
+	if next != nil {
+		resp.NextMarker = inodeDiffMarker(next)
+	}
+	return
+}
+
+func dentryDiffMarker(d *Dentry) string {
+	return fmt.Sprintf("%v/%v/%v", snapshotDiffDentryMarker, d.ParentId, d.Name)
+}
+
+func inodeDiffMarker(ino *Inode) string {
+	return fmt.Sprintf("%v/%v", snapshotDiffInodeMarker, ino.Inode)
+}
+
+func parseSnapshotDiffMarker(marker string) (stage string, dentry *Dentry, inode *Inode, err error) {
+	parts := strings.SplitN(marker, "/", 3)
+	switch {
+	case parts[0] == snapshotDiffDentryMarker && len(parts) == 3:
+		dentry = &Dentry{Name: parts[2]}
+		dentry.ParentId, err = strconv.ParseUint(parts[1], 10, 64)
+	case parts[0] == snapshotDiffInodeMarker && len(parts) == 2:
+		inode = NewInode(0, 0)
+		inode.Inode, err = strconv.ParseUint(parts[1], 10, 64)
+	default:
+		err = fmt.Errorf("bad marker %v", marker)
+	}
+	if err != nil {
+		err = fmt.Errorf("bad marker %v", marker)
+	}
+	return parts[0], dentry, inode, err
+}
+
+// ascendAfter returns at most n items of the tree after the item, or from the beginning if it is nil.
+func ascendAfter(tree *BTree, after BtreeItem, n int) (items []BtreeItem) {
+	collect := func(i BtreeItem) bool {
+		if after != nil && !after.Less(i) {
+			return true
+		}
+		items = append(items, i)
+		return len(items) < n
+	}
+	if after == nil {
+		tree.Ascend(collect)
+	} else {
+		tree.AscendGreaterOrEqual(after, collect)
+	}
+	return
+}
+
+// mergeViews walks the items of both trees after the item in their order, and calls diff with the item of each tree
+// of the same key, nil if the tree has none. The walk stops once diff returns false, at the item returned as next,
+// or next is nil once both trees are walked through.
+func mergeViews(from, to *BTree, after BtreeItem, batch int, diff func(old, new BtreeItem) bool) (next BtreeItem) {
+	for {
+		olds, news := ascendAfter(from, after, batch), ascendAfter(to, after, batch)
+		// the items beyond the last one of a full batch are not fetched from that tree yet
+		var bound BtreeItem
+		if len(olds) == batch {
+			bound = olds[batch-1]
+		}
+		if len(news) == batch && (bound == nil || news[batch-1].Less(bound)) {
+			bound = news[batch-1]
+		}
+		i, j := 0, 0
+		for i < len(olds) || j < len(news) {
+			var old, new BtreeItem
+			switch {
+			case j == len(news) || (i < len(olds) && olds[i].Less(news[j])):
+				old = olds[i]
+				i++
+			case i == len(olds) || news[j].Less(olds[i]):
+				new = news[j]
+				j++
+			default:
+				old, new = olds[i], news[j]
+				i++
+				j++
+			}
+			key := old
+			if key == nil {
+				key = new
+			}
+			if bound != nil && bound.Less(key) {
+				break
+			}
+			if !diff(old, new) {
+				return key
+			}
+		}
+		if bound == nil {
+			return nil
+		}
+		after = bound
+	}
+}
+
+// diffDentries lists the dentries created, deleted or pointed to another inode, at most limit of them.
+func diffDentries(from, to *BTree, after *Dentry, limit int) (entries []*proto.SnapshotDiffEntry, next *Dentry) {
+	entries = make([]*proto.SnapshotDiffEntry, 0)
+	var start BtreeItem
+	if after != nil {
+		start = after
+	}
+	last := mergeViews(from, to, start, limit, func(old, new BtreeItem) bool {
+		var entry *proto.SnapshotDiffEntry
+		switch {
+		case old == nil:
+			d := new.(*Dentry)
+			entry = &proto.SnapshotDiffEntry{Type: proto.SnapshotDiffCreated, ParentID: d.ParentId, Name: d.Name,
+				Inode: d.Inode, Mode: d.Type}
+		case new == nil:
+			d := old.(*Dentry)
+			entry = &proto.SnapshotDiffEntry{Type: proto.SnapshotDiffDeleted, ParentID: d.ParentId, Name: d.Name,
+				Inode: d.Inode, Mode: d.Type}
+		default:
+			o, d := old.(*Dentry), new.(*Dentry)
+			if o.Inode == d.Inode {
+				return true
+			}
+			entry = &proto.SnapshotDiffEntry{Type: proto.SnapshotDiffModified, ParentID: d.ParentId, Name: d.Name,
+				Inode: d.Inode, OldInode: o.Inode, Mode: d.Type}
+		}
+		entries = append(entries, entry)
+		return len(entries) < limit
+	})
+	if last != nil {
+		next = last.(*Dentry)
+	}
+	return
+}
+
+// diffInodes lists the inodes modified in place into the entries, at most limit of them. The inodes created or
+// deleted are not listed, which are listed by their dentries, nor are the directories, whose changes are the
+// dentries in them.
+func diffInodes(from, to *BTree, after *Inode, limit int, entries *[]*proto.SnapshotDiffEntry) (next *Inode) {
+	if limit <= 0 {
+		// the dentries fill the page, the inodes start from the beginning on the next page
+		return NewInode(0, 0)
+	}
+	var start BtreeItem
+	if after != nil {
+		start = after
+	}
+	listed := 0
+	last := mergeViews(from, to, start, limit, func(old, new BtreeItem) bool {
+		if old == nil || new == nil {
+			return true
+		}
+		o, ino := old.(*Inode), new.(*Inode)
+		// the nanoseconds are not compared, which are not persisted with inodeTimeExtEnabled off
+		if proto.IsDir(ino.Type) || o.Size == ino.Size && o.Generation == ino.Generation && o.ModifyTime == ino.ModifyTime {
+			return true
+		}
+		*entries = append(*entries, &proto.SnapshotDiffEntry{Type: proto.SnapshotDiffModified, Inode: ino.Inode,
+			Mode: ino.Type, Size: ino.Size, ModifyTime: ino.ModifyTime})
+		listed++
+		return listed < limit
+	})
+	if last != nil {
+		next = last.(*Inode)
+	}
+	return
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manager := &metadataManager{retainSnapshots: 2, retainSnapshotInterval: time.Minute}
+	mp := NewMetaPartition(&MetaPartitionConfig{PartitionId: 1, Start: 1, End: 100, RootDir: dir}, manager).(*metaPartition)
+	sm := func(applyID uint64) *storeMsg {
+		return &storeMsg{
+			applyIndex:    applyID,
+			inodeTree:     mp.inodeTree.GetTree(),
+			dentryTree:    mp.dentryTree.GetTree(),
+			extendTree:    mp.extendTree.GetTree(),
+			multipartTree: mp.multipartTree.GetTree(),
+		}
+	}
+	now := time.Now()
+	file := func(ino uint64) *Inode {
+		inode := NewInode(ino, proto.Mode(0644))
+		inode.ModifyTime = now.Unix()
+		return inode
+	}
+	mp.fsmCreateInode(NewInode(1, proto.Mode(os.ModeDir|0755)))
+	for ino := uint64(2); ino <= 5; ino++ {
+		mp.fsmCreateInode(file(ino))
+	}
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "kept", Inode: 2, Type: proto.Mode(0644)}, false)
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "deleted", Inode: 3, Type: proto.Mode(0644)}, false)
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "replaced", Inode: 4, Type: proto.Mode(0644)}, false)
+	if err = mp.store(sm(10)); err != nil {
+		t.Fatal(err)
+	}
+	if err = mp.retainSnapshot(10, now); err != nil {
+		t.Fatal(err)
+	}
+
+	mp.fsmDeleteDentry(&Dentry{ParentId: 1, Name: "deleted"}, false)
+	mp.fsmUpdateDentry(&Dentry{ParentId: 1, Name: "replaced", Inode: 5})
+	mp.fsmCreateInode(file(6))
+	mp.fsmCreateDentry(&Dentry{ParentId: 1, Name: "created", Inode: 6, Type: proto.Mode(0644)}, false)
+	modified := file(2)
+	modified.Size = 4096
+	modified.ModifyTime = now.Unix() + 1
+	mp.inodeTree.ReplaceOrInsert(modified, true)
+
+	p := &Packet{}
+	if err = mp.SnapshotDiff(&proto.SnapshotDiffRequest{PartitionID: 1, From: now.Unix()}, p); err != nil ||
+		p.ResultCode != proto.OpOk {
+		t.Fatalf("diff with the current tree: status %v err %v", p.ResultCode, err)
+	}
+	resp := &proto.SnapshotDiffResponse{}
+	if err = json.Unmarshal(p.Data, resp); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"created 1/created 6",
+		"deleted 1/deleted 3",
+		"modified 1/replaced 5 from 4",
+		"modified inode 2 size 4096",
+	}
+	if got := describeDiff(resp.Entries); !reflect.DeepEqual(got, expected) || resp.NextMarker != "" ||
+		resp.FromApplyID != 10 {
+		t.Fatalf("expect %v from apply 10, but got %v from apply %v marker %v", expected, got, resp.FromApplyID,
+			resp.NextMarker)
+	}
+
+	// the pages of a single change list the same changes
+	var paged []*proto.SnapshotDiffEntry
+	marker := ""
+	for i := 0; ; i++ {
+		if i > len(expected) {
+			t.Fatalf("the pages do not end, marker %v", marker)
+		}
+		page, err := diffPartitionViews(mustHistory(t, mp, now.Unix()), mp, marker, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page.Entries...)
+		if marker = page.NextMarker; marker == "" {
+			break
+		}
+	}
+	if got := describeDiff(paged); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expect the pages %v, but got %v", expected, got)
+	}
+
+	p = &Packet{}
+	if err = mp.SnapshotDiff(&proto.SnapshotDiffRequest{PartitionID: 1, From: now.Unix() - 1}, p); err != nil ||
+		p.ResultCode != proto.OpNotExistErr {
+		t.Fatalf("the diff before the retained snapshots should fail, status %v err %v", p.ResultCode, err)
+	}
+	p = &Packet{}
+	if mp.SnapshotDiff(&proto.SnapshotDiffRequest{PartitionID: 1, From: now.Unix(), Marker: "x/1"}, p); p.ResultCode != proto.OpArgMismatchErr {
+		t.Fatalf("the bad marker should be refused, status %v", p.ResultCode)
+	}
+}
+
+// TestMergeViews compares the trees of more items than the batch, whose batches end at different keys.
+func TestMergeViews(t *testing.T) {
+	from, to := NewBtree(), NewBtree()
+	for ino := uint64(1); ino <= 20; ino++ {
+		if ino%3 != 0 {
+			from.ReplaceOrInsert(NewInode(ino, 0), true)
+		}
+		if ino%4 != 0 {
+			to.ReplaceOrInsert(NewInode(ino, 0), true)
+		}
+	}
+	var onlyOld, onlyNew, both []uint64
+	next := mergeViews(from, to, nil, 3, func(old, new BtreeItem) bool {
+		switch {
+		case new == nil:
+			onlyOld = append(onlyOld, old.(*Inode).Inode)
+		case old == nil:
+			onlyNew = append(onlyNew, new.(*Inode).Inode)
+		default:
+			both = append(both, new.(*Inode).Inode)
+		}
+		return true
+	})
+	if next != nil {
+		t.Fatalf("expect the trees walked through, but stop at %v", next)
+	}
+	if fmt.Sprint(onlyOld) != "[4 8 16 20]" || fmt.Sprint(onlyNew) != "[3 6 9 15 18]" || len(both) != 10 {
+		t.Fatalf("unexpected merge old %v new %v both %v", onlyOld, onlyNew, both)
+	}
+}
+
+func mustHistory(t *testing.T, mp *metaPartition, asOf int64) *metaPartition {
+	view, err := mp.loadHistoryView(asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+func describeDiff(entries []*proto.SnapshotDiffEntry) (got []string) {
+	for _, e := range entries {
+		switch {
+		case e.ParentID == 0:
+			got = append(got, fmt.Sprintf("%v inode %v size %v", e.Type, e.Inode, e.Size))
+		case e.OldInode != 0:
+			got = append(got, fmt.Sprintf("%v %v/%v %v from %v", e.Type, e.ParentID, e.Name, e.Inode, e.OldInode))
+		default:
+			got = append(got, fmt.Sprintf("%v %v/%v %v", e.Type, e.ParentID, e.Name, e.Inode))
+		}
+	}
+	return
+}
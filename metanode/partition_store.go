@@ -30,6 +30,7 @@ import (
 	"github.com/chubaofs/chubaofs/util/log"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/atomicfile"
 	"github.com/chubaofs/chubaofs/util/errors"
 	mmap "github.com/edsrzf/mmap-go"
 )
@@ -42,7 +43,9 @@ const (
 	dentryFile      = "dentry"
 	extendFile      = "extend"
 	multipartFile   = "multipart"
+	retryFile       = "retry"
 	applyIDFile     = "apply"
+	applyIDFileTmp  = ".apply"
 	SnapshotSign    = ".sign"
 	metadataFile    = "meta"
 	metadataFileTmp = ".meta"
@@ -50,16 +53,13 @@ const (
 
 func (mp *metaPartition) loadMetadata() (err error) {
 	metaFile := path.Join(mp.config.RootDir, metadataFile)
-	fp, err := os.OpenFile(metaFile, os.O_RDONLY, 0644)
+	data, err := atomicfile.ReadFile(metaFile)
 	if err != nil {
-		err = errors.NewErrorf("[loadMetadata]: OpenFile %s", err.Error())
+		err = errors.NewErrorf("[loadMetadata]: ReadFile %s", err.Error())
 		return
 	}
-	defer fp.Close()
-	data, err := ioutil.ReadAll(fp)
-	if err != nil || len(data) == 0 {
-		err = errors.NewErrorf("[loadMetadata]: ReadFile %s, data: %s", err.Error(),
-			string(data))
+	if len(data) == 0 {
+		err = errors.NewErrorf("[loadMetadata]: metadata is empty")
 		return
 	}
 	mConf := &MetaPartitionConfig{}
@@ -77,6 +77,11 @@ func (mp *metaPartition) loadMetadata() (err error) {
 	mp.config.Start = mConf.Start
 	mp.config.End = mConf.End
 	mp.config.Peers = mConf.Peers
+	mp.config.RaftDir = mConf.RaftDir
+	mp.config.Frozen = mConf.Frozen
+	mp.config.Degraded = mConf.Degraded
+	mp.config.CaseInsensitive = mConf.CaseInsensitive
+	mp.config.ShadowVol = mConf.ShadowVol
 	mp.config.Cursor = mp.config.Start
 
 	log.LogInfof("loadMetadata: load complete: partitionID(%v) volume(%v) range(%v,%v) cursor(%v)",
@@ -295,13 +300,33 @@ func (mp *metaPartition) loadMultipart(rootDir string) error {
 	return nil
 }
 
+// loadRetryJournal loads the retry journal, which is missing in the snapshots of the older versions.
+func (mp *metaPartition) loadRetryJournal(rootDir string) (err error) {
+	filename := path.Join(rootDir, retryFile)
+	if _, err = os.Stat(filename); err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.NewErrorf("[loadRetryJournal] ReadFile: %s", err.Error())
+	}
+	var entries []*journaledMutation
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return errors.NewErrorf("[loadRetryJournal] Unmarshal: %s", err.Error())
+	}
+	mp.retries.reset(entries)
+	log.LogInfof("loadRetryJournal: load complete: partitionID(%v) volume(%v) mutations(%v) filename(%v)",
+		mp.config.PartitionId, mp.config.VolName, len(entries), filename)
+	return
+}
+
 func (mp *metaPartition) loadApplyID(rootDir string) (err error) {
 	filename := path.Join(rootDir, applyIDFile)
 	if _, err = os.Stat(filename); err != nil {
 		err = nil
 		return
 	}
-	data, err := ioutil.ReadFile(filename)
+	data, err := atomicfile.ReadFile(filename)
 	if err != nil {
 		if err == os.ErrNotExist {
 			err = nil
@@ -341,26 +366,12 @@ func (mp *metaPartition) persistMetadata() (err error) {
 
 	// TODO Unhandled errors
 	os.MkdirAll(mp.config.RootDir, 0755)
-	filename := path.Join(mp.config.RootDir, metadataFileTmp)
-	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_TRUNC|os.O_APPEND|os.O_CREATE, 0755)
-	if err != nil {
-		return
-	}
-	defer func() {
-		// TODO Unhandled errors
-		fp.Sync()
-		fp.Close()
-		os.Remove(filename)
-	}()
 
 	data, err := json.Marshal(mp.config)
 	if err != nil {
 		return
 	}
-	if _, err = fp.Write(data); err != nil {
-		return
-	}
-	if err = os.Rename(filename, path.Join(mp.config.RootDir, metadataFile)); err != nil {
+	if err = atomicfile.WriteFile(path.Join(mp.config.RootDir, metadataFile), metadataFileTmp, data, 0755); err != nil {
 		return
 	}
 	log.LogInfof("persistMetata: persist complete: partitionID(%v) volume(%v) range(%v,%v) cursor(%v)",
@@ -370,16 +381,8 @@ func (mp *metaPartition) persistMetadata() (err error) {
 
 func (mp *metaPartition) storeApplyID(rootDir string, sm *storeMsg) (err error) {
 	filename := path.Join(rootDir, applyIDFile)
-	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_TRUNC|os.
-		O_CREATE, 0755)
-	if err != nil {
-		return
-	}
-	defer func() {
-		err = fp.Sync()
-		fp.Close()
-	}()
-	if _, err = fp.WriteString(fmt.Sprintf("%d|%d", sm.applyIndex, atomic.LoadUint64(&mp.config.Cursor))); err != nil {
+	data := []byte(fmt.Sprintf("%d|%d", sm.applyIndex, atomic.LoadUint64(&mp.config.Cursor)))
+	if err = atomicfile.WriteFile(filename, applyIDFileTmp, data, 0755); err != nil {
 		return
 	}
 	log.LogInfof("storeApplyID: store complete: partitionID(%v) volume(%v) applyID(%v)",
@@ -604,3 +607,34 @@ func (mp *metaPartition) storeMultipart(rootDir string, sm *storeMsg) (crc uint3
 		mp.config.PartitionId, mp.config.VolName, multipartTree.Len(), crc)
 	return
 }
+
+func (mp *metaPartition) storeRetryJournal(rootDir string, sm *storeMsg) (crc uint32, err error) {
+	retries := sm.retries
+	if retries == nil {
+		retries = make([]*journaledMutation, 0)
+	}
+	data, err := json.Marshal(retries)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path.Join(rootDir, retryFile), os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	crc = crc32.ChecksumIEEE(data)
+	log.LogInfof("storeRetryJournal: store complete: partitoinID(%v) volume(%v) mutations(%v) crc(%v)",
+		mp.config.PartitionId, mp.config.VolName, len(retries), crc)
+	return
+}
@@ -31,6 +31,7 @@ type storeMsg struct {
 	dentryTree    *BTree
 	extendTree    *BTree
 	multipartTree *BTree
+	retries       []*journaledMutation
 }
 
 func (mp *metaPartition) startSchedule(curIndex uint64) {
@@ -52,6 +53,9 @@ func (mp *metaPartition) startSchedule(curIndex uint64) {
 					" truncate raft log")
 			}
 			curIndex = msg.applyIndex
+			if err = mp.retainSnapshot(msg.applyIndex, time.Now()); err != nil {
+				log.LogWarnf("[startSchedule] partitionId=%d: retain snapshot: %v", mp.config.PartitionId, err)
+			}
 		} else {
 			// retry again
 			mp.storeChan <- msg
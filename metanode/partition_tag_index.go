@@ -0,0 +1,135 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// tagOfXAttrKey returns the tag of an xattr key, which is empty if the key is not of a tag.
+func tagOfXAttrKey(key []byte) string {
+	tag := strings.TrimPrefix(string(key), proto.XAttrKeyTagPrefix)
+	if len(tag) == len(key) {
+		return ""
+	}
+	return tag
+}
+
+// tagIndex indexes the inodes of the partition by the tags attached to them, with the names the inodes are tagged
+// with. Like the extend tree, it is only changed by the raft commands, and rebuilt from the extend tree after loading
+// the partition, so the tags are listed without walking through the extend tree.
+type tagIndex struct {
+	sync.RWMutex
+	inodes map[string]map[uint64]string
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{inodes: make(map[string]map[uint64]string)}
+}
+
+func (idx *tagIndex) set(tag string, ino uint64, name string) {
+	idx.Lock()
+	defer idx.Unlock()
+	inodes, ok := idx.inodes[tag]
+	if !ok {
+		inodes = make(map[uint64]string)
+		idx.inodes[tag] = inodes
+	}
+	inodes[ino] = name
+}
+
+func (idx *tagIndex) remove(tag string, ino uint64) {
+	idx.Lock()
+	defer idx.Unlock()
+	inodes, ok := idx.inodes[tag]
+	if !ok {
+		return
+	}
+	delete(inodes, ino)
+	if len(inodes) == 0 {
+		delete(idx.inodes, tag)
+	}
+}
+
+// addExtend indexes the tags in the xattrs of the extend.
+func (idx *tagIndex) addExtend(extend *Extend) {
+	extend.Range(func(key, value []byte) bool {
+		if tag := tagOfXAttrKey(key); tag != "" {
+			idx.set(tag, extend.inode, string(value))
+		}
+		return true
+	})
+}
+
+// removeExtend removes the tags in the xattrs of the extend from the index.
+func (idx *tagIndex) removeExtend(extend *Extend) {
+	extend.Range(func(key, _ []byte) bool {
+		if tag := tagOfXAttrKey(key); tag != "" {
+			idx.remove(tag, extend.inode)
+		}
+		return true
+	})
+}
+
+// entries returns the inodes attached with the tag in the ascending order, skipping those not accepted by alive.
+func (idx *tagIndex) entries(tag string, alive func(ino uint64) bool) []*proto.TagEntry {
+	idx.RLock()
+	defer idx.RUnlock()
+	entries := make([]*proto.TagEntry, 0, len(idx.inodes[tag]))
+	for ino, name := range idx.inodes[tag] {
+		if alive(ino) {
+			entries = append(entries, &proto.TagEntry{Inode: ino, Name: name})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Inode < entries[j].Inode })
+	return entries
+}
+
+// tags returns the tags attached to any inode accepted by alive.
+func (idx *tagIndex) tags(alive func(ino uint64) bool) []string {
+	idx.RLock()
+	defer idx.RUnlock()
+	tags := make([]string, 0, len(idx.inodes))
+	for tag, inodes := range idx.inodes {
+		for ino := range inodes {
+			if alive(ino) {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (idx *tagIndex) reset(inodes map[string]map[uint64]string) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.inodes = inodes
+}
+
+// rebuildTagIndex rebuilds the index from the extend tree.
+func (mp *metaPartition) rebuildTagIndex() {
+	rebuilt := newTagIndex()
+	mp.extendTree.Ascend(func(i BtreeItem) bool {
+		rebuilt.addExtend(i.(*Extend))
+		return true
+	})
+	mp.tags.reset(rebuilt.inodes)
+}
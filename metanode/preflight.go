@@ -0,0 +1,101 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/preflight"
+)
+
+// Preflight checks the config of the meta node and its environment without starting it.
+func Preflight(cfg *config.Config) *preflight.Report {
+	return preflightCheck(cfg)
+}
+
+func preflightCheck(cfg *config.Config, ownPorts ...string) (r *preflight.Report) {
+	r = preflight.NewReport(proto.NodeRoleMeta, ownPorts...)
+	if !r.Required(cfg, proto.ListenPort, cfgMetadataDir, cfgRaftDir, cfgRaftHeartbeatPort, cfgRaftReplicaPort,
+		cfgTotalMem) {
+		return
+	}
+	totalMem, err := strconv.ParseUint(cfg.GetString(cfgTotalMem), 10, 64)
+	if err == nil && totalMem == 0 {
+		err = fmt.Errorf("totalMem should be greater than 0")
+	}
+	if total, _, e := util.GetMemInfo(); err == nil && e == nil && totalMem > total-util.GB {
+		err = fmt.Errorf("totalMem %v exceeds the physical memory %v less 1GB", totalMem, total)
+	}
+	r.Add(preflight.CheckConfig, cfgTotalMem, err)
+
+	listen, heartbeatPort, replicaPort := cfg.GetString(proto.ListenPort), cfg.GetString(cfgRaftHeartbeatPort),
+		cfg.GetString(cfgRaftReplicaPort)
+	r.Port(listen)
+	r.Port(heartbeatPort)
+	r.Port(replicaPort)
+
+	masters := r.Strings(cfg, proto.MasterAddr)
+	if len(masters) == 0 {
+		r.Add(preflight.CheckConfig, proto.MasterAddr, fmt.Errorf("%v is not set", proto.MasterAddr))
+	}
+	for _, addr := range masters {
+		r.Resolve(addr)
+	}
+
+	metadataDir := cfg.GetString(cfgMetadataDir)
+	dirs := append([]string{metadataDir, cfg.GetString(cfgRaftDir)}, r.Strings(cfg, cfgRaftDirs)...)
+	for _, dir := range dirs {
+		r.Dir(dir)
+		r.DiskSpace(dir, preflight.DefaultMinDiskSpace)
+	}
+	r.ConstConfig(metadataDir, &config.ConstConfig{
+		Listen:           listen,
+		RaftHeartbetPort: heartbeatPort,
+		RaftReplicaPort:  replicaPort,
+	})
+	return
+}
+
+// validateConfigHandler checks the config in the body against the environment of the meta node. The ports
+// listened by the meta node itself are taken as free.
+func (m *MetaNode) validateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	resp := NewAPIResponse(http.StatusOK, http.StatusText(http.StatusOK))
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[validateConfigHandler] response %s", err)
+		}
+	}()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.Code = http.StatusBadRequest
+		resp.Msg = err.Error()
+		return
+	}
+	cfg, err := config.ParseConfig(body)
+	if err != nil {
+		resp.Code = http.StatusBadRequest
+		resp.Msg = err.Error()
+		return
+	}
+	resp.Data = preflightCheck(cfg, m.listen, m.raftHeartbeatPort, m.raftReplicatePort)
+}
@@ -0,0 +1,290 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	raftDiskStatusFile          = ".diskStatus"
+	intervalToCheckRaftDiskStat = time.Minute * 2
+)
+
+var (
+	ErrRaftDiskNotFound    = errors.New("raft disk not found")
+	ErrRaftDiskUnavailable = errors.New("raft disk unavailable")
+	ErrNoAvailableRaftDisk = errors.New("no available raft disk")
+)
+
+// raftDisk is a directory storing the raft WaL of the meta partitions assigned to it.
+type raftDisk struct {
+	Path       string
+	Status     int
+	partitions map[uint64]struct{}
+}
+
+// raftDiskManager assigns the raft WaL of each meta partition to one of the configured raft directories.
+// The meta partitions which have no raft directory recorded in their meta data (created before multiple raft
+// directories are supported) are assigned to the default raft directory, whose layout is kept unchanged.
+type raftDiskManager struct {
+	sync.RWMutex
+	defaultPath string
+	disks       []*raftDisk
+	onDiskError func(diskPath string, partitions []uint64)
+	stopC       chan struct{}
+}
+
+func newRaftDiskManager(defaultPath string, paths []string) (dm *raftDiskManager, err error) {
+	dm = &raftDiskManager{
+		defaultPath: defaultPath,
+		disks:       make([]*raftDisk, 0, len(paths)+1),
+		stopC:       make(chan struct{}),
+	}
+	for _, p := range append([]string{defaultPath}, paths...) {
+		if dm.getDisk(p) != nil {
+			continue
+		}
+		disk := &raftDisk{Path: p, Status: proto.ReadWrite, partitions: make(map[uint64]struct{})}
+		if err = os.MkdirAll(p, 0755); err != nil {
+			if p == defaultPath {
+				err = errors.NewErrorf("create raft dir %v: %s", p, err.Error())
+				return
+			}
+			log.LogErrorf("[newRaftDiskManager] create raft dir %v: %v", p, err)
+			disk.Status = proto.Unavailable
+			err = nil
+		}
+		dm.disks = append(dm.disks, disk)
+	}
+	return
+}
+
+func (dm *raftDiskManager) getDisk(diskPath string) *raftDisk {
+	if diskPath == "" {
+		diskPath = dm.defaultPath
+	}
+	for _, disk := range dm.disks {
+		if disk.Path == diskPath {
+			return disk
+		}
+	}
+	return nil
+}
+
+// selectDisk returns the available raft directory with the least meta partitions.
+// An empty path is returned if the default raft directory is selected.
+func (dm *raftDiskManager) selectDisk() (diskPath string, err error) {
+	dm.RLock()
+	defer dm.RUnlock()
+	var selected *raftDisk
+	for _, disk := range dm.disks {
+		if disk.Status != proto.ReadWrite {
+			continue
+		}
+		if selected == nil || len(disk.partitions) < len(selected.partitions) {
+			selected = disk
+		}
+	}
+	if selected == nil {
+		err = ErrNoAvailableRaftDisk
+		return
+	}
+	if selected.Path != dm.defaultPath {
+		diskPath = selected.Path
+	}
+	return
+}
+
+// attachPartition records the meta partition on the given raft directory and
+// returns the WaL path to be used by the raft store.
+func (dm *raftDiskManager) attachPartition(diskPath string, id uint64) (walPath string, err error) {
+	dm.Lock()
+	defer dm.Unlock()
+	disk := dm.getDisk(diskPath)
+	if disk == nil {
+		err = errors.NewErrorf("%v: %v", ErrRaftDiskNotFound, diskPath)
+		return
+	}
+	if disk.Status == proto.Unavailable {
+		err = errors.NewErrorf("%v: %v", ErrRaftDiskUnavailable, disk.Path)
+		return
+	}
+	disk.partitions[id] = struct{}{}
+	if disk.Path != dm.defaultPath {
+		walPath = disk.Path
+	}
+	return
+}
+
+// locatePartition finds the raft directory holding the WaL of the meta partition which has no raft directory
+// recorded. Its WaL is in the legacy layout of the default raft directory, unless the raftDir has been relocated
+// and the former one is configured in the raftDirs, whose legacy WaL is moved to the layout of the extra raft
+// directories then. An empty path is returned for the default raft directory, as well as if the WaL is not found.
+func (dm *raftDiskManager) locatePartition(id uint64) (diskPath string, err error) {
+	dm.RLock()
+	defer dm.RUnlock()
+	name := strconv.FormatUint(id, 10)
+	if _, err = os.Stat(path.Join(dm.defaultPath, name)); err == nil || !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	for _, disk := range dm.disks {
+		if disk.Path == dm.defaultPath || disk.Status == proto.Unavailable {
+			continue
+		}
+		walPath := path.Join(disk.Path, "wal_"+name)
+		if _, e := os.Stat(walPath); e == nil {
+			diskPath = disk.Path
+			return
+		}
+		legacyPath := path.Join(disk.Path, name)
+		if _, e := os.Stat(legacyPath); e != nil {
+			continue
+		}
+		if err = os.Rename(legacyPath, walPath); err != nil {
+			err = errors.NewErrorf("migrate raft wal %v to %v: %s", legacyPath, walPath, err.Error())
+			return
+		}
+		log.LogWarnf("[locatePartition] partition(%v) raft wal is migrated from %v to %v", id, legacyPath, walPath)
+		diskPath = disk.Path
+		return
+	}
+	log.LogWarnf("[locatePartition] partition(%v) raft wal is not found in any raft dir, use the default %v",
+		id, dm.defaultPath)
+	return
+}
+
+func (dm *raftDiskManager) detachPartition(diskPath string, id uint64) {
+	dm.Lock()
+	defer dm.Unlock()
+	if disk := dm.getDisk(diskPath); disk != nil {
+		delete(disk.partitions, id)
+	}
+}
+
+// removePartitionWal removes the raft WaL of a meta partition which is not served by this node any more, from
+// the legacy layout of the default raft directory as well as the layout of the extra raft directories.
+func (dm *raftDiskManager) removePartitionWal(id uint64) (err error) {
+	dm.RLock()
+	defer dm.RUnlock()
+	name := strconv.FormatUint(id, 10)
+	walPaths := []string{path.Join(dm.defaultPath, name)}
+	for _, disk := range dm.disks {
+		if _, attached := disk.partitions[id]; attached {
+			return errors.NewErrorf("partition(%v) is attached to raft disk %v", id, disk.Path)
+		}
+		if disk.Path != dm.defaultPath && disk.Status != proto.Unavailable {
+			walPaths = append(walPaths, path.Join(disk.Path, "wal_"+name))
+		}
+	}
+	for _, walPath := range walPaths {
+		if _, e := os.Stat(walPath); e != nil {
+			continue
+		}
+		if err = os.RemoveAll(walPath); err != nil {
+			return
+		}
+		log.LogWarnf("[removePartitionWal] partition(%v) raft wal %v is removed", id, walPath)
+	}
+	return
+}
+
+func (dm *raftDiskManager) isUnavailable(diskPath string) bool {
+	dm.RLock()
+	defer dm.RUnlock()
+	disk := dm.getDisk(diskPath)
+	return disk == nil || disk.Status == proto.Unavailable
+}
+
+func (dm *raftDiskManager) start() {
+	go func() {
+		ticker := time.NewTicker(intervalToCheckRaftDiskStat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-dm.stopC:
+				return
+			case <-ticker.C:
+				dm.checkDisks()
+			}
+		}
+	}()
+}
+
+func (dm *raftDiskManager) stop() {
+	close(dm.stopC)
+}
+
+func (dm *raftDiskManager) checkDisks() {
+	dm.RLock()
+	disks := make([]*raftDisk, 0, len(dm.disks))
+	for _, disk := range dm.disks {
+		if disk.Status != proto.Unavailable {
+			disks = append(disks, disk)
+		}
+	}
+	dm.RUnlock()
+	for _, disk := range disks {
+		if err := checkRaftDiskStatus(disk.Path); err != nil {
+			dm.triggerDiskError(disk, err)
+		}
+	}
+}
+
+// triggerDiskError marks the raft directory as unavailable, and only the meta partitions
+// colocated on it are taken out of the raft store.
+func (dm *raftDiskManager) triggerDiskError(disk *raftDisk, err error) {
+	dm.Lock()
+	disk.Status = proto.Unavailable
+	partitions := make([]uint64, 0, len(disk.partitions))
+	for id := range disk.partitions {
+		partitions = append(partitions, id)
+	}
+	dm.Unlock()
+	mesg := fmt.Sprintf("raft disk path %v error: %v, partitions %v", disk.Path, err, partitions)
+	exporter.Warning(mesg)
+	log.LogErrorf(mesg)
+	if dm.onDiskError != nil {
+		dm.onDiskError(disk.Path, partitions)
+	}
+}
+
+func checkRaftDiskStatus(diskPath string) (err error) {
+	fp, err := os.OpenFile(path.Join(diskPath, raftDiskStatusFile), os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0755)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	data := []byte(raftDiskStatusFile)
+	if _, err = fp.WriteAt(data, 0); err != nil {
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		return
+	}
+	_, err = fp.ReadAt(data, 0)
+	return
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRaftDiskManager_SelectDisk(t *testing.T) {
+	root, err := ioutil.TempDir("", "raft_disk")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	defaultDir, extraDir := path.Join(root, "raft0"), path.Join(root, "raft1")
+	dm, err := newRaftDiskManager(defaultDir, []string{extraDir, defaultDir})
+	if err != nil {
+		t.Fatalf("new raft disk manager: %v", err)
+	}
+	if len(dm.disks) != 2 {
+		t.Fatalf("disk count mismatch: expect 2, actual %v", len(dm.disks))
+	}
+
+	// partitions without raft dir are attached to the default raft dir with the legacy layout
+	walPath, err := dm.attachPartition("", 1)
+	if err != nil || walPath != "" {
+		t.Fatalf("attach legacy partition: walPath(%v) err(%v)", walPath, err)
+	}
+	diskPath, err := dm.selectDisk()
+	if err != nil || diskPath != extraDir {
+		t.Fatalf("select disk: expect %v, actual %v, err(%v)", extraDir, diskPath, err)
+	}
+	if walPath, err = dm.attachPartition(diskPath, 2); err != nil || walPath != extraDir {
+		t.Fatalf("attach partition: walPath(%v) err(%v)", walPath, err)
+	}
+
+	dm.triggerDiskError(dm.getDisk(extraDir), os.ErrInvalid)
+	if !dm.isUnavailable(extraDir) || dm.isUnavailable("") {
+		t.Fatalf("only the broken raft disk should be unavailable")
+	}
+	if diskPath, err = dm.selectDisk(); err != nil || diskPath != "" {
+		t.Fatalf("select disk: expect default, actual %v, err(%v)", diskPath, err)
+	}
+	if _, err = dm.attachPartition(extraDir, 3); err == nil {
+		t.Fatalf("attach partition to unavailable raft disk should fail")
+	}
+	if _, err = dm.attachPartition(path.Join(root, "unknown"), 4); err == nil {
+		t.Fatalf("attach partition to unknown raft disk should fail")
+	}
+}
+
+func TestRaftDiskManager_LocatePartition(t *testing.T) {
+	root, err := ioutil.TempDir("", "raft_disk")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	// the raftDir is relocated to raft2, and the former one is configured as an extra raft dir
+	oldDir, extraDir, newDir := path.Join(root, "raft0"), path.Join(root, "raft1"), path.Join(root, "raft2")
+	walFiles := map[string]string{
+		path.Join(newDir, "1"):       "0000000000000001-0000000000000001.log",
+		path.Join(oldDir, "2"):       "0000000000000001-0000000000000001.log",
+		path.Join(extraDir, "wal_3"): "0000000000000001-0000000000000001.log",
+	}
+	for dir, file := range walFiles {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("create wal dir: %v", err)
+		}
+		if err = ioutil.WriteFile(path.Join(dir, file), []byte("wal"), 0644); err != nil {
+			t.Fatalf("write wal file: %v", err)
+		}
+	}
+	dm, err := newRaftDiskManager(newDir, []string{oldDir, extraDir})
+	if err != nil {
+		t.Fatalf("new raft disk manager: %v", err)
+	}
+
+	expects := []struct {
+		id       uint64
+		diskPath string
+	}{
+		{id: 1, diskPath: ""},       // in the legacy layout of the default raft dir
+		{id: 2, diskPath: oldDir},   // in the legacy layout of the former raft dir
+		{id: 3, diskPath: extraDir}, // in the layout of the extra raft dirs
+		{id: 4, diskPath: ""},       // not found
+	}
+	for _, expect := range expects {
+		diskPath, err := dm.locatePartition(expect.id)
+		if err != nil || diskPath != expect.diskPath {
+			t.Fatalf("locate partition(%v): expect %v, actual %v, err(%v)", expect.id, expect.diskPath, diskPath, err)
+		}
+	}
+
+	// the wal in the former raft dir is migrated to the layout used by the raft store for the extra raft dirs
+	walPath, err := dm.attachPartition(oldDir, 2)
+	if err != nil || walPath != oldDir {
+		t.Fatalf("attach partition: walPath(%v) err(%v)", walPath, err)
+	}
+	if _, err = os.Stat(path.Join(oldDir, "wal_2", walFiles[path.Join(oldDir, "2")])); err != nil {
+		t.Fatalf("the wal of partition 2 is not migrated: %v", err)
+	}
+	if _, err = os.Stat(path.Join(oldDir, "2")); !os.IsNotExist(err) {
+		t.Fatalf("the legacy wal dir of partition 2 should be moved, err(%v)", err)
+	}
+	if diskPath, err := dm.locatePartition(2); err != nil || diskPath != oldDir {
+		t.Fatalf("locate migrated partition: expect %v, actual %v, err(%v)", oldDir, diskPath, err)
+	}
+}
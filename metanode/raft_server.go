@@ -30,6 +30,9 @@ func (m *MetaNode) startRaftServer() (err error) {
 			return
 		}
 	}
+	if m.raftDisks, err = newRaftDiskManager(m.raftDir, m.raftDirs); err != nil {
+		return
+	}
 
 	heartbeatPort, _ := strconv.Atoi(m.raftHeartbeatPort)
 	replicaPort, _ := strconv.Atoi(m.raftReplicatePort)
@@ -41,6 +44,12 @@ func (m *MetaNode) startRaftServer() (err error) {
 		HeartbeatPort:     heartbeatPort,
 		ReplicaPort:       replicaPort,
 		NumOfLogsToRetain: raftstore.DefaultNumOfLogsToRetain * 2,
+		TickInterval:      m.raftTimings.TickInterval,
+		HeartbeatTick:     m.raftTimings.HeartbeatTick,
+		ElectionTick:      m.raftTimings.ElectionTick,
+		MaxInflightMsgs:   m.raftTimings.MaxInflightMsgs,
+		ReplicaIP:         m.replicaIP,
+		ReplicaResolver:   m.replicaResolver,
 	}
 	m.raftStore, err = raftstore.NewRaftStore(raftConf)
 	if err != nil {
@@ -50,6 +59,9 @@ func (m *MetaNode) startRaftServer() (err error) {
 }
 
 func (m *MetaNode) stopRaftServer() {
+	if m.raftDisks != nil {
+		m.raftDisks.stop()
+	}
 	if m.raftStore != nil {
 		m.raftStore.Stop()
 	}
@@ -81,13 +81,20 @@ func (m *MetaNode) serveConn(conn net.Conn, stopC chan uint8) {
 			return
 		}
 		if err := m.handlePacket(conn, p, remoteAddr); err != nil {
-			log.LogErrorf("serve handlePacket fail: %v", err)
+			log.LogErrorfLimited("serve handlePacket fail: %v", err)
 		}
 	}
 }
 
 func (m *MetaNode) handlePacket(conn net.Conn, p *Packet,
 	remoteAddr string) (err error) {
+	// shed the requests of the clients under the critical pressure, the master and the peers are always served
+	if isPriorityQueued(p.Opcode) {
+		if err = m.pressure.Shed(); err != nil {
+			p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+			return p.WriteToConn(conn)
+		}
+	}
 	// Handle request
 	err = m.metadataManager.HandleMetadataOperation(conn, p, remoteAddr)
 	return
@@ -0,0 +1,105 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"net"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/pressure"
+)
+
+// handledManager records the opcodes of the packets handed to the metadata manager.
+type handledManager struct {
+	MetadataManager
+	handled []uint8
+}
+
+func (m *handledManager) HandleMetadataOperation(conn net.Conn, p *Packet, remoteAddr string) error {
+	m.handled = append(m.handled, p.Opcode)
+	return nil
+}
+
+func TestHandlePacketUnderPressure(t *testing.T) {
+	// any usage of the memory or the file descriptors is critical with the tiny ratios
+	monitor, err := pressure.NewMonitor("metanode", config.LoadConfigString(`{"pressureWarnRatio": 0.000001, "pressureCriticalRatio": 0.000002}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor.Start()
+	defer monitor.Stop()
+	if !monitor.Critical() {
+		t.Fatalf("the pressure should be critical, stat %v", monitor.Stat())
+	}
+	manager := &handledManager{}
+	m := &MetaNode{metadataManager: manager, pressure: monitor}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	defer client.Close()
+
+	for _, opcode := range []uint8{proto.OpMetaLookup, proto.OpMetaCreateInode, proto.OpMetaReadDir, proto.OpMetaFallocate} {
+		replyC := make(chan *proto.Packet, 1)
+		go func() {
+			reply := proto.NewPacket()
+			if err := reply.ReadFromConn(client, proto.ReadDeadlineTime); err != nil {
+				reply = nil
+			}
+			replyC <- reply
+		}()
+		p := &Packet{}
+		p.Magic = proto.ProtoMagic
+		p.Opcode = opcode
+		if err = m.handlePacket(server, p, "client"); err != nil {
+			t.Fatal(err)
+		}
+		if reply := <-replyC; reply == nil || reply.ResultCode != proto.OpAgain {
+			t.Fatalf("the client request %v should be replied with OpAgain, reply %v", p.GetOpMsg(), reply)
+		}
+	}
+	if len(manager.handled) != 0 {
+		t.Fatalf("the shed requests should not be handled, but %v are", manager.handled)
+	}
+
+	// the requests of the master and the peers are handled without the pressure check
+	admitted := []uint8{proto.OpMetaNodeHeartbeat, proto.OpCreateMetaPartition, proto.OpDeleteMetaPartition,
+		proto.OpMetaFreeInodesOnRaftFollower}
+	for _, opcode := range admitted {
+		p := &Packet{}
+		p.Opcode = opcode
+		if err = m.handlePacket(server, p, "master"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(manager.handled) != len(admitted) {
+		t.Fatalf("expect the requests %v to be handled, but are %v", admitted, manager.handled)
+	}
+	if rejected := monitor.Stat().RejectedRequests; rejected != 4 {
+		t.Fatalf("expect 4 rejected requests, but is %v", rejected)
+	}
+}
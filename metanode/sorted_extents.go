@@ -116,6 +116,23 @@ func (se *SortedExtents) Append(ek proto.ExtentKey) (deleteExtents []proto.Exten
 	return
 }
 
+// Swap replaces the extent keys with the new ones if they are exactly the old ones.
+func (se *SortedExtents) Swap(oldEks, newEks []proto.ExtentKey) bool {
+	se.Lock()
+	defer se.Unlock()
+	if len(se.eks) != len(oldEks) || len(newEks) != len(oldEks) {
+		return false
+	}
+	for idx, ek := range se.eks {
+		if ek != oldEks[idx] {
+			return false
+		}
+	}
+	se.eks = make([]proto.ExtentKey, len(newEks))
+	copy(se.eks, newEks)
+	return true
+}
+
 func (se *SortedExtents) Truncate(offset uint64) (deleteExtents []proto.ExtentKey) {
 	var endIndex int
 
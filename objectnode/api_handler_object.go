@@ -290,6 +290,12 @@ func (o *ObjectNode) getObjectHandler(w http.ResponseWriter, r *http.Request) {
 		if len(fileInfo.ETag) > 0 {
 			w.Header()[HeaderNameETag] = []string{wrapUnescapedQuot(fileInfo.ETag)}
 		}
+		if err = setChecksumHeader(w, r, vol, fileInfo); err != nil {
+			log.LogErrorf("getObjectHandler: get checksum fail: requestId(%v) volume(%v) path(%v) err(%v)",
+				GetRequestID(r), vol.Name(), param.Object(), err)
+			errorCode = InternalErrorCode(err)
+			return
+		}
 		if isRangeRead {
 			w.Header()[HeaderNameContentRange] = []string{fmt.Sprintf("bytes %d-%d/%d", rangeLower, rangeUpper, fileInfo.Size)}
 		}
@@ -485,6 +491,12 @@ func (o *ObjectNode) headObjectHandler(w http.ResponseWriter, r *http.Request) {
 		if len(fileInfo.ETag) > 0 {
 			w.Header()[HeaderNameETag] = []string{wrapUnescapedQuot(fileInfo.ETag)}
 		}
+		if err = setChecksumHeader(w, r, vol, fileInfo); err != nil {
+			log.LogErrorf("headObjectHandler: get checksum fail: requestId(%v) volume(%v) path(%v) err(%v)",
+				GetRequestID(r), vol.Name(), param.Object(), err)
+			errorCode = InternalErrorCode(err)
+			return
+		}
 	}
 
 	// User-defined metadata
@@ -1665,6 +1677,20 @@ func (o *ObjectNode) listObjectXAttrs(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// setChecksumHeader sets the SHA256 checksum of the whole object to the response if the checksum mode of the request
+// is enabled, in the way of the S3 additional checksums.
+func setChecksumHeader(w http.ResponseWriter, r *http.Request, vol *Volume, fileInfo *FSFileInfo) (err error) {
+	if r.Header.Get(HeaderNameXAmzChecksumMode) != HeaderValueChecksumModeEnabled || fileInfo.Mode.IsDir() {
+		return
+	}
+	var checksum string
+	if checksum, err = vol.ObjectChecksum(fileInfo.Inode); err != nil {
+		return
+	}
+	w.Header()[HeaderNameXAmzChecksumSHA256] = []string{checksum}
+	return
+}
+
 func parsePartInfo(partNumber uint64, fileSize uint64) (uint64, uint64, uint64, uint64, error) {
 	var partSize uint64
 	var partCount uint64
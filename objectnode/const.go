@@ -66,6 +66,8 @@ const (
 	HeaderNameXAmzMetadataDirective   = "x-amz-metadata-directive"
 	HeaderNameXAmzBucketRegion        = "x-amz-bucket-region"
 	HeaderNameXAmzTaggingCount        = "x-amz-tagging-count"
+	HeaderNameXAmzChecksumMode        = "x-amz-checksum-mode"
+	HeaderNameXAmzChecksumSHA256      = "x-amz-checksum-sha256"
 
 	HeaderNameIfMatch           = "If-Match"
 	HeaderNameIfNoneMatch       = "If-None-Match"
@@ -79,6 +81,7 @@ const (
 	HeaderValueTypeStream           = "application/octet-stream"
 	HeaderValueContentTypeXML       = "application/xml"
 	HeaderValueContentTypeDirectory = "application/directory"
+	HeaderValueChecksumModeEnabled  = "ENABLED"
 )
 
 const (
@@ -15,6 +15,7 @@
 package objectnode
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
@@ -1245,6 +1246,20 @@ func (v *Volume) ReadFile(path string, writer io.Writer, offset, size uint64) er
 	return nil
 }
 
+// ObjectChecksum returns the base64 encoded SHA256 checksum of the object, which is computed by the meta node on
+// demand and kept until the object is written again.
+func (v *Volume) ObjectChecksum(inode uint64) (checksum string, err error) {
+	var hexChecksum string
+	if hexChecksum, err = v.mw.FileChecksum_ll(inode); err != nil {
+		return
+	}
+	var raw []byte
+	if raw, err = hex.DecodeString(hexChecksum); err != nil {
+		return
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
 func (v *Volume) ObjectMeta(path string) (info *FSFileInfo, err error) {
 
 	// process path
@@ -23,12 +23,27 @@ const (
 	AdminCreateDataPartition       = "/dataPartition/create"
 	AdminDecommissionDataPartition = "/dataPartition/decommission"
 	AdminDiagnoseDataPartition     = "/dataPartition/diagnose"
+	AdminDeleteDataPartition       = "/dataPartition/delete"
+	AdminCancelDeleteDataPartition = "/dataPartition/cancelDelete"
+	AdminCheckDataPartitionRef     = "/dataPartition/checkRef"
+	AdminFreezeDataPartition       = "/dataPartition/freeze"
+	AdminUnfreezeDataPartition     = "/dataPartition/unfreeze"
+	AdminDegradeDataPartition      = "/dataPartition/degrade"
+	AdminUndegradeDataPartition    = "/dataPartition/undegrade"
+	AdminResizeDataPartition       = "/dataPartition/resize"
 	AdminDeleteDataReplica         = "/dataReplica/delete"
 	AdminAddDataReplica            = "/dataReplica/add"
 	AdminDeleteVol                 = "/vol/delete"
+	AdminUndeleteVol               = "/vol/undelete"
 	AdminUpdateVol                 = "/vol/update"
 	AdminVolShrink                 = "/vol/shrink"
 	AdminVolExpand                 = "/vol/expand"
+	AdminFreezeVol                 = "/vol/freeze"
+	AdminThawVol                   = "/vol/thaw"
+	AdminDelegateVolToken          = "/vol/delegateToken"
+	AdminReserveVolSpace           = "/vol/reserve"
+	AdminCancelVolReservation      = "/vol/cancelReservation"
+	AdminGetVolReservations        = "/vol/reservations"
 	AdminCreateVol                 = "/admin/createVol"
 	AdminGetVol                    = "/admin/getVol"
 	AdminClusterFreeze             = "/cluster/freeze"
@@ -39,6 +54,24 @@ const (
 	AdminListVols                  = "/vol/list"
 	AdminSetNodeInfo               = "/admin/setNodeInfo"
 	AdminGetNodeInfo               = "/admin/getNodeInfo"
+	AdminBootstrap                 = "/admin/bootstrap"
+	AdminSetVolLifecycle           = "/vol/lifecycle/set"
+	AdminSetVolMaxClients          = "/vol/setMaxClients"
+	AdminGetVolLifecycleStatus     = "/vol/lifecycle/status"
+	AdminPlacementDiff             = "/admin/placementDiff"
+	AdminDataPartitionPlacement    = "/dataPartition/placement"
+	AdminDataPartitionCreations    = "/dataPartition/creations"
+	AdminSetDataNodeDiskThreshold  = "/threshold/setDataNodeDisk"
+	AdminNodeVersions              = "/admin/nodeVersions"
+	AdminValidateConfig            = "/validateConfig"
+	AdminSchemaVersion             = "/admin/schemaVersion"
+	AdminGetRaftTimings            = "/admin/getRaftTimings"
+	AdminSetRaftTimings            = "/admin/setRaftTimings"
+	AdminStatsTree                 = "/admin/statsTree"
+	AdminExportMetadata            = "/admin/export"
+	AdminResolvePath               = "/debug/resolve"
+	AdminVolRecommendations        = "/vol/recommendations"
+	AdminVolShadowFailover         = "/vol/shadow/failover"
 
 	//graphql master api
 	AdminClusterAPI = "/api/cluster"
@@ -59,6 +92,12 @@ const (
 	ClientMetaPartition  = "/metaPartition/get"
 	ClientVolStat        = "/client/volStat"
 	ClientMetaPartitions = "/client/metaPartitions"
+	ClientMetricsReport  = "/client/metrics/report"
+	ClientMetricsList    = "/client/metrics/list"
+	ClientReportBadBlock = "/client/badBlock/report"
+	ClientReportMismatch = "/client/readMismatch/report"
+	ClientRegister       = "/client/register"
+	ClientUnregister     = "/client/unregister"
 
 	//raft node APIs
 	AddRaftNode    = "/raftNode/add"
@@ -74,12 +113,64 @@ const (
 	GetMetaNode                    = "/metaNode/get"
 	AdminUpdateMetaNode            = "/metaNode/update"
 	AdminUpdateDataNode            = "/dataNode/update"
+	AdminSetDataNodeSpare          = "/dataNode/setSpare"
+	AdminSetAutoPromoteSpare       = "/cluster/autoPromoteSpare"
+	AdminSetQuorumWrite            = "/cluster/quorumWrite"
 	AdminGetInvalidNodes           = "/invalid/nodes"
 	AdminLoadMetaPartition         = "/metaPartition/load"
 	AdminDiagnoseMetaPartition     = "/metaPartition/diagnose"
 	AdminDecommissionMetaPartition = "/metaPartition/decommission"
+	AdminDegradeMetaPartition      = "/metaPartition/degrade"
+	AdminUndegradeMetaPartition    = "/metaPartition/undegrade"
 	AdminAddMetaReplica            = "/metaReplica/add"
 	AdminDeleteMetaReplica         = "/metaReplica/delete"
+	AddMetaCacheNode               = "/metaCacheNode/add"
+	GetMetaCacheNodes              = "/metaCacheNode/list"
+
+	// Maintenance plan APIs
+	AdminSubmitMaintenancePlan = "/maintenancePlan/submit"
+	AdminGetMaintenancePlan    = "/maintenancePlan/get"
+	AdminListMaintenancePlans  = "/maintenancePlan/list"
+	AdminPauseMaintenancePlan  = "/maintenancePlan/pause"
+	AdminResumeMaintenancePlan = "/maintenancePlan/resume"
+	AdminAbortMaintenancePlan  = "/maintenancePlan/abort"
+
+	// Tenant APIs
+	AdminCreateTenant    = "/tenant/create"
+	AdminUpdateTenant    = "/tenant/update"
+	AdminDeleteTenant    = "/tenant/delete"
+	AdminTenantAddVol    = "/tenant/addVol"
+	AdminTenantRemoveVol = "/tenant/removeVol"
+	AdminTenantStats     = "/tenant/stats"
+
+	// Cluster event APIs
+	AdminGetEvents        = "/events"
+	AdminSetEventWebhooks = "/events/setWebhooks"
+
+	// Snapshot diff APIs
+	AdminVolSnapshotDiff = "/vol/snapshotDiff"
+
+	// Volume usage hook APIs
+	AdminGetVolUsageHooks         = "/volUsage/hooks"
+	AdminSetVolUsageHooks         = "/volUsage/setHooks"
+	AdminRetryVolUsageDeadLetters = "/volUsage/retryDeadLetters"
+	AdminPurgeVolUsageDeadLetters = "/volUsage/purgeDeadLetters"
+
+	// Extent copy APIs
+	AdminCopyExtent       = "/dataPartition/copyExtent"
+	AdminGetExtentCopyJob = "/dataPartition/copyExtentJob"
+
+	// Namespace export APIs
+	AdminSetVolNamespaceExport    = "/vol/nsExport/set"
+	AdminRunVolNamespaceExport    = "/vol/nsExport/run"
+	AdminGetVolNamespaceExportJob = "/vol/nsExport/status"
+
+	// Orphan extent APIs
+	AdminRunVolOrphanExtents       = "/vol/orphanExtents/run"
+	AdminGetVolOrphanExtentsReport = "/vol/orphanExtents/report"
+
+	// Read verification APIs
+	AdminGetReadMismatches = "/dataPartition/readMismatches"
 
 	// Operation response
 	GetMetaNodeTaskResponse = "/metaNode/response" // Method: 'POST', ContentType: 'application/json'
@@ -116,6 +207,14 @@ const (
 	ParamAuthorized = "_authorization"
 	UserKey         = "_user_key"
 	UserInfoKey     = "_user_info_key"
+
+	// headers of the requests sent by the data nodes and the meta nodes to the master
+	NodeRoleHeader  = "X-Cfs-Node-Role"
+	NodeTokenHeader = "X-Cfs-Node-Token"
+	NodeRoleData    = "datanode"
+	NodeRoleMeta    = "metanode"
+
+	NodeRoleMetaCache = "metacache"
 )
 
 const TimeFormat = "2006-01-02 15:04:05"
@@ -138,6 +237,26 @@ type HTTPReply struct {
 	Data interface{} `json:"data"`
 }
 
+// The param of the master APIs to reply the data in the typed structures below, instead of a bare message or ID.
+const (
+	FormatKey  = "format"
+	FormatJSON = "json"
+)
+
+// MessageResult defines the data replied with format=json by the APIs which reply a message by default, such as the
+// ones changing the settings or scheduling the tasks.
+type MessageResult struct {
+	Operation string `json:"operation"` // the path of the API
+	Message   string `json:"message"`
+}
+
+// IDResult defines the data replied with format=json by the APIs which reply an ID by default, such as addDataNode
+// and addMetaNode.
+type IDResult struct {
+	Operation string `json:"operation"`
+	ID        uint64 `json:"id"`
+}
+
 // RegisterMetaNodeResp defines the response to register a meta node.
 type RegisterMetaNodeResp struct {
 	ID uint64
@@ -163,6 +282,7 @@ type CreateDataPartitionRequest struct {
 	Members       []Peer
 	Hosts         []string
 	CreateType    int
+	DiskPath      string // the disk preferred by the master, the data node chooses one if it is empty or unusable
 }
 
 // CreateDataPartitionResponse defines the response to the request of creating a data partition.
@@ -179,6 +299,114 @@ type DeleteDataPartitionRequest struct {
 	PartitionSize     int
 }
 
+// FreezeDataPartitionRequest defines the request to freeze or unfreeze a data partition. A frozen data partition
+// serves the reads only, without any write, repair or delete.
+type FreezeDataPartitionRequest struct {
+	PartitionId uint64
+	IsFrozen    bool
+}
+
+// DegradeDataPartitionRequest defines the request to enter or leave the degraded mode of a data partition. The
+// replicas of a degraded data partition serve the reads without the leader once the quorum is lost, and flag the
+// replies with DegradedReplyFlag since the data may be stale.
+type DegradeDataPartitionRequest struct {
+	PartitionId uint64
+	IsDegraded  bool
+}
+
+// ResizeDataPartitionRequest defines the request to grow a data partition to the size in bytes.
+type ResizeDataPartitionRequest struct {
+	PartitionId   uint64
+	PartitionSize int
+}
+
+// FreezeMetaPartitionRequest defines the request to freeze or thaw a meta partition. A frozen meta partition serves
+// the reads only, and refuses the mutations with OpVolFrozen.
+type FreezeMetaPartitionRequest struct {
+	PartitionID uint64
+	IsFrozen    bool
+}
+
+// FreezeMetaPartitionResponse defines the response to the request to freeze or thaw a meta partition.
+type FreezeMetaPartitionResponse struct {
+	PartitionID uint64
+	IsFrozen    bool
+	IsLeader    bool
+	ApplyID     uint64 // applied index of the replica once the dirty state is flushed
+	Status      uint8
+	Result      string
+}
+
+// DegradeMetaPartitionRequest defines the request to enter or leave the degraded mode of a meta partition. The
+// replicas of a degraded meta partition serve the read-only requests locally without the leader, instead of
+// refusing them, and flag the replies with DegradedReplyFlag since the metadata may be stale.
+type DegradeMetaPartitionRequest struct {
+	PartitionID uint64
+	IsDegraded  bool
+}
+
+// RepairDataBlockRequest defines the request to repair the corrupted blocks of an extent on a replica, with the data
+// of the same blocks read from the source replica.
+type RepairDataBlockRequest struct {
+	PartitionId uint64
+	ExtentId    uint64
+	Offset      int64
+	Size        uint32
+	SourceAddr  string
+}
+
+// CopyExtentRequest defines the request to copy the range of an extent from the replica on the source data node to
+// the replica on the destination, which is a data move instead of a repair. The zero Size copies to the end of the
+// source extent, and the zero RateLimit copies without the limit.
+// The extent is copied from the extent of another partition of the volume if SourcePartitionId is set, e.g. to move
+// it to the cold tier, and the destination allocates the ID of the copy if ExtentId is zero and replies the request
+// with it.
+type CopyExtentRequest struct {
+	JobID             uint64
+	PartitionId       uint64
+	ExtentId          uint64
+	Offset            uint64
+	Size              uint32
+	SourceAddr        string
+	RateLimit         uint64 // bytes per second
+	SourcePartitionId uint64 `json:",omitempty"`
+	SourceExtentId    uint64 `json:",omitempty"`
+}
+
+// CopyExtentResponse defines the response to the request of copying an extent, which is sent once the copy ends.
+type CopyExtentResponse struct {
+	JobID       uint64
+	Status      uint8
+	Result      string
+	CopiedBytes uint64
+	Crc         uint32 // of the range copied, verified against the source
+}
+
+// The states of the extent copy jobs
+const (
+	ExtentCopyRunning   = "running"
+	ExtentCopySucceeded = "succeeded"
+	ExtentCopyFailed    = "failed"
+)
+
+// ExtentCopyJob defines the view of a job copying an extent between the data nodes.
+type ExtentCopyJob struct {
+	ID          uint64
+	PartitionID uint64
+	ExtentID    uint64
+	Offset      uint64
+	Size        uint32 // the size to copy, which is resolved from the source if it is requested as zero
+	SourceAddr  string
+	DestAddr    string
+	RateLimit   uint64
+	State       string
+	CopiedBytes uint64
+	Crc         uint32
+	Msg         string
+	CreateTime  int64
+	UpdateTime  int64
+}
+
 // DeleteDataPartitionResponse defines the response to the request of deleting a data partition.
 type DeleteDataPartitionResponse struct {
 	Status      uint8
@@ -186,6 +414,33 @@ type DeleteDataPartitionResponse struct {
 	PartitionId uint64
 }
 
+// CheckDataPartitionRefRequest defines the request to find the inodes of a meta partition
+// which have extent keys referring to the data partition.
+type CheckDataPartitionRefRequest struct {
+	PartitionID     uint64
+	DataPartitionID uint64
+	Limit           int // the max number of inodes in the response
+}
+
+// CheckDataPartitionRefResponse defines the response to the request of checking the references of a data partition.
+type CheckDataPartitionRefResponse struct {
+	PartitionID     uint64
+	DataPartitionID uint64
+	ExtentKeyCount  uint64
+	InodeCount      uint64
+	Inodes          []uint64
+}
+
+// DataPartitionRefReport defines the extent keys of a volume which refer to a data partition.
+type DataPartitionRefReport struct {
+	VolName         string
+	PartitionID     uint64
+	ExtentKeyCount  uint64
+	InodeCount      uint64
+	Inodes          []uint64
+	IsPendingDelete bool
+}
+
 // DataPartitionDecommissionRequest defines the request of decommissioning a data partition.
 type DataPartitionDecommissionRequest struct {
 	PartitionId uint64
@@ -259,21 +514,47 @@ type LoadMetaPartitionMetricResponse struct {
 
 // HeartBeatRequest define the heartbeat request.
 type HeartBeatRequest struct {
-	CurrTime   int64
-	MasterAddr string
+	CurrTime          int64
+	MasterAddr        string
+	EnableQuorumWrite bool
+	TokenRequiredVols []string // the vols whose clients are refused without a delegated token
 }
 
 // PartitionReport defines the partition report.
 type PartitionReport struct {
-	VolName         string
-	PartitionID     uint64
-	PartitionStatus int
-	Total           uint64
-	Used            uint64
-	DiskPath        string
-	IsLeader        bool
-	ExtentCount     int
-	NeedCompare     bool
+	VolName              string
+	PartitionID          uint64
+	PartitionStatus      int
+	Total                uint64
+	Used                 uint64
+	DiskPath             string
+	IsLeader             bool
+	ExtentCount          int
+	NeedCompare          bool
+	IsFrozen             bool
+	IsDegraded           bool
+	AvailableTinyExtents int // tiny extents available for the small file writes
+	BrokenTinyExtents    int // tiny extents waiting for the repair
+
+	WriteSizes []uint64 // the writes led by the replica, counted in the buckets of IOSizeBounds
+	ReadSizes  []uint64 // the reads served by the replica, counted in the buckets of IOSizeBounds
+}
+
+// IOSizeBounds are the upper bounds of the buckets in which the data partitions count the sizes of the reads and the
+// writes, and the last bucket counts the sizes larger than all the bounds.
+var IOSizeBounds = [...]uint32{4 << 10, 16 << 10, 64 << 10, 128 << 10, 1 << 20}
+
+// IOSizeBucketCount is the number of the buckets of the read and the write sizes.
+const IOSizeBucketCount = len(IOSizeBounds) + 1
+
+// IOSizeBucket returns the bucket of the read or the write size.
+func IOSizeBucket(size uint32) int {
+	for i, bound := range IOSizeBounds {
+		if size <= bound {
+			return i
+		}
+	}
+	return len(IOSizeBounds)
 }
 
 // DataNodeHeartbeatResponse defines the response to the data node heartbeat.
@@ -290,6 +571,29 @@ type DataNodeHeartbeatResponse struct {
 	Status              uint8
 	Result              string
 	BadDisks            []string
+	BuildInfo           BuildInfo
+	Pressure            *ResourcePressure `json:",omitempty"` // only reported by the stats API of the data node
+	// The partitions of a node with massive partitions are reported in the cohorts of their IDs modulo ReportCohorts
+	// across the consecutive heartbeats, along with the partitions whose status changed. All the partitions are
+	// reported if ReportCohorts is 0 or 1.
+	ReportCohort  int
+	ReportCohorts int
+	Disks         []*DiskReport
+
+	ReplicaIP     string                 `json:",omitempty"`
+	Rack          string                 `json:",omitempty"`
+	Interfaces    []*InterfaceThroughput `json:",omitempty"` // only reported by the stats API of the data node
+	PriorityQueue *PriorityQueueStat     `json:",omitempty"` // only reported by the stats API of the data node
+}
+
+// DiskReport defines the usage of a disk reported by the data node.
+type DiskReport struct {
+	Path       string
+	Total      uint64
+	Used       uint64
+	Available  uint64
+	Status     int
+	Partitions int
 }
 
 // MetaPartitionReport defines the meta partition report.
@@ -303,6 +607,23 @@ type MetaPartitionReport struct {
 	VolName     string
 	InodeCnt    uint64
 	DentryCnt   uint64
+	DedupStat   DedupStat
+	IsFrozen    bool
+	IsDegraded  bool
+	Reserved    uint64 // the preallocated space of the inodes which is not written yet
+	ApplyStall  bool   // the proposals wait without any entry applied
+	ApplyQueue  int64  // the proposals waiting to be applied
+
+	ShadowFailures uint64 // the mutations failed to be mirrored to the shadow volume
+	DeleteBacklog  DeleteBacklog
+}
+
+// DeleteBacklog is the backlog of the deletion pipeline of a meta partition, which grows without bound once the
+// pipeline is stuck.
+type DeleteBacklog struct {
+	PendingInodes    uint64 // the inodes waiting to be freed
+	PendingExtents   uint64 // the extents of the freed inodes waiting to be deleted from the data nodes
+	OldestPendingSec int64  // how long the oldest inode has been waiting to be freed
 }
 
 // MetaNodeHeartbeatResponse defines the response to the meta node heartbeat request.
@@ -313,6 +634,8 @@ type MetaNodeHeartbeatResponse struct {
 	MetaPartitionReports []*MetaPartitionReport
 	Status               uint8
 	Result               string
+	BuildInfo            BuildInfo
+	ReplicaIP            string `json:",omitempty"`
 }
 
 // DeleteFileRequest defines the request to delete a file.
@@ -396,6 +719,7 @@ type DataPartitionResponse struct {
 	Status      int8
 	ReplicaNum  uint8
 	Hosts       []string
+	HostZones   map[string]string // host -> zone
 	LeaderAddr  string
 	Epoch       uint64
 	IsRecover   bool
@@ -441,6 +765,21 @@ type VolView struct {
 	DataPartitions []*DataPartitionResponse
 	OSSSecure      *OSSSecure
 	CreateTime     int64
+
+	MinClientVersion string
+	Features         map[string]bool
+
+	// MetaCacheNodes are the meta cache nodes to proxy the metadata requests of the volume, empty unless the
+	// meta cache is enabled on the volume.
+	MetaCacheNodes []string
+
+	// SyncOnRename makes the clients flush and fsync the renamed files, and the meta nodes sync the raft log of the
+	// renames before they return, so that the published files are durable once they are visible.
+	SyncOnRename bool
+
+	// Shadow is the shadow volume mirroring the volume, nil unless the volume is created with a shadow. The
+	// partitions of the view are the ones of the shadow once the volume fails over to it.
+	Shadow *VolShadowView
 }
 
 func (v *VolView) SetOwner(owner string) {
@@ -498,8 +837,44 @@ type SimpleVolView struct {
 	Description        string
 	DpSelectorName     string
 	DpSelectorParm     string
+	DpAffinity         string
+	FailureDomain      string // the failure domain which holds at most one replica of a new data partition
+	MinClientVersion   string
+	Features           map[string]bool `graphql:"-"`
+	MultipartTTL       int64           // hours
+	DeleteTime         string          // when the volume was deleted, empty unless it is pending delete
+	DedupStat          DedupStat       // the deduplicated blocks of the volume with FeatureDedup
+	MetaCache          bool            // the metadata requests of the volume are proxied by the meta cache nodes
+	MaxClients         int             // the maximum number of the mounted clients, 0 for unlimited
+	Clients            int             // the number of the mounted clients registered to the master
+	IsFrozen           bool            // the writes of the volume are quiesced by /vol/freeze
+	CaseInsensitive    bool            // the dentries are looked up case-insensitively
+	VerifyReads        bool            // the clients verify the sampled reads against another replica
+	VerifyReadsPercent int             // the percent of the reads verified with VerifyReads
+	SyncOnRename       bool            // the renames are durable once they return
+	RequireToken       bool            // the clients are refused without a delegated token
+	ColdZone           string          // the zone of the data partitions the lifecycle rules move the files to
+	NamePolicy         DentryNamePolicy // the rules of the names of the dentries enforced by the meta nodes
+	Shadow             *VolShadowView  // the shadow mirroring the volume, nil unless the volume has a shadow
+	ShadowOf           string          // the volume mirrored by the volume, empty unless it is a shadow
 }
 
+// The affinity policies between the data partitions and the meta nodes hosting the meta partitions of a volume
+const (
+	DpAffinityNone         = ""
+	DpAffinityColocate     = "colocate"     // prefer the data nodes on the same hosts as the meta nodes
+	DpAffinityAntiColocate = "anticolocate" // prefer the data nodes on the other hosts than the meta nodes
+)
+
+// The failure domains which hold at most one replica of a data partition of a volume. The replicas are always on
+// different hosts unless the failure domain is none.
+const (
+	FailureDomainNone = ""
+	FailureDomainHost = "host"
+	FailureDomainRack = "rack" // the replicas are on different racks reported by the data nodes
+	FailureDomainZone = "zone"
+)
+
 // MasterAPIAccessResp defines the response for getting meta partition
 type MasterAPIAccessResp struct {
 	APIResp APIAccessResp `json:"api_resp"`
@@ -526,6 +901,344 @@ func NewVolInfo(name, owner string, createTime int64, status uint8, totalSize, u
 	}
 }
 
+// ClientMetrics defines the summarized metrics periodically reported by a mounted client.
+type ClientMetrics struct {
+	Volume      string
+	Addr        string
+	ClientID    string // the ID registered by the mount, which tells apart the mounts of a volume on the same host
+	ReportTime  int64
+	Inflight    int64
+	OpCounts    map[string]uint64
+	ErrorCounts map[string]uint64
+	IcacheHits  uint64
+	IcacheMiss  uint64
+	DcacheHits  uint64
+	DcacheMiss  uint64
+
+	DeferredCloses        uint64
+	DeferredCloseFailures uint64
+
+	ShadowFailures uint64 // the writes failed to be mirrored to the shadow volume
+}
+
+// DataBlockReport defines the blocks of an extent reported by a client, which are failed to be read from a replica
+// for the Crc mismatch and read from the source replica instead.
+type DataBlockReport struct {
+	PartitionID uint64
+	ExtentID    uint64
+	Offset      int64
+	Size        uint32
+	Addr        string // the replica with the corrupted blocks
+	SourceAddr  string // the replica which served the blocks
+}
+
+// ReplicaCrc defines the Crc of the data read from a replica.
+type ReplicaCrc struct {
+	Addr string
+	Crc  uint32
+}
+
+// ReadMismatchReport defines a range of an extent reported by a client of a volume with VerifyReads, whose data read
+// from two replicas have different Crcs. It is a suspected corruption, since the client can not tell which replica
+// is corrupted, and the range may be overwritten between the reads.
+type ReadMismatchReport struct {
+	VolName      string
+	Inode        uint64
+	PartitionID  uint64
+	ExtentID     uint64
+	ExtentOffset uint64
+	Size         uint32
+	Replicas     []*ReplicaCrc
+	ClientIP     string // set by the master
+	ReportTime   int64  // set by the master
+}
+
+// The types of the partitions in the placement diff
+const (
+	PartitionTypeData = "data"
+	PartitionTypeMeta = "meta"
+)
+
+// PartitionPlacementDiff defines a partition whose replicas reported by the nodes diverge from its hosts.
+type PartitionPlacementDiff struct {
+	PartitionID     uint64
+	PartitionType   string
+	VolName         string
+	Hosts           []string // the hosts of the partition on the master
+	ReportedHosts   []string // the active nodes which report the partition in the latest heartbeat
+	MissingHosts    []string // the active hosts which do not report the partition
+	UnexpectedHosts []string // the nodes which report the partition but are not its hosts
+	InactiveHosts   []string // the hosts whose replicas are unknown since they are inactive
+}
+
+// PlacementDiffReport defines the partitions whose actual replicas diverge from the hosts on the master.
+// The partitions reported by the nodes but unknown to the master have no hosts.
+type PlacementDiffReport struct {
+	CheckedDataPartitions int
+	CheckedMetaPartitions int
+	InactiveDataNodes     []string
+	InactiveMetaNodes     []string
+	Diffs                 []*PartitionPlacementDiff
+}
+
+// DiskPlacementView explains whether the new data partitions are placed on a disk of a data node.
+type DiskPlacementView struct {
+	Path       string
+	Total      uint64
+	Used       uint64
+	Available  uint64
+	UsageRatio float64
+	Status     int
+	Partitions int
+	Eligible   bool
+	Preferred  bool   // the emptiest eligible disk of the node, which the next partition on the node is placed on
+	Reason     string // why the disk is excluded
+}
+
+// DataNodePlacementView explains whether the new data partitions are placed on a data node.
+type DataNodePlacementView struct {
+	Addr       string
+	ZoneName   string
+	UsageRatio float64
+	Eligible   bool
+	Reason     string // why the node is excluded
+	Disks      []*DiskPlacementView
+}
+
+// ReplicaPlacement defines the placement of a replica of a data partition created by the master.
+type ReplicaPlacement struct {
+	Addr           string
+	Zone           string
+	Rack           string  `json:",omitempty"`
+	PreferredDisk  string  // empty if the data node reports no disks
+	PreferredUsage float64 // usage ratio of the preferred disk when the partition is created
+	DiskPath       string  // the disk the replica is created on, as replied by the data node
+}
+
+// PlacementDecision defines the placement of a data partition created by the master.
+type PlacementDecision struct {
+	PartitionID   uint64
+	VolName       string
+	CreateType    int
+	CreateTime    int64
+	DiskThreshold float32
+	FailureDomain string // the failure domain of the volume validated against, empty if not validated
+	Replicas      []*ReplicaPlacement
+}
+
+// DataPartitionCreation defines the result of creating the data partitions of a volume, with the placement
+// decisions of the new data partitions.
+type DataPartitionCreation struct {
+	Message   string
+	Decisions []*PlacementDecision
+}
+
+// DataPartitionCreationQueue shows the limits and the state of the data partition creations admitted by the master.
+type DataPartitionCreationQueue struct {
+	Concurrency  int            // creations running in the cluster at most
+	RatePerSec   int            // creations started per second at most, 0 if unlimited
+	VolQueueSize int            // creations of a volume waiting at most
+	WaitSec      int64          // a creation is rejected once it waits this long
+	Running      map[string]int // vol name -> creations running
+	Waiting      []*DataPartitionCreationWaiter
+	Admitted     uint64
+	Rejected     uint64 // since the queue of the volume is full
+	TimedOut     uint64
+}
+
+type DataPartitionCreationWaiter struct {
+	VolName   string
+	WaitedSec int64
+}
+
+// DataPartitionPlacementView explains the placement of the new data partitions on the data nodes and their disks,
+// along with the latest placement decisions.
+type DataPartitionPlacementView struct {
+	DiskThreshold float32
+	DataNodes     []*DataNodePlacementView
+	Decisions     []*PlacementDecision
+}
+
+// The pressure levels of the resources of a node
+const (
+	PressureNormal   = "normal"
+	PressureWarning  = "warning"
+	PressureCritical = "critical"
+)
+
+// ResourcePressure defines the usage of the memory and the file descriptors of a node against their limits.
+type ResourcePressure struct {
+	Level            string
+	MemoryUsed       uint64 // resident set size of the process
+	MemoryLimit      uint64 // the memory limit of the cgroup, or the total memory if it is unlimited
+	OpenFiles        uint64
+	MaxOpenFiles     uint64 // the soft limit of the open files
+	RejectedRequests uint64 // the client requests shed under the critical pressure
+	UpdateTime       int64
+}
+
+// The roles of the network interfaces of a node
+const (
+	InterfaceRoleClient  = "client"
+	InterfaceRoleReplica = "replica"
+)
+
+// InterfaceThroughput defines the throughput of a network interface of a node, which serves the client traffic, the
+// replication traffic between the nodes, or both.
+type InterfaceThroughput struct {
+	Name          string
+	IP            string
+	Roles         []string
+	RxBytes       uint64 // the bytes received since the interface is up
+	TxBytes       uint64
+	RxBytesPerSec uint64 // the throughput within the latest sample interval
+	TxBytesPerSec uint64
+	UpdateTime    int64
+}
+
+// The types of the nodes in the version inventory
+const (
+	NodeTypeData = "datanode"
+	NodeTypeMeta = "metanode"
+)
+
+// NodeVersion defines the build information reported by a node in the latest heartbeat.
+type NodeVersion struct {
+	Addr       string
+	NodeType   string
+	ZoneName   string
+	IsActive   bool
+	ReportTime int64
+	Reported   bool // false if the node has not reported its build information since the master took office
+	Stale      bool // true if the node runs a commit other than the expected one
+	BuildInfo
+}
+
+// NodeVersionsView defines the build information of the nodes in the cluster.
+type NodeVersionsView struct {
+	Master           BuildInfo
+	ExpectedCommitID string
+	CommitCounts     map[string]int // commit ID -> number of the reported nodes running it
+	StaleNodes       []string
+	UnreportedNodes  []string
+	Nodes            []*NodeVersion
+}
+
+// SchemaVersionView describes the schema version of the metadata stored by the masters.
+type SchemaVersionView struct {
+	Current  int            // version of the records written by the leader
+	Stored   int            // highest version the store has been raised to by a leader
+	Migrated map[string]int // kind of the records -> number of the records upgraded when loaded by the leader
+}
+
+// MetaPartitionFreezeMark records the applied index of a meta partition when its volume was frozen.
+type MetaPartitionFreezeMark struct {
+	PartitionID uint64
+	ApplyID     uint64
+}
+
+// VolShadowView describes the shadow volume which mirrors the primary volume synchronously within the cluster. The
+// meta nodes mirror the mutations of the namespace with the same inode numbers, and the clients mirror the data,
+// which is placed on the nodes other than the ones of the primary volume.
+type VolShadowView struct {
+	Name         string // the shadow volume
+	Active       bool   // the clients are served by the shadow, since the primary volume failed over to it
+	OutOfSync    bool   // a mutation failed to be mirrored, so the primary volume never fails over automatically
+	SyncError    string // why the shadow is out of sync
+	FailoverTime int64
+	FailoverBy   string // why the primary volume failed over
+}
+
+// ShadowMirrors returns whether the mutations of the volume are mirrored to the shadow.
+func (v *VolShadowView) ShadowMirrors() bool {
+	return v != nil && !v.Active
+}
+
+// VolFreezeView describes a frozen volume. The token is required to thaw the volume, and the applied indexes of the
+// meta partitions mark the state captured by the external snapshots.
+type VolFreezeView struct {
+	Name                 string
+	Token                string
+	FreezeTime           int64
+	MetaPartitions       []*MetaPartitionFreezeMark
+	FrozenDataPartitions []uint64 // data partitions frozen by the volume, the ones frozen before are kept frozen when thawed
+}
+
+const (
+	DefaultVolReservationTTLHours = 24
+	MaxVolReservationTTLHours     = 30 * 24
+)
+
+// VolReservation describes the space reserved on a volume for a time window, e.g. for a large batch job. The space is
+// held until the reservation expires or is canceled, no matter how much of it is written.
+type VolReservation struct {
+	ID         uint64
+	VolName    string
+	Size       uint64 // GB
+	CreateTime int64
+	ExpireTime int64
+}
+
+// VolReservationsView describes the active reservations of a volume.
+type VolReservationsView struct {
+	VolName      string
+	Capacity     uint64 // GB
+	UsedSize     uint64 // GB
+	ReservedSize uint64 // GB
+	Reservations []*VolReservation
+}
+
+// BootstrapManifest describes the initial topology and the default volume of a cluster.
+type BootstrapManifest struct {
+	DataNodes []*BootstrapNode
+	MetaNodes []*BootstrapNode
+	Volume    *BootstrapVolume
+}
+
+// BootstrapNode defines a node to be added into the specified zone, the default zone is used if ZoneName is empty.
+type BootstrapNode struct {
+	Addr     string
+	ZoneName string
+	Spare    bool // only for data nodes
+}
+
+// BootstrapVolume defines the default volume to be created.
+type BootstrapVolume struct {
+	Name         string
+	Owner        string
+	Capacity     int // GB
+	MpCount      int
+	DpReplicaNum int
+	DpSize       int // GB
+	FollowerRead bool
+	CrossZone    bool
+	ZoneName     string
+	Description  string
+	// the dentries are looked up case-insensitively
+	CaseInsensitive bool
+}
+
+const (
+	BootstrapStepCreated = "created"
+	BootstrapStepExists  = "exists"
+	BootstrapStepFailed  = "failed"
+)
+
+// BootstrapStep is the progress of a step executed to bootstrap the cluster.
+type BootstrapStep struct {
+	Action string
+	Target string
+	Status string
+	Msg    string
+}
+
+// BootstrapResult reports the steps executed to bootstrap the cluster.
+// Bootstrapping is idempotent, so the failed steps can be retried by submitting the same manifest again.
+type BootstrapResult struct {
+	Steps  []*BootstrapStep
+	Failed int
+}
+
 //ZoneView define the view of zone
 type ZoneView struct {
 	Name    string
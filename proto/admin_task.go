@@ -15,6 +15,8 @@
 package proto
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"time"
 )
@@ -41,6 +43,10 @@ type AdminTask struct {
 	SendCount    uint8
 	Request      interface{}
 	Response     interface{}
+
+	// Nonce is drawn at random when the task is created and echoed back in the response of the task, so that the
+	// master accepts the response only for the very task which is outstanding.
+	Nonce uint64
 }
 
 // ToString returns the string format of the task.
@@ -121,5 +127,17 @@ func NewAdminTask(opCode uint8, opAddr string, request interface{}) (t *AdminTas
 	t.OperatorAddr = opAddr
 	t.ID = fmt.Sprintf("addr[%v]_op[%v]", t.OperatorAddr, t.OpCode)
 	t.CreateTime = time.Now().Unix()
+	t.Nonce = newTaskNonce()
+	return
+}
+
+func newTaskNonce() (nonce uint64) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		nonce = binary.BigEndian.Uint64(b[:])
+	}
+	if nonce == 0 {
+		nonce = uint64(time.Now().UnixNano())
+	}
 	return
 }
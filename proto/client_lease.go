@@ -0,0 +1,25 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import "time"
+
+// A mounted client registers to the master with a unique client ID, and renews the registration at
+// ClientLeaseInterval until it is unmounted. The master rejects the new registrations of a volume once its live
+// clients reach the maximum of the volume, which protects the meta nodes from the runaway client fleets.
+const (
+	// ClientLeaseInterval is the interval at which the mounted clients renew their registrations.
+	ClientLeaseInterval = time.Minute
+)
@@ -0,0 +1,54 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The types of the cluster events
+const (
+	EventDataNodeDown                 = "DataNodeDown"                 // Resource: addr
+	EventMetaNodeDown                 = "MetaNodeDown"                 // Resource: addr
+	EventDiskOffline                  = "DiskOffline"                  // Resource: addr:path
+	EventDataPartitionUnderReplicated = "DataPartitionUnderReplicated" // Resource: partition id
+	EventMetaPartitionUnderReplicated = "MetaPartitionUnderReplicated" // Resource: partition id
+	EventVolumeFull                   = "VolumeFull"                   // Resource: vol name
+	EventTinyExtentsLow               = "TinyExtentsLow"               // Resource: partition id
+)
+
+// The severities of the cluster events
+const (
+	EventSeverityCritical = "critical"
+	EventSeverityWarning  = "warning"
+	EventSeverityInfo     = "info"
+)
+
+// ClusterEvent defines a structured event of a critical state change of the cluster. An event is raised once when
+// the condition begins, and an event of the same type and resource with Resolved set is raised when it ends.
+type ClusterEvent struct {
+	ID       uint64
+	Time     int64
+	Cluster  string
+	Type     string
+	Severity string
+	Resource string
+	Vol      string `json:",omitempty"`
+	Msg      string
+	Resolved bool
+}
+
+// ClusterEventsView defines the view of the events kept by the master.
+type ClusterEventsView struct {
+	Webhooks []string
+	Dropped  uint64 // the number of events not pushed to the webhooks for the queue is full
+	Events   []*ClusterEvent
+}
@@ -0,0 +1,255 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDelegatedTokenTTLHours = 1
+	MaxDelegatedTokenTTLHours     = 7 * 24
+
+	internalDelegatedTokenID  = "internal"
+	internalDelegatedTokenTTL = time.Minute
+	inodeCapSize              = 12
+)
+
+// DelegatedToken is the payload of a short-lived token minted by the owner of a volume for the batch jobs. The token
+// is the payload signed with the key shared by the masters, the meta nodes and the data nodes, so that they validate
+// it without asking the master.
+type DelegatedToken struct {
+	ID         string `json:"id"`
+	VolName    string `json:"vol"`
+	ReadOnly   bool   `json:"ro,omitempty"`
+	SubDir     string `json:"dir,omitempty"`
+	RootInode  uint64 `json:"root,omitempty"` // the inode of SubDir, which the meta nodes confine the requests under
+	IssueTime  int64  `json:"iat"`
+	ExpireTime int64  `json:"exp"`
+}
+
+// DelegatedTokenView is the reply of minting a delegated token.
+type DelegatedTokenView struct {
+	Token      string
+	VolName    string
+	ReadOnly   bool
+	SubDir     string
+	RootInode  uint64
+	ExpireTime int64
+}
+
+func signDelegatedToken(payload string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the token of the payload signed with the key.
+func (t *DelegatedToken) Sign(key []byte) (token string, err error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signDelegatedToken(payload, key), nil
+}
+
+// Expired returns whether the token is expired at the time.
+func (t *DelegatedToken) Expired(now time.Time) bool {
+	return now.Unix() >= t.ExpireTime
+}
+
+// Allows returns whether the token grants the access to the volume, or to mutate it if write is set.
+func (t *DelegatedToken) Allows(volName string, write bool) bool {
+	return t.VolName == volName && (!write || !t.ReadOnly)
+}
+
+// Scoped returns whether the token is confined to a sub directory of the volume.
+func (t *DelegatedToken) Scoped() bool {
+	return t.SubDir != ""
+}
+
+// InodeCap returns the capability of the inode under the sub directory of the token, which the meta nodes grant in
+// the replies of the lookups, the directory reads and the inode creations, and the client presents in the requests
+// on the inode afterwards. The capability is bound to the token, so it expires with the token.
+func (t *DelegatedToken) InodeCap(key []byte, ino uint64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(t.ID + ":" + strconv.FormatUint(ino, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:inodeCapSize])
+}
+
+// NewInternalDelegatedToken returns a short-lived token with the full access to the volume, which the servers attach
+// to the requests they send on behalf of the volume, e.g. the lookups of the master and the mirrored requests of the
+// meta nodes, so that the volumes requiring the tokens serve them. It returns an empty token without the key.
+func NewInternalDelegatedToken(volName string, key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	now := time.Now()
+	t := &DelegatedToken{
+		ID:         internalDelegatedTokenID,
+		VolName:    volName,
+		IssueTime:  now.Unix(),
+		ExpireTime: now.Add(internalDelegatedTokenTTL).Unix(),
+	}
+	token, err := t.Sign(key)
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// DecodeDelegatedToken decodes the payload of a token without verifying it, which is for the clients to learn the
+// scope of the token they are given.
+func DecodeDelegatedToken(token string) (t *DelegatedToken, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrDelegatedTokenInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrDelegatedTokenInvalid
+	}
+	t = &DelegatedToken{}
+	if err = json.Unmarshal(data, t); err != nil {
+		return nil, ErrDelegatedTokenInvalid
+	}
+	return t, nil
+}
+
+// VerifyDelegatedToken verifies the signature of a token with the key, and returns its payload if it is not expired.
+func VerifyDelegatedToken(token string, key []byte) (t *DelegatedToken, err error) {
+	if len(key) == 0 {
+		return nil, ErrDelegatedTokenNotEnabled
+	}
+	i := strings.LastIndex(token, ".")
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(signDelegatedToken(token[:i], key))) {
+		return nil, ErrDelegatedTokenInvalid
+	}
+	if t, err = DecodeDelegatedToken(token); err != nil {
+		return
+	}
+	if t.Expired(time.Now()) {
+		return nil, ErrDelegatedTokenExpired
+	}
+	return t, nil
+}
+
+// delegatedTokenArgMark precedes the delegated token in the arg of a packet. It is appended to the other arg, e.g.
+// the addresses of the followers which end with AddrSplit, so that the nodes unaware of it ignore the token.
+var delegatedTokenArgMark = []byte("\x00token=")
+
+// AttachDelegatedToken appends the token to the arg of a packet.
+func AttachDelegatedToken(arg []byte, token string) []byte {
+	if token == "" {
+		return arg
+	}
+	result := make([]byte, 0, len(arg)+len(delegatedTokenArgMark)+len(token))
+	result = append(result, arg...)
+	result = append(result, delegatedTokenArgMark...)
+	return append(result, token...)
+}
+
+// DetachDelegatedToken splits the arg of a packet into the other arg and the delegated token.
+func DetachDelegatedToken(arg []byte) (rest []byte, token string) {
+	i := bytes.LastIndex(arg, delegatedTokenArgMark)
+	if i < 0 {
+		return arg, ""
+	}
+	return arg[:i], string(arg[i+len(delegatedTokenArgMark):])
+}
+
+// inodeCapsArgMark precedes the capabilities of the inodes in the arg of a packet, which are attached before the
+// delegated token. The meta nodes reply the capabilities they grant in the arg of the replies the same way.
+var inodeCapsArgMark = []byte("\x00caps=")
+
+// AttachInodeCaps appends the capabilities of the inodes to the arg of a packet.
+func AttachInodeCaps(arg []byte, caps map[uint64]string) []byte {
+	if len(caps) == 0 {
+		return arg
+	}
+	items := make([]string, 0, len(caps))
+	for ino, c := range caps {
+		items = append(items, strconv.FormatUint(ino, 10)+":"+c)
+	}
+	result := make([]byte, 0, len(arg)+len(inodeCapsArgMark))
+	result = append(result, arg...)
+	result = append(result, inodeCapsArgMark...)
+	return append(result, strings.Join(items, ",")...)
+}
+
+// DetachInodeCaps splits the arg of a packet, from which the delegated token is detached, into the other arg and the
+// capabilities of the inodes. The malformed capabilities are skipped.
+func DetachInodeCaps(arg []byte) (rest []byte, caps map[uint64]string) {
+	i := bytes.LastIndex(arg, inodeCapsArgMark)
+	if i < 0 {
+		return arg, nil
+	}
+	caps = make(map[uint64]string)
+	for _, item := range strings.Split(string(arg[i+len(inodeCapsArgMark):]), ",") {
+		j := strings.IndexByte(item, ':')
+		if j < 0 {
+			continue
+		}
+		ino, err := strconv.ParseUint(item[:j], 10, 64)
+		if err != nil {
+			continue
+		}
+		caps[ino] = item[j+1:]
+	}
+	return arg[:i], caps
+}
+
+// The fields of the metadata requests which refer to the inodes, either a number or an array of numbers.
+var requestInodeFields = []string{"ino", "inos", "pino", "srcPid", "dstPid", "dirs"}
+
+// RequestInodes returns the inodes the metadata request refers to by its top level fields, e.g. the parent of the
+// dentry to look up, or the inodes to get in a batch. The zero ones, which the requests leave unset, are skipped.
+func RequestInodes(data []byte) (inodes []uint64, err error) {
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	for _, name := range requestInodeFields {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var ino uint64
+		if err = json.Unmarshal(raw, &ino); err == nil {
+			if ino != 0 {
+				inodes = append(inodes, ino)
+			}
+			continue
+		}
+		var list []uint64
+		if err = json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+		for _, ino = range list {
+			if ino != 0 {
+				inodes = append(inodes, ino)
+			}
+		}
+	}
+	return inodes, nil
+}
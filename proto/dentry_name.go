@@ -0,0 +1,69 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// DentryNamePolicy defines the rules of the names of the dentries created or renamed in a volume, which are enforced
+// by the meta nodes. The zero value accepts any name.
+type DentryNamePolicy struct {
+	MaxLength      int  `json:",omitempty"` // the maximum bytes of a name, 0 for unlimited
+	ValidUTF8      bool `json:",omitempty"` // the names must be valid UTF-8
+	NoControlChars bool `json:",omitempty"` // the names must not contain the ASCII control characters
+	// Relaxed only logs the names breaking the rules instead of refusing them, for migrating the legacy data.
+	Relaxed bool `json:",omitempty"`
+}
+
+// IsZero returns whether the policy accepts any name.
+func (p *DentryNamePolicy) IsZero() bool {
+	return p == nil || (p.MaxLength <= 0 && !p.ValidUTF8 && !p.NoControlChars)
+}
+
+// Check returns OpOk if the name follows the rules of the policy, or OpNameTooLong or OpInvalidName with the reason,
+// regardless of Relaxed.
+func (p *DentryNamePolicy) Check(name string) (resultCode uint8, err error) {
+	if p.IsZero() {
+		return OpOk, nil
+	}
+	if p.MaxLength > 0 && len(name) > p.MaxLength {
+		return OpNameTooLong, fmt.Errorf("name of %v bytes exceeds %v bytes", len(name), p.MaxLength)
+	}
+	if p.ValidUTF8 && !utf8.ValidString(name) {
+		return OpInvalidName, fmt.Errorf("name is not valid UTF-8")
+	}
+	if p.NoControlChars {
+		for i := 0; i < len(name); i++ {
+			if c := name[i]; c < 0x20 || c == 0x7f {
+				return OpInvalidName, fmt.Errorf("name contains control character %#x at byte %v", c, i)
+			}
+		}
+	}
+	return OpOk, nil
+}
+
+// String returns the rules of the policy for display.
+func (p *DentryNamePolicy) String() string {
+	if p.IsZero() {
+		return "any"
+	}
+	s := fmt.Sprintf("maxLength(%v) validUTF8(%v) noControlChars(%v)", p.MaxLength, p.ValidUTF8, p.NoControlChars)
+	if p.Relaxed {
+		s += " relaxed"
+	}
+	return s
+}
@@ -0,0 +1,280 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ErrorCategory classifies the errors by how the callers should react to them.
+type ErrorCategory uint8
+
+const (
+	ErrCategoryNone      ErrorCategory = iota // no error
+	ErrCategoryRetryable                      // transient, the request may succeed if retried, e.g. by another replica
+	ErrCategoryBusy                           // the server is overloaded or limited, retry after a backoff
+	ErrCategoryNotFound                       // the target of the request does not exist
+	ErrCategoryFatal                          // the request fails again if it is retried
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrCategoryNone:
+		return "none"
+	case ErrCategoryRetryable:
+		return "retryable"
+	case ErrCategoryBusy:
+		return "busy"
+	case ErrCategoryNotFound:
+		return "notFound"
+	case ErrCategoryFatal:
+		return "fatal"
+	default:
+		return fmt.Sprintf("unknown(%v)", uint8(c))
+	}
+}
+
+type resultCodeEntry struct {
+	name     string
+	category ErrorCategory
+	errno    syscall.Errno
+}
+
+// resultCodeCatalog describes the result codes of the packets replied by the data nodes and the meta nodes.
+var resultCodeCatalog = map[uint8]resultCodeEntry{
+	OpOk:               {"Ok", ErrCategoryNone, 0},
+	OpIntraGroupNetErr: {"IntraGroupNetErr", ErrCategoryRetryable, syscall.EIO},
+	OpArgMismatchErr:   {"ArgUnmatchErr", ErrCategoryFatal, syscall.EINVAL},
+	OpNotExistErr:      {"NotExistErr", ErrCategoryNotFound, syscall.ENOENT},
+	OpDiskNoSpaceErr:   {"DiskNoSpaceErr", ErrCategoryRetryable, syscall.ENOSPC},
+	OpDiskErr:          {"DiskErr", ErrCategoryRetryable, syscall.EIO},
+	OpErr:              {"Err", ErrCategoryRetryable, syscall.EAGAIN},
+	OpAgain:            {"Again", ErrCategoryBusy, syscall.EAGAIN},
+	OpExistErr:         {"ExistErr", ErrCategoryFatal, syscall.EEXIST},
+	OpInodeFullErr:     {"InodeFullErr", ErrCategoryFatal, syscall.ENOMEM},
+	OpTryOtherAddr:     {"TryOtherAddr", ErrCategoryRetryable, syscall.EAGAIN},
+	OpNotPerm:          {"NotPerm", ErrCategoryFatal, syscall.EPERM},
+	OpNotEmtpy:         {"DirNotEmpty", ErrCategoryFatal, syscall.ENOTEMPTY},
+	OpCrcMismatchErr:   {"CrcMismatchErr", ErrCategoryRetryable, syscall.EIO},
+	OpVolFrozen:        {"VolFrozen", ErrCategoryBusy, syscall.EBUSY},
+	OpTimeout:          {"Timeout", ErrCategoryBusy, syscall.ETIMEDOUT},
+	OpNameTooLong:      {"NameTooLong", ErrCategoryFatal, syscall.ENAMETOOLONG},
+	OpInvalidName:      {"InvalidName", ErrCategoryFatal, syscall.EINVAL},
+}
+
+// ResultCodeName returns the name of a result code.
+func ResultCodeName(code uint8) string {
+	if entry, ok := resultCodeCatalog[code]; ok {
+		return entry.name
+	}
+	return fmt.Sprintf("Unknown(%v)", code)
+}
+
+// ResultCodeCategory returns the category of a result code, the unknown codes are fatal.
+func ResultCodeCategory(code uint8) ErrorCategory {
+	if entry, ok := resultCodeCatalog[code]; ok {
+		return entry.category
+	}
+	return ErrCategoryFatal
+}
+
+// ResultCodeErrno returns the errno a result code is reported as to the applications.
+func ResultCodeErrno(code uint8) syscall.Errno {
+	if entry, ok := resultCodeCatalog[code]; ok {
+		return entry.errno
+	}
+	return syscall.EIO
+}
+
+// ResultCodeError is the error of a request replied with a result code other than OpOk.
+type ResultCodeError struct {
+	Code uint8
+	Msg  string
+}
+
+// NewResultCodeError returns the error of a reply with the result code.
+func NewResultCodeError(code uint8, msg string) error {
+	return &ResultCodeError{Code: code, Msg: msg}
+}
+
+func resultCodeMarker(code uint8) string {
+	return fmt.Sprintf("ResultCode(%v)", ResultCodeName(code))
+}
+
+// Error carries the name of the result code, so that the code can be recovered by ResultCodeOf even if the error is
+// wrapped into a message.
+func (e *ResultCodeError) Error() string {
+	return fmt.Sprintf("%v %v", resultCodeMarker(e.Code), e.Msg)
+}
+
+type registeredError struct {
+	msg  string
+	code uint8
+}
+
+var (
+	registeredErrorsMutex sync.RWMutex
+	registeredErrors      []registeredError
+)
+
+// RegisterResultCode registers the result code replied for an error. The errors are matched by their messages in
+// the order they are registered, since they are usually traced into the messages of other errors.
+func RegisterResultCode(err error, code uint8) {
+	registeredErrorsMutex.Lock()
+	defer registeredErrorsMutex.Unlock()
+	registeredErrors = append(registeredErrors, registeredError{msg: err.Error(), code: code})
+}
+
+// ResultCodeOf returns the result code of an error, which is either a ResultCodeError or contains the message of a
+// registered error.
+func ResultCodeOf(err error) (code uint8, ok bool) {
+	if err == nil {
+		return OpOk, true
+	}
+	if e, is := err.(*ResultCodeError); is {
+		return e.Code, true
+	}
+	return ResultCodeOfMessage(err.Error())
+}
+
+// IsResultCode returns whether an error is of the result code.
+func IsResultCode(err error, code uint8) bool {
+	c, ok := ResultCodeOf(err)
+	return ok && c == code
+}
+
+// ResultCodeOfMessage returns the result code of an error message.
+func ResultCodeOfMessage(msg string) (code uint8, ok bool) {
+	registeredErrorsMutex.RLock()
+	defer registeredErrorsMutex.RUnlock()
+	for _, re := range registeredErrors {
+		if strings.Contains(msg, re.msg) {
+			return re.code, true
+		}
+	}
+	for code := range resultCodeCatalog {
+		if code != OpOk && strings.Contains(msg, resultCodeMarker(code)) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// httpCodeCategories holds the categories of the error codes replied by the master, the codes missing are fatal.
+var httpCodeCategories = map[int32]ErrorCategory{
+	ErrCodeSuccess:                  ErrCategoryNone,
+	ErrCodeInternalError:            ErrCategoryRetryable,
+	ErrCodePersistenceByRaft:        ErrCategoryRetryable,
+	ErrCodeNoLeader:                 ErrCategoryRetryable,
+	ErrCodeActiveDataNodesTooLess:   ErrCategoryRetryable,
+	ErrCodeActiveMetaNodesTooLess:   ErrCategoryRetryable,
+	ErrCodeNoAvailDataPartition:     ErrCategoryRetryable,
+	ErrCodeNoDataNodeToWrite:        ErrCategoryRetryable,
+	ErrCodeNoMetaNodeToWrite:        ErrCategoryRetryable,
+	ErrCodeNodeClockSkew:            ErrCategoryRetryable,
+	ErrCodeTooManyClients:           ErrCategoryBusy,
+	ErrCodeVolFrozen:                ErrCategoryBusy,
+	ErrCodeVolNotExists:             ErrCategoryNotFound,
+	ErrCodeMetaPartitionNotExists:   ErrCategoryNotFound,
+	ErrCodeDataPartitionNotExists:   ErrCategoryNotFound,
+	ErrCodeDataNodeNotExists:        ErrCategoryNotFound,
+	ErrCodeMetaNodeNotExists:        ErrCategoryNotFound,
+	ErrCodeAccessKeyNotExists:       ErrCategoryNotFound,
+	ErrCodeUserNotExists:            ErrCategoryNotFound,
+	ErrCodeVolPolicyNotExists:       ErrCategoryNotFound,
+	ErrCodeZoneNotExists:            ErrCategoryNotFound,
+	ErrCodeTokenNotExist:            ErrCategoryNotFound,
+	ErrCodeMaintenancePlanNotExists: ErrCategoryNotFound,
+}
+
+// httpCodeOf returns the error code of an error replied by the master.
+func httpCodeOf(err error) (code int32, ok bool) {
+	// the errors of the uncomparable types panic as the keys of a map
+	if !reflect.TypeOf(err).Comparable() {
+		return
+	}
+	code, ok = Err2CodeMap[err]
+	return
+}
+
+// HTTPCodeCategory returns the category of an error code replied by the master.
+func HTTPCodeCategory(code int32) ErrorCategory {
+	if category, ok := httpCodeCategories[code]; ok {
+		return category
+	}
+	return ErrCategoryFatal
+}
+
+// ErrorCategoryOf classifies the errors replied by the master, the data nodes and the meta nodes, as well as the
+// errnos and the network errors. The other errors are fatal.
+func ErrorCategoryOf(err error) ErrorCategory {
+	if err == nil {
+		return ErrCategoryNone
+	}
+	if code, ok := httpCodeOf(err); ok {
+		return HTTPCodeCategory(code)
+	}
+	switch e := err.(type) {
+	case syscall.Errno:
+		switch e {
+		case syscall.ENOENT:
+			return ErrCategoryNotFound
+		case syscall.EAGAIN, syscall.EBUSY:
+			return ErrCategoryBusy
+		case syscall.EIO, syscall.ETIMEDOUT, syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.EPIPE:
+			return ErrCategoryRetryable
+		}
+		return ErrCategoryFatal
+	case net.Error:
+		return ErrCategoryRetryable
+	}
+	if code, ok := ResultCodeOf(err); ok {
+		return ResultCodeCategory(code)
+	}
+	return ErrCategoryFatal
+}
+
+// ErrnoOf returns the errno an error is reported as to the applications.
+func ErrnoOf(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+	if errno, ok := err.(syscall.Errno); ok {
+		return errno
+	}
+	if _, ok := httpCodeOf(err); !ok {
+		if code, ok := ResultCodeOf(err); ok {
+			return ResultCodeErrno(code)
+		}
+	}
+	switch ErrorCategoryOf(err) {
+	case ErrCategoryNotFound:
+		return syscall.ENOENT
+	case ErrCategoryBusy, ErrCategoryRetryable:
+		return syscall.EAGAIN
+	}
+	return syscall.EIO
+}
+
+// IsRetryable returns whether a request failed by the error may succeed if retried.
+func IsRetryable(err error) bool {
+	category := ErrorCategoryOf(err)
+	return category == ErrCategoryRetryable || category == ErrCategoryBusy
+}
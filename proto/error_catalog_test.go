@@ -0,0 +1,84 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestResultCodeOf(t *testing.T) {
+	// the result code is recovered from the messages of the errors traced by the callers
+	err := fmt.Errorf("read extent failed: %v", NewResultCodeError(OpNotEmtpy, "dir 10"))
+	if code, ok := ResultCodeOf(err); !ok || code != OpNotEmtpy {
+		t.Fatalf("expect the code %v of err %v, but is %v", ResultCodeName(OpNotEmtpy), err, ResultCodeName(code))
+	}
+	if !IsResultCode(err, OpNotEmtpy) || IsResultCode(err, OpNotExistErr) {
+		t.Fatalf("err %v should be of the code %v only", err, ResultCodeName(OpNotEmtpy))
+	}
+
+	registered := errors.New("extent has been deleted by the test")
+	RegisterResultCode(registered, OpNotExistErr)
+	err = fmt.Errorf("repair failed: %v", registered)
+	if code, ok := ResultCodeOf(err); !ok || code != OpNotExistErr {
+		t.Fatalf("expect the code of the registered err %v, but is %v", err, ResultCodeName(code))
+	}
+	if _, ok := ResultCodeOf(errors.New("some other error")); ok {
+		t.Fatalf("the unknown error should have no result code")
+	}
+	if ResultCodeName(0xe0) != "Unknown(224)" || ResultCodeCategory(0xe0) != ErrCategoryFatal || ResultCodeErrno(0xe0) != syscall.EIO {
+		t.Fatalf("the unknown result code should be fatal")
+	}
+}
+
+func TestErrorCategoryOf(t *testing.T) {
+	tests := []struct {
+		err      error
+		category ErrorCategory
+		errno    syscall.Errno
+	}{
+		{nil, ErrCategoryNone, 0},
+		// the errors replied by the master
+		{ErrVolNotExists, ErrCategoryNotFound, syscall.ENOENT},
+		{ErrNoLeader, ErrCategoryRetryable, syscall.EAGAIN},
+		{ErrTooManyClients, ErrCategoryBusy, syscall.EAGAIN},
+		{ErrParamError, ErrCategoryFatal, syscall.EIO},
+		// the result codes replied by the data nodes and the meta nodes
+		{NewResultCodeError(OpAgain, ""), ErrCategoryBusy, syscall.EAGAIN},
+		{NewResultCodeError(OpDiskNoSpaceErr, ""), ErrCategoryRetryable, syscall.ENOSPC},
+		{fmt.Errorf("lookup: %v", NewResultCodeError(OpNotExistErr, "")), ErrCategoryNotFound, syscall.ENOENT},
+		// the errnos and the network errors
+		{syscall.ENOENT, ErrCategoryNotFound, syscall.ENOENT},
+		{syscall.ECONNREFUSED, ErrCategoryRetryable, syscall.ECONNREFUSED},
+		{syscall.EPERM, ErrCategoryFatal, syscall.EPERM},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNRESET}, ErrCategoryRetryable, syscall.EAGAIN},
+		{errors.New("some other error"), ErrCategoryFatal, syscall.EIO},
+	}
+	for _, test := range tests {
+		if category := ErrorCategoryOf(test.err); category != test.category {
+			t.Fatalf("expect the category %v of err %v, but is %v", test.category, test.err, category)
+		}
+		if errno := ErrnoOf(test.err); errno != test.errno {
+			t.Fatalf("expect the errno %v of err %v, but is %v", test.errno, test.err, errno)
+		}
+		retryable := test.category == ErrCategoryRetryable || test.category == ErrCategoryBusy
+		if IsRetryable(test.err) != retryable {
+			t.Fatalf("err %v should be retryable[%v]", test.err, retryable)
+		}
+	}
+}
@@ -81,6 +81,41 @@ var (
 	ErrInvalidAccessKey                = errors.New("invalid access key")
 	ErrInvalidSecretKey                = errors.New("invalid secret key")
 	ErrIsOwner                         = errors.New("user owns the volume")
+	ErrDataPartitionReferenced         = errors.New("data partition is referenced by inodes")
+	ErrNodeClockSkew                   = errors.New("clock of the node skews too much from the master")
+	ErrDuplicateNodeAddr               = errors.New("node address is registered by another active instance")
+	ErrDuplicateNodeInstance           = errors.New("node instance is registered with another address")
+	ErrVolNotDeleted                   = errors.New("vol is not deleted")
+	ErrVolDeleteGraceExpired           = errors.New("grace period of the deleted vol has expired")
+	ErrDataPartitionFrozen             = errors.New("data partition is frozen")
+	ErrMaintenancePlanNotExists        = errors.New("maintenance plan does not exist")
+	ErrDuplicateMaintenancePlan        = errors.New("duplicate maintenance plan")
+	ErrMaintenancePlanState            = errors.New("operation is not allowed in the state of the maintenance plan")
+	ErrTooManyClients                  = errors.New("vol has reached the maximum number of the mounted clients")
+	ErrVolFrozen                       = errors.New("vol is frozen")
+	ErrVolNotFrozen                    = errors.New("vol is not frozen")
+	ErrVolFreezeTokenNotMatch          = errors.New("freeze token of the vol does not match")
+	ErrDelegatedTokenNotEnabled        = errors.New("delegated tokens are not enabled")
+	ErrDelegatedTokenInvalid           = errors.New("delegated token is invalid")
+	ErrDelegatedTokenExpired           = errors.New("delegated token is expired")
+	ErrDelegatedTokenRequired          = errors.New("delegated token is required by the vol")
+	ErrDelegatedTokenOutOfScope        = errors.New("inode is out of the sub directory of the delegated token")
+	ErrVolNoColdZone                   = errors.New("vol has no cold zone to move the files to")
+	ErrDataPartitionCreationQueueFull  = errors.New("too many data partition creations of the vol are queued")
+	ErrDataPartitionCreationTimeout    = errors.New("data partition creation waits too long in the queue")
+	ErrTenantNotExists                 = errors.New("tenant does not exist")
+	ErrDuplicateTenant                 = errors.New("duplicate tenant")
+	ErrTenantNotEmpty                  = errors.New("tenant still has volumes")
+	ErrTenantQuotaExceeded             = errors.New("the capacity of the volumes exceeds the quota of the tenant")
+	ErrVolInOtherTenant                = errors.New("vol belongs to another tenant")
+	ErrVolReservationExceedsCapacity   = errors.New("the used and the reserved space exceeds the capacity of the vol")
+	ErrNoSpaceToReserve                = errors.New("no available space of the data nodes to reserve")
+	ErrSpaceReserved                   = errors.New("the available space of the data nodes is reserved by the other vols")
+	ErrVolReservationNotExists         = errors.New("vol reservation does not exist")
+	ErrStaleVolCapacity                = errors.New("the capacity of the vol is changed since the data partition creation is planned")
+	ErrShadowVol                       = errors.New("vol is the shadow of another vol")
+	ErrNoShadowVol                     = errors.New("vol has no shadow")
+	ErrShadowVolActive                 = errors.New("vol has failed over to its shadow")
 )
 
 // http response error code and error message definitions
@@ -144,6 +179,38 @@ const (
 	ErrCodeInvalidAccessKey
 	ErrCodeInvalidSecretKey
 	ErrCodeIsOwner
+	ErrCodeDataPartitionReferenced
+	ErrCodeNodeClockSkew
+	ErrCodeDuplicateNodeAddr
+	ErrCodeDuplicateNodeInstance
+	ErrCodeVolNotDeleted
+	ErrCodeVolDeleteGraceExpired
+	ErrCodeDataPartitionFrozen
+	ErrCodeMaintenancePlanNotExists
+	ErrCodeDuplicateMaintenancePlan
+	ErrCodeMaintenancePlanState
+	ErrCodeTooManyClients
+	ErrCodeVolFrozen
+	ErrCodeVolNotFrozen
+	ErrCodeVolFreezeTokenNotMatch
+	ErrCodeDelegatedTokenNotEnabled
+	ErrCodeDelegatedTokenInvalid
+	ErrCodeDelegatedTokenExpired
+	ErrCodeDataPartitionCreationQueueFull
+	ErrCodeDataPartitionCreationTimeout
+	ErrCodeTenantNotExists
+	ErrCodeDuplicateTenant
+	ErrCodeTenantNotEmpty
+	ErrCodeTenantQuotaExceeded
+	ErrCodeVolInOtherTenant
+	ErrCodeVolReservationExceedsCapacity
+	ErrCodeNoSpaceToReserve
+	ErrCodeSpaceReserved
+	ErrCodeVolReservationNotExists
+	ErrCodeStaleVolCapacity
+	ErrCodeShadowVol
+	ErrCodeNoShadowVol
+	ErrCodeShadowVolActive
 )
 
 // Err2CodeMap error map to code
@@ -205,6 +272,38 @@ var Err2CodeMap = map[error]int32{
 	ErrInvalidAccessKey:                ErrCodeInvalidAccessKey,
 	ErrInvalidSecretKey:                ErrCodeInvalidSecretKey,
 	ErrIsOwner:                         ErrCodeIsOwner,
+	ErrDataPartitionReferenced:         ErrCodeDataPartitionReferenced,
+	ErrNodeClockSkew:                   ErrCodeNodeClockSkew,
+	ErrDuplicateNodeAddr:               ErrCodeDuplicateNodeAddr,
+	ErrDuplicateNodeInstance:           ErrCodeDuplicateNodeInstance,
+	ErrVolNotDeleted:                   ErrCodeVolNotDeleted,
+	ErrVolDeleteGraceExpired:           ErrCodeVolDeleteGraceExpired,
+	ErrDataPartitionFrozen:             ErrCodeDataPartitionFrozen,
+	ErrMaintenancePlanNotExists:        ErrCodeMaintenancePlanNotExists,
+	ErrDuplicateMaintenancePlan:        ErrCodeDuplicateMaintenancePlan,
+	ErrMaintenancePlanState:            ErrCodeMaintenancePlanState,
+	ErrTooManyClients:                  ErrCodeTooManyClients,
+	ErrVolFrozen:                       ErrCodeVolFrozen,
+	ErrVolNotFrozen:                    ErrCodeVolNotFrozen,
+	ErrVolFreezeTokenNotMatch:          ErrCodeVolFreezeTokenNotMatch,
+	ErrDelegatedTokenNotEnabled:        ErrCodeDelegatedTokenNotEnabled,
+	ErrDelegatedTokenInvalid:           ErrCodeDelegatedTokenInvalid,
+	ErrDelegatedTokenExpired:           ErrCodeDelegatedTokenExpired,
+	ErrDataPartitionCreationQueueFull:  ErrCodeDataPartitionCreationQueueFull,
+	ErrDataPartitionCreationTimeout:    ErrCodeDataPartitionCreationTimeout,
+	ErrTenantNotExists:                 ErrCodeTenantNotExists,
+	ErrDuplicateTenant:                 ErrCodeDuplicateTenant,
+	ErrTenantNotEmpty:                  ErrCodeTenantNotEmpty,
+	ErrTenantQuotaExceeded:             ErrCodeTenantQuotaExceeded,
+	ErrVolInOtherTenant:                ErrCodeVolInOtherTenant,
+	ErrVolReservationExceedsCapacity:   ErrCodeVolReservationExceedsCapacity,
+	ErrNoSpaceToReserve:                ErrCodeNoSpaceToReserve,
+	ErrSpaceReserved:                   ErrCodeSpaceReserved,
+	ErrVolReservationNotExists:         ErrCodeVolReservationNotExists,
+	ErrStaleVolCapacity:                ErrCodeStaleVolCapacity,
+	ErrShadowVol:                       ErrCodeShadowVol,
+	ErrNoShadowVol:                     ErrCodeNoShadowVol,
+	ErrShadowVolActive:                 ErrCodeShadowVolActive,
 }
 
 func ParseErrorCode(code int32) error {
@@ -273,6 +372,38 @@ var code2ErrMap = map[int32]error{
 	ErrCodeInvalidAccessKey:                ErrInvalidAccessKey,
 	ErrCodeInvalidSecretKey:                ErrInvalidSecretKey,
 	ErrCodeIsOwner:                         ErrIsOwner,
+	ErrCodeDataPartitionReferenced:         ErrDataPartitionReferenced,
+	ErrCodeNodeClockSkew:                   ErrNodeClockSkew,
+	ErrCodeDuplicateNodeAddr:               ErrDuplicateNodeAddr,
+	ErrCodeDuplicateNodeInstance:           ErrDuplicateNodeInstance,
+	ErrCodeVolNotDeleted:                   ErrVolNotDeleted,
+	ErrCodeVolDeleteGraceExpired:           ErrVolDeleteGraceExpired,
+	ErrCodeDataPartitionFrozen:             ErrDataPartitionFrozen,
+	ErrCodeMaintenancePlanNotExists:        ErrMaintenancePlanNotExists,
+	ErrCodeDuplicateMaintenancePlan:        ErrDuplicateMaintenancePlan,
+	ErrCodeMaintenancePlanState:            ErrMaintenancePlanState,
+	ErrCodeTooManyClients:                  ErrTooManyClients,
+	ErrCodeVolFrozen:                       ErrVolFrozen,
+	ErrCodeVolNotFrozen:                    ErrVolNotFrozen,
+	ErrCodeVolFreezeTokenNotMatch:          ErrVolFreezeTokenNotMatch,
+	ErrCodeDelegatedTokenNotEnabled:        ErrDelegatedTokenNotEnabled,
+	ErrCodeDelegatedTokenInvalid:           ErrDelegatedTokenInvalid,
+	ErrCodeDelegatedTokenExpired:           ErrDelegatedTokenExpired,
+	ErrCodeDataPartitionCreationQueueFull:  ErrDataPartitionCreationQueueFull,
+	ErrCodeDataPartitionCreationTimeout:    ErrDataPartitionCreationTimeout,
+	ErrCodeTenantNotExists:                 ErrTenantNotExists,
+	ErrCodeDuplicateTenant:                 ErrDuplicateTenant,
+	ErrCodeTenantNotEmpty:                  ErrTenantNotEmpty,
+	ErrCodeTenantQuotaExceeded:             ErrTenantQuotaExceeded,
+	ErrCodeVolInOtherTenant:                ErrVolInOtherTenant,
+	ErrCodeVolReservationExceedsCapacity:   ErrVolReservationExceedsCapacity,
+	ErrCodeNoSpaceToReserve:                ErrNoSpaceToReserve,
+	ErrCodeSpaceReserved:                   ErrSpaceReserved,
+	ErrCodeVolReservationNotExists:         ErrVolReservationNotExists,
+	ErrCodeStaleVolCapacity:                ErrStaleVolCapacity,
+	ErrCodeShadowVol:                       ErrShadowVol,
+	ErrCodeNoShadowVol:                     ErrNoShadowVol,
+	ErrCodeShadowVolActive:                 ErrShadowVolActive,
 }
 
 type GeneralResp struct {
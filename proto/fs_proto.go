@@ -72,6 +72,8 @@ type InodeInfo struct {
 	ModifyTime time.Time `json:"mt"`
 	CreateTime time.Time `json:"ct"`
 	AccessTime time.Time `json:"at"`
+	BirthTime  time.Time `json:"bt"`  // zero if replied by the older meta nodes
+	Reserved   uint64    `json:"rsv"` // the preallocated size of the file
 	Target     []byte    `json:"tgt"`
 
 	expiration int64
@@ -138,6 +140,10 @@ type CreateInodeRequest struct {
 	Uid         uint32 `json:"uid"`
 	Gid         uint32 `json:"gid"`
 	Target      []byte `json:"tgt"`
+	ReqID       string `json:"rid,omitempty"` // unique per mutation of the client, the same across its retries
+
+	// Inode is the number of the inode to create, only set by the meta node mirroring the inode to the shadow.
+	Inode uint64 `json:"ino,omitempty"`
 }
 
 // CreateInodeResponse defines the response to the request of creating an inode.
@@ -162,6 +168,7 @@ type UnlinkInodeRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
+	ReqID       string `json:"rid,omitempty"`
 }
 
 // UnlinkInodeRequest defines the request to unlink an inode.
@@ -206,6 +213,8 @@ type CreateDentryRequest struct {
 	Inode       uint64 `json:"ino"`
 	Name        string `json:"name"`
 	Mode        uint32 `json:"mode"`
+	ReqID       string `json:"rid,omitempty"`
+	Sync        bool   `json:"sync,omitempty"` // the dentry is synced by a raft barrier before the reply
 }
 
 // UpdateDentryRequest defines the request to update a dentry.
@@ -214,7 +223,9 @@ type UpdateDentryRequest struct {
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
 	Name        string `json:"name"`
-	Inode       uint64 `json:"ino"` // new inode number
+	Inode       uint64 `json:"ino"`            // new inode number
+	ReqID       string `json:"rid,omitempty"`
+	Sync        bool   `json:"sync,omitempty"` // the dentry is synced by a raft barrier before the reply
 }
 
 // UpdateDentryResponse defines the response to the request of updating a dentry.
@@ -228,6 +239,8 @@ type DeleteDentryRequest struct {
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
 	Name        string `json:"name"`
+	ReqID       string `json:"rid,omitempty"`
+	Sync        bool   `json:"sync,omitempty"` // the deletion is synced by a raft barrier before the reply
 }
 
 type BatchDeleteDentryRequest struct {
@@ -256,6 +269,7 @@ type LookupRequest struct {
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
 	Name        string `json:"name"`
+	AsOf        int64  `json:"asOf,omitempty"` // unix seconds to read the retained history, 0 to read the current tree
 }
 
 // LookupResponse defines the response for the loopup request.
@@ -264,11 +278,208 @@ type LookupResponse struct {
 	Mode  uint32 `json:"mode"`
 }
 
+// WatchDentryRequest defines the request to watch the dentries of the directories, which also polls the dentries
+// invalidated since the last request of the client.
+type WatchDentryRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	ClientID    string   `json:"cid"`
+	Dirs        []uint64 `json:"dirs"`
+}
+
+// InvalidDentry defines a dentry created, deleted or updated in a watched directory.
+type InvalidDentry struct {
+	ParentID uint64 `json:"pino"`
+	Name     string `json:"name"`
+}
+
+// WatchDentryResponse defines the response to the WatchDentryRequest. The directories in Overflow have too many
+// invalidated dentries to be listed, so the whole directories are invalidated.
+type WatchDentryResponse struct {
+	Dentries []*InvalidDentry `json:"dentries"`
+	Overflow []uint64         `json:"overflow"`
+}
+
+// The SHA256 checksum of a file is stored in the xattr named XAttrKeyChecksumSHA256 as "<generation>:<hex checksum>",
+// in which the generation is the one of the inode when the checksum is computed. The checksum is stale once the file
+// is written, since the writes increase the generation of the inode.
+const (
+	XAttrKeyChecksumSHA256  = "cfs.checksum.sha256"
+	ChecksumAlgorithmSHA256 = "sha256"
+)
+
+// FileChecksumRequest defines the request to get the checksum of a file, which is computed by the meta node with
+// the data nodes if it is absent or stale.
+type FileChecksumRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+}
+
+// FileChecksumResponse defines the response to the FileChecksumRequest.
+type FileChecksumResponse struct {
+	Inode      uint64 `json:"ino"`
+	Algorithm  string `json:"alg"`
+	Checksum   string `json:"checksum"` // in hex
+	Generation uint64 `json:"gen"`
+}
+
+// ExtentHashRequest defines the request to a data node to resume the hash state with the range of an extent.
+// The state is the one marshaled by the hash of the algorithm, and the data node replies with the resumed state.
+type ExtentHashRequest struct {
+	Algorithm string `json:"alg"`
+	Offset    uint64 `json:"off"`
+	Size      uint32 `json:"size"`
+	State     []byte `json:"state"`
+}
+
+// ExtentVerifyRequest defines the request to a replica of a data partition for the CRC of the range of an extent.
+type ExtentVerifyRequest struct {
+	Offset uint64 `json:"off"`
+	Size   uint32 `json:"size"`
+}
+
+// ExtentVerifyResponse defines the response to the ExtentVerifyRequest. The CRC is only computed if the replica
+// holds the whole range.
+type ExtentVerifyResponse struct {
+	Exists     bool   `json:"exists"`
+	Deleted    bool   `json:"deleted"`
+	ExtentSize uint64 `json:"extentSize"`
+	Complete   bool   `json:"complete"`
+	Crc        uint32 `json:"crc"`
+}
+
+// The problems of the extents found by verifying the replicas of a file.
+const (
+	VerifyProblemUnreachable = "unreachable"  // a replica fails to answer
+	VerifyProblemMissing     = "missing"      // the extent is absent or deleted on a replica
+	VerifyProblemShort       = "short"        // a replica does not hold the whole range of the extent
+	VerifyProblemCrcMismatch = "crc mismatch" // the CRCs of the range disagree among the replicas
+	VerifyProblemNoPartition = "no partition" // the data partition of the extent is unknown
+)
+
+// ReplicaVerifyResult is the state of the range of an extent on a replica.
+type ReplicaVerifyResult struct {
+	Addr       string `json:"addr"`
+	ExtentSize uint64 `json:"extentSize"`
+	Crc        uint32 `json:"crc"`
+	Err        string `json:"err,omitempty"`
+}
+
+// ExtentVerifyResult is the result of verifying the replicas of an extent of a file.
+type ExtentVerifyResult struct {
+	PartitionID  uint64                 `json:"pid"`
+	ExtentID     uint64                 `json:"extentId"`
+	FileOffset   uint64                 `json:"fileOffset"`
+	ExtentOffset uint64                 `json:"extentOffset"`
+	Size         uint32                 `json:"size"`
+	Problems     []string               `json:"problems"`
+	Replicas     []*ReplicaVerifyResult `json:"replicas"`
+}
+
+// FileVerifyReport is the result of verifying the replicas of the extents of a file. Only the extents with problems
+// are listed, up to MaxVerifyReportExtents.
+type FileVerifyReport struct {
+	Inode       uint64                `json:"ino"`
+	Generation  uint64                `json:"gen"`
+	Size        uint64                `json:"size"`
+	Extents     int                   `json:"extents"`
+	BadExtents  int                   `json:"badExtents"`
+	Healthy     bool                  `json:"healthy"`
+	Details     []*ExtentVerifyResult `json:"details"`
+	Truncated   bool                  `json:"truncated"`
+	ElapsedTime string                `json:"elapsed"`
+}
+
+const MaxVerifyReportExtents = 64
+
+// The blocks of the files in the volumes with FeatureDedup are deduplicated at the write time by their fingerprints,
+// which are the SHA256 checksums of the blocks. The meta partition indexes the blocks written to the files of the
+// partition, and the fingerprints of the blocks used by a file are stored in the hidden xattr XAttrKeyDedupBlocks.
+const (
+	XAttrKeyDedupBlocks  = "cfs.dedup.blocks"
+	DedupFingerprintSize = 32
+)
+
+// DedupBlock is a block of a file to be indexed by its fingerprint.
+type DedupBlock struct {
+	Fingerprint []byte `json:"fp"`
+	FileOffset  uint64 `json:"off"`
+	Size        uint32 `json:"size"`
+}
+
+// DedupRegisterRequest defines the request to index the blocks written to a file. The blocks must have been
+// appended to the file, and the ones whose fingerprints are already indexed are skipped.
+type DedupRegisterRequest struct {
+	VolName     string       `json:"vol"`
+	PartitionID uint64       `json:"pid"`
+	Inode       uint64       `json:"ino"`
+	Blocks      []DedupBlock `json:"blocks"`
+}
+
+// DedupRegisterResponse defines the response to the DedupRegisterRequest.
+type DedupRegisterResponse struct {
+	Registered int `json:"registered"`
+}
+
+// DedupReferenceRequest defines the request to append the indexed block of the fingerprint to a file at the offset
+// instead of writing the block again. The meta node replies OpNotExistErr if the fingerprint is not indexed.
+type DedupReferenceRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+	Fingerprint []byte `json:"fp"`
+	FileOffset  uint64 `json:"off"`
+}
+
+// DedupReferenceResponse defines the response to the DedupReferenceRequest.
+type DedupReferenceResponse struct {
+	Extent ExtentKey `json:"ek"`
+}
+
+// DedupStat is the statistics of the deduplicated blocks. The logical bytes count a block once for each file using
+// it, while the physical bytes count it once.
+type DedupStat struct {
+	Blocks        uint64 `json:"blocks"`
+	Extents       uint64 `json:"extents"`
+	LogicalBytes  uint64 `json:"logicalBytes"`
+	PhysicalBytes uint64 `json:"physicalBytes"`
+}
+
+// BatchRenameItem is a dentry to be moved by the BatchRenameRequest.
+type BatchRenameItem struct {
+	SrcName string `json:"src"`
+	DstName string `json:"dst"`
+	Inode   uint64 `json:"ino"`
+	Type    uint32 `json:"type"`
+}
+
+// BatchRenameRequest defines the request to move a set of dentries from the source directory to the destination
+// directory atomically, so that the readers observe either none or all of them. Both directories must belong to the
+// meta partition. A zero SrcParentID only links the destination dentries and a zero DstParentID only unlinks the
+// source dentries, which are used to move the dentries across meta partitions.
+type BatchRenameRequest struct {
+	VolName     string            `json:"vol"`
+	PartitionID uint64            `json:"pid"`
+	SrcParentID uint64            `json:"srcPid"`
+	DstParentID uint64            `json:"dstPid"`
+	Items       []BatchRenameItem `json:"items"`
+}
+
+// BatchRenameResponse defines the response to the BatchRenameRequest. The replaced inodes are the regular files
+// overwritten in the destination directory, which are to be unlinked by the client. The moved inodes are the ones
+// whose dentries are linked or unlinked by the request, excluding the ones done by a former attempt.
+type BatchRenameResponse struct {
+	Replaced []uint64 `json:"replaced"`
+	Moved    []uint64 `json:"moved"`
+}
+
 // InodeGetRequest defines the request to get the inode.
 type InodeGetRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
+	AsOf        int64  `json:"asOf,omitempty"` // unix seconds to read the retained history, 0 to read the current tree
 }
 
 // InodeGetResponse defines the response to the InodeGetRequest.
@@ -281,6 +492,7 @@ type BatchInodeGetRequest struct {
 	VolName     string   `json:"vol"`
 	PartitionID uint64   `json:"pid"`
 	Inodes      []uint64 `json:"inos"`
+	AsOf        int64    `json:"asOf,omitempty"` // unix seconds to read the retained history, 0 to read the current tree
 }
 
 // BatchInodeGetResponse defines the response to the request of getting the inode in batch.
@@ -293,6 +505,9 @@ type ReadDirRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
+	AsOf        int64  `json:"asOf,omitempty"`   // unix seconds to read the retained history, 0 to read the current tree
+	Marker      string `json:"marker,omitempty"` // reads the children named after the marker
+	Limit       uint64 `json:"limit,omitempty"`  // the most children to read, 0 to read all
 }
 
 // ReadDirResponse defines the response to the request of reading dir.
@@ -313,6 +528,7 @@ type GetExtentsRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
+	AsOf        int64  `json:"asOf,omitempty"` // unix seconds to read the retained history, 0 to read the current tree
 }
 
 // GetExtentsResponse defines the response to the request of getting extents.
@@ -330,6 +546,16 @@ type TruncateRequest struct {
 	Size        uint64 `json:"sz"`
 }
 
+// FallocateRequest defines the request to preallocate the space of the file up to Offset+Length. The preallocated
+// size of the inode is raised to it, the file size is kept.
+type FallocateRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+	Offset      uint64 `json:"off"`
+	Length      uint64 `json:"len"`
+}
+
 // SetAttrRequest defines the request to set attribute.
 type SetAttrRequest struct {
 	VolName     string `json:"vol"`
@@ -341,6 +567,9 @@ type SetAttrRequest struct {
 	ModifyTime  int64  `json:"mt"`
 	AccessTime  int64  `json:"at"`
 	Valid       uint32 `json:"valid"`
+	// the nanoseconds of the timestamps, ignored by the older meta nodes
+	ModifyTimeNsec uint32 `json:"mtn,omitempty"`
+	AccessTimeNsec uint32 `json:"atn,omitempty"`
 }
 
 const (
@@ -386,6 +615,7 @@ type GetXAttrRequest struct {
 	PartitionId uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
 	Key         string `json:"key"`
+	AsOf        int64  `json:"asOf,omitempty"` // unix seconds to read the retained history, 0 to read the current tree
 }
 
 type GetXAttrResponse struct {
@@ -407,6 +637,7 @@ type ListXAttrRequest struct {
 	VolName     string `json:"vol"`
 	PartitionId uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
+	AsOf        int64  `json:"asOf,omitempty"` // unix seconds to read the retained history, 0 to read the current tree
 }
 
 type ListXAttrResponse struct {
@@ -416,6 +647,31 @@ type ListXAttrResponse struct {
 	XAttrs      []string `json:"xattrs"`
 }
 
+// Files are tagged by the xattr named XAttrKeyTagPrefix+<tag>, and the value of the xattr,
+// if any, is the name of the file shown in the virtual directory of the tag.
+const (
+	XAttrKeyTagPrefix = "cfs.tag."
+	VirtualTagDirName = ".tags"
+)
+
+type ListTagRequest struct {
+	VolName     string `json:"vol"`
+	PartitionId uint64 `json:"pid"`
+	Tag         string `json:"tag"` // list all the tags if empty
+}
+
+type TagEntry struct {
+	Inode uint64 `json:"ino"`
+	Name  string `json:"name"`
+}
+
+type ListTagResponse struct {
+	VolName     string      `json:"vol"`
+	PartitionId uint64      `json:"pid"`
+	Tags        []string    `json:"tags"`
+	Entries     []*TagEntry `json:"entries"`
+}
+
 type BatchGetXAttrRequest struct {
 	VolName     string   `json:"vol"`
 	PartitionId uint64   `json:"pid"`
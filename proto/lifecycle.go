@@ -0,0 +1,195 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The state of a lifecycle rule
+const (
+	LifecycleRuleIdle     = "idle"
+	LifecycleRuleRunning  = "running"
+	LifecycleRuleDisabled = "disabled"
+)
+
+// StorageClassCold is the storage class of the cold tier, which is made of the data partitions in the cold zone of
+// the volume.
+const StorageClassCold = "COLD"
+
+// LifecycleRule defines a lifecycle rule of a volume, which is applied to the files whose paths start with Prefix.
+// Like the S3 lifecycle configuration, the actions are turned off if the days are zero.
+type LifecycleRule struct {
+	ID       string
+	Prefix   string
+	Disabled bool
+	// the files which have not been modified for ExpirationDays are deleted
+	ExpirationDays int
+	// the files which have not been modified for TransitionDays are moved to the storage class, whose empty value
+	// is StorageClassCold
+	TransitionDays         int
+	TransitionStorageClass string
+	// the multipart uploads which have been initiated for AbortIncompleteMultipartUploadDays are aborted
+	AbortIncompleteMultipartUploadDays int
+}
+
+// LifecycleRuleStatus defines the progress and the statistics of a lifecycle rule, which are kept by the master leader.
+type LifecycleRuleStatus struct {
+	ID                string
+	State             string
+	CurrentPath       string // the directory being scanned
+	LastStartTime     int64
+	LastEndTime       int64
+	Runs              uint64
+	ScannedDirs       uint64
+	ScannedFiles      uint64
+	ExpiredFiles      uint64
+	TransitionedFiles uint64
+	AbortedUploads    uint64
+	TotalExpiredFiles uint64
+	TotalTransitioned uint64
+	TotalAborted      uint64
+	LastError         string
+}
+
+// LifecycleStatus defines the lifecycle rules of a volume and their status.
+type LifecycleStatus struct {
+	VolName string
+	Rules   []*LifecycleRule
+	Status  []*LifecycleRuleStatus
+}
+
+// LifecycleDentry defines a dentry scanned by a lifecycle rule.
+type LifecycleDentry struct {
+	Name  string
+	Inode uint64
+	Type  uint32
+}
+
+// LifecycleScanDirRequest defines the request to list the dentries of a directory whose names start with the prefix,
+// in the order of the names and starting after the marker.
+type LifecycleScanDirRequest struct {
+	PartitionID uint64
+	ParentID    uint64
+	Prefix      string
+	Marker      string
+	Limit       int
+}
+
+// LifecycleScanDirResponse defines the response to the request of scanning a directory.
+type LifecycleScanDirResponse struct {
+	Dentries   []*LifecycleDentry
+	NextMarker string // empty if there are no more dentries
+}
+
+// LifecycleFilterExpiredRequest defines the request to find the regular files which have not been modified
+// since the expiration time.
+type LifecycleFilterExpiredRequest struct {
+	PartitionID  uint64
+	Inodes       []uint64
+	ExpireBefore int64
+}
+
+// LifecycleFilterExpiredResponse defines the response to the request of filtering the expired files.
+type LifecycleFilterExpiredResponse struct {
+	Inodes []uint64
+}
+
+// LifecycleDeleteDentriesRequest defines the request to delete the dentries of a directory.
+// A dentry is not deleted if it does not refer to the inode any more.
+type LifecycleDeleteDentriesRequest struct {
+	PartitionID uint64
+	ParentID    uint64
+	Dentries    []*LifecycleDentry
+}
+
+// LifecycleDeleteDentriesResponse defines the response to the request of deleting the dentries.
+type LifecycleDeleteDentriesResponse struct {
+	Inodes []uint64 // the inodes whose dentries are deleted
+}
+
+// LifecycleDeleteInodesRequest defines the request to unlink and evict the inodes.
+type LifecycleDeleteInodesRequest struct {
+	PartitionID uint64
+	Inodes      []uint64
+}
+
+// LifecycleListExtentsRequest defines the request to list the extent keys of the regular files, which are moved to
+// the cold tier.
+type LifecycleListExtentsRequest struct {
+	PartitionID uint64
+	Inodes      []uint64
+}
+
+// LifecycleFileExtents defines the extent keys of a file.
+type LifecycleFileExtents struct {
+	Inode   uint64
+	Extents []ExtentKey
+}
+
+// LifecycleListExtentsResponse defines the response to the request of listing the extent keys of the files.
+type LifecycleListExtentsResponse struct {
+	Files []*LifecycleFileExtents
+}
+
+// LifecycleSwapExtentsRequest defines the request to replace the extent keys of a file with the keys of the copies
+// of their extents, in the same order. The keys are swapped only if the file still has exactly the old keys, and the
+// extents not referred to any more are deleted, i.e. the old ones if the keys are swapped, or else the copies.
+// The request without the old keys deletes the copies only, e.g. when the copies fail.
+type LifecycleSwapExtentsRequest struct {
+	PartitionID uint64
+	Inode       uint64
+	OldExtents  []ExtentKey
+	NewExtents  []ExtentKey
+}
+
+// LifecycleSwapExtentsResponse defines the response to the request of swapping the extent keys of a file.
+type LifecycleSwapExtentsResponse struct {
+	Swapped bool
+}
+
+// LifecycleMultipart defines a multipart upload found by a lifecycle rule.
+type LifecycleMultipart struct {
+	Path        string
+	MultipartID string
+	InitTime    int64
+	Inodes      []uint64 // the inodes of the uploaded parts
+}
+
+// LifecycleListMultipartsRequest defines the request to list the multipart uploads under the prefix which have been
+// initiated before the time.
+type LifecycleListMultipartsRequest struct {
+	PartitionID uint64
+	Prefix      string
+	InitBefore  int64
+	Limit       int
+}
+
+// LifecycleListMultipartsResponse defines the response to the request of listing the stale multipart uploads.
+type LifecycleListMultipartsResponse struct {
+	Multiparts []*LifecycleMultipart
+}
+
+// LifecycleRemoveMultipartsRequest defines the request to remove the multipart uploads.
+type LifecycleRemoveMultipartsRequest struct {
+	PartitionID uint64
+	Multiparts  []*LifecycleMultipart
+}
+
+// MultipartGCStat defines the statistics of the multipart uploads expired by a meta partition, which are abandoned
+// for longer than the multipart TTL of the volume.
+type MultipartGCStat struct {
+	ExpiredUploads uint64
+	DeletedParts   uint64
+	ReclaimedBytes uint64
+	LastRunTime    int64
+	LastErr        string
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The types of the steps of a maintenance plan, each of which takes the same parameters as the decommission API.
+const (
+	PlanStepDecommissionDataNode      = "decommissionDataNode"      // Addr
+	PlanStepDecommissionDisk          = "decommissionDisk"          // Addr, DiskPath
+	PlanStepDecommissionMetaNode      = "decommissionMetaNode"      // Addr
+	PlanStepDecommissionDataPartition = "decommissionDataPartition" // Addr, PartitionID
+	PlanStepDecommissionMetaPartition = "decommissionMetaPartition" // Addr, PartitionID
+)
+
+// The states of a maintenance plan
+const (
+	PlanRunning   = "running"
+	PlanPaused    = "paused"
+	PlanAborted   = "aborted"
+	PlanFailed    = "failed"
+	PlanSucceeded = "succeeded"
+)
+
+// MaintenanceStep defines an offline operation of a maintenance plan.
+type MaintenanceStep struct {
+	Type        string
+	Addr        string
+	DiskPath    string `json:",omitempty"`
+	PartitionID uint64 `json:",omitempty"`
+}
+
+// MaintenancePlanLog defines an entry of the execution log of a maintenance plan.
+type MaintenancePlanLog struct {
+	Time int64
+	Step int // the index of the step, or -1 if the entry is not about a step
+	Msg  string
+}
+
+// MaintenancePlan defines a named plan of the offline operations executed by the master one by one. The next step
+// starts only after the replicas of the partitions taken offline by the previous steps have been recovered.
+type MaintenancePlan struct {
+	Name       string
+	Steps      []*MaintenanceStep
+	State      string
+	NextStep   int // the index of the step to be executed
+	CreateTime int64
+	UpdateTime int64
+	LastError  string
+	Logs       []*MaintenancePlanLog `json:",omitempty"`
+}
+
+// MaintenancePlanView defines the brief information of a maintenance plan.
+type MaintenancePlanView struct {
+	Name       string
+	State      string
+	Steps      int
+	NextStep   int
+	CreateTime int64
+	UpdateTime int64
+	LastError  string
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import "time"
+
+// The meta cache nodes sit between the clients and the meta nodes of the volumes with the meta cache enabled. A
+// client sends the metadata requests of a meta partition to the meta cache node chosen by the partition ID, with
+// the address of the meta node to forward them to in the arg of the packets. The meta cache node answers the
+// read-only requests from its cache, and invalidates the cache with the mutation requests passing through it.
+//
+// The meta nodes reply the index of the raft log applied to the partition before serving a request in the
+// KernelOffset of the header, which is zero if the request is not served by the partition. The meta cache nodes
+// compare the cached responses with the latest index replied, so that the mutations not passing through them
+// invalidate the cache as soon as any request of the partition is forwarded after them.
+const (
+	// MetaCacheNodeHeartbeatInterval is the interval at which the meta cache nodes register to the master.
+	MetaCacheNodeHeartbeatInterval = 10 * time.Second
+)
+
+// IsMetaCacheable returns true if the responses to the requests of the opcode can be cached by the meta cache nodes.
+func IsMetaCacheable(opcode uint8) bool {
+	switch opcode {
+	case OpMetaLookup, OpMetaReadDir, OpMetaInodeGet, OpMetaBatchInodeGet:
+		return true
+	default:
+		return false
+	}
+}
+
+// MetaCacheNodeFor returns the meta cache node to proxy the requests of the meta partition, or an empty string if
+// there is no meta cache node. The nodes must be sorted, so that the clients route the requests of a meta
+// partition to the same node.
+func MetaCacheNodeFor(nodes []string, partitionID uint64) string {
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[partitionID%uint64(len(nodes))]
+}
@@ -39,6 +39,10 @@ type CreateMetaPartitionRequest struct {
 	End         uint64
 	PartitionID uint64
 	Members     []Peer
+	// the dentries are looked up case-insensitively
+	CaseInsensitive bool
+	// the shadow volume which the mutations of the partition are mirrored to
+	ShadowVol string
 }
 
 // CreateMetaPartitionResponse defines the response to the request of creating a meta partition.
@@ -39,6 +39,8 @@ type MetaNodeInfo struct {
 	MetaPartitionCount        int
 	NodeSetID                 uint64
 	PersistenceMetaPartitions []uint64
+	ReplicaIP                 string `json:",omitempty"`
+	InstanceID                string `json:",omitempty"`
 }
 
 // DataNode stores all the information about a data node
@@ -59,6 +61,10 @@ type DataNodeInfo struct {
 	NodeSetID                 uint64
 	PersistenceDataPartitions []uint64
 	BadDisks                  []string
+	IsSpare                   bool
+	InstanceID                string
+	ReplicaIP                 string `json:",omitempty"`
+	Rack                      string `json:",omitempty"`
 }
 
 // MetaPartition defines the structure of a meta partition
@@ -80,6 +86,7 @@ type MetaPartitionInfo struct {
 	OfflinePeerID uint64
 	MissNodes     map[string]int64
 	LoadResponse  []*MetaPartitionLoadResponse
+	IsDegraded    bool // the replicas serve the possibly stale reads without the leader
 }
 
 // MetaReplica defines the replica of a meta partition
@@ -88,6 +95,11 @@ type MetaReplicaInfo struct {
 	ReportTime int64
 	Status     int8 // unavailable, readOnly, readWrite
 	IsLeader   bool
+	ApplyStall bool  // the proposals wait without any entry applied
+	ApplyQueue int64 // the proposals waiting to be applied
+	IsDegraded bool
+
+	DeleteBacklog DeleteBacklog
 }
 
 // ClusterView provides the view of a cluster.
@@ -95,6 +107,8 @@ type ClusterView struct {
 	Name                string
 	LeaderAddr          string
 	DisableAutoAlloc    bool
+	DisableAutoPromote  bool // disable promoting spare data nodes automatically
+	EnableQuorumWrite   bool // ack the append writes once the quorum of the replicas persist them
 	MetaNodeThreshold   float32
 	Applied             uint64
 	MaxDataPartitionID  uint64
@@ -107,6 +121,93 @@ type ClusterView struct {
 	BadMetaPartitionIDs []BadPartitionView
 	MetaNodes           []NodeView
 	DataNodes           []NodeView
+	HeartbeatPace       *HeartbeatPaceView
+}
+
+// HeartbeatPaceView shows the interval of the heartbeats sent to the nodes by the leader, which is stretched while
+// the nodes fall behind, and the node timeout stretched with it.
+type HeartbeatPaceView struct {
+	IntervalMs      int64 // the configured interval
+	CurrentMs       int64
+	NodeTimeoutMs   int64
+	SuppressedCount uint64 // the rounds of the heartbeats sent at a stretched interval
+}
+
+// PathResolution traces a path of a volume from its dentries down to the disks holding its data.
+type PathResolution struct {
+	VolName       string
+	Path          string
+	Components    []*ResolvedDentry // the dentries walked from the root, one per path component
+	Inode         *InodeInfo
+	MetaPartition *ResolvedMetaPartition // the meta partition holding the inode
+	Generation    uint64
+	ExtentCount   int
+	Truncated     bool // only the first extents are listed
+	Extents       []*ResolvedExtent
+}
+
+// ResolvedDentry is a dentry walked while resolving a path.
+type ResolvedDentry struct {
+	Name        string
+	ParentID    uint64
+	Inode       uint64
+	Mode        uint32
+	PartitionID uint64 // the meta partition holding the dentry
+	Leader      string
+}
+
+// ResolvedMetaPartition shows where a meta partition is served.
+type ResolvedMetaPartition struct {
+	PartitionID uint64
+	Start       uint64
+	End         uint64
+	Leader      string
+	Hosts       []string
+}
+
+// ResolvedExtent maps an extent key to the replicas of its data partition.
+type ResolvedExtent struct {
+	ExtentKey
+	Hosts    []string
+	Replicas []*ResolvedReplica
+	Err      string `json:",omitempty"` // why the data partition can not be resolved
+}
+
+// ResolvedReplica shows the node and disk of a replica of a data partition.
+type ResolvedReplica struct {
+	Addr     string
+	DiskPath string
+	IsLeader bool
+	Status   int8
+}
+
+// VolAccessPattern is the access pattern of a volume summed up from the reports of the nodes and the clients, which
+// carries neither the paths nor the addresses of the clients.
+type VolAccessPattern struct {
+	WriteSizes             []uint64          // the writes counted in the buckets of IOSizeBounds
+	ReadSizes              []uint64          // the reads counted in the buckets of IOSizeBounds
+	OpCounts               map[string]uint64 // the operations of the clients
+	Clients                int
+	IcacheHits             uint64
+	IcacheMiss             uint64
+	MetaPartitions         int
+	WritableMetaPartitions int
+	MaxMetaPartitionItems  uint64 // the inodes and the dentries of the largest meta partition
+	MaxApplyQueue          int64  // the proposals waiting to be applied on the busiest meta partition replica
+}
+
+// VolRecommendation is a suggestion to tune a volume for its access pattern.
+type VolRecommendation struct {
+	ID     string
+	Reason string
+	Action string
+}
+
+// VolRecommendations are the suggestions to tune a volume, and the access pattern they are derived from.
+type VolRecommendations struct {
+	VolName         string
+	Pattern         *VolAccessPattern
+	Recommendations []*VolRecommendation
 }
 
 // NodeView provides the view of the data or meta node.
@@ -115,6 +216,7 @@ type NodeView struct {
 	Status     bool
 	ID         uint64
 	IsWritable bool
+	ReplicaIP  string `json:",omitempty"` // the IP of the interface dedicated to the replication, if any
 }
 
 type BadPartitionView struct {
@@ -141,6 +243,37 @@ type ZoneNodesStat struct {
 	WritableNodes int
 }
 
+// the levels of the statistics tree
+const (
+	StatsLevelCluster = "cluster"
+	StatsLevelZone    = "zone"
+	StatsLevelRack    = "rack"
+	StatsLevelNode    = "node"
+)
+
+// StorageStats is the capacity, the usage and the partitions of the nodes rolled up to a level of the statistics tree.
+type StorageStats struct {
+	DataNodes          int
+	DataTotal          uint64 // bytes of the disks
+	DataUsed           uint64
+	DataPartitionCount uint64
+	MetaNodes          int
+	MetaTotal          uint64 // bytes of the memory
+	MetaUsed           uint64
+	MetaPartitionCount uint64
+}
+
+// StatsTreeNode is a zone, a rack or a node in the statistics tree of the cluster, with the statistics rolled up from
+// its children.
+type StatsTreeNode struct {
+	Name       string // the name of the cluster, the zone or the rack, or the address of the node
+	Level      string
+	Role       string `json:",omitempty"` // datanode or metanode, of the nodes only
+	ReportTime int64  `json:",omitempty"` // unix seconds of the latest heartbeat, of the nodes only
+	StorageStats
+	Children []*StatsTreeNode `json:",omitempty"`
+}
+
 type NodeStatInfo struct {
 	TotalGB     uint64
 	UsedGB      uint64
@@ -149,11 +282,12 @@ type NodeStatInfo struct {
 }
 
 type VolStatInfo struct {
-	Name        string
-	TotalSize   uint64
-	UsedSize    uint64
-	UsedRatio   string
-	EnableToken bool
+	Name         string
+	TotalSize    uint64
+	UsedSize     uint64
+	UsedRatio    string
+	EnableToken  bool
+	ReservedSize uint64 // the space preallocated to the files but not written yet, which is not counted in UsedSize
 }
 
 // DataPartition represents the structure of storing the file contents.
@@ -172,9 +306,14 @@ type DataPartitionInfo struct {
 	OfflinePeerID           uint64
 	FileInCoreMap           map[string]*FileInCore
 	FilesWithMissingReplica map[string]int64 // key: file name, value: last time when a missing replica is found
+	IsPendingDelete         bool
+	IsFrozen                bool
+	IsDegraded              bool   // the replicas serve the possibly stale reads without the leader
+	IsCold                  bool   // the partition holds the files moved to the cold tier, which are read only
+	Size                    uint64 // the size allocated on each replica
 }
 
-//FileInCore define file in data partition
+// FileInCore define file in data partition
 type FileInCore struct {
 	Name          string
 	LastModify    int64
@@ -190,16 +329,20 @@ type FileMetadata struct {
 
 // DataReplica represents the replica of a data partition
 type DataReplica struct {
-	Addr            string
-	ReportTime      int64
-	FileCount       uint32
-	Status          int8
-	HasLoadResponse bool   // if there is any response when loading
-	Total           uint64 `json:"TotalSize"`
-	Used            uint64 `json:"UsedSize"`
-	IsLeader        bool
-	NeedsToCompare  bool
-	DiskPath        string
+	Addr                 string
+	ReportTime           int64
+	FileCount            uint32
+	Status               int8
+	HasLoadResponse      bool   // if there is any response when loading
+	Total                uint64 `json:"TotalSize"`
+	Used                 uint64 `json:"UsedSize"`
+	IsLeader             bool
+	NeedsToCompare       bool
+	DiskPath             string
+	IsFrozen             bool
+	IsDegraded           bool
+	AvailableTinyExtents int
+	BrokenTinyExtents    int
 }
 
 // data partition diagnosis represents the inactive data nodes, corrupt data partitions, and data partitions lack of replicas
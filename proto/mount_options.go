@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/config"
@@ -47,6 +48,22 @@ const (
 	EnableXattr
 	NearRead
 	EnablePosixACL
+	MetricsPushInterval
+	AsyncClose
+	AsyncCloseQueueSize
+	StrictAsyncClose
+	DirectIOAlignment
+	SkipVolGate
+	EnableDentryWatch
+	ZoneName
+	MaxCachedInodes
+	MaxCachedDentries
+	DisableDirPrefetch
+	HedgeReadBudget
+	DelegatedTokenKey
+	AsOf
+	Namespace
+	Priority
 
 	MaxMountOption
 )
@@ -56,6 +73,18 @@ const (
 	MasterAddr       = "masterAddr"
 	ListenPort       = "listen"
 	ObjectNodeDomain = "objectNodeDomain"
+	NodeToken        = "nodeToken"
+	// the key to sign the delegated tokens, which is shared by the masters, the meta nodes and the data nodes
+	TokenSigningKey = "tokenSigningKey"
+
+	PressureWarnRatio     = "pressureWarnRatio"
+	PressureCriticalRatio = "pressureCriticalRatio"
+
+	// the requests served at the same time by a node in the weighted fair queues of the priority classes
+	PriorityQueueSlots = "priorityQueueSlots"
+
+	// the IP of the network interface dedicated to the replication and the repair between the nodes
+	ReplicaIP = "replicaIP"
 )
 
 type MountOption struct {
@@ -112,6 +141,22 @@ func InitMountOptions(opts []MountOption) {
 	opts[MaxCPUs] = MountOption{"maxcpus", "The maximum number of CPUs that can be executing", "", int64(-1)}
 	opts[EnableXattr] = MountOption{"enableXattr", "Enable xattr support", "", false}
 	opts[EnablePosixACL] = MountOption{"enablePosixACL", "enable posix ACL support", "", false}
+	opts[MetricsPushInterval] = MountOption{"metricsPushInterval", "Interval in seconds to push client metrics to master", "", int64(-1)}
+	opts[AsyncClose] = MountOption{"asyncClose", "Flush the released files asynchronously", "", false}
+	opts[AsyncCloseQueueSize] = MountOption{"asyncCloseQueueSize", "The maximum number of the files waiting to be flushed asynchronously", "", int64(1024)}
+	opts[StrictAsyncClose] = MountOption{"strictAsyncClose", "Report the failed asynchronous flush upon the next open as well", "", false}
+	opts[DirectIOAlignment] = MountOption{"directIOAlignment", "The alignment of the offset and the size of O_DIRECT requests, 0 to disable the check", "", int64(512)}
+	opts[SkipVolGate] = MountOption{"skipVolGate", "Mount even if the client is incompatible with the volume, for emergencies", "", false}
+	opts[EnableDentryWatch] = MountOption{"enableDentryWatch", "Invalidate the dentries cached by the client once they are changed by the other clients", "", false}
+	opts[ZoneName] = MountOption{"zoneName", "The zone of the client, whose replicas are preferred by the reads from the followers", "", ""}
+	opts[MaxCachedInodes] = MountOption{"maxCachedInodes", "The maximum number of the inodes cached by the client", "", int64(-1)}
+	opts[MaxCachedDentries] = MountOption{"maxCachedDentries", "The maximum number of the dentries cached by the client", "", int64(-1)}
+	opts[DisableDirPrefetch] = MountOption{"disableDirPrefetch", "Disable prefetching the subdirectories once a directory is read", "", false}
+	opts[HedgeReadBudget] = MountOption{"hedgeReadBudget", "The percent of the reads from the followers which can be hedged to another replica, 0 to disable", "", int64(0)}
+	opts[DelegatedTokenKey] = MountOption{"delegatedToken", "The short-lived token minted by the owner, which is used instead of the owner", "", ""}
+	opts[AsOf] = MountOption{"asOf", "Mount read-only as of the time in unix seconds or RFC3339, from the snapshots retained by the meta nodes", "", ""}
+	opts[Namespace] = MountOption{"namespace", "Mount the subtrees of the volumes as the directories of the mount point, such as /data=volA:/shared,/scratch=volB:/team1", "", ""}
+	opts[Priority] = MountOption{"priority", "The priority class of the requests, interactive, normal or batch", "", ""}
 
 	for i := 0; i < MaxMountOption; i++ {
 		flag.StringVar(&opts[i].cmdlineValue, opts[i].keyword, "", opts[i].description)
@@ -241,4 +286,69 @@ type MountOptions struct {
 	EnableXattr    bool
 	NearRead       bool
 	EnablePosixACL bool
+
+	MetricsPushInterval int64
+	AsyncClose          bool
+	AsyncCloseQueueSize int64
+	StrictAsyncClose    bool
+	DirectIOAlignment   int64
+	SkipVolGate         bool
+	EnableDentryWatch   bool
+	ZoneName            string
+	MaxCachedInodes     int64
+	MaxCachedDentries   int64
+	DisableDirPrefetch  bool
+	HedgeReadBudget     int64
+	DelegatedToken      string
+	AsOf                int64 // unix seconds to mount as of, 0 to mount the current volume
+	Namespace           []NamespaceAlias
+	Priority            uint8
+}
+
+// NamespaceAlias maps the sub directory of the volume to the directory of the mount point.
+type NamespaceAlias struct {
+	Name   string // the name of the directory in the mount point
+	Volume string
+	SubDir string
+}
+
+// ParseNamespace parses the aliases of the namespace in the form of /name=volume:/subDir, separated by commas. The
+// sub directory is optional, and the name can not contain a slash.
+func ParseNamespace(value string) (aliases []NamespaceAlias, err error) {
+	if value == "" {
+		return
+	}
+	names := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid alias(%v) of namespace, expect /name=volume:/subDir", item)
+		}
+		alias := NamespaceAlias{Name: strings.TrimPrefix(strings.TrimSpace(parts[0]), "/")}
+		if alias.Name == "" || alias.Name == "." || alias.Name == ".." || strings.Contains(alias.Name, "/") {
+			return nil, fmt.Errorf("invalid name(%v) of alias, expect a single directory", parts[0])
+		}
+		if names[alias.Name] {
+			return nil, fmt.Errorf("duplicate alias(%v) of namespace", alias.Name)
+		}
+		names[alias.Name] = true
+		target := strings.SplitN(strings.TrimSpace(parts[1]), ":", 2)
+		if alias.Volume = target[0]; alias.Volume == "" {
+			return nil, fmt.Errorf("no volume of alias(%v)", alias.Name)
+		}
+		if len(target) == 2 {
+			alias.SubDir = target[1]
+		}
+		aliases = append(aliases, alias)
+	}
+	return
+}
+
+// AliasOptions returns the mount options of the alias, which mount the sub directory of the volume of the alias.
+func (opt *MountOptions) AliasOptions(alias NamespaceAlias) *MountOptions {
+	aliasOpt := *opt
+	aliasOpt.Volname = alias.Volume
+	aliasOpt.SubDir = alias.SubDir
+	aliasOpt.Namespace = nil
+	return &aliasOpt
 }
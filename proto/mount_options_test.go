@@ -0,0 +1,61 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNamespace(t *testing.T) {
+	aliases, err := ParseNamespace("/data=volA:/shared, /scratch=volB:/team1,logs=volA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []NamespaceAlias{
+		{Name: "data", Volume: "volA", SubDir: "/shared"},
+		{Name: "scratch", Volume: "volB", SubDir: "/team1"},
+		{Name: "logs", Volume: "volA"},
+	}
+	if !reflect.DeepEqual(aliases, expected) {
+		t.Fatalf("expect the aliases %v, but are %v", expected, aliases)
+	}
+	if aliases, err = ParseNamespace(""); err != nil || len(aliases) != 0 {
+		t.Fatalf("expect no aliases, but are %v, err %v", aliases, err)
+	}
+	for _, value := range []string{
+		"/data",                    // no volume
+		"/data=",                   // empty volume
+		"/=volA",                   // empty name
+		"/..=volA",                 // not a single directory
+		"/a/b=volA",                // nested name
+		"/data=volA,/data=volB:/x", // duplicate name
+	} {
+		if _, err = ParseNamespace(value); err == nil {
+			t.Fatalf("the namespace %v should be refused", value)
+		}
+	}
+}
+
+func TestAliasOptions(t *testing.T) {
+	opt := &MountOptions{Volname: "volA", Owner: "owner", SubDir: "/x", Namespace: []NamespaceAlias{{Name: "data"}}}
+	aliasOpt := opt.AliasOptions(NamespaceAlias{Name: "data", Volume: "volB", SubDir: "/team1"})
+	if aliasOpt.Volname != "volB" || aliasOpt.SubDir != "/team1" || aliasOpt.Owner != "owner" || aliasOpt.Namespace != nil {
+		t.Fatalf("unexpected options %+v of the alias", aliasOpt)
+	}
+	if opt.Volname != "volA" || opt.SubDir != "/x" || len(opt.Namespace) != 1 {
+		t.Fatalf("the options of the mount should not be changed, but are %+v", opt)
+	}
+}
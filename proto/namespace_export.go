@@ -0,0 +1,74 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The state of the namespace export of a volume
+const (
+	NamespaceExportIdle    = "idle"
+	NamespaceExportRunning = "running"
+)
+
+// NamespaceExportConfig defines the periodic export of the namespace of a volume to the index files, which are
+// searched offline instead of the live meta nodes. The format of the index files is documented in util/nsindex.
+type NamespaceExportConfig struct {
+	// an absolute directory shared by the meta nodes, or s3://bucket/prefix with the credentials of the meta nodes
+	Target        string
+	IntervalHours int
+}
+
+// NamespaceExportStatus defines the progress of the namespace export of a volume, which is kept by the master leader.
+type NamespaceExportStatus struct {
+	VolName       string
+	Config        *NamespaceExportConfig
+	State         string
+	ExportID      string // the export running or done last
+	LastStartTime int64
+	LastEndTime   int64
+	Runs          uint64
+	Partitions    int // the meta partitions to export
+	Exported      int // the meta partitions exported
+	Inodes        uint64
+	Dentries      uint64
+	Size          int64
+	LastSuccessID string // the last export whose manifest is written
+	LastError     string
+}
+
+// NamespaceExportRequest defines the request to export the namespace of a meta partition from its snapshot,
+// which is answered once the export starts. If Files is not empty, the manifest listing the files of the export
+// is written instead, which is answered once it is written.
+type NamespaceExportRequest struct {
+	PartitionID uint64
+	VolName     string
+	ExportID    string
+	ExportTime  int64
+	Target      string
+	Files       []*NamespaceExportResponse
+}
+
+// NamespaceExportResponse defines the response to the request of exporting a meta partition, which is sent once
+// the export ends.
+type NamespaceExportResponse struct {
+	PartitionID uint64
+	VolName     string
+	ExportID    string
+	Status      uint8
+	Result      string
+	File        string
+	ApplyID     uint64
+	Inodes      uint64
+	Dentries    uint64
+	Size        int64
+}
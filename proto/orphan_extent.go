@@ -0,0 +1,81 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The state of the orphan extent reclamation of a volume
+const (
+	OrphanExtentsIdle    = "idle"
+	OrphanExtentsRunning = "running"
+)
+
+// OrphanExtent defines a normal extent which may be referenced by no inode, e.g. as the client crashes between
+// creating the extent and appending the extent key.
+type OrphanExtent struct {
+	PartitionID uint64
+	ExtentID    uint64
+	Inode       uint64 // the inode bound to the extent on creation, 0 if unknown
+	Size        uint64
+	ModifyTime  int64
+}
+
+// OrphanExtentsRequest defines the request to list the normal extents of a data partition not modified since
+// ModifiedBefore in the order of the extent ID, which are the candidates of the orphan extents. If Reclaim is not
+// empty, the extents in it still not modified since ModifiedBefore are deleted instead.
+type OrphanExtentsRequest struct {
+	PartitionID    uint64
+	ModifiedBefore int64
+	FromExtentID   uint64 // the extents after it are listed
+	Limit          int
+	Reclaim        []uint64
+}
+
+// OrphanExtentsResponse defines the extents listed, or the extents deleted by the reclamation.
+type OrphanExtentsResponse struct {
+	PartitionID uint64
+	Extents     []*OrphanExtent
+}
+
+// CheckExtentRefsRequest defines the request to find the extents referenced by the inodes of a meta partition. If
+// ByInode is true, only the inodes which the extents are created for are checked instead of all the inodes.
+type CheckExtentRefsRequest struct {
+	PartitionID uint64
+	Extents     []*OrphanExtent
+	ByInode     bool
+}
+
+// CheckExtentRefsResponse defines the extents referenced by the inodes.
+type CheckExtentRefsResponse struct {
+	PartitionID uint64
+	Referenced  []*OrphanExtent
+}
+
+// OrphanExtentsReport defines the orphan extents of a volume found and reclaimed, which is kept by the master leader.
+// An orphan extent is queued once found, and reclaimed if it is still an orphan in the next run.
+type OrphanExtentsReport struct {
+	VolName          string
+	State            string
+	LastStartTime    int64
+	LastEndTime      int64
+	Runs             uint64
+	Partitions       int    // the data partitions checked by the last run
+	Scanned          uint64 // the extents old enough checked by the last run
+	QueuedExtents    int
+	QueuedSize       uint64
+	ReclaimedExtents uint64 // the extents reclaimed by all the runs
+	ReclaimedSize    uint64
+	Queued           []*OrphanExtent // the first of the extents waiting to be reclaimed
+	Reclaimed        []*OrphanExtent // the extents reclaimed lately
+	LastError        string
+}
@@ -67,6 +67,10 @@ const (
 	OpReadTinyDeleteRecord           uint8 = 0x14
 	OpTinyExtentRepairRead           uint8 = 0x15
 	OpGetMaxExtentIDAndPartitionSize uint8 = 0x16
+	OpStreamVectorRead               uint8 = 0x17
+	OpExtentHash                     uint8 = 0x18
+	OpVerifyExtent                   uint8 = 0x19
+	OpExtentDelta                    uint8 = 0x1A
 
 	// Operations: Client -> MetaNode.
 	OpMetaCreateInode   uint8 = 0x20
@@ -98,6 +102,12 @@ const (
 	OpMetaRemoveXAttr     uint8 = 0x37
 	OpMetaListXAttr       uint8 = 0x38
 	OpMetaBatchGetXAttr   uint8 = 0x39
+	OpMetaListTag         uint8 = 0x3A
+	OpMetaWatchDentry     uint8 = 0x3B
+	OpMetaFileChecksum    uint8 = 0x3C
+	OpMetaDedupRegister   uint8 = 0x3D
+	OpMetaDedupReference  uint8 = 0x3E
+	OpMetaBatchRename     uint8 = 0x3F
 
 	// Operations: Master -> MetaNode
 	OpCreateMetaPartition           uint8 = 0x40
@@ -109,6 +119,20 @@ const (
 	OpAddMetaPartitionRaftMember    uint8 = 0x46
 	OpRemoveMetaPartitionRaftMember uint8 = 0x47
 	OpMetaPartitionTryToLeader      uint8 = 0x48
+	OpCheckDataPartitionRef         uint8 = 0x49
+	OpLifecycleScanDir              uint8 = 0x4A
+	OpLifecycleFilterExpired        uint8 = 0x4B
+	OpLifecycleDeleteDentries       uint8 = 0x4C
+	OpLifecycleDeleteInodes         uint8 = 0x4D
+	OpLifecycleListMultiparts       uint8 = 0x4E
+	OpLifecycleRemoveMultiparts     uint8 = 0x4F
+	OpFreezeMetaPartition           uint8 = 0x50
+	OpDegradeMetaPartition          uint8 = 0x51
+	OpMetaNamespaceExport           uint8 = 0x52
+	OpCheckExtentRefs               uint8 = 0x53
+	OpMetaSnapshotDiff              uint8 = 0x54
+	OpLifecycleListExtents          uint8 = 0x55
+	OpLifecycleSwapExtents          uint8 = 0x56
 
 	// Operations: Master -> DataNode
 	OpCreateDataPartition           uint8 = 0x60
@@ -121,6 +145,12 @@ const (
 	OpAddDataPartitionRaftMember    uint8 = 0x67
 	OpRemoveDataPartitionRaftMember uint8 = 0x68
 	OpDataPartitionTryToLeader      uint8 = 0x69
+	OpFreezeDataPartition           uint8 = 0x6A
+	OpRepairDataBlock               uint8 = 0x6B
+	OpResizeDataPartition           uint8 = 0x6C
+	OpDegradeDataPartition          uint8 = 0x6D
+	OpCopyExtent                    uint8 = 0x6E
+	OpOrphanExtents                 uint8 = 0x6F
 
 	// Operations: MultipartInfo
 	OpCreateMultipart  uint8 = 0x70
@@ -130,6 +160,7 @@ const (
 	OpListMultiparts   uint8 = 0x74
 
 	OpBatchDeleteExtent uint8 = 0x75 // SDK to MetaNode
+	OpMetaFallocate     uint8 = 0x76 // SDK to MetaNode
 
 	//Operations: MetaNode Leader -> MetaNode Follower
 	OpMetaBatchDeleteInode  uint8 = 0x90
@@ -150,6 +181,11 @@ const (
 	OpTryOtherAddr     uint8 = 0xFC
 	OpNotPerm          uint8 = 0xFD
 	OpNotEmtpy         uint8 = 0xFE
+	OpCrcMismatchErr   uint8 = 0xF1
+	OpVolFrozen        uint8 = 0xF2
+	OpTimeout          uint8 = 0xEF // the request is not done within the timeout of its opcode on the server
+	OpNameTooLong      uint8 = 0xEE // the name of the dentry exceeds the maximum length of the volume
+	OpInvalidName      uint8 = 0xED // the name of the dentry breaks the naming policy of the volume
 	OpOk               uint8 = 0xF0
 
 	OpPing uint8 = 0xFF
@@ -167,6 +203,13 @@ const (
 const (
 	TinyExtentType   = 0
 	NormalExtentType = 1
+	// VerifiedReadExtentType reads the data as NormalExtentType, and fails if the range of a tiny extent is deleted
+	// instead of reading the zeros, for the reads by the historical extent keys.
+	VerifiedReadExtentType = 2
+
+	// DegradedReplyFlag is set in the ExtentType of the replies served by a degraded partition without the leader,
+	// whose data may be stale.
+	DegradedReplyFlag uint8 = 0x80
 )
 
 const (
@@ -194,6 +237,7 @@ type Packet struct {
 	StartT             int64
 	mesg               string
 	HasPrepare         bool
+	Priority           uint8 // the priority class of the request, carried in the ExtentType of the header
 }
 
 // NewPacket returns a new packet.
@@ -217,11 +261,13 @@ func (p *Packet) String() string {
 
 // GetStoreType returns the store type.
 func (p *Packet) GetStoreType() (m string) {
-	switch p.ExtentType {
+	switch p.ExtentType &^ DegradedReplyFlag {
 	case TinyExtentType:
 		m = "TinyExtent"
 	case NormalExtentType:
 		m = "NormalExtent"
+	case VerifiedReadExtentType:
+		m = "VerifiedRead"
 	default:
 		m = "Unknown"
 	}
@@ -249,6 +295,14 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpStreamRead"
 	case OpStreamFollowerRead:
 		m = "OpStreamFollowerRead"
+	case OpStreamVectorRead:
+		m = "OpStreamVectorRead"
+	case OpExtentHash:
+		m = "OpExtentHash"
+	case OpVerifyExtent:
+		m = "OpVerifyExtent"
+	case OpExtentDelta:
+		m = "OpExtentDelta"
 	case OpGetAllWatermarks:
 		m = "OpGetAllWatermarks"
 	case OpNotifyReplicasToRepair:
@@ -351,8 +405,48 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpRemoveMetaPartitionRaftMember"
 	case OpMetaPartitionTryToLeader:
 		m = "OpMetaPartitionTryToLeader"
+	case OpCheckDataPartitionRef:
+		m = "OpCheckDataPartitionRef"
+	case OpLifecycleScanDir:
+		m = "OpLifecycleScanDir"
+	case OpLifecycleFilterExpired:
+		m = "OpLifecycleFilterExpired"
+	case OpLifecycleDeleteDentries:
+		m = "OpLifecycleDeleteDentries"
+	case OpLifecycleDeleteInodes:
+		m = "OpLifecycleDeleteInodes"
+	case OpLifecycleListMultiparts:
+		m = "OpLifecycleListMultiparts"
+	case OpLifecycleRemoveMultiparts:
+		m = "OpLifecycleRemoveMultiparts"
+	case OpFreezeMetaPartition:
+		m = "OpFreezeMetaPartition"
+	case OpDegradeMetaPartition:
+		m = "OpDegradeMetaPartition"
+	case OpMetaNamespaceExport:
+		m = "OpMetaNamespaceExport"
+	case OpCheckExtentRefs:
+		m = "OpCheckExtentRefs"
+	case OpMetaSnapshotDiff:
+		m = "OpMetaSnapshotDiff"
+	case OpLifecycleListExtents:
+		m = "OpLifecycleListExtents"
+	case OpLifecycleSwapExtents:
+		m = "OpLifecycleSwapExtents"
 	case OpDataPartitionTryToLeader:
 		m = "OpDataPartitionTryToLeader"
+	case OpFreezeDataPartition:
+		m = "OpFreezeDataPartition"
+	case OpDegradeDataPartition:
+		m = "OpDegradeDataPartition"
+	case OpCopyExtent:
+		m = "OpCopyExtent"
+	case OpOrphanExtents:
+		m = "OpOrphanExtents"
+	case OpRepairDataBlock:
+		m = "OpRepairDataBlock"
+	case OpResizeDataPartition:
+		m = "OpResizeDataPartition"
 	case OpMetaDeleteInode:
 		m = "OpMetaDeleteInode"
 	case OpMetaBatchDeleteInode:
@@ -369,6 +463,18 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpMetaListXAttr"
 	case OpMetaBatchGetXAttr:
 		m = "OpMetaBatchGetXAttr"
+	case OpMetaListTag:
+		m = "OpMetaListTag"
+	case OpMetaWatchDentry:
+		m = "OpMetaWatchDentry"
+	case OpMetaFileChecksum:
+		m = "OpMetaFileChecksum"
+	case OpMetaDedupRegister:
+		m = "OpMetaDedupRegister"
+	case OpMetaDedupReference:
+		m = "OpMetaDedupReference"
+	case OpMetaBatchRename:
+		m = "OpMetaBatchRename"
 	case OpCreateMultipart:
 		m = "OpCreateMultipart"
 	case OpGetMultipart:
@@ -381,6 +487,8 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpListMultiparts"
 	case OpBatchDeleteExtent:
 		m = "OpBatchDeleteExtent"
+	case OpMetaFallocate:
+		m = "OpMetaFallocate"
 	}
 	return
 }
@@ -392,34 +500,13 @@ func (p *Packet) GetResultMsg() (m string) {
 	}
 
 	switch p.ResultCode {
-	case OpIntraGroupNetErr:
-		m = "IntraGroupNetErr"
-	case OpDiskNoSpaceErr:
-		m = "DiskNoSpaceErr"
-	case OpDiskErr:
-		m = "DiskErr"
-	case OpErr:
-		m = "Err: " + string(p.Data)
-	case OpAgain:
-		m = "Again: " + string(p.Data)
-	case OpOk:
-		m = "Ok"
-	case OpExistErr:
-		m = "ExistErr"
-	case OpInodeFullErr:
-		m = "InodeFullErr"
-	case OpArgMismatchErr:
-		m = "ArgUnmatchErr"
-	case OpNotExistErr:
-		m = "NotExistErr"
-	case OpTryOtherAddr:
-		m = "TryOtherAddr"
-	case OpNotPerm:
-		m = "NotPerm"
-	case OpNotEmtpy:
-		m = "DirNotEmpty"
+	case OpErr, OpAgain, OpTimeout, OpNameTooLong, OpInvalidName:
+		m = ResultCodeName(p.ResultCode) + ": " + string(p.Data)
 	default:
-		return fmt.Sprintf("Unknown ResultCode(%v)", p.ResultCode)
+		if _, ok := resultCodeCatalog[p.ResultCode]; !ok {
+			return fmt.Sprintf("Unknown ResultCode(%v)", p.ResultCode)
+		}
+		m = ResultCodeName(p.ResultCode)
 	}
 	return
 }
@@ -431,7 +518,7 @@ func (p *Packet) GetReqID() int64 {
 // MarshalHeader marshals the packet header.
 func (p *Packet) MarshalHeader(out []byte) {
 	out[0] = p.Magic
-	out[1] = p.ExtentType
+	out[1] = p.marshalExtentType()
 	out[2] = p.Opcode
 	out[3] = p.ResultCode
 	out[4] = p.RemainingFollowers
@@ -453,7 +540,7 @@ func (p *Packet) UnmarshalHeader(in []byte) error {
 		return errors.New("Bad Magic " + strconv.Itoa(int(p.Magic)))
 	}
 
-	p.ExtentType = in[1]
+	p.unmarshalExtentType(in[1])
 	p.Opcode = in[2]
 	p.ResultCode = in[3]
 	p.RemainingFollowers = in[4]
@@ -605,6 +692,11 @@ func (p *Packet) PacketErrorWithBody(code uint8, reply []byte) {
 	p.ArgLen = 0
 }
 
+// IsDegradedReply returns whether the reply is served by a degraded partition, and may be stale.
+func (p *Packet) IsDegradedReply() bool {
+	return p.ExtentType&DegradedReplyFlag != 0
+}
+
 func (p *Packet) SetPacketHasPrepare() {
 	p.setPacketPrefix()
 	p.HasPrepare = true
@@ -0,0 +1,93 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The priority classes of the requests, which are queued by the data nodes and the meta nodes in the weighted fair
+// queues. The requests of the older clients are of PriorityNormal.
+const (
+	PriorityNormal      uint8 = 0
+	PriorityInteractive uint8 = 1
+	PriorityBatch       uint8 = 2
+	PriorityClassCount        = 3
+)
+
+// The priority class is carried in the bits of the ExtentType of the packet header below DegradedReplyFlag, and kept
+// apart from the ExtentType once the header is unmarshalled.
+const (
+	priorityShift       = 5
+	priorityMask  uint8 = 0x60
+)
+
+// PriorityNames are the names of the priority classes in the mount option and the stats.
+var PriorityNames = [PriorityClassCount]string{
+	PriorityNormal:      "normal",
+	PriorityInteractive: "interactive",
+	PriorityBatch:       "batch",
+}
+
+var localPriority uint32
+
+// ParsePriority parses the name of the priority class, where an empty name is PriorityNormal.
+func ParsePriority(name string) (priority uint8, err error) {
+	if name == "" {
+		return PriorityNormal, nil
+	}
+	for class, className := range PriorityNames {
+		if className == name {
+			return uint8(class), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority class %v", name)
+}
+
+// SetLocalPriority sets the priority class of the packets sent by the process, which is taken by the packets
+// without one, such as all the packets of a client mounted with the priority option.
+func SetLocalPriority(priority uint8) {
+	atomic.StoreUint32(&localPriority, uint32(priority))
+}
+
+func (p *Packet) marshalExtentType() uint8 {
+	priority := p.Priority
+	if priority == PriorityNormal {
+		priority = uint8(atomic.LoadUint32(&localPriority))
+	}
+	return p.ExtentType&^priorityMask | priority<<priorityShift&priorityMask
+}
+
+func (p *Packet) unmarshalExtentType(extentType uint8) {
+	p.Priority = (extentType & priorityMask) >> priorityShift
+	p.ExtentType = extentType &^ priorityMask
+}
+
+// PriorityQueueStat defines the requests queued by a node in the weighted fair queues of the priority classes.
+type PriorityQueueStat struct {
+	Slots   int // the requests served at the same time, 0 if the requests are not queued
+	Running int
+	Classes []*PriorityClassStat
+}
+
+// PriorityClassStat defines the requests of a priority class queued by a node.
+type PriorityClassStat struct {
+	Name     string
+	Weight   int
+	Waiting  int
+	Served   uint64
+	WaitTime int64 // the total nanoseconds of the served requests waiting in the queue
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	ReadRangeLength  = 12 // offset (8 bytes) + size (4 bytes)
+	MaxReadRanges    = 128
+	MaxReadRangeSize = 16 * 1024 * 1024 // max total size of the ranges in a vectored read
+)
+
+// ReadRange defines a range of an extent to read in a vectored read (OpStreamVectorRead).
+// The ranges are carried in the data of the request packet, and are replied in the order of the request
+// with one or more reply packets per range, whose ExtentOffset marks where the data belongs to.
+type ReadRange struct {
+	Offset int64
+	Size   uint32
+}
+
+// String returns the string format of the read range.
+func (r ReadRange) String() string {
+	return fmt.Sprintf("ReadRange{Offset(%v) Size(%v)}", r.Offset, r.Size)
+}
+
+// MarshalReadRanges encodes the read ranges into the binary format.
+func MarshalReadRanges(ranges []ReadRange) []byte {
+	data := make([]byte, len(ranges)*ReadRangeLength)
+	for i, r := range ranges {
+		binary.BigEndian.PutUint64(data[i*ReadRangeLength:], uint64(r.Offset))
+		binary.BigEndian.PutUint32(data[i*ReadRangeLength+8:], r.Size)
+	}
+	return data
+}
+
+// UnmarshalReadRanges decodes and validates the read ranges from the binary format.
+func UnmarshalReadRanges(data []byte) (ranges []ReadRange, err error) {
+	if len(data) == 0 || len(data)%ReadRangeLength != 0 || len(data)/ReadRangeLength > MaxReadRanges {
+		err = fmt.Errorf("invalid read ranges length(%v)", len(data))
+		return
+	}
+	var total uint64
+	ranges = make([]ReadRange, 0, len(data)/ReadRangeLength)
+	for i := 0; i < len(data); i += ReadRangeLength {
+		r := ReadRange{
+			Offset: int64(binary.BigEndian.Uint64(data[i:])),
+			Size:   binary.BigEndian.Uint32(data[i+8:]),
+		}
+		if r.Offset < 0 || r.Size == 0 {
+			err = fmt.Errorf("invalid read range %v", r)
+			return
+		}
+		total += uint64(r.Size)
+		ranges = append(ranges, r)
+	}
+	if total > MaxReadRangeSize {
+		err = fmt.Errorf("read ranges size(%v) exceeds limit(%v)", total, MaxReadRangeSize)
+		return
+	}
+	return
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The types of the changes listed by the snapshot diff
+const (
+	SnapshotDiffCreated  = "created"
+	SnapshotDiffDeleted  = "deleted"
+	SnapshotDiffModified = "modified"
+)
+
+// SnapshotDiffEntry defines a change of the namespace between two views of a volume. A dentry created, deleted or
+// pointed to another inode is identified by its parent inode and its name, while a file modified in place is
+// identified by its inode only, whose dentries are not changed.
+type SnapshotDiffEntry struct {
+	PartitionID uint64
+	Type        string
+	ParentID    uint64 `json:",omitempty"` // 0 for a modified inode
+	Name        string `json:",omitempty"`
+	Inode       uint64
+	OldInode    uint64 `json:",omitempty"` // the inode the dentry pointed to in the older view if it is replaced
+	Mode        uint32
+	Size        uint64 `json:",omitempty"` // the size of the modified inode in the newer view
+	ModifyTime  int64  `json:",omitempty"`
+}
+
+// SnapshotDiffRequest defines the request to list the changes of a meta partition from the view as of From to the
+// view as of To, each of which is served by the newest snapshot retained by the partition not later than the time.
+// A zero To compares with the current tree instead. The changes after Marker are listed, at most Limit of them.
+type SnapshotDiffRequest struct {
+	VolName     string
+	PartitionID uint64
+	From        int64
+	To          int64
+	Marker      string
+	Limit       int
+}
+
+// SnapshotDiffResponse defines the changes of a meta partition, and the applied indexes of the views compared. The
+// NextMarker is empty once all the changes of the partition are listed.
+type SnapshotDiffResponse struct {
+	PartitionID uint64
+	FromApplyID uint64
+	ToApplyID   uint64
+	Entries     []*SnapshotDiffEntry
+	NextMarker  string
+}
+
+// SnapshotDiff defines a page of the changes of a volume between two views, listed by the meta partitions in the
+// order of their IDs. The NextMarker is empty once all the changes are listed.
+type SnapshotDiff struct {
+	VolName    string
+	From       int64
+	To         int64
+	Entries    []*SnapshotDiffEntry
+	NextMarker string
+}
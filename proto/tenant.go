@@ -0,0 +1,47 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// TenantInfo defines a tenant grouping the volumes under a quota of their aggregate capacity. The volumes created in
+// the tenant are owned by the owner of the tenant by default, and the users in the ACL are granted their permissions
+// on the volumes once the volumes are added to the tenant.
+type TenantInfo struct {
+	Name       string
+	Owner      string
+	Capacity   uint64            // GB, the quota of the sum of the capacities of the volumes
+	ACL        map[string]string // user ID -> builtin permission, such as perm:builtin:ReadOnly
+	Vols       []string
+	CreateTime int64
+	UpdateTime int64
+}
+
+// TenantVolStat defines the usage of a volume of a tenant.
+type TenantVolStat struct {
+	Name      string
+	Capacity  uint64 // GB
+	UsedSize  uint64
+	UsedRatio string
+}
+
+// TenantStat defines the usage of a tenant.
+type TenantStat struct {
+	Name              string
+	Owner             string
+	Capacity          uint64 // GB
+	AllocatedCapacity uint64 // GB, the sum of the capacities of the volumes
+	UsedSize          uint64
+	ACL               map[string]string
+	Vols              []*TenantVolStat
+}
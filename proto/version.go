@@ -3,6 +3,7 @@ package proto
 import (
 	"fmt"
 	"runtime"
+	"time"
 )
 
 var (
@@ -10,8 +11,31 @@ var (
 	CommitID   string
 	BranchName string
 	BuildTime  string
+
+	// StartTime is the time when the process started.
+	StartTime = time.Now()
 )
 
+// BuildInfo defines the build information of a running node, which is reported to the master in the heartbeats.
+type BuildInfo struct {
+	Version    string
+	CommitID   string
+	BranchName string
+	BuildTime  string
+	StartTime  int64
+}
+
+// GetBuildInfo returns the build information of the current process.
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:    Version,
+		CommitID:   CommitID,
+		BranchName: BranchName,
+		BuildTime:  BuildTime,
+		StartTime:  StartTime.Unix(),
+	}
+}
+
 func DumpVersion(role string) string {
 	return fmt.Sprintf("ChubaoFS %s\n"+
 		"Version : %s\n"+
@@ -0,0 +1,160 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The client features which can be gated by a volume. The feature flags of a volume map the features to true if
+// the clients are required to support them, or to false if the clients must not use them.
+const (
+	FeatureXattr      = "xattr"
+	FeaturePosixACL   = "posixAcl"
+	FeatureAsyncClose = "asyncClose"
+	FeatureDirectIO   = "directIO"
+	FeatureDedup      = "dedup" // the blocks written to the volume are deduplicated, and the files are append-only
+
+	// FeatureDisabledPrefix marks a disabled feature in the feature list of the volume update API.
+	FeatureDisabledPrefix = "-"
+)
+
+// ClientFeatures are the features known by this client.
+var ClientFeatures = []string{
+	FeatureXattr,
+	FeaturePosixACL,
+	FeatureAsyncClose,
+	FeatureDirectIO,
+	FeatureDedup,
+}
+
+// IsClientFeature returns true if the feature is known by this client.
+func IsClientFeature(feature string) bool {
+	for _, f := range ClientFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFeatures parses a comma-separated feature list such as "xattr,-asyncClose" into the feature flags,
+// in which the features prefixed by "-" are disabled and the others are required.
+func ParseFeatures(value string) (features map[string]bool, err error) {
+	features = make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		required := !strings.HasPrefix(item, FeatureDisabledPrefix)
+		feature := strings.TrimPrefix(item, FeatureDisabledPrefix)
+		if !IsClientFeature(feature) {
+			return nil, fmt.Errorf("unknown feature %v, the features are %v", feature, strings.Join(ClientFeatures, ","))
+		}
+		features[feature] = required
+	}
+	return
+}
+
+// FormatFeatures formats the feature flags into a sorted comma-separated feature list.
+func FormatFeatures(features map[string]bool) string {
+	items := make([]string, 0, len(features))
+	for feature, required := range features {
+		if !required {
+			feature = FeatureDisabledPrefix + feature
+		}
+		items = append(items, feature)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// parseVersion parses a version like "v2.1.0" or "2.1.0-rc1" into the numbers of the components.
+func parseVersion(version string) (nums []int, err error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	for _, part := range strings.Split(version, ".") {
+		var num int
+		if num, err = strconv.Atoi(part); err != nil || num < 0 {
+			return nil, fmt.Errorf("invalid version %v", version)
+		}
+		nums = append(nums, num)
+	}
+	return
+}
+
+// CompareVersion returns -1, 0 or 1 if the version v1 is lower than, equal to or higher than v2. The missing
+// components are taken as 0, and the pre-release suffixes are ignored.
+func CompareVersion(v1, v2 string) (result int, err error) {
+	var nums1, nums2 []int
+	if nums1, err = parseVersion(v1); err != nil {
+		return
+	}
+	if nums2, err = parseVersion(v2); err != nil {
+		return
+	}
+	for i := 0; i < len(nums1) || i < len(nums2); i++ {
+		var n1, n2 int
+		if i < len(nums1) {
+			n1 = nums1[i]
+		}
+		if i < len(nums2) {
+			n2 = nums2[i]
+		}
+		if n1 < n2 {
+			return -1, nil
+		}
+		if n1 > n2 {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// ValidateVersion returns an error if the version can not be compared.
+func ValidateVersion(version string) (err error) {
+	_, err = parseVersion(version)
+	return
+}
+
+// CheckClientCompatibility returns an error if the client of the version can not work with a volume which
+// requires the minimum client version and the feature flags. A client of an unknown version is incompatible with
+// a volume requiring a minimum version.
+func CheckClientCompatibility(version, minVersion string, features map[string]bool) error {
+	if minVersion != "" {
+		result, err := CompareVersion(version, minVersion)
+		if err != nil {
+			return fmt.Errorf("unknown client version %v, the volume requires %v: %v", version, minVersion, err)
+		}
+		if result < 0 {
+			return fmt.Errorf("client version %v is lower than %v required by the volume", version, minVersion)
+		}
+	}
+	for feature, required := range features {
+		if required && !IsClientFeature(feature) {
+			return fmt.Errorf("the volume requires the feature %v unknown to the client", feature)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// The types of the volume usage events
+const (
+	VolUsageCreate         = "VolCreate"
+	VolUsageCapacityChange = "VolCapacityChange"
+	VolUsageDelete         = "VolDelete"
+	VolUsageTick           = "VolUsageTick" // raised for every volume periodically
+)
+
+// VolUsageEvent defines an event of the lifecycle or the usage of a volume delivered to the volume usage hooks, such
+// as the billing systems. An event is delivered at least once, so the receivers drop the events of the IDs seen before.
+type VolUsageEvent struct {
+	ID          uint64
+	Time        int64
+	Cluster     string
+	Type        string
+	Vol         string
+	VolID       uint64
+	Owner       string
+	Capacity    uint64 // GB
+	OldCapacity uint64 `json:",omitempty"` // GB, set by VolCapacityChange
+	TotalSize   uint64 // bytes
+	UsedSize    uint64 // bytes
+}
+
+// VolUsageDeadLetter defines an event failed to be delivered to some hooks within the attempts, which is kept until
+// it is retried or purged.
+type VolUsageDeadLetter struct {
+	Event     *VolUsageEvent
+	Hooks     []string // the hooks the event is not delivered to
+	Attempts  int
+	LastError string
+	Time      int64 // the time the event is moved to the dead letters
+}
+
+// VolUsageHooksView defines the view of the volume usage hooks of the master.
+type VolUsageHooksView struct {
+	Webhooks        []string
+	Plugins         []string // the hooks registered into the master by the custom builds
+	TickIntervalSec int64
+	Pending         int // the number of events not delivered yet
+	DeadLetters     []*VolUsageDeadLetter
+}
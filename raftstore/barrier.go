@@ -0,0 +1,90 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package raftstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/tiglabs/raft"
+)
+
+const (
+	barrierPollInterval = 10 * time.Millisecond
+	barrierTimeout      = 10 * time.Second
+
+	walMetaFileName  = "META"
+	walLogFileSuffix = ".log"
+)
+
+var ErrBarrierTimeout = errors.New("raft barrier timeout")
+
+// Barrier waits until the entries committed so far are applied, and syncs the raft log of the partition to the disk,
+// since the log is written without sync, so that the entries survive a power failure of the leader once it returns.
+func (p *partition) Barrier() (err error) {
+	if !p.IsRaftLeader() {
+		return raft.ErrNotLeader
+	}
+	committed := p.CommittedIndex()
+	deadline := time.Now().Add(barrierTimeout)
+	for p.AppliedIndex() < committed {
+		if time.Now().After(deadline) {
+			return ErrBarrierTimeout
+		}
+		time.Sleep(barrierPollInterval)
+	}
+	return syncWal(p.walPath)
+}
+
+// syncWal syncs the hard state and the last log file of the WaL, which are the only files written since the last
+// rotation, as the rotated log files are synced once they are closed.
+func syncWal(walPath string) (err error) {
+	fileInfos, err := ioutil.ReadDir(walPath)
+	if err != nil {
+		return
+	}
+	logFiles := make([]string, 0, len(fileInfos))
+	for _, fi := range fileInfos {
+		if strings.HasSuffix(fi.Name(), walLogFileSuffix) {
+			logFiles = append(logFiles, fi.Name())
+		}
+	}
+	// the log files are named by the hex sequence numbers of fixed width
+	sort.Strings(logFiles)
+	syncing := []string{walMetaFileName}
+	if len(logFiles) > 0 {
+		syncing = append(syncing, logFiles[len(logFiles)-1])
+	}
+	for _, name := range syncing {
+		if err = syncFile(path.Join(walPath, name)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func syncFile(name string) (err error) {
+	f, err := os.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,28 @@
+package raftstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSyncWal(t *testing.T) {
+	walPath, err := ioutil.TempDir("", "raftstore_barrier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(walPath)
+	if err = syncWal(walPath); err == nil {
+		t.Fatalf("syncing the wal without %v should fail", walMetaFileName)
+	}
+	for _, name := range []string{walMetaFileName, "0000000000000001-0000000000000001.log",
+		"0000000000000002-0000000000000100.log"} {
+		if err = ioutil.WriteFile(path.Join(walPath, name), []byte("entries"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = syncWal(walPath); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,6 +16,7 @@ package raftstore
 
 import (
 	"fmt"
+	"github.com/chubaofs/chubaofs/util/replnet"
 	"github.com/tiglabs/raft/proto"
 )
 
@@ -47,6 +48,17 @@ type Config struct {
 	// We suggest to use ElectionTick = 10 * HeartbeatTick to avoid unnecessary leader switching.
 	// The default value is 1s.
 	ElectionTick int
+
+	// HeartbeatTick is the heartbeat interval in ticks, 1 by default.
+	HeartbeatTick int
+
+	// MaxInflightMsgs limits the append messages in flight to a follower, 128 by default.
+	MaxInflightMsgs int
+
+	// ReplicaIP is the IP of the network interface dedicated to the replication, if any. The logs are replicated to
+	// the replication interfaces of the peers resolved by ReplicaResolver, while the heartbeats stay on IPAddr.
+	ReplicaIP       string
+	ReplicaResolver *replnet.Resolver
 }
 
 // PeerAddress defines the set of addresses that will be used by the peers.
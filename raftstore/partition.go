@@ -67,6 +67,12 @@ type Partition interface {
 	TryToLeader(nodeID uint64) error
 
 	IsOfflinePeer() bool
+
+	// Barrier waits until the committed entries are applied and syncs the raft log of the leader to the disk.
+	Barrier() error
+
+	// RaftView returns the internals of the raft group for debugging.
+	RaftView() *RaftView
 }
 
 // Default implementation of the Partition interface.
@@ -75,6 +81,8 @@ type partition struct {
 	raft    *raft.RaftServer
 	walPath string
 	config  *PartitionConfig
+	monitor *electionMonitor
+	changes memberChanges
 }
 
 // ChaneMember submits member change event and information to raft log.
@@ -84,6 +92,8 @@ func (p *partition) ChangeMember(changeType proto.ConfChangeType, peer proto.Pee
 		err = raft.ErrNotLeader
 		return
 	}
+	seq := p.changes.add(changeType, peer)
+	defer p.changes.done(seq)
 	future := p.raft.ChangeMember(p.id, changeType, peer, context)
 	resp, err = future.Response()
 	return
@@ -92,6 +102,9 @@ func (p *partition) ChangeMember(changeType proto.ConfChangeType, peer proto.Pee
 // Stop removes the raft partition from raft server and shuts down this partition.
 func (p *partition) Stop() (err error) {
 	err = p.raft.RemoveRaft(p.id)
+	if p.monitor != nil {
+		p.monitor.forget(p.id)
+	}
 	return
 }
 
@@ -172,11 +185,12 @@ func (p *partition) Truncate(index uint64) {
 	}
 }
 
-func newPartition(cfg *PartitionConfig, raft *raft.RaftServer, walPath string) Partition {
+func newPartition(cfg *PartitionConfig, raft *raft.RaftServer, walPath string, monitor *electionMonitor) Partition {
 	return &partition{
 		id:      cfg.ID,
 		raft:    raft,
 		walPath: walPath,
 		config:  cfg,
+		monitor: monitor,
 	}
 }
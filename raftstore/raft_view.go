@@ -0,0 +1,139 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package raftstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tiglabs/raft"
+	"github.com/tiglabs/raft/proto"
+)
+
+// DefaultElectionEventsKept is the number of the recent leader changes kept for each partition.
+const DefaultElectionEventsKept = 16
+
+// RaftView defines the internals of the raft group of a partition, which are kept inside the raft library, for
+// debugging the partition during the outages. The term, the commit and applied indices and the match index of each
+// peer are the ones of the raft status.
+type RaftView struct {
+	*PartitionStatus
+	SnapshotPeers  []uint64            // the followers receiving a snapshot from the leader
+	DownReplicas   []raft.DownReplica  // the followers not responding to the leader
+	Elections      []*ElectionEvent    // the recent leader changes observed by the node, the latest last
+	PendingChanges []*MemberChangeView // the member changes proposed by the node and not applied yet
+}
+
+// ElectionEvent defines a leader change of a partition, whose leader is 0 if the leader is lost.
+type ElectionEvent struct {
+	From uint64
+	To   uint64
+	Time string
+}
+
+// MemberChangeView defines a member change proposed to the raft group of a partition.
+type MemberChangeView struct {
+	Type         string
+	PeerID       uint64
+	ProposedTime string
+}
+
+// memberChanges tracks the member changes proposed by the node until they are applied or failed.
+type memberChanges struct {
+	sync.Mutex
+	seq     uint64
+	pending map[uint64]*MemberChangeView
+}
+
+func (c *memberChanges) add(changeType proto.ConfChangeType, peer proto.Peer) (seq uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[uint64]*MemberChangeView)
+	}
+	c.seq++
+	c.pending[c.seq] = &MemberChangeView{
+		Type:         changeType.String(),
+		PeerID:       peer.ID,
+		ProposedTime: time.Now().Format(time.RFC3339),
+	}
+	return c.seq
+}
+
+func (c *memberChanges) done(seq uint64) {
+	c.Lock()
+	delete(c.pending, seq)
+	c.Unlock()
+}
+
+func (c *memberChanges) list() (changes []*MemberChangeView) {
+	c.Lock()
+	defer c.Unlock()
+	seqs := make([]uint64, 0, len(c.pending))
+	for seq := range c.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	changes = make([]*MemberChangeView, 0, len(seqs))
+	for _, seq := range seqs {
+		changes = append(changes, c.pending[seq])
+	}
+	return
+}
+
+// recordLeader records the leader change of the partition, including the loss of the leader.
+func (m *electionMonitor) recordLeader(id, leader uint64, now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+	events := m.events[id]
+	event := &ElectionEvent{To: leader, Time: now.Format(time.RFC3339)}
+	if len(events) > 0 {
+		event.From = events[len(events)-1].To
+	}
+	if events = append(events, event); len(events) > DefaultElectionEventsKept {
+		events = events[len(events)-DefaultElectionEventsKept:]
+	}
+	m.events[id] = events
+}
+
+func (m *electionMonitor) electionEvents(id uint64) []*ElectionEvent {
+	m.Lock()
+	defer m.Unlock()
+	return append([]*ElectionEvent{}, m.events[id]...)
+}
+
+// forget drops the leader changes of the partition removed from the raft store.
+func (m *electionMonitor) forget(id uint64) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.events, id)
+	delete(m.changes, id)
+	delete(m.alerted, id)
+}
+
+// RaftView returns the internals of the raft group of the partition.
+func (p *partition) RaftView() (view *RaftView) {
+	view = &RaftView{
+		PartitionStatus: p.Status(),
+		SnapshotPeers:   p.raft.GetPendingReplica(p.id),
+		DownReplicas:    p.raft.GetDownReplicas(p.id),
+		PendingChanges:  p.changes.list(),
+	}
+	if p.monitor != nil {
+		view.Elections = p.monitor.electionEvents(p.id)
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package raftstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tiglabs/raft/proto"
+)
+
+func TestElectionEvents(t *testing.T) {
+	m := newElectionMonitor(DefaultElectionChurnWindow, DefaultElectionChurnThreshold)
+	now := time.Now()
+	m.recordLeader(1, 2, now)
+	m.recordLeader(1, 0, now)
+	m.recordLeader(1, 3, now)
+	events := m.electionEvents(1)
+	if len(events) != 3 || events[0].From != 0 || events[1].From != 2 || events[1].To != 0 || events[2].From != 0 ||
+		events[2].To != 3 {
+		t.Fatalf("unexpected election events %+v %+v %+v", events[0], events[1], events[2])
+	}
+	for i := 0; i < DefaultElectionEventsKept; i++ {
+		m.recordLeader(1, uint64(10+i), now)
+	}
+	if events = m.electionEvents(1); len(events) != DefaultElectionEventsKept || events[0].From != 3 {
+		t.Fatalf("expect the latest %v events kept, but are %v from %+v", DefaultElectionEventsKept, len(events),
+			events[0])
+	}
+	m.forget(1)
+	if events = m.electionEvents(1); len(events) != 0 {
+		t.Fatalf("expect the events of the removed partition dropped, but are %v", len(events))
+	}
+}
+
+func TestMemberChanges(t *testing.T) {
+	var changes memberChanges
+	first := changes.add(proto.ConfAddNode, proto.Peer{ID: 4})
+	second := changes.add(proto.ConfRemoveNode, proto.Peer{ID: 1})
+	pending := changes.list()
+	if len(pending) != 2 || pending[0].PeerID != 4 || pending[1].PeerID != 1 {
+		t.Fatalf("unexpected pending changes %+v", pending)
+	}
+	changes.done(first)
+	if pending = changes.list(); len(pending) != 1 || pending[0].Type != proto.ConfRemoveNode.String() {
+		t.Fatalf("expect the removal pending only, but are %+v", pending)
+	}
+	changes.done(second)
+	if pending = changes.list(); len(pending) != 0 {
+		t.Fatalf("expect no pending change, but are %+v", pending)
+	}
+}
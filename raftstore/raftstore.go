@@ -36,6 +36,9 @@ type RaftStore interface {
 	RaftStatus(raftID uint64) (raftStatus *raft.Status)
 	NodeManager
 	RaftServer() *raft.RaftServer
+	Timings() Timings
+	SetTimings(timings Timings) error
+	TimingsView() *TimingsView
 }
 
 type raftStore struct {
@@ -44,6 +47,7 @@ type raftStore struct {
 	raftConfig *raft.Config
 	raftServer *raft.RaftServer
 	raftPath   string
+	elections  *electionMonitor
 }
 
 // RaftConfig returns the raft configuration.
@@ -95,7 +99,7 @@ func newRaftLogger(dir string) {
 
 // NewRaftStore returns a new raft store instance.
 func NewRaftStore(cfg *Config) (mr RaftStore, err error) {
-	resolver := NewNodeResolver()
+	resolver := &nodeResolver{replica: cfg.ReplicaResolver}
 
 	newRaftLogger(cfg.RaftPath)
 
@@ -119,10 +123,20 @@ func NewRaftStore(cfg *Config) (mr RaftStore, err error) {
 	}
 	rc.HeartbeatAddr = fmt.Sprintf("%s:%d", cfg.IPAddr, cfg.HeartbeatPort)
 	rc.ReplicateAddr = fmt.Sprintf("%s:%d", cfg.IPAddr, cfg.ReplicaPort)
+	if cfg.ReplicaIP != "" {
+		// the peers without the replication interfaces still replicate to the IP address
+		rc.ReplicateAddr = fmt.Sprintf(":%d", cfg.ReplicaPort)
+	}
 	rc.Resolver = resolver
 	rc.RetainLogs = cfg.NumOfLogsToRetain
 	rc.TickInterval = time.Duration(cfg.TickInterval) * time.Millisecond
 	rc.ElectionTick = cfg.ElectionTick
+	if cfg.HeartbeatTick > 0 {
+		rc.HeartbeatTick = cfg.HeartbeatTick
+	}
+	if cfg.MaxInflightMsgs > 0 {
+		rc.MaxInflightMsgs = cfg.MaxInflightMsgs
+	}
 	rs, err := raft.NewRaftServer(rc)
 	if err != nil {
 		return
@@ -133,10 +147,38 @@ func NewRaftStore(cfg *Config) (mr RaftStore, err error) {
 		raftConfig: rc,
 		raftServer: rs,
 		raftPath:   cfg.RaftPath,
+		elections:  newElectionMonitor(DefaultElectionChurnWindow, DefaultElectionChurnThreshold),
 	}
 	return
 }
 
+// Timings returns the raft timings in effect.
+func (s *raftStore) Timings() Timings {
+	return timingsOf(s.raftServer.Timings())
+}
+
+// SetTimings changes the raft timings without restart. The change is not persisted, so the config is to be updated
+// as well to keep it after restart.
+func (s *raftStore) SetTimings(timings Timings) (err error) {
+	if err = s.raftServer.SetTimings(timings.raftTimings()); err != nil {
+		return
+	}
+	syslog.Printf("raft timings changed to %+v\n", timings)
+	return
+}
+
+// TimingsView returns the raft timings in effect and the election churn of the raft store.
+func (s *raftStore) TimingsView() *TimingsView {
+	timings := s.Timings()
+	tick := time.Duration(timings.TickInterval) * time.Millisecond
+	return &TimingsView{
+		Timings:           timings,
+		HeartbeatInterval: (time.Duration(timings.HeartbeatTick) * tick).String(),
+		ElectionTimeout:   (time.Duration(timings.ElectionTick) * tick).String(),
+		Churn:             s.elections.churn(time.Now()),
+	}
+}
+
 func (s *raftStore) RaftServer() *raft.RaftServer {
 	return s.raftServer
 }
@@ -176,12 +218,12 @@ func (s *raftStore) CreatePartition(cfg *PartitionConfig) (p Partition, err erro
 		Leader:       cfg.Leader,
 		Term:         cfg.Term,
 		Storage:      ws,
-		StateMachine: cfg.SM,
+		StateMachine: &electionWatcher{PartitionFsm: cfg.SM, id: cfg.ID, store: s, monitor: s.elections},
 		Applied:      cfg.Applied,
 	}
 	if err = s.raftServer.CreateRaft(rc); err != nil {
 		return
 	}
-	p = newPartition(cfg, s.raftServer, walPath)
+	p = newPartition(cfg, s.raftServer, walPath, s.elections)
 	return
 }
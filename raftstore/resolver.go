@@ -17,6 +17,7 @@ package raftstore
 import (
 	"fmt"
 	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/replnet"
 	"github.com/tiglabs/raft"
 	"strings"
 	"sync"
@@ -54,6 +55,7 @@ type NodeResolver interface {
 // Default thread-safe implementation of the NodeResolver interface.
 type nodeResolver struct {
 	nodeMap sync.Map
+	replica *replnet.Resolver // resolves the replication interfaces of the peers, nil if this node has none
 }
 
 // NodeAddress resolves NodeID as net.Addr.
@@ -73,7 +75,7 @@ func (r *nodeResolver) NodeAddress(nodeID uint64, stype raft.SocketType) (addr s
 	case raft.HeartBeat:
 		addr = address.Heartbeat
 	case raft.Replicate:
-		addr = address.Replicate
+		addr = r.replica.ReplicaAddr(address.Replicate)
 	default:
 		err = ErrUnknownSocketType
 	}
@@ -209,3 +209,8 @@ func (rs *RocksDBStore) Iterator(snapshot *gorocksdb.Snapshot) *gorocksdb.Iterat
 
 	return rs.db.NewIterator(ro)
 }
+
+// Close closes the RocksDB instance.
+func (rs *RocksDBStore) Close() {
+	rs.db.Close()
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package raftstore
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/tiglabs/raft"
+)
+
+// The keys of the raft timings, which are shared by the config files and the runtime APIs of the master, the meta
+// nodes and the data nodes.
+const (
+	CfgTickInterval    = "tickInterval"
+	CfgHeartbeatTick   = "heartbeatTick"
+	CfgElectionTick    = "electionTick"
+	CfgMaxInflightMsgs = "maxInflightMsgs"
+)
+
+const (
+	DefaultElectionChurnWindow    = 10 * time.Minute
+	DefaultElectionChurnThreshold = 3 // leader changes of a partition within the window to alert
+)
+
+// Timings defines the raft timings of the raft store. The heartbeat interval is HeartbeatTick ticks and the election
+// timeout is ElectionTick ticks, randomized up to twice of it on the followers.
+type Timings struct {
+	TickInterval    int `json:"tickInterval"` // millisecond
+	HeartbeatTick   int `json:"heartbeatTick"`
+	ElectionTick    int `json:"electionTick"`
+	MaxInflightMsgs int `json:"maxInflightMsgs"`
+}
+
+// Override returns the timings with the ones of the keys present in the values, which is the config or the form of
+// a request.
+func (t Timings) Override(get func(key string) string) (Timings, error) {
+	for _, item := range []struct {
+		key   string
+		value *int
+	}{
+		{CfgTickInterval, &t.TickInterval},
+		{CfgHeartbeatTick, &t.HeartbeatTick},
+		{CfgElectionTick, &t.ElectionTick},
+		{CfgMaxInflightMsgs, &t.MaxInflightMsgs},
+	} {
+		value := get(item.key)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return t, fmt.Errorf("%v must be a positive integer", item.key)
+		}
+		*item.value = v
+	}
+	return t, nil
+}
+
+// LoadTimings loads the raft timings from the config, in which they are numbers or strings. The ones not configured
+// are left zero to take the defaults.
+func LoadTimings(cfg *config.Config) (Timings, error) {
+	return Timings{}.Override(func(key string) string {
+		if value := cfg.GetString(key); value != "" {
+			return value
+		}
+		if value := cfg.GetFloat(key); value > 0 {
+			return strconv.Itoa(int(value))
+		}
+		return ""
+	})
+}
+
+func (t Timings) raftTimings() raft.Timings {
+	return raft.Timings{
+		TickInterval:    time.Duration(t.TickInterval) * time.Millisecond,
+		HeartbeatTick:   t.HeartbeatTick,
+		ElectionTick:    t.ElectionTick,
+		MaxInflightMsgs: t.MaxInflightMsgs,
+	}
+}
+
+func timingsOf(t raft.Timings) Timings {
+	return Timings{
+		TickInterval:    int(t.TickInterval / time.Millisecond),
+		HeartbeatTick:   t.HeartbeatTick,
+		ElectionTick:    t.ElectionTick,
+		MaxInflightMsgs: t.MaxInflightMsgs,
+	}
+}
+
+// TimingsView defines the view of the raft timings and the election churn of the raft store.
+type TimingsView struct {
+	Timings
+	HeartbeatInterval string
+	ElectionTimeout   string
+	Churn             *ElectionChurn
+}
+
+// ElectionChurn defines the leader changes observed by the raft store. The partitions whose leader changes reach
+// the threshold within the window are alerted, which hints the election timeout is too short for the network.
+type ElectionChurn struct {
+	Window        string
+	Threshold     int
+	LeaderChanges uint64            // since the raft store is started
+	Partitions    map[uint64]int    // the leader changes of the partitions within the window
+	Alerted       map[uint64]string // the partitions alerted within the window and when
+}
+
+// electionMonitor counts the leader changes of the partitions of the raft store.
+type electionMonitor struct {
+	sync.Mutex
+	window    time.Duration
+	threshold int
+	total     uint64
+	changes   map[uint64][]time.Time
+	alerted   map[uint64]time.Time
+	events    map[uint64][]*ElectionEvent // the recent leader changes of the partitions
+}
+
+func newElectionMonitor(window time.Duration, threshold int) *electionMonitor {
+	return &electionMonitor{
+		window:    window,
+		threshold: threshold,
+		changes:   make(map[uint64][]time.Time),
+		alerted:   make(map[uint64]time.Time),
+		events:    make(map[uint64][]*ElectionEvent),
+	}
+}
+
+func (m *electionMonitor) expire(id uint64, now time.Time) {
+	changes := m.changes[id]
+	i := 0
+	for i < len(changes) && now.Sub(changes[i]) > m.window {
+		i++
+	}
+	if changes = changes[i:]; len(changes) == 0 {
+		delete(m.changes, id)
+	} else {
+		m.changes[id] = changes
+	}
+	if at, ok := m.alerted[id]; ok && now.Sub(at) > m.window {
+		delete(m.alerted, id)
+	}
+}
+
+// record records a leader change of the partition, and returns whether the partition is to be alerted, which is
+// at most once within the window.
+func (m *electionMonitor) record(id uint64, now time.Time) (count int, alert bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.total++
+	m.expire(id, now)
+	m.changes[id] = append(m.changes[id], now)
+	count = len(m.changes[id])
+	if _, ok := m.alerted[id]; !ok && count >= m.threshold {
+		m.alerted[id] = now
+		alert = true
+	}
+	return
+}
+
+func (m *electionMonitor) churn(now time.Time) *ElectionChurn {
+	m.Lock()
+	defer m.Unlock()
+	churn := &ElectionChurn{
+		Window:        m.window.String(),
+		Threshold:     m.threshold,
+		LeaderChanges: m.total,
+		Partitions:    make(map[uint64]int),
+		Alerted:       make(map[uint64]string),
+	}
+	for id := range m.changes {
+		m.expire(id, now)
+	}
+	for id := range m.alerted {
+		m.expire(id, now)
+	}
+	for id, changes := range m.changes {
+		churn.Partitions[id] = len(changes)
+	}
+	for id, at := range m.alerted {
+		churn.Alerted[id] = at.Format(time.RFC3339)
+	}
+	return churn
+}
+
+// electionWatcher reports the leader changes of a partition to the monitor before passing them to the state machine.
+type electionWatcher struct {
+	PartitionFsm
+	id      uint64
+	store   *raftStore
+	monitor *electionMonitor
+}
+
+func (w *electionWatcher) HandleLeaderChange(leader uint64) {
+	w.monitor.recordLeader(w.id, leader, time.Now())
+	if leader != 0 {
+		if count, alert := w.monitor.record(w.id, time.Now()); alert {
+			timings := w.store.Timings()
+			msg := fmt.Sprintf("raft partition[%v] changed its leader %v times within %v, the election timeout %v "+
+				"may be too short for the network", w.id, count, w.monitor.window,
+				time.Duration(timings.ElectionTick*timings.TickInterval)*time.Millisecond)
+			log.LogWarn(msg)
+			exporter.Warning(msg)
+		}
+	}
+	w.PartitionFsm.HandleLeaderChange(leader)
+}
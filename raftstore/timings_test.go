@@ -0,0 +1,69 @@
+package raftstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/config"
+)
+
+func TestTimingsOverride(t *testing.T) {
+	current := Timings{TickInterval: 300, HeartbeatTick: 1, ElectionTick: 3, MaxInflightMsgs: 128}
+	form := map[string]string{CfgTickInterval: "1000", CfgElectionTick: "10"}
+	timings, err := current.Override(func(key string) string { return form[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Timings{TickInterval: 1000, HeartbeatTick: 1, ElectionTick: 10, MaxInflightMsgs: 128}
+	if timings != expected {
+		t.Fatalf("expected %+v, got %+v", expected, timings)
+	}
+	if timingsOf(timings.raftTimings()) != timings {
+		t.Fatalf("timings %+v changed by the conversion", timings)
+	}
+
+	for _, value := range []string{"0", "-1", "1s"} {
+		form[CfgHeartbeatTick] = value
+		if _, err = current.Override(func(key string) string { return form[key] }); err == nil {
+			t.Fatalf("%v=%v should be refused", CfgHeartbeatTick, value)
+		}
+	}
+
+	cfg := config.LoadConfigString(`{"tickInterval": 500, "electionTick": "8"}`)
+	if timings, err = LoadTimings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if expected = (Timings{TickInterval: 500, ElectionTick: 8}); timings != expected {
+		t.Fatalf("expected %+v loaded, got %+v", expected, timings)
+	}
+}
+
+func TestElectionMonitor(t *testing.T) {
+	m := newElectionMonitor(time.Minute, 3)
+	now := time.Now()
+	for i, expected := range []bool{false, false, true, false} {
+		if _, alert := m.record(1, now.Add(time.Duration(i)*time.Second)); alert != expected {
+			t.Fatalf("change %v of partition 1: expected alert %v", i, expected)
+		}
+	}
+	if _, alert := m.record(2, now); alert {
+		t.Fatalf("partition 2 should not be alerted")
+	}
+
+	churn := m.churn(now.Add(10 * time.Second))
+	if churn.LeaderChanges != 5 || churn.Partitions[1] != 4 || churn.Partitions[2] != 1 || len(churn.Alerted) != 1 {
+		t.Fatalf("unexpected churn %+v", churn)
+	}
+
+	// the changes and the alert expire out of the window, after which the partition can be alerted again
+	later := now.Add(2 * time.Minute)
+	churn = m.churn(later)
+	if churn.LeaderChanges != 5 || len(churn.Partitions) != 0 || len(churn.Alerted) != 0 {
+		t.Fatalf("unexpected churn %+v after the window", churn)
+	}
+	for i, expected := range []bool{false, false, true} {
+		if _, alert := m.record(1, later.Add(time.Duration(i)*time.Second)); alert != expected {
+			t.Fatalf("change %v of partition 1 after the window: expected alert %v", i, expected)
+		}
+	}
+}
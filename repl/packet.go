@@ -15,6 +15,7 @@
 package repl
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -43,6 +44,7 @@ type Packet struct {
 	TpObject        *exporter.TimePointCount
 	NeedReply       bool
 	OrgBuffer       []byte
+	QuorumWrite     bool // if true, the packet is acked once the quorum of the replicas persist it
 }
 
 type FollowerPacket struct {
@@ -71,26 +73,7 @@ func (p *FollowerPacket) IsErrPacket() bool {
 
 
 func (p *FollowerPacket) identificationErrorResultCode(errLog string, errMsg string) {
-	if strings.Contains(errLog, ActionReceiveFromFollower) || strings.Contains(errLog, ActionSendToFollowers) ||
-		strings.Contains(errLog, ConnIsNullErr) {
-		p.ResultCode = proto.OpIntraGroupNetErr
-	} else if strings.Contains(errMsg, storage.ParameterMismatchError.Error()) ||
-		strings.Contains(errMsg, ErrorUnknownOp.Error()) {
-		p.ResultCode = proto.OpArgMismatchErr
-	} else if strings.Contains(errMsg, proto.ErrDataPartitionNotExists.Error()) {
-		p.ResultCode = proto.OpTryOtherAddr
-	} else if strings.Contains(errMsg, storage.ExtentNotFoundError.Error()) ||
-		strings.Contains(errMsg, storage.ExtentHasBeenDeletedError.Error()) {
-		p.ResultCode = proto.OpNotExistErr
-	} else if strings.Contains(errMsg, storage.NoSpaceError.Error()) {
-		p.ResultCode = proto.OpDiskNoSpaceErr
-	} else if strings.Contains(errMsg, storage.TryAgainError.Error()) {
-		p.ResultCode = proto.OpAgain
-	} else if strings.Contains(errMsg, raft.ErrNotLeader.Error()) {
-		p.ResultCode = proto.OpTryOtherAddr
-	} else {
-		p.ResultCode = proto.OpIntraGroupNetErr
-	}
+	p.ResultCode = errorResultCode(errLog, errMsg)
 }
 
 func (p *Packet) AfterTp() (ok bool) {
@@ -118,6 +101,7 @@ func (p *Packet) clean() {
 func copyPacket(src *Packet, dst *FollowerPacket) {
 	dst.Magic = src.Magic
 	dst.ExtentType = src.ExtentType
+	dst.Priority = src.Priority
 	dst.Opcode = src.Opcode
 	dst.ResultCode = src.ResultCode
 	dst.CRC = src.CRC
@@ -224,6 +208,55 @@ func NewExtentRepairReadPacket(partitionID uint64, extentID uint64, offset, size
 	return
 }
 
+// NewBlockRepairReadPacket returns a new packet to read the blocks of a normal extent from the source replica of a
+// block repair. It is a follower read, so that the data is checked against the block Crcs of the source.
+func NewBlockRepairReadPacket(partitionID uint64, extentID uint64, offset int64, size uint32) (p *Packet) {
+	p = new(Packet)
+	p.ExtentID = extentID
+	p.PartitionID = partitionID
+	p.Magic = proto.ProtoMagic
+	p.ExtentOffset = offset
+	p.Size = size
+	p.Opcode = proto.OpStreamFollowerRead
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+
+	return
+}
+
+// NewVerifyExtentPacket returns a new packet to get the size of the extent on a replica, and the Crc of the range
+// if the replica holds the whole range.
+func NewVerifyExtentPacket(partitionID uint64, extentID uint64, offset uint64, size uint32) (p *Packet) {
+	p = new(Packet)
+	p.ExtentID = extentID
+	p.PartitionID = partitionID
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpVerifyExtent
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+	p.Data, _ = json.Marshal(&proto.ExtentVerifyRequest{Offset: offset, Size: size})
+	p.Size = uint32(len(p.Data))
+
+	return
+}
+
+// NewPacketToExtentDelta returns a new packet to ask the source of a delta sync for the delta of the extent
+// from the offset, against the block signatures in the data.
+func NewPacketToExtentDelta(partitionID uint64, extentID uint64, offset int64, data []byte) (p *Packet) {
+	p = new(Packet)
+	p.ExtentID = extentID
+	p.PartitionID = partitionID
+	p.Magic = proto.ProtoMagic
+	p.ExtentOffset = offset
+	p.Data = data
+	p.Size = uint32(len(data))
+	p.Opcode = proto.OpExtentDelta
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+
+	return
+}
+
 func NewTinyExtentRepairReadPacket(partitionID uint64, extentID uint64, offset, size int) (p *Packet) {
 	p = new(Packet)
 	p.ExtentID = extentID
@@ -286,27 +319,34 @@ var (
 	ErrorUnknownOp = errors.New("unknown opcode")
 )
 
-func (p *Packet) identificationErrorResultCode(errLog string, errMsg string) {
+func init() {
+	proto.RegisterResultCode(storage.ParameterMismatchError, proto.OpArgMismatchErr)
+	proto.RegisterResultCode(ErrorUnknownOp, proto.OpArgMismatchErr)
+	proto.RegisterResultCode(proto.ErrDataPartitionNotExists, proto.OpTryOtherAddr)
+	proto.RegisterResultCode(storage.ExtentIsLaggingError, proto.OpTryOtherAddr)
+	proto.RegisterResultCode(storage.ExtentNotFoundError, proto.OpNotExistErr)
+	proto.RegisterResultCode(storage.ExtentHasBeenDeletedError, proto.OpNotExistErr)
+	proto.RegisterResultCode(storage.NoSpaceError, proto.OpDiskNoSpaceErr)
+	proto.RegisterResultCode(storage.TryAgainError, proto.OpAgain)
+	proto.RegisterResultCode(storage.BlockCrcMismatchError, proto.OpCrcMismatchErr)
+	proto.RegisterResultCode(raft.ErrNotLeader, proto.OpTryOtherAddr)
+}
+
+// errorResultCode returns the result code replied for an error by the error catalog, the failures to forward the
+// packets to the followers and the unknown errors are replied as OpIntraGroupNetErr.
+func errorResultCode(errLog string, errMsg string) uint8 {
 	if strings.Contains(errLog, ActionReceiveFromFollower) || strings.Contains(errLog, ActionSendToFollowers) ||
 		strings.Contains(errLog, ConnIsNullErr) {
-		p.ResultCode = proto.OpIntraGroupNetErr
-	} else if strings.Contains(errMsg, storage.ParameterMismatchError.Error()) ||
-		strings.Contains(errMsg, ErrorUnknownOp.Error()) {
-		p.ResultCode = proto.OpArgMismatchErr
-	} else if strings.Contains(errMsg, proto.ErrDataPartitionNotExists.Error()) {
-		p.ResultCode = proto.OpTryOtherAddr
-	} else if strings.Contains(errMsg, storage.ExtentNotFoundError.Error()) ||
-		strings.Contains(errMsg, storage.ExtentHasBeenDeletedError.Error()) {
-		p.ResultCode = proto.OpNotExistErr
-	} else if strings.Contains(errMsg, storage.NoSpaceError.Error()) {
-		p.ResultCode = proto.OpDiskNoSpaceErr
-	} else if strings.Contains(errMsg, storage.TryAgainError.Error()) {
-		p.ResultCode = proto.OpAgain
-	} else if strings.Contains(errMsg, raft.ErrNotLeader.Error()) {
-		p.ResultCode = proto.OpTryOtherAddr
-	} else {
-		p.ResultCode = proto.OpIntraGroupNetErr
+		return proto.OpIntraGroupNetErr
+	}
+	if code, ok := proto.ResultCodeOfMessage(errMsg); ok && code != proto.OpOk {
+		return code
 	}
+	return proto.OpIntraGroupNetErr
+}
+
+func (p *Packet) identificationErrorResultCode(errLog string, errMsg string) {
+	p.ResultCode = errorResultCode(errLog, errMsg)
 }
 
 func (p *Packet) PackErrorBody(action, msg string) {
@@ -370,12 +410,37 @@ func (p *Packet) IsMasterCommand() bool {
 		proto.OpDecommissionDataPartition,
 		proto.OpAddDataPartitionRaftMember,
 		proto.OpRemoveDataPartitionRaftMember,
-		proto.OpDataPartitionTryToLeader:
+		proto.OpDataPartitionTryToLeader,
+		proto.OpFreezeDataPartition,
+		proto.OpDegradeDataPartition,
+		proto.OpCopyExtent,
+		proto.OpRepairDataBlock,
+		proto.OpResizeDataPartition,
+		proto.OpOrphanExtents:
 		return true
 	}
 	return false
 }
 
+// quorum returns the number of the replicas, including the leader, which must persist the packet before it is acked.
+func (p *Packet) quorum() int {
+	replicas := len(p.followersAddrs) + 1
+	if !p.QuorumWrite {
+		return replicas
+	}
+	return replicas/2 + 1
+}
+
+// detachBuffer takes the pooled buffer away from the packet, so that it is not released by clean
+// while the followers are still sending it.
+func (p *Packet) detachBuffer() (buffer []byte) {
+	if p.OrgBuffer != nil && len(p.OrgBuffer) == util.BlockSize && p.IsWriteOperation() {
+		buffer = p.OrgBuffer
+		p.OrgBuffer = nil
+	}
+	return
+}
+
 func (p *Packet) IsForwardPacket() bool {
 	r := p.RemainingFollowers > 0
 	return r
@@ -420,6 +485,11 @@ func (p *Packet) IsReadOperation() bool {
 		p.Opcode == proto.OpTinyExtentRepairRead || p.Opcode == proto.OpStreamFollowerRead
 }
 
+// IsVectorReadOperation returns if the packet is a vectored read, whose request carries the read ranges in the data.
+func (p *Packet) IsVectorReadOperation() bool {
+	return p.Opcode == proto.OpStreamVectorRead
+}
+
 func (p *Packet) IsRandomWrite() bool {
 	return p.Opcode == proto.OpRandomWrite || p.Opcode == proto.OpSyncRandomWrite
 }
@@ -21,21 +21,37 @@ import (
 	"sync"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
 	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/chubaofs/chubaofs/util/replnet"
 	"sync/atomic"
 	"time"
 )
 
+// LaggingExtentRetryInterval is how long the packets of an extent are not sent to the follower lagging on it. The repair
+// catching up the follower is launched storage.RepairInterval after the extent is not modified any more.
+const LaggingExtentRetryInterval = 2 * time.Second * (storage.RepairInterval + 10)
+
 var (
-	gConnPool = util.NewConnectPool()
+	gConnPool        = util.NewConnectPool()
+	gReplicaResolver *replnet.Resolver
 )
 
+// SetReplicaResolver forwards the packets to the replication interfaces of the followers resolved by the resolver.
+func SetReplicaResolver(resolver *replnet.Resolver) {
+	gReplicaResolver = resolver
+}
+
 // ReplProtocol defines the struct of the replication protocol.
 // 1. ServerConn reads a packet from the client socket, and analyzes the addresses of the followers.
 // 2. After the preparation, the packet is send to toBeProcessedCh. If failure happens, send it to the response channel.
 // 3. OperatorAndForwardPktGoRoutine fetches a packet from toBeProcessedCh, and determine if it needs to be forwarded to the followers.
 // 4. receiveResponse fetches a reply from responseCh, executes postFunc, and writes a response to the client if necessary.
+//
+// A quorum write packet is acked once the quorum of the replicas persist it. The responses of the stragglers are
+// received asynchronously and reported by stragglerFunc, and the following packets of the same extent are not
+// sent to the stragglers until LaggingExtentRetryInterval passes, by when they are caught up by the extent repair.
 type ReplProtocol struct {
 	packetListLock sync.RWMutex
 
@@ -57,6 +73,10 @@ type ReplProtocol struct {
 	operatorFunc func(p *Packet, c *net.TCPConn) error // operator
 	postFunc     func(p *Packet) error                 // post-processing packet
 
+	stragglerFunc     func(p *FollowerPacket, addr string, err error) // report the straggler of a quorum write packet
+	laggingExtents    map[string]time.Time                            // the extents lagging on the followers and when they were marked, protected by lock
+	retiredTransports []*FollowerTransport                            // the broken transports to be destroyed, protected by lock
+
 	isError int32
 	replId  int64
 }
@@ -69,13 +89,14 @@ type FollowerTransport struct {
 	exitCh   chan struct{}
 	exitedMu sync.RWMutex
 	isclosed int32
+	isBroken int32
 }
 
 func NewFollowersTransport(addr string) (ft *FollowerTransport, err error) {
 	var (
 		conn net.Conn
 	)
-	if conn, err = gConnPool.GetConnect(addr); err != nil {
+	if conn, err = gConnPool.GetConnect(gReplicaResolver.ReplicaAddr(addr)); err != nil {
 		return
 	}
 	ft = new(FollowerTransport)
@@ -97,7 +118,7 @@ func (ft *FollowerTransport) serverWriteToFollower() {
 			if err := p.WriteToConn(ft.conn); err != nil {
 				p.PackErrorBody(ActionSendToFollowers, err.Error())
 				p.respCh <- fmt.Errorf(string(p.Data[:p.Size]))
-				ft.conn.Close()
+				ft.close()
 				continue
 			}
 			ft.recvCh <- p
@@ -137,7 +158,7 @@ func (ft *FollowerTransport) readFollowerResult(request *FollowerPacket) (err er
 		reply.clean()
 		request.respCh <- err
 		if err != nil {
-			ft.conn.Close()
+			ft.close()
 		}
 	}()
 	if request.IsErrPacket() {
@@ -168,6 +189,17 @@ func (ft *FollowerTransport) readFollowerResult(request *FollowerPacket) (err er
 	return
 }
 
+// close closes the connection to the follower after an error, and the transport is broken since then.
+func (ft *FollowerTransport) close() {
+	atomic.StoreInt32(&ft.isBroken, 1)
+	ft.conn.Close()
+}
+
+// IsBroken returns if the connection to the follower has been closed due to an error.
+func (ft *FollowerTransport) IsBroken() bool {
+	return atomic.LoadInt32(&ft.isBroken) == 1
+}
+
 func (ft *FollowerTransport) Destory() {
 	ft.exitedMu.Lock()
 	atomic.StoreInt32(&ft.isclosed, FollowerTransportExiting)
@@ -188,7 +220,8 @@ func (ft *FollowerTransport) Write(p *FollowerPacket) {
 }
 
 func NewReplProtocol(inConn *net.TCPConn, prepareFunc func(p *Packet) error,
-	operatorFunc func(p *Packet, c *net.TCPConn) error, postFunc func(p *Packet) error) *ReplProtocol {
+	operatorFunc func(p *Packet, c *net.TCPConn) error, postFunc func(p *Packet) error,
+	stragglerFunc func(p *FollowerPacket, addr string, err error)) *ReplProtocol {
 	rp := new(ReplProtocol)
 	rp.packetList = list.New()
 	rp.ackCh = make(chan struct{}, RequestChanSize)
@@ -200,6 +233,8 @@ func NewReplProtocol(inConn *net.TCPConn, prepareFunc func(p *Packet) error,
 	rp.prepareFunc = prepareFunc
 	rp.operatorFunc = operatorFunc
 	rp.postFunc = postFunc
+	rp.stragglerFunc = stragglerFunc
+	rp.laggingExtents = make(map[string]time.Time)
 	rp.exited = ReplRuning
 	rp.replId = proto.GenerateRequestID()
 	go rp.OperatorAndForwardPktGoRoutine()
@@ -285,14 +320,20 @@ func (rp *ReplProtocol) readPkgAndPrepare() (err error) {
 
 func (rp *ReplProtocol) sendRequestToAllFollowers(request *Packet) (index int, err error) {
 	for index = 0; index < len(request.followersAddrs); index++ {
+		followerRequest := NewFollowerPacket()
+		copyPacket(request, followerRequest)
+		followerRequest.RemainingFollowers = 0
+		if request.QuorumWrite && rp.isExtentLagging(request.followersAddrs[index], request.ExtentID) {
+			// the follower rejects the packet anyway, since it has missed the previous packets of the extent
+			request.followerPackets[index] = followerRequest
+			followerRequest.respCh <- storage.ExtentIsLaggingError
+			continue
+		}
 		var transport *FollowerTransport
 		if transport, err = rp.allocateFollowersConns(request, index); err != nil {
 			request.PackErrorBody(ActionSendToFollowers, err.Error())
 			return
 		}
-		followerRequest := NewFollowerPacket()
-		copyPacket(request, followerRequest)
-		followerRequest.RemainingFollowers = 0
 		request.followerPackets[index] = followerRequest
 		transport.Write(followerRequest)
 	}
@@ -378,6 +419,10 @@ func (rp *ReplProtocol) checkLocalResultAndReciveAllFollowerResponse() {
 	if request.IsErrPacket() {
 		return
 	}
+	if request.quorum() <= len(request.followersAddrs) {
+		rp.receiveQuorumFollowerResponse(request)
+		return
+	}
 	for index := 0; index < len(request.followersAddrs); index++ {
 		followerPacket := request.followerPackets[index]
 		err := <-followerPacket.respCh
@@ -390,6 +435,110 @@ func (rp *ReplProtocol) checkLocalResultAndReciveAllFollowerResponse() {
 	return
 }
 
+type followerResult struct {
+	index int
+	err   error
+}
+
+// Wait until the quorum of the replicas persist the packet, the leader has persisted it already.
+// The remaining responses are received asynchronously, and the buffer of the packet is released after that.
+func (rp *ReplProtocol) receiveQuorumFollowerResponse(request *Packet) {
+	var (
+		followers = len(request.followerPackets)
+		needAcks  = request.quorum() - 1
+		acks      int
+		fails     int
+	)
+	results := make(chan followerResult, followers)
+	for index, followerPacket := range request.followerPackets {
+		go func(index int, followerPacket *FollowerPacket) {
+			results <- followerResult{index: index, err: <-followerPacket.respCh}
+		}(index, followerPacket)
+	}
+	for acks < needAcks && followers-fails >= needAcks {
+		result := <-results
+		if result.err == nil {
+			acks++
+			rp.clearExtentLagging(request, result)
+			continue
+		}
+		fails++
+		rp.reportStraggler(request, result)
+		if followers-fails < needAcks {
+			request.PackErrorBody(ActionReceiveFromFollower, result.err.Error())
+		}
+	}
+	pending := followers - acks - fails
+	buffer := request.detachBuffer()
+	go func() {
+		for i := 0; i < pending; i++ {
+			if result := <-results; result.err != nil {
+				rp.reportStraggler(request, result)
+			} else {
+				rp.clearExtentLagging(request, result)
+			}
+		}
+		if buffer != nil {
+			proto.Buffers.Put(buffer)
+		}
+	}()
+}
+
+func (rp *ReplProtocol) reportStraggler(request *Packet, result followerResult) {
+	addr := request.followersAddrs[result.index]
+	followerPacket := request.followerPackets[result.index]
+	if !rp.markExtentLagging(addr, followerPacket.ExtentID) {
+		return
+	}
+	log.LogWarnf("action[reportStraggler] follower(%v) is lagging on packet(%v) err(%v)",
+		addr, followerPacket.GetUniqueLogId(), result.err)
+	if rp.stragglerFunc != nil {
+		rp.stragglerFunc(followerPacket, addr, result.err)
+	}
+}
+
+func laggingExtentKey(addr string, extentID uint64) string {
+	return fmt.Sprintf("%v_%v", addr, extentID)
+}
+
+// markExtentLagging returns false if the extent has been marked lagging on the follower and the mark has not expired.
+// An expired mark is renewed, since the follower has not been caught up by the repair scheduled for the mark.
+func (rp *ReplProtocol) markExtentLagging(addr string, extentID uint64) bool {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	if rp.laggingExtents == nil {
+		return false
+	}
+	key := laggingExtentKey(addr, extentID)
+	if markTime, ok := rp.laggingExtents[key]; ok && time.Since(markTime) < LaggingExtentRetryInterval {
+		return false
+	}
+	rp.laggingExtents[key] = time.Now()
+	return true
+}
+
+// isExtentLagging returns true if the extent is marked lagging on the follower. The packets are sent to the follower
+// again once the mark expires, so that the mark is cleared by the ack of the follower caught up by the repair.
+func (rp *ReplProtocol) isExtentLagging(addr string, extentID uint64) bool {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+	markTime, ok := rp.laggingExtents[laggingExtentKey(addr, extentID)]
+	return ok && time.Since(markTime) < LaggingExtentRetryInterval
+}
+
+// clearExtentLagging clears the mark of the extent on the follower which acks a packet of it.
+func (rp *ReplProtocol) clearExtentLagging(request *Packet, result followerResult) {
+	addr := request.followersAddrs[result.index]
+	extentID := request.followerPackets[result.index].ExtentID
+	key := laggingExtentKey(addr, extentID)
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	if _, ok := rp.laggingExtents[key]; ok {
+		delete(rp.laggingExtents, key)
+		log.LogInfof("action[clearExtentLagging] extent(%v) is caught up on follower(%v)", extentID, addr)
+	}
+}
+
 // Write a reply to the client.
 func (rp *ReplProtocol) writeResponse(reply *Packet) {
 	var err error
@@ -399,7 +548,7 @@ func (rp *ReplProtocol) writeResponse(reply *Packet) {
 	if reply.IsErrPacket() {
 		err = fmt.Errorf(reply.LogMessage(ActionWriteToClient, rp.sourceConn.RemoteAddr().String(),
 			reply.StartT, fmt.Errorf(string(reply.Data[:reply.Size]))))
-		log.LogErrorf(err.Error())
+		log.LogErrorfLimited("%v", err)
 		rp.Stop()
 	}
 
@@ -412,7 +561,7 @@ func (rp *ReplProtocol) writeResponse(reply *Packet) {
 	if err = reply.WriteToConn(rp.sourceConn); err != nil {
 		err = fmt.Errorf(reply.LogMessage(ActionWriteToClient, fmt.Sprintf("local(%v)->remote(%v)", rp.sourceConn.LocalAddr().String(),
 			rp.sourceConn.RemoteAddr().String()), reply.StartT, err))
-		log.LogErrorf(err.Error())
+		log.LogErrorfLimited("%v", err)
 		rp.Stop()
 	}
 	log.LogDebugf(reply.LogMessage(ActionWriteToClient,
@@ -438,13 +587,18 @@ func (rp *ReplProtocol) allocateFollowersConns(p *Packet, index int) (transport
 	rp.lock.RLock()
 	transport = rp.followerConnects[p.followersAddrs[index]]
 	rp.lock.RUnlock()
-	if transport == nil {
+	if transport == nil || transport.IsBroken() {
+		// a broken transport is replaced, since the replication goes on after a straggler fails in a quorum write
+		oldTransport := transport
 		transport, err = NewFollowersTransport(p.followersAddrs[index])
 		if err != nil {
 			return
 		}
 		rp.lock.Lock()
 		rp.followerConnects[p.followersAddrs[index]] = transport
+		if oldTransport != nil {
+			rp.retiredTransports = append(rp.retiredTransports, oldTransport)
+		}
 		rp.lock.Unlock()
 	}
 
@@ -506,12 +660,16 @@ func (rp *ReplProtocol) cleanResource() {
 	for _, transport := range rp.followerConnects {
 		transport.Destory()
 	}
+	for _, transport := range rp.retiredTransports {
+		transport.Destory()
+	}
 	rp.lock.RUnlock()
 	close(rp.responseCh)
 	close(rp.toBeProcessedCh)
 	close(rp.ackCh)
 	rp.packetList = nil
 	rp.followerConnects = nil
+	rp.retiredTransports = nil
 	rp.packetListLock.Unlock()
 }
 
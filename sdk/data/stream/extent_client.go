@@ -32,6 +32,8 @@ type AppendExtentKeyFunc func(inode uint64, key proto.ExtentKey) error
 type GetExtentsFunc func(inode uint64) (uint64, uint64, []proto.ExtentKey, error)
 type TruncateFunc func(inode, size uint64) error
 type EvictIcacheFunc func(inode uint64)
+type DedupRegisterFunc func(inode uint64, blocks []proto.DedupBlock) error
+type DedupReferenceFunc func(inode uint64, fingerprint []byte, fileOffset uint64) (proto.ExtentKey, error)
 
 const (
 	MaxMountRetryLimit = 5
@@ -81,12 +83,19 @@ type ExtentConfig struct {
 	Masters           []string
 	FollowerRead      bool
 	NearRead          bool
+	ZoneName          string
 	ReadRate          int64
 	WriteRate         int64
+	HedgeReadBudget   int64  // the percent of the reads from the followers which can be hedged, 0 to disable hedging
+	DelegatedToken    string // the delegated token attached to the packets, if the volume is mounted with one
+	VerifyRead        bool   // fail the reads of the deleted data, if the volume is read as of a past time
 	OnAppendExtentKey AppendExtentKeyFunc
 	OnGetExtents      GetExtentsFunc
 	OnTruncate        TruncateFunc
 	OnEvictIcache     EvictIcacheFunc
+	// The blocks written are deduplicated if the functions are set, and the files can only be appended.
+	OnDedupRegister  DedupRegisterFunc
+	OnDedupReference DedupReferenceFunc
 }
 
 // ExtentClient defines the struct of the extent client.
@@ -102,6 +111,13 @@ type ExtentClient struct {
 	getExtents      GetExtentsFunc
 	truncate        TruncateFunc
 	evictIcache     EvictIcacheFunc //May be null, must check before using
+	dedupRegister   DedupRegisterFunc
+	dedupReference  DedupReferenceFunc
+
+	disableVectorRead int32 // set if the data nodes do not support vectored read
+
+	shadow         *ExtentClient // the extent client of the shadow volume, nil if there is none
+	shadowFailures uint64
 }
 
 // NewExtentClient returns a new extent client.
@@ -126,8 +142,14 @@ retry:
 	client.getExtents = config.OnGetExtents
 	client.truncate = config.OnTruncate
 	client.evictIcache = config.OnEvictIcache
+	client.dedupRegister = config.OnDedupRegister
+	client.dedupReference = config.OnDedupReference
 	client.dataWrapper.InitFollowerRead(config.FollowerRead)
 	client.dataWrapper.SetNearRead(config.NearRead)
+	client.dataWrapper.SetZoneName(config.ZoneName)
+	client.dataWrapper.SetReadHedgeBudget(config.HedgeReadBudget)
+	client.dataWrapper.SetDelegatedToken(config.DelegatedToken)
+	client.dataWrapper.SetVerifyRead(config.VerifyRead)
 
 	var readLimit, writeLimit rate.Limit
 	if config.ReadRate <= 0 {
@@ -149,6 +171,9 @@ retry:
 
 // Open request shall grab the lock until request is sent to the request channel
 func (client *ExtentClient) OpenStream(inode uint64) error {
+	client.mirrorToShadow("OpenStream", inode, func(shadow *ExtentClient) error {
+		return shadow.OpenStream(inode)
+	})
 	client.streamerLock.Lock()
 	s, ok := client.streamers[inode]
 	if !ok {
@@ -160,6 +185,9 @@ func (client *ExtentClient) OpenStream(inode uint64) error {
 
 // Release request shall grab the lock until request is sent to the request channel
 func (client *ExtentClient) CloseStream(inode uint64) error {
+	client.mirrorToShadow("CloseStream", inode, func(shadow *ExtentClient) error {
+		return shadow.CloseStream(inode)
+	})
 	client.streamerLock.Lock()
 	s, ok := client.streamers[inode]
 	if !ok {
@@ -171,6 +199,9 @@ func (client *ExtentClient) CloseStream(inode uint64) error {
 
 // Evict request shall grab the lock until request is sent to the request channel
 func (client *ExtentClient) EvictStream(inode uint64) error {
+	client.mirrorToShadow("EvictStream", inode, func(shadow *ExtentClient) error {
+		return shadow.EvictStream(inode)
+	})
 	client.streamerLock.Lock()
 	s, ok := client.streamers[inode]
 	if !ok {
@@ -234,7 +265,12 @@ func (client *ExtentClient) Write(inode uint64, offset int, data []byte, flags i
 		err = errors.Trace(err, prefix)
 		log.LogError(errors.Stack(err))
 		exporter.Warning(err.Error())
+		return
 	}
+	client.mirrorToShadow("Write", inode, func(shadow *ExtentClient) error {
+		_, e := shadow.Write(inode, offset, data[:write], flags)
+		return e
+	})
 	return
 }
 
@@ -249,8 +285,12 @@ func (client *ExtentClient) Truncate(inode uint64, size int) error {
 	if err != nil {
 		err = errors.Trace(err, prefix)
 		log.LogError(errors.Stack(err))
+		return err
 	}
-	return err
+	client.mirrorToShadow("Truncate", inode, func(shadow *ExtentClient) error {
+		return shadow.Truncate(inode, size)
+	})
+	return nil
 }
 
 func (client *ExtentClient) Flush(inode uint64) error {
@@ -258,7 +298,13 @@ func (client *ExtentClient) Flush(inode uint64) error {
 	if s == nil {
 		return fmt.Errorf("Flush: stream is not opened yet, ino(%v)", inode)
 	}
-	return s.IssueFlushRequest()
+	if err := s.IssueFlushRequest(); err != nil {
+		return err
+	}
+	client.mirrorToShadow("Flush", inode, func(shadow *ExtentClient) error {
+		return shadow.Flush(inode)
+	})
+	return nil
 }
 
 func (client *ExtentClient) Read(inode uint64, data []byte, offset int, size int) (read int, err error) {
@@ -285,6 +331,32 @@ func (client *ExtentClient) Read(inode uint64, data []byte, offset int, size int
 	return
 }
 
+// ReadV reads the consecutive range of the file starting at the offset into the buffers in order, like preadv.
+// The ranges on the same extent are read with a single vectored read if possible.
+func (client *ExtentClient) ReadV(inode uint64, bufs [][]byte, offset int) (read int, err error) {
+	if len(bufs) == 0 {
+		return
+	}
+
+	s := client.GetStreamer(inode)
+	if s == nil {
+		err = fmt.Errorf("ReadV: stream is not opened yet, ino(%v) offset(%v)", inode, offset)
+		return
+	}
+
+	s.once.Do(func() {
+		s.GetExtents()
+	})
+
+	err = s.IssueFlushRequest()
+	if err != nil {
+		return
+	}
+
+	read, err = s.readv(bufs, offset)
+	return
+}
+
 // GetStreamer returns the streamer.
 func (client *ExtentClient) GetStreamer(inode uint64) *Streamer {
 	client.streamerLock.Lock()
@@ -338,5 +410,8 @@ func (client *ExtentClient) Close() error {
 		_ = client.EvictStream(inode)
 	}
 	client.dataWrapper.Stop()
+	if client.shadow != nil {
+		client.shadow.Close()
+	}
 	return nil
 }
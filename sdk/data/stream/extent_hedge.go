@@ -0,0 +1,110 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"time"
+
+	"github.com/chubaofs/chubaofs/sdk/data/wrapper"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	MetricReadHedged        = "readHedged"
+	MetricReadHedgeWon      = "readHedgeWon"
+	MetricReadHedgeSkipped  = "readHedgeSkipped"
+	readHedgeStatsLogPeriod = 10000 // log the stats of the hedger every the number of the hedged reads
+)
+
+type hedgedReadResult struct {
+	data      []byte
+	readBytes int
+	addr      string
+	err       error
+	isHedge   bool
+}
+
+// NewHedgeStreamConn returns a stream connection to the preferred available replica of the data partition other
+// than the excluded one, or nil if there is no such replica.
+func NewHedgeStreamConn(dp *wrapper.DataPartition, exclude string) *StreamConn {
+	for _, addr := range sortByStatus(dp, false) {
+		if addr != exclude {
+			return &StreamConn{dp: dp, currAddr: addr}
+		}
+	}
+	return nil
+}
+
+// hedgedRead reads the extent request from a follower, and issues the same read to another replica if it has not
+// returned within the delay of the hedger. The first successful reply is taken, and the other read is left to finish
+// in the background. Since the loser may still be reading when the winner returns, both read into their own buffers,
+// which costs a copy of the data. The address of the replica which served the read is returned as well.
+func (reader *ExtentReader) hedgedRead(req *ExtentRequest, hedger *wrapper.ReadHedger) (readBytes int, addr string, err error) {
+	start := time.Now()
+	results := make(chan *hedgedReadResult, 2)
+	issue := func(sc *StreamConn, isHedge bool) {
+		data := make([]byte, req.Size)
+		n, e := reader.read(req, sc, data)
+		if !isHedge && e == nil {
+			hedger.Observe(time.Since(start))
+		}
+		results <- &hedgedReadResult{data: data, readBytes: n, addr: sc.currAddr, err: e, isHedge: isHedge}
+	}
+
+	primary := NewStreamConn(reader.dp, true)
+	primaryAddr := primary.currAddr
+	go issue(primary, false)
+	pending := 1
+
+	timer := time.NewTimer(hedger.Begin())
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-results:
+			pending--
+			if res.err != nil && pending > 0 {
+				log.LogWarnf("hedgedRead: ino(%v) req(%v) isHedge(%v) err(%v), wait for the other read",
+					reader.inode, req, res.isHedge, res.err)
+				continue
+			}
+			if res.err == nil {
+				readBytes = copy(req.Data, res.data[:res.readBytes])
+				if res.isHedge {
+					hedger.Win()
+					exporter.NewCounter(MetricReadHedgeWon).Add(1)
+				}
+			}
+			return readBytes, res.addr, res.err
+		case <-timer.C:
+			hedge := NewHedgeStreamConn(reader.dp, primaryAddr)
+			if hedge == nil {
+				continue
+			}
+			if !hedger.Hedge() {
+				exporter.NewCounter(MetricReadHedgeSkipped).Add(1)
+				continue
+			}
+			exporter.NewCounter(MetricReadHedged).Add(1)
+			if stats := hedger.Stats(); stats.Hedged%readHedgeStatsLogPeriod == 0 {
+				log.LogInfof("hedgedRead: stats %+v", stats)
+			}
+			log.LogDebugf("hedgedRead: ino(%v) req(%v) addr(%v) not returned within %v, hedge to addr(%v)",
+				reader.inode, req, primaryAddr, time.Since(start), hedge.currAddr)
+			go issue(hedge, true)
+			pending++
+		}
+	}
+}
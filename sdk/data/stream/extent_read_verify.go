@@ -0,0 +1,76 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"hash/crc32"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	MetricReadVerified       = "readVerified"
+	MetricReadMismatched     = "readMismatched"
+	readVerifyStatsLogPeriod = 10000 // log the stats of the verifier every the number of the verified reads
+)
+
+// verifyReplicas reads the range just read from the served replica again from another replica, and reports the
+// mismatch of their Crcs to the master as a suspected corruption. It runs in the background on its own buffer, so
+// the read is neither delayed nor failed by the verification, and the ranges failed to be read again are skipped.
+func (reader *ExtentReader) verifyReplicas(req *ExtentRequest, readBytes int, crc uint32, servedAddr string) {
+	sc := NewHedgeStreamConn(reader.dp, servedAddr)
+	if sc == nil {
+		return
+	}
+	verifier := reader.dp.ClientWrapper.ReadVerifier()
+	exporter.NewCounter(MetricReadVerified).Add(1)
+	if stats := verifier.Stats(); stats.Verified%readVerifyStatsLogPeriod == 0 {
+		log.LogInfof("verifyReplicas: stats %+v", stats)
+	}
+	// read from the other replica as a follower, whichever the served one is
+	other := NewExtentReader(reader.inode, reader.key, reader.dp, true)
+	data := make([]byte, readBytes)
+	n, err := other.read(&ExtentRequest{FileOffset: req.FileOffset, Size: readBytes, ExtentKey: req.ExtentKey}, sc, data)
+	if err != nil || n != readBytes || sc.currAddr == servedAddr {
+		log.LogWarnf("verifyReplicas: ino(%v) req(%v) served(%v) addr(%v) readBytes(%v) err(%v), skipped",
+			reader.inode, req, servedAddr, sc.currAddr, n, err)
+		return
+	}
+	otherCrc := crc32.ChecksumIEEE(data)
+	if otherCrc == crc {
+		return
+	}
+	verifier.Mismatch()
+	exporter.NewCounter(MetricReadMismatched).Add(1)
+	report := &proto.ReadMismatchReport{
+		Inode:        reader.inode,
+		PartitionID:  reader.dp.PartitionID,
+		ExtentID:     reader.key.ExtentId,
+		ExtentOffset: uint64(req.FileOffset) - reader.key.FileOffset + reader.key.ExtentOffset,
+		Size:         uint32(readBytes),
+		Replicas: []*proto.ReplicaCrc{
+			{Addr: servedAddr, Crc: crc},
+			{Addr: sc.currAddr, Crc: otherCrc},
+		},
+	}
+	log.LogErrorf("verifyReplicas: ino(%v) extent(%v_%v) offset(%v) size(%v) crc mismatch, %v(%v) and %v(%v)",
+		reader.inode, report.PartitionID, report.ExtentID, report.ExtentOffset, report.Size, servedAddr, crc,
+		sc.currAddr, otherCrc)
+	if err = reader.dp.ClientWrapper.ReportReadMismatch(report); err != nil {
+		log.LogWarnf("verifyReplicas: ino(%v) report(%v) err(%v)", reader.inode, report, err)
+	}
+}
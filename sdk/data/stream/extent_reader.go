@@ -23,6 +23,7 @@ import (
 	"github.com/chubaofs/chubaofs/util/log"
 	"hash/crc32"
 	"net"
+	"strings"
 )
 
 // ExtentReader defines the struct of the extent reader.
@@ -49,22 +50,40 @@ func (reader *ExtentReader) String() (m string) {
 		reader.key.Marshal())
 }
 
-// Read reads the extent request.
+// Read reads the extent request, and verifies the sampled reads against another replica in the background if the
+// volume verifies the reads.
 func (reader *ExtentReader) Read(req *ExtentRequest) (readBytes int, err error) {
+	var servedAddr string
+	if hedger := reader.dp.ClientWrapper.ReadHedger(); hedger != nil && reader.followerRead && len(reader.dp.Hosts) > 1 {
+		readBytes, servedAddr, err = reader.hedgedRead(req, hedger)
+	} else {
+		sc := NewStreamConn(reader.dp, reader.followerRead)
+		readBytes, err = reader.read(req, sc, req.Data)
+		servedAddr = sc.currAddr
+	}
+	if err == nil && readBytes > 0 && len(reader.dp.Hosts) > 1 && reader.dp.ClientWrapper.ReadVerifier().Sample() {
+		go reader.verifyReplicas(req, readBytes, crc32.ChecksumIEEE(req.Data[:readBytes]), servedAddr)
+	}
+	return
+}
+
+// read reads the extent request through the stream connection into the data.
+func (reader *ExtentReader) read(req *ExtentRequest, sc *StreamConn, data []byte) (readBytes int, err error) {
 	offset := req.FileOffset - int(reader.key.FileOffset) + int(reader.key.ExtentOffset)
 	size := req.Size
 
 	reqPacket := NewReadPacket(reader.key, offset, size, reader.inode, req.FileOffset, reader.followerRead)
-	sc := NewStreamConn(reader.dp, reader.followerRead)
+	reqPacket.verifyRead(reader.dp)
 
 	log.LogDebugf("ExtentReader Read enter: size(%v) req(%v) reqPacket(%v)", size, req, reqPacket)
 
+	var badBlocks []*proto.DataBlockReport
 	err = sc.Send(reqPacket, func(conn *net.TCPConn) (error, bool) {
 		readBytes = 0
 		for readBytes < size {
 			replyPacket := NewReply(reqPacket.ReqID, reader.dp.PartitionID, reqPacket.ExtentID)
 			bufSize := util.Min(util.ReadBlockSize, size-readBytes)
-			replyPacket.Data = req.Data[readBytes : readBytes+bufSize]
+			replyPacket.Data = data[readBytes : readBytes+bufSize]
 			e := replyPacket.readFromConn(conn, proto.ReadDeadlineTime)
 			if e != nil {
 				log.LogWarnf("Extent Reader Read: failed to read from connect, ino(%v) req(%v) readBytes(%v) err(%v)", reader.inode, reqPacket, readBytes, e)
@@ -78,6 +97,29 @@ func (reader *ExtentReader) Read(req *ExtentRequest) (readBytes int, err error)
 				return nil, true
 			}
 
+			if reqPacket.Opcode == proto.OpStreamRead && replyPacket.ResultCode == proto.OpTryOtherAddr &&
+				strings.Contains(string(replyPacket.Data[:util.Min(int(replyPacket.Size), len(replyPacket.Data))]), laggingExtentMsg) {
+				// The leader has not been caught up after a quorum write, so read from the other replicas.
+				log.LogWarnf("Extent Reader Read: extent is lagging on leader, ino(%v) req(%v) addr(%v)", reader.inode, reqPacket, conn.RemoteAddr())
+				reqPacket.Opcode = proto.OpStreamFollowerRead
+				return TryOtherAddrError, false
+			}
+
+			if replyPacket.ResultCode == proto.OpCrcMismatchErr {
+				// The replica has the corrupted blocks, so read from the other replicas and report it to repair.
+				log.LogWarnf("Extent Reader Read: block crc mismatch, ino(%v) req(%v) addr(%v) offset(%v)",
+					reader.inode, reqPacket, sc.currAddr, replyPacket.ExtentOffset)
+				badBlocks = append(badBlocks, &proto.DataBlockReport{
+					PartitionID: reader.dp.PartitionID,
+					ExtentID:    reader.key.ExtentId,
+					Offset:      replyPacket.ExtentOffset,
+					Size:        uint32(util.Min(util.ReadBlockSize, size-readBytes)),
+					Addr:        sc.currAddr,
+				})
+				reqPacket.Opcode = proto.OpStreamFollowerRead
+				return TryOtherAddrError, false
+			}
+
 			e = reader.checkStreamReply(reqPacket, replyPacket)
 			if e != nil {
 				// Dont change the error message, since the caller will
@@ -92,12 +134,101 @@ func (reader *ExtentReader) Read(req *ExtentRequest) (readBytes int, err error)
 
 	if err != nil {
 		log.LogErrorf("Extent Reader Read: err(%v) req(%v) reqPacket(%v)", err, req, reqPacket)
+	} else if len(badBlocks) > 0 {
+		go reader.reportBadBlocks(badBlocks, sc.currAddr)
 	}
 
 	log.LogDebugf("ExtentReader Read exit: req(%v) reqPacket(%v) readBytes(%v) err(%v)", req, reqPacket, readBytes, err)
 	return
 }
 
+// The error message replied by the data nodes which do not support the opcode.
+const unknownOpcodeMsg = "unknown opcode"
+
+// The error message replied by the replica whose extent has not been caught up after a quorum write.
+const laggingExtentMsg = "extent is lagging"
+
+// ReadRanges reads the extent requests on the same extent with a single vectored read, which is always served by the leader.
+// The requests are either all read or failed, and it is only tried once since the caller falls back to the normal read.
+func (reader *ExtentReader) ReadRanges(reqs []*ExtentRequest) (err error) {
+	ranges := make([]proto.ReadRange, 0, len(reqs))
+	for _, req := range reqs {
+		ranges = append(ranges, proto.ReadRange{
+			Offset: int64(req.FileOffset - int(req.ExtentKey.FileOffset) + int(req.ExtentKey.ExtentOffset)),
+			Size:   uint32(req.Size),
+		})
+	}
+
+	reqPacket := NewVectorReadPacket(reader.key, ranges, reader.inode, reqs[0].FileOffset)
+	reqPacket.verifyRead(reader.dp)
+	sc := NewStreamConn(reader.dp, false)
+
+	log.LogDebugf("ExtentReader ReadRanges enter: ranges(%v) reqPacket(%v)", ranges, reqPacket)
+
+	err = sc.sendToPartition(reqPacket, func(conn *net.TCPConn) (error, bool) {
+		for i, req := range reqs {
+			readBytes := 0
+			for readBytes < req.Size {
+				replyPacket := NewReply(reqPacket.ReqID, reader.dp.PartitionID, reqPacket.ExtentID)
+				bufSize := util.Min(util.ReadBlockSize, req.Size-readBytes)
+				replyPacket.Data = req.Data[readBytes : readBytes+bufSize]
+				e := replyPacket.readFromConn(conn, proto.ReadDeadlineTime)
+				if e != nil {
+					log.LogWarnf("Extent Reader ReadRanges: failed to read from connect, ino(%v) req(%v) range(%v) readBytes(%v) err(%v)",
+						reader.inode, reqPacket, ranges[i], readBytes, e)
+					return TryOtherAddrError, false
+				}
+
+				if replyPacket.ResultCode == proto.OpAgain {
+					return nil, true
+				}
+
+				if replyPacket.ResultCode != proto.OpOk &&
+					strings.Contains(string(replyPacket.Data[:util.Min(int(replyPacket.Size), len(replyPacket.Data))]), unknownOpcodeMsg) {
+					return VectorReadNotSupportedError, false
+				}
+				if e = reader.checkStreamReply(reqPacket, replyPacket); e != nil {
+					return e, false
+				}
+				if replyPacket.ExtentOffset != ranges[i].Offset+int64(readBytes) {
+					return errors.New(fmt.Sprintf("ReadRanges: inconsistent offset, range(%v) readBytes(%v) reply(%v)",
+						ranges[i], readBytes, replyPacket)), false
+				}
+
+				readBytes += int(replyPacket.Size)
+			}
+		}
+		return nil, false
+	})
+
+	if err != nil {
+		log.LogErrorf("Extent Reader ReadRanges: err(%v) reqPacket(%v)", err, reqPacket)
+	}
+
+	log.LogDebugf("ExtentReader ReadRanges exit: reqPacket(%v) err(%v)", reqPacket, err)
+	return
+}
+
+// reportBadBlocks reports the blocks failed to be read for the Crc mismatch to the master, which repairs them with
+// the data of the replica which served the read.
+func (reader *ExtentReader) reportBadBlocks(badBlocks []*proto.DataBlockReport, source string) {
+	reported := make(map[string]bool)
+	for _, report := range badBlocks {
+		key := fmt.Sprintf("%v_%v", report.Addr, report.Offset)
+		if reported[key] || report.Addr == source {
+			continue
+		}
+		reported[key] = true
+		report.SourceAddr = source
+		if err := reader.dp.ClientWrapper.ReportBadBlock(report); err != nil {
+			log.LogWarnf("reportBadBlocks: ino(%v) report(%v) err(%v)", reader.inode, report, err)
+			continue
+		}
+		log.LogWarnf("reportBadBlocks: ino(%v) extent(%v_%v) offset(%v) size(%v) addr(%v) source(%v)", reader.inode,
+			report.PartitionID, report.ExtentID, report.Offset, report.Size, report.Addr, report.SourceAddr)
+	}
+}
+
 func (reader *ExtentReader) checkStreamReply(request *Packet, reply *Packet) (err error) {
 	if reply.ResultCode == proto.OpTryOtherAddr {
 		return TryOtherAddrError
@@ -109,7 +240,7 @@ func (reader *ExtentReader) checkStreamReply(request *Packet, reply *Packet) (er
 				"req(%v) reply(%v)", reply.GetResultMsg(), request, reply)
 			return TryOtherAddrError
 		}
-		err = errors.New(fmt.Sprintf("checkStreamReply: ResultCode(%v) NOK", reply.GetResultMsg()))
+		err = proto.NewResultCodeError(reply.ResultCode, fmt.Sprintf("checkStreamReply: NOK, msg(%v)", reply.GetResultMsg()))
 		return
 	}
 	if !request.isValidReadReply(reply) {
@@ -121,5 +252,9 @@ func (reader *ExtentReader) checkStreamReply(request *Packet, reply *Packet) (er
 		err = errors.New(fmt.Sprintf("checkStreamReply: inconsistent CRC, expectCRC(%v) replyCRC(%v)", expectCrc, reply.CRC))
 		return
 	}
+	if reply.IsDegradedReply() {
+		log.LogWarnf("checkStreamReply: possibly stale data read from degraded partition, ino(%v) req(%v) reply(%v)",
+			reader.inode, request, reply)
+	}
 	return nil
 }
@@ -0,0 +1,49 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"sync/atomic"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// SetShadow sets the extent client of the shadow volume, to which the writes are mirrored synchronously while the
+// shadow is not serving the volume. The shadow client must be set before any stream is opened.
+func (client *ExtentClient) SetShadow(shadow *ExtentClient) {
+	client.shadow = shadow
+}
+
+// ShadowFailures returns the number of the writes failed to be mirrored to the shadow volume, which tells the master
+// the shadow is out of sync.
+func (client *ExtentClient) ShadowFailures() uint64 {
+	return atomic.LoadUint64(&client.shadowFailures)
+}
+
+func (client *ExtentClient) shadowMirrors() bool {
+	return client.shadow != nil && client.dataWrapper.ShadowMirrors()
+}
+
+// mirrorToShadow runs the operation on the shadow client if the writes are mirrored. A failure does not fail the
+// operation on the primary volume, it is counted and reported instead.
+func (client *ExtentClient) mirrorToShadow(op string, inode uint64, fn func(shadow *ExtentClient) error) {
+	if !client.shadowMirrors() {
+		return
+	}
+	if err := fn(client.shadow); err != nil {
+		atomic.AddUint64(&client.shadowFailures, 1)
+		log.LogWarnf("mirrorToShadow: %v ino(%v) err(%v)", op, inode, err)
+	}
+}
@@ -16,6 +16,7 @@ package stream
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/sdk/data/wrapper"
@@ -95,6 +96,23 @@ func NewReadPacket(key *proto.ExtentKey, extentOffset, size int, inode uint64, f
 	return p
 }
 
+// NewVectorReadPacket returns a new packet to read multiple ranges of the same extent.
+func NewVectorReadPacket(key *proto.ExtentKey, ranges []proto.ReadRange, inode uint64, fileOffset int) *Packet {
+	p := new(Packet)
+	p.ExtentID = key.ExtentId
+	p.PartitionID = key.PartitionId
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpStreamVectorRead
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+	p.RemainingFollowers = 0
+	p.inode = inode
+	p.KernelOffset = uint64(fileOffset)
+	p.Data = proto.MarshalReadRanges(ranges)
+	p.Size = uint32(len(p.Data))
+	return p
+}
+
 // NewCreateExtentPacket returns a new packet to create extent.
 func NewCreateExtentPacket(dp *wrapper.DataPartition, inode uint64) *Packet {
 	p := new(Packet)
@@ -103,6 +121,7 @@ func NewCreateExtentPacket(dp *wrapper.DataPartition, inode uint64) *Packet {
 	p.ExtentType = proto.NormalExtentType
 	p.Arg = ([]byte)(dp.GetAllAddrs())
 	p.ArgLen = uint32(len(p.Arg))
+	p.attachDelegatedToken(dp)
 	p.RemainingFollowers = uint8(len(dp.Hosts) - 1)
 	p.ReqID = proto.GenerateRequestID()
 	p.Opcode = proto.OpCreateExtent
@@ -137,6 +156,26 @@ func (p *Packet) isValidReadReply(q *Packet) bool {
 	return false
 }
 
+// attachDelegatedToken attaches the delegated token of the client to the packet, if the volume is mounted with one.
+func (p *Packet) attachDelegatedToken(dp *wrapper.DataPartition) {
+	if dp == nil || dp.ClientWrapper == nil || dp.ClientWrapper.DelegatedToken() == "" {
+		return
+	}
+	if _, token := proto.DetachDelegatedToken(p.Arg[:p.ArgLen]); token != "" {
+		return
+	}
+	p.Arg = proto.AttachDelegatedToken(p.Arg[:p.ArgLen], dp.ClientWrapper.DelegatedToken())
+	p.ArgLen = uint32(len(p.Arg))
+}
+
+// verifyRead makes the data node verify the data read is not deleted, if the client reads by the historical extent
+// keys. The data nodes not supporting it refuse the read.
+func (p *Packet) verifyRead(dp *wrapper.DataPartition) {
+	if dp != nil && dp.ClientWrapper != nil && dp.ClientWrapper.VerifyRead() {
+		p.ExtentType = proto.VerifiedReadExtentType
+	}
+}
+
 func (p *Packet) writeToConn(conn net.Conn) error {
 	p.CRC = crc32.ChecksumIEEE(p.Data[:p.Size])
 	return p.WriteToConn(conn)
@@ -181,3 +220,18 @@ func readToBuffer(c net.Conn, buf *[]byte, readSize int) (err error) {
 	_, err = io.ReadFull(c, (*buf)[:readSize])
 	return
 }
+
+// NewVerifyExtentPacket returns a new packet to get the CRC of the range of the extent on a replica.
+func NewVerifyExtentPacket(key *proto.ExtentKey) *Packet {
+	p := new(Packet)
+	p.ExtentID = key.ExtentId
+	p.PartitionID = key.PartitionId
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpVerifyExtent
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+	p.RemainingFollowers = 0
+	p.Data, _ = json.Marshal(&proto.ExtentVerifyRequest{Offset: key.ExtentOffset, Size: key.Size})
+	p.Size = uint32(len(p.Data))
+	return p
+}
@@ -27,7 +27,8 @@ import (
 )
 
 var (
-	TryOtherAddrError = errors.New("TryOtherAddrError")
+	TryOtherAddrError           = errors.New("TryOtherAddrError")
+	VectorReadNotSupportedError = errors.New("VectorReadNotSupportedError")
 )
 
 const (
@@ -56,7 +57,7 @@ func NewStreamConn(dp *wrapper.DataPartition, follower bool) *StreamConn {
 		}
 	}
 
-	if dp.ClientWrapper.NearRead() {
+	if dp.ClientWrapper.ReadNearHosts() {
 		return &StreamConn{
 			dp:       dp,
 			currAddr: getNearestHost(dp),
@@ -140,6 +141,7 @@ func (sc *StreamConn) sendToPartition(req *Packet, getReply GetReplyFunc) (err e
 }
 
 func (sc *StreamConn) sendToConn(conn *net.TCPConn, req *Packet, getReply GetReplyFunc) (err error) {
+	req.attachDelegatedToken(sc.dp)
 	for i := 0; i < StreamSendMaxRetry; i++ {
 		log.LogDebugf("sendToConn: send to addr(%v), reqPacket(%v)", sc.currAddr, req)
 		err = req.WriteToConn(conn)
@@ -173,7 +175,7 @@ func sortByStatus(dp *wrapper.DataPartition, selectAll bool) (hosts []string) {
 	var failedHosts []string
 	hostsStatus := dp.ClientWrapper.HostsStatus
 	var dpHosts []string
-	if dp.ClientWrapper.FollowerRead() && dp.ClientWrapper.NearRead() {
+	if dp.ClientWrapper.FollowerRead() && dp.ClientWrapper.ReadNearHosts() {
 		dpHosts = dp.NearHosts
 	} else {
 		dpHosts = dp.Hosts
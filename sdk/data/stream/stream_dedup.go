@@ -0,0 +1,81 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"crypto/sha256"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// MaxDedupPendingBlocks is the max number of the written blocks waiting to be registered, beyond which the streamer
+// flushes the data and registers the blocks.
+const MaxDedupPendingBlocks = 1024
+
+func (client *ExtentClient) dedupEnabled() bool {
+	return client.dedupRegister != nil && client.dedupReference != nil
+}
+
+// doDedupWrite writes the data like doWrite, except that the full blocks stored in the normal extents are looked up
+// in the dedup index of the meta partition by their fingerprints, and the indexed blocks are appended to the file as
+// references instead of being written again. The blocks written are registered to the index after being flushed.
+func (s *Streamer) doDedupWrite(data []byte, offset, size int, direct bool) (total int, err error) {
+	for total < size {
+		pos := offset + total
+		n := util.Min(size-total, util.BlockSize-pos%util.BlockSize)
+		block := data[total : total+n]
+		if n < util.BlockSize || pos < s.tinySizeLimit() {
+			if _, err = s.doWrite(block, pos, n, direct); err != nil {
+				return
+			}
+			total += n
+			continue
+		}
+
+		fingerprint := sha256.Sum256(block)
+		if ek, e := s.client.dedupReference(s.inode, fingerprint[:], uint64(pos)); e == nil {
+			log.LogDebugf("doDedupWrite: ino(%v) offset(%v) deduplicated ek(%v)", s.inode, pos, ek)
+			s.extents.Append(&ek, true)
+			total += n
+			continue
+		}
+		if _, err = s.doWrite(block, pos, n, direct); err != nil {
+			return
+		}
+		total += n
+		s.dedupBlocks = append(s.dedupBlocks, proto.DedupBlock{
+			Fingerprint: fingerprint[:],
+			FileOffset:  uint64(pos),
+			Size:        uint32(n),
+		})
+		if len(s.dedupBlocks) >= MaxDedupPendingBlocks {
+			if err = s.flush(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// registerDedupBlocks registers the blocks written, whose extent keys have been flushed to the meta partition.
+// Failing to register the blocks only misses the chance of deduplicating them.
+func (s *Streamer) registerDedupBlocks() {
+	if err := s.client.dedupRegister(s.inode, s.dedupBlocks); err != nil {
+		log.LogWarnf("registerDedupBlocks: ino(%v) blocks(%v) err(%v)", s.inode, len(s.dedupBlocks), err)
+	}
+	s.dedupBlocks = nil
+}
@@ -19,6 +19,7 @@ import (
 	"golang.org/x/net/context"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -44,6 +45,8 @@ type Streamer struct {
 	dirtylist *DirtyExtentList // dirty handlers
 	dirty     bool             // whether current open handler is in the dirty list
 
+	dedupBlocks []proto.DedupBlock // blocks written but not registered for dedup yet
+
 	request chan interface{} // request channel, write/flush/close
 	done    chan struct{}    // stream writer is being closed
 
@@ -85,16 +88,39 @@ func (s *Streamer) GetExtentReader(ek *proto.ExtentKey) (*ExtentReader, error) {
 }
 
 func (s *Streamer) read(data []byte, offset int, size int) (total int, err error) {
-	var (
-		readBytes       int
-		reader          *ExtentReader
-		requests        []*ExtentRequest
-		revisedRequests []*ExtentRequest
-	)
+	ctx := context.Background()
+	s.client.readLimiter.Wait(ctx)
 
+	requests, err := s.prepareReadRequests(offset, size, data)
+	if err != nil {
+		return 0, err
+	}
+	return s.readRequests(requests)
+}
+
+// readv reads the consecutive range of the file starting at the offset into the buffers in order, like preadv.
+func (s *Streamer) readv(bufs [][]byte, offset int) (total int, err error) {
 	ctx := context.Background()
 	s.client.readLimiter.Wait(ctx)
 
+	var requests []*ExtentRequest
+	for _, buf := range bufs {
+		if len(buf) == 0 {
+			continue
+		}
+		var reqs []*ExtentRequest
+		if reqs, err = s.prepareReadRequests(offset, len(buf), buf); err != nil {
+			return 0, err
+		}
+		requests = append(requests, reqs...)
+		offset += len(buf)
+	}
+	return s.readRequests(requests)
+}
+
+func (s *Streamer) prepareReadRequests(offset int, size int, data []byte) (requests []*ExtentRequest, err error) {
+	var revisedRequests []*ExtentRequest
+
 	requests = s.extents.PrepareReadRequests(offset, size, data)
 	for _, req := range requests {
 		if req.ExtentKey == nil {
@@ -104,7 +130,7 @@ func (s *Streamer) read(data []byte, offset int, size int) (total int, err error
 			s.writeLock.Lock()
 			if err = s.IssueFlushRequest(); err != nil {
 				s.writeLock.Unlock()
-				return 0, err
+				return nil, err
 			}
 			revisedRequests = s.extents.PrepareReadRequests(offset, size, data)
 			s.writeLock.Unlock()
@@ -115,6 +141,16 @@ func (s *Streamer) read(data []byte, offset int, size int) (total int, err error
 	if revisedRequests != nil {
 		requests = revisedRequests
 	}
+	return
+}
+
+func (s *Streamer) readRequests(requests []*ExtentRequest) (total int, err error) {
+	var (
+		readBytes int
+		reader    *ExtentReader
+	)
+
+	served := s.readVectored(requests)
 
 	filesize, _ := s.extents.Size()
 	log.LogDebugf("read: ino(%v) requests(%v) filesize(%v)", s.inode, requests, filesize)
@@ -140,6 +176,9 @@ func (s *Streamer) read(data []byte, offset int, size int) (total int, err error
 			// Reading a hole, just fill zero
 			total += req.Size
 			log.LogDebugf("Stream read hole: ino(%v) req(%v) total(%v)", s.inode, req, total)
+		} else if served[req] {
+			total += req.Size
+			log.LogDebugf("Stream read vectored: ino(%v) req(%v) total(%v)", s.inode, req, total)
 		} else {
 			reader, err = s.GetExtentReader(req.ExtentKey)
 			if err != nil {
@@ -158,3 +197,63 @@ func (s *Streamer) read(data []byte, offset int, size int) (total int, err error
 	}
 	return
 }
+
+// readVectored reads the requests on the same extent with vectored reads, and returns the served requests.
+// The requests not served, e.g. the vectored read fails, are left to the normal read.
+func (s *Streamer) readVectored(requests []*ExtentRequest) (served map[*ExtentRequest]bool) {
+	if atomic.LoadInt32(&s.client.disableVectorRead) != 0 || s.client.dataWrapper.FollowerRead() {
+		return
+	}
+
+	type extentID struct {
+		partitionID uint64
+		extentID    uint64
+	}
+	groups := make(map[extentID][]*ExtentRequest)
+	order := make([]extentID, 0)
+	for _, req := range requests {
+		if req.ExtentKey == nil {
+			continue
+		}
+		id := extentID{partitionID: req.ExtentKey.PartitionId, extentID: req.ExtentKey.ExtentId}
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], req)
+	}
+
+	for _, id := range order {
+		reqs := groups[id]
+		for len(reqs) > 1 {
+			n, size := 0, 0
+			for n < len(reqs) && n < proto.MaxReadRanges && size+reqs[n].Size <= proto.MaxReadRangeSize {
+				size += reqs[n].Size
+				n++
+			}
+			if n < 2 {
+				break
+			}
+			batch := reqs[:n]
+			reqs = reqs[n:]
+			reader, err := s.GetExtentReader(batch[0].ExtentKey)
+			if err != nil {
+				break
+			}
+			if err = reader.ReadRanges(batch); err != nil {
+				if err == VectorReadNotSupportedError {
+					log.LogWarnf("readVectored: vectored read is not supported by data nodes, disabled, ino(%v)", s.inode)
+					atomic.StoreInt32(&s.client.disableVectorRead, 1)
+					return
+				}
+				continue
+			}
+			if served == nil {
+				served = make(map[*ExtentRequest]bool)
+			}
+			for _, req := range batch {
+				served[req] = true
+			}
+		}
+	}
+	return
+}
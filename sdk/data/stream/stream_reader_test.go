@@ -0,0 +1,57 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestReadvHoles(t *testing.T) {
+	// the vectored reads of the extents are skipped, so only the holes are read
+	client := &ExtentClient{readLimiter: rate.NewLimiter(rate.Inf, 1), disableVectorRead: 1}
+	s := &Streamer{client: client, inode: 1, extents: NewExtentCache(1)}
+	s.extents.SetSize(100, true)
+
+	fill := func(bufs ...[]byte) [][]byte {
+		for _, buf := range bufs {
+			for i := range buf {
+				buf[i] = 0xff
+			}
+		}
+		return bufs
+	}
+	bufs := fill(make([]byte, 30), make([]byte, 0), make([]byte, 40))
+	total, err := s.readv(bufs, 10)
+	if err != nil || total != 70 {
+		t.Fatalf("expect 70 bytes read within the size, but read %v err %v", total, err)
+	}
+	for i, buf := range bufs {
+		if !bytes.Equal(buf, make([]byte, len(buf))) {
+			t.Fatalf("the buffer %v is not filled with the hole", i)
+		}
+	}
+
+	bufs = fill(make([]byte, 30), make([]byte, 30))
+	if total, err = s.readv(bufs, 60); err != io.EOF || total != 40 {
+		t.Fatalf("expect 40 bytes read till the size with EOF, but read %v err %v", total, err)
+	}
+	if !bytes.Equal(bufs[1][:10], make([]byte, 10)) {
+		t.Fatalf("the second buffer is not filled till the size")
+	}
+}
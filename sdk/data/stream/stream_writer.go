@@ -279,6 +279,17 @@ func (s *Streamer) write(data []byte, offset, size, flags int) (total int, err e
 	requests := s.extents.PrepareWriteRequests(offset, size, data)
 	log.LogDebugf("Streamer write: ino(%v) prepared requests(%v)", s.inode, requests)
 
+	// The blocks may be shared by the other files if the volume deduplicates the blocks, so the data can not be
+	// overwritten.
+	if s.client.dedupEnabled() {
+		for _, req := range requests {
+			if req.ExtentKey != nil {
+				log.LogWarnf("Streamer write: overwrite not permitted with dedup, ino(%v) offset(%v) size(%v)", s.inode, offset, size)
+				return 0, syscall.EPERM
+			}
+		}
+	}
+
 	// Must flush before doing overwrite
 	for _, req := range requests {
 		if req.ExtentKey == nil {
@@ -297,6 +308,8 @@ func (s *Streamer) write(data []byte, offset, size, flags int) (total int, err e
 		var writeSize int
 		if req.ExtentKey != nil {
 			writeSize, err = s.doOverwrite(req, direct)
+		} else if s.client.dedupEnabled() {
+			writeSize, err = s.doDedupWrite(req.Data, req.FileOffset, req.Size, direct)
 		} else {
 			writeSize, err = s.doWrite(req.Data, req.FileOffset, req.Size, direct)
 		}
@@ -461,6 +474,9 @@ func (s *Streamer) flush() (err error) {
 		}
 		log.LogDebugf("Streamer flush end: eh(%v)", eh)
 	}
+	if len(s.dedupBlocks) > 0 {
+		s.registerDedupBlocks()
+	}
 	return
 }
 
@@ -0,0 +1,154 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// VerifyFile checks the replicas of the extents of the file: every replica holds the range of the extent used by
+// the file, and the CRCs of the range agree among the replicas. Only the partitions of the file are visited.
+func (client *ExtentClient) VerifyFile(inode uint64) (report *proto.FileVerifyReport, err error) {
+	start := time.Now()
+	gen, size, eks, err := client.getExtents(inode)
+	if err != nil {
+		return
+	}
+	report = &proto.FileVerifyReport{
+		Inode:      inode,
+		Generation: gen,
+		Size:       size,
+		Extents:    len(eks),
+		Details:    make([]*proto.ExtentVerifyResult, 0),
+	}
+	for i := range eks {
+		result := client.verifyExtent(&eks[i])
+		if len(result.Problems) == 0 {
+			continue
+		}
+		report.BadExtents++
+		if len(report.Details) < proto.MaxVerifyReportExtents {
+			report.Details = append(report.Details, result)
+		} else {
+			report.Truncated = true
+		}
+	}
+	report.Healthy = report.BadExtents == 0
+	report.ElapsedTime = time.Since(start).String()
+	log.LogInfof("VerifyFile: ino(%v) gen(%v) extents(%v) bad(%v) elapsed(%v)",
+		inode, gen, report.Extents, report.BadExtents, report.ElapsedTime)
+	return
+}
+
+func (client *ExtentClient) verifyExtent(ek *proto.ExtentKey) (result *proto.ExtentVerifyResult) {
+	result = &proto.ExtentVerifyResult{
+		PartitionID:  ek.PartitionId,
+		ExtentID:     ek.ExtentId,
+		FileOffset:   ek.FileOffset,
+		ExtentOffset: ek.ExtentOffset,
+		Size:         ek.Size,
+		Problems:     make([]string, 0),
+		Replicas:     make([]*proto.ReplicaVerifyResult, 0),
+	}
+	dp, err := client.dataWrapper.GetDataPartition(ek.PartitionId)
+	if err != nil {
+		result.Problems = append(result.Problems, proto.VerifyProblemNoPartition)
+		return
+	}
+	resps := make([]*proto.ExtentVerifyResponse, len(dp.Hosts))
+	errs := make([]error, len(dp.Hosts))
+	var wg sync.WaitGroup
+	for i, host := range dp.Hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			resps[i], errs[i] = verifyExtentOnHost(host, ek)
+		}(i, host)
+	}
+	wg.Wait()
+	checkReplicas(result, ek, dp.Hosts, resps, errs)
+	return
+}
+
+// checkReplicas records the state of the extent on each replica, and the problems found among them.
+func checkReplicas(result *proto.ExtentVerifyResult, ek *proto.ExtentKey, hosts []string,
+	resps []*proto.ExtentVerifyResponse, errs []error) {
+	addProblem := func(problem string) {
+		for _, p := range result.Problems {
+			if p == problem {
+				return
+			}
+		}
+		result.Problems = append(result.Problems, problem)
+	}
+	var crc *uint32
+	for i, host := range hosts {
+		replica := &proto.ReplicaVerifyResult{Addr: host}
+		result.Replicas = append(result.Replicas, replica)
+		resp := resps[i]
+		switch {
+		case errs[i] != nil:
+			replica.Err = errs[i].Error()
+			addProblem(proto.VerifyProblemUnreachable)
+			continue
+		case !resp.Exists || resp.Deleted:
+			replica.Err = "extent does not exist"
+			addProblem(proto.VerifyProblemMissing)
+			continue
+		}
+		replica.ExtentSize = resp.ExtentSize
+		if !resp.Complete {
+			replica.Err = fmt.Sprintf("extent size %v is less than %v", resp.ExtentSize, ek.ExtentOffset+uint64(ek.Size))
+			addProblem(proto.VerifyProblemShort)
+			continue
+		}
+		replica.Crc = resp.Crc
+		if crc == nil {
+			crc = &resp.Crc
+		} else if *crc != resp.Crc {
+			addProblem(proto.VerifyProblemCrcMismatch)
+		}
+	}
+}
+
+func verifyExtentOnHost(host string, ek *proto.ExtentKey) (resp *proto.ExtentVerifyResponse, err error) {
+	conn, err := StreamConnPool.GetConnect(host)
+	if err != nil {
+		return
+	}
+	defer func() {
+		StreamConnPool.PutConnect(conn, err != nil)
+	}()
+	p := NewVerifyExtentPacket(ek)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = fmt.Errorf("%v", p.GetResultMsg())
+		return
+	}
+	resp = new(proto.ExtentVerifyResponse)
+	err = json.Unmarshal(p.Data[:p.Size], resp)
+	return
+}
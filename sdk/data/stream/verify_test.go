@@ -0,0 +1,86 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestCheckReplicas(t *testing.T) {
+	ek := &proto.ExtentKey{PartitionId: 1, ExtentId: 1025, ExtentOffset: 100, Size: 200}
+	hosts := []string{"a", "b", "c"}
+	healthy := func(crc uint32) *proto.ExtentVerifyResponse {
+		return &proto.ExtentVerifyResponse{Exists: true, ExtentSize: 4096, Complete: true, Crc: crc}
+	}
+	cases := []struct {
+		name     string
+		resps    []*proto.ExtentVerifyResponse
+		errs     []error
+		problems []string
+	}{
+		{
+			name:  "healthy",
+			resps: []*proto.ExtentVerifyResponse{healthy(7), healthy(7), healthy(7)},
+		},
+		{
+			name:     "crc mismatch",
+			resps:    []*proto.ExtentVerifyResponse{healthy(7), healthy(8), healthy(9)},
+			problems: []string{proto.VerifyProblemCrcMismatch},
+		},
+		{
+			name: "missing, short and unreachable",
+			resps: []*proto.ExtentVerifyResponse{
+				{Exists: true, Deleted: true},
+				{Exists: true, ExtentSize: 150},
+				nil,
+			},
+			errs:     []error{nil, nil, errors.New("connection refused")},
+			problems: []string{proto.VerifyProblemMissing, proto.VerifyProblemShort, proto.VerifyProblemUnreachable},
+		},
+		{
+			// the replicas not holding the range are not compared
+			name:     "short",
+			resps:    []*proto.ExtentVerifyResponse{healthy(7), {Exists: true, ExtentSize: 150}, healthy(7)},
+			problems: []string{proto.VerifyProblemShort},
+		},
+	}
+	for _, c := range cases {
+		errs := c.errs
+		if errs == nil {
+			errs = make([]error, len(hosts))
+		}
+		result := &proto.ExtentVerifyResult{Problems: make([]string, 0)}
+		checkReplicas(result, ek, hosts, c.resps, errs)
+		if len(result.Problems) != len(c.problems) {
+			t.Fatalf("%v: expect the problems %v, but are %v", c.name, c.problems, result.Problems)
+		}
+		for i := range c.problems {
+			if result.Problems[i] != c.problems[i] {
+				t.Fatalf("%v: expect the problems %v, but are %v", c.name, c.problems, result.Problems)
+			}
+		}
+		if len(result.Replicas) != len(hosts) {
+			t.Fatalf("%v: expect the results of every replica, but are %v", c.name, result.Replicas)
+		}
+		for i, replica := range result.Replicas {
+			if replica.Addr != hosts[i] || (replica.Err == "") != (c.resps[i] != nil && c.resps[i].Complete && errs[i] == nil) {
+				t.Fatalf("%v: unexpected result %+v of replica %v", c.name, replica, hosts[i])
+			}
+		}
+	}
+}
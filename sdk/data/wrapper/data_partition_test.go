@@ -74,3 +74,27 @@ func TestKmin(t *testing.T) {
 	}
 	fmt.Println()
 }
+
+func TestSortHostsByZone(t *testing.T) {
+	hosts := []string{"192.168.0.1:6000", "192.168.0.2:6000", "192.168.0.3:6000"}
+	hostZones := map[string]string{
+		"192.168.0.1:6000": "z1",
+		"192.168.0.2:6000": "z2",
+		"192.168.0.3:6000": "z2",
+	}
+	w := &Wrapper{zoneName: "z2"}
+	sorted := w.sortHosts(hosts, hostZones)
+	expected := []string{"192.168.0.2:6000", "192.168.0.3:6000", "192.168.0.1:6000"}
+	for i := range expected {
+		if sorted[i] != expected[i] {
+			t.Fatalf("expect %v, but got %v", expected, sorted)
+		}
+	}
+	if hosts[0] != "192.168.0.1:6000" {
+		t.Fatalf("hosts should not be changed, but got %v", hosts)
+	}
+	w = &Wrapper{zoneName: "z3"}
+	if sorted = w.sortHosts(hosts, hostZones); sorted[0] != hosts[0] || len(sorted) != len(hosts) {
+		t.Fatalf("hosts should keep the order if none is in the zone, but got %v", sorted)
+	}
+}
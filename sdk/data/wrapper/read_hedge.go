@@ -0,0 +1,130 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wrapper
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MinReadHedgeDelay = 2 * time.Millisecond
+	MaxReadHedgeDelay = 500 * time.Millisecond
+	// The hedges can be issued back to back up to the burst, e.g. after the reads are idle for a while.
+	ReadHedgeBurst = 10
+)
+
+// ReadHedgeStats holds the counters of the reads taken by the hedger.
+type ReadHedgeStats struct {
+	Reads   uint64 // the reads which could be hedged
+	Hedged  uint64 // the reads hedged to another replica
+	Won     uint64 // the hedged reads served first by the hedge
+	Skipped uint64 // the reads not hedged for the budget
+}
+
+// ReadHedger decides when a read from the followers is hedged, i.e. issued again to another replica if it has not
+// returned within the delay, so that a slow replica does not inflate the tail latency. The delay adapts to the
+// latencies observed like the retransmission timeout of TCP: the smoothed latency plus twice its mean deviation,
+// which is roughly the 95th percentile. The hedges are limited to the ratio of the reads, plus a small burst.
+type ReadHedger struct {
+	sync.Mutex
+	ratio  float64
+	tokens float64
+	srtt   time.Duration // zero until the first latency is observed
+	rttvar time.Duration
+
+	reads   uint64
+	hedged  uint64
+	won     uint64
+	skipped uint64
+}
+
+// NewReadHedger returns a hedger which hedges at most the percent of the reads, or nil if the percent is not positive.
+func NewReadHedger(percent int64) *ReadHedger {
+	if percent <= 0 {
+		return nil
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return &ReadHedger{ratio: float64(percent) / 100, tokens: ReadHedgeBurst}
+}
+
+// Begin starts a read, which earns the budget of the hedges, and returns the delay after which it is hedged.
+func (h *ReadHedger) Begin() time.Duration {
+	atomic.AddUint64(&h.reads, 1)
+	h.Lock()
+	defer h.Unlock()
+	if h.tokens += h.ratio; h.tokens > ReadHedgeBurst {
+		h.tokens = ReadHedgeBurst
+	}
+	if h.srtt == 0 {
+		return MaxReadHedgeDelay
+	}
+	delay := h.srtt + 2*h.rttvar
+	if delay < MinReadHedgeDelay {
+		delay = MinReadHedgeDelay
+	}
+	if delay > MaxReadHedgeDelay {
+		delay = MaxReadHedgeDelay
+	}
+	return delay
+}
+
+// Hedge returns whether a read which has not returned within the delay can be hedged within the budget.
+func (h *ReadHedger) Hedge() bool {
+	h.Lock()
+	defer h.Unlock()
+	if h.tokens < 1 {
+		atomic.AddUint64(&h.skipped, 1)
+		return false
+	}
+	h.tokens--
+	atomic.AddUint64(&h.hedged, 1)
+	return true
+}
+
+// Observe records the latency of a read from the replica it was issued to first, whether it won or not.
+func (h *ReadHedger) Observe(latency time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	if h.srtt == 0 {
+		h.srtt = latency
+		h.rttvar = latency / 2
+		return
+	}
+	diff := h.srtt - latency
+	if diff < 0 {
+		diff = -diff
+	}
+	h.rttvar += (diff - h.rttvar) / 4
+	h.srtt += (latency - h.srtt) / 8
+}
+
+// Win records a hedged read served first by the hedge.
+func (h *ReadHedger) Win() {
+	atomic.AddUint64(&h.won, 1)
+}
+
+// Stats returns the counters of the reads taken by the hedger.
+func (h *ReadHedger) Stats() ReadHedgeStats {
+	return ReadHedgeStats{
+		Reads:   atomic.LoadUint64(&h.reads),
+		Hedged:  atomic.LoadUint64(&h.hedged),
+		Won:     atomic.LoadUint64(&h.won),
+		Skipped: atomic.LoadUint64(&h.skipped),
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadHedgerDelay(t *testing.T) {
+	if NewReadHedger(0) != nil {
+		t.Fatalf("hedging should be disabled by a zero budget")
+	}
+	h := NewReadHedger(5)
+	if delay := h.Begin(); delay != MaxReadHedgeDelay {
+		t.Fatalf("delay before any latency is observed %v", delay)
+	}
+	for i := 0; i < 100; i++ {
+		h.Observe(10 * time.Millisecond)
+	}
+	steady := h.Begin()
+	if steady < 10*time.Millisecond || steady > 12*time.Millisecond {
+		t.Fatalf("delay of the steady latencies %v", steady)
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe(100 * time.Millisecond)
+	}
+	if delay := h.Begin(); delay <= steady {
+		t.Fatalf("delay should grow with the latencies, %v to %v", steady, delay)
+	}
+	for i := 0; i < 100; i++ {
+		h.Observe(time.Microsecond)
+	}
+	if delay := h.Begin(); delay != MinReadHedgeDelay {
+		t.Fatalf("delay should be bounded by %v, got %v", MinReadHedgeDelay, delay)
+	}
+}
+
+func TestReadHedgerBudget(t *testing.T) {
+	h := NewReadHedger(10)
+	hedged := 0
+	for i := 0; i < 1000; i++ {
+		h.Begin()
+		if h.Hedge() {
+			hedged++
+		}
+	}
+	if max := 1000/10 + ReadHedgeBurst; hedged > max || hedged < 100 {
+		t.Fatalf("hedged %v reads, expected at least 100 and at most %v", hedged, max)
+	}
+	h.Win()
+	stats := h.Stats()
+	if stats.Reads != 1000 || stats.Hedged != uint64(hedged) || stats.Skipped != uint64(1000-hedged) || stats.Won != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wrapper
+
+import (
+	"sync/atomic"
+)
+
+// ReadVerifyStats holds the counters of the reads verified against another replica.
+type ReadVerifyStats struct {
+	Reads      uint64 // the reads which could be verified
+	Verified   uint64 // the reads sampled to be verified
+	Mismatched uint64 // the verified reads whose data differ between the replicas
+}
+
+// ReadVerifier samples the reads of a volume with VerifyReads, which are read again from another replica to compare
+// the Crcs. The samples are spread evenly, i.e. one in every 100/percent reads, and the percent follows the volume.
+type ReadVerifier struct {
+	percent    int32
+	reads      uint64
+	verified   uint64
+	mismatched uint64
+}
+
+// SetPercent sets the percent of the reads verified, 0 to verify none.
+func (v *ReadVerifier) SetPercent(percent int) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	atomic.StoreInt32(&v.percent, int32(percent))
+}
+
+// Percent returns the percent of the reads verified.
+func (v *ReadVerifier) Percent() int {
+	return int(atomic.LoadInt32(&v.percent))
+}
+
+// Sample returns whether a read is verified.
+func (v *ReadVerifier) Sample() bool {
+	percent := uint64(atomic.LoadInt32(&v.percent))
+	if percent == 0 {
+		return false
+	}
+	n := atomic.AddUint64(&v.reads, 1)
+	if n*percent/100 == (n-1)*percent/100 {
+		return false
+	}
+	atomic.AddUint64(&v.verified, 1)
+	return true
+}
+
+// Mismatch records a verified read whose data differ between the replicas.
+func (v *ReadVerifier) Mismatch() {
+	atomic.AddUint64(&v.mismatched, 1)
+}
+
+// Stats returns the counters of the reads verified.
+func (v *ReadVerifier) Stats() ReadVerifyStats {
+	return ReadVerifyStats{
+		Reads:      atomic.LoadUint64(&v.reads),
+		Verified:   atomic.LoadUint64(&v.verified),
+		Mismatched: atomic.LoadUint64(&v.mismatched),
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+)
+
+func TestReadVerifierSample(t *testing.T) {
+	v := &ReadVerifier{}
+	if v.Sample() {
+		t.Fatalf("read is verified with a zero percent")
+	}
+	v.SetPercent(3)
+	verified := 0
+	for i := 0; i < 1000; i++ {
+		if v.Sample() {
+			verified++
+		}
+	}
+	if verified != 30 {
+		t.Fatalf("verified %v reads, expected 30", verified)
+	}
+	v.Mismatch()
+	if stats := v.Stats(); stats.Reads != 1000 || stats.Verified != 30 || stats.Mismatched != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	v.SetPercent(200)
+	if v.Percent() != 100 || !v.Sample() || !v.Sample() {
+		t.Fatalf("all reads should be verified with percent %v", v.Percent())
+	}
+}
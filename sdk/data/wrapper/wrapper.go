@@ -17,8 +17,10 @@ package wrapper
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -47,6 +49,12 @@ type Wrapper struct {
 	followerRead          bool
 	followerReadClientCfg bool
 	nearRead              bool
+	zoneName              string
+	readHedger            *ReadHedger
+	readVerifier          ReadVerifier
+	delegatedToken        string
+	verifyRead            bool
+	shadowMirrors         int32 // set if the writes are mirrored to the shadow volume, accessed atomically
 	dpSelectorChanged     bool
 	dpSelectorName        string
 	dpSelectorParm        string
@@ -125,6 +133,8 @@ func (w *Wrapper) getSimpleVolView() (err error) {
 		return
 	}
 	w.followerRead = view.FollowerRead
+	w.setVerifyReads(view)
+	w.setShadowMirrors(view)
 	w.dpSelectorName = view.DpSelectorName
 	w.dpSelectorParm = view.DpSelectorParm
 
@@ -164,6 +174,9 @@ func (w *Wrapper) updateSimpleVolView() (err error) {
 		w.followerRead = view.FollowerRead
 	}
 
+	w.setVerifyReads(view)
+	w.setShadowMirrors(view)
+
 	if w.dpSelectorName != view.DpSelectorName || w.dpSelectorParm != view.DpSelectorParm {
 		log.LogInfof("updateSimpleVolView: update dpSelector from old(%v %v) to new(%v %v)",
 			w.dpSelectorName, w.dpSelectorParm, view.DpSelectorName, view.DpSelectorParm)
@@ -196,8 +209,8 @@ func (w *Wrapper) updateDataPartition(isInit bool) (err error) {
 	rwPartitionGroups := make([]*DataPartition, 0)
 	for _, partition := range dpv.DataPartitions {
 		dp := convert(partition)
-		if w.followerRead && w.nearRead {
-			dp.NearHosts = w.sortHostsByDistance(dp.Hosts)
+		if w.followerRead && w.ReadNearHosts() {
+			dp.NearHosts = w.sortHosts(dp.Hosts, dp.HostZones)
 		}
 		log.LogInfof("updateDataPartition: dp(%v)", dp)
 		w.replaceOrInsertPartition(dp)
@@ -229,7 +242,8 @@ func (w *Wrapper) replaceOrInsertPartition(dp *DataPartition) {
 		old.Status = dp.Status
 		old.ReplicaNum = dp.ReplicaNum
 		old.Hosts = dp.Hosts
-		old.NearHosts = dp.Hosts
+		old.HostZones = dp.HostZones
+		old.NearHosts = dp.NearHosts
 		dp.Metrics = old.Metrics
 	} else {
 		dp.Metrics = NewDataPartitionMetrics()
@@ -254,6 +268,17 @@ func (w *Wrapper) GetDataPartition(partitionID uint64) (*DataPartition, error) {
 	return dp, nil
 }
 
+// ReportReadMismatch reports a range of an extent whose data read from two replicas differ to the master.
+func (w *Wrapper) ReportReadMismatch(report *proto.ReadMismatchReport) error {
+	report.VolName = w.volName
+	return w.mc.ClientAPI().ReportReadMismatch(report)
+}
+
+// ReportBadBlock reports the blocks failed to be read from a replica for the Crc mismatch to the master.
+func (w *Wrapper) ReportBadBlock(report *proto.DataBlockReport) error {
+	return w.mc.ClientAPI().ReportBadBlock(report)
+}
+
 // WarningMsg returns the warning message that contains the cluster name.
 func (w *Wrapper) WarningMsg() string {
 	return fmt.Sprintf("%s_client_warning", w.clusterName)
@@ -287,16 +312,104 @@ func (w *Wrapper) NearRead() bool {
 	return w.nearRead
 }
 
-// Sort hosts by distance form local
-func (w *Wrapper) sortHostsByDistance(hosts []string) []string {
-	for i := 0; i < len(hosts); i++ {
-		for j := i + 1; j < len(hosts); j++ {
-			if distanceFromLocal(hosts[i]) > distanceFromLocal(hosts[j]) {
-				hosts[i], hosts[j] = hosts[j], hosts[i]
+// SetZoneName sets the zone of the client, whose replicas are preferred by the reads from the followers.
+func (w *Wrapper) SetZoneName(zoneName string) {
+	w.zoneName = zoneName
+	log.LogInfof("SetZoneName: set zoneName to %v", w.zoneName)
+}
+
+func (w *Wrapper) ZoneName() string {
+	return w.zoneName
+}
+
+// SetReadHedgeBudget enables hedging the reads from the followers, with at most the percent of them hedged.
+func (w *Wrapper) SetReadHedgeBudget(percent int64) {
+	w.readHedger = NewReadHedger(percent)
+	log.LogInfof("SetReadHedgeBudget: set hedgeReadBudget to %v", percent)
+}
+
+// ReadHedger returns the hedger of the reads from the followers, or nil if they are not hedged.
+func (w *Wrapper) ReadHedger() *ReadHedger {
+	return w.readHedger
+}
+
+// ReadVerifier returns the sampler of the reads verified against another replica.
+func (w *Wrapper) ReadVerifier() *ReadVerifier {
+	return &w.readVerifier
+}
+
+func (w *Wrapper) setVerifyReads(view *proto.SimpleVolView) {
+	percent := 0
+	if view.VerifyReads {
+		percent = view.VerifyReadsPercent
+	}
+	if old := w.readVerifier.Percent(); old != percent {
+		log.LogInfof("setVerifyReads: update verifyReadsPercent from old(%v) to new(%v)", old, percent)
+		w.readVerifier.SetPercent(percent)
+	}
+}
+
+func (w *Wrapper) setShadowMirrors(view *proto.SimpleVolView) {
+	var mirrors int32
+	if view.Shadow.ShadowMirrors() {
+		mirrors = 1
+	}
+	if old := atomic.SwapInt32(&w.shadowMirrors, mirrors); old != mirrors {
+		log.LogWarnf("setShadowMirrors: volume(%v) shadow(%v) mirrors from old(%v) to new(%v)",
+			w.volName, view.Shadow, old == 1, mirrors == 1)
+	}
+}
+
+// ShadowMirrors returns whether the writes of the volume are mirrored to its shadow volume, which is false once the
+// volume fails over to the shadow.
+func (w *Wrapper) ShadowMirrors() bool {
+	return atomic.LoadInt32(&w.shadowMirrors) == 1
+}
+
+// SetDelegatedToken sets the delegated token attached to the packets to the data nodes.
+func (w *Wrapper) SetDelegatedToken(token string) {
+	w.delegatedToken = token
+}
+
+// DelegatedToken returns the delegated token attached to the packets to the data nodes.
+func (w *Wrapper) DelegatedToken() string {
+	return w.delegatedToken
+}
+
+// SetVerifyRead makes the data nodes fail the reads of the deleted data instead of reading the zeros, which is set
+// if the extent keys read from are not the current ones.
+func (w *Wrapper) SetVerifyRead(verify bool) {
+	w.verifyRead = verify
+}
+
+// VerifyRead returns whether the data nodes verify the data read is not deleted.
+func (w *Wrapper) VerifyRead() bool {
+	return w.verifyRead
+}
+
+// ReadNearHosts returns true if the reads from the followers go to the hosts sorted by the preference of the client
+// rather than to the hosts in turn.
+func (w *Wrapper) ReadNearHosts() bool {
+	return w.nearRead || w.zoneName != ""
+}
+
+// sortHosts returns a copy of the hosts sorted by the preference of the client: the hosts in the zone of the client
+// come first, and then the hosts nearer to the client if near read is enabled. The hosts in the other zones are kept
+// behind for the reads to fall back to.
+func (w *Wrapper) sortHosts(hosts []string, hostZones map[string]string) []string {
+	sorted := make([]string, len(hosts))
+	copy(sorted, hosts)
+	less := func(a, b string) bool {
+		if w.zoneName != "" {
+			inZoneA, inZoneB := hostZones[a] == w.zoneName, hostZones[b] == w.zoneName
+			if inZoneA != inZoneB {
+				return inZoneA
 			}
 		}
+		return w.nearRead && distanceFromLocal(a) < distanceFromLocal(b)
 	}
-	return hosts
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
 }
 
 func distanceFromLocal(b string) int {
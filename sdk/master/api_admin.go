@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/chubaofs/chubaofs/proto"
 )
@@ -51,6 +52,24 @@ func (api *AdminAPI) GetClusterStat() (cs *proto.ClusterStatInfo, err error) {
 	}
 	return
 }
+
+// GetStatsTree returns the statistics of the cluster rolled up by zone, rack and node down to the level, of the zone
+// only if zoneName is not empty.
+func (api *AdminAPI) GetStatsTree(zoneName, level string) (tree *proto.StatsTreeNode, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminStatsTree)
+	request.addParam("zoneName", zoneName)
+	request.addParam("level", level)
+	var buf []byte
+	if buf, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	tree = &proto.StatsTreeNode{}
+	if err = json.Unmarshal(buf, tree); err != nil {
+		return
+	}
+	return
+}
+
 func (api *AdminAPI) ListZones() (zoneViews []*proto.ZoneView, err error) {
 	var request = newAPIRequest(http.MethodGet, proto.GetAllZones)
 	var buf []byte
@@ -91,6 +110,131 @@ func (api *AdminAPI) GetDataPartition(volName string, partitionID uint64) (parti
 	return
 }
 
+func (api *AdminAPI) CheckDataPartitionRef(volName string, partitionID uint64, limit int) (report *proto.DataPartitionRefReport, err error) {
+	var buf []byte
+	var request = newAPIRequest(http.MethodGet, proto.AdminCheckDataPartitionRef)
+	request.addParam("id", strconv.FormatUint(partitionID, 10))
+	request.addParam("name", volName)
+	request.addParam("limit", strconv.Itoa(limit))
+	if buf, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	report = &proto.DataPartitionRefReport{}
+	if err = json.Unmarshal(buf, report); err != nil {
+		return
+	}
+	return
+}
+
+// DeleteDataPartition marks the data partition to be deleted, and the master deletes it once no inode refers to it.
+// proto.ErrDataPartitionReferenced is returned if the data partition is referenced and force is false.
+func (api *AdminAPI) DeleteDataPartition(volName string, partitionID uint64, force bool) (report *proto.DataPartitionRefReport, err error) {
+	var buf []byte
+	var request = newAPIRequest(http.MethodGet, proto.AdminDeleteDataPartition)
+	request.addParam("id", strconv.FormatUint(partitionID, 10))
+	request.addParam("name", volName)
+	request.addParam("force", strconv.FormatBool(force))
+	if buf, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	report = &proto.DataPartitionRefReport{}
+	if err = json.Unmarshal(buf, report); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) CancelDeleteDataPartition(volName string, partitionID uint64) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminCancelDeleteDataPartition)
+	request.addParam("id", strconv.FormatUint(partitionID, 10))
+	request.addParam("name", volName)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) FreezeDataPartition(volName string, partitionID uint64) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminFreezeDataPartition)
+	request.addParam("id", strconv.FormatUint(partitionID, 10))
+	request.addParam("name", volName)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) UnfreezeDataPartition(volName string, partitionID uint64) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminUnfreezeDataPartition)
+	request.addParam("id", strconv.FormatUint(partitionID, 10))
+	request.addParam("name", volName)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) CopyExtent(request *proto.CopyExtentRequest, destAddr string) (jobID uint64, err error) {
+	var req = newAPIRequest(http.MethodGet, proto.AdminCopyExtent)
+	req.addParam("id", strconv.FormatUint(request.PartitionId, 10))
+	req.addParam("addr", destAddr)
+	req.addParam("sourceAddr", request.SourceAddr)
+	req.addParam("extentID", strconv.FormatUint(request.ExtentId, 10))
+	req.addParam("offset", strconv.FormatUint(request.Offset, 10))
+	req.addParam("size", strconv.FormatUint(uint64(request.Size), 10))
+	req.addParam("rateLimit", strconv.FormatUint(request.RateLimit, 10))
+	var data []byte
+	if data, err = api.mc.serveRequest(req); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &jobID); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetExtentCopyJob(jobID uint64) (job *proto.ExtentCopyJob, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminGetExtentCopyJob)
+	request.addParam("jobID", strconv.FormatUint(jobID, 10))
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	job = &proto.ExtentCopyJob{}
+	if err = json.Unmarshal(data, job); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetReadMismatches(volName string, partitionID uint64) (reports []*proto.ReadMismatchReport, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminGetReadMismatches)
+	request.addParam("name", volName)
+	request.addParam("id", strconv.FormatUint(partitionID, 10))
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	reports = make([]*proto.ReadMismatchReport, 0)
+	if err = json.Unmarshal(data, &reports); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetDataPartitionCreationQueue() (queue *proto.DataPartitionCreationQueue, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminDataPartitionCreations)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	queue = &proto.DataPartitionCreationQueue{}
+	if err = json.Unmarshal(data, queue); err != nil {
+		return
+	}
+	return
+}
+
 func (api *AdminAPI) DiagnoseDataPartition() (diagnosis *proto.DataPartitionDiagnosis, err error) {
 	var buf []byte
 	var request = newAPIRequest(http.MethodGet, proto.AdminDiagnoseDataPartition)
@@ -207,6 +351,77 @@ func (api *AdminAPI) DeleteVolume(volName, authKey string) (err error) {
 	return
 }
 
+// DelegateVolToken mints a delegated token of the volume, which expires in ttl hours.
+func (api *AdminAPI) DelegateVolToken(volName, authKey string, readOnly bool, subDir string, ttl int64) (view *proto.DelegatedTokenView, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminDelegateVolToken)
+	request.addParam("name", volName)
+	request.addParam("authKey", authKey)
+	request.addParam("readOnly", strconv.FormatBool(readOnly))
+	request.addParam("subDir", subDir)
+	request.addParam("ttl", strconv.FormatInt(ttl, 10))
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	view = &proto.DelegatedTokenView{}
+	if err = json.Unmarshal(data, view); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) ReserveVolSpace(volName, authKey string, size uint64, ttl int64) (reservation *proto.VolReservation, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminReserveVolSpace)
+	request.addParam("name", volName)
+	request.addParam("authKey", authKey)
+	request.addParam("size", strconv.FormatUint(size, 10))
+	request.addParam("ttl", strconv.FormatInt(ttl, 10))
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	reservation = &proto.VolReservation{}
+	if err = json.Unmarshal(data, reservation); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) CancelVolReservation(volName, authKey string, id uint64) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminCancelVolReservation)
+	request.addParam("name", volName)
+	request.addParam("authKey", authKey)
+	request.addParam("id", strconv.FormatUint(id, 10))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetVolReservations(volName string) (view *proto.VolReservationsView, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminGetVolReservations)
+	request.addParam("name", volName)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	view = &proto.VolReservationsView{}
+	if err = json.Unmarshal(data, view); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) UndeleteVolume(volName, authKey string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminUndeleteVol)
+	request.addParam("name", volName)
+	request.addParam("authKey", authKey)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
 func (api *AdminAPI) UpdateVolume(volName string, capacity uint64, replicas int, followerRead, authenticate, enableToken bool, authKey, zoneName string) (err error) {
 	var request = newAPIRequest(http.MethodGet, proto.AdminUpdateVol)
 	request.addParam("name", volName)
@@ -246,7 +461,7 @@ func (api *AdminAPI) VolExpand(volName string, capacity uint64, authKey string)
 }
 
 func (api *AdminAPI) CreateVolume(volName, owner string, mpCount int,
-	dpSize uint64, capacity uint64, replicas int, followerRead bool, zoneName string) (err error) {
+	dpSize uint64, capacity uint64, replicas int, followerRead bool, zoneName string, caseInsensitive bool) (err error) {
 	var request = newAPIRequest(http.MethodGet, proto.AdminCreateVol)
 	request.addParam("name", volName)
 	request.addParam("owner", owner)
@@ -255,12 +470,106 @@ func (api *AdminAPI) CreateVolume(volName, owner string, mpCount int,
 	request.addParam("capacity", strconv.FormatUint(capacity, 10))
 	request.addParam("followerRead", strconv.FormatBool(followerRead))
 	request.addParam("zoneName", zoneName)
+	request.addParam("caseInsensitive", strconv.FormatBool(caseInsensitive))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) Bootstrap(manifest *proto.BootstrapManifest) (result *proto.BootstrapResult, err error) {
+	var request = newAPIRequest(http.MethodPost, proto.AdminBootstrap)
+	var reqBody []byte
+	if reqBody, err = json.Marshal(manifest); err != nil {
+		return
+	}
+	request.addBody(reqBody)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	result = &proto.BootstrapResult{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return
+	}
+	return
+}
+
+// SetVolMaxClients overrides the maximum number of the clients mounting the volume, 0 for unlimited.
+func (api *AdminAPI) SetVolMaxClients(volName string, maxClients int) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminSetVolMaxClients)
+	request.addParam("name", volName)
+	request.addParam("maxClients", strconv.Itoa(maxClients))
 	if _, err = api.mc.serveRequest(request); err != nil {
 		return
 	}
 	return
 }
 
+func (api *AdminAPI) SetVolLifecycle(volName, authKey string, rules []*proto.LifecycleRule) (err error) {
+	var request = newAPIRequest(http.MethodPost, proto.AdminSetVolLifecycle)
+	request.addParam("name", volName)
+	request.addParam("authKey", authKey)
+	var reqBody []byte
+	if reqBody, err = json.Marshal(rules); err != nil {
+		return
+	}
+	request.addBody(reqBody)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetVolLifecycleStatus(volName string) (status *proto.LifecycleStatus, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminGetVolLifecycleStatus)
+	request.addParam("name", volName)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	status = &proto.LifecycleStatus{}
+	if err = json.Unmarshal(data, status); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetPlacementDiff(volName, partitionType string) (report *proto.PlacementDiffReport, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminPlacementDiff)
+	if volName != "" {
+		request.addParam("name", volName)
+	}
+	if partitionType != "" {
+		request.addParam("type", partitionType)
+	}
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	report = &proto.PlacementDiffReport{}
+	if err = json.Unmarshal(data, report); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetNodeVersions(commitID string) (view *proto.NodeVersionsView, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminNodeVersions)
+	if commitID != "" {
+		request.addParam("commit", commitID)
+	}
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	view = &proto.NodeVersionsView{}
+	if err = json.Unmarshal(data, view); err != nil {
+		return
+	}
+	return
+}
+
 func (api *AdminAPI) CreateDefaultVolume(volName, owner string) (err error) {
 	var request = newAPIRequest(http.MethodGet, proto.AdminCreateVol)
 	request.addParam("name", volName)
@@ -332,6 +641,34 @@ func (api *AdminAPI) IsFreezeCluster(isFreeze bool) (err error) {
 	return
 }
 
+func (api *AdminAPI) SetAutoPromoteSpare(enable bool) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminSetAutoPromoteSpare)
+	request.addParam("enable", strconv.FormatBool(enable))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) SetQuorumWrite(enable bool) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminSetQuorumWrite)
+	request.addParam("enable", strconv.FormatBool(enable))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) SetDataNodeSpare(addr string, isSpare bool) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminSetDataNodeSpare)
+	request.addParam("addr", addr)
+	request.addParam("spare", strconv.FormatBool(isSpare))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
 func (api *AdminAPI) SetMetaNodeThreshold(threshold float64) (err error) {
 	var request = newAPIRequest(http.MethodGet, proto.AdminSetMetaNodeThreshold)
 	request.addParam("threshold", strconv.FormatFloat(threshold, 'f', 6, 64))
@@ -369,3 +706,180 @@ func (api *AdminAPI) GetDeleteParas() (delParas map[string]string, err error) {
 	}
 	return
 }
+
+func (api *AdminAPI) SubmitMaintenancePlan(plan *proto.MaintenancePlan) (err error) {
+	var request = newAPIRequest(http.MethodPost, proto.AdminSubmitMaintenancePlan)
+	var reqBody []byte
+	if reqBody, err = json.Marshal(plan); err != nil {
+		return
+	}
+	request.addBody(reqBody)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetMaintenancePlan(name string) (plan *proto.MaintenancePlan, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminGetMaintenancePlan)
+	request.addParam("name", name)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	plan = &proto.MaintenancePlan{}
+	if err = json.Unmarshal(data, plan); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) ListMaintenancePlans() (plans []*proto.MaintenancePlanView, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminListMaintenancePlans)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	plans = make([]*proto.MaintenancePlanView, 0)
+	if err = json.Unmarshal(data, &plans); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) PauseMaintenancePlan(name string) (err error) {
+	return api.setMaintenancePlanState(proto.AdminPauseMaintenancePlan, name)
+}
+
+func (api *AdminAPI) ResumeMaintenancePlan(name string) (err error) {
+	return api.setMaintenancePlanState(proto.AdminResumeMaintenancePlan, name)
+}
+
+func (api *AdminAPI) AbortMaintenancePlan(name string) (err error) {
+	return api.setMaintenancePlanState(proto.AdminAbortMaintenancePlan, name)
+}
+
+func (api *AdminAPI) setMaintenancePlanState(path, name string) (err error) {
+	var request = newAPIRequest(http.MethodPost, path)
+	request.addParam("name", name)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) CreateTenant(name, owner string, capacity uint64, acl string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminCreateTenant)
+	request.addParam("name", name)
+	request.addParam("owner", owner)
+	request.addParam("capacity", strconv.FormatUint(capacity, 10))
+	request.addParam("acl", acl)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+// UpdateTenant changes the owner, the quota and the ACL of the tenant, the empty ones are not changed.
+func (api *AdminAPI) UpdateTenant(name, owner string, capacity uint64, acl string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminUpdateTenant)
+	request.addParam("name", name)
+	if owner != "" {
+		request.addParam("owner", owner)
+	}
+	if capacity != 0 {
+		request.addParam("capacity", strconv.FormatUint(capacity, 10))
+	}
+	request.addParam("acl", acl)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) DeleteTenant(name string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminDeleteTenant)
+	request.addParam("name", name)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) AddVolToTenant(name, volName string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminTenantAddVol)
+	request.addParam("name", name)
+	request.addParam("volName", volName)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) RemoveVolFromTenant(name, volName string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminTenantRemoveVol)
+	request.addParam("name", name)
+	request.addParam("volName", volName)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) GetTenantStat(name string) (stat *proto.TenantStat, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminTenantStats)
+	request.addParam("name", name)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	stat = &proto.TenantStat{}
+	if err = json.Unmarshal(data, stat); err != nil {
+		return
+	}
+	return
+}
+
+func (api *AdminAPI) ListTenantStats() (stats []*proto.TenantStat, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminTenantStats)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	stats = make([]*proto.TenantStat, 0)
+	if err = json.Unmarshal(data, &stats); err != nil {
+		return
+	}
+	return
+}
+
+// GetEvents returns the latest limit events (0 for all) of the type and the resource raised since the time in unix
+// seconds. The empty filters match all the events, and activeOnly returns only the events of the conditions not
+// resolved yet.
+func (api *AdminAPI) GetEvents(eventType, resource string, since int64, activeOnly bool, limit int) (view *proto.ClusterEventsView, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminGetEvents)
+	request.addParam("type", eventType)
+	request.addParam("resource", resource)
+	request.addParam("time", strconv.FormatInt(since, 10))
+	request.addParam("active", strconv.FormatBool(activeOnly))
+	request.addParam("limit", strconv.Itoa(limit))
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	view = &proto.ClusterEventsView{}
+	if err = json.Unmarshal(data, view); err != nil {
+		return
+	}
+	return
+}
+
+// SetEventWebhooks sets the URLs to which the master pushes the events, and the empty list stops the pushing.
+func (api *AdminAPI) SetEventWebhooks(webhooks []string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AdminSetEventWebhooks)
+	request.addParam("webhooks", strings.Join(webhooks, ","))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
@@ -63,6 +63,22 @@ func (api *ClientAPI) GetVolumeWithoutAuthKey(volName string) (vv *proto.VolView
 	return
 }
 
+// GetVolumeWithDelegatedToken fetches the view of the volume with a delegated token instead of the auth key.
+func (api *ClientAPI) GetVolumeWithDelegatedToken(volName string, token string) (vv *proto.VolView, err error) {
+	var request = newAPIRequest(http.MethodPost, proto.ClientVol)
+	request.addParam("name", volName)
+	request.addParam("delegatedToken", token)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	vv = &proto.VolView{}
+	if err = json.Unmarshal(data, vv); err != nil {
+		return
+	}
+	return
+}
+
 func (api *ClientAPI) GetVolumeWithAuthnode(volName string, authKey string, token string, decoder Decoder) (vv *proto.VolView, err error) {
 	var body []byte
 	var request = newAPIRequest(http.MethodPost, proto.ClientVol)
@@ -153,3 +169,78 @@ func (api *ClientAPI) GetDataPartitions(volName string) (view *proto.DataPartiti
 	}
 	return
 }
+
+func (api *ClientAPI) ReportClientMetrics(metrics *proto.ClientMetrics) (err error) {
+	var encoded []byte
+	if encoded, err = json.Marshal(metrics); err != nil {
+		return
+	}
+	var request = newAPIRequest(http.MethodPost, proto.ClientMetricsReport)
+	request.addBody(encoded)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+// RegisterClient registers the client mounting the volume, which is renewed at proto.ClientLeaseInterval.
+func (api *ClientAPI) RegisterClient(volName, clientID string, renew bool) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.ClientRegister)
+	request.addParam("name", volName)
+	request.addParam("clientId", clientID)
+	request.addParam("renew", strconv.FormatBool(renew))
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *ClientAPI) UnregisterClient(volName, clientID string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.ClientUnregister)
+	request.addParam("name", volName)
+	request.addParam("clientId", clientID)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *ClientAPI) ReportBadBlock(report *proto.DataBlockReport) (err error) {
+	var encoded []byte
+	if encoded, err = json.Marshal(report); err != nil {
+		return
+	}
+	var request = newAPIRequest(http.MethodPost, proto.ClientReportBadBlock)
+	request.addBody(encoded)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *ClientAPI) ReportReadMismatch(report *proto.ReadMismatchReport) (err error) {
+	var encoded []byte
+	if encoded, err = json.Marshal(report); err != nil {
+		return
+	}
+	var request = newAPIRequest(http.MethodPost, proto.ClientReportMismatch)
+	request.addBody(encoded)
+	if _, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	return
+}
+
+func (api *ClientAPI) ListClientMetrics(volName string) (metrics []*proto.ClientMetrics, err error) {
+	var request = newAPIRequest(http.MethodGet, proto.ClientMetricsList)
+	request.addParam("name", volName)
+	var data []byte
+	if data, err = api.mc.serveRequest(request); err != nil {
+		return
+	}
+	metrics = make([]*proto.ClientMetrics, 0)
+	if err = json.Unmarshal(data, &metrics); err != nil {
+		return
+	}
+	return
+}
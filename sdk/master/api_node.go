@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 )
@@ -26,27 +27,54 @@ type NodeAPI struct {
 	mc *MasterClient
 }
 
-func (api *NodeAPI) AddDataNode(serverAddr, zoneName string) (id uint64, err error) {
+func (api *NodeAPI) AddDataNode(serverAddr, zoneName, instanceID string, isSpare bool) (id uint64, err error) {
 	var request = newAPIRequest(http.MethodGet, proto.AddDataNode)
 	request.addParam("addr", serverAddr)
 	request.addParam("zoneName", zoneName)
+	request.addParam("spare", strconv.FormatBool(isSpare))
+	if instanceID != "" {
+		request.addParam("instanceId", instanceID)
+	}
+	request.addParam("time", strconv.FormatInt(time.Now().Unix(), 10))
+	request.addParam(proto.FormatKey, proto.FormatJSON)
 	var data []byte
 	if data, err = api.mc.serveRequest(request); err != nil {
 		return
 	}
-	id, err = strconv.ParseUint(string(data), 10, 64)
-	return
+	return parseIDResult(data)
 }
 
-func (api *NodeAPI) AddMetaNode(serverAddr, zoneName string) (id uint64, err error) {
+func (api *NodeAPI) AddMetaNode(serverAddr, zoneName, instanceID string) (id uint64, err error) {
 	var request = newAPIRequest(http.MethodGet, proto.AddMetaNode)
 	request.addParam("addr", serverAddr)
 	request.addParam("zoneName", zoneName)
+	if instanceID != "" {
+		request.addParam("instanceId", instanceID)
+	}
+	request.addParam("time", strconv.FormatInt(time.Now().Unix(), 10))
+	request.addParam(proto.FormatKey, proto.FormatJSON)
 	var data []byte
 	if data, err = api.mc.serveRequest(request); err != nil {
 		return
 	}
-	id, err = strconv.ParseUint(string(data), 10, 64)
+	return parseIDResult(data)
+}
+
+// parseIDResult parses the ID replied in the typed structure, or the bare ID replied by the masters of the older
+// versions ignoring the format.
+func parseIDResult(data []byte) (id uint64, err error) {
+	result := &proto.IDResult{}
+	if err = json.Unmarshal(data, result); err == nil {
+		return result.ID, nil
+	}
+	return strconv.ParseUint(string(data), 10, 64)
+}
+
+// AddMetaCacheNode registers the meta cache node, which must be done again at MetaCacheNodeHeartbeatInterval.
+func (api *NodeAPI) AddMetaCacheNode(serverAddr string) (err error) {
+	var request = newAPIRequest(http.MethodGet, proto.AddMetaCacheNode)
+	request.addParam("addr", serverAddr)
+	_, err = api.mc.serveRequest(request)
 	return
 }
 
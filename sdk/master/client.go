@@ -44,6 +44,8 @@ type MasterClient struct {
 	useSSL     bool
 	leaderAddr string
 	timeout    time.Duration
+	nodeRole   string
+	nodeToken  string
 
 	adminAPI  *AdminAPI
 	clientAPI *ClientAPI
@@ -89,6 +91,15 @@ func (c *MasterClient) setLeader(addr string) {
 	c.Unlock()
 }
 
+// SetNodeIdentity makes the requests carry the role and the token of the node, by which the master tells the
+// requests of the cluster nodes from those of the external users.
+func (c *MasterClient) SetNodeIdentity(role, token string) {
+	c.Lock()
+	c.nodeRole = role
+	c.nodeToken = token
+	c.Unlock()
+}
+
 // Change the request timeout
 func (c *MasterClient) SetTimeout(timeout uint16) {
 	c.Lock()
@@ -209,6 +220,12 @@ func (c *MasterClient) httpRequest(method, url string, param, header map[string]
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Connection", "close")
+	c.RLock()
+	if c.nodeRole != "" {
+		req.Header.Set(proto.NodeRoleHeader, c.nodeRole)
+		req.Header.Set(proto.NodeTokenHeader, c.nodeToken)
+	}
+	c.RUnlock()
 	for k, v := range header {
 		req.Header.Set(k, v)
 	}
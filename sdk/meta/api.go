@@ -17,6 +17,7 @@ package meta
 import (
 	"fmt"
 	syslog "log"
+	"path"
 	"sort"
 	"strings"
 	"sync"
@@ -36,13 +37,29 @@ const (
 	BatchIgetRespBuf = 1000
 )
 
+const (
+	// ReadDirPageLimit is the most children read by a request once a directory is not read within the timeout of
+	// the meta node at once.
+	ReadDirPageLimit = 1000
+)
+
 const (
 	OpenRetryInterval = 5 * time.Millisecond
 	OpenRetryLimit    = 1000
 )
 
+const (
+	FileChecksumRetryInterval = time.Second
+	FileChecksumTimeout       = 10 * time.Minute
+)
+
 func (mw *MetaWrapper) GetRootIno(subdir string) (uint64, error) {
 	rootIno := proto.RootIno
+	if mw.tokenRootIno != 0 {
+		// the scoped token confines the mount under its sub directory, which is walked from the root of the token
+		rootIno = mw.tokenRootIno
+		subdir = strings.TrimPrefix(path.Clean("/"+subdir), mw.tokenSubDir)
+	}
 	if subdir == "" || subdir == "/" {
 		return rootIno, nil
 	}
@@ -65,9 +82,55 @@ func (mw *MetaWrapper) GetRootIno(subdir string) (uint64, error) {
 	return rootIno, nil
 }
 
+// Statfs returns the capacity and the used space of the volume, in which the space preallocated to the files is
+// counted as used.
 func (mw *MetaWrapper) Statfs() (total, used uint64) {
 	total = atomic.LoadUint64(&mw.totalSize)
-	used = atomic.LoadUint64(&mw.usedSize)
+	used = atomic.LoadUint64(&mw.usedSize) + atomic.LoadUint64(&mw.reservedSize)
+	if used > total {
+		used = total
+	}
+	return
+}
+
+// VolStat is the statistics of the volume reported by statfs.
+type VolStat struct {
+	Total      uint64 // the capacity in bytes
+	Used       uint64 // the used bytes, including the space preallocated to the files
+	Inodes     uint64
+	FreeInodes uint64
+}
+
+// Add sums up the statistics of another volume.
+func (s *VolStat) Add(o *VolStat) {
+	s.Total += o.Total
+	s.Used += o.Used
+	s.Inodes = addInodes(s.Inodes, o.Inodes)
+	s.FreeInodes = addInodes(s.FreeInodes, o.FreeInodes)
+}
+
+// VolStat returns the statistics of the volume, which are refreshed from the master if they are older than
+// VolStatCacheTTL. The cached ones are returned if the refresh fails, which is not tried again within the TTL.
+func (mw *MetaWrapper) VolStat() (stat *VolStat) {
+	if time.Since(time.Unix(0, atomic.LoadInt64(&mw.statTime))) >= VolStatCacheTTL {
+		mw.statMutex.Lock()
+		// the statistics may be refreshed by another caller while waiting for the lock
+		if time.Since(time.Unix(0, atomic.LoadInt64(&mw.statTime))) >= VolStatCacheTTL {
+			if err := mw.updateVolStatInfo(); err != nil {
+				log.LogWarnf("VolStat: volume(%v) serves the cached capacity, err(%v)", mw.volname, err)
+			}
+			if err := mw.updateVolInodeInfo(); err != nil {
+				log.LogWarnf("VolStat: volume(%v) serves the cached inodes, err(%v)", mw.volname, err)
+			}
+			atomic.StoreInt64(&mw.statTime, time.Now().UnixNano())
+		}
+		mw.statMutex.Unlock()
+	}
+	stat = &VolStat{
+		Inodes:     atomic.LoadUint64(&mw.totalInodes),
+		FreeInodes: atomic.LoadUint64(&mw.freeInodes),
+	}
+	stat.Total, stat.Used = mw.Statfs()
 	return
 }
 
@@ -122,7 +185,7 @@ func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode, uid, gid ui
 	return nil, syscall.ENOMEM
 
 create_dentry:
-	status, err = mw.dcreate(parentMP, parentID, name, info.Inode, mode)
+	status, err = mw.dcreate(parentMP, parentID, name, info.Inode, mode, false)
 	if err != nil {
 		return nil, statusToErrno(status)
 	} else if status != statusOK {
@@ -339,7 +402,7 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*pro
 		}
 	}
 
-	status, inode, err = mw.ddelete(parentMP, parentID, name)
+	status, inode, err = mw.ddelete(parentMP, parentID, name, false)
 	if err != nil || status != statusOK {
 		if status == statusNoent {
 			return nil, nil
@@ -364,6 +427,9 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*pro
 func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID uint64, dstName string) (err error) {
 	var oldInode uint64
 
+	// the dentries are synced by the raft barriers of the meta partitions on a volume with SyncOnRename
+	barrier := mw.SyncOnRename()
+
 	srcParentMP := mw.getPartitionByInode(srcParentID)
 	if srcParentMP == nil {
 		return syscall.ENOENT
@@ -389,14 +455,14 @@ func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID
 	}
 
 	// create dentry in dst parent
-	status, err = mw.dcreate(dstParentMP, dstParentID, dstName, inode, mode)
+	status, err = mw.dcreate(dstParentMP, dstParentID, dstName, inode, mode, barrier)
 	if err != nil {
 		return syscall.EAGAIN
 	}
 
 	// Note that only regular files are allowed to be overwritten.
 	if status == statusExist && proto.IsRegular(mode) {
-		status, oldInode, err = mw.dupdate(dstParentMP, dstParentID, dstName, inode)
+		status, oldInode, err = mw.dupdate(dstParentMP, dstParentID, dstName, inode, barrier)
 		if err != nil {
 			return syscall.EAGAIN
 		}
@@ -408,7 +474,7 @@ func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID
 	}
 
 	// delete dentry from src parent
-	status, _, err = mw.ddelete(srcParentMP, srcParentID, srcName)
+	status, _, err = mw.ddelete(srcParentMP, srcParentID, srcName, barrier)
 	if err != nil {
 		return statusToErrno(status)
 	} else if status != statusOK {
@@ -417,9 +483,9 @@ func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID
 			e   error
 		)
 		if oldInode == 0 {
-			sts, _, e = mw.ddelete(dstParentMP, dstParentID, dstName)
+			sts, _, e = mw.ddelete(dstParentMP, dstParentID, dstName, false)
 		} else {
-			sts, _, e = mw.dupdate(dstParentMP, dstParentID, dstName, oldInode)
+			sts, _, e = mw.dupdate(dstParentMP, dstParentID, dstName, oldInode, false)
 		}
 		if e == nil && sts == statusOK {
 			mw.iunlink(srcMP, inode)
@@ -441,6 +507,108 @@ func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID
 	return nil
 }
 
+// BatchRename moves the dentries of the items from the source directory to the destination directory, which is used
+// to publish a set of files at once. The inode and type of each item must be the ones of the source dentry, and only
+// regular files are allowed to be overwritten. The readers of the destination directory observe either none or all
+// of the dentries moved.
+//
+// If both directories belong to the same meta partition, the dentries are moved by one atomic operation. Otherwise
+// the inodes are linked first, then the destination dentries are linked at once and the source dentries are unlinked
+// at last. A failure of the last step leaves the files linked in both directories, which is reported to the caller
+// and can be retried.
+func (mw *MetaWrapper) BatchRename(srcParentID, dstParentID uint64, items []proto.BatchRenameItem) (err error) {
+	if len(items) == 0 {
+		return nil
+	}
+	srcParentMP := mw.getPartitionByInode(srcParentID)
+	if srcParentMP == nil {
+		return syscall.ENOENT
+	}
+	dstParentMP := mw.getPartitionByInode(dstParentID)
+	if dstParentMP == nil {
+		return syscall.ENOENT
+	}
+
+	var (
+		status int
+		resp   *proto.BatchRenameResponse
+	)
+	if srcParentMP == dstParentMP {
+		status, resp, err = mw.batchRename(srcParentMP, srcParentID, dstParentID, items)
+		if err != nil || status != statusOK {
+			log.LogErrorf("BatchRename: src(%v) dst(%v) items(%v) err(%v) status(%v)", srcParentID, dstParentID, len(items), err, status)
+			return statusToErrno(status)
+		}
+		mw.unlinkReplacedInodes(resp.Replaced)
+		return nil
+	}
+
+	// keep the moved inodes alive while they are linked in both directories, and drop the links not taken by the
+	// dentries at last
+	var linked []uint64
+	defer func() {
+		for _, ino := range linked {
+			if mp := mw.getPartitionByInode(ino); mp != nil {
+				mw.iunlink(mp, ino)
+			}
+		}
+	}()
+	for _, item := range items {
+		mp := mw.getPartitionByInode(item.Inode)
+		if mp == nil {
+			return syscall.ENOENT
+		}
+		if status, _, err = mw.ilink(mp, item.Inode); err != nil || status != statusOK {
+			log.LogErrorf("BatchRename: ilink ino(%v) err(%v) status(%v)", item.Inode, err, status)
+			return statusToErrno(status)
+		}
+		linked = append(linked, item.Inode)
+	}
+
+	status, resp, err = mw.batchRename(dstParentMP, 0, dstParentID, items)
+	if err != nil || status != statusOK {
+		log.LogErrorf("BatchRename: link dst(%v) items(%v) err(%v) status(%v)", dstParentID, len(items), err, status)
+		return statusToErrno(status)
+	}
+	mw.unlinkReplacedInodes(resp.Replaced)
+	// the dentries linked by a former attempt already hold their links
+	linked = subtractInodes(linked, resp.Moved)
+
+	status, resp, err = mw.batchRename(srcParentMP, srcParentID, 0, items)
+	if err != nil || status != statusOK {
+		log.LogErrorf("BatchRename: unlink src(%v) items(%v) err(%v) status(%v)", srcParentID, len(items), err, status)
+		return statusToErrno(status)
+	}
+	linked = append(linked, resp.Moved...)
+	return nil
+}
+
+// subtractInodes returns the inodes of a which are not in b, counting the duplicated ones.
+func subtractInodes(a, b []uint64) (diff []uint64) {
+	count := make(map[uint64]int, len(b))
+	for _, ino := range b {
+		count[ino]++
+	}
+	for _, ino := range a {
+		if count[ino] > 0 {
+			count[ino]--
+			continue
+		}
+		diff = append(diff, ino)
+	}
+	return
+}
+
+func (mw *MetaWrapper) unlinkReplacedInodes(replaced []uint64) {
+	for _, ino := range replaced {
+		if mp := mw.getPartitionByInode(ino); mp != nil {
+			mw.iunlink(mp, ino)
+			// evict the replaced inode to avoid it becomes orphan inode
+			mw.ievict(mp, ino)
+		}
+	}
+}
+
 func (mw *MetaWrapper) ReadDir_ll(parentID uint64) ([]proto.Dentry, error) {
 	parentMP := mw.getPartitionByInode(parentID)
 	if parentMP == nil {
@@ -461,7 +629,7 @@ func (mw *MetaWrapper) DentryCreate_ll(parentID uint64, name string, inode uint6
 	}
 	var err error
 	var status int
-	if status, err = mw.dcreate(parentMP, parentID, name, inode, mode); err != nil || status != statusOK {
+	if status, err = mw.dcreate(parentMP, parentID, name, inode, mode, false); err != nil || status != statusOK {
 		return statusToErrno(status)
 	}
 	return nil
@@ -474,7 +642,7 @@ func (mw *MetaWrapper) DentryUpdate_ll(parentID uint64, name string, inode uint6
 		return
 	}
 	var status int
-	status, oldInode, err = mw.dupdate(parentMP, parentID, name, inode)
+	status, oldInode, err = mw.dupdate(parentMP, parentID, name, inode, false)
 	if err != nil || status != statusOK {
 		err = statusToErrno(status)
 		return
@@ -544,6 +712,39 @@ func (mw *MetaWrapper) Truncate(inode, size uint64) error {
 
 }
 
+// Fallocate preallocates the space of the file up to offset+length without changing the file size. The space which
+// is not preallocated yet is reserved against the capacity of the volume, and ENOSPC is returned early if the volume
+// does not have enough space left for it.
+func (mw *MetaWrapper) Fallocate(inode, offset, length uint64) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("Fallocate: No inode partition, ino(%v)", inode)
+		return syscall.ENOENT
+	}
+
+	info, err := mw.InodeGet_ll(inode)
+	if err != nil {
+		return err
+	}
+	end, allocated := offset+length, info.Size
+	if info.Reserved > allocated {
+		allocated = info.Reserved
+	}
+	if end > allocated {
+		if total, used := mw.Statfs(); used+end-allocated > total {
+			log.LogWarnf("Fallocate: no space left, ino(%v) end(%v) allocated(%v) total(%v) used(%v)",
+				inode, end, allocated, total, used)
+			return syscall.ENOSPC
+		}
+	}
+
+	status, err := mw.fallocate(mp, inode, offset, length)
+	if err != nil || status != statusOK {
+		return statusToErrno(status)
+	}
+	return nil
+}
+
 func (mw *MetaWrapper) Link(parentID uint64, name string, ino uint64) (*proto.InodeInfo, error) {
 	parentMP := mw.getPartitionByInode(parentID)
 	if parentMP == nil {
@@ -564,7 +765,7 @@ func (mw *MetaWrapper) Link(parentID uint64, name string, ino uint64) (*proto.In
 	}
 
 	// create new dentry and refer to the inode
-	status, err = mw.dcreate(parentMP, parentID, name, ino, info.Mode)
+	status, err = mw.dcreate(parentMP, parentID, name, ino, info.Mode, false)
 	if err != nil {
 		return nil, statusToErrno(status)
 	} else if status != statusOK {
@@ -591,7 +792,7 @@ func (mw *MetaWrapper) Evict(inode uint64) error {
 	return nil
 }
 
-func (mw *MetaWrapper) Setattr(inode uint64, valid, mode, uid, gid uint32, atime, mtime int64) error {
+func (mw *MetaWrapper) Setattr(inode uint64, valid, mode, uid, gid uint32, atime, mtime time.Time) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogErrorf("Setattr: No such partition, ino(%v)", inode)
@@ -902,3 +1103,105 @@ func (mw *MetaWrapper) XAttrsList_ll(inode uint64) ([]string, error) {
 
 	return keys, nil
 }
+
+// FileChecksum_ll is a low-level meta api that returns the SHA256 checksum of the file in hex. The checksum is
+// computed by the meta node with the data nodes if it is absent or stale, which is waited for up to
+// FileChecksumTimeout.
+func (mw *MetaWrapper) FileChecksum_ll(inode uint64) (checksum string, err error) {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("FileChecksum_ll: no such partition, inode(%v)", inode)
+		return "", syscall.ENOENT
+	}
+	deadline := time.Now().Add(FileChecksumTimeout)
+	for {
+		resp, status, e := mw.fileChecksum(mp, inode)
+		if e == nil && status == statusOK {
+			return resp.Checksum, nil
+		}
+		if e != nil || status != statusAgain || time.Now().After(deadline) {
+			log.LogErrorf("FileChecksum_ll: inode(%v) status(%v) err(%v)", inode, status, e)
+			return "", statusToErrno(status)
+		}
+		time.Sleep(FileChecksumRetryInterval)
+	}
+}
+
+// DedupRegister indexes the blocks written to the file, so that the same blocks written later are deduplicated.
+func (mw *MetaWrapper) DedupRegister(inode uint64, blocks []proto.DedupBlock) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		return syscall.ENOENT
+	}
+	status, err := mw.dedupRegister(mp, inode, blocks)
+	if err != nil || status != statusOK {
+		log.LogErrorf("DedupRegister: ino(%v) blocks(%v) err(%v) status(%v)", inode, len(blocks), err, status)
+		return statusToErrno(status)
+	}
+	return nil
+}
+
+// DedupReference appends the indexed block of the fingerprint to the file at the offset. It returns ENOENT if the
+// fingerprint is not indexed, in which case the block must be written.
+func (mw *MetaWrapper) DedupReference(inode uint64, fingerprint []byte, fileOffset uint64) (ek proto.ExtentKey, err error) {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		return ek, syscall.ENOENT
+	}
+	status, ek, err := mw.dedupReference(mp, inode, fingerprint, fileOffset)
+	if err != nil || status != statusOK {
+		if err != nil {
+			log.LogErrorf("DedupReference: ino(%v) offset(%v) err(%v) status(%v)", inode, fileOffset, err, status)
+		}
+		return ek, statusToErrno(status)
+	}
+	return ek, nil
+}
+
+// ListTag_ll is a low-level meta api that lists the tags of the volume if tag is empty,
+// otherwise lists the entries attached with the specified tag.
+func (mw *MetaWrapper) ListTag_ll(tag string) (tags []string, entries []*proto.TagEntry, err error) {
+	mw.RLock()
+	partitions := make([]*MetaPartition, 0, len(mw.partitions))
+	for _, mp := range mw.partitions {
+		partitions = append(partitions, mp)
+	}
+	mw.RUnlock()
+
+	var wg = sync.WaitGroup{}
+	var wl = sync.Mutex{}
+	var tagSet = make(map[string]struct{})
+	entries = make([]*proto.TagEntry, 0)
+
+	for _, mp := range partitions {
+		wg.Add(1)
+		go func(mp *MetaPartition) {
+			defer wg.Done()
+			resp, status, e := mw.listTag(mp, tag)
+			wl.Lock()
+			defer wl.Unlock()
+			if e != nil || status != statusOK {
+				log.LogErrorf("ListTag_ll: partition list tag fail, partitionID(%v) tag(%v) err(%v) status(%v)",
+					mp.PartitionID, tag, e, status)
+				err = statusToErrno(status)
+				return
+			}
+			for _, t := range resp.Tags {
+				tagSet[t] = struct{}{}
+			}
+			entries = append(entries, resp.Entries...)
+		}(mp)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags = make([]string, 0, len(tagSet))
+	for t := range tagSet {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Inode < entries[j].Inode })
+	return tags, entries, nil
+}
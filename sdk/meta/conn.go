@@ -17,6 +17,8 @@ package meta
 import (
 	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -30,36 +32,102 @@ const (
 	SendRetryLimit    = 100
 	SendRetryInterval = 100 * time.Millisecond
 	SendTimeLimit     = 20 * time.Second
+
+	// The mutations refused by a frozen volume are held back for up to FrozenWaitLimit in case the volume is thawed
+	// soon, and fail with EBUSY afterwards.
+	FrozenRetryInterval = 500 * time.Millisecond
+	FrozenWaitLimit     = 10 * time.Second
+
+	// MetaCacheRetryInterval is the interval to send the requests directly to the meta nodes once a meta cache
+	// node is failed to connect.
+	MetaCacheRetryInterval = 30 * time.Second
 )
 
+// The message responded by the meta node which does not serve the meta partition.
+const partitionNotServingMsg = "unknown meta partition"
+
 type MetaConn struct {
-	conn *net.TCPConn
-	id   uint64 //PartitionID
-	addr string //MetaNode addr
+	conn   *net.TCPConn
+	id     uint64    //PartitionID
+	addr   string    //MetaNode addr, or the meta cache node addr if proxied
+	target string    //MetaNode addr to be forwarded to by the meta cache node
+	token  string    //delegated token attached to the requests
+	caps   *sync.Map //capabilities of the inodes granted with a scoped token, nil without
 }
 
 // Connection managements
 //
 
 func (mc *MetaConn) String() string {
+	if mc.target != "" {
+		return fmt.Sprintf("partitionID(%v) addr(%v) target(%v)", mc.id, mc.addr, mc.target)
+	}
 	return fmt.Sprintf("partitionID(%v) addr(%v)", mc.id, mc.addr)
 }
 
 func (mw *MetaWrapper) getConn(partitionID uint64, addr string) (*MetaConn, error) {
+	if cacheAddr := mw.getMetaCacheNode(partitionID); cacheAddr != "" {
+		conn, err := mw.conns.GetConnect(cacheAddr)
+		if err == nil {
+			return &MetaConn{conn: conn, id: partitionID, addr: cacheAddr, target: addr, token: mw.delegatedToken,
+				caps: mw.scopedInodeCaps()}, nil
+		}
+		mw.metaCacheFailures.Store(cacheAddr, time.Now())
+		log.LogWarnf("GetConnect meta cache: addr(%v) err(%v), send to (%v) directly for (%v)",
+			cacheAddr, err, addr, MetaCacheRetryInterval)
+	}
 	conn, err := mw.conns.GetConnect(addr)
 	if err != nil {
 		log.LogWarnf("GetConnect conn: addr(%v) err(%v)", addr, err)
 		return nil, err
 	}
-	mc := &MetaConn{conn: conn, id: partitionID, addr: addr}
+	mc := &MetaConn{conn: conn, id: partitionID, addr: addr, token: mw.delegatedToken, caps: mw.scopedInodeCaps()}
 	return mc, nil
 }
 
+// scopedInodeCaps returns the capabilities of the inodes if the volume is mounted with a scoped token, or nil.
+func (mw *MetaWrapper) scopedInodeCaps() *sync.Map {
+	if mw.tokenRootIno == 0 {
+		return nil
+	}
+	return &mw.inodeCaps
+}
+
 func (mw *MetaWrapper) putConn(mc *MetaConn, err error) {
 	mw.conns.PutConnect(mc.conn, err != nil)
 }
 
-func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet) (*proto.Packet, error) {
+// getMetaCacheNode returns the meta cache node to proxy the requests of the meta partition, or an empty string if
+// the requests should be sent to the meta nodes directly.
+func (mw *MetaWrapper) getMetaCacheNode(partitionID uint64) string {
+	mw.RLock()
+	addr := proto.MetaCacheNodeFor(mw.metaCacheNodes, partitionID)
+	mw.RUnlock()
+	if addr == "" {
+		return ""
+	}
+	if failure, ok := mw.metaCacheFailures.Load(addr); ok {
+		if time.Since(failure.(time.Time)) < MetaCacheRetryInterval {
+			return ""
+		}
+		mw.metaCacheFailures.Delete(addr)
+	}
+	return addr
+}
+
+func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet) (resp *proto.Packet, err error) {
+	start := time.Now()
+	for {
+		resp, err = mw.trySendToMetaPartition(mp, req)
+		if err != nil || resp.ResultCode != proto.OpVolFrozen || time.Since(start) > FrozenWaitLimit {
+			return
+		}
+		log.LogWarnf("sendToMetaPartition: vol frozen req(%v) mp(%v) retry in (%v)", req, mp, FrozenRetryInterval)
+		time.Sleep(FrozenRetryInterval)
+	}
+}
+
+func (mw *MetaWrapper) trySendToMetaPartition(mp *MetaPartition, req *proto.Packet) (*proto.Packet, error) {
 	var (
 		resp  *proto.Packet
 		err   error
@@ -84,11 +152,18 @@ func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet)
 	if err == nil && !resp.ShouldRetry() {
 		goto out
 	}
+	if err == nil && isPartitionNotServing(resp) {
+		mw.invalidatePartition(mp)
+	}
 	log.LogWarnf("sendToMetaPartition: leader failed req(%v) mp(%v) mc(%v) err(%v) resp(%v)", req, mp, mc, err, resp)
 
 retry:
 	start = time.Now()
 	for i := 0; i < SendRetryLimit; i++ {
+		// the routing table might have been updated since the partition was invalidated
+		if latest := mw.getPartitionByID(mp.PartitionID); latest != nil {
+			mp = latest
+		}
 		for j, addr = range mp.Members {
 			mc, err = mw.getConn(mp.PartitionID, addr)
 			errs[j] = err
@@ -100,6 +175,9 @@ retry:
 			if err == nil && !resp.ShouldRetry() {
 				goto out
 			}
+			if err == nil && isPartitionNotServing(resp) {
+				mw.invalidatePartition(mp)
+			}
 			if err == nil {
 				errs[j] = errors.New(fmt.Sprintf("request should retry[%v]", resp.GetResultMsg()))
 			} else {
@@ -119,11 +197,21 @@ out:
 	if err != nil || resp == nil {
 		return nil, errors.New(fmt.Sprintf("sendToMetaPartition failed: req(%v) mp(%v) errs(%v) resp(%v)", req, mp, errs, resp))
 	}
+	if resp.IsDegradedReply() {
+		log.LogWarnf("sendToMetaPartition: possibly stale reply from degraded partition, req(%v) mp(%v) mc(%v)", req, mp, mc)
+	}
 	log.LogDebugf("sendToMetaPartition successful: req(%v) mc(%v) resp(%v)", req, mc, resp)
 	return resp, nil
 }
 
+func isPartitionNotServing(resp *proto.Packet) bool {
+	return resp.ResultCode == proto.OpErr && strings.Contains(string(resp.Data), partitionNotServingMsg)
+}
+
 func (mc *MetaConn) send(req *proto.Packet) (resp *proto.Packet, err error) {
+	// the meta cache node forwards the request to the meta node in the arg
+	req.Arg = proto.AttachDelegatedToken(mc.attachInodeCaps([]byte(mc.target), req), mc.token)
+	req.ArgLen = uint32(len(req.Arg))
 	err = req.WriteToConn(mc.conn)
 	if err != nil {
 		return nil, errors.Trace(err, "Failed to write to conn, req(%v)", req)
@@ -139,5 +227,37 @@ func (mc *MetaConn) send(req *proto.Packet) (resp *proto.Packet, err error) {
 			mc.conn.LocalAddr(), mc.conn.RemoteAddr(), req, resp)
 		return nil, syscall.EBADMSG
 	}
+	mc.recordInodeCaps(resp)
 	return resp, nil
 }
+
+// attachInodeCaps appends the capabilities of the inodes the request refers to, with a scoped token.
+func (mc *MetaConn) attachInodeCaps(arg []byte, req *proto.Packet) []byte {
+	if mc.caps == nil {
+		return arg
+	}
+	inodes, err := proto.RequestInodes(req.Data[:req.Size])
+	if err != nil {
+		return arg
+	}
+	caps := make(map[uint64]string, len(inodes))
+	for _, ino := range inodes {
+		if c, ok := mc.caps.Load(ino); ok {
+			caps[ino] = c.(string)
+		}
+	}
+	return proto.AttachInodeCaps(arg, caps)
+}
+
+// recordInodeCaps records the capabilities of the inodes granted in the arg of the response, with a scoped token.
+func (mc *MetaConn) recordInodeCaps(resp *proto.Packet) {
+	if mc.caps == nil || resp.ArgLen == 0 {
+		return
+	}
+	// the meta nodes echo the arg of the request if they grant none
+	arg, _ := proto.DetachDelegatedToken(resp.Arg[:resp.ArgLen])
+	_, caps := proto.DetachInodeCaps(arg)
+	for ino, c := range caps {
+		mc.caps.Store(ino, c)
+	}
+}
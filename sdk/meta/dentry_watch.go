@@ -0,0 +1,106 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// DentryInvalidator is called with the dentry changed by the other clients. An empty name means that all the
+// dentries of the directory are invalidated.
+type DentryInvalidator func(parentID uint64, name string)
+
+type dentryWatch struct {
+	sync.Mutex
+	clientID    string
+	dirs        map[uint64]time.Time // directory inode -> expiration
+	invalidator DentryInvalidator
+}
+
+// StartDentryWatch starts to poll the meta partitions at the interval for the dentries changed in the directories
+// passed to WatchDir, and calls the invalidator with them.
+func (mw *MetaWrapper) StartDentryWatch(interval time.Duration, invalidator DentryInvalidator) {
+	mw.dentryWatch = &dentryWatch{
+		clientID:    fmt.Sprintf("%v:%v:%v", mw.localIP, os.Getpid(), time.Now().UnixNano()),
+		dirs:        make(map[uint64]time.Time),
+		invalidator: invalidator,
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-mw.closeCh:
+				return
+			case <-t.C:
+				mw.pollDentryWatch()
+			}
+		}
+	}()
+}
+
+// WatchDir watches the dentries of the directory for the duration, during which they are cached by the caller.
+func (mw *MetaWrapper) WatchDir(parentID uint64, duration time.Duration) {
+	w := mw.dentryWatch
+	if w == nil {
+		return
+	}
+	w.Lock()
+	w.dirs[parentID] = time.Now().Add(duration)
+	w.Unlock()
+}
+
+// watchedDirs returns the unexpired watched directories grouped by the meta partitions.
+func (mw *MetaWrapper) watchedDirs() map[*MetaPartition][]uint64 {
+	w := mw.dentryWatch
+	now := time.Now()
+	groups := make(map[*MetaPartition][]uint64)
+	w.Lock()
+	defer w.Unlock()
+	for dir, expire := range w.dirs {
+		if expire.Before(now) {
+			delete(w.dirs, dir)
+			continue
+		}
+		mp := mw.getPartitionByInode(dir)
+		if mp == nil {
+			continue
+		}
+		groups[mp] = append(groups[mp], dir)
+	}
+	return groups
+}
+
+func (mw *MetaWrapper) pollDentryWatch() {
+	w := mw.dentryWatch
+	for mp, dirs := range mw.watchedDirs() {
+		resp, status, err := mw.watchDentry(mp, w.clientID, dirs)
+		if err != nil || status != statusOK {
+			log.LogWarnf("pollDentryWatch: mp(%v) dirs(%v) status(%v) err(%v)", mp, len(dirs), status, err)
+			continue
+		}
+		for _, dir := range resp.Overflow {
+			w.invalidator(dir, "")
+		}
+		for _, dentry := range resp.Dentries {
+			w.invalidator(dentry.ParentID, dentry.Name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// registerClient registers the client to the master, which rejects it if the volume has reached the maximum number
+// of the mounted clients. The other failures, e.g., the master not supporting the registration, do not fail the
+// mount, and the registration is done by the renewals later.
+func (mw *MetaWrapper) registerClient() error {
+	mw.clientID = fmt.Sprintf("%v_%v_%v", mw.localIP, os.Getpid(), time.Now().UnixNano())
+	err := mw.mc.ClientAPI().RegisterClient(mw.volname, mw.clientID, false)
+	if err == proto.ErrTooManyClients {
+		return fmt.Errorf("mount volume(%v) rejected: %v, ask the administrator to raise its maxClients", mw.volname, err)
+	}
+	if err != nil {
+		log.LogWarnf("registerClient: volume(%v) client(%v) err(%v)", mw.volname, mw.clientID, err)
+	}
+	go mw.renewClientLease()
+	return nil
+}
+
+func (mw *MetaWrapper) renewClientLease() {
+	t := time.NewTicker(proto.ClientLeaseInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := mw.mc.ClientAPI().RegisterClient(mw.volname, mw.clientID, true); err != nil {
+				log.LogWarnf("renewClientLease: volume(%v) client(%v) err(%v)", mw.volname, mw.clientID, err)
+			}
+		case <-mw.closeCh:
+			return
+		}
+	}
+}
+
+func (mw *MetaWrapper) unregisterClient() {
+	if mw.clientID == "" {
+		return
+	}
+	if err := mw.mc.ClientAPI().UnregisterClient(mw.volname, mw.clientID); err != nil {
+		log.LogWarnf("unregisterClient: volume(%v) client(%v) err(%v)", mw.volname, mw.clientID, err)
+	}
+}
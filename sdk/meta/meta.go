@@ -16,7 +16,10 @@ package meta
 
 import (
 	"fmt"
+	"math/rand"
+	"os"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -29,11 +32,13 @@ import (
 	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/btree"
 	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
 )
 
 const (
 	HostsSeparator                = ","
 	RefreshMetaPartitionsInterval = time.Minute * 5
+	VolStatCacheTTL               = time.Second * 5 // how long the statistics refreshed for statfs are reused
 )
 
 const (
@@ -46,6 +51,9 @@ const (
 	statusError
 	statusInval
 	statusNotPerm
+	statusFrozen
+	statusTimeout
+	statusNameTooLong
 )
 
 const (
@@ -75,6 +83,13 @@ type MetaConfig struct {
 	TicketMess       auth.TicketMess
 	ValidateOwner    bool
 	OnAsyncTaskError AsyncTaskErrorFunc
+	// SkipVolGate mounts the volume even if the client is incompatible with it, for emergencies.
+	SkipVolGate bool
+	// DelegatedToken is the token minted by the owner, which is used instead of the auth key of the owner.
+	DelegatedToken string
+	// AsOf reads the volume as of the time in unix seconds from the snapshots retained by the meta nodes, 0 to read
+	// the current volume.
+	AsOf int64
 }
 
 type MetaWrapper struct {
@@ -84,6 +99,10 @@ type MetaWrapper struct {
 	volname         string
 	ossSecure       *OSSSecure
 	volCreateTime   int64
+	minVersion      string
+	volFeatures     map[string]bool
+	shadow          *proto.VolShadowView
+	syncOnRename    bool
 	owner           string
 	ownerValidation bool
 	mc              *masterSDK.MasterClient
@@ -103,11 +122,19 @@ type MetaWrapper struct {
 	// a specific inode locate.
 	ranges *btree.BTree
 
+	// Version of the routing table, i.e. partitions and ranges, increased on each update.
+	version uint64
+
 	rwPartitions []*MetaPartition
 	epoch        uint64
 
-	totalSize uint64
-	usedSize  uint64
+	totalSize    uint64
+	usedSize     uint64
+	reservedSize uint64 // the space preallocated to the files which is not written yet
+	totalInodes  uint64 // the inode IDs of all the meta partitions
+	freeInodes   uint64 // the inode IDs not allocated by the cursors of the meta partitions yet
+	statTime     int64  // the unix nano of the last attempt to refresh the statistics for statfs
+	statMutex    sync.Mutex
 
 	authenticate bool
 	Ticket       auth.Ticket
@@ -125,6 +152,37 @@ type MetaWrapper struct {
 	// Used to trigger and throttle instant partition updates
 	forceUpdate      chan struct{}
 	forceUpdateLimit *rate.Limiter
+
+	// Used to invalidate the dentries cached by the caller once they are changed by the other clients
+	dentryWatch *dentryWatch
+
+	// The meta cache nodes proxying the requests if the meta cache is enabled on the volume
+	metaCacheNodes    []string
+	metaCacheFailures sync.Map // address -> time of the last failure to connect
+
+	// The unique ID of the client registered to the master, which limits the mounted clients of the volume
+	clientID string
+
+	// The time in unix seconds to read the volume as of, 0 to read the current volume
+	asOf int64
+
+	// The delegated token attached to the requests to the meta nodes
+	delegatedToken string
+
+	// The root inode and the sub directory of a scoped delegated token, under which the meta nodes confine the
+	// requests, and the capabilities of the inodes granted by the meta nodes, which are presented in the requests
+	tokenRootIno uint64
+	tokenSubDir  string
+	inodeCaps    sync.Map // inode -> capability
+
+	// The request IDs of the mutations, by which the meta nodes recognize the retries of the applied mutations
+	reqIDPrefix string
+	reqIDSeq    uint64
+}
+
+// newReqID returns a request ID unique among the clients for a mutation, which is kept across its retries.
+func (mw *MetaWrapper) newReqID() string {
+	return fmt.Sprintf("%v_%x", mw.reqIDPrefix, atomic.AddUint64(&mw.reqIDSeq, 1))
 }
 
 //the ticket from authnode
@@ -158,6 +216,14 @@ func NewMetaWrapper(config *MetaConfig) (*MetaWrapper, error) {
 	mw.volname = config.Volume
 	mw.owner = config.Owner
 	mw.ownerValidation = config.ValidateOwner
+	mw.delegatedToken = config.DelegatedToken
+	if config.DelegatedToken != "" {
+		if t, err := proto.DecodeDelegatedToken(config.DelegatedToken); err == nil && t.Scoped() {
+			mw.tokenRootIno, mw.tokenSubDir = t.RootInode, t.SubDir
+		}
+	}
+	mw.asOf = config.AsOf
+	mw.reqIDPrefix = fmt.Sprintf("%x_%x_%x", os.Getpid(), time.Now().UnixNano(), rand.Uint32())
 	mw.mc = masterSDK.NewMasterClient(config.Masters, false)
 	mw.onAsyncTaskError = config.OnAsyncTaskError
 	mw.conns = util.NewConnectPool()
@@ -189,6 +255,17 @@ func NewMetaWrapper(config *MetaConfig) (*MetaWrapper, error) {
 		return nil, err
 	}
 
+	if err = mw.checkClientCompatibility(); err != nil {
+		if !config.SkipVolGate {
+			return nil, err
+		}
+		log.LogWarnf("NewMetaWrapper: skip the volume gate: volume(%v) err(%v)", mw.volname, err)
+	}
+
+	if err = mw.registerClient(); err != nil {
+		return nil, err
+	}
+
 	go mw.refresh()
 	return mw, nil
 }
@@ -221,14 +298,55 @@ func (mw *MetaWrapper) VolCreateTime() int64 {
 	return mw.volCreateTime
 }
 
+func (mw *MetaWrapper) checkClientCompatibility() error {
+	mw.RLock()
+	defer mw.RUnlock()
+	return proto.CheckClientCompatibility(proto.Version, mw.minVersion, mw.volFeatures)
+}
+
+// VolFeatureDisabled returns true if the feature must not be used on the volume.
+func (mw *MetaWrapper) VolFeatureDisabled(feature string) bool {
+	mw.RLock()
+	defer mw.RUnlock()
+	required, ok := mw.volFeatures[feature]
+	return ok && !required
+}
+
+// VolFeatureRequired returns true if the feature must be used on the volume.
+func (mw *MetaWrapper) VolFeatureRequired(feature string) bool {
+	mw.RLock()
+	defer mw.RUnlock()
+	return mw.volFeatures[feature]
+}
+
+// SyncOnRename returns true if the renames of the volume must be durable once they return.
+func (mw *MetaWrapper) SyncOnRename() bool {
+	mw.RLock()
+	defer mw.RUnlock()
+	return mw.syncOnRename
+}
+
+// Shadow returns the shadow volume the volume is replicated to, nil if there is none.
+func (mw *MetaWrapper) Shadow() *proto.VolShadowView {
+	mw.RLock()
+	defer mw.RUnlock()
+	return mw.shadow
+}
+
 func (mw *MetaWrapper) Close() error {
 	mw.closeOnce.Do(func() {
 		close(mw.closeCh)
 		mw.conns.Close()
+		mw.unregisterClient()
 	})
 	return nil
 }
 
+// ClientID returns the ID the client is registered with to the master.
+func (mw *MetaWrapper) ClientID() string {
+	return mw.clientID
+}
+
 func (mw *MetaWrapper) Cluster() string {
 	return mw.cluster
 }
@@ -254,36 +372,40 @@ func parseStatus(result uint8) (status int) {
 		status = statusFull
 	case proto.OpAgain:
 		status = statusAgain
-	case proto.OpArgMismatchErr:
+	case proto.OpArgMismatchErr, proto.OpInvalidName:
 		status = statusInval
 	case proto.OpNotPerm:
 		status = statusNotPerm
+	case proto.OpVolFrozen:
+		status = statusFrozen
+	case proto.OpTimeout:
+		status = statusTimeout
+	case proto.OpNameTooLong:
+		status = statusNameTooLong
 	default:
 		status = statusError
 	}
 	return
 }
 
+// statusResultCodes maps the statuses back to the result codes, whose errnos are given by the error catalog.
+var statusResultCodes = map[int]uint8{
+	statusOK:          proto.OpAgain, // return error anyway
+	statusExist:       proto.OpExistErr,
+	statusNoent:       proto.OpNotExistErr,
+	statusFull:        proto.OpInodeFullErr,
+	statusAgain:       proto.OpAgain,
+	statusInval:       proto.OpArgMismatchErr,
+	statusNotPerm:     proto.OpNotPerm,
+	statusFrozen:      proto.OpVolFrozen,
+	statusTimeout:     proto.OpTimeout,
+	statusNameTooLong: proto.OpNameTooLong,
+	statusError:       proto.OpErr,
+}
+
 func statusToErrno(status int) error {
-	switch status {
-	case statusOK:
-		// return error anyway
-		return syscall.EAGAIN
-	case statusExist:
-		return syscall.EEXIST
-	case statusNoent:
-		return syscall.ENOENT
-	case statusFull:
-		return syscall.ENOMEM
-	case statusAgain:
-		return syscall.EAGAIN
-	case statusInval:
-		return syscall.EINVAL
-	case statusNotPerm:
-		return syscall.EPERM
-	case statusError:
-		return syscall.EAGAIN
-	default:
+	if code, ok := statusResultCodes[status]; ok {
+		return proto.ResultCodeErrno(code)
 	}
 	return syscall.EIO
 }
@@ -17,6 +17,7 @@ package meta
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/chubaofs/chubaofs/util/errors"
 
@@ -36,6 +37,7 @@ func (mw *MetaWrapper) icreate(mp *MetaPartition, mode, uid, gid uint32, target
 		Uid:         uid,
 		Gid:         gid,
 		Target:      target,
+		ReqID:       mw.newReqID(),
 	}
 
 	packet := proto.NewPacketReqID()
@@ -81,6 +83,7 @@ func (mw *MetaWrapper) iunlink(mp *MetaPartition, inode uint64) (status int, inf
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inode:       inode,
+		ReqID:       mw.newReqID(),
 	}
 
 	packet := proto.NewPacketReqID()
@@ -151,7 +154,7 @@ func (mw *MetaWrapper) ievict(mp *MetaPartition, inode uint64) (status int, err
 	return statusOK, nil
 }
 
-func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string, inode uint64, mode uint32) (status int, err error) {
+func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string, inode uint64, mode uint32, barrier bool) (status int, err error) {
 	if parentID == inode {
 		return statusExist, nil
 	}
@@ -163,6 +166,8 @@ func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string,
 		Inode:       inode,
 		Name:        name,
 		Mode:        mode,
+		ReqID:       mw.newReqID(),
+		Sync:        barrier,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -192,7 +197,7 @@ func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string,
 	return
 }
 
-func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string, newInode uint64) (status int, oldInode uint64, err error) {
+func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string, newInode uint64, barrier bool) (status int, oldInode uint64, err error) {
 	if parentID == newInode {
 		return statusExist, 0, nil
 	}
@@ -203,6 +208,8 @@ func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string,
 		ParentID:    parentID,
 		Name:        name,
 		Inode:       newInode,
+		ReqID:       mw.newReqID(),
+		Sync:        barrier,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -238,12 +245,14 @@ func (mw *MetaWrapper) dupdate(mp *MetaPartition, parentID uint64, name string,
 	return statusOK, resp.Inode, nil
 }
 
-func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string) (status int, inode uint64, err error) {
+func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string, barrier bool) (status int, inode uint64, err error) {
 	req := &proto.DeleteDentryRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		ParentID:    parentID,
 		Name:        name,
+		ReqID:       mw.newReqID(),
+		Sync:        barrier,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -285,6 +294,7 @@ func (mw *MetaWrapper) lookup(mp *MetaPartition, parentID uint64, name string) (
 		PartitionID: mp.PartitionID,
 		ParentID:    parentID,
 		Name:        name,
+		AsOf:        mw.asOf,
 	}
 	packet := proto.NewPacketReqID()
 	packet.Opcode = proto.OpMetaLookup
@@ -330,6 +340,7 @@ func (mw *MetaWrapper) iget(mp *MetaPartition, inode uint64) (status int, info *
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inode:       inode,
+		AsOf:        mw.asOf,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -373,6 +384,7 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inodes:      inodes,
+		AsOf:        mw.asOf,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -392,6 +404,14 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 	}
 
 	status := parseStatus(packet.ResultCode)
+	if status == statusTimeout && len(inodes) > 1 {
+		// the meta node can not get the batch within its timeout, get the halves instead
+		log.LogWarnf("batchIget: mp(%v) inodes(%v) timeout, split", mp, len(inodes))
+		wg.Add(2)
+		go mw.batchIget(wg, mp, inodes[:len(inodes)/2], respCh)
+		go mw.batchIget(wg, mp, inodes[len(inodes)/2:], respCh)
+		return
+	}
 	if status != statusOK {
 		log.LogErrorf("batchIget: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
 		return
@@ -415,10 +435,35 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 }
 
 func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int, children []proto.Dentry, err error) {
+	if status, children, err = mw.readdirPage(mp, parentID, "", 0); err != nil || status != statusTimeout {
+		return
+	}
+	// the meta node can not read the directory within its timeout, read it by pages instead
+	log.LogWarnf("readdir: mp(%v) parentID(%v) timeout, read by pages", mp, parentID)
+	children = make([]proto.Dentry, 0)
+	var marker string
+	for {
+		var page []proto.Dentry
+		if status, page, err = mw.readdirPage(mp, parentID, marker, ReadDirPageLimit); err != nil || status != statusOK {
+			return
+		}
+		children = append(children, page...)
+		if len(page) < ReadDirPageLimit {
+			return
+		}
+		marker = page[len(page)-1].Name
+	}
+}
+
+// readdirPage reads the children named after the marker, at most the limit of them, or all of them if the limit is 0.
+func (mw *MetaWrapper) readdirPage(mp *MetaPartition, parentID uint64, marker string, limit uint64) (status int, children []proto.Dentry, err error) {
 	req := &proto.ReadDirRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		ParentID:    parentID,
+		AsOf:        mw.asOf,
+		Marker:      marker,
+		Limit:       limit,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -492,6 +537,7 @@ func (mw *MetaWrapper) getExtents(mp *MetaPartition, inode uint64) (status int,
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inode:       inode,
+		AsOf:        mw.asOf,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -564,6 +610,44 @@ func (mw *MetaWrapper) truncate(mp *MetaPartition, inode, size uint64) (status i
 	return statusOK, nil
 }
 
+func (mw *MetaWrapper) fallocate(mp *MetaPartition, inode, offset, length uint64) (status int, err error) {
+	req := &proto.FallocateRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Offset:      offset,
+		Length:      length,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaFallocate
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("fallocate: ino(%v) offset(%v) length(%v) err(%v)", inode, offset, length, err)
+		return
+	}
+
+	log.LogDebugf("fallocate enter: packet(%v) mp(%v) req(%v)", packet, mp, string(packet.Data))
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("fallocate: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("fallocate: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("fallocate exit: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
+
 func (mw *MetaWrapper) ilink(mp *MetaPartition, inode uint64) (status int, info *proto.InodeInfo, err error) {
 	req := &proto.LinkInodeRequest{
 		VolName:     mw.volname,
@@ -611,17 +695,19 @@ func (mw *MetaWrapper) ilink(mp *MetaPartition, inode uint64) (status int, info
 	return statusOK, resp.Info, nil
 }
 
-func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid, gid uint32, atime, mtime int64) (status int, err error) {
+func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid, gid uint32, atime, mtime time.Time) (status int, err error) {
 	req := &proto.SetAttrRequest{
-		VolName:     mw.volname,
-		PartitionID: mp.PartitionID,
-		Inode:       inode,
-		Valid:       valid,
-		Mode:        mode,
-		Uid:         uid,
-		Gid:         gid,
-		AccessTime:  atime,
-		ModifyTime:  mtime,
+		VolName:        mw.volname,
+		PartitionID:    mp.PartitionID,
+		Inode:          inode,
+		Valid:          valid,
+		Mode:           mode,
+		Uid:            uid,
+		Gid:            gid,
+		AccessTime:     atime.Unix(),
+		ModifyTime:     mtime.Unix(),
+		AccessTimeNsec: uint32(atime.Nanosecond()),
+		ModifyTimeNsec: uint32(mtime.Nanosecond()),
 	}
 
 	packet := proto.NewPacketReqID()
@@ -927,6 +1013,7 @@ func (mw *MetaWrapper) getXAttr(mp *MetaPartition, inode uint64, name string) (v
 		PartitionId: mp.PartitionID,
 		Inode:       inode,
 		Key:         name,
+		AsOf:        mw.asOf,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -1003,6 +1090,7 @@ func (mw *MetaWrapper) listXAttr(mp *MetaPartition, inode uint64) (keys []string
 		VolName:     mw.volname,
 		PartitionId: mp.PartitionID,
 		Inode:       inode,
+		AsOf:        mw.asOf,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -1039,6 +1127,205 @@ func (mw *MetaWrapper) listXAttr(mp *MetaPartition, inode uint64) (keys []string
 	return
 }
 
+func (mw *MetaWrapper) listTag(mp *MetaPartition, tag string) (resp *proto.ListTagResponse, status int, err error) {
+	req := &proto.ListTagRequest{
+		VolName:     mw.volname,
+		PartitionId: mp.PartitionID,
+		Tag:         tag,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaListTag
+	if err = packet.MarshalData(req); err != nil {
+		log.LogErrorf("list tag: req(%v) err(%v)", *req, err)
+		return
+	}
+	log.LogDebugf("list tag: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	if packet, err = mw.sendToMetaPartition(mp, packet); err != nil {
+		log.LogErrorf("list tag: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("list tag: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp = new(proto.ListTagResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("list tag: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("list tag: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+	return
+}
+
+func (mw *MetaWrapper) watchDentry(mp *MetaPartition, clientID string, dirs []uint64) (resp *proto.WatchDentryResponse, status int, err error) {
+	req := &proto.WatchDentryRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		ClientID:    clientID,
+		Dirs:        dirs,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaWatchDentry
+	if err = packet.MarshalData(req); err != nil {
+		log.LogErrorf("watch dentry: req(%v) err(%v)", *req, err)
+		return
+	}
+	log.LogDebugf("watch dentry: packet(%v) mp(%v) dirs(%v)", packet, mp, len(dirs))
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	if packet, err = mw.sendToMetaPartition(mp, packet); err != nil {
+		log.LogErrorf("watch dentry: packet(%v) mp(%v) err(%v)", packet, mp, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("watch dentry: packet(%v) mp(%v) result(%v)", packet, mp, packet.GetResultMsg())
+		return
+	}
+
+	resp = new(proto.WatchDentryResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("watch dentry: packet(%v) mp(%v) err(%v) PacketData(%v)", packet, mp, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("watch dentry: packet(%v) mp(%v) dentries(%v) overflow(%v)", packet, mp, len(resp.Dentries), resp.Overflow)
+	return
+}
+
+func (mw *MetaWrapper) fileChecksum(mp *MetaPartition, inode uint64) (resp *proto.FileChecksumResponse, status int, err error) {
+	req := &proto.FileChecksumRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaFileChecksum
+	if err = packet.MarshalData(req); err != nil {
+		log.LogErrorf("file checksum: req(%v) err(%v)", *req, err)
+		return
+	}
+	log.LogDebugf("file checksum: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	if packet, err = mw.sendToMetaPartition(mp, packet); err != nil {
+		log.LogErrorf("file checksum: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogWarnf("file checksum: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp = new(proto.FileChecksumResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("file checksum: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("file checksum: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+	return
+}
+
+func (mw *MetaWrapper) dedupRegister(mp *MetaPartition, inode uint64, blocks []proto.DedupBlock) (status int, err error) {
+	req := &proto.DedupRegisterRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Blocks:      blocks,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaDedupRegister
+	if err = packet.MarshalData(req); err != nil {
+		log.LogErrorf("dedupRegister: ino(%v) err(%v)", inode, err)
+		return
+	}
+	log.LogDebugf("dedupRegister: packet(%v) mp(%v) ino(%v) blocks(%v)", packet, mp, inode, len(blocks))
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	if packet, err = mw.sendToMetaPartition(mp, packet); err != nil {
+		log.LogErrorf("dedupRegister: packet(%v) mp(%v) ino(%v) err(%v)", packet, mp, inode, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogWarnf("dedupRegister: packet(%v) mp(%v) ino(%v) result(%v)", packet, mp, inode, packet.GetResultMsg())
+		return
+	}
+
+	resp := new(proto.DedupRegisterResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("dedupRegister: packet(%v) mp(%v) ino(%v) err(%v) PacketData(%v)", packet, mp, inode, err, string(packet.Data))
+		return
+	}
+	log.LogDebugf("dedupRegister: packet(%v) mp(%v) ino(%v) registered(%v)", packet, mp, inode, resp.Registered)
+	return
+}
+
+func (mw *MetaWrapper) dedupReference(mp *MetaPartition, inode uint64, fingerprint []byte, fileOffset uint64) (status int, ek proto.ExtentKey, err error) {
+	req := &proto.DedupReferenceRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Fingerprint: fingerprint,
+		FileOffset:  fileOffset,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaDedupReference
+	if err = packet.MarshalData(req); err != nil {
+		log.LogErrorf("dedupReference: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	if packet, err = mw.sendToMetaPartition(mp, packet); err != nil {
+		log.LogErrorf("dedupReference: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		if status != statusNoent {
+			log.LogWarnf("dedupReference: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		}
+		return
+	}
+
+	resp := new(proto.DedupReferenceResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("dedupReference: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+	ek = resp.Extent
+	log.LogDebugf("dedupReference: packet(%v) mp(%v) req(%v) ek(%v)", packet, mp, *req, ek)
+	return
+}
+
 func (mw *MetaWrapper) listMultiparts(mp *MetaPartition, prefix, delimiter, keyMarker string, multipartIdMarker string, maxUploads uint64) (status int, sessions *proto.ListMultipartResponse, err error) {
 	req := &proto.ListMultipartRequest{
 		VolName:           mw.volname,
@@ -1111,6 +1398,19 @@ func (mw *MetaWrapper) batchGetXAttr(mp *MetaPartition, inodes []uint64, keys []
 	}
 
 	status := parseStatus(packet.ResultCode)
+	if status == statusTimeout && len(inodes) > 1 {
+		// the meta node can not get the batch within its timeout, get the halves instead
+		log.LogWarnf("batchGetXAttr: mp(%v) inodes(%v) timeout, split", mp, len(inodes))
+		var xattrs []*proto.XAttrInfo
+		if xattrs, err = mw.batchGetXAttr(mp, inodes[:len(inodes)/2], keys); err != nil {
+			return nil, err
+		}
+		var others []*proto.XAttrInfo
+		if others, err = mw.batchGetXAttr(mp, inodes[len(inodes)/2:], keys); err != nil {
+			return nil, err
+		}
+		return append(xattrs, others...), nil
+	}
 	if status != statusOK {
 		log.LogErrorf("batchIget: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
 		return nil, err
@@ -1125,3 +1425,43 @@ func (mw *MetaWrapper) batchGetXAttr(mp *MetaPartition, inodes []uint64, keys []
 
 	return resp.XAttrs, nil
 }
+
+func (mw *MetaWrapper) batchRename(mp *MetaPartition, srcParentID, dstParentID uint64, items []proto.BatchRenameItem) (status int, resp *proto.BatchRenameResponse, err error) {
+	req := &proto.BatchRenameRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		SrcParentID: srcParentID,
+		DstParentID: dstParentID,
+		Items:       items,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaBatchRename
+	if err = packet.MarshalData(req); err != nil {
+		log.LogErrorf("batchRename: src(%v) dst(%v) err(%v)", srcParentID, dstParentID, err)
+		return
+	}
+	log.LogDebugf("batchRename: packet(%v) mp(%v) src(%v) dst(%v) items(%v)", packet, mp, srcParentID, dstParentID, len(items))
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	if packet, err = mw.sendToMetaPartition(mp, packet); err != nil {
+		log.LogErrorf("batchRename: packet(%v) mp(%v) src(%v) dst(%v) err(%v)", packet, mp, srcParentID, dstParentID, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogWarnf("batchRename: packet(%v) mp(%v) src(%v) dst(%v) result(%v)", packet, mp, srcParentID, dstParentID, packet.GetResultMsg())
+		return
+	}
+
+	resp = new(proto.BatchRenameResponse)
+	if err = packet.UnmarshalData(resp); err != nil {
+		log.LogErrorf("batchRename: packet(%v) mp(%v) src(%v) dst(%v) err(%v) PacketData(%v)", packet, mp, srcParentID, dstParentID, err, string(packet.Data))
+		return
+	}
+	log.LogDebugf("batchRename: packet(%v) mp(%v) src(%v) dst(%v) replaced(%v) moved(%v)", packet, mp, srcParentID, dstParentID, resp.Replaced, len(resp.Moved))
+	return
+}
@@ -16,7 +16,9 @@ package meta
 
 import (
 	"fmt"
+
 	"github.com/chubaofs/chubaofs/util/btree"
+	"github.com/chubaofs/chubaofs/util/log"
 )
 
 type MetaPartition struct {
@@ -26,6 +28,9 @@ type MetaPartition struct {
 	Members     []string
 	LeaderAddr  string
 	Status      int8
+
+	// version of the routing table which the partition belongs to
+	version uint64
 }
 
 func (this *MetaPartition) Less(than btree.Item) bool {
@@ -44,27 +49,40 @@ func (mp *MetaPartition) String() string {
 // Meta partition managements
 //
 
-func (mw *MetaWrapper) addPartition(mp *MetaPartition) {
-	mw.partitions[mp.PartitionID] = mp
-	mw.ranges.ReplaceOrInsert(mp)
-}
-
-func (mw *MetaWrapper) deletePartition(mp *MetaPartition) {
-	delete(mw.partitions, mp.PartitionID)
-	mw.ranges.Delete(mp)
-}
+// setPartitions replaces the routing table with the meta partitions of a new volume view.
+// The partitions and ranges of an old routing table are never modified, so that they can be
+// iterated by the callers without holding the lock.
+func (mw *MetaWrapper) setPartitions(mps []*MetaPartition) {
+	partitions := make(map[uint64]*MetaPartition, len(mps))
+	ranges := btree.New(32)
 
-func (mw *MetaWrapper) replaceOrInsertPartition(mp *MetaPartition) {
 	mw.Lock()
 	defer mw.Unlock()
-
-	found, ok := mw.partitions[mp.PartitionID]
-	if ok {
-		mw.deletePartition(found)
+	mw.version++
+	for _, mp := range mps {
+		mp.version = mw.version
+		partitions[mp.PartitionID] = mp
+		ranges.ReplaceOrInsert(mp)
 	}
+	mw.partitions = partitions
+	mw.ranges = ranges
+}
 
-	mw.addPartition(mp)
-	return
+// invalidatePartition triggers an asynchronous update of the routing table, since the partition is not
+// served by the meta nodes recorded in it, e.g. the partition has been migrated.
+// Nothing is done if the routing table has been updated since the partition was routed.
+func (mw *MetaWrapper) invalidatePartition(mp *MetaPartition) {
+	mw.RLock()
+	stale := mp.version == mw.version
+	mw.RUnlock()
+	if !stale {
+		return
+	}
+	log.LogWarnf("invalidatePartition: mp(%v) version(%v)", mp, mp.version)
+	select {
+	case mw.forceUpdate <- struct{}{}:
+	default:
+	}
 }
 
 func (mw *MetaWrapper) getPartitionByID(id uint64) *MetaPartition {
@@ -0,0 +1,91 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestSetPartitions(t *testing.T) {
+	mw := &MetaWrapper{forceUpdate: make(chan struct{}, 1)}
+	mw.setPartitions([]*MetaPartition{
+		{PartitionID: 1, Start: 1, End: 100, Members: []string{"a"}},
+		{PartitionID: 2, Start: 101, End: 200, Members: []string{"b"}},
+	})
+	old := mw.getPartitionByInode(150)
+	if old == nil || old.PartitionID != 2 || mw.getPartitionByInode(201) != nil {
+		t.Fatalf("unexpected partition %v of inode 150", old)
+	}
+
+	// the partition 2 is migrated, and split with the partition 3
+	mw.setPartitions([]*MetaPartition{
+		{PartitionID: 1, Start: 1, End: 100, Members: []string{"a"}},
+		{PartitionID: 2, Start: 101, End: 150, Members: []string{"c"}},
+		{PartitionID: 3, Start: 151, End: 300, Members: []string{"c"}},
+	})
+	if mp := mw.getPartitionByInode(160); mp == nil || mp.PartitionID != 3 {
+		t.Fatalf("unexpected partition %v of inode 160", mp)
+	}
+	if mp := mw.getPartitionByID(2); mp == nil || mp.Members[0] != "c" || mp.version != old.version+1 {
+		t.Fatalf("unexpected partition %v", mp)
+	}
+	// the partitions routed by the old table are not modified
+	if old.End != 200 || old.Members[0] != "b" {
+		t.Fatalf("the partition of the old routing table is modified to %v", old)
+	}
+}
+
+func TestInvalidatePartition(t *testing.T) {
+	mw := &MetaWrapper{forceUpdate: make(chan struct{}, 1)}
+	mw.setPartitions([]*MetaPartition{{PartitionID: 1, Start: 1, End: 100}})
+	stale := mw.getPartitionByID(1)
+	mw.setPartitions([]*MetaPartition{{PartitionID: 1, Start: 1, End: 100}})
+
+	// the partition routed before the update needs no other update
+	mw.invalidatePartition(stale)
+	select {
+	case <-mw.forceUpdate:
+		t.Fatalf("the routing table updated since should not be updated again")
+	default:
+	}
+	current := mw.getPartitionByID(1)
+	mw.invalidatePartition(current)
+	mw.invalidatePartition(current)
+	select {
+	case <-mw.forceUpdate:
+	default:
+		t.Fatalf("the routing table should be updated")
+	}
+}
+
+func TestIsPartitionNotServing(t *testing.T) {
+	resp := proto.NewPacket()
+	resp.ResultCode = proto.OpErr
+	resp.Data = []byte("unknown meta partition: 10")
+	if !isPartitionNotServing(resp) {
+		t.Fatalf("the partition should not be served")
+	}
+	resp.Data = []byte("raft not leader")
+	if isPartitionNotServing(resp) {
+		t.Fatalf("other errors should not invalidate the partition")
+	}
+	resp.ResultCode = proto.OpAgain
+	resp.Data = []byte("unknown meta partition: 10")
+	if isPartitionNotServing(resp) {
+		t.Fatalf("only the errors should invalidate the partition")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -43,6 +44,12 @@ type VolumeView struct {
 	MetaPartitions []*MetaPartition
 	OSSSecure      *OSSSecure
 	CreateTime     int64
+
+	MinClientVersion string
+	Features         map[string]bool
+	MetaCacheNodes   []string
+	SyncOnRename     bool
+	Shadow           *proto.VolShadowView
 }
 
 type OSSSecure struct {
@@ -54,7 +61,11 @@ type VolStatInfo = proto.VolStatInfo
 
 func (mw *MetaWrapper) fetchVolumeView() (view *VolumeView, err error) {
 	var vv *proto.VolView
-	if mw.ownerValidation {
+	if mw.ownerValidation && mw.delegatedToken != "" {
+		if vv, err = mw.mc.ClientAPI().GetVolumeWithDelegatedToken(mw.volname, mw.delegatedToken); err != nil {
+			return
+		}
+	} else if mw.ownerValidation {
 		var authKey string
 		if authKey, err = calculateAuthKey(mw.owner); err != nil {
 			return
@@ -92,6 +103,12 @@ func (mw *MetaWrapper) fetchVolumeView() (view *VolumeView, err error) {
 			MetaPartitions: make([]*MetaPartition, len(volView.MetaPartitions)),
 			OSSSecure:      &OSSSecure{},
 			CreateTime:     volView.CreateTime,
+
+			MinClientVersion: volView.MinClientVersion,
+			Features:         volView.Features,
+			MetaCacheNodes:   volView.MetaCacheNodes,
+			SyncOnRename:     volView.SyncOnRename,
+			Shadow:           volView.Shadow,
 		}
 		if volView.OSSSecure != nil {
 			result.OSSSecure.AccessKey = volView.OSSSecure.AccessKey
@@ -136,10 +153,51 @@ func (mw *MetaWrapper) updateVolStatInfo() (err error) {
 	}
 	atomic.StoreUint64(&mw.totalSize, info.TotalSize)
 	atomic.StoreUint64(&mw.usedSize, info.UsedSize)
+	atomic.StoreUint64(&mw.reservedSize, info.ReservedSize)
 	log.LogInfof("VolStatInfo: info(%v)", info)
 	return
 }
 
+// updateVolInodeInfo sums the inode IDs of the meta partitions, and the ones not allocated by their cursors yet.
+func (mw *MetaWrapper) updateVolInodeInfo() (err error) {
+	var views []*proto.MetaPartitionView
+	if views, err = mw.mc.ClientAPI().GetMetaPartitions(mw.volname); err != nil {
+		log.LogWarnf("updateVolInodeInfo: get meta partitions fail: volume(%v) err(%v)", mw.volname, err)
+		return
+	}
+	total, free := sumInodes(views)
+	atomic.StoreUint64(&mw.totalInodes, total)
+	atomic.StoreUint64(&mw.freeInodes, free)
+	log.LogInfof("updateVolInodeInfo: volume(%v) totalInodes(%v) freeInodes(%v)", mw.volname, total, free)
+	return
+}
+
+// sumInodes returns the inode IDs of the meta partitions, and the ones not allocated by their cursors yet.
+func sumInodes(views []*proto.MetaPartitionView) (total, free uint64) {
+	for _, mp := range views {
+		if mp.End < mp.Start {
+			continue
+		}
+		cursor := mp.MaxInodeID
+		if cursor < mp.Start {
+			cursor = mp.Start
+		} else if cursor > mp.End {
+			cursor = mp.End
+		}
+		total = addInodes(total, mp.End-mp.Start+1)
+		free = addInodes(free, mp.End-cursor)
+	}
+	return
+}
+
+// addInodes adds up the inode IDs, which saturates rather than overflows since the last partition is unbounded.
+func addInodes(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
 func (mw *MetaWrapper) updateMetaPartitions() error {
 	view, err := mw.fetchVolumeView()
 	if err != nil {
@@ -166,15 +224,25 @@ func (mw *MetaWrapper) updateMetaPartitions() error {
 
 	rwPartitions := make([]*MetaPartition, 0)
 	for _, mp := range view.MetaPartitions {
-		mw.replaceOrInsertPartition(mp)
 		log.LogInfof("updateMetaPartition: mp(%v)", mp)
 		if mp.Status == proto.ReadWrite {
 			rwPartitions = append(rwPartitions, mp)
 		}
 	}
+	if len(view.MetaPartitions) != 0 {
+		mw.setPartitions(view.MetaPartitions)
+	}
 	mw.ossSecure = view.OSSSecure
 	mw.volCreateTime = view.CreateTime
 
+	mw.Lock()
+	mw.minVersion = view.MinClientVersion
+	mw.volFeatures = view.Features
+	mw.metaCacheNodes = view.MetaCacheNodes
+	mw.syncOnRename = view.SyncOnRename
+	mw.shadow = view.Shadow
+	mw.Unlock()
+
 	if len(rwPartitions) == 0 {
 		log.LogInfof("updateMetaPartition: no valid partitions")
 		return nil
@@ -0,0 +1,66 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestSumInodes(t *testing.T) {
+	total, free := sumInodes([]*proto.MetaPartitionView{
+		{Start: 1, End: 100, MaxInodeID: 40},
+		{Start: 101, End: 200, MaxInodeID: 0},   // the cursor not reported yet starts at the start
+		{Start: 201, End: 300, MaxInodeID: 500}, // the cursor reported past the end
+		{Start: 400, End: 300},                  // the range being split
+	})
+	if total != 300 || free != 60+99 {
+		t.Fatalf("expect 300 inodes and 159 free, but are %v and %v", total, free)
+	}
+
+	// the last partition is unbounded, whose inodes saturate the sum rather than overflow it
+	total, free = sumInodes([]*proto.MetaPartitionView{
+		{Start: 1, End: 100, MaxInodeID: 100},
+		{Start: 101, End: math.MaxUint64, MaxInodeID: 200},
+	})
+	if total != math.MaxUint64 || free != math.MaxUint64-200 {
+		t.Fatalf("unexpected inodes %v and free %v of the unbounded partition", total, free)
+	}
+
+	stat := &VolStat{Total: 100, Used: 10, Inodes: math.MaxUint64 - 1, FreeInodes: 5}
+	stat.Add(&VolStat{Total: 50, Used: 20, Inodes: 10, FreeInodes: 5})
+	if stat.Total != 150 || stat.Used != 30 || stat.Inodes != math.MaxUint64 || stat.FreeInodes != 10 {
+		t.Fatalf("unexpected sum %+v", stat)
+	}
+}
+
+func TestVolStatCached(t *testing.T) {
+	// the statistics refreshed within the TTL are served without asking the master
+	mw := &MetaWrapper{
+		totalSize:    1000,
+		usedSize:     300,
+		reservedSize: 800,
+		totalInodes:  100,
+		freeInodes:   40,
+		statTime:     time.Now().UnixNano(),
+	}
+	stat := mw.VolStat()
+	if stat.Total != 1000 || stat.Used != 1000 || stat.Inodes != 100 || stat.FreeInodes != 40 {
+		t.Fatalf("unexpected cached stat %+v", stat)
+	}
+}
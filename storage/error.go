@@ -33,6 +33,8 @@ var (
 	ExtentIsFullError         = errors.New("extent is full")
 	BrokenExtentError         = errors.New("extent has been broken")
 	BrokenDiskError           = errors.New("disk has broken")
+	ExtentIsLaggingError      = errors.New("extent is lagging behind the other replicas")
+	BlockCrcMismatchError     = errors.New("block crc mismatch")
 )
 
 func NewParameterMismatchErr(msg string) (err error) {
@@ -70,7 +70,12 @@ type Extent struct {
 	dataSize   int64
 	hasClose   int32
 	header     []byte
+	reads      uint32     // number of reads before the extent is mapped
+	mmapCache  *MmapCache // maps the extent if it is hot, nil to always read by pread
 	sync.Mutex
+	packed     *packedExtent   // the segment if the tiny extent is in the packed format, nil in the plain format
+	conversion *tinyConversion // not nil if the tiny extent is being converted to the other format
+	formatLock sync.RWMutex    // held by the operations on the tiny extent against the change of its format
 }
 
 // NewExtentInCore create and returns a new extent instance.
@@ -91,6 +96,12 @@ func (e *Extent) Close() (err error) {
 	if e.HasClosed() {
 		return
 	}
+	if e.mmapCache != nil {
+		e.mmapCache.Release(e)
+	}
+	if e.packed != nil {
+		e.packed.close()
+	}
 	if err = e.file.Close(); err != nil {
 		return
 	}
@@ -147,7 +158,14 @@ func (e *Extent) RestoreFromFS() (err error) {
 		return
 	}
 	if IsTinyExtent(e.extentID) {
+		if err = e.restorePacked(info.Size()); err != nil {
+			e.file.Close()
+			return
+		}
 		watermark := info.Size()
+		if e.packed != nil {
+			watermark = e.packed.size
+		}
 		if watermark%PageSize != 0 {
 			watermark = watermark + (PageSize - watermark%PageSize)
 		}
@@ -189,15 +207,27 @@ func (e *Extent) WriteTiny(data []byte, offset, size int64, crc uint32, writeTyp
 	if IsAppendWrite(writeType) && offset != e.dataSize {
 		return ParameterMismatchError
 	}
-
-	if _, err = e.file.WriteAt(data[:size], int64(offset)); err != nil {
+	if err = injectWriteFault(e.filePath); err != nil {
 		return
 	}
-	if isSync {
-		if err = e.file.Sync(); err != nil {
+
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	if e.packed != nil {
+		if err = e.packed.write(data[:size], offset, isSync); err != nil {
+			return
+		}
+	} else {
+		if _, err = e.file.WriteAt(data[:size], int64(offset)); err != nil {
 			return
 		}
+		if isSync {
+			if err = e.file.Sync(); err != nil {
+				return
+			}
+		}
 	}
+	e.conversion.mark(offset, size)
 
 	if !IsAppendWrite(writeType) {
 		return
@@ -220,6 +250,9 @@ func (e *Extent) Write(data []byte, offset, size int64, crc uint32, writeType in
 	if err = e.checkOffsetAndSize(offset, size); err != nil {
 		return
 	}
+	if err = injectWriteFault(e.filePath); err != nil {
+		return
+	}
 	if _, err = e.file.WriteAt(data[:size], int64(offset)); err != nil {
 		return
 	}
@@ -259,20 +292,32 @@ func (e *Extent) Read(data []byte, offset, size int64, isRepairRead bool) (crc u
 	if err = e.checkOffsetAndSize(offset, size); err != nil {
 		return
 	}
+	if err = injectReadFault(e.filePath); err != nil {
+		return
+	}
 	if _, err = e.file.ReadAt(data[:size], offset); err != nil {
 		return
 	}
-	crc = crc32.ChecksumIEEE(data)
+	crc = injectCrcFault(e.filePath, crc32.ChecksumIEEE(data))
 	return
 }
 
 // ReadTiny read data from a tiny extent.
 func (e *Extent) ReadTiny(data []byte, offset, size int64, isRepairRead bool) (crc uint32, err error) {
-	_, err = e.file.ReadAt(data[:size], offset)
+	if err = injectReadFault(e.filePath); err != nil {
+		return
+	}
+	e.formatLock.RLock()
+	if e.packed != nil {
+		err = e.packed.read(data[:size], offset)
+	} else {
+		_, err = e.file.ReadAt(data[:size], offset)
+	}
+	e.formatLock.RUnlock()
 	if isRepairRead && err == io.EOF {
 		err = nil
 	}
-	crc = crc32.ChecksumIEEE(data[:size])
+	crc = injectCrcFault(e.filePath, crc32.ChecksumIEEE(data[:size]))
 
 	return
 }
@@ -293,6 +338,13 @@ func (e *Extent) checkOffsetAndSize(offset, size int64) error {
 
 // Flush synchronizes data to the disk.
 func (e *Extent) Flush() (err error) {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	if e.packed != nil {
+		if err = e.packed.sync(); err != nil {
+			return
+		}
+	}
 	err = e.file.Sync()
 	return
 }
@@ -347,6 +399,16 @@ func (e *Extent) DeleteTiny(offset, size int64) (hasDelete bool, err error) {
 		return false, ParameterMismatchError
 	}
 
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	defer func() {
+		if err == nil && !hasDelete {
+			e.conversion.mark(offset, size)
+		}
+	}()
+	if e.packed != nil {
+		return e.packed.delete(offset, size)
+	}
 	newOffset, err := e.file.Seek(offset, SEEK_DATA)
 	if err != nil {
 		if strings.Contains(err.Error(), syscall.ENXIO.Error()) {
@@ -380,7 +442,11 @@ func (e *Extent) TinyExtentRecover(data []byte, offset, size int64, crc uint32,
 	}
 	log.LogDebugf("before file (%v) getRealBlockNo (%v) isEmptyPacket(%v)"+
 		"offset(%v) size(%v) e.datasize(%v)", e.filePath, e.getRealBlockCnt(), isEmptyPacket, offset, size, e.dataSize)
-	if isEmptyPacket {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	if e.packed != nil {
+		err = e.packed.recover(data, offset, size, isEmptyPacket)
+	} else if isEmptyPacket {
 		finfo, err := e.file.Stat()
 		if err != nil {
 			return err
@@ -399,6 +465,7 @@ func (e *Extent) TinyExtentRecover(data []byte, offset, size int64, crc uint32,
 	if err != nil {
 		return
 	}
+	e.conversion.mark(offset, size)
 	watermark := offset + size
 	if watermark%PageSize != 0 {
 		watermark = watermark + (PageSize - watermark%PageSize)
@@ -413,11 +480,15 @@ func (e *Extent) TinyExtentRecover(data []byte, offset, size int64, crc uint32,
 func (e *Extent) tinyExtentAvaliOffset(offset int64) (newOffset, newEnd int64, err error) {
 	e.Lock()
 	defer e.Unlock()
-	newOffset, err = e.file.Seek(int64(offset), SEEK_DATA)
-	if err != nil {
-		return
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	if e.packed != nil {
+		newOffset, newEnd, err = e.packed.dataRun(offset)
+	} else {
+		if newOffset, err = e.file.Seek(int64(offset), SEEK_DATA); err == nil {
+			newEnd, err = e.file.Seek(int64(newOffset), SEEK_HOLE)
+		}
 	}
-	newEnd, err = e.file.Seek(int64(newOffset), SEEK_HOLE)
 	if err != nil {
 		return
 	}
@@ -126,6 +126,21 @@ func (cache *ExtentCache) Clear() {
 	cache.extentMap = make(map[uint64]*ExtentMapItem)
 }
 
+// Release closes all the normal extents stored in the cache to release their file descriptors.
+// They are reopened on the next access.
+func (cache *ExtentCache) Release() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	for e := cache.extentList.Front(); e != nil; {
+		curr := e
+		e = e.Next()
+		ec := curr.Value.(*Extent)
+		delete(cache.extentMap, ec.extentID)
+		cache.extentList.Remove(curr)
+		ec.Close()
+	}
+}
+
 // Size returns number of extents stored in the cache.
 func (cache *ExtentCache) Size() int {
 	cache.lock.RLock()
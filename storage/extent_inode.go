@@ -0,0 +1,116 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The inode which a normal extent is created for is appended to EXTENT_INODE as the extent ID and the inode, so that
+// the extents never referenced by the inode, e.g. as the client crashes before appending the extent key, can be
+// checked against the inode first. The records of the deleted extents are dropped by compacting the file on startup.
+const (
+	ExtInodeFileName      = "EXTENT_INODE"
+	ExtentInodeRecordSize = 16
+)
+
+// OrphanExtentFilter selects the normal extents not modified since the time, which may be referenced by no inode.
+func OrphanExtentFilter(modifiedBefore int64) ExtentFilter {
+	return func(ei *ExtentInfo) bool {
+		return !IsTinyExtent(ei.FileID) && !ei.IsDeleted && ei.ModifyTime < modifiedBefore
+	}
+}
+
+// loadExtentInodes loads the records of the existing extents, and rewrites the file if any record is dropped.
+func (s *ExtentStore) loadExtentInodes() (err error) {
+	name := path.Join(s.dataPath, ExtInodeFileName)
+	data, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	s.extentInodes = make(map[uint64]uint64)
+	records := len(data) / ExtentInodeRecordSize
+	for i := 0; i < records; i++ {
+		record := data[i*ExtentInodeRecordSize:]
+		extentID := binary.BigEndian.Uint64(record[0:8])
+		if s.HasExtent(extentID) {
+			s.extentInodes[extentID] = binary.BigEndian.Uint64(record[8:16])
+		}
+	}
+	if records != len(s.extentInodes) || len(data)%ExtentInodeRecordSize != 0 {
+		if err = s.compactExtentInodes(name); err != nil {
+			return
+		}
+		log.LogInfof("action[loadExtentInodes] partition(%v) compacts %v records to %v", s.partitionID, records,
+			len(s.extentInodes))
+	}
+	s.extentInodeFp, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	return
+}
+
+func (s *ExtentStore) compactExtentInodes(name string) (err error) {
+	extentIDs := make([]uint64, 0, len(s.extentInodes))
+	for extentID := range s.extentInodes {
+		extentIDs = append(extentIDs, extentID)
+	}
+	sort.Slice(extentIDs, func(i, j int) bool { return extentIDs[i] < extentIDs[j] })
+	data := make([]byte, len(extentIDs)*ExtentInodeRecordSize)
+	for i, extentID := range extentIDs {
+		binary.BigEndian.PutUint64(data[i*ExtentInodeRecordSize:], extentID)
+		binary.BigEndian.PutUint64(data[i*ExtentInodeRecordSize+8:], s.extentInodes[extentID])
+	}
+	tmpName := name + ".tmp"
+	if err = ioutil.WriteFile(tmpName, data, 0666); err != nil {
+		return
+	}
+	return os.Rename(tmpName, name)
+}
+
+// BindExtentInode records the inode which the normal extent is created for.
+func (s *ExtentStore) BindExtentInode(extentID, inode uint64) (err error) {
+	if inode == 0 || IsTinyExtent(extentID) {
+		return
+	}
+	var record [ExtentInodeRecordSize]byte
+	binary.BigEndian.PutUint64(record[0:8], extentID)
+	binary.BigEndian.PutUint64(record[8:16], inode)
+	s.extentInodeMutex.Lock()
+	defer s.extentInodeMutex.Unlock()
+	if _, err = s.extentInodeFp.Write(record[:]); err != nil {
+		return
+	}
+	s.extentInodes[extentID] = inode
+	return
+}
+
+// ExtentInode returns the inode which the normal extent is created for, or 0 if it is unknown, e.g. the extent is
+// created by the older versions or by the repair.
+func (s *ExtentStore) ExtentInode(extentID uint64) (inode uint64) {
+	s.extentInodeMutex.Lock()
+	defer s.extentInodeMutex.Unlock()
+	return s.extentInodes[extentID]
+}
+
+func (s *ExtentStore) unbindExtentInode(extentID uint64) {
+	s.extentInodeMutex.Lock()
+	delete(s.extentInodes, extentID)
+	s.extentInodeMutex.Unlock()
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestExtentInodeCompact(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_inode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	kept, _ := s.NextExtentID()
+	deleted, _ := s.NextExtentID()
+	for i, extentID := range []uint64{kept, deleted} {
+		if err = s.Create(extentID); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.BindExtentInode(extentID, uint64(100+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.MarkDelete(deleted, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if inode := s.ExtentInode(deleted); inode != 0 {
+		t.Fatalf("deleted extent(%v) is still bound to inode(%v)", deleted, inode)
+	}
+	s.Close()
+
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	if inode := s.ExtentInode(kept); inode != 100 {
+		t.Fatalf("extent(%v) is bound to inode(%v), expect 100", kept, inode)
+	}
+	info, err := os.Stat(path.Join(dataDir, ExtInodeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != ExtentInodeRecordSize {
+		t.Fatalf("extent inode file of size(%v) is not compacted", info.Size())
+	}
+	extents, _, err := s.GetAllWatermarks(OrphanExtentFilter(time.Now().Unix() + 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extents) != 1 || extents[0].FileID != kept {
+		t.Fatalf("orphan extent candidates %v, expect extent(%v)", extents, kept)
+	}
+}
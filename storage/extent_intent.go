@@ -0,0 +1,193 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The intent log makes the multi-step operations on the normal extents crash-consistent. An operation appends its
+// intent and syncs it before the first step, and appends the done record after the last one. The intents without the
+// done records are replayed on startup before the extents are loaded:
+//   - a create is rolled back, the extent file is removed if nothing is written into it, and the base extent ID is
+//     moved past the extent, so that the ID is not allocated again;
+//   - a mark delete is rolled forward, the extent file is removed, its crc is punched and the deletion is recorded.
+//
+// Both replays are idempotent, so a crash during the replay is replayed again. The done records are not synced, since
+// losing them only replays the finished operations again.
+//
+// A record is the extent ID, the operation, the begin or done flag, two bytes of padding and the crc of the 12 bytes.
+const (
+	ExtIntentLogFileName = "EXTENT_INTENT"
+	IntentRecordSize     = 16
+	IntentLogCompactSize = 4 * 1024 * 1024 // the intent log is truncated beyond the size once no intent is pending
+)
+
+// The operations logged by the intents.
+const (
+	IntentCreate     = 1
+	IntentMarkDelete = 2
+)
+
+const (
+	intentBegin = 0
+	intentDone  = 1
+)
+
+func encodeIntentRecord(extentID uint64, op, flag uint8) []byte {
+	data := make([]byte, IntentRecordSize)
+	binary.BigEndian.PutUint64(data[0:8], extentID)
+	data[8] = op
+	data[9] = flag
+	binary.BigEndian.PutUint32(data[12:16], crc32.ChecksumIEEE(data[0:12]))
+	return data
+}
+
+func (s *ExtentStore) openIntentLog() (err error) {
+	s.intentLogFp, err = os.OpenFile(path.Join(s.dataPath, ExtIntentLogFileName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	return
+}
+
+// beginIntent logs the intent of the operation on the extent durably.
+func (s *ExtentStore) beginIntent(extentID uint64, op uint8) (err error) {
+	s.intentMutex.Lock()
+	defer s.intentMutex.Unlock()
+	if _, err = s.intentLogFp.Write(encodeIntentRecord(extentID, op, intentBegin)); err != nil {
+		return
+	}
+	if err = s.intentLogFp.Sync(); err != nil {
+		return
+	}
+	s.pendingIntents++
+	return
+}
+
+// finishIntent logs the operation on the extent as done, and truncates the intent log if it is large and no intent
+// is pending.
+func (s *ExtentStore) finishIntent(extentID uint64, op uint8) {
+	s.intentMutex.Lock()
+	defer s.intentMutex.Unlock()
+	s.pendingIntents--
+	if _, err := s.intentLogFp.Write(encodeIntentRecord(extentID, op, intentDone)); err != nil {
+		log.LogWarnf("finishIntent: partition(%v) extent(%v) op(%v) err(%v)", s.partitionID, extentID, op, err)
+		return
+	}
+	if s.pendingIntents != 0 {
+		return
+	}
+	if stat, err := s.intentLogFp.Stat(); err == nil && stat.Size() >= IntentLogCompactSize {
+		if err = s.intentLogFp.Truncate(0); err != nil {
+			log.LogWarnf("finishIntent: partition(%v) truncate intent log err(%v)", s.partitionID, err)
+		}
+	}
+}
+
+// loadPendingIntents returns the intents without the done records in the order of their logging. The torn record at
+// the tail and the records failing the crc are skipped.
+func (s *ExtentStore) loadPendingIntents() (intents [][2]uint64, err error) {
+	data, err := ioutil.ReadFile(path.Join(s.dataPath, ExtIntentLogFileName))
+	if err != nil {
+		return
+	}
+	pending := make(map[[2]uint64]int)
+	order := make([][2]uint64, 0)
+	for off := 0; off+IntentRecordSize <= len(data); off += IntentRecordSize {
+		record := data[off : off+IntentRecordSize]
+		if crc32.ChecksumIEEE(record[0:12]) != binary.BigEndian.Uint32(record[12:16]) {
+			log.LogWarnf("loadPendingIntents: partition(%v) skip the broken record at offset(%v)", s.partitionID, off)
+			continue
+		}
+		intent := [2]uint64{binary.BigEndian.Uint64(record[0:8]), uint64(record[8])}
+		if record[9] == intentBegin {
+			if pending[intent] == 0 {
+				order = append(order, intent)
+			}
+			pending[intent]++
+		} else if pending[intent] > 0 {
+			pending[intent]--
+		}
+	}
+	for _, intent := range order {
+		if pending[intent] > 0 {
+			intents = append(intents, intent)
+		}
+	}
+	return
+}
+
+// replayIntents replays the intents pending since the last run, and then clears the intent log. The layout of the
+// extent files is loaded, but the extents are not, so both the flat and the bucketed paths of an extent are tried.
+func (s *ExtentStore) replayIntents() (err error) {
+	intents, err := s.loadPendingIntents()
+	if err != nil {
+		return
+	}
+	for _, intent := range intents {
+		extentID, op := intent[0], uint8(intent[1])
+		switch op {
+		case IntentCreate:
+			err = s.rollbackCreate(extentID)
+		case IntentMarkDelete:
+			err = s.rollForwardMarkDelete(extentID)
+		}
+		if err != nil {
+			return
+		}
+		log.LogWarnf("replayIntents: partition(%v) extent(%v) op(%v) is replayed", s.partitionID, extentID, op)
+	}
+	return s.intentLogFp.Truncate(0)
+}
+
+func (s *ExtentStore) extentPathCandidates(extentID uint64) []string {
+	name := strconv.FormatUint(extentID, 10)
+	if s.extentLayout == ExtentLayoutFlat {
+		return []string{path.Join(s.dataPath, name)}
+	}
+	return []string{path.Join(s.dataPath, name), path.Join(s.dataPath, extentBucket(extentID), name)}
+}
+
+func (s *ExtentStore) rollbackCreate(extentID uint64) (err error) {
+	for _, name := range s.extentPathCandidates(extentID) {
+		info, statErr := os.Stat(name)
+		if statErr != nil || info.Size() != 0 {
+			continue
+		}
+		if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	baseExtentID, _ := s.GetPersistenceBaseExtentID()
+	if extentID > baseExtentID {
+		return s.PersistenceBaseExtentID(extentID)
+	}
+	return nil
+}
+
+func (s *ExtentStore) rollForwardMarkDelete(extentID uint64) (err error) {
+	for _, name := range s.extentPathCandidates(extentID) {
+		if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	s.DeleteBlockCrc(extentID)
+	return s.PersistenceHasDeleteExtent(extentID)
+}
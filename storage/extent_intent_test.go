@@ -0,0 +1,134 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestExtentStore(t *testing.T, dataDir string) *ExtentStore {
+	s, err := NewExtentStore(dataDir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestIntentCreateCrash(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_intent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	// crash after the extent file is created by a follower, before the extent and the base extent ID are updated
+	extentID := atomic.LoadUint64(&s.baseExtentID) + 100
+	if err = s.beginIntent(extentID, IntentCreate); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path.Join(dataDir, strconv.FormatUint(extentID, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	s.Close()
+
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	if s.HasExtent(extentID) {
+		t.Fatalf("extent(%v) created partly is not rolled back", extentID)
+	}
+	if next, _ := s.NextExtentID(); next <= extentID {
+		t.Fatalf("extent ID(%v) is allocated again", next)
+	}
+	if intents, err := s.loadPendingIntents(); err != nil || len(intents) != 0 {
+		t.Fatalf("intents(%v) are pending after the replay, err(%v)", intents, err)
+	}
+}
+
+func TestIntentMarkDeleteCrash(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_intent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	deleted, _ := s.NextExtentID()
+	kept, _ := s.NextExtentID()
+	for _, extentID := range []uint64{deleted, kept} {
+		if err = s.Create(extentID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// crash before the extent file is removed
+	if err = s.beginIntent(deleted, IntentMarkDelete); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = newTestExtentStore(t, dataDir)
+	if s.HasExtent(deleted) || !s.HasExtent(kept) {
+		t.Fatalf("extent(%v) is not deleted or extent(%v) is deleted", deleted, kept)
+	}
+	data, err := ioutil.ReadFile(path.Join(dataDir, NormalExtDeletedFileName))
+	if err != nil || len(data) != 8 {
+		t.Fatalf("deletion of extent(%v) is not recorded, err(%v)", deleted, err)
+	}
+	// crash after the extent file is removed, the replay is idempotent
+	if err = s.beginIntent(deleted, IntentMarkDelete); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	if s.HasExtent(deleted) || !s.HasExtent(kept) {
+		t.Fatalf("extent(%v) is not deleted or extent(%v) is deleted", deleted, kept)
+	}
+}
+
+func TestIntentLogTornRecord(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_intent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	defer s.Close()
+	extentID, _ := s.NextExtentID()
+	if err = s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.beginIntent(extentID+1, IntentCreate); err != nil {
+		t.Fatal(err)
+	}
+	broken := encodeIntentRecord(extentID+2, IntentMarkDelete, intentBegin)
+	broken[0] ^= 0xff
+	if _, err = s.intentLogFp.Write(append(broken, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	intents, err := s.loadPendingIntents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intents) != 1 || intents[0] != [2]uint64{extentID + 1, IntentCreate} {
+		t.Fatalf("pending intents(%v), expect the create of extent(%v) only", intents, extentID+1)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The layouts of the extent files in the data directory of a partition. The tiny extents are always kept in the data
+// directory, since there are only TinyExtentCount of them.
+const (
+	ExtentLayoutFlat      = 0 // the normal extents are in the data directory
+	ExtentLayoutMigrating = 1 // the normal extents are being moved from the data directory into the buckets
+	ExtentLayoutBucketed  = 2 // the normal extents are in the buckets, the subdirectories hashed by the extent ID
+)
+
+const (
+	ExtentBucketCount      = 256
+	ExtentLayoutOffset     = 16   // offset of the layout in EXTENT_META, after the base extent ID and the preallocated one
+	ExtentMigrateBatchSize = 1000 // the most extents moved into the buckets by each backend task
+)
+
+// extentBucket returns the subdirectory of the extent, named apart from the extent files.
+func extentBucket(extentID uint64) string {
+	return fmt.Sprintf("b%02x", extentID%ExtentBucketCount)
+}
+
+func (s *ExtentStore) persistExtentLayout(layout int32) (err error) {
+	// the extents must not be moved before the layout is persisted, or they are lost on restart
+	if err = s.updateExtentMeta(func(m *extentMeta) { m.layout = layout }, true); err != nil {
+		return
+	}
+	atomic.StoreInt32(&s.extentLayout, layout)
+	return
+}
+
+// extentPath returns the path of the extent file. The caller holds the layoutMutex.
+func (s *ExtentStore) extentPath(extentID uint64) string {
+	name := strconv.FormatUint(extentID, 10)
+	if IsTinyExtent(extentID) || s.extentLayout == ExtentLayoutFlat {
+		return path.Join(s.dataPath, name)
+	}
+	if _, ok := s.flatExtents[extentID]; ok {
+		return path.Join(s.dataPath, name)
+	}
+	return path.Join(s.dataPath, extentBucket(extentID), name)
+}
+
+// listExtentFiles returns the IDs of the extent files in the data directory and the buckets, and records the normal
+// extents left in the data directory to be moved into the buckets.
+func (s *ExtentStore) listExtentFiles() (extentIDs []uint64, err error) {
+	files, err := ioutil.ReadDir(s.dataPath)
+	if err != nil {
+		return
+	}
+	s.layoutMutex.Lock()
+	defer s.layoutMutex.Unlock()
+	s.flatExtents = make(map[uint64]struct{})
+	for _, f := range files {
+		extentID, isExtent := s.ExtentID(f.Name())
+		if !isExtent {
+			continue
+		}
+		extentIDs = append(extentIDs, extentID)
+		if !IsTinyExtent(extentID) && s.extentLayout != ExtentLayoutFlat {
+			s.flatExtents[extentID] = struct{}{}
+		}
+	}
+	if s.extentLayout == ExtentLayoutFlat {
+		return
+	}
+	for bucket := 0; bucket < ExtentBucketCount; bucket++ {
+		if files, err = ioutil.ReadDir(path.Join(s.dataPath, extentBucket(uint64(bucket)))); os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		for _, f := range files {
+			if extentID, isExtent := s.ExtentID(f.Name()); isExtent {
+				extentIDs = append(extentIDs, extentID)
+			}
+		}
+	}
+	err = nil
+	switch {
+	case s.extentLayout == ExtentLayoutMigrating && len(s.flatExtents) == 0:
+		err = s.persistExtentLayout(ExtentLayoutBucketed)
+	case s.extentLayout == ExtentLayoutBucketed && len(s.flatExtents) > 0:
+		err = s.persistExtentLayout(ExtentLayoutMigrating)
+	}
+	return
+}
+
+// SetExtentLayout upgrades the layout of the extent files to the bucketed one, which keeps the normal extents in the
+// subdirectories hashed by the extent ID, so that the data directory is not slowed down by massive extent files. The
+// normal extents in the data directory are moved into the buckets by the backend tasks, and are read from the data
+// directory until they are moved. A store can not be downgraded to the flat layout once it is upgraded.
+func (s *ExtentStore) SetExtentLayout(layout int32) (err error) {
+	if layout != ExtentLayoutBucketed {
+		return fmt.Errorf("unsupported extent layout %v", layout)
+	}
+	s.layoutMutex.Lock()
+	defer s.layoutMutex.Unlock()
+	if s.extentLayout != ExtentLayoutFlat {
+		return
+	}
+	for bucket := 0; bucket < ExtentBucketCount; bucket++ {
+		if err = MkdirAll(path.Join(s.dataPath, extentBucket(uint64(bucket)))); err != nil {
+			return
+		}
+	}
+	s.eiMutex.RLock()
+	for extentID, ei := range s.extentInfoMap {
+		if !IsTinyExtent(extentID) && !ei.IsDeleted {
+			s.flatExtents[extentID] = struct{}{}
+		}
+	}
+	s.eiMutex.RUnlock()
+	if len(s.flatExtents) == 0 {
+		layout = ExtentLayoutBucketed
+	} else {
+		layout = ExtentLayoutMigrating
+	}
+	if err = s.persistExtentLayout(layout); err != nil {
+		return
+	}
+	log.LogWarnf("action[SetExtentLayout] partition(%v) layout(%v) extents to move(%v)", s.partitionID, layout,
+		len(s.flatExtents))
+	return
+}
+
+// ExtentLayout returns the layout of the extent files, and the number of the normal extents to be moved into the
+// buckets.
+func (s *ExtentStore) ExtentLayout() (layout int32, flatExtents int) {
+	s.layoutMutex.RLock()
+	defer s.layoutMutex.RUnlock()
+	return s.extentLayout, len(s.flatExtents)
+}
+
+// migrateExtentLayout moves a batch of the normal extents from the data directory into the buckets. An extent is
+// renamed under the layoutMutex, which keeps it from being opened by the old path meanwhile, and the cached one opened
+// by the old path is closed, so it is opened by the new path afterwards.
+func (s *ExtentStore) migrateExtentLayout() {
+	if atomic.LoadInt32(&s.extentLayout) != ExtentLayoutMigrating {
+		return
+	}
+	s.layoutMutex.RLock()
+	extentIDs := make([]uint64, 0, ExtentMigrateBatchSize)
+	for extentID := range s.flatExtents {
+		if len(extentIDs) == ExtentMigrateBatchSize {
+			break
+		}
+		extentIDs = append(extentIDs, extentID)
+	}
+	s.layoutMutex.RUnlock()
+
+	for _, extentID := range extentIDs {
+		if err := s.moveExtentToBucket(extentID); err != nil {
+			log.LogErrorf("action[migrateExtentLayout] partition(%v) extent(%v) err(%v)", s.partitionID, extentID, err)
+			return
+		}
+	}
+
+	s.layoutMutex.Lock()
+	defer s.layoutMutex.Unlock()
+	if len(s.flatExtents) > 0 || s.extentLayout != ExtentLayoutMigrating {
+		return
+	}
+	if err := s.persistExtentLayout(ExtentLayoutBucketed); err != nil {
+		log.LogErrorf("action[migrateExtentLayout] partition(%v) persist layout err(%v)", s.partitionID, err)
+		return
+	}
+	log.LogWarnf("action[migrateExtentLayout] partition(%v) all the extents are moved into the buckets", s.partitionID)
+}
+
+func (s *ExtentStore) moveExtentToBucket(extentID uint64) (err error) {
+	s.layoutMutex.Lock()
+	defer s.layoutMutex.Unlock()
+	if _, ok := s.flatExtents[extentID]; !ok {
+		return
+	}
+	name := strconv.FormatUint(extentID, 10)
+	bucketDir := path.Join(s.dataPath, extentBucket(extentID))
+	if err = MkdirAll(bucketDir); err != nil {
+		return
+	}
+	if err = os.Rename(path.Join(s.dataPath, name), path.Join(bucketDir, name)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	// the extent missing from the data directory has been deleted
+	delete(s.flatExtents, extentID)
+	s.cache.Del(extentID)
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func createTestExtents(t *testing.T, s *ExtentStore, count int) (contents map[uint64][]byte) {
+	contents = make(map[uint64][]byte)
+	for i := 0; i < count; i++ {
+		extentID, _ := s.NextExtentID()
+		if err := s.Create(extentID); err != nil {
+			t.Fatal(err)
+		}
+		data := bytes.Repeat([]byte{byte(extentID)}, PageSize)
+		if err := s.Write(extentID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+		contents[extentID] = data
+	}
+	return
+}
+
+// checkExtentLayout checks the layout of the store and the extents to be moved, and that the extents are read from
+// where they are on the disk.
+func checkExtentLayout(t *testing.T, s *ExtentStore, contents map[uint64][]byte, layout int32, flat int) {
+	if l, n := s.ExtentLayout(); l != layout || n != flat {
+		t.Fatalf("expect layout %v with %v flat extents, but is %v with %v", layout, flat, l, n)
+	}
+	inFlat := 0
+	for extentID, expected := range contents {
+		data := make([]byte, len(expected))
+		if _, err := s.Read(extentID, 0, int64(len(data)), data, false); err != nil {
+			t.Fatalf("read extent(%v): %v", extentID, err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("unexpected content of extent(%v)", extentID)
+		}
+		name := strconv.FormatUint(extentID, 10)
+		_, flatErr := os.Stat(path.Join(s.dataPath, name))
+		_, bucketErr := os.Stat(path.Join(s.dataPath, extentBucket(extentID), name))
+		if (flatErr == nil) == (bucketErr == nil) {
+			t.Fatalf("extent(%v) should be in either the data directory or the bucket, err(%v, %v)", extentID,
+				flatErr, bucketErr)
+		}
+		if flatErr == nil {
+			inFlat++
+		}
+	}
+	if layout == ExtentLayoutFlat {
+		flat = len(contents)
+	}
+	if inFlat != flat {
+		t.Fatalf("expect %v extents left in the data directory, but is %v", flat, inFlat)
+	}
+}
+
+func TestExtentLayoutMigration(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	contents := createTestExtents(t, s, 6)
+	checkExtentLayout(t, s, contents, ExtentLayoutFlat, 0)
+
+	if err = s.SetExtentLayout(ExtentLayoutBucketed); err != nil {
+		t.Fatal(err)
+	}
+	checkExtentLayout(t, s, contents, ExtentLayoutMigrating, 6)
+	// the extents created meanwhile go into the buckets
+	for extentID, data := range createTestExtents(t, s, 2) {
+		contents[extentID] = data
+	}
+	checkExtentLayout(t, s, contents, ExtentLayoutMigrating, 6)
+
+	// crash after some of the extents are moved
+	moved := 0
+	for extentID := range contents {
+		if _, ok := s.flatExtents[extentID]; !ok {
+			continue
+		}
+		if err = s.moveExtentToBucket(extentID); err != nil {
+			t.Fatal(err)
+		}
+		if moved++; moved == 3 {
+			break
+		}
+	}
+	s.Close()
+	s = newTestExtentStore(t, dataDir)
+	checkExtentLayout(t, s, contents, ExtentLayoutMigrating, 3)
+
+	// an extent left in the data directory is deleted before it is moved
+	var deleted uint64
+	for extentID := range s.flatExtents {
+		deleted = extentID
+		break
+	}
+	if err = s.MarkDelete(deleted, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	delete(contents, deleted)
+	checkExtentLayout(t, s, contents, ExtentLayoutMigrating, 2)
+
+	// crash after all the extents are moved, before the layout is persisted
+	for extentID := range contents {
+		if err = s.moveExtentToBucket(extentID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	checkExtentLayout(t, s, contents, ExtentLayoutBucketed, 0)
+	if err = s.SetExtentLayout(ExtentLayoutFlat); err == nil {
+		t.Fatalf("the store should not be downgraded to the flat layout")
+	}
+}
+
+func TestExtentLayoutMigrationTask(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	contents := createTestExtents(t, s, 4)
+	if err = s.SetExtentLayout(ExtentLayoutBucketed); err != nil {
+		t.Fatal(err)
+	}
+	// the extents are cached by the reads by the old paths before they are moved
+	checkExtentLayout(t, s, contents, ExtentLayoutMigrating, 4)
+
+	s.migrateExtentLayout()
+	checkExtentLayout(t, s, contents, ExtentLayoutBucketed, 0)
+	// the extents opened again by the new paths are written
+	for extentID, data := range contents {
+		if err = s.Write(extentID, PageSize, PageSize, data, crc32.ChecksumIEEE(data), AppendWriteType, true); err != nil {
+			t.Fatalf("write extent(%v) moved: %v", extentID, err)
+		}
+		contents[extentID] = append(data, data...)
+	}
+	s.Close()
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	checkExtentLayout(t, s, contents, ExtentLayoutBucketed, 0)
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The extent meta is kept in two copies, EXTENT_META and its mirror, so that the base extent ID is not reset by the
+// corruption of a single file, or the new extents may collide with the existing ones. A copy is the base extent ID,
+// the extent ID preallocated on the verify file and the layout of the extent files at the same offsets as written by
+// the older versions, followed by the generation, which is increased by every update, and the crc of the 32 bytes.
+//
+// The copies are validated on startup, and the valid one of the higher generation is loaded and written back to both.
+// If neither is valid, the meta is rebuilt from the directory scan: the base extent ID is moved past the extent files,
+// the deletion records and the intents, and then by ExtentIDRebuildGap more, since the extents allocated but not
+// created on this replica are unknown. The rebuilt meta is reported by ExtentMetaStatus to be alarmed.
+const (
+	ExtMetaMirrorFileName = "EXTENT_META_MIRROR"
+	ExtentMetaSize        = 36
+	ExtentIDRebuildGap    = 100000 // the base extent ID is moved past the extents seen by the gap when rebuilt
+)
+
+// The status of the extent meta loaded on startup.
+const (
+	ExtentMetaIntact   = 0 // both copies are valid
+	ExtentMetaLegacy   = 1 // written by the versions without the crc, and upgraded
+	ExtentMetaRestored = 2 // one copy is broken, and restored from the other
+	ExtentMetaRebuilt  = 3 // both copies are broken, and the base extent ID is guessed from the directory scan
+)
+
+const (
+	legacyExtentMetaSize = 24
+	extentMetaGenOffset  = 24
+	extentMetaCrcOffset  = 32
+)
+
+type extentMeta struct {
+	baseExtentID     uint64
+	preAllocExtentID uint64
+	layout           int32
+	generation       uint64
+}
+
+func (m *extentMeta) encode() []byte {
+	data := make([]byte, ExtentMetaSize)
+	binary.BigEndian.PutUint64(data[BaseExtentIDOffset:], m.baseExtentID)
+	binary.BigEndian.PutUint64(data[PreAllocExtentIDOffset:], m.preAllocExtentID)
+	binary.BigEndian.PutUint64(data[ExtentLayoutOffset:], uint64(m.layout))
+	binary.BigEndian.PutUint64(data[extentMetaGenOffset:], m.generation)
+	binary.BigEndian.PutUint32(data[extentMetaCrcOffset:], crc32.ChecksumIEEE(data[:extentMetaCrcOffset]))
+	return data
+}
+
+// decodeExtentMeta decodes a copy of the extent meta, and fails it if it is torn, fails the crc or holds an unknown
+// layout.
+func decodeExtentMeta(data []byte) (m *extentMeta, err error) {
+	if len(data) < ExtentMetaSize {
+		return nil, fmt.Errorf("extent meta size(%v) is short", len(data))
+	}
+	if crc32.ChecksumIEEE(data[:extentMetaCrcOffset]) != binary.BigEndian.Uint32(data[extentMetaCrcOffset:]) {
+		return nil, fmt.Errorf("extent meta crc mismatch")
+	}
+	m = &extentMeta{
+		baseExtentID:     binary.BigEndian.Uint64(data[BaseExtentIDOffset:]),
+		preAllocExtentID: binary.BigEndian.Uint64(data[PreAllocExtentIDOffset:]),
+		layout:           int32(binary.BigEndian.Uint64(data[ExtentLayoutOffset:])),
+		generation:       binary.BigEndian.Uint64(data[extentMetaGenOffset:]),
+	}
+	if m.layout < ExtentLayoutFlat || m.layout > ExtentLayoutBucketed {
+		return nil, fmt.Errorf("extent meta layout(%v) is unknown", m.layout)
+	}
+	return
+}
+
+// decodeLegacyExtentMeta decodes the extent meta written by the versions without the crc, which is 8, 16 or 24 bytes
+// as the fields are added, or empty if the store is new.
+func decodeLegacyExtentMeta(data []byte) (m *extentMeta, err error) {
+	if len(data)%8 != 0 || len(data) > legacyExtentMetaSize {
+		return nil, fmt.Errorf("legacy extent meta size(%v) is torn", len(data))
+	}
+	m = new(extentMeta)
+	if len(data) >= PreAllocExtentIDOffset {
+		m.baseExtentID = binary.BigEndian.Uint64(data[BaseExtentIDOffset:])
+	}
+	if len(data) >= ExtentLayoutOffset {
+		m.preAllocExtentID = binary.BigEndian.Uint64(data[PreAllocExtentIDOffset:])
+	}
+	if len(data) >= legacyExtentMetaSize {
+		m.layout = int32(binary.BigEndian.Uint64(data[ExtentLayoutOffset:]))
+	}
+	if m.layout < ExtentLayoutFlat || m.layout > ExtentLayoutBucketed {
+		return nil, fmt.Errorf("legacy extent meta layout(%v) is unknown", m.layout)
+	}
+	return
+}
+
+func (s *ExtentStore) openExtentMeta() (err error) {
+	if s.metadataFp, err = os.OpenFile(path.Join(s.dataPath, ExtBaseExtentIDFileName), os.O_CREATE|os.O_RDWR, 0666); err != nil {
+		return
+	}
+	s.metaMirrorFp, err = os.OpenFile(path.Join(s.dataPath, ExtMetaMirrorFileName), os.O_CREATE|os.O_RDWR, 0666)
+	return
+}
+
+// loadExtentMeta validates both copies of the extent meta, and loads the valid one of the higher generation. The
+// broken copy is written back at once, and so is the legacy one, so that it is mirrored from now on.
+func (s *ExtentStore) loadExtentMeta() (err error) {
+	primary, err := readExtentMetaFile(s.metadataFp)
+	if err != nil {
+		return
+	}
+	mirror, err := readExtentMetaFile(s.metaMirrorFp)
+	if err != nil {
+		return
+	}
+	primaryMeta, primaryErr := decodeExtentMeta(primary)
+	mirrorMeta, mirrorErr := decodeExtentMeta(mirror)
+	switch {
+	case primaryErr == nil && mirrorErr == nil:
+		s.meta = *primaryMeta
+		if mirrorMeta.generation > primaryMeta.generation {
+			s.meta = *mirrorMeta
+		}
+		s.metaStatus = ExtentMetaIntact
+		if primaryMeta.generation == mirrorMeta.generation {
+			return
+		}
+		// torn between the writes of the copies
+		return s.persistExtentMeta(false)
+	case primaryErr == nil || mirrorErr == nil:
+		if primaryErr == nil {
+			s.meta = *primaryMeta
+			s.metaError = fmt.Sprintf("%v is broken: %v", ExtMetaMirrorFileName, mirrorErr)
+		} else {
+			s.meta = *mirrorMeta
+			s.metaError = fmt.Sprintf("%v is broken: %v", ExtBaseExtentIDFileName, primaryErr)
+		}
+		// the mirror is empty if the first startup after the upgrade crashed before writing it
+		if primaryErr == nil && len(mirror) == 0 {
+			s.metaStatus = ExtentMetaLegacy
+			s.metaError = ""
+			return s.persistExtentMeta(true)
+		}
+		s.metaStatus = ExtentMetaRestored
+		log.LogWarnf("loadExtentMeta: partition(%v) %v, restored from the other copy", s.partitionID, s.metaError)
+		return s.persistExtentMeta(true)
+	}
+	if len(mirror) == 0 {
+		legacyMeta, legacyErr := decodeLegacyExtentMeta(primary)
+		if legacyErr == nil && len(primary) == 0 && !s.hasExtentFiles() {
+			// a new store
+			s.meta = *legacyMeta
+			s.metaStatus = ExtentMetaIntact
+			return s.persistExtentMeta(true)
+		}
+		if legacyErr == nil && len(primary) != 0 {
+			s.meta = *legacyMeta
+			s.metaStatus = ExtentMetaLegacy
+			return s.persistExtentMeta(true)
+		}
+		if legacyErr != nil {
+			primaryErr = legacyErr
+		}
+	}
+	s.metaStatus = ExtentMetaRebuilt
+	s.metaError = fmt.Sprintf("both copies are broken: %v; %v", primaryErr, mirrorErr)
+	log.LogErrorf("loadExtentMeta: partition(%v) %v, rebuilt from the directory scan", s.partitionID, s.metaError)
+	return s.rebuildExtentMeta()
+}
+
+// rebuildExtentMeta rebuilds the extent meta when both copies are broken. The layout is inferred from the buckets,
+// and corrected by listExtentFiles, and the base extent ID is moved past the deletion records here, and past the
+// extent files and by ExtentIDRebuildGap in initBaseFileID. The verify file is preallocated again from the start.
+func (s *ExtentStore) rebuildExtentMeta() (err error) {
+	s.meta = extentMeta{layout: ExtentLayoutFlat}
+	for bucket := 0; bucket < ExtentBucketCount; bucket++ {
+		if _, statErr := os.Stat(path.Join(s.dataPath, extentBucket(uint64(bucket)))); statErr == nil {
+			s.meta.layout = ExtentLayoutMigrating
+			break
+		}
+	}
+	data, err := ioutil.ReadFile(path.Join(s.dataPath, NormalExtDeletedFileName))
+	if err != nil {
+		return
+	}
+	for off := 0; off+8 <= len(data); off += 8 {
+		if extentID := binary.BigEndian.Uint64(data[off : off+8]); extentID > s.meta.baseExtentID {
+			s.meta.baseExtentID = extentID
+		}
+	}
+	return s.persistExtentMeta(true)
+}
+
+// hasExtentFiles tells if the data directory holds any extent file, or any bucket of them, so that an empty meta is
+// not taken for a new store.
+func (s *ExtentStore) hasExtentFiles() bool {
+	files, err := ioutil.ReadDir(s.dataPath)
+	if err != nil {
+		return true
+	}
+	for _, f := range files {
+		if _, isExtent := s.ExtentID(f.Name()); isExtent {
+			return true
+		}
+		if f.IsDir() && len(f.Name()) == 3 && f.Name()[0] == 'b' {
+			return true
+		}
+	}
+	if info, err := os.Stat(path.Join(s.dataPath, NormalExtDeletedFileName)); err == nil && info.Size() > 0 {
+		return true
+	}
+	return false
+}
+
+func readExtentMetaFile(fp *os.File) (data []byte, err error) {
+	info, err := fp.Stat()
+	if err != nil {
+		return
+	}
+	data = make([]byte, info.Size())
+	if _, err = fp.ReadAt(data, 0); err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// persistExtentMeta increases the generation and writes both copies, the primary one first, so that at least one
+// copy is valid if the writes are torn. The caller holds the metaMutex, or is loading the store.
+func (s *ExtentStore) persistExtentMeta(sync bool) (err error) {
+	s.meta.generation++
+	data := s.meta.encode()
+	for _, fp := range []*os.File{s.metadataFp, s.metaMirrorFp} {
+		if _, err = fp.WriteAt(data, 0); err != nil {
+			return
+		}
+		if !sync {
+			continue
+		}
+		if err = fp.Sync(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// updateExtentMeta applies the update to the extent meta, and persists it.
+func (s *ExtentStore) updateExtentMeta(update func(m *extentMeta), sync bool) (err error) {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	update(&s.meta)
+	return s.persistExtentMeta(sync)
+}
+
+// ExtentMetaStatus returns the status of the extent meta loaded on startup, and the error of the broken copies.
+func (s *ExtentStore) ExtentMetaStatus() (status int, msg string) {
+	return s.metaStatus, s.metaError
+}
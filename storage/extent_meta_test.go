@@ -0,0 +1,115 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestExtentMetaRestore(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	last, _ := s.NextExtentID()
+	s.Close()
+	if err = os.Truncate(path.Join(dataDir, ExtBaseExtentIDFileName), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestExtentStore(t, dataDir)
+	if status, msg := s.ExtentMetaStatus(); status != ExtentMetaRestored {
+		t.Fatalf("extent meta status(%v) msg(%v), expect restored", status, msg)
+	}
+	if next, _ := s.NextExtentID(); next <= last {
+		t.Fatalf("extent ID(%v) is allocated again", next)
+	}
+	s.Close()
+
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	if status, msg := s.ExtentMetaStatus(); status != ExtentMetaIntact {
+		t.Fatalf("extent meta status(%v) msg(%v), expect intact after the restore", status, msg)
+	}
+}
+
+func TestExtentMetaRebuild(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	kept, _ := s.NextExtentID()
+	deleted, _ := s.NextExtentID()
+	for _, extentID := range []uint64{kept, deleted} {
+		if err = s.Create(extentID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.MarkDelete(deleted, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	for _, name := range []string{ExtBaseExtentIDFileName, ExtMetaMirrorFileName} {
+		if err = ioutil.WriteFile(path.Join(dataDir, name), make([]byte, ExtentMetaSize), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	if status, msg := s.ExtentMetaStatus(); status != ExtentMetaRebuilt || msg == "" {
+		t.Fatalf("extent meta status(%v) msg(%v), expect rebuilt", status, msg)
+	}
+	if next, _ := s.NextExtentID(); next <= deleted+ExtentIDRebuildGap {
+		t.Fatalf("extent ID(%v) is not moved past the deleted extent(%v) by the gap", next, deleted)
+	}
+}
+
+func TestExtentMetaLegacy(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	legacy := make([]byte, legacyExtentMetaSize)
+	binary.BigEndian.PutUint64(legacy[BaseExtentIDOffset:], 5000)
+	if err = ioutil.WriteFile(path.Join(dataDir, ExtBaseExtentIDFileName), legacy, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestExtentStore(t, dataDir)
+	defer s.Close()
+	if status, msg := s.ExtentMetaStatus(); status != ExtentMetaLegacy {
+		t.Fatalf("extent meta status(%v) msg(%v), expect legacy", status, msg)
+	}
+	if next, _ := s.NextExtentID(); next != 5001 {
+		t.Fatalf("extent ID(%v) is not allocated after the legacy base", next)
+	}
+	mirror, err := ioutil.ReadFile(path.Join(dataDir, ExtMetaMirrorFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decodeExtentMeta(mirror); err != nil {
+		t.Fatalf("legacy extent meta is not mirrored: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"container/list"
+	"hash/crc32"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// an extent is mapped after it has been read for this number of times
+	MmapHotReadCount = 4
+	// an extent is mapped only if it has not been appended for this period (in terms of seconds)
+	MmapSealedSeconds = RepairInterval
+)
+
+// MmapStat is the statistics of the mapped extents of a disk.
+type MmapStat struct {
+	Budget    int64  `json:"budget"`
+	Mapped    int64  `json:"mapped"`
+	Extents   int    `json:"extents"`
+	Maps      uint64 `json:"maps"`
+	Unmaps    uint64 `json:"unmaps"`
+	Hits      uint64 `json:"hits"`
+	Fallbacks uint64 `json:"fallbacks"` // reads of the hot extents served by pread, as they cannot be mapped
+	Errors    uint64 `json:"errors"`
+}
+
+type extentMapping struct {
+	sync.RWMutex
+	e       *Extent
+	data    []byte
+	element *list.Element
+}
+
+// MmapCache maps the hot normal extents of a disk read-only, so that their reads are served by copying from the
+// mappings instead of a pread each. The mapped bytes are bounded by the budget, and the least recently read
+// extents are unmapped to make room for the others.
+type MmapCache struct {
+	budget    int64
+	mapped    int64
+	mappings  map[*Extent]*extentMapping
+	lru       *list.List
+	lock      sync.Mutex
+	maps      uint64
+	unmaps    uint64
+	hits      uint64
+	fallbacks uint64
+	errors    uint64
+}
+
+// NewMmapCache creates a cache which maps up to the budget bytes of extents.
+func NewMmapCache(budget int64) *MmapCache {
+	return &MmapCache{
+		budget:   budget,
+		mappings: make(map[*Extent]*extentMapping),
+		lru:      list.New(),
+	}
+}
+
+// Read copies the data of the extent from its mapping. It returns false if the extent is not mapped, and the caller
+// reads the extent by pread instead.
+func (c *MmapCache) Read(e *Extent, data []byte, offset, size int64) (crc uint32, ok bool) {
+	m := c.acquire(e, offset+size)
+	if m == nil {
+		return
+	}
+	if !m.copy(data[:size], offset) {
+		atomic.AddUint64(&c.errors, 1)
+		log.LogWarnf("action[MmapCache.Read] extent(%v) offset(%v) size(%v) is truncated under the mapping",
+			e.filePath, offset, size)
+		c.drop(m)
+		return
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return crc32.ChecksumIEEE(data[:size]), true
+}
+
+// copy copies the data from the read locked mapping and unlocks it. It returns false if the pages are gone as the
+// file has been truncated, which would otherwise crash the process by SIGBUS.
+func (m *extentMapping) copy(data []byte, offset int64) (ok bool) {
+	defer m.RUnlock()
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isFault := r.(interface{ Addr() uintptr }); !isFault {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	copy(data, m.data[offset:])
+	return true
+}
+
+// acquire returns the read locked mapping of the extent which covers the end, and maps the extent if it is hot.
+func (c *MmapCache) acquire(e *Extent, end int64) (m *extentMapping) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m, ok := c.mappings[e]
+	if ok && int64(len(m.data)) < end {
+		// the extent has grown since it was mapped
+		c.unmap(m)
+		ok = false
+	}
+	if !ok {
+		if atomic.AddUint32(&e.reads, 1) < MmapHotReadCount ||
+			time.Now().Unix()-e.ModifyTime() < MmapSealedSeconds {
+			return nil
+		}
+		if m = c.mmap(e, end); m == nil {
+			atomic.AddUint64(&c.fallbacks, 1)
+			return nil
+		}
+	}
+	c.lru.MoveToBack(m.element)
+	m.RLock()
+	return
+}
+
+func (c *MmapCache) mmap(e *Extent, end int64) *extentMapping {
+	size := e.Size()
+	if size < end || size > c.budget || e.HasClosed() {
+		return nil
+	}
+	for c.mapped+size > c.budget {
+		c.unmap(c.lru.Front().Value.(*extentMapping))
+	}
+	data, err := mmapFile(int(e.file.Fd()), size)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		log.LogWarnf("action[MmapCache.mmap] extent(%v) size(%v) err(%v)", e.filePath, size, err)
+		return nil
+	}
+	m := &extentMapping{e: e, data: data}
+	m.element = c.lru.PushBack(m)
+	c.mappings[e] = m
+	c.mapped += size
+	atomic.AddUint64(&c.maps, 1)
+	return m
+}
+
+// unmap waits for the reads of the mapping, and unmaps it. The caller must hold the lock of the cache.
+func (c *MmapCache) unmap(m *extentMapping) {
+	size := int64(len(m.data))
+	m.Lock()
+	if err := munmapFile(m.data); err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		log.LogWarnf("action[MmapCache.unmap] extent(%v) err(%v)", m.e.filePath, err)
+	}
+	m.data = nil
+	m.Unlock()
+	c.mapped -= size
+	delete(c.mappings, m.e)
+	c.lru.Remove(m.element)
+	atomic.AddUint64(&c.unmaps, 1)
+}
+
+// drop unmaps the mapping failing to be read, and the extent has to be hot again to be mapped.
+func (c *MmapCache) drop(m *extentMapping) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.mappings[m.e] == m {
+		c.unmap(m)
+	}
+	atomic.StoreUint32(&m.e.reads, 0)
+}
+
+// Release unmaps the extent, which is called when the extent is closed.
+func (c *MmapCache) Release(e *Extent) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if m, ok := c.mappings[e]; ok {
+		c.unmap(m)
+	}
+}
+
+// Stat returns the statistics of the cache.
+func (c *MmapCache) Stat() *MmapStat {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &MmapStat{
+		Budget:    c.budget,
+		Mapped:    c.mapped,
+		Extents:   len(c.mappings),
+		Maps:      atomic.LoadUint64(&c.maps),
+		Unmaps:    atomic.LoadUint64(&c.unmaps),
+		Hits:      atomic.LoadUint64(&c.hits),
+		Fallbacks: atomic.LoadUint64(&c.fallbacks),
+		Errors:    atomic.LoadUint64(&c.errors),
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// newMmapTestExtent creates a store mapping the hot extents, with a normal extent of the blocks.
+func newMmapTestExtent(t *testing.T, dataDir string, blocks int) (s *ExtentStore, cache *MmapCache, extentID uint64, content []byte) {
+	s = newTestExtentStore(t, dataDir)
+	cache = NewMmapCache(1 << 30)
+	s.SetMmapCache(cache)
+	extentID, _ = s.NextExtentID()
+	if err := s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	content = make([]byte, blocks*util.BlockSize)
+	for i := range content {
+		content[i] = byte(i % 253)
+	}
+	appendMmapTestExtent(t, s, extentID, 0, content)
+	return
+}
+
+func appendMmapTestExtent(t *testing.T, s *ExtentStore, extentID uint64, offset int, content []byte) {
+	for i := 0; i < len(content); i += util.BlockSize {
+		data := content[i:util.Min(i+util.BlockSize, len(content))]
+		if err := s.Write(extentID, int64(offset+i), int64(len(data)), data, crc32.ChecksumIEEE(data),
+			AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mapMmapTestExtent seals the extent, and reads it until it is mapped.
+func mapMmapTestExtent(t *testing.T, s *ExtentStore, cache *MmapCache, extentID uint64) *Extent {
+	e, err := s.extentWithHeaderByExtentID(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&e.modifyTime, time.Now().Unix()-MmapSealedSeconds-1)
+	hits := cache.Stat().Hits
+	buf := make([]byte, PageSize)
+	for i := 0; i < MmapHotReadCount; i++ {
+		if _, err = s.Read(extentID, 0, PageSize, buf, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stat := cache.Stat(); stat.Hits <= hits || stat.Extents != 1 {
+		t.Fatalf("the extent should be mapped once hot, stat %+v", stat)
+	}
+	return e
+}
+
+func TestMmapReadPastSize(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s, cache, extentID, content := newMmapTestExtent(t, dataDir, 2)
+	defer s.Close()
+	mapMmapTestExtent(t, s, cache, extentID)
+
+	buf := make([]byte, util.BlockSize)
+	if _, err = s.Read(extentID, int64(len(content))-10, 100, buf, false); err == nil {
+		t.Fatalf("the read past the size should fail")
+	}
+	if stat := cache.Stat(); stat.Extents != 1 || stat.Unmaps != 0 || stat.Errors != 0 {
+		t.Fatalf("the read past the size should not touch the mapping, stat %+v", stat)
+	}
+
+	// the extent grown since it was mapped is mapped again to cover the new data
+	appended := bytes.Repeat([]byte{0xa5}, util.BlockSize)
+	appendMmapTestExtent(t, s, extentID, len(content), appended)
+	mapMmapTestExtent(t, s, cache, extentID)
+	if _, err = s.Read(extentID, int64(len(content)), 100, buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:100], appended[:100]) {
+		t.Fatalf("unexpected data of the grown extent")
+	}
+	if stat := cache.Stat(); stat.Maps != 2 || stat.Unmaps != 1 || stat.Mapped != int64(len(content)+len(appended)) {
+		t.Fatalf("the grown extent should be mapped again, stat %+v", stat)
+	}
+}
+
+func TestMmapReadTruncated(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s, cache, extentID, content := newMmapTestExtent(t, dataDir, 2)
+	defer s.Close()
+	e := mapMmapTestExtent(t, s, cache, extentID)
+
+	// the pages truncated by others under the mapping fault instead of crashing the process
+	if err = os.Truncate(e.filePath, util.BlockSize); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, PageSize)
+	if _, ok := cache.Read(e, buf, util.BlockSize+PageSize, PageSize); ok {
+		t.Fatalf("the truncated data should not be read from the mapping")
+	}
+	if stat := cache.Stat(); stat.Errors != 1 || stat.Extents != 0 || stat.Mapped != 0 {
+		t.Fatalf("the mapping of the truncated extent should be dropped, stat %+v", stat)
+	}
+	if _, err = s.Read(extentID, PageSize, PageSize, buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, content[PageSize:2*PageSize]) {
+		t.Fatalf("unexpected data of the extent left")
+	}
+}
+
+func TestMmapReadDeleted(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s, cache, extentID, _ := newMmapTestExtent(t, dataDir, 1)
+	defer s.Close()
+	e := mapMmapTestExtent(t, s, cache, extentID)
+
+	if err = s.MarkDelete(extentID, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if stat := cache.Stat(); stat.Extents != 0 || stat.Mapped != 0 || stat.Unmaps != 1 {
+		t.Fatalf("the deleted extent should be unmapped, stat %+v", stat)
+	}
+	buf := make([]byte, PageSize)
+	if _, err = s.Read(extentID, 0, PageSize, buf, false); err == nil {
+		t.Fatalf("the deleted extent should not be read")
+	}
+	// the readers holding the extent closed do not map it again
+	for i := 0; i < MmapHotReadCount; i++ {
+		if _, ok := cache.Read(e, buf, 0, PageSize); ok {
+			t.Fatalf("the closed extent should not be read from a mapping")
+		}
+	}
+	if stat := cache.Stat(); stat.Maps != 1 || stat.Extents != 0 {
+		t.Fatalf("the closed extent should not be mapped again, stat %+v", stat)
+	}
+}
@@ -0,0 +1,892 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/google/btree"
+)
+
+// The packed format of the tiny extents. The data of tiny extent <id> is appended to the segment <id>.pack as the
+// records, each of which is a header followed by the data. The deletes are appended as the records as well instead
+// of punching the holes, so the small files are stored without the page alignment and the deletes never fragment
+// the file. The in-memory index from the offsets of the extent to the data in the segment is rebuilt by scanning the
+// record headers on load, and the dead space is dropped by the compaction in the background.
+//
+// The file <id> of the plain format is kept empty as the placeholder, and the segment takes over if both exist.
+const (
+	PackedExtentSuffix = ".pack"
+	TempExtentSuffix   = ".tmp"
+
+	PackedCompactMinGarbage   = 64 * util.MB // a segment is compacted if the dead space reaches both the size
+	PackedCompactGarbageRatio = 0.5          // and the ratio of the segment
+)
+
+const (
+	packedRecordHeaderSize        = 32
+	packedRecordMagic      uint32 = 0x43465054
+
+	packedRecordData   = 1 // the data written at the offset
+	packedRecordDelete = 2 // the range deleted
+	packedRecordExtend = 3 // the size extended without data, by the empty packets of the repair
+
+	// the data crc of the records in the tail of the segment is verified on load to drop the torn writes, which
+	// are the ones not synced before the crash
+	packedVerifyTailSize = 64 * util.MB
+	packedCopyUnit       = util.BlockSize
+)
+
+// packedRecord is the header of a record of the segment:
+// magic(4) | type(1) | reserved(3) | offset(8) | size(8) | data crc(4) | header crc(4)
+type packedRecord struct {
+	kind   uint8
+	offset int64
+	size   int64
+	crc    uint32
+}
+
+func (r *packedRecord) marshal(b []byte) {
+	binary.BigEndian.PutUint32(b[0:4], packedRecordMagic)
+	b[4] = r.kind
+	b[5], b[6], b[7] = 0, 0, 0
+	binary.BigEndian.PutUint64(b[8:16], uint64(r.offset))
+	binary.BigEndian.PutUint64(b[16:24], uint64(r.size))
+	binary.BigEndian.PutUint32(b[24:28], r.crc)
+	binary.BigEndian.PutUint32(b[28:32], crc32.ChecksumIEEE(b[0:28]))
+}
+
+func (r *packedRecord) unmarshal(b []byte) bool {
+	if binary.BigEndian.Uint32(b[0:4]) != packedRecordMagic || binary.BigEndian.Uint32(b[28:32]) != crc32.ChecksumIEEE(b[0:28]) {
+		return false
+	}
+	r.kind = b[4]
+	r.offset = int64(binary.BigEndian.Uint64(b[8:16]))
+	r.size = int64(binary.BigEndian.Uint64(b[16:24]))
+	r.crc = binary.BigEndian.Uint32(b[24:28])
+	switch {
+	case r.kind < packedRecordData || r.kind > packedRecordExtend:
+		return false
+	case r.offset < 0 || r.size < 0 || r.offset+r.size > ExtentMaxSize:
+		return false
+	}
+	return true
+}
+
+func (r *packedRecord) dataSize() int64 {
+	if r.kind == packedRecordData {
+		return r.size
+	}
+	return 0
+}
+
+// packedEntry maps the range of the extent to the position of its data in the segment.
+type packedEntry struct {
+	offset int64
+	size   int64
+	pos    int64
+}
+
+func (e packedEntry) Less(than btree.Item) bool {
+	return e.offset < than.(packedEntry).offset
+}
+
+func (e packedEntry) end() int64 {
+	return e.offset + e.size
+}
+
+// packedExtent is the segment of a tiny extent in the packed format. The entries of the index never overlap, the
+// later records overriding the former ones, and the data of the records is never changed once appended.
+type packedExtent struct {
+	file      *os.File
+	filePath  string
+	index     *btree.BTree
+	end       int64 // size of the segment, where the next record is appended
+	size      int64 // size of the extent, the same as the file size in the plain format
+	liveBytes int64 // data of the segment referred by the index
+	sync.RWMutex
+}
+
+func packedExtentPath(filePath string) string {
+	return filePath + PackedExtentSuffix
+}
+
+func newPackedExtent(file *os.File, filePath string) *packedExtent {
+	return &packedExtent{
+		file:     file,
+		filePath: filePath,
+		index:    btree.New(32),
+	}
+}
+
+func createPackedExtent(filePath string) (p *packedExtent, err error) {
+	var file *os.File
+	if file, err = os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666); err != nil {
+		return
+	}
+	return newPackedExtent(file, filePath), nil
+}
+
+// openPackedExtent opens the segment and rebuilds the index, truncating the torn records at the end.
+func openPackedExtent(filePath string) (p *packedExtent, err error) {
+	var (
+		file *os.File
+		info os.FileInfo
+		end  int64
+	)
+	if file, err = os.OpenFile(filePath, os.O_RDWR, 0666); err != nil {
+		return
+	}
+	p = newPackedExtent(file, filePath)
+	defer func() {
+		if err != nil {
+			file.Close()
+		}
+	}()
+	if info, err = file.Stat(); err != nil {
+		return
+	}
+	if end, err = p.scan(0, info.Size(), info.Size()-packedVerifyTailSize, func(r *packedRecord, dataPos int64) error {
+		p.apply(r, dataPos)
+		return nil
+	}); err != nil {
+		return
+	}
+	if end < info.Size() {
+		log.LogWarnf("action[openPackedExtent] %v drops the torn records from %v to %v", filePath, end, info.Size())
+		if err = file.Truncate(end); err != nil {
+			return
+		}
+	}
+	p.end = end
+	return
+}
+
+// scan iterates the records within the range of the segment, and returns where it stops, which is the end of the
+// last valid record. The data crc is verified for the records whose data is after verifyFrom.
+func (p *packedExtent) scan(from, to, verifyFrom int64, fn func(r *packedRecord, dataPos int64) error) (pos int64, err error) {
+	var (
+		header = make([]byte, packedRecordHeaderSize)
+		data   []byte
+		r      packedRecord
+	)
+	for pos = from; pos+packedRecordHeaderSize <= to; {
+		if _, err = p.file.ReadAt(header, pos); err != nil {
+			return
+		}
+		if !r.unmarshal(header) {
+			return
+		}
+		dataPos := pos + packedRecordHeaderSize
+		if dataPos+r.dataSize() > to {
+			return
+		}
+		if r.kind == packedRecordData && dataPos >= verifyFrom {
+			if int64(cap(data)) < r.size {
+				data = make([]byte, r.size)
+			}
+			if _, err = p.file.ReadAt(data[:r.size], dataPos); err != nil {
+				return
+			}
+			if crc32.ChecksumIEEE(data[:r.size]) != r.crc {
+				return
+			}
+		}
+		if err = fn(&r, dataPos); err != nil {
+			return
+		}
+		pos = dataPos + r.dataSize()
+	}
+	return
+}
+
+// ascend calls fn on the entries overlapping the range in order.
+func (p *packedExtent) ascend(start, end int64, fn func(e packedEntry) bool) {
+	pivot := packedEntry{offset: start}
+	next := true
+	p.index.DescendLessOrEqual(pivot, func(item btree.Item) bool {
+		if e := item.(packedEntry); e.offset < start && e.end() > start {
+			next = fn(e)
+		}
+		return false
+	})
+	if !next {
+		return
+	}
+	p.index.AscendRange(pivot, packedEntry{offset: end}, func(item btree.Item) bool {
+		return fn(item.(packedEntry))
+	})
+}
+
+func (p *packedExtent) insert(e packedEntry) {
+	p.index.ReplaceOrInsert(e)
+	p.liveBytes += e.size
+}
+
+// remove removes the range from the index, splitting the entries across the boundaries.
+func (p *packedExtent) remove(start, end int64) (removed bool) {
+	hits := make([]packedEntry, 0)
+	p.ascend(start, end, func(e packedEntry) bool {
+		hits = append(hits, e)
+		return true
+	})
+	for _, e := range hits {
+		p.index.Delete(e)
+		p.liveBytes -= e.size
+		if e.offset < start {
+			p.insert(packedEntry{offset: e.offset, size: start - e.offset, pos: e.pos})
+		}
+		if e.end() > end {
+			p.insert(packedEntry{offset: end, size: e.end() - end, pos: e.pos + end - e.offset})
+		}
+	}
+	return len(hits) > 0
+}
+
+func (p *packedExtent) apply(r *packedRecord, dataPos int64) {
+	switch r.kind {
+	case packedRecordData:
+		p.remove(r.offset, r.offset+r.size)
+		if r.size > 0 {
+			p.insert(packedEntry{offset: r.offset, size: r.size, pos: dataPos})
+		}
+	case packedRecordDelete:
+		p.remove(r.offset, r.offset+r.size)
+		return
+	}
+	if r.offset+r.size > p.size {
+		p.size = r.offset + r.size
+	}
+}
+
+// append appends the record and applies it to the index. The caller holds the lock.
+func (p *packedExtent) append(r *packedRecord, data []byte) (err error) {
+	buf := make([]byte, packedRecordHeaderSize+len(data))
+	r.marshal(buf)
+	copy(buf[packedRecordHeaderSize:], data)
+	if _, err = p.file.WriteAt(buf, p.end); err != nil {
+		return
+	}
+	p.apply(r, p.end+packedRecordHeaderSize)
+	p.end += int64(len(buf))
+	return
+}
+
+func (p *packedExtent) write(data []byte, offset int64, isSync bool) (err error) {
+	p.Lock()
+	err = p.append(&packedRecord{kind: packedRecordData, offset: offset, size: int64(len(data)), crc: crc32.ChecksumIEEE(data)}, data)
+	p.Unlock()
+	if err != nil || !isSync {
+		return
+	}
+	return p.sync()
+}
+
+// read reads the range of the extent, in which the holes are read as zeros. It returns io.EOF if the range is
+// beyond the size of the extent, as reading the file of the plain format.
+func (p *packedExtent) read(data []byte, offset int64) (err error) {
+	for i := range data {
+		data[i] = 0
+	}
+	end := offset + int64(len(data))
+	p.RLock()
+	defer p.RUnlock()
+	p.ascend(offset, end, func(e packedEntry) bool {
+		from, to := e.offset, e.end()
+		if from < offset {
+			from = offset
+		}
+		if to > end {
+			to = end
+		}
+		_, err = p.file.ReadAt(data[from-offset:to-offset], e.pos+from-e.offset)
+		return err == nil
+	})
+	if err == nil && end > p.size {
+		err = io.EOF
+	}
+	return
+}
+
+// delete deletes the range, and returns whether the range has been deleted before.
+func (p *packedExtent) delete(offset, size int64) (hasDelete bool, err error) {
+	p.Lock()
+	defer p.Unlock()
+	hasDelete = true
+	p.ascend(offset, offset+size, func(e packedEntry) bool {
+		hasDelete = false
+		return false
+	})
+	if hasDelete {
+		return
+	}
+	err = p.append(&packedRecord{kind: packedRecordDelete, offset: offset, size: size}, nil)
+	return
+}
+
+// recover appends the data repaired at the end of the extent, or extends the extent by the empty packet.
+func (p *packedExtent) recover(data []byte, offset, size int64, isEmptyPacket bool) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	if !isEmptyPacket {
+		return p.append(&packedRecord{kind: packedRecordData, offset: offset, size: size, crc: crc32.ChecksumIEEE(data[:size])}, data[:size])
+	}
+	if offset < p.size {
+		return fmt.Errorf("error empty packet on (%v) offset(%v) size(%v) extent size(%v)", p.filePath, offset, size, p.size)
+	}
+	return p.append(&packedRecord{kind: packedRecordExtend, offset: offset, size: size}, nil)
+}
+
+// dataRun returns the range of the data at or after the offset as SEEK_DATA and SEEK_HOLE do on the file of the
+// plain format, including the padding to the pages. It returns syscall.ENXIO if there is no data.
+func (p *packedExtent) dataRun(offset int64) (start, end int64, err error) {
+	p.RLock()
+	defer p.RUnlock()
+	start, end = -1, -1
+	p.ascend(offset, math.MaxInt64, func(e packedEntry) bool {
+		if start < 0 {
+			start = e.offset - e.offset%PageSize
+			if start < offset {
+				start = offset
+			}
+		} else if e.offset > end {
+			return false
+		}
+		end = e.end()
+		if end%PageSize != 0 {
+			end = end + (PageSize - end%PageSize)
+		}
+		// the run is cut by the callers anyway
+		return end-start < util.BlockSize
+	})
+	if start < 0 {
+		return 0, 0, syscall.ENXIO
+	}
+	if end > p.size {
+		end = p.size
+	}
+	return
+}
+
+func (p *packedExtent) sync() (err error) {
+	p.RLock()
+	defer p.RUnlock()
+	return p.file.Sync()
+}
+
+func (p *packedExtent) close() error {
+	return p.file.Close()
+}
+
+func (p *packedExtent) needCompaction() bool {
+	p.RLock()
+	defer p.RUnlock()
+	garbage := p.end - p.liveBytes
+	return garbage >= PackedCompactMinGarbage && float64(garbage) >= float64(p.end)*PackedCompactGarbageRatio
+}
+
+// compact rewrites the live data into a new segment to drop the dead space. The writes go on while the data is
+// copied, and the records appended meanwhile are copied again before the new segment takes over.
+func (p *packedExtent) compact() (err error) {
+	p.Lock()
+	index, from, size := p.index.Clone(), p.end, p.size
+	p.Unlock()
+
+	var (
+		tmp *packedExtent
+		buf []byte
+	)
+	if tmp, err = createPackedExtent(p.filePath + TempExtentSuffix); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.close()
+			os.Remove(tmp.filePath)
+		}
+	}()
+	// the size is kept even if the data at the end is deleted
+	if err = tmp.append(&packedRecord{kind: packedRecordExtend, size: size}, nil); err != nil {
+		return
+	}
+	index.Ascend(func(item btree.Item) bool {
+		e := item.(packedEntry)
+		if int64(cap(buf)) < e.size {
+			buf = make([]byte, e.size)
+		}
+		if _, err = p.file.ReadAt(buf[:e.size], e.pos); err != nil {
+			return false
+		}
+		err = tmp.append(&packedRecord{kind: packedRecordData, offset: e.offset, size: e.size, crc: crc32.ChecksumIEEE(buf[:e.size])}, buf[:e.size])
+		return err == nil
+	})
+	if err != nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if _, err = p.scan(from, p.end, math.MaxInt64, func(r *packedRecord, dataPos int64) error {
+		n := r.dataSize()
+		if int64(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		if _, err := p.file.ReadAt(buf[:n], dataPos); err != nil {
+			return err
+		}
+		return tmp.append(&packedRecord{kind: r.kind, offset: r.offset, size: r.size, crc: r.crc}, buf[:n])
+	}); err != nil {
+		return
+	}
+	if err = tmp.file.Sync(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.filePath, p.filePath); err != nil {
+		return
+	}
+	log.LogInfof("action[packedExtent.compact] %v compacted from %v to %v bytes", p.filePath, p.end, tmp.end)
+	p.file.Close()
+	p.file, p.index, p.end, p.liveBytes = tmp.file, tmp.index, tmp.end, tmp.liveBytes
+	return
+}
+
+// The methods below convert the tiny extents between the formats.
+
+func (p *packedExtent) readAt(data []byte, offset int64) (err error) {
+	if err = p.read(data, offset); err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// writeAt writes the data of a run as is, including the zeros written to the plain format, so that the converted
+// extent keeps the same ranges of data, which the verified reads rely on.
+func (p *packedExtent) writeAt(data []byte, offset int64) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	return p.append(&packedRecord{kind: packedRecordData, offset: offset, size: int64(len(data)), crc: crc32.ChecksumIEEE(data)}, data)
+}
+
+func (p *packedExtent) punch(offset, size int64) (err error) {
+	_, err = p.delete(offset, size)
+	return
+}
+
+func (p *packedExtent) fileSize() (size int64, err error) {
+	p.RLock()
+	defer p.RUnlock()
+	return p.size, nil
+}
+
+func (p *packedExtent) extend(size int64) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	if size <= p.size {
+		return
+	}
+	return p.append(&packedRecord{kind: packedRecordExtend, offset: p.size, size: size - p.size}, nil)
+}
+
+// tinyFormat is the format of a tiny extent to convert from or to.
+type tinyFormat interface {
+	dataRun(offset int64) (start, end int64, err error)
+	readAt(data []byte, offset int64) error
+	writeAt(data []byte, offset int64) error
+	punch(offset, size int64) error
+	fileSize() (int64, error)
+	extend(size int64) error
+	sync() error
+}
+
+// plainTiny is the file of a tiny extent in the plain format.
+type plainTiny struct {
+	file *os.File
+}
+
+func (f *plainTiny) dataRun(offset int64) (start, end int64, err error) {
+	if start, err = f.file.Seek(offset, SEEK_DATA); err != nil {
+		return
+	}
+	end, err = f.file.Seek(start, SEEK_HOLE)
+	return
+}
+
+func (f *plainTiny) readAt(data []byte, offset int64) (err error) {
+	var n int
+	if n, err = f.file.ReadAt(data, offset); err == io.EOF {
+		for i := n; i < len(data); i++ {
+			data[i] = 0
+		}
+		err = nil
+	}
+	return
+}
+
+func (f *plainTiny) writeAt(data []byte, offset int64) (err error) {
+	_, err = f.file.WriteAt(data, offset)
+	return
+}
+
+func (f *plainTiny) punch(offset, size int64) error {
+	return fallocate(int(f.file.Fd()), FallocFLPunchHole|FallocFLKeepSize, offset, size)
+}
+
+func (f *plainTiny) fileSize() (size int64, err error) {
+	var info os.FileInfo
+	if info, err = f.file.Stat(); err != nil {
+		return
+	}
+	return info.Size(), nil
+}
+
+func (f *plainTiny) extend(size int64) (err error) {
+	var current int64
+	if current, err = f.fileSize(); err != nil || size <= current {
+		return
+	}
+	return f.file.Truncate(size)
+}
+
+func (f *plainTiny) sync() error {
+	return f.file.Sync()
+}
+
+func isNoDataError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), syscall.ENXIO.Error())
+}
+
+// copyTinyRange copies the data within the range between the formats.
+func copyTinyRange(src, dst tinyFormat, start, end int64, buf []byte) (err error) {
+	for offset := start; offset < end; {
+		var runStart, runEnd int64
+		if runStart, runEnd, err = src.dataRun(offset); err != nil {
+			if isNoDataError(err) {
+				err = nil
+			}
+			return
+		}
+		if runStart >= end || runEnd <= runStart {
+			return
+		}
+		if runEnd > end {
+			runEnd = end
+		}
+		for runStart < runEnd {
+			n := runEnd - runStart
+			if n > int64(len(buf)) {
+				n = int64(len(buf))
+			}
+			if err = src.readAt(buf[:n], runStart); err != nil {
+				return
+			}
+			if err = dst.writeAt(buf[:n], runStart); err != nil {
+				return
+			}
+			runStart += n
+		}
+		offset = runEnd
+	}
+	return
+}
+
+// tinyConversion records the ranges of a tiny extent changed during its conversion, which are copied again before
+// the converted format takes over.
+type tinyConversion struct {
+	sync.Mutex
+	dirty []packedEntry
+}
+
+func (c *tinyConversion) mark(offset, size int64) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	c.dirty = append(c.dirty, packedEntry{offset: offset, size: size})
+	c.Unlock()
+}
+
+// TinyExtentStat defines the format and the space of a tiny extent.
+type TinyExtentStat struct {
+	ExtentID    uint64 `json:"extentId"`
+	Packed      bool   `json:"packed"`
+	Size        int64  `json:"size"`        // size of the extent
+	SegmentSize int64  `json:"segmentSize"` // size of the segment in the packed format
+	LiveSize    int64  `json:"liveSize"`    // data in the segment not deleted or overwritten
+}
+
+// restorePacked opens the segment of the tiny extent if it exists, and empties the file of the plain format left by
+// an interrupted conversion.
+func (e *Extent) restorePacked(plainSize int64) (err error) {
+	name := packedExtentPath(e.filePath)
+	if _, err = os.Stat(name); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if e.packed, err = openPackedExtent(name); err != nil {
+		return fmt.Errorf("open packed extent %v: %v", name, err)
+	}
+	if plainSize > 0 {
+		log.LogWarnf("action[restorePacked] %v exists, empty the plain file of size %v", name, plainSize)
+		err = e.file.Truncate(0)
+	}
+	return
+}
+
+// IsPacked returns whether the tiny extent is in the packed format.
+func (e *Extent) IsPacked() bool {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	return e.packed != nil
+}
+
+func (e *Extent) tinyFileSize() (size int64, err error) {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	return e.tinyFormat().fileSize()
+}
+
+func (e *Extent) tinyFormat() tinyFormat {
+	if e.packed != nil {
+		return e.packed
+	}
+	return &plainTiny{file: e.file}
+}
+
+// checkTinyData checks that the range of the tiny extent is all data, i.e. none of it is punched by the deletions.
+func (e *Extent) checkTinyData(offset, size int64) (err error) {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	format := e.tinyFormat()
+	for end := offset + size; offset < end; {
+		var start, runEnd int64
+		if start, runEnd, err = format.dataRun(offset); err != nil {
+			if isNoDataError(err) {
+				err = ExtentHasBeenDeletedError
+			}
+			return
+		}
+		if start != offset || runEnd <= offset {
+			return ExtentHasBeenDeletedError
+		}
+		offset = runEnd
+	}
+	return
+}
+
+func (e *Extent) tinyStat() (stat *TinyExtentStat, err error) {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	stat = &TinyExtentStat{ExtentID: e.extentID, Packed: e.packed != nil}
+	if e.packed == nil {
+		stat.Size, err = e.tinyFormat().fileSize()
+		return
+	}
+	e.packed.RLock()
+	stat.Size, stat.SegmentSize, stat.LiveSize = e.packed.size, e.packed.end, e.packed.liveBytes
+	e.packed.RUnlock()
+	return
+}
+
+// compactTiny compacts the segment of the tiny extent if the dead space is large enough, and returns whether it is
+// compacted.
+func (e *Extent) compactTiny() (compacted bool, err error) {
+	e.formatLock.RLock()
+	defer e.formatLock.RUnlock()
+	if e.packed == nil || !e.packed.needCompaction() {
+		return
+	}
+	if err = e.packed.compact(); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// convertTiny converts the tiny extent to the packed format or back to the plain one. The data is copied with the
+// operations going on, and the ranges changed meanwhile are copied again with the operations blocked, after which
+// the converted format takes over.
+func (e *Extent) convertTiny(toPacked bool) (err error) {
+	e.formatLock.Lock()
+	if (e.packed != nil) == toPacked {
+		e.formatLock.Unlock()
+		return
+	}
+	conversion := &tinyConversion{}
+	e.conversion = conversion
+	src := e.tinyFormat()
+	e.formatLock.Unlock()
+
+	var (
+		dst     tinyFormat
+		packed  *packedExtent
+		plain   *os.File
+		tmpPath string
+		buf     = make([]byte, packedCopyUnit)
+	)
+	defer func() {
+		if err == nil {
+			return
+		}
+		e.formatLock.Lock()
+		e.conversion = nil
+		e.formatLock.Unlock()
+		if packed != nil {
+			packed.close()
+		}
+		if plain != nil {
+			plain.Close()
+		}
+		os.Remove(tmpPath)
+	}()
+	if toPacked {
+		tmpPath = packedExtentPath(e.filePath) + TempExtentSuffix
+		if packed, err = createPackedExtent(tmpPath); err != nil {
+			return
+		}
+		dst = packed
+	} else {
+		tmpPath = e.filePath + TempExtentSuffix
+		if plain, err = os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666); err != nil {
+			return
+		}
+		dst = &plainTiny{file: plain}
+	}
+	if err = copyTinyRange(src, dst, 0, ExtentMaxSize, buf); err != nil {
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	e.formatLock.Lock()
+	defer e.formatLock.Unlock()
+	for _, r := range conversion.dirty {
+		if err = dst.punch(r.offset, r.size); err != nil {
+			return
+		}
+		if err = copyTinyRange(src, dst, r.offset, r.end(), buf); err != nil {
+			return
+		}
+	}
+	var size int64
+	if size, err = src.fileSize(); err != nil {
+		return
+	}
+	if err = dst.extend(size); err != nil {
+		return
+	}
+	if err = dst.sync(); err != nil {
+		return
+	}
+	if toPacked {
+		if err = os.Rename(tmpPath, packedExtentPath(e.filePath)); err != nil {
+			return
+		}
+		packed.filePath = packedExtentPath(e.filePath)
+		e.packed = packed
+		// the segment has taken over, and the plain file is emptied on load if it fails here
+		if truncErr := e.file.Truncate(0); truncErr != nil {
+			log.LogWarnf("action[convertTiny] empty the plain file %v: %v", e.filePath, truncErr)
+		}
+	} else {
+		if err = os.Rename(tmpPath, e.filePath); err != nil {
+			return
+		}
+		// the segment takes over on load until it is removed
+		if err = os.Remove(e.packed.filePath); err != nil {
+			return
+		}
+		e.file.Close()
+		e.file = plain
+		e.packed.close()
+		e.packed = nil
+	}
+	e.conversion = nil
+	return
+}
+
+// SetPackTinyExtents sets the format the tiny extents are converted to in the background, the packed one if true
+// and the plain one otherwise.
+func (s *ExtentStore) SetPackTinyExtents(packed bool) {
+	var flag int32
+	if packed {
+		flag = 1
+	}
+	atomic.StoreInt32(&s.packTinyExtents, flag)
+}
+
+// PackTinyExtents returns whether the tiny extents are converted to the packed format.
+func (s *ExtentStore) PackTinyExtents() bool {
+	return atomic.LoadInt32(&s.packTinyExtents) == 1
+}
+
+// TinyExtentStats returns the formats and the space of the tiny extents.
+func (s *ExtentStore) TinyExtentStats() (stats []*TinyExtentStat, err error) {
+	stats = make([]*TinyExtentStat, 0, TinyExtentCount)
+	for extentID := uint64(TinyExtentStartID); extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
+		var (
+			e    *Extent
+			stat *TinyExtentStat
+		)
+		if e, err = s.extentWithHeaderByExtentID(extentID); err != nil {
+			return
+		}
+		if stat, err = e.tinyStat(); err != nil {
+			return
+		}
+		stats = append(stats, stat)
+	}
+	return
+}
+
+// maintainTinyExtents converts the available tiny extents to the format set, one at a time as it is taken out of
+// the writes, and compacts the segments of the packed ones. The extents not available are left to the next round.
+func (s *ExtentStore) maintainTinyExtents() {
+	packed := s.PackTinyExtents()
+	for extentID := uint64(TinyExtentStartID); extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
+		e, err := s.extentWithHeaderByExtentID(extentID)
+		if err != nil {
+			continue
+		}
+		if e.IsPacked() != packed {
+			if !s.takeAvailableTinyExtent(extentID) {
+				continue
+			}
+			if err = e.convertTiny(packed); err != nil {
+				log.LogErrorf("action[maintainTinyExtents] convert %v to packed(%v): %v", s.getExtentKey(extentID), packed, err)
+			} else {
+				log.LogInfof("action[maintainTinyExtents] convert %v to packed(%v)", s.getExtentKey(extentID), packed)
+			}
+			s.SendToAvailableTinyExtentC(extentID)
+			continue
+		}
+		if compacted, err := e.compactTiny(); err != nil {
+			log.LogErrorf("action[maintainTinyExtents] compact %v: %v", s.getExtentKey(extentID), err)
+		} else if compacted {
+			log.LogInfof("action[maintainTinyExtents] compact %v", s.getExtentKey(extentID))
+		}
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+// tinyTestData is the content of a tiny extent whose pages at the holes are deleted.
+func tinyTestData(pages int, holes ...int) []byte {
+	data := make([]byte, pages*PageSize)
+	for i := range data {
+		data[i] = byte(i/PageSize + 1)
+	}
+	for _, h := range holes {
+		for i := h * PageSize; i < (h+1)*PageSize; i++ {
+			data[i] = 0
+		}
+	}
+	return data
+}
+
+func newTestTinyExtent(t *testing.T, dir string, pages int, holes ...int) *Extent {
+	e := NewExtentInCore(path.Join(dir, strconv.Itoa(TinyExtentStartID)), TinyExtentStartID)
+	if err := e.InitToFS(); err != nil {
+		t.Fatal(err)
+	}
+	data := tinyTestData(pages)
+	for i := 0; i < pages; i++ {
+		if err := e.WriteTiny(data[i*PageSize:], int64(i*PageSize), PageSize, 0, AppendWriteType, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, h := range holes {
+		if _, err := e.DeleteTiny(int64(h*PageSize), PageSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e
+}
+
+func reopenTinyExtent(t *testing.T, e *Extent) *Extent {
+	e.Close()
+	reopened := NewExtentInCore(e.filePath, e.extentID)
+	if err := reopened.RestoreFromFS(); err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}
+
+// checkTinyExtent checks the content of the extent, and that its data runs skip the holes.
+func checkTinyExtent(t *testing.T, e *Extent, expected []byte, holes ...int) {
+	data := make([]byte, len(expected))
+	if _, err := e.ReadTiny(data, 0, int64(len(data)), false); err != nil {
+		t.Fatalf("read %v: %v", e.filePath, err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("unexpected content of %v, packed(%v)", e.filePath, e.IsPacked())
+	}
+	if size, err := e.tinyFileSize(); err != nil || size != int64(len(expected)) {
+		t.Fatalf("expect size %v of %v, but is %v, err %v", len(expected), e.filePath, size, err)
+	}
+	for _, h := range holes {
+		if err := e.checkTinyData(int64(h*PageSize), PageSize); err != ExtentHasBeenDeletedError {
+			t.Fatalf("page %v of %v should be deleted, err %v", h, e.filePath, err)
+		}
+	}
+}
+
+func TestPackedExtentConversion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_packed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	holes := []int{1, 4, 5}
+	expected := tinyTestData(8, holes...)
+	e := newTestTinyExtent(t, dir, 8, holes...)
+	checkTinyExtent(t, e, expected, holes...)
+
+	if err = e.convertTiny(true); err != nil {
+		t.Fatal(err)
+	}
+	if !e.IsPacked() {
+		t.Fatalf("the extent should be packed")
+	}
+	checkTinyExtent(t, e, expected, holes...)
+	if info, err := os.Stat(e.filePath); err != nil || info.Size() != 0 {
+		t.Fatalf("the plain file should be emptied as the placeholder, err %v", err)
+	}
+	if e.packed.liveBytes != int64((8-len(holes))*PageSize) {
+		t.Fatalf("expect %v live bytes, but is %v", (8-len(holes))*PageSize, e.packed.liveBytes)
+	}
+	e = reopenTinyExtent(t, e)
+	if !e.IsPacked() || e.Size() != int64(len(expected)) {
+		t.Fatalf("the extent should be loaded packed of size %v, but is %v", len(expected), e.Size())
+	}
+	checkTinyExtent(t, e, expected, holes...)
+
+	// the writes to the packed extent survive the conversion back
+	if err = e.WriteTiny(bytes.Repeat([]byte{0xff}, PageSize), 8*PageSize, PageSize, 0, AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected, bytes.Repeat([]byte{0xff}, PageSize)...)
+	if err = e.convertTiny(false); err != nil {
+		t.Fatal(err)
+	}
+	if e.IsPacked() {
+		t.Fatalf("the extent should be plain")
+	}
+	if _, err = os.Stat(packedExtentPath(e.filePath)); !os.IsNotExist(err) {
+		t.Fatalf("the segment should be removed, err %v", err)
+	}
+	checkTinyExtent(t, e, expected, holes...)
+	e = reopenTinyExtent(t, e)
+	defer e.Close()
+	checkTinyExtent(t, e, expected, holes...)
+}
+
+func TestPackedExtentCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_packed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := createPackedExtent(path.Join(dir, "segment"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := tinyTestData(16)
+	if err = p.write(expected, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	// overwrite a range across the pages, and delete the pages in the middle and at the end
+	overwrite := bytes.Repeat([]byte{0xee}, 3*PageSize)
+	if err = p.write(overwrite, 2*PageSize+100, false); err != nil {
+		t.Fatal(err)
+	}
+	copy(expected[2*PageSize+100:], overwrite)
+	for _, h := range []int{8, 9, 15} {
+		if _, err = p.delete(int64(h*PageSize), PageSize); err != nil {
+			t.Fatal(err)
+		}
+		copy(expected[h*PageSize:(h+1)*PageSize], make([]byte, PageSize))
+	}
+	end, live := p.end, p.liveBytes
+	if live != int64(13*PageSize) {
+		t.Fatalf("expect %v live bytes, but is %v", 13*PageSize, live)
+	}
+
+	if err = p.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if p.end >= end || p.liveBytes != live || p.end-p.liveBytes > int64(10*packedRecordHeaderSize) {
+		t.Fatalf("the dead space should be dropped, end %v to %v, live %v to %v", end, p.end, live, p.liveBytes)
+	}
+	check := func(p *packedExtent) {
+		data := make([]byte, len(expected))
+		if err := p.read(data, 0); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("unexpected content after the compaction")
+		}
+		// the size is kept though the last page is deleted
+		if p.size != int64(len(expected)) {
+			t.Fatalf("expect size %v, but is %v", len(expected), p.size)
+		}
+		if err := p.read(make([]byte, 1), p.size); err != io.EOF {
+			t.Fatalf("read beyond the size should be EOF, but is %v", err)
+		}
+		if start, runEnd, err := p.dataRun(8 * PageSize); err != nil || start != 10*PageSize || runEnd != 15*PageSize {
+			t.Fatalf("expect the data run [%v, %v), but is [%v, %v), err %v", 10*PageSize, 15*PageSize, start, runEnd, err)
+		}
+	}
+	check(p)
+	if _, err = os.Stat(p.filePath + TempExtentSuffix); !os.IsNotExist(err) {
+		t.Fatalf("the temporary segment should be renamed, err %v", err)
+	}
+
+	// the compacted segment is loaded the same
+	p.close()
+	if p, err = openPackedExtent(p.filePath); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		p.close()
+	}()
+	check(p)
+
+	// the torn record at the end is dropped on load
+	torn := make([]byte, packedRecordHeaderSize+10)
+	(&packedRecord{kind: packedRecordData, offset: 16 * PageSize, size: PageSize}).marshal(torn)
+	if _, err = p.file.WriteAt(torn, p.end); err != nil {
+		t.Fatal(err)
+	}
+	end = p.end
+	p.close()
+	if p, err = openPackedExtent(p.filePath); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(p.filePath); err != nil || info.Size() != end || p.end != end {
+		t.Fatalf("the torn record should be truncated to %v, err %v", end, err)
+	}
+	check(p)
+}
+
+// TestPackedExtentInterruptedConversion replays the states a crash leaves at each step of the conversions, and
+// checks that the extent is loaded from the format which has taken over.
+func TestPackedExtentInterruptedConversion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_packed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	holes := []int{2, 3}
+	expected := tinyTestData(6, holes...)
+	e := newTestTinyExtent(t, dir, 6, holes...)
+	segmentPath := packedExtentPath(e.filePath)
+	buf := make([]byte, packedCopyUnit)
+
+	// to packed: the temporary segment is copied and synced, but not renamed yet
+	tmp, err := createPackedExtent(segmentPath + TempExtentSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = copyTinyRange(e.tinyFormat(), tmp, 0, ExtentMaxSize, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = tmp.extend(int64(len(expected))); err != nil {
+		t.Fatal(err)
+	}
+	if err = tmp.sync(); err != nil {
+		t.Fatal(err)
+	}
+	tmp.close()
+	e = reopenTinyExtent(t, e)
+	if e.IsPacked() {
+		t.Fatalf("the temporary segment should not take over")
+	}
+	checkTinyExtent(t, e, expected, holes...)
+
+	// to packed: the segment is renamed, but the plain file is not emptied yet
+	if err = os.Rename(segmentPath+TempExtentSuffix, segmentPath); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenTinyExtent(t, e)
+	if !e.IsPacked() {
+		t.Fatalf("the renamed segment should take over")
+	}
+	if info, err := os.Stat(e.filePath); err != nil || info.Size() != 0 {
+		t.Fatalf("the plain file should be emptied on load, err %v", err)
+	}
+	checkTinyExtent(t, e, expected, holes...)
+
+	// to plain: the temporary file is copied and synced, but not renamed yet
+	plainTmp := e.filePath + TempExtentSuffix
+	file, err := os.OpenFile(plainTmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := &plainTiny{file: file}
+	if err = copyTinyRange(e.tinyFormat(), plain, 0, ExtentMaxSize, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = plain.extend(int64(len(expected))); err != nil {
+		t.Fatal(err)
+	}
+	if err = plain.sync(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	e = reopenTinyExtent(t, e)
+	if !e.IsPacked() {
+		t.Fatalf("the segment should still be loaded before the rename")
+	}
+	checkTinyExtent(t, e, expected, holes...)
+
+	// to plain: the plain file is renamed, but the segment is not removed yet, which still takes over
+	if err = os.Rename(plainTmp, e.filePath); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenTinyExtent(t, e)
+	if !e.IsPacked() {
+		t.Fatalf("the segment should take over until it is removed")
+	}
+	checkTinyExtent(t, e, expected, holes...)
+
+	// the conversion is done again after the crashes
+	if err = e.convertTiny(false); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenTinyExtent(t, e)
+	defer e.Close()
+	if e.IsPacked() {
+		t.Fatalf("the extent should be plain")
+	}
+	checkTinyExtent(t, e, expected, holes...)
+}
+
+// TestReadHalfConvertedStore reads a store whose tiny extents are partly converted, one of which crashed with both
+// formats on the disk.
+func TestReadHalfConvertedStore(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_packed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	contents, packed := make(map[uint64][]byte), make(map[uint64]bool)
+	for i := uint64(0); i < 4; i++ {
+		extentID := TinyExtentStartID + i
+		data := bytes.Repeat([]byte{byte(extentID)}, int(i+1)*PageSize)
+		if err = s.Write(extentID, 0, int64(len(data)), data, 0, AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+		contents[extentID] = data
+		if i%2 == 0 {
+			continue
+		}
+		e, err := s.extentWithHeaderByExtentID(extentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = e.convertTiny(true); err != nil {
+			t.Fatal(err)
+		}
+		packed[extentID] = true
+	}
+	read := func(s *ExtentStore) {
+		for extentID, expected := range contents {
+			data := make([]byte, len(expected))
+			if _, err := s.Read(extentID, 0, int64(len(data)), data, false); err != nil {
+				t.Fatalf("read tiny extent(%v): %v", extentID, err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Fatalf("unexpected content of tiny extent(%v)", extentID)
+			}
+		}
+	}
+	read(s)
+	stats, err := s.TinyExtentStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stat := range stats[:4] {
+		if stat.Packed != packed[stat.ExtentID] || stat.Size != int64(len(contents[stat.ExtentID])) {
+			t.Fatalf("unexpected stat %v", stat)
+		}
+	}
+
+	// the plain file of a packed extent is not emptied before the crash
+	packedID := uint64(TinyExtentStartID + 1)
+	s.Close()
+	if err = ioutil.WriteFile(s.extentPath(packedID), bytes.Repeat([]byte{0xaa}, PageSize), 0666); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	read(s)
+	e, err := s.extentWithHeaderByExtentID(packedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.IsPacked() {
+		t.Fatalf("tiny extent(%v) should be loaded packed", packedID)
+	}
+}
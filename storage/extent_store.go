@@ -17,7 +17,6 @@ package storage
 import (
 	"encoding/binary"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strconv"
 	"sync"
@@ -55,6 +54,7 @@ const (
 	RandomWriteType              = 2
 	AppendWriteType              = 1
 	NormalExtentDeleteRetainTime = 3600 * 4
+	tinyExtentUnloadableSuffix   = ".unloadable" // appended to the tiny extent files moved aside as they fail to load
 )
 
 var (
@@ -113,7 +113,12 @@ type ExtentStore struct {
 	cache                             *ExtentCache           // extent cache
 	mutex                             sync.Mutex
 	storeSize                         int      // size of the extent store
-	metadataFp                        *os.File // metadata file pointer?
+	metadataFp                        *os.File // the primary copy of the extent meta
+	metaMirrorFp                      *os.File // the mirror copy of the extent meta
+	meta                              extentMeta
+	metaMutex                         sync.Mutex
+	metaStatus                        int    // the status of the extent meta loaded on startup
+	metaError                         string // the error of the broken copies of the extent meta
 	tinyExtentDeleteFp                *os.File
 	normalExtentDeleteFp              *os.File
 	closeC                            chan bool
@@ -122,11 +127,28 @@ type ExtentStore struct {
 	availableTinyExtentMap            sync.Map
 	brokenTinyExtentC                 chan uint64 // broken tinyExtent channel
 	brokenTinyExtentMap               sync.Map
+	tinyExtentMutex                   sync.Mutex // mutex for moving the tiny extents between the channels
+	takenTinyExtentMap                sync.Map   // extent id -> the unix time when the tiny extent is taken for writing
 	blockSize                         int
 	partitionID                       uint64
 	verifyExtentFp                    *os.File
 	hasAllocSpaceExtentIDOnVerfiyFile uint64
 	hasDeleteNormalExtentsCache       sync.Map
+	mmapCache                         *MmapCache // maps the hot normal extents of the disk, nil if disabled
+	packTinyExtents                   int32      // 1 to convert the tiny extents to the packed format, 0 to the plain one
+	quorumWrite                       int32      // 1 if the replicas may lag behind the others by the quorum write
+	extentLayout                      int32      // the layout of the extent files
+	layoutMutex                       sync.RWMutex
+	flatExtents                       map[uint64]struct{} // the normal extents to be moved into the buckets
+	intentLogFp                       *os.File
+	intentMutex                       sync.Mutex
+	pendingIntents                    int
+	usedSize                          int64 // counted on the writes and the deletions, reconciled at intervals
+	reconciledUsedSize                int64 // computed from the extents on the disk by the last reconciliation
+	reconcileTime                     int64 // the unix time of the last reconciliation
+	extentInodeFp                     *os.File
+	extentInodes                      map[uint64]uint64 // extent id -> the inode which the extent is created for
+	extentInodeMutex                  sync.Mutex
 }
 
 func MkdirAll(name string) (err error) {
@@ -155,14 +177,28 @@ func NewExtentStore(dataDir string, partitionID uint64, storeSize int) (s *Exten
 	if s.verifyExtentFp, err = os.OpenFile(path.Join(s.dataPath, ExtCrcHeaderFileName), os.O_CREATE|os.O_RDWR, 0666); err != nil {
 		return
 	}
-	if s.metadataFp, err = os.OpenFile(path.Join(s.dataPath, ExtBaseExtentIDFileName), os.O_CREATE|os.O_RDWR, 0666); err != nil {
+	if err = s.openExtentMeta(); err != nil {
 		return
 	}
 	if s.normalExtentDeleteFp, err = os.OpenFile(path.Join(s.dataPath, NormalExtDeletedFileName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666); err != nil {
 		return
 	}
 
+	if err = s.loadExtentMeta(); err != nil {
+		err = fmt.Errorf("load extent meta: %v", err)
+		return
+	}
+	s.extentLayout = s.meta.layout
+	if err = s.openIntentLog(); err != nil {
+		return
+	}
+	if err = s.replayIntents(); err != nil {
+		err = fmt.Errorf("replay intents: %v", err)
+		return
+	}
+
 	s.extentInfoMap = make(map[uint64]*ExtentInfo, 0)
+	s.flatExtents = make(map[uint64]struct{})
 	s.cache = NewExtentCache(100)
 	if err = s.initBaseFileID(); err != nil {
 		err = fmt.Errorf("init base field ID: %v", err)
@@ -176,6 +212,11 @@ func NewExtentStore(dataDir string, partitionID uint64, storeSize int) (s *Exten
 	if err != nil {
 		return
 	}
+	if err = s.loadExtentInodes(); err != nil {
+		err = fmt.Errorf("load extent inodes: %v", err)
+		return
+	}
+	s.ReconcileUsedSize()
 	return
 }
 
@@ -228,15 +269,23 @@ func (s *ExtentStore) SnapShot() (files []*proto.File, err error) {
 // Create creates an extent.
 func (s *ExtentStore) Create(extentID uint64) (err error) {
 	var e *Extent
-	name := path.Join(s.dataPath, strconv.Itoa(int(extentID)))
 	if s.HasExtent(extentID) {
 		err = ExtentExistsError
 		return err
 	}
-	e = NewExtentInCore(name, extentID)
+	if !IsTinyExtent(extentID) {
+		if err = s.beginIntent(extentID, IntentCreate); err != nil {
+			return err
+		}
+		defer s.finishIntent(extentID, IntentCreate)
+	}
+	s.layoutMutex.RLock()
+	e = NewExtentInCore(s.extentPath(extentID), extentID)
+	e.mmapCache = s.mmapCache
 	e.header = make([]byte, util.BlockHeaderSize)
 	err = e.InitToFS()
 	if err != nil {
+		s.layoutMutex.RUnlock()
 		return err
 	}
 	s.cache.Put(e)
@@ -245,6 +294,7 @@ func (s *ExtentStore) Create(extentID uint64) (err error) {
 	s.eiMutex.Lock()
 	s.extentInfoMap[extentID] = extInfo
 	s.eiMutex.Unlock()
+	s.layoutMutex.RUnlock()
 
 	s.UpdateBaseExtentID(extentID)
 	return
@@ -255,23 +305,20 @@ func (s *ExtentStore) initBaseFileID() (err error) {
 		baseFileID uint64
 	)
 	baseFileID, _ = s.GetPersistenceBaseExtentID()
-	files, err := ioutil.ReadDir(s.dataPath)
+	extentIDs, err := s.listExtentFiles()
 	if err != nil {
 		return err
 	}
 
 	var (
-		extentID uint64
-		isExtent bool
-		e        *Extent
-		ei       *ExtentInfo
-		loadErr  error
+		e       *Extent
+		ei      *ExtentInfo
+		loadErr error
 	)
-	for _, f := range files {
-		if extentID, isExtent = s.ExtentID(f.Name()); !isExtent {
-			continue
-		}
+	for _, extentID := range extentIDs {
 		if e, loadErr = s.extent(extentID); loadErr != nil {
+			log.LogWarnf("action[initBaseFileID] partition(%v) skips extent(%v) failing to load, err(%v)",
+				s.partitionID, extentID, loadErr)
 			continue
 		}
 		ei = &ExtentInfo{FileID: extentID}
@@ -288,6 +335,14 @@ func (s *ExtentStore) initBaseFileID() (err error) {
 	if baseFileID < MinExtentID {
 		baseFileID = MinExtentID
 	}
+	if s.metaStatus == ExtentMetaRebuilt {
+		// the extents allocated past the ones seen are unknown
+		baseFileID += ExtentIDRebuildGap
+		if err = s.PersistenceBaseExtentID(baseFileID); err != nil {
+			return err
+		}
+		s.metaError = fmt.Sprintf("%v, base extent ID is guessed as %v", s.metaError, baseFileID)
+	}
 	atomic.StoreUint64(&s.baseExtentID, baseFileID)
 	log.LogInfof("datadir(%v) maxBaseId(%v)", s.dataPath, baseFileID)
 	runtime.GC()
@@ -314,7 +369,7 @@ func (s *ExtentStore) Write(extentID uint64, offset, size int64, data []byte, cr
 	if err != nil {
 		return err
 	}
-	ei.UpdateExtentInfo(e, 0)
+	s.updateExtentInfo(ei, e)
 
 	return nil
 }
@@ -341,6 +396,21 @@ func IsTinyExtent(extentID uint64) bool {
 	return extentID >= TinyExtentStartID && extentID < TinyExtentStartID+TinyExtentCount
 }
 
+// SetQuorumWrite sets whether the replicas may lag behind the others by the quorum write, in which case the reads
+// beyond the extent size are rejected with ExtentIsLaggingError and redirected to the other replicas.
+func (s *ExtentStore) SetQuorumWrite(enable bool) {
+	var flag int32
+	if enable {
+		flag = 1
+	}
+	atomic.StoreInt32(&s.quorumWrite, flag)
+}
+
+// IsQuorumWrite returns whether the replicas may lag behind the others by the quorum write.
+func (s *ExtentStore) IsQuorumWrite() bool {
+	return atomic.LoadInt32(&s.quorumWrite) == 1
+}
+
 // Read reads the extent based on the given id.
 func (s *ExtentStore) Read(extentID uint64, offset, size int64, nbuf []byte, isRepairRead bool) (crc uint32, err error) {
 	var e *Extent
@@ -353,11 +423,52 @@ func (s *ExtentStore) Read(extentID uint64, offset, size int64, nbuf []byte, isR
 	if err = s.checkOffsetAndSize(extentID, offset, size); err != nil {
 		return
 	}
-	crc, err = e.Read(nbuf, offset, size, isRepairRead)
+	// the replica has not been caught up with the others
+	if s.IsQuorumWrite() && !IsTinyExtent(extentID) && !isRepairRead && offset+size > e.Size() {
+		err = ExtentIsLaggingError
+		return
+	}
+	// the reads past the size fail on the file rather than remapping the extent
+	if e.mmapCache != nil && !IsTinyExtent(extentID) && e.checkOffsetAndSize(offset, size) == nil && offset+size <= e.Size() {
+		var ok bool
+		if crc, ok = e.mmapCache.Read(e, nbuf, offset, size); ok {
+			if err = injectReadFault(e.filePath); err != nil {
+				return
+			}
+			crc = injectCrcFault(e.filePath, crc)
+			err = s.verifyReadBlock(e, offset, size, crc, isRepairRead)
+			return
+		}
+	}
+	if crc, err = e.Read(nbuf, offset, size, isRepairRead); err != nil {
+		return
+	}
+	err = s.verifyReadBlock(e, offset, size, crc, isRepairRead)
 
 	return
 }
 
+// CheckTinyExtentData checks that the range of the tiny extent still holds the data written, i.e. it is not deleted
+// since the range is read by the extent keys of a file. It returns ExtentHasBeenDeletedError otherwise.
+func (s *ExtentStore) CheckTinyExtentData(extentID uint64, offset, size int64) (err error) {
+	var e *Extent
+	if !IsTinyExtent(extentID) {
+		return fmt.Errorf("extent(%v) is not a tiny extent", extentID)
+	}
+	s.eiMutex.RLock()
+	ei := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	if e, err = s.extentWithHeader(ei); err != nil {
+		return
+	}
+	return e.checkTinyData(offset, size)
+}
+
+// SetMmapCache sets the cache to map the hot normal extents opened afterwards, nil to read them by pread.
+func (s *ExtentStore) SetMmapCache(cache *MmapCache) {
+	s.mmapCache = cache
+}
+
 func (s *ExtentStore) tinyDelete(extentID uint64, offset, size int64) (err error) {
 	e, err := s.extentWithHeaderByExtentID(extentID)
 	if err != nil {
@@ -375,6 +486,12 @@ func (s *ExtentStore) tinyDelete(extentID uint64, offset, size int64) (err error
 	if hasDelete {
 		return
 	}
+	// the hole is punched in pages
+	punched := size
+	if punched%PageSize != 0 {
+		punched += PageSize - punched%PageSize
+	}
+	atomic.AddInt64(&s.usedSize, -punched)
 	if err = s.RecordTinyDelete(e.extentID, offset, size); err != nil {
 		return
 	}
@@ -397,11 +514,19 @@ func (s *ExtentStore) MarkDelete(extentID uint64, offset, size int64) (err error
 	if ei == nil || ei.IsDeleted {
 		return
 	}
-	extentFilePath := path.Join(s.dataPath, strconv.FormatUint(extentID, 10))
-	if err = os.Remove(extentFilePath); err != nil {
+	if err = s.beginIntent(extentID, IntentMarkDelete); err != nil {
 		return
 	}
+	defer s.finishIntent(extentID, IntentMarkDelete)
+	s.layoutMutex.Lock()
+	if err = os.Remove(s.extentPath(extentID)); err != nil {
+		s.layoutMutex.Unlock()
+		return
+	}
+	delete(s.flatExtents, extentID)
+	s.layoutMutex.Unlock()
 	s.PersistenceHasDeleteExtent(extentID)
+	atomic.AddInt64(&s.usedSize, -int64(ei.Size))
 	ei.IsDeleted = true
 	ei.ModifyTime = time.Now().Unix()
 	s.cache.Del(extentID)
@@ -409,8 +534,9 @@ func (s *ExtentStore) MarkDelete(extentID uint64, offset, size int64) (err error
 	s.PutNormalExtentToDeleteCache(extentID)
 
 	s.eiMutex.Lock()
-	delete(s.extentInfoMap,extentID)
+	delete(s.extentInfoMap, extentID)
 	s.eiMutex.Unlock()
+	s.unbindExtentInode(extentID)
 
 	return
 }
@@ -425,6 +551,11 @@ func (s *ExtentStore) IsDeletedNormalExtent(extentID uint64) (ok bool) {
 }
 
 // Close closes the extent store.
+// ReleaseCache closes the normal extents in the cache to release the file descriptors.
+func (s *ExtentStore) ReleaseCache() {
+	s.cache.Release()
+}
+
 func (s *ExtentStore) Close() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -441,6 +572,13 @@ func (s *ExtentStore) Close() {
 	s.normalExtentDeleteFp.Close()
 	s.verifyExtentFp.Sync()
 	s.verifyExtentFp.Close()
+	s.intentLogFp.Close()
+	s.metadataFp.Sync()
+	s.metadataFp.Close()
+	s.metaMirrorFp.Sync()
+	s.metaMirrorFp.Close()
+	s.extentInodeFp.Sync()
+	s.extentInodeFp.Close()
 	s.closed = true
 }
 
@@ -490,12 +628,14 @@ func (s *ExtentStore) GetStoreUsedSize() (used int64) {
 			continue
 		}
 		if IsTinyExtent(einfo.FileID) {
-			stat := new(syscall.Stat_t)
-			err := syscall.Stat(fmt.Sprintf("%v/%v", s.dataPath, einfo.FileID), stat)
-			if err != nil {
-				continue
+			name := fmt.Sprintf("%v/%v", s.dataPath, einfo.FileID)
+			for _, filePath := range []string{name, packedExtentPath(name)} {
+				stat := new(syscall.Stat_t)
+				if err := syscall.Stat(filePath, stat); err != nil {
+					continue
+				}
+				used += (stat.Blocks * DiskSectorSize)
 			}
-			used += (stat.Blocks * DiskSectorSize)
 		} else {
 			used += int64(einfo.Size)
 		}
@@ -503,6 +643,38 @@ func (s *ExtentStore) GetStoreUsedSize() (used int64) {
 	return
 }
 
+// updateExtentInfo updates the extent info after the extent is written, and counts the growth of the extent in the
+// used size.
+func (s *ExtentStore) updateExtentInfo(ei *ExtentInfo, e *Extent) {
+	before := ei.Size
+	ei.UpdateExtentInfo(e, 0)
+	atomic.AddInt64(&s.usedSize, int64(ei.Size)-int64(before))
+}
+
+// UsedSize returns the used size counted on the writes and the deletions, which is cheap to call but may drift from
+// the space used on the disk until the next reconciliation.
+func (s *ExtentStore) UsedSize() int64 {
+	if used := atomic.LoadInt64(&s.usedSize); used > 0 {
+		return used
+	}
+	return 0
+}
+
+// ReconcileUsedSize computes the used size from the extents on the disk, which replaces the counted one, and returns
+// both of them before the replacement.
+func (s *ExtentStore) ReconcileUsedSize() (counted, reconciled int64) {
+	reconciled = s.GetStoreUsedSize()
+	counted = atomic.SwapInt64(&s.usedSize, reconciled)
+	atomic.StoreInt64(&s.reconciledUsedSize, reconciled)
+	atomic.StoreInt64(&s.reconcileTime, time.Now().Unix())
+	return
+}
+
+// ReconciledUsedSize returns the used size computed by the last reconciliation and the time of it.
+func (s *ExtentStore) ReconciledUsedSize() (used, reconcileTime int64) {
+	return atomic.LoadInt64(&s.reconciledUsedSize), atomic.LoadInt64(&s.reconcileTime)
+}
+
 // GetAllWatermarks returns all the watermarks.
 func (s *ExtentStore) GetAllWatermarks(filter ExtentFilter) (extents []*ExtentInfo, tinyDeleteFileSize int64, err error) {
 	extents = make([]*ExtentInfo, 0)
@@ -559,30 +731,92 @@ func (s *ExtentStore) ExtentID(filename string) (extentID uint64, isExtent bool)
 	return
 }
 
+// initTinyExtent recreates the tiny extents which are missing on the disk, e.g. removed by a disk repair or by hand,
+// or whose files fail to load, and sends all the tiny extents to the broken channel, from which they are sent to the
+// available channel once repaired from the other replicas. Otherwise the writes routed to a tiny extent without its
+// file would fail forever.
 func (s *ExtentStore) initTinyExtent() (err error) {
 	s.availableTinyExtentC = make(chan uint64, TinyExtentCount)
 	s.brokenTinyExtentC = make(chan uint64, TinyExtentCount)
-	var extentID uint64
+	var (
+		extentID   uint64
+		missing    []uint64
+		unloadable []uint64
+	)
 
 	for extentID = TinyExtentStartID; extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
-		err = s.Create(extentID)
-		if err == nil || strings.Contains(err.Error(), syscall.EEXIST.Error()) || err == ExtentExistsError {
-			err = nil
-			s.brokenTinyExtentC <- extentID
-			s.brokenTinyExtentMap.Store(extentID, true)
-			continue
+		if !s.HasExtent(extentID) {
+			var exists bool
+			if exists, err = s.moveAsideTinyExtentFile(extentID); err != nil {
+				return
+			}
+			if err = s.Create(extentID); err != nil {
+				return fmt.Errorf("recreate tiny extent(%v): %v", extentID, err)
+			}
+			if exists {
+				unloadable = append(unloadable, extentID)
+			} else {
+				missing = append(missing, extentID)
+			}
 		}
-		return err
+		s.brokenTinyExtentC <- extentID
+		s.brokenTinyExtentMap.Store(extentID, true)
+	}
+	available, broken := s.verifyTinyExtentChannels()
+	if len(missing) > 0 || len(unloadable) > 0 {
+		log.LogWarnf("action[initTinyExtent] partition(%v) tiny extents reconciled, recreated missing%v unloadable%v, "+
+			"available(%v) broken(%v)", s.partitionID, missing, unloadable, available, broken)
+	} else {
+		log.LogInfof("action[initTinyExtent] partition(%v) tiny extents loaded, available(%v) broken(%v)",
+			s.partitionID, available, broken)
 	}
-
 	return
 }
 
+// moveAsideTinyExtentFile moves the file of the tiny extent, which is not loaded, aside to be recreated, and returns
+// false if there is no such file.
+func (s *ExtentStore) moveAsideTinyExtentFile(extentID uint64) (exists bool, err error) {
+	name := s.extentPath(extentID)
+	if _, err = os.Lstat(name); os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Rename(name, name+tinyExtentUnloadableSuffix); err != nil {
+		return
+	}
+	log.LogWarnf("action[moveAsideTinyExtentFile] partition(%v) tiny extent(%v) fails to load, moved aside to %v",
+		s.partitionID, extentID, name+tinyExtentUnloadableSuffix)
+	return true, nil
+}
+
+// verifyTinyExtentChannels checks that each tiny extent is in the available or the broken channel, or taken for
+// writing, sends the lost ones to the broken channel, and returns the number of the extents in each channel.
+func (s *ExtentStore) verifyTinyExtentChannels() (available, broken int) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
+	for extentID := uint64(TinyExtentStartID); extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
+		_, isAvailable := s.availableTinyExtentMap.Load(extentID)
+		_, isBroken := s.brokenTinyExtentMap.Load(extentID)
+		_, isTaken := s.takenTinyExtentMap.Load(extentID)
+		if !isAvailable && !isBroken && !isTaken {
+			log.LogWarnf("action[verifyTinyExtentChannels] partition(%v) tiny extent(%v) is lost from the channels",
+				s.partitionID, extentID)
+			s.sendToBrokenTinyExtentC(extentID)
+		}
+	}
+	return len(s.availableTinyExtentC), len(s.brokenTinyExtentC)
+}
+
 // GetAvailableTinyExtent returns the available tiny extent from the channel.
 func (s *ExtentStore) GetAvailableTinyExtent() (extentID uint64, err error) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
 	select {
 	case extentID = <-s.availableTinyExtentC:
 		s.availableTinyExtentMap.Delete(extentID)
+		s.takenTinyExtentMap.Store(extentID, time.Now().Unix())
 		return
 	default:
 		return 0, NoAvailableExtentError
@@ -590,8 +824,35 @@ func (s *ExtentStore) GetAvailableTinyExtent() (extentID uint64, err error) {
 	}
 }
 
+// takeAvailableTinyExtent takes the given extent out of the channel that stores the available tiny extents, and
+// returns false if it is not available, e.g., taken for writing or broken.
+func (s *ExtentStore) takeAvailableTinyExtent(extentID uint64) (taken bool) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
+	if _, ok := s.availableTinyExtentMap.Load(extentID); !ok {
+		return false
+	}
+	for i := len(s.availableTinyExtentC); i > 0; i-- {
+		id := <-s.availableTinyExtentC
+		if id == extentID {
+			taken = true
+			continue
+		}
+		s.availableTinyExtentC <- id
+	}
+	s.availableTinyExtentMap.Delete(extentID)
+	return
+}
+
 // SendToAvailableTinyExtentC sends the extent to the channel that stores the available tiny extents.
+// The extent which has been reclaimed to the broken channel is left to the repair to send it back.
 func (s *ExtentStore) SendToAvailableTinyExtentC(extentID uint64) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
+	s.takenTinyExtentMap.Delete(extentID)
+	if _, ok := s.brokenTinyExtentMap.Load(extentID); ok {
+		return
+	}
 	if _, ok := s.availableTinyExtentMap.Load(extentID); !ok {
 		s.availableTinyExtentC <- extentID
 		s.availableTinyExtentMap.Store(extentID, true)
@@ -600,12 +861,10 @@ func (s *ExtentStore) SendToAvailableTinyExtentC(extentID uint64) {
 
 // SendAllToBrokenTinyExtentC sends all the extents to the channel that stores the broken extents.
 func (s *ExtentStore) SendAllToBrokenTinyExtentC(extentIds []uint64) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
 	for _, extentID := range extentIds {
-		if _, ok := s.brokenTinyExtentMap.Load(extentID); !ok {
-			s.brokenTinyExtentC <- extentID
-			s.brokenTinyExtentMap.Store(extentID, true)
-		}
-
+		s.sendToBrokenTinyExtentC(extentID)
 	}
 }
 
@@ -632,11 +891,36 @@ func (s *ExtentStore) MoveAllToBrokenTinyExtentC(cnt int) {
 
 // SendToBrokenTinyExtentC sends the given extent id to the channel.
 func (s *ExtentStore) SendToBrokenTinyExtentC(extentID uint64) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
+	s.sendToBrokenTinyExtentC(extentID)
+}
+
+func (s *ExtentStore) sendToBrokenTinyExtentC(extentID uint64) {
+	s.takenTinyExtentMap.Delete(extentID)
 	if _, ok := s.brokenTinyExtentMap.Load(extentID); !ok {
 		s.brokenTinyExtentC <- extentID
 		s.brokenTinyExtentMap.Store(extentID, true)
 	}
+}
 
+// ReclaimTinyExtents moves the tiny extents which have been taken for writing longer than the timeout to the
+// channel that stores the broken extents, from which the repair sends them back to the available ones. The extents
+// are leaked if the writes taking them are never released, e.g., the connections are closed halfway.
+func (s *ExtentStore) ReclaimTinyExtents(timeout time.Duration) (extentIDs []uint64) {
+	s.tinyExtentMutex.Lock()
+	defer s.tinyExtentMutex.Unlock()
+	deadline := time.Now().Add(-timeout).Unix()
+	s.takenTinyExtentMap.Range(func(key, value interface{}) bool {
+		if value.(int64) < deadline {
+			extentIDs = append(extentIDs, key.(uint64))
+		}
+		return true
+	})
+	for _, extentID := range extentIDs {
+		s.sendToBrokenTinyExtentC(extentID)
+	}
+	return
 }
 
 // GetBrokenTinyExtent returns the first broken extent in the channel.
@@ -814,8 +1098,12 @@ func (s *ExtentStore) GetExtentCount() (count int) {
 }
 
 func (s *ExtentStore) loadExtentFromDisk(extentID uint64, putCache bool) (e *Extent, err error) {
-	name := path.Join(s.dataPath, strconv.Itoa(int(extentID)))
+	// the extent is not moved into the bucket until it is opened and cached
+	s.layoutMutex.RLock()
+	defer s.layoutMutex.RUnlock()
+	name := s.extentPath(extentID)
 	e = NewExtentInCore(name, extentID)
+	e.mmapCache = s.mmapCache
 	if err = e.RestoreFromFS(); err != nil {
 		err = fmt.Errorf("restore from file %v putCache %v system: %v", name, putCache, err)
 		return
@@ -826,7 +1114,10 @@ func (s *ExtentStore) loadExtentFromDisk(extentID uint64, putCache bool) (e *Ext
 	if !IsTinyExtent(extentID) {
 		e.header = make([]byte, util.BlockHeaderSize)
 		if _, err = s.verifyExtentFp.ReadAt(e.header, int64(extentID*util.BlockHeaderSize)); err != nil && err != io.EOF {
-			return
+			// the data is still readable without the header, which can be rebuilt from the data
+			log.LogErrorf("action[loadExtentFromDisk] partition(%v) extent(%v) read header err(%v), the header needs rebuilding",
+				s.partitionID, extentID, err)
+			e.header = make([]byte, util.BlockHeaderSize)
 		}
 	}
 	err = nil
@@ -865,6 +1156,8 @@ func (arr ExtentInfoArr) Swap(i, j int)      { arr[i], arr[j] = arr[j], arr[i] }
 func (s *ExtentStore) BackendTask() {
 	s.autoComputeExtentCrc()
 	s.cleanExpiredNormalExtentDeleteCache()
+	s.maintainTinyExtents()
+	s.migrateExtentLayout()
 }
 
 func (s *ExtentStore) cleanExpiredNormalExtentDeleteCache() {
@@ -947,7 +1240,7 @@ func (s *ExtentStore) TinyExtentRecover(extentID uint64, offset, size int64, dat
 	if err = e.TinyExtentRecover(data, offset, size, crc, isEmptyPacket); err != nil {
 		return err
 	}
-	ei.UpdateExtentInfo(e, 0)
+	s.updateExtentInfo(ei, e)
 
 	return nil
 }
@@ -966,11 +1259,11 @@ func (s *ExtentStore) TinyExtentGetFinfoSize(extentID uint64) (size uint64, err
 		return
 	}
 
-	finfo, err := e.file.Stat()
+	fileSize, err := e.tinyFileSize()
 	if err != nil {
 		return 0, err
 	}
-	size = uint64(finfo.Size())
+	size = uint64(fileSize)
 
 	return
 }
@@ -0,0 +1,142 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestRecreateTinyExtentsAtLoad(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	s.Close()
+
+	missing, unloadable := uint64(TinyExtentStartID+2), uint64(TinyExtentStartID+4)
+	if err = os.Remove(path.Join(dataDir, strconv.FormatUint(missing, 10))); err != nil {
+		t.Fatal(err)
+	}
+	// a directory in place of the file can not be opened for writing
+	name := path.Join(dataDir, strconv.FormatUint(unloadable, 10))
+	if err = os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(name, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	for _, extentID := range []uint64{missing, unloadable} {
+		if !s.HasExtent(extentID) {
+			t.Fatalf("tiny extent(%v) is not recreated", extentID)
+		}
+		if _, ok := s.brokenTinyExtentMap.Load(extentID); !ok {
+			t.Fatalf("tiny extent(%v) recreated should be repaired before written", extentID)
+		}
+		if err = s.Write(extentID, 0, 4, []byte("tiny"), 0, AppendWriteType, false); err != nil {
+			t.Fatalf("write tiny extent(%v) recreated: %v", extentID, err)
+		}
+	}
+	if info, err := os.Stat(name + tinyExtentUnloadableSuffix); err != nil || !info.IsDir() {
+		t.Fatalf("unloadable tiny extent file is not moved aside, err(%v)", err)
+	}
+	if available, broken := s.verifyTinyExtentChannels(); available != 0 || broken != TinyExtentCount {
+		t.Fatalf("expect all the tiny extents broken at load, available(%v) broken(%v)", available, broken)
+	}
+}
+
+func TestCountUsedSize(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	defer s.Close()
+
+	base := s.UsedSize()
+	data := make([]byte, 2*PageSize)
+	extentID, _ := s.NextExtentID()
+	if err = s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(extentID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	tinyID := uint64(TinyExtentStartID)
+	if err = s.Write(tinyID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	if used := s.UsedSize(); used != base+int64(2*len(data)) {
+		t.Fatalf("expect used size %v after the writes, but is %v", base+int64(2*len(data)), used)
+	}
+
+	if err = s.MarkDelete(extentID, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.MarkDelete(tinyID, 0, PageSize); err != nil {
+		t.Fatal(err)
+	}
+	if used := s.UsedSize(); used != base+PageSize {
+		t.Fatalf("expect used size %v after the deletions, but is %v", base+PageSize, used)
+	}
+
+	counted, reconciled := s.ReconcileUsedSize()
+	if counted != base+PageSize {
+		t.Fatalf("expect counted used size %v, but is %v", base+PageSize, counted)
+	}
+	if used, reconcileTime := s.ReconciledUsedSize(); used != reconciled || reconcileTime == 0 || s.UsedSize() != reconciled {
+		t.Fatalf("the used size(%v) is not replaced by the reconciled one(%v)", s.UsedSize(), reconciled)
+	}
+}
+
+func TestReadLaggingExtent(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	defer s.Close()
+
+	data := make([]byte, PageSize)
+	extentID, _ := s.NextExtentID()
+	if err = s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(extentID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2*PageSize)
+	if _, err = s.Read(extentID, 0, int64(len(buf)), buf, false); err == ExtentIsLaggingError {
+		t.Fatalf("the read beyond the extent size should not be lagging without quorum write")
+	}
+	s.SetQuorumWrite(true)
+	if _, err = s.Read(extentID, 0, int64(len(buf)), buf, false); err != ExtentIsLaggingError {
+		t.Fatalf("the read beyond the extent size should be lagging with quorum write, err(%v)", err)
+	}
+	if _, err = s.Read(extentID, 0, int64(len(data)), buf[:len(data)], false); err != nil {
+		t.Fatalf("the read within the extent size should pass, err(%v)", err)
+	}
+}
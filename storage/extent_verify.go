@@ -0,0 +1,269 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The kinds of corruption found by the verification of the extent header.
+const (
+	CorruptionNone   = "none"
+	CorruptionHeader = "header"
+	CorruptionData   = "data"
+)
+
+const (
+	// A damaged sector of the header spoils many block Crcs at once, while the data is more likely to be
+	// damaged in a few blocks.
+	headerCorruptionMinMismatches = 2
+)
+
+// BlockCrcMismatch records a block whose Crc in the header differs from the Crc computed from its data.
+type BlockCrcMismatch struct {
+	BlockNo   int    `json:"blockNo"`
+	HeaderCrc uint32 `json:"headerCrc"`
+	DataCrc   uint32 `json:"dataCrc"`
+}
+
+// ExtentVerifyResult is the result of verifying the block Crcs in the header of an extent against its data.
+type ExtentVerifyResult struct {
+	ExtentID       uint64              `json:"extentID"`
+	Size           int64               `json:"size"`
+	VerifiedBlocks int                 `json:"verifiedBlocks"`
+	GarbageEntries int                 `json:"garbageEntries"`
+	Mismatches     []*BlockCrcMismatch `json:"mismatches"`
+	HeaderErr      string              `json:"headerErr,omitempty"`
+	Corruption     string              `json:"corruption"`
+	Rebuilt        bool                `json:"rebuilt"`
+}
+
+// classify tells whether the mismatches come from a damaged header or from damaged data. Crcs behind the end of
+// the data can only be garbage in the header.
+func (r *ExtentVerifyResult) classify() string {
+	switch {
+	case r.HeaderErr != "" || r.GarbageEntries > 0:
+		return CorruptionHeader
+	case len(r.Mismatches) == 0:
+		return CorruptionNone
+	case len(r.Mismatches) >= headerCorruptionMinMismatches && len(r.Mismatches)*2 >= r.VerifiedBlocks:
+		return CorruptionHeader
+	default:
+		return CorruptionData
+	}
+}
+
+func extentBlockCount(size int64) (blockCnt int) {
+	blockCnt = int(size / util.BlockSize)
+	if size%util.BlockSize != 0 {
+		blockCnt += 1
+	}
+	return
+}
+
+func headerBlockCrc(header []byte, blockNo int) uint32 {
+	return binary.BigEndian.Uint32(header[blockNo*util.PerBlockCrcSize : (blockNo+1)*util.PerBlockCrcSize])
+}
+
+// blockCrc computes the Crc of a block from the data in the extent file.
+func (e *Extent) blockCrc(blockNo int) (crc uint32, err error) {
+	data := make([]byte, util.BlockSize)
+	readN, err := e.file.ReadAt(data, int64(blockNo*util.BlockSize))
+	if err != nil && err != io.EOF {
+		return
+	}
+	return crc32.ChecksumIEEE(data[:readN]), nil
+}
+
+// readExtentHeader reads the header of the extent from the verify file rather than the cache.
+func (s *ExtentStore) readExtentHeader(extentID uint64) (header []byte, err error) {
+	header = make([]byte, util.BlockHeaderSize)
+	if _, err = s.verifyExtentFp.ReadAt(header, int64(extentID*util.BlockHeaderSize)); err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func (s *ExtentStore) normalExtent(extentID uint64) (e *Extent, ei *ExtentInfo, err error) {
+	if IsTinyExtent(extentID) {
+		err = NewParameterMismatchErr(fmt.Sprintf("tiny extent %v has no header", extentID))
+		return
+	}
+	s.eiMutex.RLock()
+	ei = s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	e, err = s.extentWithHeader(ei)
+	return
+}
+
+// VerifyExtentHeader checks the block Crcs in the header of a normal extent against its data, and tells
+// the header corruption from the data corruption. Blocks whose Crc has not been computed yet are skipped.
+func (s *ExtentStore) VerifyExtentHeader(extentID uint64) (r *ExtentVerifyResult, err error) {
+	var e *Extent
+	if e, _, err = s.normalExtent(extentID); err != nil {
+		return
+	}
+	return s.verifyExtentHeader(e)
+}
+
+func (s *ExtentStore) verifyExtentHeader(e *Extent) (r *ExtentVerifyResult, err error) {
+	r = &ExtentVerifyResult{ExtentID: e.extentID, Size: e.Size(), Mismatches: make([]*BlockCrcMismatch, 0)}
+	header, err := s.readExtentHeader(e.extentID)
+	if err != nil {
+		r.HeaderErr = err.Error()
+		r.Corruption = r.classify()
+		return r, nil
+	}
+	blockCnt := extentBlockCount(r.Size)
+	for blockNo := blockCnt; blockNo < util.BlockCount; blockNo++ {
+		if headerBlockCrc(header, blockNo) != 0 {
+			r.GarbageEntries++
+		}
+	}
+	for blockNo := 0; blockNo < blockCnt; blockNo++ {
+		headerCrc := headerBlockCrc(header, blockNo)
+		if headerCrc == 0 {
+			continue
+		}
+		r.VerifiedBlocks++
+		var dataCrc uint32
+		if dataCrc, err = e.blockCrc(blockNo); err != nil {
+			return
+		}
+		if dataCrc == headerCrc {
+			continue
+		}
+		// check again in case the block is being overwritten
+		if header, err = s.readExtentHeader(e.extentID); err != nil {
+			return
+		}
+		if dataCrc, err = e.blockCrc(blockNo); err != nil {
+			return
+		}
+		if headerCrc = headerBlockCrc(header, blockNo); headerCrc != 0 && dataCrc != headerCrc {
+			r.Mismatches = append(r.Mismatches, &BlockCrcMismatch{BlockNo: blockNo, HeaderCrc: headerCrc, DataCrc: dataCrc})
+		}
+	}
+	r.Corruption = r.classify()
+	return
+}
+
+// verifyReadBlock checks the data read from a normal extent against the Crc of its block in the header, if the
+// read covers the whole block, or the tail block up to the end of the extent. The repair reads are not checked,
+// since the replicas are compared by their extent Crcs after the repair.
+func (s *ExtentStore) verifyReadBlock(e *Extent, offset, size int64, crc uint32, isRepairRead bool) (err error) {
+	if isRepairRead || IsTinyExtent(e.extentID) || offset%util.BlockSize != 0 {
+		return
+	}
+	if size != util.BlockSize && offset+size != e.Size() {
+		return
+	}
+	blockNo := int(offset / util.BlockSize)
+	headerCrc := headerBlockCrc(e.header, blockNo)
+	if headerCrc == 0 || headerCrc == crc {
+		return
+	}
+	// check again in case the block is being overwritten
+	header, err := s.readExtentHeader(e.extentID)
+	if err != nil {
+		return
+	}
+	dataCrc, err := e.blockCrc(blockNo)
+	if err != nil {
+		return
+	}
+	if headerCrc = headerBlockCrc(header, blockNo); headerCrc == 0 || dataCrc == headerCrc {
+		return
+	}
+	log.LogErrorf("action[verifyReadBlock] extent(%v) block(%v) headerCrc(%v) dataCrc(%v) readCrc(%v) mismatch",
+		e.extentID, blockNo, headerCrc, dataCrc, crc)
+	return fmt.Errorf("%v: extent(%v) block(%v) headerCrc(%v) dataCrc(%v)", BlockCrcMismatchError,
+		e.extentID, blockNo, headerCrc, dataCrc)
+}
+
+// RebuildExtentHeader recomputes all the block Crcs of a normal extent from its data and rewrites the header.
+// The header is rebuilt only if it is found corrupted, unless force is set, since rebuilding it upon the data
+// corruption would hide the damaged data from the Crc check between the replicas.
+func (s *ExtentStore) RebuildExtentHeader(extentID uint64, force bool) (r *ExtentVerifyResult, err error) {
+	var (
+		e  *Extent
+		ei *ExtentInfo
+	)
+	if e, ei, err = s.normalExtent(extentID); err != nil {
+		return
+	}
+	if time.Now().Unix()-e.ModifyTime() <= UpdateCrcInterval {
+		err = fmt.Errorf("extent %v has been modified in the last %v seconds: %v", extentID, UpdateCrcInterval, TryAgainError)
+		return
+	}
+	if r, err = s.verifyExtentHeader(e); err != nil {
+		return
+	}
+	if r.Corruption == CorruptionNone && !force {
+		return
+	}
+	if r.Corruption == CorruptionData && !force {
+		err = fmt.Errorf("extent %v has %v corrupted data blocks, refuse to rebuild the header", extentID, len(r.Mismatches))
+		return
+	}
+	blockCnt := extentBlockCount(r.Size)
+	header := make([]byte, util.BlockHeaderSize)
+	for blockNo := 0; blockNo < blockCnt; blockNo++ {
+		var blockCrc uint32
+		if blockCrc, err = e.blockCrc(blockNo); err != nil {
+			return
+		}
+		binary.BigEndian.PutUint32(header[blockNo*util.PerBlockCrcSize:(blockNo+1)*util.PerBlockCrcSize], blockCrc)
+	}
+	// The header occupies an aligned page of the verify file, so it is replaced by a single write.
+	if _, err = s.verifyExtentFp.WriteAt(header, int64(extentID*util.BlockHeaderSize)); err != nil {
+		return
+	}
+	if err = s.verifyExtentFp.Sync(); err != nil {
+		return
+	}
+	copy(e.header, header)
+	ei.UpdateExtentInfo(e, crc32.ChecksumIEEE(header[:blockCnt*util.PerBlockCrcSize]))
+	r.Rebuilt = true
+	log.LogWarnf("action[RebuildExtentHeader] partition(%v) extent(%v) corruption(%v) mismatches(%v) garbage(%v) header rebuilt",
+		s.partitionID, extentID, r.Corruption, len(r.Mismatches), r.GarbageEntries)
+	return
+}
+
+// VerifyAllExtentHeaders verifies the headers of all the normal extents, and returns the corrupted ones.
+func (s *ExtentStore) VerifyAllExtentHeaders() (results []*ExtentVerifyResult, err error) {
+	results = make([]*ExtentVerifyResult, 0)
+	extents, _, err := s.GetAllWatermarks(NormalExtentFilter())
+	if err != nil {
+		return
+	}
+	for _, ei := range extents {
+		var r *ExtentVerifyResult
+		if r, err = s.VerifyExtentHeader(ei.FileID); err != nil {
+			return
+		}
+		if r.Corruption != CorruptionNone {
+			results = append(results, r)
+		}
+	}
+	return
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// createVerifyTestExtent creates an extent of 3 full blocks and a partial one, and returns the Crcs of its blocks.
+func createVerifyTestExtent(t *testing.T, s *ExtentStore) (extentID uint64, crcs []uint32) {
+	extentID, _ = s.NextExtentID()
+	if err := s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	for blockNo := 0; blockNo < 4; blockNo++ {
+		data := make([]byte, util.BlockSize)
+		if blockNo == 3 {
+			data = data[:PageSize]
+		}
+		for i := range data {
+			data[i] = byte(blockNo*7 + i)
+		}
+		crc := crc32.ChecksumIEEE(data)
+		if err := s.Write(extentID, int64(blockNo*util.BlockSize), int64(len(data)), data, crc, AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+		crcs = append(crcs, crc)
+	}
+	// the extent is not being written, so its header can be rebuilt
+	e, _, err := s.normalExtent(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&e.modifyTime, time.Now().Unix()-UpdateCrcInterval-1)
+	return
+}
+
+func checkRebuiltHeader(t *testing.T, s *ExtentStore, extentID uint64, crcs []uint32) {
+	header, err := s.readExtentHeader(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, err := s.normalExtent(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for blockNo := 0; blockNo < util.BlockCount; blockNo++ {
+		var expected uint32
+		if blockNo < len(crcs) {
+			expected = crcs[blockNo]
+		}
+		if crc := headerBlockCrc(header, blockNo); crc != expected {
+			t.Fatalf("expect Crc %v of block %v, but is %v", expected, blockNo, crc)
+		}
+		if crc := headerBlockCrc(e.header, blockNo); crc != expected {
+			t.Fatalf("expect cached Crc %v of block %v, but is %v", expected, blockNo, crc)
+		}
+	}
+	if r, err := s.VerifyExtentHeader(extentID); err != nil || r.Corruption != CorruptionNone || r.VerifiedBlocks != len(crcs) {
+		t.Fatalf("the rebuilt header should be verified, result %v err %v", r, err)
+	}
+}
+
+func TestRebuildCorruptedExtentHeader(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	defer s.Close()
+	extentID, crcs := createVerifyTestExtent(t, s)
+	// the Crc of the partial block is not computed until the backend task
+	if r, err := s.VerifyExtentHeader(extentID); err != nil || r.Corruption != CorruptionNone || r.VerifiedBlocks != 3 {
+		t.Fatalf("the header should be verified, result %v err %v", r, err)
+	}
+	if r, err := s.RebuildExtentHeader(extentID, false); err != nil || r.Rebuilt {
+		t.Fatalf("the sound header should not be rebuilt, result %v err %v", r, err)
+	}
+
+	// a damaged sector of the header spoils the Crcs of the blocks and leaves the garbage behind the data
+	garbage := make([]byte, util.BlockHeaderSize)
+	for i := range garbage {
+		garbage[i] = 0x5a
+	}
+	if _, err = s.verifyExtentFp.WriteAt(garbage, int64(extentID*util.BlockHeaderSize)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.VerifyExtentHeader(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Corruption != CorruptionHeader || len(r.Mismatches) != 4 || r.GarbageEntries != util.BlockCount-4 {
+		t.Fatalf("expect the header corruption, but is %v with %v mismatches and %v garbage entries", r.Corruption,
+			len(r.Mismatches), r.GarbageEntries)
+	}
+	if r, err = s.RebuildExtentHeader(extentID, false); err != nil || !r.Rebuilt {
+		t.Fatalf("the corrupted header should be rebuilt, result %v err %v", r, err)
+	}
+	checkRebuiltHeader(t, s, extentID, crcs)
+}
+
+func TestRebuildDroppedExtentHeader(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	extentID, crcs := createVerifyTestExtent(t, s)
+
+	// the header dropped from the verify file is loaded empty
+	if err = s.DeleteBlockCrc(extentID); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s = newTestExtentStore(t, dataDir)
+	defer s.Close()
+	e, _, err := s.normalExtent(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&e.modifyTime, time.Now().Unix()-UpdateCrcInterval-1)
+	if r, err := s.VerifyExtentHeader(extentID); err != nil || r.Corruption != CorruptionNone || r.VerifiedBlocks != 0 {
+		t.Fatalf("the empty header has nothing to verify, result %v err %v", r, err)
+	}
+	if r, err := s.RebuildExtentHeader(extentID, true); err != nil || !r.Rebuilt {
+		t.Fatalf("the dropped header should be rebuilt by force, result %v err %v", r, err)
+	}
+	checkRebuiltHeader(t, s, extentID, crcs)
+}
+
+func TestRefuseRebuildOnDataCorruption(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "extent_verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	s := newTestExtentStore(t, dataDir)
+	defer s.Close()
+	extentID, _ := createVerifyTestExtent(t, s)
+	e, _, err := s.normalExtent(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.file.WriteAt([]byte{0xff, 0xff}, util.BlockSize+10); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.VerifyExtentHeader(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Corruption != CorruptionData || len(r.Mismatches) != 1 || r.Mismatches[0].BlockNo != 1 {
+		t.Fatalf("expect the data corruption of block 1, but is %v with mismatches %v", r.Corruption, r.Mismatches)
+	}
+	if _, err = s.RebuildExtentHeader(extentID, false); err == nil {
+		t.Fatalf("the header should not be rebuilt upon the corrupted data")
+	}
+	header, err := s.readExtentHeader(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crc := binary.BigEndian.Uint32(header[util.PerBlockCrcSize:]); crc != r.Mismatches[0].HeaderCrc {
+		t.Fatalf("the header should be kept, but the Crc of block 1 is %v", crc)
+	}
+}
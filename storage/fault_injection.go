@@ -0,0 +1,29 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+// ErrorInjector injects the faults into the file operations of the extents on a disk, to test how the data node
+// handles the disk errors, the disks going offline and the repairs. The injectors only take effect in the builds with
+// the faultinject tag, and the file operations are never hooked in the other builds.
+type ErrorInjector interface {
+	// WriteFault returns the error to fail the write of the extent file, nil to write it.
+	WriteFault(path string) error
+
+	// ReadFault may delay the read of the extent file, and returns the error to fail it, nil to read it.
+	ReadFault(path string) error
+
+	// CrcFault returns the crc replied for the data read from the extent file, which is corrupted if it differs.
+	CrcFault(path string, crc uint32) uint32
+}
@@ -0,0 +1,33 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !faultinject
+// +build !faultinject
+
+package storage
+
+// FaultInjectionEnabled tells whether the build injects the faults into the file operations of the extents.
+const FaultInjectionEnabled = false
+
+func injectWriteFault(path string) error {
+	return nil
+}
+
+func injectReadFault(path string) error {
+	return nil
+}
+
+func injectCrcFault(path string, crc uint32) uint32 {
+	return crc
+}
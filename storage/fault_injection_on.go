@@ -0,0 +1,128 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build faultinject
+// +build faultinject
+
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultInjectionEnabled tells whether the build injects the faults into the file operations of the extents.
+const FaultInjectionEnabled = true
+
+var injectors = struct {
+	sync.RWMutex
+	disks map[string]ErrorInjector // disk path -> injector
+}{disks: make(map[string]ErrorInjector)}
+
+// SetErrorInjector injects the faults of the injector into the extents on the disk, or stops injecting if it is nil.
+func SetErrorInjector(diskPath string, injector ErrorInjector) {
+	diskPath = path.Clean(diskPath)
+	injectors.Lock()
+	defer injectors.Unlock()
+	if injector == nil {
+		delete(injectors.disks, diskPath)
+		return
+	}
+	injectors.disks[diskPath] = injector
+}
+
+// ErrorInjectors returns the injectors of the disks.
+func ErrorInjectors() (disks map[string]ErrorInjector) {
+	injectors.RLock()
+	defer injectors.RUnlock()
+	disks = make(map[string]ErrorInjector, len(injectors.disks))
+	for diskPath, injector := range injectors.disks {
+		disks[diskPath] = injector
+	}
+	return
+}
+
+func injectorOf(filePath string) ErrorInjector {
+	injectors.RLock()
+	defer injectors.RUnlock()
+	for diskPath, injector := range injectors.disks {
+		if strings.HasPrefix(filePath, diskPath+"/") {
+			return injector
+		}
+	}
+	return nil
+}
+
+func injectWriteFault(path string) error {
+	if injector := injectorOf(path); injector != nil {
+		return injector.WriteFault(path)
+	}
+	return nil
+}
+
+func injectReadFault(path string) error {
+	if injector := injectorOf(path); injector != nil {
+		return injector.ReadFault(path)
+	}
+	return nil
+}
+
+func injectCrcFault(path string, crc uint32) uint32 {
+	if injector := injectorOf(path); injector != nil {
+		return injector.CrcFault(path, crc)
+	}
+	return crc
+}
+
+// DiskFaults is the ErrorInjector failing or corrupting the given percent of the operations. The errors wrap EIO, so
+// that they are taken as the disk errors by the data node.
+type DiskFaults struct {
+	WriteErrPercent   int   // percent of the writes failed
+	ReadErrPercent    int   // percent of the reads failed
+	ReadDelayMs       int64 // milliseconds each read is delayed
+	CrcCorruptPercent int   // percent of the reads replied with a corrupted crc
+}
+
+func hitPercent(percent int) bool {
+	return percent > 0 && rand.Intn(100) < percent
+}
+
+func (f *DiskFaults) WriteFault(path string) error {
+	if hitPercent(f.WriteErrPercent) {
+		return fmt.Errorf("injected write fault on %v: %v", path, syscall.EIO)
+	}
+	return nil
+}
+
+func (f *DiskFaults) ReadFault(path string) error {
+	if f.ReadDelayMs > 0 {
+		time.Sleep(time.Duration(f.ReadDelayMs) * time.Millisecond)
+	}
+	if hitPercent(f.ReadErrPercent) {
+		return fmt.Errorf("injected read fault on %v: %v", path, syscall.EIO)
+	}
+	return nil
+}
+
+func (f *DiskFaults) CrcFault(path string, crc uint32) uint32 {
+	if hitPercent(f.CrcCorruptPercent) {
+		return ^crc
+	}
+	return crc
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build faultinject
+// +build faultinject
+
+package storage
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestDiskFaults(t *testing.T) {
+	diskPath, err := ioutil.TempDir("", "fault_injection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diskPath)
+	s := newTestExtentStore(t, path.Join(diskPath, "datapartition_1"))
+	defer s.Close()
+	extentID, _ := s.NextExtentID()
+	if err = s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, util.BlockSize)
+	write := func() error {
+		return s.Write(extentID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), RandomWriteType, true)
+	}
+	read := func() (crc uint32, err error) {
+		return s.Read(extentID, 0, int64(len(data)), make([]byte, len(data)), false)
+	}
+	if err = s.Write(extentID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// the faults are injected into the extents on the disk only
+	SetErrorInjector(diskPath+"_other", &DiskFaults{WriteErrPercent: 100, ReadErrPercent: 100})
+	defer SetErrorInjector(diskPath+"_other", nil)
+	if err = write(); err != nil {
+		t.Fatalf("the faults of another disk should not be injected, but err is %v", err)
+	}
+
+	SetErrorInjector(diskPath+"/", &DiskFaults{ReadErrPercent: 100})
+	if _, err = read(); err == nil || !strings.Contains(err.Error(), "injected read fault") {
+		t.Fatalf("expect the injected read fault, but err is %v", err)
+	}
+
+	SetErrorInjector(diskPath, &DiskFaults{CrcCorruptPercent: 100})
+	if crc, _ := read(); crc == crc32.ChecksumIEEE(data) {
+		t.Fatalf("the crc of the read should be corrupted")
+	}
+
+	SetErrorInjector(diskPath, nil)
+	if len(ErrorInjectors()) != 1 {
+		t.Fatalf("the injector of the disk should be removed, but are %v", ErrorInjectors())
+	}
+	if crc, err := read(); err != nil || crc != crc32.ChecksumIEEE(data) {
+		t.Fatalf("the extent should be read with no faults, crc %v err %v", crc, err)
+	}
+
+	SetErrorInjector(diskPath, &DiskFaults{WriteErrPercent: 100})
+	defer SetErrorInjector(diskPath, nil)
+	if err = write(); err == nil || !strings.Contains(err.Error(), syscall.EIO.Error()) {
+		t.Fatalf("expect the injected write fault, but err is %v", err)
+	}
+}
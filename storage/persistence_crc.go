@@ -29,7 +29,8 @@ type BlockCrc struct {
 type BlockCrcArr []*BlockCrc
 
 const (
-	BaseExtentIDOffset = 0
+	BaseExtentIDOffset     = 0
+	PreAllocExtentIDOffset = 8
 )
 
 func (arr BlockCrcArr) Len() int           { return len(arr) }
@@ -58,21 +59,20 @@ func (s *ExtentStore) DeleteBlockCrc(extentID uint64) (err error) {
 	return
 }
 
+// PersistenceBaseExtentID persists the base extent ID, which is never moved backwards, since the IDs allocated
+// concurrently may be persisted out of order.
 func (s *ExtentStore) PersistenceBaseExtentID(extentID uint64) (err error) {
-	value := make([]byte, 8)
-	binary.BigEndian.PutUint64(value, extentID)
-	_, err = s.metadataFp.WriteAt(value, BaseExtentIDOffset)
-	return
+	return s.updateExtentMeta(func(m *extentMeta) {
+		if extentID > m.baseExtentID {
+			m.baseExtentID = extentID
+		}
+	}, false)
 }
 
 func (s *ExtentStore) GetPreAllocSpaceExtentIDOnVerfiyFile() (extentID uint64) {
-	value := make([]byte, 8)
-	_, err := s.metadataFp.WriteAt(value, 8)
-	if err != nil {
-		return
-	}
-	extentID = binary.BigEndian.Uint64(value)
-	return
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	return s.meta.preAllocExtentID
 }
 
 func (s *ExtentStore) PreAllocSpaceOnVerfiyFile(currExtentID uint64) {
@@ -84,9 +84,9 @@ func (s *ExtentStore) PreAllocSpaceOnVerfiyFile(currExtentID uint64) {
 		if err != nil {
 			return
 		}
-		data := make([]byte, 8)
-		binary.BigEndian.PutUint64(data, uint64(endAllocSpaceExtentID))
-		if _, err = s.metadataFp.WriteAt(data, 8); err != nil {
+		if err = s.updateExtentMeta(func(m *extentMeta) {
+			m.preAllocExtentID = uint64(endAllocSpaceExtentID)
+		}, false); err != nil {
 			return
 		}
 		atomic.StoreUint64(&s.hasAllocSpaceExtentIDOnVerfiyFile, uint64(endAllocSpaceExtentID))
@@ -100,13 +100,9 @@ func (s *ExtentStore) PreAllocSpaceOnVerfiyFile(currExtentID uint64) {
 }
 
 func (s *ExtentStore) GetPersistenceBaseExtentID() (extentID uint64, err error) {
-	data := make([]byte, 8)
-	_, err = s.metadataFp.ReadAt(data, 0)
-	if err != nil {
-		return
-	}
-	extentID = binary.BigEndian.Uint64(data)
-	return
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	return s.meta.baseExtentID, nil
 }
 
 func (s *ExtentStore) PersistenceHasDeleteExtent(extentID uint64) (err error) {
@@ -0,0 +1,132 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package atomicfile persists the small metadata files, such as the META and the apply ID files of the partitions.
+//
+// The content is prefixed with a header line which carries the format version and the CRC32 checksum of the
+// content, and is written to a temporary file which is synced and then renamed to the target, so that a crash
+// leaves either the old or the new file, and a damaged file is detected on load instead of being parsed.
+// The files written before the header was introduced are still loaded, without being verified.
+package atomicfile
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const (
+	headerMagic = "#cfsmeta"
+	Version     = 1
+)
+
+// CorruptedError indicates that the content of a metadata file does not match its header.
+type CorruptedError struct {
+	Name   string
+	Reason string
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("metadata file %v is corrupted: %v", e.Name, e.Reason)
+}
+
+// IsCorrupted returns true if the error indicates a corrupted metadata file.
+func IsCorrupted(err error) bool {
+	_, ok := err.(*CorruptedError)
+	return ok
+}
+
+// Encode prefixes the data with the header.
+func Encode(data []byte) []byte {
+	header := fmt.Sprintf("%v %d %08x\n", headerMagic, Version, crc32.ChecksumIEEE(data))
+	return append([]byte(header), data...)
+}
+
+// Decode verifies the data against the header, and returns the content without the header.
+// The data without a header is returned as it is.
+func Decode(name string, raw []byte) (data []byte, err error) {
+	if !bytes.HasPrefix(raw, []byte(headerMagic+" ")) {
+		return raw, nil
+	}
+	var (
+		version int
+		crc     uint32
+	)
+	index := bytes.IndexByte(raw, '\n')
+	if index < 0 {
+		return nil, &CorruptedError{Name: name, Reason: "incomplete header"}
+	}
+	if _, err = fmt.Sscanf(string(raw[:index]), headerMagic+" %d %x", &version, &crc); err != nil {
+		return nil, &CorruptedError{Name: name, Reason: fmt.Sprintf("invalid header %q", raw[:index])}
+	}
+	if version > Version {
+		return nil, fmt.Errorf("metadata file %v has version %v newer than the supported version %v", name, version, Version)
+	}
+	data = raw[index+1:]
+	if actual := crc32.ChecksumIEEE(data); actual != crc {
+		return nil, &CorruptedError{Name: name, Reason: fmt.Sprintf("checksum mismatch, expect %08x actual %08x", crc, actual)}
+	}
+	return data, nil
+}
+
+// WriteFile writes the data with the header to the temporary file in the same directory, syncs it and renames it to
+// the named file, and then syncs the directory to persist the rename.
+func WriteFile(name, tmpName string, data []byte, perm os.FileMode) (err error) {
+	tmpFile := path.Join(path.Dir(name), tmpName)
+	fp, err := os.OpenFile(tmpFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmpFile)
+		}
+	}()
+	if _, err = fp.Write(Encode(data)); err != nil {
+		fp.Close()
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		return
+	}
+	if err = fp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmpFile, name); err != nil {
+		return
+	}
+	return syncDir(path.Dir(name))
+}
+
+// ReadFile reads the named file and verifies it against the header.
+func ReadFile(name string) (data []byte, err error) {
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	return Decode(name, raw)
+}
+
+func syncDir(dir string) (err error) {
+	fp, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	return fp.Sync()
+}
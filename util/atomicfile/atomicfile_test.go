@@ -0,0 +1,72 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWriteAndReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := path.Join(dir, "META")
+	content := []byte(`{"VolumeID":"ltptest","PartitionID":1}`)
+	if err = WriteFile(name, ".meta", content, 0644); err != nil {
+		t.Fatalf("write file fail cause: %v", err)
+	}
+	if _, err = os.Stat(path.Join(dir, ".meta")); !os.IsNotExist(err) {
+		t.Fatalf("temporary file should be renamed, err: %v", err)
+	}
+	data, err := ReadFile(name)
+	if err != nil {
+		t.Fatalf("read file fail cause: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Fatalf("unexpected content %s", data)
+	}
+
+	raw, _ := ioutil.ReadFile(name)
+	raw[len(raw)-2] ^= 0xff
+	if err = ioutil.WriteFile(name, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadFile(name); !IsCorrupted(err) {
+		t.Fatalf("expect corrupted error, but got %v", err)
+	}
+	if err = ioutil.WriteFile(name, raw[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadFile(name); !IsCorrupted(err) {
+		t.Fatalf("expect corrupted error for truncated header, but got %v", err)
+	}
+}
+
+func TestReadLegacyFile(t *testing.T) {
+	content := []byte("1024|4096")
+	data, err := Decode("apply", content)
+	if err != nil {
+		t.Fatalf("decode legacy content fail cause: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Fatalf("unexpected content %s", data)
+	}
+}
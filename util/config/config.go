@@ -50,6 +50,16 @@ func LoadConfigFile(filename string) (*Config, error) {
 	return result, err
 }
 
+// ParseConfig parses config information from JSON data, and returns the error rather than exiting.
+func ParseConfig(data []byte) (*Config, error) {
+	result := newConfig()
+	if err := json.Unmarshal(data, &result.data); err != nil {
+		return nil, err
+	}
+	result.Raw = data
+	return result, nil
+}
+
 // LoadConfigString loads config information from a JSON string.
 func LoadConfigString(s string) *Config {
 	result := newConfig()
@@ -254,12 +264,36 @@ func CheckOrStoreConstCfg(fileDir, fileName string, cfg *ConstConfig) (ok bool,
 		return true, nil
 	}
 	// Load and check stored const configuration
+	if err = compareConstCfg(filePath, buf, cfg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckConstCfg checks the listen port, raft replica port and raft heartbeat port against the stored ones,
+// without storing them if they have not been stored yet.
+func CheckConstCfg(fileDir, fileName string, cfg *ConstConfig) (err error) {
+	var filePath = path.Join(fileDir, fileName)
+	buf, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read config file %v failed: %v", filePath, err)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	return compareConstCfg(filePath, buf, cfg)
+}
+
+func compareConstCfg(filePath string, buf []byte, cfg *ConstConfig) (err error) {
 	storedConstCfg := new(ConstConfig)
 	if err = json.Unmarshal(buf, storedConstCfg); err != nil {
-		return false, fmt.Errorf("unmarshal const config %v failed: %v", filePath, err)
+		return fmt.Errorf("unmarshal const config %v failed: %v", filePath, err)
 	}
 	if ok := storedConstCfg.Equals(cfg); !ok {
-		return false, fmt.Errorf("compare const config %v and %v failed: %v", storedConstCfg, cfg, err)
+		return fmt.Errorf("compare const config %v and %v failed: %v", storedConstCfg, cfg, err)
 	}
-	return true, nil
+	return nil
 }
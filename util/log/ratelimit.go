@@ -0,0 +1,143 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// The messages logged by the limited functions are limited by a token bucket per call site, so that the same error
+// repeated by every request or every partition during an incident does not flood the log. The messages dropped by
+// a call site are summarized by a line before its next message.
+const (
+	DefaultRateLimit = 10 // messages per second of a call site
+	DefaultRateBurst = 100
+
+	rateCallerSkip = 3 // allow <- logfLimited <- LogXfLimited <- the call site
+)
+
+type siteLimiter struct {
+	sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed uint64
+}
+
+var (
+	rateMutex sync.RWMutex
+	rateLimit = float64(DefaultRateLimit)
+	rateBurst = float64(DefaultRateBurst)
+	logSites  sync.Map // the program counter of the call site -> *siteLimiter
+)
+
+// SetRateLimit sets the messages per second and the burst of each call site of the limited functions, 0 or negative
+// rate to log all the messages.
+func SetRateLimit(limit float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	rateMutex.Lock()
+	rateLimit, rateBurst = limit, float64(burst)
+	rateMutex.Unlock()
+}
+
+func getRateLimit() (limit, burst float64) {
+	rateMutex.RLock()
+	defer rateMutex.RUnlock()
+	return rateLimit, rateBurst
+}
+
+// allow takes a token of the call site, and returns the number of the messages suppressed since the last one if
+// it is allowed.
+func (l *siteLimiter) allow(now time.Time, limit, burst float64) (ok bool, suppressed uint64) {
+	l.Lock()
+	defer l.Unlock()
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * limit
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		l.suppressed++
+		return false, 0
+	}
+	l.tokens--
+	suppressed, l.suppressed = l.suppressed, 0
+	return true, suppressed
+}
+
+func allow() (ok bool, suppressed uint64) {
+	limit, burst := getRateLimit()
+	if limit <= 0 {
+		return true, 0
+	}
+	pc, _, _, ok := runtime.Caller(rateCallerSkip)
+	if !ok {
+		return true, 0
+	}
+	value, _ := logSites.LoadOrStore(pc, &siteLimiter{})
+	return value.(*siteLimiter).allow(time.Now(), limit, burst)
+}
+
+func logfLimited(logger *LogObject, prefix string, format string, v ...interface{}) {
+	ok, suppressed := allow()
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		logger.Output(3, gLog.SetPrefix(fmt.Sprintf("suppressed %v similar messages", suppressed), prefix))
+	}
+	logger.Output(3, gLog.SetPrefix(fmt.Sprintf(format, v...), prefix))
+}
+
+// LogErrorfLimited logs the errors with specific format, which are limited per call site.
+func LogErrorfLimited(format string, v ...interface{}) {
+	if gLog == nil {
+		return
+	}
+	if ErrorLevel&gLog.level != gLog.level {
+		return
+	}
+	logfLimited(gLog.errorLogger, levelPrefixes[3], format, v...)
+}
+
+// LogWarnfLimited logs the warnings with specific format, which are limited per call site.
+func LogWarnfLimited(format string, v ...interface{}) {
+	if gLog == nil {
+		return
+	}
+	if WarnLevel&gLog.level != gLog.level {
+		return
+	}
+	logfLimited(gLog.warnLogger, levelPrefixes[2], format, v...)
+}
+
+// LogInfofLimited logs the information with specific format, which is limited per call site.
+func LogInfofLimited(format string, v ...interface{}) {
+	if gLog == nil {
+		return
+	}
+	if InfoLevel&gLog.level != gLog.level {
+		return
+	}
+	logfLimited(gLog.infoLogger, levelPrefixes[1], format, v...)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSiteLimiter(t *testing.T) {
+	l := &siteLimiter{}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(now, 1, 3); !ok {
+			t.Fatalf("message %v within the burst is suppressed", i)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.allow(now, 1, 3); ok {
+			t.Fatalf("message %v beyond the burst is allowed", i)
+		}
+	}
+	ok, suppressed := l.allow(now.Add(time.Second), 1, 3)
+	if !ok || suppressed != 5 {
+		t.Fatalf("expect the message allowed after 5 suppressed ones, but is %v %v", ok, suppressed)
+	}
+	if ok, _ = l.allow(now.Add(time.Second), 1, 3); ok {
+		t.Fatalf("the refilled token is taken twice")
+	}
+	// the tokens are refilled up to the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, suppressed = l.allow(now, 1, 3); !ok {
+			t.Fatalf("message %v within the refilled burst is suppressed", i)
+		}
+	}
+	if ok, _ = l.allow(now, 1, 3); ok {
+		t.Fatalf("the tokens exceed the burst")
+	}
+}
+
+// testLogfLimited calls allow as deep as the limited functions do.
+func testLogfLimited() bool {
+	return testLogf()
+}
+
+func testLogf() bool {
+	ok, _ := allow()
+	return ok
+}
+
+func TestAllowPerCallSite(t *testing.T) {
+	SetRateLimit(0.001, 1)
+	defer SetRateLimit(DefaultRateLimit, DefaultRateBurst)
+	allowed := make([]bool, 0, 3)
+	for i := 0; i < 2; i++ {
+		allowed = append(allowed, testLogfLimited())
+	}
+	allowed = append(allowed, testLogfLimited())
+	if !allowed[0] || allowed[1] || !allowed[2] {
+		t.Fatalf("expect the second message of a call site suppressed only, but allowed %v", allowed)
+	}
+}
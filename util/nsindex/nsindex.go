@@ -0,0 +1,453 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package nsindex implements the namespace index, a compact columnar file format to which the metadata of a volume is
+// exported for the offline search, so that the scanners read the index instead of the live meta nodes.
+//
+// A volume is exported into a directory holding an index file for each meta partition and a manifest:
+//
+//	<target>/<volume>/<exportID>/mp_<partitionID>.cfsidx
+//	<target>/<volume>/<exportID>/MANIFEST.json
+//
+// The export is complete only if the manifest exists, which lists the index files. An index file is laid out as:
+//
+//	magic "CFSNSIX1"
+//	column chunks, each of which holds the encoded values of a column
+//	footer, the JSON encoded Footer which locates the column chunks
+//	footer length, uint32 in big endian
+//	magic "CFSNSIX1"
+//
+// The index has two tables. Table "inodes" holds the inodes of the partition ordered by the inode ID, with columns
+// "ino", "mode", "size", "mtime", "uid", "gid" and "nlink". Table "dentries" holds the dentries of the partition
+// ordered by the parent inode ID and the name, with columns "parent", "name", "ino" and "type". A dentry is kept by
+// the partition of its parent, which may differ from the partition of its inode, so the paths are built by joining
+// the dentries of all the index files with the inodes, see ResolvePaths.
+//
+// The encodings of the columns are:
+//
+//	delta    the first value and the differences between the consecutive values, as unsigned varints
+//	uvarint  unsigned varints
+//	varint   zigzag encoded signed varints
+//	string   the length as an unsigned varint followed by the bytes
+//
+// The crc of each column chunk is the IEEE CRC-32 of its bytes.
+package nsindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	Magic        = "CFSNSIX1"
+	FileSuffix   = ".cfsidx"
+	ManifestName = "MANIFEST.json"
+
+	TableInodes   = "inodes"
+	TableDentries = "dentries"
+
+	EncodingDelta   = "delta"
+	EncodingUvarint = "uvarint"
+	EncodingVarint  = "varint"
+	EncodingString  = "string"
+)
+
+var ErrCorrupted = errors.New("corrupted namespace index")
+
+// FileName returns the name of the index file of the meta partition.
+func FileName(partitionID uint64) string {
+	return fmt.Sprintf("mp_%d%s", partitionID, FileSuffix)
+}
+
+// Inode is a row of table "inodes".
+type Inode struct {
+	Inode      uint64
+	Mode       uint32
+	Size       uint64
+	ModifyTime int64 // unix seconds
+	Uid        uint32
+	Gid        uint32
+	Nlink      uint32
+}
+
+// Dentry is a row of table "dentries".
+type Dentry struct {
+	ParentID uint64
+	Name     string
+	Inode    uint64
+	Type     uint32
+}
+
+// Footer describes the index file.
+type Footer struct {
+	Volume      string
+	PartitionID uint64
+	ApplyID     uint64 // the apply ID of the snapshot the index is exported from
+	ExportTime  int64
+	Tables      []*Table
+}
+
+// Table describes a table of the index file.
+type Table struct {
+	Name    string
+	Rows    uint64
+	Columns []*Column
+}
+
+// Column locates the chunk of a column in the index file.
+type Column struct {
+	Name     string
+	Encoding string
+	Offset   int64
+	Length   int64
+	Crc      uint32
+}
+
+// Manifest lists the index files of an export, which is written once all of them are exported.
+type Manifest struct {
+	Volume     string
+	ExportID   string
+	ExportTime int64
+	Files      []*ManifestFile
+}
+
+// ManifestFile describes an index file of the export.
+type ManifestFile struct {
+	PartitionID uint64
+	Name        string
+	ApplyID     uint64
+	Inodes      uint64
+	Dentries    uint64
+	Size        int64
+}
+
+// columnWriter encodes the values of a column.
+type columnWriter struct {
+	name     string
+	encoding string
+	buf      bytes.Buffer
+	last     uint64
+	scratch  [binary.MaxVarintLen64]byte
+}
+
+func (c *columnWriter) putUint(v uint64) error {
+	if c.encoding == EncodingDelta {
+		if c.buf.Len() > 0 && v < c.last {
+			return fmt.Errorf("column %v is not ascending: %v after %v", c.name, v, c.last)
+		}
+		v, c.last = v-c.last, v
+	}
+	c.buf.Write(c.scratch[:binary.PutUvarint(c.scratch[:], v)])
+	return nil
+}
+
+func (c *columnWriter) putInt(v int64) {
+	c.buf.Write(c.scratch[:binary.PutVarint(c.scratch[:], v)])
+}
+
+func (c *columnWriter) putString(v string) {
+	c.buf.Write(c.scratch[:binary.PutUvarint(c.scratch[:], uint64(len(v)))])
+	c.buf.WriteString(v)
+}
+
+type tableWriter struct {
+	name    string
+	rows    uint64
+	columns []*columnWriter
+}
+
+func newTableWriter(name string, columns ...*columnWriter) *tableWriter {
+	return &tableWriter{name: name, columns: columns}
+}
+
+func column(name, encoding string) *columnWriter {
+	return &columnWriter{name: name, encoding: encoding}
+}
+
+// Writer builds an index file in memory, in which the columns are encoded compactly enough for a meta partition.
+type Writer struct {
+	footer   Footer
+	inodes   *tableWriter
+	dentries *tableWriter
+}
+
+// NewWriter returns a writer of the index file of the meta partition.
+func NewWriter(volume string, partitionID, applyID uint64, exportTime int64) *Writer {
+	return &Writer{
+		footer: Footer{Volume: volume, PartitionID: partitionID, ApplyID: applyID, ExportTime: exportTime},
+		inodes: newTableWriter(TableInodes, column("ino", EncodingDelta), column("mode", EncodingUvarint),
+			column("size", EncodingUvarint), column("mtime", EncodingVarint), column("uid", EncodingUvarint),
+			column("gid", EncodingUvarint), column("nlink", EncodingUvarint)),
+		dentries: newTableWriter(TableDentries, column("parent", EncodingDelta), column("name", EncodingString),
+			column("ino", EncodingUvarint), column("type", EncodingUvarint)),
+	}
+}
+
+// AddInode appends the inode, which must be added in the ascending order of the inode IDs.
+func (w *Writer) AddInode(ino *Inode) (err error) {
+	cols := w.inodes.columns
+	if err = cols[0].putUint(ino.Inode); err != nil {
+		return
+	}
+	cols[1].putUint(uint64(ino.Mode))
+	cols[2].putUint(ino.Size)
+	cols[3].putInt(ino.ModifyTime)
+	cols[4].putUint(uint64(ino.Uid))
+	cols[5].putUint(uint64(ino.Gid))
+	cols[6].putUint(uint64(ino.Nlink))
+	w.inodes.rows++
+	return
+}
+
+// AddDentry appends the dentry, which must be added in the ascending order of the parent inode IDs.
+func (w *Writer) AddDentry(dentry *Dentry) (err error) {
+	cols := w.dentries.columns
+	if err = cols[0].putUint(dentry.ParentID); err != nil {
+		return
+	}
+	cols[1].putString(dentry.Name)
+	cols[2].putUint(dentry.Inode)
+	cols[3].putUint(uint64(dentry.Type))
+	w.dentries.rows++
+	return
+}
+
+// Rows returns the numbers of the inodes and the dentries added.
+func (w *Writer) Rows() (inodes, dentries uint64) {
+	return w.inodes.rows, w.dentries.rows
+}
+
+// WriteTo writes the index file.
+func (w *Writer) WriteTo(out io.Writer) (n int64, err error) {
+	write := func(data []byte) error {
+		written, err := out.Write(data)
+		n += int64(written)
+		return err
+	}
+	if err = write([]byte(Magic)); err != nil {
+		return
+	}
+	footer := w.footer
+	footer.Tables = nil
+	for _, tw := range []*tableWriter{w.inodes, w.dentries} {
+		table := &Table{Name: tw.name, Rows: tw.rows}
+		for _, cw := range tw.columns {
+			data := cw.buf.Bytes()
+			table.Columns = append(table.Columns, &Column{
+				Name:     cw.name,
+				Encoding: cw.encoding,
+				Offset:   n,
+				Length:   int64(len(data)),
+				Crc:      crc32.ChecksumIEEE(data),
+			})
+			if err = write(data); err != nil {
+				return
+			}
+		}
+		footer.Tables = append(footer.Tables, table)
+	}
+	data, err := json.Marshal(&footer)
+	if err != nil {
+		return
+	}
+	if err = write(data); err != nil {
+		return
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	if err = write(length[:]); err != nil {
+		return
+	}
+	err = write([]byte(Magic))
+	return
+}
+
+// Reader reads an index file.
+type Reader struct {
+	Footer
+	data []byte
+}
+
+// ReadFile reads the index file.
+func ReadFile(name string) (r *Reader, err error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	return NewReader(data)
+}
+
+// NewReader returns the reader of the index file in data.
+func NewReader(data []byte) (r *Reader, err error) {
+	trailer := 4 + len(Magic)
+	if len(data) < len(Magic)+trailer || string(data[:len(Magic)]) != Magic || string(data[len(data)-len(Magic):]) != Magic {
+		return nil, ErrCorrupted
+	}
+	length := int(binary.BigEndian.Uint32(data[len(data)-trailer:]))
+	if length > len(data)-len(Magic)-trailer {
+		return nil, ErrCorrupted
+	}
+	r = &Reader{data: data}
+	if err = json.Unmarshal(data[len(data)-trailer-length:len(data)-trailer], &r.Footer); err != nil {
+		return nil, ErrCorrupted
+	}
+	return
+}
+
+func (r *Reader) table(name string) (*Table, error) {
+	for _, table := range r.Tables {
+		if table.Name == name {
+			return table, nil
+		}
+	}
+	return nil, fmt.Errorf("%v: table %v not found", ErrCorrupted, name)
+}
+
+// columnReader decodes the values of a column.
+type columnReader struct {
+	column *Column
+	data   []byte
+	last   uint64
+	err    error
+}
+
+func (r *Reader) columns(table *Table, names ...string) (readers []*columnReader, err error) {
+	for _, name := range names {
+		var found *Column
+		for _, col := range table.Columns {
+			if col.Name == name {
+				found = col
+				break
+			}
+		}
+		if found == nil || found.Offset < 0 || found.Length < 0 || found.Offset+found.Length > int64(len(r.data)) {
+			return nil, fmt.Errorf("%v: column %v of table %v", ErrCorrupted, name, table.Name)
+		}
+		data := r.data[found.Offset : found.Offset+found.Length]
+		if crc32.ChecksumIEEE(data) != found.Crc {
+			return nil, fmt.Errorf("%v: crc of column %v of table %v", ErrCorrupted, name, table.Name)
+		}
+		readers = append(readers, &columnReader{column: found, data: data})
+	}
+	return
+}
+
+func (c *columnReader) uint() (v uint64) {
+	v, n := binary.Uvarint(c.data)
+	if n <= 0 {
+		c.err = fmt.Errorf("%v: column %v is truncated", ErrCorrupted, c.column.Name)
+		return 0
+	}
+	c.data = c.data[n:]
+	if c.column.Encoding == EncodingDelta {
+		v += c.last
+		c.last = v
+	}
+	return
+}
+
+func (c *columnReader) int() (v int64) {
+	v, n := binary.Varint(c.data)
+	if n <= 0 {
+		c.err = fmt.Errorf("%v: column %v is truncated", ErrCorrupted, c.column.Name)
+		return 0
+	}
+	c.data = c.data[n:]
+	return
+}
+
+func (c *columnReader) string() (v string) {
+	length := c.uint()
+	if c.err != nil {
+		return
+	}
+	if length > uint64(len(c.data)) {
+		c.err = fmt.Errorf("%v: column %v is truncated", ErrCorrupted, c.column.Name)
+		return
+	}
+	v, c.data = string(c.data[:length]), c.data[length:]
+	return
+}
+
+func firstError(cols []*columnReader) error {
+	for _, c := range cols {
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// Inodes calls fn on the inodes of the index file in order, until fn returns false.
+func (r *Reader) Inodes(fn func(ino *Inode) bool) (err error) {
+	table, err := r.table(TableInodes)
+	if err != nil {
+		return
+	}
+	cols, err := r.columns(table, "ino", "mode", "size", "mtime", "uid", "gid", "nlink")
+	if err != nil {
+		return
+	}
+	for i := uint64(0); i < table.Rows; i++ {
+		ino := &Inode{
+			Inode:      cols[0].uint(),
+			Mode:       uint32(cols[1].uint()),
+			Size:       cols[2].uint(),
+			ModifyTime: cols[3].int(),
+			Uid:        uint32(cols[4].uint()),
+			Gid:        uint32(cols[5].uint()),
+			Nlink:      uint32(cols[6].uint()),
+		}
+		if err = firstError(cols); err != nil {
+			return
+		}
+		if !fn(ino) {
+			return
+		}
+	}
+	return
+}
+
+// Dentries calls fn on the dentries of the index file in order, until fn returns false.
+func (r *Reader) Dentries(fn func(dentry *Dentry) bool) (err error) {
+	table, err := r.table(TableDentries)
+	if err != nil {
+		return
+	}
+	cols, err := r.columns(table, "parent", "name", "ino", "type")
+	if err != nil {
+		return
+	}
+	for i := uint64(0); i < table.Rows; i++ {
+		dentry := &Dentry{
+			ParentID: cols[0].uint(),
+			Name:     cols[1].string(),
+			Inode:    cols[2].uint(),
+			Type:     uint32(cols[3].uint()),
+		}
+		if err = firstError(cols); err != nil {
+			return
+		}
+		if !fn(dentry) {
+			return
+		}
+	}
+	return
+}
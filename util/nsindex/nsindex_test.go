@@ -0,0 +1,135 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package nsindex
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func buildIndex(t *testing.T, partitionID uint64, inodes []*Inode, dentries []*Dentry) *Reader {
+	w := NewWriter("vol", partitionID, 100, 1600000000)
+	for _, ino := range inodes {
+		if err := w.AddInode(ino); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dentry := range dentries {
+		if err := w.AddDentry(dentry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if _, err := w.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWriteAndRead(t *testing.T) {
+	inodes := []*Inode{
+		{Inode: 1, Mode: proto.Mode(os.ModeDir | 0755), ModifyTime: 1600000000, Nlink: 3},
+		{Inode: 5, Mode: 0644, Size: 1 << 40, ModifyTime: -1, Uid: 1000, Gid: 1000, Nlink: 1},
+	}
+	dentries := []*Dentry{
+		{ParentID: 1, Name: "a", Inode: 5, Type: 0644},
+		{ParentID: 1, Name: "文件", Inode: 6, Type: 0644},
+	}
+	r := buildIndex(t, 7, inodes, dentries)
+	if r.PartitionID != 7 || r.ApplyID != 100 || r.Volume != "vol" {
+		t.Fatalf("unexpected footer %+v", r.Footer)
+	}
+	var gotInodes []*Inode
+	if err := r.Inodes(func(ino *Inode) bool { gotInodes = append(gotInodes, ino); return true }); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotInodes, inodes) {
+		t.Fatalf("expect inodes %v, but got %v", inodes, gotInodes)
+	}
+	var gotDentries []*Dentry
+	if err := r.Dentries(func(dentry *Dentry) bool { gotDentries = append(gotDentries, dentry); return true }); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotDentries, dentries) {
+		t.Fatalf("expect dentries %v, but got %v", dentries, gotDentries)
+	}
+
+	w := NewWriter("vol", 7, 100, 0)
+	if err := w.AddInode(&Inode{Inode: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddInode(&Inode{Inode: 4}); err == nil {
+		t.Fatalf("the inodes out of order should be rejected")
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	w := NewWriter("vol", 1, 1, 0)
+	w.AddInode(&Inode{Inode: 1})
+	buf := new(bytes.Buffer)
+	w.WriteTo(buf)
+	data := buf.Bytes()
+	if _, err := NewReader(data[:len(data)-1]); err != ErrCorrupted {
+		t.Fatalf("the truncated index should be rejected, err %v", err)
+	}
+	data[len(Magic)] ^= 0xff
+	r, err := NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Inodes(func(*Inode) bool { return true }); err == nil {
+		t.Fatalf("the corrupted column should be rejected")
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	// the dentries are kept by the partition of the parent, which differs from the one of the inode
+	r1 := buildIndex(t, 1, []*Inode{
+		{Inode: 1, Mode: proto.Mode(os.ModeDir | 0755)},
+		{Inode: 2, Mode: proto.Mode(os.ModeDir | 0755)},
+		{Inode: 3, Size: 10},
+	}, []*Dentry{
+		{ParentID: 1, Name: "dir", Inode: 2},
+		{ParentID: 2, Name: "big", Inode: 100},
+		{ParentID: 2, Name: "link", Inode: 3},
+	})
+	r2 := buildIndex(t, 2, []*Inode{
+		{Inode: 100, Size: 1000},
+		{Inode: 101, Size: 1}, // orphan
+	}, []*Dentry{
+		{ParentID: 1, Name: "file", Inode: 3},
+	})
+	paths := make([]string, 0)
+	if err := ResolvePaths([]*Reader{r1, r2}, func(path string, ino *Inode) bool {
+		paths = append(paths, path)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	expect := []string{"/", "/dir", "/dir/big", "/dir/link", "/file"}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Fatalf("expect paths %v, but got %v", expect, paths)
+	}
+}
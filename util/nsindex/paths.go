@@ -0,0 +1,83 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package nsindex
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+type dentryRef struct {
+	parentID uint64
+	name     string
+}
+
+// ResolvePaths calls fn with the paths of the inodes in the index files of an export, until fn returns false. An
+// inode linked by several dentries is called with each of its paths, and the inodes unreachable from the root, e.g.
+// the orphans waiting to be freed, are skipped. The dentries of all the index files are held in memory.
+func ResolvePaths(readers []*Reader, fn func(path string, ino *Inode) bool) (err error) {
+	refs := make(map[uint64][]dentryRef)
+	for _, r := range readers {
+		if err = r.Dentries(func(dentry *Dentry) bool {
+			refs[dentry.Inode] = append(refs[dentry.Inode], dentryRef{parentID: dentry.ParentID, name: dentry.Name})
+			return true
+		}); err != nil {
+			return
+		}
+	}
+	dirPaths := make(map[uint64]string)
+	var dirPath func(ino uint64, depth int) (string, bool)
+	dirPath = func(ino uint64, depth int) (string, bool) {
+		if ino == proto.RootIno {
+			return "", true
+		}
+		if p, ok := dirPaths[ino]; ok {
+			return p, true
+		}
+		// a directory has a single dentry, and a loop is never resolved
+		if len(refs[ino]) == 0 || depth > len(refs) {
+			return "", false
+		}
+		ref := refs[ino][0]
+		parent, ok := dirPath(ref.parentID, depth+1)
+		if !ok {
+			return "", false
+		}
+		p := parent + "/" + ref.name
+		dirPaths[ino] = p
+		return p, true
+	}
+	next := true
+	for _, r := range readers {
+		if err = r.Inodes(func(ino *Inode) bool {
+			if ino.Inode == proto.RootIno {
+				next = fn("/", ino)
+				return next
+			}
+			for _, ref := range refs[ino.Inode] {
+				parent, ok := dirPath(ref.parentID, 0)
+				if !ok {
+					continue
+				}
+				if next = fn(parent+"/"+ref.name, ino); !next {
+					return false
+				}
+			}
+			return true
+		}); err != nil || !next {
+			return
+		}
+	}
+	return
+}
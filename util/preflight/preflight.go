@@ -0,0 +1,214 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package preflight checks the config and the environment of a server before it is started, without changing
+// anything of the environment, and reports the results in a machine-readable form.
+package preflight
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/config"
+)
+
+// The names of the checks
+const (
+	CheckConfig      = "config"
+	CheckPort        = "port"
+	CheckDir         = "dir"
+	CheckDiskSpace   = "diskSpace"
+	CheckResolve     = "resolve"
+	CheckConstConfig = "constConfig"
+)
+
+const (
+	// DefaultMinDiskSpace is the free space required by the directories of the metadata and the raft logs.
+	DefaultMinDiskSpace = 1 * util.GB
+)
+
+// Check is the result of a single check.
+type Check struct {
+	Name   string
+	Target string
+	Passed bool
+	Msg    string `json:",omitempty"`
+}
+
+// Report is the result of the preflight of a server. It is passed only if all the checks are passed.
+type Report struct {
+	Role   string
+	Passed bool
+	Checks []*Check
+
+	ownPorts map[string]bool
+}
+
+// NewReport returns a new report of the server of the role. The ports listened by the running server itself are
+// taken as free, so that the config of a running server can be validated by it.
+func NewReport(role string, ownPorts ...string) *Report {
+	r := &Report{Role: role, Passed: true, Checks: make([]*Check, 0), ownPorts: make(map[string]bool)}
+	for _, port := range ownPorts {
+		r.ownPorts[port] = true
+	}
+	return r
+}
+
+// Add records the result of a check, which is failed if err is not nil.
+func (r *Report) Add(name, target string, err error) {
+	check := &Check{Name: name, Target: target, Passed: err == nil}
+	if err != nil {
+		check.Msg = err.Error()
+		r.Passed = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// Required checks that the config keys are set, and returns whether all of them are set.
+func (r *Report) Required(cfg *config.Config, keys ...string) (ok bool) {
+	ok = true
+	for _, key := range keys {
+		var err error
+		if cfg.GetString(key) == "" {
+			err = fmt.Errorf("%v is not set", key)
+			ok = false
+		}
+		r.Add(CheckConfig, key, err)
+	}
+	return
+}
+
+// Strings returns the strings of the config key, and records the failure if any of them is not a string.
+func (r *Report) Strings(cfg *config.Config, key string) (values []string) {
+	values = make([]string, 0)
+	for _, item := range cfg.GetSlice(key) {
+		value, ok := item.(string)
+		if !ok {
+			r.Add(CheckConfig, key, fmt.Errorf("%v is not a string", item))
+			continue
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Port checks that the port is valid and free to be listened.
+func (r *Report) Port(port string) {
+	r.Add(CheckPort, port, r.checkPort(port))
+}
+
+func (r *Report) checkPort(port string) (err error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid port %v", port)
+	}
+	if r.ownPorts[port] {
+		return
+	}
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return
+	}
+	return ln.Close()
+}
+
+// Dir checks that the directory, or its nearest existing parent to create it in, is a writable directory.
+func (r *Report) Dir(dir string) {
+	r.Add(CheckDir, dir, checkDir(dir))
+}
+
+func checkDir(dir string) (err error) {
+	existing, err := existingDir(dir)
+	if err != nil {
+		return
+	}
+	fp, err := ioutil.TempFile(existing, ".preflight")
+	if err != nil {
+		return
+	}
+	fp.Close()
+	return os.Remove(fp.Name())
+}
+
+// existingDir returns the directory itself if it exists, or its nearest existing parent.
+func existingDir(dir string) (existing string, err error) {
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	for {
+		var info os.FileInfo
+		if info, err = os.Stat(dir); err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%v is not a directory", dir)
+			}
+			return dir, nil
+		}
+		if !os.IsNotExist(err) {
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// DiskSpace checks that the available space of the file system of the directory is at least min bytes.
+func (r *Report) DiskSpace(dir string, min uint64) {
+	r.Add(CheckDiskSpace, dir, checkDiskSpace(dir, min))
+}
+
+func checkDiskSpace(dir string, min uint64) (err error) {
+	existing, err := existingDir(dir)
+	if err != nil {
+		return
+	}
+	fs := syscall.Statfs_t{}
+	if err = syscall.Statfs(existing, &fs); err != nil {
+		return
+	}
+	if avail := fs.Bavail * uint64(fs.Bsize); avail < min {
+		return fmt.Errorf("available space %v is less than %v", avail, min)
+	}
+	return
+}
+
+// Resolve checks that the host of the address is resolvable.
+func (r *Report) Resolve(addr string) {
+	r.Add(CheckResolve, addr, resolve(addr))
+}
+
+func resolve(addr string) (err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	if net.ParseIP(host) != nil {
+		return
+	}
+	_, err = net.LookupHost(host)
+	return
+}
+
+// ConstConfig checks that the ports are the same as the ones the server was started with in the directory.
+func (r *Report) ConstConfig(dir string, cfg *config.ConstConfig) {
+	r.Add(CheckConstConfig, dir, config.CheckConstCfg(dir, config.DefaultConstConfigFile, cfg))
+}
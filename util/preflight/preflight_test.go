@@ -0,0 +1,98 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package preflight
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/util/config"
+)
+
+func lastCheck(r *Report) *Check {
+	return r.Checks[len(r.Checks)-1]
+}
+
+func TestPort(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	r := NewReport("test")
+	if r.Port(port); lastCheck(r).Passed || r.Passed {
+		t.Fatalf("port %v in use should fail", port)
+	}
+	if r.Port("65536"); lastCheck(r).Passed {
+		t.Fatalf("invalid port should fail")
+	}
+	r = NewReport("test", port)
+	if r.Port(port); !r.Passed {
+		t.Fatalf("port %v of the server itself should pass: %v", port, lastCheck(r).Msg)
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "file")
+	if err = ioutil.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReport("test")
+	if r.Dir(path.Join(dir, "a", "b")); !r.Passed {
+		t.Fatalf("dir to be created should pass: %v", lastCheck(r).Msg)
+	}
+	if _, err = os.Stat(path.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Fatalf("dir should not be created by the check, err %v", err)
+	}
+	if r.DiskSpace(dir, 1); !r.Passed {
+		t.Fatalf("disk space should pass: %v", lastCheck(r).Msg)
+	}
+	if r.Dir(path.Join(file, "a")); r.Passed {
+		t.Fatalf("dir under a file should fail")
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 1 {
+		t.Fatalf("the check should leave nothing in the dir, but got %v", len(infos))
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg, err := config.ParseConfig([]byte(`{"listen":"17010","disks":["/data0:1",1]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReport("test")
+	if !r.Required(cfg, "listen") || !r.Passed {
+		t.Fatalf("listen is set")
+	}
+	if disks := r.Strings(cfg, "disks"); len(disks) != 1 || r.Passed {
+		t.Fatalf("non-string disk should fail, disks %v", disks)
+	}
+	r = NewReport("test")
+	if r.Required(cfg, "listen", "raftDir") || r.Passed || len(r.Checks) != 2 {
+		t.Fatalf("raftDir is not set, checks %v", len(r.Checks))
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pressure
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+const (
+	procSelfCgroup     = "/proc/self/cgroup"
+	procSelfFd         = "/proc/self/fd"
+	cgroupRoot         = "/sys/fs/cgroup"
+	cgroupV1MemLimit   = "memory.limit_in_bytes"
+	cgroupV2MemLimit   = "memory.max"
+	cgroupV1MemSubsys  = "memory"
+	cgroupUnlimitedStr = "max"
+)
+
+// cgroupPaths returns the cgroup path of the memory controller in cgroup v1 and the unified path in cgroup v2.
+func cgroupPaths() (v1Path, v2Path string) {
+	fp, err := os.Open(procSelfCgroup)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	scan := bufio.NewScanner(fp)
+	for scan.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scan.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2Path = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == cgroupV1MemSubsys {
+				v1Path = fields[2]
+			}
+		}
+	}
+	return
+}
+
+func readLimit(file string) (limit uint64, ok bool) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	value := strings.TrimSpace(string(data))
+	if value == cgroupUnlimitedStr {
+		return
+	}
+	if limit, err = strconv.ParseUint(value, 10, 64); err != nil {
+		return
+	}
+	return limit, true
+}
+
+// cgroupMemoryLimit returns the memory limit of the cgroup of the process. The own cgroup path is tried first,
+// and then the root which is the own cgroup in a container.
+func cgroupMemoryLimit() (limit uint64, ok bool) {
+	v1Path, v2Path := cgroupPaths()
+	candidates := []string{
+		path.Join(cgroupRoot, v2Path, cgroupV2MemLimit),
+		path.Join(cgroupRoot, cgroupV2MemLimit),
+		path.Join(cgroupRoot, cgroupV1MemSubsys, v1Path, cgroupV1MemLimit),
+		path.Join(cgroupRoot, cgroupV1MemSubsys, cgroupV1MemLimit),
+	}
+	for _, file := range candidates {
+		if limit, ok = readLimit(file); ok {
+			return
+		}
+	}
+	return
+}
+
+// memoryUsage returns the resident set size of the process and the smaller one of the cgroup limit and the total
+// memory of the host, since the cgroup v1 reports a huge number if it is unlimited.
+func memoryUsage() (used, limit uint64, err error) {
+	if used, err = util.GetProcessMemory(os.Getpid()); err != nil {
+		return
+	}
+	if limit, _, err = util.GetMemInfo(); err != nil {
+		return
+	}
+	if cgroupLimit, ok := cgroupMemoryLimit(); ok && cgroupLimit < limit {
+		limit = cgroupLimit
+	}
+	return
+}
+
+// openFileUsage returns the number of the open files of the process and the soft limit.
+func openFileUsage() (used, limit uint64, err error) {
+	var rlimit syscall.Rlimit
+	if err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return
+	}
+	limit = rlimit.Cur
+	fp, err := os.Open(procSelfFd)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	names, err := fp.Readdirnames(-1)
+	if err != nil {
+		return
+	}
+	used = uint64(len(names))
+	return
+}
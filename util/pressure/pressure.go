@@ -0,0 +1,206 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package pressure watches the memory and the file descriptors of the process against the limits of the cgroup and
+// the ulimit, so that a node sheds load before it is killed or fails to open files.
+package pressure
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultWarnRatio     = 0.85
+	DefaultCriticalRatio = 0.95
+	DefaultCheckInterval = 10 * time.Second
+)
+
+// ErrBusy is the error of the requests shed under the critical pressure, which is replied with OpAgain, so that the
+// clients retry them later or on other replicas.
+var ErrBusy = errors.New("busy under critical resource pressure")
+
+func init() {
+	proto.RegisterResultCode(ErrBusy, proto.OpAgain)
+}
+
+const (
+	levelNormal int32 = iota
+	levelWarning
+	levelCritical
+)
+
+var levelNames = map[int32]string{
+	levelNormal:   proto.PressureNormal,
+	levelWarning:  proto.PressureWarning,
+	levelCritical: proto.PressureCritical,
+}
+
+// Monitor checks the resource usage of the process periodically, and relieves the pressure when it rises.
+type Monitor struct {
+	module           string
+	warnRatio        float64
+	criticalRatio    float64
+	interval         time.Duration
+	level            int32
+	rejectedRequests uint64
+	reliefs          []func()
+	stat             *proto.ResourcePressure
+	statLock         sync.RWMutex
+	stopC            chan struct{}
+	stopOnce         sync.Once
+}
+
+// NewMonitor returns a new Monitor with the ratios configured by the keys pressureWarnRatio and
+// pressureCriticalRatio, which default to 0.85 and 0.95.
+func NewMonitor(module string, cfg *config.Config) (m *Monitor, err error) {
+	m = &Monitor{
+		module:        module,
+		warnRatio:     DefaultWarnRatio,
+		criticalRatio: DefaultCriticalRatio,
+		interval:      DefaultCheckInterval,
+		stat:          &proto.ResourcePressure{Level: proto.PressureNormal},
+		stopC:         make(chan struct{}),
+	}
+	if cfg != nil {
+		if ratio := cfg.GetFloat(proto.PressureWarnRatio); ratio > 0 {
+			m.warnRatio = ratio
+		}
+		if ratio := cfg.GetFloat(proto.PressureCriticalRatio); ratio > 0 {
+			m.criticalRatio = ratio
+		}
+	}
+	if m.warnRatio >= m.criticalRatio || m.criticalRatio > 1 {
+		return nil, fmt.Errorf("invalid pressure ratios, %v(%v) should be less than %v(%v) which is at most 1",
+			proto.PressureWarnRatio, m.warnRatio, proto.PressureCriticalRatio, m.criticalRatio)
+	}
+	return
+}
+
+// AddRelief registers the function to be called when the pressure rises to the warning level or above, such as
+// flushing the caches.
+func (m *Monitor) AddRelief(relief func()) {
+	m.reliefs = append(m.reliefs, relief)
+}
+
+// Start checks the usage at once, and then checks it periodically until the monitor is stopped.
+func (m *Monitor) Start() {
+	m.check()
+	stat := m.Stat()
+	log.LogInfof("action[pressureMonitor] module(%v) memory(%v/%v) openFiles(%v/%v) level(%v)", m.module,
+		stat.MemoryUsed, stat.MemoryLimit, stat.OpenFiles, stat.MaxOpenFiles, stat.Level)
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopC:
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic check.
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopC)
+	})
+}
+
+func ratio(used, limit uint64) float64 {
+	if limit == 0 {
+		return 0
+	}
+	return float64(used) / float64(limit)
+}
+
+func (m *Monitor) check() {
+	stat := &proto.ResourcePressure{UpdateTime: time.Now().Unix()}
+	var err error
+	if stat.MemoryUsed, stat.MemoryLimit, err = memoryUsage(); err != nil {
+		log.LogWarnf("action[pressureMonitor] module(%v) get memory usage err(%v)", m.module, err)
+	}
+	if stat.OpenFiles, stat.MaxOpenFiles, err = openFileUsage(); err != nil {
+		log.LogWarnf("action[pressureMonitor] module(%v) get open files err(%v)", m.module, err)
+	}
+	usage := ratio(stat.MemoryUsed, stat.MemoryLimit)
+	if r := ratio(stat.OpenFiles, stat.MaxOpenFiles); r > usage {
+		usage = r
+	}
+	level := levelNormal
+	if usage >= m.criticalRatio {
+		level = levelCritical
+	} else if usage >= m.warnRatio {
+		level = levelWarning
+	}
+	stat.Level = levelNames[level]
+	stat.RejectedRequests = atomic.LoadUint64(&m.rejectedRequests)
+	m.statLock.Lock()
+	m.stat = stat
+	m.statLock.Unlock()
+
+	oldLevel := atomic.SwapInt32(&m.level, level)
+	if level == oldLevel {
+		return
+	}
+	msg := fmt.Sprintf("action[pressureMonitor] module(%v) pressure changes from %v to %v, memory(%v/%v) openFiles(%v/%v)",
+		m.module, levelNames[oldLevel], stat.Level, stat.MemoryUsed, stat.MemoryLimit, stat.OpenFiles, stat.MaxOpenFiles)
+	if level < oldLevel {
+		log.LogInfo(msg)
+		return
+	}
+	log.LogWarn(msg)
+	exporter.Warning(msg)
+	for _, relief := range m.reliefs {
+		relief()
+	}
+	debug.FreeOSMemory()
+}
+
+// Critical returns true if the pressure reaches the critical level.
+func (m *Monitor) Critical() bool {
+	return atomic.LoadInt32(&m.level) == levelCritical
+}
+
+// Stat returns the latest usage and the pressure level.
+func (m *Monitor) Stat() *proto.ResourcePressure {
+	m.statLock.RLock()
+	stat := *m.stat
+	m.statLock.RUnlock()
+	stat.RejectedRequests = atomic.LoadUint64(&m.rejectedRequests)
+	return &stat
+}
+
+// Shed returns ErrBusy and counts the request as rejected if the pressure reaches the critical level. It is only
+// called for the reads and the writes of the clients, so that the requests of the master and the peers, which relieve
+// or repair the node, are always served.
+func (m *Monitor) Shed() error {
+	if !m.Critical() {
+		return nil
+	}
+	atomic.AddUint64(&m.rejectedRequests, 1)
+	return ErrBusy
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pressure
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestMonitorCheck(t *testing.T) {
+	m, err := NewMonitor("test", nil)
+	if err != nil {
+		t.Fatalf("new monitor fail cause: %v", err)
+	}
+	m.check()
+	stat := m.Stat()
+	if stat.MemoryUsed == 0 || stat.MemoryLimit == 0 || stat.OpenFiles == 0 || stat.MaxOpenFiles == 0 {
+		t.Fatalf("unexpected usage %v", stat)
+	}
+	if stat.Level != proto.PressureNormal || m.Critical() {
+		t.Fatalf("unexpected pressure level %v", stat.Level)
+	}
+
+	m.warnRatio, m.criticalRatio = 0, 0
+	relieved := false
+	m.AddRelief(func() { relieved = true })
+	m.check()
+	if !m.Critical() || !relieved {
+		t.Fatalf("pressure should be critical and relieved, stat %v", m.Stat())
+	}
+}
+
+func TestMonitorShed(t *testing.T) {
+	m, err := NewMonitor("test", nil)
+	if err != nil {
+		t.Fatalf("new monitor fail cause: %v", err)
+	}
+	m.check()
+	if err = m.Shed(); err != nil {
+		t.Fatalf("the requests should not be shed under the normal pressure, err %v", err)
+	}
+
+	m.warnRatio, m.criticalRatio = 0, 0
+	m.check()
+	if err = m.Shed(); err != ErrBusy {
+		t.Fatalf("expect ErrBusy under the critical pressure, but got %v", err)
+	}
+	// the error is replied with the action, and recovered as OpAgain by the clients
+	if code, ok := proto.ResultCodeOfMessage("ActionPreparePkt_" + err.Error()); !ok || code != proto.OpAgain {
+		t.Fatalf("expect result code OpAgain, but got %v", code)
+	}
+	if m.Stat().RejectedRequests != 1 {
+		t.Fatalf("expect 1 rejected request, but got %v", m.Stat().RejectedRequests)
+	}
+}
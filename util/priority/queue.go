@@ -0,0 +1,171 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package priority queues the requests of the priority classes in the weighted fair queues, so that the interactive
+// requests are served in time while the batch ones flood the node.
+package priority
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// DefaultWeights are the shares of the slots taken by the priority classes when all of them are waiting.
+var DefaultWeights = [proto.PriorityClassCount]int{
+	proto.PriorityNormal:      4,
+	proto.PriorityInteractive: 8,
+	proto.PriorityBatch:       1,
+}
+
+// the virtual time taken by a request of the weight 1
+const virtualTimeUnit = 1 << 20
+
+type waiter struct {
+	readyC  chan struct{}
+	enqueue time.Time
+}
+
+type class struct {
+	weight      int
+	waiters     *list.List
+	virtualTime uint64 // the virtual finish time of the last request of the class
+	served      uint64
+	waitTime    int64
+}
+
+// Queue serves at most the slots of the requests at the same time. Once all the slots are taken, the requests wait
+// in the queues of their classes, and are served by the start-time fair queuing: a request is tagged with the virtual
+// time when its class is served next, which grows inversely with the weight of the class, and the waiting request
+// with the smallest tag is served first. A class idle for a while does not save up the tags, since its tag starts
+// from the virtual time of the queue at least.
+type Queue struct {
+	module      string
+	slots       int
+	running     int
+	virtualTime uint64 // the start tag of the request served last
+	classes     [proto.PriorityClassCount]*class
+	lock        sync.Mutex
+}
+
+// NewQueue returns a new Queue with the slots configured by the key priorityQueueSlots, where the requests are not
+// queued if it is 0 or absent.
+func NewQueue(module string, cfg *config.Config) (q *Queue, err error) {
+	q = &Queue{module: module}
+	if cfg != nil {
+		q.slots = int(cfg.GetInt64(proto.PriorityQueueSlots))
+	}
+	if q.slots < 0 {
+		return nil, fmt.Errorf("invalid %v(%v), should not be negative", proto.PriorityQueueSlots, q.slots)
+	}
+	for i := range q.classes {
+		q.classes[i] = &class{weight: DefaultWeights[i], waiters: list.New()}
+	}
+	if q.slots > 0 {
+		log.LogInfof("action[priorityQueue] module(%v) slots(%v) weights(%v)", module, q.slots, DefaultWeights)
+	}
+	return
+}
+
+// Acquire waits for a slot for the request of the priority class, and returns the function to release the slot
+// once the request is done. The unknown classes are taken as proto.PriorityNormal.
+func (q *Queue) Acquire(priority uint8) (release func()) {
+	if q == nil || q.slots == 0 {
+		return func() {}
+	}
+	if int(priority) >= proto.PriorityClassCount {
+		priority = proto.PriorityNormal
+	}
+	c := q.classes[priority]
+	q.lock.Lock()
+	if q.running < q.slots && q.waiting() == 0 {
+		q.serve(c, time.Now())
+		q.lock.Unlock()
+		return q.release
+	}
+	w := &waiter{readyC: make(chan struct{}), enqueue: time.Now()}
+	c.waiters.PushBack(w)
+	q.lock.Unlock()
+	<-w.readyC
+	return q.release
+}
+
+func (q *Queue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.running--
+	for q.running < q.slots {
+		var next *class
+		for _, c := range q.classes {
+			if c.waiters.Len() == 0 {
+				continue
+			}
+			if next == nil || q.startTag(c) < q.startTag(next) {
+				next = c
+			}
+		}
+		if next == nil {
+			return
+		}
+		w := next.waiters.Remove(next.waiters.Front()).(*waiter)
+		q.serve(next, w.enqueue)
+		close(w.readyC)
+	}
+}
+
+func (q *Queue) startTag(c *class) uint64 {
+	if c.virtualTime > q.virtualTime {
+		return c.virtualTime
+	}
+	return q.virtualTime
+}
+
+// serve takes a slot for the request of the class enqueued at the time. The caller holds the lock.
+func (q *Queue) serve(c *class, enqueue time.Time) {
+	start := q.startTag(c)
+	q.virtualTime = start
+	c.virtualTime = start + uint64(virtualTimeUnit/c.weight)
+	c.served++
+	c.waitTime += int64(time.Since(enqueue))
+	q.running++
+}
+
+func (q *Queue) waiting() (waiting int) {
+	for _, c := range q.classes {
+		waiting += c.waiters.Len()
+	}
+	return
+}
+
+// Stat returns the requests served and waiting in the queues.
+func (q *Queue) Stat() *proto.PriorityQueueStat {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	stat := &proto.PriorityQueueStat{Slots: q.slots, Running: q.running}
+	for i, c := range q.classes {
+		stat.Classes = append(stat.Classes, &proto.PriorityClassStat{
+			Name:     proto.PriorityNames[i],
+			Weight:   c.weight,
+			Waiting:  c.waiters.Len(),
+			Served:   c.served,
+			WaitTime: c.waitTime,
+		})
+	}
+	return stat
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package priority
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestQueueDisabled(t *testing.T) {
+	q, err := NewQueue("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		q.Acquire(proto.PriorityBatch)
+	}
+	if stat := q.Stat(); stat.Running != 0 {
+		t.Fatalf("requests are queued while disabled, stat %v", stat)
+	}
+}
+
+func TestQueueWeightedFair(t *testing.T) {
+	q, _ := NewQueue("test", nil)
+	q.slots = 1
+	// take the only slot, and queue the requests of both classes behind it
+	release := q.Acquire(proto.PriorityNormal)
+	const requests = 90
+	var (
+		order []uint8
+		lock  sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for _, priority := range []uint8{proto.PriorityBatch, proto.PriorityInteractive} {
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(priority uint8) {
+				defer wg.Done()
+				done := q.Acquire(priority)
+				lock.Lock()
+				order = append(order, priority)
+				lock.Unlock()
+				done()
+			}(priority)
+		}
+	}
+	for q.Stat().Classes[proto.PriorityBatch].Waiting+q.Stat().Classes[proto.PriorityInteractive].Waiting < 2*requests {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	wg.Wait()
+
+	// the interactive requests take 8 of each 9 slots until they are drained
+	interactive := 0
+	for _, priority := range order[:requests] {
+		if priority == proto.PriorityInteractive {
+			interactive++
+		}
+	}
+	if interactive < requests*8/9-2 {
+		t.Fatalf("interactive requests(%v) of the first %v served are fewer than the weight", interactive, requests)
+	}
+	stat := q.Stat()
+	if stat.Running != 0 || stat.Classes[proto.PriorityBatch].Served != requests {
+		t.Fatalf("unexpected stat %v", stat)
+	}
+}
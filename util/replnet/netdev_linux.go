@@ -0,0 +1,61 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replnet
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const procNetDev = "/proc/net/dev"
+
+func readNetDev() (counters map[string]netDevCounters, err error) {
+	fp, err := os.Open(procNetDev)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	return parseNetDev(fp)
+}
+
+// parseNetDev parses the counters of the interfaces, two lines of the headers followed by a line of each interface:
+// "name: rx-bytes rx-packets rx-errs rx-drop rx-fifo rx-frame rx-compressed rx-multicast tx-bytes ...".
+func parseNetDev(r io.Reader) (counters map[string]netDevCounters, err error) {
+	counters = make(map[string]netDevCounters)
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		parts := strings.SplitN(scan.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
+		}
+		var c netDevCounters
+		if c.rxBytes, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return
+		}
+		if c.txBytes, err = strconv.ParseUint(fields[8], 10, 64); err != nil {
+			return
+		}
+		counters[strings.TrimSpace(parts[0])] = c
+	}
+	err = scan.Err()
+	return
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package replnet separates the replication and the repair traffic between the nodes from the client traffic on the
+// nodes with dual network interfaces, and reports the throughput of each interface.
+package replnet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultResolveExpiration = time.Minute
+	DefaultSampleInterval    = 10 * time.Second
+)
+
+// Resolver resolves the replication IPs of the peers from the node views of the cluster, which are looked up from
+// the master at most once within the expiration. A peer without the replication IP is reached by its own address.
+// A nil Resolver resolves every address to itself, so that a node without the replication interface never sends to
+// the replication interfaces of its peers, which may be unreachable from it.
+type Resolver struct {
+	lookup     func() ([]proto.NodeView, error)
+	expiration time.Duration
+	mu         sync.Mutex
+	replicaIPs map[string]string // key: the host of the node, value: its replication IP
+	updateTime time.Time
+}
+
+// NewResolver returns a new Resolver looking up the node views by the function.
+func NewResolver(lookup func() ([]proto.NodeView, error)) *Resolver {
+	return &Resolver{
+		lookup:     lookup,
+		expiration: DefaultResolveExpiration,
+		replicaIPs: make(map[string]string),
+	}
+}
+
+// ReplicaIP returns the replication IP of the node on the host, or the host itself if the node has none.
+func (r *Resolver) ReplicaIP(host string) string {
+	if r == nil {
+		return host
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.updateTime) > r.expiration {
+		r.refresh()
+	}
+	if ip, ok := r.replicaIPs[host]; ok {
+		return ip
+	}
+	return host
+}
+
+// ReplicaAddr replaces the host of the address "host:port" with the replication IP of the node on the host.
+func (r *Resolver) ReplicaAddr(addr string) string {
+	if r == nil {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return net.JoinHostPort(r.ReplicaIP(host), port)
+}
+
+// refresh keeps the replication IPs resolved before if the lookup fails, and retries it after the expiration.
+func (r *Resolver) refresh() {
+	r.updateTime = time.Now()
+	views, err := r.lookup()
+	if err != nil {
+		log.LogWarnf("action[replicaResolver] lookup the nodes err(%v)", err)
+		return
+	}
+	replicaIPs := make(map[string]string, len(views))
+	for _, view := range views {
+		if view.ReplicaIP == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(view.Addr)
+		if err != nil {
+			host = view.Addr
+		}
+		replicaIPs[host] = view.ReplicaIP
+	}
+	r.replicaIPs = replicaIPs
+}
+
+// CheckLocalIP returns an error if the IP is not an address of any network interface of this node.
+func CheckLocalIP(ip string) (err error) {
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid %v(%v)", proto.ReplicaIP, ip)
+	}
+	if _, err = interfaceOf(ip); err != nil {
+		return fmt.Errorf("invalid %v(%v): %v", proto.ReplicaIP, ip, err)
+	}
+	return
+}
+
+// interfaceOf returns the name of the network interface with the IP.
+func interfaceOf(ip string) (name string, err error) {
+	target := net.ParseIP(ip)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(target) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no network interface with the address %v", ip)
+}
+
+type netDevCounters struct {
+	rxBytes uint64
+	txBytes uint64
+}
+
+// Monitor samples the counters of the network interfaces serving the client and the replication traffic
+// periodically, and derives their throughput.
+type Monitor struct {
+	module     string
+	interval   time.Duration
+	interfaces []*proto.InterfaceThroughput // the names, the IPs and the roles of the monitored interfaces
+	last       map[string]netDevCounters
+	lastTime   time.Time
+	stat       []*proto.InterfaceThroughput
+	statLock   sync.RWMutex
+	stopC      chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewMonitor returns a new Monitor of the interfaces with the local IP and the replication IP. The replication IP
+// may be empty, or share the interface with the local IP.
+func NewMonitor(module, localIP, replicaIP string) (m *Monitor) {
+	m = &Monitor{
+		module:   module,
+		interval: DefaultSampleInterval,
+		last:     make(map[string]netDevCounters),
+		stopC:    make(chan struct{}),
+	}
+	m.addInterface(localIP, proto.InterfaceRoleClient)
+	m.addInterface(replicaIP, proto.InterfaceRoleReplica)
+	return
+}
+
+func (m *Monitor) addInterface(ip, role string) {
+	if ip == "" {
+		return
+	}
+	name, err := interfaceOf(ip)
+	if err != nil {
+		log.LogWarnf("action[netMonitor] module(%v) %v interface of %v is not monitored: %v", m.module, role, ip, err)
+		return
+	}
+	for _, iface := range m.interfaces {
+		if iface.Name == name {
+			iface.Roles = append(iface.Roles, role)
+			return
+		}
+	}
+	m.interfaces = append(m.interfaces, &proto.InterfaceThroughput{Name: name, IP: ip, Roles: []string{role}})
+}
+
+// Start samples the counters at once, and then samples them periodically until the monitor is stopped.
+func (m *Monitor) Start() {
+	m.sample()
+	for _, iface := range m.interfaces {
+		log.LogInfof("action[netMonitor] module(%v) monitor interface(%v) ip(%v) roles(%v)", m.module, iface.Name,
+			iface.IP, iface.Roles)
+	}
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopC:
+				return
+			case <-ticker.C:
+				m.sample()
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic sampling.
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopC)
+	})
+}
+
+func (m *Monitor) sample() {
+	if len(m.interfaces) == 0 {
+		return
+	}
+	counters, err := readNetDev()
+	if err != nil {
+		log.LogWarnf("action[netMonitor] module(%v) read the interface counters err(%v)", m.module, err)
+		return
+	}
+	m.update(counters, time.Now())
+}
+
+func (m *Monitor) update(counters map[string]netDevCounters, now time.Time) {
+	elapsed := now.Sub(m.lastTime).Seconds()
+	stat := make([]*proto.InterfaceThroughput, 0, len(m.interfaces))
+	for _, iface := range m.interfaces {
+		cur, ok := counters[iface.Name]
+		if !ok {
+			continue
+		}
+		tp := *iface
+		tp.RxBytes, tp.TxBytes, tp.UpdateTime = cur.rxBytes, cur.txBytes, now.Unix()
+		// the counters are reset if the interface goes down and up again
+		if last, ok := m.last[iface.Name]; ok && elapsed > 0 && cur.rxBytes >= last.rxBytes && cur.txBytes >= last.txBytes {
+			tp.RxBytesPerSec = uint64(float64(cur.rxBytes-last.rxBytes) / elapsed)
+			tp.TxBytesPerSec = uint64(float64(cur.txBytes-last.txBytes) / elapsed)
+		}
+		m.last[iface.Name] = cur
+		stat = append(stat, &tp)
+	}
+	m.lastTime = now
+	m.statLock.Lock()
+	m.stat = stat
+	m.statLock.Unlock()
+}
+
+// Stat returns the throughput of the monitored interfaces within the latest sample interval.
+func (m *Monitor) Stat() []*proto.InterfaceThroughput {
+	m.statLock.RLock()
+	defer m.statLock.RUnlock()
+	return m.stat
+}
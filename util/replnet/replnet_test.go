@@ -0,0 +1,110 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replnet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestResolver(t *testing.T) {
+	var (
+		lookups int
+		fail    bool
+	)
+	r := NewResolver(func() ([]proto.NodeView, error) {
+		lookups++
+		if fail {
+			return nil, errors.New("master unavailable")
+		}
+		return []proto.NodeView{
+			{Addr: "192.168.0.1:17310", ReplicaIP: "10.0.0.1"},
+			{Addr: "192.168.0.2:17310"},
+		}, nil
+	})
+	if addr := r.ReplicaAddr("192.168.0.1:17310"); addr != "10.0.0.1:17310" {
+		t.Fatalf("expect the replication address 10.0.0.1:17310, but got %v", addr)
+	}
+	if ip := r.ReplicaIP("192.168.0.2"); ip != "192.168.0.2" {
+		t.Fatalf("the node without the replication IP should be reached by its own address, but got %v", ip)
+	}
+	if lookups != 1 {
+		t.Fatalf("the nodes should be looked up once within the expiration, but looked up %v times", lookups)
+	}
+
+	fail = true
+	r.updateTime = time.Now().Add(-2 * r.expiration)
+	if ip := r.ReplicaIP("192.168.0.1"); ip != "10.0.0.1" || lookups != 2 {
+		t.Fatalf("the resolved IPs should be kept if the lookup fails, but got %v after %v lookups", ip, lookups)
+	}
+
+	var nilResolver *Resolver
+	if addr := nilResolver.ReplicaAddr("192.168.0.1:17310"); addr != "192.168.0.1:17310" {
+		t.Fatalf("a nil resolver should resolve the address to itself, but got %v", addr)
+	}
+}
+
+func TestMonitorUpdate(t *testing.T) {
+	const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth1: 5000000    4000    0    0    0     0          0         0  2000000    3000    0    0    0     0       0          0
+`
+	counters, err := parseNetDev(strings.NewReader(netDev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := counters["eth1"]; c.rxBytes != 5000000 || c.txBytes != 2000000 {
+		t.Fatalf("unexpected counters of eth1 %v", c)
+	}
+
+	m := &Monitor{last: make(map[string]netDevCounters)}
+	m.interfaces = []*proto.InterfaceThroughput{{Name: "eth1", IP: "10.0.0.1", Roles: []string{proto.InterfaceRoleReplica}}}
+	now := time.Now()
+	m.update(counters, now)
+	if stat := m.Stat(); len(stat) != 1 || stat[0].RxBytes != 5000000 || stat[0].RxBytesPerSec != 0 {
+		t.Fatalf("the throughput is unknown at the first sample, but got %v", stat)
+	}
+	counters["eth1"] = netDevCounters{rxBytes: 7000000, txBytes: 3000000}
+	m.update(counters, now.Add(10*time.Second))
+	if stat := m.Stat(); stat[0].RxBytesPerSec != 200000 || stat[0].TxBytesPerSec != 100000 {
+		t.Fatalf("unexpected throughput %v", stat[0])
+	}
+	// the counters are reset
+	counters["eth1"] = netDevCounters{rxBytes: 100, txBytes: 100}
+	m.update(counters, now.Add(20*time.Second))
+	if stat := m.Stat(); stat[0].RxBytesPerSec != 0 || stat[0].TxBytesPerSec != 0 {
+		t.Fatalf("the throughput should be unknown after the counters are reset, but got %v", stat[0])
+	}
+}
+
+func TestMonitorLoopback(t *testing.T) {
+	if err := CheckLocalIP("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckLocalIP("192.0.2.1"); err == nil {
+		t.Fatalf("the address of the documentation should not be local")
+	}
+	m := NewMonitor("test", "127.0.0.1", "127.0.0.1")
+	m.sample()
+	stat := m.Stat()
+	if len(stat) != 1 || len(stat[0].Roles) != 2 {
+		t.Fatalf("the shared interface should be reported once with both roles, but got %v", stat)
+	}
+}